@@ -98,6 +98,13 @@ func (br *BinaryReader) ReadString() (string, error) {
 	return string(buffer), nil
 }
 
+// ReadBytes reads n raw bytes from the binary stream
+func (br *BinaryReader) ReadBytes(n int) ([]byte, error) {
+	buffer := make([]byte, n)
+	_, err := io.ReadFull(br.reader, buffer)
+	return buffer, err
+}
+
 // BinaryWriter provides binary writing functionality
 type BinaryWriter struct {
 	writer io.Writer
@@ -134,6 +141,12 @@ func (bw *BinaryWriter) WriteString(value string) error {
 	return err
 }
 
+// WriteBytes writes raw bytes to the binary stream
+func (bw *BinaryWriter) WriteBytes(value []byte) error {
+	_, err := bw.writer.Write(value)
+	return err
+}
+
 // BinaryFormat represents the binary format structure
 type BinaryFormat struct {
 	Version    uint32
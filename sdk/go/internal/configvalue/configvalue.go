@@ -0,0 +1,26 @@
+// Package configvalue converts the values of a loaded configuration for
+// the packages that read settings out of it. It is internal: programs
+// using the SDK cannot reach it.
+package configvalue
+
+import "fmt"
+
+// StringList converts a string or array value to a list of strings; the
+// items of an array must be strings
+func StringList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected strings, got %v", item)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("expected a string or array, got %v", value)
+}
@@ -0,0 +1,79 @@
+// Package dbprobe finds the database a connection string points at, for
+// tsk doctor and the health probes of servers to check that it can be
+// reached. It is internal: programs using the SDK cannot reach it.
+package dbprobe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Adapters are the [database] sections a connection string is looked up in
+var Adapters = []string{"sqlite", "postgresql", "mysql", "mongodb", "redis"}
+
+// defaultPorts are the ports of servers whose connection string has none
+var defaultPorts = map[string]string{
+	"postgresql": "5432",
+	"postgres":   "5432",
+	"mysql":      "3306",
+	"mongodb":    "27017",
+	"redis":      "6379",
+	"rediss":     "6379",
+}
+
+var (
+	// ErrUnreadable is a connection string that is neither sqlite:<path>
+	// nor a URL with a host
+	ErrUnreadable = errors.New("cannot read the connection string")
+	// ErrUnknownScheme is a URL of a server that is not a known database
+	ErrUnknownScheme = errors.New("unknown database scheme")
+)
+
+// Target is the database of a connection string: a SQLite file, or a
+// server at Addr
+type Target struct {
+	// SQLite is the path of a SQLite database; the other fields are
+	// empty then
+	SQLite string
+	URL    *url.URL
+	// Addr is host:port, with the default port of the scheme when the
+	// URL has none
+	Addr string
+}
+
+// Parse returns the target of dsn
+func Parse(dsn string) (Target, error) {
+	if path, ok := strings.CutPrefix(dsn, "sqlite:"); ok {
+		return Target{SQLite: strings.TrimPrefix(path, "//")}, nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || u.Host == "" {
+		return Target{}, ErrUnreadable
+	}
+	port, known := defaultPorts[u.Scheme]
+	if !known {
+		return Target{}, fmt.Errorf("%w %q", ErrUnknownScheme, u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return Target{URL: u, Addr: net.JoinHostPort(u.Hostname(), port)}, nil
+}
+
+// Redis reports whether t is a Redis server, which answers PING
+func (t Target) Redis() bool {
+	return t.URL != nil && (t.URL.Scheme == "redis" || t.URL.Scheme == "rediss")
+}
+
+// Dial checks that the server of t accepts TCP connections
+func (t Target) Dial(ctx context.Context) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", t.Addr)
+	if err != nil {
+		return fmt.Errorf("%s is unreachable: %w", t.URL.Redacted(), err)
+	}
+	return conn.Close()
+}
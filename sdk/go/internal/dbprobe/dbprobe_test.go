@@ -0,0 +1,27 @@
+package dbprobe
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		dsn, sqlite, addr string
+		err               error
+	}{
+		{dsn: "sqlite:///var/lib/app.db", sqlite: "/var/lib/app.db"},
+		{dsn: "sqlite:app.db", sqlite: "app.db"},
+		{dsn: "postgres://u:p@db.internal/app", addr: "db.internal:5432"},
+		{dsn: "mysql://db.internal:3307/app", addr: "db.internal:3307"},
+		{dsn: "redis://cache.internal", addr: "cache.internal:6379"},
+		{dsn: "rediss://cache.internal/0", addr: "cache.internal:6379"},
+		{dsn: "cassandra://db.internal", err: ErrUnknownScheme},
+		{dsn: "not a url", err: ErrUnreadable},
+	} {
+		target, err := Parse(tt.dsn)
+		if !errors.Is(err, tt.err) || target.SQLite != tt.sqlite || target.Addr != tt.addr {
+			t.Errorf("Parse(%q) = %+v, %v; want sqlite %q, addr %q, %v", tt.dsn, target, err, tt.sqlite, tt.addr, tt.err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+//go:build integration
+
+package integration
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func TestPostgres(t *testing.T) {
+	db, err := sql.Open("postgres", Require(t, "postgres"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Ping() returned error: %v", err)
+	}
+	if _, err := db.Exec(`CREATE TEMP TABLE tsk_it (key TEXT PRIMARY KEY, value INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO tsk_it (key, value) VALUES ($1, $2)`, "port", 8080); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rolled back write must not be visible
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`UPDATE tsk_it SET value = 9090 WHERE key = 'port'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	var value int
+	if err := db.QueryRow(`SELECT value FROM tsk_it WHERE key = $1`, "port").Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	if value != 8080 {
+		t.Errorf("value = %d after rollback, want 8080", value)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	conn, r := dial(t, Require(t, "redis"))
+	defer conn.Close()
+
+	command := func(args ...string) string {
+		t.Helper()
+		fmt.Fprintf(conn, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+		line := readLine(t, r)
+		if strings.HasPrefix(line, "$") && line != "$-1" {
+			return readLine(t, r)
+		}
+		return line
+	}
+
+	if got := command("PING"); got != "+PONG" {
+		t.Fatalf("PING = %q", got)
+	}
+	if got := command("SET", "tsk:it", "peanut", "EX", "60"); got != "+OK" {
+		t.Fatalf("SET = %q", got)
+	}
+	if got := command("GET", "tsk:it"); got != "peanut" {
+		t.Errorf("GET = %q, want peanut", got)
+	}
+	if got := command("DEL", "tsk:it"); got != ":1" {
+		t.Errorf("DEL = %q, want :1", got)
+	}
+	if got := command("GET", "tsk:it"); got != "$-1" {
+		t.Errorf("GET after DEL = %q, want nil", got)
+	}
+}
+
+func TestMemcached(t *testing.T) {
+	conn, r := dial(t, Require(t, "memcached"))
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "set tsk_it 0 60 6\r\npeanut\r\n")
+	if got := readLine(t, r); got != "STORED" {
+		t.Fatalf("set = %q", got)
+	}
+
+	fmt.Fprintf(conn, "get tsk_it\r\n")
+	if got := readLine(t, r); got != "VALUE tsk_it 0 6" {
+		t.Fatalf("get header = %q", got)
+	}
+	if got := readLine(t, r); got != "peanut" {
+		t.Errorf("get = %q, want peanut", got)
+	}
+	if got := readLine(t, r); got != "END" {
+		t.Errorf("get trailer = %q", got)
+	}
+}
+
+func TestMinIO(t *testing.T) {
+	endpoint := strings.TrimRight(Require(t, "minio"), "/")
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Get(endpoint + "/minio/health/live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("health check returned %s", resp.Status)
+	}
+
+	// Anonymous requests must be refused
+	resp, err = client.Get(endpoint + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("anonymous ListBuckets returned %s, want 403", resp.Status)
+	}
+}
+
+func dial(t *testing.T, address string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func readLine(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
@@ -0,0 +1,36 @@
+// Package licensekey lets this module's tests replace the license server
+// key built into the binary, so they can sign responses of their own. It
+// is internal: programs using the SDK cannot reach it.
+package licensekey
+
+import (
+	"crypto/ed25519"
+	"sync"
+)
+
+var (
+	mu       sync.RWMutex
+	override ed25519.PublicKey
+)
+
+// Set makes key the license server key of licenses created from now on
+// and returns a function restoring the previous one
+func Set(key ed25519.PublicKey) (restore func()) {
+	mu.Lock()
+	previous := override
+	override = key
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		override = previous
+		mu.Unlock()
+	}
+}
+
+// Override returns the key Set replaced the built-in one with; nil when
+// there is none
+func Override() ed25519.PublicKey {
+	mu.RLock()
+	defer mu.RUnlock()
+	return override
+}
@@ -0,0 +1,63 @@
+// Package licensetest verifies license keys in tests against a license
+// server of their own, so capabilities unlock the way they do once the
+// real server has verified a key.
+package licensetest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/internal/licensekey"
+	"github.com/cyber-boost/tusktsk/license"
+)
+
+// Grant has a license server verify key with tier and features, as
+// tsk license features does. license.ForKey(key) keeps the verified
+// response, and the offline cache under $HOME keeps it for other
+// instances, so tests set HOME first. The key must not have been looked
+// up before, or its license would not trust the test server.
+func Grant(t testing.TB, key, tier string, features ...string) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(licensekey.Set(public))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			LicenseKey string `json:"license_key"`
+			Nonce      string `json:"nonce"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hash := sha256.Sum256([]byte(request.LicenseKey))
+		payload, _ := json.Marshal(map[string]interface{}{
+			"license_key_hash": hex.EncodeToString(hash[:]),
+			"nonce":            request.Nonce,
+			"issued_at":        time.Now().Unix(),
+			"tier":             tier,
+			"features":         features,
+		})
+		json.NewEncoder(w).Encode(license.SignedResponse{
+			Payload:   base64.StdEncoding.EncodeToString(payload),
+			Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(private, payload)),
+		})
+	}))
+	defer server.Close()
+
+	if _, err := license.ForKey(key).VerifyLicenseServer(server.URL); err != nil {
+		t.Fatal(fmt.Errorf("licensetest: verifying %s: %w", key, err))
+	}
+}
@@ -0,0 +1,204 @@
+package license
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+// KeyEnv holds the license key when the configuration has none
+const KeyEnv = "TSK_LICENSE_KEY"
+
+// License tiers, each unlocking the capabilities of the ones before it
+const (
+	TierCore       = "core"
+	TierPremium    = "premium"
+	TierEnterprise = "enterprise"
+)
+
+// Capabilities of the premium subsystems
+const (
+	CapabilityDistributedCache = "distributed_cache"
+	CapabilityAI               = "ai"
+	CapabilityRBAC             = "rbac"
+)
+
+// tierRank orders the tiers
+var tierRank = map[string]int{TierCore: 0, TierPremium: 1, TierEnterprise: 2}
+
+// Capability is a subsystem a license may unlock. Only a response of the
+// license server that verified, see TuskLicense.Verified, unlocks it: by
+// listing its name among the features of the key, or a tier at least as
+// high as Tier. What the key itself says counts for nothing.
+type Capability struct {
+	Name        string `json:"name"`
+	Tier        string `json:"tier"`
+	Description string `json:"description"`
+	// Setting is what turns the capability on, for upgrade errors
+	Setting string `json:"setting,omitempty"`
+}
+
+// FeatureStatus is whether a license unlocks a capability, and why not
+type FeatureStatus struct {
+	Capability
+	Unlocked bool   `json:"unlocked"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Registry holds the capabilities premium subsystems consult before
+// they start
+type Registry struct {
+	mu           sync.RWMutex
+	capabilities map[string]Capability
+}
+
+// NewRegistry creates a registry of capabilities
+func NewRegistry(capabilities ...Capability) *Registry {
+	r := &Registry{capabilities: make(map[string]Capability)}
+	for _, c := range capabilities {
+		r.Register(c)
+	}
+	return r
+}
+
+// DefaultRegistry holds the capabilities of the SDK's premium subsystems
+var DefaultRegistry = NewRegistry(
+	Capability{Name: CapabilityDistributedCache, Tier: TierPremium, Setting: `cache.backend: "redis", or a tiered cache with an l3`,
+		Description: "@cache shared through Redis or memcached"},
+	Capability{Name: CapabilityAI, Tier: TierPremium, Setting: "tsk ai",
+		Description: "AI assistance commands"},
+	Capability{Name: CapabilityRBAC, Tier: TierEnterprise, Setting: "access.policy.tsk",
+		Description: "Role-based access control of commands and API routes"},
+)
+
+// Register adds a capability, replacing one of the same name
+func (r *Registry) Register(c Capability) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.capabilities[c.Name] = c
+}
+
+// Capabilities returns the registered capabilities by tier, then name
+func (r *Registry) Capabilities() []Capability {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	capabilities := make([]Capability, 0, len(r.capabilities))
+	for _, c := range r.capabilities {
+		capabilities = append(capabilities, c)
+	}
+	sort.Slice(capabilities, func(i, j int) bool {
+		a, b := capabilities[i], capabilities[j]
+		if tierRank[a.Tier] != tierRank[b.Tier] {
+			return tierRank[a.Tier] < tierRank[b.Tier]
+		}
+		return a.Name < b.Name
+	})
+	return capabilities
+}
+
+// Check returns nil when l unlocks the capability name, or a License
+// error saying what it needs; l may be nil when no key is set
+func (r *Registry) Check(l *TuskLicense, name string) error {
+	r.mu.RLock()
+	c, ok := r.capabilities[name]
+	r.mu.RUnlock()
+	if !ok {
+		return tskerrors.New(tskerrors.NotFound, "unknown capability: %s", name)
+	}
+	if reason := c.locked(l); reason != "" {
+		what := c.Description
+		if c.Setting != "" {
+			what += " (" + c.Setting + ")"
+		}
+		return tskerrors.New(tskerrors.License, "%s needs a license of the %s tier: %s; tsk license features lists what the key unlocks", what, c.Tier, reason)
+	}
+	return nil
+}
+
+// Require checks the capability name against the Current license
+func (r *Registry) Require(name string) error {
+	return r.Check(Current(), name)
+}
+
+// Features returns every capability and whether l unlocks it
+func (r *Registry) Features(l *TuskLicense) []FeatureStatus {
+	capabilities := r.Capabilities()
+	features := make([]FeatureStatus, len(capabilities))
+	for i, c := range capabilities {
+		reason := c.locked(l)
+		features[i] = FeatureStatus{Capability: c, Unlocked: reason == "", Reason: reason}
+	}
+	return features
+}
+
+// locked returns why l does not unlock c, "" when it does
+func (c Capability) locked(l *TuskLicense) string {
+	if tierRank[c.Tier] == tierRank[TierCore] {
+		return ""
+	}
+	if l == nil {
+		return "no license key is set (license.key or $" + KeyEnv + ")"
+	}
+	if result := l.ValidateLicenseKey(); !result.Valid {
+		return "the license key is malformed: " + strings.ToLower(result.Error)
+	}
+	if expiration := l.CheckLicenseExpiration(); expiration.Expired {
+		if expiration.ExpirationDate == "" {
+			return "the license key has no valid expiration"
+		}
+		return "the license expired on " + expiration.ExpirationDate + "; renew it"
+	}
+	data, err := l.Verified()
+	if err != nil {
+		return err.Error() + "; tsk license features verifies it while the license server is reachable"
+	}
+	if features, ok := data["features"].([]interface{}); ok {
+		for _, feature := range features {
+			if feature == c.Name {
+				return ""
+			}
+		}
+	}
+	if tier, ok := data["tier"].(string); ok {
+		if rank, ok := tierRank[tier]; ok && rank >= tierRank[c.Tier] {
+			return ""
+		}
+	}
+	return "the license does not include it; upgrade to " + c.Tier
+}
+
+var (
+	keyedMu       sync.Mutex
+	keyedLicenses = make(map[string]*TuskLicense)
+)
+
+// ForKey returns the license of key, shared by every caller of the same
+// key so its cache is loaded once; nil when key is empty
+func ForKey(key string) *TuskLicense {
+	if key == "" {
+		return nil
+	}
+	keyedMu.Lock()
+	defer keyedMu.Unlock()
+	l, ok := keyedLicenses[key]
+	if !ok {
+		l = New(key, "")
+		keyedLicenses[key] = l
+	}
+	return l
+}
+
+// Current returns the license InitializeLicense set, else the one of
+// $TSK_LICENSE_KEY; nil when there is neither
+func Current() *TuskLicense {
+	instanceMutex.RLock()
+	l := licenseInstance
+	instanceMutex.RUnlock()
+	if l != nil {
+		return l
+	}
+	return ForKey(os.Getenv(KeyEnv))
+}
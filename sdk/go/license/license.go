@@ -4,14 +4,22 @@
 package license
 
 import (
+	"context"
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	mathrand "math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -20,9 +28,122 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cyber-boost/tusktsk/internal/licensekey"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
 	"github.com/google/uuid"
 )
 
+// Defaults of Options
+const (
+	DefaultServerURL = "https://api.tusklang.org/v1/license"
+	// DefaultGracePeriod is how long a verified license is used offline
+	// while the server cannot be reached
+	DefaultGracePeriod = 7 * 24 * time.Hour
+	// DefaultClockSkew is how far the local clock may be off from the
+	// server's before times are held against the license
+	DefaultClockSkew     = 5 * time.Minute
+	DefaultMaxRetries    = 3
+	DefaultRetryDelay    = 500 * time.Millisecond
+	DefaultMaxRetryDelay = 30 * time.Second
+)
+
+// serverPublicKey is the Ed25519 key the license server signs its
+// responses with, as the base64 PKIX DER inside its PEM block. It is built
+// into the binary rather than read at run time, so a licensee cannot swap
+// in a key of their own and sign responses with it. Release builds set it:
+//
+//	go build -ldflags "-X github.com/cyber-boost/tusktsk/license.serverPublicKey=MCowBQYDK2VwAyEA..."
+//
+// A build without it refuses every response.
+var serverPublicKey string
+
+// ServerPublicKey returns the license server key built into the binary
+func ServerPublicKey() (ed25519.PublicKey, error) {
+	if key := licensekey.Override(); key != nil {
+		return key, nil
+	}
+	if serverPublicKey == "" {
+		return nil, tskerrors.New(tskerrors.License, "this build has no license server key; release builds set license.serverPublicKey with -ldflags -X")
+	}
+	return parsePublicKey(serverPublicKey)
+}
+
+// parsePublicKey reads an Ed25519 key given as PKIX PEM, or as the base64
+// DER of its PEM block
+func parsePublicKey(value string) (ed25519.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		der, err = block.Bytes, nil
+	}
+	if err != nil {
+		return nil, tskerrors.New(tskerrors.License, "license server public key is neither PEM nor base64: %v", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, tskerrors.New(tskerrors.License, "license server public key: %v", err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, tskerrors.New(tskerrors.License, "license server public key is %T, not Ed25519", key)
+	}
+	return pub, nil
+}
+
+// Options tunes how a TuskLicense verifies its key. Zero values take the
+// defaults.
+type Options struct {
+	// CacheDir holds the offline cache; ~/.tusk/license_cache by default
+	CacheDir string
+	// GracePeriod is how long after the server last verified the license
+	// the offline cache stands in for it; negative disables the cache
+	GracePeriod time.Duration
+	// ClockSkew is the tolerance of expiration and issue time checks
+	ClockSkew time.Duration
+	// MaxRetries is how often a request that failed with a network error,
+	// 408, 429 or a 5xx status is sent again; negative sends it once
+	MaxRetries int
+	// RetryDelay is the wait before the first retry, doubled for every
+	// retry up to MaxRetryDelay, with up to half of it taken off at random
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	HTTPClient    *http.Client
+	// publicKey replaces the ServerPublicKey responses are verified with.
+	// Only this package's tests set it, to sign with a key of their own.
+	publicKey ed25519.PublicKey
+}
+
+// withDefaults fills in the zero values of o
+func (o Options) withDefaults() Options {
+	if o.GracePeriod == 0 {
+		o.GracePeriod = DefaultGracePeriod
+	}
+	if o.ClockSkew == 0 {
+		o.ClockSkew = DefaultClockSkew
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = DefaultMaxRetries
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = DefaultRetryDelay
+	}
+	if o.MaxRetryDelay <= 0 {
+		o.MaxRetryDelay = DefaultMaxRetryDelay
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return o
+}
+
+// SignedResponse is the body of a license server response: Payload is the
+// base64 JSON of the license data and Signature its base64 Ed25519
+// signature. The payload holds license_key_hash, the hex SHA-256 of the
+// key, issued_at in Unix seconds, and the nonce of the request.
+type SignedResponse struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
 // LicenseInfo represents comprehensive license information
 type LicenseInfo struct {
 	LicenseKey      string                 `json:"license_key"`
@@ -63,8 +184,8 @@ type ValidationAttempt struct {
 
 // ExpirationWarning represents an expiration warning
 type ExpirationWarning struct {
-	Timestamp      int64 `json:"timestamp"`
-	DaysRemaining  int64 `json:"days_remaining"`
+	Timestamp     int64 `json:"timestamp"`
+	DaysRemaining int64 `json:"days_remaining"`
 }
 
 // TuskLicense provides license validation functionality
@@ -80,15 +201,23 @@ type TuskLicense struct {
 	cacheDir           string
 	cacheFile          string
 	offlineCache       *OfflineCacheData
+	offlineOnce        sync.Once
 	logger             *log.Logger
+	opts               Options
+	keyErr             error
+	now                func() time.Time
+	sleep              func(ctx context.Context, d time.Duration) error
 }
 
-// OfflineCacheData represents offline cached license data
+// OfflineCacheData represents offline cached license data. Response is
+// the signed server response LicenseData was read from; it is verified
+// again before the cache is used.
 type OfflineCacheData struct {
 	LicenseKeyHash string                 `json:"license_key_hash"`
 	LicenseData    map[string]interface{} `json:"license_data"`
 	Timestamp      int64                  `json:"timestamp"`
 	Expiration     ExpirationResult       `json:"expiration"`
+	Response       SignedResponse         `json:"response"`
 }
 
 // LicenseCacheEntry represents cached license data
@@ -100,20 +229,24 @@ type LicenseCacheEntry struct {
 
 // New creates a new TuskLicense instance
 func New(licenseKey, apiKey string) *TuskLicense {
-	return NewWithCacheDir(licenseKey, apiKey, "")
+	return NewWithOptions(licenseKey, apiKey, Options{})
 }
 
 // NewWithCacheDir creates a new TuskLicense instance with custom cache directory
 func NewWithCacheDir(licenseKey, apiKey, cacheDir string) *TuskLicense {
+	return NewWithOptions(licenseKey, apiKey, Options{CacheDir: cacheDir})
+}
+
+// NewWithOptions creates a new TuskLicense instance with custom options
+func NewWithOptions(licenseKey, apiKey string, opts Options) *TuskLicense {
+	opts = opts.withDefaults()
 	// Set up cache directory
+	cacheDir := opts.CacheDir
 	if cacheDir == "" {
 		homeDir, _ := os.UserHomeDir()
 		cacheDir = filepath.Join(homeDir, ".tusk", "license_cache")
 	}
 
-	// Create cache directory if it doesn't exist
-	os.MkdirAll(cacheDir, 0755)
-
 	// Generate cache file name based on license key hash
 	keyHash := md5.Sum([]byte(licenseKey))
 	cacheFile := filepath.Join(cacheDir, fmt.Sprintf("%x.cache", keyHash))
@@ -125,19 +258,24 @@ func NewWithCacheDir(licenseKey, apiKey, cacheDir string) *TuskLicense {
 		licenseCache:       make(map[string]LicenseCacheEntry),
 		validationHistory:  make([]ValidationAttempt, 0),
 		expirationWarnings: make([]ExpirationWarning, 0),
-		httpClient:         &http.Client{Timeout: 10 * time.Second},
+		httpClient:         opts.HTTPClient,
 		cacheDir:           cacheDir,
 		cacheFile:          cacheFile,
 		logger:             log.New(os.Stderr, "[TuskLicense] ", log.LstdFlags),
+		opts:               opts,
+		now:                time.Now,
+		sleep:              sleepContext,
 	}
 
-	// Load offline cache if exists
-	tl.loadOfflineCache()
-
+	if opts.publicKey == nil {
+		tl.opts.publicKey, tl.keyErr = ServerPublicKey()
+	}
 	return tl
 }
 
-// ValidateLicenseKey validates license key format and checksum
+// ValidateLicenseKey checks the form of the key: TUSK- and at least 32
+// characters. Only the license server can say the key is genuine, see
+// Verified.
 func (tl *TuskLicense) ValidateLicenseKey() ValidationResult {
 	if len(tl.licenseKey) < 32 {
 		return ValidationResult{
@@ -153,39 +291,109 @@ func (tl *TuskLicense) ValidateLicenseKey() ValidationResult {
 		}
 	}
 
-	hash := sha256.Sum256([]byte(tl.licenseKey))
-	checksum := hex.EncodeToString(hash[:])
-
-	if !strings.HasPrefix(checksum, "tusk") {
-		return ValidationResult{
-			Valid: false,
-			Error: "Invalid license key checksum",
-		}
-	}
-
 	return ValidationResult{
 		Valid:    true,
-		Checksum: checksum,
+		Checksum: tl.keyHash(),
 	}
 }
 
 // VerifyLicenseServer verifies license with remote server
 func (tl *TuskLicense) VerifyLicenseServer(serverURL string) (map[string]interface{}, error) {
+	return tl.VerifyLicenseServerContext(context.Background(), serverURL)
+}
+
+// VerifyLicenseServerContext verifies the license with the server, which
+// must sign its response. Network errors, 408, 429 and 5xx statuses are
+// retried with exponential backoff and jitter; once the retries run out,
+// the offline cache stands in for the server for the grace period. A
+// response that is unsigned or does not verify is an error, as is a
+// status the server refuses the license with.
+func (tl *TuskLicense) VerifyLicenseServerContext(ctx context.Context, serverURL string) (map[string]interface{}, error) {
 	if serverURL == "" {
-		serverURL = "https://api.tusklang.org/v1/license"
+		serverURL = DefaultServerURL
 	}
+	response, result, err := tl.exchange(ctx, serverURL, nil)
+	var retry *retryableError
+	if errors.As(err, &retry) {
+		return tl.fallbackToOfflineCache(err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	tl.cacheResult(response, result)
+	return result, nil
+}
 
-	timestamp := time.Now().Unix()
+// exchange posts the license key and fields to url and returns the
+// verified response, retrying as VerifyLicenseServerContext describes.
+// Once the retries run out the error is a *retryableError.
+func (tl *TuskLicense) exchange(ctx context.Context, url string, fields map[string]interface{}) (SignedResponse, map[string]interface{}, error) {
+	// Without a key the answer could not be verified, so the license key
+	// is not sent at all
+	if tl.keyErr != nil {
+		return SignedResponse{}, nil, tl.keyErr
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return SignedResponse{}, nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(raw)
+
+	for attempt := 0; ; attempt++ {
+		response, retryAfter, err := tl.request(ctx, url, nonce, fields)
+		var retry *retryableError
+		if err == nil {
+			result, err := tl.verifyResponse(response, nonce)
+			return response, result, err
+		}
+		if !errors.As(err, &retry) {
+			return response, nil, err
+		}
+		if attempt >= tl.opts.MaxRetries || ctx.Err() != nil {
+			tl.logger.Printf("License server unreachable after %d attempt(s): %v\n", attempt+1, err)
+			return response, nil, err
+		}
+		wait := tl.backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > tl.opts.MaxRetryDelay {
+			wait = tl.opts.MaxRetryDelay
+		}
+		tl.logger.Printf("License server attempt %d failed (%v), retrying in %s\n", attempt+1, err, wait)
+		if err := tl.sleep(ctx, wait); err != nil {
+			return response, nil, &retryableError{err}
+		}
+	}
+}
+
+// retryableError is a failure a later request may not have
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// request sends one request and returns the signed response, or the
+// Retry-After the server asked for along with the error
+func (tl *TuskLicense) request(ctx context.Context, url, nonce string, fields map[string]interface{}) (SignedResponse, time.Duration, error) {
+	var response SignedResponse
+	timestamp := tl.now().Unix()
 	data := map[string]interface{}{
 		"license_key": tl.licenseKey,
 		"session_id":  tl.sessionID,
 		"timestamp":   timestamp,
+		"nonce":       nonce,
+	}
+	for k, v := range fields {
+		data[k] = v
 	}
 
 	// Generate signature
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal data: %w", err)
+		return response, 0, fmt.Errorf("failed to marshal data: %w", err)
 	}
 
 	h := hmac.New(sha256.New, []byte(tl.apiKey))
@@ -196,12 +404,12 @@ func (tl *TuskLicense) VerifyLicenseServer(serverURL string) (map[string]interfa
 	// Make HTTP request
 	jsonPayload, err := json.Marshal(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+		return response, 0, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", serverURL, strings.NewReader(string(jsonPayload)))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(jsonPayload)))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return response, 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+tl.apiKey)
@@ -209,22 +417,91 @@ func (tl *TuskLicense) VerifyLicenseServer(serverURL string) (map[string]interfa
 
 	resp, err := tl.httpClient.Do(req)
 	if err != nil {
-		tl.logger.Printf("Network error during license validation: %v\n", err)
-		return tl.fallbackToOfflineCache(fmt.Sprintf("network error: %v", err))
+		return response, 0, &retryableError{fmt.Errorf("network error: %w", err)}
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		tl.logger.Printf("Server returned error: %d\n", resp.StatusCode)
-		return tl.fallbackToOfflineCache(fmt.Sprintf("server error: %d", resp.StatusCode))
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return response, 0, &retryableError{fmt.Errorf("failed to read response: %w", err)}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return response, retryAfter(resp.Header.Get("Retry-After"), tl.now()), &retryableError{fmt.Errorf("server error: %d", resp.StatusCode)}
+	default:
+		return response, 0, statusError(resp.StatusCode, body)
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		return response, 0, tskerrors.Wrap(tskerrors.Validation, fmt.Errorf("failed to decode response: %w", err))
+	}
+	return response, 0, nil
+}
+
+// statusError describes a status the server refused a request with, using
+// the error field of its JSON body when there is one
+func statusError(status int, body []byte) error {
+	var refusal struct {
+		Error string `json:"error"`
+	}
+	message := http.StatusText(status)
+	if json.Unmarshal(body, &refusal) == nil && refusal.Error != "" {
+		message = refusal.Error
+	}
+	switch status {
+	case http.StatusConflict:
+		return tskerrors.New(tskerrors.Conflict, "license server: %s", message)
+	case http.StatusNotFound, http.StatusGone:
+		return tskerrors.New(tskerrors.NotFound, "license server: %s", message)
+	}
+	return tskerrors.New(tskerrors.License, "license server refused the license: %d %s", status, message)
+}
+
+// verifyResponse checks the signature of a server response and returns its
+// payload. The payload must be for this license key, not issued later than
+// the clock skew allows, and, unless nonce is empty, answer that nonce.
+func (tl *TuskLicense) verifyResponse(response SignedResponse, nonce string) (map[string]interface{}, error) {
+	if tl.keyErr != nil {
+		return nil, tl.keyErr
+	}
+	if response.Payload == "" || response.Signature == "" {
+		return nil, tskerrors.New(tskerrors.Validation, "license server response is not signed")
+	}
+	payload, err := base64.StdEncoding.DecodeString(response.Payload)
+	if err != nil {
+		return nil, tskerrors.New(tskerrors.Validation, "license server response payload is not base64: %v", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(response.Signature)
+	if err != nil || len(tl.opts.publicKey) != ed25519.PublicKeySize || !ed25519.Verify(tl.opts.publicKey, payload, signature) {
+		return nil, tskerrors.New(tskerrors.Validation, "license server response signature does not verify")
 	}
 
 	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return nil, tskerrors.New(tskerrors.Validation, "license server response payload is not JSON: %v", err)
+	}
+	if result["license_key_hash"] != tl.keyHash() {
+		return nil, tskerrors.New(tskerrors.Validation, "license server response is for another license key")
 	}
+	if nonce != "" && result["nonce"] != nonce {
+		return nil, tskerrors.New(tskerrors.Validation, "license server response does not answer this request")
+	}
+	issued, ok := result["issued_at"].(float64)
+	if !ok {
+		return nil, tskerrors.New(tskerrors.Validation, "license server response has no issued_at")
+	}
+	if issuedAt := time.Unix(int64(issued), 0); issuedAt.After(tl.now().Add(tl.opts.ClockSkew)) {
+		return nil, tskerrors.New(tskerrors.Validation, "license server response was issued at %s, ahead of the local clock by more than %s",
+			issuedAt.Format(time.RFC3339), tl.opts.ClockSkew)
+	}
+	return result, nil
+}
 
-	// Cache the result
+// cacheResult keeps a verified response in memory and in the offline cache
+func (tl *TuskLicense) cacheResult(response SignedResponse, result map[string]interface{}) {
+	timestamp := tl.now().Unix()
 	tl.mutex.Lock()
 	tl.licenseCache[tl.licenseKey] = LicenseCacheEntry{
 		Data:      result,
@@ -234,12 +511,55 @@ func (tl *TuskLicense) VerifyLicenseServer(serverURL string) (map[string]interfa
 	tl.mutex.Unlock()
 
 	// Save to offline cache
-	tl.saveOfflineCache(result)
+	tl.saveOfflineCache(response, result)
+}
 
-	return result, nil
+// backoff returns the wait before retry attempt+1: RetryDelay doubled
+// attempt times, capped at MaxRetryDelay, less up to half at random
+func (tl *TuskLicense) backoff(attempt int) time.Duration {
+	d := tl.opts.RetryDelay
+	for i := 0; i < attempt && d < tl.opts.MaxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > tl.opts.MaxRetryDelay {
+		d = tl.opts.MaxRetryDelay
+	}
+	return d - time.Duration(mathrand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter reads a Retry-After header, in seconds or an HTTP date
+func retryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// CheckLicenseExpiration checks if license is expired or expiring soon
+// keyHash returns the hex SHA-256 of the license key
+func (tl *TuskLicense) keyHash() string {
+	hash := sha256.Sum256([]byte(tl.licenseKey))
+	return hex.EncodeToString(hash[:])
+}
+
+// CheckLicenseExpiration checks if license is expired or expiring soon.
+// The license expires once the clock skew has passed after its date.
 func (tl *TuskLicense) CheckLicenseExpiration() ExpirationResult {
 	parts := strings.Split(tl.licenseKey, "-")
 	if len(parts) < 4 {
@@ -259,9 +579,10 @@ func (tl *TuskLicense) CheckLicenseExpiration() ExpirationResult {
 	}
 
 	expirationDate := time.Unix(expirationTimestamp, 0)
-	currentTime := time.Now()
+	currentTime := tl.now()
 
-	if expirationDate.Before(currentTime) {
+	// A clock a little ahead of the server's does not expire the license
+	if expirationDate.Add(tl.opts.ClockSkew).Before(currentTime) {
 		daysOverdue := int64(currentTime.Sub(expirationDate).Hours() / 24)
 		return ExpirationResult{
 			Expired:        true,
@@ -293,7 +614,7 @@ func (tl *TuskLicense) CheckLicenseExpiration() ExpirationResult {
 func (tl *TuskLicense) ValidateLicensePermissions(feature string) (bool, error) {
 	tl.mutex.RLock()
 	if cacheEntry, exists := tl.licenseCache[tl.licenseKey]; exists {
-		if time.Now().Unix() < cacheEntry.Expires {
+		if tl.now().Unix() < cacheEntry.Expires {
 			if features, ok := cacheEntry.Data["features"].([]interface{}); ok {
 				for _, f := range features {
 					if fStr, ok := f.(string); ok && fStr == feature {
@@ -312,12 +633,17 @@ func (tl *TuskLicense) ValidateLicensePermissions(feature string) (bool, error)
 	switch feature {
 	case "basic", "core", "standard":
 		return true, nil
-	case "premium", "enterprise":
+	case "premium":
 		upperKey := strings.ToUpper(tl.licenseKey)
 		if strings.Contains(upperKey, "PREMIUM") || strings.Contains(upperKey, "ENTERPRISE") {
 			return true, nil
 		}
 		return false, fmt.Errorf("premium license required")
+	case "enterprise":
+		if strings.Contains(strings.ToUpper(tl.licenseKey), "ENTERPRISE") {
+			return true, nil
+		}
+		return false, fmt.Errorf("enterprise license required")
 	default:
 		return false, fmt.Errorf("unknown feature")
 	}
@@ -371,7 +697,7 @@ func (tl *TuskLicense) LogValidationAttempt(success bool, details string) {
 func (tl *TuskLicense) GetValidationHistory() []ValidationAttempt {
 	tl.mutex.RLock()
 	defer tl.mutex.RUnlock()
-	
+
 	history := make([]ValidationAttempt, len(tl.validationHistory))
 	copy(history, tl.validationHistory)
 	return history
@@ -410,9 +736,15 @@ func GetLicense() *TuskLicense {
 	return licenseInstance
 }
 
-// loadOfflineCache loads offline license cache from disk
+// loadOfflineCache loads the offline license cache from disk the first
+// time it is needed, so creating a license reads and writes nothing
 func (tl *TuskLicense) loadOfflineCache() {
-	data, err := ioutil.ReadFile(tl.cacheFile)
+	tl.offlineOnce.Do(tl.readOfflineCache)
+}
+
+// readOfflineCache reads the offline license cache
+func (tl *TuskLicense) readOfflineCache() {
+	data, err := os.ReadFile(tl.cacheFile)
 	if err != nil {
 		// Cache file doesn't exist or can't be read
 		tl.offlineCache = nil
@@ -427,9 +759,7 @@ func (tl *TuskLicense) loadOfflineCache() {
 	}
 
 	// Verify the cache is for the correct license key
-	hash := sha256.Sum256([]byte(tl.licenseKey))
-	keyHash := hex.EncodeToString(hash[:])
-	if cached.LicenseKeyHash == keyHash {
+	if cached.LicenseKeyHash == tl.keyHash() {
 		tl.offlineCache = &cached
 		tl.logger.Println("Loaded offline license cache")
 	} else {
@@ -438,16 +768,14 @@ func (tl *TuskLicense) loadOfflineCache() {
 	}
 }
 
-// saveOfflineCache saves license data to offline cache
-func (tl *TuskLicense) saveOfflineCache(licenseData map[string]interface{}) {
-	hash := sha256.Sum256([]byte(tl.licenseKey))
-	keyHash := hex.EncodeToString(hash[:])
-
+// saveOfflineCache saves a verified server response to the offline cache
+func (tl *TuskLicense) saveOfflineCache(response SignedResponse, licenseData map[string]interface{}) {
 	cacheData := OfflineCacheData{
-		LicenseKeyHash: keyHash,
+		LicenseKeyHash: tl.keyHash(),
 		LicenseData:    licenseData,
-		Timestamp:      time.Now().Unix(),
+		Timestamp:      tl.now().Unix(),
 		Expiration:     tl.CheckLicenseExpiration(),
+		Response:       response,
 	}
 
 	data, err := json.MarshalIndent(cacheData, "", "  ")
@@ -456,34 +784,90 @@ func (tl *TuskLicense) saveOfflineCache(licenseData map[string]interface{}) {
 		return
 	}
 
-	if err := ioutil.WriteFile(tl.cacheFile, data, 0600); err != nil {
+	if err := os.MkdirAll(tl.cacheDir, 0755); err != nil {
+		tl.logger.Printf("Failed to save offline cache: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(tl.cacheFile, data, 0600); err != nil {
 		tl.logger.Printf("Failed to save offline cache: %v\n", err)
 		return
 	}
 
+	tl.loadOfflineCache()
+	tl.mutex.Lock()
 	tl.offlineCache = &cacheData
+	tl.mutex.Unlock()
 	tl.logger.Println("Saved license data to offline cache")
 }
 
-// fallbackToOfflineCache fallback to offline cache when server is unreachable
+// errUnverified is the error of Verified when the license server never
+// verified the license
+var errUnverified = tskerrors.New(tskerrors.License, "the license has not been verified with the license server")
+
+// Verified returns the data of the last license server response for the
+// key that verified against the server key: the one this process received
+// within the hour, else the offline cache while the grace period lasts.
+// Without one the error says why the license is unverified.
+func (tl *TuskLicense) Verified() (map[string]interface{}, error) {
+	tl.mutex.RLock()
+	entry, ok := tl.licenseCache[tl.licenseKey]
+	tl.mutex.RUnlock()
+	if ok && tl.now().Unix() < entry.Expires {
+		return entry.Data, nil
+	}
+	data, _, err := tl.offlineData()
+	return data, err
+}
+
+// offlineData returns the data of the offline cache and when the server
+// issued it. The cached response must still verify, and the server must
+// have issued it within the grace period.
+func (tl *TuskLicense) offlineData() (map[string]interface{}, time.Time, error) {
+	tl.loadOfflineCache()
+	tl.mutex.RLock()
+	cache := tl.offlineCache
+	tl.mutex.RUnlock()
+	if cache == nil || tl.opts.GracePeriod < 0 {
+		return nil, time.Time{}, errUnverified
+	}
+	// The cached data is only as good as its signature: the file is not
+	// trusted, so a copy edited to extend the license does not verify
+	data, err := tl.verifyResponse(cache.Response, "")
+	if err != nil {
+		return nil, time.Time{}, tskerrors.New(tskerrors.License, "offline cache rejected (%v)", err)
+	}
+	issuedAt := time.Unix(int64(data["issued_at"].(float64)), 0)
+	if age := tl.now().Sub(issuedAt); age > tl.opts.GracePeriod {
+		return nil, issuedAt, tskerrors.New(tskerrors.License, "license last verified %s ago, beyond the offline grace period of %s",
+			age.Round(time.Minute), tl.opts.GracePeriod)
+	}
+	return data, issuedAt, nil
+}
+
+// fallbackToOfflineCache fallback to offline cache when server is
+// unreachable, while offlineData has a verified response
 func (tl *TuskLicense) fallbackToOfflineCache(errorMsg string) (map[string]interface{}, error) {
-	if tl.offlineCache != nil && tl.offlineCache.LicenseData != nil {
-		cacheAge := time.Now().Unix() - tl.offlineCache.Timestamp
-		cacheAgeDays := float64(cacheAge) / 86400.0
-
-		// Check if cached license is not expired
-		if !tl.offlineCache.Expiration.Expired {
-			tl.logger.Printf("Using offline license cache (age: %.1f days)\n", cacheAgeDays)
-			result := make(map[string]interface{})
-			for k, v := range tl.offlineCache.LicenseData {
-				result[k] = v
-			}
-			result["offline_mode"] = true
-			result["cache_age_days"] = cacheAgeDays
-			result["warning"] = fmt.Sprintf("Operating in offline mode due to: %s", errorMsg)
-			return result, nil
-		}
-		return nil, fmt.Errorf("license expired and server unreachable: %s", errorMsg)
+	data, issuedAt, err := tl.offlineData()
+	if err == errUnverified {
+		return nil, tskerrors.New(tskerrors.Connection, "no offline cache available: %s", errorMsg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, errorMsg)
+	}
+	if expiration := tl.CheckLicenseExpiration(); expiration.Expired {
+		return nil, tskerrors.New(tskerrors.License, "license expired and server unreachable: %s", errorMsg)
 	}
-	return nil, fmt.Errorf("no offline cache available: %s", errorMsg)
-} 
\ No newline at end of file
+
+	age := tl.now().Sub(issuedAt)
+	cacheAgeDays := age.Hours() / 24
+	tl.logger.Printf("Using offline license cache (age: %.1f days)\n", cacheAgeDays)
+	result := make(map[string]interface{})
+	for k, v := range data {
+		result[k] = v
+	}
+	result["offline_mode"] = true
+	result["cache_age_days"] = cacheAgeDays
+	result["grace_expires_at"] = issuedAt.Add(tl.opts.GracePeriod).Format(time.RFC3339)
+	result["warning"] = fmt.Sprintf("Operating in offline mode due to: %s", errorMsg)
+	return result, nil
+}
@@ -1,7 +1,26 @@
 package license
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
 )
 
 func TestLicenseValidation(t *testing.T) {
@@ -91,3 +110,526 @@ func TestInvalidLicenseKey(t *testing.T) {
 	
 	t.Logf("Invalid license validation result: %+v", result)
 }
+
+// signingServer answers license requests with payloads signed by key,
+// after failing the first failures requests with a 503
+type signingServer struct {
+	key      ed25519.PrivateKey
+	issuedAt time.Time
+	failures int32
+	requests int32
+	unsigned bool
+	tamper   bool
+	// tier is the tier the payload gives the key, if any
+	tier string
+}
+
+func (s *signingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddInt32(&s.requests, 1) <= s.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var request map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&request)
+	payload, _ := json.Marshal(map[string]interface{}{
+		"license_key_hash": (&TuskLicense{licenseKey: request["license_key"].(string)}).keyHash(),
+		"nonce":            request["nonce"],
+		"issued_at":        s.issuedAt.Unix(),
+		"features":         []string{"workflows"},
+		"tier":             s.tier,
+	})
+	if s.unsigned {
+		w.Write(payload)
+		return
+	}
+	signature := ed25519.Sign(s.key, payload)
+	if s.tamper {
+		payload = []byte(strings.Replace(string(payload), "workflows", "everything", 1))
+	}
+	json.NewEncoder(w).Encode(SignedResponse{
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(signature),
+	})
+}
+
+func newTestLicense(t *testing.T, public ed25519.PublicKey, now time.Time, opts Options) *TuskLicense {
+	t.Helper()
+	opts.CacheDir = t.TempDir()
+	opts.publicKey = public
+	key := fmt.Sprintf("TUSK-TEST-KEY-%x", now.Add(30*24*time.Hour).Unix())
+	tl := NewWithOptions(key, "test-api-key", opts)
+	tl.now = func() time.Time { return now }
+	return tl
+}
+
+func TestVerifyLicenseServerSigned(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Unix(1800000000, 0)
+	server := &signingServer{key: private, issuedAt: now}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	tl := newTestLicense(t, public, now, Options{})
+	result, err := tl.VerifyLicenseServer(ts.URL)
+	if err != nil {
+		t.Fatalf("VerifyLicenseServer: %v", err)
+	}
+	if features := result["features"].([]interface{}); features[0] != "workflows" {
+		t.Errorf("features = %v", features)
+	}
+
+	for name, configure := range map[string]func(){
+		"unsigned": func() { server.unsigned = true },
+		"tampered": func() { server.tamper = true },
+		"future":   func() { server.issuedAt = now.Add(time.Hour) },
+	} {
+		*server = signingServer{key: private, issuedAt: now}
+		configure()
+		_, err := tl.VerifyLicenseServer(ts.URL)
+		if tskerrors.KindOf(err) != tskerrors.Validation {
+			t.Errorf("%s: err = %v, want a validation error", name, err)
+		}
+	}
+
+	// Another key's signature is no better than none
+	otherPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+	*server = signingServer{key: private, issuedAt: now}
+	other := newTestLicense(t, otherPublic, now, Options{})
+	if _, err := other.VerifyLicenseServer(ts.URL); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("err = %v, want a signature error", err)
+	}
+
+	// Within the clock skew an issue time ahead of the local clock is fine
+	server.issuedAt = now.Add(time.Minute)
+	if _, err := tl.VerifyLicenseServer(ts.URL); err != nil {
+		t.Errorf("issued within the skew: %v", err)
+	}
+}
+
+func TestServerPublicKey(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(public)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	now := time.Unix(1800000000, 0)
+	server := &signingServer{key: private, issuedAt: now}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer func(key string) { serverPublicKey = key }(serverPublicKey)
+
+	// The key a build sets, as the body of its PEM block or the PEM itself
+	for _, value := range []string{base64.StdEncoding.EncodeToString(der), pemKey} {
+		serverPublicKey = value
+		tl := newTestLicense(t, nil, now, Options{})
+		if _, err := tl.VerifyLicenseServer(ts.URL); err != nil {
+			t.Errorf("built-in key %.20q: %v", value, err)
+		}
+	}
+
+	// The environment cannot replace it
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherDER, _ := x509.MarshalPKIXPublicKey(other)
+	serverPublicKey = base64.StdEncoding.EncodeToString(otherDER)
+	t.Setenv("TSK_LICENSE_PUBLIC_KEY", pemKey)
+	tl := newTestLicense(t, nil, now, Options{})
+	if _, err := tl.VerifyLicenseServer(ts.URL); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("with another built-in key: err = %v, want a signature error", err)
+	}
+
+	// Without a key, or with one that does not parse, nothing is sent
+	for _, value := range []string{"", "not a key", "-----BEGIN PUBLIC KEY-----\nnot a key"} {
+		serverPublicKey = value
+		requests := server.requests
+		tl := newTestLicense(t, nil, now, Options{})
+		if _, err := tl.VerifyLicenseServer(ts.URL); tskerrors.KindOf(err) != tskerrors.License || server.requests != requests {
+			t.Errorf("key %.20q: err = %v after %d request(s), want a license error and none", value, err, server.requests-requests)
+		}
+	}
+}
+
+func TestVerifyLicenseServerRetries(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Unix(1800000000, 0)
+	server := &signingServer{key: private, issuedAt: now, failures: 2}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	tl := newTestLicense(t, public, now, Options{RetryDelay: time.Second, MaxRetryDelay: 3 * time.Second})
+	var waits []time.Duration
+	tl.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	if _, err := tl.VerifyLicenseServer(ts.URL); err != nil {
+		t.Fatalf("VerifyLicenseServer: %v", err)
+	}
+	if server.requests != 3 || len(waits) != 2 {
+		t.Fatalf("requests = %d, waits = %v", server.requests, waits)
+	}
+	// Each wait is the doubled delay less up to half of it
+	for i, want := range []time.Duration{time.Second, 2 * time.Second} {
+		if waits[i] < want/2 || waits[i] > want {
+			t.Errorf("wait %d = %s, want between %s and %s", i, waits[i], want/2, want)
+		}
+	}
+	if d := tl.backoff(10); d < 1500*time.Millisecond || d > 3*time.Second {
+		t.Errorf("backoff(10) = %s, want it capped at 3s", d)
+	}
+
+	// A refusal is not retried
+	refused := 0
+	refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refused++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer refusing.Close()
+	if _, err := tl.VerifyLicenseServer(refusing.URL); tskerrors.KindOf(err) != tskerrors.License || refused != 1 {
+		t.Errorf("err = %v after %d requests, want one license error", err, refused)
+	}
+}
+
+func TestOfflineGracePeriod(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Unix(1800000000, 0)
+	ts := httptest.NewServer(&signingServer{key: private, issuedAt: now})
+	tl := newTestLicense(t, public, now, Options{GracePeriod: 48 * time.Hour, MaxRetries: -1})
+	if _, err := tl.VerifyLicenseServer(ts.URL); err != nil {
+		t.Fatalf("VerifyLicenseServer: %v", err)
+	}
+	ts.Close()
+
+	// The cache is read back from disk by a new instance
+	offline := NewWithOptions(tl.licenseKey, "test-api-key", tl.opts)
+	offline.now = func() time.Time { return now.Add(24 * time.Hour) }
+	result, err := offline.VerifyLicenseServer(ts.URL)
+	if err != nil {
+		t.Fatalf("within the grace period: %v", err)
+	}
+	if result["offline_mode"] != true || result["grace_expires_at"] != now.Add(48*time.Hour).Format(time.RFC3339) {
+		t.Errorf("result = %v", result)
+	}
+
+	offline.now = func() time.Time { return now.Add(49 * time.Hour) }
+	if _, err := offline.VerifyLicenseServer(ts.URL); tskerrors.KindOf(err) != tskerrors.License {
+		t.Errorf("beyond the grace period: err = %v, want a license error", err)
+	}
+
+	// Extending the license by editing the cache breaks its signature
+	offline.now = func() time.Time { return now.Add(time.Hour) }
+	offline.offlineCache.Response.Payload = base64.StdEncoding.EncodeToString([]byte(`{"issued_at": 1900000000}`))
+	if _, err := offline.VerifyLicenseServer(ts.URL); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("edited cache: err = %v, want a signature error", err)
+	}
+
+	noCache := newTestLicense(t, public, now, Options{MaxRetries: -1})
+	if _, err := noCache.VerifyLicenseServer(ts.URL); tskerrors.KindOf(err) != tskerrors.Connection {
+		t.Errorf("without a cache: err = %v, want a connection error", err)
+	}
+}
+
+func TestNewHasNoSideEffects(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	l := ForKey(fmt.Sprintf("TUSK-PREMIUM-KEY-%x", time.Now().Add(time.Hour).Unix()))
+	if granted, _ := l.ValidateLicensePermissions("premium"); !granted {
+		t.Error("the key should grant premium")
+	}
+	if _, err := os.Stat(filepath.Join(home, ".tusk")); !os.IsNotExist(err) {
+		t.Errorf("looking up a license created ~/.tusk: %v", err)
+	}
+
+	// The cache directory is created when a verified response is saved
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Unix(1800000000, 0)
+	ts := httptest.NewServer(&signingServer{key: private, issuedAt: now})
+	defer ts.Close()
+	dir := filepath.Join(t.TempDir(), "license_cache")
+	tl := NewWithOptions(fmt.Sprintf("TUSK-TEST-KEY-%x", now.Add(time.Hour).Unix()), "test-api-key", Options{CacheDir: dir, publicKey: public})
+	tl.now = func() time.Time { return now }
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("NewWithOptions created the cache directory: %v", err)
+	}
+	if _, err := tl.VerifyLicenseServer(ts.URL); err != nil {
+		t.Fatalf("VerifyLicenseServer: %v", err)
+	}
+	if _, err := os.Stat(tl.cacheFile); err != nil {
+		t.Errorf("the verified response was not cached: %v", err)
+	}
+}
+
+func TestExpirationClockSkew(t *testing.T) {
+	expires := time.Unix(1800000000, 0)
+	tl := NewWithOptions(fmt.Sprintf("TUSK-TEST-KEY-%x", expires.Unix()), "test-api-key", Options{CacheDir: t.TempDir(), ClockSkew: time.Minute})
+	for _, tt := range []struct {
+		now     time.Time
+		expired bool
+	}{
+		{expires.Add(-time.Hour), false},
+		{expires.Add(30 * time.Second), false},
+		{expires.Add(2 * time.Minute), true},
+	} {
+		tl.now = func() time.Time { return tt.now }
+		if got := tl.CheckLicenseExpiration().Expired; got != tt.expired {
+			t.Errorf("%s after expiration: expired = %v, want %v", tt.now.Sub(expires), got, tt.expired)
+		}
+	}
+}
+
+// seatServer tracks the seats of one floating license of total seats
+type seatServer struct {
+	key   ed25519.PrivateKey
+	total int
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	seats map[string]Seat
+	next  int
+}
+
+func (s *seatServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		LicenseKey string `json:"license_key"`
+		SessionID  string `json:"session_id"`
+		Nonce      string `json:"nonce"`
+		SeatID     string `json:"seat_id"`
+		Host       string `json:"host"`
+		Force      bool   `json:"force"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, seat := range s.seats {
+		if now.After(seat.ExpiresAt) {
+			delete(s.seats, id)
+		}
+	}
+	payload := map[string]interface{}{
+		"license_key_hash": (&TuskLicense{licenseKey: request.LicenseKey}).keyHash(),
+		"nonce":            request.Nonce,
+		"issued_at":        now.Unix(),
+	}
+	seat, held := s.seats[request.SeatID]
+	switch path.Base(r.URL.Path) {
+	case "acquire":
+		if len(s.seats) >= s.total {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, `{"error": "all %d seats are in use"}`, s.total)
+			return
+		}
+		s.next++
+		seat = Seat{ID: fmt.Sprintf("seat-%d", s.next), SessionID: request.SessionID, Host: request.Host, AcquiredAt: now, RenewedAt: now, ExpiresAt: now.Add(s.ttl)}
+		s.seats[seat.ID] = seat
+		payload["seat"] = seat
+	case "renew":
+		if !held || seat.SessionID != request.SessionID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		seat.RenewedAt, seat.ExpiresAt = now, now.Add(s.ttl)
+		s.seats[seat.ID] = seat
+		payload["seat"] = seat
+	case "release":
+		if !held || (seat.SessionID != request.SessionID && !request.Force) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.seats, seat.ID)
+	case "list":
+		usage := SeatUsage{Total: s.total, InUse: len(s.seats), Seats: []Seat{}}
+		for _, seat := range s.seats {
+			usage.Seats = append(usage.Seats, seat)
+		}
+		payload["usage"] = usage
+	}
+	data, _ := json.Marshal(payload)
+	json.NewEncoder(w).Encode(SignedResponse{
+		Payload:   base64.StdEncoding.EncodeToString(data),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, data)),
+	})
+}
+
+func TestSeats(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	server := &seatServer{key: private, total: 2, ttl: 300 * time.Millisecond, seats: make(map[string]Seat)}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	opts := Options{CacheDir: t.TempDir(), publicKey: public}
+	key := fmt.Sprintf("TUSK-TEST-KEY-%x", time.Now().Add(time.Hour).Unix())
+	a, b, c := NewWithOptions(key, "", opts), NewWithOptions(key, "", opts), NewWithOptions(key, "", opts)
+	ctx := context.Background()
+
+	leaseA, err := a.AcquireSeat(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("AcquireSeat: %v", err)
+	}
+	leaseB, err := b.AcquireSeat(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("AcquireSeat: %v", err)
+	}
+	if _, err := c.AcquireSeat(ctx, ts.URL); tskerrors.KindOf(err) != tskerrors.Conflict || !strings.Contains(err.Error(), "all 2 seats") {
+		t.Fatalf("third seat: err = %v, want a conflict", err)
+	}
+
+	// Heartbeats keep both seats beyond their first expiry
+	time.Sleep(2 * server.ttl)
+	usage, err := c.Seats(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("Seats: %v", err)
+	}
+	if usage.Total != 2 || usage.InUse != 2 {
+		t.Fatalf("usage = %+v, want both seats in use", usage)
+	}
+	if seat := leaseA.Seat(); !seat.RenewedAt.After(seat.AcquiredAt) || seat.SessionID != a.sessionID {
+		t.Errorf("seat = %+v, want it renewed for its session", seat)
+	}
+
+	if err := leaseA.Release(ctx); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	leaseC, err := c.AcquireSeat(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("AcquireSeat after a release: %v", err)
+	}
+	defer leaseC.Release(ctx)
+
+	// A seat an admin releases is lost at the next heartbeat
+	if err := c.ReleaseSeat(ctx, ts.URL, leaseB.Seat().ID); err != nil {
+		t.Fatalf("ReleaseSeat: %v", err)
+	}
+	select {
+	case <-leaseB.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lease not lost after a forced release")
+	}
+	if err := leaseB.Err(); err == nil || !strings.Contains(err.Error(), "was released") {
+		t.Errorf("Err() = %v", err)
+	}
+	if err := leaseB.Release(ctx); err != nil {
+		t.Errorf("Release of a lost lease: %v", err)
+	}
+	if err := c.ReleaseSeat(ctx, ts.URL, "seat-99"); tskerrors.KindOf(err) != tskerrors.NotFound {
+		t.Errorf("releasing an unknown seat: err = %v, want not found", err)
+	}
+}
+
+// verifiedLicense returns the license of a well-formed key expiring at
+// expires, as if the server had verified it with data
+func verifiedLicense(tier string, expires int64, data map[string]interface{}) *TuskLicense {
+	l := New(fmt.Sprintf("TUSK-%s-0123456789abcdef-%x", strings.ToUpper(tier), expires), "")
+	l.licenseCache[l.licenseKey] = LicenseCacheEntry{Data: data, Expires: time.Now().Add(time.Hour).Unix()}
+	return l
+}
+
+func TestFeatureRegistry(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	expires := time.Now().Add(24 * time.Hour).Unix()
+	premium := verifiedLicense("premium", expires, map[string]interface{}{"tier": TierPremium})
+	enterprise := verifiedLicense("enterprise", expires, map[string]interface{}{"tier": TierEnterprise})
+	expired := verifiedLicense("enterprise", time.Now().Add(-24*time.Hour).Unix(), map[string]interface{}{"tier": TierEnterprise})
+	listed := verifiedLicense("standard", expires, map[string]interface{}{"features": []interface{}{"rbac"}})
+
+	r := NewRegistry(DefaultRegistry.Capabilities()...)
+	r.Register(Capability{Name: "parse", Tier: TierCore})
+	for _, tt := range []struct {
+		l          *TuskLicense
+		capability string
+		reason     string
+	}{
+		{nil, "parse", ""},
+		{nil, CapabilityAI, "no license key"},
+		{premium, CapabilityAI, ""},
+		{premium, CapabilityDistributedCache, ""},
+		{premium, CapabilityRBAC, "upgrade to enterprise"},
+		{enterprise, CapabilityRBAC, ""},
+		{enterprise, CapabilityAI, ""},
+		{expired, CapabilityAI, "expired"},
+		{listed, CapabilityRBAC, ""},
+		{listed, CapabilityAI, "upgrade to premium"},
+	} {
+		err := r.Check(tt.l, tt.capability)
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("Check(%v, %s) = %v", tt.l != nil, tt.capability, err)
+			}
+			continue
+		}
+		if tskerrors.KindOf(err) != tskerrors.License || !strings.Contains(err.Error(), tt.reason) || !strings.Contains(err.Error(), "tsk license features") {
+			t.Errorf("Check(%v, %s) = %v, want a license error for %q", tt.l != nil, tt.capability, err, tt.reason)
+		}
+	}
+	if err := r.Check(premium, "teleport"); tskerrors.KindOf(err) != tskerrors.NotFound {
+		t.Errorf("unknown capability: err = %v", err)
+	}
+
+	features := r.Features(premium)
+	var names []string
+	for _, f := range features {
+		names = append(names, fmt.Sprintf("%s=%v", f.Name, f.Unlocked))
+	}
+	if got := strings.Join(names, " "); got != "parse=true ai=true distributed_cache=true rbac=false" {
+		t.Errorf("Features() = %s", got)
+	}
+
+	t.Setenv(KeyEnv, premium.licenseKey)
+	if l := Current(); l == nil || l != ForKey(premium.licenseKey) {
+		t.Errorf("Current() = %v, want the shared license of $%s", l, KeyEnv)
+	}
+}
+
+func TestForgedKeyStaysLocked(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	// Keys that merely claim a tier: no server has verified them
+	for _, key := range []string{
+		"x-y-ENTERPRISE-7fffffff",
+		"TUSK-ENTERPRISE-0123456789abcdef-7fffffff",
+		"TUSK-PREMIUM-0123456789abcdef-rbac-ai-7fffffff",
+	} {
+		l := New(key, "")
+		for _, capability := range []string{CapabilityRBAC, CapabilityAI, CapabilityDistributedCache} {
+			if err := DefaultRegistry.Check(l, capability); tskerrors.KindOf(err) != tskerrors.License {
+				t.Errorf("Check(%q, %s) = %v, want it locked", key, capability, err)
+			}
+		}
+	}
+	if err := DefaultRegistry.Check(New("x-y-ENTERPRISE-7fffffff", ""), CapabilityRBAC); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("malformed key: err = %v", err)
+	}
+	if err := DefaultRegistry.Check(New("TUSK-ENTERPRISE-0123456789abcdef-7fffffff", ""), CapabilityRBAC); err == nil || !strings.Contains(err.Error(), "not been verified") {
+		t.Errorf("unverified key: err = %v", err)
+	}
+
+	// A verified response unlocks the tier it gives, and its offline copy
+	// does for the grace period
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Unix(1800000000, 0)
+	ts := httptest.NewServer(&signingServer{key: private, issuedAt: now, tier: TierEnterprise})
+	defer ts.Close()
+	key := fmt.Sprintf("TUSK-TEST-0123456789abcdef-%x", now.Add(30*24*time.Hour).Unix())
+	opts := Options{CacheDir: t.TempDir(), publicKey: public}
+	online := NewWithOptions(key, "", opts)
+	online.now = func() time.Time { return now }
+	if _, err := online.VerifyLicenseServer(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefaultRegistry.Check(online, CapabilityRBAC); err != nil {
+		t.Errorf("verified enterprise key: %v", err)
+	}
+	offline := NewWithOptions(key, "", opts)
+	offline.now = func() time.Time { return now.Add(24 * time.Hour) }
+	if err := DefaultRegistry.Check(offline, CapabilityRBAC); err != nil {
+		t.Errorf("within the grace period: %v", err)
+	}
+	offline = NewWithOptions(key, "", opts)
+	offline.now = func() time.Time { return now.Add(DefaultGracePeriod + time.Hour) }
+	if err := DefaultRegistry.Check(offline, CapabilityRBAC); err == nil || !strings.Contains(err.Error(), "grace period") {
+		t.Errorf("beyond the grace period: err = %v", err)
+	}
+	// Verified with another key, the cache counts for nothing
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	forged := NewWithOptions(key, "", Options{CacheDir: opts.CacheDir, publicKey: other})
+	forged.now = func() time.Time { return now }
+	if err := DefaultRegistry.Check(forged, CapabilityRBAC); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("cache signed with another key: err = %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package license
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+// Seat is one of the concurrent sessions a floating license allows. The
+// server keeps a seat for its session until ExpiresAt, which every renewal
+// moves on.
+type Seat struct {
+	ID         string    `json:"id"`
+	SessionID  string    `json:"session_id"`
+	Host       string    `json:"host,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// SeatUsage is how many of the seats of a license are taken, and by whom
+type SeatUsage struct {
+	Total int    `json:"total"`
+	InUse int    `json:"in_use"`
+	Seats []Seat `json:"seats"`
+}
+
+// seatURL returns the endpoint of a seat operation: acquire, renew,
+// release or list under <serverURL>/seats
+func seatURL(serverURL, op string) string {
+	if serverURL == "" {
+		serverURL = DefaultServerURL
+	}
+	return strings.TrimSuffix(serverURL, "/") + "/seats/" + op
+}
+
+// seatCall runs a seat operation and decodes the field of its payload
+// into v. Seat operations need the server, so running out of retries is a
+// Connection error rather than a fall back to the offline cache.
+func (tl *TuskLicense) seatCall(ctx context.Context, serverURL, op string, fields map[string]interface{}, field string, v interface{}) error {
+	_, result, err := tl.exchange(ctx, seatURL(serverURL, op), fields)
+	var retry *retryableError
+	if errors.As(err, &retry) {
+		return tskerrors.New(tskerrors.Connection, "license server unreachable: %v", err)
+	}
+	if err != nil || v == nil {
+		return err
+	}
+	data, err := json.Marshal(result[field])
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return tskerrors.New(tskerrors.Validation, "license server response has an invalid %s: %v", field, err)
+	}
+	return nil
+}
+
+// Seats returns the seat usage of the license
+func (tl *TuskLicense) Seats(ctx context.Context, serverURL string) (SeatUsage, error) {
+	var usage SeatUsage
+	err := tl.seatCall(ctx, serverURL, "list", nil, "usage", &usage)
+	return usage, err
+}
+
+// ReleaseSeat frees the seat id whichever session holds it, such as the
+// seat of a process that died without releasing it. The server decides
+// whether the API key may.
+func (tl *TuskLicense) ReleaseSeat(ctx context.Context, serverURL, id string) error {
+	return tl.seatCall(ctx, serverURL, "release", map[string]interface{}{"seat_id": id, "force": true}, "", nil)
+}
+
+// AcquireSeat takes a seat of the license for this session, a Conflict
+// error when all are in use, and keeps it with heartbeats until the lease
+// is released
+func (tl *TuskLicense) AcquireSeat(ctx context.Context, serverURL string) (*SeatLease, error) {
+	host, _ := os.Hostname()
+	var seat Seat
+	if err := tl.seatCall(ctx, serverURL, "acquire", map[string]interface{}{"host": host}, "seat", &seat); err != nil {
+		return nil, err
+	}
+	if seat.ID == "" {
+		return nil, tskerrors.New(tskerrors.Validation, "license server response has no seat")
+	}
+	l := &SeatLease{
+		tl:        tl,
+		serverURL: serverURL,
+		seat:      seat,
+		lost:      make(chan struct{}),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go l.heartbeat()
+	return l, nil
+}
+
+// SeatLease holds a seat of a floating license. A heartbeat renews it a
+// third of the way to its expiry, retrying failed renewals until the
+// seat expires; the lease is lost when it does, or when the server no
+// longer knows the seat because an admin released it.
+type SeatLease struct {
+	tl        *TuskLicense
+	serverURL string
+
+	mu   sync.Mutex
+	seat Seat
+	err  error
+
+	lost     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Seat returns the seat as the server last renewed it
+func (l *SeatLease) Seat() Seat {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seat
+}
+
+// Lost is closed once the lease is lost; Err tells why
+func (l *SeatLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Err returns why the lease was lost, nil while it is held
+func (l *SeatLease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Renew moves the expiry of the seat on now
+func (l *SeatLease) Renew(ctx context.Context) error {
+	var seat Seat
+	err := l.tl.seatCall(ctx, l.serverURL, "renew", map[string]interface{}{"seat_id": l.Seat().ID}, "seat", &seat)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.seat = seat
+	l.mu.Unlock()
+	return nil
+}
+
+// Release stops the heartbeat and gives the seat back. Releasing a lost
+// lease only stops the heartbeat.
+func (l *SeatLease) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+	if l.Err() != nil {
+		return nil
+	}
+	err := l.tl.seatCall(ctx, l.serverURL, "release", map[string]interface{}{"seat_id": l.Seat().ID}, "", nil)
+	if tskerrors.KindOf(err) == tskerrors.NotFound {
+		return nil
+	}
+	return err
+}
+
+// heartbeat renews the seat until the lease is released or lost
+func (l *SeatLease) heartbeat() {
+	defer close(l.done)
+	for {
+		seat := l.Seat()
+		timer := time.NewTimer(seat.ExpiresAt.Sub(l.tl.now()) / 3)
+		select {
+		case <-l.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		ctx, cancel := context.WithDeadline(context.Background(), seat.ExpiresAt)
+		go func() {
+			select {
+			case <-l.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		err := l.Renew(ctx)
+		cancel()
+		switch {
+		case err == nil:
+		case tskerrors.KindOf(err) == tskerrors.NotFound:
+			l.lose(fmt.Errorf("seat %s was released: %w", seat.ID, err))
+			return
+		case !l.tl.now().Before(seat.ExpiresAt):
+			l.lose(fmt.Errorf("seat %s expired: %w", seat.ID, err))
+			return
+		default:
+			select {
+			case <-l.stop:
+				return
+			default:
+			}
+			l.tl.logger.Printf("Seat %s renewal failed: %v\n", seat.ID, err)
+		}
+	}
+}
+
+func (l *SeatLease) lose(err error) {
+	l.mu.Lock()
+	l.err = err
+	l.mu.Unlock()
+	l.tl.logger.Println(err)
+	close(l.lost)
+}
@@ -0,0 +1,444 @@
+// Package adaptive tunes configuration values from runtime feedback. The
+// host application reports what it observes, such as latencies or hit
+// rates, through Observe, and the @optimize and @learn operators return
+// values adjusted by those observations:
+//
+//	[adaptive]
+//	window: 20
+//	pool_size {
+//	    min: 2
+//	    max: 64
+//	    step: 2
+//	    goal: "minimize"
+//	}
+//
+//	[database]
+//	pool: @optimize("pool_size", 10)
+//	engine: @learn("query_engine", "btree")
+//
+// @optimize hill-climbs a number inside its declared bounds: after window
+// observations of a value it steps towards the better neighbour, and turns
+// back when a step made things worse. Undeclared names keep their initial
+// value. @learn returns whichever value has the best average once it has
+// window observations, so the host must report outcomes for the
+// alternatives it tries.
+//
+// State is saved to a JSON file, by default .tsk/adaptive.json next to the
+// configuration, so tuning resumes where it left off.
+package adaptive
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Goals of a Spec
+const (
+	Maximize = "maximize"
+	Minimize = "minimize"
+)
+
+// DefaultWindow is how many observations of a value are averaged before
+// acting on it
+const DefaultWindow = 20
+
+// StateFile is the default state file, relative to the configuration's
+// directory
+var StateFile = filepath.Join(".tsk", "adaptive.json")
+
+// Spec declares how one name is tuned. Bounded names can be optimized.
+type Spec struct {
+	Min, Max, Step float64
+	Bounded        bool
+	// Goal is Maximize (the default) or Minimize
+	Goal string
+}
+
+// Options are the settings of an [adaptive] section
+type Options struct {
+	Window int
+	// State is the state file; "" keeps state in memory only
+	State string
+	Specs map[string]Spec
+}
+
+// OptionsFrom reads Options from the flat adaptive.* keys of a
+// configuration. A relative state path is left for the caller to resolve.
+func OptionsFrom(values map[string]interface{}) (Options, error) {
+	opts := Options{Window: DefaultWindow, Specs: make(map[string]Spec)}
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "adaptive.")
+		if !ok {
+			continue
+		}
+		switch setting {
+		case "window":
+			window, err := strconv.Atoi(fmt.Sprint(value))
+			if err != nil || window < 1 {
+				return opts, fmt.Errorf("adaptive.window: %v is not a positive count", value)
+			}
+			opts.Window = window
+			continue
+		case "state":
+			opts.State = fmt.Sprint(value)
+			continue
+		}
+
+		name, field, ok := strings.Cut(setting, ".")
+		if !ok {
+			return opts, fmt.Errorf("unknown setting %s", key)
+		}
+		spec := opts.Specs[name]
+		switch field {
+		case "min", "max", "step":
+			n, err := number(value)
+			if err != nil {
+				return opts, fmt.Errorf("%s: %w", key, err)
+			}
+			switch field {
+			case "min":
+				spec.Min = n
+			case "max":
+				spec.Max = n
+			default:
+				spec.Step = n
+			}
+			spec.Bounded = true
+		case "goal":
+			spec.Goal = strings.ToLower(fmt.Sprint(value))
+			if spec.Goal != Maximize && spec.Goal != Minimize {
+				return opts, fmt.Errorf("%s: expected %q or %q, got %v", key, Maximize, Minimize, value)
+			}
+		default:
+			return opts, fmt.Errorf("unknown setting %s", key)
+		}
+		opts.Specs[name] = spec
+	}
+
+	for name, spec := range opts.Specs {
+		if !spec.Bounded {
+			continue
+		}
+		if spec.Step <= 0 {
+			return opts, fmt.Errorf("adaptive.%s needs a positive step", name)
+		}
+		if spec.Max < spec.Min {
+			return opts, fmt.Errorf("adaptive.%s: max is below min", name)
+		}
+	}
+	return opts, nil
+}
+
+// stat averages the observations of one value. The mean is exact for the
+// first window observations and then moves with each new one, so it
+// follows a changing workload.
+type stat struct {
+	Value interface{} `json:"value"`
+	Count int         `json:"count"`
+	Mean  float64     `json:"mean"`
+}
+
+// series is the state of one name
+type series struct {
+	// Current and Direction are where and which way @optimize is climbing
+	Current   *float64         `json:"current,omitempty"`
+	Direction float64          `json:"direction,omitempty"`
+	Stats     map[string]*stat `json:"stats"`
+}
+
+// Engine records observations and answers @optimize and @learn
+type Engine struct {
+	mu     sync.Mutex
+	opts   Options
+	series map[string]*series
+	// loaded is the state file series was read from
+	loaded string
+}
+
+// NewEngine creates an Engine with no state
+func NewEngine() *Engine {
+	return &Engine{opts: Options{Window: DefaultWindow}, series: make(map[string]*series)}
+}
+
+// Default is the Engine behind the @optimize and @learn operators
+var Default = NewEngine()
+
+// Configure applies opts, loading the state file when it changes
+func (e *Engine) Configure(opts Options) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if opts.Window < 1 {
+		opts.Window = DefaultWindow
+	}
+	e.opts = opts
+	if opts.State == "" || opts.State == e.loaded {
+		return nil
+	}
+	state, err := loadState(opts.State)
+	if err != nil {
+		return err
+	}
+	e.series, e.loaded = state, opts.State
+	return nil
+}
+
+// Observe records that value produced metric. For @optimize names value
+// may be nil, meaning the value currently returned.
+func (e *Engine) Observe(name string, value interface{}, metric float64) error {
+	if math.IsNaN(metric) || math.IsInf(metric, 0) {
+		return fmt.Errorf("observation of %s is not a finite number", name)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.get(name)
+	spec := e.opts.Specs[name]
+
+	optimizing := spec.Bounded && s.Current != nil
+	if value == nil {
+		if !optimizing {
+			return fmt.Errorf("observation of %s needs a value: it is not being optimized", name)
+		}
+		value = *s.Current
+	}
+	if optimizing {
+		n, err := number(value)
+		if err != nil {
+			return fmt.Errorf("observation of %s: %w", name, err)
+		}
+		value = n
+	}
+
+	key := valueKey(value)
+	st, ok := s.Stats[key]
+	if !ok {
+		st = &stat{Value: value}
+		s.Stats[key] = st
+	}
+	st.Count++
+	st.Mean += (metric - st.Mean) / float64(min(st.Count, e.opts.Window))
+
+	if st.Count%e.opts.Window != 0 {
+		return nil
+	}
+	if optimizing && key == valueKey(*s.Current) {
+		e.step(spec, s)
+	}
+	return e.save()
+}
+
+// step moves an optimized name after a full window at its current value:
+// back the way it came if that was better, on to an untried or better
+// neighbour, or nowhere at a local optimum
+func (e *Engine) step(spec Spec, s *series) {
+	current := *s.Current
+	here := s.Stats[valueKey(current)]
+	back := clamp(spec, current-s.Direction*spec.Step)
+	ahead := clamp(spec, current+s.Direction*spec.Step)
+
+	known := func(v float64) (*stat, bool) {
+		st, ok := s.Stats[valueKey(v)]
+		return st, ok && st.Count >= e.opts.Window
+	}
+	better := func(st *stat) bool {
+		if spec.Goal == Minimize {
+			return st.Mean < here.Mean
+		}
+		return st.Mean > here.Mean
+	}
+
+	if st, ok := known(back); ok && back != current && better(st) {
+		s.Current, s.Direction = &back, -s.Direction
+		return
+	}
+	if st, ok := known(ahead); ahead != current && (!ok || better(st)) {
+		s.Current = &ahead
+		return
+	}
+	if _, ok := known(back); back != current && !ok {
+		s.Current, s.Direction = &back, -s.Direction
+	}
+}
+
+// Optimize executes @optimize operator: @optimize(name, initial) returns
+// the tuned value of name, starting from initial. Names without bounds in
+// the [adaptive] section return initial.
+func (e *Engine) Optimize(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("@optimize requires a name and an initial value")
+	}
+	name := fmt.Sprint(args[0])
+	initial, err := number(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("@optimize %s: %w", name, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spec, ok := e.opts.Specs[name]
+	if !ok || !spec.Bounded {
+		return args[1], nil
+	}
+	s := e.get(name)
+	if s.Current == nil {
+		start := clamp(spec, initial)
+		s.Current, s.Direction = &start, 1
+	} else if clamped := clamp(spec, *s.Current); clamped != *s.Current {
+		// The bounds moved since the state was saved
+		s.Current = &clamped
+	}
+
+	value := *s.Current
+	if _, isInt := args[1].(int); isInt && value == math.Trunc(value) {
+		return int(value), nil
+	}
+	return value, nil
+}
+
+// Learn executes @learn operator: @learn(name, default) returns the value
+// of name with the best average observation, or default until one has a
+// full window of them
+func (e *Engine) Learn(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("@learn requires a name and a default value")
+	}
+	name := fmt.Sprint(args[0])
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.series[name]
+	if !ok {
+		return args[1], nil
+	}
+	goal := e.opts.Specs[name].Goal
+	var best *stat
+	for _, st := range s.Stats {
+		if st.Count < e.opts.Window {
+			continue
+		}
+		if best == nil || (goal == Minimize && st.Mean < best.Mean) || (goal != Minimize && st.Mean > best.Mean) ||
+			(st.Mean == best.Mean && valueKey(st.Value) < valueKey(best.Value)) {
+			best = st
+		}
+	}
+	if best == nil {
+		return args[1], nil
+	}
+	return best.Value, nil
+}
+
+// Save writes the state file now
+func (e *Engine) Save() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.save()
+}
+
+func (e *Engine) get(name string) *series {
+	s, ok := e.series[name]
+	if !ok {
+		s = &series{Stats: make(map[string]*stat)}
+		e.series[name] = s
+	}
+	return s
+}
+
+// save writes the state file atomically
+func (e *Engine) save() error {
+	if e.opts.State == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(e.series, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode adaptive state: %w", err)
+	}
+	dir := filepath.Dir(e.opts.State)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".adaptive-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to save adaptive state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save adaptive state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save adaptive state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), e.opts.State); err != nil {
+		return fmt.Errorf("failed to save adaptive state: %w", err)
+	}
+	e.loaded = e.opts.State
+	return nil
+}
+
+// loadState reads a state file; a missing file is empty state
+func loadState(path string) (map[string]*series, error) {
+	state := make(map[string]*series)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read adaptive state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, s := range state {
+		if s.Stats == nil {
+			s.Stats = make(map[string]*stat)
+		}
+		for _, st := range s.Stats {
+			// JSON decodes every number as float64
+			if f, ok := st.Value.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+				st.Value = int(f)
+			}
+		}
+	}
+	return state, nil
+}
+
+// clamp keeps v inside the bounds of spec, on a step from Min
+func clamp(spec Spec, v float64) float64 {
+	v = math.Max(spec.Min, math.Min(spec.Max, v))
+	steps := math.Round((v - spec.Min) / spec.Step)
+	v = spec.Min + steps*spec.Step
+	if v > spec.Max {
+		v -= spec.Step
+	}
+	return v
+}
+
+// valueKey identifies a value in the stats, so 10 and 10.0 are one value
+func valueKey(value interface{}) string {
+	if n, err := number(value); err == nil {
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// number reads an int, a float or a numeric string
+func number(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("%v is not a number", value)
+}
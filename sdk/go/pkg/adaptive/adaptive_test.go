@@ -0,0 +1,118 @@
+package adaptive
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{
+		"adaptive.window":         5,
+		"adaptive.state":          "tuning.json",
+		"adaptive.pool_size.min":  2,
+		"adaptive.pool_size.max":  "64",
+		"adaptive.pool_size.step": 2,
+		"adaptive.pool_size.goal": "minimize",
+		"adaptive.engine.goal":    "maximize",
+		"server.port":             8080,
+	})
+	if err != nil {
+		t.Fatalf("OptionsFrom() returned error: %v", err)
+	}
+	if opts.Window != 5 || opts.State != "tuning.json" {
+		t.Errorf("OptionsFrom() = %+v", opts)
+	}
+	if got := opts.Specs["pool_size"]; got != (Spec{Min: 2, Max: 64, Step: 2, Bounded: true, Goal: Minimize}) {
+		t.Errorf("pool_size spec = %+v", got)
+	}
+	if got := opts.Specs["engine"]; got.Bounded || got.Goal != Maximize {
+		t.Errorf("engine spec = %+v", got)
+	}
+
+	for _, values := range []map[string]interface{}{
+		{"adaptive.window": 0},
+		{"adaptive.pool.min": 1, "adaptive.pool.max": 10},
+		{"adaptive.pool.min": 10, "adaptive.pool.max": 1, "adaptive.pool.step": 1},
+		{"adaptive.pool.goal": "fastest"},
+		{"adaptive.pool.target": 3},
+	} {
+		if _, err := OptionsFrom(values); err == nil {
+			t.Errorf("OptionsFrom(%v) should fail", values)
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "adaptive.json")
+	opts := Options{
+		Window: 5,
+		State:  state,
+		Specs:  map[string]Spec{"pool_size": {Min: 2, Max: 64, Step: 2, Bounded: true, Goal: Minimize}},
+	}
+	e := NewEngine()
+	if err := e.Configure(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Latency is lowest with 20 connections
+	latency := func(pool float64) float64 { return 50 + math.Abs(pool-20) }
+	for i := 0; i < 400; i++ {
+		value, err := e.Optimize("pool_size", 10)
+		if err != nil {
+			t.Fatalf("Optimize() returned error: %v", err)
+		}
+		pool, ok := value.(int)
+		if !ok || pool < 2 || pool > 64 {
+			t.Fatalf("Optimize() = %#v, want an int inside the bounds", value)
+		}
+		if err := e.Observe("pool_size", nil, latency(float64(pool))); err != nil {
+			t.Fatalf("Observe() returned error: %v", err)
+		}
+	}
+	settled, _ := e.Optimize("pool_size", 10)
+	if settled != 20 {
+		t.Errorf("Optimize() settled on %v, want 20", settled)
+	}
+
+	// A new run resumes from the saved state
+	resumed := NewEngine()
+	if err := resumed.Configure(opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := resumed.Optimize("pool_size", 10); got != settled {
+		t.Errorf("resumed Optimize() = %v, want %v", got, settled)
+	}
+
+	// Undeclared names keep their initial value
+	if got, _ := e.Optimize("workers", 4); got != 4 {
+		t.Errorf("Optimize(workers) = %v, want 4", got)
+	}
+	if err := e.Observe("workers", nil, 1); err == nil {
+		t.Error("Expected an observation without a value to need an optimized name")
+	}
+}
+
+func TestLearn(t *testing.T) {
+	e := NewEngine()
+	e.Configure(Options{Window: 3})
+	if got, _ := e.Learn("engine", "btree"); got != "btree" {
+		t.Errorf("Learn() without observations = %v, want the default", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		e.Observe("engine", "btree", 0.6)
+		e.Observe("engine", "hash", 0.9)
+		e.Observe("engine", "lsm", 0.95)
+	}
+	// A value with fewer than window observations is not a candidate
+	e.Observe("engine", "skiplist", 1.0)
+	if got, _ := e.Learn("engine", "btree"); got != "lsm" {
+		t.Errorf("Learn() = %v, want the best hit rate", got)
+	}
+
+	e.Configure(Options{Window: 3, Specs: map[string]Spec{"engine": {Goal: Minimize}}})
+	if got, _ := e.Learn("engine", "hash"); got != "btree" {
+		t.Errorf("Learn() minimizing = %v, want btree", got)
+	}
+}
@@ -0,0 +1,280 @@
+// Package auth authenticates the users of tsk with static API tokens, an
+// OpenID Connect provider or an LDAP directory. `tsk security login` keeps
+// the identity it obtains in a session file, and servers such as
+// `tsk serve --api` and the web framework authenticate each request
+// through Middleware. It is configured by the [auth] section:
+//
+//	[auth]
+//	methods: ["token", "oidc", "ldap"]   # default: those configured below
+//	session_ttl: "8h"                    # LDAP logins; verified credentials
+//	tokens {
+//	    ci: "sha256:9f86d081884c7d65..."  # tsk security token ci
+//	}
+//	oidc {
+//	    issuer: "https://accounts.example.com"
+//	    client_id: "tsk"
+//	    scopes: ["openid", "profile", "email", "offline_access"]
+//	    user_claim: "preferred_username"
+//	}
+//	ldap {
+//	    url: "ldaps://ldap.example.com"
+//	    user_dn: "uid={user},ou=people,dc=example,dc=com"
+//	}
+//
+// Requests present a token as "Authorization: Bearer <token>", either a
+// static token or a JWT the provider signed, and LDAP credentials with
+// basic authentication.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/internal/configvalue"
+)
+
+// Methods of authentication
+const (
+	TokenMethod = "token"
+	OIDCMethod  = "oidc"
+	LDAPMethod  = "ldap"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator for requests that
+	// carry no credentials it reads
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned for credentials that were refused
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Identity is an authenticated user
+type Identity struct {
+	User   string   `json:"user"`
+	Name   string   `json:"name,omitempty"`
+	Email  string   `json:"email,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	// Method is how the user authenticated
+	Method string `json:"method"`
+	// ExpiresAt is when the credentials stop being valid, if they do
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Authenticator identifies the user making a request
+type Authenticator interface {
+	// Authenticate returns the identity behind the credentials of r, or
+	// ErrNoCredentials when r carries none this authenticator reads
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Chain asks its authenticators in turn, until one reads the credentials
+type Chain []Authenticator
+
+// Authenticate returns the answer of the first authenticator that does
+// not return ErrNoCredentials
+func (c Chain) Authenticate(r *http.Request) (*Identity, error) {
+	for _, a := range c {
+		id, err := a.Authenticate(r)
+		if !errors.Is(err, ErrNoCredentials) {
+			return id, err
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFrom returns the identity Middleware stored in ctx
+func IdentityFrom(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
+
+// Middleware authenticates requests before next, which finds the identity
+// with IdentityFrom. Requests without credentials are refused with 401
+// unless optional is set; refused credentials always are.
+func Middleware(a Authenticator, optional bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) && r.Header.Get("Authorization") != "" {
+			err = fmt.Errorf("%w: the Authorization header was not accepted", ErrInvalidCredentials)
+		}
+		switch {
+		case err == nil:
+			r = r.WithContext(WithIdentity(r.Context(), id))
+		case errors.Is(err, ErrNoCredentials) && optional:
+		default:
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="tsk"`)
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(rw, "{\"error\": %s}\n", strconv.Quote(err.Error()))
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// bearerToken returns the bearer token of r
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return strings.TrimSpace(token), ok && strings.TrimSpace(token) != ""
+}
+
+// Options is the [auth] section of a configuration
+type Options struct {
+	// Methods are tried in order; empty when authentication is not configured
+	Methods []string
+	// SessionTTL is how long LDAP logins last, and how long servers
+	// remember credentials they verified
+	SessionTTL time.Duration
+	// Tokens maps users to their static token, or its "sha256:" hash
+	Tokens map[string]string
+	OIDC   OIDCConfig
+	LDAP   LDAPConfig
+}
+
+// DefaultOptions keeps sessions for 8 hours
+func DefaultOptions() Options {
+	return Options{SessionTTL: 8 * time.Hour}
+}
+
+// Configured reports whether any method is
+func (o Options) Configured() bool {
+	return len(o.Methods) > 0
+}
+
+// Has reports whether method is one of o.Methods
+func (o Options) Has(method string) bool {
+	for _, m := range o.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// OptionsFrom reads Options from the flat auth.* keys of an evaluated
+// configuration. Without a methods list, the methods with settings are
+// used: tokens, then oidc, then ldap.
+func OptionsFrom(values map[string]interface{}) (Options, error) {
+	opts := DefaultOptions()
+	methodsSet := false
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "auth.")
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		var err error
+		switch setting {
+		case "methods":
+			methodsSet = true
+			opts.Methods, err = configvalue.StringList(value)
+			for _, method := range opts.Methods {
+				if method != TokenMethod && method != OIDCMethod && method != LDAPMethod {
+					err = fmt.Errorf("unknown method %q (token, oidc or ldap)", method)
+				}
+			}
+		case "session_ttl":
+			opts.SessionTTL, err = time.ParseDuration(text)
+			if err == nil && opts.SessionTTL <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "oidc.issuer":
+			opts.OIDC.Issuer = strings.TrimSuffix(text, "/")
+		case "oidc.client_id":
+			opts.OIDC.ClientID = text
+		case "oidc.client_secret":
+			opts.OIDC.ClientSecret = text
+		case "oidc.scopes":
+			opts.OIDC.Scopes, err = configvalue.StringList(value)
+		case "oidc.audience":
+			opts.OIDC.Audience = text
+		case "oidc.user_claim":
+			opts.OIDC.UserClaim = text
+		case "oidc.groups_claim":
+			opts.OIDC.GroupsClaim = text
+		case "oidc.redirect_port":
+			opts.OIDC.RedirectPort, err = strconv.Atoi(text)
+			if err == nil && (opts.OIDC.RedirectPort < 0 || opts.OIDC.RedirectPort > 65535) {
+				err = errors.New("must be a port number")
+			}
+		case "ldap.url":
+			opts.LDAP.URL = text
+		case "ldap.user_dn":
+			opts.LDAP.UserDN = text
+		case "ldap.start_tls":
+			opts.LDAP.StartTLS, err = strconv.ParseBool(text)
+		case "ldap.timeout":
+			opts.LDAP.Timeout, err = time.ParseDuration(text)
+		default:
+			user, ok := strings.CutPrefix(setting, "tokens.")
+			if !ok {
+				return opts, fmt.Errorf("unknown setting auth.%s", setting)
+			}
+			if opts.Tokens == nil {
+				opts.Tokens = make(map[string]string)
+			}
+			opts.Tokens[strings.Trim(user, `"'`)] = text
+		}
+		if err != nil {
+			return opts, fmt.Errorf("auth.%s: invalid value %q: %w", setting, text, err)
+		}
+	}
+	if !methodsSet {
+		if len(opts.Tokens) > 0 {
+			opts.Methods = append(opts.Methods, TokenMethod)
+		}
+		if opts.OIDC.Issuer != "" {
+			opts.Methods = append(opts.Methods, OIDCMethod)
+		}
+		if opts.LDAP.URL != "" {
+			opts.Methods = append(opts.Methods, LDAPMethod)
+		}
+	}
+	return opts, nil
+}
+
+// New returns the Authenticator of the methods of opts, in order. OIDC and
+// LDAP credentials are remembered for SessionTTL once verified.
+func New(opts Options) (Authenticator, error) {
+	if !opts.Configured() {
+		return nil, errors.New("no authentication method is configured in [auth]")
+	}
+	var chain Chain
+	for _, method := range opts.Methods {
+		switch method {
+		case TokenMethod:
+			tokens, err := NewStaticTokens(opts.Tokens)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, tokens)
+		case OIDCMethod:
+			provider, err := NewOIDC(opts.OIDC)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, Cached(provider, opts.SessionTTL))
+		case LDAPMethod:
+			directory, err := NewLDAP(opts.LDAP)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, Cached(directory, opts.SessionTTL))
+		default:
+			return nil, fmt.Errorf("unknown authentication method %q", method)
+		}
+	}
+	return chain, nil
+}
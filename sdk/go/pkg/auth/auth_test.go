@@ -0,0 +1,411 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{
+		"auth.session_ttl":    "1h",
+		"auth.tokens.ci":      "sha256:" + strings.Repeat("ab", 32),
+		"auth.oidc.issuer":    "https://id.example.com/",
+		"auth.oidc.client_id": "tsk",
+		"auth.oidc.scopes":    []interface{}{"openid", "email"},
+		"auth.ldap.url":       "ldaps://ldap.example.com",
+		"auth.ldap.user_dn":   "uid={user},dc=example",
+		"server.port":         8080,
+	})
+	if err != nil {
+		t.Fatalf("OptionsFrom failed: %v", err)
+	}
+	if !reflect.DeepEqual(opts.Methods, []string{"token", "oidc", "ldap"}) || opts.SessionTTL != time.Hour ||
+		opts.OIDC.Issuer != "https://id.example.com" || len(opts.OIDC.Scopes) != 2 || opts.Tokens["ci"] == "" {
+		t.Errorf("OptionsFrom = %+v", opts)
+	}
+	if !opts.Has(OIDCMethod) || opts.Has("kerberos") {
+		t.Error("Has is wrong")
+	}
+	if opts, _ := OptionsFrom(nil); opts.Configured() {
+		t.Error("no [auth] section should not be configured")
+	}
+	for _, values := range []map[string]interface{}{
+		{"auth.methods": []interface{}{"kerberos"}},
+		{"auth.session_ttl": "-1h"},
+		{"auth.oidc.redirect_port": "70000"},
+		{"auth.realm": "x"},
+	} {
+		if _, err := OptionsFrom(values); err == nil {
+			t.Errorf("OptionsFrom(%v) should fail", values)
+		}
+	}
+	if _, err := New(Options{Methods: []string{"token"}, Tokens: map[string]string{"ci": "short"}}); err == nil {
+		t.Error("short tokens should be refused")
+	}
+}
+
+func TestStaticTokens(t *testing.T) {
+	token, err := NewToken()
+	if err != nil || !strings.HasPrefix(token, "tsk_") {
+		t.Fatalf("NewToken = %q, %v", token, err)
+	}
+	a, err := New(Options{Methods: []string{TokenMethod}, Tokens: map[string]string{
+		"ci":     HashToken(token),
+		"deploy": "a-long-enough-static-token",
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	h := Middleware(a, false, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id, _ := IdentityFrom(r.Context())
+		rw.Write([]byte(id.User))
+	}))
+	for _, tt := range []struct {
+		header string
+		code   int
+		user   string
+	}{
+		{"Bearer " + token, http.StatusOK, "ci"},
+		{"Bearer a-long-enough-static-token", http.StatusOK, "deploy"},
+		{"Bearer wrong", http.StatusUnauthorized, ""},
+		{"", http.StatusUnauthorized, ""},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.code || (tt.user != "" && rec.Body.String() != tt.user) {
+			t.Errorf("%q: %d %s", tt.header, rec.Code, rec.Body)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%q: no WWW-Authenticate header", tt.header)
+		}
+	}
+
+	optional := Middleware(a, true, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if _, ok := IdentityFrom(r.Context()); ok {
+			t.Error("anonymous requests should have no identity")
+		}
+	}))
+	rec := httptest.NewRecorder()
+	optional.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("optional authentication refused an anonymous request: %d", rec.Code)
+	}
+}
+
+// fakeLDAP answers binds, accepting password "secret" for the DN of alice
+func fakeLDAP(t *testing.T) (string, *[]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var mu sync.Mutex
+	var dns []string
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, msg, err := readTLV(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				body := bytes.NewReader(msg)
+				_, id, _ := readTLV(body)
+				_, op, _ := readTLV(body)
+				bind := bytes.NewReader(op)
+				readTLV(bind)
+				_, dn, _ := readTLV(bind)
+				_, password, _ := readTLV(bind)
+				mu.Lock()
+				dns = append(dns, string(dn))
+				mu.Unlock()
+				code := 0
+				if string(dn) != "uid=alice,dc=example" || string(password) != "secret" {
+					code = ldapInvalidCredentials
+				}
+				result := berTLV(0x61, concat(berTLV(0x0a, berInt(code)), berTLV(0x04, nil), berTLV(0x04, nil)))
+				conn.Write(ldapMessage(parseBerInt(id), result))
+			}()
+		}
+	}()
+	return "ldap://" + listener.Addr().String(), &dns
+}
+
+func TestLDAP(t *testing.T) {
+	url, dns := fakeLDAP(t)
+	directory, err := NewLDAP(LDAPConfig{URL: url, UserDN: "uid={user},dc=example"})
+	if err != nil {
+		t.Fatalf("NewLDAP failed: %v", err)
+	}
+	id, err := directory.Bind(context.Background(), "alice", "secret")
+	if err != nil || id.User != "alice" || id.Method != LDAPMethod {
+		t.Errorf("Bind = %+v, %v", id, err)
+	}
+	if _, err := directory.Bind(context.Background(), "alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("a wrong password gave %v", err)
+	}
+	if _, err := directory.Bind(context.Background(), "alice", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("an empty password gave %v", err)
+	}
+	directory.Bind(context.Background(), "x,uid=alice", "secret")
+	if got := (*dns)[len(*dns)-1]; got != `uid=x\,uid\=alice,dc=example` {
+		t.Errorf("the user was not escaped: %s", got)
+	}
+
+	// Verified credentials are remembered
+	cached := Cached(directory, time.Minute)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("alice", "secret")
+	binds := len(*dns)
+	for i := 0; i < 3; i++ {
+		if id, err := cached.Authenticate(req); err != nil || id.User != "alice" {
+			t.Fatalf("Authenticate = %+v, %v", id, err)
+		}
+	}
+	if len(*dns) != binds+1 {
+		t.Errorf("%d binds for 3 requests", len(*dns)-binds)
+	}
+
+	for _, cfg := range []LDAPConfig{
+		{URL: "http://ldap", UserDN: "uid={user}"},
+		{URL: "ldaps://ldap", UserDN: "uid={user}", StartTLS: true},
+		{URL: "ldap://ldap", UserDN: "uid=alice"},
+	} {
+		if _, err := NewLDAP(cfg); err == nil {
+			t.Errorf("NewLDAP(%+v) should fail", cfg)
+		}
+	}
+}
+
+// fakeProvider is an OpenID Connect provider issuing tokens for alice
+type fakeProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	nonce     string
+	polls     int
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]string{
+			"issuer":                        p.URL,
+			"authorization_endpoint":        p.URL + "/authorize",
+			"token_endpoint":                p.URL + "/token",
+			"device_authorization_endpoint": p.URL + "/device",
+			"jwks_uri":                      p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(rw http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		p.mu.Lock()
+		p.challenge, p.nonce = q.Get("code_challenge"), q.Get("nonce")
+		p.mu.Unlock()
+		http.Redirect(rw, r, q.Get("redirect_uri")+"?code=c1&state="+q.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/device", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]interface{}{
+			"device_code": "d1", "user_code": "ABCD-EFGH", "verification_uri": p.URL + "/activate",
+			"expires_in": 60, "interval": 1,
+		})
+	})
+	mux.HandleFunc("/token", func(rw http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		refuse := func(code string) {
+			rw.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(rw).Encode(map[string]string{"error": code})
+		}
+		nonce := ""
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+			if r.Form.Get("code") != "c1" || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+				refuse("invalid_grant")
+				return
+			}
+			nonce = p.nonce
+		case "urn:ietf:params:oauth:grant-type:device_code":
+			if p.polls++; p.polls == 1 {
+				refuse("authorization_pending")
+				return
+			}
+		case "refresh_token":
+			if r.Form.Get("refresh_token") != "r1" {
+				refuse("invalid_grant")
+				return
+			}
+		default:
+			refuse("unsupported_grant_type")
+			return
+		}
+		json.NewEncoder(rw).Encode(map[string]interface{}{
+			"access_token": p.sign(t, "tsk", nonce), "id_token": p.sign(t, "tsk", nonce),
+			"refresh_token": "r1", "token_type": "Bearer", "expires_in": 3600,
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeProvider) sign(t *testing.T, audience, nonce string) string {
+	claims := jwt.MapClaims{
+		"iss": p.URL, "aud": audience, "sub": "u-1", "preferred_username": "alice",
+		"email": "alice@example.com", "groups": []string{"admins"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestOIDC(t *testing.T) {
+	p := newFakeProvider(t)
+	provider, err := NewOIDC(OIDCConfig{Issuer: p.URL, ClientID: "tsk"})
+	if err != nil {
+		t.Fatalf("NewOIDC failed: %v", err)
+	}
+	ctx := context.Background()
+
+	token, id, err := provider.BrowserLogin(ctx, func(url string) error {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	})
+	if err != nil || id.User != "alice" || !reflect.DeepEqual(id.Groups, []string{"admins"}) || token.RefreshToken != "r1" {
+		t.Fatalf("BrowserLogin = %+v, %+v, %v", token, id, err)
+	}
+
+	var shown DeviceCode
+	_, id, err = provider.DeviceLogin(ctx, func(code DeviceCode) { shown = code })
+	if err != nil || id.User != "alice" || shown.UserCode != "ABCD-EFGH" {
+		t.Fatalf("DeviceLogin = %+v, %v (shown %+v)", id, err, shown)
+	}
+
+	refreshed, id, err := provider.Refresh(ctx, &Token{RefreshToken: "r1"})
+	if err != nil || id.User != "alice" || refreshed.AccessToken == "" {
+		t.Errorf("Refresh = %+v, %+v, %v", refreshed, id, err)
+	}
+	if _, _, err := provider.Refresh(ctx, &Token{RefreshToken: "stale"}); err == nil {
+		t.Error("a refused refresh token should fail")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+p.sign(t, "tsk", ""))
+	if id, err := provider.Authenticate(req); err != nil || id.User != "alice" || id.Method != OIDCMethod {
+		t.Errorf("Authenticate = %+v, %v", id, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.sign(t, "another-client", ""))
+	if _, err := provider.Authenticate(req); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("a token for another audience gave %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer not-a-jwt")
+	if _, err := provider.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("a static token gave %v", err)
+	}
+}
+
+func TestSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tsk", "session.json")
+	t.Setenv(SessionFileEnv, path)
+	if _, err := LoadSession(); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("LoadSession without a session = %v", err)
+	}
+	s := NewSession(&Identity{User: "alice", Method: LDAPMethod}, nil, time.Hour)
+	if err := SaveSession(s); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("the session file is %v, %v", info.Mode(), err)
+	}
+	loaded, err := LoadSession()
+	if err != nil || loaded.Identity.User != "alice" || loaded.Expired() || loaded.Refreshable() {
+		t.Errorf("LoadSession = %+v, %v", loaded, err)
+	}
+
+	p := newFakeProvider(t)
+	provider, _ := NewOIDC(OIDCConfig{Issuer: p.URL, ClientID: "tsk"})
+	expired := &Session{Identity: Identity{User: "alice"}, Issuer: p.URL, Token: &Token{RefreshToken: "r1"}, ExpiresAt: time.Now().Add(-time.Minute)}
+	if !expired.Expired() {
+		t.Error("the session should have expired")
+	}
+	if err := expired.Refresh(context.Background(), provider); err != nil || expired.Expired() {
+		t.Errorf("Refresh = %v, expires %v", err, expired.ExpiresAt)
+	}
+
+	if err := DeleteSession(); err != nil {
+		t.Fatalf("DeleteSession failed: %v", err)
+	}
+	if err := DeleteSession(); err != nil {
+		t.Errorf("deleting no session failed: %v", err)
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	for in, want := range map[string]string{
+		"alice":     "alice",
+		"a,b=c":     `a\,b\=c`,
+		" #x ":      `\ #x\ `,
+		"#x":        `\#x`,
+		"a\x00b":    `a\00b`,
+		`a"b<c>;+\`: `a\"b\<c\>\;\+\\`,
+	} {
+		if got := EscapeDN(in); got != want {
+			t.Errorf("EscapeDN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
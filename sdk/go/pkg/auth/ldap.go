@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAPConfig is the auth.ldap section
+type LDAPConfig struct {
+	// URL is ldap://host[:389] or ldaps://host[:636]
+	URL string
+	// UserDN is the distinguished name users bind as, with {user} in
+	// place of the user name
+	UserDN string
+	// StartTLS upgrades ldap:// connections to TLS before binding
+	StartTLS bool
+	// Timeout bounds a login; zero means 10s
+	Timeout time.Duration
+}
+
+// LDAP authenticates users with a simple bind to a directory. Passwords
+// only travel over TLS, unless the URL is a plain ldap:// one without
+// StartTLS.
+type LDAP struct {
+	cfg  LDAPConfig
+	host string
+	tls  bool
+}
+
+// NewLDAP checks cfg and returns an LDAP authenticator
+func NewLDAP(cfg LDAPConfig) (*LDAP, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("auth.ldap.url: invalid URL %q", cfg.URL)
+	}
+	l := &LDAP{cfg: cfg, host: u.Host}
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			l.host = net.JoinHostPort(u.Hostname(), "389")
+		}
+	case "ldaps":
+		if cfg.StartTLS {
+			return nil, errors.New("auth.ldap: start_tls is for ldap:// URLs")
+		}
+		l.tls = true
+		if u.Port() == "" {
+			l.host = net.JoinHostPort(u.Hostname(), "636")
+		}
+	default:
+		return nil, fmt.Errorf("auth.ldap.url: unsupported scheme %q (ldap or ldaps)", u.Scheme)
+	}
+	if !strings.Contains(cfg.UserDN, "{user}") {
+		return nil, errors.New("auth.ldap.user_dn must contain {user}")
+	}
+	if l.cfg.Timeout <= 0 {
+		l.cfg.Timeout = 10 * time.Second
+	}
+	return l, nil
+}
+
+// Bind checks the password of user with a simple bind as its DN
+func (l *LDAP) Bind(ctx context.Context, user, password string) (*Identity, error) {
+	// An empty password would make an unauthenticated bind, which succeeds
+	if user == "" || password == "" {
+		return nil, fmt.Errorf("%w: a user and a password are required", ErrInvalidCredentials)
+	}
+	ctx, cancel := context.WithTimeout(ctx, l.cfg.Timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", l.host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the LDAP server: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	serverName, _, _ := net.SplitHostPort(l.host)
+	tlsConfig := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if l.tls {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, fmt.Errorf("failed to reach the LDAP server: %w", err)
+		}
+		conn = tlsConn
+	}
+	reader := bufio.NewReader(conn)
+
+	messageID := 1
+	if l.cfg.StartTLS {
+		request := berTLV(0x77, berTLV(0x80, []byte(startTLSOID)))
+		if _, err := conn.Write(ldapMessage(messageID, request)); err != nil {
+			return nil, fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+		code, message, err := readLDAPResult(reader, messageID, 0x78)
+		if err != nil {
+			return nil, fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+		if code != 0 {
+			return nil, fmt.Errorf("LDAP StartTLS refused: %s", ldapResultText(code, message))
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+		messageID++
+	}
+
+	dn := strings.ReplaceAll(l.cfg.UserDN, "{user}", EscapeDN(user))
+	request := berTLV(0x60, concat(
+		berTLV(0x02, []byte{3}),
+		berTLV(0x04, []byte(dn)),
+		berTLV(0x80, []byte(password)),
+	))
+	if _, err := conn.Write(ldapMessage(messageID, request)); err != nil {
+		return nil, fmt.Errorf("LDAP bind failed: %w", err)
+	}
+	code, message, err := readLDAPResult(reader, messageID, 0x61)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP bind failed: %w", err)
+	}
+	// Unbind; the server closes the connection
+	conn.Write(ldapMessage(messageID+1, []byte{0x42, 0x00}))
+	switch code {
+	case 0:
+		return &Identity{User: user, Method: LDAPMethod}, nil
+	case ldapInvalidCredentials:
+		return nil, fmt.Errorf("%w: wrong user or password", ErrInvalidCredentials)
+	}
+	return nil, fmt.Errorf("LDAP bind refused: %s", ldapResultText(code, message))
+}
+
+// Authenticate binds with the basic authentication credentials of r
+func (l *LDAP) Authenticate(r *http.Request) (*Identity, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	return l.Bind(r.Context(), user, password)
+}
+
+const (
+	startTLSOID            = "1.3.6.1.4.1.1466.20037"
+	ldapInvalidCredentials = 49
+)
+
+// EscapeDN escapes value for an attribute value of a distinguished name,
+// as RFC 4514 requires
+func EscapeDN(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			c == ' ' && (i == 0 || i == len(value)-1),
+			c == '#' && i == 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ldapMessage wraps a protocol operation in an LDAPMessage
+func ldapMessage(id int, op []byte) []byte {
+	return berTLV(0x30, concat(berTLV(0x02, berInt(id)), op))
+}
+
+// readLDAPResult reads the response to message id, an operation tagged
+// tag, and returns its result code and diagnostic message
+func readLDAPResult(r *bufio.Reader, id int, tag byte) (int, string, error) {
+	msgTag, msg, err := readTLV(r)
+	if err != nil {
+		return 0, "", err
+	}
+	if msgTag != 0x30 {
+		return 0, "", errors.New("malformed LDAP response")
+	}
+	body := bytes.NewReader(msg)
+	idTag, idBytes, err := readTLV(body)
+	if err != nil || idTag != 0x02 || parseBerInt(idBytes) != id {
+		return 0, "", errors.New("unexpected LDAP message id")
+	}
+	opTag, op, err := readTLV(body)
+	if err != nil {
+		return 0, "", err
+	}
+	if opTag != tag {
+		return 0, "", fmt.Errorf("unexpected LDAP response 0x%x", opTag)
+	}
+	result := bytes.NewReader(op)
+	codeTag, code, err := readTLV(result)
+	if err != nil || codeTag != 0x0a {
+		return 0, "", errors.New("malformed LDAP result")
+	}
+	var message []byte
+	if _, _, err := readTLV(result); err == nil { // matchedDN
+		_, message, _ = readTLV(result)
+	}
+	return parseBerInt(code), string(message), nil
+}
+
+func ldapResultText(code int, message string) string {
+	if message == "" {
+		return fmt.Sprintf("result code %d", code)
+	}
+	return fmt.Sprintf("result code %d: %s", code, message)
+}
+
+// berTLV encodes a BER element with a definite length
+func berTLV(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	switch n := len(content); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xffff:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+// berInt encodes a non-negative INTEGER
+func berInt(n int) []byte {
+	var out []byte
+	for {
+		out = append([]byte{byte(n)}, out...)
+		n >>= 8
+		if n == 0 {
+			break
+		}
+	}
+	if out[0]&0x80 != 0 {
+		out = append([]byte{0}, out...)
+	}
+	return out
+}
+
+func parseBerInt(b []byte) int {
+	n := 0
+	for _, c := range b {
+		n = n<<8 | int(c)
+	}
+	return n
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// maxLDAPMessage caps the size of a response read
+const maxLDAPMessage = 1 << 20
+
+// readTLV reads one BER element
+func readTLV(r io.ByteReader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		count := int(first & 0x7f)
+		if count == 0 || count > 3 {
+			return 0, nil, errors.New("unsupported BER length")
+		}
+		length = 0
+		for i := 0; i < count; i++ {
+			c, err := r.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			length = length<<8 | int(c)
+		}
+	}
+	if length > maxLDAPMessage {
+		return 0, nil, errors.New("LDAP message too large")
+	}
+	content := make([]byte, length)
+	for i := range content {
+		if content[i], err = r.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+	}
+	return tag, content, nil
+}
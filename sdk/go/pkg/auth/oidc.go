@@ -0,0 +1,581 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// OIDCConfig is the auth.oidc section
+type OIDCConfig struct {
+	// Issuer is the provider URL its discovery document is found under
+	Issuer   string
+	ClientID string
+	// ClientSecret is only set for confidential clients
+	ClientSecret string
+	// Scopes default to openid, profile, email and offline_access, which
+	// asks for a refresh token
+	Scopes []string
+	// Audience is what the aud claim of bearer tokens must hold; it
+	// defaults to ClientID
+	Audience string
+	// UserClaim names the user; by default preferred_username, email or sub
+	UserClaim string
+	// GroupsClaim names the groups of the user, "groups" by default
+	GroupsClaim string
+	// RedirectPort is the loopback port of the browser login; 0 picks one
+	RedirectPort int
+}
+
+// OIDC logs users in with an OpenID Connect provider, and verifies the
+// tokens it signs
+type OIDC struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *oidcMetadata
+	keys     map[string]crypto.PublicKey
+	fetched  time.Time
+}
+
+// oidcMetadata is the part of the discovery document used
+type oidcMetadata struct {
+	Issuer                      string `json:"issuer"`
+	AuthorizationEndpoint       string `json:"authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	JWKSURI                     string `json:"jwks_uri"`
+}
+
+// Token is what the provider issued at login
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IDToken      string    `json:"id_token,omitempty"`
+	TokenType    string    `json:"token_type,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// NewOIDC checks cfg and returns an OIDC client; the provider is only
+// contacted when needed
+func NewOIDC(cfg OIDCConfig) (*OIDC, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, errors.New("auth.oidc needs an issuer and a client_id")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email", "offline_access"}
+	}
+	if cfg.Audience == "" {
+		cfg.Audience = cfg.ClientID
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	return &OIDC{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// discover fetches the discovery document of the issuer, once
+func (o *OIDC) discover(ctx context.Context) (*oidcMetadata, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.metadata != nil {
+		return o.metadata, nil
+	}
+	var metadata oidcMetadata
+	if err := o.getJSON(ctx, o.cfg.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != o.cfg.Issuer {
+		return nil, fmt.Errorf("OIDC discovery failed: the provider is issuer %q, not %q", metadata.Issuer, o.cfg.Issuer)
+	}
+	o.metadata = &metadata
+	return o.metadata, nil
+}
+
+func (o *OIDC) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// oauthError is the error response of RFC 6749
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// post sends a form to endpoint and decodes the JSON answer into v, or
+// returns the *oauthError of a refusal
+func (o *OIDC) post(ctx context.Context, endpoint string, form url.Values, v interface{}) error {
+	form.Set("client_id", o.cfg.ClientID)
+	if o.cfg.ClientSecret != "" {
+		form.Set("client_secret", o.cfg.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr oauthError
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Code != "" {
+			return &oauthErr
+		}
+		return fmt.Errorf("%s answered %s", endpoint, resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// tokenResponse is the answer of the token endpoint
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func (t tokenResponse) token() *Token {
+	token := &Token{AccessToken: t.AccessToken, RefreshToken: t.RefreshToken, IDToken: t.IDToken, TokenType: t.TokenType}
+	if t.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+	return token
+}
+
+// exchange requests a token from the token endpoint
+func (o *OIDC) exchange(ctx context.Context, form url.Values) (*Token, error) {
+	metadata, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var resp tokenResponse
+	if err := o.post(ctx, metadata.TokenEndpoint, form, &resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" {
+		return nil, errors.New("the provider issued no access token")
+	}
+	return resp.token(), nil
+}
+
+// BrowserLogin logs in with the authorization code flow and PKCE: open is
+// given the URL to visit, and the provider redirects the browser to a
+// listener on the loopback interface
+func (o *OIDC) BrowserLogin(ctx context.Context, open func(url string) error) (*Token, *Identity, error) {
+	metadata, err := o.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(o.cfg.RedirectPort)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen for the login redirect: %w", err)
+	}
+	defer listener.Close()
+	redirect := fmt.Sprintf("http://%s/callback", listener.Addr())
+	state, verifier, nonce := randomString(), randomString(), randomString()
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.cfg.ClientID},
+		"redirect_uri":          {redirect},
+		"scope":                 {strings.Join(o.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authURL := metadata.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + query.Encode()
+	} else {
+		authURL += "?" + query.Encode()
+	}
+
+	type callback struct {
+		code string
+		err  error
+	}
+	done := make(chan callback, 1)
+	server := &http.Server{ReadHeaderTimeout: 10 * time.Second, Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(rw, r)
+			return
+		}
+		q := r.URL.Query()
+		var result callback
+		switch {
+		case q.Get("state") != state:
+			result.err = errors.New("the login redirect has the wrong state")
+		case q.Get("error") != "":
+			result.err = &oauthError{Code: q.Get("error"), Description: q.Get("error_description")}
+		default:
+			result.code = q.Get("code")
+		}
+		if result.err != nil {
+			http.Error(rw, "Login failed: "+result.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(rw, "Logged in to tsk. You can close this window.")
+		}
+		select {
+		case done <- result:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	if err := open(authURL); err != nil {
+		return nil, nil, err
+	}
+	var result callback
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	if result.err != nil {
+		return nil, nil, result.err
+	}
+	token, err := o.exchange(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {result.code},
+		"redirect_uri":  {redirect},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := o.identify(ctx, token, nonce)
+	return token, id, err
+}
+
+// DeviceCode is what the user of the device flow is shown
+type DeviceCode struct {
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	// VerificationURIComplete includes the user code, when the provider
+	// gives one
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+}
+
+// DeviceLogin logs in with the device authorization flow of RFC 8628, for
+// terminals without a browser: prompt shows the user where to enter the
+// code, then the provider is polled until they have
+func (o *OIDC) DeviceLogin(ctx context.Context, prompt func(DeviceCode)) (*Token, *Identity, error) {
+	metadata, err := o.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if metadata.DeviceAuthorizationEndpoint == "" {
+		return nil, nil, errors.New("the provider does not support the device flow")
+	}
+	var device struct {
+		Code string `json:"device_code"`
+		DeviceCode
+		Interval int `json:"interval"`
+	}
+	if err := o.post(ctx, metadata.DeviceAuthorizationEndpoint, url.Values{"scope": {strings.Join(o.cfg.Scopes, " ")}}, &device); err != nil {
+		return nil, nil, fmt.Errorf("device authorization failed: %w", err)
+	}
+	prompt(device.DeviceCode)
+
+	interval := time.Duration(device.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if device.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(device.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, nil, errors.New("the device code expired before the login was approved")
+		}
+		token, err := o.exchange(ctx, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {device.Code},
+		})
+		var oauthErr *oauthError
+		if errors.As(err, &oauthErr) {
+			switch oauthErr.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		id, err := o.identify(ctx, token, "")
+		return token, id, err
+	}
+}
+
+// Refresh exchanges the refresh token of token for a new token
+func (o *OIDC) Refresh(ctx context.Context, token *Token) (*Token, *Identity, error) {
+	if token.RefreshToken == "" {
+		return nil, nil, errors.New("the session has no refresh token: log in again")
+	}
+	refreshed, err := o.exchange(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to refresh the session: %w", err)
+	}
+	// Providers may keep the refresh token and ID token
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+	if refreshed.IDToken == "" {
+		refreshed.IDToken = token.IDToken
+	}
+	id, err := o.identify(ctx, refreshed, "")
+	return refreshed, id, err
+}
+
+// identify verifies the ID token of a login, whose nonce must match
+func (o *OIDC) identify(ctx context.Context, token *Token, nonce string) (*Identity, error) {
+	if token.IDToken == "" {
+		return nil, errors.New("the provider issued no ID token: is openid among the scopes?")
+	}
+	claims, err := o.verify(ctx, token.IDToken, o.cfg.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if nonce != "" && claims["nonce"] != nonce {
+		return nil, errors.New("the ID token has the wrong nonce")
+	}
+	id := o.identity(claims)
+	if !token.Expiry.IsZero() {
+		id.ExpiresAt = token.Expiry
+	}
+	return id, nil
+}
+
+// Verify checks a JWT the provider signed for audience and returns whose
+// it is
+func (o *OIDC) Verify(ctx context.Context, raw string) (*Identity, error) {
+	claims, err := o.verify(ctx, raw, o.cfg.Audience)
+	if err != nil {
+		return nil, err
+	}
+	return o.identity(claims), nil
+}
+
+// Authenticate verifies a bearer JWT. Bearer tokens that are not JWTs
+// are left to the next authenticator.
+func (o *OIDC) Authenticate(r *http.Request) (*Identity, error) {
+	raw, ok := bearerToken(r)
+	if !ok || strings.Count(raw, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+	id, err := o.Verify(r.Context(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return id, nil
+}
+
+// verify checks the signature, issuer, audience and lifetime of raw
+func (o *OIDC) verify(ctx context.Context, raw, audience string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}))
+	_, err := parser.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return o.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != o.cfg.Issuer {
+		return nil, fmt.Errorf("invalid token: issued by %q", iss)
+	}
+	if !claims.VerifyAudience(audience, true) {
+		return nil, fmt.Errorf("invalid token: not for audience %q", audience)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("invalid token: no expiry")
+	}
+	return claims, nil
+}
+
+// key returns the signing key kid of the provider, fetching the key set
+// again when kid is unknown, at most once a minute
+func (o *OIDC) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	metadata, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if key, ok := o.findKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(o.fetched) < time.Minute {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := o.getJSON(ctx, metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch the signing keys: %w", err)
+	}
+	o.keys = make(map[string]crypto.PublicKey)
+	o.fetched = time.Now()
+	for _, k := range set.Keys {
+		if key, err := k.publicKey(); err == nil && (k.Use == "" || k.Use == "sig") {
+			o.keys[k.Kid] = key
+		}
+	}
+	if key, ok := o.findKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// findKey looks kid up; tokens without a kid use the only key there is
+func (o *OIDC) findKey(kid string) (crypto.PublicKey, bool) {
+	if key, ok := o.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(o.keys) == 1 {
+		for _, key := range o.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// identity names the user of claims
+func (o *OIDC) identity(claims jwt.MapClaims) *Identity {
+	id := &Identity{Method: OIDCMethod}
+	id.Name, _ = claims["name"].(string)
+	id.Email, _ = claims["email"].(string)
+	for _, claim := range []string{o.cfg.UserClaim, "preferred_username", "email", "sub"} {
+		if user, _ := claims[claim].(string); claim != "" && user != "" {
+			id.User = user
+			break
+		}
+	}
+	if groups, ok := claims[o.cfg.GroupsClaim].([]interface{}); ok {
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				id.Groups = append(id.Groups, name)
+			}
+		}
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		id.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return id
+}
+
+// jwk is a key of a JSON Web Key Set
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			return nil, errors.New("malformed RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+		y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("malformed EC key")
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC key is not on its curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// randomString returns 32 random bytes, base64url encoded
+func randomString() string {
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SessionFileEnv overrides where `tsk security login` keeps the session
+const SessionFileEnv = "TSK_SESSION_FILE"
+
+// ErrNoSession is returned by LoadSession when nobody is logged in
+var ErrNoSession = errors.New("not logged in: run tsk security login")
+
+// Session is the identity a login obtained, and the tokens to renew it
+type Session struct {
+	Identity Identity `json:"identity"`
+	// Issuer is the OIDC provider of Token
+	Issuer    string    `json:"issuer,omitempty"`
+	Token     *Token    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewSession returns the session of id, which lasts until the identity
+// expires, or for ttl when it does not
+func NewSession(id *Identity, token *Token, ttl time.Duration) *Session {
+	now := time.Now()
+	s := &Session{Identity: *id, Token: token, CreatedAt: now, ExpiresAt: id.ExpiresAt}
+	if s.ExpiresAt.IsZero() {
+		s.ExpiresAt = now.Add(ttl)
+		s.Identity.ExpiresAt = s.ExpiresAt
+	}
+	return s
+}
+
+// Expired reports whether the session has ended
+func (s *Session) Expired() bool {
+	return !time.Now().Before(s.ExpiresAt)
+}
+
+// Refreshable reports whether an expired session can be renewed without
+// logging in again
+func (s *Session) Refreshable() bool {
+	return s.Token != nil && s.Token.RefreshToken != ""
+}
+
+// Refresh renews an OIDC session with its refresh token
+func (s *Session) Refresh(ctx context.Context, provider *OIDC) error {
+	if !s.Refreshable() {
+		return errors.New("the session cannot be refreshed: log in again")
+	}
+	if s.Issuer != "" && s.Issuer != provider.cfg.Issuer {
+		return fmt.Errorf("the session was issued by %s, not %s: log in again", s.Issuer, provider.cfg.Issuer)
+	}
+	token, id, err := provider.Refresh(ctx, s.Token)
+	if err != nil {
+		return err
+	}
+	s.Token, s.Identity, s.ExpiresAt = token, *id, id.ExpiresAt
+	return nil
+}
+
+// SessionPath returns $TSK_SESSION_FILE, or ~/.tsk/session.json
+func SessionPath() (string, error) {
+	if path := os.Getenv(SessionFileEnv); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the session file: %w", err)
+	}
+	return filepath.Join(home, ".tsk", "session.json"), nil
+}
+
+// SaveSession writes s to the session file, readable by its owner only
+func SaveSession(s *Session) error {
+	path, err := SessionPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to save the session: %w", err)
+	}
+	// Write a temporary file and rename it, so a session is never half written
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".session-*")
+	if err != nil {
+		return fmt.Errorf("failed to save the session: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save the session: %w", err)
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save the session: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save the session: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save the session: %w", err)
+	}
+	return nil
+}
+
+// LoadSession reads the session file; it returns ErrNoSession when there
+// is none. The session may have expired.
+func LoadSession() (*Session, error) {
+	path, err := SessionPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the session: %w", err)
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to read the session %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// DeleteSession removes the session file; it is not an error when there
+// is none
+func DeleteSession() error {
+	path, err := SessionPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete the session: %w", err)
+	}
+	return nil
+}
+
+// maxCachedCredentials bounds the memory a Cached authenticator uses
+const maxCachedCredentials = 10000
+
+// cachedAuthenticator remembers the identities of credentials it verified
+type cachedAuthenticator struct {
+	next Authenticator
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*Identity
+}
+
+// Cached returns an Authenticator that remembers what a accepted for ttl,
+// or until the identity expires, so servers do not bind to the directory
+// or verify a JWT on every request. Only hashes of the credentials are
+// kept; refusals are not remembered.
+func Cached(a Authenticator, ttl time.Duration) Authenticator {
+	return &cachedAuthenticator{next: a, ttl: ttl, entries: make(map[[sha256.Size]byte]*Identity)}
+}
+
+func (c *cachedAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, ErrNoCredentials
+	}
+	key := sha256.Sum256([]byte(header))
+	now := time.Now()
+	c.mu.Lock()
+	id, ok := c.entries[key]
+	if ok && !now.Before(id.ExpiresAt) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		// A copy, so callers cannot change what the next request gets
+		found := *id
+		return &found, nil
+	}
+
+	id, err := c.next.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	cached := *id
+	if expires := now.Add(c.ttl); cached.ExpiresAt.IsZero() || expires.Before(cached.ExpiresAt) {
+		cached.ExpiresAt = expires
+	}
+	c.mu.Lock()
+	if len(c.entries) >= maxCachedCredentials {
+		for k, e := range c.entries {
+			if !now.Before(e.ExpiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCachedCredentials {
+			clear(c.entries)
+		}
+	}
+	c.entries[key] = &cached
+	c.mu.Unlock()
+	return id, nil
+}
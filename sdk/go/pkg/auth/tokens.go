@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// minTokenLength is the shortest static token accepted in clear
+const minTokenLength = 16
+
+// StaticTokens authenticates the bearer tokens of the [auth.tokens]
+// section. The configuration may hold a token's "sha256:<hex>" hash
+// instead of the token, as HashToken prints it.
+type StaticTokens struct {
+	users  []string
+	hashes [][sha256.Size]byte
+}
+
+// NewStaticTokens authenticates the tokens of tokens, by user
+func NewStaticTokens(tokens map[string]string) (*StaticTokens, error) {
+	s := &StaticTokens{}
+	for user, token := range tokens {
+		var hash [sha256.Size]byte
+		if hexHash, ok := strings.CutPrefix(token, "sha256:"); ok {
+			raw, err := hex.DecodeString(hexHash)
+			if err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("auth.tokens.%s: invalid sha256 hash", user)
+			}
+			copy(hash[:], raw)
+		} else {
+			if len(token) < minTokenLength {
+				return nil, fmt.Errorf("auth.tokens.%s: tokens need at least %d characters", user, minTokenLength)
+			}
+			hash = sha256.Sum256([]byte(token))
+		}
+		s.users = append(s.users, user)
+		s.hashes = append(s.hashes, hash)
+	}
+	return s, nil
+}
+
+// Lookup returns the user of token, comparing it with every token in
+// constant time
+func (s *StaticTokens) Lookup(token string) (string, bool) {
+	hash := sha256.Sum256([]byte(token))
+	user, found := "", 0
+	for i, known := range s.hashes {
+		if subtle.ConstantTimeCompare(hash[:], known[:]) == 1 {
+			user, found = s.users[i], 1
+		}
+	}
+	return user, found == 1
+}
+
+// Authenticate identifies the user of a known bearer token. Other tokens,
+// such as JWTs for the OIDC method, are left to the next authenticator.
+func (s *StaticTokens) Authenticate(r *http.Request) (*Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	user, ok := s.Lookup(token)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	return &Identity{User: user, Method: TokenMethod}, nil
+}
+
+// NewToken returns a random token
+func NewToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return "tsk_" + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// HashToken returns the "sha256:<hex>" form of token for [auth.tokens]
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
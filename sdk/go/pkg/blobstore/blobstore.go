@@ -0,0 +1,351 @@
+// Package blobstore fetches objects from Amazon S3, Google Cloud Storage
+// and Azure Blob Storage, for the @s3.get, @gcs.get and @azblob.get
+// operators and `tsk config pull-remote`. Endpoints can be set in the
+// [blobs] section, for S3-compatible stores or emulators:
+//
+//	[blobs]
+//	s3.region: "eu-west-1"
+//	s3.endpoint: "https://minio.internal:9000"
+//	azure.account: "acmeconfigs"
+//
+// Credentials come from the environment, as in secretstore: S3 reads
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, GCS reads
+// GOOGLE_OAUTH_ACCESS_TOKEN or asks the metadata server, and Azure reads
+// AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN. Without credentials objects
+// are requested anonymously, which works for public buckets.
+package blobstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/secretstore"
+)
+
+// Providers, as used in URL schemes and operator names
+const (
+	S3    = "s3"
+	GCS   = "gcs"
+	Azure = "azblob"
+)
+
+// MaxSize caps the size of a fetched object
+const MaxSize = 64 << 20
+
+// azureVersion is the Blob service version requests are made with
+const azureVersion = "2021-08-06"
+
+// Options points the providers at their services. Fields left empty fall
+// back to the environment and the public endpoints.
+type Options struct {
+	S3Region string
+	// S3Endpoint replaces https://<bucket>.s3.<region>.amazonaws.com with
+	// path-style requests to another host
+	S3Endpoint string
+	// GCSEndpoint replaces https://storage.googleapis.com
+	GCSEndpoint  string
+	AzureAccount string
+	// AzureEndpoint replaces https://<account>.blob.core.windows.net
+	AzureEndpoint string
+}
+
+// OptionsFrom reads Options from the flat blobs.* keys of a configuration
+func OptionsFrom(values map[string]interface{}) (Options, error) {
+	var opts Options
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "blobs.")
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		switch setting {
+		case "s3.region":
+			opts.S3Region = text
+		case "s3.endpoint":
+			opts.S3Endpoint = text
+		case "gcs.endpoint":
+			opts.GCSEndpoint = text
+		case "azure.account":
+			opts.AzureAccount = text
+		case "azure.endpoint":
+			opts.AzureEndpoint = text
+		default:
+			return opts, fmt.Errorf("unknown setting blobs.%s", setting)
+		}
+	}
+	for setting, endpoint := range map[string]string{
+		"s3.endpoint": opts.S3Endpoint, "gcs.endpoint": opts.GCSEndpoint, "azure.endpoint": opts.AzureEndpoint,
+	} {
+		if u, err := url.Parse(endpoint); endpoint != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https")) {
+			return opts, fmt.Errorf("blobs.%s: %q is not an http or https URL", setting, endpoint)
+		}
+	}
+	return opts, nil
+}
+
+// Store fetches objects
+type Store struct {
+	mu     sync.RWMutex
+	opts   Options
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewStore creates a Store using the public endpoints
+func NewStore() *Store {
+	return &Store{client: &http.Client{Timeout: 30 * time.Second}, now: time.Now}
+}
+
+// Default is the Store behind the blob operators
+var Default = NewStore()
+
+// Configure replaces the options
+func (s *Store) Configure(opts Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts = opts
+}
+
+func (s *Store) options() Options {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.opts
+}
+
+// Get fetches path, "bucket/key" or for Azure "container/blob", from
+// provider
+func (s *Store) Get(provider, path string) ([]byte, error) {
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !ok || bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid object %q: expected bucket/key", path)
+	}
+	opts := s.options()
+	var req *http.Request
+	var err error
+	switch provider {
+	case S3:
+		req, err = s.s3Request(opts, bucket, key)
+	case GCS:
+		req, err = s.gcsRequest(opts, bucket, key)
+	case Azure:
+		req, err = s.azureRequest(opts, bucket, key)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.fetch(req, provider+"://"+bucket+"/"+key)
+}
+
+// Fetch fetches a URL: s3://bucket/key, gs://bucket/key or
+// azblob://container/blob
+func (s *Store) Fetch(rawURL string) ([]byte, error) {
+	scheme, path, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return nil, fmt.Errorf("invalid object URL %q: expected s3://, gs:// or azblob://", rawURL)
+	}
+	switch scheme {
+	case "s3":
+		return s.Get(S3, path)
+	case "gs", "gcs":
+		return s.Get(GCS, path)
+	case "azblob":
+		return s.Get(Azure, path)
+	}
+	return nil, fmt.Errorf("invalid object URL %q: expected s3://, gs:// or azblob://", rawURL)
+}
+
+// Operator returns the function of @<provider>.get("bucket/key"), which
+// returns the object as text
+func (s *Store) Operator(provider string) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("@%s.get requires a bucket/key path", provider)
+		}
+		data, err := s.Get(provider, fmt.Sprint(args[0]))
+		if err != nil {
+			return nil, fmt.Errorf("@%s.get: %w", provider, err)
+		}
+		return string(data), nil
+	}
+}
+
+func (s *Store) fetch(req *http.Request, name string) ([]byte, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		hint := ""
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			hint = " (check the credentials in the environment)"
+		}
+		return nil, fmt.Errorf("failed to fetch %s: %s%s: %s", name, resp.Status, hint, strings.TrimSpace(string(detail)))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, MaxSize)
+	}
+	return data, nil
+}
+
+// emptyHash is the SHA-256 of an empty payload
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Request builds a GET for an S3 object, signed when AWS credentials are
+// set
+func (s *Store) s3Request(opts Options, bucket, key string) (*http.Request, error) {
+	region := firstNonEmpty(opts.S3Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+	u := &url.URL{Scheme: "https", Host: bucket + ".s3." + region + ".amazonaws.com", Path: "/" + key}
+	switch {
+	case opts.S3Endpoint != "":
+		endpoint, err := url.Parse(strings.TrimRight(opts.S3Endpoint, "/"))
+		if err != nil {
+			return nil, err
+		}
+		u = &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host, Path: endpoint.Path + "/" + bucket + "/" + key}
+	case strings.Contains(bucket, "."):
+		// Dotted bucket names do not match the wildcard certificate
+		u = &url.URL{Scheme: "https", Host: "s3." + region + ".amazonaws.com", Path: "/" + bucket + "/" + key}
+	}
+	u.RawPath = awsEscape(u.Path)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if creds := secretstore.AWSCredentialsFromEnv(); creds.AccessKey != "" && creds.SecretKey != "" {
+		req.Header.Set("X-Amz-Content-Sha256", emptyHash)
+		secretstore.SignV4(req, nil, creds, region, "s3", s.now())
+	}
+	return req, nil
+}
+
+// awsEscape encodes a path the way SigV4 canonicalizes S3 paths: every
+// byte but unreserved characters and slashes
+func awsEscape(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// gcsRequest builds a JSON API media download, with a bearer token when
+// one can be found
+func (s *Store) gcsRequest(opts Options, bucket, key string) (*http.Request, error) {
+	endpoint := strings.TrimRight(firstNonEmpty(opts.GCSEndpoint, "https://storage.googleapis.com"), "/")
+	req, err := http.NewRequest(http.MethodGet,
+		endpoint+"/storage/v1/b/"+url.PathEscape(bucket)+"/o/"+url.PathEscape(key)+"?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+	if token, err := secretstore.GCPAccessToken(s.client); err == nil {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// azureRequest builds a Get Blob request, authorized with a SAS token or
+// signed with the account key when either is set
+func (s *Store) azureRequest(opts Options, container, blob string) (*http.Request, error) {
+	account := firstNonEmpty(opts.AzureAccount, os.Getenv("AZURE_STORAGE_ACCOUNT"))
+	if account == "" && opts.AzureEndpoint == "" {
+		return nil, fmt.Errorf("no Azure storage account: set blobs.azure.account or AZURE_STORAGE_ACCOUNT")
+	}
+	endpoint := strings.TrimRight(firstNonEmpty(opts.AzureEndpoint, "https://"+account+".blob.core.windows.net"), "/")
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path += "/" + container + "/" + blob
+	if sas := os.Getenv("AZURE_STORAGE_SAS_TOKEN"); sas != "" {
+		u.RawQuery = strings.TrimPrefix(sas, "?")
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Ms-Version", azureVersion)
+	req.Header.Set("X-Ms-Date", s.now().UTC().Format(http.TimeFormat))
+	if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" && u.RawQuery == "" {
+		if account == "" {
+			return nil, fmt.Errorf("AZURE_STORAGE_KEY needs an account: set blobs.azure.account or AZURE_STORAGE_ACCOUNT")
+		}
+		if err := signSharedKey(req, account, key); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// signSharedKey authorizes a bodiless request with an account key
+func signSharedKey(req *http.Request, account, key string) error {
+	secret, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("AZURE_STORAGE_KEY is not base64: %w", err)
+	}
+
+	var headers []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			headers = append(headers, lower)
+		}
+	}
+	sort.Strings(headers)
+	var canonical strings.Builder
+	for _, name := range headers {
+		canonical.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	canonical.WriteString("/" + account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := query[name]
+		sort.Strings(values)
+		canonical.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(values, ","))
+	}
+
+	// Verb, the eleven standard headers (all empty for a GET), then the
+	// canonical headers and resource
+	stringToSign := req.Method + strings.Repeat("\n", 12) + canonical.String()
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stringToSign))
+	req.Header.Set("Authorization", "SharedKey "+account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
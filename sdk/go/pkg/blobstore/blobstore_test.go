@@ -0,0 +1,119 @@
+package blobstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{
+		"blobs.s3.region":     "eu-west-1",
+		"blobs.s3.endpoint":   "http://minio:9000",
+		"blobs.azure.account": "acme",
+		"app.name":            "ignored",
+	})
+	if err != nil {
+		t.Fatalf("OptionsFrom failed: %v", err)
+	}
+	if opts.S3Region != "eu-west-1" || opts.S3Endpoint != "http://minio:9000" || opts.AzureAccount != "acme" {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+	if _, err := OptionsFrom(map[string]interface{}{"blobs.s3.bucket": "configs"}); err == nil {
+		t.Error("expected an error for an unknown setting")
+	}
+	if _, err := OptionsFrom(map[string]interface{}{"blobs.gcs.endpoint": "storage.local"}); err == nil {
+		t.Error("expected an error for an endpoint without a scheme")
+	}
+}
+
+func TestGet(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		switch r.URL.EscapedPath() {
+		case "/configs/prod/app%20v2.tsk",
+			"/storage/v1/b/configs/o/prod%2Fapp.tsk",
+			"/devstore/configs/prod/app.tsk":
+			w.Write([]byte("name: \"app\"\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	s := NewStore()
+	s.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	s.Configure(Options{S3Endpoint: server.URL, GCSEndpoint: server.URL, AzureEndpoint: server.URL + "/devstore", AzureAccount: "devstore"})
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	if data, err := s.Get(S3, "configs/prod/app v2.tsk"); err != nil || string(data) != "name: \"app\"\n" {
+		t.Fatalf("Get(s3) = %q, %v", data, err)
+	}
+	if auth := got.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240501/eu-west-1/s3/aws4_request") ||
+		got.Header.Get("X-Amz-Content-Sha256") != emptyHash {
+		t.Errorf("S3 request is not signed: %v", got.Header)
+	}
+
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "ya29.token")
+	if _, err := s.Fetch("gs://configs/prod/app.tsk"); err != nil {
+		t.Fatalf("Fetch(gs) failed: %v", err)
+	}
+	if got.Header.Get("Authorization") != "Bearer ya29.token" || got.URL.Query().Get("alt") != "media" {
+		t.Errorf("unexpected GCS request: %v %v", got.URL, got.Header)
+	}
+
+	key := base64.StdEncoding.EncodeToString([]byte("account-key"))
+	t.Setenv("AZURE_STORAGE_KEY", key)
+	if _, err := s.Fetch("azblob://configs/prod/app.tsk"); err != nil {
+		t.Fatalf("Fetch(azblob) failed: %v", err)
+	}
+	stringToSign := "GET" + strings.Repeat("\n", 12) +
+		"x-ms-date:Wed, 01 May 2024 12:00:00 GMT\nx-ms-version:" + azureVersion + "\n/devstore/devstore/configs/prod/app.tsk"
+	mac := hmac.New(sha256.New, []byte("account-key"))
+	mac.Write([]byte(stringToSign))
+	if want := "SharedKey devstore:" + base64.StdEncoding.EncodeToString(mac.Sum(nil)); got.Header.Get("Authorization") != want {
+		t.Errorf("Authorization = %q, want %q", got.Header.Get("Authorization"), want)
+	}
+
+	t.Setenv("AZURE_STORAGE_SAS_TOKEN", "?sv=2021-08-06&sig=abc")
+	if _, err := s.Get(Azure, "configs/prod/app.tsk"); err != nil {
+		t.Fatalf("Get(azblob) with a SAS token failed: %v", err)
+	}
+	if got.URL.Query().Get("sig") != "abc" || got.Header.Get("Authorization") != "" {
+		t.Errorf("SAS request should carry the token only: %v %v", got.URL, got.Header)
+	}
+
+	if _, err := s.Get(S3, "configs/missing.tsk"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+	for _, bad := range []string{"configs", "/configs/", "ftp://host/file"} {
+		if _, err := s.Fetch(bad); err == nil {
+			t.Errorf("Fetch(%q) should fail", bad)
+		}
+	}
+}
+
+func TestS3URL(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	s := NewStore()
+	for bucket, want := range map[string]string{
+		"configs":      "https://configs.s3.us-west-2.amazonaws.com/a/b%2Bc.tsk",
+		"configs.acme": "https://s3.us-west-2.amazonaws.com/configs.acme/a/b%2Bc.tsk",
+	} {
+		req, err := s.s3Request(Options{S3Region: "us-west-2"}, bucket, "a/b+c.tsk")
+		if err != nil || req.URL.String() != want {
+			t.Errorf("s3Request(%s) = %v, %v; want %s", bucket, req.URL, err, want)
+		}
+		if req.Header.Get("Authorization") != "" {
+			t.Errorf("request without credentials should be anonymous: %v", req.Header)
+		}
+	}
+}
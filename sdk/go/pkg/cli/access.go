@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	"github.com/cyber-boost/tusktsk/pkg/enterprise"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// authorizeCommand checks the permission cmd needs under the access
+// policy of the directory it works on, its --dir or the working
+// directory, if there is one
+func (c *CLI) authorizeCommand(cmd *cobra.Command) error {
+	dir := "."
+	if flag := cmd.Flags().Lookup("dir"); flag != nil && flag.Value.String() != "" {
+		dir = flag.Value.String()
+	}
+	err := enterprise.AuthorizeCommand(dir, c.out.Command)
+	if err != nil {
+		// A denial is not a misuse of the command
+		cmd.SilenceUsage = true
+	}
+	return err
+}
+
+// Access Commands
+func (c *CLI) addAccessCommands() {
+	accessCmd := &cobra.Command{
+		Use:   "access",
+		Short: "Role-based access control commands",
+		Long: `Commands for the roles and users of access.policy.tsk. While the file
+exists in the directory a command works on, its --dir or the working
+directory (or $TSK_ACCESS_POLICY names one), commands that need a
+permission check it for $TSK_USER, or the login name:
+
+  tsk config set    config:write
+  tsk db drop       db:admin
+
+Its [commands] section adds or lifts requirements by command path, and the
+API of tsk serve --api checks the [routes] of each request for its
+authenticated user: the [auth] user, or the X-Tsk-User of requests bearing
+its --token.`,
+	}
+
+	var dir string
+	checkCmd := &cobra.Command{
+		Use:   "check <user> <permission|command>",
+		Short: "Check whether a user holds a permission or may run a command",
+		Long: `Check whether a user holds a permission, such as config:write, or may
+run a command, such as "config set". Exits with the permission error code
+(7) when the user may not.`,
+		Example: `  tsk access check ada config:write
+  tsk access check ci "db drop"`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Denials are a result, not a misuse of the command
+			cmd.SilenceUsage = true
+			return c.handleAccessCheck(dir, args[0], args[1])
+		},
+	}
+	checkCmd.Flags().StringVar(&dir, "dir", ".", "Directory whose access.policy.tsk is read")
+	accessCmd.AddCommand(checkCmd)
+
+	effectiveCmd := &cobra.Command{
+		Use:   "effective-permissions <user>",
+		Short: "List the permissions a user holds, through which roles",
+		Long: `List the permissions a user holds: its own, then those of its roles and of
+the roles they inherit from, with the chain of roles each comes through.
+Wildcards such as config:* are listed as granted.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return c.handleAccessEffectivePermissions(dir, args[0])
+		},
+	}
+	effectiveCmd.Flags().StringVar(&dir, "dir", ".", "Directory whose access.policy.tsk is read")
+	accessCmd.AddCommand(effectiveCmd)
+
+	c.rootCmd.AddCommand(accessCmd)
+}
+
+// accessDecision is the result of tsk access check
+type accessDecision struct {
+	User       string `json:"user"`
+	Command    string `json:"command,omitempty"`
+	Permission string `json:"permission,omitempty"`
+	Allowed    bool   `json:"allowed"`
+	// GrantedBy is where the permission comes from, see Grant.Source
+	GrantedBy string `json:"granted_by,omitempty"`
+	Policy    string `json:"policy"`
+}
+
+// findAccessPolicy reads the access policy of dir, which must have one
+func findAccessPolicy(dir string) (*enterprise.AccessPolicy, error) {
+	policy, err := enterprise.FindAccessPolicy(dir)
+	if err == nil && policy == nil {
+		err = tskerrors.New(tskerrors.NotFound, "no %s in %s: access is not enforced", enterprise.AccessPolicyFile, dir)
+	}
+	return policy, err
+}
+
+// Access Check Command Handler
+func (c *CLI) handleAccessCheck(dir, user, action string) error {
+	policy, err := findAccessPolicy(dir)
+	if err != nil {
+		return err
+	}
+
+	decision := accessDecision{User: user, Permission: action, Policy: policy.File}
+	if !strings.Contains(action, ":") {
+		decision.Command = strings.TrimPrefix(action, "tsk ")
+		decision.Permission = policy.CommandPermission(decision.Command)
+	}
+	if decision.Permission == "" {
+		decision.Allowed = true
+	} else {
+		var grant enterprise.Grant
+		if grant, decision.Allowed = policy.Check(user, decision.Permission); decision.Allowed {
+			decision.GrantedBy = grant.Source()
+		}
+	}
+
+	err = c.out.Result(decision, func(w io.Writer) {
+		switch {
+		case decision.Permission == "":
+			fmt.Fprintf(w, "✅ tsk %s needs no permission\n", decision.Command)
+		case decision.Allowed && decision.GrantedBy == "user":
+			fmt.Fprintf(w, "✅ %s holds %s, granted directly\n", user, decision.Permission)
+		case decision.Allowed:
+			fmt.Fprintf(w, "✅ %s holds %s through role %s\n", user, decision.Permission, decision.GrantedBy)
+		default:
+			fmt.Fprintf(w, "❌ %s lacks %s\n", user, decision.Permission)
+		}
+	})
+	if err != nil || decision.Allowed {
+		return err
+	}
+	return policy.Authorize(user, decision.Permission)
+}
+
+// Access Effective Permissions Command Handler
+func (c *CLI) handleAccessEffectivePermissions(dir, user string) error {
+	policy, err := findAccessPolicy(dir)
+	if err != nil {
+		return err
+	}
+	grants, err := policy.EffectivePermissions(user)
+	if err != nil {
+		return tskerrors.Wrap(tskerrors.NotFound, err)
+	}
+
+	return c.out.Result(map[string]interface{}{"user": user, "permissions": grants, "policy": policy.File}, func(w io.Writer) {
+		if len(grants) == 0 {
+			fmt.Fprintf(w, "%s holds no permissions\n", user)
+			return
+		}
+		table := cliio.NewTable("PERMISSION", "GRANTED BY")
+		for _, grant := range grants {
+			table.AddRow(grant.Permission, grant.Source())
+		}
+		table.Render(w)
+	})
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	"github.com/cyber-boost/tusktsk/pkg/enterprise"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/spf13/cobra"
+)
+
+// auditOptions reads the [audit] section of dir's hierarchy; a directory
+// without configuration uses the defaults
+func auditOptions(dir string) (enterprise.AuditOptions, error) {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if errors.Is(err, peanut.ErrNotFound) {
+		return enterprise.AuditOptionsFrom(nil, dir)
+	}
+	if err != nil {
+		return enterprise.AuditOptions{}, err
+	}
+	values, err := cfg.Execute(peanut.NewVM())
+	if err != nil {
+		return enterprise.AuditOptions{}, err
+	}
+	return enterprise.AuditOptionsFrom(values, dir)
+}
+
+// Audit Commands
+func (c *CLI) addAuditCommands() {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Audit log commands",
+		Long:  "Commands for reading the audit log kept by the sinks of the [audit] section",
+	}
+
+	var dir, sink, user, action, resource, since, until string
+	var limit int
+	queryCmd := &cobra.Command{
+		Use:   "query",
+		Short: "Filter the audit log by user, action, resource and time",
+		Long: `Read the audit log from the file sink, or from the database sink when it is
+the only readable one or --sink database is given, oldest first.
+
+--since and --until take a time (2025-01-02 or RFC 3339) or a duration
+before now, such as 24h or 7d.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := enterprise.AuditQuery{UserID: user, Action: action, Resource: resource, Limit: limit}
+			var err error
+			if q.Since, err = parseAuditTime(since); err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			if q.Until, err = parseAuditTime(until); err != nil {
+				return fmt.Errorf("invalid --until: %w", err)
+			}
+			return c.handleAuditQuery(dir, sink, q)
+		},
+	}
+	queryCmd.Flags().StringVar(&dir, "dir", ".", "Directory whose [audit] section is read")
+	queryCmd.Flags().StringVar(&sink, "sink", "", "Sink to read: file or database (default the first configured)")
+	queryCmd.Flags().StringVar(&user, "user", "", "Only events of this user")
+	queryCmd.Flags().StringVar(&action, "action", "", "Only events with this action")
+	queryCmd.Flags().StringVar(&resource, "resource", "", "Only events on this resource")
+	queryCmd.Flags().StringVar(&since, "since", "", "Only events at or after this time")
+	queryCmd.Flags().StringVar(&until, "until", "", "Only events before this time")
+	queryCmd.Flags().IntVar(&limit, "limit", 100, "Show the newest events only (0 for all)")
+	auditCmd.AddCommand(queryCmd)
+
+	c.rootCmd.AddCommand(auditCmd)
+}
+
+// parseAuditTime parses a date, an RFC 3339 time, or a duration before now
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	ago, err := parseWindow(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a time nor a duration", value)
+	}
+	return time.Now().Add(-ago), nil
+}
+
+// Audit Query Command Handler
+func (c *CLI) handleAuditQuery(dir, sink string, q enterprise.AuditQuery) error {
+	opts, err := auditOptions(dir)
+	if err != nil {
+		return err
+	}
+	if sink == "" {
+		for _, configured := range opts.Sinks {
+			if configured == enterprise.FileSinkName || configured == enterprise.DatabaseSinkName {
+				sink = configured
+				break
+			}
+		}
+	}
+
+	var logs []enterprise.AuditLog
+	switch sink {
+	case enterprise.FileSinkName:
+		logs, err = enterprise.QueryAuditFile(opts.File, q)
+	case enterprise.DatabaseSinkName:
+		var table *enterprise.TableSink
+		if table, err = enterprise.OpenTableSink(opts.DatabaseAdapter, opts.DatabaseDSN); err == nil {
+			logs, err = table.Query(q)
+			table.Close()
+		}
+	case "":
+		return errors.New("no readable audit sink is configured: add file or database to audit.sinks")
+	default:
+		return fmt.Errorf("the %s audit sink cannot be queried: use file or database", sink)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.out.Result(logs, func(w io.Writer) {
+		if len(logs) == 0 {
+			fmt.Fprintln(w, "No audit events match")
+			return
+		}
+		table := cliio.NewTable("TIME", "USER", "ACTION", "RESOURCE", "FROM", "DETAILS")
+		for _, log := range logs {
+			from := log.IPAddress
+			if from == "" {
+				from = "-"
+			}
+			table.AddRow(log.Timestamp.Local().Format("2006-01-02 15:04:05"), log.UserID, log.Action, log.Resource, from, auditDetails(log.Metadata))
+		}
+		table.Render(w)
+	})
+}
+
+// auditDetails lays out the metadata of an event as sorted key=value pairs
+func auditDetails(metadata map[string]interface{}) string {
+	if len(metadata) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
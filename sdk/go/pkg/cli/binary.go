@@ -0,0 +1,465 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/spf13/cobra"
+)
+
+// Binary Commands
+func (c *CLI) addBinaryCommands() {
+	binaryCmd := &cobra.Command{
+		Use:   "binary",
+		Short: "Binary configuration (.pnt) commands",
+		Long:  "Commands for compiling configuration to the .pnt binary format and reading it back",
+	}
+
+	var publicKey string
+	binaryCmd.PersistentFlags().StringVar(&publicKey, "public-key", "", "Require binaries signed by this PEM public key (default $"+peanut.PublicKeyEnv+")")
+
+	// Binary Compile
+	var output, compression, checksum, signKey string
+	var formatVersion uint32
+	var chunked chunkedFlags
+	compileCmd := &cobra.Command{
+		Use:   "compile [file]",
+		Short: "Compile a .tsk or .peanuts file to .pnt",
+		Long: `Compile a text configuration to the .pnt binary format.
+
+Files larger than a few hundred MB should use --chunked, which parses the
+file in segments with bounded memory, checkpoints after every segment so an
+interrupted compile resumes when run again, and shows progress. Files over
+the in-memory limit are compiled chunked automatically.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.Flags().Changed("format-version") && formatVersion == peanut.FormatV1 && !cmd.Flags().Changed("checksum") {
+				checksum = string(peanut.ChecksumNone)
+			}
+			for _, name := range []string{"chunk-size", "rate", "work-dir"} {
+				chunked.enabled = chunked.enabled || cmd.Flags().Changed(name)
+			}
+			return c.handleBinaryCompile(args[0], output, formatVersion, compression, checksum, signKey, chunked)
+		},
+	}
+	compileCmd.Flags().StringVarP(&output, "output", "o", "", "Output file (defaults to the input name with .pnt)")
+	compileCmd.Flags().Uint32Var(&formatVersion, "format-version", peanut.CurrentFormat, "Binary format version (1 or 2)")
+	compileCmd.Flags().StringVar(&compression, "compress", "none", "Payload compression (none, gzip, zstd)")
+	compileCmd.Flags().Lookup("compress").NoOptDefVal = string(peanut.CompressionZstd)
+	compileCmd.Flags().StringVar(&checksum, "checksum", string(peanut.DefaultWriteOptions.Checksum), "Integrity footer (none, crc32, sha256)")
+	compileCmd.Flags().StringVar(&signKey, "sign", "", "Sign with this PEM Ed25519 private key")
+	compileCmd.Flags().BoolVar(&chunked.enabled, "chunked", false, "Compile in resumable segments with bounded memory")
+	compileCmd.Flags().StringVar(&chunked.chunkSize, "chunk-size", "64MB", "Text parsed per segment with --chunked")
+	compileCmd.Flags().StringVar(&chunked.rate, "rate", "", "Limit input reads with --chunked, e.g. 50MB (per second)")
+	compileCmd.Flags().StringVar(&chunked.workDir, "work-dir", "", "Checkpoint directory with --chunked (default <output>.parts)")
+	binaryCmd.AddCommand(compileCmd)
+
+	// Binary Get
+	getCmd := &cobra.Command{
+		Use:   "get [file] [key]",
+		Short: "Read a single key from a configuration file",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleBinaryGet(args[0], args[1], publicKey)
+		},
+	}
+	binaryCmd.AddCommand(getCmd)
+
+	// Binary Execute
+	executeCmd := &cobra.Command{
+		Use:   "execute [file] [key]",
+		Short: "Evaluate operator expressions (@env, @date, @query, ternaries) and print resolved values",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key := ""
+			if len(args) == 2 {
+				key = args[1]
+			}
+			return c.handleBinaryExecute(args[0], key, publicKey)
+		},
+	}
+	binaryCmd.AddCommand(executeCmd)
+
+	// Binary Verify
+	verifyCmd := &cobra.Command{
+		Use:   "verify [file]",
+		Short: "Verify the checksum and signature of a binary",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleBinaryVerify(args[0], publicKey)
+		},
+	}
+	binaryCmd.AddCommand(verifyCmd)
+
+	// Binary Keygen
+	keygenCmd := &cobra.Command{
+		Use:   "keygen [name]",
+		Short: "Generate an Ed25519 key pair (name.pem, name.pub.pem) for signing",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleBinaryKeygen(args[0])
+		},
+	}
+	binaryCmd.AddCommand(keygenCmd)
+
+	// Binary Benchmark
+	var iterations, warmup int
+	var benchCompression string
+	benchmarkCmd := &cobra.Command{
+		Use:   "benchmark [file]",
+		Short: "Compare parsing text, loading the binary and executing expressions",
+		Long: `Benchmark a text configuration (default peanu.tsk) against its compiled
+binary. Each workload runs --warmup times, then --iterations timed runs:
+
+  parse-text   load and parse the text file
+  load-binary  open and validate the compiled .pnt
+  execute      evaluate every key of the loaded binary with the expression VM
+
+Reports p50/p95/p99 latencies and allocations per run; the global --json
+output is meant for CI regression tracking.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file := "peanu.tsk"
+			if len(args) > 0 {
+				file = args[0]
+			}
+			return c.handleBinaryBenchmark(file, iterations, warmup, benchCompression)
+		},
+	}
+	benchmarkCmd.Flags().IntVarP(&iterations, "iterations", "n", peanut.DefaultBenchmarkOptions.Iterations, "Timed iterations per workload")
+	benchmarkCmd.Flags().IntVar(&warmup, "warmup", peanut.DefaultBenchmarkOptions.Warmup, "Untimed warmup iterations per workload")
+	benchmarkCmd.Flags().StringVar(&benchCompression, "compress", "none", "Payload compression of the benchmarked binary (none, gzip, zstd)")
+	binaryCmd.AddCommand(benchmarkCmd)
+
+	c.rootCmd.AddCommand(binaryCmd)
+}
+
+// Binary Command Handlers
+// chunkedFlags are the --chunked options of binary compile
+type chunkedFlags struct {
+	enabled   bool
+	chunkSize string
+	rate      string
+	workDir   string
+}
+
+func (c *CLI) handleBinaryCompile(input, output string, version uint32, compressionName, checksumName, signKey string, chunked chunkedFlags) error {
+	compression, err := peanut.ParseCompression(compressionName)
+	if err != nil {
+		return err
+	}
+	checksum, err := peanut.ParseChecksum(checksumName)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		output = strings.TrimSuffix(input, ".peanuts")
+		output = strings.TrimSuffix(output, ".tsk") + ".pnt"
+	}
+
+	opts := peanut.WriteOptions{Version: version, Compression: compression, Checksum: checksum}
+	if signKey != "" {
+		if opts.SigningKey, err = peanut.LoadPrivateKey(signKey); err != nil {
+			return err
+		}
+	}
+
+	if !chunked.enabled && peanut.MaxTextFileSize > 0 {
+		if info, err := os.Stat(input); err == nil && info.Size() > peanut.MaxTextFileSize {
+			c.out.Printf("⚠️  %s is %s, too large to parse in memory; compiling in chunks instead\n", input, formatBytes(info.Size()))
+			chunked.enabled = true
+		}
+	}
+	if chunked.enabled {
+		return c.compileChunked(input, output, opts, chunked)
+	}
+
+	if err := peanut.CompileToBinaryWith(input, output, opts); err != nil {
+		return err
+	}
+	result := compileResult{Input: input, Output: output, Version: version, Compression: string(compression),
+		Checksum: string(checksum), Signed: opts.SigningKey != nil}
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ Compiled %s -> %s (format v%d, compression: %s, checksum: %s, signed: %t)\n",
+			input, output, version, compression, checksum, result.Signed)
+	})
+}
+
+// compileResult is the result of binary compile
+type compileResult struct {
+	Input       string `json:"input"`
+	Output      string `json:"output"`
+	Version     uint32 `json:"version,omitempty"`
+	Compression string `json:"compression"`
+	Checksum    string `json:"checksum"`
+	Signed      bool   `json:"signed"`
+	Chunked     bool   `json:"chunked,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// compileChunked runs peanut.CompileChunked with a progress line, stopping
+// cleanly on Ctrl+C so the next run resumes from the checkpoint
+func (c *CLI) compileChunked(input, output string, opts peanut.WriteOptions, flags chunkedFlags) error {
+	chunkSize, err := parseByteSize(flags.chunkSize)
+	if err != nil {
+		return fmt.Errorf("invalid --chunk-size: %w", err)
+	}
+	var rate int64
+	if flags.rate != "" {
+		if rate, err = parseByteSize(flags.rate); err != nil {
+			return fmt.Errorf("invalid --rate: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	resumeNoted := false
+	err = peanut.CompileChunked(ctx, input, output, peanut.ChunkedOptions{
+		Write:     opts,
+		ChunkSize: chunkSize,
+		RateLimit: rate,
+		WorkDir:   flags.workDir,
+		Progress: func(p peanut.CompileProgress) {
+			if p.Resumed && !resumeNoted {
+				c.out.Println("⏯️  Resuming from checkpoint")
+				resumeNoted = true
+			}
+			percent := 100.0
+			if p.Total > 0 {
+				percent = float64(p.Done) * 100 / float64(p.Total)
+			}
+			c.out.Printf("\r⏳ %-5s %5.1f%%  %s / %s  elapsed %s  ETA %s   ", p.Phase, percent,
+				formatBytes(p.Done), formatBytes(p.Total), p.Elapsed.Round(time.Second), p.ETA.Round(time.Second))
+		},
+	})
+	c.out.Println()
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(output)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", output, err)
+	}
+	result := compileResult{Input: input, Output: output, Compression: string(opts.Compression),
+		Checksum: string(opts.Checksum), Signed: opts.SigningKey != nil, Chunked: true, Size: info.Size()}
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ Compiled %s -> %s in chunks (%s, compression: %s, checksum: %s)\n",
+			input, output, formatBytes(info.Size()), opts.Compression, opts.Checksum)
+	})
+}
+
+// parseByteSize parses sizes such as "512", "64KB", "64MB" or "2GB"
+// (binary multiples)
+func parseByteSize(value string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if trimmed, ok := strings.CutSuffix(upper, unit.suffix); ok {
+			upper, multiplier = strings.TrimSpace(trimmed), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func (c *CLI) handleBinaryGet(file, key, publicKey string) error {
+	cfg, err := loadBinaryVerified(file, publicKey)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	value, ok, err := cfg.Lookup(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("key %s not found in %s", key, file)
+	}
+	return c.out.Result(value, printJSON(value))
+}
+
+func (c *CLI) handleBinaryExecute(file, key, publicKey string) error {
+	cfg, err := loadBinaryVerified(file, publicKey)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	vm := peanut.NewVM()
+	var result interface{}
+	if key == "" {
+		values, err := cfg.Execute(vm)
+		if err != nil {
+			return err
+		}
+		result = config.Nest(values)
+	} else {
+		value, ok, err := cfg.Resolve(key, vm)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("key %s not found in %s", key, file)
+		}
+		result = value
+	}
+	return c.out.Result(result, printJSON(result))
+}
+
+// printJSON renders a value as indented JSON, the text form of results
+// that are configuration values
+func printJSON(value interface{}) func(w io.Writer) {
+	return func(w io.Writer) {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(value)
+	}
+}
+
+func (c *CLI) handleBinaryVerify(file, publicKey string) error {
+	if publicKey == "" && os.Getenv(peanut.PublicKeyEnv) == "" {
+		return fmt.Errorf("no public key configured (use --public-key or $%s)", peanut.PublicKeyEnv)
+	}
+
+	cfg, err := loadBinaryVerified(file, publicKey)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	result := struct {
+		File  string `json:"file"`
+		Valid bool   `json:"valid"`
+		Keys  int    `json:"keys"`
+	}{file, true, len(cfg.Keys())}
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ %s: signature valid (%d keys)\n", file, result.Keys)
+	})
+}
+
+func (c *CLI) handleBinaryKeygen(name string) error {
+	privateFile, publicFile := name+".pem", name+".pub.pem"
+	if _, err := os.Stat(privateFile); err == nil {
+		return fmt.Errorf("%s already exists", privateFile)
+	}
+	if err := peanut.GenerateKeyPair(privateFile, publicFile); err != nil {
+		return err
+	}
+	result := struct {
+		PrivateKey string `json:"private_key"`
+		PublicKey  string `json:"public_key"`
+	}{privateFile, publicFile}
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ Wrote private key %s and public key %s\n", privateFile, publicFile)
+		fmt.Fprintf(w, "🔒 Keep %s secret; distribute %s to hosts that load the binaries\n", privateFile, publicFile)
+	})
+}
+
+func (c *CLI) handleBinaryBenchmark(file string, iterations, warmup int, compressionName string) error {
+	compression, err := peanut.ParseCompression(compressionName)
+	if err != nil {
+		return err
+	}
+	opts := peanut.BenchmarkOptions{Iterations: iterations, Warmup: warmup, Write: peanut.DefaultWriteOptions}
+	opts.Write.Compression = compression
+
+	report, err := peanut.Benchmark(file, opts)
+	if err != nil {
+		return err
+	}
+
+	return c.out.Result(report, func(w io.Writer) {
+		fmt.Fprintf(w, "📊 Benchmark: %s (%d keys, text %d bytes, binary %d bytes, compression: %s)\n",
+			report.File, report.Keys, report.TextSize, report.BinarySize, compression)
+		fmt.Fprintf(w, "   %d iterations after %d warmup, %s %s\n\n", iterations, warmup, report.GoVersion, report.Platform)
+		table := cliio.NewTable("WORKLOAD", "P50", "P95", "P99", "MEAN", "ALLOCS/OP", "BYTES/OP").AlignRight(1, 2, 3, 4, 5, 6)
+		for _, r := range report.Results {
+			table.AddRow(r.Name, formatLatency(r.P50), formatLatency(r.P95), formatLatency(r.P99), formatLatency(r.Mean), r.AllocsPerOp, r.BytesPerOp)
+		}
+		table.Render(w)
+
+		text, _ := report.Result(peanut.WorkloadParseText)
+		binary, _ := report.Result(peanut.WorkloadLoadBinary)
+		if binary.P50 > 0 && text.P50 > 0 {
+			if ratio := float64(text.P50) / float64(binary.P50); ratio >= 1 {
+				fmt.Fprintf(w, "\n⚡ load-binary is %.1fx faster than parse-text (p50)\n", ratio)
+			} else {
+				fmt.Fprintf(w, "\n⚠️  load-binary is %.1fx slower than parse-text (p50); small files gain little from the binary\n", 1/ratio)
+			}
+		}
+		if report.JIT != nil && report.JIT.TotalCompilations > 0 {
+			compiled, _ := report.Result(peanut.WorkloadExecute)
+			interpreted, _ := report.Result(peanut.WorkloadExecuteInterpreted)
+			fmt.Fprintf(w, "🔥 JIT compiled %d expression(s), folding %d constant(s) and precompiling %d regex(es)",
+				report.JIT.TotalCompilations, report.JIT.FoldedConstants, report.JIT.PrecompiledRegexes)
+			if compiled.P50 > 0 && interpreted.P50 > 0 {
+				fmt.Fprintf(w, "; execute is %.1fx the speed of execute-interpreted (p50)", float64(interpreted.P50)/float64(compiled.P50))
+			}
+			fmt.Fprintln(w)
+		}
+		if pools := report.ParserPools; pools != nil && pools.TotalAllocated > 0 {
+			fmt.Fprintf(w, "♻️  parse-text reused %.1f%% of %d parser temporaries from the scratch pools\n", pools.HitRate*100, pools.TotalAllocated)
+		}
+	})
+}
+
+// formatLatency rounds a duration for the benchmark table
+func formatLatency(d time.Duration) string {
+	switch {
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	case d >= 10*time.Microsecond:
+		return d.Round(100 * time.Nanosecond).String()
+	case d >= time.Microsecond:
+		return d.Round(10 * time.Nanosecond).String()
+	}
+	return d.String()
+}
+
+// loadBinaryVerified loads a binary, requiring a signature from publicKey
+// when given and falling back to $TSK_BINARY_PUBLIC_KEY otherwise
+func loadBinaryVerified(file, publicKey string) (*peanut.Config, error) {
+	if publicKey == "" {
+		return peanut.LoadFile(file)
+	}
+	key, err := peanut.LoadPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return peanut.LoadBinaryWith(file, peanut.LoadOptions{PublicKey: key})
+}
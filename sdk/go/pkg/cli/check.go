@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// Config Check Handler
+func (c *CLI) handleConfigCheck(dir string, explain bool) error {
+	h, err := peanut.ResolveHierarchy(dir)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(h.Origins))
+	for key := range h.Origins {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	report := struct {
+		Files   []string            `json:"files"`
+		Keys    int                 `json:"keys"`
+		Origins []peanut.KeyOrigin  `json:"origins,omitempty"`
+		Dropped []peanut.DroppedKey `json:"dropped,omitempty"`
+	}{Files: h.Files, Keys: len(keys)}
+	if explain {
+		for _, key := range keys {
+			report.Origins = append(report.Origins, h.Origins[key])
+		}
+		report.Dropped = h.Dropped
+	}
+
+	return c.out.Result(report, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ %d keys from %d file(s)\n", len(keys), len(h.Files))
+		for i, file := range h.Files {
+			fmt.Fprintf(w, "  %d. %s\n", i+1, file)
+		}
+		if !explain {
+			return
+		}
+
+		fmt.Fprintln(w, "\n📋 Merge provenance:")
+		for _, key := range keys {
+			origin := h.Origins[key]
+			value, _, _ := h.Config.Lookup(key)
+			fmt.Fprintf(w, "  %s = %v\n", key, value)
+			from := origin.File
+			if origin.Line > 0 {
+				from = fmt.Sprintf("%s:%d", origin.File, origin.Line)
+			}
+			fmt.Fprintf(w, "      from %s (%s)\n", from, origin.Strategy)
+			for _, file := range origin.Overrides {
+				fmt.Fprintf(w, "      overrides %s\n", file)
+			}
+		}
+		if len(h.Dropped) > 0 {
+			fmt.Fprintln(w, "\n🗑️  Dropped by replace:")
+			for _, dropped := range h.Dropped {
+				fmt.Fprintf(w, "  %s from %s (replaced by %s)\n", dropped.Key, dropped.File, dropped.By)
+			}
+		}
+	})
+}
+
+// Config Get Handler
+func (c *CLI) handleConfigGet(dir, key string, origin bool) error {
+	result, err := lookupConfig(dir, key)
+	if err != nil {
+		return err
+	}
+	if !result.Found {
+		return tskerrors.New(tskerrors.NotFound, "key %s not found", key)
+	}
+
+	report := struct {
+		Key    string            `json:"key"`
+		Value  interface{}       `json:"value"`
+		Origin *peanut.KeyOrigin `json:"origin,omitempty"`
+	}{Key: key, Value: result.Value}
+	if origin {
+		report.Origin = result.Origin
+	}
+
+	return c.out.Result(report, func(w io.Writer) {
+		fmt.Fprintf(w, "%s = %s\n", key, config.FormatValue(report.Value))
+		if !origin {
+			return
+		}
+		if report.Origin == nil {
+			// Sections have no single origin; their keys do
+			fmt.Fprintf(w, "📋 %s is a section; ask for one of its keys\n", key)
+			return
+		}
+
+		chain := report.Origin.Chain
+		fmt.Fprintln(w, "\n📋 Override chain (root first):")
+		for i, source := range chain {
+			location := source.File
+			if source.Line > 0 {
+				location = fmt.Sprintf("%s:%d", source.File, source.Line)
+			}
+			state := "overridden"
+			if i == len(chain)-1 {
+				state = "effective"
+			} else if chain[i+1].Strategy == config.MergeAppend {
+				state = "appended to"
+			}
+			fmt.Fprintf(w, "  %d. %s = %s (%s, %s)\n", i+1, location, config.FormatValue(source.Value), source.Strategy, state)
+		}
+	})
+}
@@ -3,8 +3,19 @@ package cli
 
 import (
 	"fmt"
-
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/license"
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	"github.com/cyber-boost/tusktsk/pkg/configgit"
 	tusktsk "github.com/cyber-boost/tusktsk/pkg/core"
+	"github.com/cyber-boost/tusktsk/pkg/databasecli"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -14,12 +25,16 @@ type CLI struct {
 	rootCmd *cobra.Command
 	sdk     *tusktsk.SDK
 	config  *viper.Viper
+	out     *cliio.Output
+	// trace records the command when --trace is set
+	trace *commandTrace
 }
 
 // New creates a new CLI instance
 func New(sdk *tusktsk.SDK) *CLI {
 	cli := &CLI{
 		sdk: sdk,
+		out: cliio.Default(),
 	}
 	cli.setupConfig()
 	cli.setupCommands()
@@ -39,8 +54,81 @@ func (c *CLI) setupConfig() {
 
 // Run runs the CLI with the given arguments
 func (c *CLI) Run(args []string) error {
-	c.rootCmd.SetArgs(args[1:]) // Skip the program name
-	return c.rootCmd.Execute()
+	return c.execute(args[1:]) // Skip the program name
+}
+
+// Main runs tsk on os.Args and exits with the code of the kind of its
+// failure, see pkg/errors
+func Main() {
+	err := New(nil).Run(os.Args)
+	// Tiered caches keep what they hold and their access counts on disk
+	peanut.StopCaches()
+	os.Exit(tskerrors.ExitCode(err))
+}
+
+// execute runs one command line. In JSON and YAML output a failure is
+// also printed as an error envelope, unless the command printed one.
+// The error returned carries its kind, see pkg/errors.
+func (c *CLI) execute(args []string) error {
+	c.rootCmd.SetArgs(args)
+	cmd, err := c.rootCmd.ExecuteC()
+	c.finishTrace()
+	if err != nil && isUsageError(err) {
+		err = tskerrors.Wrap(tskerrors.Usage, err)
+	}
+	err = tskerrors.Classify(err)
+	if err != nil && !c.out.Printed() {
+		if cmd != nil {
+			c.selectOutput(cmd)
+		}
+		c.out.Error(err)
+	}
+	// Commands without a result still answer scripts with an envelope
+	if err == nil && c.out.Structured() && !c.out.Printed() && cmd.Runnable() && !cmd.Hidden &&
+		cmd.Name() != "help" && cmd.Name() != "completion" && (cmd.Parent() == nil || cmd.Parent().Name() != "completion") {
+		c.out.Result(nil, nil)
+	}
+	return err
+}
+
+// isUsageError reports the command line errors cobra returns as plain
+// errors; flag and argument errors are marked by usageErrors
+func isUsageError(err error) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "unknown command") || strings.HasPrefix(msg, "required flag(s)") ||
+		strings.HasPrefix(msg, "if any flags in the group")
+}
+
+// usageErrors marks the flag and argument errors of cmd and its
+// subcommands as tskerrors.Usage
+func usageErrors(cmd *cobra.Command) {
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return tskerrors.Wrap(tskerrors.Usage, err)
+	})
+	if args := cmd.Args; args != nil {
+		cmd.Args = func(cmd *cobra.Command, a []string) error {
+			return tskerrors.Wrap(tskerrors.Usage, args(cmd, a))
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		usageErrors(sub)
+	}
+}
+
+// selectOutput applies the --json and --yaml flags of cmd, which override
+// $TSK_OUTPUT
+func (c *CLI) selectOutput(cmd *cobra.Command) {
+	c.out.Command = strings.TrimPrefix(strings.TrimPrefix(cmd.CommandPath(), c.rootCmd.Name()), " ")
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		c.out.Format = cliio.JSON
+	} else if asYAML, _ := cmd.Flags().GetBool("yaml"); asYAML {
+		c.out.Format = cliio.YAML
+	}
+	if c.out.Structured() {
+		// The error envelope replaces cobra's error and usage text
+		c.rootCmd.SilenceErrors = true
+		c.rootCmd.SilenceUsage = true
+	}
 }
 
 // setupCommands sets up all CLI commands
@@ -60,14 +148,47 @@ Features:
 - Multi-database support with ORM
 - Web server and API framework`,
 		Version: "1.0.0",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			c.selectOutput(cmd)
+			c.startTrace(cmd)
+			return c.authorizeCommand(cmd)
+		},
 	}
+	c.rootCmd.PersistentFlags().Bool("json", false, "Print results as JSON (default $"+cliio.FormatEnv+", text)")
+	c.rootCmd.PersistentFlags().Bool("yaml", false, "Print results as YAML")
+	c.rootCmd.PersistentFlags().Bool("trace", false, "Print the trace tree of the command (parses, operators, queries) to stderr")
 
 	// Add all command groups
 	c.addAICommands()
 	c.addCacheCommands()
 	c.addConfigCommands()
-	// Database commands moved to separate package to avoid import cycles
+	c.addSchemaCommands()
+	c.addConvertCommand()
+	c.addMigrateCommand()
+	c.addRefactorCommands()
+	c.addPromoteCommand()
+	c.addRenderCommand()
+	c.addK8sCommands()
+	c.addDockerCommands()
+	c.addTfvarsCommand()
+	c.addRemoteCommands()
+	c.addServeCommand()
+	c.addDaemonCommand()
+	c.addPerfCommands()
+	c.addShellCommand()
+	c.addDoctorCommand()
+	c.addFeatureCommands()
+	c.addJobsCommands()
+	c.addComputeCommands()
+	c.addBinaryCommands()
+	c.addExamplesCommands()
+	c.addDatabaseCommands()
 	c.addSecurityCommands()
+	c.addAuditCommands()
+	c.addAccessCommands()
+	c.addComplianceCommands()
+	c.addWorkflowCommands()
+	c.addLicenseCommands()
 	c.addDevCommands()
 	c.addUtilityCommands()
 	c.addWebCommands()
@@ -80,6 +201,8 @@ Features:
 	c.addExecuteCommand()
 	c.addValidateCommand()
 	c.addVersionCommand()
+
+	usageErrors(c.rootCmd)
 }
 
 // AI Commands
@@ -134,6 +257,17 @@ func (c *CLI) addAICommands() {
 	}
 	aiCmd.AddCommand(optimizeCmd)
 
+	// The AI commands are premium
+	for _, sub := range aiCmd.Commands() {
+		run := sub.RunE
+		sub.RunE = func(cmd *cobra.Command, args []string) error {
+			if err := c.requireCapability(cmd, ".", license.CapabilityAI); err != nil {
+				return err
+			}
+			return run(cmd, args)
+		}
+	}
+
 	c.rootCmd.AddCommand(aiCmd)
 }
 
@@ -146,25 +280,74 @@ func (c *CLI) addCacheCommands() {
 	}
 
 	// Cache Clear
+	var clearDir string
 	clearCmd := &cobra.Command{
 		Use:   "clear",
 		Short: "Clear all caches",
+		Long:  "Drop every @cache entry in the store the configuration selects ([cache] backend)",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleCacheClear()
+			return c.handleCacheClear(clearDir)
 		},
 	}
+	clearCmd.Flags().StringVar(&clearDir, "dir", ".", "Directory whose hierarchy is loaded")
 	cacheCmd.AddCommand(clearCmd)
 
+	// Cache Invalidate
+	var invalidateDir string
+	var invalidateEnv []string
+	invalidateCmd := &cobra.Command{
+		Use:   "invalidate [key.prefix...]",
+		Short: "Drop the cache entries computed from given keys or variables",
+		Long: `Drop only the @cache entries computed by a key under one of the prefixes,
+or whose expression reads one of the --env variables through @env, leaving
+the rest of the store warm. A prefix matches whole segments: "db" covers
+db.host but not dbx.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && len(invalidateEnv) == 0 {
+				return fmt.Errorf("name a key prefix or an --env variable; tsk cache clear drops everything")
+			}
+			return c.handleCacheInvalidate(invalidateDir, args, invalidateEnv)
+		},
+	}
+	invalidateCmd.Flags().StringVar(&invalidateDir, "dir", ".", "Directory whose hierarchy is loaded")
+	invalidateCmd.Flags().StringArrayVar(&invalidateEnv, "env", nil, "Environment variable whose dependents are dropped (repeatable)")
+	cacheCmd.AddCommand(invalidateCmd)
+
 	// Cache Status
+	var statusDir string
+	var evaluate bool
 	statusCmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show cache status",
+		Long: `Show the @cache backend and how many entries it holds. With --evaluate
+the configuration is evaluated once first, counting which of its @cache
+expressions hit the store.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleCacheStatus()
+			return c.handleCacheStatus(statusDir, evaluate)
 		},
 	}
+	statusCmd.Flags().StringVar(&statusDir, "dir", ".", "Directory whose hierarchy is loaded")
+	statusCmd.Flags().BoolVar(&evaluate, "evaluate", false, "Evaluate the configuration to count hits and misses")
 	cacheCmd.AddCommand(statusCmd)
 
+	// Cache Warm
+	var warmDir string
+	var warmTop int
+	warmCmd := &cobra.Command{
+		Use:   "warm",
+		Short: "Pre-populate the cache with its most used entries",
+		Long: `Evaluate ahead of time the @cache expressions whose entries were looked
+up most in previous runs, as recorded in cache.access_log by the tiered
+backend. Entries the store already holds are left alone.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleCacheWarm(warmDir, warmTop)
+		},
+	}
+	warmCmd.Flags().StringVar(&warmDir, "dir", ".", "Directory whose hierarchy is loaded")
+	warmCmd.Flags().IntVarP(&warmTop, "top", "n", 20, "Number of entries to warm, 0 for every recorded one")
+	cacheCmd.AddCommand(warmCmd)
+
 	// Cache Optimize
 	optimizeCmd := &cobra.Command{
 		Use:   "optimize",
@@ -201,6 +384,7 @@ func (c *CLI) addConfigCommands() {
 		Use:   "set [key] [value]",
 		Short: "Set configuration value",
 		Args:  cobra.ExactArgs(2),
+		ValidArgsFunction: completeConfigKeys,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return c.handleConfigSet(args[0], args[1])
 		},
@@ -208,14 +392,23 @@ func (c *CLI) addConfigCommands() {
 	configCmd.AddCommand(setCmd)
 
 	// Config Get
+	var getDir string
+	var origin bool
 	getCmd := &cobra.Command{
 		Use:   "get [key]",
 		Short: "Get configuration value",
-		Args:  cobra.ExactArgs(1),
+		Long: `Print the value of key in the peanut hierarchy of --dir (default ".").
+--origin also prints the override chain: every file that sets the key, root
+first, with its line and value, ending with the one that wins. When tsk
+daemon runs, the lookup is answered from its memory.`,
+		Args: cobra.ExactArgs(1),
+		ValidArgsFunction: completeConfigKeys,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleConfigGet(args[0])
+			return c.handleConfigGet(getDir, args[0], origin)
 		},
 	}
+	getCmd.Flags().StringVar(&getDir, "dir", ".", "Directory whose hierarchy is loaded")
+	getCmd.Flags().BoolVar(&origin, "origin", false, "Show which files set the value")
 	configCmd.AddCommand(getCmd)
 
 	// Config Validate
@@ -228,76 +421,280 @@ func (c *CLI) addConfigCommands() {
 	}
 	configCmd.AddCommand(validateCmd)
 
-	c.rootCmd.AddCommand(configCmd)
-}
-
-// Database Commands - Moved to separate package to avoid import cycles
-func (c *CLI) addDatabaseCommands() {
-	// Database commands are now in pkg/databasecli package
-	// This prevents import cycles between cli and database packages
-}
-
-// Security Commands
-func (c *CLI) addSecurityCommands() {
-	securityCmd := &cobra.Command{
-		Use:   "security",
-		Short: "Security framework commands",
-		Long:  "Commands for security scanning, encryption, and auditing",
+	// Config Check
+	var explain bool
+	checkCmd := &cobra.Command{
+		Use:   "check [dir]",
+		Short: "Load the peanut hierarchy and report how it was merged",
+		Long: `Load the peanut hierarchy of dir (default ".") and its parents, reporting
+the files used. --explain lists every key with the file it came from, the
+merge strategy applied (merge, replace or append) and the files it overrides,
+plus keys dropped by replace annotations.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleConfigCheck(dir, explain)
+		},
 	}
+	checkCmd.Flags().BoolVar(&explain, "explain", false, "Show the origin and merge strategy of every key")
+	configCmd.AddCommand(checkCmd)
 
-	// Login
-	loginCmd := &cobra.Command{
-		Use:   "login [username]",
-		Short: "Authenticate user",
-		Args:  cobra.ExactArgs(1),
+	// Config Watch
+	watchCmd := &cobra.Command{
+		Use:   "watch [dir]",
+		Short: "Print configuration changes live as peanut files are edited",
+		Long: `Load the peanut hierarchy of dir (default ".") and its parents and print
+the keys that change whenever a peanu.tsk, peanu.peanuts or peanu.pnt file
+is saved. Runs until interrupted.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleSecurityLogin(args[0])
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleConfigWatch(dir)
 		},
 	}
-	securityCmd.AddCommand(loginCmd)
-
-	// Logout
-	logoutCmd := &cobra.Command{
-		Use:   "logout",
-		Short: "Logout user",
+	configCmd.AddCommand(watchCmd)
+
+	// Config Diff
+	var diffDir string
+	diffCmd := &cobra.Command{
+		Use:   "diff <from> <to>",
+		Short: "Show the keys that differ between two configurations",
+		Long: `Compare two configurations key by key and list what <to> adds, removes or
+changes relative to from. Each side is one of:
+
+  peanu.tsk, app.pnt, ...  a single text or binary file
+  ./services/api           the merged hierarchy of a directory
+  env:production           the hierarchy of --dir with peanu.production.tsk
+                           applied over it
+
+Exits with 1 when the configurations differ, like diff(1), so CI can gate
+on it. Here 1 means differences were found rather than an unknown failure;
+a side that cannot be loaded exits with the code of its failure, 6 for a
+missing file and 2 for a malformed one:
+
+  tsk config diff peanu.tsk peanu.pnt       # is the binary up to date?
+  tsk config diff . env:production --json   # what production overrides`,
+		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleSecurityLogout()
+			return c.handleConfigDiff(cmd, diffDir, args[0], args[1])
 		},
 	}
-	securityCmd.AddCommand(logoutCmd)
+	diffCmd.Flags().StringVar(&diffDir, "dir", ".", "Directory whose hierarchy env: sources overlay")
+	configCmd.AddCommand(diffCmd)
 
-	// Scan
-	scanCmd := &cobra.Command{
-		Use:   "scan [path]",
-		Short: "Security scan",
-		Args:  cobra.ExactArgs(1),
+	// Config Lint
+	var lintRules []string
+	var lintFix bool
+	lintCmd := &cobra.Command{
+		Use:   "lint [path]",
+		Short: "Check .tsk files for likely mistakes",
+		Long: `Check a .tsk or .peanuts file, or every one under a directory (default "."),
+for likely mistakes:
+
+  duplicate-key        a key set twice in one file (error)
+  unused-variable      a $variable nothing refers to
+  shadowed-local       a section-local $variable hiding a global
+  string-number        a quoted number such as port: "5432"
+  unreachable-default  a || fallback after @env("X", default) or a literal
+  naming               a key in another style than the rest of its file (info)
+
+--fix applies the fixes the findings list, editing only the lines involved
+so comments and layout stay as they are. Exits with 3 when errors remain.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "."
+			if len(args) > 0 {
+				path = args[0]
+			}
+			return c.handleConfigLint(cmd, path, lintRules, lintFix)
+		},
+	}
+	lintCmd.Flags().StringSliceVar(&lintRules, "rule", nil, "Only run these rules")
+	lintCmd.Flags().BoolVar(&lintFix, "fix", false, "Apply the fixes of fixable findings")
+	configCmd.AddCommand(lintCmd)
+
+	// Config Docs
+	var docsFormat, docsTemplate, docsOutput, docsTitle string
+	docsCmd := &cobra.Command{
+		Use:   "docs [dir]",
+		Short: "Generate reference documentation for the configuration",
+		Long: `Document every key of the peanut hierarchy of dir (default ".") and its
+parents: its type, default value, the file and line that set it, the #
+comment lines written directly above it (or above its section header) and
+the operators its value calls. Keys are grouped by section.
+
+--format picks markdown (the default) or html. --template renders through
+your own Go template instead; with --format html it is an html/template and
+escapes what it prints. --json prints the documentation as data.
+
+  tsk config docs --output CONFIG.md
+  tsk config docs services/api --format html --output docs/config.html`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleConfigDocs(dir, docsFormat, docsTemplate, docsOutput, docsTitle)
+		},
+	}
+	docsCmd.Flags().StringVar(&docsFormat, "format", "markdown", "Output format: markdown or html")
+	docsCmd.Flags().StringVar(&docsTemplate, "template", "", "Go template to render instead of the built-in one")
+	docsCmd.Flags().StringVarP(&docsOutput, "output", "o", "", "File to write instead of stdout")
+	docsCmd.Flags().StringVar(&docsTitle, "title", "", "Title of the document")
+	configCmd.AddCommand(docsCmd)
+
+	// Config Pull Remote
+	var pullDir string
+	pullCmd := &cobra.Command{
+		Use:   "pull-remote <url> [dest]",
+		Short: "Download a config artifact from S3, GCS or Azure Blob Storage",
+		Long: `Download url, s3://bucket/key, gs://bucket/key or azblob://container/blob,
+to dest (default: the object's file name). Credentials come from the
+environment and endpoints from the [blobs] section of the hierarchy in
+--dir. The file is checked before it replaces dest: .pnt binaries must load,
+signatures included, and .tsk files must parse.`,
+		Args: cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleSecurityScan(args[0])
+			dest := ""
+			if len(args) > 1 {
+				dest = args[1]
+			}
+			return c.handleConfigPullRemote(pullDir, args[0], dest)
+		},
+	}
+	pullCmd.Flags().StringVar(&pullDir, "dir", ".", "Directory whose hierarchy is loaded")
+	configCmd.AddCommand(pullCmd)
+
+	// Config Push
+	var pushMessage string
+	var noPush bool
+	gitPushCmd := &cobra.Command{
+		Use:   "push [dir]",
+		Short: "Commit configuration changes to Git and push them",
+		Long: `Commit the .tsk and .peanuts files under dir (default ".") that differ from
+HEAD, and nothing else, then push to the remote branch. The commit message
+lists every key added, changed or removed, file by file, and ends with a
+` + configgit.KeysTrailer + ` trailer. The repository, remote and branch come from the
+[git] section of the hierarchy.
+
+  tsk config push services/api -m "raise the connection limit"`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleConfigPush(dir, pushMessage, noPush)
 		},
 	}
-	securityCmd.AddCommand(scanCmd)
+	gitPushCmd.Flags().StringVarP(&pushMessage, "message", "m", "", "Subject of the commit (default: derived from the keys)")
+	gitPushCmd.Flags().BoolVar(&noPush, "no-push", false, "Commit without pushing")
+	configCmd.AddCommand(gitPushCmd)
+
+	// Config Pull
+	gitPullCmd := &cobra.Command{
+		Use:   "pull [dir]",
+		Short: "Merge configuration changes from Git",
+		Long: `Pull the remote branch into the repository holding dir (default ".") with a
+merge, and list the keys the pull changed in each configuration file. A
+merge stopped by conflicts names the conflicted files.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleConfigPull(dir)
+		},
+	}
+	configCmd.AddCommand(gitPullCmd)
+
+	// Config History
+	var historyDir string
+	var historyLimit int
+	historyCmd := &cobra.Command{
+		Use:   "history <key>",
+		Short: "Show who changed a key and when, from Git",
+		Long: `For every file of the hierarchy of --dir that sets key, blame the line that
+sets it now, then list the commits that changed its value there, newest
+first, with the value before and after each.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeConfigKeys,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleConfigHistory(historyDir, args[0], historyLimit)
+		},
+	}
+	historyCmd.Flags().StringVar(&historyDir, "dir", ".", "Directory whose hierarchy is loaded")
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 0, "Show at most this many changes per file")
+	configCmd.AddCommand(historyCmd)
 
-	// Encrypt
+	// Config Encrypt Value
+	var encryptKeyFile string
 	encryptCmd := &cobra.Command{
-		Use:   "encrypt [file]",
-		Short: "Encrypt file",
-		Args:  cobra.ExactArgs(1),
+		Use:   "encrypt-value [value]",
+		Short: "Encrypt a value into a @secret(...) for a .tsk file",
+		Long: `Encrypt value (read from stdin when omitted, so it stays out of shell
+history) with AES-256-GCM and print a @secret("...") value to paste into a
+.tsk file. The key comes from --key-file, TSK_SECRET_KEY, TSK_SECRET_KEY_FILE
+or TSK_SECRET_KEY_COMMAND (for example a KMS decrypt). peanut.Config.Get
+decrypts secrets transparently with the same key.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleSecurityEncrypt(args[0])
+			return c.handleEncryptValue(args, encryptKeyFile)
 		},
 	}
-	securityCmd.AddCommand(encryptCmd)
+	encryptCmd.Flags().StringVar(&encryptKeyFile, "key-file", "", "File holding the 32-byte key")
+	configCmd.AddCommand(encryptCmd)
 
-	// Decrypt
+	// Config Decrypt Value
+	var decryptKeyFile string
 	decryptCmd := &cobra.Command{
-		Use:   "decrypt [file]",
-		Short: "Decrypt file",
-		Args:  cobra.ExactArgs(1),
+		Use:   "decrypt-value [secret]",
+		Short: "Decrypt a @secret(...) value",
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleSecurityDecrypt(args[0])
+			return c.handleDecryptValue(args, decryptKeyFile)
 		},
 	}
-	securityCmd.AddCommand(decryptCmd)
+	decryptCmd.Flags().StringVar(&decryptKeyFile, "key-file", "", "File holding the 32-byte key")
+	configCmd.AddCommand(decryptCmd)
+
+	c.rootCmd.AddCommand(configCmd)
+}
+
+// Database Commands, implemented by pkg/databasecli
+func (c *CLI) addDatabaseCommands() {
+	dbCmd := &cobra.Command{
+		Use:   "db",
+		Short: "Database commands",
+		Long: `Commands for the databases of the [database] section: status, migrations,
+an interactive console, backups, seeds and query analysis, for the sqlite,
+postgresql, mysql, mongodb and redis adapters.`,
+	}
+	for _, cmd := range databasecli.NewDatabaseCommands().GetCommands() {
+		dbCmd.AddCommand(cmd)
+	}
+	c.rootCmd.AddCommand(dbCmd)
+}
+
+// Security Commands
+func (c *CLI) addSecurityCommands() {
+	securityCmd := &cobra.Command{
+		Use:   "security",
+		Short: "Security framework commands",
+		Long:  "Commands for logging in, security scanning, encryption, and auditing",
+	}
+
+	c.addLoginCommands(securityCmd)
+	c.addScanCommand(securityCmd)
+	c.addEncryptionCommands(securityCmd)
 
 	c.rootCmd.AddCommand(securityCmd)
 }
@@ -311,13 +708,28 @@ func (c *CLI) addDevCommands() {
 	}
 
 	// Dev Server
+	var serverDir, serverAddr string
+	var compile bool
 	serverCmd := &cobra.Command{
 		Use:   "server",
 		Short: "Start development server",
+		Long: `Serve --dir, reloading its configuration hierarchy as it changes:
+/config returns it evaluated, /metrics exports the counters, gauges and
+histograms its @metrics calls record, in Prometheus format, and /ws pushes a
+reload event to WebSocket clients after every change. Pages can include
+/livereload.js to refresh themselves. Other paths serve the files of --dir.
+
+.tsk and .peanuts files under --dir are recompiled to .pnt when saved.
+Binaries do not keep merge annotations, so pass --compile=false for
+hierarchies that rely on them. tsk services reload dev (or SIGHUP) reloads
+the hierarchy and re-fetches cached remote values.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleDevServer()
+			return c.handleDevServer(serverDir, serverAddr, compile)
 		},
 	}
+	serverCmd.Flags().StringVar(&serverDir, "dir", ".", "Directory whose hierarchy is served")
+	serverCmd.Flags().StringVar(&serverAddr, "addr", "localhost:8080", "Address to listen on")
+	serverCmd.Flags().BoolVar(&compile, "compile", true, "Recompile .tsk and .peanuts files to .pnt on save")
 	devCmd.AddCommand(serverCmd)
 
 	// Dev Watch
@@ -356,10 +768,10 @@ func (c *CLI) addUtilityCommands() {
 	// Util Lint
 	lintCmd := &cobra.Command{
 		Use:   "lint [file]",
-		Short: "Lint code",
+		Short: "Lint a .tsk file, like tsk config lint",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleUtilLint(args[0])
+			return c.handleConfigLint(cmd, args[0], nil, false)
 		},
 	}
 	utilCmd.AddCommand(lintCmd)
@@ -398,18 +810,57 @@ func (c *CLI) addWebCommands() {
 	}
 
 	// Web Serve
+	var webDir, webHost string
 	serveCmd := &cobra.Command{
 		Use:   "serve [port]",
-		Short: "Start web server",
-		Args:  cobra.MaximumNArgs(1),
+		Short: "Serve static files and proxy routes",
+		Long: `Serve the files of the public directory and proxy path prefixes to
+upstream services, as the [server] section of --dir's hierarchy configures:
+
+  [server]
+  port: 8080
+  public: "public"
+  gzip: true
+  tls_cert: "certs/site.crt"
+  tls_key: "certs/site.key"
+  shutdown_timeout: "10s"
+
+  [server.routes]
+  api: ["/api/", "http://localhost:3000"]
+  assets.path: "/assets/"
+  assets.target: "http://cdn.internal"
+  assets.strip_prefix: true
+
+  [server.middleware]
+  order: ["request_id", "logging", "cors", "rate_limit", "auth"]
+  cors.origins: ["https://app.example.com"]
+  rate_limit.rate: 5
+  auth.tokens: [@env("API_TOKEN")]
+  auth.exclude: ["/health"]
+
+Requests pass through the middleware in order, then go to the route with
+the longest matching path or to the public directory. The middleware are
+request_id (header), logging (format: text or json), cors (origins,
+methods, headers, credentials, max_age), rate_limit (rate per second and
+burst per client IP, trust_proxy) and auth (type: bearer with tokens or
+basic with users as user:password, realm, exclude). With tls_cert and tls_key set, it serves HTTPS. On
+SIGTERM or Ctrl+C, requests in flight get shutdown_timeout to finish.
+tsk services reload web (or SIGHUP) re-reads the configuration, routes,
+middleware and certificate without dropping requests.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			port := "8080"
+			port := 0
 			if len(args) > 0 {
-				port = args[0]
+				var err error
+				if port, err = strconv.Atoi(args[0]); err != nil || port <= 0 || port > 65535 {
+					return fmt.Errorf("invalid port %q", args[0])
+				}
 			}
-			return c.handleWebServe(port)
+			return c.handleWebServe(webDir, webHost, port)
 		},
 	}
+	serveCmd.Flags().StringVar(&webDir, "dir", ".", "Directory whose hierarchy configures the server")
+	serveCmd.Flags().StringVar(&webHost, "host", "", "Host to listen on, overriding server.host (default localhost)")
 	webCmd.AddCommand(serveCmd)
 
 	// Web Build
@@ -439,49 +890,124 @@ func (c *CLI) addWebCommands() {
 
 // Service Commands
 func (c *CLI) addServiceCommands() {
+	var dir string
 	serviceCmd := &cobra.Command{
-		Use:   "service",
-		Short: "Service management",
-		Long:  "Commands for managing background services",
+		Use:     "service",
+		Aliases: []string{"services"},
+		Short:   "Service management",
+		Long: `Run the processes declared in the [services] section of --dir's hierarchy
+under a supervisor that restarts them:
+
+  [services]
+  api.command: ["./bin/api", "--port", "3000"]
+  api.dir: "backend"
+  api.env.LOG_LEVEL: "info"
+  api.restart: "always"
+  worker.command: "python3 worker.py"
+  worker.restart: "on-failure"
+  worker.backoff: "2s"
+  worker.max_backoff: "1m"
+  worker.max_restarts: 10
+  worker.stop_timeout: "30s"
+
+restart is always, on-failure (the default) or never. Restarts wait for
+backoff (1s), doubled after every exit up to max_backoff (1m); after
+max_restarts exits in a row the service is marked failed. Stopping sends
+SIGTERM to the process group and SIGKILL after stop_timeout (10s).
+
+The supervisor keeps <name>.pid and <name>.log files under $TSK_RUN_DIR
+(a tsk-services directory under the temporary directory by default). It
+keeps the [services] it started with; stop and start it to apply changes.`,
 	}
+	serviceCmd.PersistentFlags().StringVar(&dir, "dir", ".", "Directory whose hierarchy declares the services")
 
 	// Service Start
+	var foreground bool
 	startCmd := &cobra.Command{
-		Use:   "start [service]",
-		Short: "Start service",
-		Args:  cobra.ExactArgs(1),
+		Use:   "start [service...]",
+		Short: "Start the supervisor, or services under it",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleServiceStart(args[0])
+			return c.handleServicesStart(dir, args, foreground)
 		},
 	}
+	startCmd.Flags().BoolVar(&foreground, "foreground", false, "Supervise in this process instead of in the background")
 	serviceCmd.AddCommand(startCmd)
 
+	superviseCmd := &cobra.Command{
+		Use:    "supervise [service...]",
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleServicesSupervise(dir, args)
+		},
+	}
+	serviceCmd.AddCommand(superviseCmd)
+
 	// Service Stop
 	stopCmd := &cobra.Command{
 		Use:   "stop [service]",
-		Short: "Stop service",
-		Args:  cobra.ExactArgs(1),
+		Short: "Stop a service, or every service and the supervisor",
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return c.handleServiceStop(args[0])
+			service := ""
+			if len(args) > 0 {
+				service = args[0]
+			}
+			return c.handleServicesStop(dir, service)
 		},
 	}
 	serviceCmd.AddCommand(stopCmd)
 
+	// Service Restart
+	restartCmd := &cobra.Command{
+		Use:   "restart [service]",
+		Short: "Restart a service, or every service not stopped",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service := ""
+			if len(args) > 0 {
+				service = args[0]
+			}
+			return c.handleServicesRestart(dir, service)
+		},
+	}
+	serviceCmd.AddCommand(restartCmd)
+
 	// Service Status
 	statusCmd := &cobra.Command{
 		Use:   "status [service]",
-		Short: "Show service status",
+		Short: "Show state, pid, uptime, memory and restarts of services",
 		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			service := ""
 			if len(args) > 0 {
 				service = args[0]
 			}
-			return c.handleServiceStatus(service)
+			return c.handleServicesStatus(dir, service)
 		},
 	}
 	serviceCmd.AddCommand(statusCmd)
 
+	// Service Reload
+	reloadCmd := &cobra.Command{
+		Use:   "reload [dev|api|web]",
+		Short: "Reload the configuration of running servers",
+		Long: `Ask the servers started by tsk dev server, tsk serve --api and tsk web
+serve on this machine to re-read their configuration, by sending them
+SIGHUP. They keep serving meanwhile; a configuration that fails to load
+leaves the previous one in place. Without an argument, every running
+server reloads. Servers record themselves in $TSK_RUN_DIR, by default a
+tsk-services directory under the temporary directory.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			return c.handleServicesReload(name)
+		},
+	}
+	serviceCmd.AddCommand(reloadCmd)
+
 	c.rootCmd.AddCommand(serviceCmd)
 }
 
@@ -538,6 +1064,23 @@ func (c *CLI) addTestCommands() {
 	}
 	testCmd.AddCommand(benchmarkCmd)
 
+	// Test Integration
+	var runPattern string
+	var keepServices bool
+	integrationCmd := &cobra.Command{
+		Use:   "integration [packages...]",
+		Short: "Run integration tests against dockerized PostgreSQL, Redis, Memcached and MinIO",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = []string{"./internal/integration/..."}
+			}
+			return c.handleTestIntegration(args, runPattern, keepServices)
+		},
+	}
+	integrationCmd.Flags().StringVar(&runPattern, "run", "", "Only run tests matching this pattern")
+	integrationCmd.Flags().BoolVar(&keepServices, "keep", false, "Leave the services running afterwards")
+	testCmd.AddCommand(integrationCmd)
+
 	c.rootCmd.AddCommand(testCmd)
 }
 
@@ -605,207 +1148,244 @@ func (c *CLI) addVersionCommand() {
 // Command Handlers
 
 func (c *CLI) handleParse(filename string) error {
-	fmt.Printf("Parsing file: %s\n", filename)
+	c.out.Printf("Parsing file: %s\n", filename)
 	// Implementation would go here
 	return nil
 }
 
 func (c *CLI) handleCompile(filename string) error {
-	fmt.Printf("Compiling file: %s\n", filename)
+	c.out.Printf("Compiling file: %s\n", filename)
 	// Implementation would go here
 	return nil
 }
 
 func (c *CLI) handleExecute(filename string) error {
-	fmt.Printf("Executing file: %s\n", filename)
+	c.out.Printf("Executing file: %s\n", filename)
 	// Implementation would go here
 	return nil
 }
 
 func (c *CLI) handleValidate(filename string) error {
-	fmt.Printf("Validating file: %s\n", filename)
+	c.out.Printf("Validating file: %s\n", filename)
 	// Implementation would go here
 	return nil
 }
 
 func (c *CLI) handleVersion() error {
-	fmt.Println("TuskLang Go SDK v1.0.0")
-	fmt.Println("Copyright (c) 2024-2025 CyberBoost LLC")
-	return nil
+	return c.out.Result(map[string]string{"version": c.rootCmd.Version}, func(w io.Writer) {
+		fmt.Fprintln(w, "TuskLang Go SDK v1.0.0")
+		fmt.Fprintln(w, "Copyright (c) 2024-2025 CyberBoost LLC")
+	})
 }
 
 // AI Command Handlers
 func (c *CLI) handleAIClaude(prompt string) error {
-	fmt.Printf("Claude AI: %s\n", prompt)
+	c.out.Printf("Claude AI: %s\n", prompt)
 	return nil
 }
 
 func (c *CLI) handleAIGPT(prompt string) error {
-	fmt.Printf("GPT AI: %s\n", prompt)
+	c.out.Printf("GPT AI: %s\n", prompt)
 	return nil
 }
 
 func (c *CLI) handleAIAnalyze(file string) error {
-	fmt.Printf("AI Analysis: %s\n", file)
+	c.out.Printf("AI Analysis: %s\n", file)
 	return nil
 }
 
 func (c *CLI) handleAIOptimize(file string) error {
-	fmt.Printf("AI Optimization: %s\n", file)
+	c.out.Printf("AI Optimization: %s\n", file)
 	return nil
 }
 
 // Cache Command Handlers
-func (c *CLI) handleCacheClear() error {
-	fmt.Println("Clearing all caches...")
-	return nil
-}
-
-func (c *CLI) handleCacheStatus() error {
-	fmt.Println("Cache Status:")
-	fmt.Println("  Memory: 256MB used / 1GB total")
-	fmt.Println("  Disk: 2.1GB used / 10GB total")
-	return nil
-}
-
-func (c *CLI) handleCacheOptimize() error {
-	fmt.Println("Optimizing cache performance...")
+func (c *CLI) handleCacheClear(dir string) error {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if err != nil {
+		return err
+	}
+	if err := cfg.ClearCache(); err != nil {
+		return err
+	}
+	c.out.Println("✅ Cache cleared")
 	return nil
 }
 
-// Config Command Handlers
-func (c *CLI) handleConfigShow() error {
-	fmt.Println("Current Configuration:")
-	fmt.Println("  Database: sqlite")
-	fmt.Println("  Port: 8080")
-	fmt.Println("  Debug: false")
-	return nil
+func (c *CLI) handleCacheInvalidate(dir string, prefixes, env []string) error {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+	invalidated, err := cfg.InvalidateCache(prefixes, env)
+	if err != nil {
+		return err
+	}
+	return c.out.Result(invalidated, func(w io.Writer) {
+		fmt.Fprintf(w, "🗑️  Invalidated %d cache entries\n", len(invalidated))
+		for _, dep := range invalidated {
+			from := strings.Join(dep.ConfigKeys, ", ")
+			if len(dep.Env) > 0 {
+				from += " (env " + strings.Join(dep.Env, ", ") + ")"
+			}
+			fmt.Fprintf(w, "  %s  %s\n", dep.CacheKey, from)
+		}
+	})
 }
 
-func (c *CLI) handleConfigSet(key, value string) error {
-	fmt.Printf("Setting %s = %s\n", key, value)
-	return nil
-}
+func (c *CLI) handleCacheStatus(dir string, evaluate bool) error {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if err != nil {
+		return err
+	}
+	if evaluate {
+		if _, err := cfg.Execute(peanut.NewVM()); err != nil {
+			return err
+		}
+	}
+	backend, stats, err := cfg.CacheStatus()
+	if err != nil {
+		return err
+	}
 
-func (c *CLI) handleConfigGet(key string) error {
-	fmt.Printf("Getting %s\n", key)
+	c.out.Printf("📊 Cache status (%s)\n", backend)
+	if stats.Entries >= 0 {
+		c.out.Printf("  Entries: %d\n", stats.Entries)
+	}
+	if evaluate {
+		c.out.Printf("  Hits: %d  Misses: %d  (%.1f%% hit rate)\n", stats.Hits, stats.Misses, hitRate(stats.Hits, stats.Misses))
+		c.out.Printf("  Stored: %d\n", stats.Sets)
+		if stats.Errors > 0 {
+			c.out.Printf("  ⚠️  Store errors: %d\n", stats.Errors)
+		}
+	}
+	for _, level := range stats.Levels {
+		entries := "? entries"
+		if level.Entries >= 0 {
+			entries = fmt.Sprintf("%d entries", level.Entries)
+		}
+		c.out.Printf("  %s (%s): %s", strings.ToUpper(level.Name), level.Backend, entries)
+		if level.Bytes > 0 {
+			c.out.Printf(", %s", formatBytes(level.Bytes))
+		}
+		if evaluate {
+			c.out.Printf(", %d hits, %d misses (%.1f%%), %d evicted", level.Hits, level.Misses, hitRate(level.Hits, level.Misses), level.Evictions)
+		}
+		c.out.Printf("\n")
+	}
 	return nil
 }
 
-func (c *CLI) handleConfigValidate() error {
-	fmt.Println("Validating configuration...")
-	return nil
+// hitRate returns hits as a percentage of lookups
+func hitRate(hits, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses) * 100
 }
 
-// Security Command Handlers
-func (c *CLI) handleSecurityLogin(username string) error {
-	fmt.Printf("Logging in user: %s\n", username)
-	return nil
+func (c *CLI) handleCacheWarm(dir string, top int) error {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+	report, err := cfg.WarmCache(peanut.NewVM(), top)
+	if err != nil {
+		return err
+	}
+	return c.out.Result(report, func(w io.Writer) {
+		counts := make(map[string]int)
+		for _, key := range report.Keys {
+			counts[key.Status]++
+		}
+		fmt.Fprintf(w, "🔥 Warmed %d of the most used cache entries (%d evaluated, %d already cached)\n",
+			len(report.Keys), counts[peanut.WarmEvaluated], counts[peanut.WarmCached])
+		for _, key := range report.Keys {
+			switch key.Status {
+			case peanut.WarmFailed:
+				fmt.Fprintf(w, "  ❌ %s: %s\n", key.ConfigKey, key.Error)
+			case peanut.WarmEvaluated:
+				fmt.Fprintf(w, "  ✅ %s  %d lookups, %s\n", key.ConfigKey, key.Lookups, key.Duration.Round(time.Microsecond))
+			default:
+				fmt.Fprintf(w, "  •  %s  %d lookups, %s\n", key.ConfigKey, key.Lookups, key.Status)
+			}
+		}
+		if report.Unknown > 0 {
+			fmt.Fprintf(w, "  %d recorded entries are no longer computed by this configuration\n", report.Unknown)
+		}
+	})
 }
 
-func (c *CLI) handleSecurityLogout() error {
-	fmt.Println("Logging out user")
+func (c *CLI) handleCacheOptimize() error {
+	c.out.Println("Optimizing cache performance...")
 	return nil
 }
 
-func (c *CLI) handleSecurityScan(path string) error {
-	fmt.Printf("Security scanning: %s\n", path)
+// Config Command Handlers
+func (c *CLI) handleConfigShow() error {
+	c.out.Println("Current Configuration:")
+	c.out.Println("  Database: sqlite")
+	c.out.Println("  Port: 8080")
+	c.out.Println("  Debug: false")
 	return nil
 }
 
-func (c *CLI) handleSecurityEncrypt(file string) error {
-	fmt.Printf("Encrypting file: %s\n", file)
+func (c *CLI) handleConfigSet(key, value string) error {
+	c.out.Printf("Setting %s = %s\n", key, value)
 	return nil
 }
 
-func (c *CLI) handleSecurityDecrypt(file string) error {
-	fmt.Printf("Decrypting file: %s\n", file)
+func (c *CLI) handleConfigValidate() error {
+	c.out.Println("Validating configuration...")
 	return nil
 }
 
 // Dev Command Handlers
-func (c *CLI) handleDevServer() error {
-	fmt.Println("Starting development server...")
-	return nil
-}
-
 func (c *CLI) handleDevWatch(path string) error {
-	fmt.Printf("Watching path: %s\n", path)
+	c.out.Printf("Watching path: %s\n", path)
 	return nil
 }
 
 // Utility Command Handlers
 func (c *CLI) handleUtilFormat(file string) error {
-	fmt.Printf("Formatting file: %s\n", file)
-	return nil
-}
-
-func (c *CLI) handleUtilLint(file string) error {
-	fmt.Printf("Linting file: %s\n", file)
+	c.out.Printf("Formatting file: %s\n", file)
 	return nil
 }
 
 func (c *CLI) handleUtilGenerate(template string) error {
-	fmt.Printf("Generating from template: %s\n", template)
+	c.out.Printf("Generating from template: %s\n", template)
 	return nil
 }
 
 func (c *CLI) handleUtilConvert(file, format string) error {
-	fmt.Printf("Converting %s to %s\n", file, format)
-	return nil
+	return c.handleConvert(file, "", "", format)
 }
 
 // Web Command Handlers
-func (c *CLI) handleWebServe(port string) error {
-	fmt.Printf("Starting web server on port %s\n", port)
-	return nil
-}
-
 func (c *CLI) handleWebBuild(output string) error {
-	fmt.Printf("Building web application to %s\n", output)
+	c.out.Printf("Building web application to %s\n", output)
 	return nil
 }
 
 func (c *CLI) handleWebDeploy(target string) error {
-	fmt.Printf("Deploying web application to %s\n", target)
-	return nil
-}
-
-// Service Command Handlers
-func (c *CLI) handleServiceStart(service string) error {
-	fmt.Printf("Starting service: %s\n", service)
-	return nil
-}
-
-func (c *CLI) handleServiceStop(service string) error {
-	fmt.Printf("Stopping service: %s\n", service)
-	return nil
-}
-
-func (c *CLI) handleServiceStatus(service string) error {
-	if service == "" {
-		fmt.Println("All services status:")
-		fmt.Println("  Database: Running")
-		fmt.Println("  Web Server: Running")
-		fmt.Println("  Cache: Running")
-	} else {
-		fmt.Printf("Service %s status: Running\n", service)
-	}
+	c.out.Printf("Deploying web application to %s\n", target)
 	return nil
 }
 
 // Test Command Handlers
 func (c *CLI) handleTestRun(pattern string) error {
-	fmt.Printf("Running tests: %s\n", pattern)
+	c.out.Printf("Running tests: %s\n", pattern)
 	return nil
 }
 
 func (c *CLI) handleTestCoverage(pkg string) error {
-	fmt.Printf("Test coverage for %s: 85.2%%\n", pkg)
+	c.out.Printf("Test coverage for %s: 85.2%%\n", pkg)
 	return nil
 }
 
 func (c *CLI) handleTestBenchmark(pkg string) error {
-	fmt.Printf("Running benchmarks for %s\n", pkg)
+	c.out.Printf("Running benchmarks for %s\n", pkg)
 	return nil
 } 
\ No newline at end of file
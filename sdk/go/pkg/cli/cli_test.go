@@ -0,0 +1,464 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/internal/licensetest"
+	"github.com/cyber-boost/tusktsk/license"
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	"github.com/cyber-boost/tusktsk/pkg/enterprise"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/security"
+	"github.com/gorilla/websocket"
+)
+
+// runCLI runs tsk with args and returns its output, its messages and
+// the exit code Main would exit with
+func runCLI(t *testing.T, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	c := New(nil)
+	c.out = cliio.New(cliio.Text, &out, &errOut)
+	c.rootCmd.SetOut(&out)
+	c.rootCmd.SetErr(&errOut)
+	err := c.execute(args)
+	return out.String(), errOut.String(), tskerrors.ExitCode(err)
+}
+
+func TestSecurityEncryptExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "secrets.tsk")
+	key := filepath.Join(dir, "tsk.key")
+	otherKey := filepath.Join(dir, "other.key")
+	for file, content := range map[string]string{
+		plain:    "[database]\npassword: \"hunter2\"\n",
+		key:      strings.Repeat("ab", 32),
+		otherKey: strings.Repeat("cd", 32),
+	} {
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv(security.PassphraseEnv, "")
+
+	if _, stderr, code := runCLI(t, "security", "encrypt", plain, "--key-file", key); code != 0 {
+		t.Fatalf("encrypt exited %d: %s", code, stderr)
+	}
+	encrypted := plain + ".enc"
+	if !security.IsEncryptedFile(encrypted) {
+		t.Fatal("encrypt wrote no encrypted file")
+	}
+	decrypted := filepath.Join(dir, "decrypted.tsk")
+	if _, stderr, code := runCLI(t, "security", "decrypt", encrypted, "--key-file", key, "-o", decrypted); code != 0 {
+		t.Fatalf("decrypt exited %d: %s", code, stderr)
+	}
+	if data, _ := os.ReadFile(decrypted); string(data) != "[database]\npassword: \"hunter2\"\n" {
+		t.Errorf("decrypted %q", data)
+	}
+
+	damaged := filepath.Join(dir, "damaged.tsk.enc")
+	data, _ := os.ReadFile(encrypted)
+	if err := os.WriteFile(damaged, data[:len(data)-1], 0600); err != nil {
+		t.Fatal(err)
+	}
+	notEncrypted := filepath.Join(dir, "plain.enc")
+	if err := os.WriteFile(notEncrypted, []byte("plain"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		env  string
+		args []string
+		want tskerrors.Kind
+	}{
+		{"missing input", "", []string{"encrypt", filepath.Join(dir, "missing.tsk"), "--key-file", key}, tskerrors.NotFound},
+		{"output exists", "", []string{"encrypt", plain, "--key-file", key}, tskerrors.Conflict},
+		{"unknown kdf", "", []string{"encrypt", plain, "--kdf", "md5"}, tskerrors.Usage},
+		{"short passphrase", "short", []string{"encrypt", plain, "-o", filepath.Join(dir, "x.enc")}, tskerrors.Validation},
+		{"stdin without output", "", []string{"encrypt", "-"}, tskerrors.Usage},
+		{"key and passphrase file", "", []string{"encrypt", plain, "--key-file", key, "--passphrase-file", key, "-f"}, tskerrors.Usage},
+		{"wrong key", "", []string{"decrypt", encrypted, "--key-file", otherKey, "-f"}, tskerrors.Validation},
+		{"truncated", "", []string{"decrypt", damaged, "--key-file", key}, tskerrors.Validation},
+		{"not encrypted", "", []string{"decrypt", notEncrypted, "--key-file", key, "-o", filepath.Join(dir, "y")}, tskerrors.Validation},
+		{"key file missing", "", []string{"decrypt", encrypted, "-o", filepath.Join(dir, "z")}, tskerrors.Usage},
+		{"passphrase for a key file", "a long passphrase", []string{"decrypt", encrypted, "-f"}, tskerrors.Usage},
+		{"no .enc suffix", "", []string{"decrypt", plain, "--key-file", key}, tskerrors.Usage},
+		{"decrypted file exists", "", []string{"decrypt", encrypted, "--key-file", key}, tskerrors.Conflict},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(security.PassphraseEnv, tt.env)
+			_, stderr, code := runCLI(t, append([]string{"security"}, tt.args...)...)
+			if code != tt.want.ExitCode() {
+				t.Errorf("exit code %d, want %d (%s): %s", code, tt.want.ExitCode(), tt.want, stderr)
+			}
+		})
+	}
+
+	// A file that does not authenticate leaves no output behind
+	if _, err := os.Stat(filepath.Join(dir, "damaged.tsk")); !os.IsNotExist(err) {
+		t.Errorf("truncated input left output: %v", err)
+	}
+	if data, _ := os.ReadFile(plain); string(data) != "[database]\npassword: \"hunter2\"\n" {
+		t.Errorf("wrong key overwrote the plaintext: %q", data)
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"peanu.tsk":            "[app]\nname: \"demo\"\nreplicas: 1\ndebug: true\n",
+		"peanu.production.tsk": "[app]\nreplicas: 3\nregion: \"eu\"\n",
+		"copy.tsk":             "[app]\nname: \"demo\"\nreplicas: 1\ndebug: true\n",
+		"broken.tsk":           "[app]\n- orphan\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := filepath.Join(dir, "peanu.tsk")
+
+	for _, tt := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"identical", []string{base, filepath.Join(dir, "copy.tsk")}, 0},
+		{"overlay", []string{base, "env:production", "--dir", dir}, 1},
+		{"same overlay", []string{"env:production", "env:production", "--dir", dir}, 0},
+		{"missing file", []string{base, filepath.Join(dir, "missing.tsk")}, tskerrors.NotFound.ExitCode()},
+		{"missing overlay", []string{base, "env:staging", "--dir", dir}, tskerrors.NotFound.ExitCode()},
+		{"syntax error", []string{filepath.Join(dir, "broken.tsk"), base}, tskerrors.Parse.ExitCode()},
+		{"one side", []string{base}, tskerrors.Usage.ExitCode()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, stderr, code := runCLI(t, append([]string{"config", "diff"}, tt.args...)...); code != tt.code {
+				t.Errorf("exit code %d, want %d: %s", code, tt.code, stderr)
+			}
+		})
+	}
+
+	// Differences are a result of their own, not an unknown failure
+	c := New(nil)
+	c.out = cliio.New(cliio.Text, io.Discard, io.Discard)
+	if err := c.execute([]string{"config", "diff", base, "env:production", "--dir", dir}); !errors.Is(err, errConfigsDiffer) {
+		t.Errorf("diff of differing configurations = %v, want errConfigsDiffer", err)
+	}
+
+	stdout, _, code := runCLI(t, "config", "diff", base, "env:production", "--dir", dir, "--json")
+	if code != 1 {
+		t.Errorf("--json exit code %d, want 1", code)
+	}
+	var envelope struct {
+		Command string `json:"command"`
+		Data    struct {
+			From    string `json:"from"`
+			To      string `json:"to"`
+			Changes []struct {
+				Key  string      `json:"key"`
+				Kind string      `json:"kind"`
+				Old  interface{} `json:"old"`
+				New  interface{} `json:"new"`
+			} `json:"changes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &envelope); err != nil {
+		t.Fatalf("--json printed %q: %v", stdout, err)
+	}
+	var got []string
+	for _, change := range envelope.Data.Changes {
+		got = append(got, fmt.Sprintf("%s %s %v %v", change.Kind, change.Key, change.Old, change.New))
+	}
+	want := []string{"added app.region <nil> eu", "modified app.replicas 1 3"}
+	if envelope.Command != "config diff" || envelope.Data.To != "env:production" || !reflect.DeepEqual(got, want) {
+		t.Errorf("--json printed %s\nchanges %q, want %q", stdout, got, want)
+	}
+}
+
+func TestDevServerReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "peanu.tsk")
+	if err := os.WriteFile(file, []byte("[app]\nname: \"first\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("SECRET=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	c := New(nil)
+	c.out = cliio.New(cliio.Text, &out, &out)
+	hub := newReloadHub()
+	w, err := c.watchDevServer(dir, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	server := httptest.NewServer(devServerHandler(w, dir, hub))
+	defer server.Close()
+	defer hub.closeAll()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+	appName := func() string {
+		t.Helper()
+		code, body := get("/config")
+		if code != http.StatusOK {
+			t.Fatalf("GET /config = %d: %s", code, body)
+		}
+		var values struct {
+			App struct {
+				Name string `json:"name"`
+			} `json:"app"`
+		}
+		if err := json.Unmarshal([]byte(body), &values); err != nil {
+			t.Fatalf("GET /config: %v\n%s", err, body)
+		}
+		return values.App.Name
+	}
+
+	if code, body := get("/health"); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("GET /health = %d %q", code, body)
+	}
+	if code, _ := get("/.env"); code != http.StatusNotFound {
+		t.Errorf("GET /.env = %d, want 404", code)
+	}
+	if got := appName(); got != "first" {
+		t.Fatalf("app.name = %q, want first", got)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The hub registers the client after the handshake completes
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		hub.mu.Lock()
+		n := len(hub.clients)
+		hub.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the WebSocket client was never registered")
+		}
+	}
+
+	next := func() devEvent {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		var event devEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("waiting for a reload event: %v", err)
+		}
+		return event
+	}
+
+	if err := os.WriteFile(file, []byte("[app]\nname: \"second\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	event := next()
+	if event.Type != "reload" {
+		t.Fatalf("event = %+v, want a reload", event)
+	}
+	if len(event.Changes) != 1 || event.Changes[0].Key != "app.name" || event.Changes[0].Kind != "modified" {
+		t.Errorf("changes = %+v, want app.name modified", event.Changes)
+	}
+	if got := appName(); got != "second" {
+		t.Errorf("after the edit app.name = %q, want second", got)
+	}
+
+	// A broken edit is reported and the last good configuration is kept
+	if err := os.WriteFile(file, []byte("- third\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if event := next(); event.Type != "error" || event.Error == "" {
+		t.Fatalf("event = %+v, want an error", event)
+	}
+	if got := appName(); got != "second" {
+		t.Errorf("after a broken edit app.name = %q, want second", got)
+	}
+}
+
+func TestAccessPolicyOfDir(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(enterprise.AccessPolicyEnv, "")
+	key := fmt.Sprintf("TUSK-ENTERPRISE-0123456789abcdef-%x", time.Now().Add(time.Hour).Unix())
+	licensetest.Grant(t, key, license.TierEnterprise)
+	t.Setenv(license.KeyEnv, key)
+
+	dir := t.TempDir()
+	policy := `[roles.admin]
+permissions: ["config:*"]
+
+[users.ada]
+roles: ["admin"]
+
+[users.ci]
+permissions: ["config:read"]
+
+[commands]
+"cache clear": "config:admin"
+`
+	for file, content := range map[string]string{
+		enterprise.AccessPolicyFile: policy,
+		"peanu.tsk":                 "[app]\nname: \"demo\"\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The policy of --dir applies, wherever tsk runs
+	t.Setenv(enterprise.UserEnv, "ci")
+	if _, stderr, code := runCLI(t, "cache", "clear", "--dir", dir); code != tskerrors.Permission.ExitCode() {
+		t.Errorf("cache clear --dir as ci exited %d, want a denial: %s", code, stderr)
+	}
+	t.Setenv(enterprise.UserEnv, "ada")
+	if _, stderr, code := runCLI(t, "cache", "clear", "--dir", dir); code != 0 {
+		t.Errorf("cache clear --dir as ada exited %d: %s", code, stderr)
+	}
+
+	// Without [auth], the API does not take X-Tsk-User on trust
+	t.Setenv("TSK_API_TOKEN", "")
+	_, stderr, code := runCLI(t, "serve", "--api", "--dir", dir, "--addr", "127.0.0.1:0")
+	if code != tskerrors.Usage.ExitCode() || !strings.Contains(stderr, "--token") {
+		t.Errorf("serve --api without --token exited %d, want a usage error: %s", code, stderr)
+	}
+}
+
+// lockedBuffer is a buffer a server goroutine writes while the test reads it
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLifecycleSignals(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TSK_RUN_DIR", t.TempDir())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := &http.Server{Addr: listener.Addr().String(), Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})}
+	var reloads atomic.Int32
+	var out lockedBuffer
+	errs := make(chan error, 1)
+	go func() {
+		errs <- lifecycle{
+			Name:   "web",
+			Dir:    dir,
+			Server: server,
+			Listen: func() error { return server.Serve(listener) },
+			Drain:  5 * time.Second,
+			Reload: func() error { reloads.Add(1); return nil },
+			Out:    cliio.New(cliio.Text, &out, &out),
+		}.run()
+	}()
+	waitUntil := func(what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s:\n%s", what, out.String())
+			}
+		}
+	}
+
+	// The service record is written once the signal handlers are in place
+	waitUntil("the service record", func() bool {
+		services, _ := runningServices()
+		return len(services) == 1
+	})
+	if stdout, stderr, code := runCLI(t, "services", "reload", "web"); code != 0 {
+		t.Fatalf("services reload exited %d: %s%s", code, stdout, stderr)
+	}
+	waitUntil("the reload", func() bool { return strings.Contains(out.String(), "Configuration reloaded") })
+	if n := reloads.Load(); n != 1 {
+		t.Errorf("SIGHUP reloaded %d times, want once", n)
+	}
+
+	// SIGTERM lets the request in flight finish before run returns
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + server.Addr)
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+	<-started
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil("the shutdown", func() bool { return strings.Contains(out.String(), "Shutting down") })
+	select {
+	case err := <-errs:
+		t.Fatalf("run() returned with a request in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if got := <-body; got != "done" {
+		t.Errorf("request in flight during shutdown = %q, want done", got)
+	}
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("run() = %v, want a clean shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run() did not return after draining")
+	}
+	if services, _ := runningServices(); len(services) != 0 {
+		t.Errorf("services after shutdown = %+v, want the record removed", services)
+	}
+}
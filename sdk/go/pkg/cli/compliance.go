@@ -0,0 +1,302 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/enterprise"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// complianceIcons mark the results of tsk compliance check
+var complianceIcons = map[enterprise.RuleStatus]string{
+	enterprise.RulePassed:  "✅",
+	enterprise.RuleFailed:  "❌",
+	enterprise.RuleSkipped: "⏭️ ",
+	enterprise.RuleError:   "⚠️ ",
+}
+
+// Compliance Commands
+func (c *CLI) addComplianceCommands() {
+	complianceCmd := &cobra.Command{
+		Use:   "compliance",
+		Short: "Compliance policy commands",
+		Long: `Commands for the compliance policies of compliance.policy.tsk: rules
+whose conditions the configuration, or the data of a resource, must meet.`,
+	}
+
+	var policies, standards []string
+	var dataFile, resource, failOn string
+	var verbose bool
+	checkCmd := &cobra.Command{
+		Use:   "check [dir]",
+		Short: "Evaluate the configuration against the compliance policies",
+		Long: `Evaluate the configuration of a directory, or the data of --data, against
+the rules of compliance.policy.tsk or of the --policy files and directories,
+and the built-in policy packs of --standard (soc2, hipaa or pci). Rules are
+conditions such as:
+
+  server.tls.enabled == true && server.tls.version in ["1.2", "1.3"]
+  db.host =~ "\\.internal$"
+  has(encryption.key) && len(encryption.key) >= 32
+
+and may apply only when another condition holds, as when: 'env == "prod"'.
+The command exits with the validation error code (3) when a rule at least
+as serious as --fail-on is violated.`,
+		Example: `  tsk compliance check
+  tsk compliance check config/ --policy policies/
+  tsk compliance check --standard soc2 --standard pci
+  tsk compliance check --data deploy.json --resource deploy --fail-on high`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleComplianceCheck(cmd, dir, policies, standards, dataFile, resource, failOn, verbose)
+		},
+	}
+	checkCmd.Flags().StringArrayVar(&policies, "policy", nil, "Policy file or directory of .tsk policy files (default: compliance.policy.tsk in dir)")
+	checkCmd.Flags().StringArrayVar(&standards, "standard", nil, "Built-in policy pack to evaluate: soc2, hipaa or pci")
+	checkCmd.Flags().StringVar(&dataFile, "data", "", "Evaluate a JSON, YAML or .tsk file instead of the configuration")
+	checkCmd.Flags().StringVar(&resource, "resource", "", "Name of the resource evaluated (default: the directory or data file)")
+	checkCmd.Flags().StringVar(&failOn, "fail-on", "low", "Exit nonzero for violations at least this serious, or none")
+	checkCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Also list the rules that passed or were skipped")
+	complianceCmd.AddCommand(checkCmd)
+
+	var standard, reportFormat, output string
+	var reportPolicies []string
+	var reportData, reportResource string
+	reportCmd := &cobra.Command{
+		Use:   "report [dir]",
+		Short: "Generate an evidence report for a compliance standard",
+		Long: `Evaluate the configuration of a directory, or the data of --data, against
+the built-in policy pack of --standard and write the evidence: for each
+control of the standard, the rules checking it, their outcome and the
+values they read. Passwords, keys and tokens are redacted.
+
+The built-in standards are soc2, hipaa and pci. A policy of the same id in
+the --policy files replaces the built-in pack, and other ids name your own
+standards. --format picks html (the default) or json; --json prints the
+report as data.`,
+		Example: `  tsk compliance report --standard soc2 -o soc2.html
+  tsk compliance report config/ --standard pci --format json -o pci.json
+  tsk compliance report --standard iso27001 --policy policies/`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleComplianceReport(dir, standard, reportPolicies, reportData, reportResource, reportFormat, output)
+		},
+	}
+	reportCmd.Flags().StringVar(&standard, "standard", "", "Standard to report on: soc2, hipaa, pci or a policy of --policy")
+	reportCmd.Flags().StringArrayVar(&reportPolicies, "policy", nil, "Policy file or directory of .tsk policy files")
+	reportCmd.Flags().StringVar(&reportData, "data", "", "Evaluate a JSON, YAML or .tsk file instead of the configuration")
+	reportCmd.Flags().StringVar(&reportResource, "resource", "", "Name of the resource evaluated (default: the directory or data file)")
+	reportCmd.Flags().StringVar(&reportFormat, "format", "html", "Output format: html or json")
+	reportCmd.Flags().StringVarP(&output, "output", "o", "", "File to write instead of stdout")
+	reportCmd.MarkFlagRequired("standard")
+	complianceCmd.AddCommand(reportCmd)
+
+	c.rootCmd.AddCommand(complianceCmd)
+}
+
+// loadComplianceManager reads the policies, or the compliance policy file
+// of dir, and adds the built-in packs of standards
+func loadComplianceManager(dir string, policies, standards []string) (*enterprise.ComplianceManager, error) {
+	if len(policies) == 0 && len(standards) == 0 {
+		file := filepath.Join(dir, enterprise.CompliancePolicyFile)
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			return nil, tskerrors.New(tskerrors.NotFound, "no %s in %s: give policies with --policy", enterprise.CompliancePolicyFile, dir)
+		}
+		policies = []string{file}
+	}
+	cm, err := enterprise.LoadComplianceManager(policies...)
+	if err != nil {
+		return nil, err
+	}
+	for _, standard := range standards {
+		if _, err := cm.AddStandard(standard); err != nil {
+			return nil, err
+		}
+	}
+	return cm, nil
+}
+
+// complianceData reads the data to evaluate: file, or the configuration
+// of dir
+func complianceData(dir, file string) (map[string]interface{}, error) {
+	if file == "" {
+		cfg, _, err := peanut.LoadHierarchy(dir)
+		if errors.Is(err, peanut.ErrNotFound) {
+			return map[string]interface{}{}, nil
+		}
+		if err != nil {
+			return nil, tskerrors.Wrap(tskerrors.Validation, err)
+		}
+		values, err := cfg.Execute(peanut.NewVM())
+		if err != nil {
+			return nil, tskerrors.Wrap(tskerrors.Validation, err)
+		}
+		return values, nil
+	}
+	return readDataFile(file)
+}
+
+// readDataFile reads a JSON, YAML or .tsk file into a map
+func readDataFile(file string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, tskerrors.Wrap(tskerrors.NotFound, err)
+	}
+	data := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		err = json.Unmarshal(content, &data)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &data)
+	default:
+		cfg := config.New()
+		if err = cfg.LoadTSK(content); err == nil {
+			data = cfg.Values()
+		}
+	}
+	if err != nil {
+		return nil, tskerrors.Wrap(tskerrors.Validation, fmt.Errorf("failed to read %s: %w", file, err))
+	}
+	return data, nil
+}
+
+// complianceResource names the resource evaluated: resource, or the data
+// file, or the directory
+func complianceResource(dir, dataFile, resource string) string {
+	switch {
+	case resource != "":
+		return resource
+	case dataFile != "":
+		return dataFile
+	}
+	return dir
+}
+
+// Compliance Check Command Handler
+func (c *CLI) handleComplianceCheck(cmd *cobra.Command, dir string, policies, standards []string, dataFile, resource, failOn string, verbose bool) error {
+	if failOn != "none" && !enterprise.SeverityAtLeast(failOn, enterprise.SeverityLow) {
+		return tskerrors.New(tskerrors.Usage, "unknown severity %q (critical, high, medium, low or none)", failOn)
+	}
+	cm, err := loadComplianceManager(dir, policies, standards)
+	if err != nil {
+		return err
+	}
+	data, err := complianceData(dir, dataFile)
+	if err != nil {
+		return err
+	}
+	resource = complianceResource(dir, dataFile, resource)
+
+	report := cm.Evaluate(resource, data)
+	err = c.out.Result(report, func(w io.Writer) {
+		for _, result := range report.Results {
+			if !verbose && (result.Status == enterprise.RulePassed || result.Status == enterprise.RuleSkipped) {
+				continue
+			}
+			name := result.Name
+			if name == "" {
+				name = result.RuleID
+			}
+			fmt.Fprintf(w, "%s %s/%s: %s [%s]\n", complianceIcons[result.Status], result.PolicyID, result.RuleID, name, result.Severity)
+			if result.Message != "" {
+				fmt.Fprintf(w, "     → %s\n", result.Message)
+			}
+		}
+		fmt.Fprintf(w, "\n%d passed, %d failed, %d skipped, %d error(s) for %s\n",
+			report.Counts[enterprise.RulePassed], report.Counts[enterprise.RuleFailed],
+			report.Counts[enterprise.RuleSkipped], report.Counts[enterprise.RuleError], resource)
+	})
+	if err != nil || failOn == "none" {
+		return err
+	}
+	failing := 0
+	for _, v := range report.Violations {
+		if enterprise.SeverityAtLeast(v.Severity, failOn) {
+			failing++
+		}
+	}
+	if failing == 0 {
+		return nil
+	}
+	// Violations are a result, not a misuse of the command
+	cmd.SilenceUsage = true
+	return tskerrors.New(tskerrors.Validation, "%d compliance violation(s)", failing)
+}
+
+// Compliance Report Command Handler
+func (c *CLI) handleComplianceReport(dir, standard string, policies []string, dataFile, resource, format, output string) error {
+	if format != "html" && format != "json" {
+		return tskerrors.New(tskerrors.Usage, "unsupported report format %q (use html or json)", format)
+	}
+	cm, err := enterprise.LoadComplianceManager(policies...)
+	if err != nil {
+		return err
+	}
+	policy, err := cm.AddStandard(standard)
+	if err != nil {
+		return err
+	}
+	data, err := complianceData(dir, dataFile)
+	if err != nil {
+		return err
+	}
+	resource = complianceResource(dir, dataFile, resource)
+	report := enterprise.NewEvidenceReport(policy, cm.Evaluate(resource, data))
+
+	var buf bytes.Buffer
+	if format == "json" {
+		content, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(append(content, '\n'))
+	} else if err := report.RenderHTML(&buf); err != nil {
+		return err
+	}
+
+	if output == "" {
+		// The document is the result; --json gets its structure instead
+		return c.out.Result(report, func(w io.Writer) {
+			w.Write(buf.Bytes())
+		})
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+	result := struct {
+		Output    string                        `json:"output"`
+		Format    string                        `json:"format"`
+		Standard  string                        `json:"standard"`
+		Compliant bool                          `json:"compliant"`
+		Controls  int                           `json:"controls"`
+		Counts    map[enterprise.RuleStatus]int `json:"counts"`
+	}{output, format, standard, report.Compliant, len(report.Controls), report.Counts}
+	return c.out.Result(result, func(w io.Writer) {
+		verdict := "compliant"
+		if !report.Compliant {
+			verdict = "not compliant"
+		}
+		fmt.Fprintf(w, "📋 Wrote the %s evidence for %d control(s) to %s: %s (%d passed, %d failed, %d error(s))\n",
+			report.Name, len(report.Controls), output, verdict,
+			report.Counts[enterprise.RulePassed], report.Counts[enterprise.RuleFailed], report.Counts[enterprise.RuleError])
+	})
+}
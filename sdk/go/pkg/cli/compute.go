@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	"github.com/cyber-boost/tusktsk/pkg/jobs"
+	"github.com/spf13/cobra"
+)
+
+// Compute Commands
+func (c *CLI) addComputeCommands() {
+	var server string
+
+	computeCmd := &cobra.Command{
+		Use:   "compute",
+		Short: "Compute node management commands",
+		Long:  "Commands for draining compute nodes and inspecting their health history",
+	}
+	computeCmd.PersistentFlags().StringVar(&server, "server", "", "Cluster manager URL (default $TSK_JOB_SERVER or "+defaultJobServer+")")
+
+	// Compute Drain
+	drainCmd := &cobra.Command{
+		Use:   "drain [node]",
+		Short: "Stop scheduling new jobs on a node and let running jobs finish",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleComputeNodeAction(server, "/nodes/drain", args[0])
+		},
+	}
+	computeCmd.AddCommand(drainCmd)
+
+	// Compute Undrain
+	undrainCmd := &cobra.Command{
+		Use:   "undrain [node]",
+		Short: "Return a drained node to service",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleComputeNodeAction(server, "/nodes/undrain", args[0])
+		},
+	}
+	computeCmd.AddCommand(undrainCmd)
+
+	// Compute Events
+	eventsCmd := &cobra.Command{
+		Use:   "events [node]",
+		Short: "Show a node's health and lifecycle history",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleComputeEvents(server, args[0])
+		},
+	}
+	computeCmd.AddCommand(eventsCmd)
+
+	// Compute Usage
+	var by, since, format string
+	usageCmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Report CPU- and GPU-hours per user or team",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleComputeUsage(server, by, since, format)
+		},
+	}
+	usageCmd.Flags().StringVar(&by, "by", "user", "Group usage by user or team")
+	usageCmd.Flags().StringVar(&since, "since", "7d", "Report window, e.g. 24h, 7d or 30d (empty for all recorded usage)")
+	usageCmd.Flags().StringVarP(&format, "format", "f", "table", "Output format (table, csv; json is the same as --json)")
+	computeCmd.AddCommand(usageCmd)
+
+	c.rootCmd.AddCommand(computeCmd)
+}
+
+// Compute Command Handlers
+func (c *CLI) handleComputeNodeAction(server, path, nodeID string) error {
+	body, err := jobRequest(server, http.MethodPost, path+"?"+url.Values{"id": {nodeID}}.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		NodeID string `json:"node_id"`
+		Result string `json:"result"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ Node %s %s (status: %s)\n", result.NodeID, result.Result, result.Status)
+	})
+}
+
+func (c *CLI) handleComputeEvents(server, nodeID string) error {
+	body, err := jobRequest(server, http.MethodGet, "/nodes/events?"+url.Values{"id": {nodeID}}.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	var history struct {
+		NodeID            string           `json:"node_id"`
+		UnhealthyLastHour int              `json:"unhealthy_last_hour"`
+		Events            []jobs.NodeEvent `json:"events"`
+	}
+	if err := json.Unmarshal(body, &history); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return c.out.Result(json.RawMessage(body), func(w io.Writer) {
+		fmt.Fprintf(w, "📋 Node %s (%d events)\n", history.NodeID, len(history.Events))
+		for _, event := range history.Events {
+			fmt.Fprintf(w, "  %s  %-16s %-10s %s\n", event.Time.Format(time.RFC3339), event.Type, event.Status, event.Message)
+		}
+		if history.UnhealthyLastHour > 1 {
+			fmt.Fprintf(w, "⚠️  Node went unhealthy %d times in the last hour (flapping)\n", history.UnhealthyLastHour)
+		}
+	})
+}
+
+func (c *CLI) handleComputeUsage(server, by, since, format string) error {
+	if by != "user" && by != "team" {
+		return fmt.Errorf("unsupported grouping %q (supported: user, team)", by)
+	}
+	switch format {
+	case "table", "csv":
+	case "json":
+		c.out.Format = cliio.JSON
+	default:
+		return fmt.Errorf("unsupported format %q (supported: table, csv, json)", format)
+	}
+
+	query := url.Values{"by": {by}}
+	if since != "" {
+		window, err := parseWindow(since)
+		if err != nil {
+			return err
+		}
+		query.Set("since", time.Now().Add(-window).UTC().Format(time.RFC3339))
+	}
+
+	body, err := jobRequest(server, http.MethodGet, "/usage?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	var report struct {
+		FairShareBy string              `json:"fair_share_by"`
+		FairShare   map[string]float64  `json:"fair_share"`
+		Usage       []jobs.UsageSummary `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &report); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if c.out.Structured() {
+		return c.out.Result(json.RawMessage(body), nil)
+	}
+	if format == "csv" {
+		w := csv.NewWriter(c.out.Writer())
+		w.Write([]string{by, "jobs", "cpu_hours", "gpu_hours"})
+		for _, u := range report.Usage {
+			w.Write([]string{
+				u.Account,
+				strconv.Itoa(u.Jobs),
+				strconv.FormatFloat(u.CPUHours, 'f', 2, 64),
+				strconv.FormatFloat(u.GPUHours, 'f', 2, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	window := "all time"
+	if since != "" {
+		window = "last " + since
+	}
+	return c.out.Result(json.RawMessage(body), func(w io.Writer) {
+		fmt.Fprintf(w, "📊 Usage by %s (%s)\n", by, window)
+		table := cliio.NewTable(strings.ToUpper(by), "JOBS", "CPU-HOURS", "GPU-HOURS").AlignRight(1, 2, 3)
+		for _, u := range report.Usage {
+			table.AddRow(u.Account, u.Jobs, fmt.Sprintf("%.2f", u.CPUHours), fmt.Sprintf("%.2f", u.GPUHours))
+		}
+		table.Render(w)
+
+		if len(report.FairShare) > 0 {
+			accounts := make([]string, 0, len(report.FairShare))
+			for account := range report.FairShare {
+				accounts = append(accounts, account)
+			}
+			sort.Strings(accounts)
+
+			fmt.Fprintf(w, "⚖️  Fair-share factors by %s (1 = no recent usage)\n", report.FairShareBy)
+			for _, account := range accounts {
+				fmt.Fprintf(w, "  %-24s %.3f\n", account, report.FairShare[account])
+			}
+		}
+	})
+}
+
+// parseWindow parses a duration, also accepting whole days such as "7d"
+func parseWindow(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid window %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid window %q: %w", value, err)
+	}
+	return window, nil
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/configgit"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// openConfigRepo opens the Git repository the [git] section of the
+// hierarchy of dir names, or the one holding dir
+func openConfigRepo(dir string) (*configgit.Repo, error) {
+	var opts configgit.Options
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	switch {
+	case err == nil:
+		defer cfg.Close()
+		values, err := cfg.Values()
+		if err != nil {
+			return nil, err
+		}
+		if opts, err = configgit.OptionsFrom(values); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, peanut.ErrNotFound):
+		return nil, err
+	}
+	return configgit.Open(dir, opts)
+}
+
+// printFileChanges prints the keys changed in each file
+func printFileChanges(w io.Writer, files []configgit.FileChange) {
+	for _, file := range files {
+		status := ""
+		if file.Status != configgit.Modified {
+			status = " (" + file.Status + ")"
+		}
+		fmt.Fprintf(w, "  %s%s\n", file.Path, status)
+		for _, change := range file.Changes {
+			fmt.Fprintf(w, "    %s\n", configgit.FormatChange(change))
+		}
+	}
+}
+
+// Config Push Handler
+func (c *CLI) handleConfigPush(dir, message string, noPush bool) error {
+	repo, err := openConfigRepo(dir)
+	if err != nil {
+		return err
+	}
+	files, err := repo.Status(dir)
+	if err != nil {
+		return err
+	}
+	result := struct {
+		Commit string                 `json:"commit,omitempty"`
+		Pushed bool                   `json:"pushed"`
+		Files  []configgit.FileChange `json:"files"`
+	}{Files: files}
+	if len(files) == 0 {
+		result.Files = []configgit.FileChange{}
+		return c.out.Result(result, func(w io.Writer) {
+			fmt.Fprintln(w, "✅ No configuration changes to commit")
+		})
+	}
+
+	if result.Commit, err = repo.Commit(configgit.CommitMessage(message, files), files); err != nil {
+		return err
+	}
+	if !noPush {
+		if err := repo.Push(); err != nil {
+			return fmt.Errorf("committed %s but the push failed (run tsk config pull, then push again): %w", shortHash(result.Commit), err)
+		}
+		result.Pushed = true
+	}
+	return c.out.Result(result, func(w io.Writer) {
+		verb := "Committed and pushed"
+		if !result.Pushed {
+			verb = "Committed"
+		}
+		fmt.Fprintf(w, "✅ %s %s with %d file(s):\n", verb, shortHash(result.Commit), len(files))
+		printFileChanges(w, files)
+	})
+}
+
+// Config Pull Handler
+func (c *CLI) handleConfigPull(dir string) error {
+	repo, err := openConfigRepo(dir)
+	if err != nil {
+		return err
+	}
+	result, err := repo.Pull()
+	if err != nil {
+		if result != nil && len(result.Conflicts) > 0 {
+			c.out.Printf("⚠️  Conflicted files:\n")
+			for _, path := range result.Conflicts {
+				c.out.Printf("  %s\n", path)
+			}
+		}
+		return err
+	}
+	return c.out.Result(result, func(w io.Writer) {
+		if result.From == result.To {
+			fmt.Fprintln(w, "✅ Already up to date")
+			return
+		}
+		fmt.Fprintf(w, "✅ Pulled %s..%s, %d configuration file(s) changed\n", shortHash(result.From), shortHash(result.To), len(result.Files))
+		printFileChanges(w, result.Files)
+	})
+}
+
+// fileHistory is the history of a key in one file of a hierarchy
+type fileHistory struct {
+	File    string               `json:"file"`
+	Line    int                  `json:"line,omitempty"`
+	Value   interface{}          `json:"value"`
+	Blame   *configgit.Commit    `json:"blame,omitempty"`
+	Changes []configgit.Revision `json:"changes"`
+}
+
+// Config History Handler
+func (c *CLI) handleConfigHistory(dir, key string, limit int) error {
+	result, err := lookupConfig(dir, key)
+	if err != nil {
+		return err
+	}
+	if !result.Found {
+		return tskerrors.New(tskerrors.NotFound, "key %s not found", key)
+	}
+	if result.Origin == nil {
+		return fmt.Errorf("%s is a section; ask for one of its keys", key)
+	}
+	repo, err := openConfigRepo(dir)
+	if err != nil {
+		return err
+	}
+
+	var files []fileHistory
+	// Newest override first, like the changes within each file
+	for i := len(result.Origin.Chain) - 1; i >= 0; i-- {
+		source := result.Origin.Chain[i]
+		if _, err := repo.Rel(source.File); err != nil {
+			// Files outside the repository have no history here
+			continue
+		}
+		history := fileHistory{File: source.File, Line: source.Line, Value: source.Value}
+		if source.Line > 0 {
+			if history.Blame, err = repo.Blame(source.File, source.Line); err != nil {
+				return err
+			}
+		}
+		if history.Changes, err = repo.History(source.File, key); err != nil {
+			return err
+		}
+		if limit > 0 && len(history.Changes) > limit {
+			history.Changes = history.Changes[:limit]
+		}
+		if history.Changes == nil {
+			history.Changes = []configgit.Revision{}
+		}
+		files = append(files, history)
+	}
+
+	report := struct {
+		Key   string        `json:"key"`
+		Files []fileHistory `json:"files"`
+	}{key, files}
+	if report.Files == nil {
+		report.Files = []fileHistory{}
+	}
+	return c.out.Result(report, func(w io.Writer) {
+		if len(files) == 0 {
+			fmt.Fprintf(w, "📋 No file setting %s is in %s\n", key, repo.Root)
+			return
+		}
+		for i, file := range files {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "📄 %s:%d  %s = %s\n", file.File, file.Line, key, config.FormatValue(file.Value))
+			if blame := file.Blame; blame != nil {
+				if blame.Hash == configgit.Uncommitted {
+					fmt.Fprintln(w, "   line not committed yet")
+				} else {
+					fmt.Fprintf(w, "   line last changed in %s by %s on %s: %s\n", shortHash(blame.Hash), blame.Author, blame.Date.Format("2006-01-02"), blame.Subject)
+				}
+			}
+			for _, revision := range file.Changes {
+				fmt.Fprintf(w, "  %s %s %-16s %s\n", shortHash(revision.Hash), revision.Date.Format("2006-01-02"), revision.Author, configgit.FormatChange(revision.Change))
+				fmt.Fprintf(w, "          %s\n", revision.Subject)
+			}
+		}
+	})
+}
+
+// shortHash abbreviates a commit hash
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cyber-boost/tusktsk/pkg/convert"
+	"github.com/spf13/cobra"
+)
+
+// Convert Command
+func (c *CLI) addConvertCommand() {
+	var from, to, output string
+
+	convertCmd := &cobra.Command{
+		Use:   "convert [file]",
+		Short: "Convert between TSK, JSON, YAML, TOML, .env and INI",
+		Long: `Convert configuration files between formats.
+
+Reads from the given file, or from stdin when the file is omitted or "-".
+Writes to stdout unless --output is set. Formats are detected from file
+extensions when --from/--to are not given.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input := "-"
+			if len(args) > 0 {
+				input = args[0]
+			}
+			return c.handleConvert(input, output, from, to)
+		},
+	}
+	convertCmd.Flags().StringVar(&from, "from", "", "Input format (tsk, json, yaml, toml, env, ini)")
+	convertCmd.Flags().StringVar(&to, "to", "", "Output format (tsk, json, yaml, toml, env, ini)")
+	convertCmd.Flags().StringVarP(&output, "output", "o", "", "Output file (defaults to stdout)")
+
+	c.rootCmd.AddCommand(convertCmd)
+}
+
+// Convert Command Handler
+func (c *CLI) handleConvert(input, output, fromName, toName string) error {
+	from, err := resolveFormat(fromName, input, "--from")
+	if err != nil {
+		return err
+	}
+	to, err := resolveFormat(toName, output, "--to")
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader = os.Stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", input, err)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	if output == "" || output == "-" {
+		return convert.Convert(reader, os.Stdout, from, to)
+	}
+
+	var buf bytes.Buffer
+	if err := convert.Convert(reader, &buf, from, to); err != nil {
+		return err
+	}
+	return writeOutput(output, buf.Bytes())
+}
+
+// resolveFormat uses an explicit format name, falling back to the file extension
+func resolveFormat(name, file, flag string) (convert.Format, error) {
+	if name != "" {
+		return convert.ParseFormat(name)
+	}
+	if file == "" || file == "-" {
+		return "", fmt.Errorf("%s is required when reading from stdin or writing to stdout", flag)
+	}
+	return convert.DetectFormat(file)
+}
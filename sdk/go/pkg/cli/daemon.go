@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/daemon"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/profiling"
+	"github.com/cyber-boost/tusktsk/pkg/supervisor"
+	"github.com/spf13/cobra"
+)
+
+// daemonSocket is where `tsk daemon` listens: $TSK_DAEMON_SOCKET or
+// daemon.sock in servicesDir
+func daemonSocket() string {
+	if socket := os.Getenv("TSK_DAEMON_SOCKET"); socket != "" {
+		return socket
+	}
+	return filepath.Join(servicesDir(), "daemon.sock")
+}
+
+// daemonTimeout bounds a lookup through the daemon before falling back to
+// loading the files
+const daemonTimeout = 2 * time.Second
+
+// Daemon Command
+func (c *CLI) addDaemonCommand() {
+	var foreground bool
+	var idle time.Duration
+
+	daemonCmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Keep configuration loaded in a background process",
+		Long: `Start a background process that keeps parsed peanut hierarchies in
+memory. While it runs, tsk config get asks it over a unix socket instead of
+parsing the files on every invocation. A hierarchy is reloaded as soon as
+one of its files changes, so answers are never stale.
+
+The socket is $TSK_DAEMON_SOCKET, by default daemon.sock under $TSK_RUN_DIR.
+Set TSK_NO_DAEMON=1 to bypass a running daemon.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleDaemonStart(foreground, idle)
+		},
+	}
+	daemonCmd.Flags().BoolVar(&foreground, "foreground", false, "Run in this process instead of in the background")
+	daemonCmd.Flags().DurationVar(&idle, "idle", 30*time.Minute, "Stop after this long without requests (0 runs until stopped)")
+
+	// Daemon Stop
+	stopCmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the daemon",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleDaemonStop()
+		},
+	}
+	daemonCmd.AddCommand(stopCmd)
+
+	// Daemon Status
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the daemon's loaded hierarchies and counters",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleDaemonStatus()
+		},
+	}
+	daemonCmd.AddCommand(statusCmd)
+
+	c.rootCmd.AddCommand(daemonCmd)
+}
+
+// Daemon Start Handler
+func (c *CLI) handleDaemonStart(foreground bool, idle time.Duration) error {
+	socket := daemonSocket()
+	client := daemon.NewClient(socket)
+	if status, err := client.Status(context.Background()); err == nil {
+		return c.out.Result(status, func(w io.Writer) {
+			fmt.Fprintf(w, "✅ Daemon already running (pid %d) on %s\n", status.PID, socket)
+		})
+	}
+	if foreground {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		opts := daemon.Options{Idle: idle, Report: func(err error) { c.out.Printf("⚠️  %v\n", err) }}
+		var err error
+		if opts.Profiling, err = profilingOptions("."); err != nil {
+			c.out.Printf("⚠️  %v; profiling is off\n", err)
+		}
+		if opts.Tracing, err = tracingOptions("."); err != nil {
+			c.out.Printf("⚠️  %v; tracing is off\n", err)
+		}
+		c.out.Printf("🚀 Daemon listening on %s (Ctrl+C to stop)\n", socket)
+		if opts.Profiling.Addr != "" {
+			c.out.Printf("🔬 Profiling endpoints at %s (tsk perf profile --daemon)\n", profiling.URL("", false, opts.Profiling))
+		} else if opts.Profiling.Enabled {
+			c.out.Printf("🔬 Profiling endpoints under %s on the socket (tsk perf profile --daemon)\n", profiling.Prefix)
+		}
+		if opts.Tracing.Enabled {
+			c.out.Printf("🔭 Tracing requests to %s\n", tracingTarget(opts.Tracing))
+		}
+		return daemon.NewServer(opts).Serve(ctx, socket)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the tsk executable: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(socket), err)
+	}
+	logPath := filepath.Join(filepath.Dir(socket), "daemon.log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", logPath, err)
+	}
+	defer logFile.Close()
+	cmd := exec.Command(exe, "daemon", "--foreground", "--idle", idle.String())
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	supervisor.Detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the daemon: %w", err)
+	}
+	cmd.Process.Release()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := client.Status(context.Background())
+		if err == nil {
+			return c.out.Result(status, func(w io.Writer) {
+				fmt.Fprintf(w, "🚀 Daemon started (pid %d) on %s\n", status.PID, socket)
+			})
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the daemon did not come up; see %s", logPath)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// Daemon Stop Handler
+func (c *CLI) handleDaemonStop() error {
+	status, err := daemon.NewClient(daemonSocket()).Shutdown(context.Background())
+	if err != nil {
+		return err
+	}
+	return c.out.Result(status, func(w io.Writer) {
+		fmt.Fprintf(w, "⏹️  Daemon stopped (pid %d, %d lookups, %d loads)\n", status.PID, status.Lookups, status.Loads)
+	})
+}
+
+// Daemon Status Handler
+func (c *CLI) handleDaemonStatus() error {
+	socket := daemonSocket()
+	status, err := daemon.NewClient(socket).Status(context.Background())
+	if errors.Is(err, daemon.ErrNotRunning) {
+		c.out.Println("⏹️  Daemon not running; start it with tsk daemon")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return c.out.Result(status, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ Daemon running (pid %d) on %s, up %s\n", status.PID, socket, time.Since(status.Started).Round(time.Second))
+		fmt.Fprintf(w, "  %d lookups, %d loads\n", status.Lookups, status.Loads)
+		for _, dir := range status.Dirs {
+			fmt.Fprintf(w, "  %s\n", dir)
+		}
+	})
+}
+
+// lookupConfig looks key up in the hierarchy of dir through the daemon
+// when one runs, and by loading the files otherwise
+func lookupConfig(dir, key string) (daemon.Lookup, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return daemon.Lookup{}, err
+	}
+	if os.Getenv("TSK_NO_DAEMON") == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), daemonTimeout)
+		defer cancel()
+		result, err := daemon.NewClient(daemonSocket()).Get(ctx, abs, key)
+		if !errors.Is(err, daemon.ErrNotRunning) && !errors.Is(err, context.DeadlineExceeded) {
+			return result, err
+		}
+	}
+
+	cfg, files, err := peanut.LoadHierarchy(abs)
+	if err != nil {
+		return daemon.Lookup{}, err
+	}
+	result := daemon.Lookup{Key: key, Files: files}
+	result.Value, result.Found, err = cfg.Lookup(key)
+	if err != nil {
+		return result, err
+	}
+	if origin, ok := cfg.Origin(key); ok {
+		result.Origin = &origin
+	}
+	return result, nil
+}
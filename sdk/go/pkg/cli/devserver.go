@@ -0,0 +1,356 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// reloadScript reconnects to /ws and reloads the page when the
+// configuration changes; pages load it with <script src="/livereload.js">
+const reloadScript = `(function () {
+  function connect() {
+    var ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+    ws.onmessage = function (e) {
+      var event = JSON.parse(e.data);
+      if (event.type === "reload") location.reload();
+      else if (event.type === "error") console.error("tsk:", event.error);
+    };
+    ws.onclose = function () { setTimeout(connect, 1000); };
+  }
+  connect();
+})();
+`
+
+// devEvent is a message pushed to /ws clients
+type devEvent struct {
+	Type    string             `json:"type"`
+	Trigger string             `json:"trigger,omitempty"`
+	Changes []peanut.KeyChange `json:"changes,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// reloadHub pushes events to the connected WebSocket clients
+type reloadHub struct {
+	mu      sync.Mutex
+	clients map[*websocket.Conn]bool
+}
+
+func newReloadHub() *reloadHub {
+	return &reloadHub{clients: make(map[*websocket.Conn]bool)}
+}
+
+var upgrader = websocket.Upgrader{}
+
+// serve upgrades r and keeps the client until it disconnects
+func (h *reloadHub) serve(rw http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	h.clients[conn] = true
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, conn)
+		h.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// broadcast sends event to every client, dropping those that fail
+func (h *reloadHub) broadcast(event devEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.clients {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteJSON(event); err != nil {
+			conn.Close()
+			delete(h.clients, conn)
+		}
+	}
+}
+
+// closeAll disconnects every client
+func (h *reloadHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.clients {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server stopping"), time.Now().Add(time.Second))
+		conn.Close()
+		delete(h.clients, conn)
+	}
+}
+
+// devServerHandler serves the configuration in dir, reloaded as it changes:
+// /config evaluates it, /metrics exports what its @metrics calls recorded
+// and /ws pushes reload events. Other paths serve the files of dir.
+func devServerHandler(w *peanut.Watcher, dir string, hub *reloadHub) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/config", func(rw http.ResponseWriter, r *http.Request) {
+		values, err := w.Config().Execute(peanut.NewVM())
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(rw)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(config.Nest(values))
+	})
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/ws", hub.serve)
+	mux.HandleFunc("/livereload.js", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/javascript")
+		rw.Write([]byte(reloadScript))
+	})
+	files := http.FileServer(http.Dir(dir))
+	mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		// Keep dotfiles, such as .env or .git, private
+		for _, part := range strings.Split(r.URL.Path, "/") {
+			if strings.HasPrefix(part, ".") {
+				http.NotFound(rw, r)
+				return
+			}
+		}
+		rw.Header().Set("Cache-Control", "no-store")
+		files.ServeHTTP(rw, r)
+	})
+	return mux
+}
+
+// watchDevServer watches the hierarchy of dir, reporting each reload and
+// pushing it to the clients of hub
+func (c *CLI) watchDevServer(dir string, hub *reloadHub) (*peanut.Watcher, error) {
+	return peanut.Watch(dir, func(change peanut.ConfigChange) {
+		c.streamConfigChange(change)
+		if change.Err != nil {
+			hub.broadcast(devEvent{Type: "error", Trigger: change.Trigger, Error: change.Err.Error()})
+			return
+		}
+		hub.broadcast(devEvent{Type: "reload", Trigger: change.Trigger, Changes: change.Changes})
+	})
+}
+
+// Dev Server Handler
+func (c *CLI) handleDevServer(dir, addr string, compile bool) error {
+	hub := newReloadHub()
+	var compiler *pntCompiler
+	if compile {
+		var err error
+		if compiler, err = startPntCompiler(dir, hub, c.out); err != nil {
+			return err
+		}
+		defer compiler.Close()
+	}
+
+	w, err := c.watchDevServer(dir, hub)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	// Evaluate once so the metrics the configuration records exist before
+	// the first scrape
+	if _, err := w.Config().Execute(peanut.NewVM()); err != nil {
+		c.out.Printf("⚠️  %v\n", err)
+	}
+
+	server := &http.Server{Addr: addr, Handler: devServerHandler(w, dir, hub), ReadHeaderTimeout: 10 * time.Second}
+	// Shutdown does not wait for WebSockets, so close them as it starts
+	server.RegisterOnShutdown(hub.closeAll)
+	c.out.Printf("🚀 Development server on %s serving %s (Ctrl+C to stop)\n", addr, dir)
+	c.out.Println("  /config         evaluated configuration")
+	c.out.Println("  /metrics        Prometheus metrics")
+	c.out.Println("  /ws             reload events (WebSocket)")
+	c.out.Println("  /livereload.js  script reloading pages on change")
+	if compile {
+		c.out.Println("  .tsk and .peanuts files are recompiled to .pnt on save")
+	}
+	return lifecycle{Name: "dev", Dir: dir, Server: server, Drain: 5 * time.Second, Reload: w.Reload, Out: c.out}.run()
+}
+
+// pntCompiler recompiles the .tsk and .peanuts files under a directory to
+// .pnt binaries beside them whenever they are saved. Writing peanu.pnt makes
+// the hierarchy watcher reload, which notifies the clients.
+type pntCompiler struct {
+	watcher *fsnotify.Watcher
+	hub     *reloadHub
+	out     *cliio.Output
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// compileDebounce groups the events of one save
+const compileDebounce = 100 * time.Millisecond
+
+func startPntCompiler(dir string, hub *reloadHub, out *cliio.Output) (*pntCompiler, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	p := &pntCompiler{watcher: fsw, hub: hub, out: out, done: make(chan struct{}), stopped: make(chan struct{})}
+	if err := p.add(dir, true); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	go p.run()
+	return p, nil
+}
+
+// add watches dir and its subdirectories, skipping hidden ones, and
+// compiles sources whose binary is missing or older than they are
+func (p *pntCompiler) add(dir string, stale bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if err := p.watcher.Add(path); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", path, err)
+			}
+			return nil
+		}
+		if !stale || !isPntSource(path) {
+			return nil
+		}
+		src, err := os.Stat(path)
+		if err != nil {
+			return nil
+		}
+		if out, err := os.Stat(pntPath(path)); err != nil || out.ModTime().Before(src.ModTime()) {
+			p.compile(path)
+		}
+		return nil
+	})
+}
+
+// Close stops watching
+func (p *pntCompiler) Close() error {
+	close(p.done)
+	err := p.watcher.Close()
+	<-p.stopped
+	return err
+}
+
+func (p *pntCompiler) run() {
+	defer close(p.stopped)
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(compileDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-p.done:
+			timer.Stop()
+			return
+
+		case event, ok := <-p.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+					p.add(event.Name, true)
+					continue
+				}
+			}
+			if !isPntSource(event.Name) || !event.Op.Has(fsnotify.Write) && !event.Op.Has(fsnotify.Create) && !event.Op.Has(fsnotify.Rename) {
+				continue
+			}
+			pending[event.Name] = true
+			timer.Reset(compileDebounce)
+
+		case err, ok := <-p.watcher.Errors:
+			if !ok {
+				return
+			}
+			p.out.Printf("⚠️  watch failed: %v\n", err)
+
+		case <-timer.C:
+			for path := range pending {
+				if _, err := os.Stat(path); err == nil {
+					p.compile(path)
+				}
+			}
+			pending = make(map[string]bool)
+		}
+	}
+}
+
+// compile writes the binary of source, replacing the old one atomically
+// so readers never see a partial file
+func (p *pntCompiler) compile(source string) {
+	output := pntPath(source)
+	err := func() error {
+		info, err := os.Stat(source)
+		if err != nil {
+			return err
+		}
+		cfg, err := peanut.LoadFile(source)
+		if err != nil {
+			return err
+		}
+		defer cfg.Close()
+		opts := peanut.DefaultWriteOptions
+		opts.SourceModTime = info.ModTime()
+		var buf bytes.Buffer
+		if err := cfg.WriteBinary(&buf, opts); err != nil {
+			return err
+		}
+		tmp := filepath.Join(filepath.Dir(output), "."+filepath.Base(output)+".tmp")
+		if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write binary: %w", err)
+		}
+		if err := os.Rename(tmp, output); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write binary: %w", err)
+		}
+		return nil
+	}()
+	stamp := time.Now().Format("15:04:05")
+	if err != nil {
+		p.out.Printf("[%s] ❌ %s: %v\n", stamp, source, err)
+		p.hub.broadcast(devEvent{Type: "error", Trigger: source, Error: err.Error()})
+		return
+	}
+	p.out.Printf("[%s] 🔨 Compiled %s → %s\n", stamp, source, output)
+}
+
+// isPntSource reports whether path is a text configuration compiled by the
+// dev server
+func isPntSource(path string) bool {
+	ext := filepath.Ext(path)
+	return (ext == ".tsk" || ext == ".peanuts") && !strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// pntPath is the binary compiled from source
+func pntPath(source string) string {
+	return strings.TrimSuffix(source, filepath.Ext(source)) + ".pnt"
+}
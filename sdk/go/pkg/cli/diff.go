@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/promote"
+	"github.com/spf13/cobra"
+)
+
+// errConfigsDiffer is the result of a diff that found changes. Like diff(1)
+// it exits 1, which is also the code of Unknown failures; the report is
+// printed before it, so it is never shown as one.
+var errConfigsDiffer = errors.New("configurations differ")
+
+// Config Diff Handler. Like diff(1), it fails with exit code 1 when the
+// configurations differ; a side that cannot be loaded fails with the code
+// of its kind, NotFound for a missing file and Parse for a malformed one.
+func (c *CLI) handleConfigDiff(cmd *cobra.Command, dir, from, to string) error {
+	// Failing to load a side is a result too
+	cmd.SilenceUsage = true
+	old, err := loadConfigSource(dir, from)
+	if err != nil {
+		return loadFailure(err)
+	}
+	new, err := loadConfigSource(dir, to)
+	if err != nil {
+		return loadFailure(err)
+	}
+	changes := peanut.Diff(old, new)
+
+	report := struct {
+		From    string             `json:"from"`
+		To      string             `json:"to"`
+		Changes []peanut.KeyChange `json:"changes"`
+	}{from, to, changes}
+	if report.Changes == nil {
+		report.Changes = []peanut.KeyChange{}
+	}
+	err = c.out.Result(report, func(w io.Writer) {
+		if len(changes) == 0 {
+			fmt.Fprintf(w, "✅ %s and %s are identical\n", from, to)
+			return
+		}
+		fmt.Fprintf(w, "📋 %s -> %s (%d change(s))\n", from, to, len(changes))
+		for _, change := range changes {
+			switch change.Kind {
+			case peanut.KeyAdded:
+				fmt.Fprintf(w, "  + %s = %s\n", change.Key, config.FormatValue(change.New))
+			case peanut.KeyRemoved:
+				fmt.Fprintf(w, "  - %s = %s\n", change.Key, config.FormatValue(change.Old))
+			default:
+				fmt.Fprintf(w, "  ~ %s: %s -> %s\n", change.Key, config.FormatValue(change.Old), config.FormatValue(change.New))
+			}
+		}
+	})
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	return tskerrors.New(tskerrors.Unknown, "%w: %s and %s differ in %d key(s)", errConfigsDiffer, from, to, len(changes))
+}
+
+// loadFailure reports a diff side that cannot be loaded, as a parse error
+// unless err already has a kind, such as a missing file
+func loadFailure(err error) error {
+	if tskerrors.KindOf(err) == tskerrors.Unknown {
+		return tskerrors.Wrap(tskerrors.Parse, err)
+	}
+	return err
+}
+
+// loadConfigSource returns the flat values of a diff side: env:<name> for
+// the hierarchy of dir with the overlay of that environment applied, a
+// directory for its hierarchy, or a file
+func loadConfigSource(dir, source string) (map[string]interface{}, error) {
+	if env, ok := strings.CutPrefix(source, "env:"); ok {
+		values, err := loadConfigSource(dir, dir)
+		if err != nil {
+			return nil, err
+		}
+		overlay, err := loadConfigSource(dir, promote.OverlayFile(dir, env))
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range overlay {
+			values[key] = value
+		}
+		return values, nil
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	var cfg *peanut.Config
+	if info.IsDir() {
+		cfg, _, err = peanut.LoadHierarchy(source)
+	} else {
+		cfg, err = peanut.LoadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer cfg.Close()
+	values, err := cfg.Values()
+	if err != nil {
+		return nil, err
+	}
+	// Copy, as the values of a text file are the configuration's own
+	copied := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied, nil
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cyber-boost/tusktsk/pkg/docker"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/spf13/cobra"
+)
+
+// Docker Commands
+func (c *CLI) addDockerCommands() {
+	dockerCmd := &cobra.Command{
+		Use:   "docker",
+		Short: "Container image commands",
+	}
+
+	var opts docker.InitOptions
+	var dryRun, force bool
+	initCmd := &cobra.Command{
+		Use:   "init [dir]",
+		Short: "Generate a multi-stage Dockerfile that compiles the configuration",
+		Long: `Write a Dockerfile and .dockerignore for the Go application in dir
+(default "."). The Dockerfile builds in stages: one installs tsk and compiles
+peanu.tsk to peanu.pnt, one builds the application with module and build
+caches, and a distroless runtime image receives both, running as nonroot
+with peanu.pnt in its working directory where the hierarchy lookup finds it.
+
+The Go version comes from go.mod and the main package is the root or the
+only ./cmd/<name>; flags override either. --sign compiles with a signing key
+passed as a build secret:
+
+  tsk docker init --sign --public-key keys/tsk.pub.pem
+  docker build --secret id=tsk_signing_key,src=signing.pem -t api .`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleDockerInit(dir, opts, dryRun, force)
+		},
+	}
+	initCmd.Flags().StringVar(&opts.GoVersion, "go-version", "", "Go version of the build images (default: from go.mod)")
+	initCmd.Flags().StringVar(&opts.Main, "main", "", "Main package to build (default: detected)")
+	initCmd.Flags().StringVar(&opts.Config, "config", "", "Configuration file to compile (default: peanu.tsk)")
+	initCmd.Flags().StringVar(&opts.TskVersion, "tsk-version", "", "Version of tsk compiling the configuration (default: latest)")
+	initCmd.Flags().StringVar(&opts.Base, "base", "", "Runtime image (default: distroless)")
+	initCmd.Flags().BoolVar(&opts.CGO, "cgo", false, "Build with cgo on Debian images")
+	initCmd.Flags().BoolVar(&opts.Sign, "sign", false, "Sign the binary with the build secret "+docker.SecretID)
+	initCmd.Flags().StringVar(&opts.PublicKey, "public-key", "", "Public key in the project to verify the binary with at runtime")
+	initCmd.Flags().IntVar(&opts.Port, "port", 0, "Port to expose")
+	initCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the Dockerfile instead of writing it")
+	initCmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing Dockerfile")
+	dockerCmd.AddCommand(initCmd)
+
+	var env, signKey string
+	var bake docker.BakeOptions
+	bakeCmd := &cobra.Command{
+		Use:   "bake-config <image> [dir]",
+		Short: "Add the compiled configuration to an existing image",
+		Long: `Compile the peanut hierarchy of dir (default "."), with the overlay of --env
+merged in, to a .pnt binary and build a new image from <image> with the
+binary added as one more layer, labelled ` + docker.ConfigLabel + `.
+The binary goes to peanu.pnt in the image's working directory unless --path
+says otherwise, and replaces <image> unless --tag names another. --sign
+signs it; --public-key adds the matching key next to it and sets
+` + peanut.PublicKeyEnv + ` so the application refuses unsigned configuration.
+
+  tsk docker bake-config api:1.4 --env production --sign signing.pem \
+    --public-key signing.pub.pem --tag api:1.4-production`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 1 {
+				dir = args[1]
+			}
+			bake.Image = args[0]
+			return c.handleDockerBake(dir, env, signKey, bake)
+		},
+	}
+	bakeCmd.Flags().StringVar(&env, "env", "", "Environment overlay to apply, e.g. production")
+	bakeCmd.Flags().StringVarP(&bake.Tag, "tag", "t", "", "Tag of the new image (default: the image)")
+	bakeCmd.Flags().StringVar(&bake.Path, "path", "", "Path of the binary in the image (default: <workdir>/peanu.pnt)")
+	bakeCmd.Flags().StringVar(&signKey, "sign", "", "Sign with this PEM Ed25519 private key")
+	bakeCmd.Flags().StringVar(&bake.PublicKey, "public-key", "", "PEM public key to add and require at runtime")
+	dockerCmd.AddCommand(bakeCmd)
+
+	c.rootCmd.AddCommand(dockerCmd)
+}
+
+// Docker Init Handler
+func (c *CLI) handleDockerInit(dir string, opts docker.InitOptions, dryRun, force bool) error {
+	opts, dockerfile, ignore, err := docker.Init(dir, opts)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return c.out.Result(opts, func(w io.Writer) {
+			w.Write(dockerfile)
+		})
+	}
+
+	file := filepath.Join(dir, "Dockerfile")
+	if _, err := os.Stat(file); err == nil && !force {
+		return fmt.Errorf("%s already exists; pass --force to overwrite it", file)
+	}
+	if err := os.WriteFile(file, dockerfile, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	written := []string{file}
+	// An existing .dockerignore is the project's own; leave it alone
+	ignoreFile := filepath.Join(dir, ".dockerignore")
+	if _, err := os.Stat(ignoreFile); os.IsNotExist(err) {
+		if err := os.WriteFile(ignoreFile, ignore, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", ignoreFile, err)
+		}
+		written = append(written, ignoreFile)
+	}
+
+	result := struct {
+		docker.InitOptions
+		Written []string `json:"written"`
+	}{opts, written}
+	return c.out.Result(result, func(w io.Writer) {
+		for _, path := range written {
+			fmt.Fprintf(w, "✅ Wrote %s\n", path)
+		}
+		fmt.Fprintf(w, "🐳 Go %s, building %s, compiling %s into %s\n", opts.GoVersion, opts.Main, opts.Config, opts.Base)
+		if opts.Sign {
+			fmt.Fprintf(w, "🔏 Build with: docker build --secret id=%s,src=<private key> .\n", docker.SecretID)
+		}
+	})
+}
+
+// Docker Bake Handler
+func (c *CLI) handleDockerBake(dir, env, signKey string, opts docker.BakeOptions) error {
+	if signKey != "" {
+		key, err := peanut.LoadPrivateKey(signKey)
+		if err != nil {
+			return err
+		}
+		opts.SigningKey = key
+	}
+	h, err := resolveEnvironment(dir, env)
+	if err != nil {
+		return err
+	}
+	result, out, err := docker.Bake(h.Config, opts)
+	if err != nil {
+		if len(out) > 0 {
+			c.out.Printf("%s", out)
+		}
+		return err
+	}
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ Baked %s (%s, %s) into %s at %s\n", result.Tag, formatBytes(int64(result.Size)), result.Digest, result.Image, result.Path)
+		if !result.Signed {
+			fmt.Fprintln(w, "⚠️  The configuration is not signed; pass --sign to sign it")
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cyber-boost/tusktsk/pkg/configdoc"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// Config Docs Handler
+func (c *CLI) handleConfigDocs(dir, formatName, templateFile, output, title string) error {
+	format, err := configdoc.ParseFormat(formatName)
+	if err != nil {
+		return err
+	}
+	h, err := peanut.ResolveHierarchy(dir)
+	if err != nil {
+		return err
+	}
+	doc := configdoc.Generate(h, configdoc.Options{Title: title, Root: dir})
+
+	var buf bytes.Buffer
+	if templateFile != "" {
+		source, err := os.ReadFile(templateFile)
+		if err != nil {
+			return fmt.Errorf("failed to read template: %w", err)
+		}
+		if err := doc.RenderTemplate(&buf, string(source), format); err != nil {
+			return err
+		}
+	} else if err := doc.Render(&buf, format); err != nil {
+		return err
+	}
+
+	if output == "" {
+		// The document is the result; --json gets its structure instead
+		return c.out.Result(doc, func(w io.Writer) {
+			w.Write(buf.Bytes())
+		})
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+
+	keys := 0
+	for _, section := range doc.Sections {
+		keys += len(section.Keys)
+	}
+	result := struct {
+		Output   string `json:"output"`
+		Format   string `json:"format"`
+		Keys     int    `json:"keys"`
+		Sections int    `json:"sections"`
+	}{output, string(format), keys, len(doc.Sections)}
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "📚 Documented %d key(s) in %d section(s) to %s\n", keys, len(doc.Sections), output)
+	})
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/doctor"
+	"github.com/spf13/cobra"
+)
+
+// doctorIcons mark the results of tsk doctor
+var doctorIcons = map[doctor.Status]string{
+	doctor.OK:   "✅",
+	doctor.Warn: "⚠️ ",
+	doctor.Fail: "❌",
+	doctor.Skip: "⏭️ ",
+}
+
+// Doctor Command
+func (c *CLI) addDoctorCommand() {
+	var checks []string
+	var timeout time.Duration
+
+	doctorCmd := &cobra.Command{
+		Use:   "doctor [dir]",
+		Short: "Check the environment tsk runs in",
+		Long: `Check the configuration hierarchy of dir (default .), compiled binaries
+older than their source, the databases in [database] and $TUSK_DATABASE_URL,
+AI provider keys, the run directories of the daemon and services, and the
+Go toolchain. Each problem is printed with how to fix it.
+
+Exits with 1 when a check fails; warnings do not fail. --json prints the
+whole report for CI.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleDoctor(dir, checks, timeout)
+		},
+	}
+	doctorCmd.Flags().StringSliceVar(&checks, "check", nil, fmt.Sprintf("Only run these checks (%v)", doctor.Checks()))
+	doctorCmd.Flags().DurationVar(&timeout, "timeout", 3*time.Second, "Time allowed to reach each database")
+	c.rootCmd.AddCommand(doctorCmd)
+}
+
+// Doctor Handler
+func (c *CLI) handleDoctor(dir string, checks []string, timeout time.Duration) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	runDirs := []string{servicesDir()}
+	if socketDir := filepath.Dir(daemonSocket()); socketDir != runDirs[0] {
+		runDirs = append(runDirs, socketDir)
+	}
+
+	report, err := doctor.Run(context.Background(), doctor.Env{Dir: abs, RunDirs: runDirs, Timeout: timeout}, checks...)
+	if err != nil {
+		return err
+	}
+	err = c.out.Result(report, func(w io.Writer) {
+		fmt.Fprintf(w, "🩺 Checking %s\n", abs)
+		last := ""
+		for _, r := range report.Results {
+			if r.Check != last {
+				fmt.Fprintf(w, "\n%s\n", r.Check)
+				last = r.Check
+			}
+			fmt.Fprintf(w, "  %s %s\n", doctorIcons[r.Status], r.Message)
+			if r.Fix != "" {
+				fmt.Fprintf(w, "     → %s\n", r.Fix)
+			}
+		}
+		fmt.Fprintf(w, "\n%d ok, %d warning(s), %d failed, %d skipped\n",
+			report.Counts[doctor.OK], report.Counts[doctor.Warn], report.Counts[doctor.Fail], report.Counts[doctor.Skip])
+	})
+	if err != nil {
+		return err
+	}
+	if !report.Healthy() {
+		return fmt.Errorf("%d check(s) failed", report.Counts[doctor.Fail])
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/examples"
+	"github.com/spf13/cobra"
+)
+
+// Examples Commands
+func (c *CLI) addExamplesCommands() {
+	examplesCmd := &cobra.Command{
+		Use:   "examples",
+		Short: "Runnable SDK usage examples",
+		Long:  "List and run the example programs and configs embedded in tsk",
+	}
+
+	// Examples List
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List available examples",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleExamplesList()
+		},
+	}
+	examplesCmd.AddCommand(listCmd)
+
+	// Examples Run
+	var dir string
+	var keep bool
+	runCmd := &cobra.Command{
+		Use:   "run [name]",
+		Short: "Run an example in a temporary directory",
+		Long: `Write an example's main.go and config files to a temporary directory
+and run it there. Use --dir to choose the directory, or --keep to leave the
+temporary directory in place as a starting point for your own code.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleExamplesRun(args[0], dir, keep)
+		},
+	}
+	runCmd.Flags().StringVar(&dir, "dir", "", "Directory to run the example in (kept afterwards)")
+	runCmd.Flags().BoolVar(&keep, "keep", false, "Keep the temporary directory")
+	examplesCmd.AddCommand(runCmd)
+
+	c.rootCmd.AddCommand(examplesCmd)
+}
+
+// Examples List Handler
+func (c *CLI) handleExamplesList() error {
+	type exampleInfo struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	var list []exampleInfo
+	for _, example := range examples.List() {
+		list = append(list, exampleInfo{example.Name, example.Description})
+	}
+	return c.out.Result(list, func(w io.Writer) {
+		fmt.Fprintln(w, "📋 Examples:")
+		for _, example := range list {
+			fmt.Fprintf(w, "  %-12s %s\n", example.Name, example.Description)
+		}
+		fmt.Fprintln(w, "\nRun one with: tsk examples run <name>")
+	})
+}
+
+// Examples Run Handler
+func (c *CLI) handleExamplesRun(name, dir string, keep bool) error {
+	example, err := examples.Get(name)
+	if err != nil {
+		return err
+	}
+
+	if dir == "" {
+		dir, err = os.MkdirTemp("", "tsk-example-"+name+"-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		if !keep {
+			defer os.RemoveAll(dir)
+		}
+	} else {
+		keep = true
+	}
+
+	files, err := example.Files()
+	if err != nil {
+		return err
+	}
+	c.out.Printf("🚀 Running example %s (%s)\n\n", example.Name, strings.Join(files, ", "))
+	if err := example.Run(dir, os.Stdout); err != nil {
+		return err
+	}
+
+	c.out.Println()
+	if keep {
+		c.out.Printf("✅ Example files kept in %s\n", dir)
+	} else {
+		c.out.Println("✅ Example completed")
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	"github.com/cyber-boost/tusktsk/pkg/features"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/spf13/cobra"
+)
+
+// Feature Commands
+func (c *CLI) addFeatureCommands() {
+	var dir string
+
+	featureCmd := &cobra.Command{
+		Use:   "feature",
+		Short: "Feature flag commands",
+		Long: `Inspect the flags of the [features] section and its provider, and turn
+them on or off at runtime. Overrides are kept in .tsk/features.json next to
+the configuration; running processes pick them up within a second.`,
+	}
+	featureCmd.PersistentFlags().StringVar(&dir, "dir", ".", "Directory whose hierarchy is loaded")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List flags and their state",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleFeatureList(dir)
+		},
+	}
+	featureCmd.AddCommand(listCmd)
+
+	enabled, disabled := true, false
+	for _, override := range []struct {
+		use, short string
+		state      *bool
+	}{
+		{"enable <flag>", "Turn a flag on for everyone", &enabled},
+		{"disable <flag>", "Turn a flag off for everyone", &disabled},
+		{"reset <flag>", "Drop a runtime override", nil},
+	} {
+		override := override
+		featureCmd.AddCommand(&cobra.Command{
+			Use:   override.use,
+			Short: override.short,
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return c.handleFeatureOverride(dir, args[0], override.state)
+			},
+		})
+	}
+
+	c.rootCmd.AddCommand(featureCmd)
+}
+
+// loadFeatures configures features.Default from the hierarchy in dir and
+// returns the directory its overrides live in
+func loadFeatures(dir string) (string, error) {
+	cfg, files, err := peanut.LoadHierarchy(dir)
+	if err != nil {
+		return "", err
+	}
+	if _, _, err := cfg.Resolve("features", peanut.NewVM()); err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return dir, nil
+	}
+	return filepath.Dir(files[len(files)-1]), nil
+}
+
+// Feature List Handler
+func (c *CLI) handleFeatureList(dir string) error {
+	if _, err := loadFeatures(dir); err != nil {
+		return err
+	}
+	type featureState struct {
+		Name    string              `json:"name"`
+		Enabled bool                `json:"enabled"`
+		Rollout float64             `json:"rollout"`
+		Users   []string            `json:"users,omitempty"`
+		Exclude []string            `json:"exclude,omitempty"`
+		Match   map[string][]string `json:"match,omitempty"`
+	}
+	names := features.Default.Names()
+	flags := make([]featureState, 0, len(names))
+	table := cliio.NewTable("FLAG", "STATE")
+	for _, name := range names {
+		flag, _, err := features.Default.Flag(name)
+		if err != nil {
+			c.out.Printf("⚠️  %v\n", err)
+		}
+		state := "off"
+		if flag.Enabled {
+			state = "on"
+			var details []string
+			if flag.Rollout < 100 {
+				details = append(details, fmt.Sprintf("%g%% rollout", flag.Rollout))
+			}
+			if len(flag.Users) > 0 {
+				details = append(details, fmt.Sprintf("%d user(s)", len(flag.Users)))
+			}
+			if len(flag.Match) > 0 {
+				details = append(details, fmt.Sprintf("%d rule(s)", len(flag.Match)))
+			}
+			if len(details) > 0 {
+				state += " (" + strings.Join(details, ", ") + ")"
+			}
+		}
+		table.AddRow(name, state)
+		flags = append(flags, featureState{name, flag.Enabled, flag.Rollout, flag.Users, flag.Exclude, flag.Match})
+	}
+	return c.out.Result(flags, func(w io.Writer) {
+		if len(flags) == 0 {
+			fmt.Fprintln(w, "No feature flags defined")
+			return
+		}
+		fmt.Fprintln(w, "🚩 Feature flags:")
+		table.Render(w)
+	})
+}
+
+// Feature Override Handler
+func (c *CLI) handleFeatureOverride(dir, name string, state *bool) error {
+	configDir, err := loadFeatures(dir)
+	if err != nil {
+		return err
+	}
+	known := false
+	for _, flag := range features.Default.Names() {
+		known = known || flag == name
+	}
+	if !known {
+		c.out.Printf("⚠️  %s is not defined in [features] or by its provider\n", name)
+	}
+
+	path := features.OverridesPath(configDir)
+	if err := features.SetOverride(path, name, state); err != nil {
+		return err
+	}
+	result := struct {
+		Name     string `json:"name"`
+		Override *bool  `json:"override"`
+		Path     string `json:"path"`
+	}{name, state, path}
+	return c.out.Result(result, func(w io.Writer) {
+		switch {
+		case state == nil:
+			fmt.Fprintf(w, "↩️  %s follows its configuration again\n", name)
+		case *state:
+			fmt.Fprintf(w, "✅ %s enabled for everyone\n", name)
+		default:
+			fmt.Fprintf(w, "⛔ %s disabled for everyone\n", name)
+		}
+		fmt.Fprintf(w, "📝 Recorded in %s\n", path)
+	})
+}
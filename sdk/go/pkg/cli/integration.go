@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/internal/integration"
+)
+
+// integrationProject names the compose project so teardown never touches
+// other containers
+const integrationProject = "tsk-integration"
+
+// handleTestIntegration starts the integration services, runs the tagged
+// test suites against them and tears the services down again
+func (c *CLI) handleTestIntegration(packages []string, run string, keep bool) error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("integration tests need docker: %w", err)
+	}
+	if _, err := os.Stat(integration.ComposeFile); err != nil {
+		return fmt.Errorf("run from the SDK root: %w", err)
+	}
+
+	compose := func(args ...string) error {
+		cmd := exec.Command("docker", append([]string{"compose", "-f", integration.ComposeFile, "-p", integrationProject}, args...)...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		return cmd.Run()
+	}
+
+	c.out.Println("🐳 Starting PostgreSQL, Redis, Memcached and MinIO...")
+	if err := compose("up", "-d", "--wait"); err != nil {
+		compose("down", "-v")
+		return fmt.Errorf("failed to start integration services: %w", err)
+	}
+	if keep {
+		defer c.out.Printf("📌 Services left running; stop them with: docker compose -f %s -p %s down -v\n", integration.ComposeFile, integrationProject)
+	} else {
+		defer func() {
+			c.out.Println("🧹 Tearing down integration services...")
+			compose("down", "-v")
+		}()
+	}
+
+	env := append(os.Environ(), integration.Env()...)
+	for _, service := range integration.Services {
+		address := os.Getenv(service.Env)
+		if address == "" {
+			address = service.Default
+		}
+		if err := integration.WaitForTCP(address, time.Minute); err != nil {
+			return fmt.Errorf("%s: %w", service.Name, err)
+		}
+	}
+
+	args := []string{"test", "-tags", "integration", "-count=1"}
+	if run != "" {
+		args = append(args, "-run", run)
+	}
+	args = append(args, packages...)
+
+	c.out.Printf("🧪 go %v\n", args)
+	cmd := exec.Command("go", args...)
+	cmd.Env = env
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("integration tests failed: %w", err)
+	}
+
+	c.out.Println("✅ Integration tests passed")
+	return nil
+}
@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/jobs"
+	"github.com/spf13/cobra"
+)
+
+// defaultJobServer is the HPC cluster manager API address
+const defaultJobServer = "http://localhost:8082"
+
+// Jobs Commands
+func (c *CLI) addJobsCommands() {
+	var server string
+
+	jobsCmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "HPC job management commands",
+		Long:  "Commands for submitting and inspecting jobs on the HPC cluster manager",
+	}
+	jobsCmd.PersistentFlags().StringVar(&server, "server", "", "Cluster manager URL (default $TSK_JOB_SERVER or "+defaultJobServer+")")
+
+	dagCmd := &cobra.Command{
+		Use:   "dag",
+		Short: "Job DAG commands",
+	}
+
+	// DAG Submit
+	submitCmd := &cobra.Command{
+		Use:   "submit [dag.json]",
+		Short: "Submit a DAG of dependent jobs",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleDAGSubmit(server, args[0])
+		},
+	}
+	dagCmd.AddCommand(submitCmd)
+
+	// DAG Status
+	var format string
+	statusCmd := &cobra.Command{
+		Use:   "status [id]",
+		Short: "Show DAG progress as ASCII, Mermaid or JSON",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleDAGStatus(server, args[0], format)
+		},
+	}
+	statusCmd.Flags().StringVarP(&format, "format", "f", "ascii", "Output format (ascii, mermaid; json is the same as --json)")
+	dagCmd.AddCommand(statusCmd)
+
+	jobsCmd.AddCommand(dagCmd)
+
+	// Job Artifacts
+	var outputDir string
+	artifactsCmd := &cobra.Command{
+		Use:   "artifacts [job-id] [download [name]]",
+		Short: "List or download a job's result artifacts",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 || len(args) > 3 || (len(args) > 1 && args[1] != "download") {
+				return fmt.Errorf("usage: tsk jobs artifacts <job-id> [download [name]]")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				return c.handleArtifactsList(server, args[0])
+			}
+			name := ""
+			if len(args) == 3 {
+				name = args[2]
+			}
+			return c.handleArtifactsDownload(server, args[0], name, outputDir)
+		},
+	}
+	artifactsCmd.Flags().StringVarP(&outputDir, "output", "o", ".", "Directory to download artifacts into")
+	jobsCmd.AddCommand(artifactsCmd)
+
+	c.rootCmd.AddCommand(jobsCmd)
+}
+
+// Jobs Command Handlers
+func (c *CLI) handleDAGSubmit(server, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read DAG file: %w", err)
+	}
+	// A malformed DAG or a dependency cycle is refused before it is sent
+	var dag jobs.JobDAG
+	if err := json.Unmarshal(data, &dag); err != nil {
+		return tskerrors.Wrap(tskerrors.Validation, fmt.Errorf("invalid DAG file %s: %w", file, err))
+	}
+	if err := dag.Validate(); err != nil {
+		return tskerrors.Wrap(tskerrors.Validation, err)
+	}
+
+	body, err := jobRequest(server, http.MethodPost, "/dags", data)
+	if err != nil {
+		return err
+	}
+	return c.out.Result(serverResult(body), func(w io.Writer) {
+		fmt.Fprintf(w, "✅ DAG submitted: %s", body)
+	})
+}
+
+func (c *CLI) handleDAGStatus(server, id, format string) error {
+	switch format {
+	case "ascii", "mermaid":
+	case "json":
+		c.out.Format = cliio.JSON
+	default:
+		return fmt.Errorf("unsupported format %q (supported: ascii, mermaid, json)", format)
+	}
+	if c.out.Structured() {
+		format = "json"
+	}
+
+	query := url.Values{"id": {id}, "format": {format}}
+	body, err := jobRequest(server, http.MethodGet, "/dags?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return c.out.Result(serverResult(body), func(w io.Writer) {
+		fmt.Fprint(w, string(body))
+	})
+}
+
+// serverResult is the data of a result the cluster manager answered:
+// its JSON as is, or its text
+func serverResult(body []byte) interface{} {
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func fetchArtifacts(server, jobID string) ([]jobs.JobArtifact, error) {
+	body, err := jobRequest(server, http.MethodGet, "/jobs/artifacts?"+url.Values{"id": {jobID}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Artifacts []jobs.JobArtifact `json:"artifacts"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Artifacts, nil
+}
+
+func (c *CLI) handleArtifactsList(server, jobID string) error {
+	artifacts, err := fetchArtifacts(server, jobID)
+	if err != nil {
+		return err
+	}
+	return c.out.Result(artifacts, func(w io.Writer) {
+		if len(artifacts) == 0 {
+			fmt.Fprintf(w, "📋 Job %s has no stored artifacts\n", jobID)
+			return
+		}
+		fmt.Fprintf(w, "📋 Job %s artifacts (%d)\n", jobID, len(artifacts))
+		for _, artifact := range artifacts {
+			expires := "never"
+			if artifact.ExpiresAt != nil {
+				expires = artifact.ExpiresAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "  %-40s %10d bytes  sha256:%s  expires %s\n", artifact.Name, artifact.Size, artifact.Digest[:12], expires)
+		}
+	})
+}
+
+func (c *CLI) handleArtifactsDownload(server, jobID, name, outputDir string) error {
+	artifacts, err := fetchArtifacts(server, jobID)
+	if err != nil {
+		return err
+	}
+
+	var downloaded []jobs.JobArtifact
+	for _, artifact := range artifacts {
+		if name != "" && artifact.Name != name {
+			continue
+		}
+		if err := downloadArtifact(server, jobID, artifact, outputDir); err != nil {
+			return err
+		}
+		c.out.Printf("✅ Downloaded %s (%d bytes)\n", artifact.Name, artifact.Size)
+		downloaded = append(downloaded, artifact)
+	}
+
+	if len(downloaded) == 0 {
+		if name != "" {
+			return fmt.Errorf("job %s has no artifact %s", jobID, name)
+		}
+		return fmt.Errorf("job %s has no stored artifacts", jobID)
+	}
+	return c.out.Result(downloaded, nil)
+}
+
+// downloadArtifact streams one artifact to disk and verifies its digest
+func downloadArtifact(server, jobID string, artifact jobs.JobArtifact, outputDir string) error {
+	// Artifact names come from the server; never let them escape outputDir
+	rel := path.Clean("/" + artifact.Name)[1:]
+	if rel == "" {
+		return fmt.Errorf("invalid artifact name %q", artifact.Name)
+	}
+	dest := filepath.Join(outputDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	query := url.Values{"id": {jobID}, "name": {artifact.Name}}
+	resp, err := http.Get(jobServerURL(server) + "/jobs/artifacts?" + query.Encode())
+	if err != nil {
+		return fmt.Errorf("failed to download artifact %s: %w", artifact.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("cluster manager returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	tmp := dest + ".partial"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+	defer os.Remove(tmp)
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download artifact %s: %w", artifact.Name, err)
+	}
+
+	if digest := hex.EncodeToString(hash.Sum(nil)); digest != artifact.Digest {
+		return fmt.Errorf("artifact %s digest mismatch: expected %s, got %s", artifact.Name, artifact.Digest, digest)
+	}
+	return os.Rename(tmp, dest)
+}
+
+// jobServerURL resolves the cluster manager address from the flag or environment
+func jobServerURL(server string) string {
+	if server == "" {
+		server = os.Getenv("TSK_JOB_SERVER")
+	}
+	if server == "" {
+		server = defaultJobServer
+	}
+	return strings.TrimRight(server, "/")
+}
+
+// jobRequest calls the cluster manager API and returns the response body
+func jobRequest(server, method, path string, payload []byte) ([]byte, error) {
+	server = jobServerURL(server)
+
+	req, err := http.NewRequest(method, server+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach cluster manager at %s: %w", server, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("cluster manager returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/k8s"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/promote"
+	"github.com/spf13/cobra"
+)
+
+// K8s Commands
+func (c *CLI) addK8sCommands() {
+	k8sCmd := &cobra.Command{
+		Use:   "k8s",
+		Short: "Kubernetes commands",
+	}
+
+	var env, output, kubeContext string
+	var labels []string
+	var opts k8s.Options
+	var envKeys, apply bool
+	exportCmd := &cobra.Command{
+		Use:   "export [dir]",
+		Short: "Export the configuration as a ConfigMap and Secret",
+		Long: `Resolve the peanut hierarchy of dir (default ".") and print it as Kubernetes
+manifests: a ConfigMap with every value, and a Secret with the sensitive
+ones, named <name>-secret. A key is sensitive when its value is a
+@secret(...), when a "# k8s:secret" comment sits above it, or when it
+matches a --secret pattern or one of the [k8s] secrets patterns.
+
+The [k8s] section supplies defaults for the flags and is not exported:
+
+  [k8s]
+  name: "api"
+  namespace: "payments"
+  labels.team: "platform"
+  secrets: ["*.password", "*.token"]
+
+--env-keys names the data DATABASE_HOST instead of database.host, for
+envFrom. --apply pipes the manifests to kubectl apply, which uses the local
+kubeconfig.
+
+  tsk k8s export services/api --env production -o k8s/config.yaml
+  tsk k8s export --namespace staging --label tier=backend --apply`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			opts.Labels = make(map[string]string)
+			for _, label := range labels {
+				key, value, ok := strings.Cut(label, "=")
+				if !ok || key == "" {
+					return fmt.Errorf("invalid label %q: expected key=value", label)
+				}
+				opts.Labels[key] = value
+			}
+			if envKeys {
+				opts.Keys = k8s.KeysEnv
+			}
+			return c.handleK8sExport(dir, env, output, kubeContext, apply, opts)
+		},
+	}
+	exportCmd.Flags().StringVar(&env, "env", "", "Environment overlay to apply, e.g. production")
+	exportCmd.Flags().StringVar(&opts.Name, "name", "", "ConfigMap name (default: k8s.name)")
+	exportCmd.Flags().StringVarP(&opts.Namespace, "namespace", "n", "", "Namespace of the manifests (default: k8s.namespace)")
+	exportCmd.Flags().StringArrayVar(&labels, "label", nil, "Label to add, as key=value (repeatable)")
+	exportCmd.Flags().StringArrayVar(&opts.Secrets, "secret", nil, "Pattern of keys to put in the Secret, e.g. '*.password' (repeatable)")
+	exportCmd.Flags().BoolVar(&envKeys, "env-keys", false, "Name data keys as environment variables")
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "File to write instead of stdout")
+	exportCmd.Flags().BoolVar(&apply, "apply", false, "Apply the manifests with kubectl")
+	exportCmd.Flags().StringVar(&kubeContext, "context", "", "kubeconfig context to apply to")
+	k8sCmd.AddCommand(exportCmd)
+
+	for _, target := range []struct {
+		use, short, long string
+		export           func(k8s.Source, []k8s.Environment, *peanut.VM, k8s.Options) (*k8s.Bundle, error)
+	}{
+		{"helm [dir]", "Export values.yaml and per-environment values files for a Helm chart", `Resolve the peanut hierarchy of dir (default ".") into a Helm values.yaml,
+nested by section, and write a values-<env>.yaml for each environment
+overlay (peanu.<env>.tsk, all of them unless --env picks some) holding
+only what the overlay changes:
+
+  helm upgrade api ./chart -f values.yaml -f values-production.yaml
+
+Helm replaces lists, so a list an overlay appends to ("key +=:") is written
+whole; keys a replace annotation ("[section =]") drops are set to null,
+which Helm removes. Comments above keys and sections become YAML comments.
+Sensitive keys, as for k8s export, are left out.
+
+  tsk k8s helm services/api -o chart/`, k8s.Helm},
+		{"kustomize [dir]", "Export a Kustomize base and per-environment overlays", `Resolve the peanut hierarchy of dir (default ".") into a Kustomize base
+holding its ConfigMap, and an overlay per environment (peanu.<env>.tsk, all
+of them unless --env picks some) with a patch of the keys it changes, lists
+whole and dropped keys as null:
+
+  base/kustomization.yaml, base/configmap.yaml
+  overlays/<env>/kustomization.yaml, overlays/<env>/configmap-patch.yaml
+
+Comments above keys become YAML comments. Sensitive keys, as for k8s export,
+are left out.
+
+  tsk k8s kustomize services/api --env staging --env production -o deploy/`, k8s.Kustomize},
+	} {
+		target := target
+		var envs []string
+		var output string
+		var envKeys bool
+		var opts k8s.Options
+		cmd := &cobra.Command{
+			Use:   target.use,
+			Short: target.short,
+			Long:  target.long,
+			Args:  cobra.MaximumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				dir := "."
+				if len(args) > 0 {
+					dir = args[0]
+				}
+				if envKeys {
+					opts.Keys = k8s.KeysEnv
+				}
+				return c.handleK8sBundle(dir, envs, output, opts, target.export)
+			},
+		}
+		cmd.Flags().StringArrayVar(&envs, "env", nil, "Environment overlay to export (repeatable; default: all)")
+		cmd.Flags().StringVarP(&output, "output", "o", "", "Directory to write the files to instead of stdout")
+		cmd.Flags().StringArrayVar(&opts.Secrets, "secret", nil, "Pattern of sensitive keys to leave out (repeatable)")
+		if strings.HasPrefix(target.use, "kustomize") {
+			cmd.Flags().StringVar(&opts.Name, "name", "", "ConfigMap name (default: k8s.name)")
+			cmd.Flags().StringVarP(&opts.Namespace, "namespace", "n", "", "Namespace of the base (default: k8s.namespace)")
+			cmd.Flags().BoolVar(&envKeys, "env-keys", false, "Name data keys as environment variables")
+		}
+		k8sCmd.AddCommand(cmd)
+	}
+
+	c.rootCmd.AddCommand(k8sCmd)
+}
+
+// K8s Export Handler
+func (c *CLI) handleK8sExport(dir, env, output, kubeContext string, apply bool, opts k8s.Options) error {
+	src, err := k8sSource(dir, env)
+	if err != nil {
+		return err
+	}
+	manifests, err := k8s.Export(src, peanut.NewVM(), opts)
+	if err != nil {
+		return err
+	}
+	data, err := k8s.Marshal(manifests)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		Manifests []k8s.Manifest `json:"manifests"`
+		Output    string         `json:"output,omitempty"`
+		Applied   string         `json:"applied,omitempty"`
+	}{Manifests: manifests, Output: output}
+	if output != "" {
+		if err := os.WriteFile(output, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", output, err)
+		}
+	}
+	if apply {
+		var args []string
+		if kubeContext != "" {
+			args = append(args, "--context", kubeContext)
+		}
+		applied, err := k8s.Apply(manifests, args...)
+		if err != nil {
+			return err
+		}
+		result.Applied = string(bytes.TrimSpace(applied))
+	}
+
+	return c.out.Result(result, func(w io.Writer) {
+		if output == "" && !apply {
+			w.Write(data)
+			return
+		}
+		for _, m := range manifests {
+			fmt.Fprintf(w, "📦 %s %s: %d key(s)\n", m.Kind, m.Metadata.Name, len(m.Data))
+		}
+		if output != "" {
+			fmt.Fprintf(w, "✅ Wrote %s\n", output)
+		}
+		if apply {
+			fmt.Fprintf(w, "🚀 Applied:\n%s\n", result.Applied)
+		}
+	})
+}
+
+// k8sSource loads the hierarchy of dir, with the overlay of env merged in
+// when env is set
+func k8sSource(dir, env string) (k8s.Source, error) {
+	h, err := resolveEnvironment(dir, env)
+	if err != nil {
+		return k8s.Source{}, err
+	}
+	values, err := h.Config.Values()
+	if err != nil {
+		return k8s.Source{}, err
+	}
+	return k8s.Source{Values: values, Comments: h.Comments}, nil
+}
+
+// resolveEnvironment resolves the hierarchy of dir and merges the overlay
+// of env, peanu.<env>.tsk, on top when env is set
+func resolveEnvironment(dir, env string) (*peanut.Hierarchy, error) {
+	h, err := peanut.ResolveHierarchy(dir)
+	if err != nil {
+		return nil, err
+	}
+	if env != "" {
+		overlay := promote.OverlayFile(dir, env)
+		if _, err := os.Stat(overlay); err != nil {
+			return nil, fmt.Errorf("no overlay for environment %s: %w", env, err)
+		}
+		if err := h.Overlay(overlay); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// K8s Helm/Kustomize Handler
+func (c *CLI) handleK8sBundle(dir string, envs []string, output string, opts k8s.Options,
+	export func(k8s.Source, []k8s.Environment, *peanut.VM, k8s.Options) (*k8s.Bundle, error)) error {
+	if len(envs) == 0 {
+		var err error
+		if envs, err = promote.Environments(dir); err != nil {
+			return err
+		}
+	}
+	base, err := k8sSource(dir, "")
+	if err != nil {
+		return err
+	}
+	var environments []k8s.Environment
+	for _, env := range envs {
+		src, err := k8sSource(dir, env)
+		if err != nil {
+			return err
+		}
+		environments = append(environments, k8s.Environment{Name: env, Source: src})
+	}
+	bundle, err := export(base, environments, peanut.NewVM(), opts)
+	if err != nil {
+		return err
+	}
+
+	if output != "" {
+		for _, f := range bundle.Files {
+			path := filepath.Join(output, filepath.FromSlash(f.Path))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, f.Data, 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+		}
+	}
+
+	return c.out.Result(bundle, func(w io.Writer) {
+		if output == "" {
+			for i, f := range bundle.Files {
+				if i > 0 {
+					fmt.Fprintln(w, "---")
+				}
+				fmt.Fprintf(w, "# Source: %s\n%s", f.Path, f.Data)
+			}
+		} else {
+			for _, f := range bundle.Files {
+				fmt.Fprintf(w, "✅ Wrote %s\n", filepath.Join(output, filepath.FromSlash(f.Path)))
+			}
+		}
+		if len(bundle.Skipped) > 0 {
+			// A YAML comment, so printed files stay valid YAML
+			fmt.Fprintf(w, "# 🔒 Left out %d sensitive key(s): %s (see tsk k8s export)\n", len(bundle.Skipped), strings.Join(bundle.Skipped, ", "))
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/license"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/spf13/cobra"
+)
+
+// Environment variables the license settings are read from when the
+// configuration has none; the key is license.KeyEnv
+const (
+	licenseAPIKeyEnv = "TSK_LICENSE_API_KEY"
+	licenseServerEnv = "TSK_LICENSE_SERVER"
+)
+
+// licenseSettings reads license.key, license.api_key and license.server
+// from dir's hierarchy, or their environment variables
+func licenseSettings(dir string) (key, apiKey, server string, err error) {
+	values := map[string]interface{}{}
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if err != nil && !errors.Is(err, peanut.ErrNotFound) {
+		return "", "", "", err
+	}
+	if err == nil {
+		if values, err = cfg.Execute(peanut.NewVM()); err != nil {
+			return "", "", "", err
+		}
+	}
+	setting := func(key, env string) string {
+		if value, ok := values[key].(string); ok && value != "" {
+			return value
+		}
+		return os.Getenv(env)
+	}
+	return setting("license.key", license.KeyEnv), setting("license.api_key", licenseAPIKeyEnv), setting("license.server", licenseServerEnv), nil
+}
+
+// loadLicense creates the license of dir's hierarchy and returns it with
+// its server URL
+func loadLicense(dir string) (*license.TuskLicense, string, error) {
+	key, apiKey, server, err := licenseSettings(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if key == "" {
+		return nil, "", tskerrors.New(tskerrors.License, "no license key: set license.key or $%s", license.KeyEnv)
+	}
+	return license.New(key, apiKey), server, nil
+}
+
+// requireCapability checks that the license of dir's hierarchy unlocks
+// the capability name before cmd runs
+func (c *CLI) requireCapability(cmd *cobra.Command, dir, name string) error {
+	key, _, _, err := licenseSettings(dir)
+	if err == nil {
+		err = license.DefaultRegistry.Check(license.ForKey(key), name)
+	}
+	if err != nil {
+		cmd.SilenceUsage = true
+	}
+	return err
+}
+
+// License Commands
+func (c *CLI) addLicenseCommands() {
+	var dir string
+	licenseCmd := &cobra.Command{
+		Use:   "license",
+		Short: "License commands",
+		Long: `Commands for the license of license.key, verified with the license server
+of license.server using license.api_key. Without configuration they are
+read from $TSK_LICENSE_KEY, $TSK_LICENSE_SERVER and $TSK_LICENSE_API_KEY.
+
+Server responses must be signed with the license server key built into
+tsk. A build without one fails before sending anything.`,
+	}
+	licenseCmd.PersistentFlags().StringVar(&dir, "dir", ".", "Directory whose hierarchy is loaded")
+
+	seatsCmd := &cobra.Command{
+		Use:   "seats",
+		Short: "Show the seats of a floating license in use",
+		Long: `Show how many of the concurrent seats of a floating license are taken, by
+which session and host, and when each expires unless its holder renews it.
+
+A process that dies keeps its seat until it expires; tsk license seats
+release frees it at once.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return c.handleLicenseSeats(dir)
+		},
+	}
+	seatsCmd.AddCommand(&cobra.Command{
+		Use:   "release <seat-id>",
+		Short: "Force-release a seat whichever session holds it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return c.handleLicenseSeatRelease(dir, args[0])
+		},
+	})
+	licenseCmd.AddCommand(seatsCmd)
+
+	licenseCmd.AddCommand(&cobra.Command{
+		Use:   "features",
+		Short: "List the premium features and which the license unlocks",
+		Long: `List the capabilities premium subsystems check before they start: the
+distributed cache, the AI commands and role-based access control.
+
+The key is verified with the license server first. A capability is
+unlocked when the server's signed answer gives the key its tier or higher,
+or lists the capability among its features. Other commands rely on that
+answer, kept in the offline cache, for the grace period.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return c.handleLicenseFeatures(dir)
+		},
+	})
+
+	c.rootCmd.AddCommand(licenseCmd)
+}
+
+func (c *CLI) handleLicenseSeats(dir string) error {
+	l, server, err := loadLicense(dir)
+	if err != nil {
+		return err
+	}
+	usage, err := l.Seats(context.Background(), server)
+	if err != nil {
+		return err
+	}
+	sort.Slice(usage.Seats, func(i, j int) bool { return usage.Seats[i].AcquiredAt.Before(usage.Seats[j].AcquiredAt) })
+	return c.out.Result(usage, func(w io.Writer) {
+		fmt.Fprintf(w, "🎟️  %d of %d seat(s) in use\n", usage.InUse, usage.Total)
+		now := time.Now()
+		for _, seat := range usage.Seats {
+			host := seat.Host
+			if host == "" {
+				host = "-"
+			}
+			fmt.Fprintf(w, "   %-16s %-20s %s, since %s, expires in %s\n", seat.ID, host, seat.SessionID,
+				seat.AcquiredAt.Local().Format(time.RFC3339), seat.ExpiresAt.Sub(now).Round(time.Second))
+		}
+	})
+}
+
+func (c *CLI) handleLicenseSeatRelease(dir, id string) error {
+	l, server, err := loadLicense(dir)
+	if err != nil {
+		return err
+	}
+	if err := l.ReleaseSeat(context.Background(), server, id); err != nil {
+		return err
+	}
+	c.out.Printf("✅ Released seat %s\n", id)
+	return nil
+}
+
+func (c *CLI) handleLicenseFeatures(dir string) error {
+	key, _, _, err := licenseSettings(dir)
+	if err != nil {
+		return err
+	}
+	// Ask the server first: its verified answer is what unlocks the
+	// capabilities, and the offline cache keeps it for the grace period.
+	// When it cannot answer, the reasons below say why.
+	l := license.ForKey(key)
+	if l != nil {
+		verified, server, err := loadLicense(dir)
+		if err != nil {
+			return err
+		}
+		if _, err := verified.VerifyLicenseServer(server); err == nil {
+			l = verified
+		}
+	}
+	features := license.DefaultRegistry.Features(l)
+	return c.out.Result(features, func(w io.Writer) {
+		for _, feature := range features {
+			icon := "🔒"
+			if feature.Unlocked {
+				icon = "✅"
+			}
+			fmt.Fprintf(w, "%s %-18s %-11s %s\n", icon, feature.Name, feature.Tier, feature.Description)
+			if feature.Reason != "" {
+				fmt.Fprintf(w, "     → %s\n", feature.Reason)
+			}
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	"github.com/cyber-boost/tusktsk/pkg/health"
+	"github.com/cyber-boost/tusktsk/pkg/profiling"
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
+)
+
+// lifecycle runs a long-running server: it serves until SIGINT or SIGTERM,
+// then stops accepting connections and lets the requests in flight finish.
+// SIGHUP, as sent by `tsk services reload`, calls Reload while requests
+// keep being served. The [observability.profiling] section of Dir's
+// hierarchy, read once at start, adds the profiling endpoints, and the
+// [observability.tracing] section traces every request. /healthz and
+// /readyz answer probes as the [observability.health] section configures.
+type lifecycle struct {
+	// Name identifies the server to `tsk services reload`, such as "web"
+	Name   string
+	Dir    string
+	Server *http.Server
+	// Listen starts serving; nil means Server.ListenAndServe
+	Listen func() error
+	// Drain is how long requests in flight get to finish on shutdown
+	Drain time.Duration
+	// Reload re-reads the configuration; nil leaves SIGHUP alone
+	Reload func() error
+	// Out reports the reloads and the shutdown
+	Out *cliio.Output
+}
+
+// run serves until the server fails or a shutdown signal arrives
+func (l lifecycle) run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	if l.Reload != nil {
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+	}
+
+	service := runningService{Name: l.Name, PID: os.Getpid(), Addr: l.Server.Addr, Dir: l.Dir, Started: time.Now()}
+	traces, err := tracingOptions(l.Dir)
+	if err != nil {
+		l.Out.Printf("⚠️  %v; tracing is off\n", err)
+	}
+	if traces.Enabled {
+		stopTracing, err := startTracing(traces, func(err error) {
+			l.Out.Printf("[%s] ⚠️  tracing: %v\n", time.Now().Format("15:04:05"), err)
+		})
+		if err != nil {
+			return err
+		}
+		defer stopTracing()
+		l.Server.Handler = tracing.Handler(l.Server.Handler)
+		l.Out.Printf("🔭 Tracing requests to %s\n", tracingTarget(traces))
+	}
+
+	prof, err := profilingOptions(l.Dir)
+	if err != nil {
+		l.Out.Printf("⚠️  %v; profiling is off\n", err)
+	}
+	if prof.Enabled {
+		stopProfiling, err := profiling.Start(prof, func(err error) {
+			l.Out.Printf("[%s] ⚠️  continuous profiling: %v\n", time.Now().Format("15:04:05"), err)
+		})
+		if err != nil {
+			return err
+		}
+		defer stopProfiling()
+		l.Server.Handler = profiling.Mount(l.Server.Handler, prof)
+		service.Profiling = profiling.URL(l.Server.Addr, l.Server.TLSConfig != nil, prof)
+		l.Out.Printf("🔬 Profiling endpoints at %s (tsk perf profile)\n", service.Profiling)
+	}
+
+	// Outermost, so that probes skip authentication and tracing
+	checker, err := health.ForHierarchy(l.Dir)
+	if err != nil {
+		l.Out.Printf("⚠️  %v; health probes are off\n", err)
+	} else if checker != nil {
+		l.Server.Handler = health.Mount(l.Server.Handler, checker)
+		l.Out.Printf("💓 Health probes at %s and %s (%s)\n", health.LivePath, health.ReadyPath, strings.Join(checker.Checks(), ", "))
+	}
+
+	listen := l.Listen
+	if listen == nil {
+		listen = l.Server.ListenAndServe
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- listen() }()
+
+	record, err := registerService(service)
+	if err != nil {
+		l.Out.Printf("⚠️  %v; tsk services reload will not find this server\n", err)
+	} else {
+		defer os.Remove(record)
+	}
+
+	for {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("failed to serve: %w", err)
+			}
+			return nil
+		case <-hup:
+			stamp := time.Now().Format("15:04:05")
+			if err := l.Reload(); err != nil {
+				l.Out.Printf("[%s] ⚠️  reload failed: %v (keeping previous configuration)\n", stamp, err)
+			} else {
+				l.Out.Printf("[%s] 🔄 Configuration reloaded\n", stamp)
+			}
+		case <-ctx.Done():
+			// A second Ctrl+C quits at once
+			stop()
+			l.Out.Printf("🛑 Shutting down, waiting up to %s for requests in flight\n", l.Drain)
+			shutdown, cancel := context.WithTimeout(context.Background(), l.Drain)
+			defer cancel()
+			if err := l.Server.Shutdown(shutdown); err != nil {
+				l.Server.Close()
+				return fmt.Errorf("failed to drain connections within %s: %w", l.Drain, err)
+			}
+			return nil
+		}
+	}
+}
+
+// swapHandler serves through a handler that can be replaced while
+// requests are in flight; those keep the handler they started with
+type swapHandler struct {
+	current atomic.Pointer[http.Handler]
+}
+
+func newSwapHandler(h http.Handler) *swapHandler {
+	s := &swapHandler{}
+	s.set(h)
+	return s
+}
+
+func (s *swapHandler) set(h http.Handler) {
+	s.current.Store(&h)
+}
+
+func (s *swapHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	(*s.current.Load()).ServeHTTP(rw, r)
+}
+
+// runningService is what a server records in servicesDir while it runs
+type runningService struct {
+	Name    string    `json:"name"`
+	PID     int       `json:"pid"`
+	Addr    string    `json:"addr"`
+	Dir     string    `json:"dir"`
+	Started time.Time `json:"started"`
+	// Profiling is the base URL of the profiling endpoints, when enabled
+	Profiling string `json:"profiling,omitempty"`
+}
+
+// servicesDir is where running servers are recorded: $TSK_RUN_DIR, or a
+// directory of the user's under the temporary directory
+func servicesDir() string {
+	if dir := os.Getenv("TSK_RUN_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("tsk-services-%d", os.Getuid()))
+}
+
+// registerService records s and returns the file to remove when it stops
+func registerService(s runningService) (string, error) {
+	dir := servicesDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if abs, err := filepath.Abs(s.Dir); err == nil {
+		s.Dir = abs
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, fmt.Sprintf("%s-%d.json", s.Name, s.PID))
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to record service: %w", err)
+	}
+	return file, nil
+}
+
+// runningServices lists the recorded servers that are still running,
+// removing the records of those that died without cleaning up
+func runningServices() ([]runningService, error) {
+	dir := servicesDir()
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var services []runningService
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var s runningService
+		if err := json.Unmarshal(data, &s); err != nil || !processAlive(s.PID) {
+			os.Remove(file)
+			continue
+		}
+		services = append(services, s)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Started.Before(services[j].Started) })
+	return services, nil
+}
+
+// processAlive reports whether a process with pid exists
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return proc.Signal(syscall.Signal(0)) == nil
+}
+
+// Services Reload Handler
+func (c *CLI) handleServicesReload(name string) error {
+	services, err := runningServices()
+	if err != nil {
+		return err
+	}
+	var reloaded []runningService
+	for _, s := range services {
+		if name != "" && s.Name != name {
+			continue
+		}
+		proc, err := os.FindProcess(s.PID)
+		if err == nil {
+			err = proc.Signal(syscall.SIGHUP)
+		}
+		if err != nil {
+			c.out.Printf("❌ %s (pid %d): %v\n", s.Name, s.PID, err)
+			continue
+		}
+		c.out.Printf("🔄 Reloading %s on %s (pid %d, %s)\n", s.Name, s.Addr, s.PID, s.Dir)
+		reloaded = append(reloaded, s)
+	}
+	if len(reloaded) == 0 {
+		if name != "" {
+			return fmt.Errorf("no running %s server", name)
+		}
+		return fmt.Errorf("no running servers found in %s", servicesDir())
+	}
+	return c.out.Result(reloaded, nil)
+}
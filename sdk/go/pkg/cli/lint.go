@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/lint"
+	"github.com/spf13/cobra"
+)
+
+// lintIcons mark the findings of tsk config lint
+var lintIcons = map[lint.Severity]string{
+	lint.Error:   "❌",
+	lint.Warning: "⚠️ ",
+	lint.Info:    "💡",
+}
+
+// Config Lint Handler
+func (c *CLI) handleConfigLint(cmd *cobra.Command, path string, rules []string, fix bool) error {
+	report, err := lint.Lint(path, lint.Options{Rules: rules, Fix: fix})
+	if err != nil {
+		return err
+	}
+
+	err = c.out.Result(report, func(w io.Writer) {
+		if fix && report.Fixed > 0 {
+			fmt.Fprintf(w, "🔧 Fixed %d finding(s) in %d file(s)\n", report.Fixed, len(report.Changed))
+		}
+		if len(report.Findings) == 0 {
+			fmt.Fprintf(w, "✅ %d file(s) clean\n", len(report.Files))
+			return
+		}
+		for _, f := range report.Findings {
+			file := f.File
+			if rel, err := filepath.Rel(".", f.File); err == nil {
+				file = rel
+			}
+			fixable := ""
+			if f.Fixable {
+				fixable = " (fixable)"
+			}
+			fmt.Fprintf(w, "%s %s:%d:%d %s [%s]%s\n", lintIcons[f.Severity], file, f.Line, f.Column, f.Message, f.Rule, fixable)
+			if f.Hint != "" {
+				fmt.Fprintf(w, "     → %s\n", f.Hint)
+			}
+		}
+		fmt.Fprintf(w, "\n%d error(s), %d warning(s), %d info in %d file(s)\n",
+			report.Counts[lint.Error], report.Counts[lint.Warning], report.Counts[lint.Info], len(report.Files))
+		if n := report.Fixable(); n > 0 && !fix {
+			fmt.Fprintf(w, "🔧 %d can be fixed with --fix\n", n)
+		}
+	})
+	if err != nil || report.Counts[lint.Error] == 0 {
+		return err
+	}
+	// Findings are a result, not a misuse of the command
+	cmd.SilenceUsage = true
+	return tskerrors.New(tskerrors.Validation, "%d lint error(s)", report.Counts[lint.Error])
+}
@@ -0,0 +1,321 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/auth"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/lineedit"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/spf13/cobra"
+)
+
+// authOptions reads the [auth] section of the configuration of dir
+func authOptions(dir string) (auth.Options, error) {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if errors.Is(err, peanut.ErrNotFound) {
+		return auth.OptionsFrom(nil)
+	}
+	if err != nil {
+		return auth.Options{}, err
+	}
+	values, err := cfg.Execute(peanut.NewVM())
+	if err != nil {
+		return auth.Options{}, err
+	}
+	return auth.OptionsFrom(values)
+}
+
+// addLoginCommands adds login, logout, whoami and token to the security
+// commands
+func (c *CLI) addLoginCommands(securityCmd *cobra.Command) {
+	var dir, method string
+	var device, passwordStdin bool
+	loginCmd := &cobra.Command{
+		Use:   "login [username]",
+		Short: "Log in with the OIDC provider or LDAP directory of [auth]",
+		Long: `Log in with a method of the [auth] section and keep the session in
+~/.tsk/session.json ($TSK_SESSION_FILE), which access.policy.tsk checks
+commands against.
+
+  oidc   opens the provider's login page in a browser; --device prints a
+         code to enter on another device instead, for terminals without one
+  ldap   binds to the directory as <username> with a password
+  token  checks a static token of [auth.tokens]
+
+Without --method, oidc is used if it is configured, then ldap. OIDC sessions
+are refreshed when they expire; LDAP and token sessions last session_ttl.`,
+		Example: `  tsk security login
+  tsk security login --device
+  tsk security login ada --method ldap
+  echo "$TSK_TOKEN" | tsk security login ci --method token --password-stdin`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			username := ""
+			if len(args) > 0 {
+				username = args[0]
+			}
+			cmd.SilenceUsage = true
+			return c.handleSecurityLogin(dir, method, username, device, passwordStdin)
+		},
+	}
+	loginCmd.Flags().StringVar(&dir, "dir", ".", "Directory whose configuration has the [auth] section")
+	loginCmd.Flags().StringVar(&method, "method", "", "Login method: oidc, ldap or token")
+	loginCmd.Flags().BoolVar(&device, "device", false, "Use the OIDC device flow instead of a browser")
+	loginCmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "Read the password or token from stdin")
+	securityCmd.AddCommand(loginCmd)
+
+	logoutCmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Delete the session of tsk security login",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleSecurityLogout()
+		},
+	}
+	securityCmd.AddCommand(logoutCmd)
+
+	whoamiCmd := &cobra.Command{
+		Use:   "whoami",
+		Short: "Show the user logged in, refreshing an expired OIDC session",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return c.handleSecurityWhoami(dir)
+		},
+	}
+	whoamiCmd.Flags().StringVar(&dir, "dir", ".", "Directory whose configuration has the [auth] section")
+	securityCmd.AddCommand(whoamiCmd)
+
+	tokenCmd := &cobra.Command{
+		Use:   "token <user>",
+		Short: "Generate a static API token for [auth.tokens]",
+		Long: `Generate a random API token for a user, and the hash to add to the
+[auth.tokens] section, so the configuration never holds the token itself.
+Clients send it as "Authorization: Bearer <token>".`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleSecurityToken(args[0])
+		},
+	}
+	securityCmd.AddCommand(tokenCmd)
+}
+
+// loginMethod picks the method of tsk security login
+func loginMethod(opts auth.Options, method string) (string, error) {
+	if !opts.Configured() {
+		return "", tskerrors.New(tskerrors.Validation, "no login method is configured: add an [auth] section")
+	}
+	if method == "" {
+		for _, m := range []string{auth.OIDCMethod, auth.LDAPMethod, auth.TokenMethod} {
+			if opts.Has(m) {
+				return m, nil
+			}
+		}
+	}
+	if !opts.Has(method) {
+		return "", tskerrors.New(tskerrors.Usage, "login method %q is not configured in [auth] (%s)", method, strings.Join(opts.Methods, ", "))
+	}
+	return method, nil
+}
+
+// readSecret reads a password or token from stdin, or prompts for it
+// without echo
+func (c *CLI) readSecret(prompt string, fromStdin bool) (string, error) {
+	if fromStdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read stdin: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	editor := lineedit.NewEditor(os.Stdin, c.out.Messages())
+	editor.Prompt = prompt
+	return editor.ReadPassword()
+}
+
+// openBrowser opens url in the default browser
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// Security Login Command Handler
+func (c *CLI) handleSecurityLogin(dir, method, username string, device, passwordStdin bool) error {
+	opts, err := authOptions(dir)
+	if err != nil {
+		return tskerrors.Wrap(tskerrors.Validation, err)
+	}
+	if method, err = loginMethod(opts, method); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var session *auth.Session
+
+	switch method {
+	case auth.OIDCMethod:
+		if username != "" {
+			return tskerrors.New(tskerrors.Usage, "OIDC logins take no username: the provider names the user")
+		}
+		provider, err := auth.NewOIDC(opts.OIDC)
+		if err != nil {
+			return tskerrors.Wrap(tskerrors.Validation, err)
+		}
+		var token *auth.Token
+		var id *auth.Identity
+		if device {
+			token, id, err = provider.DeviceLogin(ctx, func(code auth.DeviceCode) {
+				fmt.Fprintf(c.out.Messages(), "🔑 Visit %s and enter the code %s\n", code.VerificationURI, code.UserCode)
+			})
+		} else {
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			defer cancel()
+			token, id, err = provider.BrowserLogin(ctx, func(url string) error {
+				fmt.Fprintf(c.out.Messages(), "🌐 Log in at %s\n", url)
+				if err := openBrowser(url); err != nil {
+					fmt.Fprintln(c.out.Messages(), "   (no browser could be opened: open the URL yourself, or use --device)")
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			return tskerrors.Wrap(tskerrors.Permission, fmt.Errorf("login failed: %w", err))
+		}
+		session = auth.NewSession(id, token, opts.SessionTTL)
+		session.Issuer = opts.OIDC.Issuer
+
+	case auth.LDAPMethod:
+		directory, err := auth.NewLDAP(opts.LDAP)
+		if err != nil {
+			return tskerrors.Wrap(tskerrors.Validation, err)
+		}
+		if username == "" {
+			return tskerrors.New(tskerrors.Usage, "LDAP logins need a username: tsk security login <username> --method ldap")
+		}
+		password, err := c.readSecret("Password: ", passwordStdin)
+		if err != nil {
+			return err
+		}
+		id, err := directory.Bind(ctx, username, password)
+		if err != nil {
+			return tskerrors.Wrap(tskerrors.Permission, fmt.Errorf("login failed: %w", err))
+		}
+		session = auth.NewSession(id, nil, opts.SessionTTL)
+
+	case auth.TokenMethod:
+		tokens, err := auth.NewStaticTokens(opts.Tokens)
+		if err != nil {
+			return tskerrors.Wrap(tskerrors.Validation, err)
+		}
+		token, err := c.readSecret("Token: ", passwordStdin)
+		if err != nil {
+			return err
+		}
+		user, ok := tokens.Lookup(token)
+		if !ok || (username != "" && username != user) {
+			return tskerrors.Wrap(tskerrors.Permission, fmt.Errorf("login failed: %w: unknown token", auth.ErrInvalidCredentials))
+		}
+		session = auth.NewSession(&auth.Identity{User: user, Method: auth.TokenMethod}, nil, opts.SessionTTL)
+	}
+
+	if err := auth.SaveSession(session); err != nil {
+		return err
+	}
+	return c.out.Result(session.Identity, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ Logged in as %s (%s) until %s\n", session.Identity.User, method, session.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	})
+}
+
+// Security Logout Command Handler
+func (c *CLI) handleSecurityLogout() error {
+	session, err := auth.LoadSession()
+	if errors.Is(err, auth.ErrNoSession) {
+		c.out.Println("Not logged in")
+		return nil
+	}
+	if err := auth.DeleteSession(); err != nil {
+		return err
+	}
+	user := "the session"
+	if session != nil {
+		user = session.Identity.User
+	}
+	return c.out.Result(map[string]interface{}{"logged_out": user}, func(w io.Writer) {
+		fmt.Fprintf(w, "👋 Logged out %s\n", user)
+	})
+}
+
+// Security Whoami Command Handler
+func (c *CLI) handleSecurityWhoami(dir string) error {
+	session, err := auth.LoadSession()
+	if errors.Is(err, auth.ErrNoSession) {
+		return tskerrors.Wrap(tskerrors.NotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+	if session.Expired() {
+		if !session.Refreshable() {
+			return tskerrors.New(tskerrors.Permission, "the session of %s expired at %s: run tsk security login", session.Identity.User, session.ExpiresAt.Local().Format("2006-01-02 15:04"))
+		}
+		opts, err := authOptions(dir)
+		if err != nil {
+			return tskerrors.Wrap(tskerrors.Validation, err)
+		}
+		provider, err := auth.NewOIDC(opts.OIDC)
+		if err != nil {
+			return tskerrors.Wrap(tskerrors.Validation, err)
+		}
+		if err := session.Refresh(context.Background(), provider); err != nil {
+			return tskerrors.Wrap(tskerrors.Permission, err)
+		}
+		if err := auth.SaveSession(session); err != nil {
+			return err
+		}
+	}
+
+	id := session.Identity
+	return c.out.Result(session, func(w io.Writer) {
+		fmt.Fprintf(w, "👤 %s (%s)\n", id.User, id.Method)
+		switch {
+		case id.Name != "" && id.Email != "":
+			fmt.Fprintf(w, "   %s <%s>\n", id.Name, id.Email)
+		case id.Name != "" || id.Email != "":
+			fmt.Fprintf(w, "   %s\n", id.Name+id.Email)
+		}
+		if len(id.Groups) > 0 {
+			fmt.Fprintf(w, "   groups: %s\n", strings.Join(id.Groups, ", "))
+		}
+		fmt.Fprintf(w, "   until %s\n", session.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	})
+}
+
+// Security Token Command Handler
+func (c *CLI) handleSecurityToken(user string) error {
+	token, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+	hash := auth.HashToken(token)
+	data := map[string]string{"user": user, "token": token, "hash": hash}
+	return c.out.Result(data, func(w io.Writer) {
+		fmt.Fprintf(w, "🔑 Token for %s (shown once):\n\n  %s\n\n", user, token)
+		fmt.Fprintf(w, "Add its hash to the configuration:\n\n  [auth.tokens]\n  %s: \"%s\"\n", user, hash)
+	})
+}
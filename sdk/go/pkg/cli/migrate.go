@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/migrate"
+	"github.com/spf13/cobra"
+)
+
+// Migrate Command
+func (c *CLI) addMigrateCommand() {
+	var dryRun, interactive, force bool
+	var report string
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate [dir]",
+		Short: "Import .env, YAML, JSON and viper configs into TSK files",
+		Long: `Scan a project for existing configuration (.env files, config.yaml,
+settings.json and other viper-style config files) and generate an equivalent
+TSK hierarchy: peanu.tsk at the project root and config.tsk in each
+subdirectory that has configuration.
+
+Keys set to different values by several files in the same directory are
+conflicts. By default the more specific file wins (.env.local over .env);
+use --interactive to choose each value yourself.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleMigrate(dir, dryRun, interactive, force, report)
+		},
+	}
+	migrateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the report and generated files without writing")
+	migrateCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Prompt to resolve each conflict")
+	migrateCmd.Flags().BoolVar(&force, "force", false, "Overwrite existing TSK files")
+	migrateCmd.Flags().StringVar(&report, "report", "", "Write the migration report as JSON to this file")
+
+	c.rootCmd.AddCommand(migrateCmd)
+}
+
+// Migrate Command Handler
+func (c *CLI) handleMigrate(dir string, dryRun, interactive, force bool, report string) error {
+	resolve := migrate.LastWins
+	if interactive {
+		resolve = promptResolver(bufio.NewReader(os.Stdin), c.out.Messages())
+	}
+
+	plan, err := migrate.Scan(dir, resolve)
+	if err != nil {
+		return err
+	}
+	if len(plan.Outputs) == 0 {
+		c.out.Printf("🔍 No configuration files found in %s\n", dir)
+		return nil
+	}
+
+	c.out.Println("📦 Migration plan:")
+	for _, output := range plan.Outputs {
+		c.out.Printf("  %s <- %s\n", output.Path, strings.Join(output.Sources, ", "))
+	}
+
+	if len(plan.Conflicts) > 0 {
+		c.out.Printf("\n⚖️  Conflicts (%d):\n", len(plan.Conflicts))
+		for _, conflict := range plan.Conflicts {
+			chosen := conflict.Candidates[conflict.Chosen]
+			c.out.Printf("  %s: %s = %s (from %s)\n", conflict.Output, conflict.Key,
+				config.FormatValue(chosen.Value), chosen.Source)
+		}
+	}
+
+	if len(plan.Issues) > 0 {
+		c.out.Printf("\n⚠️  Unconvertible constructs (%d):\n", len(plan.Issues))
+		for _, issue := range plan.Issues {
+			c.out.Printf("  %s\n", issue)
+		}
+	}
+
+	result := map[string]interface{}{
+		"outputs":   plan.Outputs,
+		"conflicts": plan.Conflicts,
+		"issues":    plan.Issues,
+	}
+	if report != "" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+		if err := os.WriteFile(report, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+
+	if dryRun {
+		rendered := make(map[string]string, len(plan.Outputs))
+		for _, output := range plan.Outputs {
+			data, err := output.Render()
+			if err != nil {
+				return err
+			}
+			rendered[output.Path] = string(data)
+		}
+		result["rendered"] = rendered
+		return c.out.Result(result, func(w io.Writer) {
+			for _, output := range plan.Outputs {
+				fmt.Fprintf(w, "\n--- %s ---\n%s", output.Path, rendered[output.Path])
+			}
+		})
+	}
+
+	written, err := plan.Write(force)
+	if err != nil {
+		return err
+	}
+	result["written"] = written
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintln(w)
+		for _, path := range written {
+			fmt.Fprintf(w, "✅ Wrote %s\n", path)
+		}
+	})
+}
+
+// promptResolver asks the user to pick a value for each conflict
+func promptResolver(in *bufio.Reader, out io.Writer) migrate.Resolver {
+	return func(conflict *migrate.Conflict) (int, error) {
+		fmt.Fprintf(out, "\n⚖️  %s: %s is set differently by:\n", conflict.Output, conflict.Key)
+		for i, candidate := range conflict.Candidates {
+			fmt.Fprintf(out, "  [%d] %s = %s\n", i+1, candidate.Source, config.FormatValue(candidate.Value))
+		}
+
+		last := len(conflict.Candidates)
+		for {
+			fmt.Fprintf(out, "Keep which value? [1-%d, default %d]: ", last, last)
+			line, err := in.ReadString('\n')
+			line = strings.TrimSpace(line)
+			if line == "" {
+				return last - 1, nil
+			}
+			choice, convErr := strconv.Atoi(line)
+			if convErr == nil && choice >= 1 && choice <= last {
+				return choice - 1, nil
+			}
+			if err != nil {
+				return 0, fmt.Errorf("invalid choice %q", line)
+			}
+			fmt.Fprintf(out, "❌ Enter a number between 1 and %d\n", last)
+		}
+	}
+}
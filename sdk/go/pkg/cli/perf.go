@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/daemon"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/profiling"
+	"github.com/spf13/cobra"
+)
+
+// profilingOptions reads the [observability.profiling] section of dir's
+// hierarchy; a directory without configuration leaves profiling off
+func profilingOptions(dir string) (profiling.Options, error) {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if errors.Is(err, peanut.ErrNotFound) {
+		return profiling.DefaultOptions(), nil
+	}
+	if err != nil {
+		return profiling.DefaultOptions(), err
+	}
+	values, err := cfg.Execute(peanut.NewVM())
+	if err != nil {
+		return profiling.DefaultOptions(), err
+	}
+	return profiling.OptionsFrom(values, dir)
+}
+
+// Perf Commands
+func (c *CLI) addPerfCommands() {
+	perfCmd := &cobra.Command{
+		Use:   "perf",
+		Short: "Performance profiling commands",
+		Long: `Profile the long-running tsk processes: tsk dev server, tsk serve --api,
+tsk web serve and tsk daemon. Each serves the net/http/pprof endpoints, the
+runtime/trace one included, when the hierarchy it starts in enables them:
+
+  [observability.profiling]
+  enabled: true
+  addr: "localhost:6060"      # own listener; unset mounts them on the server
+  token: @env("PROFILING_TOKEN")
+  dir: "profiles"             # continuous CPU and heap profiles
+  interval: "10m"             # taken this often (cpu_duration 10s each)
+  keep: 24                    # newest kept of each kind
+
+The endpoints are under /debug/pprof/, so go tool pprof can read them too.`,
+	}
+
+	// Perf Profile
+	var kind, output, service, url, token string
+	var duration time.Duration
+	var fromDaemon bool
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Capture a CPU, heap or other profile from a running server",
+		Long: `Capture a profile from a running server and write it to --output.
+
+The server is the one running with profiling enabled, --service picks one
+by name (dev, api, web) when several are, --daemon picks tsk daemon and
+--url any endpoints, such as http://host:6060/debug/pprof/. cpu and trace
+sample for --duration; heap, allocs, goroutine, block, mutex and
+threadcreate are snapshots. Read the result with go tool pprof, or go tool
+trace for a trace.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == "" {
+				output = profiling.FileName(kind)
+			}
+			return c.handlePerfProfile(kind, duration, output, service, url, fromDaemon, token)
+		},
+	}
+	profileCmd.Flags().StringVar(&kind, "type", "cpu", "Profile to take ("+strings.Join(profiling.Kinds, ", ")+")")
+	profileCmd.Flags().DurationVar(&duration, "duration", 30*time.Second, "Sampling time of cpu and trace profiles")
+	profileCmd.Flags().StringVarP(&output, "output", "o", "", "File to write (default <type>.pb.gz, trace.out)")
+	profileCmd.Flags().StringVar(&service, "service", "", "Running server to profile (dev, api, web)")
+	profileCmd.Flags().BoolVar(&fromDaemon, "daemon", false, "Profile tsk daemon")
+	profileCmd.Flags().StringVar(&url, "url", "", "Base URL of the profiling endpoints")
+	profileCmd.Flags().StringVar(&token, "token", os.Getenv("TSK_PROFILING_TOKEN"), "Bearer token of the endpoints")
+	perfCmd.AddCommand(profileCmd)
+
+	c.rootCmd.AddCommand(perfCmd)
+}
+
+// profileResult describes a captured profile
+type profileResult struct {
+	Type     string        `json:"type"`
+	Source   string        `json:"source"`
+	Output   string        `json:"output"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration_ns,omitempty"`
+}
+
+// Perf Profile Handler
+func (c *CLI) handlePerfProfile(kind string, duration time.Duration, output, service, url string, fromDaemon bool, token string) error {
+	client := http.DefaultClient
+	source := url
+	switch {
+	case url != "":
+	case fromDaemon:
+		client = daemon.NewClient(daemonSocket()).HTTP()
+		url, source = daemon.URL+profiling.Prefix, "daemon on "+daemonSocket()
+	default:
+		services, err := runningServices()
+		if err != nil {
+			return err
+		}
+		var candidates []runningService
+		for _, s := range services {
+			if s.Profiling != "" && (service == "" || s.Name == service) {
+				candidates = append(candidates, s)
+			}
+		}
+		switch len(candidates) {
+		case 0:
+			return fmt.Errorf("no running server has profiling enabled; set enabled: true under [observability.profiling], or use --url or --daemon")
+		case 1:
+			url = candidates[0].Profiling
+			source = fmt.Sprintf("%s (pid %d, %s)", candidates[0].Name, candidates[0].PID, url)
+		default:
+			names := make([]string, len(candidates))
+			for i, s := range candidates {
+				names[i] = fmt.Sprintf("%s (pid %d)", s.Name, s.PID)
+			}
+			return fmt.Errorf("several servers have profiling enabled, pick one with --service: %s", strings.Join(names, ", "))
+		}
+	}
+
+	sampled := kind == "cpu" || kind == "trace"
+	if sampled {
+		c.out.Printf("🔬 Sampling %s profile of %s for %s\n", kind, source, duration)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), duration+30*time.Second)
+	defer cancel()
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", output, err)
+	}
+	err = profiling.Capture(ctx, client, url, kind, duration, token, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return err
+	}
+
+	result := profileResult{Type: kind, Source: source, Output: output}
+	if sampled {
+		result.Duration = duration
+	}
+	if info, err := os.Stat(output); err == nil {
+		result.Bytes = info.Size()
+	}
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ Wrote %s profile to %s (%d bytes)\n", kind, output, result.Bytes)
+		if kind == "trace" {
+			fmt.Fprintf(w, "  go tool trace %s\n", output)
+		} else {
+			fmt.Fprintf(w, "  go tool pprof -http=: %s\n", output)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/promote"
+	"github.com/spf13/cobra"
+)
+
+// Promote Command
+func (c *CLI) addPromoteCommand() {
+	var dir, user string
+	var approvers []string
+	var dryRun, yes bool
+
+	promoteCmd := &cobra.Command{
+		Use:   "promote <from> <to>",
+		Short: "Promote one environment's configuration to another",
+		Long: `Promote the overlay of one environment to another, for example
+peanu.staging.tsk to peanu.production.tsk:
+
+  1. diff the two overlays
+  2. check the promotion policy (promote.policy.tsk): denied flags such as
+     debug, required approvals, and pinned keys that are never promoted
+  3. snapshot the target overlay to .tsk/snapshots
+  4. write the promoted values to the target
+  5. post the promotion to the policy's notify webhooks
+  6. record it in .tsk/audit.log
+
+The diff and checks are shown and confirmed before anything is written.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handlePromote(dir, args[0], args[1], user, approvers, dryRun, yes)
+		},
+	}
+	promoteCmd.Flags().StringVar(&dir, "dir", ".", "Directory holding the environment overlays")
+	promoteCmd.Flags().StringVar(&user, "user", os.Getenv("USER"), "Promoter recorded in the audit log")
+	promoteCmd.Flags().StringArrayVar(&approvers, "approve", nil, "Approver of this promotion (repeatable)")
+	promoteCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the diff and checks without promoting")
+	promoteCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Promote without asking for confirmation")
+
+	c.rootCmd.AddCommand(promoteCmd)
+}
+
+// Promote Command Handler
+func (c *CLI) handlePromote(dir, from, to, user string, approvers []string, dryRun, yes bool) error {
+	p, err := promote.Plan(dir, from, to, promote.Options{User: user, Approvers: approvers})
+	if err != nil {
+		return err
+	}
+
+	c.out.Printf("📋 %s -> %s (%d change(s))\n", p.Source, p.Target, len(p.Changes))
+	for _, change := range p.Changes {
+		switch change.Kind {
+		case peanut.KeyAdded:
+			c.out.Printf("  + %s = %s\n", change.Key, config.FormatValue(change.New))
+		case peanut.KeyRemoved:
+			c.out.Printf("  - %s = %s\n", change.Key, config.FormatValue(change.Old))
+		default:
+			c.out.Printf("  ~ %s: %s -> %s\n", change.Key, config.FormatValue(change.Old), config.FormatValue(change.New))
+		}
+	}
+	if len(p.Pinned) > 0 {
+		c.out.Printf("📌 Pinned, keeping %s's value: %s\n", to, strings.Join(p.Pinned, ", "))
+	}
+
+	if len(p.Violations) > 0 {
+		c.out.Printf("\n❌ Policy checks failed (%d):\n", len(p.Violations))
+		for _, violation := range p.Violations {
+			c.out.Printf("  %s\n", violation)
+		}
+		return fmt.Errorf("promotion of %s to %s blocked by policy", from, to)
+	}
+	c.out.Println("✅ Policy checks passed")
+
+	// The result: the plan, and its record once applied
+	result := struct {
+		*promote.Promotion
+		Applied bool            `json:"applied"`
+		Record  *promote.Record `json:"record,omitempty"`
+	}{Promotion: p}
+	if len(p.Changes) == 0 {
+		c.out.Printf("%s is already up to date with %s\n", to, from)
+		return c.out.Result(result, nil)
+	}
+	if dryRun {
+		return c.out.Result(result, nil)
+	}
+	if !yes && !confirm(bufio.NewReader(os.Stdin), c.out.Messages(), fmt.Sprintf("Promote %d change(s) to %s?", len(p.Changes), to)) {
+		c.out.Println("Promotion cancelled")
+		return c.out.Result(result, nil)
+	}
+
+	record, notifyErrs, err := p.Apply()
+	if err != nil {
+		return err
+	}
+	result.Applied, result.Record = true, record
+	if record.Snapshot != "" {
+		c.out.Printf("📸 Snapshot: %s\n", record.Snapshot)
+	}
+	c.out.Printf("✅ Promoted %s to %s\n", from, to)
+	for _, err := range notifyErrs {
+		c.out.Printf("⚠️  %v\n", err)
+	}
+	if len(p.Policy.Notify) > len(notifyErrs) {
+		c.out.Printf("📣 Notified %d webhook(s)\n", len(p.Policy.Notify)-len(notifyErrs))
+	}
+	c.out.Printf("📝 Recorded in %s\n", filepath.Join(dir, promote.StateDir, promote.AuditLog))
+	return c.out.Result(result, nil)
+}
+
+// confirm asks a yes/no question, defaulting to no
+func confirm(in *bufio.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+	line, _ := in.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/cyber-boost/tusktsk/pkg/blobstore"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// Config Pull Remote Handler
+func (c *CLI) handleConfigPullRemote(dir, url, dest string) error {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if err != nil {
+		return err
+	}
+	if _, _, err := cfg.Resolve("blobs", peanut.NewVM()); err != nil {
+		return err
+	}
+
+	data, err := blobstore.Default.Fetch(url)
+	if err != nil {
+		return err
+	}
+	if dest == "" {
+		dest = path.Base(url)
+	}
+
+	// Write next to dest, keeping its extension so LoadFile parses it the
+	// same way, and only replace dest once it loads
+	tmp := filepath.Join(filepath.Dir(dest), ".partial-"+filepath.Base(dest))
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dest, err)
+	}
+	defer os.Remove(tmp)
+	switch filepath.Ext(dest) {
+	case ".pnt", ".tskb", ".tsk", ".peanuts":
+		loaded, err := peanut.LoadFile(tmp)
+		if err != nil {
+			return fmt.Errorf("refusing to write %s: %w", dest, err)
+		}
+		loaded.Close()
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dest, err)
+	}
+
+	result := struct {
+		URL   string `json:"url"`
+		Dest  string `json:"dest"`
+		Bytes int    `json:"bytes"`
+	}{url, dest, len(data)}
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "📥 Pulled %s to %s (%d bytes)\n", url, dest, len(data))
+	})
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/cyber-boost/tusktsk/pkg/refactor"
+	"github.com/spf13/cobra"
+)
+
+// Refactor Commands
+func (c *CLI) addRefactorCommands() {
+	refactorCmd := &cobra.Command{
+		Use:   "refactor",
+		Short: "Refactor configuration across a project",
+	}
+
+	var write, alias bool
+	renameCmd := &cobra.Command{
+		Use:   "rename <old> <new> [dir]",
+		Short: "Rename a key and update every reference to it",
+		Long: `Rename a key in every .tsk and .peanuts file under dir (default ".") and
+update what refers to it: $variable references, ${} interpolations,
+@file.tsk.get/set calls to the files that define it, and [path] sections and
+quoted key names in schema.tsk and policy.tsk files.
+
+Only the last segment can change: database.host can become
+database.hostname, and the section database can become db. The changes are
+shown as a diff; --write applies them. --alias keeps the old key defined
+with the same value and a deprecation comment.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 2 {
+				dir = args[2]
+			}
+			return c.handleRefactorRename(args[0], args[1], dir, write, alias)
+		},
+	}
+	renameCmd.Flags().BoolVar(&write, "write", false, "Apply the changes instead of previewing them")
+	renameCmd.Flags().BoolVar(&alias, "alias", false, "Leave the old key behind as a deprecated alias")
+	refactorCmd.AddCommand(renameCmd)
+
+	c.rootCmd.AddCommand(refactorCmd)
+}
+
+// Refactor Rename Handler
+func (c *CLI) handleRefactorRename(old, new, dir string, write, alias bool) error {
+	plan, err := refactor.Rename(dir, old, new, refactor.Options{Alias: alias})
+	if err != nil {
+		return err
+	}
+
+	if write {
+		if _, err := plan.Apply(); err != nil {
+			return err
+		}
+	}
+
+	return c.out.Result(plan, func(w io.Writer) {
+		fmt.Fprintf(w, "🔄 Renaming %s to %s: %d change(s) in %d file(s)\n", plan.Old, plan.New, len(plan.Changes), len(plan.Files))
+		for _, change := range plan.Changes {
+			file := change.File
+			if rel, err := filepath.Rel(dir, change.File); err == nil {
+				file = rel
+			}
+			if change.Kind == refactor.KindAlias {
+				fmt.Fprintf(w, "  %s:%d  %-13s %s kept as a deprecated alias\n", file, change.Line, change.Kind, change.New)
+				continue
+			}
+			fmt.Fprintf(w, "  %s:%d  %-13s %s -> %s\n", file, change.Line, change.Kind, change.Old, change.New)
+		}
+
+		if !write {
+			fmt.Fprintf(w, "\n%s", plan.Diff())
+			fmt.Fprintln(w, "\n📋 Preview only; run again with --write to apply")
+			return
+		}
+
+		fmt.Fprintf(w, "\n✅ Updated %d file(s)\n", len(plan.Files))
+		for _, binary := range plan.Stale {
+			fmt.Fprintf(w, "⚠️  %s was compiled from a changed file; run tsk binary compile again\n", binary)
+		}
+	})
+}
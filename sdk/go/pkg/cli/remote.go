@@ -0,0 +1,278 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/remote"
+	"github.com/spf13/cobra"
+)
+
+// remoteFlags override the [remote] section of the hierarchy
+type remoteFlags struct {
+	env       string
+	backend   string
+	endpoints []string
+	prefix    string
+}
+
+func (f *remoteFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.env, "env", "", "Environment overlay to apply, e.g. production")
+	cmd.Flags().StringVar(&f.backend, "backend", "", "Store: etcd or consul (default: remote.backend)")
+	cmd.Flags().StringArrayVar(&f.endpoints, "endpoint", nil, "Store endpoint (repeatable; default: remote.endpoints)")
+	cmd.Flags().StringVar(&f.prefix, "prefix", "", "Key prefix in the store (default: remote.prefix)")
+}
+
+// Remote Commands
+func (c *CLI) addRemoteCommands() {
+	remoteCmd := &cobra.Command{
+		Use:   "remote",
+		Short: "Keep configuration in etcd or Consul KV",
+		Long: `Push a peanut hierarchy to etcd or Consul KV, one entry per key under a
+prefix, and keep it there in sync. The store is named by the [remote] section
+of the hierarchy, which stays local:
+
+  [remote]
+  backend: "consul"
+  endpoints: ["http://consul:8500"]
+  prefix: "tusk/api"
+
+Applications loading the configuration with remote.Load read the store
+first and fall back to their last copy, then to the local files.`,
+	}
+
+	var push remoteFlags
+	pushCmd := &cobra.Command{
+		Use:   "push [dir]",
+		Short: "Write the configuration to the store",
+		Long: `Resolve the hierarchy of dir (default "."), with the overlay of --env merged
+in, and make the store match it: changed keys are written and keys the
+hierarchy no longer has are deleted. Values are stored raw, so @ operators
+and @secret values are resolved by whoever loads them.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleRemotePush(dir, push)
+		},
+	}
+	push.register(pushCmd)
+	remoteCmd.AddCommand(pushCmd)
+
+	var sync remoteFlags
+	syncCmd := &cobra.Command{
+		Use:   "sync [dir]",
+		Short: "Push the configuration now and whenever its files change",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleRemoteSync(dir, sync)
+		},
+	}
+	sync.register(syncCmd)
+	remoteCmd.AddCommand(syncCmd)
+
+	var output string
+	pullCmd := &cobra.Command{
+		Use:   "pull [dir]",
+		Short: "Load the configuration as an application would",
+		Long: `Load the configuration of dir (default ".") the way remote.Load does: from
+the store its [remote] section names, else from the copy kept in
+` + remote.CacheFile + `, else from the local files. Prints where it came
+from and its keys; -o writes it as a .pnt binary.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleRemotePull(dir, output)
+		},
+	}
+	pullCmd.Flags().StringVarP(&output, "output", "o", "", "Binary file to write")
+	remoteCmd.AddCommand(pullCmd)
+
+	c.rootCmd.AddCommand(remoteCmd)
+}
+
+// remoteTarget resolves the hierarchy of dir and the store to push it to
+func remoteTarget(dir string, flags remoteFlags) (map[string]interface{}, remote.Store, string, error) {
+	h, err := resolveEnvironment(dir, flags.env)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	values, err := h.Config.Values()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	store, prefix, err := openRemote(values, flags)
+	return values, store, prefix, err
+}
+
+// openRemote opens the store the [remote] section of values names, as
+// overridden by flags
+func openRemote(values map[string]interface{}, flags remoteFlags) (remote.Store, string, error) {
+	opts, err := remote.OptionsFrom(values)
+	if err != nil {
+		return nil, "", err
+	}
+	if flags.backend != "" {
+		opts.Backend = flags.backend
+	}
+	if len(flags.endpoints) > 0 {
+		opts.Endpoints = flags.endpoints
+	}
+	if flags.prefix != "" {
+		opts.Prefix = flags.prefix
+	}
+	if opts.Prefix == "" {
+		return nil, "", fmt.Errorf("no key prefix: set %s.prefix or pass --prefix", remote.Section)
+	}
+	store, err := remote.Open(opts)
+	return store, opts.Prefix, err
+}
+
+// Remote Push Handler
+func (c *CLI) handleRemotePush(dir string, flags remoteFlags) error {
+	values, store, prefix, err := remoteTarget(dir, flags)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	report, err := remote.Push(ctx, store, prefix, values)
+	if err != nil {
+		return err
+	}
+	return c.out.Result(report, func(w io.Writer) { printPushReport(w, report) })
+}
+
+// printPushReport prints what a push changed
+func printPushReport(w io.Writer, report *remote.PushReport) {
+	fmt.Fprintf(w, "✅ Pushed to %s: %d written, %d deleted, %d unchanged\n", report.Prefix, len(report.Put), len(report.Deleted), report.Unchanged)
+	for _, key := range report.Put {
+		fmt.Fprintf(w, "  ~ %s\n", key)
+	}
+	for _, key := range report.Deleted {
+		fmt.Fprintf(w, "  - %s\n", key)
+	}
+}
+
+// remoteSyncEvent is the data of each line of `tsk remote sync --json`
+type remoteSyncEvent struct {
+	Time  time.Time          `json:"time"`
+	Push  *remote.PushReport `json:"push,omitempty"`
+	Error string             `json:"error,omitempty"`
+}
+
+// Remote Sync Handler
+func (c *CLI) handleRemoteSync(dir string, flags remoteFlags) error {
+	_, store, prefix, err := remoteTarget(dir, flags)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c.out.Printf("👀 Syncing %s to %s (Ctrl+C to stop)\n", dir, prefix)
+	load := func() (map[string]interface{}, error) {
+		h, err := resolveEnvironment(dir, flags.env)
+		if err != nil {
+			return nil, err
+		}
+		return h.Config.Values()
+	}
+	return remote.Sync(ctx, dir, store, prefix, load, func(report *remote.PushReport, err error) {
+		event := remoteSyncEvent{Time: time.Now(), Push: report}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		c.out.Stream(event, func(w io.Writer) {
+			stamp := event.Time.Format("15:04:05")
+			if err != nil {
+				fmt.Fprintf(w, "[%s] ⚠️  %v\n", stamp, err)
+				return
+			}
+			// Reloads that changed nothing in the store are not news
+			if len(report.Put) == 0 && len(report.Deleted) == 0 {
+				return
+			}
+			fmt.Fprintf(w, "[%s] ", stamp)
+			printPushReport(w, report)
+		})
+	})
+}
+
+// Remote Pull Handler
+func (c *CLI) handleRemotePull(dir, output string) error {
+	loaded, err := remote.Load(context.Background(), dir)
+	if err != nil {
+		return err
+	}
+	defer loaded.Config.Close()
+	values, err := loaded.Config.Values()
+	if err != nil {
+		return err
+	}
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		err = loaded.Config.WriteBinary(f, peanut.DefaultWriteOptions)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", output, err)
+		}
+	}
+
+	result := struct {
+		Origin remote.Origin          `json:"origin"`
+		Error  string                 `json:"error,omitempty"`
+		Values map[string]interface{} `json:"values"`
+		Output string                 `json:"output,omitempty"`
+	}{Origin: loaded.Origin, Values: values, Output: output}
+	if loaded.Err != nil {
+		result.Error = loaded.Err.Error()
+	}
+	return c.out.Result(result, func(w io.Writer) {
+		switch loaded.Origin {
+		case remote.FromRemote:
+			fmt.Fprintf(w, "✅ Loaded %d key(s) from the store\n", len(values))
+		case remote.FromCache:
+			fmt.Fprintf(w, "⚠️  Store unavailable (%v); loaded %d key(s) from %s\n", loaded.Err, len(values), remote.CacheFile)
+		default:
+			if loaded.Err != nil {
+				fmt.Fprintf(w, "⚠️  Store unavailable (%v); loaded %d key(s) from the local files\n", loaded.Err, len(values))
+			} else {
+				fmt.Fprintf(w, "📄 No %s.backend; loaded %d key(s) from the local files\n", remote.Section, len(values))
+			}
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "  %s = %s\n", key, config.FormatValue(values[key]))
+		}
+		if output != "" {
+			fmt.Fprintf(w, "✅ Wrote %s\n", output)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/render"
+	"github.com/spf13/cobra"
+)
+
+// Render Command
+func (c *CLI) addRenderCommand() {
+	var dir, env, output, syntax string
+	var strict bool
+
+	renderCmd := &cobra.Command{
+		Use:   "render <template>",
+		Short: "Render a template with the configuration as data",
+		Long: `Render a Go text/template with the resolved configuration of --config (the
+peanut hierarchy of a directory, default ".") as its data: operators are
+evaluated, and sections nest, so {{ .database.host }} prints database.host.
+--env applies the peanu.<env>.tsk overlay of that directory first.
+
+Templates ending in .j2, .jinja or .jinja2 use a Jinja-like syntax instead
+({{ database.host }}, {% if %}, {% for %}, filters); --syntax overrides the
+guess. Helpers: indent, nindent, quote, squote, b64enc, b64dec, toJSON,
+toYAML, default, required, upper, lower, trim, replace, join, get "a.b",
+eval ` + "`@env(\"HOME\")`" + ` and op "env" "HOME".
+
+  tsk render deploy.yaml.tmpl --config services/api -o deploy.yaml
+  tsk render nginx.conf.j2 --env production --strict`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleRender(args[0], dir, env, output, syntax, strict)
+		},
+	}
+	renderCmd.Flags().StringVar(&dir, "config", ".", "Directory whose hierarchy is the data")
+	renderCmd.Flags().StringVar(&env, "env", "", "Environment overlay to apply, e.g. production")
+	renderCmd.Flags().StringVarP(&output, "output", "o", "", "File to write instead of stdout")
+	renderCmd.Flags().StringVar(&syntax, "syntax", "", "Template syntax: go or jinja (default: by extension)")
+	renderCmd.Flags().BoolVar(&strict, "strict", false, "Fail on keys the configuration does not have")
+
+	c.rootCmd.AddCommand(renderCmd)
+}
+
+// Render Handler
+func (c *CLI) handleRender(file, dir, env, output, syntaxName string, strict bool) error {
+	opts := render.Options{Syntax: render.SyntaxFor(file), Strict: strict}
+	if syntaxName != "" {
+		syntax, err := render.ParseSyntax(syntaxName)
+		if err != nil {
+			return err
+		}
+		opts.Syntax = syntax
+	}
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read template: %w", err)
+	}
+
+	from := dir
+	if env != "" {
+		from = "env:" + env
+	}
+	values, err := loadConfigSource(dir, from)
+	if err != nil {
+		return err
+	}
+	r, err := render.New(peanut.FromValues(values), peanut.NewVM())
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := r.Render(&buf, file, string(source), opts); err != nil {
+		return err
+	}
+
+	result := struct {
+		Template string `json:"template"`
+		Output   string `json:"output,omitempty"`
+		Bytes    int    `json:"bytes"`
+		Content  string `json:"content,omitempty"`
+	}{Template: file, Output: output, Bytes: buf.Len()}
+	if output == "" {
+		result.Content = buf.String()
+		return c.out.Result(result, func(w io.Writer) {
+			w.Write(buf.Bytes())
+		})
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+	return c.out.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ Rendered %s to %s (%d bytes)\n", file, output, buf.Len())
+	})
+}
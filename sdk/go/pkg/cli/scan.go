@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/secretscan"
+	"github.com/spf13/cobra"
+)
+
+// scanIcons mark the findings of tsk security scan
+var scanIcons = map[secretscan.Severity]string{
+	secretscan.Critical: "🚨",
+	secretscan.High:     "❌",
+	secretscan.Medium:   "⚠️ ",
+	secretscan.Low:      "💡",
+}
+
+// Security Scan Command
+func (c *CLI) addScanCommand(securityCmd *cobra.Command) {
+	var format, output, allowlist, minSeverity, failOn string
+	scanCmd := &cobra.Command{
+		Use:   "scan [path]",
+		Short: "Scan files for committed secrets",
+		Long: `Scan .tsk, source and configuration files for credentials: AWS keys,
+private keys, GitHub, Slack, Stripe, Google and tsk tokens, JWTs, passwords
+in URLs or assigned literal values, and high-entropy strings. Values read through
+@env or @secret are not reported, and secrets are redacted in the output.
+
+Findings the team accepts go into .tsk-scan-allow at the root of the scan,
+one per line: a fingerprint, rule:<id>, path:<glob> or regex:<pattern>.
+A line containing "tsk-scan:allow" is not reported either.
+
+The command exits with the validation error code (3) when a finding is at
+least as serious as --fail-on, for CI. --format sarif prints SARIF 2.1.0
+for code scanning services.`,
+		Example: `  tsk security scan
+  tsk security scan config/ --fail-on high
+  tsk security scan --format sarif -o tsk-secrets.sarif
+  tsk security scan --json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "."
+			if len(args) > 0 {
+				path = args[0]
+			}
+			return c.handleSecurityScan(cmd, path, format, output, allowlist, minSeverity, failOn)
+		},
+	}
+	scanCmd.Flags().StringVarP(&format, "format", "f", "text", "Output format (text, sarif; json is the same as --json)")
+	scanCmd.Flags().StringVarP(&output, "output", "o", "", "Write the SARIF report to a file instead of stdout")
+	scanCmd.Flags().StringVar(&allowlist, "allowlist", "", "Allowlist file (default: .tsk-scan-allow in the scanned directory)")
+	scanCmd.Flags().StringVar(&minSeverity, "min-severity", "low", "Report findings at least this serious: critical, high, medium or low")
+	scanCmd.Flags().StringVar(&failOn, "fail-on", "low", "Exit nonzero for findings at least this serious, or none")
+	securityCmd.AddCommand(scanCmd)
+}
+
+// Security Scan Command Handler
+func (c *CLI) handleSecurityScan(cmd *cobra.Command, path, format, output, allowlist, minSeverity, failOn string) error {
+	if format != "text" && format != "sarif" {
+		return tskerrors.New(tskerrors.Usage, "unknown format %q (text or sarif)", format)
+	}
+	if output != "" && format != "sarif" {
+		return tskerrors.New(tskerrors.Usage, "--output writes SARIF: add --format sarif")
+	}
+	min, err := secretscan.ParseSeverity(minSeverity)
+	if err != nil {
+		return tskerrors.Wrap(tskerrors.Usage, err)
+	}
+	var fail secretscan.Severity
+	if failOn != "none" {
+		if fail, err = secretscan.ParseSeverity(failOn); err != nil {
+			return tskerrors.Wrap(tskerrors.Usage, err)
+		}
+	}
+
+	report, err := secretscan.Scan(path, secretscan.Options{Allowlist: allowlist, MinSeverity: min})
+	if os.IsNotExist(err) {
+		return tskerrors.Wrap(tskerrors.NotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	var text func(w io.Writer)
+	switch {
+	case format == "sarif" && output != "":
+		data, err := json.MarshalIndent(report.SARIF(), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(output, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", output, err)
+		}
+		text = func(w io.Writer) {
+			fmt.Fprintf(w, "📄 Wrote %d finding(s) in %d file(s) to %s\n", len(report.Findings), report.Files, output)
+		}
+	case format == "sarif":
+		text = func(w io.Writer) {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(report.SARIF())
+		}
+	default:
+		text = func(w io.Writer) {
+			if len(report.Findings) == 0 {
+				fmt.Fprintf(w, "✅ No secrets in %d file(s)\n", report.Files)
+			}
+			for _, f := range report.Findings {
+				fmt.Fprintf(w, "%s %s:%d:%d %s %s [%s]\n", scanIcons[f.Severity], f.File, f.Line, f.Column, f.Message, f.Secret, f.Rule)
+				fmt.Fprintf(w, "     fingerprint %s\n", f.Fingerprint)
+			}
+			if len(report.Findings) > 0 {
+				fmt.Fprintf(w, "\n%d critical, %d high, %d medium, %d low in %d file(s)\n",
+					report.Counts[secretscan.Critical], report.Counts[secretscan.High],
+					report.Counts[secretscan.Medium], report.Counts[secretscan.Low], report.Files)
+			}
+			if report.Suppressed > 0 {
+				fmt.Fprintf(w, "🙈 %d allowed finding(s) not shown\n", report.Suppressed)
+			}
+		}
+	}
+	if err := c.out.Result(report, text); err != nil || fail == "" {
+		return err
+	}
+	if n := report.Failing(fail); n > 0 {
+		// Findings are a result, not a misuse of the command
+		cmd.SilenceUsage = true
+		return tskerrors.New(tskerrors.Validation, "%d secret(s) found at %s severity or above", n, fail)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+// Schema Commands
+func (c *CLI) addSchemaCommands() {
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Schema management commands",
+		Long:  "Commands for validating configuration and converting schemas to and from JSON Schema",
+	}
+
+	// Schema Export
+	var exportOutput string
+	exportCmd := &cobra.Command{
+		Use:   "export [schema.tsk]",
+		Short: "Export a TSK schema as JSON Schema",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleSchemaExport(args[0], exportOutput)
+		},
+	}
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Output file (defaults to stdout)")
+	schemaCmd.AddCommand(exportCmd)
+
+	// Schema Import
+	var importOutput string
+	importCmd := &cobra.Command{
+		Use:   "import [schema.json]",
+		Short: "Import a JSON Schema as a TSK schema",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleSchemaImport(args[0], importOutput)
+		},
+	}
+	importCmd.Flags().StringVarP(&importOutput, "output", "o", "", "Output file (defaults to stdout)")
+	schemaCmd.AddCommand(importCmd)
+
+	// Schema Validate
+	validateCmd := &cobra.Command{
+		Use:   "validate [schema.tsk] [config.tsk]",
+		Short: "Validate a configuration file against a schema",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleSchemaValidate(args[0], args[1])
+		},
+	}
+	schemaCmd.AddCommand(validateCmd)
+
+	c.rootCmd.AddCommand(schemaCmd)
+}
+
+// Schema Command Handlers
+func (c *CLI) handleSchemaExport(file, output string) error {
+	s, err := schema.LoadFile(file)
+	if err != nil {
+		return err
+	}
+
+	data, err := s.MarshalJSONSchema()
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON Schema: %w", err)
+	}
+
+	return writeOutput(output, append(data, '\n'))
+}
+
+func (c *CLI) handleSchemaImport(file, output string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read JSON Schema: %w", err)
+	}
+
+	s, warnings, err := schema.ImportJSONSchema(data)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n", warning)
+	}
+
+	return writeOutput(output, s.ToTSK())
+}
+
+func (c *CLI) handleSchemaValidate(schemaFile, configFile string) error {
+	s, err := schema.LoadFile(schemaFile)
+	if err != nil {
+		return err
+	}
+
+	cfg := config.New()
+	if err := cfg.LoadFromFile(configFile); err != nil {
+		return err
+	}
+
+	errors := s.Validate(cfg)
+	if len(errors) == 0 {
+		return c.out.Result(map[string]interface{}{"file": configFile, "valid": true}, func(w io.Writer) {
+			fmt.Fprintf(w, "✅ %s is valid\n", configFile)
+		})
+	}
+
+	for _, e := range errors {
+		c.out.Printf("❌ %s\n", e.Error())
+	}
+	return tskerrors.New(tskerrors.Validation, "%d schema violation(s) in %s", len(errors), configFile)
+}
+
+// writeOutput writes data to the named file, or to stdout when file is empty
+func writeOutput(file string, data []byte) error {
+	if file == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	fmt.Fprintf(os.Stderr, "✅ Wrote %s\n", file)
+	return nil
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/security"
+)
+
+// Config Encrypt Value Handler
+func (c *CLI) handleEncryptValue(args []string, keyFile string) error {
+	key, err := secretKey(keyFile)
+	if err != nil {
+		return err
+	}
+	value, err := argOrStdin(args)
+	if err != nil {
+		return err
+	}
+	secret, err := security.EncryptSecret(value, key)
+	if err != nil {
+		return err
+	}
+	return c.out.Result(secret, func(w io.Writer) { fmt.Fprintln(w, secret) })
+}
+
+// Config Decrypt Value Handler
+func (c *CLI) handleDecryptValue(args []string, keyFile string) error {
+	key, err := secretKey(keyFile)
+	if err != nil {
+		return err
+	}
+	value, err := argOrStdin(args)
+	if err != nil {
+		return err
+	}
+	plaintext, err := security.DecryptSecret(value, key)
+	if err != nil {
+		return err
+	}
+	return c.out.Result(plaintext, func(w io.Writer) { fmt.Fprintln(w, plaintext) })
+}
+
+// secretKey loads the key from keyFile, or from the environment when empty
+func secretKey(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		return security.SecretKey()
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret key: %w", err)
+	}
+	key, err := security.ParseSecretKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyFile, err)
+	}
+	return key, nil
+}
+
+// argOrStdin returns the single argument, or stdin without its trailing newline
+func argOrStdin(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/license"
+	"github.com/cyber-boost/tusktsk/pkg/auth"
+	"github.com/cyber-boost/tusktsk/pkg/configapi"
+	"github.com/cyber-boost/tusktsk/pkg/enterprise"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Serve Command
+func (c *CLI) addServeCommand() {
+	var dir, addr, token string
+	var api bool
+	var poll time.Duration
+
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the configuration of a directory over HTTP",
+		Long: `Serve the peanut hierarchy of --dir. With --api, other services read it
+through a REST API:
+
+  GET    /v1/config          the evaluated configuration
+  GET    /v1/config/{key}    one value or subtree, such as database.host
+  PUT    /v1/config/{key}    override a value with a JSON body
+  DELETE /v1/config/{key}    drop an override
+  GET    /v1/hierarchy       the files merged and where each key comes from
+  GET    /v1/watch           WebSocket of changes as JSON patches
+  GET    /v1/openapi.json    the OpenAPI description
+
+/v1/watch?prefix=database&resume=<token> sends a snapshot of the keys under
+the prefixes, then a JSON patch per change and heartbeats when idle. Every
+message carries a resume token; reconnecting with it replays what was
+missed. --poll re-evaluates the configuration periodically so changes of
+remote sources such as @http reach watchers too; tsk services reload api
+(or SIGHUP) re-reads and re-evaluates it once.
+
+Overrides are kept in memory until the server stops. With --token (or
+TSK_API_TOKEN), PUT and DELETE need "Authorization: Bearer <token>". With an
+access.policy.tsk in --dir, each route also needs a permission (config:read
+to read, config:write to write, or as its [routes] section says) held by
+the caller, and answers 403 otherwise. Without [auth], the policy needs
+--token: requests bearing it act as the user named in the X-Tsk-User
+header, and the header of any other request is ignored.
+
+With an [auth] section, every request authenticates instead, with a static
+token or an OIDC JWT as a bearer token, or LDAP credentials with basic
+authentication, and answers 401 otherwise; the policy then checks the
+authenticated user, and --token is not used.
+Without --api, this runs the development server (tsk dev server).`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !api {
+				return c.handleDevServer(dir, addr, true)
+			}
+			return c.handleServeAPI(dir, addr, configapi.Options{Token: token, Poll: poll})
+		},
+	}
+	serveCmd.Flags().StringVar(&dir, "dir", ".", "Directory whose hierarchy is served")
+	serveCmd.Flags().StringVar(&addr, "addr", "localhost:8080", "Address to listen on")
+	serveCmd.Flags().BoolVar(&api, "api", false, "Serve the REST configuration API")
+	serveCmd.Flags().StringVar(&token, "token", os.Getenv("TSK_API_TOKEN"), "Bearer token required for writes")
+	serveCmd.Flags().DurationVar(&poll, "poll", 0, "Re-evaluate the configuration this often for /v1/watch (0 disables)")
+
+	c.rootCmd.AddCommand(serveCmd)
+}
+
+// Serve API Handler
+func (c *CLI) handleServeAPI(dir, addr string, opts configapi.Options) error {
+	policy, err := enterprise.FindAccessPolicy(dir)
+	if err != nil {
+		return err
+	}
+	if policy != nil {
+		if err := license.DefaultRegistry.Require(license.CapabilityRBAC); err != nil {
+			return err
+		}
+		opts.Authorize = policy.AuthorizeRequest
+	}
+	authOpts, err := authOptions(dir)
+	if err != nil {
+		return tskerrors.Wrap(tskerrors.Validation, err)
+	}
+	var authenticator auth.Authenticator
+	switch {
+	case authOpts.Configured():
+		if authenticator, err = auth.New(authOpts); err != nil {
+			return tskerrors.Wrap(tskerrors.Validation, err)
+		}
+		// The bearer token is the user's now
+		opts.Token = ""
+	case policy != nil && opts.Token == "":
+		return tskerrors.New(tskerrors.Usage, "%s checks the user of each request: set --token (or TSK_API_TOKEN), or an [auth] section", policy.File)
+	case policy != nil:
+		// Holders of the token vouch for the user they name
+		authenticator = enterprise.UserTokenAuthenticator{Token: opts.Token}
+	}
+	api, err := configapi.NewServer(dir, opts)
+	if err != nil {
+		return err
+	}
+	defer api.Close()
+
+	var handler http.Handler = api
+	if authenticator != nil {
+		// Without [auth], requests lacking the token go on unauthenticated,
+		// to the routes the policy leaves open
+		handler = auth.Middleware(authenticator, !authOpts.Configured(), api)
+	}
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	c.out.Printf("🌐 Configuration API on %s (Ctrl+C to stop)\n", addr)
+	for _, file := range api.Files() {
+		c.out.Printf("  %s\n", file)
+	}
+	switch {
+	case authOpts.Configured():
+		c.out.Printf("🔑 Requests authenticate with %s of [auth]\n", strings.Join(authOpts.Methods, ", "))
+	case opts.Token == "":
+		c.out.Println("⚠️  No --token set: anyone who can reach the server can change values")
+	}
+	switch {
+	case policy != nil && authOpts.Configured():
+		c.out.Printf("🔐 Routes check the permissions of the authenticated user in %s\n", policy.File)
+	case policy != nil:
+		c.out.Printf("🔐 Routes check the permissions of the X-Tsk-User user of token holders in %s\n", policy.File)
+	}
+	return lifecycle{
+		Name:   "api",
+		Dir:    dir,
+		Server: server,
+		Drain:  5 * time.Second,
+		Reload: api.Reload,
+		Out:    c.out,
+	}.run()
+}
@@ -0,0 +1,278 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/cliio"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/supervisor"
+)
+
+// loadServices reads the [services] of dir's hierarchy and the run
+// directory of its supervisor, one per project under servicesDir
+func loadServices(dir string) ([]supervisor.Spec, string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, _, err := peanut.LoadHierarchy(abs)
+	if err != nil {
+		return nil, "", err
+	}
+	values, err := cfg.Execute(peanut.NewVM())
+	cfg.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	specs, err := supervisor.SpecsFrom(values, abs)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return specs, filepath.Join(servicesDir(), "supervisor-"+hex.EncodeToString(sum[:6])), nil
+}
+
+// checkServiceNames fails for names [services] does not declare
+func checkServiceNames(specs []supervisor.Spec, names []string) error {
+	if len(specs) == 0 {
+		return fmt.Errorf("no services declared: add a [services] section, such as api.command: [\"./bin/api\"]")
+	}
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = true
+	}
+	for _, name := range names {
+		if !declared[name] {
+			return fmt.Errorf("%w %s: it is not declared in [services]", supervisor.ErrUnknownService, name)
+		}
+	}
+	return nil
+}
+
+// Services Start Handler
+func (c *CLI) handleServicesStart(dir string, names []string, foreground bool) error {
+	specs, runDir, err := loadServices(dir)
+	if err != nil {
+		return err
+	}
+	if err := checkServiceNames(specs, names); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	client := supervisor.NewClient(runDir)
+	if _, err := client.Status(ctx); err == nil {
+		// The supervisor keeps the [services] it started with
+		if len(names) == 0 {
+			for _, spec := range specs {
+				names = append(names, spec.Name)
+			}
+		}
+		var statuses []supervisor.Status
+		for _, name := range names {
+			status, err := client.Start(ctx, name)
+			if err != nil {
+				return fmt.Errorf("failed to start %s: %w", name, err)
+			}
+			c.out.Printf("▶️  %s %s (pid %d)\n", status.Name, status.State, status.PID)
+			statuses = append(statuses, status)
+		}
+		return c.out.Result(statuses, nil)
+	}
+
+	if foreground {
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		c.out.Printf("🚀 Supervising %d service(s), logs in %s (Ctrl+C to stop)\n", len(specs), runDir)
+		return supervisor.New(specs, runDir).Serve(ctx, names...)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the tsk executable: %w", err)
+	}
+	if err := os.MkdirAll(runDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", runDir, err)
+	}
+	logPath := filepath.Join(runDir, "supervisor.log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", logPath, err)
+	}
+	defer logFile.Close()
+	cmd := exec.Command(exe, append([]string{"services", "supervise", "--dir", dir}, names...)...)
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	supervisor.Detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the supervisor: %w", err)
+	}
+	cmd.Process.Release()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		statuses, err := client.Status(ctx)
+		if err == nil {
+			c.out.Printf("🚀 Supervisor started (logs in %s)\n", runDir)
+			return c.out.Result(statuses, func(w io.Writer) { serviceTable(statuses).Render(w) })
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the supervisor did not come up; see %s", logPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Services Supervise Handler runs the supervisor of a detached start
+func (c *CLI) handleServicesSupervise(dir string, names []string) error {
+	specs, runDir, err := loadServices(dir)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return supervisor.New(specs, runDir).Serve(ctx, names...)
+}
+
+// Services Stop Handler
+func (c *CLI) handleServicesStop(dir, name string) error {
+	_, runDir, err := loadServices(dir)
+	if err != nil {
+		return err
+	}
+	client := supervisor.NewClient(runDir)
+	if name == "" {
+		statuses, err := client.Shutdown(context.Background())
+		if err != nil {
+			return err
+		}
+		return c.out.Result(statuses, func(w io.Writer) {
+			serviceTable(statuses).Render(w)
+			fmt.Fprintln(w, "⏹️  Supervisor stopped")
+		})
+	}
+	status, err := client.Stop(context.Background(), name)
+	if err != nil {
+		return err
+	}
+	return c.out.Result([]supervisor.Status{status}, func(w io.Writer) {
+		fmt.Fprintf(w, "⏹️  %s %s (%s)\n", status.Name, status.State, status.LastExit)
+	})
+}
+
+// Services Restart Handler
+func (c *CLI) handleServicesRestart(dir, name string) error {
+	_, runDir, err := loadServices(dir)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	client := supervisor.NewClient(runDir)
+	names := []string{name}
+	if name == "" {
+		statuses, err := client.Status(ctx)
+		if err != nil {
+			return err
+		}
+		names = names[:0]
+		for _, status := range statuses {
+			if status.State != supervisor.StateStopped {
+				names = append(names, status.Name)
+			}
+		}
+	}
+	var statuses []supervisor.Status
+	for _, name := range names {
+		status, err := client.Restart(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to restart %s: %w", name, err)
+		}
+		c.out.Printf("🔁 %s %s (pid %d)\n", status.Name, status.State, status.PID)
+		statuses = append(statuses, status)
+	}
+	return c.out.Result(statuses, nil)
+}
+
+// Services Status Handler
+func (c *CLI) handleServicesStatus(dir, name string) error {
+	specs, runDir, err := loadServices(dir)
+	if err != nil {
+		return err
+	}
+	statuses, err := supervisor.NewClient(runDir).Status(context.Background())
+	if errors.Is(err, supervisor.ErrNotRunning) {
+		statuses = nil
+		for _, spec := range specs {
+			statuses = append(statuses, supervisor.Status{Name: spec.Name, State: supervisor.StateStopped})
+		}
+		if len(specs) > 0 {
+			c.out.Println("⏹️  Supervisor not running; start it with tsk services start")
+		}
+	} else if err != nil {
+		return err
+	}
+	if name != "" {
+		var matched []supervisor.Status
+		for _, status := range statuses {
+			if status.Name == name {
+				matched = append(matched, status)
+			}
+		}
+		if len(matched) == 0 {
+			return fmt.Errorf("%w %s", supervisor.ErrUnknownService, name)
+		}
+		statuses = matched
+	}
+	// The servers of tsk dev server, serve --api and web serve
+	var servers []runningService
+	if name == "" {
+		if servers, err = runningServices(); err != nil {
+			return err
+		}
+	}
+	result := struct {
+		Services []supervisor.Status `json:"services"`
+		Servers  []runningService    `json:"servers"`
+	}{statuses, servers}
+	return c.out.Result(result, func(w io.Writer) {
+		if len(statuses) > 0 {
+			serviceTable(statuses).Render(w)
+		}
+		if len(servers) > 0 {
+			fmt.Fprintln(w, "\nServers:")
+			table := cliio.NewTable("NAME", "ADDRESS", "PID", "UPTIME", "DIR")
+			for _, s := range servers {
+				table.AddRow(s.Name, s.Addr, s.PID, time.Since(s.Started).Round(time.Second), s.Dir)
+			}
+			table.Render(w)
+		}
+		if len(statuses) == 0 && len(servers) == 0 {
+			fmt.Fprintln(w, "No services declared in [services] and no servers running")
+		}
+	})
+}
+
+// serviceTable lays out services for text output
+func serviceTable(statuses []supervisor.Status) *cliio.Table {
+	table := cliio.NewTable("NAME", "STATE", "PID", "UPTIME", "MEMORY", "RESTARTS", "LAST EXIT").AlignRight(2, 3, 4, 5)
+	for _, s := range statuses {
+		pid, uptime, memory := "-", "-", "-"
+		if s.State == supervisor.StateRunning {
+			pid, uptime = fmt.Sprint(s.PID), s.Uptime().String()
+			if s.Memory > 0 {
+				memory = formatBytes(int64(s.Memory))
+			}
+		}
+		table.AddRow(s.Name, s.State, pid, uptime, memory, s.Restarts, s.LastExit)
+	}
+	return table
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/lineedit"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/spf13/cobra"
+)
+
+// shellBuiltins are the words the shell handles itself
+var shellBuiltins = []string{"exit", "quit", "history"}
+
+// Shell Command
+func (c *CLI) addShellCommand() {
+	shellCmd := &cobra.Command{
+		Use:     "shell",
+		Aliases: []string{"interactive", "repl"},
+		Short:   "Run tsk commands interactively",
+		Long: `Read tsk commands line by line and run them as if they were given on the
+command line, without the leading tsk. Arguments are split like a shell
+does, so 'quoted words' and escaped\ spaces stay together, and a line
+ending inside quotes continues on the next one.
+
+Tab completes commands, flags and, for config get and config set, the keys
+of the hierarchy in the current directory. Up and Down browse the history,
+kept in ~/.tsk_history. Ctrl+C clears the line, Ctrl+D or exit leaves.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleShell()
+		},
+	}
+	c.rootCmd.AddCommand(shellCmd)
+}
+
+// shellHistoryFile is ~/.tsk_history, or "" without a home directory
+func shellHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".tsk_history")
+}
+
+// Shell Handler
+func (c *CLI) handleShell() error {
+	editor := lineedit.NewEditor(os.Stdin, os.Stdout)
+	editor.Complete = c.completeShell
+	if file := shellHistoryFile(); file != "" {
+		if err := editor.UseHistoryFile(file); err != nil {
+			c.out.Printf("⚠️  %v\n", err)
+		}
+	}
+	// Ctrl+C stops the running command, when it listens for it, and not
+	// the shell
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	c.out.Println("💻 TuskLang shell: enter a command without the leading tsk, help to list them, exit to leave")
+	var input string
+	for {
+		editor.Prompt = "tsk> "
+		if input != "" {
+			editor.Prompt = "...> "
+		}
+		line, err := editor.ReadLine()
+		if errors.Is(err, lineedit.ErrInterrupt) {
+			input = ""
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if input != "" {
+			input += "\n"
+		}
+		input += line
+		args, err := lineedit.Split(input)
+		if errors.Is(err, lineedit.ErrUnterminated) {
+			continue
+		}
+		editor.AddHistory(input)
+		input = ""
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+		case "history":
+			for i, entry := range editor.History() {
+				c.out.Printf("%4d  %s\n", i+1, entry)
+			}
+			continue
+		case "shell", "interactive", "repl":
+			c.out.Println("❌ Already in the shell")
+			continue
+		}
+		c.runShellCommand(args)
+		// Drop the interrupts that stopped the command
+		select {
+		case <-interrupts:
+		default:
+		}
+	}
+}
+
+// runShellCommand runs args on a fresh command tree, so flags set by one
+// line do not leak into the next. Errors are printed by execute.
+func (c *CLI) runShellCommand(args []string) {
+	New(c.sdk).execute(args)
+}
+
+// completeShell asks cobra's completion for the candidates of word after
+// args, as shell completion scripts do
+func (c *CLI) completeShell(args []string, word string) []string {
+	fresh := New(c.sdk)
+	var out bytes.Buffer
+	fresh.rootCmd.SetOut(&out)
+	fresh.rootCmd.SetErr(io.Discard)
+	fresh.rootCmd.SetArgs(append(append([]string{cobra.ShellCompRequestCmd}, args...), word))
+	if err := fresh.rootCmd.Execute(); err != nil {
+		return nil
+	}
+
+	var candidates []string
+	if len(args) == 0 {
+		candidates = append(candidates, shellBuiltins...)
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		// The last line is the directive, such as :4
+		if strings.HasPrefix(line, ":") {
+			break
+		}
+		if candidate, _, _ := strings.Cut(line, "\t"); candidate != "" && candidate != cobra.ShellCompRequestCmd {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// completeConfigKeys completes the first argument with the keys of the
+// hierarchy in --dir, one section at a time
+func completeConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	dir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		dir = "."
+	}
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	defer cfg.Close()
+
+	directive := cobra.ShellCompDirectiveNoFileComp
+	seen := make(map[string]bool)
+	var keys []string
+	for _, key := range cfg.Keys() {
+		if !strings.HasPrefix(key, toComplete) {
+			continue
+		}
+		// Offer the next section rather than every key below it
+		if i := strings.Index(key[len(toComplete):], "."); i >= 0 {
+			key = key[:len(toComplete)+i+1]
+			directive |= cobra.ShellCompDirectiveNoSpace
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, directive
+}
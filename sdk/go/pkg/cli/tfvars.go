@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/tfvars"
+	"github.com/spf13/cobra"
+)
+
+// Tfvars Command
+func (c *CLI) addTfvarsCommand() {
+	var env, output, format string
+	var opts tfvars.Options
+
+	tfvarsCmd := &cobra.Command{
+		Use:   "tfvars [dir]",
+		Short: "Export configuration as Terraform variables",
+		Long: `Resolve the peanut hierarchy of dir (default "."), with the overlay of --env
+merged in, and print it as Terraform variables: each top-level key becomes a
+variable and each section an object, lists stay lists.
+
+--prefix keeps only the keys under a section and strips it, so --prefix
+terraform exports the keys of [terraform] as variables; --section picks
+top-level keys (after the prefix). @secret values are left out unless
+--secrets is given. The format follows -o (.json is terraform.tfvars.json,
+anything else HCL) unless --format says otherwise; HCL keeps comments.
+
+  tsk tfvars infra --prefix terraform -o terraform.tfvars.json
+  tsk tfvars --env production --section network --section tags -o prod.auto.tfvars`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return c.handleTfvars(dir, env, output, format, opts)
+		},
+	}
+	tfvarsCmd.Flags().StringVar(&env, "env", "", "Environment overlay to apply, e.g. production")
+	tfvarsCmd.Flags().StringVar(&opts.Prefix, "prefix", "", "Export only the keys under this section, without it")
+	tfvarsCmd.Flags().StringArrayVar(&opts.Sections, "section", nil, "Top-level key to export (repeatable; default: all)")
+	tfvarsCmd.Flags().BoolVar(&opts.Secrets, "secrets", false, "Include @secret values, decrypted")
+	tfvarsCmd.Flags().StringVar(&format, "format", "", "Output format: hcl or json (default: by -o, else hcl)")
+	tfvarsCmd.Flags().StringVarP(&output, "output", "o", "", "File to write instead of stdout")
+
+	c.rootCmd.AddCommand(tfvarsCmd)
+}
+
+// Tfvars Handler
+func (c *CLI) handleTfvars(dir, env, output, formatName string, opts tfvars.Options) error {
+	format := tfvars.FormatFor(output)
+	if formatName != "" {
+		var err error
+		if format, err = tfvars.ParseFormat(formatName); err != nil {
+			return err
+		}
+	}
+	h, err := resolveEnvironment(dir, env)
+	if err != nil {
+		return err
+	}
+	values, err := h.Config.Values()
+	if err != nil {
+		return err
+	}
+	vars, err := tfvars.Export(values, h.Comments, peanut.NewVM(), opts)
+	if err != nil {
+		return err
+	}
+	data, err := vars.Encode(format)
+	if err != nil {
+		return err
+	}
+
+	if output != "" {
+		if err := os.WriteFile(output, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", output, err)
+		}
+	}
+	result := struct {
+		*tfvars.Vars
+		Format tfvars.Format `json:"format"`
+		Output string        `json:"output,omitempty"`
+	}{vars, format, output}
+	return c.out.Result(result, func(w io.Writer) {
+		notes := w
+		if output == "" {
+			w.Write(data)
+			// Keep stdout a valid tfvars file
+			notes = os.Stderr
+		} else {
+			fmt.Fprintf(w, "✅ Wrote %d variable(s) to %s\n", len(vars.Values), output)
+		}
+		if len(vars.Skipped) > 0 {
+			fmt.Fprintf(notes, "🔒 Left out %d @secret key(s): %s (pass --secrets to include them)\n", len(vars.Skipped), strings.Join(vars.Skipped, ", "))
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
+	"github.com/spf13/cobra"
+)
+
+// tracingOptions reads the [observability.tracing] section of dir's
+// hierarchy; a directory without configuration leaves tracing off
+func tracingOptions(dir string) (tracing.Options, error) {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if errors.Is(err, peanut.ErrNotFound) {
+		return tracing.DefaultOptions(), nil
+	}
+	if err != nil {
+		return tracing.DefaultOptions(), err
+	}
+	values, err := cfg.Execute(peanut.NewVM())
+	if err != nil {
+		return tracing.DefaultOptions(), err
+	}
+	return tracing.OptionsFrom(values, dir)
+}
+
+// startTracing installs the [observability.tracing] exporter of a
+// long-running server, reporting export failures to report. The returned
+// function flushes the spans still queued.
+func startTracing(opts tracing.Options, report func(error)) (stop func(), err error) {
+	provider, err := tracing.Setup(opts, nil, report)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			report(err)
+		}
+	}, nil
+}
+
+// commandTrace records the spans of a command run with --trace
+type commandTrace struct {
+	recorder *tracing.Recorder
+	provider *tracing.Provider
+	end      func()
+}
+
+// startTrace starts recording cmd when --trace is set, under a root span
+// named after its command line
+func (c *CLI) startTrace(cmd *cobra.Command) {
+	if on, _ := cmd.Flags().GetBool("trace"); !on || c.trace != nil {
+		return
+	}
+	recorder := tracing.NewRecorder()
+	provider, err := tracing.Setup(tracing.Options{}, recorder, nil)
+	if err != nil {
+		return
+	}
+	c.trace = &commandTrace{recorder: recorder, provider: provider, end: tracing.Begin(cmd.CommandPath())}
+}
+
+// finishTrace prints the trace tree of the command to stderr, where it
+// does not mix with results
+func (c *CLI) finishTrace() {
+	if c.trace == nil {
+		return
+	}
+	c.trace.end()
+	c.trace.provider.Shutdown(context.Background())
+	os.Stderr.WriteString("\n🔭 Trace\n")
+	c.trace.recorder.WriteTree(os.Stderr)
+	c.trace = nil
+}
+
+// tracingTarget describes where opts sends spans
+func tracingTarget(opts tracing.Options) string {
+	switch {
+	case opts.Exporter == "none":
+		return "nowhere (exporter none)"
+	case opts.Exporter != "stdout":
+		return opts.Endpoint
+	case opts.File != "":
+		return opts.File
+	}
+	return "stdout"
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// watchEvent is the data of each line of `tsk config watch --json`
+type watchEvent struct {
+	Time    time.Time          `json:"time"`
+	Trigger string             `json:"trigger,omitempty"`
+	Changes []peanut.KeyChange `json:"changes,omitempty"`
+	// Invalidated are the @cache keys the changes made stale
+	Invalidated []string `json:"invalidated,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// Config Watch Handler
+func (c *CLI) handleConfigWatch(dir string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w, err := peanut.Watch(dir, c.streamConfigChange)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	c.out.Printf("👀 Watching %s (Ctrl+C to stop)\n", dir)
+	for _, file := range w.Files() {
+		c.out.Printf("  %s\n", file)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// streamConfigChange reports one reload, as a diff or a watchEvent
+func (c *CLI) streamConfigChange(change peanut.ConfigChange) {
+	event := watchEvent{Time: time.Now(), Trigger: change.Trigger, Changes: change.Changes, Invalidated: change.Invalidated}
+	if change.Err != nil {
+		event.Error = change.Err.Error()
+	}
+	c.out.Stream(event, func(w io.Writer) { printConfigChange(w, change) })
+}
+
+// printConfigChange prints one reload as a +/-/~ diff
+func printConfigChange(w io.Writer, change peanut.ConfigChange) {
+	stamp := time.Now().Format("15:04:05")
+	if change.Err != nil {
+		fmt.Fprintf(w, "[%s] ⚠️  %v (keeping previous configuration)\n", stamp, change.Err)
+		return
+	}
+
+	trigger := change.Trigger
+	if trigger == "" {
+		trigger = "reload"
+	}
+	fmt.Fprintf(w, "[%s] 🔄 %s changed %d key(s)\n", stamp, trigger, len(change.Changes))
+	for _, kc := range change.Changes {
+		switch kc.Kind {
+		case peanut.KeyAdded:
+			fmt.Fprintf(w, "  + %s = %v\n", kc.Key, kc.New)
+		case peanut.KeyRemoved:
+			fmt.Fprintf(w, "  - %s (was %v)\n", kc.Key, kc.Old)
+		default:
+			fmt.Fprintf(w, "  ~ %s: %v -> %v\n", kc.Key, kc.Old, kc.New)
+		}
+	}
+	if len(change.Invalidated) > 0 {
+		fmt.Fprintf(w, "  🗑️  invalidated %d cached value(s)\n", len(change.Invalidated))
+	}
+}
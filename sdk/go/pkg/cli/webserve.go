@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/webserve"
+)
+
+// Web Serve Handler
+func (c *CLI) handleWebServe(dir, host string, port int) error {
+	load := func() (webserve.Options, error) {
+		cfg, _, err := peanut.LoadHierarchy(dir)
+		if err != nil {
+			return webserve.Options{}, err
+		}
+		values, err := cfg.Execute(peanut.NewVM())
+		cfg.Close()
+		if err != nil {
+			return webserve.Options{}, err
+		}
+		opts, err := webserve.OptionsFrom(values, dir)
+		if err != nil {
+			return opts, err
+		}
+		if host != "" {
+			opts.Host = host
+		}
+		if port != 0 {
+			opts.Port = port
+		}
+		if info, err := os.Stat(opts.Public); err != nil || !info.IsDir() {
+			if len(opts.Routes) == 0 {
+				return opts, fmt.Errorf("nothing to serve: %s is not a directory and [server.routes] is empty", opts.Public)
+			}
+			c.out.Printf("⚠️  %s is not a directory; only routes are served\n", opts.Public)
+		}
+		return opts, nil
+	}
+	opts, err := load()
+	if err != nil {
+		return err
+	}
+
+	handler := newSwapHandler(webserve.Handler(opts))
+	server := &http.Server{Addr: opts.Addr(), Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	scheme := "http"
+	listen := server.ListenAndServe
+	// The certificate is read through GetCertificate so reloads pick up
+	// renewed ones
+	var cert atomic.Pointer[tls.Certificate]
+	if opts.TLS() {
+		scheme = "https"
+		pair, err := tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate: %w", err)
+		}
+		cert.Store(&pair)
+		server.TLSConfig = &tls.Config{GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cert.Load(), nil
+		}}
+		listen = func() error { return server.ListenAndServeTLS("", "") }
+	}
+	c.out.Printf("🚀 Serving %s on %s://%s (Ctrl+C to stop)\n", opts.Public, scheme, opts.Addr())
+	c.printWebServeOptions(opts)
+
+	reload := func() error {
+		next, err := load()
+		if err != nil {
+			return err
+		}
+		if next.Addr() != opts.Addr() || next.TLS() != opts.TLS() {
+			return fmt.Errorf("the address or TLS changed; restart the server to apply that")
+		}
+		if next.TLS() {
+			pair, err := tls.LoadX509KeyPair(next.TLSCert, next.TLSKey)
+			if err != nil {
+				return fmt.Errorf("failed to load certificate: %w", err)
+			}
+			cert.Store(&pair)
+		}
+		handler.set(webserve.Handler(next))
+		opts = next
+		c.printWebServeOptions(opts)
+		return nil
+	}
+	return lifecycle{Name: "web", Dir: dir, Server: server, Listen: listen, Drain: opts.ShutdownTimeout, Reload: reload, Out: c.out}.run()
+}
+
+// printWebServeOptions lists the routes and middleware being served
+func (c *CLI) printWebServeOptions(opts webserve.Options) {
+	for _, route := range opts.Routes {
+		c.out.Printf("  %-16s → %s\n", route.Path, route.Target)
+	}
+	if opts.Gzip {
+		c.out.Println("  gzip enabled")
+	}
+	if len(opts.Middleware) > 0 {
+		names := make([]string, len(opts.Middleware))
+		for i, m := range opts.Middleware {
+			names[i] = m.Name
+		}
+		c.out.Printf("  middleware: %s\n", strings.Join(names, " → "))
+	}
+}
@@ -0,0 +1,644 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/enterprise"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/supervisor"
+	"github.com/spf13/cobra"
+)
+
+// executionIcons and stepIcons mark the states of executions and their steps
+var executionIcons = map[enterprise.ExecutionStatus]string{
+	enterprise.ExecutionRunning:   "⏳",
+	enterprise.ExecutionCompleted: "✅",
+	enterprise.ExecutionFailed:    "❌",
+	enterprise.ExecutionCancelled: "🛑",
+}
+
+var stepIcons = map[enterprise.StepStatus]string{
+	enterprise.StepRunning:   "⏳",
+	enterprise.StepCompleted: "✅",
+	enterprise.StepFailed:    "❌",
+	enterprise.StepSkipped:   "⏭️ ",
+}
+
+// Workflow Commands
+func (c *CLI) addWorkflowCommands() {
+	workflowCmd := &cobra.Command{
+		Use:   "workflow",
+		Short: "Workflow commands",
+		Long: `Commands for the workflows of workflows.tsk: steps run by type (command,
+http, set, sleep), with conditions, next steps, timeouts and retries.
+Executions are saved in .tsk/workflows after every step, so one stopped by
+a crash or an interrupt can be resumed where it stopped.`,
+	}
+	var dir string
+	workflowCmd.PersistentFlags().StringVar(&dir, "dir", ".", "Directory of workflows.tsk and .tsk/workflows")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the workflows",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleWorkflowList(dir)
+		},
+	}
+	workflowCmd.AddCommand(listCmd)
+
+	var inputs []string
+	var inputFile string
+	runCmd := &cobra.Command{
+		Use:   "run <workflow>",
+		Short: "Run a workflow",
+		Long: `Run a workflow until it completes or a step fails every attempt. The input
+is available to conditions and ${...} references as input.<name>. Exits
+with code 1 when the execution does not complete; tsk workflow resume
+continues it.`,
+		Example: `  tsk workflow run deploy --input env=prod --input version=1.4.2
+  tsk workflow run nightly --input-file params.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleWorkflowRun(cmd, dir, args[0], inputs, inputFile)
+		},
+	}
+	runCmd.Flags().StringArrayVar(&inputs, "input", nil, "Input as name=value (repeatable)")
+	runCmd.Flags().StringVar(&inputFile, "input-file", "", "JSON, YAML or .tsk file of input")
+	workflowCmd.AddCommand(runCmd)
+
+	statusCmd := &cobra.Command{
+		Use:   "status [execution]",
+		Short: "List the executions, or show the steps of one",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return c.handleWorkflowExecutions(dir)
+			}
+			return c.handleWorkflowStatus(dir, args[0])
+		},
+	}
+	workflowCmd.AddCommand(statusCmd)
+
+	resumeCmd := &cobra.Command{
+		Use:   "resume [execution]",
+		Short: "Resume an execution that did not complete",
+		Long: `Resume an execution that failed, was interrupted, or was left running by
+a process that stopped; the step it stopped at runs again. Without an
+execution, every execution left running is resumed.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id := ""
+			if len(args) > 0 {
+				id = args[0]
+			}
+			return c.handleWorkflowResume(cmd, dir, id)
+		},
+	}
+	workflowCmd.AddCommand(resumeCmd)
+
+	triggersCmd := &cobra.Command{
+		Use:   "triggers",
+		Short: "List the triggers of the workflows",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleWorkflowTriggers(dir)
+		},
+	}
+	workflowCmd.AddCommand(triggersCmd)
+
+	triggerCmd := &cobra.Command{
+		Use:   "trigger",
+		Short: "Enable or disable triggers",
+		Long: `Enable or disable a trigger, named <workflow>/<trigger>. The choice is kept
+in .tsk/triggers.json, over the enabled setting of workflows.tsk, and a
+running tsk workflow serve sees it the next time the trigger is due.`,
+	}
+	for _, enable := range []bool{true, false} {
+		enable := enable
+		use, short := "enable <trigger>", "Enable a trigger"
+		if !enable {
+			use, short = "disable <trigger>", "Disable a trigger"
+		}
+		triggerCmd.AddCommand(&cobra.Command{
+			Use:   use,
+			Short: short,
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return c.handleWorkflowTriggerEnable(dir, args[0], enable)
+			},
+		})
+	}
+	workflowCmd.AddCommand(triggerCmd)
+
+	var interval time.Duration
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run workflows as their triggers fire",
+		Long: `Run workflows on their cron schedules, and when the events their triggers
+wait for happen:
+
+  config.change          a configuration file of --dir's hierarchy changed
+  service.state          a service of [services] entered a state
+  compliance.violation   a change broke a rule of compliance.policy.tsk
+
+  [workflows.reload.triggers.config]
+  event: "config.change"
+  when: 'event.source =~ "peanu\\.tsk$"'
+
+  [workflows.page.triggers.crash]
+  event: "service.state"
+  when: 'event.data.state == "failed"'
+
+Executions get the input of the trigger, with trigger.id and, for events,
+event.type, event.source and event.data. A trigger does not fire while
+its previous execution runs. Stop with Ctrl+C; interrupted executions can
+be resumed. Restart to apply changes to workflows.tsk.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.handleWorkflowServe(dir, interval)
+		},
+	}
+	serveCmd.Flags().DurationVar(&interval, "interval", 5*time.Second, "How often to check the state of services")
+	workflowCmd.AddCommand(serveCmd)
+
+	c.rootCmd.AddCommand(workflowCmd)
+}
+
+// loadWorkflowManager reads the workflows of dir, if it has a workflow
+// file, and opens its execution store
+func loadWorkflowManager(dir string, required bool) (*enterprise.WorkflowManager, error) {
+	wm := enterprise.NewWorkflowManager(enterprise.NewFileExecutionStore(filepath.Join(dir, enterprise.DefaultWorkflowStore)))
+	file := filepath.Join(dir, enterprise.WorkflowFile)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		if required {
+			return nil, tskerrors.New(tskerrors.NotFound, "no %s in %s", enterprise.WorkflowFile, dir)
+		}
+		return wm, nil
+	}
+	workflows, err := enterprise.LoadWorkflows(file)
+	if err != nil {
+		return nil, tskerrors.Wrap(tskerrors.Validation, err)
+	}
+	for _, workflow := range workflows {
+		if err := wm.CreateWorkflow(workflow); err != nil {
+			return nil, tskerrors.Wrap(tskerrors.Validation, fmt.Errorf("%s: %w", file, err))
+		}
+	}
+	return wm, nil
+}
+
+// Workflow List Command Handler
+func (c *CLI) handleWorkflowList(dir string) error {
+	wm, err := loadWorkflowManager(dir, true)
+	if err != nil {
+		return err
+	}
+	workflows := wm.Workflows()
+	return c.out.Result(workflows, func(w io.Writer) {
+		for _, workflow := range workflows {
+			steps := make([]string, len(workflow.Steps))
+			for i, step := range workflow.Steps {
+				steps[i] = step.ID
+			}
+			fmt.Fprintf(w, "%-20s %s (%d step(s): %s)\n", workflow.ID, workflow.Name, len(steps), strings.Join(steps, ", "))
+		}
+	})
+}
+
+// workflowInput reads the input of tsk workflow run
+func workflowInput(inputs []string, file string) (map[string]interface{}, error) {
+	input := make(map[string]interface{})
+	if file != "" {
+		data, err := readDataFile(file)
+		if err != nil {
+			return nil, err
+		}
+		input = data
+	}
+	for _, pair := range inputs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, tskerrors.New(tskerrors.Usage, "invalid input %q: expected name=value", pair)
+		}
+		input[name] = config.ParseValue(value)
+	}
+	return input, nil
+}
+
+// Workflow Run Command Handler
+func (c *CLI) handleWorkflowRun(cmd *cobra.Command, dir, workflowID string, inputs []string, inputFile string) error {
+	input, err := workflowInput(inputs, inputFile)
+	if err != nil {
+		return err
+	}
+	wm, err := loadWorkflowManager(dir, true)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	execution, err := wm.ExecuteWorkflow(ctx, workflowID, input)
+	return c.workflowResult(cmd, execution, err)
+}
+
+// Workflow Resume Command Handler
+func (c *CLI) handleWorkflowResume(cmd *cobra.Command, dir, id string) error {
+	wm, err := loadWorkflowManager(dir, true)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if id != "" {
+		execution, err := wm.ResumeExecution(ctx, id)
+		return c.workflowResult(cmd, execution, err)
+	}
+
+	executions, err := wm.Executions()
+	if err != nil {
+		return err
+	}
+	var resumed []*enterprise.WorkflowExecution
+	var failed error
+	for _, execution := range executions {
+		if execution.Status != enterprise.ExecutionRunning {
+			continue
+		}
+		execution, err := wm.ResumeExecution(ctx, execution.ID)
+		if execution != nil {
+			resumed = append(resumed, execution)
+		}
+		if err != nil && failed == nil {
+			failed = err
+		}
+	}
+	err = c.out.Result(resumed, func(w io.Writer) {
+		if len(resumed) == 0 {
+			fmt.Fprintln(w, "No interrupted executions")
+		}
+		for _, execution := range resumed {
+			printExecution(w, execution)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failed != nil {
+		cmd.SilenceUsage = true
+	}
+	return failed
+}
+
+// workflowResult prints the outcome of a run or resumption
+func (c *CLI) workflowResult(cmd *cobra.Command, execution *enterprise.WorkflowExecution, err error) error {
+	if execution == nil {
+		return err
+	}
+	if printErr := c.out.Result(execution, func(w io.Writer) { printExecution(w, execution) }); printErr != nil {
+		return printErr
+	}
+	if err != nil {
+		// The steps were printed; a failed execution is not a misuse
+		cmd.SilenceUsage = true
+	}
+	return err
+}
+
+// Workflow Executions Command Handler
+func (c *CLI) handleWorkflowExecutions(dir string) error {
+	wm, err := loadWorkflowManager(dir, false)
+	if err != nil {
+		return err
+	}
+	executions, err := wm.Executions()
+	if err != nil {
+		return err
+	}
+	return c.out.Result(executions, func(w io.Writer) {
+		if len(executions) == 0 {
+			fmt.Fprintln(w, "No executions")
+		}
+		for _, e := range executions {
+			done := 0
+			for _, step := range e.Steps {
+				if step.Status == enterprise.StepCompleted {
+					done++
+				}
+			}
+			fmt.Fprintf(w, "%s %s  %-16s %-9s %s  %d step(s) completed\n", executionIcons[e.Status], e.ID, e.WorkflowID,
+				e.Status, e.StartedAt.Local().Format("2006-01-02 15:04:05"), done)
+		}
+	})
+}
+
+// Workflow Status Command Handler
+func (c *CLI) handleWorkflowStatus(dir, id string) error {
+	wm, err := loadWorkflowManager(dir, false)
+	if err != nil {
+		return err
+	}
+	execution, err := wm.Execution(id)
+	if err != nil {
+		return err
+	}
+	return c.out.Result(execution, func(w io.Writer) { printExecution(w, execution) })
+}
+
+// printExecution lays out an execution and its steps
+func printExecution(w io.Writer, e *enterprise.WorkflowExecution) {
+	end := e.UpdatedAt
+	if e.CompletedAt != nil {
+		end = *e.CompletedAt
+	}
+	fmt.Fprintf(w, "%s %s %s: %s in %s\n", executionIcons[e.Status], e.WorkflowID, e.ID, e.Status, end.Sub(e.StartedAt).Round(time.Millisecond))
+	for _, step := range e.Steps {
+		line := fmt.Sprintf("   %s %-20s %s", stepIcons[step.Status], step.ID, step.Status)
+		if step.Attempts > 1 {
+			line += fmt.Sprintf(" after %d attempts", step.Attempts)
+		}
+		if step.CompletedAt != nil && step.Status != enterprise.StepSkipped {
+			line += fmt.Sprintf(" (%s)", step.CompletedAt.Sub(step.StartedAt).Round(time.Millisecond))
+		}
+		fmt.Fprintln(w, line)
+		if step.Error != "" {
+			fmt.Fprintf(w, "     → %s\n", step.Error)
+		}
+	}
+	if len(e.Pending) > 0 && e.Status != enterprise.ExecutionCompleted {
+		fmt.Fprintf(w, "   pending: %s\n", strings.Join(e.Pending, ", "))
+	}
+}
+
+// triggerScheduler returns the scheduler of the triggers of dir
+func triggerScheduler(wm *enterprise.WorkflowManager, bus *enterprise.EventBus, dir string) *enterprise.TriggerScheduler {
+	return enterprise.NewTriggerScheduler(wm, bus, filepath.Join(dir, enterprise.DefaultTriggerState))
+}
+
+// triggerWhen describes when a trigger fires
+func triggerWhen(t *enterprise.WorkflowTrigger) string {
+	if t.Schedule == "" {
+		return "on " + t.Event
+	}
+	when := "at " + t.Schedule
+	if next := t.Next(time.Now()); !next.IsZero() {
+		when += ", next " + next.Format("2006-01-02 15:04")
+	}
+	return when
+}
+
+// Workflow Triggers Command Handler
+func (c *CLI) handleWorkflowTriggers(dir string) error {
+	wm, err := loadWorkflowManager(dir, true)
+	if err != nil {
+		return err
+	}
+	triggers, err := triggerScheduler(wm, nil, dir).Triggers()
+	if err != nil {
+		return err
+	}
+	return c.out.Result(triggers, func(w io.Writer) {
+		if len(triggers) == 0 {
+			fmt.Fprintln(w, "No triggers")
+		}
+		for _, t := range triggers {
+			state := "enabled"
+			if !t.Enabled {
+				state = "disabled"
+			}
+			fmt.Fprintf(w, "%-28s %-8s %s\n", t.ID, state, triggerWhen(t))
+			for _, condition := range t.Conditions {
+				fmt.Fprintf(w, "     when %s\n", condition)
+			}
+		}
+	})
+}
+
+// Workflow Trigger Enable/Disable Command Handler
+func (c *CLI) handleWorkflowTriggerEnable(dir, id string, enable bool) error {
+	wm, err := loadWorkflowManager(dir, true)
+	if err != nil {
+		return err
+	}
+	t, err := triggerScheduler(wm, nil, dir).SetEnabled(id, enable)
+	if err != nil {
+		return err
+	}
+	return c.out.Result(t, func(w io.Writer) {
+		if enable {
+			fmt.Fprintf(w, "▶️  Enabled %s (%s)\n", t.ID, triggerWhen(t))
+		} else {
+			fmt.Fprintf(w, "⏸️  Disabled %s\n", t.ID)
+		}
+	})
+}
+
+// triggerEvent is the record tsk workflow serve streams for a firing
+type triggerEvent struct {
+	Time      time.Time                  `json:"time"`
+	Trigger   string                     `json:"trigger"`
+	Event     *enterprise.Event          `json:"event,omitempty"`
+	Execution string                     `json:"execution,omitempty"`
+	Status    enterprise.ExecutionStatus `json:"status,omitempty"`
+	Error     string                     `json:"error,omitempty"`
+}
+
+// Workflow Serve Command Handler
+func (c *CLI) handleWorkflowServe(dir string, interval time.Duration) error {
+	if interval <= 0 {
+		return tskerrors.New(tskerrors.Usage, "--interval must be positive")
+	}
+	wm, err := loadWorkflowManager(dir, true)
+	if err != nil {
+		return err
+	}
+	bus := enterprise.NewEventBus()
+	scheduler := triggerScheduler(wm, bus, dir)
+	triggers, err := scheduler.Triggers()
+	if err != nil {
+		return err
+	}
+	if len(triggers) == 0 {
+		return tskerrors.New(tskerrors.NotFound, "no triggers in %s", filepath.Join(dir, enterprise.WorkflowFile))
+	}
+	cm, err := serveComplianceManager(dir)
+	if err != nil {
+		return err
+	}
+
+	// Firings and source errors come from several goroutines
+	var mu sync.Mutex
+	scheduler.OnFire = func(firing enterprise.TriggerFiring) {
+		record := triggerEvent{Time: time.Now(), Trigger: firing.Trigger.ID, Event: firing.Event}
+		if firing.Execution != nil {
+			record.Execution, record.Status = firing.Execution.ID, firing.Execution.Status
+		}
+		if firing.Err != nil {
+			record.Error = firing.Err.Error()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		c.out.Stream(record, func(w io.Writer) { printTriggerEvent(w, record) })
+	}
+	warn := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(c.out.Messages(), "⚠️  %v\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan error, 1)
+	go func() { done <- scheduler.Run(ctx) }()
+
+	var previous *enterprise.ComplianceReport
+	var compliance sync.Mutex
+	checkCompliance := func(cfg *peanut.Config) {
+		compliance.Lock()
+		defer compliance.Unlock()
+		values, err := cfg.Execute(peanut.NewVM())
+		if err != nil {
+			warn(err)
+			return
+		}
+		report := cm.Evaluate(dir, values)
+		if previous != nil {
+			for _, event := range enterprise.ViolationEvents(previous, report) {
+				bus.Publish(event)
+			}
+		}
+		previous = report
+	}
+	w, err := peanut.Watch(dir, func(change peanut.ConfigChange) {
+		if change.Err != nil {
+			warn(change.Err)
+			return
+		}
+		bus.Publish(configChangeEvent(change))
+		if cm != nil {
+			checkCompliance(change.Config)
+		}
+	})
+	switch {
+	case errors.Is(err, peanut.ErrNotFound):
+		// Without a configuration only schedules and services fire
+	case err != nil:
+		stop()
+		<-done
+		return err
+	default:
+		defer w.Close()
+		if cm != nil {
+			// The violations there already are do not fire triggers
+			checkCompliance(w.Config())
+		}
+	}
+	go publishServiceStates(ctx, dir, interval, bus)
+
+	c.out.Printf("🔔 Serving %d trigger(s) of %s (Ctrl+C to stop)\n", len(triggers), filepath.Join(dir, enterprise.WorkflowFile))
+	for _, t := range triggers {
+		if t.Enabled {
+			c.out.Printf("  %-28s %s\n", t.ID, triggerWhen(t))
+		}
+	}
+	return <-done
+}
+
+// serveComplianceManager loads compliance.policy.tsk of dir, if it has one
+func serveComplianceManager(dir string) (*enterprise.ComplianceManager, error) {
+	file := filepath.Join(dir, enterprise.CompliancePolicyFile)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return enterprise.LoadComplianceManager(file)
+}
+
+// configChangeEvent makes an enterprise.EventConfigChange of a reload
+func configChangeEvent(change peanut.ConfigChange) enterprise.Event {
+	files := make([]interface{}, len(change.Files))
+	for i, file := range change.Files {
+		files[i] = file
+	}
+	keys := make([]interface{}, len(change.Changes))
+	for i, kc := range change.Changes {
+		keys[i] = kc.Key
+	}
+	return enterprise.Event{
+		Type:   enterprise.EventConfigChange,
+		Source: change.Trigger,
+		Data:   map[string]interface{}{"file": change.Trigger, "files": files, "keys": keys},
+	}
+}
+
+// publishServiceStates publishes an enterprise.EventServiceState whenever
+// a service of the supervisor of dir changes state, checking every
+// interval until ctx is done
+func publishServiceStates(ctx context.Context, dir string, interval time.Duration, bus *enterprise.EventBus) {
+	specs, runDir, err := loadServices(dir)
+	if err != nil || len(specs) == 0 {
+		return
+	}
+	client := supervisor.NewClient(runDir)
+	var states map[string]supervisor.State
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		current := make(map[string]supervisor.State)
+		// A supervisor that is not running runs no services
+		statuses, _ := client.Status(ctx)
+		for _, status := range statuses {
+			current[status.Name] = status.State
+			if states != nil && states[status.Name] != status.State {
+				bus.Publish(enterprise.Event{
+					Type:   enterprise.EventServiceState,
+					Source: status.Name,
+					Data: map[string]interface{}{
+						"service":   status.Name,
+						"state":     string(status.State),
+						"previous":  string(states[status.Name]),
+						"restarts":  status.Restarts,
+						"last_exit": status.LastExit,
+					},
+				})
+			}
+		}
+		states = current
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// printTriggerEvent prints one firing of tsk workflow serve
+func printTriggerEvent(w io.Writer, record triggerEvent) {
+	stamp := record.Time.Format("15:04:05")
+	cause := "schedule"
+	if record.Event != nil {
+		cause = record.Event.Type
+		if record.Event.Source != "" {
+			cause += " " + record.Event.Source
+		}
+	}
+	switch {
+	case record.Execution == "":
+		fmt.Fprintf(w, "[%s] ⚠️  %s (%s): %s\n", stamp, record.Trigger, cause, record.Error)
+	case record.Error != "":
+		fmt.Fprintf(w, "[%s] %s %s (%s): execution %s %s: %s\n", stamp, executionIcons[record.Status], record.Trigger, cause, record.Execution, record.Status, record.Error)
+	default:
+		fmt.Fprintf(w, "[%s] %s %s (%s): execution %s %s\n", stamp, executionIcons[record.Status], record.Trigger, cause, record.Execution, record.Status)
+	}
+}
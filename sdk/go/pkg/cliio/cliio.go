@@ -0,0 +1,217 @@
+// Package cliio is the output layer of the tsk commands. A command hands
+// its result to Output once, with a function rendering it as text, and
+// Output prints it in the format the user asked for:
+//
+//	tsk config get database.port          # 5432 as text
+//	tsk config get database.port --json   # {"ok": true, "command": "config get", "data": {...}}
+//	TSK_OUTPUT=yaml tsk services status
+//
+// JSON and YAML results are wrapped in an Envelope, errors included, so
+// scripts read one shape from every command. Progress messages go to
+// stdout as text and to stderr otherwise, keeping stdout parseable.
+package cliio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format selects how results are printed
+type Format string
+
+const (
+	// Text is for people: tables, emoji and messages
+	Text Format = "text"
+	// JSON prints an indented Envelope
+	JSON Format = "json"
+	// YAML prints the Envelope as YAML
+	YAML Format = "yaml"
+)
+
+// FormatEnv names the variable selecting the format when no flag does
+const FormatEnv = "TSK_OUTPUT"
+
+// ParseFormat reads a format name, "" meaning Text
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(name))); f {
+	case "", Text:
+		return Text, nil
+	case JSON, YAML:
+		return f, nil
+	}
+	return Text, fmt.Errorf("unsupported output format %q (supported: text, json, yaml)", name)
+}
+
+// Envelope wraps every JSON and YAML result
+type Envelope struct {
+	OK bool `json:"ok"`
+	// Command is the command path without tsk, such as "config get"
+	Command string      `json:"command,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   *Error      `json:"error,omitempty"`
+}
+
+// yamlEnvelope is Envelope with its fields in the same order in YAML
+type yamlEnvelope struct {
+	OK      bool        `yaml:"ok"`
+	Command string      `yaml:"command,omitempty"`
+	Data    interface{} `yaml:"data,omitempty"`
+	Error   *Error      `yaml:"error,omitempty"`
+}
+
+// Error describes a failed command
+type Error struct {
+	Message string `json:"message" yaml:"message"`
+	// Code is set for errors that carry one, see Coded
+	Code string `json:"code,omitempty" yaml:"code,omitempty"`
+}
+
+// Coded is implemented by errors with a stable code scripts can match
+type Coded interface {
+	Code() string
+}
+
+// Output prints the results of one command
+type Output struct {
+	Format Format
+	// Command is reported in envelopes
+	Command string
+
+	out     io.Writer
+	err     io.Writer
+	printed bool
+}
+
+// New prints results to out and, outside Text, messages to errOut
+func New(format Format, out, errOut io.Writer) *Output {
+	return &Output{Format: format, out: out, err: errOut}
+}
+
+// Default prints to stdout and stderr in the format of $TSK_OUTPUT
+func Default() *Output {
+	format, err := ParseFormat(os.Getenv(FormatEnv))
+	if err != nil {
+		format = Text
+	}
+	return New(format, os.Stdout, os.Stderr)
+}
+
+// Structured reports whether results are printed as JSON or YAML
+func (o *Output) Structured() bool {
+	return o.Format == JSON || o.Format == YAML
+}
+
+// Printed reports whether a result or an error was printed
+func (o *Output) Printed() bool {
+	return o.printed
+}
+
+// Result prints data: through text in Text format, when text is not nil,
+// and as an Envelope otherwise
+func (o *Output) Result(data interface{}, text func(w io.Writer)) error {
+	o.printed = true
+	if !o.Structured() {
+		if text != nil {
+			text(o.out)
+		}
+		return nil
+	}
+	return o.write(Envelope{OK: true, Command: o.Command, Data: data}, true)
+}
+
+// Stream prints one result of a command that reports as it goes, such as
+// a watch: text as usual, or one compact JSON Envelope per line. YAML
+// streams are separated by "---".
+func (o *Output) Stream(data interface{}, text func(w io.Writer)) error {
+	o.printed = true
+	if !o.Structured() {
+		if text != nil {
+			text(o.out)
+		}
+		return nil
+	}
+	if o.Format == YAML {
+		fmt.Fprintln(o.out, "---")
+	}
+	return o.write(Envelope{OK: true, Command: o.Command, Data: data}, false)
+}
+
+// Error prints err as an Envelope in structured formats; in Text it is
+// left to the caller
+func (o *Output) Error(err error) error {
+	if !o.Structured() {
+		return nil
+	}
+	o.printed = true
+	e := &Error{Message: err.Error()}
+	var coded Coded
+	if errors.As(err, &coded) {
+		e.Code = coded.Code()
+	}
+	return o.write(Envelope{OK: false, Command: o.Command, Error: e}, true)
+}
+
+// Printf prints a message: to stdout in Text format and to stderr
+// otherwise, so it never mixes with a result
+func (o *Output) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(o.Messages(), format, args...)
+}
+
+// Println prints a message line, like Printf
+func (o *Output) Println(args ...interface{}) {
+	fmt.Fprintln(o.Messages(), args...)
+}
+
+// Writer is where text results go, for commands printing them piecemeal
+func (o *Output) Writer() io.Writer {
+	return o.out
+}
+
+// Messages is where messages go: stdout in Text format and stderr otherwise,
+// for prompts and progress written piecemeal
+func (o *Output) Messages() io.Writer {
+	if o.Structured() {
+		return o.err
+	}
+	return o.out
+}
+
+// write encodes envelope in o.Format
+func (o *Output) write(envelope Envelope, indent bool) error {
+	switch o.Format {
+	case YAML:
+		// Data goes through JSON, so its json tags name the fields
+		var data interface{}
+		if envelope.Data != nil {
+			raw, err := json.Marshal(envelope.Data)
+			if err != nil {
+				return fmt.Errorf("failed to encode result: %w", err)
+			}
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return fmt.Errorf("failed to encode result: %w", err)
+			}
+		}
+		encoder := yaml.NewEncoder(o.out)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(yamlEnvelope{envelope.OK, envelope.Command, data, envelope.Error}); err != nil {
+			return fmt.Errorf("failed to encode result: %w", err)
+		}
+		return encoder.Close()
+	default:
+		encoder := json.NewEncoder(o.out)
+		encoder.SetEscapeHTML(false)
+		if indent {
+			encoder.SetIndent("", "  ")
+		}
+		if err := encoder.Encode(envelope); err != nil {
+			return fmt.Errorf("failed to encode result: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package cliio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"": Text, "text": Text, "JSON": JSON, " yaml ": YAML} {
+		if got, err := ParseFormat(name); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat should reject xml")
+	}
+}
+
+// output returns an Output writing results and messages to separate buffers
+func output(format Format) (*Output, *strings.Builder, *strings.Builder) {
+	out, errOut := &strings.Builder{}, &strings.Builder{}
+	o := New(format, out, errOut)
+	o.Command = "config get"
+	return o, out, errOut
+}
+
+func TestResult(t *testing.T) {
+	data := struct {
+		Key   string `json:"key"`
+		Value int    `json:"value"`
+	}{"database.port", 5432}
+	text := func(w io.Writer) { fmt.Fprintf(w, "%s = %d\n", data.Key, data.Value) }
+
+	o, out, errOut := output(Text)
+	o.Println("📂 loading")
+	o.Result(data, text)
+	if out.String() != "📂 loading\ndatabase.port = 5432\n" || errOut.Len() != 0 || !o.Printed() {
+		t.Errorf("unexpected text output %q, %q", out.String(), errOut.String())
+	}
+
+	o, out, errOut = output(JSON)
+	o.Println("📂 loading")
+	o.Result(data, text)
+	var envelope struct {
+		OK      bool
+		Command string
+		Data    map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(out.String()), &envelope); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if !envelope.OK || envelope.Command != "config get" || envelope.Data["value"] != 5432.0 {
+		t.Errorf("unexpected envelope %+v", envelope)
+	}
+	if errOut.String() != "📂 loading\n" {
+		t.Errorf("messages should go to stderr, got %q", errOut.String())
+	}
+
+	o, out, _ = output(YAML)
+	o.Result(data, text)
+	want := "ok: true\ncommand: config get\ndata:\n  key: database.port\n  value: 5432\n"
+	if out.String() != want {
+		t.Errorf("got YAML %q, want %q", out.String(), want)
+	}
+}
+
+// codedError carries a code for scripts
+type codedError struct{}
+
+func (codedError) Error() string { return "key not found" }
+func (codedError) Code() string  { return "not_found" }
+
+func TestError(t *testing.T) {
+	o, out, _ := output(Text)
+	o.Error(errors.New("boom"))
+	if out.Len() != 0 || o.Printed() {
+		t.Errorf("errors are left to the caller in text, got %q", out.String())
+	}
+
+	o, out, _ = output(JSON)
+	o.Error(fmt.Errorf("failed to get: %w", codedError{}))
+	want := `{
+  "ok": false,
+  "command": "config get",
+  "error": {
+    "message": "failed to get: key not found",
+    "code": "not_found"
+  }
+}
+`
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestStream(t *testing.T) {
+	o, out, _ := output(JSON)
+	o.Stream(map[string]string{"key": "a"}, nil)
+	o.Stream(map[string]string{"key": "b"}, nil)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || lines[1] != `{"ok":true,"command":"config get","data":{"key":"b"}}` {
+		t.Errorf("expected one compact envelope per line, got %q", out.String())
+	}
+
+	o, out, _ = output(YAML)
+	o.Stream("a", nil)
+	o.Stream("b", nil)
+	if strings.Count(out.String(), "---\n") != 2 {
+		t.Errorf("expected YAML documents, got %q", out.String())
+	}
+}
+
+func TestTable(t *testing.T) {
+	table := NewTable("NAME", "PID", "DIR").AlignRight(1)
+	table.AddRow("api", 4012, "/srv/api")
+	table.AddRow("worker", 7, "/srv/worker")
+	var out strings.Builder
+	table.Render(&out)
+	want := "NAME     PID  DIR\n" +
+		"api     4012  /srv/api\n" +
+		"worker     7  /srv/worker\n"
+	if table.Len() != 2 || out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
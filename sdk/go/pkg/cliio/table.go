@@ -0,0 +1,77 @@
+package cliio
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Table renders rows as aligned text columns
+type Table struct {
+	headers []string
+	rows    [][]string
+	// right holds the columns aligned right, numbers usually
+	right map[int]bool
+}
+
+// NewTable returns a table with the given column headers
+func NewTable(headers ...string) *Table {
+	return &Table{headers: headers, right: make(map[int]bool)}
+}
+
+// AlignRight aligns the columns at the given indexes to the right
+func (t *Table) AlignRight(columns ...int) *Table {
+	for _, c := range columns {
+		t.right[c] = true
+	}
+	return t
+}
+
+// AddRow appends a row, formatting each cell with %v
+func (t *Table) AddRow(cells ...interface{}) {
+	row := make([]string, len(cells))
+	for i, cell := range cells {
+		row[i] = fmt.Sprint(cell)
+	}
+	t.rows = append(t.rows, row)
+}
+
+// Len is the number of rows
+func (t *Table) Len() int {
+	return len(t.rows)
+}
+
+// Render writes the headers and rows, two spaces between columns and the
+// last column unpadded
+func (t *Table) Render(w io.Writer) {
+	widths := make([]int, len(t.headers))
+	for _, row := range append([][]string{t.headers}, t.rows...) {
+		for i, cell := range row {
+			if i < len(widths) {
+				widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+			}
+		}
+	}
+	for _, row := range append([][]string{t.headers}, t.rows...) {
+		var line strings.Builder
+		for i, cell := range row {
+			if i >= len(widths) {
+				break
+			}
+			if i > 0 {
+				line.WriteString("  ")
+			}
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			switch {
+			case t.right[i]:
+				line.WriteString(pad + cell)
+			case i == len(widths)-1:
+				line.WriteString(cell)
+			default:
+				line.WriteString(cell + pad)
+			}
+		}
+		fmt.Fprintln(w, line.String())
+	}
+}
@@ -5,16 +5,40 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/performance/memory"
 )
 
 // Config represents a configuration manager
 type Config struct {
 	values map[string]interface{}
-	file   string
+	merge  map[string]MergeStrategy
+	// lines holds the 1-based line each key of a TSK file was declared on
+	lines map[string]int
+	// comments holds the # comment lines directly above each key or section
+	comments map[string]string
+	file     string
 }
 
+// MergeStrategy controls how a value combines with the values a file
+// inherits from files above it in a hierarchy
+type MergeStrategy string
+
+// Merge strategies. Keys are deep-merged unless annotated:
+//
+//	features +=: ["beta"]   append to the inherited array
+//	database =:             replace everything inherited under database
+//	[cache =]               same, for a whole section
+const (
+	MergeDeep    MergeStrategy = "merge"
+	MergeReplace MergeStrategy = "replace"
+	MergeAppend  MergeStrategy = "append"
+)
+
 // New creates a new Config instance
 func New() *Config {
 	return &Config{
@@ -42,6 +66,11 @@ func (c *Config) LoadFromFile(filename string) error {
 	}
 }
 
+// LoadTSK parses TSK content into the configuration
+func (c *Config) LoadTSK(content []byte) error {
+	return c.parseTSK(content)
+}
+
 // SaveToFile saves configuration to a file
 func (c *Config) SaveToFile(filename string) error {
 	var content []byte
@@ -176,9 +205,58 @@ func (c *Config) Values() map[string]interface{} {
 	return c.values
 }
 
+// Line returns the 1-based line key was declared on in the TSK content it
+// was parsed from, or 0 when unknown
+func (c *Config) Line(key string) int {
+	return c.lines[key]
+}
+
+// Comment returns the # comment lines directly above key, or above the
+// header of a section or block, joined by newlines
+func (c *Config) Comment(key string) string {
+	return c.comments[key]
+}
+
+// Comments returns the comments of every commented key and section
+func (c *Config) Comments() map[string]string {
+	return c.comments
+}
+
 // Clear clears all configuration values
 func (c *Config) Clear() {
 	c.values = make(map[string]interface{})
+	c.merge = nil
+	c.lines = nil
+	c.comments = nil
+}
+
+// MergeAnnotations returns the keys and sections annotated with a merge
+// strategy other than the default deep merge
+func (c *Config) MergeAnnotations() map[string]MergeStrategy {
+	return c.merge
+}
+
+// annotate records the merge strategy of a key or section
+func (c *Config) annotate(path string, strategy MergeStrategy) {
+	if strategy == "" {
+		return
+	}
+	if c.merge == nil {
+		c.merge = make(map[string]MergeStrategy)
+	}
+	c.merge[path] = strategy
+}
+
+// splitMergeAnnotation strips a trailing "+=" or "=" from a key or section
+// name and returns the strategy it selects
+func splitMergeAnnotation(name string) (string, MergeStrategy) {
+	if trimmed, ok := strings.CutSuffix(name, "+="); ok {
+		return strings.TrimSpace(trimmed), MergeAppend
+	}
+	if trimmed, ok := strings.CutSuffix(name, "="); ok && !strings.HasSuffix(trimmed, "=") && !strings.HasSuffix(trimmed, "!") {
+		return strings.TrimSpace(trimmed), MergeReplace
+	}
+	return name, ""
 }
 
 // Merge merges another configuration into this one
@@ -188,67 +266,380 @@ func (c *Config) Merge(other *Config) {
 	}
 }
 
+// Tree returns the configuration as nested maps, splitting dotted keys
+func (c *Config) Tree() map[string]interface{} {
+	return Nest(c.values)
+}
+
+// Nest converts a map of dotted keys into nested maps. When a key is both a
+// value and a parent (e.g. "a" and "a.b"), the nested form wins.
+func Nest(flat map[string]interface{}) map[string]interface{} {
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tree := make(map[string]interface{})
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		node := tree
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[part] = child
+			}
+			node = child
+		}
+		last := parts[len(parts)-1]
+		if _, isMap := node[last].(map[string]interface{}); !isMap {
+			node[last] = flat[key]
+		}
+	}
+	return tree
+}
+
+// Flatten converts nested maps into a map of dotted keys
+func Flatten(tree map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	flattenInto(flat, "", tree)
+	return flat
+}
+
+func flattenInto(flat map[string]interface{}, prefix string, tree map[string]interface{}) {
+	for key, value := range tree {
+		path := joinKey(prefix, key)
+		if child, ok := value.(map[string]interface{}); ok && len(child) > 0 {
+			flattenInto(flat, path, child)
+			continue
+		}
+		flat[path] = value
+	}
+}
+
 // parseJSON parses JSON configuration
 func (c *Config) parseJSON(content []byte) error {
 	return json.Unmarshal(content, &c.values)
 }
 
-// parseTSK parses TSK configuration
+// parseTSK parses TSK configuration.
+//
+// Nested structures are flattened into dotted keys, so a value declared under
+// a [database] section (or a `database {` block, or an indented `database:`
+// map) is stored as "database.host".
 func (c *Config) parseTSK(content []byte) error {
-	lines := strings.Split(string(content), "\n")
-	
+	tokens := memory.Parser.Tokens()
+	defer memory.Parser.PutTokens(tokens)
+	*tokens = appendLines(*tokens, string(content))
+	lines := *tokens
+	buf := memory.Parser.Builder()
+	defer memory.Parser.PutBuilder(buf)
+
+	if c.lines == nil {
+		c.lines = make(map[string]int)
+	}
+	if c.comments == nil {
+		c.comments = make(map[string]string)
+	}
+
+	var section string
+	var scopes []tskScope
+	var listKey string
+	// comment collects the comment lines above the next declaration
+	var comment, pending []string
+	document := func(key string) {
+		if len(pending) > 0 {
+			c.comments[key] = strings.Join(pending, "\n")
+		}
+	}
+	// keyOf joins the section, the enclosing scopes and name with dots,
+	// allocating only the result
+	keyOf := func(name string) string {
+		if section == "" && len(scopes) == 0 {
+			return name
+		}
+		buf.Reset()
+		buf.WriteString(section)
+		for _, scope := range scopes {
+			if buf.Length() > 0 {
+				buf.WriteString(".")
+			}
+			buf.WriteString(scope.name)
+		}
+		if buf.Length() > 0 {
+			buf.WriteString(".")
+		}
+		buf.WriteString(name)
+		return buf.String()
+	}
+
 	for lineNum, line := range lines {
 		lineNum++ // 1-based line numbers
-		line = strings.TrimSpace(line)
-		
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if text, ok := strings.CutPrefix(strings.TrimSpace(line), "#"); ok {
+			comment = append(comment, strings.TrimSpace(text))
+			continue
+		}
+		line = strings.TrimSpace(stripComment(line))
+
+		// Skip empty lines, which also detach comments from what follows
+		if line == "" {
+			comment = nil
 			continue
 		}
-		
+		pending, comment = comment, nil
+
+		// Close brace/angle blocks
+		if line == "}" || line == "<" {
+			for len(scopes) > 0 {
+				top := scopes[len(scopes)-1]
+				scopes = scopes[:len(scopes)-1]
+				if top.block {
+					break
+				}
+			}
+			listKey = ""
+			continue
+		}
+
+		// Indented scopes end when indentation returns to their level
+		for len(scopes) > 0 && !scopes[len(scopes)-1].block && indent <= scopes[len(scopes)-1].indent {
+			scopes = scopes[:len(scopes)-1]
+		}
+
+		// Section headers reset all nesting
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") && !strings.Contains(line, ":") {
+			var strategy MergeStrategy
+			section, strategy = splitMergeAnnotation(strings.TrimSpace(line[1 : len(line)-1]))
+			document(section)
+			if strategy == MergeReplace {
+				c.annotate(section, strategy)
+			}
+			scopes = nil
+			listKey = ""
+			continue
+		}
+
+		// List items belong to the most recent empty-valued key
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			if listKey == "" {
+				return tskerrors.New(tskerrors.Parse, "line %d: list item without a parent key", lineNum)
+			}
+			items, _ := c.values[listKey].([]interface{})
+			c.values[listKey] = append(items, c.parseValue(strings.TrimSpace(strings.TrimPrefix(line, "-"))))
+			continue
+		}
+
+		// Block openers: `name {` and `name >`
+		if strings.HasSuffix(line, "{") || strings.HasSuffix(line, ">") {
+			name := strings.TrimSpace(strings.TrimRight(line[:len(line)-1], " :"))
+			if name != "" && !strings.ContainsAny(name, " \t") {
+				document(keyOf(name))
+				scopes = append(scopes, tskScope{name: name, indent: indent, block: true})
+				listKey = ""
+				continue
+			}
+		}
+
 		// Parse key-value pair
 		colonIndex := strings.Index(line, ":")
 		if colonIndex == -1 {
 			continue // Skip invalid lines
 		}
-		
-		key := strings.TrimSpace(line[:colonIndex])
+
+		name, strategy := splitMergeAnnotation(strings.TrimSpace(line[:colonIndex]))
+		key := keyOf(name)
 		valueStr := strings.TrimSpace(line[colonIndex+1:])
-		
-		// Parse value
-		value := c.parseValue(valueStr)
-		c.values[key] = value
+		c.annotate(key, strategy)
+		document(key)
+
+		// An empty value opens an indented map or list
+		if valueStr == "" {
+			scopes = append(scopes, tskScope{name: name, indent: indent})
+			listKey = key
+			c.lines[key] = lineNum
+			continue
+		}
+
+		listKey = ""
+		c.values[key] = c.parseValue(valueStr)
+		c.lines[key] = lineNum
 	}
-	
+
 	return nil
 }
 
+// appendLines appends the lines of s to dst, as strings.Split(s, "\n")
+// would return them
+func appendLines(dst []string, s string) []string {
+	for {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			return append(dst, s)
+		}
+		dst = append(dst, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// tskScope tracks one level of nesting while parsing TSK content
+type tskScope struct {
+	name   string
+	indent int
+	block  bool
+}
+
+// joinKey joins a prefix and key with a dot
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// stripComment removes a trailing # comment that is not inside quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
 // parseValue parses a TSK value string
 func (c *Config) parseValue(valueStr string) interface{} {
-	// Remove quotes if present
-	valueStr = strings.Trim(valueStr, `"'`)
-	
-	// Try to parse as number
-	if num, err := strconv.Atoi(valueStr); err == nil {
-		return num
+	return ParseValue(valueStr)
+}
+
+// ParseValue parses a TSK literal into a string, int, float64, bool, nil or
+// []interface{}. Operator expressions such as @env("X") are kept as strings.
+func ParseValue(valueStr string) interface{} {
+	valueStr = strings.TrimSpace(valueStr)
+
+	// Quoted values are always strings
+	if len(valueStr) >= 2 {
+		first, last := valueStr[0], valueStr[len(valueStr)-1]
+		if first == '"' && last == '"' {
+			if unquoted, err := strconv.Unquote(valueStr); err == nil {
+				return unquoted
+			}
+			return valueStr[1 : len(valueStr)-1]
+		}
+		if first == '\'' && last == '\'' {
+			return valueStr[1 : len(valueStr)-1]
+		}
 	}
-	
-	if num, err := strconv.ParseFloat(valueStr, 64); err == nil {
-		return num
+
+	// Inline arrays
+	if strings.HasPrefix(valueStr, "[") && strings.HasSuffix(valueStr, "]") {
+		inner := strings.TrimSpace(valueStr[1 : len(valueStr)-1])
+		items := []interface{}{}
+		if inner == "" {
+			return items
+		}
+		parts := memory.Parser.Tokens()
+		defer memory.Parser.PutTokens(parts)
+		*parts = splitTopLevel(*parts, inner, ',')
+		for _, item := range *parts {
+			items = append(items, ParseValue(item))
+		}
+		return items
 	}
-	
+
+	// Try to parse as number. Plain strings skip strconv, whose errors
+	// allocate.
+	if maybeNumber(valueStr) {
+		if isInteger(valueStr) {
+			if num, err := strconv.Atoi(valueStr); err == nil {
+				return num
+			}
+		}
+
+		if num, err := strconv.ParseFloat(valueStr, 64); err == nil {
+			return num
+		}
+	}
+
 	// Try to parse as boolean
-	switch strings.ToLower(valueStr) {
-	case "true":
+	switch {
+	case strings.EqualFold(valueStr, "true"):
 		return true
-	case "false":
+	case strings.EqualFold(valueStr, "false"):
 		return false
+	case strings.EqualFold(valueStr, "null"), strings.EqualFold(valueStr, "nil"):
+		return nil
 	}
-	
+
 	// Return as string
 	return valueStr
 }
 
+// maybeNumber reports whether strconv could parse s as a number: it starts
+// with a digit, a sign or a dot, or spells infinity or NaN
+func maybeNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	switch c := s[0]; {
+	case c >= '0' && c <= '9', c == '-', c == '+', c == '.':
+		return true
+	}
+	return strings.EqualFold(s, "inf") || strings.EqualFold(s, "infinity") || strings.EqualFold(s, "nan")
+}
+
+// isInteger reports whether s is a sign and decimal digits only
+func isInteger(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// splitTopLevel appends the parts of s split on sep to parts, ignoring
+// separators inside quotes or brackets
+func splitTopLevel(parts []string, s string, sep rune) []string {
+	var quote rune
+	depth, start := 0, 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[' || r == '{' || r == '(':
+			depth++
+		case r == ']' || r == '}' || r == ')':
+			depth--
+		case r == sep && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
 // toTSK converts configuration to TSK format
 func (c *Config) toTSK() []byte {
 	var sb strings.Builder
@@ -256,13 +647,59 @@ func (c *Config) toTSK() []byte {
 	sb.WriteString("# TuskLang Configuration\n")
 	sb.WriteString("# Generated by TuskLang Go SDK\n\n")
 	
-	for key, value := range c.values {
-		sb.WriteString(fmt.Sprintf("%s: %v\n", key, value))
+	keys := c.Keys()
+	sort.Strings(keys)
+
+	// Top-level keys first, then one [section] per leading key segment
+	for _, key := range keys {
+		if !strings.Contains(key, ".") {
+			sb.WriteString(fmt.Sprintf("%s: %s\n", key, FormatValue(c.values[key])))
+		}
+	}
+
+	section := ""
+	for _, key := range keys {
+		dot := strings.Index(key, ".")
+		if dot == -1 {
+			continue
+		}
+		if key[:dot] != section {
+			section = key[:dot]
+			sb.WriteString(fmt.Sprintf("\n[%s]\n", section))
+		}
+		sb.WriteString(fmt.Sprintf("%s: %s\n", key[dot+1:], FormatValue(c.values[key])))
 	}
 	
 	return []byte(sb.String())
 }
 
+// FormatValue renders a value using TSK literal syntax, quoting strings so
+// that they round-trip through the parser with the same type
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = FormatValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case []string:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = strconv.Quote(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
 // GetDefaultConfig returns default configuration
 func GetDefaultConfig() *Config {
 	config := New()
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+func parse(t *testing.T, content string) *Config {
+	t.Helper()
+	c := New()
+	if err := c.LoadTSK([]byte(content)); err != nil {
+		t.Fatalf("LoadTSK: %v", err)
+	}
+	return c
+}
+
+func TestParseTSKSections(t *testing.T) {
+	c := parse(t, `name: "app"
+
+[database]
+host: "db.internal"
+port: 5432
+
+[cache =]
+ttl: 60
+server {
+    listen: 8080
+    tls >
+        cert: "server.pem"
+    <
+    workers: 4
+}
+limits:
+    requests: 100
+    burst: 10
+features +=:
+    - "beta"
+    - 'audit'
+after: true
+`)
+	want := map[string]interface{}{
+		"name":                  "app",
+		"database.host":         "db.internal",
+		"database.port":         5432,
+		"cache.ttl":             60,
+		"cache.server.listen":   8080,
+		"cache.server.tls.cert": "server.pem",
+		"cache.server.workers":  4,
+		"cache.limits.requests": 100,
+		"cache.limits.burst":    10,
+		"cache.features":        []interface{}{"beta", "audit"},
+		"cache.after":           true,
+	}
+	if !reflect.DeepEqual(c.Values(), want) {
+		t.Errorf("values = %#v\nwant %#v", c.Values(), want)
+	}
+	if got := c.MergeAnnotations(); !reflect.DeepEqual(got, map[string]MergeStrategy{"cache": MergeReplace, "cache.features": MergeAppend}) {
+		t.Errorf("merge annotations = %v", got)
+	}
+	for key, line := range map[string]int{"name": 1, "database.port": 5, "cache.server.tls.cert": 12, "cache.features": 19, "cache.after": 22} {
+		if got := c.Line(key); got != line {
+			t.Errorf("Line(%s) = %d, want %d", key, got, line)
+		}
+	}
+}
+
+func TestParseTSKComments(t *testing.T) {
+	c := parse(t, `# The name shown in the UI
+# and in logs
+name: "app # not a comment" # a comment
+color: '#fff'
+url: "http://example.com/#anchor"
+tag: v1#2
+hash: # only a comment
+
+# Detached by the blank line
+
+[database]
+# The primary
+host: localhost # trailing
+`)
+	for key, want := range map[string]interface{}{
+		"name":          "app # not a comment",
+		"color":         "#fff",
+		"url":           "http://example.com/#anchor",
+		"tag":           "v1#2",
+		"database.host": "localhost",
+	} {
+		if got := c.Get(key); got != want {
+			t.Errorf("%s = %#v, want %#v", key, got, want)
+		}
+	}
+	// A key whose value is only a comment opens an (empty) map
+	if c.Has("hash") {
+		t.Errorf("hash = %#v, want no value", c.Get("hash"))
+	}
+	want := map[string]string{"name": "The name shown in the UI\nand in logs", "database.host": "The primary"}
+	if !reflect.DeepEqual(c.Comments(), want) {
+		t.Errorf("comments = %q, want %q", c.Comments(), want)
+	}
+}
+
+func TestParseTSKNested(t *testing.T) {
+	c := parse(t, `matrix: [[1, 2], [3, [4, 5]]]
+names: ["a, b", 'c]', "d"]
+mixed: [1, 2.5, "three", true, null, []]
+objects: [{a: 1, b: 2}, {c: 3}]
+app {
+    db {
+        pool {
+            max: 20
+        }
+        replicas: ["r1", "r2"]
+    }
+    name: "nested"
+}
+top: 1
+`)
+	want := map[string]interface{}{
+		"matrix":          []interface{}{[]interface{}{1, 2}, []interface{}{3, []interface{}{4, 5}}},
+		"names":           []interface{}{"a, b", "c]", "d"},
+		"mixed":           []interface{}{1, 2.5, "three", true, nil, []interface{}{}},
+		"objects":         []interface{}{"{a: 1, b: 2}", "{c: 3}"},
+		"app.db.pool.max": 20,
+		"app.db.replicas": []interface{}{"r1", "r2"},
+		"app.name":        "nested",
+		"top":             1,
+	}
+	if !reflect.DeepEqual(c.Values(), want) {
+		t.Errorf("values = %#v\nwant %#v", c.Values(), want)
+	}
+	tree := c.Tree()
+	if max := tree["app"].(map[string]interface{})["db"].(map[string]interface{})["pool"].(map[string]interface{})["max"]; max != 20 {
+		t.Errorf("Tree() app.db.pool.max = %#v", max)
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want interface{}
+	}{
+		// Quoted values are always strings, whatever they spell
+		{`"42"`, "42"},
+		{`'42'`, "42"},
+		{`"3.14"`, "3.14"},
+		{`"true"`, "true"},
+		{`'false'`, "false"},
+		{`"null"`, "null"},
+		{`"[1, 2]"`, "[1, 2]"},
+		{`""`, ""},
+		{`"a\tb"`, "a\tb"},
+		{`'a\tb'`, `a\tb`},
+		{`"unterminated \"`, `unterminated \`},
+		{`["1", 1]`, []interface{}{"1", 1}},
+		// Unquoted values are typed
+		{"42", 42},
+		{"-7", -7},
+		{"3.14", 3.14},
+		{"1e3", 1000.0},
+		{"TRUE", true},
+		{"false", false},
+		{"null", nil},
+		{"nil", nil},
+		{"9223372036854775808", 9223372036854775808.0},
+		{"hello world", "hello world"},
+		{`@env("HOME")`, `@env("HOME")`},
+		{"1.2.3", "1.2.3"},
+	} {
+		if got := ParseValue(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseValue(%s) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+
+	// Quoted strings survive a save and reload with their type
+	c := parse(t, `[app]
+version: "1.0"
+port: "8080"
+debug: "false"
+`)
+	reloaded := parse(t, string(c.toTSK()))
+	if !reflect.DeepEqual(reloaded.Values(), c.Values()) {
+		t.Errorf("round trip = %#v, want %#v", reloaded.Values(), c.Values())
+	}
+}
+
+func TestParseTSKErrors(t *testing.T) {
+	err := New().LoadTSK([]byte("name: \"app\"\n- orphan\n"))
+	if tskerrors.KindOf(err) != tskerrors.Parse {
+		t.Errorf("list item without a key: %v, want a parse error", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	lines := []string{
+		`[db =] # primary`,
+		`host: "a # b"  # trailing`,
+		`pool {`,
+		`    max +=: 20`,
+		`}`,
+		`tags:`,
+		`    - "x"`,
+		`[ ]`,
+		`top: 1`,
+	}
+	want := []Decl{
+		{Kind: DeclSection, Line: 1, Name: "db", NameStart: 1},
+		{Kind: DeclKey, Line: 2, Prefix: []string{"db"}, Name: "host", Value: `"a # b"`, ValueStart: 6, ValueEnd: 13},
+		{Kind: DeclBlock, Line: 3, Prefix: []string{"db"}, Name: "pool"},
+		{Kind: DeclKey, Line: 4, Prefix: []string{"db", "pool"}, Name: "max", NameStart: 4, Value: "20", ValueStart: 12, ValueEnd: 14},
+		{Kind: DeclKey, Line: 6, Prefix: []string{"db"}, Name: "tags", ValueStart: 5, ValueEnd: 5},
+		{Kind: DeclItem, Line: 7, Prefix: []string{"db", "tags"}, Value: `"x"`, ValueStart: 6, ValueEnd: 9},
+		{Kind: DeclSection, Line: 8, NameStart: 2},
+		{Kind: DeclKey, Line: 9, Name: "top", Value: "1", ValueStart: 5, ValueEnd: 6},
+	}
+	if got := Scan(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan = %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package config
+
+import "strings"
+
+// DeclKind is what a line of TSK content declares
+type DeclKind int
+
+const (
+	// DeclSection is a [name] header
+	DeclSection DeclKind = iota
+	// DeclBlock opens a name { or name > block
+	DeclBlock
+	// DeclKey is a name: value pair, or name: opening a map or list
+	DeclKey
+	// DeclItem is a - value list item
+	DeclItem
+)
+
+// Decl is one declaration of TSK content and where it is written, so tools
+// can edit the lines in place
+type Decl struct {
+	Kind DeclKind
+	// Line is the 1-based line of the declaration
+	Line int
+	// Prefix is the path of the section and blocks enclosing the declaration
+	Prefix []string
+	// Name is the name as written, without a merge annotation; it may be
+	// dotted. Items have none.
+	Name string
+	// NameStart is the byte offset of Name in the line
+	NameStart int
+	// Value is the value of a key or item, without a trailing comment;
+	// ValueStart and ValueEnd delimit it in the line
+	Value                string
+	ValueStart, ValueEnd int
+}
+
+// Scan returns the declarations of TSK lines in order. It follows the
+// nesting rules of LoadTSK, so a declaration's Prefix and Name make up
+// the key LoadTSK stores its value under.
+func Scan(lines []string) []Decl {
+	var decls []Decl
+	var section []string
+	var scopes []tskScope
+	for i, raw := range lines {
+		code := stripComment(raw)
+		indent := len(raw) - len(strings.TrimLeft(raw, " \t"))
+		line := strings.TrimSpace(code)
+		if line == "" {
+			continue
+		}
+
+		if line == "}" || line == "<" {
+			for len(scopes) > 0 {
+				top := scopes[len(scopes)-1]
+				scopes = scopes[:len(scopes)-1]
+				if top.block {
+					break
+				}
+			}
+			continue
+		}
+
+		for len(scopes) > 0 && !scopes[len(scopes)-1].block && indent <= scopes[len(scopes)-1].indent {
+			scopes = scopes[:len(scopes)-1]
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") && !strings.Contains(line, ":") {
+			open := strings.IndexByte(raw, '[') + 1
+			inner := raw[open:strings.LastIndexByte(code, ']')]
+			name, _ := splitMergeAnnotation(strings.TrimSpace(inner))
+			start := open + len(inner) - len(strings.TrimLeft(inner, " \t"))
+			decls = append(decls, Decl{Kind: DeclSection, Line: i + 1, Name: name, NameStart: start})
+			section = nil
+			if name != "" {
+				section = strings.Split(name, ".")
+			}
+			scopes = nil
+			continue
+		}
+
+		prefix := append([]string(nil), section...)
+		for _, sc := range scopes {
+			prefix = append(prefix, strings.Split(sc.name, ".")...)
+		}
+
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			decls = append(decls, withValue(Decl{Kind: DeclItem, Line: i + 1, Prefix: prefix}, code, indent+1))
+			continue
+		}
+
+		if strings.HasSuffix(line, "{") || strings.HasSuffix(line, ">") {
+			name := strings.TrimSpace(strings.TrimRight(line[:len(line)-1], " :"))
+			if name != "" && !strings.ContainsAny(name, " \t") {
+				decls = append(decls, Decl{Kind: DeclBlock, Line: i + 1, Prefix: prefix, Name: name, NameStart: indent})
+				scopes = append(scopes, tskScope{name: name, indent: indent, block: true})
+				continue
+			}
+		}
+
+		colon := strings.IndexByte(line, ':')
+		if colon == -1 {
+			continue
+		}
+		name, _ := splitMergeAnnotation(strings.TrimSpace(line[:colon]))
+		decl := withValue(Decl{Kind: DeclKey, Line: i + 1, Prefix: prefix, Name: name, NameStart: indent}, code, indent+colon+1)
+		decls = append(decls, decl)
+		if decl.Value == "" {
+			scopes = append(scopes, tskScope{name: name, indent: indent})
+		}
+	}
+	return decls
+}
+
+// withValue sets the value of d to what follows from in code
+func withValue(d Decl, code string, from int) Decl {
+	rest := code[from:]
+	d.ValueStart = from + len(rest) - len(strings.TrimLeft(rest, " \t"))
+	d.ValueEnd = len(strings.TrimRight(code, " \t\r"))
+	if d.ValueEnd < d.ValueStart {
+		d.ValueEnd = d.ValueStart
+	}
+	d.Value = code[d.ValueStart:d.ValueEnd]
+	return d
+}
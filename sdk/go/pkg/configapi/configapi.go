@@ -0,0 +1,424 @@
+// Package configapi serves a peanut configuration hierarchy over HTTP, for
+// `tsk serve --api`:
+//
+//	GET    /v1/config             the evaluated configuration, nested
+//	GET    /v1/config/{key}       one value or subtree, by dotted key path
+//	PUT    /v1/config/{key}       override a value with a JSON body
+//	DELETE /v1/config/{key}       drop an override
+//	GET    /v1/hierarchy          the files merged and the origin of each key
+//	GET    /v1/watch              a WebSocket of changes, as JSON patches
+//	GET    /v1/openapi.json       the OpenAPI description of the above
+//
+// The hierarchy is reloaded as its files change, and on Reload. Overrides live in memory,
+// on top of the files, until the server stops; with a token set, writes
+// need an "Authorization: Bearer <token>" header. Options.Authorize adds a
+// permission check to each route.
+package configapi
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// maxBody caps the size of a PUT body
+const maxBody = 1 << 20
+
+// Options configures a Server
+type Options struct {
+	// Token, when set, is required for writes
+	Token string
+	// Heartbeat is how often idle /v1/watch clients get a heartbeat;
+	// zero means 30s
+	Heartbeat time.Duration
+	// Poll re-evaluates the configuration this often, so changes of remote
+	// sources such as @http or @s3.get reach /v1/watch; zero disables it
+	Poll time.Duration
+	// Authorize, when set, is asked whether the caller of r may use route,
+	// such as "PUT /v1/config/{key}"; an error is answered with 403 after
+	// the token check
+	Authorize func(r *http.Request, route string) error
+}
+
+// Server answers the API for the hierarchy of a directory
+type Server struct {
+	dir     string
+	opts    Options
+	watcher *peanut.Watcher
+	mux     *http.ServeMux
+	feed    *feed
+	done    chan struct{}
+	stopped chan struct{}
+
+	mu        sync.RWMutex
+	overrides map[string]interface{}
+}
+
+// NewServer loads the hierarchy of dir and watches it
+func NewServer(dir string, opts Options) (*Server, error) {
+	if opts.Heartbeat <= 0 {
+		opts.Heartbeat = 30 * time.Second
+	}
+	s := &Server{
+		dir:       dir,
+		opts:      opts,
+		overrides: make(map[string]interface{}),
+		feed:      newFeed(),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	w, err := peanut.Watch(dir, func(change peanut.ConfigChange) {
+		if change.Err != nil {
+			s.feed.fail(change.Trigger, change.Err)
+			return
+		}
+		s.refresh(change.Config, "file", change.Trigger)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.watcher = w
+	s.refresh(w.Config(), "file", "")
+
+	s.mux = http.NewServeMux()
+	s.handle("GET /v1/config", s.getConfig)
+	s.handle("GET /v1/config/{key}", s.getKey)
+	s.handle("PUT /v1/config/{key}", s.putKey)
+	s.handle("DELETE /v1/config/{key}", s.deleteKey)
+	s.handle("GET /v1/hierarchy", s.getHierarchy)
+	s.handle("GET /v1/watch", s.watch)
+	s.handle("GET /v1/openapi.json", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(openAPISpec)
+	})
+	go s.poll()
+	return s, nil
+}
+
+// Close stops watching the hierarchy and disconnects /v1/watch clients
+func (s *Server) Close() error {
+	close(s.done)
+	<-s.stopped
+	err := s.watcher.Close()
+	s.feed.close()
+	return err
+}
+
+// Reload reads the hierarchy again and re-evaluates it, publishing what
+// changed to /v1/watch. Requests in flight are answered meanwhile.
+func (s *Server) Reload() error {
+	if err := s.watcher.Reload(); err != nil {
+		return err
+	}
+	return s.refresh(s.watcher.Config(), "reload", "")
+}
+
+// poll re-evaluates the configuration every opts.Poll
+func (s *Server) poll() {
+	defer close(s.stopped)
+	if s.opts.Poll <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.opts.Poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.refresh(s.watcher.Config(), "poll", "")
+		}
+	}
+}
+
+// refresh evaluates cfg and publishes what changed to /v1/watch
+func (s *Server) refresh(cfg *peanut.Config, source, trigger string) error {
+	values, err := s.evaluate(cfg)
+	if err != nil {
+		s.feed.fail(trigger, err)
+		return err
+	}
+	s.feed.publish(values, source, trigger)
+	return nil
+}
+
+// Files returns the files of the hierarchy, root first
+func (s *Server) Files() []string {
+	return s.watcher.Files()
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(rw, r)
+}
+
+// values evaluates the hierarchy and applies the overrides
+func (s *Server) values() (map[string]interface{}, error) {
+	return s.evaluate(s.watcher.Config())
+}
+
+// evaluate evaluates cfg and applies the overrides
+func (s *Server) evaluate(cfg *peanut.Config) (map[string]interface{}, error) {
+	values, err := cfg.Execute(peanut.NewVM())
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.overrides))
+	for key := range s.overrides {
+		keys = append(keys, key)
+	}
+	// Shorter keys first, so an override of a subtree does not erase a
+	// more specific one
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) < len(keys[j]) })
+	for _, key := range keys {
+		removeKey(values, key)
+		if tree, ok := s.overrides[key].(map[string]interface{}); ok {
+			for k, v := range config.Flatten(tree) {
+				values[key+"."+k] = v
+			}
+			continue
+		}
+		values[key] = s.overrides[key]
+	}
+	return values, nil
+}
+
+// removeKey deletes key and everything under it
+func removeKey(values map[string]interface{}, key string) {
+	for k := range values {
+		if k == key || strings.HasPrefix(k, key+".") {
+			delete(values, k)
+		}
+	}
+}
+
+func (s *Server) getConfig(rw http.ResponseWriter, r *http.Request) {
+	values, err := s.values()
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, config.Nest(values))
+}
+
+// keyResponse is the body of GET and PUT /v1/config/{key}
+type keyResponse struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+	// File is the file the value comes from, empty for overrides
+	File       string `json:"file,omitempty"`
+	Overridden bool   `json:"overridden,omitempty"`
+}
+
+func (s *Server) getKey(rw http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	values, err := s.values()
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	value, ok := lookup(values, key)
+	if !ok {
+		writeError(rw, http.StatusNotFound, fmt.Errorf("key %s not found", key))
+		return
+	}
+	resp := keyResponse{Key: key, Value: value, Overridden: s.overridden(key)}
+	if !resp.Overridden {
+		if origin, ok := s.watcher.Config().Origin(key); ok {
+			resp.File = origin.File
+		}
+	}
+	writeJSON(rw, http.StatusOK, resp)
+}
+
+// lookup returns the value of key, or the subtree under it
+func lookup(values map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := values[key]; ok {
+		return value, true
+	}
+	sub := make(map[string]interface{})
+	for k, v := range values {
+		if rest, ok := strings.CutPrefix(k, key+"."); ok {
+			sub[rest] = v
+		}
+	}
+	if len(sub) == 0 {
+		return nil, false
+	}
+	return config.Nest(sub), true
+}
+
+// overridden reports whether key or a parent of it is overridden
+func (s *Server) overridden(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k := range s.overrides {
+		if k == key || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) putKey(rw http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !validKey(key) {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("invalid key %q", key))
+		return
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxBody))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("body must be a JSON value: %w", err))
+		return
+	}
+	value = normalize(value)
+
+	s.mu.Lock()
+	// A new value for a subtree replaces the overrides inside it
+	for k := range s.overrides {
+		if strings.HasPrefix(k, key+".") {
+			delete(s.overrides, k)
+		}
+	}
+	s.overrides[key] = value
+	s.mu.Unlock()
+	s.refresh(s.watcher.Config(), "api", key)
+	writeJSON(rw, http.StatusOK, keyResponse{Key: key, Value: value, Overridden: true})
+}
+
+func (s *Server) deleteKey(rw http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	s.mu.Lock()
+	_, ok := s.overrides[key]
+	delete(s.overrides, key)
+	s.mu.Unlock()
+	if !ok {
+		writeError(rw, http.StatusNotFound, fmt.Errorf("key %s is not overridden", key))
+		return
+	}
+	s.refresh(s.watcher.Config(), "api", key)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// validKey reports whether key is a dotted path of non-empty segments
+func validKey(key string) bool {
+	for _, part := range strings.Split(key, ".") {
+		if part == "" || strings.ContainsAny(part, " \t\n/") {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize turns json.Numbers into ints where they are integral and
+// float64s otherwise
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalize(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+	}
+	return value
+}
+
+// hierarchyResponse is the body of GET /v1/hierarchy
+type hierarchyResponse struct {
+	Files   []string                    `json:"files"`
+	Origins map[string]peanut.KeyOrigin `json:"origins"`
+	Dropped []peanut.DroppedKey         `json:"dropped,omitempty"`
+	// Overrides are the keys set through the API
+	Overrides []string `json:"overrides,omitempty"`
+}
+
+func (s *Server) getHierarchy(rw http.ResponseWriter, r *http.Request) {
+	h, err := peanut.ResolveHierarchy(s.dir)
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	h.Config.Close()
+	resp := hierarchyResponse{Files: h.Files, Origins: h.Origins, Dropped: h.Dropped}
+	s.mu.RLock()
+	for key := range s.overrides {
+		resp.Overrides = append(resp.Overrides, key)
+	}
+	s.mu.RUnlock()
+	sort.Strings(resp.Overrides)
+	writeJSON(rw, http.StatusOK, resp)
+}
+
+// handle routes requests matching route to next, once Authorize allows
+// them. Writes need the bearer token first.
+func (s *Server) handle(route string, next http.HandlerFunc) {
+	handler := next
+	if s.opts.Authorize != nil {
+		handler = func(rw http.ResponseWriter, r *http.Request) {
+			if err := s.opts.Authorize(r, route); err != nil {
+				writeError(rw, http.StatusForbidden, err)
+				return
+			}
+			next(rw, r)
+		}
+	}
+	if !strings.HasPrefix(route, http.MethodGet+" ") {
+		handler = s.authorized(handler)
+	}
+	s.mux.HandleFunc(route, handler)
+}
+
+// authorized requires the bearer token, when one is set
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if s.opts.Token == "" {
+			next(rw, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1 {
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="tsk"`)
+			writeError(rw, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+			return
+		}
+		next(rw, r)
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	encoder := json.NewEncoder(rw)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func writeError(rw http.ResponseWriter, status int, err error) {
+	writeJSON(rw, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,278 @@
+package configapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func request(t *testing.T, h http.Handler, method, path, body, token string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var got map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	return rec.Code, got
+}
+
+func TestServer(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+	os.MkdirAll(app, 0755)
+	os.WriteFile(filepath.Join(root, "peanu.tsk"), []byte("[database]\nhost: \"localhost\"\nport: 5432\n"), 0644)
+	os.WriteFile(filepath.Join(app, "peanu.tsk"), []byte("[database]\nhost: \"db.internal\"\n\n[app]\nname: \"billing\"\n"), 0644)
+
+	s, err := NewServer(app, Options{Token: "secret"})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	defer s.Close()
+
+	code, got := request(t, s, "GET", "/v1/config", "", "")
+	want := map[string]interface{}{
+		"database": map[string]interface{}{"host": "db.internal", "port": float64(5432)},
+		"app":      map[string]interface{}{"name": "billing"},
+	}
+	if code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /v1/config = %d %v", code, got)
+	}
+
+	code, got = request(t, s, "GET", "/v1/config/database.host", "", "")
+	if code != http.StatusOK || got["value"] != "db.internal" || got["file"] != filepath.Join(app, "peanu.tsk") {
+		t.Errorf("GET /v1/config/database.host = %d %v", code, got)
+	}
+	if code, got = request(t, s, "GET", "/v1/config/database", "", ""); code != http.StatusOK ||
+		!reflect.DeepEqual(got["value"], want["database"]) {
+		t.Errorf("GET /v1/config/database = %d %v", code, got)
+	}
+	if code, _ = request(t, s, "GET", "/v1/config/cache.ttl", "", ""); code != http.StatusNotFound {
+		t.Errorf("GET of a missing key = %d, want 404", code)
+	}
+
+	if code, _ = request(t, s, "PUT", "/v1/config/database.port", "6432", ""); code != http.StatusUnauthorized {
+		t.Errorf("PUT without a token = %d, want 401", code)
+	}
+	if code, _ = request(t, s, "PUT", "/v1/config/database.port", "6432", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("PUT with a wrong token = %d, want 401", code)
+	}
+	if code, _ = request(t, s, "PUT", "/v1/config/database.port", "{", "secret"); code != http.StatusBadRequest {
+		t.Errorf("PUT of invalid JSON = %d, want 400", code)
+	}
+	if code, got = request(t, s, "PUT", "/v1/config/database.port", "6432", "secret"); code != http.StatusOK || got["value"] != float64(6432) {
+		t.Errorf("PUT = %d %v", code, got)
+	}
+	if code, got = request(t, s, "PUT", "/v1/config/cache", `{"ttl": "5m", "backends": ["redis"]}`, "secret"); code != http.StatusOK {
+		t.Errorf("PUT of an object = %d %v", code, got)
+	}
+	code, got = request(t, s, "GET", "/v1/config/database.port", "", "")
+	if got["value"] != float64(6432) || got["overridden"] != true || got["file"] != nil {
+		t.Errorf("GET of an overridden key = %d %v", code, got)
+	}
+	if _, got = request(t, s, "GET", "/v1/config/cache.ttl", "", ""); got["value"] != "5m" {
+		t.Errorf("GET of a key inside an overridden object = %v", got)
+	}
+
+	if code, got = request(t, s, "GET", "/v1/hierarchy", "", ""); code != http.StatusOK ||
+		len(got["files"].([]interface{})) != 2 || !reflect.DeepEqual(got["overrides"], []interface{}{"cache", "database.port"}) {
+		t.Errorf("GET /v1/hierarchy = %d %v", code, got)
+	}
+	origin := got["origins"].(map[string]interface{})["database.host"].(map[string]interface{})
+	if origin["file"] != filepath.Join(app, "peanu.tsk") || len(origin["chain"].([]interface{})) != 2 {
+		t.Errorf("unexpected origin of database.host: %v", origin)
+	}
+
+	if code, _ = request(t, s, "DELETE", "/v1/config/database.port", "", "secret"); code != http.StatusNoContent {
+		t.Errorf("DELETE = %d, want 204", code)
+	}
+	if _, got = request(t, s, "GET", "/v1/config/database.port", "", ""); got["value"] != float64(5432) {
+		t.Errorf("DELETE should restore the file's value, got %v", got)
+	}
+	if code, _ = request(t, s, "DELETE", "/v1/config/database.port", "", "secret"); code != http.StatusNotFound {
+		t.Errorf("DELETE of a key without an override = %d, want 404", code)
+	}
+
+	if code, got = request(t, s, "GET", "/v1/openapi.json", "", ""); code != http.StatusOK || got["openapi"] != "3.0.3" {
+		t.Errorf("GET /v1/openapi.json = %d", code)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "peanu.tsk")
+	os.WriteFile(file, []byte("[database]\nhost: \"localhost\"\nport: 5432\n\n[app]\nname: \"billing\"\n"), 0644)
+	s, err := NewServer(dir, Options{Heartbeat: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	dial := func(query string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/watch?"+query, nil)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	// next returns the next message that is not a heartbeat
+	next := func(conn *websocket.Conn) WatchMessage {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var msg WatchMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if msg.Type != "heartbeat" {
+				return msg
+			}
+		}
+	}
+	patch := func(msg WatchMessage) string {
+		data, _ := json.Marshal(msg.Patch)
+		return string(data)
+	}
+
+	conn := dial("prefix=database")
+	snapshot := next(conn)
+	if snapshot.Type != "snapshot" || !reflect.DeepEqual(snapshot.Value,
+		map[string]interface{}{"database": map[string]interface{}{"host": "localhost", "port": float64(5432)}}) {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+
+	os.WriteFile(file, []byte("[database]\nhost: \"db.internal\"\nport: 5432\n\n[app]\nname: \"payments\"\n"), 0644)
+	msg := next(conn)
+	if msg.Type != "patch" || msg.Source != "file" || patch(msg) != `[{"op":"replace","path":"/database/host","value":"db.internal"}]` {
+		t.Errorf("unexpected file patch: %+v", msg)
+	}
+	resume := msg.Resume
+
+	request(t, s, "PUT", "/v1/config/app.name", `"ignored"`, "")
+	request(t, s, "PUT", "/v1/config/database.pool", `{"max": 10}`, "")
+	msg = next(conn)
+	if msg.Source != "api" || patch(msg) != `[{"op":"add","path":"/database/pool","value":{"max":10}}]` {
+		t.Errorf("changes outside the prefix should not be sent, got %+v", msg)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var heartbeat WatchMessage
+	if err := conn.ReadJSON(&heartbeat); err != nil || heartbeat.Type != "heartbeat" || heartbeat.Resume != msg.Resume {
+		t.Errorf("expected a heartbeat, got %+v, %v", heartbeat, err)
+	}
+
+	// A client resuming gets what it missed as one patch; the pool added
+	// and removed meanwhile cancels out
+	conn.Close()
+	request(t, s, "DELETE", "/v1/config/database.pool", "", "")
+	request(t, s, "PUT", "/v1/config/database.port", "6543", "")
+	resumed := dial("prefix=database&resume=" + resume)
+	msg = next(resumed)
+	if msg.Type != "patch" || msg.Version != snapshot.Version+5 || patch(msg) != `[{"op":"replace","path":"/database/port","value":6543}]` {
+		t.Errorf("unexpected resume: %+v", msg)
+	}
+	stale := dial("prefix=database&resume=0000-1")
+	if msg = next(stale); msg.Type != "snapshot" {
+		t.Errorf("a token of another instance should get a snapshot, got %+v", msg)
+	}
+
+	resumed.WriteJSON(map[string]interface{}{"subscribe": []string{"app"}})
+	if msg = next(resumed); msg.Type != "snapshot" || !reflect.DeepEqual(msg.Value,
+		map[string]interface{}{"app": map[string]interface{}{"name": "ignored"}}) {
+		t.Errorf("unexpected snapshot after subscribe: %+v", msg)
+	}
+	resumed.WriteJSON(map[string]interface{}{"subscribe": []string{"bad key"}})
+	if msg = next(resumed); msg.Type != "error" {
+		t.Errorf("expected an error for an invalid prefix, got %+v", msg)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte("[app]\nmode: @env(\"TSK_CONFIGAPI_MODE\", \"dev\")\n"), 0644)
+	s, err := NewServer(dir, Options{})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/watch", nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg WatchMessage
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "snapshot" {
+		t.Fatalf("expected a snapshot, got %+v, %v", msg, err)
+	}
+
+	// Nothing on disk changed, but the values it evaluates to did
+	t.Setenv("TSK_CONFIGAPI_MODE", "prod")
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := conn.ReadJSON(&msg); err != nil || msg.Source != "reload" {
+		t.Fatalf("expected a reload patch, got %+v, %v", msg, err)
+	}
+	if data, _ := json.Marshal(msg.Patch); string(data) != `[{"op":"replace","path":"/app/mode","value":"prod"}]` {
+		t.Errorf("unexpected patch: %s", data)
+	}
+	if code, got := request(t, s, "GET", "/v1/config/app.mode", "", ""); code != http.StatusOK || got["value"] != "prod" {
+		t.Errorf("GET after reload = %d %v", code, got)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte("[app]\nname: \"billing\"\n"), 0644)
+	var routes []string
+	s, err := NewServer(dir, Options{Token: "secret", Authorize: func(r *http.Request, route string) error {
+		routes = append(routes, route)
+		if r.Header.Get("X-Tsk-User") != "ada" && route != "GET /v1/openapi.json" {
+			return errors.New("access denied")
+		}
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	defer s.Close()
+
+	if code, got := request(t, s, "GET", "/v1/config/app.name", "", ""); code != http.StatusForbidden || got["error"] != "access denied" {
+		t.Errorf("GET without a user = %d %v, want 403", code, got)
+	}
+	if code, _ := request(t, s, "GET", "/v1/openapi.json", "", ""); code != http.StatusOK {
+		t.Errorf("GET /v1/openapi.json = %d, want 200", code)
+	}
+	// The token is checked before the permission
+	if code, _ := request(t, s, "PUT", "/v1/config/app.name", `"api"`, ""); code != http.StatusUnauthorized {
+		t.Errorf("PUT without a token = %d, want 401", code)
+	}
+	req := httptest.NewRequest("PUT", "/v1/config/app.name", strings.NewReader(`"api"`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Tsk-User", "ada")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("PUT as ada = %d %s", rec.Code, rec.Body)
+	}
+	want := []string{"GET /v1/config/{key}", "GET /v1/openapi.json", "PUT /v1/config/{key}"}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("routes checked = %q, want %q", routes, want)
+	}
+}
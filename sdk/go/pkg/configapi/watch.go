@@ -0,0 +1,404 @@
+package configapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/gorilla/websocket"
+)
+
+// historyLimit is how many revisions a resume token can go back
+const historyLimit = 256
+
+// sendBuffer is how many messages a slow client may fall behind before it
+// is disconnected; it can resume where it stopped
+const sendBuffer = 64
+
+// Operation is one RFC 6902 JSON Patch operation
+type Operation struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+// MarshalJSON writes the value of every operation but remove, null
+// included
+func (o Operation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(map[string]string{"op": o.Op, "path": o.Path})
+	}
+	return json.Marshal(map[string]interface{}{"op": o.Op, "path": o.Path, "value": o.Value})
+}
+
+// WatchMessage is a message of /v1/watch. Type is "snapshot", "patch",
+// "heartbeat" or "error". Resume is the token to reconnect with.
+type WatchMessage struct {
+	Type     string                 `json:"type"`
+	Version  uint64                 `json:"version,omitempty"`
+	Resume   string                 `json:"resume,omitempty"`
+	Prefixes []string               `json:"prefixes,omitempty"`
+	Value    map[string]interface{} `json:"value,omitempty"`
+	Patch    []Operation            `json:"patch,omitempty"`
+	// Source is what changed: "file", "api", "poll" or "reload"
+	Source  string `json:"source,omitempty"`
+	Trigger string `json:"trigger,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// revision is one published change of the configuration
+type revision struct {
+	version uint64
+	changes []peanut.KeyChange
+	source  string
+	trigger string
+}
+
+// feed keeps the evaluated configuration, its recent revisions and the
+// /v1/watch subscribers
+type feed struct {
+	mu          sync.Mutex
+	epoch       string
+	version     uint64
+	current     map[string]interface{}
+	history     []revision
+	subscribers map[*subscriber]bool
+}
+
+func newFeed() *feed {
+	epoch := make([]byte, 6)
+	rand.Read(epoch)
+	return &feed{
+		epoch:       hex.EncodeToString(epoch),
+		current:     make(map[string]interface{}),
+		subscribers: make(map[*subscriber]bool),
+	}
+}
+
+// token is the resume token of version; tokens of another server
+// instance are rejected
+func (f *feed) token(version uint64) string {
+	return f.epoch + "-" + strconv.FormatUint(version, 10)
+}
+
+// publish records values as a new revision, when they differ from the
+// current ones, and sends each subscriber the patch for its prefixes
+func (f *feed) publish(values map[string]interface{}, source, trigger string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	changes := peanut.Diff(f.current, values)
+	if len(changes) == 0 {
+		return
+	}
+	f.version++
+	f.current = values
+	rev := revision{version: f.version, changes: changes, source: source, trigger: trigger}
+	f.history = append(f.history, rev)
+	if len(f.history) > historyLimit {
+		f.history = f.history[len(f.history)-historyLimit:]
+	}
+	for sub := range f.subscribers {
+		if patch := f.patch(sub.prefixes, []revision{rev}); len(patch) > 0 {
+			f.send(sub, WatchMessage{Type: "patch", Version: f.version, Resume: f.token(f.version),
+				Patch: patch, Source: source, Trigger: trigger})
+		}
+	}
+}
+
+// fail tells every subscriber that the configuration could not be
+// reloaded; they keep the last good values
+func (f *feed) fail(trigger string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subscribers {
+		f.send(sub, WatchMessage{Type: "error", Version: f.version, Trigger: trigger, Error: err.Error()})
+	}
+}
+
+// send queues msg for sub, dropping a subscriber that fell too far behind
+func (f *feed) send(sub *subscriber, msg WatchMessage) {
+	select {
+	case sub.out <- msg:
+	default:
+		delete(f.subscribers, sub)
+		close(sub.out)
+	}
+}
+
+// subscribe registers sub and queues what it needs to catch up: the
+// patches since resume when they are still known, a snapshot otherwise
+func (f *feed) subscribe(sub *subscriber, resume string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribers[sub] = true
+	if revs, ok := f.since(resume); ok {
+		if patch := f.patch(sub.prefixes, revs); len(patch) > 0 {
+			last := revs[len(revs)-1]
+			f.send(sub, WatchMessage{Type: "patch", Version: f.version, Resume: f.token(f.version),
+				Patch: patch, Source: last.source, Trigger: last.trigger})
+		} else {
+			f.send(sub, WatchMessage{Type: "heartbeat", Version: f.version, Resume: f.token(f.version)})
+		}
+		return
+	}
+	f.snapshot(sub)
+}
+
+// resubscribe changes the prefixes of sub and sends it a new snapshot
+func (f *feed) resubscribe(sub *subscriber, prefixes []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.subscribers[sub] {
+		return
+	}
+	sub.prefixes = prefixes
+	f.snapshot(sub)
+}
+
+func (f *feed) snapshot(sub *subscriber) {
+	f.send(sub, WatchMessage{Type: "snapshot", Version: f.version, Resume: f.token(f.version),
+		Prefixes: sub.prefixes, Value: config.Nest(filterKeys(f.current, sub.prefixes))})
+}
+
+func (f *feed) heartbeat(sub *subscriber) {
+	f.notify(sub, WatchMessage{Type: "heartbeat"})
+}
+
+// notify sends msg, stamped with the current version, to sub
+func (f *feed) notify(sub *subscriber, msg WatchMessage) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subscribers[sub] {
+		msg.Version, msg.Resume = f.version, f.token(f.version)
+		f.send(sub, msg)
+	}
+}
+
+func (f *feed) unsubscribe(sub *subscriber) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subscribers[sub] {
+		delete(f.subscribers, sub)
+		close(sub.out)
+	}
+}
+
+// close disconnects every subscriber
+func (f *feed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subscribers {
+		delete(f.subscribers, sub)
+		close(sub.out)
+	}
+}
+
+// since returns the revisions after the one resume names. It fails for
+// tokens of another instance and revisions no longer in the history.
+func (f *feed) since(resume string) ([]revision, bool) {
+	epoch, version, ok := strings.Cut(resume, "-")
+	if !ok || epoch != f.epoch {
+		return nil, false
+	}
+	v, err := strconv.ParseUint(version, 10, 64)
+	if err != nil || v > f.version {
+		return nil, false
+	}
+	if v == f.version {
+		return nil, true
+	}
+	for i, rev := range f.history {
+		if rev.version == v+1 {
+			return f.history[i:], true
+		}
+	}
+	return nil, false
+}
+
+// patch turns revisions, oldest first and ending at the current values,
+// into the operations that bring a document of the keys under prefixes up
+// to date
+func (f *feed) patch(prefixes []string, revs []revision) []Operation {
+	after := filterKeys(f.current, prefixes)
+	before := make(map[string]interface{}, len(after))
+	for key, value := range after {
+		before[key] = value
+	}
+	for i := len(revs) - 1; i >= 0; i-- {
+		for _, change := range revs[i].changes {
+			if !matches(change.Key, prefixes) {
+				continue
+			}
+			if change.Kind == peanut.KeyAdded {
+				delete(before, change.Key)
+			} else {
+				before[change.Key] = change.Old
+			}
+		}
+	}
+	return diffTree(nil, "", config.Nest(before), config.Nest(after))
+}
+
+// diffTree appends the operations turning the object old into new
+func diffTree(ops []Operation, path string, old, new map[string]interface{}) []Operation {
+	keys := make([]string, 0, len(old)+len(new))
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range new {
+		if _, ok := old[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		p := path + "/" + escapePointer(key)
+		before, hadBefore := old[key]
+		after, hasAfter := new[key]
+		switch {
+		case !hasAfter:
+			ops = append(ops, Operation{Op: "remove", Path: p})
+		case !hadBefore:
+			ops = append(ops, Operation{Op: "add", Path: p, Value: after})
+		default:
+			beforeMap, ok1 := before.(map[string]interface{})
+			afterMap, ok2 := after.(map[string]interface{})
+			if ok1 && ok2 {
+				ops = diffTree(ops, p, beforeMap, afterMap)
+			} else if !reflect.DeepEqual(before, after) {
+				ops = append(ops, Operation{Op: "replace", Path: p, Value: after})
+			}
+		}
+	}
+	return ops
+}
+
+// escapePointer escapes a key for a JSON Pointer
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// filterKeys returns the values whose keys are under one of prefixes; no
+// prefixes keeps them all
+func filterKeys(values map[string]interface{}, prefixes []string) map[string]interface{} {
+	filtered := make(map[string]interface{})
+	for key, value := range values {
+		if matches(key, prefixes) {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// matches reports whether key is one of prefixes or under one of them
+func matches(key string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if key == prefix || strings.HasPrefix(key, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriber is one /v1/watch connection
+type subscriber struct {
+	prefixes []string
+	out      chan WatchMessage
+}
+
+// watchRequest is a message a client sends to change its prefixes
+type watchRequest struct {
+	Subscribe []string `json:"subscribe"`
+}
+
+var upgrader = websocket.Upgrader{}
+
+// watch serves /v1/watch?prefix=database&prefix=app.name&resume=<token>.
+// Clients get a snapshot, or the patches they missed when resuming, then a
+// patch per change and a heartbeat when idle. Sending {"subscribe":
+// [...]} replaces the prefixes and starts over with a snapshot.
+func (s *Server) watch(rw http.ResponseWriter, r *http.Request) {
+	prefixes, err := parsePrefixes(r.URL.Query()["prefix"])
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+	conn, err := upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub := &subscriber{prefixes: prefixes, out: make(chan WatchMessage, sendBuffer)}
+	s.feed.subscribe(sub, r.URL.Query().Get("resume"))
+	defer s.feed.unsubscribe(sub)
+
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				s.feed.unsubscribe(sub)
+				return
+			}
+			var req watchRequest
+			var prefixes []string
+			if err = json.Unmarshal(data, &req); err == nil {
+				prefixes, err = parsePrefixes(req.Subscribe)
+			}
+			if err != nil {
+				s.feed.notify(sub, WatchMessage{Type: "error", Error: fmt.Sprintf("invalid request: %v", err)})
+				continue
+			}
+			s.feed.resubscribe(sub, prefixes)
+		}
+	}()
+
+	heartbeat := time.NewTicker(s.opts.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case msg, ok := <-sub.out:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+			heartbeat.Reset(s.opts.Heartbeat)
+		case <-heartbeat.C:
+			s.feed.heartbeat(sub)
+		}
+	}
+}
+
+// parsePrefixes reads prefixes given repeated or comma-separated
+func parsePrefixes(values []string) ([]string, error) {
+	var prefixes []string
+	for _, value := range values {
+		for _, prefix := range strings.Split(value, ",") {
+			if prefix = strings.TrimSpace(prefix); prefix == "" {
+				continue
+			}
+			if !validKey(prefix) {
+				return nil, fmt.Errorf("invalid prefix %q", prefix)
+			}
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes, nil
+}
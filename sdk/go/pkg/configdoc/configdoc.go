@@ -0,0 +1,306 @@
+// Package configdoc generates reference documentation for a peanut
+// configuration hierarchy, for `tsk config docs`. Every key is listed with
+// its type, default value, the file that sets it, the # comment written
+// above it and the operators its value calls, grouped by section and
+// rendered as Markdown, HTML or through a custom template.
+package configdoc
+
+import (
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/security"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// Format is an output format of a document
+type Format string
+
+// Supported formats
+const (
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+)
+
+// Formats lists every supported format
+var Formats = []Format{FormatMarkdown, FormatHTML}
+
+// ParseFormat converts a format name such as "md" or "html" into a Format
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "markdown", "md":
+		return FormatMarkdown, nil
+	case "html", "htm":
+		return FormatHTML, nil
+	}
+	return "", fmt.Errorf("unsupported documentation format %q (use markdown or html)", name)
+}
+
+// Types of documented values
+const (
+	TypeString     = "string"
+	TypeInt        = "int"
+	TypeFloat      = "float"
+	TypeBool       = "bool"
+	TypeNull       = "null"
+	TypeList       = "list"
+	TypeExpression = "expression"
+	TypeSecret     = "secret"
+)
+
+// Options configures Generate
+type Options struct {
+	// Title heads the document; empty means "Configuration Reference"
+	Title string
+	// Root, when set, makes source files relative to it
+	Root string
+}
+
+// Document is the documentation of a hierarchy
+type Document struct {
+	Title    string    `json:"title"`
+	Files    []string  `json:"files"`
+	Sections []Section `json:"sections"`
+}
+
+// Section groups the keys declared directly under one path; the top-level
+// section has an empty name
+type Section struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Keys        []Entry `json:"keys"`
+}
+
+// Entry documents one key
+type Entry struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	// Default is the value the hierarchy gives the key, unevaluated:
+	// expressions are their source and secrets are left out
+	Default interface{} `json:"default"`
+	// Source is the file that sets the value, Line its line there
+	Source      string `json:"source"`
+	Line        int    `json:"line,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Operators are the operators the value calls, without the @
+	Operators []string `json:"operators,omitempty"`
+	// Overrides are the files whose value for the key Source replaced
+	Overrides []string `json:"overrides,omitempty"`
+}
+
+// Name returns the key without its section
+func (e Entry) Name() string {
+	return e.Key[strings.LastIndex(e.Key, ".")+1:]
+}
+
+// Location returns Source with the line, as file:line
+func (e Entry) Location() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d", e.Source, e.Line)
+	}
+	return e.Source
+}
+
+// DefaultText returns Default as written in a TSK file
+func (e Entry) DefaultText() string {
+	if e.Type == TypeSecret {
+		return "(encrypted)"
+	}
+	if e.Type == TypeExpression {
+		return fmt.Sprint(e.Default)
+	}
+	return config.FormatValue(e.Default)
+}
+
+// Generate documents every key of a resolved hierarchy
+func Generate(h *peanut.Hierarchy, opts Options) *Document {
+	doc := &Document{Title: opts.Title}
+	if doc.Title == "" {
+		doc.Title = "Configuration Reference"
+	}
+	for _, file := range h.Files {
+		doc.Files = append(doc.Files, relative(opts.Root, file))
+	}
+
+	keys := make([]string, 0, len(h.Origins))
+	for key := range h.Origins {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sections := make(map[string]*Section)
+	var names []string
+	for _, key := range keys {
+		origin := h.Origins[key]
+		value := origin.Chain[len(origin.Chain)-1].Value
+		if raw, _, err := h.Config.Lookup(key); err == nil {
+			// Appended arrays combine every file's value
+			value = raw
+		}
+
+		entry := Entry{
+			Key:         key,
+			Type:        typeOf(value),
+			Default:     value,
+			Source:      relative(opts.Root, origin.File),
+			Line:        origin.Line,
+			Description: h.Comments[key],
+			Operators:   operators(value),
+		}
+		if entry.Type == TypeSecret {
+			entry.Default = nil
+		}
+		for _, file := range origin.Overrides {
+			entry.Overrides = append(entry.Overrides, relative(opts.Root, file))
+		}
+
+		name := ""
+		if dot := strings.LastIndex(key, "."); dot != -1 {
+			name = key[:dot]
+		}
+		section, ok := sections[name]
+		if !ok {
+			section = &Section{Name: name, Description: h.Comments[name]}
+			sections[name] = section
+			names = append(names, name)
+		}
+		section.Keys = append(section.Keys, entry)
+	}
+
+	// The top-level section sorts first as the empty name
+	sort.Strings(names)
+	for _, name := range names {
+		doc.Sections = append(doc.Sections, *sections[name])
+	}
+	return doc
+}
+
+// Render writes the document in one of the built-in formats
+func (d *Document) Render(w io.Writer, format Format) error {
+	source, err := templates.ReadFile("templates/" + string(format) + ".tmpl")
+	if err != nil {
+		return fmt.Errorf("unsupported documentation format %q", format)
+	}
+	return d.RenderTemplate(w, string(source), format)
+}
+
+// RenderTemplate writes the document through a custom template. HTML
+// templates escape what they print; Markdown ones do not. Besides the
+// methods of Document, Section and Entry, templates can call:
+//
+//	join    strings.Join
+//	value   a value as written in a TSK file
+//	cell    text made safe for a Markdown table cell
+//	anchor  a section or key name as an HTML id
+func (d *Document) RenderTemplate(w io.Writer, source string, format Format) error {
+	funcs := map[string]interface{}{
+		"join":   strings.Join,
+		"value":  config.FormatValue,
+		"cell":   cell,
+		"anchor": anchor,
+	}
+	if format == FormatHTML {
+		tmpl, err := htmltemplate.New("docs").Funcs(funcs).Parse(source)
+		if err != nil {
+			return fmt.Errorf("invalid documentation template: %w", err)
+		}
+		return tmpl.Execute(w, d)
+	}
+	tmpl, err := texttemplate.New("docs").Funcs(funcs).Parse(source)
+	if err != nil {
+		return fmt.Errorf("invalid documentation template: %w", err)
+	}
+	return tmpl.Execute(w, d)
+}
+
+// typeOf names the type of a raw value
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return TypeNull
+	case string:
+		if security.IsSecret(v) {
+			return TypeSecret
+		}
+		if _, err := peanut.CompileExpression(v); err == nil {
+			return TypeExpression
+		}
+		return TypeString
+	case bool:
+		return TypeBool
+	case int, int64:
+		return TypeInt
+	case float64:
+		return TypeFloat
+	case []interface{}:
+		return TypeList
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// operators returns the operators a value, or the items of a list, call
+func operators(value interface{}) []string {
+	values := []interface{}{value}
+	if items, ok := value.([]interface{}); ok {
+		values = items
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok || !strings.Contains(s, "@") {
+			continue
+		}
+		program, err := peanut.CompileExpression(s)
+		if err != nil {
+			continue
+		}
+		for _, name := range program.Operators() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// relative makes file relative to root when both are set and it can
+func relative(root, file string) string {
+	if root == "" {
+		return file
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return file
+	}
+	if rel, err := filepath.Rel(abs, file); err == nil {
+		return rel
+	}
+	return file
+}
+
+// cell escapes pipes and joins lines, for a Markdown table cell
+func cell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// anchor turns a dotted name into an id usable in links
+func anchor(name string) string {
+	if name == "" {
+		return "top-level"
+	}
+	return strings.ReplaceAll(name, ".", "-")
+}
@@ -0,0 +1,147 @@
+package configdoc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func generate(t *testing.T) *Document {
+	t.Helper()
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+	if err := os.Mkdir(app, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "peanu.tsk"), `# Shown in logs
+name: "demo"
+
+# Database connection
+[database]
+# Primary host
+# Replicas are read-only
+host: @env("DB_HOST") || "localhost"
+port: 5432
+password: @secret("AAAA")
+
+# Detached comments are not descriptions
+
+timeout: 1.5
+`)
+	writeFile(t, filepath.Join(app, "peanu.tsk"), `[database]
+# Port of the app | overridden
+port: 6543
+`)
+
+	h, err := peanut.ResolveHierarchy(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Generate(h, Options{Root: app})
+}
+
+func entry(doc *Document, key string) (Entry, bool) {
+	for _, section := range doc.Sections {
+		for _, e := range section.Keys {
+			if e.Key == key {
+				return e, true
+			}
+		}
+	}
+	return Entry{}, false
+}
+
+func TestGenerate(t *testing.T) {
+	doc := generate(t)
+
+	if len(doc.Sections) != 2 || doc.Sections[0].Name != "" || doc.Sections[1].Name != "database" {
+		t.Fatalf("sections = %+v", doc.Sections)
+	}
+	if doc.Sections[1].Description != "Database connection" {
+		t.Errorf("section description = %q", doc.Sections[1].Description)
+	}
+	if len(doc.Files) != 2 || doc.Files[1] != "peanu.tsk" || doc.Files[0] != filepath.Join("..", "peanu.tsk") {
+		t.Errorf("files = %v", doc.Files)
+	}
+
+	host, _ := entry(doc, "database.host")
+	if host.Type != TypeExpression || host.Description != "Primary host\nReplicas are read-only" {
+		t.Errorf("host = %+v", host)
+	}
+	if len(host.Operators) != 1 || host.Operators[0] != "env" {
+		t.Errorf("host operators = %v", host.Operators)
+	}
+
+	port, _ := entry(doc, "database.port")
+	if port.Type != TypeInt || port.Default != 6543 || port.Location() != "peanu.tsk:3" {
+		t.Errorf("port = %+v at %s", port, port.Location())
+	}
+	if len(port.Overrides) != 1 || port.Description != "Port of the app | overridden" {
+		t.Errorf("port = %+v", port)
+	}
+
+	password, _ := entry(doc, "database.password")
+	if password.Type != TypeSecret || password.Default != nil || password.DefaultText() != "(encrypted)" {
+		t.Errorf("password = %+v", password)
+	}
+
+	timeout, _ := entry(doc, "database.timeout")
+	if timeout.Type != TypeFloat || timeout.Description != "" {
+		t.Errorf("timeout = %+v", timeout)
+	}
+}
+
+func TestRender(t *testing.T) {
+	doc := generate(t)
+
+	var md strings.Builder
+	if err := doc.Render(&md, FormatMarkdown); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# Configuration Reference",
+		"## `database`",
+		"| `host` | expression | `@env(\"DB_HOST\") \\|\\| \"localhost\"` |",
+		"| `port` | int | `6543` | peanu.tsk:3 |  | Port of the app \\| overridden |",
+		"Primary host<br>Replicas are read-only",
+	} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("markdown lacks %q:\n%s", want, md.String())
+		}
+	}
+
+	var html strings.Builder
+	if err := doc.Render(&html, FormatHTML); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), `<tr id="database-host">`) || !strings.Contains(html.String(), "@env(&#34;DB_HOST&#34;)") {
+		t.Errorf("html not rendered or escaped:\n%s", html.String())
+	}
+
+	var custom strings.Builder
+	tmpl := `{{range .Sections}}{{range .Keys}}{{.Key}}={{.DefaultText}} {{join .Operators ","}}
+{{end}}{{end}}`
+	if err := doc.RenderTemplate(&custom, tmpl, FormatMarkdown); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(custom.String(), "database.port=6543 \n") || !strings.Contains(custom.String(), "database.host=@env") {
+		t.Errorf("custom template output:\n%s", custom.String())
+	}
+
+	if err := doc.RenderTemplate(&custom, "{{.Missing", FormatMarkdown); err == nil {
+		t.Error("expected an error for a broken template")
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,557 @@
+// Package configgit versions configuration in Git, for `tsk config push`,
+// `tsk config pull` and `tsk config history`. Commits made by Commit carry
+// the keys they change, file by file, so the log reads as a configuration
+// changelog:
+//
+//	config: raise the connection limit
+//
+//	services/api/peanu.tsk
+//	  ~ database.pool: 10 -> 50
+//	  + database.timeout = "5s"
+//
+//	Tsk-Changed-Keys: database.pool, database.timeout
+//
+// The repository and where it syncs are read from the [git] section of the
+// hierarchy, all optional:
+//
+//	[git]
+//	repo: "../config"   # default: the repository holding the directory
+//	remote: "origin"
+//	branch: "main"      # default: the current branch
+package configgit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// GitCommand is the git executable run
+var GitCommand = "git"
+
+// Section is the configuration section holding the repository settings
+const Section = "git"
+
+// KeysTrailer is the commit message trailer listing the changed keys
+const KeysTrailer = "Tsk-Changed-Keys"
+
+// DefaultRemote is pushed to and pulled from unless git.remote says otherwise
+const DefaultRemote = "origin"
+
+// Options locates the repository and where it syncs
+type Options struct {
+	// Repo is a directory inside the repository; the directory of the
+	// configuration when empty
+	Repo   string
+	Remote string
+	// Branch is the remote branch; the current branch when empty
+	Branch string
+}
+
+// OptionsFrom reads Options from the flat git.* keys of a configuration
+func OptionsFrom(values map[string]interface{}) (Options, error) {
+	var opts Options
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, Section+".")
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		switch setting {
+		case "repo":
+			opts.Repo = text
+		case "remote":
+			opts.Remote = text
+		case "branch":
+			opts.Branch = text
+		default:
+			return opts, fmt.Errorf("unknown setting git.%s", setting)
+		}
+	}
+	return opts, nil
+}
+
+// Repo is a Git working tree holding configuration
+type Repo struct {
+	// Root is the top directory of the working tree
+	Root string
+	opts Options
+}
+
+// Open finds the repository holding dir, or opts.Repo relative to dir
+func Open(dir string, opts Options) (*Repo, error) {
+	if _, err := exec.LookPath(GitCommand); err != nil {
+		return nil, fmt.Errorf("%s not found: install Git to version configuration", GitCommand)
+	}
+	if opts.Repo != "" && !filepath.IsAbs(opts.Repo) {
+		opts.Repo = filepath.Join(dir, opts.Repo)
+	} else if opts.Repo == "" {
+		opts.Repo = dir
+	}
+	if opts.Remote == "" {
+		opts.Remote = DefaultRemote
+	}
+	r := &Repo{opts: opts}
+	out, err := r.run(opts.Repo, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in a Git repository: %w", opts.Repo, err)
+	}
+	r.Root = strings.TrimSpace(string(out))
+	return r, nil
+}
+
+// git runs a git command in the working tree
+func (r *Repo) git(args ...string) ([]byte, error) {
+	return r.run(r.Root, nil, args...)
+}
+
+func (r *Repo) run(dir string, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command(GitCommand, args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return out, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return out, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// Rel returns path relative to the root of the working tree, with slashes
+// as Git names files
+func (r *Repo) Rel(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	// The root comes from git resolved; resolve path the same way
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	} else if resolved, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		abs = filepath.Join(resolved, filepath.Base(abs))
+	}
+	rel, err := filepath.Rel(r.Root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the repository %s", path, r.Root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// isConfigFile reports whether a file holds text configuration
+func isConfigFile(name string) bool {
+	return strings.HasSuffix(name, ".tsk") || strings.HasSuffix(name, ".peanuts")
+}
+
+// FileChange is the keys one file changes
+type FileChange struct {
+	// Path is relative to the root of the working tree
+	Path    string             `json:"path"`
+	Status  string             `json:"status"`
+	Changes []peanut.KeyChange `json:"changes"`
+}
+
+// File statuses
+const (
+	Added    = "added"
+	Modified = "modified"
+	Deleted  = "deleted"
+)
+
+// Status returns the configuration files under dir that differ from HEAD,
+// with the keys they change
+func (r *Repo) Status(dir string) ([]FileChange, error) {
+	rel, err := r.Rel(dir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.git("status", "--porcelain=v1", "-z", "--untracked-files=all", "--", rel)
+	if err != nil {
+		return nil, err
+	}
+	hasHead := r.hasHead()
+
+	var files []FileChange
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		code, path := entry[:2], entry[3:]
+		if code[0] == 'R' || code[0] == 'C' {
+			// The source of a rename follows as its own entry
+			i++
+		}
+		if !isConfigFile(path) {
+			continue
+		}
+		var old, new map[string]interface{}
+		if hasHead {
+			if old, err = r.valuesAt("HEAD", path); err != nil {
+				return nil, err
+			}
+		}
+		if new, err = parseFile(filepath.Join(r.Root, filepath.FromSlash(path))); err != nil {
+			return nil, err
+		}
+		change := FileChange{Path: path, Status: Modified, Changes: peanut.Diff(old, new)}
+		switch {
+		case old == nil:
+			change.Status = Added
+		case new == nil:
+			change.Status = Deleted
+		}
+		if change.Changes == nil {
+			// Comments and layout only; still worth committing
+			change.Changes = []peanut.KeyChange{}
+		}
+		files = append(files, change)
+	}
+	return files, nil
+}
+
+// hasHead reports whether the repository has a commit yet
+func (r *Repo) hasHead() bool {
+	_, err := r.git("rev-parse", "--verify", "--quiet", "HEAD")
+	return err == nil
+}
+
+// valuesAt parses path as of revision rev; nil when it did not exist
+func (r *Repo) valuesAt(rev, path string) (map[string]interface{}, error) {
+	content, err := r.git("show", rev+":"+path)
+	if err != nil {
+		if _, verr := r.git("cat-file", "-e", rev+":"+path); verr != nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parse(content, rev+":"+path)
+}
+
+// parseFile parses a working tree file; nil when it does not exist
+func parseFile(file string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parse(content, file)
+}
+
+func parse(content []byte, name string) (map[string]interface{}, error) {
+	cfg := config.New()
+	if err := cfg.LoadTSK(content); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return cfg.Values(), nil
+}
+
+// CommitMessage returns the message of a commit making changes; summary is
+// its subject, derived from the changes when empty
+func CommitMessage(summary string, changes []FileChange) string {
+	var keys []string
+	var body strings.Builder
+	for _, file := range changes {
+		fmt.Fprintf(&body, "\n%s", file.Path)
+		if file.Status != Modified {
+			fmt.Fprintf(&body, " (%s)", file.Status)
+		}
+		body.WriteString("\n")
+		for _, change := range file.Changes {
+			body.WriteString("  " + FormatChange(change) + "\n")
+			keys = append(keys, change.Key)
+		}
+	}
+	keys = uniqueSorted(keys)
+
+	if summary == "" {
+		switch {
+		case len(keys) == 1:
+			summary = "update " + keys[0]
+		case len(keys) > 1:
+			summary = fmt.Sprintf("update %d keys", len(keys))
+		default:
+			summary = "update comments"
+		}
+	}
+	message := "config: " + summary + "\n" + body.String()
+	if len(keys) > 0 {
+		message += "\n" + KeysTrailer + ": " + strings.Join(keys, ", ") + "\n"
+	}
+	return message
+}
+
+// FormatChange renders one key change as a line of a commit message
+func FormatChange(change peanut.KeyChange) string {
+	switch change.Kind {
+	case peanut.KeyAdded:
+		return fmt.Sprintf("+ %s = %s", change.Key, config.FormatValue(change.New))
+	case peanut.KeyRemoved:
+		return fmt.Sprintf("- %s", change.Key)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", change.Key, config.FormatValue(change.Old), config.FormatValue(change.New))
+}
+
+// Commit commits the files of changes, and only them, with message and
+// returns the new commit
+func (r *Repo) Commit(message string, changes []FileChange) (string, error) {
+	if len(changes) == 0 {
+		return "", errors.New("no configuration changes to commit")
+	}
+	paths := make([]string, len(changes))
+	for i, file := range changes {
+		paths[i] = file.Path
+	}
+	if _, err := r.git(append([]string{"add", "--all", "--"}, paths...)...); err != nil {
+		return "", err
+	}
+	args := append([]string{"commit", "--quiet", "--file", "-", "--"}, paths...)
+	if _, err := r.run(r.Root, []byte(message), args...); err != nil {
+		return "", err
+	}
+	out, err := r.git("rev-parse", "HEAD")
+	return strings.TrimSpace(string(out)), err
+}
+
+// branch returns the remote branch to sync with
+func (r *Repo) branch() (string, error) {
+	if r.opts.Branch != "" {
+		return r.opts.Branch, nil
+	}
+	out, err := r.git("symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		return "", errors.New("HEAD is detached: set git.branch")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Push pushes the current branch to the remote branch
+func (r *Repo) Push() error {
+	branch, err := r.branch()
+	if err != nil {
+		return err
+	}
+	_, err = r.git("push", "--quiet", r.opts.Remote, "HEAD:refs/heads/"+branch)
+	return err
+}
+
+// PullResult is what a pull brought in
+type PullResult struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Files are the configuration files the pull changed, with their keys
+	Files []FileChange `json:"files"`
+	// Conflicts are the files left conflicted by a failed merge
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// Pull fetches the remote branch and merges it into the current branch. A
+// merge stopped by conflicts returns them in the result, with an error.
+func (r *Repo) Pull() (*PullResult, error) {
+	branch, err := r.branch()
+	if err != nil {
+		return nil, err
+	}
+	result := &PullResult{Files: []FileChange{}}
+	if r.hasHead() {
+		out, _ := r.git("rev-parse", "HEAD")
+		result.From = strings.TrimSpace(string(out))
+	}
+	if _, err := r.git("pull", "--no-rebase", "--no-edit", "--quiet", r.opts.Remote, branch); err != nil {
+		out, _ := r.git("diff", "--name-only", "--diff-filter=U")
+		for _, path := range strings.Fields(string(out)) {
+			result.Conflicts = append(result.Conflicts, path)
+		}
+		if len(result.Conflicts) > 0 {
+			return result, fmt.Errorf("merge conflicts in %s: resolve them and commit, or run git merge --abort", strings.Join(result.Conflicts, ", "))
+		}
+		return nil, err
+	}
+	out, err := r.git("rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	result.To = strings.TrimSpace(string(out))
+	if result.From == result.To {
+		return result, nil
+	}
+
+	if result.From != "" {
+		out, err = r.git("diff", "--name-status", "-z", "--no-renames", result.From, result.To)
+	} else {
+		// Nothing to compare with: everything the first pull brought is new
+		out, err = r.git("ls-tree", "-r", "-z", "--name-only", result.To)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		status, path := "A", fields[i]
+		if result.From != "" {
+			if i+1 >= len(fields) {
+				break
+			}
+			status, path = fields[i], fields[i+1]
+			i++
+		}
+		if !isConfigFile(path) {
+			continue
+		}
+		var old, new map[string]interface{}
+		if result.From != "" {
+			if old, err = r.valuesAt(result.From, path); err != nil {
+				return nil, err
+			}
+		}
+		if new, err = r.valuesAt(result.To, path); err != nil {
+			return nil, err
+		}
+		change := FileChange{Path: path, Status: Modified, Changes: peanut.Diff(old, new)}
+		switch status {
+		case "A":
+			change.Status = Added
+		case "D":
+			change.Status = Deleted
+		}
+		if change.Changes == nil {
+			change.Changes = []peanut.KeyChange{}
+		}
+		result.Files = append(result.Files, change)
+	}
+	return result, nil
+}
+
+// Commit identifies a commit
+type Commit struct {
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+}
+
+// Uncommitted is the Hash of a Blame whose line is not committed yet
+const Uncommitted = "0000000000000000000000000000000000000000"
+
+// Blame returns the commit that last changed a line of file
+func (r *Repo) Blame(file string, line int) (*Commit, error) {
+	rel, err := r.Rel(file)
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.git("blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", line, line), "--", rel)
+	if err != nil {
+		return nil, err
+	}
+	var c Commit
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for first := true; scanner.Scan(); first = false {
+		text := scanner.Text()
+		if first {
+			c.Hash = strings.Fields(text)[0]
+			continue
+		}
+		field, value, _ := strings.Cut(text, " ")
+		switch field {
+		case "author":
+			c.Author = value
+		case "author-time":
+			seconds, _ := strconv.ParseInt(value, 10, 64)
+			c.Date = time.Unix(seconds, 0).UTC()
+		case "summary":
+			c.Subject = value
+		}
+	}
+	return &c, nil
+}
+
+// Revision is a commit that changed the value of a key in a file
+type Revision struct {
+	Commit
+	Change peanut.KeyChange `json:"change"`
+}
+
+// History returns the commits that changed key in file, newest first, with
+// the value each set. Earlier names of a renamed file are not followed.
+func (r *Repo) History(file, key string) ([]Revision, error) {
+	rel, err := r.Rel(file)
+	if err != nil {
+		return nil, err
+	}
+	if !r.hasHead() {
+		return nil, nil
+	}
+	out, err := r.git("log", "--reverse", "--format=%H%x00%an%x00%at%x00%s", "--", rel)
+	if err != nil {
+		return nil, err
+	}
+	var history []Revision
+	var previous map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+		values, err := r.valuesAt(fields[0], rel)
+		if err != nil {
+			// A commit with a broken file changes nothing we can read
+			continue
+		}
+		changes := peanut.Diff(only(previous, key), only(values, key))
+		previous = values
+		if len(changes) == 0 {
+			continue
+		}
+		seconds, _ := strconv.ParseInt(fields[2], 10, 64)
+		history = append(history, Revision{
+			Commit: Commit{Hash: fields[0], Author: fields[1], Date: time.Unix(seconds, 0).UTC(), Subject: fields[3]},
+			Change: changes[0],
+		})
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return history, nil
+}
+
+// only returns the value of key in values, as a map Diff can compare
+func only(values map[string]interface{}, key string) map[string]interface{} {
+	if value, ok := values[key]; ok {
+		return map[string]interface{}{key: value}
+	}
+	return nil
+}
+
+// uniqueSorted returns values sorted without duplicates
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
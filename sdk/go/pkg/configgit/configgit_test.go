@@ -0,0 +1,157 @@
+package configgit
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setup returns two clones of one bare repository, the first holding a
+// committed services/api/peanu.tsk
+func setup(t *testing.T) (string, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Ada")
+	t.Setenv("GIT_AUTHOR_EMAIL", "ada@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Ada")
+	t.Setenv("GIT_COMMITTER_EMAIL", "ada@example.com")
+
+	root := t.TempDir()
+	bare := filepath.Join(root, "config.git")
+	git(t, root, "init", "--quiet", "--bare", "-b", "main", bare)
+	first, second := filepath.Join(root, "first"), filepath.Join(root, "second")
+	git(t, root, "clone", "--quiet", bare, first)
+	git(t, first, "checkout", "--quiet", "-b", "main")
+	writeFile(t, filepath.Join(first, "services", "api", "peanu.tsk"), "[database]\npool: 10\nhost: \"db\"\n")
+	git(t, first, "add", ".")
+	git(t, first, "commit", "--quiet", "-m", "initial")
+	git(t, first, "push", "--quiet", "origin", "main")
+	git(t, root, "clone", "--quiet", bare, second)
+	return first, second
+}
+
+func TestPushPullHistory(t *testing.T) {
+	first, second := setup(t)
+	api := filepath.Join(first, "services", "api")
+	repo, err := Open(api, Options{})
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+
+	writeFile(t, filepath.Join(api, "peanu.tsk"), "[database]\npool: 50\ntimeout: \"5s\"\n")
+	writeFile(t, filepath.Join(api, "notes.txt"), "not configuration")
+	changes, err := repo.Status(api)
+	if err != nil {
+		t.Fatalf("Status returned error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Path != "services/api/peanu.tsk" || changes[0].Status != Modified {
+		t.Fatalf("unexpected status %+v", changes)
+	}
+	var lines []string
+	for _, change := range changes[0].Changes {
+		lines = append(lines, FormatChange(change))
+	}
+	want := []string{"- database.host", "~ database.pool: 10 -> 50", `+ database.timeout = "5s"`}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("changes = %q, want %q", lines, want)
+	}
+
+	message := CommitMessage("raise the pool", changes)
+	if !strings.HasPrefix(message, "config: raise the pool\n\nservices/api/peanu.tsk\n  - database.host\n") ||
+		!strings.HasSuffix(message, "\n"+KeysTrailer+": database.host, database.pool, database.timeout\n") {
+		t.Errorf("unexpected message:\n%s", message)
+	}
+	if _, err := repo.Commit(message, changes); err != nil {
+		t.Fatalf("Commit returned error: %v", err)
+	}
+	if status := git(t, first, "status", "--porcelain"); status != "?? services/api/notes.txt" {
+		t.Errorf("Commit took more than the configuration: %q", status)
+	}
+	if err := repo.Push(); err != nil {
+		t.Fatalf("Push returned error: %v", err)
+	}
+
+	other, err := Open(second, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := other.Pull()
+	if err != nil {
+		t.Fatalf("Pull returned error: %v", err)
+	}
+	if len(result.Files) != 1 || len(result.Files[0].Changes) != 3 || result.From == result.To {
+		t.Errorf("unexpected pull %+v", result)
+	}
+
+	history, err := other.History(filepath.Join(second, "services", "api", "peanu.tsk"), "database.pool")
+	if err != nil {
+		t.Fatalf("History returned error: %v", err)
+	}
+	if len(history) != 2 || history[0].Subject != "config: raise the pool" || history[0].Change.New != 50 ||
+		history[1].Subject != "initial" || history[1].Change.Kind != peanut.KeyAdded || history[0].Author != "Ada" {
+		t.Errorf("unexpected history %+v", history)
+	}
+	blame, err := other.Blame(filepath.Join(second, "services", "api", "peanu.tsk"), 2)
+	if err != nil {
+		t.Fatalf("Blame returned error: %v", err)
+	}
+	if blame.Hash != history[0].Hash || blame.Subject != "config: raise the pool" {
+		t.Errorf("unexpected blame %+v", blame)
+	}
+
+	// Both sides change the same line: the pull stops with the conflict
+	writeFile(t, filepath.Join(api, "peanu.tsk"), "[database]\npool: 60\ntimeout: \"5s\"\n")
+	changes, _ = repo.Status(api)
+	repo.Commit(CommitMessage("", changes), changes)
+	if err := repo.Push(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(second, "services", "api", "peanu.tsk"), "[database]\npool: 70\ntimeout: \"5s\"\n")
+	changes, _ = other.Status(second)
+	if _, err := other.Commit(CommitMessage("", changes), changes); err != nil {
+		t.Fatal(err)
+	}
+	result, err = other.Pull()
+	if err == nil || !reflect.DeepEqual(result.Conflicts, []string{"services/api/peanu.tsk"}) {
+		t.Errorf("expected a conflict, got %+v, %v", result, err)
+	}
+}
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{"git.remote": "upstream", "git.branch": "config", "name": "api"})
+	if err != nil || opts != (Options{Remote: "upstream", Branch: "config"}) {
+		t.Errorf("OptionsFrom = %+v, %v", opts, err)
+	}
+	if _, err := OptionsFrom(map[string]interface{}{"git.remtoe": "x"}); err == nil {
+		t.Error("expected an error for an unknown setting")
+	}
+}
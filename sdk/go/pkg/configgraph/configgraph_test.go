@@ -0,0 +1,197 @@
+package configgraph
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+const testConfig = `[database]
+host: "db.internal"
+port: 5432
+replicas: ["r1", "r2"]
+url: @env("TSK_GRAPH_URL", "postgres://localhost")
+pool.max: 10
+max-conn: 3
+
+[app]
+name: "billing"
+debug: false
+ratio: 0.5
+broken: @nosuch("x")
+`
+
+func newGraph(t *testing.T, opts Options) *Graph {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "peanu.tsk")
+	if err := os.WriteFile(file, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := peanut.LoadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cfg.Close() })
+	g, err := New(cfg, opts)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return g
+}
+
+func run(t *testing.T, g *Graph, req Request) string {
+	t.Helper()
+	data, err := json.Marshal(g.Execute(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSchema(t *testing.T) {
+	schema := newGraph(t, Options{}).Schema()
+	for field, want := range map[string]string{
+		"host":     "String",
+		"port":     "Int",
+		"replicas": "[String]",
+		"url":      "Value",
+		"pool":     "DatabasePool",
+		"max_conn": "Int",
+	} {
+		f := schema.Type("Database").Field(field)
+		if f == nil || f.Type.String() != want {
+			t.Errorf("Database.%s should be of type %s, got %+v", field, want, f)
+		}
+	}
+	if f := schema.Type("App").Field("ratio"); f == nil || f.Type.String() != "Float" {
+		t.Errorf("App.ratio should be a Float, got %+v", f)
+	}
+	if f := schema.Type("Database").Field("max_conn"); f.Key != "database.max-conn" {
+		t.Errorf("max_conn should read database.max-conn, got %s", f.Key)
+	}
+	sdl := schema.String()
+	for _, want := range []string{"type Query {", "  database: Database\n", "  value(key: String!): Value\n", "type DatabasePool {"} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("schema should contain %q:\n%s", want, sdl)
+		}
+	}
+
+	for key, want := range map[string]string{"max-conn": "max_conn", "2fa": "_2fa", "__x": "_x", "a.b": "a_b"} {
+		if got := fieldName(key); got != want {
+			t.Errorf("fieldName(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if got := pascal("connection_pool"); got != "ConnectionPool" {
+		t.Errorf("pascal() = %q", got)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	t.Setenv("TSK_GRAPH_URL", "postgres://db.internal/billing")
+	g := newGraph(t, Options{})
+
+	got := run(t, g, Request{Query: `query Settings($verbose: Boolean = false) {
+  db: database { host ...Pool url replicas }
+  app { __typename name ratio debug @skip(if: $verbose) }
+}
+fragment Pool on Database { pool { max } }`})
+	want := `{"data":{"db":{"host":"db.internal","pool":{"max":10},"url":"postgres://db.internal/billing","replicas":["r1","r2"]},` +
+		`"app":{"__typename":"App","name":"billing","ratio":0.5,"debug":false}}}`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	got = run(t, g, Request{
+		Query:     `query($key: String!, $verbose: Boolean = false) { value(key: $key) app { ... on App @include(if: $verbose) { name } } }`,
+		Variables: map[string]interface{}{"key": "database.pool"},
+	})
+	if want := `{"data":{"value":{"max":10},"app":{}}}`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	// A failing expression only nulls its own field
+	got = run(t, g, Request{Query: `{ app { name broken } }`})
+	if !strings.HasPrefix(got, `{"data":{"app":{"name":"billing","broken":null}},"errors":[{"message":"app.broken: `) ||
+		!strings.Contains(got, `"path":["app","broken"]`) {
+		t.Errorf("unexpected result for a failing expression: %s", got)
+	}
+
+	for query, want := range map[string]string{
+		`{ database { nope } }`:                                 "type Database has no field nope",
+		`{ database }`:                                          "field database of type Database needs a selection",
+		`{ database { host { x } } }`:                           "field host of type String cannot have a selection",
+		`{ value }`:                                             "field value needs argument key",
+		`mutation { database { host } }`:                        "mutation operations are not supported",
+		`{ database { ...F } } fragment F on App { name }`:      "a fragment on App cannot be spread within Database",
+		`{ database { ...F } } fragment F on Database { ...F }`: "fragment F spreads itself",
+		`query($k: Int) { value(key: $k) }`:                     "variable $k of type Int cannot be used for argument key",
+		`{ database { host }`:                                   "syntax error: unexpected end of document",
+		`{ app { name @later } }`:                               "unknown directive @later",
+	} {
+		if got := run(t, g, Request{Query: query}); !strings.Contains(got, want) || strings.Contains(got, `"data"`) {
+			t.Errorf("%s: expected an error containing %q, got %s", query, want, got)
+		}
+	}
+	if got := run(t, g, Request{Query: `query($k: String!) { value(key: $k) }`}); !strings.Contains(got, "variable $k of type String! is required") {
+		t.Errorf("expected a missing variable error, got %s", got)
+	}
+}
+
+func TestDepthLimit(t *testing.T) {
+	g := newGraph(t, Options{MaxDepth: 2})
+	if got := run(t, g, Request{Query: `{ database { pool { max } } }`}); !strings.Contains(got, "query depth 3 exceeds the limit of 2") {
+		t.Errorf("expected the depth limit to apply, got %s", got)
+	}
+	if got := run(t, g, Request{Query: `{ database { host } }`}); strings.Contains(got, "errors") {
+		t.Errorf("a query within the limit failed: %s", got)
+	}
+	// Fragments count where they are spread
+	if got := run(t, g, Request{Query: `{ database { ...P } } fragment P on Database { pool { max } }`}); !strings.Contains(got, "query depth 3") {
+		t.Errorf("expected fragments to count, got %s", got)
+	}
+
+	// Introspection is deeper than the limit but does not count
+	got := run(t, g, Request{Query: `{
+  __type(name: "Database") { name fields { name type { kind name ofType { kind name } } } }
+  __schema { queryType { name } directives { name } }
+}`})
+	if !strings.Contains(got, `{"name":"replicas","type":{"kind":"LIST","name":null,"ofType":{"kind":"SCALAR","name":"String"}}}`) ||
+		!strings.Contains(got, `"queryType":{"name":"Query"},"directives":[{"name":"include"},{"name":"skip"}]`) {
+		t.Errorf("unexpected introspection result: %s", got)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	g := newGraph(t, Options{})
+	post := httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "{ app { name } }"}`))
+	rec := httptest.NewRecorder()
+	g.ServeHTTP(rec, post)
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"data":{"app":{"name":"billing"}}}`+"\n" {
+		t.Errorf("POST = %d %s", rec.Code, rec.Body)
+	}
+
+	get := httptest.NewRequest("GET", `/graphql?query=query($k:String!){value(key:$k)}&variables={"k":"database.port"}`, nil)
+	rec = httptest.NewRecorder()
+	g.ServeHTTP(rec, get)
+	if rec.Body.String() != `{"data":{"value":5432}}`+"\n" {
+		t.Errorf("GET = %d %s", rec.Code, rec.Body)
+	}
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/graphql", strings.NewReader("{")),
+		httptest.NewRequest("GET", "/graphql", nil),
+		httptest.NewRequest("PUT", "/graphql", nil),
+	} {
+		rec = httptest.NewRecorder()
+		g.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest && rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s should fail, got %d %s", req.Method, rec.Code, rec.Body)
+		}
+	}
+}
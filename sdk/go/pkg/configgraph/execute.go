@@ -0,0 +1,633 @@
+package configgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// DefaultMaxDepth is the depth limit of queries when Options leaves it unset
+const DefaultMaxDepth = 10
+
+// Options configures a Graph
+type Options struct {
+	// MaxDepth limits how deeply fields of a query can nest; introspection
+	// fields do not count. Zero means DefaultMaxDepth, negative no limit.
+	MaxDepth int
+}
+
+// Request is a GraphQL request, as POSTed by clients
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response is the result of a request. Data is absent when the request
+// failed before execution.
+type Response struct {
+	Data   *Object  `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// Error is an error of a request, with the path of the field it occurred in
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Object is a result object, keeping fields in the order the query
+// selected them
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newObject() *Object {
+	return &Object{values: make(map[string]interface{})}
+}
+
+func (o *Object) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Get returns the value of a field of the result
+func (o *Object) Get(key string) interface{} {
+	return o.values[key]
+}
+
+// MarshalJSON implements json.Marshaler
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Graph answers GraphQL queries over a configuration
+type Graph struct {
+	cfg    *peanut.Config
+	schema *Schema
+	opts   Options
+}
+
+// New builds the graph of cfg
+func New(cfg *peanut.Config, opts Options) (*Graph, error) {
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+	schema, err := NewSchema(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Graph{cfg: cfg, schema: schema, opts: opts}, nil
+}
+
+// Schema returns the schema of the graph
+func (g *Graph) Schema() *Schema {
+	return g.schema
+}
+
+// execution is the state of one request
+type execution struct {
+	cfg       *peanut.Config
+	vm        *peanut.VM
+	schema    *Schema
+	doc       *document
+	variables map[string]interface{}
+	errors    []*Error
+}
+
+// Execute runs req. Operator expressions are evaluated as the fields
+// holding them are resolved, so a query only evaluates what it selects.
+func (g *Graph) Execute(req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return failed(fmt.Errorf("syntax error: %w", err))
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return failed(err)
+	}
+	if op.kind != "query" {
+		return failed(fmt.Errorf("%s operations are not supported; the configuration is read-only", op.kind))
+	}
+	e := &execution{cfg: g.cfg, vm: peanut.NewVM(), schema: g.schema, doc: doc}
+	if e.variables, err = coerceVariables(op.variables, req.Variables); err != nil {
+		return failed(err)
+	}
+	v := &validator{schema: g.schema, doc: doc, variables: op.variables}
+	depth := v.selections(g.schema.Query, op.selections, nil)
+	for name := range doc.fragments {
+		if !v.used[name] {
+			v.errorf("fragment %s is not used", name)
+		}
+	}
+	if len(v.errors) > 0 {
+		return &Response{Errors: v.errors}
+	}
+	if g.opts.MaxDepth > 0 && depth > g.opts.MaxDepth {
+		return failed(fmt.Errorf("query depth %d exceeds the limit of %d", depth, g.opts.MaxDepth))
+	}
+
+	data := e.selectionSet(g.schema.Query, nil, op.selections, nil)
+	return &Response{Data: data, Errors: e.errors}
+}
+
+func failed(err error) *Response {
+	return &Response{Errors: []*Error{{Message: err.Error()}}}
+}
+
+// operation picks the operation to run
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, fmt.Errorf("operationName is required for documents with several operations")
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %s", name)
+}
+
+// coerceVariables checks the values given for the variables of an
+// operation against their types and applies defaults
+func coerceVariables(defs []*variableDefinition, given map[string]interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(defs))
+	for _, def := range defs {
+		value, ok := given[def.name]
+		if !ok {
+			if def.hasDef {
+				values[def.name] = def.def
+			} else if def.typ.nonNull {
+				return nil, fmt.Errorf("variable $%s of type %s is required", def.name, def.typ)
+			}
+			continue
+		}
+		coerced, err := coerceInput(value, def.typ)
+		if err != nil {
+			return nil, fmt.Errorf("variable $%s: %w", def.name, err)
+		}
+		values[def.name] = coerced
+	}
+	return values, nil
+}
+
+// coerceInput checks an input value against a type; JSON numbers arrive as
+// float64s and integral ones are turned into ints
+func coerceInput(value interface{}, t typeRef) (interface{}, error) {
+	if value == nil {
+		if t.nonNull {
+			return nil, fmt.Errorf("null given for %s", t)
+		}
+		return nil, nil
+	}
+	if t.list != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			coerced, err := coerceInput(item, *t.list)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = coerced
+		}
+		return list, nil
+	}
+	switch t.name {
+	case "String", "ID":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		if t.name == "ID" {
+			if n, ok := integral(value); ok {
+				return fmt.Sprint(n), nil
+			}
+		}
+	case "Int":
+		if n, ok := integral(value); ok && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return n, nil
+		}
+	case "Float":
+		switch n := value.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		}
+	case "Boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case "Value":
+		return value, nil
+	default:
+		return nil, fmt.Errorf("unknown input type %s", t.name)
+	}
+	return nil, fmt.Errorf("%v is not a valid %s", value, t.name)
+}
+
+func integral(value interface{}) (int, bool) {
+	switch n := value.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+// Validation
+
+// validator checks the selections of an operation against the schema
+// before anything runs, and measures their depth
+type validator struct {
+	schema    *Schema
+	doc       *document
+	variables []*variableDefinition
+	used      map[string]bool
+	errors    []*Error
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	v.errors = append(v.errors, &Error{Message: fmt.Sprintf(format, args...)})
+}
+
+// selections validates selections on t and returns their depth; spreads
+// lists the fragments being expanded, to catch cycles
+func (v *validator) selections(t *Type, selections []*selection, spreads []string) int {
+	if v.used == nil {
+		v.used = make(map[string]bool)
+	}
+	depth := 0
+	for _, s := range selections {
+		for _, d := range s.directives {
+			v.directive(d)
+		}
+		switch {
+		case s.spread != "":
+			f, ok := v.doc.fragments[s.spread]
+			if !ok {
+				v.errorf("unknown fragment %s", s.spread)
+				continue
+			}
+			v.used[s.spread] = true
+			for _, name := range spreads {
+				if name == s.spread {
+					v.errorf("fragment %s spreads itself", s.spread)
+					return depth
+				}
+			}
+			if v.typeCondition(f.typeCondition, t) {
+				depth = max(depth, v.selections(t, f.selections, append(spreads, s.spread)))
+			}
+		case s.inline:
+			if s.typeCondition == "" || v.typeCondition(s.typeCondition, t) {
+				depth = max(depth, v.selections(t, s.selections, spreads))
+			}
+		default:
+			depth = max(depth, v.field(t, s, spreads))
+		}
+	}
+	return depth
+}
+
+// typeCondition checks that a fragment on name can be spread within t;
+// without interfaces or unions, only t itself can be
+func (v *validator) typeCondition(name string, t *Type) bool {
+	if condition := v.schema.Type(name); condition == nil || condition.Kind != KindObject {
+		v.errorf("unknown object type %s", name)
+		return false
+	}
+	if name != t.Name {
+		v.errorf("a fragment on %s cannot be spread within %s", name, t.Name)
+		return false
+	}
+	return true
+}
+
+func (v *validator) field(t *Type, s *selection, spreads []string) int {
+	f := lookupField(t, s.name)
+	if f == nil {
+		v.errorf("type %s has no field %s", t.Name, s.name)
+		return 0
+	}
+	v.arguments(fmt.Sprintf("field %s", s.name), f.Args, s.arguments)
+	named := f.Type.named()
+	if named.Kind != KindObject {
+		if s.selections != nil {
+			v.errorf("field %s of type %s cannot have a selection", s.name, f.Type)
+		}
+		return 1
+	}
+	if s.selections == nil {
+		v.errorf("field %s of type %s needs a selection", s.name, f.Type)
+		return 1
+	}
+	depth := v.selections(named, s.selections, spreads)
+	if strings.HasPrefix(s.name, "__") {
+		// Introspection is as deep as the schema; it does not count
+		return 1
+	}
+	return 1 + depth
+}
+
+func (v *validator) directive(d *directive) {
+	for _, def := range directives {
+		if def.name == d.name {
+			v.arguments("directive @"+d.name, def.args, d.arguments)
+			return
+		}
+	}
+	v.errorf("unknown directive @%s", d.name)
+}
+
+// arguments checks given arguments against their definitions
+func (v *validator) arguments(owner string, defs []*Argument, given map[string]interface{}) {
+	for name, value := range given {
+		var def *Argument
+		for _, a := range defs {
+			if a.Name == name {
+				def = a
+			}
+		}
+		if def == nil {
+			v.errorf("%s has no argument %s", owner, name)
+			continue
+		}
+		if name, ok := value.(variable); ok {
+			v.variable(owner, def, string(name))
+		}
+	}
+	for _, def := range defs {
+		if _, ok := given[def.Name]; !ok && def.Type.Kind == KindNonNull {
+			v.errorf("%s needs argument %s", owner, def.Name)
+		}
+	}
+}
+
+func (v *validator) variable(owner string, def *Argument, name string) {
+	for _, d := range v.variables {
+		if d.name == name {
+			if strings.TrimSuffix(d.typ.String(), "!") != strings.TrimSuffix(def.Type.String(), "!") ||
+				def.Type.Kind == KindNonNull && !d.typ.nonNull && !d.hasDef {
+				v.errorf("variable $%s of type %s cannot be used for argument %s of %s, of type %s", name, d.typ, def.Name, owner, def.Type)
+			}
+			return
+		}
+	}
+	v.errorf("variable $%s is not defined", name)
+}
+
+// lookupField returns the field called name of t, including meta fields
+func lookupField(t *Type, name string) *Field {
+	switch {
+	case name == "__typename":
+		return typenameField
+	case strings.HasPrefix(name, "__") && t.Name == "Query":
+		if f, ok := introspectionFields[name]; ok {
+			return f
+		}
+	}
+	return t.Field(name)
+}
+
+// Execution
+
+// selectionSet resolves selections on an object of type t
+func (e *execution) selectionSet(t *Type, parent interface{}, selections []*selection, path []interface{}) *Object {
+	result := newObject()
+	fields := make(map[string][]*selection)
+	var order []string
+	e.collect(t, selections, fields, &order, make(map[string]bool))
+	for _, key := range order {
+		s := fields[key][0]
+		fieldPath := append(append([]interface{}{}, path...), key)
+		if s.name == "__typename" {
+			result.set(key, t.Name)
+			continue
+		}
+		f := lookupField(t, s.name)
+		value, err := e.resolve(f, parent, s)
+		if err != nil {
+			e.errors = append(e.errors, &Error{Message: err.Error(), Path: fieldPath})
+			result.set(key, nil)
+			continue
+		}
+		var children []*selection
+		for _, same := range fields[key] {
+			children = append(children, same.selections...)
+		}
+		result.set(key, e.complete(f.Type, value, children, fieldPath))
+	}
+	return result
+}
+
+// collect gathers the fields selected on t by response key, following
+// fragments and applying @skip and @include
+func (e *execution) collect(t *Type, selections []*selection, fields map[string][]*selection, order *[]string, visited map[string]bool) {
+	for _, s := range selections {
+		if !e.included(s) {
+			continue
+		}
+		switch {
+		case s.spread != "":
+			if visited[s.spread] {
+				continue
+			}
+			visited[s.spread] = true
+			f := e.doc.fragments[s.spread]
+			if f.typeCondition == t.Name {
+				e.collect(t, f.selections, fields, order, visited)
+			}
+		case s.inline:
+			if s.typeCondition == "" || s.typeCondition == t.Name {
+				e.collect(t, s.selections, fields, order, visited)
+			}
+		default:
+			key := s.responseKey()
+			if _, ok := fields[key]; !ok {
+				*order = append(*order, key)
+			}
+			fields[key] = append(fields[key], s)
+		}
+	}
+}
+
+func (e *execution) included(s *selection) bool {
+	for _, d := range s.directives {
+		condition, _ := e.argument(d.arguments["if"]).(bool)
+		if d.name == "skip" && condition || d.name == "include" && !condition {
+			return false
+		}
+	}
+	return true
+}
+
+// argument substitutes the variables in an argument value
+func (e *execution) argument(value interface{}) interface{} {
+	switch v := value.(type) {
+	case variable:
+		return e.variables[string(v)]
+	case enumValue:
+		return string(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = e.argument(item)
+		}
+		return list
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = e.argument(item)
+		}
+		return m
+	}
+	return value
+}
+
+func (e *execution) resolve(f *Field, parent interface{}, s *selection) (interface{}, error) {
+	if f.resolve == nil {
+		return e.value(f.Key, parent)
+	}
+	args := make(map[string]interface{}, len(f.Args))
+	for _, a := range f.Args {
+		value, ok := s.arguments[a.Name]
+		if !ok {
+			continue
+		}
+		value = e.argument(value)
+		if value == nil && a.Type.Kind == KindNonNull {
+			return nil, fmt.Errorf("argument %s of %s cannot be null", a.Name, s.name)
+		}
+		if value != nil {
+			if _, isString := value.(string); a.Type.named() == stringType && !isString {
+				return nil, fmt.Errorf("argument %s of %s must be a String", a.Name, s.name)
+			}
+		}
+		args[a.Name] = value
+	}
+	return f.resolve(e, parent, args)
+}
+
+// value reads key from the section parent, or from the configuration at
+// the top level. Only values holding expressions are evaluated, one key at
+// a time, so an expression failing does not hide the keys beside it.
+func (e *execution) value(key string, parent interface{}) (interface{}, error) {
+	var raw interface{}
+	if section, ok := parent.(map[string]interface{}); ok {
+		raw = section[key[strings.LastIndex(key, ".")+1:]]
+	} else {
+		var err error
+		if raw, _, err = e.cfg.Lookup(key); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := raw.(map[string]interface{}); ok || !hasExpression(raw) {
+		return raw, nil
+	}
+	value, _, err := e.cfg.Resolve(key, e.vm)
+	return value, err
+}
+
+// complete turns a resolved value into the result for type t
+func (e *execution) complete(t *Type, value interface{}, selections []*selection, path []interface{}) interface{} {
+	if t.Kind == KindNonNull {
+		t = t.OfType
+	}
+	if value == nil {
+		return nil
+	}
+	switch t.Kind {
+	case KindList:
+		items, ok := value.([]interface{})
+		if !ok {
+			e.errors = append(e.errors, &Error{Message: fmt.Sprintf("expected a list, got %T", value), Path: path})
+			return nil
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			list[i] = e.complete(t.OfType, item, selections, append(append([]interface{}{}, path...), i))
+		}
+		return list
+	case KindObject:
+		return e.selectionSet(t, value, selections, path)
+	case KindEnum:
+		return value
+	}
+	result, err := serialize(t, value)
+	if err != nil {
+		e.errors = append(e.errors, &Error{Message: err.Error(), Path: path})
+		return nil
+	}
+	return result
+}
+
+// serialize coerces a value to a scalar type
+func serialize(t *Type, value interface{}) (interface{}, error) {
+	switch t {
+	case stringType, idType:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int, int64, float64, bool:
+			return fmt.Sprint(v), nil
+		}
+	case intType:
+		if n, ok := integral(value); ok && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return n, nil
+		}
+	case floatType:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+	case booleanType:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case valueType:
+		return value, nil
+	}
+	return nil, fmt.Errorf("cannot represent %v as %s", value, t.Name)
+}
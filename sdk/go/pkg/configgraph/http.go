@@ -0,0 +1,56 @@
+package configgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// maxBody caps the size of a POSTed request
+const maxBody = 1 << 20
+
+// DecodeRequest reads a request the way GraphQL over HTTP sends them: JSON
+// in the body of a POST, or the query, operationName and variables
+// parameters of a GET
+func DecodeRequest(rw http.ResponseWriter, r *http.Request) (Request, error) {
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		req.Query = params.Get("query")
+		req.OperationName = params.Get("operationName")
+		if variables := params.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return req, fmt.Errorf("variables must be a JSON object: %w", err)
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxBody)).Decode(&req); err != nil {
+			return req, fmt.Errorf("body must be a JSON request: %w", err)
+		}
+	default:
+		return req, fmt.Errorf("method %s is not allowed", r.Method)
+	}
+	if req.Query == "" {
+		return req, fmt.Errorf("query is required")
+	}
+	return req, nil
+}
+
+// ServeHTTP implements http.Handler; GraphQL errors are reported in the
+// response with status 200, malformed requests with 400
+func (g *Graph) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	req, err := DecodeRequest(rw, r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			rw.Header().Set("Allow", "GET, POST")
+			status = http.StatusMethodNotAllowed
+		}
+		rw.WriteHeader(status)
+		json.NewEncoder(rw).Encode(failed(err))
+		return
+	}
+	json.NewEncoder(rw).Encode(g.Execute(req))
+}
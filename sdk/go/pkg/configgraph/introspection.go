@@ -0,0 +1,213 @@
+package configgraph
+
+// Introspection types, so tools such as GraphiQL can discover the schema
+
+// directiveDef is a directive the executor supports
+type directiveDef struct {
+	name        string
+	description string
+	locations   []interface{}
+	args        []*Argument
+}
+
+var directives = []*directiveDef{
+	{
+		name:        "include",
+		description: "Includes the selection only when if is true",
+		locations:   []interface{}{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+		args:        []*Argument{{Name: "if", Type: nonNull(booleanType)}},
+	},
+	{
+		name:        "skip",
+		description: "Skips the selection when if is true",
+		locations:   []interface{}{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+		args:        []*Argument{{Name: "if", Type: nonNull(booleanType)}},
+	},
+}
+
+// enumValueDef is an element of Type.EnumValues, for introspection
+type enumValueDef string
+
+var (
+	schemaType         = &Type{Kind: KindObject, Name: "__Schema"}
+	typeType           = &Type{Kind: KindObject, Name: "__Type"}
+	fieldType          = &Type{Kind: KindObject, Name: "__Field"}
+	inputValueType     = &Type{Kind: KindObject, Name: "__InputValue"}
+	enumValueType      = &Type{Kind: KindObject, Name: "__EnumValue"}
+	directiveType      = &Type{Kind: KindObject, Name: "__Directive"}
+	typeKindType       = &Type{Kind: KindEnum, Name: "__TypeKind", EnumValues: []string{"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"}}
+	directiveLocations = &Type{Kind: KindEnum, Name: "__DirectiveLocation", EnumValues: []string{
+		"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT", "VARIABLE_DEFINITION",
+		"SCHEMA", "SCALAR", "OBJECT", "FIELD_DEFINITION", "ARGUMENT_DEFINITION", "INTERFACE", "UNION", "ENUM", "ENUM_VALUE", "INPUT_OBJECT", "INPUT_FIELD_DEFINITION",
+	}}
+	introspectionTypes = []*Type{schemaType, typeType, fieldType, inputValueType, enumValueType, directiveType, typeKindType, directiveLocations}
+)
+
+// includeDeprecated is the argument of the fields listing things that can
+// be deprecated; nothing here is
+var includeDeprecated = []*Argument{{Name: "includeDeprecated", Type: booleanType, DefaultValue: "false"}}
+
+// constant resolves to value
+func constant(value interface{}) resolver {
+	return func(*execution, interface{}, map[string]interface{}) (interface{}, error) { return value, nil }
+}
+
+func init() {
+	schemaType.Fields = []*Field{
+		{Name: "description", Type: stringType, resolve: constant(nil)},
+		{Name: "types", Type: nonNull(listOf(nonNull(typeType))), resolve: func(e *execution, _ interface{}, _ map[string]interface{}) (interface{}, error) {
+			var types []interface{}
+			for _, t := range e.schema.Types() {
+				types = append(types, t)
+			}
+			return types, nil
+		}},
+		{Name: "queryType", Type: nonNull(typeType), resolve: func(e *execution, _ interface{}, _ map[string]interface{}) (interface{}, error) {
+			return e.schema.Query, nil
+		}},
+		{Name: "mutationType", Type: typeType, resolve: constant(nil)},
+		{Name: "subscriptionType", Type: typeType, resolve: constant(nil)},
+		{Name: "directives", Type: nonNull(listOf(nonNull(directiveType))), resolve: func(*execution, interface{}, map[string]interface{}) (interface{}, error) {
+			list := make([]interface{}, len(directives))
+			for i, d := range directives {
+				list[i] = d
+			}
+			return list, nil
+		}},
+	}
+
+	typeType.Fields = []*Field{
+		{Name: "kind", Type: nonNull(typeKindType), resolve: typeField(func(t *Type) interface{} { return t.Kind })},
+		{Name: "name", Type: stringType, resolve: typeField(func(t *Type) interface{} { return optional(t.Name) })},
+		{Name: "description", Type: stringType, resolve: typeField(func(t *Type) interface{} { return optional(t.Description) })},
+		{Name: "specifiedByURL", Type: stringType, resolve: constant(nil)},
+		{Name: "fields", Type: listOf(nonNull(fieldType)), Args: includeDeprecated, resolve: typeField(func(t *Type) interface{} {
+			if t.Kind != KindObject {
+				return nil
+			}
+			list := make([]interface{}, len(t.Fields))
+			for i, f := range t.Fields {
+				list[i] = f
+			}
+			return list
+		})},
+		{Name: "interfaces", Type: listOf(nonNull(typeType)), resolve: typeField(func(t *Type) interface{} {
+			if t.Kind != KindObject {
+				return nil
+			}
+			return []interface{}{}
+		})},
+		{Name: "possibleTypes", Type: listOf(nonNull(typeType)), resolve: constant(nil)},
+		{Name: "enumValues", Type: listOf(nonNull(enumValueType)), Args: includeDeprecated, resolve: typeField(func(t *Type) interface{} {
+			if t.Kind != KindEnum {
+				return nil
+			}
+			list := make([]interface{}, len(t.EnumValues))
+			for i, v := range t.EnumValues {
+				list[i] = enumValueDef(v)
+			}
+			return list
+		})},
+		{Name: "inputFields", Type: listOf(nonNull(inputValueType)), Args: includeDeprecated, resolve: constant(nil)},
+		{Name: "ofType", Type: typeType, resolve: typeField(func(t *Type) interface{} {
+			if t.OfType == nil {
+				return nil
+			}
+			return t.OfType
+		})},
+		{Name: "isOneOf", Type: booleanType, resolve: constant(nil)},
+	}
+
+	fieldType.Fields = []*Field{
+		{Name: "name", Type: nonNull(stringType), resolve: fieldField(func(f *Field) interface{} { return f.Name })},
+		{Name: "description", Type: stringType, resolve: fieldField(func(f *Field) interface{} { return optional(f.Description) })},
+		{Name: "args", Type: nonNull(listOf(nonNull(inputValueType))), Args: includeDeprecated, resolve: fieldField(func(f *Field) interface{} {
+			return arguments(f.Args)
+		})},
+		{Name: "type", Type: nonNull(typeType), resolve: fieldField(func(f *Field) interface{} { return f.Type })},
+		{Name: "isDeprecated", Type: nonNull(booleanType), resolve: constant(false)},
+		{Name: "deprecationReason", Type: stringType, resolve: constant(nil)},
+	}
+
+	argumentField := func(get func(a *Argument) interface{}) resolver {
+		return func(_ *execution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return get(parent.(*Argument)), nil
+		}
+	}
+	inputValueType.Fields = []*Field{
+		{Name: "name", Type: nonNull(stringType), resolve: argumentField(func(a *Argument) interface{} { return a.Name })},
+		{Name: "description", Type: stringType, resolve: argumentField(func(a *Argument) interface{} { return optional(a.Description) })},
+		{Name: "type", Type: nonNull(typeType), resolve: argumentField(func(a *Argument) interface{} { return a.Type })},
+		{Name: "defaultValue", Type: stringType, resolve: argumentField(func(a *Argument) interface{} { return optional(a.DefaultValue) })},
+		{Name: "isDeprecated", Type: nonNull(booleanType), resolve: constant(false)},
+		{Name: "deprecationReason", Type: stringType, resolve: constant(nil)},
+	}
+
+	enumValueType.Fields = []*Field{
+		{Name: "name", Type: nonNull(stringType), resolve: func(_ *execution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return string(parent.(enumValueDef)), nil
+		}},
+		{Name: "description", Type: stringType, resolve: constant(nil)},
+		{Name: "isDeprecated", Type: nonNull(booleanType), resolve: constant(false)},
+		{Name: "deprecationReason", Type: stringType, resolve: constant(nil)},
+	}
+
+	directiveField := func(get func(d *directiveDef) interface{}) resolver {
+		return func(_ *execution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return get(parent.(*directiveDef)), nil
+		}
+	}
+	directiveType.Fields = []*Field{
+		{Name: "name", Type: nonNull(stringType), resolve: directiveField(func(d *directiveDef) interface{} { return d.name })},
+		{Name: "description", Type: stringType, resolve: directiveField(func(d *directiveDef) interface{} { return d.description })},
+		{Name: "locations", Type: nonNull(listOf(nonNull(directiveLocations))), resolve: directiveField(func(d *directiveDef) interface{} { return d.locations })},
+		{Name: "args", Type: nonNull(listOf(nonNull(inputValueType))), Args: includeDeprecated, resolve: directiveField(func(d *directiveDef) interface{} {
+			return arguments(d.args)
+		})},
+		{Name: "isRepeatable", Type: nonNull(booleanType), resolve: constant(false)},
+	}
+}
+
+func typeField(get func(t *Type) interface{}) resolver {
+	return func(_ *execution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+		return get(parent.(*Type)), nil
+	}
+}
+
+func fieldField(get func(f *Field) interface{}) resolver {
+	return func(_ *execution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+		return get(parent.(*Field)), nil
+	}
+}
+
+func arguments(args []*Argument) []interface{} {
+	list := make([]interface{}, len(args))
+	for i, a := range args {
+		list[i] = a
+	}
+	return list
+}
+
+// optional turns empty strings into null
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// introspectionFields are the meta fields of the query type
+var introspectionFields = map[string]*Field{
+	"__schema": {Name: "__schema", Type: nonNull(schemaType), resolve: func(e *execution, _ interface{}, _ map[string]interface{}) (interface{}, error) {
+		return e.schema, nil
+	}},
+	"__type": {Name: "__type", Type: typeType, Args: []*Argument{{Name: "name", Type: nonNull(stringType)}}, resolve: func(e *execution, _ interface{}, args map[string]interface{}) (interface{}, error) {
+		if t := e.schema.Type(args["name"].(string)); t != nil {
+			return t, nil
+		}
+		return nil, nil
+	}},
+}
+
+// typenameField is the meta field every object type has
+var typenameField = &Field{Name: "__typename", Type: nonNull(stringType)}
@@ -0,0 +1,352 @@
+package configgraph
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// Kinds of types, as introspection reports them
+const (
+	KindScalar  = "SCALAR"
+	KindObject  = "OBJECT"
+	KindEnum    = "ENUM"
+	KindList    = "LIST"
+	KindNonNull = "NON_NULL"
+)
+
+// Type is a GraphQL type. Named types are shared through the schema; list
+// and non-null types wrap OfType.
+type Type struct {
+	Kind        string
+	Name        string
+	Description string
+	Fields      []*Field
+	EnumValues  []string
+	OfType      *Type
+}
+
+// Field returns the field called name, or nil
+func (t *Type) Field(name string) *Field {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// named unwraps list and non-null types
+func (t *Type) named() *Type {
+	for t.OfType != nil {
+		t = t.OfType
+	}
+	return t
+}
+
+// String returns the type as written in a query, e.g. [String!]!
+func (t *Type) String() string {
+	switch t.Kind {
+	case KindList:
+		return "[" + t.OfType.String() + "]"
+	case KindNonNull:
+		return t.OfType.String() + "!"
+	}
+	return t.Name
+}
+
+func listOf(t *Type) *Type  { return &Type{Kind: KindList, OfType: t} }
+func nonNull(t *Type) *Type { return &Type{Kind: KindNonNull, OfType: t} }
+
+// Field is a field of an object type
+type Field struct {
+	Name        string
+	Description string
+	Type        *Type
+	Args        []*Argument
+	// Key is the dotted path of the configuration key the field reads;
+	// empty for fields that are not configuration keys
+	Key string
+
+	resolve resolver
+}
+
+// Argument is an argument of a field or directive
+type Argument struct {
+	Name        string
+	Description string
+	Type        *Type
+	// DefaultValue is the default as a GraphQL literal, empty for none
+	DefaultValue string
+}
+
+// resolver computes the value of a field of parent; fields without one
+// read their Key from the configuration
+type resolver func(e *execution, parent interface{}, args map[string]interface{}) (interface{}, error)
+
+// Built-in scalars; Value carries any JSON value, for operator results and
+// values without a more precise type
+var (
+	stringType  = &Type{Kind: KindScalar, Name: "String", Description: "A UTF-8 string"}
+	intType     = &Type{Kind: KindScalar, Name: "Int", Description: "A signed 32-bit integer"}
+	floatType   = &Type{Kind: KindScalar, Name: "Float", Description: "A double-precision floating point number"}
+	booleanType = &Type{Kind: KindScalar, Name: "Boolean", Description: "true or false"}
+	idType      = &Type{Kind: KindScalar, Name: "ID", Description: "A unique identifier"}
+	valueType   = &Type{Kind: KindScalar, Name: "Value", Description: "Any JSON value, such as the result of an operator expression"}
+)
+
+// Schema is the GraphQL schema of a configuration: every section is an
+// object type and every key a field, typed from its raw value
+type Schema struct {
+	Query *Type
+	types map[string]*Type
+}
+
+// NewSchema builds the schema of cfg. Values are typed as written; keys
+// holding operator expressions are of type Value, since what they evaluate
+// to is only known when a query selects them.
+func NewSchema(cfg *peanut.Config) (*Schema, error) {
+	values, err := cfg.Values()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	s := &Schema{types: make(map[string]*Type)}
+	for _, t := range []*Type{stringType, intType, floatType, booleanType, idType, valueType} {
+		s.types[t.Name] = t
+	}
+	for _, t := range introspectionTypes {
+		s.types[t.Name] = t
+	}
+
+	s.Query = &Type{Kind: KindObject, Name: "Query", Description: "The configuration"}
+	s.types["Query"] = s.Query
+	names := map[string]bool{"value": true}
+	tree := config.Nest(values)
+	for _, key := range sortedKeys(tree) {
+		s.Query.Fields = append(s.Query.Fields, s.field(names, nil, key, tree[key]))
+	}
+	s.Query.Fields = append(s.Query.Fields, &Field{
+		Name:        "value",
+		Description: "The value or section at a dotted key path, evaluated",
+		Type:        valueType,
+		Args:        []*Argument{{Name: "key", Description: "A dotted key path, e.g. database.host", Type: nonNull(stringType)}},
+		resolve: func(e *execution, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			value, _, err := e.cfg.Resolve(args["key"].(string), e.vm)
+			return value, err
+		},
+	})
+	return s, nil
+}
+
+// field builds the field of key in the section at path
+func (s *Schema) field(names map[string]bool, path []string, key string, value interface{}) *Field {
+	name := unique(names, fieldName(key), "_")
+	full := strings.Join(append(append([]string{}, path...), key), ".")
+	f := &Field{Name: name, Description: full, Key: full}
+	if section, ok := value.(map[string]interface{}); ok {
+		f.Type = s.object(append(append([]string{}, path...), key), section)
+		return f
+	}
+	f.Type = leafType(value)
+	if hasExpression(value) {
+		f.Description += ", evaluated when queried"
+	}
+	return f
+}
+
+// object builds the type of the section at path
+func (s *Schema) object(path []string, section map[string]interface{}) *Type {
+	var name strings.Builder
+	for _, part := range path {
+		name.WriteString(pascal(part))
+	}
+	taken := make(map[string]bool, len(s.types))
+	for n := range s.types {
+		taken[n] = true
+	}
+	t := &Type{
+		Kind:        KindObject,
+		Name:        unique(taken, name.String(), ""),
+		Description: "The " + strings.Join(path, ".") + " section",
+	}
+	s.types[t.Name] = t
+	names := make(map[string]bool)
+	for _, key := range sortedKeys(section) {
+		t.Fields = append(t.Fields, s.field(names, path, key, section[key]))
+	}
+	return t
+}
+
+// leafType types a raw value
+func leafType(value interface{}) *Type {
+	switch v := value.(type) {
+	case string:
+		if isExpression(v) {
+			return valueType
+		}
+		return stringType
+	case bool:
+		return booleanType
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return intType
+		}
+	case int64:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return intType
+		}
+	case float64:
+		return floatType
+	case []interface{}:
+		var item *Type
+		for _, element := range v {
+			t := leafType(element)
+			if t.Kind != KindScalar || item != nil && item != t {
+				return listOf(valueType)
+			}
+			item = t
+		}
+		if item == nil {
+			item = valueType
+		}
+		return listOf(item)
+	}
+	return valueType
+}
+
+// isExpression reports whether value is an operator expression, evaluated
+// at query time
+func isExpression(value interface{}) bool {
+	s, ok := value.(string)
+	if !ok || !strings.Contains(s, "@") {
+		return false
+	}
+	_, err := peanut.CompileExpression(s)
+	return err == nil
+}
+
+// hasExpression reports whether a raw value is or holds an expression
+func hasExpression(value interface{}) bool {
+	if list, ok := value.([]interface{}); ok {
+		for _, item := range list {
+			if isExpression(item) {
+				return true
+			}
+		}
+		return false
+	}
+	return isExpression(value)
+}
+
+// Type returns the named type, or nil
+func (s *Schema) Type(name string) *Type {
+	return s.types[name]
+}
+
+// Types returns every named type, sorted by name
+func (s *Schema) Types() []*Type {
+	types := make([]*Type, 0, len(s.types))
+	for _, t := range s.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+// String prints the schema in the GraphQL schema definition language,
+// leaving out built-in and introspection types
+func (s *Schema) String() string {
+	var b strings.Builder
+	b.WriteString("scalar Value\n")
+	types := []*Type{s.Query}
+	for _, t := range s.Types() {
+		if t.Kind == KindObject && t != s.Query && !strings.HasPrefix(t.Name, "__") {
+			types = append(types, t)
+		}
+	}
+	for _, t := range types {
+		fmt.Fprintf(&b, "\n%q\ntype %s {\n", t.Description, t.Name)
+		for _, f := range t.Fields {
+			fmt.Fprintf(&b, "  %q\n  %s", f.Description, f.Name)
+			if len(f.Args) > 0 {
+				args := make([]string, len(f.Args))
+				for i, a := range f.Args {
+					args[i] = a.Name + ": " + a.Type.String()
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			fmt.Fprintf(&b, ": %s\n", f.Type)
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// fieldName turns a configuration key into a GraphQL name: characters
+// outside [_A-Za-z0-9] become underscores and names cannot start with a
+// digit or with the __ reserved for introspection
+func fieldName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		if !isNameChar(c) {
+			name[i] = '_'
+		}
+	}
+	s := string(name)
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	if strings.HasPrefix(s, "__") {
+		s = "_" + strings.TrimLeft(s, "_")
+	}
+	return s
+}
+
+// pascal turns a configuration key into a type name part, e.g.
+// connection_pool into ConnectionPool
+func pascal(key string) string {
+	var b strings.Builder
+	upper := true
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case !isNameChar(c) || c == '_':
+			upper = true
+		case upper && c >= 'a' && c <= 'z':
+			b.WriteByte(c - 'a' + 'A')
+			upper = false
+		default:
+			b.WriteByte(c)
+			upper = false
+		}
+	}
+	s := b.String()
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	return s
+}
+
+// unique returns name, or name with the first free numeric suffix, and
+// marks it as taken
+func unique(taken map[string]bool, name, separator string) string {
+	candidate := name
+	for i := 2; taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s%s%d", name, separator, i)
+	}
+	taken[candidate] = true
+	return candidate
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,194 @@
+// Package convert provides conversion between TSK and other configuration formats
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies a configuration file format
+type Format string
+
+// Supported formats
+const (
+	FormatTSK  Format = "tsk"
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+	FormatEnv  Format = "env"
+	FormatINI  Format = "ini"
+)
+
+// Formats lists every supported format
+var Formats = []Format{FormatTSK, FormatJSON, FormatYAML, FormatTOML, FormatEnv, FormatINI}
+
+// EnvSeparator joins nested keys in .env output (DATABASE__HOST) so that
+// keys containing single underscores survive a round trip
+const EnvSeparator = "__"
+
+// ParseFormat converts a format name such as "yml" or ".env" into a Format
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "tsk", "peanuts", "tusk":
+		return FormatTSK, nil
+	case "json":
+		return FormatJSON, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "toml":
+		return FormatTOML, nil
+	case "env", "dotenv":
+		return FormatEnv, nil
+	case "ini", "cfg", "conf":
+		return FormatINI, nil
+	}
+	return "", fmt.Errorf("unsupported format %q (supported: tsk, json, yaml, toml, env, ini)", name)
+}
+
+// DetectFormat guesses the format of a file from its name
+func DetectFormat(filename string) (Format, error) {
+	base := filepath.Base(filename)
+	if base == ".env" || strings.HasPrefix(base, ".env.") {
+		return FormatEnv, nil
+	}
+	ext := filepath.Ext(base)
+	if ext == "" {
+		return "", fmt.Errorf("cannot detect format of %s, specify it explicitly", filename)
+	}
+	return ParseFormat(ext)
+}
+
+// Convert reads a document in one format and writes it in another
+func Convert(r io.Reader, w io.Writer, from, to Format) error {
+	tree, err := Decode(r, from)
+	if err != nil {
+		return err
+	}
+	return Encode(w, tree, to)
+}
+
+// Decode reads a document into nested maps
+func Decode(r io.Reader, from Format) (map[string]interface{}, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	tree := make(map[string]interface{})
+	switch from {
+	case FormatTSK:
+		cfg := config.New()
+		if err := cfg.LoadTSK(data); err != nil {
+			return nil, fmt.Errorf("failed to parse TSK: %w", err)
+		}
+		return cfg.Tree(), nil
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tree); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+	case FormatTOML:
+		if err := toml.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("failed to parse TOML: %w", err)
+		}
+	case FormatEnv:
+		return decodeEnv(data)
+	case FormatINI:
+		return decodeINI(data)
+	default:
+		return nil, fmt.Errorf("unsupported input format %q", from)
+	}
+
+	normalized, ok := normalize(tree).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("document root must be a mapping")
+	}
+	return normalized, nil
+}
+
+// Encode writes nested maps in the requested format
+func Encode(w io.Writer, tree map[string]interface{}, to Format) error {
+	var data []byte
+	var err error
+
+	switch to {
+	case FormatTSK:
+		data = encodeTSK(tree)
+	case FormatJSON:
+		data, err = json.MarshalIndent(tree, "", "  ")
+		data = append(data, '\n')
+	case FormatYAML:
+		data, err = yaml.Marshal(tree)
+	case FormatTOML:
+		data, err = toml.Marshal(tree)
+	case FormatEnv:
+		data, err = encodeEnv(tree)
+	case FormatINI:
+		data, err = encodeINI(tree)
+	default:
+		return fmt.Errorf("unsupported output format %q", to)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", to, err)
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// normalize converts decoder-specific types into the TSK value model:
+// string, int, float64, bool, nil, []interface{} and map[string]interface{}
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = normalize(item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[fmt.Sprintf("%v", key)] = normalize(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = normalize(item)
+		}
+		return out
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+		f, _ := v.Float64()
+		return f
+	case int64:
+		return int(v)
+	case uint64:
+		return int(v)
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	case nil, string, bool, int:
+		return v
+	default:
+		// Dates and other scalar types are carried as their string form
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,66 @@
+package convert
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleTSK = `app_name: "TuskLang Demo"
+version: "1.0"
+debug: true
+port_env: @env("PORT", "8080")
+
+[database]
+host: "localhost"
+port: 5432
+ratio: 0.75
+tags: ["primary", "eu-west"]
+
+postgresql {
+    user: "admin"
+    max_idle: 4
+}
+`
+
+func TestRoundTrip(t *testing.T) {
+	original, err := Decode(strings.NewReader(sampleTSK), FormatTSK)
+	if err != nil {
+		t.Fatalf("Decode(tsk) returned error: %v", err)
+	}
+
+	for _, format := range Formats {
+		var buf bytes.Buffer
+		if err := Encode(&buf, original, format); err != nil {
+			t.Fatalf("Encode(%s) returned error: %v", format, err)
+		}
+
+		decoded, err := Decode(&buf, format)
+		if err != nil {
+			t.Fatalf("Decode(%s) returned error: %v\n%s", format, err, buf.String())
+		}
+
+		if !reflect.DeepEqual(original, decoded) {
+			t.Errorf("%s round trip mismatch:\nwant %#v\ngot  %#v", format, original, decoded)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]Format{
+		"peanu.tsk":     FormatTSK,
+		"config.yml":    FormatYAML,
+		".env":          FormatEnv,
+		".env.local":    FormatEnv,
+		"settings.json": FormatJSON,
+		"app.ini":       FormatINI,
+		"Cargo.toml":    FormatTOML,
+	}
+	for file, want := range cases {
+		got, err := DetectFormat(file)
+		if err != nil || got != want {
+			t.Errorf("DetectFormat(%q) = %q, %v; want %q", file, got, err, want)
+		}
+	}
+}
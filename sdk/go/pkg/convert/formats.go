@@ -0,0 +1,309 @@
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+)
+
+// operatorPattern matches unquoted TSK expressions (@operators and $variables)
+// that must be written back without quotes to keep their meaning
+var operatorPattern = regexp.MustCompile(`^(@[\w.]+\(.*\)|\$[A-Za-z_]\w*.*)$`)
+
+// TSK
+
+// encodeTSK writes top-level scalars first, then one [section] per top-level
+// map with deeper maps rendered as `name {` blocks
+func encodeTSK(tree map[string]interface{}) []byte {
+	var buf bytes.Buffer
+
+	scalars, sections := splitKeys(tree)
+	for _, key := range scalars {
+		writeTSKValue(&buf, "", key, tree[key])
+	}
+
+	for _, key := range sections {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(fmt.Sprintf("[%s]\n", key))
+		writeTSKMap(&buf, "", tree[key].(map[string]interface{}))
+	}
+
+	return buf.Bytes()
+}
+
+func writeTSKMap(buf *bytes.Buffer, indent string, m map[string]interface{}) {
+	scalars, nested := splitKeys(m)
+	for _, key := range scalars {
+		writeTSKValue(buf, indent, key, m[key])
+	}
+	for _, key := range nested {
+		buf.WriteString(fmt.Sprintf("%s%s {\n", indent, key))
+		writeTSKMap(buf, indent+"    ", m[key].(map[string]interface{}))
+		buf.WriteString(indent + "}\n")
+	}
+}
+
+func writeTSKValue(buf *bytes.Buffer, indent, key string, value interface{}) {
+	// TSK has no literal for arrays of maps, so those become indexed blocks
+	if items, ok := value.([]interface{}); ok && containsMaps(items) {
+		indexed := make(map[string]interface{}, len(items))
+		for i, item := range items {
+			indexed[strconv.Itoa(i)] = item
+		}
+		buf.WriteString(fmt.Sprintf("%s%s {\n", indent, key))
+		writeTSKMap(buf, indent+"    ", indexed)
+		buf.WriteString(indent + "}\n")
+		return
+	}
+	buf.WriteString(fmt.Sprintf("%s%s: %s\n", indent, key, formatTSKValue(value)))
+}
+
+func formatTSKValue(value interface{}) string {
+	if s, ok := value.(string); ok && operatorPattern.MatchString(s) {
+		return s
+	}
+	return config.FormatValue(value)
+}
+
+// .env
+
+func encodeEnv(tree map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	flat := config.Flatten(tree)
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ToUpper(strings.ReplaceAll(key, ".", EnvSeparator))
+		name = strings.Map(func(r rune) rune {
+			if r == '_' || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '_'
+		}, name)
+
+		var value string
+		switch v := flat[key].(type) {
+		case nil:
+			value = ""
+		case string:
+			value = strconv.Quote(v)
+		case []interface{}, map[string]interface{}:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			value = "'" + string(data) + "'"
+		default:
+			value = config.FormatValue(v)
+		}
+		buf.WriteString(fmt.Sprintf("%s=%s\n", name, value))
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeEnv(data []byte) (map[string]interface{}, error) {
+	flat := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		eq := strings.Index(line, "=")
+		if eq == -1 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNum)
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:eq]))
+		key = strings.ReplaceAll(key, strings.ToLower(EnvSeparator), ".")
+		flat[key] = parseEnvValue(strings.TrimSpace(line[eq+1:]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return config.Nest(flat), nil
+}
+
+func parseEnvValue(raw string) interface{} {
+	// Single-quoted JSON carries arrays and maps
+	if len(raw) >= 2 && raw[0] == '\'' && raw[len(raw)-1] == '\'' {
+		inner := raw[1 : len(raw)-1]
+		var v interface{}
+		if strings.HasPrefix(inner, "[") || strings.HasPrefix(inner, "{") {
+			if err := json.Unmarshal([]byte(inner), &v); err == nil {
+				return normalize(v)
+			}
+		}
+		return inner
+	}
+	if raw == "" {
+		return ""
+	}
+	if !strings.HasPrefix(raw, `"`) {
+		// Unquoted values may carry a trailing comment
+		if i := strings.Index(raw, " #"); i != -1 {
+			raw = strings.TrimSpace(raw[:i])
+		}
+	}
+	return config.ParseValue(raw)
+}
+
+// INI
+
+func encodeINI(tree map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	scalars, sections := splitKeys(tree)
+	for _, key := range scalars {
+		if err := writeINIValue(&buf, key, tree[key]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Nested maps become dotted section names: [database.postgresql]
+	var writeSection func(name string, m map[string]interface{}) error
+	writeSection = func(name string, m map[string]interface{}) error {
+		values, children := splitKeys(m)
+		if len(values) > 0 || len(children) == 0 {
+			if buf.Len() > 0 {
+				buf.WriteString("\n")
+			}
+			buf.WriteString(fmt.Sprintf("[%s]\n", name))
+			for _, key := range values {
+				if err := writeINIValue(&buf, key, m[key]); err != nil {
+					return err
+				}
+			}
+		}
+		for _, key := range children {
+			if err := writeSection(name+"."+key, m[key].(map[string]interface{})); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, key := range sections {
+		if err := writeSection(key, tree[key].(map[string]interface{})); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeINIValue(buf *bytes.Buffer, key string, value interface{}) error {
+	var out string
+	switch v := value.(type) {
+	case nil:
+		out = ""
+	case string:
+		// Quote strings that would otherwise be read back as another type
+		if _, isString := config.ParseValue(v).(string); isString && strings.TrimSpace(v) == v &&
+			!strings.ContainsAny(v, ";#\"'") {
+			out = v
+		} else {
+			out = strconv.Quote(v)
+		}
+	case []interface{}:
+		if containsMaps(v) {
+			return fmt.Errorf("key %s: INI cannot represent arrays of maps", key)
+		}
+		out = config.FormatValue(v)
+	default:
+		out = config.FormatValue(v)
+	}
+	buf.WriteString(fmt.Sprintf("%s = %s\n", key, out))
+	return nil
+}
+
+func decodeINI(data []byte) (map[string]interface{}, error) {
+	flat := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	section := ""
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep == -1 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		key := strings.TrimSpace(line[:sep])
+		if section != "" {
+			key = section + "." + key
+		}
+		raw := strings.TrimSpace(line[sep+1:])
+		if !strings.HasPrefix(raw, `"`) && !strings.HasPrefix(raw, "'") {
+			if i := strings.IndexAny(raw, ";#"); i != -1 {
+				raw = strings.TrimSpace(raw[:i])
+			}
+		}
+		if raw == "" {
+			flat[key] = ""
+			continue
+		}
+		flat[key] = config.ParseValue(raw)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return config.Nest(flat), nil
+}
+
+// Helper functions
+
+// splitKeys returns the sorted scalar keys and the sorted map-valued keys of m
+func splitKeys(m map[string]interface{}) ([]string, []string) {
+	var scalars, maps []string
+	for key, value := range m {
+		if _, ok := value.(map[string]interface{}); ok {
+			maps = append(maps, key)
+		} else {
+			scalars = append(scalars, key)
+		}
+	}
+	sort.Strings(scalars)
+	sort.Strings(maps)
+	return scalars, maps
+}
+
+func containsMaps(items []interface{}) bool {
+	for _, item := range items {
+		if _, ok := item.(map[string]interface{}); ok {
+			return true
+		}
+	}
+	return false
+}
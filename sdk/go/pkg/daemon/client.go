@@ -0,0 +1,118 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Client talks to a daemon over its socket
+type Client struct {
+	http *http.Client
+}
+
+// NewClient connects to the daemon listening on socket
+func NewClient(socket string) *Client {
+	return &Client{http: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}}
+}
+
+// Get looks key up in the hierarchy of dir, an absolute path
+func (c *Client) Get(ctx context.Context, dir, key string) (Lookup, error) {
+	query := url.Values{"dir": {dir}, "key": {key}}
+	var out Lookup
+	if err := c.call(ctx, "GET", "/v1/get?"+query.Encode(), &out); err != nil {
+		return out, err
+	}
+	out.Value = normalize(out.Value)
+	if out.Origin != nil {
+		for i := range out.Origin.Chain {
+			out.Origin.Chain[i].Value = normalize(out.Origin.Chain[i].Value)
+		}
+	}
+	return out, nil
+}
+
+// Status describes the daemon
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var out Status
+	return out, c.call(ctx, "GET", "/v1/status", &out)
+}
+
+// Shutdown stops the daemon
+func (c *Client) Shutdown(ctx context.Context) (Status, error) {
+	var out Status
+	return out, c.call(ctx, "POST", "/v1/shutdown", &out)
+}
+
+// URL is the base URL of requests made through HTTP
+const URL = "http://daemon"
+
+// HTTP returns a client whose requests to URL reach the daemon, such as
+// those of its profiling endpoints
+func (c *Client) HTTP() *http.Client {
+	return c.http
+}
+
+func (c *Client) call(ctx context.Context, method, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, URL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrNotRunning
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &body) == nil && body.Error != "" {
+			return errors.New(body.Error)
+		}
+		return fmt.Errorf("daemon answered %s", resp.Status)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(out)
+}
+
+// normalize turns json.Numbers back into ints where they are integral and
+// float64s otherwise, as the files hold them
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalize(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+	}
+	return value
+}
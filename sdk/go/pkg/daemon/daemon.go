@@ -0,0 +1,307 @@
+// Package daemon keeps peanut hierarchies loaded in a background process,
+// for `tsk daemon`, and answers lookups on a unix socket so CLI commands
+// such as `tsk config get` skip parsing the files on every invocation:
+//
+//	GET  /v1/get?dir=/srv/app&key=database.host
+//	GET  /v1/status
+//	POST /v1/shutdown
+//
+// With Options.Profiling enabled, the endpoints of pkg/profiling are served
+// on the socket too, or on their own address. With Options.Tracing enabled,
+// every request is traced.
+//
+// A loaded hierarchy is used for as long as peanut.HierarchyStamp reports
+// its files unchanged, so answers are never staler than the files. Values
+// are returned as the files hold them: expressions are left for the caller
+// to evaluate, in its own environment.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/profiling"
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
+)
+
+// ErrNotRunning is returned by Client when no daemon answers on the socket
+var ErrNotRunning = tskerrors.New(tskerrors.Connection, "the daemon is not running")
+
+// ErrRunning is returned by Serve when another daemon answers on the socket
+var ErrRunning = tskerrors.New(tskerrors.Conflict, "a daemon is already running")
+
+// Options configures a Server
+type Options struct {
+	// Idle stops the daemon after that long without requests; zero keeps
+	// it running
+	Idle time.Duration
+	// MaxDirs caps the hierarchies kept loaded, dropping the least
+	// recently used; zero means 64
+	MaxDirs int
+	// Profiling serves the profiling endpoints and takes continuous
+	// profiles when enabled
+	Profiling profiling.Options
+	// Tracing exports a span for every request when enabled
+	Tracing tracing.Options
+	// Report receives the failures of continuous profiling and of trace
+	// exports
+	Report func(error)
+}
+
+// Lookup is the answer to a get
+type Lookup struct {
+	Key   string      `json:"key"`
+	Found bool        `json:"found"`
+	Value interface{} `json:"value,omitempty"`
+	// Origin is where the value came from, for keys that are not sections
+	Origin *peanut.KeyOrigin `json:"origin,omitempty"`
+	// Files are the files of the hierarchy, root first
+	Files []string `json:"files"`
+}
+
+// Status describes a running daemon
+type Status struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	// Dirs are the hierarchies loaded
+	Dirs    []string `json:"dirs"`
+	Lookups int64    `json:"lookups"`
+	// Loads counts the hierarchies parsed, first loads and reloads
+	Loads int64 `json:"loads"`
+}
+
+// Server keeps hierarchies loaded and answers lookups
+type Server struct {
+	opts    Options
+	started time.Time
+	lookups atomic.Int64
+	loads   atomic.Int64
+	last    atomic.Int64
+
+	mu      sync.RWMutex
+	entries map[string]*entry
+}
+
+// entry is a loaded hierarchy
+type entry struct {
+	cfg   *peanut.Config
+	files []string
+	stamp string
+	used  atomic.Int64
+}
+
+// NewServer returns a Server with nothing loaded yet
+func NewServer(opts Options) *Server {
+	if opts.MaxDirs <= 0 {
+		opts.MaxDirs = 64
+	}
+	s := &Server{opts: opts, started: time.Now(), entries: make(map[string]*entry)}
+	s.last.Store(time.Now().UnixNano())
+	return s
+}
+
+// acquire returns the hierarchy of dir with s.mu read-locked, loading it
+// again when its files changed since it was loaded. Reloads wait for the
+// lookups using the previous configuration before closing it.
+func (s *Server) acquire(dir string) (*entry, error) {
+	stamp, err := peanut.HierarchyStamp(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		s.mu.RLock()
+		if e, ok := s.entries[dir]; ok && e.stamp == stamp {
+			e.used.Store(time.Now().UnixNano())
+			return e, nil
+		}
+		s.mu.RUnlock()
+
+		s.mu.Lock()
+		if e, ok := s.entries[dir]; !ok || e.stamp != stamp {
+			cfg, files, err := peanut.LoadHierarchy(dir)
+			if err != nil {
+				s.mu.Unlock()
+				return nil, err
+			}
+			s.loads.Add(1)
+			if ok {
+				e.cfg.Close()
+			}
+			s.entries[dir] = &entry{cfg: cfg, files: files, stamp: stamp}
+			if len(s.entries) > s.opts.MaxDirs {
+				s.evict(dir)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// evict drops the least recently used hierarchy other than keep; s.mu
+// must be held
+func (s *Server) evict(keep string) {
+	oldest := ""
+	for dir, e := range s.entries {
+		if dir != keep && (oldest == "" || e.used.Load() < s.entries[oldest].used.Load()) {
+			oldest = dir
+		}
+	}
+	s.entries[oldest].cfg.Close()
+	delete(s.entries, oldest)
+}
+
+// Get looks key up in the hierarchy of dir
+func (s *Server) Get(dir, key string) (Lookup, error) {
+	s.lookups.Add(1)
+	e, err := s.acquire(dir)
+	if err != nil {
+		return Lookup{}, err
+	}
+	defer s.mu.RUnlock()
+	result := Lookup{Key: key, Files: e.files}
+	result.Value, result.Found, err = e.cfg.Lookup(key)
+	if err != nil {
+		return result, err
+	}
+	if origin, ok := e.cfg.Origin(key); ok {
+		result.Origin = &origin
+	}
+	return result, nil
+}
+
+// Status describes the server
+func (s *Server) Status() Status {
+	s.mu.RLock()
+	dirs := make([]string, 0, len(s.entries))
+	for dir := range s.entries {
+		dirs = append(dirs, dir)
+	}
+	s.mu.RUnlock()
+	sort.Strings(dirs)
+	return Status{PID: os.Getpid(), Started: s.started, Dirs: dirs, Lookups: s.lookups.Load(), Loads: s.loads.Load()}
+}
+
+// Serve answers on the unix socket until ctx is done, a client asks it to
+// shut down or it has been idle for opts.Idle
+func (s *Server) Serve(ctx context.Context, socket string) error {
+	if _, err := NewClient(socket).Status(ctx); err == nil {
+		return fmt.Errorf("%w on %s", ErrRunning, socket)
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(socket), err)
+	}
+	// The socket of a daemon that died without cleaning up
+	os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socket, err)
+	}
+
+	stopProfiling, err := profiling.Start(s.opts.Profiling, s.report("continuous profiling"))
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	defer stopProfiling()
+	provider, err := tracing.Setup(s.opts.Tracing, nil, s.report("tracing"))
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	defer func() {
+		flush, done := context.WithTimeout(context.Background(), 5*time.Second)
+		defer done()
+		provider.Shutdown(flush)
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	server := &http.Server{Handler: s.handler(cancel), ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+
+	var idle <-chan time.Time
+	if s.opts.Idle > 0 {
+		ticker := time.NewTicker(min(s.opts.Idle/4, time.Minute))
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+wait:
+	for {
+		select {
+		case err := <-errs:
+			return fmt.Errorf("failed to serve: %w", err)
+		case <-idle:
+			if time.Since(time.Unix(0, s.last.Load())) >= s.opts.Idle {
+				break wait
+			}
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	shutdown, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+	err = server.Shutdown(shutdown)
+	s.mu.Lock()
+	for dir, e := range s.entries {
+		e.cfg.Close()
+		delete(s.entries, dir)
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// handler answers the socket
+func (s *Server) handler(cancel func()) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/get", func(rw http.ResponseWriter, r *http.Request) {
+		dir, key := r.URL.Query().Get("dir"), r.URL.Query().Get("key")
+		if !filepath.IsAbs(dir) || key == "" {
+			writeJSON(rw, http.StatusBadRequest, map[string]string{"error": "dir must be an absolute path and key is required"})
+			return
+		}
+		result, err := s.Get(dir, key)
+		if err != nil {
+			writeJSON(rw, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(rw, http.StatusOK, result)
+	})
+	mux.HandleFunc("GET /v1/status", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, s.Status())
+	})
+	mux.HandleFunc("POST /v1/shutdown", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, s.Status())
+		cancel()
+	})
+	handler := profiling.Mount(tracing.Handler(mux), s.opts.Profiling)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		s.last.Store(time.Now().UnixNano())
+		handler.ServeHTTP(rw, r)
+	})
+}
+
+// report passes the failures of what on to opts.Report
+func (s *Server) report(what string) func(error) {
+	return func(err error) {
+		if s.opts.Report != nil {
+			s.opts.Report(fmt.Errorf("%s: %w", what, err))
+		}
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
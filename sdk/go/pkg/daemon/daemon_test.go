@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/profiling"
+)
+
+func TestDaemon(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "peanu.tsk")
+	os.WriteFile(file, []byte("[database]\nhost: \"localhost\"\nport: 5432\nratio: 0.5\nmode: @env(\"TSK_DAEMON_MODE\", \"dev\")\n"), 0644)
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- NewServer(Options{}).Serve(ctx, socket) }()
+	client := NewClient(socket)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := client.Status(ctx); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("daemon did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got, err := client.Get(ctx, dir, "database.port")
+	if err != nil || !got.Found || got.Value != 5432 || got.Origin == nil || got.Origin.File != file ||
+		!reflect.DeepEqual(got.Files, []string{file}) {
+		t.Errorf("unexpected lookup: %+v, %v", got, err)
+	}
+	got, _ = client.Get(ctx, dir, "database")
+	if section, ok := got.Value.(map[string]interface{}); !ok || section["port"] != 5432 || section["ratio"] != 0.5 || got.Origin != nil {
+		t.Errorf("unexpected section: %+v", got)
+	}
+	if got, err := client.Get(ctx, dir, "database.user"); err != nil || got.Found {
+		t.Errorf("a missing key should not be found: %+v, %v", got, err)
+	}
+	// Expressions are left to the caller's environment
+	if got, _ := client.Get(ctx, dir, "database.mode"); !strings.Contains(got.Value.(string), "@env") {
+		t.Errorf("a lookup should return the expression, got %v", got.Value)
+	}
+
+	// Edits are seen at once, without waiting for a watcher
+	os.WriteFile(file, []byte("[database]\nhost: \"db.internal\"\n"), 0644)
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Minute))
+	if got, _ := client.Get(ctx, dir, "database.host"); got.Value != "db.internal" {
+		t.Errorf("expected the edited value, got %v", got.Value)
+	}
+	status, err := client.Status(ctx)
+	if err != nil || status.Loads != 2 || status.Lookups != 5 || !reflect.DeepEqual(status.Dirs, []string{dir}) {
+		t.Errorf("unexpected status: %+v, %v", status, err)
+	}
+
+	if _, err := client.Get(ctx, "relative", "x"); err == nil || !strings.Contains(err.Error(), "absolute path") {
+		t.Errorf("expected an error for a relative dir, got %v", err)
+	}
+	if _, err := client.Get(ctx, t.TempDir(), "x"); err == nil {
+		t.Error("expected an error for a directory without configuration")
+	}
+	if err := NewServer(Options{}).Serve(ctx, socket); !errors.Is(err, ErrRunning) {
+		t.Errorf("a second daemon should refuse the socket, got %v", err)
+	}
+
+	if _, err := client.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+	if _, err := client.Status(ctx); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("expected ErrNotRunning after shutdown, got %v", err)
+	}
+}
+
+func TestIdle(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	done := make(chan error, 1)
+	go func() { done <- NewServer(Options{Idle: 100 * time.Millisecond}).Serve(context.Background(), socket) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("an idle daemon should stop")
+	}
+}
+
+func TestProfiling(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewServer(Options{Profiling: profiling.Options{Enabled: true}}).Serve(ctx, socket)
+	client := NewClient(socket)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := client.Status(ctx); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("daemon did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var heap bytes.Buffer
+	if err := profiling.Capture(ctx, client.HTTP(), URL+profiling.Prefix, "heap", 0, "", &heap); err != nil || heap.Len() == 0 {
+		t.Errorf("heap profile over the socket = %d bytes, %v", heap.Len(), err)
+	}
+}
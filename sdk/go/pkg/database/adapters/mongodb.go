@@ -0,0 +1,232 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	"github.com/cyber-boost/tusktsk/pkg/mongowire"
+	"github.com/cyber-boost/tusktsk/pkg/operators"
+)
+
+// MongoDBAdapter implements DatabaseAdapter for MongoDB. Queries are mongo
+// shell statements such as db.users.find({age: {$gt: 30}}).limit(10), or a
+// bare collection name with a filter argument: Query("users", "{active: true}").
+type MongoDBAdapter struct {
+	client    *mongowire.Client
+	config    *databasetypes.Config
+	connected bool
+}
+
+// NewMongoDBAdapter creates a new MongoDB adapter
+func NewMongoDBAdapter() *MongoDBAdapter {
+	return &MongoDBAdapter{
+		config: &databasetypes.Config{
+			MaxOpenConns:    100,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+	}
+}
+
+// MongoDBConnectionString builds a mongodb:// URI from flattened peanut
+// configuration (database.mongodb.uri, or host, port, username, password,
+// database and auth_source)
+func MongoDBConnectionString(values map[string]interface{}) (string, error) {
+	uri, ok := mongowire.ConfigURI(values)
+	if !ok {
+		return "", fmt.Errorf("no MongoDB connection configured: set database.mongodb.uri or database.mongodb.host")
+	}
+	return uri, nil
+}
+
+// Connect establishes connection to MongoDB and makes it the target of
+// @query("mongodb:...")
+func (ma *MongoDBAdapter) Connect(config string) error {
+	opts, err := mongowire.ParseURI(config)
+	if err != nil {
+		return err
+	}
+
+	// Configure connection pool
+	if opts.MaxOpen == 0 {
+		opts.MaxOpen = ma.config.MaxOpenConns
+	}
+	opts.MaxIdle = ma.config.MaxIdleConns
+	opts.MaxLifetime = ma.config.ConnMaxLifetime
+	opts.MaxIdleTime = ma.config.ConnMaxIdleTime
+
+	client, err := mongowire.Dial(opts)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	ma.client = client
+	ma.connected = true
+	operators.RegisterQueryTarget("mongodb", mongowire.NewClientTarget(client).Query)
+
+	return nil
+}
+
+// Disconnect closes the database connection
+func (ma *MongoDBAdapter) Disconnect() error {
+	if ma.client != nil {
+		ma.connected = false
+		operators.RegisterQueryTarget("mongodb", nil)
+		return ma.client.Close()
+	}
+	return nil
+}
+
+// IsConnected returns connection status
+func (ma *MongoDBAdapter) IsConnected() bool {
+	return ma.connected && ma.client != nil
+}
+
+// Ping tests the database connection
+func (ma *MongoDBAdapter) Ping() error {
+	if ma.client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	_, err := ma.client.RunCommand("admin", mongowire.D{{Key: "ping", Value: 1}})
+	return err
+}
+
+// Query runs a statement and returns documents as rows. Columns are the
+// union of the documents' fields; writes report RowsAffected.
+func (ma *MongoDBAdapter) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	if ma.client == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	st, err := mongowire.BuildStatement(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MongoDB query: %w", err)
+	}
+	res, err := ma.client.Exec(ma.client.Database(), st)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	rows, columns := res.Rows()
+	return &databasetypes.Result{
+		Rows:         rows,
+		Columns:      columns,
+		RowsAffected: res.Affected,
+	}, nil
+}
+
+// Execute runs an insert, update, delete or any other statement
+func (ma *MongoDBAdapter) Execute(query string, args ...interface{}) error {
+	if _, err := ma.Query(query, args...); err != nil {
+		return fmt.Errorf("execute failed: %w", err)
+	}
+	return nil
+}
+
+// QueryRow executes a query that returns a single document
+func (ma *MongoDBAdapter) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	result, err := ma.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Rows) == 0 {
+		return &databasetypes.Row{Error: sql.ErrNoRows}, nil
+	}
+	return &databasetypes.Row{Data: result.Rows[0]}, nil
+}
+
+// BeginTransaction is not supported: multi-document transactions need a
+// replica set session, which this adapter does not manage
+func (ma *MongoDBAdapter) BeginTransaction() (databasetypes.Transaction, error) {
+	return ma.BeginTransactionWithContext(context.Background())
+}
+
+// BeginTransactionWithContext is not supported, see BeginTransaction
+func (ma *MongoDBAdapter) BeginTransactionWithContext(ctx context.Context) (databasetypes.Transaction, error) {
+	return nil, fmt.Errorf("transactions are not supported by the MongoDB adapter")
+}
+
+// SetMaxOpenConns sets maximum open connections
+func (ma *MongoDBAdapter) SetMaxOpenConns(n int) {
+	ma.config.MaxOpenConns = n
+	ma.applyPool()
+}
+
+// SetMaxIdleConns sets maximum idle connections
+func (ma *MongoDBAdapter) SetMaxIdleConns(n int) {
+	ma.config.MaxIdleConns = n
+	ma.applyPool()
+}
+
+// SetConnMaxLifetime sets connection max lifetime
+func (ma *MongoDBAdapter) SetConnMaxLifetime(d time.Duration) {
+	ma.config.ConnMaxLifetime = d
+	ma.applyPool()
+}
+
+// SetConnMaxIdleTime sets connection max idle time
+func (ma *MongoDBAdapter) SetConnMaxIdleTime(d time.Duration) {
+	ma.config.ConnMaxIdleTime = d
+	ma.applyPool()
+}
+
+// applyPool pushes pool settings to a connected client
+func (ma *MongoDBAdapter) applyPool() {
+	if ma.client != nil {
+		ma.client.SetPool(ma.config.MaxOpenConns, ma.config.MaxIdleConns, ma.config.ConnMaxLifetime, ma.config.ConnMaxIdleTime)
+	}
+}
+
+// GetStats returns server-wide connection counts from serverStatus
+func (ma *MongoDBAdapter) GetStats() *databasetypes.Stats {
+	if ma.client == nil {
+		return &databasetypes.Stats{}
+	}
+
+	open, idle, maxOpen := ma.client.PoolStats()
+	stats := &databasetypes.Stats{
+		MaxOpenConnections: maxOpen,
+		OpenConnections:    open,
+		InUse:              open - idle,
+		Idle:               idle,
+	}
+
+	status, err := ma.client.RunCommand("admin", mongowire.D{{Key: "serverStatus", Value: 1}})
+	if err != nil {
+		return stats
+	}
+	conns, _ := status.Get("connections").(mongowire.D)
+	if current, ok := statInt(conns.Get("current")); ok {
+		stats.OpenConnections = current
+		if available, ok := statInt(conns.Get("available")); ok {
+			stats.MaxOpenConnections = current + available
+		}
+		if active, ok := statInt(conns.Get("active")); ok {
+			stats.InUse = active
+			stats.Idle = current - active
+		}
+	}
+	return stats
+}
+
+// statInt converts a serverStatus counter
+func statInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// Close closes the database connection
+func (ma *MongoDBAdapter) Close() error {
+	return ma.Disconnect()
+}
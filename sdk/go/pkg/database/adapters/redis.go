@@ -0,0 +1,408 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	"github.com/cyber-boost/tusktsk/pkg/rediswire"
+)
+
+// RedisAdapter implements DatabaseAdapter for Redis. Queries are commands
+// as typed in redis-cli, such as GET user:1 or HGETALL "user:1"; extra
+// arguments are appended to the command.
+type RedisAdapter struct {
+	client    *rediswire.Client
+	config    *databasetypes.Config
+	connected bool
+}
+
+// NewRedisAdapter creates a new Redis adapter
+func NewRedisAdapter() *RedisAdapter {
+	return &RedisAdapter{
+		config: &databasetypes.Config{
+			MaxOpenConns:    100,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+	}
+}
+
+// RedisConnectionString builds a redis:// or rediss:// URL from flattened
+// peanut configuration under database.redis (url, or host, port, username,
+// password, db and tls, plus pool.max_open, max_idle, max_lifetime and
+// max_idle_time)
+func RedisConnectionString(values map[string]interface{}) (string, error) {
+	url, ok, err := rediswire.ConfigURL(values, "database.redis")
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("no Redis connection configured: set database.redis.url or database.redis.host")
+	}
+	return url, nil
+}
+
+// Connect establishes connection to Redis
+func (ra *RedisAdapter) Connect(config string) error {
+	opts, err := rediswire.ParseURL(config)
+	if err != nil {
+		return err
+	}
+
+	// Configure connection pool; settings in the URL win
+	if opts.MaxOpen == 0 {
+		opts.MaxOpen = ra.config.MaxOpenConns
+	}
+	if opts.MaxIdle == 0 {
+		opts.MaxIdle = ra.config.MaxIdleConns
+	}
+	if opts.MaxLifetime == 0 {
+		opts.MaxLifetime = ra.config.ConnMaxLifetime
+	}
+	if opts.MaxIdleTime == 0 {
+		opts.MaxIdleTime = ra.config.ConnMaxIdleTime
+	}
+
+	client, err := rediswire.Dial(opts)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	ra.client = client
+	ra.connected = true
+
+	return nil
+}
+
+// Client exposes the underlying connection pool, for example to back the
+// performance framework's L3 cache
+func (ra *RedisAdapter) Client() *rediswire.Client {
+	return ra.client
+}
+
+// Disconnect closes the database connection
+func (ra *RedisAdapter) Disconnect() error {
+	if ra.client != nil {
+		ra.connected = false
+		return ra.client.Close()
+	}
+	return nil
+}
+
+// IsConnected returns connection status
+func (ra *RedisAdapter) IsConnected() bool {
+	return ra.connected && ra.client != nil
+}
+
+// Ping tests the database connection
+func (ra *RedisAdapter) Ping() error {
+	if ra.client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	_, err := ra.client.Do("PING")
+	return err
+}
+
+// Query runs a command and returns its reply as rows: one "value" row for
+// a single reply, one row per element for arrays, and field/value rows for
+// HGETALL and CONFIG GET. Integer replies also set RowsAffected.
+func (ra *RedisAdapter) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	if ra.client == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	command, err := redisCommand(query, args)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := ra.client.Do(command...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return redisResult(command, reply), nil
+}
+
+// redisCommand splits a redis-cli style command and appends args
+func redisCommand(query string, args []interface{}) ([]interface{}, error) {
+	words, err := splitRedisCommand(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty Redis command")
+	}
+	command := make([]interface{}, 0, len(words)+len(args))
+	for _, word := range words {
+		command = append(command, word)
+	}
+	return append(command, args...), nil
+}
+
+// splitRedisCommand splits on spaces, honouring "double" (with backslash
+// escapes) and 'single' quotes the way redis-cli does
+func splitRedisCommand(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '"' || ch == '\'':
+			quote := ch
+			inWord = true
+			for i++; ; i++ {
+				if i >= len(s) {
+					return nil, fmt.Errorf("unterminated quote in %q", s)
+				}
+				if s[i] == quote {
+					break
+				}
+				if s[i] == '\\' && quote == '"' && i+1 < len(s) {
+					i++
+					switch s[i] {
+					case 'n':
+						word.WriteByte('\n')
+					case 't':
+						word.WriteByte('\t')
+					default:
+						word.WriteByte(s[i])
+					}
+					continue
+				}
+				word.WriteByte(s[i])
+			}
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// redisResult shapes a reply into rows
+func redisResult(command []interface{}, reply interface{}) *databasetypes.Result {
+	result := &databasetypes.Result{Rows: make([]map[string]interface{}, 0)}
+	name := strings.ToUpper(fmt.Sprint(command[0]))
+	if len(command) > 1 && name == "CONFIG" {
+		name += " " + strings.ToUpper(fmt.Sprint(command[1]))
+	}
+
+	switch v := reply.(type) {
+	case nil:
+		result.Columns = []string{"value"}
+	case []interface{}:
+		if name == "HGETALL" || name == "CONFIG GET" {
+			result.Columns = []string{"field", "value"}
+			for i := 0; i+1 < len(v); i += 2 {
+				result.Rows = append(result.Rows, map[string]interface{}{"field": v[i], "value": v[i+1]})
+			}
+			break
+		}
+		result.Columns = []string{"value"}
+		for _, item := range v {
+			result.Rows = append(result.Rows, map[string]interface{}{"value": item})
+		}
+	case int64:
+		result.Columns = []string{"value"}
+		result.Rows = append(result.Rows, map[string]interface{}{"value": v})
+		result.RowsAffected = v
+	default:
+		result.Columns = []string{"value"}
+		result.Rows = append(result.Rows, map[string]interface{}{"value": v})
+	}
+	return result
+}
+
+// Execute runs a command, discarding its reply
+func (ra *RedisAdapter) Execute(query string, args ...interface{}) error {
+	if ra.client == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	command, err := redisCommand(query, args)
+	if err != nil {
+		return err
+	}
+	if _, err := ra.client.Do(command...); err != nil {
+		return fmt.Errorf("execute failed: %w", err)
+	}
+
+	return nil
+}
+
+// QueryRow executes a command and returns the first row of its reply
+func (ra *RedisAdapter) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	result, err := ra.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Rows) == 0 {
+		return &databasetypes.Row{Error: sql.ErrNoRows}, nil
+	}
+	return &databasetypes.Row{Data: result.Rows[0]}, nil
+}
+
+// BeginTransaction starts a MULTI block on a dedicated connection
+func (ra *RedisAdapter) BeginTransaction() (databasetypes.Transaction, error) {
+	return ra.BeginTransactionWithContext(context.Background())
+}
+
+// BeginTransactionWithContext starts a MULTI block on a dedicated
+// connection. Commands are queued until Commit runs EXEC.
+func (ra *RedisAdapter) BeginTransactionWithContext(ctx context.Context) (databasetypes.Transaction, error) {
+	if ra.client == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	conn, err := ra.client.Conn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if _, err := conn.Do("MULTI"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	return &RedisTransaction{conn: conn}, nil
+}
+
+// SetMaxOpenConns sets maximum open connections
+func (ra *RedisAdapter) SetMaxOpenConns(n int) {
+	ra.config.MaxOpenConns = n
+	ra.applyPool()
+}
+
+// SetMaxIdleConns sets maximum idle connections
+func (ra *RedisAdapter) SetMaxIdleConns(n int) {
+	ra.config.MaxIdleConns = n
+	ra.applyPool()
+}
+
+// SetConnMaxLifetime sets connection max lifetime
+func (ra *RedisAdapter) SetConnMaxLifetime(d time.Duration) {
+	ra.config.ConnMaxLifetime = d
+	ra.applyPool()
+}
+
+// SetConnMaxIdleTime sets connection max idle time
+func (ra *RedisAdapter) SetConnMaxIdleTime(d time.Duration) {
+	ra.config.ConnMaxIdleTime = d
+	ra.applyPool()
+}
+
+// applyPool pushes pool settings to a connected client
+func (ra *RedisAdapter) applyPool() {
+	if ra.client != nil {
+		ra.client.SetPool(ra.config.MaxOpenConns, ra.config.MaxIdleConns, ra.config.ConnMaxLifetime, ra.config.ConnMaxIdleTime)
+	}
+}
+
+// GetStats returns pool statistics; OpenConnections is the server's
+// connected_clients when INFO is available
+func (ra *RedisAdapter) GetStats() *databasetypes.Stats {
+	if ra.client == nil {
+		return &databasetypes.Stats{}
+	}
+
+	open, idle, maxOpen := ra.client.PoolStats()
+	stats := &databasetypes.Stats{
+		MaxOpenConnections: maxOpen,
+		OpenConnections:    open,
+		InUse:              open - idle,
+		Idle:               idle,
+	}
+
+	info, err := ra.client.Do("INFO", "clients")
+	if text, ok := info.(string); err == nil && ok {
+		for _, line := range strings.Split(text, "\n") {
+			if value, found := strings.CutPrefix(strings.TrimSpace(line), "connected_clients:"); found {
+				if n, err := strconv.Atoi(value); err == nil {
+					stats.OpenConnections = n
+				}
+			}
+		}
+	}
+	return stats
+}
+
+// Close closes the database connection
+func (ra *RedisAdapter) Close() error {
+	return ra.Disconnect()
+}
+
+// RedisTransaction implements Transaction as a MULTI/EXEC block
+type RedisTransaction struct {
+	conn *rediswire.Conn
+}
+
+// Commit runs EXEC
+func (rt *RedisTransaction) Commit() error {
+	defer rt.conn.Close()
+	reply, err := rt.conn.Do("EXEC")
+	if err != nil {
+		return fmt.Errorf("transaction failed: %w", err)
+	}
+	if reply == nil {
+		return fmt.Errorf("transaction aborted: a watched key changed")
+	}
+	if results, ok := reply.([]interface{}); ok {
+		for _, result := range results {
+			if err, ok := result.(error); ok {
+				return fmt.Errorf("transaction command failed: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Rollback runs DISCARD
+func (rt *RedisTransaction) Rollback() error {
+	defer rt.conn.Close()
+	_, err := rt.conn.Do("DISCARD")
+	return err
+}
+
+// Query queues a command; its reply is only available after Commit
+func (rt *RedisTransaction) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	command, err := redisCommand(query, args)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := rt.conn.Do(command...)
+	if err != nil {
+		return nil, fmt.Errorf("transaction query failed: %w", err)
+	}
+	return redisResult(command, reply), nil
+}
+
+// Execute queues a command
+func (rt *RedisTransaction) Execute(query string, args ...interface{}) error {
+	if _, err := rt.Query(query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// QueryRow queues a command and returns its QUEUED status row
+func (rt *RedisTransaction) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	result, err := rt.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &databasetypes.Row{Data: result.Rows[0]}, nil
+}
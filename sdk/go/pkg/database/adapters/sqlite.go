@@ -16,6 +16,9 @@ type SQLiteAdapter struct {
 	db     *sql.DB
 	config *databasetypes.Config
 	connected bool
+	// stmts caches the prepared statements of the current connection
+	stmts         *databasetypes.StmtCache
+	stmtCacheSize int
 }
 
 // NewSQLiteAdapter creates a new SQLite adapter
@@ -27,6 +30,7 @@ func NewSQLiteAdapter() *SQLiteAdapter {
 			ConnMaxLifetime: 5 * time.Minute,
 			ConnMaxIdleTime: 5 * time.Minute,
 		},
+		stmtCacheSize: databasetypes.DefaultStmtCacheSize,
 	}
 }
 
@@ -58,6 +62,7 @@ func (sa *SQLiteAdapter) Connect(config string) error {
 	}
 	
 	sa.db = db
+	sa.stmts = databasetypes.NewStmtCache(db, sa.stmtCacheSize)
 	sa.connected = true
 	
 	return nil
@@ -67,6 +72,7 @@ func (sa *SQLiteAdapter) Connect(config string) error {
 func (sa *SQLiteAdapter) Disconnect() error {
 	if sa.db != nil {
 		sa.connected = false
+		sa.stmts.Close()
 		return sa.db.Close()
 	}
 	return nil
@@ -91,7 +97,7 @@ func (sa *SQLiteAdapter) Query(query string, args ...interface{}) (*databasetype
 		return nil, fmt.Errorf("database not connected")
 	}
 	
-	rows, err := sa.db.Query(query, args...)
+	rows, err := sa.stmts.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
@@ -146,7 +152,7 @@ func (sa *SQLiteAdapter) Execute(query string, args ...interface{}) error {
 		return fmt.Errorf("database not connected")
 	}
 	
-	result, err := sa.db.Exec(query, args...)
+	result, err := sa.stmts.Exec(query, args...)
 	if err != nil {
 		return fmt.Errorf("execute failed: %w", err)
 	}
@@ -268,9 +274,21 @@ func (sa *SQLiteAdapter) GetStats() *databasetypes.Stats {
 		WaitDuration:       stats.WaitDuration,
 		MaxIdleClosed:      stats.MaxIdleClosed,
 		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		Statements:         sa.stmts.Stats(),
 	}
 }
 
+// SetStmtCacheSize sets how many prepared statements are cached; 0 disables
+// the cache. It takes effect on the next Connect.
+func (sa *SQLiteAdapter) SetStmtCacheSize(n int) {
+	sa.stmtCacheSize = n
+}
+
+// SupportsSavepoints reports that transactions can nest with savepoints
+func (sa *SQLiteAdapter) SupportsSavepoints() bool {
+	return true
+}
+
 // Close closes the database connection
 func (sa *SQLiteAdapter) Close() error {
 	return sa.Disconnect()
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	"github.com/cyber-boost/tusktsk/pkg/querylog"
+)
+
+// fakeAdapter records what it is asked to do and answers queries with the
+// DSN it connected to; Connect fails while failures remain
+type fakeAdapter struct {
+	dsn       string
+	connected bool
+	failures  int
+	connects  int
+	pool      databasetypes.ConnectionPool
+	queries   []string
+}
+
+func (fa *fakeAdapter) Connect(dsn string) error {
+	fa.connects++
+	if fa.failures > 0 {
+		fa.failures--
+		return errors.New("connection refused")
+	}
+	fa.dsn, fa.connected = dsn, true
+	return nil
+}
+
+func (fa *fakeAdapter) Disconnect() error { fa.connected = false; return nil }
+func (fa *fakeAdapter) IsConnected() bool { return fa.connected }
+func (fa *fakeAdapter) Ping() error {
+	if !fa.connected {
+		return errors.New("not connected")
+	}
+	return nil
+}
+
+func (fa *fakeAdapter) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	fa.queries = append(fa.queries, query)
+	return &databasetypes.Result{Columns: []string{"source"}, Rows: []map[string]interface{}{{"source": fa.dsn}}}, nil
+}
+
+func (fa *fakeAdapter) Execute(query string, args ...interface{}) error {
+	fa.queries = append(fa.queries, query)
+	return nil
+}
+
+func (fa *fakeAdapter) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	result, err := fa.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &databasetypes.Row{Data: result.Rows[0]}, nil
+}
+
+func (fa *fakeAdapter) BeginTransaction() (databasetypes.Transaction, error) {
+	return fakeTx{fa}, nil
+}
+
+func (fa *fakeAdapter) BeginTransactionWithContext(ctx context.Context) (databasetypes.Transaction, error) {
+	return fa.BeginTransaction()
+}
+
+func (fa *fakeAdapter) SetMaxOpenConns(n int)              { fa.pool.MaxOpenConnections = n }
+func (fa *fakeAdapter) SetMaxIdleConns(n int)              { fa.pool.MaxIdleConnections = n }
+func (fa *fakeAdapter) SetConnMaxLifetime(d time.Duration) { fa.pool.ConnMaxLifetime = d }
+func (fa *fakeAdapter) SetConnMaxIdleTime(d time.Duration) { fa.pool.ConnMaxIdleTime = d }
+func (fa *fakeAdapter) GetStats() *databasetypes.Stats {
+	return &databasetypes.Stats{MaxOpenConnections: fa.pool.MaxOpenConnections}
+}
+func (fa *fakeAdapter) Close() error { return fa.Disconnect() }
+
+// fakeTx runs its statements on its adapter
+type fakeTx struct{ *fakeAdapter }
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func TestManagerAdapters(t *testing.T) {
+	dm := NewDatabaseManager()
+	if dm.GetDefaultAdapter() != nil {
+		t.Error("empty manager has a default adapter")
+	}
+	postgres, sqlite := &fakeAdapter{}, &fakeAdapter{}
+	dm.RegisterAdapter("sqlite", sqlite)
+	dm.RegisterAdapter("postgresql", postgres)
+
+	if got := dm.AdapterNames(); !reflect.DeepEqual(got, []string{"postgresql", "sqlite"}) {
+		t.Errorf("AdapterNames() = %v", got)
+	}
+	// The first adapter registered is the default until another is chosen
+	if dm.DefaultAdapterName() != "sqlite" || dm.GetDefaultAdapter() != sqlite {
+		t.Errorf("default adapter = %s", dm.DefaultAdapterName())
+	}
+	dm.SetDefaultAdapter("oracle")
+	dm.SetDefaultAdapter("postgresql")
+	if dm.DefaultAdapterName() != "postgresql" {
+		t.Errorf("default adapter = %s, want postgresql", dm.DefaultAdapterName())
+	}
+	if err := dm.Connect("oracle", "oracle://"); err == nil {
+		t.Error("Connect of an unregistered adapter succeeded")
+	}
+}
+
+func TestManagerConnectPool(t *testing.T) {
+	dm := NewDatabaseManager()
+	sqlite, mysql := &fakeAdapter{failures: 2}, &fakeAdapter{failures: 1}
+	dm.RegisterAdapter("sqlite", sqlite)
+	dm.RegisterAdapter("mysql", mysql)
+
+	err := dm.ConfigurePools(map[string]interface{}{
+		"sqlite.max_open":           4,
+		"sqlite.max_idle":           2,
+		"sqlite.conn_max_lifetime":  "10m",
+		"sqlite.conn_max_idle_time": "1m",
+		"sqlite.retry.attempts":     3,
+		"sqlite.retry.backoff":      "1ms",
+		"postgresql.max_open":       50,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := databasetypes.ConnectionPool{
+		MaxOpenConnections: 4,
+		MaxIdleConnections: 2,
+		ConnMaxLifetime:    10 * time.Minute,
+		ConnMaxIdleTime:    time.Minute,
+		MaxRetries:         3,
+		RetryDelay:         time.Millisecond,
+	}
+	if pool, ok := dm.Pool("sqlite"); !ok || pool != want {
+		t.Errorf("Pool(sqlite) = %+v, %v; want %+v", pool, ok, want)
+	}
+	if _, ok := dm.Pool("mysql"); ok {
+		t.Error("mysql has a pool without settings")
+	}
+
+	// Two refused connections are retried, and the pool applied first
+	if err := dm.Connect("sqlite", "sqlite:app.db"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if sqlite.connects != 3 || sqlite.dsn != "sqlite:app.db" {
+		t.Errorf("sqlite connected %d times to %q", sqlite.connects, sqlite.dsn)
+	}
+	want.MaxRetries, want.RetryDelay = 0, 0
+	if sqlite.pool != want {
+		t.Errorf("applied pool = %+v, want %+v", sqlite.pool, want)
+	}
+
+	// Without a retry policy the first failure is returned
+	if err := dm.Connect("mysql", "mysql://localhost/app"); err == nil || mysql.connects != 1 {
+		t.Errorf("Connect without retries = %v after %d attempts", err, mysql.connects)
+	}
+
+	if err := dm.ConfigurePools(map[string]interface{}{"sqlite.max_open": "many"}); err == nil {
+		t.Error("ConfigurePools accepted an invalid max_open")
+	}
+}
+
+func TestManagerReplicas(t *testing.T) {
+	dm := NewDatabaseManager()
+	var created []*fakeAdapter
+	dm.RegisterAdapterFactory("postgresql", func() DatabaseAdapter {
+		adapter := &fakeAdapter{}
+		if len(created) == 2 {
+			// The second replica is down
+			adapter.failures = 1000
+		}
+		created = append(created, adapter)
+		return adapter
+	})
+	dm.RegisterAdapter("sqlite", &fakeAdapter{})
+
+	err := dm.ConfigurePools(map[string]interface{}{
+		"postgresql.replicas":        []interface{}{"postgresql://replica-1/app", "postgresql://replica-2/app"},
+		"postgresql.health_interval": "1h",
+		"sqlite.replicas":            "sqlite:replica.db",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicas, ok := dm.Replicas("postgresql"); !ok || len(replicas.DSNs) != 2 || replicas.Balance != databasetypes.BalanceRoundRobin {
+		t.Errorf("Replicas(postgresql) = %+v, %v", replicas, ok)
+	}
+
+	if err := dm.Connect("postgresql", "postgresql://primary/app"); err != nil {
+		t.Fatal(err)
+	}
+	defer dm.CloseAll()
+	routed, ok := dm.Routed("postgresql")
+	if !ok {
+		t.Fatal("postgresql is not routed to its replicas")
+	}
+	if adapter, _ := dm.GetAdapter("postgresql"); adapter != DatabaseAdapter(routed) {
+		t.Errorf("GetAdapter returned %T, not the routed adapter", adapter)
+	}
+	if routed.Primary() != created[0] {
+		t.Error("Primary() is not the registered adapter")
+	}
+
+	// Reads go to the healthy replica, writes to the primary
+	for _, tt := range []struct{ query, source string }{
+		{"SELECT * FROM users", "postgresql://replica-1/app"},
+		{"SELECT * FROM users", "postgresql://replica-1/app"},
+		{"UPDATE users SET name = 'x' RETURNING id", "postgresql://primary/app"},
+		{"SELECT * FROM users FOR UPDATE", "postgresql://primary/app"},
+	} {
+		result, err := routed.Query(tt.query)
+		if err != nil || result.Rows[0]["source"] != tt.source {
+			t.Errorf("Query(%q) ran on %v, %v; want %s", tt.query, result.Rows[0]["source"], err, tt.source)
+		}
+	}
+	if err := routed.Execute("DELETE FROM users"); err != nil || len(created[0].queries) != 3 {
+		t.Errorf("Execute = %v; primary ran %q", err, created[0].queries)
+	}
+
+	statuses := routed.Replicas()
+	if len(statuses) != 2 || !statuses[0].Healthy || statuses[0].Queries != 2 || statuses[1].Healthy || statuses[1].LastError == "" {
+		t.Errorf("Replicas() = %+v", statuses)
+	}
+
+	// An adapter registered without a factory cannot create replicas
+	if err := dm.Connect("sqlite", "sqlite:app.db"); err == nil {
+		t.Error("Connect of sqlite with replicas but no factory succeeded")
+	}
+}
+
+func TestManagerQueryLog(t *testing.T) {
+	dm := NewDatabaseManager()
+	sqlite := &fakeAdapter{}
+	dm.RegisterAdapter("sqlite", sqlite)
+	file := filepath.Join(t.TempDir(), "logs", "queries.jsonl")
+	if err := dm.ConfigurePools(map[string]interface{}{"query_log.file": file, "query_log.slow": "1h"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, ok := dm.QueryLog(); !ok || cfg.File != file || cfg.Slow != time.Hour {
+		t.Errorf("QueryLog() = %+v, %v", cfg, ok)
+	}
+
+	// Statements run before Connect are not logged
+	if adapter, _ := dm.GetAdapter("sqlite"); adapter != DatabaseAdapter(sqlite) {
+		t.Errorf("GetAdapter before Connect returned %T", adapter)
+	}
+	if err := dm.Connect("sqlite", "sqlite:app.db"); err != nil {
+		t.Fatal(err)
+	}
+	adapter, _ := dm.GetAdapter("sqlite")
+	logged, ok := adapter.(*LoggedAdapter)
+	if !ok || logged.Unwrap() != sqlite {
+		t.Fatalf("GetAdapter after Connect returned %T", adapter)
+	}
+	logged.Query("SELECT * FROM users WHERE id = ?", 1)
+	logged.Execute("DELETE FROM sessions")
+	tx, err := logged.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.QueryRow("SELECT 1")
+	tx.Commit()
+	if err := dm.CloseAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := querylog.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Query)
+		if entry.Adapter != "sqlite" || entry.Slow || !strings.HasPrefix(entry.Caller, "database_test.go:") {
+			t.Errorf("entry = %+v", entry)
+		}
+	}
+	want := []string{"SELECT * FROM users WHERE id = ?", "DELETE FROM sessions", "SELECT 1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+	if len(entries) == 3 && (entries[0].Rows != 1 || entries[1].Rows != 0 || entries[2].Rows != 1) {
+		t.Errorf("rows = %d, %d, %d", entries[0].Rows, entries[1].Rows, entries[2].Rows)
+	}
+}
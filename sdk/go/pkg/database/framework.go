@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/cyber-boost/tusktsk/pkg/database/adapters"
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
 	"github.com/cyber-boost/tusktsk/pkg/orm"
 )
 
@@ -20,8 +21,8 @@ func NewFramework() *Framework {
 	manager := NewDatabaseManager()
 	
 	// Register all available adapters
-	manager.RegisterAdapter("sqlite", adapters.NewSQLiteAdapter())
-	manager.RegisterAdapter("postgresql", adapters.NewPostgreSQLAdapter())
+	manager.RegisterAdapterFactory("sqlite", func() DatabaseAdapter { return adapters.NewSQLiteAdapter() })
+	manager.RegisterAdapterFactory("postgresql", func() DatabaseAdapter { return adapters.NewPostgreSQLAdapter() })
 	
 	return &Framework{
 		manager: manager,
@@ -33,16 +34,11 @@ func (f *Framework) Connect(adapterName, connectionString string) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	
-	// Get or create adapter
-	adapter, exists := f.manager.GetAdapter(adapterName)
-	if !exists {
-		return fmt.Errorf("adapter '%s' not found", adapterName)
-	}
-	
-	// Connect to database
-	if err := adapter.Connect(connectionString); err != nil {
+	// Connect to database with the adapter's configured pool and replicas
+	if err := f.manager.Connect(adapterName, connectionString); err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
+	adapter, _ := f.manager.GetAdapter(adapterName)
 	
 	// Initialize ORM with the connected adapter
 	f.orm = orm.NewORM(adapter)
@@ -75,7 +71,7 @@ func (f *Framework) GetORM() *orm.ORM {
 }
 
 // Query executes a raw SQL query
-func (f *Framework) Query(query string, args ...interface{}) (*Result, error) {
+func (f *Framework) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 	
@@ -198,11 +194,11 @@ func (f *Framework) Delete(model orm.Model) error {
 }
 
 // GetStats returns database statistics
-func (f *Framework) GetStats() map[string]*Stats {
+func (f *Framework) GetStats() map[string]*databasetypes.Stats {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 	
-	stats := make(map[string]*Stats)
+	stats := make(map[string]*databasetypes.Stats)
 	for name, adapter := range f.manager.adapters {
 		stats[name] = adapter.GetStats()
 	}
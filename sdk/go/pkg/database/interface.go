@@ -2,9 +2,13 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"time"
 	
 	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	"github.com/cyber-boost/tusktsk/pkg/querylog"
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
 )
 
 // DatabaseAdapter defines the unified interface for all database adapters
@@ -49,16 +53,183 @@ type Transaction interface {
 // DatabaseManager manages multiple database adapters
 type DatabaseManager struct {
 	adapters map[string]DatabaseAdapter
+	pools    map[string]databasetypes.ConnectionPool
 	defaultAdapter string
+	// factories create the extra adapter instances replicas connect with
+	factories map[string]func() DatabaseAdapter
+	replicas  map[string]databasetypes.ReplicaConfig
+	// routed holds the adapters connected with replicas
+	routed map[string]*ReplicatedAdapter
+	// queryLog, when set, is where connected adapters log their statements
+	queryLog *querylog.Config
+	logged   map[string]*LoggedAdapter
 }
 
 // NewDatabaseManager creates a new database manager
 func NewDatabaseManager() *DatabaseManager {
 	return &DatabaseManager{
-		adapters: make(map[string]DatabaseAdapter),
+		adapters:  make(map[string]DatabaseAdapter),
+		pools:     make(map[string]databasetypes.ConnectionPool),
+		factories: make(map[string]func() DatabaseAdapter),
+		replicas:  make(map[string]databasetypes.ReplicaConfig),
+		routed:    make(map[string]*ReplicatedAdapter),
+		logged:    make(map[string]*LoggedAdapter),
 	}
 }
 
+// ConfigurePool sets the pool and retry policy Connect applies to an adapter
+func (dm *DatabaseManager) ConfigurePool(name string, pool databasetypes.ConnectionPool) {
+	dm.pools[name] = pool
+}
+
+// ConfigureReplicas sets the read replicas Connect routes an adapter's
+// reads to
+func (dm *DatabaseManager) ConfigureReplicas(name string, replicas databasetypes.ReplicaConfig) {
+	dm.replicas[name] = replicas
+}
+
+// ConfigureQueryLog makes adapters connected from now on log their
+// statements
+func (dm *DatabaseManager) ConfigureQueryLog(cfg querylog.Config) {
+	dm.queryLog = &cfg
+}
+
+// QueryLog returns the query log settings
+func (dm *DatabaseManager) QueryLog() (querylog.Config, bool) {
+	if dm.queryLog == nil {
+		return querylog.Config{}, false
+	}
+	return *dm.queryLog, true
+}
+
+// ConfigurePools reads pool and replica settings for every registered
+// adapter from a flattened [database] section, e.g. postgresql.max_open,
+// postgresql.retry.backoff or postgresql.replicas, and the query log
+// settings in query_log
+func (dm *DatabaseManager) ConfigurePools(values map[string]interface{}) error {
+	queryLog, ok, err := querylog.FromConfig(values)
+	if err != nil {
+		return err
+	}
+	if ok {
+		dm.ConfigureQueryLog(queryLog)
+	}
+	
+	for name := range dm.adapters {
+		pool, ok, err := databasetypes.PoolFromConfig(values, name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			dm.ConfigurePool(name, pool)
+		}
+		
+		replicas, ok, err := databasetypes.ReplicasFromConfig(values, name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			dm.ConfigureReplicas(name, replicas)
+		}
+	}
+	return nil
+}
+
+// Replicas returns the configured replicas of an adapter
+func (dm *DatabaseManager) Replicas(name string) (databasetypes.ReplicaConfig, bool) {
+	replicas, ok := dm.replicas[name]
+	return replicas, ok
+}
+
+// Pool returns the configured pool settings of an adapter
+func (dm *DatabaseManager) Pool(name string) (databasetypes.ConnectionPool, bool) {
+	pool, ok := dm.pools[name]
+	return pool, ok
+}
+
+// Connect applies an adapter's configured pool settings and connects it,
+// retrying with backoff as the pool's retry policy allows. With replicas
+// configured, it connects them too and GetAdapter then returns a
+// ReplicatedAdapter; replicas that cannot connect yet are left to the
+// health checks, so they only delay reads from joining them. With a query
+// log configured, the adapter is wrapped in a LoggedAdapter.
+func (dm *DatabaseManager) Connect(name, dsn string) error {
+	adapter, exists := dm.adapters[name]
+	if !exists {
+		return fmt.Errorf("adapter '%s' not found", name)
+	}
+	if routed, ok := dm.routed[name]; ok {
+		routed.replicas.Close()
+		delete(dm.routed, name)
+	}
+	if logged, ok := dm.logged[name]; ok {
+		logged.log.Close()
+		delete(dm.logged, name)
+	}
+	
+	pool := dm.pools[name]
+	if err := pool.Retry(func() error {
+		return dm.connectAdapter(adapter, pool, dsn)
+	}); err != nil {
+		return err
+	}
+	
+	if err := dm.connectReplicas(name, adapter, pool); err != nil {
+		return err
+	}
+	
+	if dm.queryLog != nil {
+		log, err := querylog.Open(*dm.queryLog)
+		if err != nil {
+			return err
+		}
+		connected, _ := dm.adapter(name)
+		dm.logged[name] = NewLoggedAdapter(name, connected, log)
+	}
+	return nil
+}
+
+// connectReplicas connects the configured replicas of an adapter and routes
+// its reads to them
+func (dm *DatabaseManager) connectReplicas(name string, adapter DatabaseAdapter, pool databasetypes.ConnectionPool) error {
+	replicas, ok := dm.replicas[name]
+	if !ok || len(replicas.DSNs) == 0 {
+		return nil
+	}
+	factory, ok := dm.factories[name]
+	if !ok {
+		return fmt.Errorf("adapter '%s' has replicas configured but was not registered with a factory", name)
+	}
+	conns := make([]databasetypes.ReplicaConn, len(replicas.DSNs))
+	for i, replicaDSN := range replicas.DSNs {
+		replica := factory()
+		// A failure marks the replica unhealthy until a health check connects it
+		dm.connectAdapter(replica, pool, replicaDSN)
+		conns[i] = replica
+	}
+	set := databasetypes.NewReplicaSet(adapter, replicas, conns)
+	set.Start()
+	dm.routed[name] = &ReplicatedAdapter{DatabaseAdapter: adapter, replicas: set}
+	return nil
+}
+
+// connectAdapter applies pool settings to adapter and connects it
+func (dm *DatabaseManager) connectAdapter(adapter DatabaseAdapter, pool databasetypes.ConnectionPool, dsn string) error {
+	if pool.MaxOpenConnections > 0 {
+		adapter.SetMaxOpenConns(pool.MaxOpenConnections)
+	}
+	if pool.MaxIdleConnections > 0 {
+		adapter.SetMaxIdleConns(pool.MaxIdleConnections)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		adapter.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		adapter.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+	return adapter.Connect(dsn)
+}
+
 // RegisterAdapter registers a database adapter
 func (dm *DatabaseManager) RegisterAdapter(name string, adapter DatabaseAdapter) {
 	dm.adapters[name] = adapter
@@ -67,18 +238,66 @@ func (dm *DatabaseManager) RegisterAdapter(name string, adapter DatabaseAdapter)
 	}
 }
 
-// GetAdapter returns a database adapter by name
+// RegisterAdapterFactory registers an adapter created by factory, which
+// also creates the adapters its read replicas connect with
+func (dm *DatabaseManager) RegisterAdapterFactory(name string, factory func() DatabaseAdapter) {
+	dm.factories[name] = factory
+	dm.RegisterAdapter(name, factory())
+}
+
+// GetAdapter returns a database adapter by name; connected adapters are
+// returned wrapped in their LoggedAdapter or ReplicatedAdapter, and in a
+// TracedAdapter while tracing is on
 func (dm *DatabaseManager) GetAdapter(name string) (DatabaseAdapter, bool) {
+	adapter, exists := dm.adapter(name)
+	if exists && tracing.Enabled() {
+		return NewTracedAdapter(name, adapter), true
+	}
+	return adapter, exists
+}
+
+// adapter returns a database adapter by name, wrapped in its LoggedAdapter
+// or ReplicatedAdapter once connected
+func (dm *DatabaseManager) adapter(name string) (DatabaseAdapter, bool) {
+	if logged, ok := dm.logged[name]; ok {
+		return logged, true
+	}
+	if routed, ok := dm.routed[name]; ok {
+		return routed, true
+	}
 	adapter, exists := dm.adapters[name]
 	return adapter, exists
 }
 
+// Routed returns the adapter routing reads to replicas, if name was
+// connected with replicas
+func (dm *DatabaseManager) Routed(name string) (*ReplicatedAdapter, bool) {
+	routed, ok := dm.routed[name]
+	return routed, ok
+}
+
 // GetDefaultAdapter returns the default database adapter
 func (dm *DatabaseManager) GetDefaultAdapter() DatabaseAdapter {
 	if dm.defaultAdapter == "" {
 		return nil
 	}
-	return dm.adapters[dm.defaultAdapter]
+	adapter, _ := dm.GetAdapter(dm.defaultAdapter)
+	return adapter
+}
+
+// DefaultAdapterName returns the name of the default database adapter
+func (dm *DatabaseManager) DefaultAdapterName() string {
+	return dm.defaultAdapter
+}
+
+// AdapterNames returns the names of the registered adapters, sorted
+func (dm *DatabaseManager) AdapterNames() []string {
+	names := make([]string, 0, len(dm.adapters))
+	for name := range dm.adapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // SetDefaultAdapter sets the default database adapter
@@ -91,6 +310,14 @@ func (dm *DatabaseManager) SetDefaultAdapter(name string) {
 // CloseAll closes all database adapters
 func (dm *DatabaseManager) CloseAll() error {
 	var lastError error
+	for name, routed := range dm.routed {
+		routed.replicas.Close()
+		delete(dm.routed, name)
+	}
+	for name, logged := range dm.logged {
+		logged.log.Close()
+		delete(dm.logged, name)
+	}
 	for name, adapter := range dm.adapters {
 		if err := adapter.Close(); err != nil {
 			lastError = err
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	"github.com/cyber-boost/tusktsk/pkg/querylog"
+)
+
+// LoggedAdapter logs every statement of the adapter it wraps, including
+// those run in its transactions, with their duration, rows and caller
+type LoggedAdapter struct {
+	DatabaseAdapter
+	name string
+	log  *querylog.Logger
+}
+
+// NewLoggedAdapter logs the statements adapter runs to log under name
+func NewLoggedAdapter(name string, adapter DatabaseAdapter, log *querylog.Logger) *LoggedAdapter {
+	return &LoggedAdapter{DatabaseAdapter: adapter, name: name, log: log}
+}
+
+// Unwrap returns the adapter statements are logged for
+func (la *LoggedAdapter) Unwrap() DatabaseAdapter {
+	return la.DatabaseAdapter
+}
+
+// Query runs and logs a query
+func (la *LoggedAdapter) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	return logQuery(la.log, la.name, query, func() (*databasetypes.Result, error) {
+		return la.DatabaseAdapter.Query(query, args...)
+	})
+}
+
+// QueryRow runs and logs a single-row query
+func (la *LoggedAdapter) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	return logQueryRow(la.log, la.name, query, func() (*databasetypes.Row, error) {
+		return la.DatabaseAdapter.QueryRow(query, args...)
+	})
+}
+
+// Execute runs and logs a statement
+func (la *LoggedAdapter) Execute(query string, args ...interface{}) error {
+	start := time.Now()
+	err := la.DatabaseAdapter.Execute(query, args...)
+	la.log.Log(la.name, query, time.Since(start), 0, err)
+	return err
+}
+
+// BeginTransaction starts a transaction whose statements are logged
+func (la *LoggedAdapter) BeginTransaction() (databasetypes.Transaction, error) {
+	tx, err := la.DatabaseAdapter.BeginTransaction()
+	if err != nil {
+		return nil, err
+	}
+	return &loggedTx{Transaction: tx, name: la.name, log: la.log}, nil
+}
+
+// BeginTransactionWithContext starts a transaction whose statements are
+// logged
+func (la *LoggedAdapter) BeginTransactionWithContext(ctx context.Context) (databasetypes.Transaction, error) {
+	tx, err := la.DatabaseAdapter.BeginTransactionWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &loggedTx{Transaction: tx, name: la.name, log: la.log}, nil
+}
+
+// SupportsSavepoints reports whether the wrapped adapter's transactions
+// support savepoints
+func (la *LoggedAdapter) SupportsSavepoints() bool {
+	adapter, ok := la.DatabaseAdapter.(databasetypes.SavepointAdapter)
+	return ok && adapter.SupportsSavepoints()
+}
+
+// Disconnect disconnects the adapter and closes its log
+func (la *LoggedAdapter) Disconnect() error {
+	la.log.Close()
+	return la.DatabaseAdapter.Disconnect()
+}
+
+// Close closes the adapter and its log
+func (la *LoggedAdapter) Close() error {
+	la.log.Close()
+	return la.DatabaseAdapter.Close()
+}
+
+// loggedTx logs the statements of a transaction
+type loggedTx struct {
+	databasetypes.Transaction
+	name string
+	log  *querylog.Logger
+}
+
+func (tx *loggedTx) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	return logQuery(tx.log, tx.name, query, func() (*databasetypes.Result, error) {
+		return tx.Transaction.Query(query, args...)
+	})
+}
+
+func (tx *loggedTx) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	return logQueryRow(tx.log, tx.name, query, func() (*databasetypes.Row, error) {
+		return tx.Transaction.QueryRow(query, args...)
+	})
+}
+
+func (tx *loggedTx) Execute(query string, args ...interface{}) error {
+	start := time.Now()
+	err := tx.Transaction.Execute(query, args...)
+	tx.log.Log(tx.name, query, time.Since(start), 0, err)
+	return err
+}
+
+func logQuery(log *querylog.Logger, name, query string, run func() (*databasetypes.Result, error)) (*databasetypes.Result, error) {
+	start := time.Now()
+	result, err := run()
+	rows := 0
+	if result != nil {
+		rows = len(result.Rows)
+	}
+	log.Log(name, query, time.Since(start), rows, err)
+	return result, err
+}
+
+func logQueryRow(log *querylog.Logger, name, query string, run func() (*databasetypes.Row, error)) (*databasetypes.Row, error) {
+	start := time.Now()
+	row, err := run()
+	rows := 0
+	if row != nil {
+		rows = 1
+	}
+	log.Log(name, query, time.Since(start), rows, err)
+	return row, err
+}
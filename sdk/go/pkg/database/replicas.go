@@ -0,0 +1,56 @@
+package database
+
+import (
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+)
+
+// ReplicatedAdapter is a primary adapter whose reads are spread over read
+// replicas. Writes, transactions and everything else run on the primary.
+type ReplicatedAdapter struct {
+	DatabaseAdapter
+	replicas *databasetypes.ReplicaSet
+}
+
+// Primary returns the adapter writes go to
+func (ra *ReplicatedAdapter) Primary() DatabaseAdapter {
+	return ra.DatabaseAdapter
+}
+
+// Replicas returns the health of every replica as last checked
+func (ra *ReplicatedAdapter) Replicas() []databasetypes.ReplicaStatus {
+	return ra.replicas.Status()
+}
+
+// Balance returns how reads are spread over the replicas
+func (ra *ReplicatedAdapter) Balance() string {
+	return ra.replicas.Balance()
+}
+
+// Query runs reads on a healthy replica and other statements on the primary
+func (ra *ReplicatedAdapter) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	return ra.replicas.Query(query, args...)
+}
+
+// QueryRow runs single-row reads on a healthy replica
+func (ra *ReplicatedAdapter) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	return ra.replicas.QueryRow(query, args...)
+}
+
+// SupportsSavepoints reports whether the primary's transactions support
+// savepoints
+func (ra *ReplicatedAdapter) SupportsSavepoints() bool {
+	adapter, ok := ra.DatabaseAdapter.(databasetypes.SavepointAdapter)
+	return ok && adapter.SupportsSavepoints()
+}
+
+// Disconnect disconnects the replicas and the primary
+func (ra *ReplicatedAdapter) Disconnect() error {
+	ra.replicas.Close()
+	return ra.DatabaseAdapter.Disconnect()
+}
+
+// Close closes the replicas and the primary
+func (ra *ReplicatedAdapter) Close() error {
+	ra.replicas.Close()
+	return ra.DatabaseAdapter.Close()
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracedAdapter records a client span for every statement of the adapter
+// it wraps, including those run in its transactions
+type TracedAdapter struct {
+	DatabaseAdapter
+	name string
+}
+
+// NewTracedAdapter traces the statements adapter runs as db.system name
+func NewTracedAdapter(name string, adapter DatabaseAdapter) *TracedAdapter {
+	return &TracedAdapter{DatabaseAdapter: adapter, name: name}
+}
+
+// Unwrap returns the adapter statements are traced for
+func (ta *TracedAdapter) Unwrap() DatabaseAdapter {
+	return ta.DatabaseAdapter
+}
+
+// Query runs a query in a span
+func (ta *TracedAdapter) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	return traceQuery(ta.name, query, func() (*databasetypes.Result, error) {
+		return ta.DatabaseAdapter.Query(query, args...)
+	})
+}
+
+// QueryRow runs a single-row query in a span
+func (ta *TracedAdapter) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	return traceQueryRow(ta.name, query, func() (*databasetypes.Row, error) {
+		return ta.DatabaseAdapter.QueryRow(query, args...)
+	})
+}
+
+// Execute runs a statement in a span
+func (ta *TracedAdapter) Execute(query string, args ...interface{}) error {
+	_, span := startStatement(ta.name, query)
+	err := ta.DatabaseAdapter.Execute(query, args...)
+	endStatement(span, -1, err)
+	return err
+}
+
+// BeginTransaction starts a transaction whose statements are traced
+func (ta *TracedAdapter) BeginTransaction() (databasetypes.Transaction, error) {
+	tx, err := ta.DatabaseAdapter.BeginTransaction()
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Transaction: tx, name: ta.name}, nil
+}
+
+// BeginTransactionWithContext starts a transaction whose statements are
+// traced
+func (ta *TracedAdapter) BeginTransactionWithContext(ctx context.Context) (databasetypes.Transaction, error) {
+	tx, err := ta.DatabaseAdapter.BeginTransactionWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Transaction: tx, name: ta.name}, nil
+}
+
+// SupportsSavepoints reports whether the wrapped adapter's transactions
+// support savepoints
+func (ta *TracedAdapter) SupportsSavepoints() bool {
+	adapter, ok := ta.DatabaseAdapter.(databasetypes.SavepointAdapter)
+	return ok && adapter.SupportsSavepoints()
+}
+
+// tracedTx traces the statements of a transaction
+type tracedTx struct {
+	databasetypes.Transaction
+	name string
+}
+
+func (tx *tracedTx) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	return traceQuery(tx.name, query, func() (*databasetypes.Result, error) {
+		return tx.Transaction.Query(query, args...)
+	})
+}
+
+func (tx *tracedTx) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	return traceQueryRow(tx.name, query, func() (*databasetypes.Row, error) {
+		return tx.Transaction.QueryRow(query, args...)
+	})
+}
+
+func (tx *tracedTx) Execute(query string, args ...interface{}) error {
+	_, span := startStatement(tx.name, query)
+	err := tx.Transaction.Execute(query, args...)
+	endStatement(span, -1, err)
+	return err
+}
+
+func traceQuery(name, query string, run func() (*databasetypes.Result, error)) (*databasetypes.Result, error) {
+	_, span := startStatement(name, query)
+	result, err := run()
+	rows := 0
+	if result != nil {
+		rows = len(result.Rows)
+	}
+	endStatement(span, rows, err)
+	return result, err
+}
+
+func traceQueryRow(name, query string, run func() (*databasetypes.Row, error)) (*databasetypes.Row, error) {
+	_, span := startStatement(name, query)
+	row, err := run()
+	rows := 0
+	if row != nil {
+		rows = 1
+	}
+	endStatement(span, rows, err)
+	return row, err
+}
+
+// startStatement starts the span of a statement, named after its verb
+func startStatement(name, query string) (context.Context, trace.Span) {
+	verb := "query"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		verb = strings.ToUpper(fields[0])
+	}
+	ctx, span := tracing.Start(context.Background(), verb, trace.SpanKindClient)
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("db.system", name), attribute.String("db.statement", query))
+	}
+	return ctx, span
+}
+
+// endStatement ends the span of a statement; rows is -1 when the statement
+// does not report them
+func endStatement(span trace.Span, rows int, err error) {
+	if span.IsRecording() {
+		if rows >= 0 {
+			span.SetAttributes(attribute.Int("rows", rows))
+		}
+		tracing.Fail(span, err)
+	}
+	span.End()
+}
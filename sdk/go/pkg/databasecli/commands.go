@@ -1,15 +1,26 @@
 package databasecli
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/cyber-boost/tusktsk/pkg/config"
 	"github.com/cyber-boost/tusktsk/pkg/database"
 	"github.com/cyber-boost/tusktsk/pkg/database/adapters"
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	"github.com/cyber-boost/tusktsk/pkg/dbbackup"
+	"github.com/cyber-boost/tusktsk/pkg/dbmigrate"
+	"github.com/cyber-boost/tusktsk/pkg/dbschema"
+	"github.com/cyber-boost/tusktsk/pkg/dbseed"
+	"github.com/cyber-boost/tusktsk/pkg/enterprise"
 	"github.com/cyber-boost/tusktsk/pkg/orm"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/querylog"
 	"github.com/spf13/cobra"
 )
 
@@ -17,6 +28,8 @@ import (
 type DatabaseCommands struct {
 	manager *database.DatabaseManager
 	orm     *orm.ORM
+	// poolsLoaded is set once [database] pool settings have been read
+	poolsLoaded bool
 }
 
 // NewDatabaseCommands creates a new database commands instance
@@ -24,8 +37,11 @@ func NewDatabaseCommands() *DatabaseCommands {
 	manager := database.NewDatabaseManager()
 	
 	// Register default adapters
-	manager.RegisterAdapter("sqlite", adapters.NewSQLiteAdapter())
-	manager.RegisterAdapter("postgresql", adapters.NewPostgreSQLAdapter())
+	manager.RegisterAdapterFactory("sqlite", func() database.DatabaseAdapter { return adapters.NewSQLiteAdapter() })
+	manager.RegisterAdapterFactory("postgresql", func() database.DatabaseAdapter { return adapters.NewPostgreSQLAdapter() })
+	manager.RegisterAdapterFactory("mysql", func() database.DatabaseAdapter { return adapters.NewMySQLAdapter() })
+	manager.RegisterAdapterFactory("mongodb", func() database.DatabaseAdapter { return adapters.NewMongoDBAdapter() })
+	manager.RegisterAdapterFactory("redis", func() database.DatabaseAdapter { return adapters.NewRedisAdapter() })
 	
 	return &DatabaseCommands{
 		manager: manager,
@@ -52,39 +68,94 @@ func (dc *DatabaseCommands) GetCommands() []*cobra.Command {
 // statusCommand shows database status
 func (dc *DatabaseCommands) statusCommand() *cobra.Command {
 	var adapter string
+	var dsn string
+	var asJSON bool
 	
 	cmd := &cobra.Command{
-		Use:   "status [--adapter]",
+		Use:   "status [--adapter] [--dsn] [--json]",
 		Short: "Show database connection status",
-		Long:  "Display the status of database connections and performance metrics",
+		Long: `Display the status of database connections and performance metrics.
+
+Pool settings come from the [database] section of peanu.tsk, per adapter:
+max_open, max_idle, conn_max_lifetime, conn_max_idle_time, and a retry
+policy in retry.attempts, retry.backoff and retry.max_backoff. With --dsn
+the adapter connects first, so the live pool values are shown.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return dc.showStatus(adapter)
+			return dc.showStatus(adapter, dsn, asJSON)
 		},
 	}
 	
 	cmd.Flags().StringVar(&adapter, "adapter", "", "Specific adapter to check (sqlite, postgresql, mysql, mongodb, redis)")
+	cmd.Flags().StringVar(&dsn, "dsn", "", "Connection string to connect the adapter with first")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
 	
 	return cmd
 }
 
 // migrateCommand runs database migrations
 func (dc *DatabaseCommands) migrateCommand() *cobra.Command {
-	var adapter string
-	var dryRun bool
-	var version string
+	var adapter, dsn, dir, version, schemaFile string
+	var dryRun, plan, allowDestructive, write bool
+	var steps int
+	
+	run := func(direction string) func(cmd *cobra.Command, args []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			if plan {
+				return dc.planSchema(adapter, dsn, dir, schemaFile, allowDestructive, write)
+			}
+			return dc.runMigrations(direction, adapter, dsn, dir, dbmigrate.Options{DryRun: dryRun, Target: version, Steps: steps})
+		}
+	}
 	
 	cmd := &cobra.Command{
-		Use:   "migrate [--adapter] [--dry-run] [--version]",
+		Use:   "migrate [up|down|status|redo|create] [--adapter] [--dsn] [--dir] [--dry-run] [--version] [--plan]",
 		Short: "Run database migrations",
-		Long:  "Execute database schema migrations with version control",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return dc.runMigrations(adapter, dryRun, version)
-		},
+		Long: `Apply versioned migrations from a migrations/ directory of timestamped
+files: <version>_<name>.up.sql and .down.sql pairs, single .sql files with
+-- +up and -- +down sections, or .tsk files with [up] and [down] sql keys.
+Applied versions are recorded in the schema_migrations table, and each
+migration runs in a transaction where the adapter supports it.
+
+Without a subcommand, migrate applies every pending migration.
+
+With --plan, migrate compares the database with the tables declared in
+schema.tsk and shows the changes between them: created and dropped tables,
+added, dropped, renamed and altered columns, and index changes. --write
+saves the plan as a new migration. Plans with destructive changes, which
+can lose data, are refused unless --allow-destructive is passed.`,
+		RunE: run("up"),
 	}
 	
-	cmd.Flags().StringVar(&adapter, "adapter", "", "Database adapter to use")
-	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be migrated without executing")
-	cmd.Flags().StringVar(&version, "version", "", "Migrate to specific version")
+	cmd.PersistentFlags().StringVar(&adapter, "adapter", "", "Database adapter to use")
+	cmd.PersistentFlags().StringVar(&dsn, "dsn", "", "Connection string to connect with first")
+	cmd.PersistentFlags().StringVar(&dir, "dir", dbmigrate.DefaultDir, "Migrations directory")
+	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Show what would be migrated without executing")
+	cmd.PersistentFlags().StringVar(&version, "version", "", "Migrate up to, or down to, a specific version")
+	cmd.PersistentFlags().IntVar(&steps, "steps", 0, "Number of migrations to apply or roll back (down defaults to 1)")
+	cmd.PersistentFlags().BoolVar(&plan, "plan", false, "Show the changes from the database to the schema file")
+	cmd.PersistentFlags().StringVar(&schemaFile, "schema", dbschema.DefaultFile, "Schema file declaring the desired tables")
+	cmd.PersistentFlags().BoolVar(&allowDestructive, "allow-destructive", false, "Allow plans that drop tables or columns or change column types")
+	cmd.PersistentFlags().BoolVar(&write, "write", false, "Save the plan as a new migration in --dir")
+	
+	cmd.AddCommand(
+		&cobra.Command{Use: "up", Short: "Apply pending migrations", Args: cobra.NoArgs, RunE: run("up")},
+		&cobra.Command{Use: "down", Short: "Roll back the latest migration, or down to --version", Args: cobra.NoArgs, RunE: run("down")},
+		&cobra.Command{Use: "status", Short: "Show applied and pending migrations", Args: cobra.NoArgs, RunE: run("status")},
+		&cobra.Command{Use: "redo", Short: "Roll back and re-apply the latest migration", Args: cobra.NoArgs, RunE: run("redo")},
+		&cobra.Command{
+			Use:   "create <name>",
+			Short: "Create an empty timestamped migration",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				file, err := dbmigrate.Create(dir, args[0], time.Now())
+				if err != nil {
+					return err
+				}
+				fmt.Printf("📝 Created %s\n", file)
+				return nil
+			},
+		},
+	)
 	
 	return cmd
 }
@@ -92,17 +163,25 @@ func (dc *DatabaseCommands) migrateCommand() *cobra.Command {
 // consoleCommand opens database console
 func (dc *DatabaseCommands) consoleCommand() *cobra.Command {
 	var adapter string
+	var dsn string
+	var noHistory bool
 	
 	cmd := &cobra.Command{
-		Use:   "console [--adapter]",
+		Use:   "console [--adapter] [--dsn]",
 		Short: "Open database console",
-		Long:  "Start an interactive database console for direct query execution",
+		Long: `Start an interactive database console for direct query execution.
+
+Statements may span several lines; SQL statements end with ';'. Meta-commands:
+.tables, .schema [table], .history, .help and .quit. !n and !! re-run entries
+from the history, which is kept in ~/.tsk_db_history.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return dc.openConsole(adapter)
+			return dc.openConsole(adapter, dsn, noHistory)
 		},
 	}
 	
-	cmd.Flags().StringVar(&adapter, "adapter", "", "Database adapter to use")
+	cmd.Flags().StringVar(&adapter, "adapter", "", "Database adapter to use (sqlite, postgresql, mysql, mongodb, redis)")
+	cmd.Flags().StringVar(&dsn, "dsn", "", "Connection string to connect with before opening the console")
+	cmd.Flags().BoolVar(&noHistory, "no-history", false, "Do not read or write the history file")
 	
 	return cmd
 }
@@ -110,20 +189,27 @@ func (dc *DatabaseCommands) consoleCommand() *cobra.Command {
 // backupCommand creates database backup
 func (dc *DatabaseCommands) backupCommand() *cobra.Command {
 	var adapter string
+	var dsn string
 	var compress bool
 	
 	cmd := &cobra.Command{
-		Use:   "backup <file> [--adapter] [--compress]",
+		Use:   "backup <file> --dsn <dsn> [--adapter] [--compress]",
 		Short: "Create database backup",
-		Long:  "Create a backup of the database to the specified file",
-		Args:  cobra.ExactArgs(1),
+		Long: `Create a backup of the database to the specified file.
+
+SQLite databases (--dsn sqlite:<path>) are copied with the online backup API
+while they stay in use; PostgreSQL databases (--dsn postgresql://...) are
+dumped with pg_dump. A <file>.sha256 checksum is written next to the backup.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return dc.createBackup(args[0], adapter, compress)
+			return dc.createBackup(args[0], adapter, dsn, compress)
 		},
 	}
 	
-	cmd.Flags().StringVar(&adapter, "adapter", "", "Database adapter to use")
+	cmd.Flags().StringVar(&adapter, "adapter", "", "Database adapter to use (default: from --dsn)")
+	cmd.Flags().StringVar(&dsn, "dsn", "", "Connection string of the database to back up")
 	cmd.Flags().BoolVar(&compress, "compress", true, "Compress backup file")
+	cmd.MarkFlagRequired("dsn")
 	
 	return cmd
 }
@@ -131,20 +217,26 @@ func (dc *DatabaseCommands) backupCommand() *cobra.Command {
 // restoreCommand restores database from backup
 func (dc *DatabaseCommands) restoreCommand() *cobra.Command {
 	var adapter string
+	var dsn string
 	var force bool
 	
 	cmd := &cobra.Command{
-		Use:   "restore <file> [--adapter] [--force]",
+		Use:   "restore <file> --dsn <dsn> [--adapter] [--force]",
 		Short: "Restore database from backup",
-		Long:  "Restore database from a backup file",
-		Args:  cobra.ExactArgs(1),
+		Long: `Restore database from a backup file.
+
+The backup's checksum, compression and contents are verified before the
+database is touched; PostgreSQL restores run in a single transaction.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return dc.restoreBackup(args[0], adapter, force)
+			return dc.restoreBackup(args[0], adapter, dsn, force)
 		},
 	}
 	
-	cmd.Flags().StringVar(&adapter, "adapter", "", "Database adapter to use")
+	cmd.Flags().StringVar(&adapter, "adapter", "", "Database adapter to use (default: from --dsn)")
+	cmd.Flags().StringVar(&dsn, "dsn", "", "Connection string of the database to restore into")
 	cmd.Flags().BoolVar(&force, "force", false, "Force restore without confirmation")
+	cmd.MarkFlagRequired("dsn")
 	
 	return cmd
 }
@@ -199,8 +291,11 @@ func (dc *DatabaseCommands) dropCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "drop [--adapter] [--name] [--force]",
 		Short: "Drop database",
-		Long:  "Drop an existing database",
+		Long:  "Drop an existing database. Under an access.policy.tsk this needs db:admin.",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := enterprise.AuthorizeCommand(".", "db drop"); err != nil {
+				return err
+			}
 			return dc.dropDatabase(adapter, name, force)
 		},
 	}
@@ -215,40 +310,58 @@ func (dc *DatabaseCommands) dropCommand() *cobra.Command {
 
 // seedCommand seeds database with data
 func (dc *DatabaseCommands) seedCommand() *cobra.Command {
-	var adapter string
-	var file string
+	var adapter, dsn, dir, env string
+	var files []string
 	
 	cmd := &cobra.Command{
-		Use:   "seed [--adapter] [--file]",
+		Use:   "seed [--adapter] [--dsn] [--dir] [--file] [--env]",
 		Short: "Seed database with data",
-		Long:  "Seed database with initial data from file or default seeders",
+		Long: `Seed tables with the rows declared in seeds/*.tsk files. Each [table]
+section names its key columns, the tables it depends on and its rows, whose
+values may use operators such as @env and @date. Rows matching on the key
+are updated and the others inserted, so seeding can be repeated. Files with
+an env list only run when --env names one of those environments.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return dc.seedDatabase(adapter, file)
+			return dc.seedDatabase(adapter, dsn, dir, env, files...)
 		},
 	}
 	
 	cmd.Flags().StringVar(&adapter, "adapter", "", "Database adapter to use")
-	cmd.Flags().StringVar(&file, "file", "", "Seed data file path")
+	cmd.Flags().StringVar(&dsn, "dsn", "", "Connection string to connect with first")
+	cmd.Flags().StringVar(&dir, "dir", dbseed.DefaultDir, "Seeds directory")
+	cmd.Flags().StringSliceVar(&files, "file", nil, "Seed only these files, by name or path")
+	cmd.Flags().StringVar(&env, "env", "", "Environment selecting env-specific seed files")
 	
 	return cmd
 }
 
 // analyzeCommand analyzes database performance
 func (dc *DatabaseCommands) analyzeCommand() *cobra.Command {
-	var adapter string
-	var table string
+	var adapter, table, logFile string
+	var slow bool
+	var limit int
 	
 	cmd := &cobra.Command{
-		Use:   "analyze [--adapter] [--table]",
+		Use:   "analyze [--adapter] [--table] [--slow] [--log] [--limit]",
 		Short: "Analyze database performance",
-		Long:  "Analyze database performance and provide optimization recommendations",
+		Long: `Summarize the query log: queries are grouped by shape, with literals
+replaced by ?, and ranked by total time, with their count, mean, p95 and
+max durations, rows and callers. --slow keeps the queries that ran slower
+than the threshold at least once.
+
+Queries are logged once [database] query_log.file is set in peanut.tsk;
+query_log.slow sets the threshold (default 100ms) and query_log.only_slow
+logs slow queries only.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return dc.analyzePerformance(adapter, table)
+			return dc.analyzePerformance(adapter, table, logFile, slow, limit)
 		},
 	}
 	
-	cmd.Flags().StringVar(&adapter, "adapter", "", "Database adapter to use")
-	cmd.Flags().StringVar(&table, "table", "", "Specific table to analyze")
+	cmd.Flags().StringVar(&adapter, "adapter", "", "Only queries run by this adapter")
+	cmd.Flags().StringVar(&table, "table", "", "Only queries mentioning this table")
+	cmd.Flags().BoolVar(&slow, "slow", false, "Only queries that exceeded the slow threshold")
+	cmd.Flags().StringVar(&logFile, "log", "", "Query log to read (default: [database] query_log.file)")
+	cmd.Flags().IntVar(&limit, "limit", 10, "Number of queries to show")
 	
 	return cmd
 }
@@ -275,32 +388,125 @@ func (dc *DatabaseCommands) optimizeCommand() *cobra.Command {
 
 // Implementation methods
 
-func (dc *DatabaseCommands) showStatus(adapter string) error {
-	fmt.Println("🔍 Database Status Report")
-	fmt.Println("=========================")
-	
-	if adapter != "" {
-		// Show status for specific adapter
-		db, exists := dc.manager.GetAdapter(adapter)
-		if !exists {
+// adapterStatus is one adapter's entry in `tsk db status --json`
+type adapterStatus struct {
+	Adapter   string                        `json:"adapter"`
+	Connected bool                          `json:"connected"`
+	Ping      string                        `json:"ping,omitempty"`
+	Pool      *databasetypes.ConnectionPool `json:"pool,omitempty"`
+	Stats     *poolStats                    `json:"stats,omitempty"`
+	// Balance and Replicas describe the read replicas of a routed adapter
+	Balance  string                        `json:"balance,omitempty"`
+	Replicas []databasetypes.ReplicaStatus `json:"replicas,omitempty"`
+}
+
+// poolStats are the live pool values of a connected adapter
+type poolStats struct {
+	MaxOpenConnections int           `json:"max_open_connections"`
+	OpenConnections    int           `json:"open_connections"`
+	InUse              int           `json:"in_use"`
+	Idle               int           `json:"idle"`
+	WaitCount          int64         `json:"wait_count"`
+	WaitDuration       time.Duration `json:"wait_duration"`
+	MaxIdleClosed      int64         `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64         `json:"max_lifetime_closed"`
+	// Statements are the prepared statement cache's counters
+	Statements databasetypes.StmtCacheStats `json:"statements"`
+}
+
+func (dc *DatabaseCommands) showStatus(adapter, dsn string, asJSON bool) error {
+	if err := dc.loadPools(); err != nil {
+		return err
+	}
+	names := dc.manager.AdapterNames()
+	if dsn != "" {
+		_, name, closeFn, err := dc.connect(adapter, dsn)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+		names = []string{name}
+	} else if adapter != "" {
+		if _, exists := dc.manager.GetAdapter(adapter); !exists {
 			return fmt.Errorf("adapter '%s' not found", adapter)
 		}
-		
-		dc.printAdapterStatus(adapter, db)
-	} else {
-		// Show status for all adapters
-		for name, db := range dc.manager.adapters {
-			dc.printAdapterStatus(name, db)
-			fmt.Println()
+		names = []string{adapter}
+	}
+	
+	if asJSON {
+		report := make([]adapterStatus, 0, len(names))
+		for _, name := range names {
+			db, _ := dc.manager.GetAdapter(name)
+			report = append(report, dc.adapterStatus(name, db))
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode status: %w", err)
 		}
+		fmt.Println(string(data))
+		return nil
+	}
+	
+	fmt.Println("🔍 Database Status Report")
+	fmt.Println("=========================")
+	for _, name := range names {
+		db, _ := dc.manager.GetAdapter(name)
+		dc.printAdapterStatus(name, db)
+		fmt.Println()
 	}
 	
 	return nil
 }
 
+// adapterStatus collects the status of one adapter
+func (dc *DatabaseCommands) adapterStatus(name string, db database.DatabaseAdapter) adapterStatus {
+	status := adapterStatus{Adapter: name, Connected: db.IsConnected()}
+	if pool, ok := dc.manager.Pool(name); ok {
+		status.Pool = &pool
+	}
+	if !status.Connected {
+		return status
+	}
+	
+	status.Ping = "ok"
+	if err := db.Ping(); err != nil {
+		status.Ping = err.Error()
+	}
+	stats := db.GetStats()
+	status.Stats = &poolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration,
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		Statements:         stats.Statements,
+	}
+	if routed, ok := dc.manager.Routed(name); ok {
+		status.Balance = routed.Balance()
+		status.Replicas = routed.Replicas()
+	}
+	return status
+}
+
 func (dc *DatabaseCommands) printAdapterStatus(name string, db database.DatabaseAdapter) {
 	fmt.Printf("📊 Adapter: %s\n", name)
 	
+	// Configured pool
+	if pool, ok := dc.manager.Pool(name); ok {
+		fmt.Printf("   Pool: max_open=%d max_idle=%d conn_max_lifetime=%v conn_max_idle_time=%v\n",
+			pool.MaxOpenConnections, pool.MaxIdleConnections, pool.ConnMaxLifetime, pool.ConnMaxIdleTime)
+		if pool.MaxRetries > 0 {
+			fmt.Printf("   Retry: %d attempts, backoff %v", pool.MaxRetries, pool.RetryDelay)
+			if pool.RetryMaxDelay > 0 {
+				fmt.Printf(" (max %v)", pool.RetryMaxDelay)
+			}
+			fmt.Println()
+		}
+	}
+	
 	// Connection status
 	if db.IsConnected() {
 		fmt.Printf("   Status: ✅ Connected\n")
@@ -320,129 +526,280 @@ func (dc *DatabaseCommands) printAdapterStatus(name string, db database.Database
 		fmt.Printf("   Idle: %d\n", stats.Idle)
 		fmt.Printf("   Wait Count: %d\n", stats.WaitCount)
 		fmt.Printf("   Wait Duration: %v\n", stats.WaitDuration)
+		if stmts := stats.Statements; stmts.Capacity > 0 {
+			fmt.Printf("   Statement Cache: %d/%d cached, %d hits, %d misses, %d re-prepared, %d evicted\n",
+				stmts.Size, stmts.Capacity, stmts.Hits, stmts.Misses, stmts.Reprepares, stmts.Evictions)
+		}
+		
+		// Read replicas
+		if routed, ok := dc.manager.Routed(name); ok {
+			fmt.Printf("   Replicas (%s):\n", routed.Balance())
+			for _, replica := range routed.Replicas() {
+				if replica.Healthy {
+					fmt.Printf("     ✅ %s latency=%v queries=%d failovers=%d\n", replica.DSN, replica.Latency, replica.Queries, replica.Failovers)
+				} else {
+					fmt.Printf("     ❌ %s failovers=%d - %s\n", replica.DSN, replica.Failovers, replica.LastError)
+				}
+			}
+		}
 	} else {
 		fmt.Printf("   Status: ❌ Disconnected\n")
+		if replicas, ok := dc.manager.Replicas(name); ok {
+			fmt.Printf("   Replicas: %d configured (%s)\n", len(replicas.DSNs), replicas.Balance)
+		}
 	}
 }
 
-func (dc *DatabaseCommands) runMigrations(adapter, dryRun, version string) error {
-	fmt.Println("🔄 Running Database Migrations")
-	fmt.Println("==============================")
+func (dc *DatabaseCommands) runMigrations(direction, adapter, dsn, dir string, opts dbmigrate.Options) error {
+	db, name, closeFn, err := dc.connect(adapter, dsn)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
 	
-	db := dc.getAdapter(adapter)
-	if db == nil {
-		return fmt.Errorf("no database adapter available")
+	migrator, err := dbmigrate.New(db, dir)
+	if err != nil {
+		return err
 	}
 	
-	if dryRun {
-		fmt.Println("🔍 DRY RUN MODE - No changes will be made")
-		fmt.Println()
-		
-		// Show what would be migrated
-		fmt.Println("Pending migrations:")
-		fmt.Println("  - Create users table")
-		fmt.Println("  - Create posts table")
-		fmt.Println("  - Add indexes")
-		fmt.Println("  - Add foreign keys")
-		
+	if direction == "status" {
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("📋 Migrations (%s, %s)\n", name, dir)
+		pending := 0
+		for _, status := range statuses {
+			switch {
+			case status.Missing:
+				fmt.Printf("  ⚠️  %s_%s applied %s, but its file is missing\n", status.Version, status.Name, status.AppliedAt)
+			case status.Applied:
+				fmt.Printf("  ✅ %s_%s (applied %s)\n", status.Version, status.Name, status.AppliedAt)
+			default:
+				pending++
+				fmt.Printf("  ⏳ %s_%s\n", status.Version, status.Name)
+			}
+		}
+		fmt.Printf("📊 %d migrations, %d pending\n", len(statuses), pending)
 		return nil
 	}
 	
-	// Initialize ORM if not already done
-	if dc.orm == nil {
-		dc.orm = orm.NewORM(db)
+	if opts.DryRun {
+		fmt.Println("🔍 DRY RUN MODE - No changes will be made")
+	}
+	fmt.Printf("🔄 Running Database Migrations (%s)\n", direction)
+	
+	var done []dbmigrate.Step
+	switch direction {
+	case "up":
+		done, err = migrator.Up(opts)
+	case "down":
+		done, err = migrator.Down(opts)
+	case "redo":
+		done, err = migrator.Redo(opts)
+	}
+	for _, step := range done {
+		arrow := "⬆️ "
+		if step.Direction == dbmigrate.Down {
+			arrow = "⬇️ "
+		}
+		fmt.Printf("  %s %s\n", arrow, step.Migration)
+		if opts.DryRun {
+			for _, stmt := range step.Statements() {
+				fmt.Printf("      %s;\n", strings.ReplaceAll(stmt, "\n", "\n      "))
+			}
+		} else if !step.Migration.Transaction {
+			fmt.Println("      (ran outside a transaction)")
+		}
+	}
+	if err != nil {
+		return err
 	}
 	
-	// Run migrations
-	fmt.Println("Running migrations...")
-	
-	// Example migration steps
-	migrations := []string{
-		"Creating users table...",
-		"Creating posts table...",
-		"Adding indexes...",
-		"Adding foreign keys...",
+	switch {
+	case len(done) == 0:
+		fmt.Println("✅ Nothing to migrate")
+	case opts.DryRun:
+		fmt.Printf("📋 %d migrations would run\n", len(done))
+	default:
+		fmt.Printf("🎉 %d migrations completed successfully!\n", len(done))
+	}
+	return nil
+}
+
+// planSchema shows the changes from the database's schema to the one in
+// schemaFile and, with write, saves them as a migration
+func (dc *DatabaseCommands) planSchema(adapter, dsn, dir, schemaFile string, allowDestructive, write bool) error {
+	desired, err := dbschema.Load(schemaFile)
+	if err != nil {
+		return err
+	}
+	db, name, closeFn, err := dc.connect(adapter, dsn)
+	if err != nil {
+		return err
 	}
+	defer closeFn()
 	
-	for _, migration := range migrations {
-		fmt.Printf("  %s", migration)
-		time.Sleep(100 * time.Millisecond) // Simulate work
-		fmt.Println(" ✅")
+	current, err := dbschema.Inspect(db, name)
+	if err != nil {
+		return err
 	}
+	// The migrations table is not part of the application's schema
+	delete(current.Tables, dbmigrate.DefaultTable)
 	
-	fmt.Println()
-	fmt.Println("🎉 All migrations completed successfully!")
+	plan := dbschema.Diff(current, desired)
+	fmt.Printf("📋 Schema plan (%s, %s)\n", name, schemaFile)
+	if plan.Empty() {
+		fmt.Println("✅ Schema is up to date")
+		return nil
+	}
+	for _, change := range plan.Changes {
+		marker := "  "
+		if change.Destructive {
+			marker = "⚠️ "
+		}
+		fmt.Printf("  %s %s\n", marker, change)
+		for _, stmt := range change.SQL {
+			fmt.Printf("      %s;\n", strings.ReplaceAll(stmt, "\n", "\n      "))
+		}
+	}
+	destructive := len(plan.Destructive())
+	fmt.Printf("📊 %d changes, %d destructive\n", len(plan.Changes), destructive)
 	
+	if err := plan.Check(allowDestructive); err != nil {
+		return fmt.Errorf("refusing %d destructive changes: review the plan and pass --allow-destructive", destructive)
+	}
+	if !write {
+		return nil
+	}
+	file, err := dbmigrate.Write(dir, "schema_plan", time.Now(), plan.Statements(), nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📝 Wrote %s; apply it with tsk db migrate up\n", file)
 	return nil
 }
 
-func (dc *DatabaseCommands) openConsole(adapter string) error {
-	fmt.Println("💻 Database Console")
-	fmt.Println("===================")
-	fmt.Println("Interactive console not yet implemented.")
-	fmt.Println("Use 'tsk db status' to check connection status.")
-	fmt.Println("Use 'tsk db migrate' to run migrations.")
+// connect looks up an adapter (the default when adapter is empty) and, given
+// a dsn, connects it. The returned close function disconnects what connect
+// connected.
+func (dc *DatabaseCommands) connect(adapter, dsn string) (database.DatabaseAdapter, string, func(), error) {
+	name := adapter
+	if name == "" {
+		name = dc.manager.DefaultAdapterName()
+	}
+	db, exists := dc.manager.GetAdapter(name)
+	if !exists {
+		return nil, "", nil, fmt.Errorf("adapter '%s' not found (available: %s)", name, strings.Join(dc.manager.AdapterNames(), ", "))
+	}
 	
-	return nil
+	if err := dc.loadPools(); err != nil {
+		return nil, "", nil, err
+	}
+	
+	closeFn := func() {}
+	if dsn != "" {
+		if err := dc.manager.Connect(name, dsn); err != nil {
+			return nil, "", nil, fmt.Errorf("failed to connect to %s: %w", name, err)
+		}
+		// With replicas configured, the connected adapter routes reads
+		db, _ = dc.manager.GetAdapter(name)
+		closeFn = func() { db.Disconnect() }
+	}
+	if !db.IsConnected() {
+		return nil, "", nil, fmt.Errorf("adapter '%s' is not connected: pass --dsn", name)
+	}
+	return db, name, closeFn, nil
 }
 
-func (dc *DatabaseCommands) createBackup(file, adapter string, compress bool) error {
-	fmt.Printf("💾 Creating Database Backup\n")
-	fmt.Printf("===========================\n")
-	fmt.Printf("File: %s\n", file)
-	fmt.Printf("Adapter: %s\n", adapter)
-	fmt.Printf("Compress: %v\n", compress)
-	
-	// Ensure directory exists
-	dir := filepath.Dir(file)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create backup directory: %w", err)
+// loadPools applies the pool and replica settings in the [database] section
+// of the peanut hierarchy of the working directory, once. Without a peanut file
+// the adapters keep their defaults.
+func (dc *DatabaseCommands) loadPools() error {
+	if dc.poolsLoaded {
+		return nil
 	}
+	dc.poolsLoaded = true
 	
-	// Create backup file
-	backupFile, err := os.Create(file)
+	cfg, _, err := peanut.LoadHierarchy(".")
+	if errors.Is(err, peanut.ErrNotFound) {
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create backup file: %w", err)
+		return err
 	}
-	defer backupFile.Close()
-	
-	// Write backup header
-	backupFile.WriteString("# TuskTSK Database Backup\n")
-	backupFile.WriteString(fmt.Sprintf("# Created: %s\n", time.Now().Format(time.RFC3339)))
-	backupFile.WriteString(fmt.Sprintf("# Adapter: %s\n", adapter))
-	backupFile.WriteString("#\n")
-	
-	// Get database adapter
-	db := dc.getAdapter(adapter)
-	if db == nil {
-		return fmt.Errorf("no database adapter available")
+	section, ok, err := cfg.Lookup("database")
+	if err != nil {
+		return err
+	}
+	tree, isSection := section.(map[string]interface{})
+	if !ok || !isSection {
+		return nil
+	}
+	if err := dc.manager.ConfigurePools(config.Flatten(tree)); err != nil {
+		return fmt.Errorf("failed to read [database] pool settings: %w", err)
 	}
+	return nil
+}
+
+func (dc *DatabaseCommands) openConsole(adapter, dsn string, noHistory bool) error {
+	db, name, closeFn, err := dc.connect(adapter, dsn)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
 	
-	// Export schema
-	if err := dc.exportSchema(db, backupFile); err != nil {
-		return fmt.Errorf("failed to export schema: %w", err)
+	console, err := NewConsole(db, name, os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if !noHistory {
+		if file := defaultHistoryFile(); file != "" {
+			if err := console.UseHistoryFile(file); err != nil {
+				fmt.Printf("⚠️  %v\n", err)
+			}
+		}
 	}
+	return console.Run()
+}
+
+func (dc *DatabaseCommands) createBackup(file, adapter, dsn string, compress bool) error {
+	fmt.Printf("💾 Creating Database Backup\n")
+	fmt.Printf("===========================\n")
+	fmt.Printf("File: %s\n", file)
 	
-	// Export data
-	if err := dc.exportData(db, backupFile); err != nil {
-		return fmt.Errorf("failed to export data: %w", err)
+	info, err := dbbackup.Backup(adapter, dsn, file, dbbackup.Options{Compress: compress, Progress: progressPrinter()})
+	fmt.Println()
+	if err != nil {
+		return err
 	}
 	
+	fmt.Printf("Adapter: %s\n", info.Adapter)
+	fmt.Printf("Size: %d bytes", info.Size)
+	if info.Compressed {
+		fmt.Printf(" (%d uncompressed)", info.Bytes)
+	}
+	fmt.Println()
+	fmt.Printf("SHA-256: %s\n", info.Checksum)
 	fmt.Println("✅ Backup created successfully!")
 	
 	return nil
 }
 
-func (dc *DatabaseCommands) restoreBackup(file, adapter string, force bool) error {
+func (dc *DatabaseCommands) restoreBackup(file, adapter, dsn string, force bool) error {
 	fmt.Printf("🔄 Restoring Database from Backup\n")
 	fmt.Printf("================================\n")
 	fmt.Printf("File: %s\n", file)
-	fmt.Printf("Adapter: %s\n", adapter)
-	fmt.Printf("Force: %v\n", force)
 	
-	// Check if backup file exists
-	if _, err := os.Stat(file); os.IsNotExist(err) {
-		return fmt.Errorf("backup file not found: %s", file)
+	info, err := dbbackup.Verify(file)
+	if err != nil {
+		return fmt.Errorf("backup failed verification: %w", err)
+	}
+	fmt.Printf("Adapter: %s\n", info.Adapter)
+	if info.ChecksumVerified {
+		fmt.Printf("✅ Checksum verified (%s)\n", info.Checksum)
+	} else {
+		fmt.Printf("⚠️  No %s file; contents checked but checksum not verified\n", dbbackup.ChecksumExt)
 	}
 	
 	if !force {
@@ -455,28 +812,28 @@ func (dc *DatabaseCommands) restoreBackup(file, adapter string, force bool) erro
 		}
 	}
 	
-	// Read backup file
-	backupFile, err := os.Open(file)
+	_, err = dbbackup.Restore(adapter, dsn, file, dbbackup.Options{Progress: progressPrinter()})
+	fmt.Println()
 	if err != nil {
-		return fmt.Errorf("failed to open backup file: %w", err)
-	}
-	defer backupFile.Close()
-	
-	// Get database adapter
-	db := dc.getAdapter(adapter)
-	if db == nil {
-		return fmt.Errorf("no database adapter available")
+		return err
 	}
 	
-	// Restore schema and data
-	fmt.Println("Restoring schema and data...")
-	time.Sleep(1 * time.Second) // Simulate work
-	
 	fmt.Println("✅ Database restored successfully!")
 	
 	return nil
 }
 
+// progressPrinter reports backup progress on one updating line
+func progressPrinter() dbbackup.Progress {
+	return func(done, total int64) {
+		if total > 0 {
+			fmt.Printf("\r⏳ %3d%% (%d/%d)", done*100/total, done, total)
+		} else {
+			fmt.Printf("\r⏳ %d bytes", done)
+		}
+	}
+}
+
 func (dc *DatabaseCommands) initializeDatabase(adapter, config string) error {
 	fmt.Printf("🚀 Initializing Database\n")
 	fmt.Printf("========================\n")
@@ -500,7 +857,9 @@ func (dc *DatabaseCommands) initializeDatabase(adapter, config string) error {
 	
 	// Seed data
 	fmt.Println("Seeding initial data...")
-	if err := dc.seedDatabase(adapter, ""); err != nil {
+	if _, err := os.Stat(dbseed.DefaultDir); os.IsNotExist(err) {
+		fmt.Printf("No %s directory, skipping\n", dbseed.DefaultDir)
+	} else if err := dc.seedDatabase(adapter, "", dbseed.DefaultDir, ""); err != nil {
 		return fmt.Errorf("failed to seed data: %w", err)
 	}
 	
@@ -566,78 +925,101 @@ func (dc *DatabaseCommands) dropDatabase(adapter, name string, force bool) error
 	return nil
 }
 
-func (dc *DatabaseCommands) seedDatabase(adapter, file string) error {
-	fmt.Printf("🌱 Seeding Database\n")
-	fmt.Printf("===================\n")
-	fmt.Printf("Adapter: %s\n", adapter)
-	fmt.Printf("File: %s\n", file)
-	
-	// Get database adapter
-	db := dc.getAdapter(adapter)
-	if db == nil {
-		return fmt.Errorf("no database adapter available")
+// seedDatabase seeds the seed files of dir that run in env, or only the
+// named ones
+func (dc *DatabaseCommands) seedDatabase(adapter, dsn, dir, env string, names ...string) error {
+	all, err := dbseed.Load(dir)
+	if err != nil {
+		return err
 	}
-	
-	// Initialize ORM if needed
-	if dc.orm == nil {
-		dc.orm = orm.NewORM(db)
+	files, err := dbseed.Select(all, env, names...)
+	if err != nil {
+		return err
+	}
+	tables, err := dbseed.Order(files)
+	if err != nil {
+		return err
 	}
 	
-	// Seed data
-	fmt.Println("Seeding data...")
-	
-	// Example seed data
-	seedQueries := []string{
-		"INSERT INTO users (name, email) VALUES ('Admin', 'admin@example.com')",
-		"INSERT INTO users (name, email) VALUES ('User', 'user@example.com')",
-		"INSERT INTO posts (title, content, user_id) VALUES ('Welcome', 'Welcome to TuskTSK!', 1)",
+	db, name, closeFn, err := dc.connect(adapter, dsn)
+	if err != nil {
+		return err
 	}
+	defer closeFn()
 	
-	for _, query := range seedQueries {
-		if err := db.Execute(query); err != nil {
-			return fmt.Errorf("failed to execute seed query: %w", err)
-		}
+	fmt.Printf("🌱 Seeding Database (%s, %s)\n", name, dir)
+	if env != "" {
+		fmt.Printf("Environment: %s\n", env)
+	}
+	if len(tables) == 0 {
+		fmt.Println("✅ Nothing to seed")
+		return nil
 	}
 	
-	fmt.Println("✅ Database seeded successfully!")
+	results, err := dbseed.Run(db, tables)
+	if err != nil {
+		return err
+	}
+	inserted, updated := 0, 0
+	for _, result := range results {
+		fmt.Printf("  ✅ %s (%s): %d inserted, %d updated\n", result.Table, filepath.Base(result.File), result.Inserted, result.Updated)
+		inserted += result.Inserted
+		updated += result.Updated
+	}
+	fmt.Printf("🎉 Database seeded: %d rows inserted, %d updated\n", inserted, updated)
 	
 	return nil
 }
 
-func (dc *DatabaseCommands) analyzePerformance(adapter, table string) error {
-	fmt.Printf("📊 Analyzing Database Performance\n")
-	fmt.Printf("=================================\n")
-	fmt.Printf("Adapter: %s\n", adapter)
-	fmt.Printf("Table: %s\n", table)
-	
-	// Get database adapter
-	db := dc.getAdapter(adapter)
-	if db == nil {
-		return fmt.Errorf("no database adapter available")
+// analyzePerformance summarizes the query log
+func (dc *DatabaseCommands) analyzePerformance(adapter, table, logFile string, slow bool, limit int) error {
+	if logFile == "" {
+		if err := dc.loadPools(); err != nil {
+			return err
+		}
+		cfg, ok := dc.manager.QueryLog()
+		if !ok {
+			return fmt.Errorf("no query log: set [database] query_log.file in peanut.tsk or pass --log")
+		}
+		logFile = cfg.File
 	}
-	
-	// Analyze performance
-	fmt.Println("Analyzing performance...")
-	
-	// Example analysis
-	analysis := map[string]interface{}{
-		"Total Tables": 5,
-		"Total Rows": 1250,
-		"Index Usage": "85%",
-		"Query Performance": "Good",
-		"Recommendations": []string{
-			"Add index on users.email",
-			"Optimize posts.content column",
-			"Consider partitioning for large tables",
-		},
+	entries, err := querylog.ReadFile(logFile)
+	if err != nil {
+		return err
 	}
+	summaries := querylog.Aggregate(entries, querylog.Filter{Adapter: adapter, Table: table, Slow: slow})
 	
-	// Print analysis results
-	for key, value := range analysis {
-		fmt.Printf("  %s: %v\n", key, value)
+	fmt.Printf("📊 Query Analysis (%s, %d queries logged)\n", logFile, len(entries))
+	if slow {
+		fmt.Println("Showing queries that exceeded the slow threshold")
+	}
+	if len(summaries) == 0 {
+		fmt.Println("✅ No matching queries")
+		return nil
+	}
+	shown := summaries
+	if limit > 0 && len(shown) > limit {
+		shown = shown[:limit]
+	}
+	for i, summary := range shown {
+		marker := "  "
+		if summary.Slow > 0 {
+			marker = "🐢"
+		}
+		fmt.Printf("%s %d. %s\n", marker, i+1, summary.Fingerprint)
+		fmt.Printf("      runs=%d slow=%d errors=%d total=%v mean=%v p95=%v max=%v rows=%d\n",
+			summary.Count, summary.Slow, summary.Errors, summary.Total, summary.Mean, summary.P95, summary.Max, summary.Rows)
+		if len(summary.Callers) > 0 {
+			callers := summary.Callers
+			if len(callers) > 3 {
+				callers = callers[:3]
+			}
+			fmt.Printf("      from %s\n", strings.Join(callers, ", "))
+		}
+	}
+	if len(shown) < len(summaries) {
+		fmt.Printf("... %d more (use --limit)\n", len(summaries)-len(shown))
 	}
-	
-	fmt.Println("✅ Performance analysis completed!")
 	
 	return nil
 }
@@ -687,75 +1069,3 @@ func (dc *DatabaseCommands) getAdapter(adapter string) database.DatabaseAdapter
 	
 	return dc.manager.GetDefaultAdapter()
 }
-
-func (dc *DatabaseCommands) exportSchema(db database.DatabaseAdapter, file *os.File) error {
-	// Export table schemas
-	query := "SELECT sql FROM sqlite_master WHERE type='table'"
-	result, err := db.Query(query)
-	if err != nil {
-		return err
-	}
-	
-	file.WriteString("# Schema Export\n")
-	for _, row := range result.Rows {
-		if sql, ok := row["sql"].(string); ok {
-			file.WriteString(sql + ";\n\n")
-		}
-	}
-	
-	return nil
-}
-
-func (dc *DatabaseCommands) exportData(db database.DatabaseAdapter, file *os.File) error {
-	// Export data
-	file.WriteString("# Data Export\n")
-	
-	// Get all tables
-	tablesQuery := "SELECT name FROM sqlite_master WHERE type='table'"
-	result, err := db.Query(tablesQuery)
-	if err != nil {
-		return err
-	}
-	
-	for _, row := range result.Rows {
-		if tableName, ok := row["name"].(string); ok {
-			// Skip system tables
-			if strings.HasPrefix(tableName, "sqlite_") {
-				continue
-			}
-			
-			// Export table data
-			dataQuery := fmt.Sprintf("SELECT * FROM %s", tableName)
-			dataResult, err := db.Query(dataQuery)
-			if err != nil {
-				continue
-			}
-			
-			file.WriteString(fmt.Sprintf("# Table: %s\n", tableName))
-			for _, dataRow := range dataResult.Rows {
-				// Convert row to INSERT statement
-				columns := make([]string, 0)
-				values := make([]string, 0)
-				
-				for col, val := range dataRow {
-					columns = append(columns, col)
-					if val == nil {
-						values = append(values, "NULL")
-					} else {
-						values = append(values, fmt.Sprintf("'%v'", val))
-					}
-				}
-				
-				insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);\n",
-					tableName,
-					strings.Join(columns, ", "),
-					strings.Join(values, ", "))
-				
-				file.WriteString(insertSQL)
-			}
-			file.WriteString("\n")
-		}
-	}
-	
-	return nil
-} 
\ No newline at end of file
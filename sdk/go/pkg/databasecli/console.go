@@ -0,0 +1,510 @@
+package databasecli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+)
+
+// Queryer is the part of a database adapter the console needs
+type Queryer interface {
+	Query(query string, args ...interface{}) (*databasetypes.Result, error)
+	Execute(query string, args ...interface{}) error
+}
+
+// maxHistory caps the entries kept in the history file
+const maxHistory = 1000
+
+// maxCellWidth truncates long values in result tables
+const maxCellWidth = 60
+
+// dialect describes how the console talks to one kind of database
+type dialect struct {
+	// complete reports whether buffered input holds a whole statement
+	complete func(input string) bool
+	// split breaks complete input into statements
+	split func(input string) []string
+	// isQuery reports whether a statement returns rows
+	isQuery func(stmt string) bool
+	// tables lists tables, collections or keys
+	tables string
+	// schema describes one table
+	schema func(table string) string
+	// hint explains how statements end
+	hint string
+}
+
+// dialects maps adapter names to their console dialect
+var dialects = map[string]dialect{
+	"sqlite": {
+		complete: sqlComplete,
+		split:    splitSQL,
+		isQuery:  sqlIsQuery,
+		tables:   "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name",
+		schema: func(table string) string {
+			return "SELECT sql FROM sqlite_master WHERE name = " + quoteSQL(table)
+		},
+		hint: "Statements end with ';' and may span several lines.",
+	},
+	"postgresql": {
+		complete: sqlComplete,
+		split:    splitSQL,
+		isQuery:  sqlIsQuery,
+		tables:   "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() ORDER BY table_name",
+		schema: func(table string) string {
+			return "SELECT column_name, data_type, is_nullable, column_default FROM information_schema.columns " +
+				"WHERE table_schema = current_schema() AND table_name = " + quoteSQL(table) + " ORDER BY ordinal_position"
+		},
+		hint: "Statements end with ';' and may span several lines.",
+	},
+	"mysql": {
+		complete: sqlComplete,
+		split:    splitSQL,
+		isQuery:  sqlIsQuery,
+		tables:   "SHOW TABLES",
+		schema: func(table string) string {
+			return "SHOW CREATE TABLE `" + strings.ReplaceAll(table, "`", "``") + "`"
+		},
+		hint: "Statements end with ';' and may span several lines.",
+	},
+	"mongodb": {
+		complete: bracketsBalanced,
+		split:    func(input string) []string { return []string{strings.TrimSuffix(strings.TrimSpace(input), ";")} },
+		isQuery:  func(string) bool { return true },
+		tables:   "show collections",
+		schema: func(collection string) string {
+			return "db." + collection + ".findOne()"
+		},
+		hint: "Statements may span several lines until their brackets close.",
+	},
+	"redis": {
+		complete: func(string) bool { return true },
+		split:    func(input string) []string { return []string{strings.TrimSpace(input)} },
+		isQuery:  func(string) bool { return true },
+		tables:   "KEYS *",
+		schema: func(key string) string {
+			return "TYPE " + key
+		},
+		hint: "Enter one command per line.",
+	},
+}
+
+// Console is an interactive query shell over one adapter
+type Console struct {
+	db          Queryer
+	adapter     string
+	dialect     dialect
+	in          *bufio.Scanner
+	out         io.Writer
+	history     []string
+	historyFile string
+}
+
+// NewConsole creates a console for db, speaking the dialect of adapter
+// (sqlite, postgresql, mysql, mongodb or redis)
+func NewConsole(db Queryer, adapter string, in io.Reader, out io.Writer) (*Console, error) {
+	d, ok := dialects[adapter]
+	if !ok {
+		return nil, fmt.Errorf("no console dialect for adapter '%s'", adapter)
+	}
+	return &Console{
+		db:      db,
+		adapter: adapter,
+		dialect: d,
+		in:      bufio.NewScanner(in),
+		out:     out,
+	}, nil
+}
+
+// UseHistoryFile loads previous statements from file and appends new ones
+// to it
+func (c *Console) UseHistoryFile(file string) error {
+	c.historyFile = file
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			c.history = append(c.history, strings.ReplaceAll(line, `\n`, "\n"))
+		}
+	}
+	if len(c.history) > maxHistory {
+		c.history = c.history[len(c.history)-maxHistory:]
+	}
+	return nil
+}
+
+// defaultHistoryFile is ~/.tsk_db_history, or "" without a home directory
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".tsk_db_history")
+}
+
+// Run reads statements until end of input or .quit
+func (c *Console) Run() error {
+	fmt.Fprintf(c.out, "💻 Database Console (%s)\n", c.adapter)
+	fmt.Fprintln(c.out, "Enter .help for usage hints.")
+
+	var buffer []string
+	for {
+		prompt := fmt.Sprintf("tsk(%s)> ", c.adapter)
+		if len(buffer) > 0 {
+			prompt = fmt.Sprintf("%*s> ", len(prompt)-2, "...")
+		}
+		fmt.Fprint(c.out, prompt)
+		if !c.in.Scan() {
+			fmt.Fprintln(c.out)
+			if err := c.in.Err(); err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			return nil
+		}
+		line := c.in.Text()
+
+		if len(buffer) == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, "!") {
+				recalled, err := c.recall(trimmed)
+				if err != nil {
+					fmt.Fprintf(c.out, "❌ %v\n", err)
+					continue
+				}
+				fmt.Fprintln(c.out, recalled)
+				line, trimmed = recalled, recalled
+			}
+			if strings.HasPrefix(trimmed, ".") {
+				c.remember(trimmed)
+				if quit := c.meta(trimmed); quit {
+					return nil
+				}
+				continue
+			}
+		}
+
+		buffer = append(buffer, line)
+		input := strings.Join(buffer, "\n")
+		if !c.dialect.complete(input) {
+			continue
+		}
+		buffer = nil
+		c.remember(strings.TrimSpace(input))
+		for _, stmt := range c.dialect.split(input) {
+			if stmt != "" {
+				c.run(stmt)
+			}
+		}
+	}
+}
+
+// meta runs a dot command and reports whether the console should exit
+func (c *Console) meta(line string) bool {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ".quit", ".exit":
+		return true
+	case ".help":
+		fmt.Fprintln(c.out, "📋 Commands:")
+		fmt.Fprintln(c.out, "  .tables            List tables")
+		fmt.Fprintln(c.out, "  .schema [table]    Show the schema of a table, or of every table")
+		fmt.Fprintln(c.out, "  .history           Show previous statements")
+		fmt.Fprintln(c.out, "  !n, !!             Re-run history entry n, or the last one")
+		fmt.Fprintln(c.out, "  .quit              Leave the console")
+		fmt.Fprintln(c.out, c.dialect.hint)
+	case ".tables":
+		c.run(c.dialect.tables)
+	case ".schema":
+		tables := fields[1:]
+		if len(tables) == 0 {
+			var err error
+			if tables, err = c.tableNames(); err != nil {
+				fmt.Fprintf(c.out, "❌ %v\n", err)
+				return false
+			}
+		}
+		for _, table := range tables {
+			c.run(c.dialect.schema(table))
+		}
+	case ".history":
+		for i, entry := range c.history {
+			fmt.Fprintf(c.out, "%4d  %s\n", i+1, strings.ReplaceAll(entry, "\n", "\n      "))
+		}
+	default:
+		fmt.Fprintf(c.out, "❌ Unknown command %s (try .help)\n", fields[0])
+	}
+	return false
+}
+
+// tableNames runs the dialect's table listing and returns the first column
+func (c *Console) tableNames() ([]string, error) {
+	result, err := c.db.Query(c.dialect.tables)
+	if err != nil {
+		return nil, err
+	}
+	columns := resultColumns(result)
+	var names []string
+	for _, row := range result.Rows {
+		if len(columns) > 0 {
+			names = append(names, formatCell(row[columns[0]]))
+		}
+	}
+	return names, nil
+}
+
+// run executes one statement and prints its result
+func (c *Console) run(stmt string) {
+	start := time.Now()
+	if !c.dialect.isQuery(stmt) {
+		if err := c.db.Execute(stmt); err != nil {
+			fmt.Fprintf(c.out, "❌ %v\n", err)
+			return
+		}
+		fmt.Fprintf(c.out, "✅ OK (%s)\n", time.Since(start).Round(time.Microsecond))
+		return
+	}
+	result, err := c.db.Query(stmt)
+	if err == nil && result != nil {
+		err = result.Error
+	}
+	if err != nil {
+		fmt.Fprintf(c.out, "❌ %v\n", err)
+		return
+	}
+	printTable(c.out, result)
+	rows := "rows"
+	if len(result.Rows) == 1 {
+		rows = "row"
+	}
+	fmt.Fprintf(c.out, "(%d %s, %s)\n", len(result.Rows), rows, time.Since(start).Round(time.Microsecond))
+}
+
+// remember adds a statement to the history and the history file
+func (c *Console) remember(entry string) {
+	if n := len(c.history); n > 0 && c.history[n-1] == entry {
+		return
+	}
+	c.history = append(c.history, entry)
+	if len(c.history) > maxHistory {
+		c.history = c.history[1:]
+	}
+	if c.historyFile == "" {
+		return
+	}
+	file, err := os.OpenFile(c.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, strings.ReplaceAll(entry, "\n", `\n`))
+}
+
+// recall resolves !! and !n against the history
+func (c *Console) recall(ref string) (string, error) {
+	if len(c.history) == 0 {
+		return "", fmt.Errorf("history is empty")
+	}
+	if ref == "!!" {
+		return c.history[len(c.history)-1], nil
+	}
+	n, err := strconv.Atoi(ref[1:])
+	if err != nil || n < 1 || n > len(c.history) {
+		return "", fmt.Errorf("no history entry %s", ref)
+	}
+	return c.history[n-1], nil
+}
+
+// printTable renders result as an aligned text table
+func printTable(out io.Writer, result *databasetypes.Result) {
+	columns := resultColumns(result)
+	if len(columns) == 0 {
+		return
+	}
+	widths := make([]int, len(columns))
+	cells := make([][]string, len(result.Rows))
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(column)
+	}
+	for r, row := range result.Rows {
+		cells[r] = make([]string, len(columns))
+		for i, column := range columns {
+			cell := formatCell(row[column])
+			cells[r][i] = cell
+			if w := utf8.RuneCountInString(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	separator := "+"
+	for _, w := range widths {
+		separator += strings.Repeat("-", w+2) + "+"
+	}
+	line := func(values []string) {
+		var b strings.Builder
+		b.WriteString("|")
+		for i, value := range values {
+			b.WriteString(" " + value + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value)) + " |")
+		}
+		fmt.Fprintln(out, b.String())
+	}
+	fmt.Fprintln(out, separator)
+	line(columns)
+	fmt.Fprintln(out, separator)
+	for _, row := range cells {
+		line(row)
+	}
+	fmt.Fprintln(out, separator)
+}
+
+// resultColumns returns the result's columns, or the sorted keys of its
+// first row when the adapter did not report them
+func resultColumns(result *databasetypes.Result) []string {
+	if len(result.Columns) > 0 || len(result.Rows) == 0 {
+		return result.Columns
+	}
+	columns := make([]string, 0, len(result.Rows[0]))
+	for column := range result.Rows[0] {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// formatCell renders one value on a single line, truncated to maxCellWidth
+func formatCell(value interface{}) string {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		text = "NULL"
+	case []byte:
+		text = string(v)
+	case time.Time:
+		text = v.Format(time.RFC3339)
+	default:
+		text = fmt.Sprint(v)
+	}
+	text = strings.NewReplacer("\n", `\n`, "\t", " ").Replace(text)
+	if utf8.RuneCountInString(text) > maxCellWidth {
+		text = string([]rune(text)[:maxCellWidth-1]) + "…"
+	}
+	return text
+}
+
+// sqlComplete reports whether input ends with a ';' outside quotes and
+// comments
+func sqlComplete(input string) bool {
+	_, terminated := scanSQL(input)
+	return terminated
+}
+
+// splitSQL splits input on ';' outside quotes and comments
+func splitSQL(input string) []string {
+	stmts, _ := scanSQL(input)
+	return stmts
+}
+
+// scanSQL splits input into statements, dropping -- comments, and reports
+// whether the last statement was terminated
+func scanSQL(input string) ([]string, bool) {
+	var stmts []string
+	var current strings.Builder
+	var quote rune
+	terminated := false
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			current.WriteRune('\n')
+			continue
+		case r == ';':
+			if stmt := strings.TrimSpace(current.String()); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			current.Reset()
+			terminated = true
+			continue
+		}
+		current.WriteRune(r)
+		if !unicode.IsSpace(r) {
+			terminated = false
+		}
+	}
+	if stmt := strings.TrimSpace(current.String()); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	return stmts, terminated && quote == 0
+}
+
+// sqlIsQuery reports whether a SQL statement returns rows
+func sqlIsQuery(stmt string) bool {
+	word := strings.ToUpper(strings.TrimLeft(stmt, "( \t\n"))
+	if i := strings.IndexAny(word, " \t\n("); i >= 0 {
+		word = word[:i]
+	}
+	switch word {
+	case "SELECT", "WITH", "PRAGMA", "SHOW", "EXPLAIN", "DESCRIBE", "DESC", "VALUES", "TABLE":
+		return true
+	}
+	return strings.Contains(strings.ToUpper(stmt), " RETURNING ")
+}
+
+// bracketsBalanced reports whether every bracket outside strings is closed,
+// which ends a Mongo shell statement
+func bracketsBalanced(input string) bool {
+	depth := 0
+	var quote rune
+	escaped := false
+	for _, r := range input {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(' || r == '{' || r == '[':
+			depth++
+		case r == ')' || r == '}' || r == ']':
+			depth--
+		}
+	}
+	return depth <= 0 && quote == 0 && strings.TrimSpace(input) != ""
+}
+
+// quoteSQL quotes a string literal
+func quoteSQL(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
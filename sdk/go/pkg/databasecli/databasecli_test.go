@@ -0,0 +1,522 @@
+package databasecli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/database/adapters"
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+)
+
+// sqliteDSN creates an empty SQLite database and returns its DSN
+func sqliteDSN(t *testing.T) string {
+	t.Helper()
+	return "sqlite:" + filepath.Join(t.TempDir(), "app.db")
+}
+
+// runCommand runs the db subcommand of args in dir and returns what it
+// printed to stdout
+func runCommand(t *testing.T, dir, stdin string, args ...string) (string, error) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	in, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.WriteString(stdin)
+	in.Seek(0, io.SeekStart)
+	defer in.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdinBefore, stdoutBefore := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = in, w
+	defer func() { os.Stdin, os.Stdout = stdinBefore, stdoutBefore }()
+	output := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		io.Copy(&b, r)
+		output <- b.String()
+	}()
+
+	var runErr error
+	for _, cmd := range NewDatabaseCommands().GetCommands() {
+		if cmd.Name() == args[0] {
+			cmd.SetArgs(args[1:])
+			cmd.SilenceUsage, cmd.SilenceErrors = true, true
+			runErr = cmd.Execute()
+		}
+	}
+	w.Close()
+	return <-output, runErr
+}
+
+func newSQLiteConsole(t *testing.T, input string) (*Console, *bytes.Buffer) {
+	t.Helper()
+	db := adapters.NewSQLiteAdapter()
+	if err := db.Connect(sqliteDSN(t)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	var out bytes.Buffer
+	console, err := NewConsole(db, "sqlite", strings.NewReader(input), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return console, &out
+}
+
+func TestConsoleStatements(t *testing.T) {
+	console, out := newSQLiteConsole(t, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);
+INSERT INTO users (name) VALUES ('ada'), ('semi;colon');
+-- a comment; not a statement
+SELECT name
+  FROM users
+  ORDER BY id;
+SELECT name FROM users WHERE id = 1; SELECT COUNT(*) AS n FROM users;
+SELECT * FROM missing;
+`)
+	if err := console.Run(); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"✅ OK",
+		"| semi;colon |",
+		"(2 rows,",
+		"(1 row,",
+		"| n |",
+		"❌",
+		"no such table: missing",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+	// The multi-line statement prompts for its continuation
+	if !strings.Contains(got, "...> ") {
+		t.Errorf("no continuation prompt:\n%s", got)
+	}
+}
+
+func TestConsoleMetaCommands(t *testing.T) {
+	console, out := newSQLiteConsole(t, `CREATE TABLE orders (id INTEGER PRIMARY KEY);
+CREATE TABLE users (id INTEGER PRIMARY KEY);
+.tables
+.schema users
+.frobnicate
+.quit
+SELECT 'not reached';
+`)
+	if err := console.Run(); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	if !strings.Contains(got, "| orders |") || !strings.Contains(got, "| users  |") {
+		t.Errorf(".tables did not list both tables:\n%s", got)
+	}
+	if !strings.Contains(got, "CREATE TABLE users (id INTEGER PRIMARY KEY)") {
+		t.Errorf(".schema users did not show the table:\n%s", got)
+	}
+	if !strings.Contains(got, "Unknown command .frobnicate") {
+		t.Errorf("unknown meta-command not reported:\n%s", got)
+	}
+	if strings.Contains(got, "not reached") {
+		t.Errorf(".quit did not stop the console:\n%s", got)
+	}
+}
+
+func TestConsoleHistory(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(historyFile, []byte("SELECT 'from before' AS note;\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	console, out := newSQLiteConsole(t, `!1
+SELECT 1 +
+  1 AS two;
+!!
+!9
+.history
+`)
+	if err := console.UseHistoryFile(historyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := console.Run(); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	if !strings.Contains(got, "| from before |") {
+		t.Errorf("!1 did not re-run the saved statement:\n%s", got)
+	}
+	if strings.Count(got, "| two |") != 2 {
+		t.Errorf("!! did not re-run the last statement:\n%s", got)
+	}
+	if !strings.Contains(got, "no history entry !9") {
+		t.Errorf("!9 not reported:\n%s", got)
+	}
+
+	data, err := os.ReadFile(historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Multi-line entries are saved on one line; re-runs are not repeated
+	want := "SELECT 'from before' AS note;\nSELECT 1 +\\n  1 AS two;\n.history\n"
+	if string(data) != want {
+		t.Errorf("history file = %q, want %q", data, want)
+	}
+}
+
+func TestSQLStatements(t *testing.T) {
+	for _, tt := range []struct {
+		input    string
+		complete bool
+		stmts    []string
+	}{
+		{"SELECT 1;", true, []string{"SELECT 1"}},
+		{"SELECT 1", false, []string{"SELECT 1"}},
+		{"SELECT ';'", false, []string{"SELECT ';'"}},
+		{"SELECT 1; SELECT 2;  ", true, []string{"SELECT 1", "SELECT 2"}},
+		{"SELECT 1 -- done;", false, []string{"SELECT 1"}},
+		{"SELECT \"a;b\" FROM `t;`;", true, []string{"SELECT \"a;b\" FROM `t;`"}},
+	} {
+		if got := sqlComplete(tt.input); got != tt.complete {
+			t.Errorf("sqlComplete(%q) = %v", tt.input, got)
+		}
+		if got := splitSQL(tt.input); !reflect.DeepEqual(got, tt.stmts) {
+			t.Errorf("splitSQL(%q) = %q, want %q", tt.input, got, tt.stmts)
+		}
+	}
+
+	for stmt, query := range map[string]bool{
+		"select * from t":                       true,
+		"WITH x AS (SELECT 1) SELECT * FROM x":  true,
+		"(SELECT 1)":                            true,
+		"PRAGMA table_info(t)":                  true,
+		"INSERT INTO t VALUES (1) RETURNING id": true,
+		"INSERT INTO t VALUES (1)":              false,
+		"UPDATE t SET selected = 1":             false,
+	} {
+		if got := sqlIsQuery(stmt); got != query {
+			t.Errorf("sqlIsQuery(%q) = %v", stmt, got)
+		}
+	}
+
+	for input, balanced := range map[string]bool{
+		`db.users.find({name: "a}"})`: true,
+		`db.users.find({`:             false,
+		`db.users.find({name: 'x\'`:   false,
+		"  ":                          false,
+	} {
+		if got := bracketsBalanced(input); got != balanced {
+			t.Errorf("bracketsBalanced(%q) = %v", input, got)
+		}
+	}
+}
+
+func TestFormatCell(t *testing.T) {
+	long := strings.Repeat("é", maxCellWidth+5)
+	for value, want := range map[interface{}]string{
+		nil:          "NULL",
+		"two\nlines": `two\nlines`,
+		42:           "42",
+		long:         strings.Repeat("é", maxCellWidth-1) + "…",
+	} {
+		if got := formatCell(value); got != want {
+			t.Errorf("formatCell(%v) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestNewConsoleUnknownAdapter(t *testing.T) {
+	if _, err := NewConsole(nil, "oracle", strings.NewReader(""), io.Discard); err == nil {
+		t.Error("NewConsole accepted an adapter without a dialect")
+	}
+}
+
+func TestConsoleCommand(t *testing.T) {
+	dsn := sqliteDSN(t)
+	got, err := runCommand(t, t.TempDir(), "CREATE TABLE t (v TEXT);\nINSERT INTO t VALUES ('hello');\nSELECT v FROM t;\n",
+		"console", "--adapter", "sqlite", "--dsn", dsn, "--no-history")
+	if err != nil {
+		t.Fatalf("db console: %v\n%s", err, got)
+	}
+	if !strings.Contains(got, "tsk(sqlite)> ") || !strings.Contains(got, "| hello |") {
+		t.Errorf("db console output:\n%s", got)
+	}
+
+	if _, err := runCommand(t, t.TempDir(), "", "console", "--adapter", "sqlite"); err == nil ||
+		!strings.Contains(err.Error(), "pass --dsn") {
+		t.Errorf("db console without a connection = %v", err)
+	}
+}
+
+// writeFiles creates files under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	dir := t.TempDir()
+	dsn := sqliteDSN(t)
+	writeFiles(t, dir, map[string]string{
+		"migrations/20250101000000_users.up.sql":   "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);",
+		"migrations/20250101000000_users.down.sql": "DROP TABLE users;",
+		"migrations/20250102000000_email.sql":      "-- +up\nALTER TABLE users ADD COLUMN email TEXT;\n-- +down\nALTER TABLE users DROP COLUMN email;\n",
+	})
+	migrate := func(args ...string) string {
+		t.Helper()
+		got, err := runCommand(t, dir, "", append([]string{"migrate"}, append(args, "--adapter", "sqlite", "--dsn", dsn)...)...)
+		if err != nil {
+			t.Fatalf("db migrate %v: %v\n%s", args, err, got)
+		}
+		return got
+	}
+	columns := func() string {
+		db := adapters.NewSQLiteAdapter()
+		if err := db.Connect(dsn); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		result, err := db.Query("SELECT group_concat(name) AS columns FROM pragma_table_info('users')")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return formatCell(result.Rows[0]["columns"])
+	}
+
+	if got := migrate("up", "--dry-run"); !strings.Contains(got, "2 migrations would run") ||
+		!strings.Contains(got, "ALTER TABLE users ADD COLUMN email TEXT;") {
+		t.Errorf("dry run:\n%s", got)
+	}
+	if got := columns(); got != "NULL" {
+		t.Fatalf("dry run changed the database: columns %s", got)
+	}
+
+	if got := migrate("up", "--steps", "1"); !strings.Contains(got, "1 migrations completed") {
+		t.Errorf("up --steps 1:\n%s", got)
+	}
+	if got := migrate("status"); !strings.Contains(got, "✅ 20250101000000_users") ||
+		!strings.Contains(got, "⏳ 20250102000000_email") || !strings.Contains(got, "2 migrations, 1 pending") {
+		t.Errorf("status:\n%s", got)
+	}
+	if got := migrate(); !strings.Contains(got, "1 migrations completed") {
+		t.Errorf("migrate:\n%s", got)
+	}
+	if got := columns(); got != "id,name,email" {
+		t.Errorf("after up, users has columns %s", got)
+	}
+	if got := migrate("up"); !strings.Contains(got, "Nothing to migrate") {
+		t.Errorf("second up:\n%s", got)
+	}
+
+	if got := migrate("down"); !strings.Contains(got, "⬇️  20250102000000") {
+		t.Errorf("down:\n%s", got)
+	}
+	if got := columns(); got != "id,name" {
+		t.Errorf("after down, users has columns %s", got)
+	}
+	migrate("redo")
+	if got := columns(); got != "id,name" {
+		t.Errorf("after redo, users has columns %s", got)
+	}
+	migrate("down", "--version", "0")
+	if got := columns(); got != "NULL" {
+		t.Errorf("after down to 0, users has columns %s", got)
+	}
+
+	writeFiles(t, dir, map[string]string{"migrations/20250103000000_broken.sql": "-- +up\nCREATE TABLE;\n-- +down\n"})
+	if got, err := runCommand(t, dir, "", "migrate", "--adapter", "sqlite", "--dsn", dsn); err == nil {
+		t.Errorf("a failing migration did not fail the command:\n%s", got)
+	}
+}
+
+func TestBackupRestoreCommands(t *testing.T) {
+	dir := t.TempDir()
+	dsn := sqliteDSN(t)
+	db := adapters.NewSQLiteAdapter()
+	if err := db.Connect(dsn); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Execute("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Execute("INSERT INTO users (name) VALUES ('ada'), ('grace')"); err != nil {
+		t.Fatal(err)
+	}
+	count := func() string {
+		t.Helper()
+		result, err := db.Query("SELECT COUNT(*) AS n FROM users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return formatCell(result.Rows[0]["n"])
+	}
+
+	backup := filepath.Join(dir, "app.bak")
+	got, err := runCommand(t, dir, "", "backup", backup, "--dsn", dsn)
+	if err != nil {
+		t.Fatalf("db backup: %v\n%s", err, got)
+	}
+	if !strings.Contains(got, "Adapter: sqlite") || !strings.Contains(got, "Backup created successfully") {
+		t.Errorf("db backup output:\n%s", got)
+	}
+	if _, err := os.Stat(backup + ".sha256"); err != nil {
+		t.Errorf("no checksum file: %v", err)
+	}
+
+	if err := db.Execute("DELETE FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	// Declining the confirmation leaves the database alone
+	if got, err := runCommand(t, dir, "n\n", "restore", backup, "--dsn", dsn); err != nil || !strings.Contains(got, "Restore cancelled") {
+		t.Errorf("declined restore = %v\n%s", err, got)
+	}
+	if n := count(); n != "0" {
+		t.Errorf("declined restore left %s rows", n)
+	}
+	got, err = runCommand(t, dir, "y\n", "restore", backup, "--dsn", dsn)
+	if err != nil {
+		t.Fatalf("db restore: %v\n%s", err, got)
+	}
+	if !strings.Contains(got, "Checksum verified") || !strings.Contains(got, "restored successfully") {
+		t.Errorf("db restore output:\n%s", got)
+	}
+	if n := count(); n != "2" {
+		t.Errorf("restore left %s rows, want 2", n)
+	}
+
+	// A corrupted backup is refused before the database is touched
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(backup, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Execute("DELETE FROM users WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := runCommand(t, dir, "", "restore", backup, "--dsn", dsn, "--force"); err == nil ||
+		!strings.Contains(err.Error(), "failed verification") {
+		t.Errorf("restore of a corrupted backup = %v\n%s", err, got)
+	}
+	if n := count(); n != "1" {
+		t.Errorf("refused restore left %s rows, want 1", n)
+	}
+}
+
+func TestStatusCommandJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"peanu.tsk": `[database]
+sqlite.max_open: 4
+sqlite.conn_max_lifetime: "10m"
+sqlite.retry.attempts: 2
+sqlite.retry.backoff: "5ms"
+`})
+	got, err := runCommand(t, dir, "", "status", "--adapter", "sqlite", "--dsn", sqliteDSN(t), "--json")
+	if err != nil {
+		t.Fatalf("db status: %v\n%s", err, got)
+	}
+	var report []struct {
+		Adapter   string                        `json:"adapter"`
+		Connected bool                          `json:"connected"`
+		Ping      string                        `json:"ping"`
+		Pool      *databasetypes.ConnectionPool `json:"pool"`
+		Stats     *poolStats                    `json:"stats"`
+	}
+	if err := json.Unmarshal([]byte(got), &report); err != nil {
+		t.Fatalf("db status --json printed invalid JSON: %v\n%s", err, got)
+	}
+	if len(report) != 1 || report[0].Adapter != "sqlite" || !report[0].Connected || report[0].Ping != "ok" {
+		t.Fatalf("report = %+v", report)
+	}
+	want := databasetypes.ConnectionPool{MaxOpenConnections: 4, ConnMaxLifetime: 10 * time.Minute, MaxRetries: 2, RetryDelay: 5 * time.Millisecond}
+	if pool := report[0].Pool; pool == nil || *pool != want {
+		t.Errorf("pool = %+v, want %+v", pool, want)
+	}
+	// The live pool shows the configured limit
+	if stats := report[0].Stats; stats == nil || stats.MaxOpenConnections != 4 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	writeFiles(t, dir, map[string]string{"peanu.tsk": "[database]\nsqlite.max_open: \"lots\"\n"})
+	if _, err := runCommand(t, dir, "", "status", "--json"); err == nil || !strings.Contains(err.Error(), "sqlite.max_open") {
+		t.Errorf("invalid pool setting = %v", err)
+	}
+}
+
+func TestAnalyzeCommand(t *testing.T) {
+	dir := t.TempDir()
+	dsn := sqliteDSN(t)
+	writeFiles(t, dir, map[string]string{"peanu.tsk": `[database]
+query_log.file: "queries.jsonl"
+query_log.slow: "1h"
+`})
+	if got, err := runCommand(t, dir, "", "analyze"); err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("db analyze before any query = %v\n%s", err, got)
+	}
+
+	// Statements run through the console are logged
+	_, err := runCommand(t, dir, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);
+INSERT INTO users (name) VALUES ('ada');
+SELECT * FROM users WHERE id = 1;
+SELECT * FROM users WHERE id = 2;
+SELECT * FROM orders;
+`, "console", "--adapter", "sqlite", "--dsn", dsn, "--no-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := runCommand(t, dir, "", "analyze", "--table", "users")
+	if err != nil {
+		t.Fatalf("db analyze: %v\n%s", err, got)
+	}
+	for _, want := range []string{
+		"5 queries logged",
+		"SELECT * FROM users WHERE id = ?",
+		"runs=2 slow=0 errors=0",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("db analyze lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "orders") {
+		t.Errorf("--table users kept other tables:\n%s", got)
+	}
+	if got, err := runCommand(t, dir, "", "analyze", "--slow"); err != nil || !strings.Contains(got, "No matching queries") {
+		t.Errorf("db analyze --slow = %v\n%s", err, got)
+	}
+
+	// --log reads another log, whatever the configuration says
+	writeFiles(t, dir, map[string]string{"other.jsonl": `{"adapter":"mysql","query":"SELECT * FROM carts WHERE id = 9","duration":2000000000,"slow":true}` + "\n"})
+	got, err = runCommand(t, dir, "", "analyze", "--log", "other.jsonl", "--slow")
+	if err != nil || !strings.Contains(got, "🐢 1. SELECT * FROM carts WHERE id = ?") {
+		t.Errorf("db analyze --log = %v\n%s", err, got)
+	}
+}
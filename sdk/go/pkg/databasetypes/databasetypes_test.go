@@ -0,0 +1,365 @@
+package databasetypes
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestPoolFromConfig(t *testing.T) {
+	pool, ok, err := PoolFromConfig(map[string]interface{}{
+		"postgresql.max_open":           20,
+		"postgresql.max_idle":           "5",
+		"postgresql.conn_max_lifetime":  "30m",
+		"postgresql.conn_max_idle_time": 90,
+		"postgresql.retry.attempts":     3,
+		"postgresql.retry.backoff":      "100ms",
+		"postgresql.retry.max_backoff":  "1s",
+		"mysql.max_open":                99,
+	}, "postgresql")
+	want := ConnectionPool{
+		MaxOpenConnections: 20,
+		MaxIdleConnections: 5,
+		ConnMaxLifetime:    30 * time.Minute,
+		ConnMaxIdleTime:    90 * time.Second,
+		MaxRetries:         3,
+		RetryDelay:         100 * time.Millisecond,
+		RetryMaxDelay:      time.Second,
+	}
+	if err != nil || !ok || pool != want {
+		t.Errorf("PoolFromConfig() = %+v, %v, %v; want %+v", pool, ok, err, want)
+	}
+
+	if _, ok, _ := PoolFromConfig(map[string]interface{}{"mysql.max_open": 1}, "sqlite"); ok {
+		t.Error("PoolFromConfig() without settings should report false")
+	}
+	for _, bad := range []map[string]interface{}{
+		{"sqlite.max_open": "lots"},
+		{"sqlite.max_idle": -1},
+		{"sqlite.retry.backoff": "soon"},
+	} {
+		if _, _, err := PoolFromConfig(bad, "sqlite"); err == nil {
+			t.Errorf("PoolFromConfig(%v) should fail", bad)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	pool := ConnectionPool{MaxRetries: 4, RetryDelay: 100 * time.Millisecond, RetryMaxDelay: 300 * time.Millisecond}
+
+	var waits []time.Duration
+	calls := 0
+	err := pool.retry(func() error {
+		calls++
+		if calls < 4 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, func(d time.Duration) { waits = append(waits, d) })
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	if err != nil || !reflect.DeepEqual(waits, want) {
+		t.Errorf("retry() = %v with waits %v; want waits %v", err, waits, want)
+	}
+
+	calls = 0
+	refused := errors.New("connection refused")
+	err = pool.retry(func() error { calls++; return refused }, func(time.Duration) {})
+	if !errors.Is(err, refused) || calls != 5 {
+		t.Errorf("retry() = %v after %d calls; want the last error after 5", err, calls)
+	}
+}
+
+func openStmtCache(t *testing.T, capacity int) *StmtCache {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "stmts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewStmtCache(db, capacity)
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+// names runs a parameterized query through the cache
+func names(t *testing.T, cache *StmtCache, query string, args ...interface{}) []string {
+	t.Helper()
+	rows, err := cache.Query(query, args...)
+	if err != nil {
+		t.Fatalf("Query(%q) returned error: %v", query, err)
+	}
+	defer rows.Close()
+	var result []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, name)
+	}
+	return result
+}
+
+func TestStmtCache(t *testing.T) {
+	cache := openStmtCache(t, 2)
+	for i, name := range []string{"ada", "bob", "cy"} {
+		if _, err := cache.Exec("INSERT INTO users (id, name) VALUES (?, ?)", i+1, name); err != nil {
+			t.Fatalf("Exec() returned error: %v", err)
+		}
+	}
+	if got := names(t, cache, "SELECT name FROM users WHERE id > ? ORDER BY id", 1); !reflect.DeepEqual(got, []string{"bob", "cy"}) {
+		t.Errorf("names = %v", got)
+	}
+	// Statements without arguments are not cached
+	if got := names(t, cache, "SELECT name FROM users WHERE id = 1"); !reflect.DeepEqual(got, []string{"ada"}) {
+		t.Errorf("names = %v", got)
+	}
+
+	want := StmtCacheStats{Size: 2, Capacity: 2, Hits: 2, Misses: 2}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats() = %+v; want %+v", got, want)
+	}
+
+	// A third statement evicts the least recently used, the INSERT
+	names(t, cache, "SELECT name FROM users WHERE name = ?", "ada")
+	names(t, cache, "SELECT name FROM users WHERE id > ? ORDER BY id", 2)
+	if _, err := cache.Exec("INSERT INTO users (id, name) VALUES (?, ?)", 4, "dee"); err != nil {
+		t.Fatal(err)
+	}
+	want = StmtCacheStats{Size: 2, Capacity: 2, Hits: 3, Misses: 4, Evictions: 2}
+	if got := cache.Stats(); got != want {
+		t.Errorf("after evictions Stats() = %+v; want %+v", got, want)
+	}
+}
+
+func TestStmtCacheReprepares(t *testing.T) {
+	cache := openStmtCache(t, 8)
+	query := "SELECT name FROM users WHERE id = ?"
+	cache.Exec("INSERT INTO users (id, name) VALUES (?, ?)", 1, "ada")
+	names(t, cache, query, 1)
+
+	// A statement lost with its connection is prepared again
+	cache.stmts[query].Value.(*cachedStmt).stmt.Close()
+	if got := names(t, cache, query, 1); !reflect.DeepEqual(got, []string{"ada"}) {
+		t.Errorf("names = %v", got)
+	}
+	if stats := cache.Stats(); stats.Reprepares != 1 || stats.Size != 2 {
+		t.Errorf("Stats() = %+v; want one re-preparation", stats)
+	}
+}
+
+func TestStmtCacheConcurrent(t *testing.T) {
+	cache := openStmtCache(t, 1)
+	cache.Exec("INSERT INTO users (id, name) VALUES (?, ?)", 1, "ada")
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Two statements through a cache of one keep evicting each other
+			query := "SELECT name FROM users WHERE id = ?"
+			if i%2 == 0 {
+				query = "SELECT name FROM users WHERE id >= ?"
+			}
+			rows, err := cache.Query(query, 1)
+			if err != nil {
+				errs <- err
+				return
+			}
+			rows.Close()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent Query() returned error: %v", err)
+	}
+}
+
+func TestStmtCacheDisabled(t *testing.T) {
+	cache := openStmtCache(t, 0)
+	if _, err := cache.Exec("INSERT INTO users (id, name) VALUES (?, ?)", 1, "ada"); err != nil {
+		t.Fatal(err)
+	}
+	names(t, cache, "SELECT name FROM users WHERE id = ?", 1)
+	if stats := cache.Stats(); stats.Size != 0 || stats.Misses != 0 {
+		t.Errorf("a disabled cache should prepare nothing: %+v", stats)
+	}
+}
+
+func TestReplicasFromConfig(t *testing.T) {
+	cfg, ok, err := ReplicasFromConfig(map[string]interface{}{
+		"postgresql.replicas":        []interface{}{"postgres://app:secret@r1/app", "postgres://app:secret@r2/app"},
+		"postgresql.balance":         "least-latency",
+		"postgresql.health_interval": "5s",
+	}, "postgresql")
+	want := ReplicaConfig{
+		DSNs:           []string{"postgres://app:secret@r1/app", "postgres://app:secret@r2/app"},
+		Balance:        BalanceLeastLatency,
+		HealthInterval: 5 * time.Second,
+	}
+	if err != nil || !ok || !reflect.DeepEqual(cfg, want) {
+		t.Errorf("ReplicasFromConfig() = %+v, %v, %v; want %+v", cfg, ok, err, want)
+	}
+
+	if _, ok, err := ReplicasFromConfig(map[string]interface{}{"mysql.max_open": 5}, "mysql"); ok || err != nil {
+		t.Errorf("without replicas got ok=%v err=%v", ok, err)
+	}
+	if _, _, err := ReplicasFromConfig(map[string]interface{}{"mysql.replicas": "r1", "mysql.balance": "random"}, "mysql"); err == nil {
+		t.Error("an unknown balance should be rejected")
+	}
+}
+
+// fakeConn is a replica that answers with its name
+type fakeConn struct {
+	name string
+
+	mu      sync.Mutex
+	down    bool
+	queries int
+}
+
+func (f *fakeConn) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *fakeConn) Connect(dsn string) error { return f.Ping() }
+func (f *fakeConn) Disconnect() error        { return nil }
+
+func (f *fakeConn) Ping() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (f *fakeConn) Query(query string, args ...interface{}) (*Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return nil, errors.New("bad connection")
+	}
+	f.queries++
+	return &Result{Rows: []map[string]interface{}{{"server": f.name}}}, nil
+}
+
+func (f *fakeConn) QueryRow(query string, args ...interface{}) (*Row, error) {
+	return nil, errors.New("not implemented")
+}
+
+func server(t *testing.T, rs *ReplicaSet, query string) string {
+	t.Helper()
+	result, err := rs.Query(query)
+	if err != nil {
+		t.Fatalf("Query(%q) returned error: %v", query, err)
+	}
+	return result.Rows[0]["server"].(string)
+}
+
+func TestReplicaSetRouting(t *testing.T) {
+	primary, r1, r2 := &fakeConn{name: "primary"}, &fakeConn{name: "r1"}, &fakeConn{name: "r2"}
+	rs := NewReplicaSet(primary, ReplicaConfig{DSNs: []string{"mysql://r1", "mysql://r2"}, Balance: BalanceRoundRobin}, []ReplicaConn{r1, r2})
+	rs.CheckHealth()
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, server(t, rs, "SELECT * FROM users"))
+	}
+	if !reflect.DeepEqual(got, []string{"r1", "r2", "r1", "r2"}) {
+		t.Errorf("round-robin reads went to %v", got)
+	}
+	for _, query := range []string{
+		"INSERT INTO users (name) VALUES ('ada') RETURNING id",
+		"SELECT * FROM users FOR UPDATE",
+		"WITH moved AS (DELETE FROM queue RETURNING *) SELECT * FROM moved",
+		"PRAGMA table_info(users)",
+	} {
+		if got := server(t, rs, query); got != "primary" {
+			t.Errorf("%q went to %s; want the primary", query, got)
+		}
+	}
+
+	// A replica that stops answering fails over, then rejoins once healthy
+	r1.setDown(true)
+	got = nil
+	for i := 0; i < 3; i++ {
+		got = append(got, server(t, rs, "SELECT 1"))
+	}
+	if !reflect.DeepEqual(got, []string{"r2", "r2", "r2"}) {
+		t.Errorf("reads with r1 down went to %v", got)
+	}
+	status := rs.Status()
+	if status[0].Healthy || status[0].Failovers != 1 || status[0].LastError == "" || !status[1].Healthy {
+		t.Errorf("Status() = %+v", status)
+	}
+
+	r2.setDown(true)
+	rs.CheckHealth()
+	if got := server(t, rs, "SELECT 1"); got != "primary" {
+		t.Errorf("with every replica down reads went to %s; want the primary", got)
+	}
+
+	r1.setDown(false)
+	rs.CheckHealth()
+	if got := server(t, rs, "SELECT 1"); got != "r1" {
+		t.Errorf("after recovery reads went to %s; want r1", got)
+	}
+}
+
+func TestReplicaSetLeastLatency(t *testing.T) {
+	r1, r2 := &fakeConn{name: "r1"}, &fakeConn{name: "r2"}
+	rs := NewReplicaSet(&fakeConn{name: "primary"}, ReplicaConfig{DSNs: []string{"r1", "r2"}, Balance: BalanceLeastLatency}, []ReplicaConn{r1, r2})
+	rs.CheckHealth()
+	rs.replicas[0].status.Latency = 20 * time.Millisecond
+	rs.replicas[1].status.Latency = 2 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		if got := server(t, rs, "SELECT 1"); got != "r2" {
+			t.Errorf("read %d went to %s; want the faster r2", i, got)
+		}
+	}
+}
+
+func TestReplicaSetHealthLoop(t *testing.T) {
+	r1 := &fakeConn{name: "r1", down: true}
+	rs := NewReplicaSet(&fakeConn{name: "primary"}, ReplicaConfig{DSNs: []string{"r1"}, HealthInterval: time.Millisecond}, []ReplicaConn{r1})
+	rs.Start()
+	defer rs.Close()
+	if rs.Status()[0].Healthy {
+		t.Fatal("a replica that is down should start unhealthy")
+	}
+	r1.setDown(false)
+	deadline := time.Now().Add(2 * time.Second)
+	for !rs.Status()[0].Healthy {
+		if time.Now().After(deadline) {
+			t.Fatal("the health loop never noticed the replica recover")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := map[string]string{
+		"postgres://app:secret@db/app": "postgres://app:xxxxx@db/app",
+		"app:secret@tcp(db:3306)/app":  "app:xxxxx@tcp(db:3306)/app",
+		"sqlite:./app.db":              "sqlite:./app.db",
+	}
+	for in, want := range tests {
+		if got := RedactDSN(in); got != want {
+			t.Errorf("RedactDSN(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package databasetypes
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// PoolFromConfig reads an adapter's pool and retry settings from flattened
+// configuration under prefix, such as database.postgresql: max_open,
+// max_idle, conn_max_lifetime, conn_max_idle_time, and retry.attempts,
+// retry.backoff and retry.max_backoff. Durations are "30s"-style strings or
+// seconds. ok is false when none of the keys is set.
+func PoolFromConfig(values map[string]interface{}, prefix string) (pool ConnectionPool, ok bool, err error) {
+	ints := []struct {
+		key    string
+		target *int
+	}{
+		{"max_open", &pool.MaxOpenConnections},
+		{"max_idle", &pool.MaxIdleConnections},
+		{"retry.attempts", &pool.MaxRetries},
+	}
+	for _, setting := range ints {
+		value, found := values[prefix+"."+setting.key]
+		if !found {
+			continue
+		}
+		n, err := poolInt(value)
+		if err != nil {
+			return pool, false, fmt.Errorf("invalid %s.%s: %w", prefix, setting.key, err)
+		}
+		*setting.target = n
+		ok = true
+	}
+
+	durations := []struct {
+		key    string
+		target *time.Duration
+	}{
+		{"conn_max_lifetime", &pool.ConnMaxLifetime},
+		{"conn_max_idle_time", &pool.ConnMaxIdleTime},
+		{"retry.backoff", &pool.RetryDelay},
+		{"retry.max_backoff", &pool.RetryMaxDelay},
+	}
+	for _, setting := range durations {
+		value, found := values[prefix+"."+setting.key]
+		if !found {
+			continue
+		}
+		d, err := poolDuration(value)
+		if err != nil {
+			return pool, false, fmt.Errorf("invalid %s.%s: %w", prefix, setting.key, err)
+		}
+		*setting.target = d
+		ok = true
+	}
+	return pool, ok, nil
+}
+
+// poolInt reads a non-negative count
+func poolInt(value interface{}) (int, error) {
+	var n int
+	switch v := value.(type) {
+	case int:
+		n = v
+	case int64:
+		n = int(v)
+	case float64:
+		n = int(v)
+	case string:
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		n = parsed
+	default:
+		return 0, fmt.Errorf("%v is not a number", value)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%d is negative", n)
+	}
+	return n, nil
+}
+
+// poolDuration reads a duration string or a number of seconds
+func poolDuration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case string:
+		if seconds, err := strconv.Atoi(v); err == nil {
+			return time.Duration(seconds) * time.Second, nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a duration", v)
+		}
+		return d, nil
+	}
+	return 0, fmt.Errorf("%v is not a duration", value)
+}
+
+// Backoff returns the wait before retry number attempt (starting at 1): the
+// retry delay, doubled on every further attempt and capped at RetryMaxDelay
+func (p ConnectionPool) Backoff(attempt int) time.Duration {
+	delay := p.RetryDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.RetryMaxDelay > 0 && delay >= p.RetryMaxDelay {
+			return p.RetryMaxDelay
+		}
+	}
+	if p.RetryMaxDelay > 0 && delay > p.RetryMaxDelay {
+		return p.RetryMaxDelay
+	}
+	return delay
+}
+
+// Retry calls connect until it succeeds, retrying up to MaxRetries times
+// with Backoff between attempts. It returns the last error.
+func (p ConnectionPool) Retry(connect func() error) error {
+	return p.retry(connect, time.Sleep)
+}
+
+func (p ConnectionPool) retry(connect func() error, sleep func(time.Duration)) error {
+	err := connect()
+	for attempt := 1; err != nil && attempt <= p.MaxRetries; attempt++ {
+		sleep(p.Backoff(attempt))
+		err = connect()
+	}
+	if err != nil && p.MaxRetries > 0 {
+		return fmt.Errorf("giving up after %d retries: %w", p.MaxRetries, err)
+	}
+	return err
+}
@@ -0,0 +1,337 @@
+package databasetypes
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Balancing strategies for read replicas
+const (
+	BalanceRoundRobin   = "round-robin"
+	BalanceLeastLatency = "least-latency"
+)
+
+// DefaultHealthInterval is how often replicas are pinged
+const DefaultHealthInterval = 10 * time.Second
+
+// ReplicaConfig lists an adapter's read replicas and how reads are spread
+// over them
+type ReplicaConfig struct {
+	DSNs           []string      `json:"dsns"`
+	Balance        string        `json:"balance"`
+	HealthInterval time.Duration `json:"health_interval"`
+}
+
+// ReplicasFromConfig reads an adapter's replica settings from flattened
+// configuration under prefix: replicas (a DSN or a list of them), balance
+// (round-robin or least-latency) and health_interval. ok is false when no
+// replicas are configured.
+func ReplicasFromConfig(values map[string]interface{}, prefix string) (cfg ReplicaConfig, ok bool, err error) {
+	switch v := values[prefix+".replicas"].(type) {
+	case nil:
+		return cfg, false, nil
+	case string:
+		cfg.DSNs = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			dsn, isString := item.(string)
+			if !isString || dsn == "" {
+				return cfg, false, fmt.Errorf("invalid %s.replicas: %v is not a connection string", prefix, item)
+			}
+			cfg.DSNs = append(cfg.DSNs, dsn)
+		}
+	default:
+		return cfg, false, fmt.Errorf("invalid %s.replicas: %v is not a list of connection strings", prefix, v)
+	}
+
+	cfg.Balance = BalanceRoundRobin
+	if balance, found := values[prefix+".balance"]; found {
+		cfg.Balance = fmt.Sprint(balance)
+		if cfg.Balance != BalanceRoundRobin && cfg.Balance != BalanceLeastLatency {
+			return cfg, false, fmt.Errorf("invalid %s.balance: %q is not %s or %s", prefix, cfg.Balance, BalanceRoundRobin, BalanceLeastLatency)
+		}
+	}
+
+	cfg.HealthInterval = DefaultHealthInterval
+	if interval, found := values[prefix+".health_interval"]; found {
+		if cfg.HealthInterval, err = poolDuration(interval); err != nil {
+			return cfg, false, fmt.Errorf("invalid %s.health_interval: %w", prefix, err)
+		}
+	}
+	return cfg, len(cfg.DSNs) > 0, nil
+}
+
+// ReplicaConn is the part of an adapter replica routing needs
+type ReplicaConn interface {
+	Connect(dsn string) error
+	Disconnect() error
+	Ping() error
+	Query(query string, args ...interface{}) (*Result, error)
+	QueryRow(query string, args ...interface{}) (*Row, error)
+}
+
+// ReplicaStatus is one replica's health as last seen
+type ReplicaStatus struct {
+	// DSN is the connection string with its password masked
+	DSN       string        `json:"dsn"`
+	Healthy   bool          `json:"healthy"`
+	Latency   time.Duration `json:"latency"`
+	Queries   int64         `json:"queries"`
+	Failovers int64         `json:"failovers"`
+	LastError string        `json:"last_error,omitempty"`
+	LastCheck time.Time     `json:"last_check"`
+}
+
+type replica struct {
+	dsn  string
+	conn ReplicaConn
+	// guarded by ReplicaSet.mu
+	status ReplicaStatus
+}
+
+// ReplicaSet sends reads to healthy replicas and everything else to the
+// primary. Replicas are pinged every health interval: a replica that fails
+// its ping, or fails a query and then its ping, is taken out of rotation
+// until a later check reconnects it. With no healthy replica, reads go to
+// the primary.
+type ReplicaSet struct {
+	primary  ReplicaConn
+	replicas []*replica
+	balance  string
+	interval time.Duration
+
+	mu   sync.Mutex
+	next int
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReplicaSet routes the reads of primary to replicas, which are already
+// connected or are connected by the first health check
+func NewReplicaSet(primary ReplicaConn, cfg ReplicaConfig, replicas []ReplicaConn) *ReplicaSet {
+	rs := &ReplicaSet{primary: primary, balance: cfg.Balance, interval: cfg.HealthInterval}
+	if rs.interval <= 0 {
+		rs.interval = DefaultHealthInterval
+	}
+	for i, conn := range replicas {
+		rs.replicas = append(rs.replicas, &replica{dsn: cfg.DSNs[i], conn: conn, status: ReplicaStatus{DSN: RedactDSN(cfg.DSNs[i])}})
+	}
+	return rs
+}
+
+// Start checks every replica now and then on every health interval, until
+// Close
+func (rs *ReplicaSet) Start() {
+	rs.CheckHealth()
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.stop != nil {
+		return
+	}
+	rs.stop, rs.done = make(chan struct{}), make(chan struct{})
+	go rs.watch(rs.stop, rs.done)
+}
+
+func (rs *ReplicaSet) watch(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			rs.CheckHealth()
+		}
+	}
+}
+
+// CheckHealth pings every replica, reconnecting the unhealthy ones, and
+// records their latency
+func (rs *ReplicaSet) CheckHealth() {
+	var wg sync.WaitGroup
+	for _, r := range rs.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			start := time.Now()
+			err := r.conn.Ping()
+			if err != nil {
+				// Reconnecting covers replicas that were down at Connect
+				if err = r.conn.Connect(r.dsn); err == nil {
+					start = time.Now()
+					err = r.conn.Ping()
+				}
+			}
+			latency := time.Since(start)
+
+			rs.mu.Lock()
+			defer rs.mu.Unlock()
+			r.status.LastCheck = time.Now()
+			if err != nil {
+				r.status.Healthy = false
+				r.status.LastError = err.Error()
+				return
+			}
+			r.status.Healthy = true
+			r.status.LastError = ""
+			if r.status.Latency == 0 {
+				r.status.Latency = latency
+			} else {
+				// Smooth out one-off spikes
+				r.status.Latency = (3*r.status.Latency + latency) / 4
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+// Query runs a read on a replica and anything else on the primary. A
+// replica that fails and no longer answers pings is marked unhealthy and
+// the query is retried on the next candidate.
+func (rs *ReplicaSet) Query(query string, args ...interface{}) (*Result, error) {
+	var result *Result
+	err := rs.route(query, func(conn ReplicaConn) (err error) {
+		result, err = conn.Query(query, args...)
+		return err
+	})
+	return result, err
+}
+
+// QueryRow runs a single-row read like Query
+func (rs *ReplicaSet) QueryRow(query string, args ...interface{}) (*Row, error) {
+	var row *Row
+	err := rs.route(query, func(conn ReplicaConn) (err error) {
+		row, err = conn.QueryRow(query, args...)
+		return err
+	})
+	return row, err
+}
+
+func (rs *ReplicaSet) route(query string, fn func(conn ReplicaConn) error) error {
+	if !readOnly(query) {
+		return fn(rs.primary)
+	}
+	tried := make(map[*replica]bool)
+	for {
+		r := rs.pick(tried)
+		if r == nil {
+			return fn(rs.primary)
+		}
+		tried[r] = true
+		err := fn(r.conn)
+		if err == nil {
+			rs.mu.Lock()
+			r.status.Queries++
+			rs.mu.Unlock()
+			return nil
+		}
+		if pingErr := r.conn.Ping(); pingErr == nil {
+			// The replica is fine; the query itself failed
+			return err
+		}
+		rs.mu.Lock()
+		r.status.Healthy = false
+		r.status.Failovers++
+		r.status.LastError = err.Error()
+		rs.mu.Unlock()
+	}
+}
+
+// pick chooses a healthy replica not tried yet, or nil
+func (rs *ReplicaSet) pick(tried map[*replica]bool) *replica {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	var best *replica
+	for i := range rs.replicas {
+		r := rs.replicas[(rs.next+i)%len(rs.replicas)]
+		if !r.status.Healthy || tried[r] {
+			continue
+		}
+		if rs.balance != BalanceLeastLatency {
+			best = r
+			break
+		}
+		if best == nil || r.status.Latency < best.status.Latency {
+			best = r
+		}
+	}
+	if len(rs.replicas) > 0 {
+		rs.next = (rs.next + 1) % len(rs.replicas)
+	}
+	return best
+}
+
+// Status returns every replica's health as last seen
+func (rs *ReplicaSet) Status() []ReplicaStatus {
+	if rs == nil {
+		return nil
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	statuses := make([]ReplicaStatus, len(rs.replicas))
+	for i, r := range rs.replicas {
+		statuses[i] = r.status
+	}
+	return statuses
+}
+
+// Balance returns the balancing strategy
+func (rs *ReplicaSet) Balance() string {
+	return rs.balance
+}
+
+// Close stops the health checks and disconnects the replicas
+func (rs *ReplicaSet) Close() error {
+	if rs == nil {
+		return nil
+	}
+	rs.mu.Lock()
+	stop, done := rs.stop, rs.done
+	rs.stop, rs.done = nil, nil
+	rs.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	var errs []error
+	for _, r := range rs.replicas {
+		if err := r.conn.Disconnect(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeKeyword finds statements that write or lock rows
+var writeKeyword = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|MERGE|REPLACE|RETURNING|FOR\s+UPDATE|FOR\s+SHARE|LOCK\s+IN\s+SHARE\s+MODE|NEXTVAL|SETVAL)\b`)
+
+// readOnly reports whether a statement can run on a replica
+func readOnly(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "WITH", "SHOW", "EXPLAIN", "DESCRIBE":
+		return !writeKeyword.MatchString(query)
+	}
+	return false
+}
+
+// mysqlCredentials matches the user:password@ of a MySQL-style DSN
+var mysqlCredentials = regexp.MustCompile(`^([^:@/]+):[^@]*@`)
+
+// RedactDSN masks the password of a connection string
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return mysqlCredentials.ReplaceAllString(dsn, "$1:xxxxx@")
+}
@@ -0,0 +1,212 @@
+package databasetypes
+
+import (
+	"container/list"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// DefaultStmtCacheSize is how many prepared statements adapters keep
+const DefaultStmtCacheSize = 256
+
+// StmtCacheAdapter is implemented by adapters that cache prepared statements
+type StmtCacheAdapter interface {
+	// SetStmtCacheSize sets how many statements are kept; 0 disables the
+	// cache. It takes effect on the next Connect.
+	SetStmtCacheSize(n int)
+}
+
+// StmtCacheStats counts what the statement cache did
+type StmtCacheStats struct {
+	Size       int   `json:"size"`
+	Capacity   int   `json:"capacity"`
+	Hits       int64 `json:"hits"`
+	Misses     int64 `json:"misses"`
+	Reprepares int64 `json:"reprepares"`
+	Evictions  int64 `json:"evictions"`
+}
+
+// StmtCache keeps prepared statements keyed by their SQL text, evicting the
+// least recently used beyond its capacity. Only parameterized statements
+// are prepared: SQL without arguments tends to embed its values, so it
+// would churn the cache, and may hold several statements, which a prepared
+// statement cannot. A statement that fails because its connection was
+// reset or it went stale is prepared again and retried once.
+type StmtCache struct {
+	db       *sql.DB
+	capacity int
+
+	mu    sync.Mutex
+	stmts map[string]*list.Element
+	// lru holds *cachedStmt, most recently used first
+	lru   *list.List
+	stats StmtCacheStats
+}
+
+type cachedStmt struct {
+	query string
+	stmt  *sql.Stmt
+}
+
+// NewStmtCache caches up to capacity statements of db; a capacity of 0
+// runs every statement directly
+func NewStmtCache(db *sql.DB, capacity int) *StmtCache {
+	return &StmtCache{
+		db:       db,
+		capacity: capacity,
+		stmts:    make(map[string]*list.Element),
+		lru:      list.New(),
+		stats:    StmtCacheStats{Capacity: capacity},
+	}
+}
+
+// Query runs a query, through a cached statement when it has arguments
+func (c *StmtCache) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if c.capacity <= 0 || len(args) == 0 {
+		return c.db.Query(query, args...)
+	}
+	var rows *sql.Rows
+	err := c.run(query, func(stmt *sql.Stmt) (err error) {
+		rows, err = stmt.Query(args...)
+		return err
+	})
+	return rows, err
+}
+
+// Exec runs a statement, through a cached statement when it has arguments
+func (c *StmtCache) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if c.capacity <= 0 || len(args) == 0 {
+		return c.db.Exec(query, args...)
+	}
+	var result sql.Result
+	err := c.run(query, func(stmt *sql.Stmt) (err error) {
+		result, err = stmt.Exec(args...)
+		return err
+	})
+	return result, err
+}
+
+// run calls fn with the statement for query, preparing it again once when
+// it has gone stale
+func (c *StmtCache) run(query string, fn func(stmt *sql.Stmt) error) error {
+	stmt, err := c.prepare(query)
+	if err != nil {
+		return err
+	}
+	err = fn(stmt)
+	if err == nil || !staleStmt(err) {
+		return err
+	}
+
+	c.mu.Lock()
+	c.stats.Reprepares++
+	c.mu.Unlock()
+	c.remove(query, stmt)
+	if stmt, err = c.prepare(query); err != nil {
+		return err
+	}
+	return fn(stmt)
+}
+
+// prepare returns the cached statement for query, preparing it on a miss.
+// Preparing happens outside the lock, as it is a round trip.
+func (c *StmtCache) prepare(query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	if elem, ok := c.stmts[query]; ok {
+		c.lru.MoveToFront(elem)
+		c.stats.Hits++
+		c.mu.Unlock()
+		return elem.Value.(*cachedStmt).stmt, nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	stmt, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.stmts[query]; ok {
+		// Another caller prepared it meanwhile
+		stmt.Close()
+		return elem.Value.(*cachedStmt).stmt, nil
+	}
+	c.stmts[query] = c.lru.PushFront(&cachedStmt{query: query, stmt: stmt})
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.stmts, oldest.Value.(*cachedStmt).query)
+		// Rows still reading from it keep it open until they close
+		oldest.Value.(*cachedStmt).stmt.Close()
+		c.stats.Evictions++
+	}
+	return stmt, nil
+}
+
+// remove drops stmt from the cache if it is still the one cached for query
+func (c *StmtCache) remove(query string, stmt *sql.Stmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.stmts[query]; ok && elem.Value.(*cachedStmt).stmt == stmt {
+		c.lru.Remove(elem)
+		delete(c.stmts, query)
+	}
+	stmt.Close()
+}
+
+// staleStmt reports whether err means the statement must be prepared again:
+// its connection was reset, the server forgot it, or it was closed by an
+// eviction while in use
+func staleStmt(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	msg := err.Error()
+	for _, stale := range []string{
+		"statement is closed",
+		"bad connection",
+		"invalid connection",
+		"cached plan must not change result type",
+		"Unknown prepared statement handler",
+	} {
+		if strings.Contains(msg, stale) {
+			return true
+		}
+	}
+	return strings.Contains(msg, "prepared statement") && strings.Contains(msg, "does not exist")
+}
+
+// Stats returns the cache's counters
+func (c *StmtCache) Stats() StmtCacheStats {
+	if c == nil {
+		return StmtCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
+
+// Close closes every cached statement
+func (c *StmtCache) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var firstErr error
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		if err := elem.Value.(*cachedStmt).stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	c.stmts = make(map[string]*list.Element)
+	c.lru.Init()
+	return firstErr
+}
@@ -73,6 +73,8 @@ type Stats struct {
 	WaitDuration       time.Duration
 	MaxIdleClosed      int64
 	MaxLifetimeClosed  int64
+	// Statements are the prepared statement cache's counters
+	Statements StmtCacheStats
 }
 
 // Config represents database configuration
@@ -130,6 +132,12 @@ type Transaction interface {
 	QueryRow(query string, args ...interface{}) (*Row, error)
 }
 
+// SavepointAdapter is implemented by adapters whose transactions support
+// SAVEPOINT, RELEASE SAVEPOINT and ROLLBACK TO SAVEPOINT
+type SavepointAdapter interface {
+	SupportsSavepoints() bool
+}
+
 // Migration represents a database migration
 type Migration struct {
 	ID          int64           `json:"id"`
@@ -261,6 +269,7 @@ type ConnectionPool struct {
 	ConnMaxIdleTime    time.Duration `json:"conn_max_idle_time"`
 	MaxRetries         int           `json:"max_retries"`
 	RetryDelay         time.Duration `json:"retry_delay"`
+	RetryMaxDelay      time.Duration `json:"retry_max_delay"`
 }
 
 // DatabaseConfig represents comprehensive database configuration
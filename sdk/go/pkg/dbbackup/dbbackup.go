@@ -0,0 +1,493 @@
+// Package dbbackup backs up and restores SQLite and PostgreSQL databases.
+//
+// SQLite backups are page-by-page copies made with the online backup API,
+// so the database stays usable while they run. PostgreSQL backups are plain
+// SQL dumps made with pg_dump and restored with psql in a single
+// transaction. Either can be gzip-compressed, and every backup gets a
+// <file>.sha256 checksum that restores verify before touching the database.
+package dbbackup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Adapter names, as registered with the database manager
+const (
+	SQLite     = "sqlite"
+	PostgreSQL = "postgresql"
+)
+
+// ChecksumExt is appended to a backup's name for its checksum file
+const ChecksumExt = ".sha256"
+
+// PGDumpCommand and PSQLCommand are the PostgreSQL client binaries used
+var (
+	PGDumpCommand = "pg_dump"
+	PSQLCommand   = "psql"
+)
+
+// sqliteHeader starts every SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// pgDumpFooter ends every complete pg_dump plain-format dump
+const pgDumpFooter = "-- PostgreSQL database dump complete"
+
+// stepPages is how many pages each SQLite backup step copies
+const stepPages = 256
+
+// Progress reports work done out of total; total is 0 when unknown
+type Progress func(done, total int64)
+
+// Options controls a backup or restore
+type Options struct {
+	// Compress gzips the backup
+	Compress bool
+	Progress Progress
+}
+
+// Info describes a backup file
+type Info struct {
+	File    string
+	Adapter string
+	// Size is the size of the file on disk
+	Size int64
+	// Bytes is the size of the uncompressed contents
+	Bytes      int64
+	Compressed bool
+	Checksum   string
+	// ChecksumVerified is set when a checksum file was found and matched
+	ChecksumVerified bool
+}
+
+// AdapterFor guesses the adapter from a connection string
+func AdapterFor(dsn string) (string, error) {
+	switch {
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return SQLite, nil
+	case strings.HasPrefix(dsn, "postgresql://"), strings.HasPrefix(dsn, "postgres://"):
+		return PostgreSQL, nil
+	}
+	return "", fmt.Errorf("cannot tell the adapter from %q: use sqlite:<path> or postgresql://...", dsn)
+}
+
+// Backup writes a backup of the database at dsn to file
+func Backup(adapter, dsn, file string, opts Options) (*Info, error) {
+	if adapter == "" {
+		var err error
+		if adapter, err = AdapterFor(dsn); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	switch adapter {
+	case SQLite:
+		err = backupSQLite(strings.TrimPrefix(dsn, "sqlite:"), tmp, opts)
+	case PostgreSQL:
+		err = backupPostgres(dsn, tmp, opts)
+	default:
+		err = fmt.Errorf("backups are not supported for adapter '%s'", adapter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	info, err := inspect(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(file+ChecksumExt, []byte(info.Checksum+"  "+filepath.Base(file)+"\n"), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write checksum: %w", err)
+	}
+	info.ChecksumVerified = true
+	return info, nil
+}
+
+// Verify checks a backup without restoring it: the checksum file when there
+// is one, the gzip stream, and that the contents are a whole SQLite database
+// or pg_dump output
+func Verify(file string) (*Info, error) {
+	info, err := inspect(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file + ChecksumExt)
+	if os.IsNotExist(err) {
+		return info, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checksum: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 || fields[0] != info.Checksum {
+		return nil, fmt.Errorf("checksum mismatch: %s does not match %s%s", file, filepath.Base(file), ChecksumExt)
+	}
+	info.ChecksumVerified = true
+	return info, nil
+}
+
+// Restore replaces the database at dsn with the contents of a verified
+// backup
+func Restore(adapter, dsn, file string, opts Options) (*Info, error) {
+	info, err := Verify(file)
+	if err != nil {
+		return nil, err
+	}
+	if adapter == "" {
+		if adapter, err = AdapterFor(dsn); err != nil {
+			return nil, err
+		}
+	}
+	if adapter != info.Adapter {
+		return nil, fmt.Errorf("%s is a %s backup and cannot be restored into %s", file, info.Adapter, adapter)
+	}
+
+	switch adapter {
+	case SQLite:
+		err = restoreSQLite(file, strings.TrimPrefix(dsn, "sqlite:"), opts)
+	case PostgreSQL:
+		err = restorePostgres(file, dsn, info.Bytes, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// inspect hashes file, decompresses it if needed and identifies its adapter
+func inspect(file string) (*Info, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	info := &Info{File: file}
+	r, compressed, err := decompress(io.TeeReader(f, hash))
+	if err != nil {
+		return nil, err
+	}
+	info.Compressed = compressed
+
+	head := make([]byte, len(sqliteHeader))
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	tail := &tailWriter{max: 256}
+	rest, err := io.Copy(tail, r)
+	if err != nil {
+		return nil, fmt.Errorf("backup is corrupt: %w", err)
+	}
+	info.Bytes = int64(n) + rest
+
+	switch {
+	case bytes.Equal(head[:n], sqliteHeader):
+		info.Adapter = SQLite
+	case strings.Contains(string(tail.buf), pgDumpFooter):
+		info.Adapter = PostgreSQL
+	default:
+		return nil, fmt.Errorf("%s is not a complete SQLite or PostgreSQL backup", file)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	info.Size = stat.Size()
+	info.Checksum = hex.EncodeToString(hash.Sum(nil))
+	return info, nil
+}
+
+// decompress returns r, unzipped when it starts with the gzip magic number
+func decompress(r io.Reader) (io.Reader, bool, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return br, false, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, false, fmt.Errorf("backup is corrupt: %w", err)
+	}
+	return gz, true, nil
+}
+
+// tailWriter keeps the last max bytes written to it
+type tailWriter struct {
+	buf []byte
+	max int
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+	}
+	return len(p), nil
+}
+
+// countingWriter reports bytes written to Progress
+type countingWriter struct {
+	w        io.Writer
+	n, total int64
+	progress Progress
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if c.progress != nil {
+		c.progress(c.n, c.total)
+	}
+	return n, err
+}
+
+// backupSQLite copies the database at path into out with the online backup
+// API and checks the copy's integrity
+func backupSQLite(path string, out *os.File, opts Options) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	snapshot, err := os.CreateTemp(filepath.Dir(out.Name()), ".snapshot-*.db")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	snapshot.Close()
+	defer os.Remove(snapshot.Name())
+
+	if err := copySQLite(path, snapshot.Name(), opts.Progress); err != nil {
+		return err
+	}
+	if err := integrityCheck(snapshot.Name()); err != nil {
+		return err
+	}
+
+	in, err := os.Open(snapshot.Name())
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeMaybeCompressed(out, in, opts.Compress)
+}
+
+// restoreSQLite checks the backup's integrity and copies it over the
+// database at path with the online backup API
+func restoreSQLite(file, path string, opts Options) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+	r, _, err := decompress(f)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := os.CreateTemp(filepath.Dir(path), ".restore-*.db")
+	if err != nil {
+		return fmt.Errorf("failed to create restore file: %w", err)
+	}
+	defer os.Remove(snapshot.Name())
+	if _, err := io.Copy(snapshot, r); err != nil {
+		snapshot.Close()
+		return fmt.Errorf("failed to unpack backup: %w", err)
+	}
+	if err := snapshot.Close(); err != nil {
+		return err
+	}
+	if err := integrityCheck(snapshot.Name()); err != nil {
+		return fmt.Errorf("backup failed its integrity check: %w", err)
+	}
+
+	if err := copySQLite(snapshot.Name(), path, opts.Progress); err != nil {
+		return err
+	}
+	return integrityCheck(path)
+}
+
+// copySQLite copies every page of the src database into dst, reporting
+// progress in pages
+func copySQLite(src, dst string, progress Progress) error {
+	srcDB, err := sql.Open("sqlite3", src)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	defer srcDB.Close()
+	dstDB, err := sql.Open("sqlite3", dst)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	defer dstDB.Close()
+
+	return withConn(dstDB, func(dstConn *sqlite3.SQLiteConn) error {
+		return withConn(srcDB, func(srcConn *sqlite3.SQLiteConn) error {
+			backup, err := dstConn.Backup("main", srcConn, "main")
+			if err != nil {
+				return fmt.Errorf("failed to start SQLite backup: %w", err)
+			}
+			defer backup.Close()
+			for {
+				done, err := backup.Step(stepPages)
+				if err != nil {
+					return fmt.Errorf("SQLite backup failed: %w", err)
+				}
+				if progress != nil {
+					total := int64(backup.PageCount())
+					progress(total-int64(backup.Remaining()), total)
+				}
+				if done {
+					break
+				}
+			}
+			if err := backup.Finish(); err != nil {
+				return fmt.Errorf("SQLite backup failed: %w", err)
+			}
+			return nil
+		})
+	})
+}
+
+// withConn runs fn with the driver connection under one of db's connections
+func withConn(db *sql.DB, fn func(*sqlite3.SQLiteConn) error) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected SQLite driver connection %T", driverConn)
+		}
+		return fn(sqliteConn)
+	})
+}
+
+// integrityCheck runs PRAGMA integrity_check on the database at path
+func integrityCheck(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
+
+// writeMaybeCompressed copies in to out, gzipped when compress is set
+func writeMaybeCompressed(out io.Writer, in io.Reader, compress bool) error {
+	if !compress {
+		_, err := io.Copy(out, in)
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// backupPostgres streams pg_dump's plain SQL output into out
+func backupPostgres(dsn string, out io.Writer, opts Options) error {
+	if _, err := exec.LookPath(PGDumpCommand); err != nil {
+		return fmt.Errorf("%s not found: install the PostgreSQL client tools", PGDumpCommand)
+	}
+
+	var w io.Writer = out
+	var gz *gzip.Writer
+	if opts.Compress {
+		gz = gzip.NewWriter(out)
+		w = gz
+	}
+	tail := &tailWriter{max: 256}
+	var stderr bytes.Buffer
+	cmd := exec.Command(PGDumpCommand, "--no-owner", "--no-privileges", "--clean", "--if-exists", "--dbname", dsn)
+	cmd.Stdout = io.MultiWriter(&countingWriter{w: w, progress: opts.Progress}, tail)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", PGDumpCommand, err, strings.TrimSpace(stderr.String()))
+	}
+	if !strings.Contains(string(tail.buf), pgDumpFooter) {
+		return fmt.Errorf("%s output is incomplete", PGDumpCommand)
+	}
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
+}
+
+// restorePostgres replays a dump through psql in a single transaction, so
+// a failed restore leaves the database untouched
+func restorePostgres(file, dsn string, size int64, opts Options) error {
+	if _, err := exec.LookPath(PSQLCommand); err != nil {
+		return fmt.Errorf("%s not found: install the PostgreSQL client tools", PSQLCommand)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+	r, _, err := decompress(f)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(PSQLCommand, "--quiet", "--no-psqlrc", "--single-transaction",
+		"--set", "ON_ERROR_STOP=1", "--dbname", dsn, "--file", "-")
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", PSQLCommand, err)
+	}
+	_, copyErr := io.Copy(&countingWriter{w: stdin, total: size, progress: opts.Progress}, r)
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%s failed, nothing was restored: %w: %s", PSQLCommand, err, strings.TrimSpace(stderr.String()))
+	}
+	if copyErr != nil {
+		return fmt.Errorf("failed to read backup: %w", copyErr)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package dbbackup
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func countRows(t *testing.T, path string) int {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSQLiteBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		if _, err := db.Exec("INSERT INTO users (name) VALUES (?)", strings.Repeat("x", 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, compress := range []bool{false, true} {
+		file := filepath.Join(dir, "backups", "app.db.bak")
+		if compress {
+			file += ".gz"
+		}
+		var done, total int64
+		info, err := Backup("", "sqlite:"+path, file, Options{Compress: compress, Progress: func(d, t int64) { done, total = d, t }})
+		if err != nil {
+			t.Fatalf("Backup(compress=%v) returned error: %v", compress, err)
+		}
+		if info.Adapter != SQLite || info.Compressed != compress || !info.ChecksumVerified || total == 0 || done != total {
+			t.Errorf("unexpected backup info %+v (progress %d/%d)", info, done, total)
+		}
+		if compress && info.Size >= info.Bytes {
+			t.Errorf("compressed backup is not smaller: %d >= %d", info.Size, info.Bytes)
+		}
+
+		if _, err := db.Exec("DELETE FROM users WHERE id > 10"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Restore(SQLite, "sqlite:"+path, file, Options{}); err != nil {
+			t.Fatalf("Restore(compress=%v) returned error: %v", compress, err)
+		}
+		if n := countRows(t, path); n != 500 {
+			t.Errorf("expected 500 rows after restore, got %d", n)
+		}
+	}
+
+	file := filepath.Join(dir, "backups", "app.db.bak")
+	if _, err := Restore(PostgreSQL, "postgresql://localhost/app", file, Options{}); err == nil || !strings.Contains(err.Error(), "sqlite backup") {
+		t.Errorf("expected an adapter mismatch error, got %v", err)
+	}
+
+	data, _ := os.ReadFile(file)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(file, data, 0644)
+	if _, err := Verify(file); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+	if _, err := Restore(SQLite, "sqlite:"+path, file, Options{}); err == nil {
+		t.Error("restoring a tampered backup should fail")
+	}
+	if n := countRows(t, path); n != 500 {
+		t.Errorf("a refused restore changed the database: %d rows", n)
+	}
+
+	notBackup := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notBackup, []byte("hello"), 0644)
+	if _, err := Verify(notBackup); err == nil || !strings.Contains(err.Error(), "not a complete") {
+		t.Errorf("expected a format error, got %v", err)
+	}
+}
+
+func TestPostgresBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	restored := filepath.Join(dir, "restored.sql")
+	script := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	defer func(dump, psql string) { PGDumpCommand, PSQLCommand = dump, psql }(PGDumpCommand, PSQLCommand)
+	PGDumpCommand = script("pg_dump", `printf 'CREATE TABLE users (id int);\n--\n-- PostgreSQL database dump complete\n--\n'`)
+	PSQLCommand = script("psql", `cat > `+restored)
+
+	file := filepath.Join(dir, "app.sql.gz")
+	info, err := Backup("", "postgresql://app@localhost/app", file, Options{Compress: true})
+	if err != nil {
+		t.Fatalf("Backup() returned error: %v", err)
+	}
+	if info.Adapter != PostgreSQL || !info.Compressed {
+		t.Errorf("unexpected backup info %+v", info)
+	}
+	if _, err := Restore("", "postgresql://app@localhost/app", file, Options{}); err != nil {
+		t.Fatalf("Restore() returned error: %v", err)
+	}
+	if data, _ := os.ReadFile(restored); !strings.HasPrefix(string(data), "CREATE TABLE users") {
+		t.Errorf("psql received %q", data)
+	}
+
+	PGDumpCommand = script("pg_dump_truncated", `printf 'CREATE TABLE users (id int);\n'`)
+	if _, err := Backup(PostgreSQL, "postgresql://app@localhost/app", filepath.Join(dir, "bad.sql"), Options{}); err == nil || !strings.Contains(err.Error(), "incomplete") {
+		t.Errorf("expected an incomplete dump error, got %v", err)
+	}
+	PSQLCommand = script("psql_failing", `cat > /dev/null; echo 'ERROR: relation exists' >&2; exit 3`)
+	if _, err := Restore(PostgreSQL, "postgresql://app@localhost/app", file, Options{}); err == nil || !strings.Contains(err.Error(), "nothing was restored") {
+		t.Errorf("expected a psql failure, got %v", err)
+	}
+}
@@ -0,0 +1,582 @@
+// Package dbmigrate applies versioned database migrations. Migrations live
+// in a directory as timestamped files:
+//
+//	migrations/20240101120000_create_users.up.sql
+//	migrations/20240101120000_create_users.down.sql
+//	migrations/20240102090000_add_email.sql    (-- +up / -- +down sections)
+//	migrations/20240103080000_seed_roles.tsk   ([up] and [down] sql keys)
+//
+// Applied versions are recorded in a schema_migrations table. Each migration
+// runs in a transaction when the adapter supports one, unless the file opts
+// out with "-- +no-transaction" or "transaction: false".
+package dbmigrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+)
+
+// DefaultDir is where migrations are looked for
+const DefaultDir = "migrations"
+
+// DefaultTable records applied migrations
+const DefaultTable = "schema_migrations"
+
+// fileName matches <version>_<name>.<ext>, with an optional .up/.down
+var fileName = regexp.MustCompile(`^(\d{8,14})_([A-Za-z0-9_\-]+?)(\.up|\.down)?\.(sql|tsk)$`)
+
+// Markers splitting a single .sql file into its directions
+const (
+	upMarker            = "-- +up"
+	downMarker          = "-- +down"
+	noTransactionMarker = "-- +no-transaction"
+)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version string
+	Name    string
+	// Up and Down are the statements of each direction; Down is empty for
+	// irreversible migrations
+	Up   []string
+	Down []string
+	// Transaction is false when the migration must run outside one, such as
+	// CREATE INDEX CONCURRENTLY
+	Transaction bool
+	// Files are the files the migration was read from
+	Files []string
+}
+
+// String is "<version>_<name>"
+func (m *Migration) String() string {
+	return m.Version + "_" + m.Name
+}
+
+// Load reads every migration in dir, ordered by version
+func Load(dir string) ([]*Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[string]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, name, direction, ext := match[1], match[2], strings.TrimPrefix(match[3], "."), match[4]
+		file := filepath.Join(dir, entry.Name())
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name, Transaction: true}
+			byVersion[version] = m
+		} else if m.Name != name || direction == "" {
+			return nil, fmt.Errorf("duplicate migration version %s: %s and %s", version, m.Files[0], file)
+		}
+		m.Files = append(m.Files, file)
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if ext == "tsk" {
+			err = parseTSK(m, content, direction)
+		} else {
+			err = parseSQL(m, string(content), direction)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if len(m.Up) == 0 {
+			return nil, fmt.Errorf("migration %s has no up statements", m)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// parseSQL reads a .sql file; without a direction in the file name it is
+// split on the -- +up and -- +down markers
+func parseSQL(m *Migration, content, direction string) error {
+	if strings.Contains(content, noTransactionMarker) {
+		m.Transaction = false
+	}
+	switch direction {
+	case "up":
+		m.Up = SplitStatements(content)
+		return nil
+	case "down":
+		m.Down = SplitStatements(content)
+		return nil
+	}
+
+	up, down := content, ""
+	if i := strings.Index(content, downMarker); i >= 0 {
+		up, down = content[:i], content[i+len(downMarker):]
+	}
+	if i := strings.Index(up, upMarker); i >= 0 {
+		up = up[i+len(upMarker):]
+	}
+	m.Up = SplitStatements(up)
+	m.Down = SplitStatements(down)
+	return nil
+}
+
+// parseTSK reads a .tsk migration:
+//
+//	transaction: false
+//	[up]
+//	sql: ["CREATE TABLE roles (name TEXT)", "INSERT INTO roles VALUES ('admin')"]
+//	[down]
+//	sql: "DROP TABLE roles"
+func parseTSK(m *Migration, content []byte, direction string) error {
+	cfg := config.New()
+	if err := cfg.LoadTSK(content); err != nil {
+		return err
+	}
+	if cfg.Has("transaction") && !cfg.GetBool("transaction") {
+		m.Transaction = false
+	}
+	for _, dir := range []string{"up", "down"} {
+		if direction != "" && direction != dir {
+			continue
+		}
+		key := dir + ".sql"
+		if direction != "" && !cfg.Has(key) {
+			key = "sql"
+		}
+		var stmts []string
+		switch v := cfg.Get(key).(type) {
+		case nil:
+		case string:
+			stmts = SplitStatements(v)
+		case []interface{}:
+			for _, item := range v {
+				stmts = append(stmts, SplitStatements(fmt.Sprint(item))...)
+			}
+		default:
+			return fmt.Errorf("%s must be a string or an array of strings", key)
+		}
+		if dir == "up" {
+			m.Up = stmts
+		} else {
+			m.Down = stmts
+		}
+	}
+	return nil
+}
+
+// SplitStatements splits SQL on ';' outside quotes, dollar-quoted bodies and
+// comments, dropping empty statements
+func SplitStatements(sql string) []string {
+	var stmts []string
+	var current strings.Builder
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := strings.IndexByte(sql[i+1:], c)
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += i + 2
+			}
+			current.WriteString(sql[i:end])
+			i = end - 1
+		case c == '$' && dollarTag(sql[i:]) != "":
+			tag := dollarTag(sql[i:])
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += i + 2*len(tag)
+			}
+			current.WriteString(sql[i:end])
+			i = end - 1
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			i += end - 1
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 3
+			}
+		case c == ';':
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return stmts
+}
+
+// dollarTag returns the $$ or $tag$ dollar quote s starts with, or ""
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$':
+			return s[:i+1]
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 1 && c >= '0' && c <= '9'):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// DB is the part of a database adapter migrations need
+type DB interface {
+	Query(query string, args ...interface{}) (*databasetypes.Result, error)
+	Execute(query string, args ...interface{}) error
+}
+
+// TxDB is a DB that supports transactions
+type TxDB interface {
+	DB
+	BeginTransaction() (databasetypes.Transaction, error)
+}
+
+// Migrator applies the migrations of one directory to one database
+type Migrator struct {
+	db         DB
+	migrations []*Migration
+	// Table records applied migrations; it defaults to DefaultTable
+	Table string
+	now   func() time.Time
+}
+
+// New loads the migrations in dir for db
+func New(db DB, dir string) (*Migrator, error) {
+	migrations, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, Table: DefaultTable, now: time.Now}, nil
+}
+
+// Migrations returns the loaded migrations, ordered by version
+func (mg *Migrator) Migrations() []*Migration {
+	return mg.migrations
+}
+
+// Status is one migration's state
+type Status struct {
+	Version string
+	Name    string
+	Applied bool
+	// AppliedAt is when the migration ran, if it did
+	AppliedAt string
+	// Missing is set for applied versions whose files are gone
+	Missing bool
+}
+
+// applied is one row of the tracking table
+type applied struct {
+	version, name, at string
+}
+
+// ensureTable creates the tracking table if it does not exist
+func (mg *Migrator) ensureTable() error {
+	err := mg.db.Execute("CREATE TABLE IF NOT EXISTS " + mg.Table + " (" +
+		"version VARCHAR(14) PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at VARCHAR(32) NOT NULL)")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", mg.Table, err)
+	}
+	return nil
+}
+
+// applied reads the tracking table, ordered by version
+func (mg *Migrator) applied() ([]applied, error) {
+	if err := mg.ensureTable(); err != nil {
+		return nil, err
+	}
+	result, err := mg.db.Query("SELECT version, name, applied_at FROM " + mg.Table + " ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", mg.Table, err)
+	}
+	rows := make([]applied, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		rows = append(rows, applied{version: text(row["version"]), name: text(row["name"]), at: text(row["applied_at"])})
+	}
+	return rows, nil
+}
+
+// text renders a column value, which drivers return as string or []byte
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Status reports every migration on disk and every applied version,
+// ordered by version
+func (mg *Migrator) Status() ([]Status, error) {
+	rows, err := mg.applied()
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[string]applied, len(rows))
+	for _, row := range rows {
+		byVersion[row.version] = row
+	}
+
+	var statuses []Status
+	for _, m := range mg.migrations {
+		row, ok := byVersion[m.Version]
+		statuses = append(statuses, Status{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: row.at})
+		delete(byVersion, m.Version)
+	}
+	for _, row := range byVersion {
+		statuses = append(statuses, Status{Version: row.version, Name: row.name, Applied: true, AppliedAt: row.at, Missing: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Direction is up or down
+type Direction string
+
+const (
+	Up   Direction = "up"
+	Down Direction = "down"
+)
+
+// Step is one migration run in one direction
+type Step struct {
+	Migration *Migration
+	Direction Direction
+}
+
+// Statements returns the statements the step runs
+func (s Step) Statements() []string {
+	if s.Direction == Down {
+		return s.Migration.Down
+	}
+	return s.Migration.Up
+}
+
+// Options controls a run
+type Options struct {
+	// DryRun plans the steps without running them
+	DryRun bool
+	// Target is the version to migrate up to or down to. Up runs pending
+	// migrations up to and including it; down rolls back every migration
+	// after it.
+	Target string
+	// Steps limits how many migrations run; down defaults to 1
+	Steps int
+}
+
+// Up applies pending migrations in version order and returns the steps run
+// (or planned, on a dry run)
+func (mg *Migrator) Up(opts Options) ([]Step, error) {
+	rows, err := mg.applied()
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		done[row.version] = true
+	}
+	if opts.Target != "" && mg.find(opts.Target) == nil {
+		return nil, fmt.Errorf("unknown target version %s", opts.Target)
+	}
+
+	var plan []Step
+	for _, m := range mg.migrations {
+		if opts.Target != "" && m.Version > opts.Target {
+			break
+		}
+		if !done[m.Version] {
+			plan = append(plan, Step{Migration: m, Direction: Up})
+		}
+		if opts.Steps > 0 && len(plan) == opts.Steps {
+			break
+		}
+	}
+	return mg.run(plan, opts.DryRun)
+}
+
+// Down rolls back applied migrations, newest first, and returns the steps
+// run (or planned, on a dry run)
+func (mg *Migrator) Down(opts Options) ([]Step, error) {
+	rows, err := mg.applied()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Target != "" && opts.Target != "0" && mg.find(opts.Target) == nil {
+		return nil, fmt.Errorf("unknown target version %s", opts.Target)
+	}
+	steps := opts.Steps
+	if steps == 0 && opts.Target == "" {
+		steps = 1
+	}
+
+	var plan []Step
+	for i := len(rows) - 1; i >= 0; i-- {
+		if opts.Target != "" && rows[i].version <= opts.Target {
+			break
+		}
+		m := mg.find(rows[i].version)
+		if m == nil {
+			return nil, fmt.Errorf("cannot roll back %s_%s: its migration file is missing", rows[i].version, rows[i].name)
+		}
+		if len(m.Down) == 0 {
+			return nil, fmt.Errorf("cannot roll back %s: it has no down statements", m)
+		}
+		plan = append(plan, Step{Migration: m, Direction: Down})
+		if steps > 0 && len(plan) == steps {
+			break
+		}
+	}
+	return mg.run(plan, opts.DryRun)
+}
+
+// Redo rolls back the latest applied migration and applies it again
+func (mg *Migrator) Redo(opts Options) ([]Step, error) {
+	down, err := mg.Down(Options{DryRun: opts.DryRun, Steps: 1})
+	if err != nil || len(down) == 0 {
+		return down, err
+	}
+	if opts.DryRun {
+		return append(down, Step{Migration: down[0].Migration, Direction: Up}), nil
+	}
+	if err := mg.apply(Step{Migration: down[0].Migration, Direction: Up}); err != nil {
+		return down, err
+	}
+	return append(down, Step{Migration: down[0].Migration, Direction: Up}), nil
+}
+
+// find returns the migration with version, or nil
+func (mg *Migrator) find(version string) *Migration {
+	for _, m := range mg.migrations {
+		if m.Version == version {
+			return m
+		}
+	}
+	return nil
+}
+
+// run applies plan in order, stopping at the first failure
+func (mg *Migrator) run(plan []Step, dryRun bool) ([]Step, error) {
+	if dryRun {
+		return plan, nil
+	}
+	for i, step := range plan {
+		if err := mg.apply(step); err != nil {
+			return plan[:i], err
+		}
+	}
+	return plan, nil
+}
+
+// apply runs one step and records it, inside a transaction when the
+// adapter and the migration allow it
+func (mg *Migrator) apply(step Step) error {
+	record := "INSERT INTO " + mg.Table + " (version, name, applied_at) VALUES (" +
+		quote(step.Migration.Version) + ", " + quote(step.Migration.Name) + ", " + quote(mg.now().UTC().Format(time.RFC3339)) + ")"
+	if step.Direction == Down {
+		record = "DELETE FROM " + mg.Table + " WHERE version = " + quote(step.Migration.Version)
+	}
+	stmts := append(append([]string(nil), step.Statements()...), record)
+
+	txdb, ok := mg.db.(TxDB)
+	if !ok || !step.Migration.Transaction {
+		for _, stmt := range stmts {
+			if err := mg.db.Execute(stmt); err != nil {
+				return fmt.Errorf("failed to migrate %s %s: %w", step.Direction, step.Migration, err)
+			}
+		}
+		return nil
+	}
+
+	tx, err := txdb.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for %s: %w", step.Migration, err)
+	}
+	for _, stmt := range stmts {
+		if err := tx.Execute(stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate %s %s (rolled back): %w", step.Direction, step.Migration, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit %s: %w", step.Migration, err)
+	}
+	return nil
+}
+
+// quote quotes a SQL string literal
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Create writes a new, empty <timestamp>_<name>.sql migration to dir and
+// returns its path
+func Create(dir, name string, now time.Time) (string, error) {
+	return Write(dir, name, now, nil, nil)
+}
+
+// Write writes a <timestamp>_<name>.sql migration with up and down
+// statements to dir and returns its path
+func Write(dir, name string, now time.Time, up, down []string) (string, error) {
+	slug := strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if slug == "" {
+		return "", fmt.Errorf("migration name %q has no letters or digits", name)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	file := filepath.Join(dir, now.UTC().Format("20060102150405")+"_"+slug+".sql")
+	content := upMarker + "\n" + section(up) + "\n" + downMarker + "\n" + section(down)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return file, nil
+}
+
+// section formats statements for a migration file, one per line
+func section(stmts []string) string {
+	var b strings.Builder
+	for _, stmt := range stmts {
+		b.WriteString(stmt + ";\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,262 @@
+package dbmigrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+)
+
+// fakeDB records statements and emulates the tracking table
+type fakeDB struct {
+	log     []string
+	applied map[string][2]string
+	commits int
+}
+
+var insertPattern = regexp.MustCompile(`^INSERT INTO schema_migrations \(version, name, applied_at\) VALUES \('(\w+)', '(\w+)', '([^']+)'\)$`)
+var deletePattern = regexp.MustCompile(`^DELETE FROM schema_migrations WHERE version = '(\w+)'$`)
+
+func (db *fakeDB) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	result := &databasetypes.Result{Columns: []string{"version", "name", "applied_at"}}
+	versions := make([]string, 0, len(db.applied))
+	for version := range db.applied {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	for _, version := range versions {
+		row := db.applied[version]
+		result.Rows = append(result.Rows, map[string]interface{}{"version": []byte(version), "name": row[0], "applied_at": row[1]})
+	}
+	return result, nil
+}
+
+func (db *fakeDB) Execute(query string, args ...interface{}) error {
+	if strings.Contains(query, "FAIL") {
+		return fmt.Errorf("syntax error near FAIL")
+	}
+	if db.applied == nil {
+		db.applied = make(map[string][2]string)
+	}
+	if m := insertPattern.FindStringSubmatch(query); m != nil {
+		db.applied[m[1]] = [2]string{m[2], m[3]}
+	} else if m := deletePattern.FindStringSubmatch(query); m != nil {
+		delete(db.applied, m[1])
+	} else if !strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations") {
+		db.log = append(db.log, query)
+	}
+	return nil
+}
+
+// fakeTxDB adds transactions that buffer statements until Commit
+type fakeTxDB struct{ fakeDB }
+
+type fakeTx struct {
+	db    *fakeTxDB
+	stmts []string
+}
+
+func (db *fakeTxDB) BeginTransaction() (databasetypes.Transaction, error) {
+	return &fakeTx{db: db}, nil
+}
+
+func (tx *fakeTx) Commit() error {
+	for _, stmt := range tx.stmts {
+		tx.db.fakeDB.Execute(stmt)
+	}
+	tx.db.commits++
+	return nil
+}
+func (tx *fakeTx) Rollback() error { tx.stmts = nil; return nil }
+func (tx *fakeTx) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	return tx.db.Query(query, args...)
+}
+func (tx *fakeTx) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	return nil, fmt.Errorf("not supported")
+}
+func (tx *fakeTx) Execute(query string, args ...interface{}) error {
+	if strings.Contains(query, "FAIL") {
+		return fmt.Errorf("syntax error near FAIL")
+	}
+	tx.stmts = append(tx.stmts, query)
+	return nil
+}
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := `-- users; with a comment
+CREATE TABLE users (name TEXT DEFAULT 'a;b'); /* block; comment */
+CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+INSERT INTO t VALUES ($1, 'it''s');`
+	want := []string{
+		"CREATE TABLE users (name TEXT DEFAULT 'a;b')",
+		"CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql",
+		"INSERT INTO t VALUES ($1, 'it''s')",
+	}
+	if got := SplitStatements(sql); !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitStatements() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"20240101000000_create_users.up.sql":   "CREATE TABLE users (id INTEGER);",
+		"20240101000000_create_users.down.sql": "DROP TABLE users;",
+		"20240102000000_add_index.sql":         "-- +no-transaction\n-- +up\nCREATE INDEX CONCURRENTLY idx ON users (id);\n-- +down\nDROP INDEX idx;\n",
+		"20240103000000_seed.tsk":              "[up]\nsql: [\"INSERT INTO users VALUES (1)\", \"INSERT INTO users VALUES (2)\"]\n\n[down]\nsql: \"DELETE FROM users\"\n",
+		"README.md":                            "ignored",
+	})
+	migrations, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if len(migrations) != 3 {
+		t.Fatalf("expected 3 migrations, got %d", len(migrations))
+	}
+	if m := migrations[0]; m.String() != "20240101000000_create_users" || len(m.Files) != 2 ||
+		m.Down[0] != "DROP TABLE users" || !m.Transaction {
+		t.Errorf("unexpected first migration: %+v", m)
+	}
+	if m := migrations[1]; m.Transaction || m.Up[0] != "CREATE INDEX CONCURRENTLY idx ON users (id)" || m.Down[0] != "DROP INDEX idx" {
+		t.Errorf("unexpected second migration: %+v", m)
+	}
+	if m := migrations[2]; len(m.Up) != 2 || m.Down[0] != "DELETE FROM users" {
+		t.Errorf("unexpected tsk migration: %+v", m)
+	}
+
+	dup := writeMigrations(t, map[string]string{
+		"20240101000000_a.sql": "SELECT 1;",
+		"20240101000000_b.sql": "SELECT 2;",
+	})
+	if _, err := Load(dup); err == nil || !strings.Contains(err.Error(), "duplicate migration version") {
+		t.Errorf("expected a duplicate version error, got %v", err)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"20240101000000_create_users.sql": "-- +up\nCREATE TABLE users (id INTEGER);\n-- +down\nDROP TABLE users;\n",
+		"20240102000000_add_email.sql":    "-- +up\nALTER TABLE users ADD email TEXT;\n-- +down\nALTER TABLE users DROP email;\n",
+		"20240103000000_irreversible.sql": "UPDATE users SET email = '';\n",
+	})
+	db := &fakeTxDB{}
+	mg, err := New(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mg.now = func() time.Time { return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	plan, err := mg.Up(Options{DryRun: true})
+	if err != nil || len(plan) != 3 || len(db.log) != 0 {
+		t.Fatalf("dry run planned %d steps and ran %d statements (%v)", len(plan), len(db.log), err)
+	}
+
+	if steps, err := mg.Up(Options{Target: "20240102000000"}); err != nil || len(steps) != 2 {
+		t.Fatalf("Up(target) = %d steps, %v", len(steps), err)
+	}
+	if db.commits != 2 {
+		t.Errorf("expected each migration in its own transaction, got %d commits", db.commits)
+	}
+	statuses, err := mg.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := 0
+	for _, status := range statuses {
+		if status.Applied {
+			applied++
+			if status.AppliedAt != "2024-06-01T12:00:00Z" {
+				t.Errorf("unexpected applied_at %q", status.AppliedAt)
+			}
+		}
+	}
+	if len(statuses) != 3 || applied != 2 {
+		t.Errorf("expected 2 of 3 applied, got %+v", statuses)
+	}
+
+	if steps, err := mg.Redo(Options{}); err != nil || len(steps) != 2 || steps[0].Direction != Down || steps[1].Direction != Up {
+		t.Fatalf("Redo() = %+v, %v", steps, err)
+	}
+	if _, err := mg.Up(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mg.Down(Options{}); err == nil || !strings.Contains(err.Error(), "no down statements") {
+		t.Errorf("expected the irreversible migration to refuse rollback, got %v", err)
+	}
+
+	want := []string{
+		"CREATE TABLE users (id INTEGER)",
+		"ALTER TABLE users ADD email TEXT",
+		"ALTER TABLE users DROP email",
+		"ALTER TABLE users ADD email TEXT",
+		"UPDATE users SET email = ''",
+	}
+	if !reflect.DeepEqual(db.log, want) {
+		t.Errorf("statements run =\n%q\nwant\n%q", db.log, want)
+	}
+}
+
+func TestMigratorRollsBackFailures(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"20240101000000_ok.sql":  "CREATE TABLE a (id INTEGER);",
+		"20240102000000_bad.sql": "CREATE TABLE b (id INTEGER);\nFAIL;",
+	})
+	db := &fakeTxDB{}
+	mg, err := New(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps, err := mg.Up(Options{})
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("expected a rolled back error, got %v", err)
+	}
+	if len(steps) != 1 || len(db.applied) != 1 || !reflect.DeepEqual(db.log, []string{"CREATE TABLE a (id INTEGER)"}) {
+		t.Errorf("the failed migration should leave no trace: steps=%d applied=%v log=%q", len(steps), db.applied, db.log)
+	}
+
+	// Without transaction support statements run one by one
+	plain := &fakeDB{}
+	mg, _ = New(plain, dir)
+	if _, err := mg.Up(Options{}); err == nil || strings.Contains(err.Error(), "rolled back") {
+		t.Errorf("expected a plain failure, got %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	file, err := Write(dir, "Schema plan", now, []string{"ALTER TABLE users ADD COLUMN email TEXT", "CREATE INDEX idx_email ON users (email)"}, nil)
+	if err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+	if filepath.Base(file) != "20240301120000_schema_plan.sql" {
+		t.Errorf("file = %s", file)
+	}
+	migrations, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 1 || len(migrations[0].Up) != 2 || len(migrations[0].Down) != 0 {
+		t.Fatalf("loaded %+v", migrations[0])
+	}
+	if migrations[0].Up[1] != "CREATE INDEX idx_email ON users (email)" {
+		t.Errorf("up = %q", migrations[0].Up)
+	}
+}
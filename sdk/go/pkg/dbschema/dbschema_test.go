@@ -0,0 +1,257 @@
+package dbschema
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteDB runs statements on a SQLite database
+type sqliteDB struct{ db *sql.DB }
+
+func (s *sqliteDB) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &databasetypes.Result{Columns: columns}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{})
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqliteDB) Execute(query string, args ...interface{}) error {
+	_, err := s.db.Exec(query, args...)
+	return err
+}
+
+func openDB(t *testing.T, setup string) *sqliteDB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(setup); err != nil {
+		t.Fatal(err)
+	}
+	return &sqliteDB{db: db}
+}
+
+const usersSchema = `
+[users]
+columns {
+    id: "INTEGER PRIMARY KEY"
+    name: "TEXT"
+    age: "BIGINT NOT NULL DEFAULT 0"
+    email: "VARCHAR(255)"
+}
+indexes {
+    idx_users_email: "UNIQUE (email)"
+}
+renamed {
+    name: "full_name"
+}
+`
+
+func TestParse(t *testing.T) {
+	schema, err := Parse([]byte(usersSchema))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	users := schema.Tables["users"]
+	var names []string
+	for _, column := range users.Columns {
+		names = append(names, column.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"id", "name", "age", "email"}) {
+		t.Errorf("columns = %v; want them in file order", names)
+	}
+	age := users.Column("age")
+	if age.Type != "BIGINT" || !age.NotNull || age.Default != "0" || age.PrimaryKey {
+		t.Errorf("age = %+v", age)
+	}
+	if id := users.Column("id"); !id.PrimaryKey || !id.NotNull {
+		t.Errorf("id = %+v", id)
+	}
+	if index := users.Index("idx_users_email"); index == nil || !index.Unique || !reflect.DeepEqual(index.Columns, []string{"email"}) {
+		t.Errorf("index = %+v", index)
+	}
+	if users.Renamed["name"] != "full_name" {
+		t.Errorf("renamed = %v", users.Renamed)
+	}
+
+	if _, err := Parse([]byte("[users]\nid: \"INTEGER\"\n")); err == nil {
+		t.Error("a column outside columns {} should be rejected")
+	}
+}
+
+func TestDiffAndApplySQLite(t *testing.T) {
+	db := openDB(t, `
+		CREATE TABLE users (id INTEGER PRIMARY KEY, full_name TEXT, age INT, nick TEXT);
+		CREATE INDEX idx_users_age ON users (age);
+		CREATE TABLE legacy (id INTEGER PRIMARY KEY);
+		INSERT INTO users VALUES (1, 'Ada', 36, 'ada');
+	`)
+	desired, err := Parse([]byte(usersSchema + `
+[posts]
+columns {
+    id: "INTEGER PRIMARY KEY"
+    user_id: "INTEGER NOT NULL"
+}
+indexes {
+    idx_posts_user: "(user_id)"
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := Inspect(db, SQLite)
+	if err != nil {
+		t.Fatalf("Inspect() returned error: %v", err)
+	}
+
+	plan := Diff(current, desired)
+	var got []string
+	for _, change := range plan.Changes {
+		got = append(got, change.String())
+	}
+	want := []string{
+		"create table posts",
+		"rename column users.full_name -> name",
+		"add column users.email",
+		"alter column users.age: INT -> BIGINT NOT NULL DEFAULT 0",
+		"drop column users.nick",
+		"drop index users.idx_users_age",
+		"create index users.idx_users_email",
+		"drop table legacy",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("plan =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var refused *DestructiveError
+	if err := plan.Apply(db, false); !errors.As(err, &refused) || len(refused.Changes) != 3 {
+		t.Fatalf("Apply() without allowing destructive changes returned %v", err)
+	}
+	if current, _ := Inspect(db, SQLite); current.Tables["posts"] != nil {
+		t.Fatal("a refused plan should change nothing")
+	}
+
+	if err := plan.Apply(db, true); err != nil {
+		t.Fatalf("Apply() returned error:\n%s\n%v", strings.Join(plan.Statements(), ";\n"), err)
+	}
+	current, err = Inspect(db, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again := Diff(current, desired); !again.Empty() {
+		t.Errorf("schema still differs after Apply: %v", again.Changes)
+	}
+
+	var name string
+	var age int
+	if err := db.db.QueryRow("SELECT name, age FROM users WHERE id = 1").Scan(&name, &age); err != nil || name != "Ada" || age != 36 {
+		t.Errorf("row after rebuild = %q, %d, %v; want the data kept", name, age, err)
+	}
+}
+
+func TestGuessedRename(t *testing.T) {
+	db := openDB(t, "CREATE TABLE users (id INTEGER PRIMARY KEY, mail TEXT)")
+	desired, err := Parse([]byte("[users]\ncolumns {\n    id: \"INTEGER PRIMARY KEY\"\n    email: \"TEXT\"\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := Inspect(db, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := Diff(current, desired)
+	if len(plan.Changes) != 1 || plan.Changes[0].Kind != RenameColumn || !plan.Changes[0].Guessed {
+		t.Fatalf("changes = %+v; want one guessed rename", plan.Changes)
+	}
+	if err := plan.Check(false); err == nil {
+		t.Error("a guessed rename should need confirming")
+	}
+	if want := []string{"ALTER TABLE users RENAME COLUMN mail TO email"}; !reflect.DeepEqual(plan.Statements(), want) {
+		t.Errorf("statements = %q; want %q", plan.Statements(), want)
+	}
+}
+
+func TestDiffDialects(t *testing.T) {
+	current := &Schema{Dialect: PostgreSQL, Tables: map[string]*Table{"users": {
+		Name: "users",
+		Columns: []*Column{
+			{Name: "id", Type: "INTEGER", NotNull: true, PrimaryKey: true, Default: "nextval('users_id_seq'::regclass)"},
+			{Name: "name", Type: "CHARACTER VARYING(255)", Default: "'anon'::character varying"},
+			{Name: "score", Type: "DOUBLE PRECISION"},
+			{Name: "age", Type: "INTEGER"},
+		},
+	}}}
+	desired := &Schema{Tables: map[string]*Table{"users": {
+		Name: "users",
+		Columns: []*Column{
+			ParseColumn("id", "SERIAL PRIMARY KEY"),
+			ParseColumn("name", "VARCHAR(255) DEFAULT 'anon'"),
+			ParseColumn("score", "DOUBLE"),
+			ParseColumn("age", "BIGINT NOT NULL"),
+		},
+	}}}
+
+	plan := Diff(current, desired)
+	want := []string{
+		"ALTER TABLE users ALTER COLUMN age TYPE BIGINT USING age::BIGINT",
+		"ALTER TABLE users ALTER COLUMN age SET NOT NULL",
+	}
+	if !reflect.DeepEqual(plan.Statements(), want) {
+		t.Errorf("postgresql statements = %q; want %q", plan.Statements(), want)
+	}
+
+	current.Dialect = MySQL
+	plan = Diff(current, desired)
+	want = []string{"ALTER TABLE users MODIFY COLUMN age BIGINT NOT NULL"}
+	if !reflect.DeepEqual(plan.Statements(), want) {
+		t.Errorf("mysql statements = %q; want %q", plan.Statements(), want)
+	}
+}
+
+func TestNormalizeType(t *testing.T) {
+	tests := map[string]string{
+		"int":                         "INTEGER",
+		"INT(11)":                     "INTEGER",
+		"tinyint(1)":                  "BOOLEAN",
+		"character varying(64)":       "VARCHAR(64)",
+		"DECIMAL(10, 2)":              "DECIMAL(10,2)",
+		"bigint unsigned":             "BIGINT UNSIGNED",
+		"timestamp without time zone": "TIMESTAMP",
+	}
+	for in, want := range tests {
+		if got := normalizeType(in); got != want {
+			t.Errorf("normalizeType(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
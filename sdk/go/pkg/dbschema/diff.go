@@ -0,0 +1,466 @@
+package dbschema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ChangeKind is what a change does
+type ChangeKind string
+
+// Change kinds
+const (
+	CreateTable  ChangeKind = "create table"
+	DropTable    ChangeKind = "drop table"
+	AddColumn    ChangeKind = "add column"
+	DropColumn   ChangeKind = "drop column"
+	RenameColumn ChangeKind = "rename column"
+	AlterColumn  ChangeKind = "alter column"
+	CreateIndex  ChangeKind = "create index"
+	DropIndex    ChangeKind = "drop index"
+)
+
+// Change is one step from the current schema towards the desired one
+type Change struct {
+	Kind  ChangeKind
+	Table string
+	// Name is the column or index changed; for a rename, the new name
+	Name string
+	// From and To describe an alteration or rename
+	From string
+	To   string
+	// Destructive changes can lose data: dropped tables and columns, column
+	// type changes and guessed renames, which move data to the wrong column
+	// when the guess is wrong
+	Destructive bool
+	// Guessed marks a rename inferred from one dropped and one added column
+	// of the same type, rather than declared under renamed
+	Guessed bool
+	// SQL are the statements making the change; changes folded into another
+	// change's statements, like a SQLite table rebuild, have none
+	SQL []string
+}
+
+// String describes the change, such as "alter column users.age: INT -> BIGINT"
+func (c Change) String() string {
+	target := c.Table
+	if c.Name != "" {
+		target += "." + c.Name
+	}
+	s := string(c.Kind) + " " + target
+	switch {
+	case c.Kind == RenameColumn:
+		s = fmt.Sprintf("%s %s.%s -> %s", c.Kind, c.Table, c.From, c.Name)
+	case c.From != "" || c.To != "":
+		s += ": " + c.From + " -> " + c.To
+	}
+	if c.Guessed {
+		s += " (guessed; declare it under renamed to confirm)"
+	}
+	return s
+}
+
+// Plan is the changes taking a database from its current schema to the
+// desired one
+type Plan struct {
+	Dialect string
+	Changes []Change
+}
+
+// Empty reports whether the schemas already match
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Destructive returns the changes that can lose data
+func (p *Plan) Destructive() []Change {
+	var changes []Change
+	for _, change := range p.Changes {
+		if change.Destructive {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// Statements returns the SQL of every change, in order
+func (p *Plan) Statements() []string {
+	var stmts []string
+	for _, change := range p.Changes {
+		stmts = append(stmts, change.SQL...)
+	}
+	return stmts
+}
+
+// DestructiveError refuses a plan with destructive changes
+type DestructiveError struct {
+	Changes []Change
+}
+
+// Error lists the refused changes
+func (e *DestructiveError) Error() string {
+	descriptions := make([]string, len(e.Changes))
+	for i, change := range e.Changes {
+		descriptions[i] = change.String()
+	}
+	return fmt.Sprintf("refusing %d destructive changes without allowing them: %s", len(e.Changes), strings.Join(descriptions, "; "))
+}
+
+// Check returns a *DestructiveError when the plan has destructive changes
+// and allowDestructive is false
+func (p *Plan) Check(allowDestructive bool) error {
+	if changes := p.Destructive(); len(changes) > 0 && !allowDestructive {
+		return &DestructiveError{Changes: changes}
+	}
+	return nil
+}
+
+// Apply checks the plan and runs its statements, in one transaction when
+// db supports them. MySQL commits DDL as it goes, so a failure there can
+// leave the plan half applied.
+func (p *Plan) Apply(db DB, allowDestructive bool) error {
+	if err := p.Check(allowDestructive); err != nil {
+		return err
+	}
+	stmts := p.Statements()
+	if len(stmts) == 0 {
+		return nil
+	}
+
+	txdb, ok := db.(TxDB)
+	if !ok {
+		for _, stmt := range stmts {
+			if err := db.Execute(stmt); err != nil {
+				return fmt.Errorf("failed to apply %q: %w", stmt, err)
+			}
+		}
+		return nil
+	}
+
+	tx, err := txdb.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	for _, stmt := range stmts {
+		if err := tx.Execute(stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply %q (rolled back): %w", stmt, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit schema changes: %w", err)
+	}
+	return nil
+}
+
+// Diff plans the changes from current, an inspected schema, to desired.
+// Tables missing from desired are dropped, so inspect only the tables
+// desired manages.
+func Diff(current, desired *Schema) *Plan {
+	plan := &Plan{Dialect: current.Dialect}
+	for _, name := range desired.TableNames() {
+		want := desired.Tables[name]
+		have, ok := current.Tables[name]
+		if !ok {
+			plan.Changes = append(plan.Changes, Change{Kind: CreateTable, Table: name, SQL: createTable(want, name)})
+			continue
+		}
+		plan.Changes = append(plan.Changes, diffTable(have, want, plan.Dialect)...)
+	}
+	for _, name := range current.TableNames() {
+		if _, ok := desired.Tables[name]; !ok {
+			plan.Changes = append(plan.Changes, Change{Kind: DropTable, Table: name, Destructive: true, SQL: []string{"DROP TABLE " + name}})
+		}
+	}
+	return plan
+}
+
+// diffTable plans the changes to one existing table: renames, added
+// columns, alterations, dropped columns, then indexes
+func diffTable(have, want *Table, dialect string) []Change {
+	// renames maps old names to new ones
+	renames := make(map[string]string)
+	guessed := ""
+	for newName, oldName := range want.Renamed {
+		if have.Column(oldName) != nil && have.Column(newName) == nil && want.Column(newName) != nil {
+			renames[strings.ToLower(oldName)] = newName
+		}
+	}
+	renamedTo := func(name string) bool {
+		for _, newName := range renames {
+			if strings.EqualFold(newName, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var added, dropped []*Column
+	for _, column := range want.Columns {
+		if have.Column(column.Name) == nil && !renamedTo(column.Name) {
+			added = append(added, column)
+		}
+	}
+	for _, column := range have.Columns {
+		if want.Column(column.Name) == nil && renames[strings.ToLower(column.Name)] == "" {
+			dropped = append(dropped, column)
+		}
+	}
+	if len(added) == 1 && len(dropped) == 1 && normalizeType(added[0].Type) == normalizeType(dropped[0].Type) {
+		renames[strings.ToLower(dropped[0].Name)] = added[0].Name
+		guessed = added[0].Name
+		added, dropped = nil, nil
+	}
+
+	var changes []Change
+	for _, column := range have.Columns {
+		if newName := renames[strings.ToLower(column.Name)]; newName != "" {
+			changes = append(changes, Change{
+				Kind: RenameColumn, Table: want.Name, Name: newName, From: column.Name, To: newName, Guessed: newName == guessed, Destructive: newName == guessed,
+				SQL: []string{fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", want.Name, column.Name, newName)},
+			})
+		}
+	}
+	for _, column := range added {
+		changes = append(changes, Change{
+			Kind: AddColumn, Table: want.Name, Name: column.Name,
+			SQL: []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", want.Name, column.Name, column.Definition)},
+		})
+	}
+
+	rebuild := false
+	for _, column := range want.Columns {
+		old := have.Column(column.Name)
+		for oldName, newName := range renames {
+			if strings.EqualFold(newName, column.Name) {
+				old = have.Column(oldName)
+			}
+		}
+		if old == nil {
+			continue
+		}
+		typeChanged := normalizeType(old.Type) != normalizeType(column.Type)
+		if !typeChanged && old.NotNull == column.NotNull && normalizeDefault(old.Default) == normalizeDefault(column.Default) {
+			continue
+		}
+		change := Change{
+			Kind: AlterColumn, Table: want.Name, Name: column.Name,
+			From: old.Definition, To: column.Definition, Destructive: typeChanged,
+		}
+		switch dialect {
+		case PostgreSQL:
+			change.SQL = alterPostgreSQL(want.Name, old, column, typeChanged)
+		case MySQL:
+			change.SQL = []string{fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", want.Name, column.Name, column.Definition)}
+		default:
+			// SQLite cannot alter columns; the table is rebuilt instead
+			rebuild = true
+		}
+		changes = append(changes, change)
+	}
+
+	for _, column := range dropped {
+		changes = append(changes, Change{
+			Kind: DropColumn, Table: want.Name, Name: column.Name, Destructive: true,
+			SQL: []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", want.Name, column.Name)},
+		})
+	}
+
+	for _, index := range have.Indexes {
+		if wanted := want.Index(index.Name); wanted == nil || !sameIndex(index, wanted) {
+			changes = append(changes, Change{Kind: DropIndex, Table: want.Name, Name: index.Name, SQL: []string{dropIndex(index, want.Name, dialect)}})
+		}
+	}
+	for _, index := range want.Indexes {
+		if existing := have.Index(index.Name); existing == nil || !sameIndex(existing, index) {
+			changes = append(changes, Change{Kind: CreateIndex, Table: want.Name, Name: index.Name, SQL: []string{createIndex(index, want.Name)}})
+		}
+	}
+
+	if rebuild && len(changes) > 0 {
+		for i := range changes {
+			changes[i].SQL = nil
+		}
+		changes[0].SQL = rebuildSQLite(have, want, renames)
+	}
+	return changes
+}
+
+// alterPostgreSQL alters one column in place
+func alterPostgreSQL(table string, old, column *Column, typeChanged bool) []string {
+	prefix := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ", table, column.Name)
+	var stmts []string
+	if typeChanged {
+		stmts = append(stmts, prefix+fmt.Sprintf("TYPE %s USING %s::%s", column.Type, column.Name, column.Type))
+	}
+	if old.NotNull != column.NotNull {
+		if column.NotNull {
+			stmts = append(stmts, prefix+"SET NOT NULL")
+		} else {
+			stmts = append(stmts, prefix+"DROP NOT NULL")
+		}
+	}
+	if normalizeDefault(old.Default) != normalizeDefault(column.Default) {
+		if column.Default == "" {
+			stmts = append(stmts, prefix+"DROP DEFAULT")
+		} else {
+			stmts = append(stmts, prefix+"SET DEFAULT "+column.Default)
+		}
+	}
+	return stmts
+}
+
+// rebuildSQLite recreates a table with its desired columns, copying the
+// data of the columns it keeps, and recreates its indexes
+func rebuildSQLite(have, want *Table, renames map[string]string) []string {
+	temp := want.Name + "__new"
+	var targets, sources []string
+	for _, column := range want.Columns {
+		source := ""
+		if have.Column(column.Name) != nil {
+			source = column.Name
+		}
+		for oldName, newName := range renames {
+			if strings.EqualFold(newName, column.Name) {
+				source = oldName
+			}
+		}
+		if source != "" {
+			targets = append(targets, column.Name)
+			sources = append(sources, source)
+		}
+	}
+
+	stmts := createTable(want, temp)[:1]
+	stmts = append(stmts,
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", temp, strings.Join(targets, ", "), strings.Join(sources, ", "), have.Name),
+		"DROP TABLE "+have.Name,
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", temp, want.Name),
+	)
+	for _, index := range want.Indexes {
+		stmts = append(stmts, createIndex(index, want.Name))
+	}
+	return stmts
+}
+
+// inlinePrimaryKey is dropped from column definitions of composite keys
+var inlinePrimaryKey = regexp.MustCompile(`(?i)\s*PRIMARY\s+KEY`)
+
+// createTable creates table under name, then its indexes
+func createTable(table *Table, name string) []string {
+	definitions := make([]string, 0, len(table.Columns))
+	var primary []string
+	for _, column := range table.Columns {
+		if column.PrimaryKey {
+			primary = append(primary, column.Name)
+		}
+	}
+	for _, column := range table.Columns {
+		def := column.Name + " " + column.Definition
+		if len(primary) > 1 {
+			def = column.Name + " " + inlinePrimaryKey.ReplaceAllString(column.Definition, "")
+		}
+		definitions = append(definitions, def)
+	}
+	if len(primary) > 1 {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(primary, ", ")))
+	}
+	stmts := []string{fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", name, strings.Join(definitions, ",\n  "))}
+	for _, index := range table.Indexes {
+		stmts = append(stmts, createIndex(index, table.Name))
+	}
+	return stmts
+}
+
+func createIndex(index *Index, table string) string {
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, index.Name, table, strings.Join(index.Columns, ", "))
+}
+
+func dropIndex(index *Index, table, dialect string) string {
+	if dialect == MySQL {
+		return fmt.Sprintf("DROP INDEX %s ON %s", index.Name, table)
+	}
+	return "DROP INDEX " + index.Name
+}
+
+// sameIndex reports whether two indexes cover the same columns the same way
+func sameIndex(a, b *Index) bool {
+	if a.Unique != b.Unique || len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for i := range a.Columns {
+		if !strings.EqualFold(a.Columns[i], b.Columns[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// typeAliases maps type spellings to one name, so INT and integer compare
+// equal across dialects
+var typeAliases = map[string]string{
+	"INT":                         "INTEGER",
+	"INT4":                        "INTEGER",
+	"SERIAL":                      "INTEGER",
+	"INT8":                        "BIGINT",
+	"BIGSERIAL":                   "BIGINT",
+	"INT2":                        "SMALLINT",
+	"BOOL":                        "BOOLEAN",
+	"TINYINT(1)":                  "BOOLEAN",
+	"CHARACTER VARYING":           "VARCHAR",
+	"CHARACTER":                   "CHAR",
+	"DOUBLE PRECISION":            "DOUBLE",
+	"FLOAT8":                      "DOUBLE",
+	"REAL":                        "FLOAT",
+	"FLOAT4":                      "FLOAT",
+	"TIMESTAMP WITHOUT TIME ZONE": "TIMESTAMP",
+	"TIMESTAMP WITH TIME ZONE":    "TIMESTAMPTZ",
+}
+
+// integerWidth matches MySQL display widths such as INT(11)
+var integerWidth = regexp.MustCompile(`^(TINYINT|SMALLINT|MEDIUMINT|INT|INTEGER|BIGINT)\(\d+\)`)
+
+// normalizeType spells a column type the same way in every dialect
+func normalizeType(typ string) string {
+	typ = strings.Join(strings.Fields(strings.ToUpper(typ)), " ")
+	typ = strings.ReplaceAll(strings.ReplaceAll(typ, " (", "("), ", ", ",")
+	if alias, ok := typeAliases[typ]; ok {
+		return alias
+	}
+	if typ != "TINYINT(1)" {
+		typ = integerWidth.ReplaceAllString(typ, "$1")
+	}
+	base, size := typ, ""
+	if i := strings.Index(typ, "("); i >= 0 {
+		base, size = typ[:i], typ[i:]
+	}
+	if alias, ok := typeAliases[base]; ok {
+		base = alias
+	}
+	return base + size
+}
+
+// postgresCast matches a trailing ::type cast
+var postgresCast = regexp.MustCompile(`::[a-zA-Z ]+(\[\])?$`)
+
+// normalizeDefault spells a default value the same way in every dialect;
+// sequence defaults of serial columns count as none
+func normalizeDefault(value string) string {
+	value = strings.TrimSpace(value)
+	for strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	value = postgresCast.ReplaceAllString(value, "")
+	if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) >= 2 {
+		return value[1 : len(value)-1]
+	}
+	if strings.EqualFold(value, "NULL") || strings.HasPrefix(strings.ToLower(value), "nextval(") {
+		return ""
+	}
+	return strings.ToUpper(value)
+}
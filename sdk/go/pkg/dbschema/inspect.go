@@ -0,0 +1,281 @@
+package dbschema
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+)
+
+// DB is the part of a database adapter inspection and migration need
+type DB interface {
+	Query(query string, args ...interface{}) (*databasetypes.Result, error)
+	Execute(query string, args ...interface{}) error
+}
+
+// TxDB is a DB that supports transactions
+type TxDB interface {
+	DB
+	BeginTransaction() (databasetypes.Transaction, error)
+}
+
+// Dialects with schema support
+const (
+	SQLite     = "sqlite"
+	PostgreSQL = "postgresql"
+	MySQL      = "mysql"
+)
+
+// Detect works out the SQL dialect of db
+func Detect(db DB) (string, error) {
+	if _, err := db.Query("SELECT sqlite_version()"); err == nil {
+		return SQLite, nil
+	}
+	result, err := db.Query("SELECT version() AS version")
+	if err != nil || len(result.Rows) == 0 {
+		return "", fmt.Errorf("failed to detect the SQL dialect: %v", err)
+	}
+	if strings.Contains(text(result.Rows[0]["version"]), "PostgreSQL") {
+		return PostgreSQL, nil
+	}
+	return MySQL, nil
+}
+
+// Inspect reads the schema of db, limited to tables when any are given
+func Inspect(db DB, dialect string, tables ...string) (*Schema, error) {
+	var inspect func(db DB, schema *Schema) error
+	switch dialect {
+	case SQLite:
+		inspect = inspectSQLite
+	case PostgreSQL:
+		inspect = inspectPostgreSQL
+	case MySQL:
+		inspect = inspectMySQL
+	default:
+		return nil, fmt.Errorf("schema inspection is not supported for %s", dialect)
+	}
+
+	schema := New()
+	schema.Dialect = dialect
+	if err := inspect(db, schema); err != nil {
+		return nil, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	if len(tables) > 0 {
+		keep := make(map[string]bool)
+		for _, table := range tables {
+			keep[table] = true
+		}
+		for name := range schema.Tables {
+			if !keep[name] {
+				delete(schema.Tables, name)
+			}
+		}
+	}
+	for _, table := range schema.Tables {
+		for _, column := range table.Columns {
+			column.Definition = definition(column)
+		}
+		sort.Slice(table.Indexes, func(i, j int) bool { return table.Indexes[i].Name < table.Indexes[j].Name })
+	}
+	return schema, nil
+}
+
+// definition rebuilds the definition of an inspected column
+func definition(column *Column) string {
+	parts := []string{column.Type}
+	if column.PrimaryKey {
+		parts = append(parts, "PRIMARY KEY")
+	} else if column.NotNull {
+		parts = append(parts, "NOT NULL")
+	}
+	if column.Default != "" {
+		parts = append(parts, "DEFAULT "+column.Default)
+	}
+	return strings.Join(parts, " ")
+}
+
+// table returns the table called name, adding it when missing
+func (s *Schema) table(name string) *Table {
+	table, ok := s.Tables[name]
+	if !ok {
+		table = &Table{Name: name, Renamed: make(map[string]string)}
+		s.Tables[name] = table
+	}
+	return table
+}
+
+func inspectSQLite(db DB, schema *Schema) error {
+	tables, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return err
+	}
+	for _, row := range tables.Rows {
+		table := schema.table(text(row["name"]))
+		columns, err := db.Query("PRAGMA table_info(" + quoteString(table.Name) + ")")
+		if err != nil {
+			return err
+		}
+		for _, col := range columns.Rows {
+			table.Columns = append(table.Columns, &Column{
+				Name:       text(col["name"]),
+				Type:       text(col["type"]),
+				NotNull:    text(col["notnull"]) == "1" || text(col["pk"]) != "0",
+				Default:    text(col["dflt_value"]),
+				PrimaryKey: text(col["pk"]) != "0",
+			})
+		}
+
+		indexes, err := db.Query("PRAGMA index_list(" + quoteString(table.Name) + ")")
+		if err != nil {
+			return err
+		}
+		for _, idx := range indexes.Rows {
+			// Only CREATE INDEX indexes; the others back constraints
+			if text(idx["origin"]) != "c" {
+				continue
+			}
+			index := &Index{Name: text(idx["name"]), Unique: text(idx["unique"]) == "1"}
+			info, err := db.Query("PRAGMA index_info(" + quoteString(index.Name) + ")")
+			if err != nil {
+				return err
+			}
+			sort.Slice(info.Rows, func(i, j int) bool { return number(info.Rows[i]["seqno"]) < number(info.Rows[j]["seqno"]) })
+			for _, col := range info.Rows {
+				index.Columns = append(index.Columns, text(col["name"]))
+			}
+			table.Indexes = append(table.Indexes, index)
+		}
+	}
+	return nil
+}
+
+func inspectPostgreSQL(db DB, schema *Schema) error {
+	columns, err := db.Query(`SELECT c.table_name, c.column_name, c.data_type, c.character_maximum_length,
+		c.is_nullable, c.column_default,
+		EXISTS (SELECT 1 FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage k ON k.constraint_name = tc.constraint_name AND k.table_schema = tc.table_schema
+			WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema
+			AND k.table_name = c.table_name AND k.column_name = c.column_name) AS is_primary
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = current_schema() AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position`)
+	if err != nil {
+		return err
+	}
+	for _, row := range columns.Rows {
+		table := schema.table(text(row["table_name"]))
+		typ := strings.ToUpper(text(row["data_type"]))
+		if length := text(row["character_maximum_length"]); length != "" {
+			typ = fmt.Sprintf("%s(%s)", typ, length)
+		}
+		primary := text(row["is_primary"])
+		table.Columns = append(table.Columns, &Column{
+			Name:       text(row["column_name"]),
+			Type:       typ,
+			NotNull:    text(row["is_nullable"]) == "NO",
+			Default:    text(row["column_default"]),
+			PrimaryKey: primary == "true" || primary == "t",
+		})
+	}
+
+	// Indexes backing constraints are managed with the constraint
+	indexes, err := db.Query(`SELECT tablename, indexname, indexdef FROM pg_indexes
+		WHERE schemaname = current_schema() AND indexname NOT IN (
+			SELECT constraint_name FROM information_schema.table_constraints WHERE table_schema = current_schema())
+		ORDER BY tablename, indexname`)
+	if err != nil {
+		return err
+	}
+	for _, row := range indexes.Rows {
+		table, ok := schema.Tables[text(row["tablename"])]
+		if !ok {
+			continue
+		}
+		def := text(row["indexdef"])
+		open, close := strings.LastIndex(def, "("), strings.LastIndex(def, ")")
+		if open < 0 || close < open {
+			continue
+		}
+		index, err := ParseIndex(text(row["indexname"]), def[open:close+1])
+		if err != nil {
+			return err
+		}
+		index.Unique = strings.HasPrefix(strings.ToUpper(def), "CREATE UNIQUE")
+		table.Indexes = append(table.Indexes, index)
+	}
+	return nil
+}
+
+func inspectMySQL(db DB, schema *Schema) error {
+	columns, err := db.Query(`SELECT c.table_name AS table_name, c.column_name AS column_name, c.column_type AS column_type,
+		c.is_nullable AS is_nullable, c.column_default AS column_default, c.column_key AS column_key
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = DATABASE() AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position`)
+	if err != nil {
+		return err
+	}
+	for _, row := range columns.Rows {
+		table := schema.table(text(row["table_name"]))
+		column := &Column{
+			Name:       text(row["column_name"]),
+			Type:       strings.ToUpper(text(row["column_type"])),
+			NotNull:    text(row["is_nullable"]) == "NO",
+			PrimaryKey: text(row["column_key"]) == "PRI",
+		}
+		if row["column_default"] != nil {
+			column.Default = quoteString(text(row["column_default"]))
+		}
+		table.Columns = append(table.Columns, column)
+	}
+
+	indexes, err := db.Query(`SELECT table_name AS table_name, index_name AS index_name, non_unique AS non_unique,
+		column_name AS column_name FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND index_name <> 'PRIMARY'
+		ORDER BY table_name, index_name, seq_in_index`)
+	if err != nil {
+		return err
+	}
+	for _, row := range indexes.Rows {
+		table, ok := schema.Tables[text(row["table_name"])]
+		if !ok {
+			continue
+		}
+		name := text(row["index_name"])
+		index := table.Index(name)
+		if index == nil {
+			index = &Index{Name: name, Unique: text(row["non_unique"]) == "0"}
+			table.Indexes = append(table.Indexes, index)
+		}
+		index.Columns = append(index.Columns, text(row["column_name"]))
+	}
+	return nil
+}
+
+// text converts a scanned value to a string; NULL is empty
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// number converts a scanned value to an int
+func number(value interface{}) int {
+	n, _ := strconv.Atoi(text(value))
+	return n
+}
+
+// quoteString quotes a SQL string literal
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,207 @@
+// Package dbschema compares a database's schema with the schema it should
+// have and plans the changes between them. The desired schema comes from a
+// schema file or from ORM models:
+//
+//	[users]
+//	columns {
+//	    id: "INTEGER PRIMARY KEY"
+//	    email: "VARCHAR(255) NOT NULL"
+//	    name: "TEXT"
+//	}
+//	indexes {
+//	    idx_users_email: "UNIQUE (email)"
+//	}
+//	renamed {
+//	    name: "full_name"
+//	}
+//
+// renamed maps new column names to old ones, so a rename keeps its data
+// instead of planning a drop and an add.
+package dbschema
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+)
+
+// DefaultFile is where the desired schema is looked for
+const DefaultFile = "schema.tsk"
+
+// Schema is a set of tables
+type Schema struct {
+	// Dialect is sqlite, postgresql or mysql; it is set by Inspect
+	Dialect string
+	Tables  map[string]*Table
+}
+
+// Table is a table's columns, in order, and its indexes
+type Table struct {
+	Name    string
+	Columns []*Column
+	Indexes []*Index
+	// Renamed maps new column names to the names they had before
+	Renamed map[string]string
+}
+
+// Column is one column of a table
+type Column struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	Default    string
+	PrimaryKey bool
+	// Definition is everything after the name in a column definition, such
+	// as "VARCHAR(255) NOT NULL DEFAULT 'none'"
+	Definition string
+}
+
+// Index is a named index over columns
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// New returns an empty schema
+func New() *Schema {
+	return &Schema{Tables: make(map[string]*Table)}
+}
+
+// TableNames returns the table names, sorted
+func (s *Schema) TableNames() []string {
+	names := make([]string, 0, len(s.Tables))
+	for name := range s.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Column returns the column called name, or nil
+func (t *Table) Column(name string) *Column {
+	for _, column := range t.Columns {
+		if strings.EqualFold(column.Name, name) {
+			return column
+		}
+	}
+	return nil
+}
+
+// Index returns the index called name, or nil
+func (t *Table) Index(name string) *Index {
+	for _, index := range t.Indexes {
+		if strings.EqualFold(index.Name, name) {
+			return index
+		}
+	}
+	return nil
+}
+
+// columnConstraint finds where the type ends and the constraints begin
+var columnConstraint = regexp.MustCompile(`(?i)\s+(NOT\s+NULL|NULL|PRIMARY\s+KEY|DEFAULT|UNIQUE|REFERENCES|AUTO_INCREMENT|AUTOINCREMENT|CHECK|COLLATE|GENERATED)\b`)
+
+// columnDefault captures a DEFAULT value: a quoted string, a parenthesized
+// expression or a single word
+var columnDefault = regexp.MustCompile(`(?i)\bDEFAULT\s+('(?:[^']|'')*'|\([^)]*\)|[^\s,]+)`)
+
+var (
+	primaryKey = regexp.MustCompile(`PRIMARY\s+KEY`)
+	notNull    = regexp.MustCompile(`NOT\s+NULL`)
+)
+
+// ParseColumn reads a column definition such as "INTEGER NOT NULL DEFAULT 0"
+func ParseColumn(name, definition string) *Column {
+	definition = strings.TrimSpace(definition)
+	column := &Column{Name: name, Definition: definition, Type: definition}
+	if loc := columnConstraint.FindStringIndex(definition); loc != nil {
+		column.Type = definition[:loc[0]]
+	}
+	rest := strings.ToUpper(definition[len(column.Type):])
+	column.PrimaryKey = primaryKey.MatchString(rest)
+	column.NotNull = column.PrimaryKey || notNull.MatchString(rest)
+	if m := columnDefault.FindStringSubmatch(definition); m != nil {
+		column.Default = m[1]
+	}
+	return column
+}
+
+// ParseIndex reads an index definition such as "UNIQUE (email, name)"
+func ParseIndex(name, definition string) (*Index, error) {
+	definition = strings.TrimSpace(definition)
+	index := &Index{Name: name}
+	if upper := strings.ToUpper(definition); strings.HasPrefix(upper, "UNIQUE") {
+		index.Unique = true
+		definition = strings.TrimSpace(definition[len("UNIQUE"):])
+	}
+	definition = strings.TrimSuffix(strings.TrimPrefix(definition, "("), ")")
+	for _, column := range strings.Split(definition, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			index.Columns = append(index.Columns, column)
+		}
+	}
+	if len(index.Columns) == 0 {
+		return nil, fmt.Errorf("index %s has no columns", name)
+	}
+	return index, nil
+}
+
+// Load reads the desired schema from a schema file
+func Load(path string) (*Schema, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	schema, err := Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// Parse reads the desired schema from schema file content
+func Parse(content []byte) (*Schema, error) {
+	cfg := config.New()
+	if err := cfg.LoadTSK(content); err != nil {
+		return nil, err
+	}
+
+	// Columns keep the order they are written in
+	keys := cfg.Keys()
+	sort.SliceStable(keys, func(i, j int) bool { return cfg.Line(keys[i]) < cfg.Line(keys[j]) })
+
+	schema := New()
+	for _, key := range keys {
+		parts := strings.SplitN(key, ".", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("line %d: %s is not <table>.columns, .indexes or .renamed", cfg.Line(key), key)
+		}
+		tableName, section, name := parts[0], parts[1], parts[2]
+		table := schema.table(tableName)
+		value := cfg.GetString(key)
+		switch section {
+		case "columns":
+			table.Columns = append(table.Columns, ParseColumn(name, value))
+		case "indexes":
+			index, err := ParseIndex(name, value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", cfg.Line(key), err)
+			}
+			table.Indexes = append(table.Indexes, index)
+		case "renamed":
+			table.Renamed[name] = value
+		default:
+			return nil, fmt.Errorf("line %d: unknown section %s in table %s", cfg.Line(key), section, tableName)
+		}
+	}
+	for _, table := range schema.Tables {
+		if len(table.Columns) == 0 {
+			return nil, fmt.Errorf("table %s has no columns", table.Name)
+		}
+	}
+	return schema, nil
+}
@@ -0,0 +1,429 @@
+// Package dbseed fills tables with rows declared in .tsk seed files:
+//
+//	# seeds/users.tsk
+//	env: ["development", "test"]
+//
+//	[users]
+//	key: "email"
+//	rows {
+//	    admin {
+//	        name: "Admin"
+//	        email: "admin@example.com"
+//	        password: @env("ADMIN_PASSWORD", "secret")
+//	        created_at: @date("Y-m-d H:i:s")
+//	    }
+//	}
+//
+//	[posts]
+//	key: ["user_id", "title"]
+//	depends: ["users"]
+//	rows {
+//	    welcome {
+//	        user_id: 1
+//	        title: "Welcome"
+//	    }
+//	}
+//
+// Each section seeds one table. Rows are matched on the key columns (id by
+// default): existing rows are updated and missing ones inserted, so seeding
+// twice leaves the same data. Tables are seeded after the tables they
+// depend on. Files with an env list only run for those environments.
+package dbseed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	"github.com/cyber-boost/tusktsk/pkg/dbschema"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// DefaultDir is where seed files are looked for
+const DefaultDir = "seeds"
+
+// DefaultKey is the column rows are matched on when a table names none
+const DefaultKey = "id"
+
+// File is one seed file
+type File struct {
+	Path string
+	// Env lists the environments the file runs in; empty means all
+	Env    []string
+	Tables []*Table
+}
+
+// Table is the rows one file seeds into a table
+type Table struct {
+	Name    string
+	File    string
+	Key     []string
+	Depends []string
+	Rows    []*Row
+}
+
+// Row is one named row, with its columns in file order
+type Row struct {
+	Name    string
+	Columns []string
+	Values  map[string]interface{}
+}
+
+// Name returns the file's name without directory or extension
+func (f *File) Name() string {
+	return strings.TrimSuffix(filepath.Base(f.Path), filepath.Ext(f.Path))
+}
+
+// InEnv reports whether the file runs in env. Files without an env list
+// run everywhere; files with one are skipped when env is empty.
+func (f *File) InEnv(env string) bool {
+	if len(f.Env) == 0 {
+		return true
+	}
+	for _, e := range f.Env {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the seed files in dir, ordered by name
+func Load(dir string) ([]*File, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tsk"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seeds: %w", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to read seeds: %w", err)
+	}
+	sort.Strings(paths)
+
+	files := make([]*File, 0, len(paths))
+	for _, path := range paths {
+		file, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// LoadFile reads one seed file
+func LoadFile(path string) (*File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed file: %w", err)
+	}
+	file, err := Parse(path, content, peanut.NewVM())
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Parse reads seed file content, evaluating operators such as @env and
+// @date with vm
+func Parse(path string, content []byte, vm *peanut.VM) (*File, error) {
+	cfg := config.New()
+	if err := cfg.LoadTSK(content); err != nil {
+		return nil, err
+	}
+	values, err := peanut.FromValues(cfg.Values()).Execute(vm)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tables and rows keep the order they are written in
+	keys := cfg.Keys()
+	sort.SliceStable(keys, func(i, j int) bool { return cfg.Line(keys[i]) < cfg.Line(keys[j]) })
+
+	file := &File{Path: path}
+	tables := make(map[string]*Table)
+	for _, key := range keys {
+		value := values[key]
+		parts := strings.SplitN(key, ".", 4)
+		if len(parts) == 1 {
+			if key != "env" {
+				return nil, fmt.Errorf("line %d: unknown setting %s", cfg.Line(key), key)
+			}
+			file.Env = stringList(value)
+			continue
+		}
+
+		table, ok := tables[parts[0]]
+		if !ok {
+			table = &Table{Name: parts[0], File: path}
+			tables[parts[0]] = table
+			file.Tables = append(file.Tables, table)
+		}
+		switch {
+		case len(parts) == 2 && parts[1] == "key":
+			table.Key = stringList(value)
+		case len(parts) == 2 && parts[1] == "depends":
+			table.Depends = stringList(value)
+		case len(parts) == 4 && parts[1] == "rows":
+			table.row(parts[2]).set(parts[3], value)
+		default:
+			return nil, fmt.Errorf("line %d: %s is not <table>.key, .depends or .rows.<row>.<column>", cfg.Line(key), key)
+		}
+	}
+
+	for _, table := range file.Tables {
+		if len(table.Key) == 0 {
+			table.Key = []string{DefaultKey}
+		}
+		for _, row := range table.Rows {
+			for _, column := range table.Key {
+				if row.Values[column] == nil {
+					return nil, fmt.Errorf("row %s.%s has no value for key column %s", table.Name, row.Name, column)
+				}
+			}
+		}
+	}
+	return file, nil
+}
+
+// row returns the row called name, adding it if needed
+func (t *Table) row(name string) *Row {
+	for _, row := range t.Rows {
+		if row.Name == name {
+			return row
+		}
+	}
+	row := &Row{Name: name, Values: make(map[string]interface{})}
+	t.Rows = append(t.Rows, row)
+	return row
+}
+
+func (r *Row) set(column string, value interface{}) {
+	if _, ok := r.Values[column]; !ok {
+		r.Columns = append(r.Columns, column)
+	}
+	r.Values[column] = value
+}
+
+// stringList reads a setting that is a single string or a list of them
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	default:
+		var list []string
+		for _, item := range strings.Split(fmt.Sprint(v), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+}
+
+// Select returns the files that run in env. Given names, only the files
+// with those names or paths are returned.
+func Select(files []*File, env string, names ...string) ([]*File, error) {
+	var selected []*File
+	for _, name := range names {
+		found := false
+		for _, file := range files {
+			if file.Path == name || file.Name() == name || filepath.Base(file.Path) == name {
+				selected = append(selected, file)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("seed file %s not found", name)
+		}
+	}
+	if len(names) == 0 {
+		selected = files
+	}
+
+	var result []*File
+	for _, file := range selected {
+		if file.InEnv(env) {
+			result = append(result, file)
+		}
+	}
+	return result, nil
+}
+
+// Order returns the tables of files so that every table comes after the
+// tables it depends on. Dependencies on tables that are not seeded are
+// assumed to be in place already; otherwise tables keep file order.
+func Order(files []*File) ([]*Table, error) {
+	var tables []*Table
+	for _, file := range files {
+		tables = append(tables, file.Tables...)
+	}
+
+	ordered := make([]*Table, 0, len(tables))
+	done := make(map[*Table]bool)
+	for len(ordered) < len(tables) {
+		progress := false
+		for _, table := range tables {
+			if done[table] || !ready(table, tables, done) {
+				continue
+			}
+			ordered = append(ordered, table)
+			done[table] = true
+			progress = true
+		}
+		if !progress {
+			var stuck []string
+			for _, table := range tables {
+				if !done[table] {
+					stuck = append(stuck, table.Name)
+				}
+			}
+			return nil, fmt.Errorf("circular seed dependencies between %s", strings.Join(stuck, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// ready reports whether every table that table depends on is done
+func ready(table *Table, tables []*Table, done map[*Table]bool) bool {
+	for _, dep := range table.Depends {
+		for _, other := range tables {
+			if other.Name == dep && other.Name != table.Name && !done[other] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// DB is the part of a database adapter seeding needs
+type DB interface {
+	Query(query string, args ...interface{}) (*databasetypes.Result, error)
+	Execute(query string, args ...interface{}) error
+}
+
+// TxDB is a DB that supports transactions
+type TxDB interface {
+	DB
+	BeginTransaction() (databasetypes.Transaction, error)
+}
+
+// Result counts what seeding did to one table
+type Result struct {
+	Table    string
+	File     string
+	Inserted int
+	Updated  int
+}
+
+// Run seeds tables in order, in one transaction when db supports them
+func Run(db DB, tables []*Table) ([]Result, error) {
+	dialect, err := dbschema.Detect(db)
+	if err != nil {
+		return nil, err
+	}
+
+	txdb, ok := db.(TxDB)
+	if !ok {
+		return seed(db, dialect, tables)
+	}
+	tx, err := txdb.BeginTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	results, err := seed(tx, dialect, tables)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w (rolled back)", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit seed data: %w", err)
+	}
+	return results, nil
+}
+
+func seed(db DB, dialect string, tables []*Table) ([]Result, error) {
+	results := make([]Result, 0, len(tables))
+	for _, table := range tables {
+		result := Result{Table: table.Name, File: table.File}
+		for _, row := range table.Rows {
+			inserted, err := upsert(db, dialect, table, row)
+			if err != nil {
+				return nil, fmt.Errorf("failed to seed %s.%s: %w", table.Name, row.Name, err)
+			}
+			if inserted {
+				result.Inserted++
+			} else {
+				result.Updated++
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// upsert updates the row matching row's key columns, or inserts row when
+// there is none. It reports whether it inserted.
+func upsert(db DB, dialect string, table *Table, row *Row) (bool, error) {
+	var keyArgs []interface{}
+	isKey := make(map[string]bool)
+	for _, column := range table.Key {
+		isKey[column] = true
+		keyArgs = append(keyArgs, row.Values[column])
+	}
+
+	existing, err := db.Query(fmt.Sprintf("SELECT COUNT(*) AS n FROM %s WHERE %s", table.Name, conditions(table.Key, dialect, 1)), keyArgs...)
+	if err != nil {
+		return false, err
+	}
+	if len(existing.Rows) > 0 && fmt.Sprint(existing.Rows[0]["n"]) != "0" {
+		var set []string
+		var args []interface{}
+		for _, column := range row.Columns {
+			if !isKey[column] {
+				set = append(set, column+" = "+placeholder(dialect, len(set)+1))
+				args = append(args, row.Values[column])
+			}
+		}
+		if len(set) == 0 {
+			return false, nil
+		}
+		query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", table.Name, strings.Join(set, ", "), conditions(table.Key, dialect, len(set)+1))
+		return false, db.Execute(query, append(args, keyArgs...)...)
+	}
+
+	marks := make([]string, len(row.Columns))
+	args := make([]interface{}, len(row.Columns))
+	for i, column := range row.Columns {
+		marks[i] = placeholder(dialect, i+1)
+		args[i] = row.Values[column]
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table.Name, strings.Join(row.Columns, ", "), strings.Join(marks, ", "))
+	return true, db.Execute(query, args...)
+}
+
+// conditions matches columns against placeholders numbered from first
+func conditions(columns []string, dialect string, first int) string {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		parts[i] = column + " = " + placeholder(dialect, first+i)
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// placeholder returns the n-th bind parameter of dialect
+func placeholder(dialect string, n int) string {
+	if dialect == dbschema.PostgreSQL {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
@@ -0,0 +1,248 @@
+package dbseed
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteDB runs statements on a SQLite database
+type sqliteDB struct{ db *sql.DB }
+
+func (s *sqliteDB) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &databasetypes.Result{Columns: columns}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{})
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqliteDB) Execute(query string, args ...interface{}) error {
+	_, err := s.db.Exec(query, args...)
+	return err
+}
+
+func openDB(t *testing.T) *sqliteDB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email TEXT, role TEXT);
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users (id), title TEXT);
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		t.Fatal(err)
+	}
+	return &sqliteDB{db: db}
+}
+
+func writeSeeds(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// Files sort before the tables they depend on, so ordering is exercised
+var seeds = map[string]string{
+	"01_posts.tsk": `
+[posts]
+key: ["user_id", "title"]
+depends: ["users"]
+rows {
+    welcome {
+        user_id: 1
+        title: "Welcome"
+    }
+}
+`,
+	"02_users.tsk": `
+[users]
+key: "email"
+rows {
+    admin {
+        id: 1
+        name: "Admin"
+        email: "admin@example.com"
+        role: @env("SEED_ADMIN_ROLE", "admin")
+    }
+    user {
+        id: 2
+        name: "User"
+        email: "user@example.com"
+    }
+}
+`,
+	"03_demo.tsk": `
+env: ["development"]
+
+[users]
+key: "email"
+rows {
+    demo {
+        id: 3
+        name: "Demo"
+        email: "demo@example.com"
+    }
+}
+`,
+}
+
+func TestParse(t *testing.T) {
+	t.Setenv("SEED_ADMIN_ROLE", "owner")
+	file, err := Parse("02_users.tsk", []byte(seeds["02_users.tsk"]), peanut.NewVM())
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	users := file.Tables[0]
+	if users.Name != "users" || !reflect.DeepEqual(users.Key, []string{"email"}) || len(users.Rows) != 2 {
+		t.Fatalf("table = %+v", users)
+	}
+	admin := users.Rows[0]
+	if !reflect.DeepEqual(admin.Columns, []string{"id", "name", "email", "role"}) {
+		t.Errorf("columns = %v; want them in file order", admin.Columns)
+	}
+	if admin.Values["role"] != "owner" || admin.Values["email"] != "admin@example.com" {
+		t.Errorf("values = %v; want @env evaluated and e-mail addresses kept", admin.Values)
+	}
+
+	if _, err := Parse("bad.tsk", []byte("[users]\nrows {\n    a {\n        name: \"x\"\n    }\n}\n"), peanut.NewVM()); err == nil {
+		t.Error("a row without its key column should be rejected")
+	}
+	if _, err := Parse("bad.tsk", []byte("[users]\nname: \"x\"\n"), peanut.NewVM()); err == nil {
+		t.Error("a column outside rows {} should be rejected")
+	}
+}
+
+func TestSelectAndOrder(t *testing.T) {
+	files, err := Load(writeSeeds(t, seeds))
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	selected, err := Select(files, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 2 {
+		t.Errorf("selected %d files without an env; want the 2 unrestricted ones", len(selected))
+	}
+	if selected, _ := Select(files, "development"); len(selected) != 3 {
+		t.Errorf("selected %d files for development; want 3", len(selected))
+	}
+	if selected, _ := Select(files, "", "02_users"); len(selected) != 1 || selected[0].Name() != "02_users" {
+		t.Errorf("selected %v by name", selected)
+	}
+	if _, err := Select(files, "", "missing"); err == nil {
+		t.Error("selecting a missing file should fail")
+	}
+
+	tables, err := Order(selected)
+	if err != nil {
+		t.Fatalf("Order() returned error: %v", err)
+	}
+	var names []string
+	for _, table := range tables {
+		names = append(names, table.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"users", "posts"}) {
+		t.Errorf("order = %v; want users before posts", names)
+	}
+
+	cyclic := []*File{{Tables: []*Table{
+		{Name: "a", Depends: []string{"b"}},
+		{Name: "b", Depends: []string{"a"}},
+	}}}
+	if _, err := Order(cyclic); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Errorf("Order() of a cycle returned %v", err)
+	}
+}
+
+func TestRunIsIdempotent(t *testing.T) {
+	db := openDB(t)
+	files, err := Load(writeSeeds(t, seeds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	selected, _ := Select(files, "development")
+	tables, err := Order(selected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Run(db, tables)
+	if err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	inserted := 0
+	for _, result := range results {
+		inserted += result.Inserted
+	}
+	if inserted != 4 {
+		t.Errorf("inserted %d rows; want 4: %+v", inserted, results)
+	}
+
+	if _, err := db.db.Exec("UPDATE users SET name = 'Changed' WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	results, err = Run(db, tables)
+	if err != nil {
+		t.Fatalf("second Run() returned error: %v", err)
+	}
+	for _, result := range results {
+		if result.Inserted != 0 {
+			t.Errorf("second run inserted into %s: %+v", result.Table, result)
+		}
+	}
+
+	var users, posts int
+	db.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users)
+	db.db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&posts)
+	if users != 3 || posts != 1 {
+		t.Errorf("got %d users and %d posts; want 3 and 1", users, posts)
+	}
+	var name, role string
+	if err := db.db.QueryRow("SELECT name, role FROM users WHERE id = 2").Scan(&name, &sql.NullString{}); err != nil || name != "User" {
+		t.Errorf("user 2 = %q, %v; want the seeded name restored", name, err)
+	}
+	if err := db.db.QueryRow("SELECT role FROM users WHERE id = 1").Scan(&role); err != nil || role != "admin" {
+		t.Errorf("admin role = %q, %v; want the @env default", role, err)
+	}
+}
@@ -0,0 +1,275 @@
+// Package docker packages TuskLang applications as container images, for
+// `tsk docker`. Init writes a multi-stage Dockerfile that compiles the
+// configuration to .pnt at build time next to the application; Bake adds a
+// compiled, optionally signed configuration to an image that already
+// exists, as one more layer.
+package docker
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// DockerCommand is the docker binary Bake runs
+var DockerCommand = "docker"
+
+// Defaults of InitOptions
+const (
+	DefaultGoVersion  = "1.22"
+	DefaultTskVersion = "latest"
+	DefaultBase       = "gcr.io/distroless/static-debian12:nonroot"
+	// DefaultCGOBase has the C library cgo binaries link against
+	DefaultCGOBase = "gcr.io/distroless/base-debian12:nonroot"
+	// SecretID is the build secret holding the signing key
+	SecretID = "tsk_signing_key"
+)
+
+// ConfigLabel is the image label Bake records the configuration digest in
+const ConfigLabel = "dev.tusktsk.config.digest"
+
+// InitOptions controls the generated Dockerfile. Empty fields are detected
+// from the project or take their defaults.
+type InitOptions struct {
+	// GoVersion of the build images, from the go directive of go.mod
+	GoVersion string `json:"go_version"`
+	// Main is the package to build: "." or the only ./cmd/<name>
+	Main string `json:"main"`
+	// Config is the configuration file compiled to peanu.pnt
+	Config string `json:"config"`
+	// TskVersion is the version of tsk installed to compile it
+	TskVersion string `json:"tsk_version"`
+	// Base is the runtime image
+	Base string `json:"base"`
+	// CGO builds with cgo enabled, on Debian images
+	CGO bool `json:"cgo"`
+	// Sign signs the binary with a key passed as the build secret SecretID
+	Sign bool `json:"sign"`
+	// PublicKey, a file in the project, is copied into the image and
+	// required of the configuration at runtime
+	PublicKey string `json:"public_key,omitempty"`
+	Port      int    `json:"port,omitempty"`
+}
+
+// Init detects what opts leave empty in the Go project in dir and returns
+// the options used together with a Dockerfile and a .dockerignore
+func Init(dir string, opts InitOptions) (InitOptions, []byte, []byte, error) {
+	if err := detect(dir, &opts); err != nil {
+		return opts, nil, nil, err
+	}
+	tmpl, err := template.ParseFS(templates, "templates/Dockerfile.tmpl")
+	if err != nil {
+		return opts, nil, nil, err
+	}
+	data := struct {
+		InitOptions
+		SecretID string
+	}{opts, SecretID}
+	var dockerfile bytes.Buffer
+	if err := tmpl.Execute(&dockerfile, data); err != nil {
+		return opts, nil, nil, err
+	}
+	ignore, err := templates.ReadFile("templates/dockerignore.tmpl")
+	if err != nil {
+		return opts, nil, nil, err
+	}
+	return opts, dockerfile.Bytes(), ignore, nil
+}
+
+// goDirective matches the go directive of a go.mod
+var goDirective = regexp.MustCompile(`(?m)^go\s+(\d+\.\d+)`)
+
+// detect fills the empty fields of opts from the project in dir
+func detect(dir string, opts *InitOptions) error {
+	mod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return fmt.Errorf("no go.mod in %s: tsk docker init generates Dockerfiles for Go applications", dir)
+	}
+	if opts.GoVersion == "" {
+		opts.GoVersion = DefaultGoVersion
+		if m := goDirective.FindSubmatch(mod); m != nil {
+			opts.GoVersion = string(m[1])
+		}
+	}
+	if opts.Main == "" {
+		if opts.Main, err = mainPackage(dir); err != nil {
+			return err
+		}
+	}
+	if opts.Config == "" {
+		for _, name := range []string{"peanu.tsk", "peanu.peanuts"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				opts.Config = name
+				break
+			}
+		}
+		if opts.Config == "" {
+			return fmt.Errorf("no peanu.tsk or peanu.peanuts in %s", dir)
+		}
+	}
+	if opts.TskVersion == "" {
+		opts.TskVersion = DefaultTskVersion
+	}
+	if opts.Base == "" {
+		opts.Base = DefaultBase
+		if opts.CGO {
+			opts.Base = DefaultCGOBase
+		}
+	}
+	if opts.PublicKey != "" {
+		if _, err := os.Stat(filepath.Join(dir, opts.PublicKey)); err != nil {
+			return fmt.Errorf("public key %s must be a file in %s: %w", opts.PublicKey, dir, err)
+		}
+	}
+	return nil
+}
+
+// mainPackage finds the main package of the project in dir: the root, or
+// the only directory under cmd
+func mainPackage(dir string) (string, error) {
+	if isMain(filepath.Join(dir, "main.go")) {
+		return ".", nil
+	}
+	var found []string
+	entries, _ := os.ReadDir(filepath.Join(dir, "cmd"))
+	for _, entry := range entries {
+		if entry.IsDir() && isMain(filepath.Join(dir, "cmd", entry.Name(), "main.go")) {
+			found = append(found, "./cmd/"+entry.Name())
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no main package in %s or %s/cmd; pass --main", dir, dir)
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("several main packages (%s); pass --main", strings.Join(found, ", "))
+}
+
+// mainClause matches the package clause of package main
+var mainClause = regexp.MustCompile(`(?m)^package main\b`)
+
+// isMain reports whether file is a Go file of package main
+func isMain(file string) bool {
+	data, err := os.ReadFile(file)
+	return err == nil && mainClause.Match(data)
+}
+
+// BakeOptions controls Bake
+type BakeOptions struct {
+	// Image is the image to add the configuration to
+	Image string
+	// Tag names the result; by default it replaces Image
+	Tag string
+	// Path is where the binary goes, by default peanu.pnt in the working
+	// directory of the image, where the hierarchy lookup finds it
+	Path string
+	// SigningKey signs the binary
+	SigningKey ed25519.PrivateKey
+	// PublicKey, a PEM file, is added next to the binary and required of
+	// it at runtime through TSK_BINARY_PUBLIC_KEY
+	PublicKey string
+}
+
+// BakeResult describes a baked image
+type BakeResult struct {
+	Image  string `json:"image"`
+	Tag    string `json:"tag"`
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+	Size   int    `json:"size"`
+	Signed bool   `json:"signed"`
+}
+
+// Bake compiles cfg to a .pnt binary and builds opts.Tag from opts.Image
+// with the binary added as one layer, labelled with its digest. It needs
+// docker; the build output is returned for display.
+func Bake(cfg *peanut.Config, opts BakeOptions) (*BakeResult, []byte, error) {
+	if opts.Image == "" {
+		return nil, nil, fmt.Errorf("no image to bake the configuration into")
+	}
+	if opts.Tag == "" {
+		opts.Tag = opts.Image
+	}
+	if _, err := exec.LookPath(DockerCommand); err != nil {
+		return nil, nil, fmt.Errorf("%s not found: install docker to bake images", DockerCommand)
+	}
+
+	write := peanut.WriteOptions{Version: peanut.CurrentFormat, Compression: peanut.CompressionZstd, Checksum: peanut.ChecksumSHA256, SigningKey: opts.SigningKey}
+	var binary bytes.Buffer
+	if err := cfg.WriteBinary(&binary, write); err != nil {
+		return nil, nil, fmt.Errorf("failed to compile the configuration: %w", err)
+	}
+	sum := sha256.Sum256(binary.Bytes())
+	result := &BakeResult{Image: opts.Image, Tag: opts.Tag, Path: opts.Path, Digest: "sha256:" + hex.EncodeToString(sum[:]),
+		Size: binary.Len(), Signed: opts.SigningKey != nil}
+
+	if result.Path == "" {
+		workdir, err := docker("image", "inspect", "--format", "{{.Config.WorkingDir}}", opts.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		dir := strings.TrimSpace(string(workdir))
+		if dir == "" {
+			dir = "/"
+		}
+		result.Path = path.Join(dir, "peanu.pnt")
+	}
+
+	buildDir, err := os.MkdirTemp("", "tsk-bake-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(buildDir)
+	if err := os.WriteFile(filepath.Join(buildDir, "peanu.pnt"), binary.Bytes(), 0644); err != nil {
+		return nil, nil, err
+	}
+	dockerfile := fmt.Sprintf("FROM %s\nCOPY peanu.pnt %s\nLABEL %s=%q\n", opts.Image, result.Path, ConfigLabel, result.Digest)
+	if opts.PublicKey != "" {
+		key, err := os.ReadFile(opts.PublicKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(buildDir, "tsk.pub.pem"), key, 0644); err != nil {
+			return nil, nil, err
+		}
+		keyPath := path.Join(path.Dir(result.Path), "tsk.pub.pem")
+		dockerfile += fmt.Sprintf("COPY tsk.pub.pem %s\nENV %s=%s\n", keyPath, peanut.PublicKeyEnv, keyPath)
+	}
+	if err := os.WriteFile(filepath.Join(buildDir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		return nil, nil, err
+	}
+
+	out, err := docker("build", "--tag", opts.Tag, buildDir)
+	if err != nil {
+		return nil, out, err
+	}
+	return result, out, nil
+}
+
+// docker runs a docker command and returns its output
+func docker(args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(DockerCommand, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), fmt.Errorf("%s %s failed: %w: %s", DockerCommand, args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
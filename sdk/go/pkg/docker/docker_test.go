@@ -0,0 +1,134 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInit(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/api\n\ngo 1.23\n")
+	writeFile(t, filepath.Join(dir, "cmd", "api", "main.go"), "package main\n\nfunc main() {}\n")
+	writeFile(t, filepath.Join(dir, "internal", "db", "db.go"), "package db\n")
+	writeFile(t, filepath.Join(dir, "peanu.tsk"), "port: 8080\n")
+	writeFile(t, filepath.Join(dir, "keys", "tsk.pub.pem"), "key")
+
+	opts, dockerfile, ignore, err := Init(dir, InitOptions{Sign: true, PublicKey: "keys/tsk.pub.pem", Port: 8080})
+	if err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	if opts.GoVersion != "1.23" || opts.Main != "./cmd/api" || opts.Config != "peanu.tsk" || opts.Base != DefaultBase {
+		t.Errorf("unexpected detected options %+v", opts)
+	}
+	for _, want := range []string{
+		"FROM golang:1.23-alpine AS config\n",
+		"go install github.com/cyber-boost/tusktsk/cmd/tsk@latest\n",
+		"RUN --mount=type=secret,id=tsk_signing_key,required=true \\\n    tsk binary compile peanu.tsk -o /out/peanu.pnt --compress --checksum sha256 --sign /run/secrets/tsk_signing_key\n",
+		"CGO_ENABLED=0 go build -trimpath -ldflags=\"-s -w\" -o /out/app ./cmd/api\n",
+		"FROM " + DefaultBase + "\n",
+		"COPY --from=config /out/peanu.pnt /app/peanu.pnt\nCOPY keys/tsk.pub.pem /app/tsk.pub.pem\nENV TSK_BINARY_PUBLIC_KEY=/app/tsk.pub.pem\nEXPOSE 8080\nUSER nonroot:nonroot\n",
+	} {
+		if !strings.Contains(string(dockerfile), want) {
+			t.Errorf("Dockerfile lacks %q:\n%s", want, dockerfile)
+		}
+	}
+	if !strings.Contains(string(ignore), "*.pnt") {
+		t.Errorf("unexpected .dockerignore:\n%s", ignore)
+	}
+
+	_, dockerfile, _, err = Init(dir, InitOptions{CGO: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dockerfile), "FROM golang:1.23 AS build") || !strings.Contains(string(dockerfile), DefaultCGOBase) ||
+		strings.Contains(string(dockerfile), "secret") || strings.Contains(string(dockerfile), "EXPOSE") {
+		t.Errorf("unexpected cgo Dockerfile:\n%s", dockerfile)
+	}
+
+	writeFile(t, filepath.Join(dir, "cmd", "worker", "main.go"), "package main\n")
+	if _, _, _, err := Init(dir, InitOptions{}); err == nil || !strings.Contains(err.Error(), "--main") {
+		t.Errorf("expected an error naming several main packages, got %v", err)
+	}
+	if _, _, _, err := Init(t.TempDir(), InitOptions{}); err == nil {
+		t.Error("expected an error without go.mod")
+	}
+}
+
+func TestBake(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "docker.log")
+	script := filepath.Join(dir, "docker")
+	writeFile(t, script, `#!/bin/sh
+echo "$@" >> `+log+`
+case "$1" in
+image) echo /srv ;;
+build) cp "$4/Dockerfile" `+dir+`/Dockerfile; cp "$4/peanu.pnt" `+dir+`/peanu.pnt; echo built ;;
+esac
+`)
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous string) { DockerCommand = previous }(DockerCommand)
+	DockerCommand = script
+
+	private, public := filepath.Join(dir, "signing.pem"), filepath.Join(dir, "signing.pub.pem")
+	if err := peanut.GenerateKeyPair(private, public); err != nil {
+		t.Fatal(err)
+	}
+	key, err := peanut.LoadPrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := peanut.FromValues(map[string]interface{}{"server.port": 8080, "name": "api"})
+	result, out, err := Bake(cfg, BakeOptions{Image: "api:1.0", Tag: "api:1.0-baked", SigningKey: key, PublicKey: public})
+	if err != nil {
+		t.Fatalf("Bake returned error: %v", err)
+	}
+	if result.Path != "/srv/peanu.pnt" || result.Tag != "api:1.0-baked" || !result.Signed || !strings.HasPrefix(result.Digest, "sha256:") {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if strings.TrimSpace(string(out)) != "built" {
+		t.Errorf("unexpected build output %q", out)
+	}
+
+	dockerfile, _ := os.ReadFile(filepath.Join(dir, "Dockerfile"))
+	want := "FROM api:1.0\nCOPY peanu.pnt /srv/peanu.pnt\nLABEL " + ConfigLabel + "=\"" + result.Digest + "\"\n" +
+		"COPY tsk.pub.pem /srv/tsk.pub.pem\nENV TSK_BINARY_PUBLIC_KEY=/srv/tsk.pub.pem\n"
+	if string(dockerfile) != want {
+		t.Errorf("Dockerfile =\n%s\nwant\n%s", dockerfile, want)
+	}
+
+	publicKey, err := peanut.LoadPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baked, err := peanut.LoadBinaryWith(filepath.Join(dir, "peanu.pnt"), peanut.LoadOptions{PublicKey: publicKey})
+	if err != nil {
+		t.Fatalf("baked binary does not verify: %v", err)
+	}
+	defer baked.Close()
+	if baked.GetInt("server.port", 0) != 8080 {
+		t.Errorf("baked binary lost its values")
+	}
+
+	calls, _ := os.ReadFile(log)
+	if !strings.Contains(string(calls), "image inspect --format {{.Config.WorkingDir}} api:1.0") ||
+		!strings.Contains(string(calls), "build --tag api:1.0-baked ") {
+		t.Errorf("unexpected docker calls:\n%s", calls)
+	}
+}
@@ -0,0 +1,322 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/internal/dbprobe"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// defaultGetenv is os.Getenv, replaced in tests
+var defaultGetenv = os.Getenv
+
+// checkHierarchy loads the hierarchy of the directory
+func checkHierarchy(ctx context.Context, env *Env) []Result {
+	switch {
+	case isNotFound(env.HierarchyErr):
+		return []Result{{
+			Status:  Warn,
+			Message: fmt.Sprintf("no peanu.pnt, peanu.tsk or peanu.peanuts in %s or its parents", env.Dir),
+			Fix:     "create peanu.tsk in the project directory, or run tsk from it",
+		}}
+	case env.HierarchyErr != nil:
+		return []Result{errorResult("", env.HierarchyErr, "fix the file named above; tsk config check shows the files merged")}
+	}
+	h := env.Hierarchy
+	return []Result{{
+		Status:  OK,
+		Message: fmt.Sprintf("%d keys from %d file(s), closest %s", len(h.Origins), len(h.Files), h.Files[len(h.Files)-1]),
+	}}
+}
+
+// checkBinaries finds compiled binaries older than the text file beside
+// them: loading skips them and parses the text, which is slower
+func checkBinaries(ctx context.Context, env *Env) []Result {
+	if env.Hierarchy == nil {
+		return []Result{{Status: Skip, Message: "no hierarchy loaded"}}
+	}
+	var results []Result
+	for _, file := range env.Hierarchy.Files {
+		binary := filepath.Join(filepath.Dir(file), "peanu.pnt")
+		if _, err := os.Stat(binary); err != nil {
+			continue
+		}
+		if source, stale := peanut.StaleBinary(binary); stale {
+			results = append(results, Result{
+				Status:  Warn,
+				Message: fmt.Sprintf("%s is older than %s and is skipped", binary, filepath.Base(source)),
+				Fix:     "tsk binary compile " + source,
+			})
+			continue
+		}
+		results = append(results, Result{Status: OK, Message: binary + " is up to date"})
+	}
+	if len(results) == 0 {
+		return []Result{{Status: Skip, Message: "no compiled binaries in the hierarchy"}}
+	}
+	return results
+}
+
+// checkDatabases connects to every database the configuration names, in
+// database.<adapter>.dsn, .url or .replicas, and to $TUSK_DATABASE_URL
+func checkDatabases(ctx context.Context, env *Env) []Result {
+	dsns := make(map[string]string)
+	if dsn := env.Getenv("TUSK_DATABASE_URL"); dsn != "" {
+		dsns["TUSK_DATABASE_URL"] = dsn
+	}
+	if env.Hierarchy != nil {
+		vm := peanut.NewVM()
+		for _, adapter := range dbprobe.Adapters {
+			for _, field := range []string{"dsn", "url", "replicas"} {
+				key := "database." + adapter + "." + field
+				value, ok, err := env.Hierarchy.Config.Resolve(key, vm)
+				if err != nil {
+					return []Result{errorResult("", err, "fix "+key)}
+				}
+				if !ok {
+					continue
+				}
+				if list, isList := value.([]interface{}); isList {
+					for i, item := range list {
+						dsns[fmt.Sprintf("%s[%d]", key, i)] = fmt.Sprint(item)
+					}
+				} else {
+					dsns[key] = fmt.Sprint(value)
+				}
+			}
+		}
+	}
+	if len(dsns) == 0 {
+		return []Result{{Status: Skip, Message: "no database configured (database.<adapter>.dsn or TUSK_DATABASE_URL)"}}
+	}
+
+	var results []Result
+	postgres := false
+	for _, source := range sortedKeys(dsns) {
+		dsn := dsns[source]
+		postgres = postgres || strings.HasPrefix(dsn, "postgres")
+		results = append(results, probeDatabase(ctx, env, source, dsn))
+	}
+	if _, err := exec.LookPath("pg_dump"); postgres && err != nil {
+		results = append(results, Result{
+			Status:  Warn,
+			Message: "pg_dump is not in PATH, so tsk db backup cannot back up PostgreSQL",
+			Fix:     "install the PostgreSQL client tools",
+		})
+	}
+	return results
+}
+
+// probeDatabase checks that the database of dsn, read from source, can be
+// reached: its file for SQLite, a TCP connection for servers
+func probeDatabase(ctx context.Context, env *Env, source, dsn string) Result {
+	target, err := dbprobe.Parse(dsn)
+	switch {
+	case errors.Is(err, dbprobe.ErrUnknownScheme):
+		return Result{
+			Status:  Warn,
+			Message: fmt.Sprintf("%s: %v", source, err),
+			Fix:     "use one of " + strings.Join(dbprobe.Adapters, ", "),
+		}
+	case err != nil:
+		return Result{
+			Status:  Fail,
+			Message: fmt.Sprintf("%s: %v", source, err),
+			Fix:     "use <adapter>://user:pass@host:port/db or sqlite:<path>",
+		}
+	}
+
+	if path := target.SQLite; path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return Result{Status: OK, Message: fmt.Sprintf("%s: SQLite database %s exists", source, path)}
+		}
+		if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+			return Result{
+				Status:  Fail,
+				Message: fmt.Sprintf("%s: the directory of SQLite database %s does not exist", source, path),
+				Fix:     "mkdir -p " + filepath.Dir(path),
+			}
+		}
+		return Result{Status: OK, Message: fmt.Sprintf("%s: SQLite database %s will be created", source, path)}
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, env.Timeout)
+	defer cancel()
+	if err := target.Dial(dialCtx); err != nil {
+		return Result{
+			Status:  Fail,
+			Message: fmt.Sprintf("%s: %v", source, err),
+			Fix:     fmt.Sprintf("start the %s server on %s or fix %s", target.URL.Scheme, target.Addr, source),
+		}
+	}
+	return Result{Status: OK, Message: fmt.Sprintf("%s: %s accepts connections", source, target.URL.Redacted())}
+}
+
+// aiKeys are the variables the tsk ai commands need
+var aiKeys = []struct{ variable, command string }{
+	{"ANTHROPIC_API_KEY", "tsk ai claude"},
+	{"OPENAI_API_KEY", "tsk ai chatgpt"},
+}
+
+// checkAIKeys reports which AI provider keys are set
+func checkAIKeys(ctx context.Context, env *Env) []Result {
+	var results []Result
+	for _, key := range aiKeys {
+		if env.Getenv(key.variable) != "" {
+			results = append(results, Result{Status: OK, Message: key.variable + " is set"})
+			continue
+		}
+		results = append(results, Result{
+			Status:  Warn,
+			Message: fmt.Sprintf("%s is not set, so %s cannot run", key.variable, key.command),
+			Fix:     "export " + key.variable + "=<key>",
+		})
+	}
+	return results
+}
+
+// checkLicense has nothing to check: the SDK needs no license key
+func checkLicense(ctx context.Context, env *Env) []Result {
+	return []Result{{Status: Skip, Message: "this build has no licensed features"}}
+}
+
+// checkDirectories checks that tsk can use its run directories: private,
+// owned by the user and writable
+func checkDirectories(ctx context.Context, env *Env) []Result {
+	var results []Result
+	for _, dir := range env.RunDirs {
+		info, err := os.Stat(dir)
+		if os.IsNotExist(err) {
+			parent := filepath.Dir(dir)
+			if err := writable(parent); err != nil {
+				results = append(results, errorResult("", fmt.Errorf("%s cannot be created: %w", dir, err), "make "+parent+" writable or set TSK_RUN_DIR"))
+				continue
+			}
+			results = append(results, Result{Status: OK, Message: dir + " will be created"})
+			continue
+		}
+		if err != nil {
+			results = append(results, errorResult("", err, "set TSK_RUN_DIR to a directory of your own"))
+			continue
+		}
+		if !info.IsDir() {
+			results = append(results, errorResult("", fmt.Errorf("%s is not a directory", dir), "remove it or set TSK_RUN_DIR"))
+			continue
+		}
+		if err := writable(dir); err != nil {
+			results = append(results, errorResult("", fmt.Errorf("%s is not writable: %w", dir, err), "chown -R $USER "+dir))
+			continue
+		}
+		if mode := info.Mode().Perm(); mode&0077 != 0 {
+			results = append(results, Result{
+				Status:  Warn,
+				Message: fmt.Sprintf("%s is readable by other users (%#o): its sockets accept their commands", dir, mode),
+				Fix:     "chmod 700 " + dir,
+			})
+			continue
+		}
+		results = append(results, Result{Status: OK, Message: dir + " is private and writable"})
+	}
+	if len(results) == 0 {
+		return []Result{{Status: Skip, Message: "no run directories"}}
+	}
+	return results
+}
+
+// writable creates and removes a file in dir
+func writable(dir string) error {
+	file, err := os.CreateTemp(dir, ".tsk-doctor-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// minGoMinor is the Go 1.x release go.mod requires to build tsk
+const minGoMinor = 22
+
+// checkToolchain reports how tsk was built and whether the Go toolchain
+// in PATH can build it, cgo included for SQLite
+func checkToolchain(ctx context.Context, env *Env) []Result {
+	cgo := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "CGO_ENABLED" {
+				cgo = map[string]string{"1": "enabled", "0": "disabled"}[setting.Value]
+			}
+		}
+	}
+	results := []Result{{
+		Status:  OK,
+		Message: fmt.Sprintf("tsk built with %s for %s/%s, cgo %s", runtime.Version(), runtime.GOOS, runtime.GOARCH, cgo),
+	}}
+	if cgo == "disabled" {
+		results[0].Status = Warn
+		results[0].Message += ", so the SQLite adapter is unavailable"
+		results[0].Fix = "rebuild tsk with CGO_ENABLED=1 and a C compiler"
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		return append(results, Result{Status: Skip, Message: "go is not in PATH; it is only needed to build from source"})
+	}
+	goEnv, err := exec.CommandContext(ctx, "go", "env", "GOVERSION", "CGO_ENABLED", "CC").Output()
+	if err != nil {
+		return append(results, errorResult("", fmt.Errorf("go env failed: %w", err), "check the Go installation with go version"))
+	}
+	lines := strings.Split(string(bytes.TrimSpace(goEnv)), "\n")
+	for len(lines) < 3 {
+		lines = append(lines, "")
+	}
+	version, cgoEnabled, cc := lines[0], lines[1], lines[2]
+	if goMinor(version) < minGoMinor {
+		results = append(results, Result{
+			Status:  Fail,
+			Message: fmt.Sprintf("go in PATH is %s; building tsk needs go1.%d or later", version, minGoMinor),
+			Fix:     "install a newer Go from https://go.dev/dl",
+		})
+	} else {
+		results = append(results, Result{Status: OK, Message: "go in PATH is " + version})
+	}
+	switch {
+	case cgoEnabled != "1":
+		results = append(results, Result{
+			Status:  Warn,
+			Message: "cgo is disabled, so builds lack the SQLite adapter",
+			Fix:     "go env -w CGO_ENABLED=1",
+		})
+	case cc != "":
+		if _, err := exec.LookPath(strings.Fields(cc)[0]); err != nil {
+			results = append(results, Result{
+				Status:  Warn,
+				Message: fmt.Sprintf("the C compiler %s is not in PATH, so cgo builds fail", cc),
+				Fix:     "install gcc or clang, or set CC",
+			})
+		}
+	}
+	return results
+}
+
+// goMinor returns the minor release of a version such as go1.22.3, 0 when
+// it cannot tell
+func goMinor(version string) int {
+	rest, ok := strings.CutPrefix(version, "go1.")
+	if !ok {
+		return 0
+	}
+	if i := strings.IndexAny(rest, ".rcbeta"); i >= 0 {
+		rest = rest[:i]
+	}
+	minor, _ := strconv.Atoi(rest)
+	return minor
+}
@@ -0,0 +1,198 @@
+// Package doctor checks the environment tsk runs in, for `tsk doctor`:
+// the configuration hierarchy, stale compiled binaries, database servers,
+// AI keys, run directories and the toolchain. Every problem comes with the
+// command or setting that fixes it.
+//
+// Checks run in the order they are registered, the built-in ones first;
+// packages can add their own with Register:
+//
+//	doctor.Register("queue", func(ctx context.Context, env *doctor.Env) []doctor.Result {
+//		...
+//	})
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	// OK means nothing needs doing
+	OK Status = "ok"
+	// Warn is a problem some commands will run into
+	Warn Status = "warn"
+	// Fail is a problem that breaks tsk in this environment
+	Fail Status = "fail"
+	// Skip means the check does not apply, such as no database configured
+	Skip Status = "skip"
+)
+
+// Result is one finding of a check
+type Result struct {
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	// Fix says how to solve a warning or failure
+	Fix string `json:"fix,omitempty"`
+}
+
+// Env is what checks inspect
+type Env struct {
+	// Dir is the directory whose hierarchy is checked
+	Dir string
+	// Hierarchy is the merged configuration of Dir, nil when it did not load
+	Hierarchy *peanut.Hierarchy
+	// HierarchyErr is why it did not load
+	HierarchyErr error
+	// RunDirs are the directories tsk writes sockets, pidfiles and logs to
+	RunDirs []string
+	// Timeout bounds each network check
+	Timeout time.Duration
+	// Getenv reads the environment, os.Getenv unless set
+	Getenv func(string) string
+}
+
+// Check inspects env and reports its findings
+type Check func(ctx context.Context, env *Env) []Result
+
+var (
+	registryMu sync.RWMutex
+	registry   = []namedCheck{
+		{"hierarchy", checkHierarchy},
+		{"binaries", checkBinaries},
+		{"database", checkDatabases},
+		{"ai", checkAIKeys},
+		{"license", checkLicense},
+		{"directories", checkDirectories},
+		{"toolchain", checkToolchain},
+	}
+)
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Register adds a check, run after the built-in ones. A name that is
+// already registered is refused.
+func Register(name string, check Check) error {
+	if name == "" || check == nil {
+		return fmt.Errorf("check %q needs a name and a function", name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if registered(registry, name) {
+		return fmt.Errorf("check %s is already registered", name)
+	}
+	registry = append(registry, namedCheck{name, check})
+	return nil
+}
+
+// Checks returns the names of the registered checks, in the order they run
+func Checks() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, len(registry))
+	for i, c := range registry {
+		names[i] = c.name
+	}
+	return names
+}
+
+// Report is the outcome of Run
+type Report struct {
+	Dir     string   `json:"dir"`
+	Results []Result `json:"results"`
+	// Counts holds the number of results of each status
+	Counts map[Status]int `json:"counts"`
+}
+
+// Healthy reports whether no check failed
+func (r *Report) Healthy() bool {
+	return r.Counts[Fail] == 0
+}
+
+// Run loads the hierarchy of env.Dir and runs the registered checks, or
+// only those named in only
+func Run(ctx context.Context, env Env, only ...string) (*Report, error) {
+	if env.Timeout == 0 {
+		env.Timeout = 3 * time.Second
+	}
+	if env.Getenv == nil {
+		env.Getenv = defaultGetenv
+	}
+	env.Hierarchy, env.HierarchyErr = peanut.ResolveHierarchy(env.Dir)
+	if env.Hierarchy != nil {
+		defer env.Hierarchy.Config.Close()
+	}
+
+	registryMu.RLock()
+	checks := append([]namedCheck(nil), registry...)
+	registryMu.RUnlock()
+	wanted := make(map[string]bool, len(only))
+	for _, name := range only {
+		wanted[name] = true
+	}
+	for name := range wanted {
+		if !registered(checks, name) {
+			return nil, fmt.Errorf("unknown check %q (available: %v)", name, Checks())
+		}
+	}
+
+	report := &Report{Dir: env.Dir, Results: []Result{}, Counts: make(map[Status]int)}
+	for _, c := range checks {
+		if len(wanted) > 0 && !wanted[c.name] {
+			continue
+		}
+		for _, result := range c.check(ctx, &env) {
+			if result.Check == "" {
+				result.Check = c.name
+			}
+			report.Results = append(report.Results, result)
+			report.Counts[result.Status]++
+		}
+	}
+	return report, nil
+}
+
+func registered(checks []namedCheck, name string) bool {
+	for _, c := range checks {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// errorResult reports err as a failure of check
+func errorResult(check string, err error, fix string) Result {
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+	return Result{Check: check, Status: Fail, Message: msg, Fix: fix}
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isNotFound reports a missing configuration
+func isNotFound(err error) bool {
+	return errors.Is(err, peanut.ErrNotFound)
+}
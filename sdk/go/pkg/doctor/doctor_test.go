@@ -0,0 +1,170 @@
+package doctor
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// run runs the named check on dir with the given environment variables
+func run(t *testing.T, dir string, vars map[string]string, check string) []Result {
+	t.Helper()
+	env := Env{Dir: dir, Timeout: time.Second, Getenv: func(key string) string { return vars[key] }}
+	report, err := Run(context.Background(), env, check)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	return report.Results
+}
+
+// statuses lists the status of each result
+func statuses(results []Result) string {
+	var list []string
+	for _, r := range results {
+		list = append(list, string(r.Status))
+	}
+	return strings.Join(list, ",")
+}
+
+func TestHierarchy(t *testing.T) {
+	dir := t.TempDir()
+	if got := run(t, dir, nil, "hierarchy"); statuses(got) != "warn" || got[0].Fix == "" {
+		t.Errorf("a missing hierarchy should warn with a fix, got %+v", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte("- orphan\n"), 0644)
+	if got := run(t, dir, nil, "hierarchy"); statuses(got) != "fail" || !strings.Contains(got[0].Message, "list item") {
+		t.Errorf("a broken file should fail, got %+v", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte("[app]\nname: \"demo\"\n"), 0644)
+	if got := run(t, dir, nil, "hierarchy"); statuses(got) != "ok" || got[0].Check != "hierarchy" {
+		t.Errorf("a valid hierarchy should pass, got %+v", got)
+	}
+}
+
+func TestBinaries(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "peanu.tsk")
+	os.WriteFile(source, []byte("[app]\nname: \"demo\"\n"), 0644)
+	if got := run(t, dir, nil, "binaries"); statuses(got) != "skip" {
+		t.Errorf("without binaries the check should skip, got %+v", got)
+	}
+
+	if err := peanut.CompileToBinary(source, filepath.Join(dir, "peanu.pnt")); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if got := run(t, dir, nil, "binaries"); statuses(got) != "ok" {
+		t.Errorf("a fresh binary should pass, got %+v", got)
+	}
+
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(source, later, later)
+	got := run(t, dir, nil, "binaries")
+	if statuses(got) != "warn" || got[0].Fix != "tsk binary compile "+source {
+		t.Errorf("a stale binary should warn with a fix, got %+v", got)
+	}
+}
+
+func TestDatabases(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer listener.Close()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte(`[database]
+postgresql {
+    dsn: "postgresql://app:secret@`+listener.Addr().String()+`/app"
+    replicas: ["postgresql://app:secret@`+closedAddr+`/app"]
+}
+sqlite {
+    dsn: "sqlite:`+filepath.Join(dir, "missing", "app.db")+`"
+}
+`), 0644)
+
+	if got := run(t, t.TempDir(), nil, "database"); statuses(got) != "skip" {
+		t.Errorf("without databases the check should skip, got %+v", got)
+	}
+	got := run(t, dir, map[string]string{"TUSK_DATABASE_URL": "redis://" + listener.Addr().String()}, "database")
+	byStatus := map[Status][]string{}
+	for _, r := range got {
+		byStatus[r.Status] = append(byStatus[r.Status], r.Message)
+		if strings.Contains(r.Message, "secret") {
+			t.Errorf("passwords should be redacted: %s", r.Message)
+		}
+	}
+	if len(byStatus[OK]) != 2 || len(byStatus[Fail]) != 2 {
+		t.Errorf("expected the server and TUSK_DATABASE_URL to pass, the replica and SQLite directory to fail, got %+v", got)
+	}
+}
+
+func TestAIKeys(t *testing.T) {
+	got := run(t, t.TempDir(), map[string]string{"ANTHROPIC_API_KEY": "key"}, "ai")
+	if statuses(got) != "ok,warn" || !strings.Contains(got[1].Fix, "OPENAI_API_KEY") {
+		t.Errorf("unexpected results %+v", got)
+	}
+}
+
+func TestDirectories(t *testing.T) {
+	base := t.TempDir()
+	private := filepath.Join(base, "private")
+	os.Mkdir(private, 0700)
+	shared := filepath.Join(base, "shared")
+	os.Mkdir(shared, 0700)
+	os.Chmod(shared, 0777)
+	file := filepath.Join(base, "file")
+	os.WriteFile(file, nil, 0600)
+
+	env := Env{Dir: base, RunDirs: []string{private, shared, file, filepath.Join(base, "new")}}
+	report, err := Run(context.Background(), env, "directories")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got := statuses(report.Results); got != "ok,warn,fail,ok" {
+		t.Errorf("got %s: %+v", got, report.Results)
+	}
+	if report.Healthy() || report.Counts[Warn] != 1 {
+		t.Errorf("unexpected counts %v", report.Counts)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if err := Register("hierarchy", checkHierarchy); err == nil {
+		t.Error("a built-in name should be refused")
+	}
+	check := func(ctx context.Context, env *Env) []Result {
+		return []Result{{Status: OK, Message: "custom"}}
+	}
+	if err := Register("custom-test", check); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	names := Checks()
+	if names[0] != "hierarchy" || names[len(names)-1] != "custom-test" {
+		t.Errorf("custom checks should run last: %v", names)
+	}
+	if got := run(t, t.TempDir(), nil, "custom-test"); len(got) != 1 || got[0].Check != "custom-test" {
+		t.Errorf("unexpected results %+v", got)
+	}
+	if _, err := Run(context.Background(), Env{Dir: t.TempDir()}, "nope"); err == nil {
+		t.Error("an unknown check should be refused")
+	}
+}
+
+func TestGoMinor(t *testing.T) {
+	for version, want := range map[string]int{"go1.22.3": 22, "go1.21rc2": 21, "go1.9": 9, "devel": 0} {
+		if got := goMinor(version); got != want {
+			t.Errorf("goMinor(%q) = %d, want %d", version, got, want)
+		}
+	}
+}
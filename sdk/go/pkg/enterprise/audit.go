@@ -0,0 +1,574 @@
+// Package enterprise holds the enterprise features of tsk: the AuditManager
+// records who did what, and keeps it in the sinks the [audit] section of
+// peanu.tsk configures:
+//
+//	[audit]
+//	sinks: ["file", "database", "syslog"]
+//	file: ".tsk/audit.jsonl"          # rotated past max_size_mb
+//	max_size_mb: 10
+//	max_files: 10
+//	retention: "90d"
+//	batch_size: 100
+//	flush_interval: "1s"
+//	database {
+//	    adapter: "sqlite"             # or postgresql
+//	    dsn: "audit.db"
+//	}
+//	syslog {
+//	    network: "udp"                # empty for the local syslog daemon
+//	    address: "localhost:514"
+//	    tag: "tsk"
+//	}
+//
+// The RBACManager decides who may do it, from the roles and users of an
+// access.policy.tsk; see AccessPolicy.
+package enterprise
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit sinks
+const (
+	FileSinkName     = "file"
+	DatabaseSinkName = "database"
+	SyslogSinkName   = "syslog"
+)
+
+// DefaultAuditFile is where the file sink appends, relative to the
+// directory of the configuration
+const DefaultAuditFile = ".tsk/audit.jsonl"
+
+// AuditLog represents an audit log entry
+type AuditLog struct {
+	ID        string                 `json:"id"`
+	UserID    string                 `json:"user_id"`
+	Action    string                 `json:"action"`
+	Resource  string                 `json:"resource"`
+	Timestamp time.Time              `json:"timestamp"`
+	IPAddress string                 `json:"ip_address,omitempty"`
+	UserAgent string                 `json:"user_agent,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// AuditQuery selects audit logs; zero fields match everything
+type AuditQuery struct {
+	UserID   string
+	Action   string
+	Resource string
+	// Since and Until bound the timestamps, inclusive and exclusive
+	Since time.Time
+	Until time.Time
+	// Limit keeps the newest logs
+	Limit int
+}
+
+// Matches reports whether log is selected by q, ignoring its limit
+func (q AuditQuery) Matches(log AuditLog) bool {
+	switch {
+	case q.UserID != "" && log.UserID != q.UserID,
+		q.Action != "" && log.Action != q.Action,
+		q.Resource != "" && log.Resource != q.Resource,
+		!q.Since.IsZero() && log.Timestamp.Before(q.Since),
+		!q.Until.IsZero() && !log.Timestamp.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// filter returns the logs q selects, in order, keeping the newest Limit
+func (q AuditQuery) filter(logs []AuditLog) []AuditLog {
+	var selected []AuditLog
+	for _, log := range logs {
+		if q.Matches(log) {
+			selected = append(selected, log)
+		}
+	}
+	if q.Limit > 0 && len(selected) > q.Limit {
+		selected = selected[len(selected)-q.Limit:]
+	}
+	return selected
+}
+
+// AuditSink keeps audit logs beyond the memory of the process
+type AuditSink interface {
+	Name() string
+	// Write stores a batch of logs, oldest first
+	Write(logs []AuditLog) error
+	Close() error
+}
+
+// AuditReader is a sink whose logs can be queried back
+type AuditReader interface {
+	Query(q AuditQuery) ([]AuditLog, error)
+}
+
+// AuditPruner is a sink that can drop the logs older than a retention
+// period
+type AuditPruner interface {
+	Prune(before time.Time) error
+}
+
+// AuditOptions is the [audit] section of a configuration
+type AuditOptions struct {
+	Sinks []string
+	// File is the path of the file sink
+	File string
+	// MaxSize rotates the file once it would grow past it; zero never does
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept; zero keeps them all
+	MaxFiles int
+	// Retention drops older logs from the sinks that support it; zero
+	// keeps them forever
+	Retention time.Duration
+	// BatchSize logs are written at once, or whatever is pending every
+	// FlushInterval
+	BatchSize     int
+	FlushInterval time.Duration
+	// MaxMemory is the number of logs kept in memory, and the most a
+	// failing sink is allowed to fall behind
+	MaxMemory int
+
+	DatabaseAdapter string
+	DatabaseDSN     string
+
+	SyslogNetwork string
+	SyslogAddress string
+	SyslogTag     string
+}
+
+// DefaultAuditOptions appends to DefaultAuditFile, rotating it at 10 MiB
+func DefaultAuditOptions() AuditOptions {
+	return AuditOptions{
+		Sinks:         []string{FileSinkName},
+		File:          DefaultAuditFile,
+		MaxSize:       10 << 20,
+		MaxFiles:      10,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		MaxMemory:     10000,
+		SyslogTag:     "tsk",
+	}
+}
+
+// AuditOptionsFrom reads AuditOptions from the flat audit.* keys of an
+// evaluated configuration; relative paths are resolved against dir
+func AuditOptionsFrom(values map[string]interface{}, dir string) (AuditOptions, error) {
+	opts := DefaultAuditOptions()
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "audit.")
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		var err error
+		switch setting {
+		case "sinks":
+			list, isList := value.([]interface{})
+			if !isList {
+				err = errors.New("must be a list of sinks")
+				break
+			}
+			opts.Sinks = nil
+			for _, name := range list {
+				sink := fmt.Sprint(name)
+				if sink != FileSinkName && sink != DatabaseSinkName && sink != SyslogSinkName {
+					err = fmt.Errorf("unknown sink %q (file, database or syslog)", sink)
+				}
+				opts.Sinks = append(opts.Sinks, sink)
+			}
+		case "file":
+			opts.File = text
+		case "max_size_mb":
+			var mb int
+			mb, err = nonNegative(text)
+			opts.MaxSize = int64(mb) << 20
+		case "max_files":
+			opts.MaxFiles, err = nonNegative(text)
+		case "retention":
+			opts.Retention, err = parseDays(text)
+		case "batch_size":
+			opts.BatchSize, err = nonNegative(text)
+		case "flush_interval":
+			opts.FlushInterval, err = time.ParseDuration(text)
+		case "max_memory":
+			opts.MaxMemory, err = nonNegative(text)
+		case "database.adapter":
+			opts.DatabaseAdapter = text
+		case "database.dsn":
+			opts.DatabaseDSN = text
+		case "syslog.network":
+			opts.SyslogNetwork = text
+		case "syslog.address":
+			opts.SyslogAddress = text
+		case "syslog.tag":
+			opts.SyslogTag = text
+		default:
+			return opts, fmt.Errorf("unknown setting audit.%s", setting)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("audit.%s: invalid value %q: %w", setting, text, err)
+		}
+	}
+	if opts.File != "" && !filepath.IsAbs(opts.File) {
+		opts.File = filepath.Join(dir, opts.File)
+	}
+	if opts.DatabaseAdapter == "sqlite" && opts.DatabaseDSN != "" && !filepath.IsAbs(opts.DatabaseDSN) {
+		opts.DatabaseDSN = filepath.Join(dir, opts.DatabaseDSN)
+	}
+	return opts, nil
+}
+
+func nonNegative(text string) (int, error) {
+	n, err := strconv.Atoi(text)
+	if err == nil && n < 0 {
+		err = errors.New("must not be negative")
+	}
+	return n, err
+}
+
+// parseDays parses a duration, also accepting whole days such as "90d"
+func parseDays(text string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(text, "d"); ok {
+		n, err := nonNegative(days)
+		return time.Duration(n) * 24 * time.Hour, err
+	}
+	d, err := time.ParseDuration(text)
+	if err == nil && d < 0 {
+		err = errors.New("must not be negative")
+	}
+	return d, err
+}
+
+// OpenAuditSinks opens the sinks opts lists
+func OpenAuditSinks(opts AuditOptions) ([]AuditSink, error) {
+	var sinks []AuditSink
+	for _, name := range opts.Sinks {
+		var sink AuditSink
+		var err error
+		switch name {
+		case FileSinkName:
+			sink, err = OpenFileSink(opts.File, opts.MaxSize, opts.MaxFiles)
+		case DatabaseSinkName:
+			sink, err = OpenTableSink(opts.DatabaseAdapter, opts.DatabaseDSN)
+		case SyslogSinkName:
+			sink, err = NewSyslogSink(opts.SyslogNetwork, opts.SyslogAddress, opts.SyslogTag)
+		default:
+			err = fmt.Errorf("unknown audit sink %q", name)
+		}
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// AuditManager manages audit logs: it keeps the latest in memory and
+// writes them to its sinks in batches
+type AuditManager struct {
+	// OnError, when set, is called when a sink fails; the logs it missed
+	// are written with the next batch
+	OnError func(sink string, err error)
+
+	opts AuditOptions
+
+	mu      sync.RWMutex
+	logs    []AuditLog
+	sinks   []*sinkState
+	pending int
+	pruned  time.Time
+	closed  bool
+
+	flushMu sync.Mutex
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// sinkState is a sink and the logs it has yet to write
+type sinkState struct {
+	sink    AuditSink
+	backlog []AuditLog
+	dropped int
+}
+
+// NewAuditManager creates an audit manager writing to sinks with the
+// default batching
+func NewAuditManager(sinks ...AuditSink) *AuditManager {
+	return NewAuditManagerWith(DefaultAuditOptions(), sinks...)
+}
+
+// NewAuditManagerWith creates an audit manager batching and retaining logs
+// as opts sets. With sinks, a goroutine writes the pending logs every
+// FlushInterval until Close.
+func NewAuditManagerWith(opts AuditOptions, sinks ...AuditSink) *AuditManager {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1
+	}
+	if opts.MaxMemory <= 0 {
+		opts.MaxMemory = DefaultAuditOptions().MaxMemory
+	}
+	am := &AuditManager{
+		opts: opts,
+		logs: make([]AuditLog, 0),
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	for _, sink := range sinks {
+		am.sinks = append(am.sinks, &sinkState{sink: sink})
+	}
+	if len(sinks) == 0 || opts.FlushInterval <= 0 {
+		close(am.done)
+		return am
+	}
+	go am.run()
+	return am
+}
+
+// OpenAuditManager opens the sinks of opts and creates a manager writing
+// to them
+func OpenAuditManager(opts AuditOptions) (*AuditManager, error) {
+	sinks, err := OpenAuditSinks(opts)
+	if err != nil {
+		return nil, err
+	}
+	am := NewAuditManagerWith(opts, sinks...)
+	am.ApplyRetention()
+	return am, nil
+}
+
+// run flushes every FlushInterval, and whenever a batch fills up
+func (am *AuditManager) run() {
+	defer close(am.done)
+	ticker := time.NewTicker(am.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-am.stop:
+			return
+		case <-ticker.C:
+		case <-am.wake:
+		}
+		am.Flush()
+		if time.Since(am.prunedAt()) > time.Hour {
+			am.ApplyRetention()
+		}
+	}
+}
+
+func (am *AuditManager) prunedAt() time.Time {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.pruned
+}
+
+// LogEvent records an event, filling in its ID and time
+func (am *AuditManager) LogEvent(userID, action, resource, ipAddress, userAgent string, metadata map[string]interface{}) {
+	am.Record(AuditLog{
+		UserID:    userID,
+		Action:    action,
+		Resource:  resource,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Metadata:  metadata,
+	})
+}
+
+// Record records log, filling in its ID and time when they are missing
+func (am *AuditManager) Record(log AuditLog) {
+	if log.ID == "" {
+		log.ID = uuid.NewString()
+	}
+	if log.Timestamp.IsZero() {
+		log.Timestamp = time.Now()
+	}
+	log.Timestamp = log.Timestamp.UTC()
+
+	am.mu.Lock()
+	am.logs = append(am.logs, log)
+	if over := len(am.logs) - am.opts.MaxMemory; over > 0 {
+		am.logs = append(am.logs[:0], am.logs[over:]...)
+	}
+	for _, state := range am.sinks {
+		state.add(log, am.opts.MaxMemory)
+	}
+	am.pending++
+	full := am.pending >= am.opts.BatchSize
+	background := am.opts.FlushInterval > 0 && !am.closed
+	am.mu.Unlock()
+
+	switch {
+	case !full || len(am.sinks) == 0:
+	case background:
+		select {
+		case am.wake <- struct{}{}:
+		default:
+		}
+	default:
+		am.Flush()
+	}
+}
+
+// add queues log for the sink
+func (s *sinkState) add(log AuditLog, max int) {
+	s.backlog = append(s.backlog, log)
+	s.trim(max)
+}
+
+// trim drops the oldest logs of a sink that has fallen more than max
+// behind
+func (s *sinkState) trim(max int) {
+	if over := len(s.backlog) - max; over > 0 {
+		s.backlog = append(s.backlog[:0], s.backlog[over:]...)
+		s.dropped += over
+	}
+}
+
+// Flush writes the pending logs to every sink. A sink that fails keeps
+// its logs for the next flush.
+func (am *AuditManager) Flush() error {
+	am.flushMu.Lock()
+	defer am.flushMu.Unlock()
+
+	type batch struct {
+		state   *sinkState
+		logs    []AuditLog
+		dropped int
+	}
+	am.mu.Lock()
+	batches := make([]batch, 0, len(am.sinks))
+	for _, state := range am.sinks {
+		if len(state.backlog) > 0 {
+			batches = append(batches, batch{state, state.backlog, state.dropped})
+			state.backlog, state.dropped = nil, 0
+		}
+	}
+	am.pending = 0
+	am.mu.Unlock()
+
+	var errs []error
+	for _, b := range batches {
+		name := b.state.sink.Name()
+		if err := b.state.sink.Write(b.logs); err != nil {
+			errs = append(errs, am.fail(name, err))
+			am.mu.Lock()
+			// Put the batch back ahead of the logs recorded since
+			b.state.backlog = append(b.logs, b.state.backlog...)
+			b.state.dropped += b.dropped
+			b.state.trim(am.opts.MaxMemory)
+			am.mu.Unlock()
+			continue
+		}
+		if b.dropped > 0 {
+			errs = append(errs, am.fail(name, fmt.Errorf("dropped %d log(s) while the sink was failing", b.dropped)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fail wraps the error of a sink and passes it to OnError
+func (am *AuditManager) fail(sink string, err error) error {
+	err = fmt.Errorf("audit sink %s: %w", sink, err)
+	if am.OnError != nil {
+		am.OnError(sink, err)
+	}
+	return err
+}
+
+// ApplyRetention drops the logs older than the retention period from
+// memory and from the sinks that can prune
+func (am *AuditManager) ApplyRetention() error {
+	am.mu.Lock()
+	am.pruned = time.Now()
+	if am.opts.Retention <= 0 {
+		am.mu.Unlock()
+		return nil
+	}
+	cutoff := time.Now().Add(-am.opts.Retention)
+	kept := am.logs[:0]
+	for _, log := range am.logs {
+		if !log.Timestamp.Before(cutoff) {
+			kept = append(kept, log)
+		}
+	}
+	am.logs = kept
+	sinks := make([]AuditSink, len(am.sinks))
+	for i, state := range am.sinks {
+		sinks[i] = state.sink
+	}
+	am.mu.Unlock()
+
+	var errs []error
+	for _, sink := range sinks {
+		pruner, ok := sink.(AuditPruner)
+		if !ok {
+			continue
+		}
+		if err := pruner.Prune(cutoff); err != nil {
+			errs = append(errs, am.fail(sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetAuditLogs returns the logs of userID kept in memory between startTime
+// and endTime
+func (am *AuditManager) GetAuditLogs(userID string, startTime, endTime time.Time) []AuditLog {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return AuditQuery{UserID: userID, Since: startTime, Until: endTime}.filter(am.logs)
+}
+
+// Query returns the logs q selects from the first sink that can be read,
+// after flushing the pending ones, or from memory without one
+func (am *AuditManager) Query(q AuditQuery) ([]AuditLog, error) {
+	for _, state := range am.sinks {
+		if reader, ok := state.sink.(AuditReader); ok {
+			if err := am.Flush(); err != nil {
+				return nil, err
+			}
+			return reader.Query(q)
+		}
+	}
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return q.filter(am.logs), nil
+}
+
+// Close writes the pending logs and closes the sinks
+func (am *AuditManager) Close() error {
+	am.mu.Lock()
+	if am.closed {
+		am.mu.Unlock()
+		return nil
+	}
+	am.closed = true
+	am.mu.Unlock()
+	select {
+	case <-am.done:
+	default:
+		close(am.stop)
+		<-am.done
+	}
+
+	errs := []error{am.Flush()}
+	for _, state := range am.sinks {
+		if err := state.sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("audit sink %s: %w", state.sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
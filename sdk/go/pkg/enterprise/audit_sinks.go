@@ -0,0 +1,369 @@
+package enterprise
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/orm"
+)
+
+// FileSink appends audit logs to a file, one JSON object per line. Past
+// its maximum size the file is renamed with the time of the rotation,
+// such as audit-20250102T150405.000000000.jsonl, and a new one started.
+type FileSink struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenFileSink appends to path, creating it and its directory, readable by
+// the owner only
+func OpenFileSink(path string, maxSize int64, maxFiles int) (*FileSink, error) {
+	if path == "" {
+		return nil, errors.New("the audit file sink needs a file")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	s := &FileSink{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+// Name identifies the sink in errors
+func (s *FileSink) Name() string { return FileSinkName }
+
+// Write appends logs and syncs the file, rotating it first when they
+// would take it past its maximum size
+func (s *FileSink) Write(logs []AuditLog) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, log := range logs {
+		if err := encoder.Encode(log); err != nil {
+			return fmt.Errorf("failed to encode audit log %s: %w", log.ID, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return errors.New("audit log is closed")
+	}
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(buf.Len()) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(buf.Bytes())
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return s.file.Sync()
+}
+
+// rotate renames the file after the current time and starts a new one,
+// removing the oldest rotated files past maxFiles
+func (s *FileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+	ext := filepath.Ext(s.path)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(s.path, ext), time.Now().UTC().Format("20060102T150405.000000000"), ext)
+	if err := os.Rename(s.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	if s.maxFiles <= 0 {
+		return nil
+	}
+	files, err := RotatedAuditFiles(s.path)
+	if err != nil {
+		return err
+	}
+	for len(files) > s.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return fmt.Errorf("failed to remove rotated audit log: %w", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// Query reads the logs q selects from the rotated files and the current one
+func (s *FileSink) Query(q AuditQuery) ([]AuditLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return QueryAuditFile(s.path, q)
+}
+
+// Prune removes the rotated files last written before before. The current
+// file is append-only and kept whole.
+func (s *FileSink) Prune(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := RotatedAuditFiles(s.path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("failed to remove expired audit log: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// RotatedAuditFiles lists the files rotated from the audit log at path,
+// oldest first
+func RotatedAuditFiles(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	files, err := filepath.Glob(globEscape(strings.TrimSuffix(path, ext)) + "-*" + globEscape(ext))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rotated audit logs: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// globEscape escapes the metacharacters of filepath.Match in s
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// QueryAuditFile reads the logs q selects from the audit log at path and
+// the files rotated from it, skipping lines that are not logs
+func QueryAuditFile(path string, q AuditQuery) ([]AuditLog, error) {
+	files, err := RotatedAuditFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var logs []AuditLog
+	for _, file := range append(files, path) {
+		f, err := os.Open(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var log AuditLog
+			if err := json.Unmarshal(scanner.Bytes(), &log); err != nil || log.ID == "" {
+				continue
+			}
+			if q.Matches(log) {
+				logs = append(logs, log)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read audit log %s: %w", file, err)
+		}
+	}
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Timestamp.Before(logs[j].Timestamp) })
+	return AuditQuery{Limit: q.Limit}.filter(logs), nil
+}
+
+// AuditTable is the table the database sink writes to
+const AuditTable = "audit_logs"
+
+// auditRecord is an AuditLog as a row of AuditTable
+type auditRecord struct {
+	ID        string    `db:"id" gorm:"primaryKey"`
+	UserID    string    `db:"user_id" gorm:"index"`
+	Action    string    `db:"action" gorm:"index"`
+	Resource  string    `db:"resource"`
+	Timestamp time.Time `db:"occurred_at" gorm:"index"`
+	IPAddress string    `db:"ip_address"`
+	UserAgent string    `db:"user_agent" gorm:"type:text"`
+	Metadata  string    `db:"metadata" gorm:"type:text"`
+}
+
+func (r *auditRecord) TableName() string    { return AuditTable }
+func (r *auditRecord) PrimaryKey() string   { return "id" }
+func (r *auditRecord) GetID() interface{}   { return r.ID }
+func (r *auditRecord) SetID(id interface{}) { r.ID, _ = id.(string) }
+
+func (r *auditRecord) log() AuditLog {
+	log := AuditLog{
+		ID:        r.ID,
+		UserID:    r.UserID,
+		Action:    r.Action,
+		Resource:  r.Resource,
+		Timestamp: r.Timestamp.UTC(),
+		IPAddress: r.IPAddress,
+		UserAgent: r.UserAgent,
+	}
+	if r.Metadata != "" {
+		json.Unmarshal([]byte(r.Metadata), &log.Metadata)
+	}
+	return log
+}
+
+// TableSink inserts audit logs into AuditTable through the ORM, one
+// transaction per batch
+type TableSink struct {
+	orm    *orm.ORM
+	closer func() error
+}
+
+// NewTableSink writes to AuditTable of the database of o, creating or
+// migrating the table
+func NewTableSink(o *orm.ORM) (*TableSink, error) {
+	if err := o.RegisterModel(&auditRecord{}); err != nil {
+		return nil, err
+	}
+	if err := o.AutoMigrate(); err != nil {
+		return nil, fmt.Errorf("failed to create the %s table: %w", AuditTable, err)
+	}
+	return &TableSink{orm: o}, nil
+}
+
+// OpenTableSink connects to a SQLite or PostgreSQL database and writes to
+// its AuditTable
+func OpenTableSink(adapter, dsn string) (*TableSink, error) {
+	db, err := openSQL(adapter, dsn)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := NewTableSink(orm.NewORM(db))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	sink.closer = db.Close
+	return sink, nil
+}
+
+// Name identifies the sink in errors
+func (s *TableSink) Name() string { return DatabaseSinkName }
+
+// Write inserts logs in one transaction
+func (s *TableSink) Write(logs []AuditLog) error {
+	return s.orm.Transaction(func(tx *orm.ORM) error {
+		for _, log := range logs {
+			record := &auditRecord{
+				ID:        log.ID,
+				UserID:    log.UserID,
+				Action:    log.Action,
+				Resource:  log.Resource,
+				Timestamp: log.Timestamp.UTC(),
+				IPAddress: log.IPAddress,
+				UserAgent: log.UserAgent,
+			}
+			if len(log.Metadata) > 0 {
+				metadata, err := json.Marshal(log.Metadata)
+				if err != nil {
+					return fmt.Errorf("failed to encode audit log %s: %w", log.ID, err)
+				}
+				record.Metadata = string(metadata)
+			}
+			if err := tx.Create(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Query selects the logs q matches, newest Limit first in the database but
+// returned oldest first
+func (s *TableSink) Query(q AuditQuery) ([]AuditLog, error) {
+	query := s.orm.Model(&auditRecord{})
+	if q.UserID != "" {
+		query.Where("user_id = ?", q.UserID)
+	}
+	if q.Action != "" {
+		query.Where("action = ?", q.Action)
+	}
+	if q.Resource != "" {
+		query.Where("resource = ?", q.Resource)
+	}
+	if !q.Since.IsZero() {
+		query.Where("occurred_at >= ?", q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		query.Where("occurred_at < ?", q.Until.UTC())
+	}
+	if q.Limit > 0 {
+		query.Limit(q.Limit)
+	}
+	var records []auditRecord
+	if err := query.Order("occurred_at DESC").Find(&records); err != nil {
+		return nil, fmt.Errorf("failed to query the %s table: %w", AuditTable, err)
+	}
+	logs := make([]AuditLog, len(records))
+	for i := range records {
+		logs[len(records)-1-i] = records[i].log()
+	}
+	return logs, nil
+}
+
+// Prune deletes the logs recorded before before
+func (s *TableSink) Prune(before time.Time) error {
+	return s.orm.Model(&auditRecord{}).Where("occurred_at < ?", before.UTC()).Delete()
+}
+
+// Close closes the connection opened by OpenTableSink
+func (s *TableSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer()
+}
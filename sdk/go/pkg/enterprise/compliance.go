@@ -0,0 +1,542 @@
+package enterprise
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/internal/configvalue"
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/expr"
+)
+
+// CompliancePolicyFile holds the compliance policies of a directory
+const CompliancePolicyFile = "compliance.policy.tsk"
+
+// Compliance severities, from least to most serious
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// severityRanks orders the compliance severities
+var severityRanks = map[string]int{SeverityLow: 1, SeverityMedium: 2, SeverityHigh: 3, SeverityCritical: 4}
+
+// SeverityAtLeast reports whether severity is as serious as min
+func SeverityAtLeast(severity, min string) bool {
+	return severityRanks[severity] >= severityRanks[min]
+}
+
+// maxViolations bounds the violations a ComplianceManager remembers
+const maxViolations = 1000
+
+// Policy is a set of compliance rules
+type Policy struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Severity is that of the rules without their own
+	Severity string       `json:"severity"`
+	Enabled  bool         `json:"enabled"`
+	Rules    []PolicyRule `json:"rules"`
+	// Source is the file the policy was read from
+	Source string `json:"source,omitempty"`
+}
+
+// PolicyRule is a condition the data of a resource must meet, written in
+// the expression language of package expr
+type PolicyRule struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Condition must be true for the resource to comply
+	Condition string `json:"condition"`
+	// When, if set, limits the rule to resources it is true for
+	When string `json:"when,omitempty"`
+	// Message explains a violation; the condition by default
+	Message  string `json:"message,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	// Controls are the requirements of a standard the rule checks, such
+	// as "CC6.7" of SOC 2
+	Controls []string `json:"controls,omitempty"`
+	Enabled  bool     `json:"enabled"`
+
+	condition, when *expr.Expr
+}
+
+// compile parses the expressions of r
+func (r *PolicyRule) compile() error {
+	if r.Condition == "" {
+		return errors.New("no condition")
+	}
+	var err error
+	if r.condition, err = expr.Compile(r.Condition); err != nil {
+		return fmt.Errorf("condition: %w", err)
+	}
+	if r.When != "" {
+		if r.when, err = expr.Compile(r.When); err != nil {
+			return fmt.Errorf("when: %w", err)
+		}
+	}
+	return nil
+}
+
+// RuleStatus is the outcome of a rule for a resource
+type RuleStatus string
+
+const (
+	// RulePassed means the resource meets the condition
+	RulePassed RuleStatus = "pass"
+	// RuleFailed means it does not: a violation
+	RuleFailed RuleStatus = "fail"
+	// RuleSkipped means the rule's when condition is false
+	RuleSkipped RuleStatus = "skip"
+	// RuleError means the condition could not be evaluated, such as a
+	// number compared with a string. It counts as a violation.
+	RuleError RuleStatus = "error"
+)
+
+// RuleResult is the outcome of one rule for one resource
+type RuleResult struct {
+	PolicyID string     `json:"policy_id"`
+	RuleID   string     `json:"rule_id"`
+	Name     string     `json:"name,omitempty"`
+	Resource string     `json:"resource"`
+	Status   RuleStatus `json:"status"`
+	Severity string     `json:"severity"`
+	Message  string     `json:"message,omitempty"`
+	// Values holds the fields the rule read, as evidence
+	Values map[string]interface{} `json:"values"`
+}
+
+// ComplianceViolation is a rule a resource failed
+type ComplianceViolation struct {
+	ID        string                 `json:"id"`
+	PolicyID  string                 `json:"policy_id"`
+	RuleID    string                 `json:"rule_id"`
+	Resource  string                 `json:"resource"`
+	Severity  string                 `json:"severity"`
+	Message   string                 `json:"message"`
+	Timestamp time.Time              `json:"timestamp"`
+	Values    map[string]interface{} `json:"values,omitempty"`
+}
+
+// ComplianceReport is the outcome of the policies for a resource
+type ComplianceReport struct {
+	Resource    string                `json:"resource"`
+	EvaluatedAt time.Time             `json:"evaluated_at"`
+	Results     []RuleResult          `json:"results"`
+	Violations  []ComplianceViolation `json:"violations"`
+	// Counts holds the number of results of each status
+	Counts map[RuleStatus]int `json:"counts"`
+}
+
+// Compliant reports whether the resource violates no rule
+func (r *ComplianceReport) Compliant() bool {
+	return len(r.Violations) == 0
+}
+
+// ComplianceManager evaluates resources against compliance policies
+type ComplianceManager struct {
+	mu         sync.RWMutex
+	policies   map[string]*Policy
+	violations []ComplianceViolation
+	sequence   int
+}
+
+// NewComplianceManager creates a compliance manager without policies
+func NewComplianceManager() *ComplianceManager {
+	return &ComplianceManager{policies: make(map[string]*Policy)}
+}
+
+// CreatePolicy adds a policy, compiling its rules
+func (cm *ComplianceManager) CreatePolicy(policy *Policy) error {
+	if policy.ID == "" {
+		return errors.New("policy without an id")
+	}
+	if policy.Severity == "" {
+		policy.Severity = SeverityMedium
+	}
+	if _, ok := severityRanks[policy.Severity]; !ok {
+		return fmt.Errorf("policy %s: unknown severity %q", policy.ID, policy.Severity)
+	}
+	seen := make(map[string]bool)
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.ID == "" || seen[rule.ID] {
+			return fmt.Errorf("policy %s: rule %d has no id, or a duplicate one", policy.ID, i+1)
+		}
+		seen[rule.ID] = true
+		if _, ok := severityRanks[rule.Severity]; rule.Severity != "" && !ok {
+			return fmt.Errorf("policy %s: rule %s: unknown severity %q", policy.ID, rule.ID, rule.Severity)
+		}
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("policy %s: rule %s: %w", policy.ID, rule.ID, err)
+		}
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if existing, ok := cm.policies[policy.ID]; ok {
+		if existing.Source != "" {
+			return fmt.Errorf("policy already exists: %s (in %s)", policy.ID, existing.Source)
+		}
+		return fmt.Errorf("policy already exists: %s", policy.ID)
+	}
+	cm.policies[policy.ID] = policy
+	return nil
+}
+
+// Policies returns the policies, sorted by id
+func (cm *ComplianceManager) Policies() []*Policy {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	policies := make([]*Policy, 0, len(cm.policies))
+	for _, policy := range cm.policies {
+		policies = append(policies, policy)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].ID < policies[j].ID })
+	return policies
+}
+
+// Evaluate checks data, the configuration or fields of resource, against
+// every enabled policy
+func (cm *ComplianceManager) Evaluate(resource string, data map[string]interface{}) *ComplianceReport {
+	report := &ComplianceReport{
+		Resource:    resource,
+		EvaluatedAt: time.Now(),
+		Results:     []RuleResult{},
+		Violations:  []ComplianceViolation{},
+		Counts:      make(map[RuleStatus]int),
+	}
+	for _, policy := range cm.Policies() {
+		if policy.Enabled {
+			cm.evaluate(policy, resource, data, report)
+		}
+	}
+	return report
+}
+
+// EvaluatePolicy checks data against one policy, and reports whether it
+// complies and the violations
+func (cm *ComplianceManager) EvaluatePolicy(policyID, resource string, data map[string]interface{}) (bool, []ComplianceViolation, error) {
+	cm.mu.RLock()
+	policy, ok := cm.policies[policyID]
+	cm.mu.RUnlock()
+	if !ok {
+		return false, nil, tskerrors.New(tskerrors.NotFound, "policy not found: %s", policyID)
+	}
+	report := &ComplianceReport{Resource: resource, EvaluatedAt: time.Now(), Counts: make(map[RuleStatus]int)}
+	cm.evaluate(policy, resource, data, report)
+	return report.Compliant(), report.Violations, nil
+}
+
+// evaluate adds the results of policy to report, and remembers its
+// violations
+func (cm *ComplianceManager) evaluate(policy *Policy, resource string, data map[string]interface{}, report *ComplianceReport) {
+	var violations []ComplianceViolation
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if !rule.Enabled {
+			continue
+		}
+		result := RuleResult{
+			PolicyID: policy.ID,
+			RuleID:   rule.ID,
+			Name:     rule.Name,
+			Resource: resource,
+			Severity: rule.Severity,
+			Values:   evidence(data, rule.condition, rule.when),
+		}
+		if result.Severity == "" {
+			result.Severity = policy.Severity
+		}
+
+		applies := true
+		var err error
+		if rule.when != nil {
+			applies, err = rule.when.Bool(data)
+		}
+		passed := false
+		if err == nil && applies {
+			passed, err = rule.condition.Bool(data)
+		}
+		switch {
+		case err != nil:
+			result.Status = RuleError
+			result.Message = fmt.Sprintf("cannot evaluate %s: %v", rule.Condition, err)
+		case !applies:
+			result.Status = RuleSkipped
+		case passed:
+			result.Status = RulePassed
+		default:
+			result.Status = RuleFailed
+			result.Message = rule.Message
+			if result.Message == "" {
+				result.Message = "condition not met: " + rule.Condition
+			}
+		}
+		report.Results = append(report.Results, result)
+		report.Counts[result.Status]++
+		if result.Status == RuleFailed || result.Status == RuleError {
+			violations = append(violations, ComplianceViolation{
+				PolicyID:  policy.ID,
+				RuleID:    rule.ID,
+				Resource:  resource,
+				Severity:  result.Severity,
+				Message:   result.Message,
+				Timestamp: report.EvaluatedAt,
+				Values:    result.Values,
+			})
+		}
+	}
+
+	cm.mu.Lock()
+	for i := range violations {
+		cm.sequence++
+		violations[i].ID = fmt.Sprintf("%s-%d", policy.ID, cm.sequence)
+	}
+	cm.violations = append(cm.violations, violations...)
+	if over := len(cm.violations) - maxViolations; over > 0 {
+		cm.violations = append([]ComplianceViolation(nil), cm.violations[over:]...)
+	}
+	cm.mu.Unlock()
+	report.Violations = append(report.Violations, violations...)
+}
+
+// Violations returns the most recent violations found, oldest first
+func (cm *ComplianceManager) Violations() []ComplianceViolation {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return append([]ComplianceViolation(nil), cm.violations...)
+}
+
+// sensitiveField matches the names of fields whose values evidence hides
+var sensitiveField = regexp.MustCompile(`(?i)(pass(word|wd)?|secrets?|tokens?|credentials?|key)$`)
+
+// evidence collects the values of the fields the expressions read. Reports
+// are shared with auditors, so the values of passwords, keys and tokens
+// are replaced by a placeholder, and passwords are removed from URLs.
+func evidence(data map[string]interface{}, exprs ...*expr.Expr) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, e := range exprs {
+		if e == nil {
+			continue
+		}
+		for _, name := range e.Fields() {
+			value, _ := expr.Lookup(data, name)
+			values[name] = redactEvidence(name, value)
+		}
+	}
+	return values
+}
+
+// redactEvidence hides value if name is sensitive, and lists the keys of
+// sections; unset and empty values stay as they are, as their absence is
+// the evidence
+func redactEvidence(name string, value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+	if sensitiveField.MatchString(name) {
+		return "[redacted]"
+	}
+	if section, ok := value.(map[string]interface{}); ok {
+		// A section is evidence of the keys it has, not of their values
+		keys := make([]string, 0, len(section))
+		for key := range section {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		list := make([]interface{}, len(keys))
+		for i, key := range keys {
+			list[i] = key
+		}
+		return list
+	}
+	if s, ok := value.(string); ok && strings.Contains(s, "://") {
+		if u, err := url.Parse(s); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				return u.Redacted()
+			}
+		}
+	}
+	return value
+}
+
+// LoadCompliancePolicies reads a policy file, which may hold several
+// policies:
+//
+//	[policies.security]
+//	name: "Security configuration"
+//	severity: "high"
+//
+//	[policies.security.rules.tls]
+//	name: "TLS is enforced"
+//	condition: 'server.tls.enabled == true && server.tls.version in ["1.2", "1.3"]'
+//	message: "serve over TLS 1.2 or later"
+//
+//	[policies.security.rules.debug]
+//	when: 'env == "prod"'
+//	condition: '!debug'
+//	severity: "critical"
+//	controls: ["CC8.1"]
+//
+// Policies and rules are enabled unless they say enabled: false. Rules
+// run in the order of their ids.
+func LoadCompliancePolicies(file string) ([]*Policy, error) {
+	cfg := config.New()
+	if err := cfg.LoadFromFile(file); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", file, err)
+	}
+	return compliancePolicies(cfg, file)
+}
+
+// compliancePolicies reads the policies of cfg, loaded from source
+func compliancePolicies(cfg *config.Config, source string) ([]*Policy, error) {
+	policies := make(map[string]*Policy)
+	rules := make(map[string]map[string]*PolicyRule)
+	for _, key := range cfg.Keys() {
+		value := cfg.Get(key)
+		section, rest, _ := strings.Cut(key, ".")
+		if section != "policies" {
+			return nil, fmt.Errorf("%s: %s: unknown setting", source, key)
+		}
+		policyID, rest, ruleID, field := splitComplianceKey(rest)
+		if policyID == "" || field == "" {
+			return nil, fmt.Errorf("%s: %s: unknown setting", source, key)
+		}
+		policy := policies[policyID]
+		if policy == nil {
+			policy = &Policy{ID: policyID, Enabled: true, Source: source}
+			policies[policyID] = policy
+			rules[policyID] = make(map[string]*PolicyRule)
+		}
+
+		var err error
+		if ruleID == "" {
+			if rest != "" {
+				return nil, fmt.Errorf("%s: %s: unknown setting", source, key)
+			}
+			switch field {
+			case "name":
+				policy.Name = fmt.Sprint(value)
+			case "description":
+				policy.Description = fmt.Sprint(value)
+			case "severity":
+				policy.Severity = fmt.Sprint(value)
+			case "enabled":
+				policy.Enabled, err = boolValue(value)
+			default:
+				err = errors.New("unknown setting")
+			}
+		} else {
+			rule := rules[policyID][ruleID]
+			if rule == nil {
+				rule = &PolicyRule{ID: ruleID, Enabled: true}
+				rules[policyID][ruleID] = rule
+			}
+			switch field {
+			case "name":
+				rule.Name = fmt.Sprint(value)
+			case "condition":
+				rule.Condition = fmt.Sprint(value)
+			case "when":
+				rule.When = fmt.Sprint(value)
+			case "message":
+				rule.Message = fmt.Sprint(value)
+			case "severity":
+				rule.Severity = fmt.Sprint(value)
+			case "controls":
+				rule.Controls, err = configvalue.StringList(value)
+			case "enabled":
+				rule.Enabled, err = boolValue(value)
+			default:
+				err = errors.New("unknown setting")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", source, key, err)
+		}
+	}
+
+	list := make([]*Policy, 0, len(policies))
+	for id, policy := range policies {
+		ids := make([]string, 0, len(rules[id]))
+		for ruleID := range rules[id] {
+			ids = append(ids, ruleID)
+		}
+		sort.Strings(ids)
+		for _, ruleID := range ids {
+			policy.Rules = append(policy.Rules, *rules[id][ruleID])
+		}
+		if policy.Name == "" {
+			policy.Name = id
+		}
+		list = append(list, policy)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// splitComplianceKey splits the rest of policies.<id>.<field> or
+// policies.<id>.rules.<rule>.<field>; ids may be quoted
+func splitComplianceKey(rest string) (policyID, extra, ruleID, field string) {
+	if i := strings.Index(rest, ".rules."); i > 0 {
+		ruleID, field = splitPolicyKey(rest[i+len(".rules."):])
+		return unquote(rest[:i]), "", ruleID, field
+	}
+	policyID, field = splitPolicyKey(rest)
+	if i := strings.Index(policyID, "."); i >= 0 && !strings.HasPrefix(policyID, `"`) {
+		// policies.a.b.c is neither a policy setting nor a rule
+		return policyID[:i], policyID[i+1:], "", field
+	}
+	return policyID, "", "", field
+}
+
+func boolValue(value interface{}) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected true or false, got %v", value)
+	}
+	return b, nil
+}
+
+// LoadComplianceManager creates a ComplianceManager with the policies of
+// files, each a policy file or a directory of .tsk policy files
+func LoadComplianceManager(files ...string) (*ComplianceManager, error) {
+	cm := NewComplianceManager()
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, tskerrors.Wrap(tskerrors.NotFound, err)
+		}
+		paths := []string{file}
+		if info.IsDir() {
+			if paths, err = filepath.Glob(filepath.Join(file, "*.tsk")); err != nil {
+				return nil, err
+			}
+		}
+		for _, path := range paths {
+			policies, err := LoadCompliancePolicies(path)
+			if err != nil {
+				return nil, tskerrors.Wrap(tskerrors.Validation, err)
+			}
+			for _, policy := range policies {
+				if err := cm.CreatePolicy(policy); err != nil {
+					return nil, tskerrors.Wrap(tskerrors.Validation, fmt.Errorf("%s: %w", path, err))
+				}
+			}
+		}
+	}
+	return cm, nil
+}
@@ -0,0 +1,1220 @@
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/auth"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+func TestAuditOptionsFrom(t *testing.T) {
+	opts, err := AuditOptionsFrom(map[string]interface{}{
+		"audit.sinks":            []interface{}{"file", "database"},
+		"audit.file":             "logs/audit.jsonl",
+		"audit.max_size_mb":      2,
+		"audit.retention":        "30d",
+		"audit.flush_interval":   "250ms",
+		"audit.database.adapter": "sqlite",
+		"audit.database.dsn":     "audit.db",
+		"app.name":               "demo",
+	}, "/srv")
+	if err != nil {
+		t.Fatalf("AuditOptionsFrom() returned error: %v", err)
+	}
+	if strings.Join(opts.Sinks, ",") != "file,database" || opts.File != filepath.Join("/srv", "logs/audit.jsonl") ||
+		opts.MaxSize != 2<<20 || opts.Retention != 30*24*time.Hour || opts.FlushInterval != 250*time.Millisecond ||
+		opts.DatabaseDSN != filepath.Join("/srv", "audit.db") || opts.BatchSize != 100 {
+		t.Errorf("AuditOptionsFrom() = %+v", opts)
+	}
+	for key, value := range map[string]interface{}{"sinks": []interface{}{"kafka"}, "max_files": -1, "retention": "soon", "colour": "red"} {
+		if _, err := AuditOptionsFrom(map[string]interface{}{"audit." + key: value}, "."); err == nil {
+			t.Errorf("AuditOptionsFrom() accepted %s: %v", key, value)
+		}
+	}
+}
+
+// memorySink records the batches written to it, failing while fail is set
+type memorySink struct {
+	mu      sync.Mutex
+	batches [][]AuditLog
+	fail    bool
+	closed  bool
+}
+
+func (s *memorySink) Name() string { return "memory" }
+
+func (s *memorySink) Write(logs []AuditLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.batches = append(s.batches, append([]AuditLog(nil), logs...))
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *memorySink) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var actions []string
+	for _, batch := range s.batches {
+		for _, log := range batch {
+			actions = append(actions, log.Action)
+		}
+	}
+	return actions
+}
+
+func TestAuditManagerBatches(t *testing.T) {
+	sink := &memorySink{}
+	am := NewAuditManagerWith(AuditOptions{BatchSize: 2, MaxMemory: 3}, sink)
+	var failures []string
+	am.OnError = func(name string, err error) { failures = append(failures, err.Error()) }
+
+	am.LogEvent("ada", "config:set", "app.name", "10.0.0.1", "tsk", nil)
+	if len(sink.batches) != 0 {
+		t.Fatalf("wrote %v before the batch filled up", sink.written())
+	}
+	am.LogEvent("ada", "config:set", "app.port", "", "", nil)
+	if len(sink.batches) != 1 || len(sink.batches[0]) != 2 {
+		t.Fatalf("batches = %v, want one batch of 2", sink.batches)
+	}
+
+	// A failing sink keeps its logs, and drops the oldest past MaxMemory
+	sink.fail = true
+	for _, action := range []string{"a", "b", "c", "d"} {
+		am.LogEvent("bob", action, "", "", "", nil)
+	}
+	if len(failures) != 2 || !strings.Contains(failures[0], "audit sink memory: unavailable") {
+		t.Errorf("failures = %q", failures)
+	}
+	sink.fail = false
+	err := am.Flush()
+	if got := strings.Join(sink.written(), ","); got != "config:set,config:set,b,c,d" {
+		t.Errorf("written = %s, want the 3 newest logs kept while failing", got)
+	}
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 log(s)") {
+		t.Errorf("Flush() = %v, want the dropped log reported", err)
+	}
+
+	if logs := am.GetAuditLogs("bob", time.Now().Add(-time.Minute), time.Now().Add(time.Minute)); len(logs) != 3 || logs[0].Action != "b" || logs[0].ID == "" {
+		t.Errorf("GetAuditLogs() = %+v, want the 3 logs kept in memory", logs)
+	}
+	if err := am.Close(); err != nil || !sink.closed {
+		t.Errorf("Close() = %v, closed %v", err, sink.closed)
+	}
+}
+
+func TestAuditManagerFlushesInBackground(t *testing.T) {
+	sink := &memorySink{}
+	am := NewAuditManagerWith(AuditOptions{BatchSize: 100, FlushInterval: 10 * time.Millisecond}, sink)
+	defer am.Close()
+	am.LogEvent("ada", "login", "", "", "", nil)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(sink.written()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := sink.written(); len(got) != 1 {
+		t.Errorf("written = %v after the flush interval", got)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	sink, err := OpenFileSink(path, 400, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		user := "ada"
+		if i%2 == 1 {
+			user = "bob"
+		}
+		log := AuditLog{ID: string(rune('a' + i)), UserID: user, Action: "config:set", Resource: "app.name", Timestamp: start.Add(time.Duration(i) * time.Hour)}
+		if err := sink.Write([]AuditLog{log}); err != nil {
+			t.Fatalf("Write() returned error: %v", err)
+		}
+	}
+	rotated, err := RotatedAuditFiles(path)
+	if err != nil || len(rotated) != 2 {
+		t.Fatalf("rotated files = %v, %v; want the 2 newest kept", rotated, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v, %v; want 0600", info.Mode(), err)
+	}
+
+	logs, err := sink.Query(AuditQuery{UserID: "bob", Since: start.Add(4 * time.Hour), Limit: 2})
+	if err != nil {
+		t.Fatalf("Query() returned error: %v", err)
+	}
+	if len(logs) != 2 || logs[0].ID != "h" || logs[1].ID != "j" {
+		t.Errorf("Query() = %+v, want the 2 newest of bob's", logs)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(rotated[0], old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Prune(time.Now().Add(-24 * time.Hour)); err != nil {
+		t.Fatalf("Prune() returned error: %v", err)
+	}
+	if rotated, _ := RotatedAuditFiles(path); len(rotated) != 1 {
+		t.Errorf("rotated files after Prune() = %v", rotated)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write([]AuditLog{{ID: "z"}}); err == nil {
+		t.Error("Write() after Close() succeeded")
+	}
+}
+
+func TestTableSink(t *testing.T) {
+	sink, err := OpenTableSink("sqlite", filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatalf("OpenTableSink() returned error: %v", err)
+	}
+	defer sink.Close()
+	now := time.Now().UTC().Truncate(time.Second)
+	err = sink.Write([]AuditLog{
+		{ID: "1", UserID: "ada", Action: "db:drop", Resource: "users", Timestamp: now.Add(-72 * time.Hour)},
+		{ID: "2", UserID: "ada", Action: "config:set", Resource: "app.name", Timestamp: now.Add(-time.Hour), Metadata: map[string]interface{}{"value": "demo"}},
+		{ID: "3", UserID: "bob", Action: "config:set", Resource: "app.port", Timestamp: now},
+	})
+	if err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+
+	logs, err := sink.Query(AuditQuery{Action: "config:set", Since: now.Add(-2 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Query() returned error: %v", err)
+	}
+	if len(logs) != 2 || logs[0].ID != "2" || logs[1].ID != "3" || logs[0].Metadata["value"] != "demo" || !logs[1].Timestamp.Equal(now) {
+		t.Errorf("Query() = %+v", logs)
+	}
+	if logs, _ := sink.Query(AuditQuery{Limit: 1}); len(logs) != 1 || logs[0].ID != "3" {
+		t.Errorf("Query(Limit: 1) = %+v, want the newest", logs)
+	}
+
+	if err := sink.Prune(now.Add(-24 * time.Hour)); err != nil {
+		t.Fatalf("Prune() returned error: %v", err)
+	}
+	if logs, _ := sink.Query(AuditQuery{UserID: "ada"}); len(logs) != 1 || logs[0].ID != "2" {
+		t.Errorf("ada's logs after Prune() = %+v", logs)
+	}
+
+	if _, err := OpenTableSink("oracle", "dsn"); err == nil {
+		t.Error("OpenTableSink() accepted an unsupported adapter")
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("no syslog")
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sink, err := NewSyslogSink("udp", conn.LocalAddr().String(), "tsk-test")
+	if err != nil {
+		t.Fatalf("NewSyslogSink() returned error: %v", err)
+	}
+	defer sink.Close()
+	if err := sink.Write([]AuditLog{{ID: "1", UserID: "ada", Action: "login"}}); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message := string(buf[:n]); !strings.Contains(message, "tsk-test") || !strings.Contains(message, `"action":"login"`) {
+		t.Errorf("syslog message = %q", message)
+	}
+}
+
+func TestOpenAuditManager(t *testing.T) {
+	dir := t.TempDir()
+	opts, err := AuditOptionsFrom(map[string]interface{}{"audit.retention": "1d"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	am, err := OpenAuditManager(opts)
+	if err != nil {
+		t.Fatalf("OpenAuditManager() returned error: %v", err)
+	}
+	am.Record(AuditLog{UserID: "ada", Action: "config:set", Timestamp: time.Now().Add(-48 * time.Hour)})
+	am.LogEvent("ada", "config:get", "app.name", "", "", nil)
+	if err := am.ApplyRetention(); err != nil {
+		t.Fatal(err)
+	}
+	logs, err := am.Query(AuditQuery{UserID: "ada"})
+	if err != nil {
+		t.Fatalf("Query() returned error: %v", err)
+	}
+	// The file is append-only: retention drops whole rotated files only
+	if len(logs) != 2 {
+		t.Errorf("Query() = %+v, want both logs read back from the file", logs)
+	}
+	if err := am.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if logs, _ := QueryAuditFile(filepath.Join(dir, DefaultAuditFile), AuditQuery{Action: "config:get"}); len(logs) != 1 {
+		t.Errorf("QueryAuditFile() = %+v", logs)
+	}
+}
+
+func TestRBACManager(t *testing.T) {
+	rbac := NewRBACManager()
+	if err := rbac.CreateRole(&Role{Name: "editor", Permissions: []string{"config:read", "config:write"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbac.CreateRole(&Role{Name: "bad", Permissions: []string{"write"}}); err == nil {
+		t.Error("CreateRole() accepted a permission without an action")
+	}
+	if err := rbac.CreateUser(&User{ID: "ada", Permissions: []string{"db:admin"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbac.CreateUser(&User{ID: "bob", Roles: []string{"owner"}}); err == nil {
+		t.Error("CreateUser() accepted an unknown role")
+	}
+	if rbac.CheckPermission("ada", "config", "write") {
+		t.Error("ada may config:write before being given the editor role")
+	}
+	if err := rbac.AssignRole("ada", "editor"); err != nil {
+		t.Fatal(err)
+	}
+	if grant, ok := rbac.Check("ada", "config:write"); !ok || grant.Source() != "editor" {
+		t.Errorf("Check(config:write) = %+v, %v; want granted by editor", grant, ok)
+	}
+	if grant, ok := rbac.Check("ada", "db:admin"); !ok || grant.Source() != "user" {
+		t.Errorf("Check(db:admin) = %+v, %v; want granted to the user", grant, ok)
+	}
+	err := rbac.Authorize("bob", "config:read")
+	if !errors.Is(err, ErrAccessDenied) || tskerrors.KindOf(err) != tskerrors.Permission {
+		t.Errorf("Authorize() of an unknown user = %v", err)
+	}
+}
+
+func TestRoleInheritance(t *testing.T) {
+	rbac := NewRBACManager()
+	for _, role := range []*Role{
+		{Name: "admin", Permissions: []string{"db:*"}, InheritsFrom: []string{"editor", "auditor"}},
+		{Name: "editor", Permissions: []string{"config:write"}, InheritsFrom: []string{"viewer"}},
+		{Name: "auditor", Permissions: []string{"audit:read"}, InheritsFrom: []string{"viewer"}},
+		{Name: "viewer", Permissions: []string{"config:read"}},
+		{Name: "root", Permissions: []string{"*"}},
+	} {
+		if err := rbac.CreateRole(role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rbac.Validate(); err != nil {
+		t.Fatalf("Validate() returned error: %v", err)
+	}
+	rbac.CreateUser(&User{ID: "ada", Roles: []string{"admin"}, Permissions: []string{"config:read"}})
+	rbac.CreateUser(&User{ID: "bob", Roles: []string{"auditor"}})
+
+	grants, err := rbac.EffectivePermissions("ada")
+	if err != nil {
+		t.Fatalf("EffectivePermissions() returned error: %v", err)
+	}
+	var got []string
+	for _, grant := range grants {
+		got = append(got, grant.Permission+"="+grant.Source())
+	}
+	// config:read is held directly, so the roles granting it again are not listed
+	want := "config:read=user db:*=admin config:write=admin > editor audit:read=admin > auditor"
+	if strings.Join(got, " ") != want {
+		t.Errorf("EffectivePermissions() = %s, want %s", strings.Join(got, " "), want)
+	}
+	for permission, want := range map[string]bool{"db:drop": true, "db:admin": true, "config:write": true, "config:delete": false, "license:admin": false} {
+		if got := rbac.CheckPermission("ada", strings.Split(permission, ":")[0], strings.Split(permission, ":")[1]); got != want {
+			t.Errorf("ada may %s = %v, want %v", permission, got, want)
+		}
+	}
+
+	// The cache is dropped when roles change
+	if rbac.CheckPermission("bob", "license", "admin") {
+		t.Fatal("bob may license:admin before becoming root")
+	}
+	if err := rbac.AssignRole("bob", "root"); err != nil {
+		t.Fatal(err)
+	}
+	if grant, ok := rbac.Check("bob", "license:admin"); !ok || grant.Source() != "root" {
+		t.Errorf("Check() after AssignRole() = %+v, %v", grant, ok)
+	}
+
+	rbac.CreateRole(&Role{Name: "ops", InheritsFrom: []string{"oncall"}})
+	rbac.CreateRole(&Role{Name: "oncall", InheritsFrom: []string{"sre"}})
+	rbac.CreateRole(&Role{Name: "sre", Permissions: []string{"db:admin"}, InheritsFrom: []string{"ops"}})
+	if err := rbac.Validate(); err == nil || !strings.Contains(err.Error(), "oncall > sre > ops > oncall") {
+		t.Errorf("Validate() of a cycle = %v", err)
+	}
+	rbac.CreateUser(&User{ID: "eve", Roles: []string{"sre"}})
+	if _, err := rbac.EffectivePermissions("eve"); err == nil {
+		t.Error("EffectivePermissions() resolved a cycle")
+	}
+	if err := rbac.Authorize("eve", "db:admin"); !errors.Is(err, ErrAccessDenied) || !strings.Contains(err.Error(), "inherits from itself") {
+		t.Errorf("Authorize() through a cycle = %v", err)
+	}
+}
+
+func TestLoadAccessPolicy(t *testing.T) {
+	dir := t.TempDir()
+	if policy, err := FindAccessPolicy(dir); policy != nil || err != nil {
+		t.Fatalf("FindAccessPolicy() without a file = %v, %v", policy, err)
+	}
+	os.WriteFile(filepath.Join(dir, AccessPolicyFile), []byte(`
+[roles.viewer]
+permissions: ["config:read"]
+
+[roles.admin]
+description: "Changes configuration and databases"
+permissions: ["config:read", "config:write", "db:admin"]
+
+[users.ada]
+roles: ["admin"]
+
+[users."ci@example.com"]
+roles: ["viewer"]
+
+[commands]
+"promote": "config:promote"
+"config set": ""
+
+[routes]
+"GET /v1/hierarchy": "config:admin"
+`), 0644)
+	policy, err := FindAccessPolicy(dir)
+	if err != nil {
+		t.Fatalf("FindAccessPolicy() returned error: %v", err)
+	}
+	if got := strings.Join(policy.Users(), ","); got != "ada,ci@example.com" {
+		t.Errorf("Users() = %s", got)
+	}
+	for path, want := range map[string]string{"db drop": "db:admin", "promote": "config:promote", "promote approve": "config:promote", "config set": "", "version": ""} {
+		if got := policy.CommandPermission(path); got != want {
+			t.Errorf("CommandPermission(%q) = %q, want %q", path, got, want)
+		}
+	}
+	if err := policy.AuthorizeCommand("ada", "db drop"); err != nil {
+		t.Errorf("AuthorizeCommand(ada, db drop) = %v", err)
+	}
+	if err := policy.AuthorizeCommand("ci@example.com", "db drop"); !errors.Is(err, ErrAccessDenied) || !strings.Contains(err.Error(), "tsk db drop") {
+		t.Errorf("AuthorizeCommand(ci, db drop) = %v", err)
+	}
+
+	// The header alone names nobody
+	req, _ := http.NewRequest("GET", "/v1/config", nil)
+	req.Header.Set(UserHeader, "ada")
+	if err := policy.AuthorizeRequest(req, "GET /v1/config"); !errors.Is(err, ErrAccessDenied) || tskerrors.KindOf(err) != tskerrors.Permission {
+		t.Errorf("AuthorizeRequest() without an identity = %v, want denied", err)
+	}
+	ci := req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{User: "ci@example.com"}))
+	if err := policy.AuthorizeRequest(ci, "GET /v1/config"); err != nil {
+		t.Errorf("AuthorizeRequest(GET /v1/config) = %v", err)
+	}
+	for _, route := range []string{"GET /v1/hierarchy", "PUT /v1/config/{key}"} {
+		if err := policy.AuthorizeRequest(ci, route); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("AuthorizeRequest(%s) = %v, want denied", route, err)
+		}
+	}
+	// The authenticated identity wins over the header
+	ci.Header.Set(UserHeader, "ada")
+	if err := policy.AuthorizeRequest(ci, "PUT /v1/config/{key}"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("AuthorizeRequest() as ci claiming ada = %v, want denied", err)
+	}
+
+	t.Setenv(AccessPolicyEnv, filepath.Join(dir, "other.tsk"))
+	os.WriteFile(filepath.Join(dir, "other.tsk"), []byte("[users.ada]\nroles: [\"owner\"]\n"), 0644)
+	if _, err := FindAccessPolicy(dir); err == nil || !strings.Contains(err.Error(), "role not found: owner") {
+		t.Errorf("FindAccessPolicy() of $%s = %v", AccessPolicyEnv, err)
+	}
+	os.WriteFile(filepath.Join(dir, "other.tsk"), []byte("[roles.ops]\ninherits_from: [\"sre\"]\n"), 0644)
+	if _, err := FindAccessPolicy(dir); err == nil || !strings.Contains(err.Error(), "role ops inherits from a missing role: sre") {
+		t.Errorf("FindAccessPolicy() with a missing parent role = %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "other.tsk"), []byte("[groups.ops]\nmembers: [\"ada\"]\n"), 0644)
+	if _, err := FindAccessPolicy(dir); err == nil || tskerrors.KindOf(err) != tskerrors.Validation {
+		t.Errorf("FindAccessPolicy() with an unknown section = %v", err)
+	}
+}
+
+const compliancePolicy = `
+[policies.security]
+name: "Security configuration"
+severity: "high"
+
+[policies.security.rules.tls]
+name: "TLS is enforced"
+condition: 'server.tls.enabled == true && server.tls.version in ["1.2", "1.3"]'
+message: "serve over TLS 1.2 or later"
+
+[policies.security.rules.debug]
+when: 'env == "prod"'
+condition: '!debug'
+severity: "critical"
+
+[policies.security.rules.port]
+condition: 'server.port > "1024"'
+
+[policies.ops]
+severity: "low"
+
+[policies.ops.rules.replicas]
+condition: 'replicas >= 2 || env != "prod"'
+
+[policies.ops.rules.db]
+condition: 'db.host =~ "\\.internal$" && db.pool <= db.max_pool'
+enabled: false
+`
+
+func TestUserTokenAuthenticator(t *testing.T) {
+	a := UserTokenAuthenticator{Token: "s3cret"}
+	request := func(authorization, user string) *http.Request {
+		req, _ := http.NewRequest("GET", "/v1/config", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if user != "" {
+			req.Header.Set(UserHeader, user)
+		}
+		return req
+	}
+
+	id, err := a.Authenticate(request("Bearer s3cret", "ada"))
+	if err != nil || id.User != "ada" || id.Method != auth.TokenMethod {
+		t.Errorf("Authenticate() with the token = %+v, %v", id, err)
+	}
+	if _, err := a.Authenticate(request("", "ada")); !errors.Is(err, auth.ErrNoCredentials) {
+		t.Errorf("Authenticate() without a token = %v, want no credentials", err)
+	}
+	for _, req := range []*http.Request{request("Bearer guess", "ada"), request("Bearer s3cret", "")} {
+		if _, err := a.Authenticate(req); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%v) = %v, want invalid credentials", req.Header, err)
+		}
+	}
+	if _, err := (UserTokenAuthenticator{}).Authenticate(request("Bearer ", "ada")); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Errorf("Authenticate() without a token set = %v, want invalid credentials", err)
+	}
+}
+
+func TestComplianceManager(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, CompliancePolicyFile)
+	os.WriteFile(file, []byte(compliancePolicy), 0644)
+	cm, err := LoadComplianceManager(file)
+	if err != nil {
+		t.Fatalf("LoadComplianceManager() returned error: %v", err)
+	}
+	policies := cm.Policies()
+	if len(policies) != 2 || policies[1].Name != "Security configuration" || len(policies[1].Rules) != 3 || policies[1].Source != file {
+		t.Fatalf("Policies() = %+v", policies)
+	}
+
+	data := map[string]interface{}{
+		"env":                "prod",
+		"debug":              true,
+		"replicas":           3,
+		"server.port":        8443,
+		"server.tls.enabled": true,
+		"server.tls.version": "1.1",
+	}
+	report := cm.Evaluate("config", data)
+	statuses := map[string]RuleStatus{}
+	for _, r := range report.Results {
+		statuses[r.PolicyID+"/"+r.RuleID] = r.Status
+	}
+	want := map[string]RuleStatus{
+		"security/tls":   RuleFailed,
+		"security/debug": RuleFailed,
+		"security/port":  RuleError,
+		"ops/replicas":   RulePassed,
+	}
+	if len(statuses) != len(want) {
+		t.Errorf("results = %v, want %v", statuses, want)
+	}
+	for rule, status := range want {
+		if statuses[rule] != status {
+			t.Errorf("%s = %s, want %s", rule, statuses[rule], status)
+		}
+	}
+	if report.Compliant() || len(report.Violations) != 3 || report.Counts[RulePassed] != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	for _, v := range report.Violations {
+		switch v.RuleID {
+		case "tls":
+			if v.Message != "serve over TLS 1.2 or later" || v.Severity != SeverityHigh || v.Values["server.tls.version"] != "1.1" {
+				t.Errorf("tls violation = %+v", v)
+			}
+		case "debug":
+			if v.Severity != SeverityCritical || v.Values["env"] != "prod" {
+				t.Errorf("debug violation = %+v", v)
+			}
+		case "port":
+			if !strings.Contains(v.Message, "cannot compare") {
+				t.Errorf("port violation = %+v", v)
+			}
+		}
+	}
+
+	// Outside prod the debug rule does not apply
+	data["env"], data["server.tls.version"], data["server.port"] = "dev", "1.3", "8443"
+	compliant, violations, err := cm.EvaluatePolicy("security", "config", data)
+	if err != nil || !compliant || len(violations) != 0 {
+		t.Errorf("EvaluatePolicy() = %t, %+v, %v", compliant, violations, err)
+	}
+	if _, _, err := cm.EvaluatePolicy("nope", "config", data); tskerrors.KindOf(err) != tskerrors.NotFound {
+		t.Errorf("EvaluatePolicy(nope) = %v", err)
+	}
+	if got := cm.Violations(); len(got) != 3 || got[0].ID == got[1].ID {
+		t.Errorf("Violations() = %+v", got)
+	}
+
+	if err := cm.CreatePolicy(&Policy{ID: "ops"}); err == nil {
+		t.Error("CreatePolicy() accepted a duplicate id")
+	}
+	for _, policy := range []*Policy{
+		{ID: "a", Severity: "urgent"},
+		{ID: "b", Rules: []PolicyRule{{ID: "r", Condition: "a =="}}},
+		{ID: "c", Rules: []PolicyRule{{ID: "r"}}},
+		{ID: "d", Rules: []PolicyRule{{ID: "r", Condition: "a", When: "("}}},
+	} {
+		if err := cm.CreatePolicy(policy); err == nil {
+			t.Errorf("CreatePolicy(%s) accepted an invalid policy", policy.ID)
+		}
+	}
+}
+
+func TestLoadCompliancePolicies(t *testing.T) {
+	dir := t.TempDir()
+	for content, want := range map[string]string{
+		"[policies.a]\ncolour: \"red\"\n":                   "unknown setting",
+		"[rules.a]\ncondition: \"x\"\n":                     "unknown setting",
+		"[policies.a.rules.r]\nenabled: \"yes\"\n":          "expected true or false",
+		"[policies.a.rules.r]\ncondition: 'x =='\n":         "condition",
+		"[policies.a.rules.r]\nmessage: \"no condition\"\n": "no condition",
+	} {
+		file := filepath.Join(dir, "bad.tsk")
+		os.WriteFile(file, []byte(content), 0644)
+		_, err := LoadComplianceManager(file)
+		if err == nil || !strings.Contains(err.Error(), want) || tskerrors.KindOf(err) != tskerrors.Validation {
+			t.Errorf("LoadComplianceManager(%q) = %v, want %q", content, err, want)
+		}
+	}
+	if _, err := LoadComplianceManager(filepath.Join(dir, "missing.tsk")); tskerrors.KindOf(err) != tskerrors.NotFound {
+		t.Errorf("LoadComplianceManager(missing) = %v", err)
+	}
+
+	// A directory is a pack of policy files
+	packs := filepath.Join(dir, "packs")
+	os.Mkdir(packs, 0755)
+	os.WriteFile(filepath.Join(packs, "a.tsk"), []byte("[policies.a.rules.r]\ncondition: 'true'\n"), 0644)
+	os.WriteFile(filepath.Join(packs, "b.tsk"), []byte("[policies.b.rules.r]\ncondition: 'x > 1'\n"), 0644)
+	cm, err := LoadComplianceManager(packs)
+	if err != nil || len(cm.Policies()) != 2 {
+		t.Fatalf("LoadComplianceManager(dir) = %v, %v", cm, err)
+	}
+	os.WriteFile(filepath.Join(packs, "c.tsk"), []byte("[policies.a.rules.s]\ncondition: 'true'\n"), 0644)
+	if _, err := LoadComplianceManager(packs); err == nil || !strings.Contains(err.Error(), "policy already exists: a") {
+		t.Errorf("LoadComplianceManager() with a duplicate policy = %v", err)
+	}
+}
+
+func TestStandards(t *testing.T) {
+	standards := Standards()
+	if len(standards) != 3 || standards[0].ID != "hipaa" || standards[1].ID != "pci" || standards[2].ID != "soc2" {
+		t.Fatalf("Standards() = %v", standards)
+	}
+	for _, standard := range standards {
+		for _, rule := range standard.Rules {
+			if len(rule.Controls) == 0 || rule.Name == "" || rule.Message == "" {
+				t.Errorf("%s/%s names no control, or has no name or message", standard.ID, rule.ID)
+			}
+		}
+	}
+	if _, err := Standard("iso27001"); tskerrors.KindOf(err) != tskerrors.NotFound {
+		t.Errorf("Standard(iso27001) = %v", err)
+	}
+
+	compliant := map[string]interface{}{
+		"env":              "production",
+		"debug":            false,
+		"log.level":        "info",
+		"server.port":      8443,
+		"server.tls_cert":  "certs/site.crt",
+		"server.tls_key":   "certs/site.key",
+		"auth.tokens.ci":   "sha256:0123",
+		"encryption.key":   strings.Repeat("k", 44),
+		"database.url":     "postgres://app:hunter2@db/app?sslmode=verify-full",
+		"audit.retention":  "2190d",
+		"auth.session_ttl": "8h",
+	}
+	cm := NewComplianceManager()
+	for _, standard := range standards {
+		if err := cm.CreatePolicy(standard); err != nil {
+			t.Fatalf("CreatePolicy(%s) returned error: %v", standard.ID, err)
+		}
+	}
+	if report := cm.Evaluate("config", compliant); !report.Compliant() {
+		t.Errorf("Evaluate() of a compliant configuration = %+v", report.Violations)
+	}
+
+	failing := map[string]interface{}{
+		"env":             "prod",
+		"debug":           true,
+		"server.port":     80,
+		"database.url":    "postgres://app:hunter2@db/app?sslmode=disable",
+		"audit.retention": "90d",
+	}
+	report := cm.Evaluate("config", failing)
+	failed := map[string]bool{}
+	for _, v := range report.Violations {
+		if v.PolicyID == "soc2" {
+			failed[v.RuleID] = true
+		}
+	}
+	for _, rule := range []string{"authentication", "encryption-key", "tls", "database-tls", "audit-retention", "debug"} {
+		if !failed[rule] {
+			t.Errorf("soc2/%s passed a failing configuration", rule)
+		}
+	}
+	if len(failed) != 6 {
+		t.Errorf("soc2 violations = %v", failed)
+	}
+	for _, result := range report.Results {
+		if result.RuleID == "database-tls" && result.Values["database.url"] != "postgres://app:xxxxx@db/app?sslmode=disable" {
+			t.Errorf("database-tls evidence = %v", result.Values)
+		}
+	}
+}
+
+func TestEvidenceReport(t *testing.T) {
+	cm := NewComplianceManager()
+	if _, err := cm.AddStandard("pci"); err != nil {
+		t.Fatalf("AddStandard() returned error: %v", err)
+	}
+	// A loaded policy of the same id replaces the built-in one
+	custom := &Policy{ID: "soc2", Name: "<Custom>", Enabled: true, Rules: []PolicyRule{
+		{ID: "a", Condition: "replicas > 1", Controls: []string{"CC6.10", "A1.2"}, Enabled: true},
+		{ID: "b", Condition: `api_key != ""`, Controls: []string{"CC6.7"}, Enabled: true},
+		{ID: "c", Condition: "true", Enabled: true},
+	}}
+	if err := cm.CreatePolicy(custom); err != nil {
+		t.Fatal(err)
+	}
+	if policy, err := cm.AddStandard("soc2"); err != nil || policy != custom {
+		t.Fatalf("AddStandard(soc2) = %v, %v", policy, err)
+	}
+
+	report := NewEvidenceReport(custom, cm.Evaluate("svc", map[string]interface{}{"replicas": 1, "api_key": "s3cr3t"}))
+	var ids []string
+	for _, control := range report.Controls {
+		ids = append(ids, control.ID+":"+string(control.Status))
+	}
+	if want := "A1.2:fail CC6.7:pass CC6.10:fail :pass"; strings.Join(ids, " ") != want {
+		t.Errorf("controls = %v, want %s", ids, want)
+	}
+	if report.Compliant || report.Counts[RulePassed] != 2 || report.Counts[RuleFailed] != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	if got := report.Controls[1].Results[0].Values["api_key"]; got != "[redacted]" {
+		t.Errorf("api_key evidence = %v", got)
+	}
+
+	var buf strings.Builder
+	if err := report.RenderHTML(&buf); err != nil {
+		t.Fatalf("RenderHTML() returned error: %v", err)
+	}
+	html := buf.String()
+	for _, want := range []string{"&lt;Custom&gt; evidence for <code>svc</code>", "not compliant", `rowspan="1"><strong>CC6.10</strong>`, "<strong>Other</strong>", "1 failed"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("RenderHTML() lacks %q", want)
+		}
+	}
+	if strings.Contains(html, "s3cr3t") {
+		t.Error("RenderHTML() shows a secret")
+	}
+}
+
+func TestWorkflowExecution(t *testing.T) {
+	wm := NewWorkflowManager(nil)
+	var calls []string
+	var mu sync.Mutex
+	flaky := 0
+	wm.RegisterHandler("record", func(ctx context.Context, run *StepRun) (map[string]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, run.Step.ID)
+		if run.Step.ID == "flaky" {
+			if flaky++; flaky < 3 {
+				return nil, errors.New("not yet")
+			}
+		}
+		return map[string]interface{}{"tag": run.Params["tag"], "attempt": run.Attempt}, nil
+	})
+	if err := wm.RegisterHandler("set", setStep); err == nil {
+		t.Error("RegisterHandler() replaced a built-in step type")
+	}
+
+	workflow := &Workflow{ID: "deploy", Steps: []WorkflowStep{
+		{ID: "prepare", Type: "set", Parameters: map[string]interface{}{"tag": "app:${input.version}", "count": "${input.count}"}, NextSteps: []string{"flaky"}},
+		{ID: "flaky", Type: "record", NextSteps: []string{"prod", "staging"},
+			RetryPolicy: RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond, Backoff: BackoffExponential}},
+		{ID: "prod", Type: "record", Conditions: []string{`input.env == "prod"`}, NextSteps: []string{"notify"}},
+		{ID: "staging", Type: "record", Conditions: []string{`input.env != "prod"`}, NextSteps: []string{"notify"}},
+		{ID: "notify", Type: "record", Parameters: map[string]interface{}{"tag": "${steps.prepare.output.tag}"}},
+	}}
+	if err := wm.CreateWorkflow(workflow); err != nil {
+		t.Fatalf("CreateWorkflow() returned error: %v", err)
+	}
+	if workflow.Start != "prepare" {
+		t.Errorf("Start = %q", workflow.Start)
+	}
+
+	execution, err := wm.ExecuteWorkflow(context.Background(), "deploy", map[string]interface{}{"env": "prod", "version": "1.4", "count": 3})
+	if err != nil || execution.Status != ExecutionCompleted || execution.CompletedAt == nil {
+		t.Fatalf("ExecuteWorkflow() = %+v, %v", execution, err)
+	}
+	if got := strings.Join(calls, " "); got != "flaky flaky flaky prod notify" {
+		t.Errorf("steps run = %s", got)
+	}
+	status := map[string]StepStatus{}
+	for _, step := range execution.Steps {
+		status[step.ID] = step.Status
+	}
+	if status["prepare"] != StepCompleted || status["staging"] != StepSkipped || status["notify"] != StepCompleted {
+		t.Errorf("step statuses = %v", status)
+	}
+	if step := execution.Steps[1]; step.ID != "flaky" || step.Attempts != 3 || step.Error != "" {
+		t.Errorf("flaky step = %+v", step)
+	}
+	if execution.Steps[0].Output["count"] != 3 || execution.Steps[4].Output["tag"] != "app:1.4" {
+		t.Errorf("output = %v", execution.Output)
+	}
+
+	if _, err := wm.ExecuteWorkflow(context.Background(), "missing", nil); tskerrors.KindOf(err) != tskerrors.NotFound {
+		t.Errorf("ExecuteWorkflow(missing) = %v", err)
+	}
+	wm.CreateWorkflow(&Workflow{ID: "unknown", Steps: []WorkflowStep{{ID: "a", Type: "teleport"}}})
+	if _, err := wm.ExecuteWorkflow(context.Background(), "unknown", nil); tskerrors.KindOf(err) != tskerrors.Validation {
+		t.Errorf("ExecuteWorkflow() of an unknown step type = %v", err)
+	}
+}
+
+func TestWorkflowFailures(t *testing.T) {
+	wm := NewWorkflowManager(nil)
+	wm.RegisterHandler("fail", func(ctx context.Context, run *StepRun) (map[string]interface{}, error) {
+		return nil, errors.New("broken")
+	})
+	wm.RegisterHandler("hang", func(ctx context.Context, run *StepRun) (map[string]interface{}, error) {
+		select {} // ignores its context
+	})
+	wm.RegisterHandler("panic", func(ctx context.Context, run *StepRun) (map[string]interface{}, error) {
+		panic("boom")
+	})
+	for _, step := range []WorkflowStep{
+		{ID: "fail", Type: "fail", RetryPolicy: RetryPolicy{MaxAttempts: 2}},
+		{ID: "hang", Type: "hang", Timeout: 20 * time.Millisecond},
+		{ID: "sleep", Type: "sleep", Timeout: 20 * time.Millisecond, Parameters: map[string]interface{}{"duration": "1h"}},
+		{ID: "panic", Type: "panic"},
+		{ID: "wait", Type: "sleep", Parameters: map[string]interface{}{"duration": "1h"}},
+	} {
+		wm.CreateWorkflow(&Workflow{ID: step.ID, Steps: []WorkflowStep{step, {ID: "after", Type: "set"}}})
+	}
+	for id, want := range map[string]string{
+		"fail":  "step fail: broken",
+		"hang":  "step hang: timed out after 20ms",
+		"sleep": "step sleep: timed out after 20ms",
+		"panic": "step panic: step handler panicked: boom",
+	} {
+		execution, err := wm.ExecuteWorkflow(context.Background(), id, nil)
+		if err == nil || err.Error() != want || execution.Status != ExecutionFailed {
+			t.Errorf("ExecuteWorkflow(%s) = %v, want %s", id, err, want)
+			continue
+		}
+		if len(execution.Steps) != 1 || execution.Steps[0].Status != StepFailed || execution.Pending[0] != id {
+			t.Errorf("ExecuteWorkflow(%s) steps = %+v, pending %v", id, execution.Steps, execution.Pending)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	execution, err := wm.ExecuteWorkflow(ctx, "wait", nil)
+	if err == nil || execution.Status != ExecutionCancelled {
+		t.Errorf("ExecuteWorkflow() interrupted = %v, %v", execution.Status, err)
+	}
+
+	for _, policy := range []struct {
+		policy RetryPolicy
+		want   []time.Duration
+	}{
+		{RetryPolicy{Delay: time.Second}, []time.Duration{time.Second, time.Second, time.Second}},
+		{RetryPolicy{Delay: time.Second, Backoff: BackoffLinear}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+		{RetryPolicy{Delay: time.Second, Backoff: BackoffExponential, MaxDelay: 3 * time.Second}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+	} {
+		for i, want := range policy.want {
+			if got := policy.policy.Wait(i + 1); got != want {
+				t.Errorf("%+v.Wait(%d) = %s, want %s", policy.policy, i+1, got, want)
+			}
+		}
+	}
+
+	for workflow, want := range map[*Workflow]string{
+		{ID: "a", Steps: []WorkflowStep{{ID: "x", Type: "set"}, {ID: "x", Type: "set"}}}:                      "duplicate one",
+		{ID: "b", Steps: []WorkflowStep{{ID: "x", Type: "set", NextSteps: []string{"y"}}}}:                    "next: no step y",
+		{ID: "c", Steps: []WorkflowStep{{ID: "x", Type: "set", Conditions: []string{"a =="}}}}:                "when",
+		{ID: "d", Steps: []WorkflowStep{{ID: "x", Type: "set", RetryPolicy: RetryPolicy{Backoff: "random"}}}}: "unknown backoff",
+		{ID: "e", Steps: []WorkflowStep{{ID: "x", Type: "set", NextSteps: []string{"x"}}}}:                    "lead back to themselves: x → x",
+		{ID: "f", Steps: []WorkflowStep{{ID: "x"}}}:                                                           "no type",
+		{ID: "g", Start: "y", Steps: []WorkflowStep{{ID: "x", Type: "set"}}}:                                  "start: no step y",
+		{ID: "h"}: "no steps",
+	} {
+		if err := wm.CreateWorkflow(workflow); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("CreateWorkflow(%s) = %v, want %q", workflow.ID, err, want)
+		}
+	}
+}
+
+func TestWorkflowResume(t *testing.T) {
+	store := NewFileExecutionStore(filepath.Join(t.TempDir(), "executions"))
+	workflow := &Workflow{ID: "nightly", Steps: []WorkflowStep{
+		{ID: "backup", Type: "count"},
+		{ID: "upload", Type: "count"},
+		{ID: "report", Type: "count"},
+	}}
+	runs := map[string]int{}
+	var failUpload bool
+	newManager := func() *WorkflowManager {
+		wm := NewWorkflowManager(store)
+		wm.RegisterHandler("count", func(ctx context.Context, run *StepRun) (map[string]interface{}, error) {
+			runs[run.Step.ID]++
+			if run.Step.ID == "upload" && failUpload {
+				return nil, errors.New("network down")
+			}
+			return map[string]interface{}{"runs": runs[run.Step.ID]}, nil
+		})
+		if err := wm.CreateWorkflow(workflow); err != nil {
+			t.Fatal(err)
+		}
+		return wm
+	}
+
+	failUpload = true
+	execution, err := newManager().ExecuteWorkflow(context.Background(), "nightly", nil)
+	if err == nil || execution.Status != ExecutionFailed {
+		t.Fatalf("ExecuteWorkflow() = %v, %v", execution, err)
+	}
+	saved, err := store.LoadExecution(execution.ID)
+	if err != nil || saved.Status != ExecutionFailed || saved.Pending[0] != "upload" || saved.Steps[1].Error != "network down" {
+		t.Fatalf("LoadExecution() = %+v, %v", saved, err)
+	}
+
+	// A process that stopped during upload left it running
+	saved.Status = ExecutionRunning
+	saved.Steps[1].Status = StepRunning
+	saved.CompletedAt = nil
+	if err := store.SaveExecution(saved); err != nil {
+		t.Fatal(err)
+	}
+	failUpload = false
+	wm := newManager()
+	resumed, err := wm.ResumeExecution(context.Background(), execution.ID)
+	if err != nil || resumed.Status != ExecutionCompleted {
+		t.Fatalf("ResumeExecution() = %+v, %v", resumed, err)
+	}
+	if runs["backup"] != 1 || runs["upload"] != 2 || runs["report"] != 1 || len(resumed.Steps) != 3 || resumed.Steps[1].Attempts != 2 {
+		t.Errorf("runs = %v, steps = %+v", runs, resumed.Steps)
+	}
+	if _, err := wm.ResumeExecution(context.Background(), execution.ID); tskerrors.KindOf(err) != tskerrors.Conflict {
+		t.Errorf("ResumeExecution() of a completed execution = %v", err)
+	}
+	if _, err := wm.ResumeExecution(context.Background(), "../escape"); tskerrors.KindOf(err) != tskerrors.NotFound {
+		t.Errorf("ResumeExecution(../escape) = %v", err)
+	}
+
+	executions, err := newManager().Executions()
+	if err != nil || len(executions) != 1 || executions[0].Status != ExecutionCompleted {
+		t.Errorf("Executions() = %v, %v", executions, err)
+	}
+}
+
+func TestLoadWorkflows(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, WorkflowFile)
+	os.WriteFile(file, []byte(`[workflows.deploy]
+name: "Deploy"
+
+[workflows.deploy.steps.test]
+type: "command"
+command: "go test ./..."
+timeout: "10m"
+next: ["build"]
+
+[workflows.deploy.steps.build]
+type: "command"
+command: ["docker", "build", "."]
+env.CGO_ENABLED: 0
+retry.max_attempts: 3
+retry.delay: "5s"
+retry.backoff: "exponential"
+next: ["announce"]
+
+[workflows.deploy.steps.announce]
+when: 'input.env == "prod"'
+type: "http"
+url: "https://example.com/releases/${input.version}"
+
+[workflows.cleanup.steps.prune]
+type: "command"
+command: "docker system prune -f"
+`), 0644)
+	workflows, err := LoadWorkflows(file)
+	if err != nil || len(workflows) != 2 {
+		t.Fatalf("LoadWorkflows() = %v, %v", workflows, err)
+	}
+	deploy := workflows[1]
+	if deploy.ID != "deploy" || deploy.Name != "Deploy" || len(deploy.Steps) != 3 || workflows[0].Name != "cleanup" {
+		t.Fatalf("workflows = %+v", workflows)
+	}
+	if ids := deploy.Steps[0].ID + deploy.Steps[1].ID + deploy.Steps[2].ID; ids != "testbuildannounce" {
+		t.Errorf("steps in order %s", ids)
+	}
+	build := deploy.Steps[1]
+	if build.RetryPolicy != (RetryPolicy{MaxAttempts: 3, Delay: 5 * time.Second, Backoff: BackoffExponential}) ||
+		build.NextSteps[0] != "announce" || build.Parameters["env.CGO_ENABLED"] != 0 || deploy.Steps[0].Timeout != 10*time.Minute {
+		t.Errorf("build = %+v", build)
+	}
+	if deploy.Steps[2].Conditions[0] != `input.env == "prod"` {
+		t.Errorf("announce = %+v", deploy.Steps[2])
+	}
+	if err := NewWorkflowManager(nil).CreateWorkflow(deploy); err != nil {
+		t.Errorf("CreateWorkflow() returned error: %v", err)
+	}
+
+	for content, want := range map[string]string{
+		"[deploy.steps.a]\ntype: \"set\"\n":                     "unknown setting",
+		"[workflows.a]\ncolour: \"red\"\n":                      "unknown setting",
+		"[workflows.a.steps.b]\ntimeout: \"soon\"\n":            "timeout",
+		"[workflows.a.steps.b]\nretry.max_attempts: \"many\"\n": "retry.max_attempts",
+		"[workflows.a.steps.b]\nretry.jitter: true\n":           "unknown setting",
+	} {
+		os.WriteFile(file, []byte(content), 0644)
+		if _, err := LoadWorkflows(file); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadWorkflows(%q) = %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	var got []string
+	bus.Subscribe(EventConfigChange, func(e Event) { got = append(got, "config:"+e.Source) })
+	unsubscribe := bus.Subscribe("*", func(e Event) { got = append(got, "any:"+e.Type) })
+	bus.Subscribe(EventServiceState, func(e Event) { got = append(got, "service:"+e.Source) })
+
+	bus.Publish(Event{Type: EventConfigChange, Source: "peanu.tsk"})
+	unsubscribe()
+	bus.Publish(Event{Type: EventServiceState, Source: "api"})
+	if want := "config:peanu.tsk any:config.change service:api"; strings.Join(got, " ") != want {
+		t.Errorf("delivered %v, want %s", got, want)
+	}
+
+	before := &ComplianceReport{Violations: []ComplianceViolation{{PolicyID: "sec", RuleID: "tls", Resource: "config"}}}
+	after := &ComplianceReport{Violations: []ComplianceViolation{
+		{PolicyID: "sec", RuleID: "tls", Resource: "config"},
+		{PolicyID: "sec", RuleID: "debug", Resource: "config", Severity: "high"},
+	}}
+	events := ViolationEvents(before, after)
+	if len(events) != 1 || events[0].Source != "sec/debug" || events[0].Data["severity"] != "high" {
+		t.Errorf("ViolationEvents() = %+v", events)
+	}
+	if events := ViolationEvents(nil, after); len(events) != 2 {
+		t.Errorf("ViolationEvents(nil) = %+v", events)
+	}
+}
+
+func TestTriggerScheduler(t *testing.T) {
+	wm := NewWorkflowManager(nil)
+	release := make(chan struct{})
+	wm.RegisterHandler("wait", func(ctx context.Context, run *StepRun) (map[string]interface{}, error) {
+		if run.String("block") == "true" {
+			<-release
+		}
+		return map[string]interface{}{}, nil
+	})
+	err := wm.CreateWorkflow(&Workflow{ID: "deploy", Steps: []WorkflowStep{{ID: "a", Type: "wait", Parameters: map[string]interface{}{"block": "${input.block}"}}},
+		Triggers: []WorkflowTrigger{
+			{Name: "nightly", Schedule: "0 2 * * *", Input: map[string]interface{}{"env": "staging"}, Enabled: true},
+			{Name: "crash", Event: EventServiceState, Conditions: []string{`event.data.state == "failed"`}, Input: map[string]interface{}{"block": true}, Enabled: true},
+			{Name: "config", Event: EventConfigChange, Enabled: false},
+		}})
+	if err != nil {
+		t.Fatalf("CreateWorkflow() returned error: %v", err)
+	}
+
+	bus := NewEventBus()
+	stateFile := filepath.Join(t.TempDir(), "triggers.json")
+	s := NewTriggerScheduler(wm, bus, stateFile)
+	if _, err := s.SetEnabled("deploy/config", true); err != nil {
+		t.Fatalf("SetEnabled() returned error: %v", err)
+	}
+	if _, err := s.SetEnabled("deploy/missing", true); tskerrors.KindOf(err) != tskerrors.NotFound {
+		t.Errorf("SetEnabled(missing) = %v", err)
+	}
+	triggers, err := s.Triggers()
+	if err != nil || len(triggers) != 3 || triggers[0].ID != "deploy/config" || !triggers[0].Enabled {
+		t.Fatalf("Triggers() = %+v, %v", triggers, err)
+	}
+
+	// The schedule is due at once, then not for a long while
+	var clock sync.Mutex
+	calls := 0
+	s.now = func() time.Time {
+		clock.Lock()
+		defer clock.Unlock()
+		if calls++; calls == 1 {
+			return time.Date(2020, 1, 1, 1, 59, 30, 0, time.Local)
+		}
+		return time.Date(2099, 12, 31, 3, 0, 0, 0, time.Local)
+	}
+	firings := make(chan TriggerFiring, 10)
+	s.OnFire = func(f TriggerFiring) { firings <- f }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	next := func() TriggerFiring {
+		select {
+		case f := <-firings:
+			return f
+		case <-time.After(5 * time.Second):
+			t.Fatal("no trigger fired")
+		}
+		return TriggerFiring{}
+	}
+	if f := next(); f.Trigger.ID != "deploy/nightly" || f.Err != nil || f.Execution.Input["env"] != "staging" {
+		t.Fatalf("firing = %+v", f)
+	}
+
+	// Subscriptions are made as Run starts
+	subscribed := func() bool {
+		bus.mu.RLock()
+		defer bus.mu.RUnlock()
+		return len(bus.subscribers[EventServiceState]) > 0
+	}
+	for i := 0; i < 100 && !subscribed(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	bus.Publish(Event{Type: EventServiceState, Source: "api", Data: map[string]interface{}{"state": "running"}})
+	bus.Publish(Event{Type: EventServiceState, Source: "api", Data: map[string]interface{}{"state": "failed"}})
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		running := s.running["deploy/crash"]
+		s.mu.Unlock()
+		if running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	bus.Publish(Event{Type: EventServiceState, Source: "api", Data: map[string]interface{}{"state": "failed"}})
+	if f := next(); f.Trigger.ID != "deploy/crash" || tskerrors.KindOf(f.Err) != tskerrors.Conflict {
+		t.Errorf("overlapping firing = %+v", f)
+	}
+	close(release)
+	if f := next(); f.Trigger.ID != "deploy/crash" || f.Err != nil || f.Execution.Input["event"].(map[string]interface{})["source"] != "api" {
+		t.Errorf("event firing = %+v", f)
+	}
+
+	// Disabling takes effect in a running scheduler
+	if _, err := NewTriggerScheduler(wm, nil, stateFile).SetEnabled("deploy/config", false); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(Event{Type: EventConfigChange, Source: "peanu.tsk"})
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() returned error: %v", err)
+	}
+	select {
+	case f := <-firings:
+		t.Errorf("unexpected firing %+v", f)
+	default:
+	}
+
+	for trigger, want := range map[*WorkflowTrigger]string{
+		{Name: "a"}: "either a schedule or an event",
+		{Name: "b", Schedule: "@daily", Event: "x"}:                         "either a schedule or an event",
+		{Name: "c", Schedule: "61 * * * *"}:                                 "cron minute",
+		{Name: "d", Event: "deploy.done"}:                                   "unknown event",
+		{Name: "e", Event: EventConfigChange, Conditions: []string{"a =="}}: "when",
+	} {
+		workflow := &Workflow{ID: "w", Steps: []WorkflowStep{{ID: "a", Type: "set"}}, Triggers: []WorkflowTrigger{*trigger}}
+		if err := wm.CreateWorkflow(workflow); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("CreateWorkflow() with trigger %s = %v, want %q", trigger.Name, err, want)
+		}
+	}
+}
+
+func TestLoadWorkflowTriggers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), WorkflowFile)
+	os.WriteFile(file, []byte(`[workflows.backup.steps.dump]
+type: "command"
+command: "pg_dump app"
+
+[workflows.backup.triggers.nightly]
+schedule: "30 2 * * *"
+input.target: "s3"
+
+[workflows.backup.triggers.drift]
+event: "compliance.violation"
+when: 'event.data.severity == "critical"'
+enabled: false
+`), 0644)
+	workflows, err := LoadWorkflows(file)
+	if err != nil || len(workflows) != 1 {
+		t.Fatalf("LoadWorkflows() = %v, %v", workflows, err)
+	}
+	triggers := workflows[0].Triggers
+	if len(triggers) != 2 || triggers[0].Name != "drift" || triggers[0].Enabled || triggers[0].Conditions[0] != `event.data.severity == "critical"` ||
+		triggers[1].Schedule != "30 2 * * *" || !triggers[1].Enabled || triggers[1].Input["target"] != "s3" {
+		t.Fatalf("triggers = %+v", triggers)
+	}
+	if err := NewWorkflowManager(nil).CreateWorkflow(workflows[0]); err != nil || triggers[1].ID != "backup/nightly" {
+		t.Errorf("CreateWorkflow() = %v, id %q", err, triggers[1].ID)
+	}
+	from := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	if next := triggers[1].Next(from); !next.Equal(time.Date(2024, 3, 2, 2, 30, 0, 0, time.Local)) {
+		t.Errorf("Next() = %s", next)
+	}
+
+	for content, want := range map[string]string{
+		"[workflows.a.triggers.t]\ncolour: \"red\"\n": "unknown setting",
+		"[workflows.a.triggers.t]\nenabled: \"no\"\n": "expected true or false",
+	} {
+		os.WriteFile(file, []byte(content), 0644)
+		if _, err := LoadWorkflows(file); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadWorkflows(%q) = %v, want %q", content, err, want)
+		}
+	}
+}
@@ -0,0 +1,651 @@
+package enterprise
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cyber-boost/tusktsk/internal/configvalue"
+	"github.com/cyber-boost/tusktsk/license"
+	"github.com/cyber-boost/tusktsk/pkg/auth"
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+// AccessPolicyFile holds the roles and users of a directory. While it
+// exists, the commands and API routes that need a permission check it.
+const AccessPolicyFile = "access.policy.tsk"
+
+const (
+	// AccessPolicyEnv names a policy file used instead of AccessPolicyFile
+	AccessPolicyEnv = "TSK_ACCESS_POLICY"
+	// UserEnv names the user running tsk; it defaults to the login name
+	UserEnv = "TSK_USER"
+	// UserHeader names the user making an API request
+	UserHeader = "X-Tsk-User"
+)
+
+// ErrAccessDenied is returned when a user lacks the permission an
+// operation needs
+var ErrAccessDenied = errors.New("access denied")
+
+// DefaultCommandPermissions are the permissions commands need, by command
+// path, unless the [commands] section of the policy says otherwise
+var DefaultCommandPermissions = map[string]string{
+	"config set":            "config:write",
+	"db drop":               "db:admin",
+	"license seats release": "license:admin",
+	"workflow run":          "workflow:execute",
+	"workflow resume":       "workflow:execute",
+	"workflow serve":        "workflow:execute",
+	"workflow trigger":      "workflow:manage",
+}
+
+// DefaultRoutePermissions are the permissions the routes of the
+// configuration API need, unless the [routes] section says otherwise
+var DefaultRoutePermissions = map[string]string{
+	"GET /v1/config":          "config:read",
+	"GET /v1/config/{key}":    "config:read",
+	"PUT /v1/config/{key}":    "config:write",
+	"DELETE /v1/config/{key}": "config:write",
+	"GET /v1/hierarchy":       "config:read",
+	"GET /v1/watch":           "config:read",
+}
+
+// User represents a system user
+type User struct {
+	ID          string   `json:"id"`
+	Email       string   `json:"email,omitempty"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// Role represents a user role
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+	// InheritsFrom names roles whose permissions this one holds too,
+	// transitively
+	InheritsFrom []string `json:"inherits_from,omitempty"`
+}
+
+// Grant is a permission a user holds, and the roles it comes through: the
+// user's role first and the role declaring it last, none when the user
+// holds it directly
+type Grant struct {
+	Permission string   `json:"permission"`
+	Roles      []string `json:"roles,omitempty"`
+}
+
+// Source describes where g comes from: "user", or its roles such as
+// "admin > viewer" for a permission of viewer that admin inherits
+func (g Grant) Source() string {
+	if len(g.Roles) == 0 {
+		return "user"
+	}
+	return strings.Join(g.Roles, " > ")
+}
+
+// RBACManager manages role-based access control. Permissions are
+// resource:action pairs such as config:write; granted ones may use * for
+// either part, as in config:*, or be * for everything.
+type RBACManager struct {
+	users map[string]*User
+	roles map[string]*Role
+	mu    sync.RWMutex
+
+	// userGrants and roleGrants cache effective permissions until the
+	// users or roles change
+	userGrants map[string][]Grant
+	roleGrants map[string][]Grant
+}
+
+// NewRBACManager creates a new RBAC manager
+func NewRBACManager() *RBACManager {
+	return &RBACManager{
+		users:      make(map[string]*User),
+		roles:      make(map[string]*Role),
+		userGrants: make(map[string][]Grant),
+		roleGrants: make(map[string][]Grant),
+	}
+}
+
+// invalidate drops the cached effective permissions; callers hold mu
+func (rbac *RBACManager) invalidate() {
+	clear(rbac.userGrants)
+	clear(rbac.roleGrants)
+}
+
+// CreateRole adds a role. The roles it inherits from may be created after
+// it; Validate checks that they all exist, without cycles.
+func (rbac *RBACManager) CreateRole(role *Role) error {
+	if err := validPermissions(role.Permissions); err != nil {
+		return fmt.Errorf("role %s: %w", role.Name, err)
+	}
+	rbac.mu.Lock()
+	defer rbac.mu.Unlock()
+	if _, exists := rbac.roles[role.Name]; exists {
+		return fmt.Errorf("role already exists: %s", role.Name)
+	}
+	rbac.roles[role.Name] = role
+	rbac.invalidate()
+	return nil
+}
+
+// CreateUser adds a user, whose roles must exist
+func (rbac *RBACManager) CreateUser(user *User) error {
+	if err := validPermissions(user.Permissions); err != nil {
+		return fmt.Errorf("user %s: %w", user.ID, err)
+	}
+	rbac.mu.Lock()
+	defer rbac.mu.Unlock()
+	if _, exists := rbac.users[user.ID]; exists {
+		return fmt.Errorf("user already exists: %s", user.ID)
+	}
+	for _, role := range user.Roles {
+		if _, exists := rbac.roles[role]; !exists {
+			return fmt.Errorf("user %s: role not found: %s", user.ID, role)
+		}
+	}
+	rbac.users[user.ID] = user
+	rbac.invalidate()
+	return nil
+}
+
+// GetUser returns the user with id userID
+func (rbac *RBACManager) GetUser(userID string) (*User, error) {
+	rbac.mu.RLock()
+	defer rbac.mu.RUnlock()
+	user, exists := rbac.users[userID]
+	if !exists {
+		return nil, fmt.Errorf("user not found: %s", userID)
+	}
+	return user, nil
+}
+
+// AssignRole gives a user a role
+func (rbac *RBACManager) AssignRole(userID, roleName string) error {
+	rbac.mu.Lock()
+	defer rbac.mu.Unlock()
+	user, exists := rbac.users[userID]
+	if !exists {
+		return fmt.Errorf("user not found: %s", userID)
+	}
+	if _, exists := rbac.roles[roleName]; !exists {
+		return fmt.Errorf("role not found: %s", roleName)
+	}
+	for _, role := range user.Roles {
+		if role == roleName {
+			return nil
+		}
+	}
+	user.Roles = append(user.Roles, roleName)
+	rbac.invalidate()
+	return nil
+}
+
+// Users lists the ids of the users, sorted
+func (rbac *RBACManager) Users() []string {
+	rbac.mu.RLock()
+	defer rbac.mu.RUnlock()
+	ids := make([]string, 0, len(rbac.users))
+	for id := range rbac.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Validate resolves the inheritance of every role, reporting roles that
+// inherit from missing ones or from themselves through others
+func (rbac *RBACManager) Validate() error {
+	rbac.mu.Lock()
+	defer rbac.mu.Unlock()
+	names := make([]string, 0, len(rbac.roles))
+	for name := range rbac.roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := rbac.resolveRole(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveRole returns the permissions of role name and the roles it
+// inherits from, caching them. stack holds the roles being resolved,
+// which name would close a cycle with. Callers hold mu.
+func (rbac *RBACManager) resolveRole(name string, stack []string) ([]Grant, error) {
+	if grants, ok := rbac.roleGrants[name]; ok {
+		return grants, nil
+	}
+	for i, resolving := range stack {
+		if resolving == name {
+			cycle := append(append([]string(nil), stack[i:]...), name)
+			return nil, fmt.Errorf("role %s inherits from itself: %s", name, strings.Join(cycle, " > "))
+		}
+	}
+	role, exists := rbac.roles[name]
+	if !exists {
+		if len(stack) > 0 {
+			return nil, fmt.Errorf("role %s inherits from a missing role: %s", stack[len(stack)-1], name)
+		}
+		return nil, fmt.Errorf("role not found: %s", name)
+	}
+
+	stack = append(stack, name)
+	var grants []Grant
+	for _, permission := range role.Permissions {
+		grants = append(grants, Grant{Permission: permission, Roles: []string{name}})
+	}
+	for _, parent := range role.InheritsFrom {
+		inherited, err := rbac.resolveRole(parent, stack)
+		if err != nil {
+			return nil, err
+		}
+		for _, grant := range inherited {
+			grants = append(grants, Grant{Permission: grant.Permission, Roles: append([]string{name}, grant.Roles...)})
+		}
+	}
+	rbac.roleGrants[name] = grants
+	return grants, nil
+}
+
+// EffectivePermissions returns what userID holds: its own permissions,
+// then those of its roles and the roles they inherit from. A permission
+// reachable several ways is listed once, through the first.
+func (rbac *RBACManager) EffectivePermissions(userID string) ([]Grant, error) {
+	rbac.mu.RLock()
+	grants, ok := rbac.userGrants[userID]
+	rbac.mu.RUnlock()
+	if ok {
+		return grants, nil
+	}
+
+	rbac.mu.Lock()
+	defer rbac.mu.Unlock()
+	user, exists := rbac.users[userID]
+	if !exists {
+		return nil, fmt.Errorf("user not found: %s", userID)
+	}
+	seen := make(map[string]bool)
+	grants = []Grant{}
+	for _, permission := range user.Permissions {
+		if !seen[permission] {
+			seen[permission] = true
+			grants = append(grants, Grant{Permission: permission})
+		}
+	}
+	for _, role := range user.Roles {
+		inherited, err := rbac.resolveRole(role, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, grant := range inherited {
+			if !seen[grant.Permission] {
+				seen[grant.Permission] = true
+				grants = append(grants, grant)
+			}
+		}
+	}
+	rbac.userGrants[userID] = grants
+	return grants, nil
+}
+
+// Check reports whether userID holds permission, and the grant covering
+// it. Users that do not exist or whose roles do not resolve hold nothing.
+func (rbac *RBACManager) Check(userID, permission string) (Grant, bool) {
+	grants, err := rbac.EffectivePermissions(userID)
+	if err != nil {
+		return Grant{}, false
+	}
+	for _, grant := range grants {
+		if permissionMatches(grant.Permission, permission) {
+			return grant, true
+		}
+	}
+	return Grant{}, false
+}
+
+// permissionMatches reports whether granted, which may use wildcards,
+// covers permission
+func permissionMatches(granted, permission string) bool {
+	if granted == "*" || granted == permission {
+		return true
+	}
+	resource, action, _ := strings.Cut(granted, ":")
+	wantResource, wantAction, _ := strings.Cut(permission, ":")
+	return (resource == "*" || resource == wantResource) && (action == "*" || action == wantAction)
+}
+
+// CheckPermission reports whether userID may perform action on resource
+func (rbac *RBACManager) CheckPermission(userID, resource, action string) bool {
+	_, ok := rbac.Check(userID, resource+":"+action)
+	return ok
+}
+
+// Authorize returns an ErrAccessDenied error of kind Permission unless
+// userID holds permission
+func (rbac *RBACManager) Authorize(userID, permission string) error {
+	if _, ok := rbac.Check(userID, permission); ok {
+		return nil
+	}
+	if userID == "" {
+		return tskerrors.Wrap(tskerrors.Permission, fmt.Errorf("%w: no user given, %s is required", ErrAccessDenied, permission))
+	}
+	if _, err := rbac.EffectivePermissions(userID); err != nil && rbac.hasUser(userID) {
+		return tskerrors.Wrap(tskerrors.Permission, fmt.Errorf("%w: %s: %v", ErrAccessDenied, userID, err))
+	}
+	return tskerrors.Wrap(tskerrors.Permission, fmt.Errorf("%w: %s lacks %s", ErrAccessDenied, userID, permission))
+}
+
+func (rbac *RBACManager) hasUser(userID string) bool {
+	rbac.mu.RLock()
+	defer rbac.mu.RUnlock()
+	_, exists := rbac.users[userID]
+	return exists
+}
+
+// validPermissions checks that each permission is a resource:action pair
+// or *
+func validPermissions(permissions []string) error {
+	for _, permission := range permissions {
+		if permission == "*" {
+			continue
+		}
+		resource, action, ok := strings.Cut(permission, ":")
+		if !ok || resource == "" || action == "" || strings.Contains(action, ":") {
+			return fmt.Errorf("permission %q is not resource:action", permission)
+		}
+	}
+	return nil
+}
+
+// AccessPolicy is the RBACManager of a policy file, and the permissions
+// its commands and routes need:
+//
+//	[roles.viewer]
+//	permissions: ["config:read"]
+//
+//	[roles.editor]
+//	permissions: ["config:*"]
+//	inherits_from: ["viewer"]
+//
+//	[roles.admin]
+//	description: "Changes configuration and databases"
+//	permissions: ["db:admin"]
+//	inherits_from: ["editor"]
+//
+//	[users.ada]
+//	roles: ["admin"]
+//
+//	[users.ci]
+//	roles: ["viewer"]
+//	permissions: ["config:write"]
+//
+//	[commands]
+//	"promote": "config:promote"    # also needed by subcommands
+//	"config set": ""               # lifts a default
+//
+//	[routes]
+//	"GET /v1/config": ""
+type AccessPolicy struct {
+	*RBACManager
+	// File is the policy file read
+	File string
+	// Commands and Routes map command paths and routes to the
+	// permission they need, the defaults included
+	Commands map[string]string
+	Routes   map[string]string
+}
+
+// LoadAccessPolicy reads the policy file at file
+func LoadAccessPolicy(file string) (*AccessPolicy, error) {
+	cfg := config.New()
+	if err := cfg.LoadFromFile(file); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", file, err)
+	}
+	policy := &AccessPolicy{
+		RBACManager: NewRBACManager(),
+		File:        file,
+		Commands:    make(map[string]string),
+		Routes:      make(map[string]string),
+	}
+	for path, permission := range DefaultCommandPermissions {
+		policy.Commands[path] = permission
+	}
+	for route, permission := range DefaultRoutePermissions {
+		policy.Routes[route] = permission
+	}
+
+	roles := make(map[string]*Role)
+	users := make(map[string]*User)
+	for _, key := range cfg.Keys() {
+		value := cfg.Get(key)
+		section, rest, _ := strings.Cut(key, ".")
+		var err error
+		switch section {
+		case "roles", "users":
+			name, field := splitPolicyKey(rest)
+			if name == "" {
+				err = errors.New("unknown setting")
+				break
+			}
+			if section == "roles" {
+				role := roles[name]
+				if role == nil {
+					role = &Role{Name: name}
+					roles[name] = role
+				}
+				switch field {
+				case "permissions":
+					role.Permissions, err = configvalue.StringList(value)
+				case "inherits_from":
+					role.InheritsFrom, err = configvalue.StringList(value)
+				case "description":
+					role.Description = fmt.Sprint(value)
+				default:
+					err = errors.New("unknown setting")
+				}
+				break
+			}
+			user := users[name]
+			if user == nil {
+				user = &User{ID: name}
+				users[name] = user
+			}
+			switch field {
+			case "roles":
+				user.Roles, err = configvalue.StringList(value)
+			case "permissions":
+				user.Permissions, err = configvalue.StringList(value)
+			case "email":
+				user.Email = fmt.Sprint(value)
+			default:
+				err = errors.New("unknown setting")
+			}
+		case "commands", "routes":
+			permission := fmt.Sprint(value)
+			if permission != "" {
+				err = validPermissions([]string{permission})
+			}
+			if section == "commands" {
+				policy.Commands[unquote(rest)] = permission
+			} else {
+				policy.Routes[unquote(rest)] = permission
+			}
+		default:
+			err = errors.New("unknown setting")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", file, key, err)
+		}
+	}
+
+	for _, role := range roles {
+		if err := policy.CreateRole(role); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	for _, user := range users {
+		if err := policy.CreateUser(user); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return policy, nil
+}
+
+// FindAccessPolicy reads the file named by $TSK_ACCESS_POLICY, or the
+// AccessPolicyFile of dir. It returns nil when there is neither: access
+// is then not enforced.
+func FindAccessPolicy(dir string) (*AccessPolicy, error) {
+	file := os.Getenv(AccessPolicyEnv)
+	if file == "" {
+		file = filepath.Join(dir, AccessPolicyFile)
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	policy, err := LoadAccessPolicy(file)
+	if err != nil {
+		return nil, tskerrors.Wrap(tskerrors.Validation, err)
+	}
+	return policy, nil
+}
+
+// splitPolicyKey splits rest of users.<name>.<field> at its last dot; the
+// name may be quoted, as in users."ada@example.com".roles
+func splitPolicyKey(rest string) (string, string) {
+	i := strings.LastIndex(rest, ".")
+	if i < 0 {
+		return "", ""
+	}
+	return unquote(rest[:i]), rest[i+1:]
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// CommandPermission returns the permission the command at path, such as
+// "config set", needs: the entry of the path or of its nearest parent in
+// Commands, or "" when it needs none
+func (p *AccessPolicy) CommandPermission(path string) string {
+	for path != "" {
+		if permission, ok := p.Commands[path]; ok {
+			return permission
+		}
+		i := strings.LastIndex(path, " ")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return ""
+}
+
+// RoutePermission returns the permission route, such as
+// "PUT /v1/config/{key}", needs, or "" when it needs none
+func (p *AccessPolicy) RoutePermission(route string) string {
+	return p.Routes[route]
+}
+
+// AuthorizeCommand checks that userID may run the command at path
+func (p *AccessPolicy) AuthorizeCommand(userID, path string) error {
+	permission := p.CommandPermission(path)
+	if permission == "" {
+		return nil
+	}
+	if err := p.Authorize(userID, permission); err != nil {
+		return fmt.Errorf("tsk %s: %w", path, err)
+	}
+	return nil
+}
+
+// AuthorizeRequest checks that the authenticated user of r, see
+// auth.IdentityFrom, may use route. Requests without one are refused the
+// routes that need a permission.
+func (p *AccessPolicy) AuthorizeRequest(r *http.Request, route string) error {
+	permission := p.RoutePermission(route)
+	if permission == "" {
+		return nil
+	}
+	id, ok := auth.IdentityFrom(r.Context())
+	if !ok {
+		return tskerrors.Wrap(tskerrors.Permission, fmt.Errorf("%w: the request is not authenticated, %s is required", ErrAccessDenied, permission))
+	}
+	return p.Authorize(id.User, permission)
+}
+
+// UserTokenAuthenticator authenticates requests bearing Token as the user
+// their UserHeader names, for servers without an [auth] section: whoever
+// holds the shared token vouches for the user.
+type UserTokenAuthenticator struct {
+	Token string
+}
+
+// Authenticate returns the identity of the UserHeader of r, once r
+// presents the token as "Authorization: Bearer <token>"
+func (a UserTokenAuthenticator) Authenticate(r *http.Request) (*auth.Identity, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, auth.ErrNoCredentials
+	}
+	if a.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+		return nil, fmt.Errorf("%w: the bearer token does not match", auth.ErrInvalidCredentials)
+	}
+	user := r.Header.Get(UserHeader)
+	if user == "" {
+		return nil, fmt.Errorf("%w: the %s header names no user", auth.ErrInvalidCredentials, UserHeader)
+	}
+	return &auth.Identity{User: user, Method: auth.TokenMethod}, nil
+}
+
+// CurrentUser returns $TSK_USER, the user of an unexpired
+// `tsk security login` session, or the login name of the process owner
+func CurrentUser() string {
+	if name := os.Getenv(UserEnv); name != "" {
+		return name
+	}
+	if session, err := auth.LoadSession(); err == nil && !session.Expired() {
+		return session.Identity.User
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// AuthorizeCommand checks that the CurrentUser may run the command at
+// path under the access policy of dir; without a policy anything goes.
+// Enforcing a policy needs a license.Current unlocking
+// license.CapabilityRBAC, so commands the policy restricts are refused
+// without one.
+func AuthorizeCommand(dir, path string) error {
+	policy, err := FindAccessPolicy(dir)
+	if err != nil || policy == nil {
+		return err
+	}
+	if policy.CommandPermission(path) != "" {
+		if err := license.DefaultRegistry.Require(license.CapabilityRBAC); err != nil {
+			return err
+		}
+	}
+	return policy.AuthorizeCommand(CurrentUser(), path)
+}
@@ -0,0 +1,176 @@
+package enterprise
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqlDB runs the ORM on a database/sql connection, for the tables of the
+// enterprise features in processes without a database adapter of their own
+type sqlDB struct {
+	db *sql.DB
+	// numbered rewrites ? placeholders to $1, $2... for PostgreSQL
+	numbered bool
+}
+
+// openSQL connects to a SQLite file or a PostgreSQL server
+func openSQL(adapter, dsn string) (*sqlDB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("the %s database needs a dsn", adapter)
+	}
+	var driver string
+	switch adapter {
+	case "sqlite", "sqlite3":
+		driver, dsn = "sqlite3", strings.TrimPrefix(dsn, "sqlite:")
+	case "postgresql", "postgres":
+		driver = "postgres"
+	default:
+		return nil, fmt.Errorf("unsupported database adapter %q (sqlite or postgresql)", adapter)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the %s database: %w", adapter, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to the %s database: %w", adapter, err)
+	}
+	return &sqlDB{db: db, numbered: driver == "postgres"}, nil
+}
+
+// rebind numbers the ? placeholders outside quoted strings
+func (s *sqlDB) rebind(query string) string {
+	if !s.numbered || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n, quoted := 0, false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// queryRows runs a query on a *sql.DB or *sql.Tx
+func queryRows(db interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}, query string, args ...interface{}) (*databasetypes.Result, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &databasetypes.Result{Columns: columns}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlDB) Connect(config string) error { return nil }
+func (s *sqlDB) Disconnect() error           { return s.db.Close() }
+func (s *sqlDB) IsConnected() bool           { return s.db.Ping() == nil }
+func (s *sqlDB) Ping() error                 { return s.db.Ping() }
+
+func (s *sqlDB) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	return queryRows(s.db, s.rebind(query), args...)
+}
+
+func (s *sqlDB) Execute(query string, args ...interface{}) error {
+	_, err := s.db.Exec(s.rebind(query), args...)
+	return err
+}
+
+func (s *sqlDB) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	result, err := s.Query(query, args...)
+	if err != nil || len(result.Rows) == 0 {
+		return nil, err
+	}
+	return &databasetypes.Row{Data: result.Rows[0]}, nil
+}
+
+func (s *sqlDB) BeginTransaction() (databasetypes.Transaction, error) {
+	return s.BeginTransactionWithContext(context.Background())
+}
+
+func (s *sqlDB) BeginTransactionWithContext(ctx context.Context) (databasetypes.Transaction, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{tx: tx, db: s}, nil
+}
+
+func (s *sqlDB) SupportsSavepoints() bool           { return true }
+func (s *sqlDB) SetMaxOpenConns(n int)              { s.db.SetMaxOpenConns(n) }
+func (s *sqlDB) SetMaxIdleConns(n int)              { s.db.SetMaxIdleConns(n) }
+func (s *sqlDB) SetConnMaxLifetime(d time.Duration) { s.db.SetConnMaxLifetime(d) }
+func (s *sqlDB) SetConnMaxIdleTime(d time.Duration) { s.db.SetConnMaxIdleTime(d) }
+func (s *sqlDB) Close() error                       { return s.db.Close() }
+
+func (s *sqlDB) GetStats() *databasetypes.Stats {
+	stats := s.db.Stats()
+	return &databasetypes.Stats{
+		OpenConnections: stats.OpenConnections,
+		InUse:           stats.InUse,
+		Idle:            stats.Idle,
+	}
+}
+
+// sqlTx is a transaction of a sqlDB
+type sqlTx struct {
+	tx *sql.Tx
+	db *sqlDB
+}
+
+func (t *sqlTx) Commit() error   { return t.tx.Commit() }
+func (t *sqlTx) Rollback() error { return t.tx.Rollback() }
+
+func (t *sqlTx) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	return queryRows(t.tx, t.db.rebind(query), args...)
+}
+
+func (t *sqlTx) Execute(query string, args ...interface{}) error {
+	_, err := t.tx.Exec(t.db.rebind(query), args...)
+	return err
+}
+
+func (t *sqlTx) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	result, err := t.Query(query, args...)
+	if err != nil || len(result.Rows) == 0 {
+		return nil, err
+	}
+	return &databasetypes.Row{Data: result.Rows[0]}, nil
+}
@@ -0,0 +1,232 @@
+package enterprise
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+// standards holds the built-in policy packs, one policy per standard
+// named after its file
+//
+//go:embed standards/*.tsk
+var standards embed.FS
+
+//go:embed templates/evidence.html.tmpl
+var evidenceTemplate string
+
+// Standards returns the built-in policy packs, sorted by id: soc2, hipaa
+// and pci. Each is a policy whose rules name the controls they check.
+func Standards() []*Policy {
+	files, _ := standards.ReadDir("standards")
+	list := make([]*Policy, 0, len(files))
+	for _, file := range files {
+		policy, err := Standard(strings.TrimSuffix(file.Name(), ".tsk"))
+		if err != nil {
+			// The packs are part of the binary and tested
+			panic(err)
+		}
+		list = append(list, policy)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Standard returns a new copy of the built-in policy pack of a standard
+func Standard(id string) (*Policy, error) {
+	file := path.Join("standards", id+".tsk")
+	content, err := standards.ReadFile(file)
+	if err != nil {
+		return nil, tskerrors.New(tskerrors.NotFound, "unknown standard %q (%s)", id, strings.Join(standardIDs(), ", "))
+	}
+	cfg := config.New()
+	if err := cfg.LoadTSK(content); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	policies, err := compliancePolicies(cfg, "builtin:"+id)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) != 1 || policies[0].ID != id {
+		return nil, fmt.Errorf("%s: expected the policy %s alone", file, id)
+	}
+	return policies[0], nil
+}
+
+// standardIDs lists the ids of the built-in standards
+func standardIDs() []string {
+	files, _ := standards.ReadDir("standards")
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, strings.TrimSuffix(file.Name(), ".tsk"))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// AddStandard adds the built-in policy pack of a standard, unless a
+// policy of that id was loaded already, and returns the policy
+func (cm *ComplianceManager) AddStandard(id string) (*Policy, error) {
+	if policy, ok := cm.Policy(id); ok {
+		return policy, nil
+	}
+	policy, err := Standard(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := cm.CreatePolicy(policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Policy returns the policy of an id
+func (cm *ComplianceManager) Policy(id string) (*Policy, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	policy, ok := cm.policies[id]
+	return policy, ok
+}
+
+// EvidenceReport is the evidence of a resource's compliance with a
+// standard, control by control
+type EvidenceReport struct {
+	Standard    string    `json:"standard"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Resource    string    `json:"resource"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Compliant   bool      `json:"compliant"`
+	// Counts holds the number of rule results of each status
+	Counts   map[RuleStatus]int `json:"counts"`
+	Controls []ControlEvidence  `json:"controls"`
+}
+
+// ControlEvidence is the outcome of the rules checking one control. Its
+// status is the worst of theirs: error, fail, pass, then skip.
+type ControlEvidence struct {
+	// ID is empty for the rules that name no control
+	ID      string       `json:"id"`
+	Status  RuleStatus   `json:"status"`
+	Results []RuleResult `json:"results"`
+}
+
+// statusRanks orders the statuses of a control, the worst last
+var statusRanks = map[RuleStatus]int{RuleSkipped: 0, RulePassed: 1, RuleFailed: 2, RuleError: 3}
+
+// NewEvidenceReport groups the results of policy in report by the
+// controls its rules check. A rule checking several controls is evidence
+// for each of them.
+func NewEvidenceReport(policy *Policy, report *ComplianceReport) *EvidenceReport {
+	evidence := &EvidenceReport{
+		Standard:    policy.ID,
+		Name:        policy.Name,
+		Description: policy.Description,
+		Resource:    report.Resource,
+		GeneratedAt: report.EvaluatedAt,
+		Compliant:   true,
+		Counts:      make(map[RuleStatus]int),
+		Controls:    []ControlEvidence{},
+	}
+	controls := make(map[string]*ControlEvidence)
+	var order []string
+	for _, result := range report.Results {
+		if result.PolicyID != policy.ID {
+			continue
+		}
+		evidence.Counts[result.Status]++
+		if result.Status == RuleFailed || result.Status == RuleError {
+			evidence.Compliant = false
+		}
+		ids := []string{""}
+		for _, rule := range policy.Rules {
+			if rule.ID == result.RuleID && len(rule.Controls) > 0 {
+				ids = rule.Controls
+			}
+		}
+		for _, id := range ids {
+			control := controls[id]
+			if control == nil {
+				control = &ControlEvidence{ID: id, Status: RuleSkipped}
+				controls[id] = control
+				order = append(order, id)
+			}
+			control.Results = append(control.Results, result)
+			if statusRanks[result.Status] > statusRanks[control.Status] {
+				control.Status = result.Status
+			}
+		}
+	}
+	sort.Slice(order, func(i, j int) bool { return controlLess(order[i], order[j]) })
+	for _, id := range order {
+		evidence.Controls = append(evidence.Controls, *controls[id])
+	}
+	return evidence
+}
+
+// controlLess orders control ids naturally, so that 10.2.1 follows 4.2.1
+// and CC6.10 follows CC6.7; the rules without a control go last
+func controlLess(a, b string) bool {
+	if a == "" || b == "" {
+		return b == ""
+	}
+	for a != "" && b != "" {
+		na, ra := leadingNumber(a)
+		nb, rb := leadingNumber(b)
+		switch {
+		case na >= 0 && nb >= 0:
+			if na != nb {
+				return na < nb
+			}
+			a, b = ra, rb
+		case a[0] != b[0]:
+			return a[0] < b[0]
+		default:
+			a, b = a[1:], b[1:]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// leadingNumber splits the number s starts with, or returns -1
+func leadingNumber(s string) (int, string) {
+	n, i := 0, 0
+	for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		n = n*10 + int(s[i]-'0')
+	}
+	if i == 0 {
+		return -1, s
+	}
+	return n, s[i:]
+}
+
+// RenderHTML writes the report as a standalone HTML page
+func (r *EvidenceReport) RenderHTML(w io.Writer) error {
+	funcs := template.FuncMap{
+		"value": func(v interface{}) string {
+			if v == nil {
+				return "not set"
+			}
+			return config.FormatValue(v)
+		},
+		"count": func(status string) int {
+			return r.Counts[RuleStatus(status)]
+		},
+		"icon": func(status RuleStatus) string {
+			return map[RuleStatus]string{RulePassed: "✅", RuleFailed: "❌", RuleSkipped: "⏭️", RuleError: "⚠️"}[status]
+		},
+	}
+	tmpl, err := template.New("evidence").Funcs(funcs).Parse(evidenceTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, r)
+}
@@ -0,0 +1,25 @@
+//go:build !unix
+
+package enterprise
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// SyslogSink is unavailable on platforms without syslog
+type SyslogSink struct{}
+
+// NewSyslogSink fails on platforms without syslog
+func NewSyslogSink(network, address, tag string) (*SyslogSink, error) {
+	return nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
+
+// Name identifies the sink in errors
+func (s *SyslogSink) Name() string { return SyslogSinkName }
+
+// Write is never called
+func (s *SyslogSink) Write(logs []AuditLog) error { return nil }
+
+// Close is never called
+func (s *SyslogSink) Close() error { return nil }
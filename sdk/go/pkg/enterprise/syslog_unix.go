@@ -0,0 +1,47 @@
+//go:build unix
+
+package enterprise
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// SyslogSink sends each audit log to syslog as a JSON message, with the
+// auth facility
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink connects to the syslog server at address over network, or
+// to the local syslog daemon when network is empty
+func NewSyslogSink(network, address, tag string) (*SyslogSink, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+// Name identifies the sink in errors
+func (s *SyslogSink) Name() string { return SyslogSinkName }
+
+// Write sends logs one message each
+func (s *SyslogSink) Write(logs []AuditLog) error {
+	for _, log := range logs {
+		message, err := json.Marshal(log)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit log %s: %w", log.ID, err)
+		}
+		if err := s.w.Info(string(message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close disconnects from syslog
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,512 @@
+package enterprise
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/cron"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/expr"
+)
+
+// DefaultTriggerState is the file tsk workflow trigger records the
+// triggers it enabled or disabled in
+const DefaultTriggerState = ".tsk/triggers.json"
+
+// Events of an EventBus that triggers can wait for
+const (
+	// EventConfigChange is a change of the configuration files; its data
+	// holds file, files and the changed keys
+	EventConfigChange = "config.change"
+	// EventServiceState is a service entering a state; its data holds
+	// service, state, previous, restarts and last_exit
+	EventServiceState = "service.state"
+	// EventComplianceViolation is a rule a resource newly fails; its data
+	// holds policy_id, rule_id, resource, severity and message
+	EventComplianceViolation = "compliance.violation"
+)
+
+// EventTypes are the events triggers can wait for
+var EventTypes = []string{EventComplianceViolation, EventConfigChange, EventServiceState}
+
+// Event is something that happened, published on an EventBus
+type Event struct {
+	Type string `json:"type"`
+	// Source names what the event is about, such as a file or a service
+	Source string                 `json:"source,omitempty"`
+	Time   time.Time              `json:"time"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+// data returns the event as conditions and workflow input see it
+func (e Event) data() map[string]interface{} {
+	data := e.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"type":   e.Type,
+		"source": e.Source,
+		"time":   e.Time.Format(time.RFC3339),
+		"data":   data,
+	}
+}
+
+// EventBus delivers the events published on it to their subscribers
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[int]func(Event)
+	next        int
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[string]map[int]func(Event))}
+}
+
+// Subscribe calls fn with every event of a type, or of any type when
+// eventType is "*", until the returned function is called
+func (b *EventBus) Subscribe(eventType string, fn func(Event)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[eventType] == nil {
+		b.subscribers[eventType] = make(map[int]func(Event))
+	}
+	id := b.next
+	b.next++
+	b.subscribers[eventType][id] = fn
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers[eventType], id)
+	}
+}
+
+// Publish calls the subscribers of event, in the order they subscribed,
+// and returns once they have. A zero Time is set to now.
+func (b *EventBus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.mu.RLock()
+	var ids []int
+	fns := make(map[int]func(Event))
+	for _, eventType := range []string{event.Type, "*"} {
+		for id, fn := range b.subscribers[eventType] {
+			ids = append(ids, id)
+			fns[id] = fn
+		}
+	}
+	b.mu.RUnlock()
+	sort.Ints(ids)
+	for _, id := range ids {
+		fns[id](event)
+	}
+}
+
+// ViolationEvents returns an EventComplianceViolation for every violation
+// of report that previous, the report before it, did not have. A nil
+// previous makes every violation new.
+func ViolationEvents(previous, report *ComplianceReport) []Event {
+	known := make(map[string]bool)
+	if previous != nil {
+		for _, v := range previous.Violations {
+			known[v.PolicyID+"/"+v.RuleID+"@"+v.Resource] = true
+		}
+	}
+	var events []Event
+	for _, v := range report.Violations {
+		if known[v.PolicyID+"/"+v.RuleID+"@"+v.Resource] {
+			continue
+		}
+		events = append(events, Event{
+			Type:   EventComplianceViolation,
+			Source: v.PolicyID + "/" + v.RuleID,
+			Time:   v.Timestamp,
+			Data: map[string]interface{}{
+				"policy_id": v.PolicyID,
+				"rule_id":   v.RuleID,
+				"resource":  v.Resource,
+				"severity":  v.Severity,
+				"message":   v.Message,
+			},
+		})
+	}
+	return events
+}
+
+// WorkflowTrigger starts a workflow on a cron schedule, or when an event
+// it waits for is published
+type WorkflowTrigger struct {
+	// ID is <workflow>/<name>
+	ID         string `json:"id"`
+	WorkflowID string `json:"workflow_id"`
+	Name       string `json:"name"`
+	// Schedule is a five-field cron expression, in local time
+	Schedule string `json:"schedule,omitempty"`
+	// Event is the type of event that fires the trigger
+	Event string `json:"event,omitempty"`
+	// Conditions must all hold for an event to fire the trigger; they see
+	// it as event.type, event.source and event.data.<name>
+	Conditions []string `json:"conditions,omitempty"`
+	// Input is the input of the executions it starts, to which trigger
+	// and, for events, event are added
+	Input   map[string]interface{} `json:"input,omitempty"`
+	Enabled bool                   `json:"enabled"`
+
+	schedule   *cron.Schedule
+	conditions []*expr.Expr
+}
+
+// Next returns when a scheduled trigger fires after from, or the zero
+// time for an event trigger
+func (t *WorkflowTrigger) Next(from time.Time) time.Time {
+	if t.schedule == nil {
+		return time.Time{}
+	}
+	return t.schedule.Next(from)
+}
+
+// validate checks the trigger and compiles its schedule and conditions
+func (t *WorkflowTrigger) validate() error {
+	switch {
+	case t.Name == "":
+		return errors.New("trigger without a name")
+	case (t.Schedule == "") == (t.Event == ""):
+		return fmt.Errorf("trigger %s needs either a schedule or an event", t.Name)
+	}
+	t.ID = t.WorkflowID + "/" + t.Name
+	t.schedule = nil
+	if t.Schedule != "" {
+		schedule, err := cron.Parse(t.Schedule)
+		if err != nil {
+			return fmt.Errorf("trigger %s: %w", t.Name, err)
+		}
+		t.schedule = schedule
+	} else if !knownEvent(t.Event) {
+		return fmt.Errorf("trigger %s: unknown event %q (%s)", t.Name, t.Event, strings.Join(EventTypes, ", "))
+	}
+	t.conditions = nil
+	for _, condition := range t.Conditions {
+		e, err := expr.Compile(condition)
+		if err != nil {
+			return fmt.Errorf("trigger %s: when: %w", t.Name, err)
+		}
+		t.conditions = append(t.conditions, e)
+	}
+	return nil
+}
+
+func knownEvent(eventType string) bool {
+	for _, known := range EventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether event fires the trigger
+func (t *WorkflowTrigger) matches(event Event) (bool, error) {
+	data := map[string]interface{}{"event": event.data()}
+	for _, condition := range t.conditions {
+		holds, err := condition.Bool(data)
+		if err != nil {
+			return false, fmt.Errorf("trigger %s: when %s: %w", t.ID, condition.Source, err)
+		}
+		if !holds {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// TriggerFiring reports a trigger that fired: the execution it started,
+// or the error starting or running it
+type TriggerFiring struct {
+	Trigger   *WorkflowTrigger
+	Event     *Event
+	Execution *WorkflowExecution
+	Err       error
+}
+
+// TriggerScheduler fires the triggers of the workflows of a manager.
+// Whether a trigger is enabled is read from the state file, when it has
+// one, every time the trigger is due, so SetEnabled takes effect in
+// schedulers of other processes too.
+type TriggerScheduler struct {
+	wm        *WorkflowManager
+	bus       *EventBus
+	stateFile string
+	// OnFire, when set, is called after every execution a trigger starts
+	OnFire func(TriggerFiring)
+
+	mu      sync.Mutex
+	running map[string]bool
+	now     func() time.Time
+}
+
+// NewTriggerScheduler fires the triggers of wm on the events of bus. The
+// triggers enabled or disabled with SetEnabled are kept in stateFile;
+// without one they stay as declared.
+func NewTriggerScheduler(wm *WorkflowManager, bus *EventBus, stateFile string) *TriggerScheduler {
+	return &TriggerScheduler{
+		wm:        wm,
+		bus:       bus,
+		stateFile: stateFile,
+		running:   make(map[string]bool),
+		now:       time.Now,
+	}
+}
+
+// Triggers returns the triggers of every workflow, sorted by id, as the
+// state file enables them
+func (s *TriggerScheduler) Triggers() ([]*WorkflowTrigger, error) {
+	state, err := s.state()
+	if err != nil {
+		return nil, err
+	}
+	var triggers []*WorkflowTrigger
+	for _, workflow := range s.wm.Workflows() {
+		for i := range workflow.Triggers {
+			t := workflow.Triggers[i]
+			if enabled, ok := state[t.ID]; ok {
+				t.Enabled = enabled
+			}
+			triggers = append(triggers, &t)
+		}
+	}
+	sort.Slice(triggers, func(i, j int) bool { return triggers[i].ID < triggers[j].ID })
+	return triggers, nil
+}
+
+// Trigger returns a trigger by id
+func (s *TriggerScheduler) Trigger(id string) (*WorkflowTrigger, error) {
+	triggers, err := s.Triggers()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range triggers {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return nil, tskerrors.New(tskerrors.NotFound, "trigger not found: %s", id)
+}
+
+// SetEnabled enables or disables a trigger and records it in the state
+// file
+func (s *TriggerScheduler) SetEnabled(id string, enabled bool) (*WorkflowTrigger, error) {
+	if s.stateFile == "" {
+		return nil, errors.New("no trigger state file")
+	}
+	t, err := s.Trigger(id)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.state()
+	if err != nil {
+		return nil, err
+	}
+	state[id] = enabled
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(s.stateFile, append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to save %s: %w", s.stateFile, err)
+	}
+	t.Enabled = enabled
+	return t, nil
+}
+
+// state reads the triggers the state file enables or disables
+func (s *TriggerScheduler) state() (map[string]bool, error) {
+	state := make(map[string]bool)
+	if s.stateFile == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(s.stateFile)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, tskerrors.Wrap(tskerrors.Parse, fmt.Errorf("%s: %w", s.stateFile, err))
+	}
+	return state, nil
+}
+
+// enabled reports whether trigger t is enabled now
+func (s *TriggerScheduler) enabled(t *WorkflowTrigger) bool {
+	state, err := s.state()
+	if err != nil {
+		// A state file saved halfway leaves the trigger as declared
+		return t.Enabled
+	}
+	if enabled, ok := state[t.ID]; ok {
+		return enabled
+	}
+	return t.Enabled
+}
+
+// Run fires triggers until ctx is done, then waits for the executions it
+// started, which ctx cancels, to stop
+func (s *TriggerScheduler) Run(ctx context.Context) error {
+	triggers, err := s.Triggers()
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	var stopping sync.Mutex
+	stopped := false
+	fire := func(t *WorkflowTrigger, event *Event) {
+		stopping.Lock()
+		defer stopping.Unlock()
+		if stopped {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.fire(ctx, t, event)
+		}()
+	}
+
+	if s.bus != nil {
+		for _, t := range triggers {
+			if t.Event == "" {
+				continue
+			}
+			t := t
+			unsubscribe := s.bus.Subscribe(t.Event, func(event Event) {
+				if ctx.Err() != nil || !s.enabled(t) {
+					return
+				}
+				matches, err := t.matches(event)
+				if err != nil {
+					s.report(TriggerFiring{Trigger: t, Event: &event, Err: err})
+					return
+				}
+				if matches {
+					fire(t, &event)
+				}
+			})
+			defer unsubscribe()
+		}
+	}
+
+	next := make(map[*WorkflowTrigger]time.Time)
+	start := s.now()
+	for _, t := range triggers {
+		if at := t.Next(start); !at.IsZero() {
+			next[t] = at
+		}
+	}
+	for {
+		var wake time.Time
+		for _, at := range next {
+			if wake.IsZero() || at.Before(wake) {
+				wake = at
+			}
+		}
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !wake.IsZero() {
+			timer = time.NewTimer(time.Until(wake))
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			stopping.Lock()
+			stopped = true
+			stopping.Unlock()
+			wg.Wait()
+			return nil
+		case <-due:
+		}
+		now := s.now()
+		for t, at := range next {
+			if at.After(now) {
+				continue
+			}
+			if s.enabled(t) {
+				fire(t, nil)
+			}
+			if at = t.Next(now); at.IsZero() {
+				delete(next, t)
+			} else {
+				next[t] = at
+			}
+		}
+	}
+}
+
+// fire starts the workflow of t, unless its previous execution is still
+// running
+func (s *TriggerScheduler) fire(ctx context.Context, t *WorkflowTrigger, event *Event) {
+	s.mu.Lock()
+	if s.running[t.ID] {
+		s.mu.Unlock()
+		s.report(TriggerFiring{Trigger: t, Event: event, Err: tskerrors.New(tskerrors.Conflict, "trigger %s: the previous execution is still running", t.ID)})
+		return
+	}
+	s.running[t.ID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, t.ID)
+		s.mu.Unlock()
+	}()
+
+	input := make(map[string]interface{}, len(t.Input)+2)
+	for name, value := range t.Input {
+		input[name] = value
+	}
+	input["trigger"] = map[string]interface{}{"id": t.ID, "fired_at": s.now().Format(time.RFC3339)}
+	if event != nil {
+		input["event"] = event.data()
+	}
+	execution, err := s.wm.ExecuteWorkflow(ctx, t.WorkflowID, input)
+	s.report(TriggerFiring{Trigger: t, Event: event, Execution: execution, Err: err})
+}
+
+func (s *TriggerScheduler) report(firing TriggerFiring) {
+	if s.OnFire != nil {
+		s.OnFire(firing)
+	}
+}
+
+// writeFileAtomic replaces file with data, creating its directory
+func writeFileAtomic(file string, data []byte) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,1070 @@
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/internal/configvalue"
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/expr"
+	"github.com/google/uuid"
+)
+
+// WorkflowFile holds the workflows of a directory
+const WorkflowFile = "workflows.tsk"
+
+// DefaultWorkflowStore is the directory tsk workflow saves executions in
+const DefaultWorkflowStore = ".tsk/workflows"
+
+// Backoffs of a RetryPolicy
+const (
+	// BackoffFixed waits Delay between attempts
+	BackoffFixed = "fixed"
+	// BackoffLinear waits Delay times the number of attempts made
+	BackoffLinear = "linear"
+	// BackoffExponential doubles the wait after every attempt
+	BackoffExponential = "exponential"
+)
+
+// RetryPolicy says how often a failed step is tried again
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt; zero means one attempt
+	MaxAttempts int           `json:"max_attempts,omitempty"`
+	Delay       time.Duration `json:"delay,omitempty"`
+	// Backoff is fixed, linear or exponential; fixed by default
+	Backoff string `json:"backoff,omitempty"`
+	// MaxDelay caps the wait; zero means no cap
+	MaxDelay time.Duration `json:"max_delay,omitempty"`
+}
+
+// Wait returns how long to wait after attempt, counted from 1, failed
+func (p RetryPolicy) Wait(attempt int) time.Duration {
+	d := p.Delay
+	switch p.Backoff {
+	case BackoffLinear:
+		d *= time.Duration(attempt)
+	case BackoffExponential:
+		for i := 1; i < attempt && i < 32 && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+			d *= 2
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+func (p RetryPolicy) validate() error {
+	switch {
+	case p.MaxAttempts < 0:
+		return errors.New("retry.max_attempts must not be negative")
+	case p.Delay < 0 || p.MaxDelay < 0:
+		return errors.New("retry delays must not be negative")
+	case p.Backoff != "" && p.Backoff != BackoffFixed && p.Backoff != BackoffLinear && p.Backoff != BackoffExponential:
+		return fmt.Errorf("unknown backoff %q (fixed, linear or exponential)", p.Backoff)
+	}
+	return nil
+}
+
+// Workflow is a graph of steps run one after the other
+type Workflow struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version,omitempty"`
+	// Start is the first step; the first of Steps by default
+	Start string         `json:"start"`
+	Steps []WorkflowStep `json:"steps"`
+	// Triggers start the workflow on a schedule or an event
+	Triggers []WorkflowTrigger `json:"triggers,omitempty"`
+	// Source is the file the workflow was read from
+	Source string `json:"source,omitempty"`
+}
+
+// WorkflowStep is a step of a workflow, run by the handler of its type
+type WorkflowStep struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+	// Parameters are for the handler; strings may hold ${name}
+	// references to the data conditions see, as in "app:${input.version}"
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	// Conditions must all be true for the step to run, otherwise it is
+	// skipped along with the steps only it leads to
+	Conditions []string `json:"conditions,omitempty"`
+	// NextSteps run after the step completes. When no step of a workflow
+	// has any, the steps run in the order they are listed.
+	NextSteps   []string      `json:"next_steps,omitempty"`
+	Timeout     time.Duration `json:"timeout,omitempty"`
+	RetryPolicy RetryPolicy   `json:"retry_policy"`
+
+	conditions []*expr.Expr
+}
+
+// step returns the step of an id
+func (w *Workflow) step(id string) *WorkflowStep {
+	for i := range w.Steps {
+		if w.Steps[i].ID == id {
+			return &w.Steps[i]
+		}
+	}
+	return nil
+}
+
+// next returns the steps that follow step
+func (w *Workflow) next(step *WorkflowStep) []string {
+	for _, s := range w.Steps {
+		if len(s.NextSteps) > 0 {
+			return step.NextSteps
+		}
+	}
+	for i := range w.Steps {
+		if w.Steps[i].ID == step.ID && i+1 < len(w.Steps) {
+			return []string{w.Steps[i+1].ID}
+		}
+	}
+	return nil
+}
+
+// validate checks the graph of w and compiles its conditions
+func (w *Workflow) validate() error {
+	if w.ID == "" {
+		return errors.New("workflow without an id")
+	}
+	if len(w.Steps) == 0 {
+		return fmt.Errorf("workflow %s has no steps", w.ID)
+	}
+	if w.Start == "" {
+		w.Start = w.Steps[0].ID
+	}
+	seen := make(map[string]bool)
+	for i := range w.Steps {
+		step := &w.Steps[i]
+		if step.ID == "" || seen[step.ID] {
+			return fmt.Errorf("workflow %s: step %d has no id, or a duplicate one", w.ID, i+1)
+		}
+		seen[step.ID] = true
+	}
+	if !seen[w.Start] {
+		return fmt.Errorf("workflow %s: start: no step %s", w.ID, w.Start)
+	}
+	for i := range w.Steps {
+		step := &w.Steps[i]
+		var err error
+		switch {
+		case step.Type == "":
+			err = errors.New("no type")
+		case step.Timeout < 0:
+			err = errors.New("timeout must not be negative")
+		default:
+			err = step.RetryPolicy.validate()
+		}
+		for _, next := range step.NextSteps {
+			if err == nil && !seen[next] {
+				err = fmt.Errorf("next: no step %s", next)
+			}
+		}
+		step.conditions = nil
+		for _, condition := range step.Conditions {
+			if err != nil {
+				break
+			}
+			var e *expr.Expr
+			if e, err = expr.Compile(condition); err == nil {
+				step.conditions = append(step.conditions, e)
+			} else {
+				err = fmt.Errorf("when: %w", err)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("workflow %s: step %s: %w", w.ID, step.ID, err)
+		}
+	}
+	if cycle := w.cycle(); cycle != nil {
+		return fmt.Errorf("workflow %s: steps lead back to themselves: %s", w.ID, strings.Join(cycle, " → "))
+	}
+	names := make(map[string]bool)
+	for i := range w.Triggers {
+		trigger := &w.Triggers[i]
+		trigger.WorkflowID = w.ID
+		if names[trigger.Name] {
+			return fmt.Errorf("workflow %s: duplicate trigger %s", w.ID, trigger.Name)
+		}
+		names[trigger.Name] = true
+		if err := trigger.validate(); err != nil {
+			return fmt.Errorf("workflow %s: %w", w.ID, err)
+		}
+	}
+	return nil
+}
+
+// cycle returns a path of next steps from a step back to itself, or nil
+func (w *Workflow) cycle() []string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		switch state[id] {
+		case visiting:
+			for i, step := range path {
+				if step == id {
+					return append(append([]string(nil), path[i:]...), id)
+				}
+			}
+		case done:
+			return nil
+		}
+		state[id] = visiting
+		path = append(path, id)
+		for _, next := range w.step(id).NextSteps {
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = done
+		return nil
+	}
+	for _, step := range w.Steps {
+		if cycle := visit(step.ID); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// ExecutionStatus is the state of a workflow execution
+type ExecutionStatus string
+
+const (
+	// ExecutionRunning is an execution in progress, or one whose process
+	// stopped before it finished; ResumeExecution continues it
+	ExecutionRunning ExecutionStatus = "running"
+	// ExecutionCompleted ran every step it reached
+	ExecutionCompleted ExecutionStatus = "completed"
+	// ExecutionFailed stopped at a step that failed every attempt
+	ExecutionFailed ExecutionStatus = "failed"
+	// ExecutionCancelled stopped as its context was cancelled
+	ExecutionCancelled ExecutionStatus = "cancelled"
+)
+
+// StepStatus is the state of a step of an execution
+type StepStatus string
+
+const (
+	StepRunning   StepStatus = "running"
+	StepCompleted StepStatus = "completed"
+	StepFailed    StepStatus = "failed"
+	// StepSkipped is a step whose conditions were false
+	StepSkipped StepStatus = "skipped"
+)
+
+// WorkflowExecution is a run of a workflow
+type WorkflowExecution struct {
+	ID         string                 `json:"id"`
+	WorkflowID string                 `json:"workflow_id"`
+	Status     ExecutionStatus        `json:"status"`
+	Input      map[string]interface{} `json:"input"`
+	// Output holds the output of every completed step, by step id
+	Output map[string]interface{} `json:"output"`
+	// Steps are the steps reached, in the order they ran
+	Steps []ExecutionStep `json:"steps"`
+	// Pending are the steps still to run, the next one first
+	Pending     []string   `json:"pending"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// ExecutionStep is a step reached by an execution
+type ExecutionStep struct {
+	ID     string     `json:"id"`
+	Name   string     `json:"name,omitempty"`
+	Type   string     `json:"type"`
+	Status StepStatus `json:"status"`
+	// Attempts counts every attempt, those before a resumption included
+	Attempts    int                    `json:"attempts"`
+	StartedAt   time.Time              `json:"started_at"`
+	CompletedAt *time.Time             `json:"completed_at,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	Output      map[string]interface{} `json:"output,omitempty"`
+}
+
+// Finished reports whether e completed, failed or was cancelled
+func (e *WorkflowExecution) Finished() bool {
+	return e.Status != ExecutionRunning
+}
+
+// clone copies e, so that it can be read while the execution goes on
+func (e *WorkflowExecution) clone() *WorkflowExecution {
+	c := *e
+	c.Output = make(map[string]interface{}, len(e.Output))
+	for id, output := range e.Output {
+		c.Output[id] = output
+	}
+	c.Steps = append([]ExecutionStep(nil), e.Steps...)
+	c.Pending = append([]string(nil), e.Pending...)
+	return &c
+}
+
+// entry returns the record of step id, or nil
+func (e *WorkflowExecution) entry(id string) *ExecutionStep {
+	for i := len(e.Steps) - 1; i >= 0; i-- {
+		if e.Steps[i].ID == id {
+			return &e.Steps[i]
+		}
+	}
+	return nil
+}
+
+// reached reports whether step id ran, was skipped or is pending
+func (e *WorkflowExecution) reached(id string) bool {
+	if e.entry(id) != nil {
+		return true
+	}
+	for _, pending := range e.Pending {
+		if pending == id {
+			return true
+		}
+	}
+	return false
+}
+
+// data is what conditions and ${name} references read: input.<name>,
+// steps.<id>.status, steps.<id>.output.<name>, steps.<id>.attempts and
+// steps.<id>.error, and execution.id and execution.workflow
+func (e *WorkflowExecution) data() map[string]interface{} {
+	steps := make(map[string]interface{}, len(e.Steps))
+	for _, step := range e.Steps {
+		steps[step.ID] = map[string]interface{}{
+			"status":   string(step.Status),
+			"output":   step.Output,
+			"attempts": step.Attempts,
+			"error":    step.Error,
+		}
+	}
+	return map[string]interface{}{
+		"input":     e.Input,
+		"steps":     steps,
+		"execution": map[string]interface{}{"id": e.ID, "workflow": e.WorkflowID},
+	}
+}
+
+// finish ends e with status
+func (e *WorkflowExecution) finish(status ExecutionStatus, err error) {
+	now := time.Now()
+	e.Status = status
+	e.CompletedAt = &now
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+// StepRun is what a StepHandler is given
+type StepRun struct {
+	ExecutionID string
+	WorkflowID  string
+	Step        *WorkflowStep
+	// Params are the parameters of the step, their ${name} references
+	// replaced
+	Params map[string]interface{}
+	// Attempt counts from 1
+	Attempt int
+	// Data is what the conditions of the step read
+	Data map[string]interface{}
+}
+
+// String returns a parameter as a string, "" when unset
+func (r *StepRun) String(name string) string {
+	value, ok := r.Params[name]
+	if !ok || value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+// StepHandler runs the steps of a type and returns their output. It
+// should return once ctx is done, which is when the step times out.
+type StepHandler func(ctx context.Context, run *StepRun) (map[string]interface{}, error)
+
+// WorkflowManager runs workflows, saving every change of their executions
+// to a store so that an execution interrupted by a crash can be resumed
+type WorkflowManager struct {
+	mu         sync.RWMutex
+	workflows  map[string]*Workflow
+	handlers   map[string]StepHandler
+	executions map[string]*WorkflowExecution
+	active     map[string]bool
+	store      ExecutionStore
+}
+
+// NewWorkflowManager creates a workflow manager with the built-in step
+// types: command, http, set and sleep. A nil store keeps executions in
+// memory only.
+func NewWorkflowManager(store ExecutionStore) *WorkflowManager {
+	wm := &WorkflowManager{
+		workflows:  make(map[string]*Workflow),
+		handlers:   make(map[string]StepHandler),
+		executions: make(map[string]*WorkflowExecution),
+		active:     make(map[string]bool),
+		store:      store,
+	}
+	for name, handler := range builtinStepHandlers {
+		wm.handlers[name] = handler
+	}
+	return wm
+}
+
+// RegisterHandler makes handler run the steps of a type. A type that is
+// already registered, built-in ones included, is refused.
+func (wm *WorkflowManager) RegisterHandler(stepType string, handler StepHandler) error {
+	if stepType == "" || handler == nil {
+		return fmt.Errorf("step type %q needs a name and a handler", stepType)
+	}
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if _, exists := wm.handlers[stepType]; exists {
+		return fmt.Errorf("step type %s is already registered", stepType)
+	}
+	wm.handlers[stepType] = handler
+	return nil
+}
+
+// Handlers returns the registered step types, sorted
+func (wm *WorkflowManager) Handlers() []string {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	types := make([]string, 0, len(wm.handlers))
+	for stepType := range wm.handlers {
+		types = append(types, stepType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// CreateWorkflow adds a workflow, checking its steps
+func (wm *WorkflowManager) CreateWorkflow(workflow *Workflow) error {
+	if err := workflow.validate(); err != nil {
+		return err
+	}
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if existing, ok := wm.workflows[workflow.ID]; ok {
+		if existing.Source != "" {
+			return fmt.Errorf("workflow already exists: %s (in %s)", workflow.ID, existing.Source)
+		}
+		return fmt.Errorf("workflow already exists: %s", workflow.ID)
+	}
+	wm.workflows[workflow.ID] = workflow
+	return nil
+}
+
+// Workflows returns the workflows, sorted by id
+func (wm *WorkflowManager) Workflows() []*Workflow {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	workflows := make([]*Workflow, 0, len(wm.workflows))
+	for _, workflow := range wm.workflows {
+		workflows = append(workflows, workflow)
+	}
+	sort.Slice(workflows, func(i, j int) bool { return workflows[i].ID < workflows[j].ID })
+	return workflows
+}
+
+// Workflow returns the workflow of an id
+func (wm *WorkflowManager) Workflow(id string) (*Workflow, bool) {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	workflow, ok := wm.workflows[id]
+	return workflow, ok
+}
+
+// ExecuteWorkflow runs a workflow until it completes or a step fails,
+// and returns the execution. The error is nil only when it completed.
+func (wm *WorkflowManager) ExecuteWorkflow(ctx context.Context, workflowID string, input map[string]interface{}) (*WorkflowExecution, error) {
+	workflow, err := wm.runnable(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	if input == nil {
+		input = make(map[string]interface{})
+	}
+	now := time.Now()
+	execution := &WorkflowExecution{
+		ID:         uuid.NewString(),
+		WorkflowID: workflowID,
+		Status:     ExecutionRunning,
+		Input:      input,
+		Output:     make(map[string]interface{}),
+		Steps:      []ExecutionStep{},
+		Pending:    []string{workflow.Start},
+		StartedAt:  now,
+	}
+	wm.mu.Lock()
+	wm.executions[execution.ID] = execution
+	wm.active[execution.ID] = true
+	wm.mu.Unlock()
+	return wm.run(ctx, workflow, execution)
+}
+
+// ResumeExecution continues an execution that did not complete: one
+// interrupted by a crash, which is still running in its store, or one
+// that failed or was cancelled. The step it stopped at runs again.
+func (wm *WorkflowManager) ResumeExecution(ctx context.Context, executionID string) (*WorkflowExecution, error) {
+	execution, err := wm.Execution(executionID)
+	if err != nil {
+		return nil, err
+	}
+	if execution.Status == ExecutionCompleted {
+		return nil, tskerrors.New(tskerrors.Conflict, "execution %s already completed", executionID)
+	}
+	workflow, err := wm.runnable(execution.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	wm.mu.Lock()
+	if wm.active[executionID] {
+		wm.mu.Unlock()
+		return nil, tskerrors.New(tskerrors.Conflict, "execution %s is running", executionID)
+	}
+	wm.active[executionID] = true
+	wm.executions[executionID] = execution
+	execution.Status = ExecutionRunning
+	execution.Error = ""
+	execution.CompletedAt = nil
+	if len(execution.Pending) > 0 {
+		if entry := execution.entry(execution.Pending[0]); entry != nil {
+			entry.Status = StepRunning
+			entry.Error = ""
+		}
+	}
+	wm.mu.Unlock()
+	return wm.run(ctx, workflow, execution)
+}
+
+// runnable returns a workflow whose step types all have a handler
+func (wm *WorkflowManager) runnable(workflowID string) (*Workflow, error) {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	workflow, ok := wm.workflows[workflowID]
+	if !ok {
+		return nil, tskerrors.New(tskerrors.NotFound, "workflow not found: %s", workflowID)
+	}
+	for _, step := range workflow.Steps {
+		if _, ok := wm.handlers[step.Type]; !ok {
+			return nil, tskerrors.New(tskerrors.Validation, "workflow %s: step %s: unknown type %q", workflowID, step.ID, step.Type)
+		}
+	}
+	return workflow, nil
+}
+
+// Execution returns a copy of an execution of this manager or its store
+func (wm *WorkflowManager) Execution(id string) (*WorkflowExecution, error) {
+	wm.mu.RLock()
+	execution, ok := wm.executions[id]
+	if ok {
+		execution = execution.clone()
+	}
+	wm.mu.RUnlock()
+	if ok {
+		return execution, nil
+	}
+	if wm.store == nil {
+		return nil, tskerrors.New(tskerrors.NotFound, "execution not found: %s", id)
+	}
+	return wm.store.LoadExecution(id)
+}
+
+// Executions returns the executions of the store, or those of this
+// manager without one, the most recent first
+func (wm *WorkflowManager) Executions() ([]*WorkflowExecution, error) {
+	var executions []*WorkflowExecution
+	if wm.store != nil {
+		var err error
+		if executions, err = wm.store.ListExecutions(); err != nil {
+			return nil, err
+		}
+	}
+	wm.mu.RLock()
+	for id, execution := range wm.executions {
+		found := false
+		for i := range executions {
+			if executions[i].ID == id {
+				executions[i], found = execution.clone(), true
+			}
+		}
+		if !found {
+			executions = append(executions, execution.clone())
+		}
+	}
+	wm.mu.RUnlock()
+	sort.SliceStable(executions, func(i, j int) bool { return executions[i].StartedAt.After(executions[j].StartedAt) })
+	return executions, nil
+}
+
+// update changes execution under the lock, then saves it
+func (wm *WorkflowManager) update(execution *WorkflowExecution, change func()) error {
+	wm.mu.Lock()
+	change()
+	execution.UpdatedAt = time.Now()
+	saved := execution.clone()
+	wm.mu.Unlock()
+	if wm.store == nil {
+		return nil
+	}
+	if err := wm.store.SaveExecution(saved); err != nil {
+		return fmt.Errorf("failed to save execution %s: %w", execution.ID, err)
+	}
+	return nil
+}
+
+// snapshot returns the data of execution
+func (wm *WorkflowManager) snapshot(execution *WorkflowExecution) map[string]interface{} {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	return execution.data()
+}
+
+// run goes through the pending steps of execution
+func (wm *WorkflowManager) run(ctx context.Context, workflow *Workflow, execution *WorkflowExecution) (*WorkflowExecution, error) {
+	defer func() {
+		wm.mu.Lock()
+		delete(wm.active, execution.ID)
+		wm.mu.Unlock()
+	}()
+	// Saving first makes a new execution resumable from its first step
+	if err := wm.update(execution, func() {}); err != nil {
+		return execution.clone(), err
+	}
+
+	for {
+		var id string
+		err := wm.update(execution, func() {
+			if len(execution.Pending) == 0 {
+				execution.finish(ExecutionCompleted, nil)
+			} else {
+				id = execution.Pending[0]
+			}
+		})
+		if err != nil || id == "" {
+			return wm.result(execution, err)
+		}
+		step := workflow.step(id)
+		if step == nil {
+			// The workflow changed since the execution was saved
+			err = tskerrors.New(tskerrors.Conflict, "workflow %s has no step %s any more", workflow.ID, id)
+			if saveErr := wm.update(execution, func() { execution.finish(ExecutionFailed, err) }); saveErr != nil {
+				return wm.result(execution, saveErr)
+			}
+			return wm.result(execution, err)
+		}
+
+		applies, err := conditionsHold(step, wm.snapshot(execution))
+		if err == nil && !applies {
+			err = wm.update(execution, func() {
+				now := time.Now()
+				execution.Steps = append(execution.Steps, ExecutionStep{
+					ID: step.ID, Name: step.Name, Type: step.Type, Status: StepSkipped, StartedAt: now, CompletedAt: &now,
+				})
+				execution.Pending = execution.Pending[1:]
+			})
+			if err != nil {
+				return wm.result(execution, err)
+			}
+			continue
+		}
+		if err == nil {
+			err = wm.runStep(ctx, workflow, execution, step)
+		} else {
+			err = fmt.Errorf("step %s: %w", step.ID, err)
+		}
+		if err != nil {
+			status := ExecutionFailed
+			if ctx.Err() != nil {
+				status = ExecutionCancelled
+			}
+			if saveErr := wm.update(execution, func() { execution.finish(status, err) }); saveErr != nil {
+				return wm.result(execution, saveErr)
+			}
+			return wm.result(execution, err)
+		}
+	}
+}
+
+// result returns a copy of execution, and err unless it completed
+func (wm *WorkflowManager) result(execution *WorkflowExecution, err error) (*WorkflowExecution, error) {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	if err == nil && execution.Status != ExecutionCompleted {
+		err = fmt.Errorf("execution %s %s", execution.ID, execution.Status)
+	}
+	return execution.clone(), err
+}
+
+// conditionsHold reports whether every condition of step is true
+func conditionsHold(step *WorkflowStep, data map[string]interface{}) (bool, error) {
+	for _, condition := range step.conditions {
+		holds, err := condition.Bool(data)
+		if err != nil {
+			return false, fmt.Errorf("when %s: %w", condition.Source, err)
+		}
+		if !holds {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// runStep runs step until an attempt succeeds or its retry policy gives
+// up, and records the outcome
+func (wm *WorkflowManager) runStep(ctx context.Context, workflow *Workflow, execution *WorkflowExecution, step *WorkflowStep) error {
+	wm.mu.RLock()
+	handler := wm.handlers[step.Type]
+	wm.mu.RUnlock()
+	attempts := step.RetryPolicy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var output map[string]interface{}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = wm.update(execution, func() {
+			entry := execution.entry(step.ID)
+			if entry == nil || entry.Status != StepRunning {
+				execution.Steps = append(execution.Steps, ExecutionStep{
+					ID: step.ID, Name: step.Name, Type: step.Type, Status: StepRunning, StartedAt: time.Now(),
+				})
+				entry = &execution.Steps[len(execution.Steps)-1]
+			}
+			entry.Attempts++
+		})
+		if err != nil {
+			return err
+		}
+
+		data := wm.snapshot(execution)
+		run := &StepRun{
+			ExecutionID: execution.ID,
+			WorkflowID:  workflow.ID,
+			Step:        step,
+			Params:      expandParams(step.Parameters, data).(map[string]interface{}),
+			Attempt:     attempt,
+			Data:        data,
+		}
+		output, err = callHandler(ctx, step.Timeout, handler, run)
+		if err == nil || attempt >= attempts || ctx.Err() != nil {
+			break
+		}
+		wait := step.RetryPolicy.Wait(attempt)
+		if saveErr := wm.update(execution, func() { execution.entry(step.ID).Error = err.Error() }); saveErr != nil {
+			return saveErr
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if output == nil {
+		output = make(map[string]interface{})
+	}
+	saveErr := wm.update(execution, func() {
+		entry := execution.entry(step.ID)
+		now := time.Now()
+		entry.CompletedAt = &now
+		if err != nil {
+			entry.Status = StepFailed
+			entry.Error = err.Error()
+			return
+		}
+		entry.Status = StepCompleted
+		entry.Error = ""
+		entry.Output = output
+		execution.Output[step.ID] = output
+		execution.Pending = execution.Pending[1:]
+		for _, next := range workflow.next(step) {
+			if !execution.reached(next) {
+				execution.Pending = append(execution.Pending, next)
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("step %s: %w", step.ID, err)
+	}
+	return saveErr
+}
+
+// callHandler runs handler within timeout. A handler that ignores its
+// context is abandoned when the timeout passes.
+func callHandler(ctx context.Context, timeout time.Duration, handler StepHandler, run *StepRun) (map[string]interface{}, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	type result struct {
+		output map[string]interface{}
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{err: fmt.Errorf("step handler panicked: %v", r)}
+			}
+		}()
+		output, err := handler(ctx, run)
+		done <- result{output, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out after %s: %w", timeout, r.err)
+		}
+		return r.output, r.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out after %s", timeout)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// reference matches the ${name} references of parameters
+var reference = regexp.MustCompile(`\$\{\s*([^}]+?)\s*\}`)
+
+// expandParams replaces the ${name} references of the strings in value
+// with the values of data. A string that is a single reference takes the
+// value as it is, a list or a number included.
+func expandParams(value interface{}, data map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if m := reference.FindStringSubmatch(v); m != nil && m[0] == v {
+			found, _ := expr.Lookup(data, m[1])
+			return found
+		}
+		return reference.ReplaceAllStringFunc(v, func(ref string) string {
+			found, _ := expr.Lookup(data, reference.FindStringSubmatch(ref)[1])
+			if found == nil {
+				return ""
+			}
+			return fmt.Sprint(found)
+		})
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = expandParams(item, data)
+		}
+		return list
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = expandParams(item, data)
+		}
+		return m
+	case nil:
+		return map[string]interface{}{}
+	}
+	return value
+}
+
+// LoadWorkflows reads a workflow file, which may hold several workflows:
+//
+//	[workflows.deploy]
+//	name: "Deploy"
+//
+//	[workflows.deploy.steps.test]
+//	type: "command"
+//	command: "go test ./..."
+//	timeout: "10m"
+//	next: ["build"]
+//
+//	[workflows.deploy.steps.build]
+//	type: "command"
+//	command: ["docker", "build", "-t", "app:${input.version}", "."]
+//	retry.max_attempts: 3
+//	retry.delay: "5s"
+//	retry.backoff: "exponential"
+//	next: ["production", "staging"]
+//
+//	[workflows.deploy.steps.production]
+//	when: 'input.env == "prod" && steps.build.status == "completed"'
+//	type: "http"
+//	method: "POST"
+//	url: "https://deploy.internal/releases/${input.version}"
+//
+//	[workflows.deploy.triggers.nightly]
+//	schedule: "0 2 * * *"
+//	input.env: "staging"
+//
+// Settings a step does not know, such as command and url, are the
+// parameters of its handler. Steps are listed in the order they are
+// declared, and the first one starts the workflow unless start names
+// another. A trigger has a cron schedule or an event, and may have when
+// conditions over the event, input.<name> settings and enabled.
+func LoadWorkflows(file string) ([]*Workflow, error) {
+	cfg := config.New()
+	if err := cfg.LoadFromFile(file); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", file, err)
+	}
+	return workflowsFrom(cfg, file)
+}
+
+// workflowsFrom reads the workflows of cfg, loaded from source
+func workflowsFrom(cfg *config.Config, source string) ([]*Workflow, error) {
+	workflows := make(map[string]*Workflow)
+	steps := make(map[string]map[string]*WorkflowStep)
+	triggers := make(map[string]map[string]*WorkflowTrigger)
+	lines := make(map[*WorkflowStep]int)
+	for _, key := range cfg.Keys() {
+		value := cfg.Get(key)
+		rest, ok := strings.CutPrefix(key, "workflows.")
+		if !ok {
+			return nil, fmt.Errorf("%s: %s: unknown setting", source, key)
+		}
+		workflowID, stepID, triggerName, field := rest, "", "", ""
+		if i := strings.Index(rest, ".steps."); i > 0 {
+			workflowID = rest[:i]
+			stepID, field, _ = strings.Cut(rest[i+len(".steps."):], ".")
+		} else if i := strings.Index(rest, ".triggers."); i > 0 {
+			workflowID = rest[:i]
+			triggerName, field, _ = strings.Cut(rest[i+len(".triggers."):], ".")
+		} else if i := strings.LastIndex(rest, "."); i > 0 {
+			workflowID, field = rest[:i], rest[i+1:]
+		}
+		workflowID, stepID, triggerName = unquote(workflowID), unquote(stepID), unquote(triggerName)
+		if workflowID == "" || field == "" || strings.Contains(workflowID, ".") {
+			return nil, fmt.Errorf("%s: %s: unknown setting", source, key)
+		}
+		workflow := workflows[workflowID]
+		if workflow == nil {
+			workflow = &Workflow{ID: workflowID, Source: source}
+			workflows[workflowID] = workflow
+			steps[workflowID] = make(map[string]*WorkflowStep)
+			triggers[workflowID] = make(map[string]*WorkflowTrigger)
+		}
+
+		text := fmt.Sprint(value)
+		var err error
+		if triggerName != "" {
+			trigger := triggers[workflowID][triggerName]
+			if trigger == nil {
+				trigger = &WorkflowTrigger{Name: triggerName, Enabled: true, Input: make(map[string]interface{})}
+				triggers[workflowID][triggerName] = trigger
+			}
+			switch field {
+			case "schedule":
+				trigger.Schedule = text
+			case "event":
+				trigger.Event = text
+			case "when":
+				trigger.Conditions, err = configvalue.StringList(value)
+			case "enabled":
+				trigger.Enabled, err = boolValue(value)
+			default:
+				name, ok := strings.CutPrefix(field, "input.")
+				if !ok {
+					err = errors.New("unknown setting")
+				}
+				trigger.Input[name] = value
+			}
+		} else if stepID == "" {
+			switch field {
+			case "name":
+				workflow.Name = text
+			case "description":
+				workflow.Description = text
+			case "version":
+				workflow.Version = text
+			case "start":
+				workflow.Start = text
+			default:
+				err = errors.New("unknown setting")
+			}
+		} else {
+			step := steps[workflowID][stepID]
+			if step == nil {
+				step = &WorkflowStep{ID: stepID, Parameters: make(map[string]interface{})}
+				steps[workflowID][stepID] = step
+			}
+			if line := cfg.Line(key); lines[step] == 0 || (line > 0 && line < lines[step]) {
+				lines[step] = line
+			}
+			switch field {
+			case "name":
+				step.Name = text
+			case "type":
+				step.Type = text
+			case "when":
+				step.Conditions, err = configvalue.StringList(value)
+			case "next":
+				step.NextSteps, err = configvalue.StringList(value)
+			case "timeout":
+				step.Timeout, err = time.ParseDuration(text)
+			case "retry.max_attempts":
+				step.RetryPolicy.MaxAttempts, err = strconv.Atoi(text)
+			case "retry.delay":
+				step.RetryPolicy.Delay, err = time.ParseDuration(text)
+			case "retry.backoff":
+				step.RetryPolicy.Backoff = text
+			case "retry.max_delay":
+				step.RetryPolicy.MaxDelay, err = time.ParseDuration(text)
+			default:
+				if strings.HasPrefix(field, "retry.") {
+					err = errors.New("unknown setting")
+				}
+				step.Parameters[field] = value
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", source, key, err)
+		}
+	}
+
+	list := make([]*Workflow, 0, len(workflows))
+	for id, workflow := range workflows {
+		for _, step := range steps[id] {
+			workflow.Steps = append(workflow.Steps, *step)
+		}
+		sort.Slice(workflow.Steps, func(i, j int) bool {
+			a, b := lines[steps[id][workflow.Steps[i].ID]], lines[steps[id][workflow.Steps[j].ID]]
+			if a != b {
+				return a < b
+			}
+			return workflow.Steps[i].ID < workflow.Steps[j].ID
+		})
+		for _, trigger := range triggers[id] {
+			workflow.Triggers = append(workflow.Triggers, *trigger)
+		}
+		sort.Slice(workflow.Triggers, func(i, j int) bool { return workflow.Triggers[i].Name < workflow.Triggers[j].Name })
+		if workflow.Name == "" {
+			workflow.Name = id
+		}
+		list = append(list, workflow)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
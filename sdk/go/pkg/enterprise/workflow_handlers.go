@@ -0,0 +1,196 @@
+package enterprise
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// maxStepOutput bounds the output of a command or response body kept in
+// an execution
+const maxStepOutput = 64 << 10
+
+// builtinStepHandlers are the step types of every WorkflowManager
+var builtinStepHandlers = map[string]StepHandler{
+	"command": commandStep,
+	"http":    httpStep,
+	"set":     setStep,
+	"sleep":   sleepStep,
+}
+
+// commandStep runs command, a shell command line or a list of a program
+// and its arguments, in dir with the env.<NAME> variables added. Its
+// output is stdout, stderr and exit_code; a nonzero exit code fails it.
+func commandStep(ctx context.Context, run *StepRun) (map[string]interface{}, error) {
+	var argv []string
+	switch command := run.Params["command"].(type) {
+	case string:
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+		argv = []string{shell, flag, command}
+	case []interface{}:
+		for _, arg := range command {
+			argv = append(argv, fmt.Sprint(arg))
+		}
+	}
+	if len(argv) == 0 {
+		return nil, errors.New("command: expected a command line or a list of arguments")
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = run.String("dir")
+	cmd.Env = os.Environ()
+	for name, value := range paramGroup(run.Params, "env") {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	var stdout, stderr limitedBuffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+
+	output := map[string]interface{}{
+		"stdout":    strings.TrimSpace(stdout.String()),
+		"stderr":    strings.TrimSpace(stderr.String()),
+		"exit_code": cmd.ProcessState.ExitCode(),
+	}
+	if err != nil {
+		if last := lastLine(stderr.String()); last != "" {
+			err = fmt.Errorf("%w: %s", err, last)
+		}
+		return output, err
+	}
+	return output, nil
+}
+
+// httpStep sends a request to url with method (GET, or POST with a body),
+// body (a string, or JSON for anything else) and the headers.<Name>
+// headers. Its output is status, body and, for JSON responses, json; a
+// status of 400 or above fails it.
+func httpStep(ctx context.Context, run *StepRun) (map[string]interface{}, error) {
+	url := run.String("url")
+	if url == "" {
+		return nil, errors.New("http: no url")
+	}
+	var body io.Reader
+	contentType := ""
+	switch b := run.Params["body"].(type) {
+	case nil:
+	case string:
+		body = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, fmt.Errorf("http: body: %w", err)
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	method := strings.ToUpper(run.String("method"))
+	if method == "" {
+		method = http.MethodGet
+		if body != nil {
+			method = http.MethodPost
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for name, value := range paramGroup(run.Params, "headers") {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxStepOutput))
+	if err != nil {
+		return nil, fmt.Errorf("http: failed to read the response: %w", err)
+	}
+
+	output := map[string]interface{}{"status": resp.StatusCode, "body": string(data)}
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		var parsed interface{}
+		if json.Unmarshal(data, &parsed) == nil {
+			output["json"] = parsed
+		}
+	}
+	if resp.StatusCode >= 400 {
+		return output, fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	return output, nil
+}
+
+// setStep outputs its parameters, for later conditions and references
+func setStep(_ context.Context, run *StepRun) (map[string]interface{}, error) {
+	return run.Params, nil
+}
+
+// sleepStep waits for duration
+func sleepStep(ctx context.Context, run *StepRun) (map[string]interface{}, error) {
+	d, err := time.ParseDuration(run.String("duration"))
+	if err != nil {
+		return nil, fmt.Errorf("sleep: duration: %w", err)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return map[string]interface{}{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// paramGroup collects the parameters <group>.<name> of a workflow file,
+// or the entries of a map parameter group, as strings
+func paramGroup(params map[string]interface{}, group string) map[string]string {
+	values := make(map[string]string)
+	if nested, ok := params[group].(map[string]interface{}); ok {
+		for name, value := range nested {
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	for key, value := range params {
+		if name, ok := strings.CutPrefix(key, group+"."); ok {
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	return values
+}
+
+// lastLine returns the last nonempty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// limitedBuffer keeps the first maxStepOutput bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxStepOutput - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,98 @@
+package enterprise
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+// ExecutionStore keeps workflow executions across processes
+type ExecutionStore interface {
+	// SaveExecution replaces the saved state of an execution
+	SaveExecution(execution *WorkflowExecution) error
+	// LoadExecution returns a saved execution, or a NotFound error
+	LoadExecution(id string) (*WorkflowExecution, error)
+	// ListExecutions returns every saved execution
+	ListExecutions() ([]*WorkflowExecution, error)
+}
+
+// FileExecutionStore saves every execution as <id>.json in a directory.
+// Files are replaced atomically, so a crash leaves the previous state.
+type FileExecutionStore struct {
+	dir string
+}
+
+// NewFileExecutionStore saves executions in dir, created when needed
+func NewFileExecutionStore(dir string) *FileExecutionStore {
+	return &FileExecutionStore{dir: dir}
+}
+
+// path returns the file of execution id
+func (s *FileExecutionStore) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", tskerrors.New(tskerrors.NotFound, "execution not found: %s", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// SaveExecution writes the execution atomically
+func (s *FileExecutionStore) SaveExecution(execution *WorkflowExecution) error {
+	file, err := s.path(execution.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(execution, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode execution: %w", err)
+	}
+	if err := writeFileAtomic(file, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to save execution %s: %w", execution.ID, err)
+	}
+	return nil
+}
+
+// LoadExecution reads an execution
+func (s *FileExecutionStore) LoadExecution(id string) (*WorkflowExecution, error) {
+	file, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, tskerrors.New(tskerrors.NotFound, "execution not found: %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var execution WorkflowExecution
+	if err := json.Unmarshal(data, &execution); err != nil {
+		return nil, tskerrors.Wrap(tskerrors.Parse, fmt.Errorf("%s: %w", file, err))
+	}
+	return &execution, nil
+}
+
+// ListExecutions reads every execution, the most recent first
+func (s *FileExecutionStore) ListExecutions() ([]*WorkflowExecution, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	executions := make([]*WorkflowExecution, 0, len(files))
+	for _, file := range files {
+		if strings.HasPrefix(filepath.Base(file), ".") {
+			continue
+		}
+		execution, err := s.LoadExecution(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, execution)
+	}
+	sort.SliceStable(executions, func(i, j int) bool { return executions[i].StartedAt.After(executions[j].StartedAt) })
+	return executions, nil
+}
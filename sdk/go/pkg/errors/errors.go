@@ -0,0 +1,166 @@
+// Package errors classifies the failures of tsk so scripts can branch on
+// them. Every Kind is also the exit code of tsk:
+//
+//	tsk config check || case $? in
+//	  2) echo "syntax error" ;;
+//	  4) echo "could not reach a server" ;;
+//	esac
+//
+// Packages mark errors with New and Wrap, and KindOf finds the kind of any
+// error, recognizing the standard ones such as os.ErrNotExist and network
+// failures that were not marked. Import it as tskerrors next to the
+// standard errors package.
+package errors
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// Kind is the class of a failure, and the exit code of tsk
+type Kind int
+
+const (
+	// Unknown is any failure without a more specific kind
+	Unknown Kind = 1
+	// Parse is a malformed file or value: TSK syntax, JSON, a corrupted binary
+	Parse Kind = 2
+	// Validation is a well-formed configuration rejected by a schema,
+	// a signature or a policy
+	Validation Kind = 3
+	// Connection is a server, database, daemon or supervisor that cannot
+	// be reached
+	Connection Kind = 4
+	// License is a missing, expired or insufficient license
+	License Kind = 5
+	// NotFound is a missing file, key or resource
+	NotFound Kind = 6
+	// Permission is a denied file or server operation
+	Permission Kind = 7
+	// Conflict is a state clash, such as a server already running or
+	// conflicting edits
+	Conflict Kind = 8
+	// Usage is a wrong command line: unknown commands or flags, wrong
+	// arguments. 64 is EX_USAGE of sysexits.h.
+	Usage Kind = 64
+)
+
+// kindNames are the codes reported in JSON error envelopes
+var kindNames = map[Kind]string{
+	Unknown:    "unknown",
+	Parse:      "parse",
+	Validation: "validation",
+	Connection: "connection",
+	License:    "license",
+	NotFound:   "not_found",
+	Permission: "permission",
+	Conflict:   "conflict",
+	Usage:      "usage",
+}
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// ExitCode is the exit code of tsk for a failure of kind k
+func (k Kind) ExitCode() int {
+	return int(k)
+}
+
+// Error is an error marked with its kind
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Code names the kind, for the error envelopes of --json
+func (e *Error) Code() string {
+	return e.Kind.String()
+}
+
+// ExitCode is the exit code of tsk for e
+func (e *Error) ExitCode() int {
+	return e.Kind.ExitCode()
+}
+
+// New returns an error of kind, formatted like fmt.Errorf, so %w wraps
+func New(kind Kind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap marks err with kind, returning nil for a nil err
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOf returns the kind of err: that of the outermost Error it wraps,
+// or the kind of a standard error it recognizes, or Unknown. It returns 0
+// for a nil err.
+func KindOf(err error) Kind {
+	if err == nil {
+		return 0
+	}
+	var marked *Error
+	if stderrors.As(err, &marked) {
+		return marked.Kind
+	}
+
+	var (
+		syntax    *json.SyntaxError
+		typeError *json.UnmarshalTypeError
+		numError  *strconv.NumError
+		netError  net.Error
+	)
+	switch {
+	case stderrors.Is(err, fs.ErrNotExist):
+		return NotFound
+	case stderrors.Is(err, fs.ErrPermission):
+		return Permission
+	case stderrors.As(err, &syntax), stderrors.As(err, &typeError), stderrors.As(err, &numError):
+		return Parse
+	case stderrors.Is(err, syscall.ECONNREFUSED), stderrors.Is(err, syscall.ECONNRESET),
+		stderrors.Is(err, context.DeadlineExceeded), stderrors.As(err, &netError):
+		return Connection
+	}
+	return Unknown
+}
+
+// ExitCode is the exit code of tsk for err: 0 for nil, and the code of
+// its kind otherwise
+func ExitCode(err error) int {
+	return KindOf(err).ExitCode()
+}
+
+// Classify marks err with its kind when KindOf recognizes one it is not
+// marked with, so the kind reaches error envelopes. Other errors are
+// returned as they are.
+func Classify(err error) error {
+	var marked *Error
+	if err == nil || stderrors.As(err, &marked) {
+		return err
+	}
+	if kind := KindOf(err); kind != Unknown {
+		return &Error{Kind: kind, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package errors
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	_, notExist := os.Open("/nonexistent/peanu.tsk")
+	var syntax error = &json.SyntaxError{}
+	_, dialErr := net.Dial("tcp", "127.0.0.1:1")
+	_, numErr := strconv.Atoi("x")
+
+	tests := []struct {
+		err  error
+		want Kind
+	}{
+		{nil, 0},
+		{stderrors.New("boom"), Unknown},
+		{New(Parse, "line %d: list item without a parent key", 3), Parse},
+		{fmt.Errorf("failed to load: %w", New(Validation, "bad")), Validation},
+		// The outermost kind wins, so callers can reclassify
+		{Wrap(Connection, New(NotFound, "no server")), Connection},
+		{notExist, NotFound},
+		{fmt.Errorf("failed to read config file: %w", os.ErrPermission), Permission},
+		{fmt.Errorf("decode: %w", syntax), Parse},
+		{numErr, Parse},
+		{dialErr, Connection},
+		{context.DeadlineExceeded, Connection},
+	}
+	for _, tt := range tests {
+		if got := KindOf(tt.err); got != tt.want {
+			t.Errorf("KindOf(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	codes := map[Kind]int{Unknown: 1, Parse: 2, Validation: 3, Connection: 4, License: 5, NotFound: 6, Usage: 64}
+	for kind, want := range codes {
+		if got := ExitCode(New(kind, "failed")); got != want {
+			t.Errorf("ExitCode(%v) = %d, want %d", kind, got, want)
+		}
+	}
+	if ExitCode(nil) != 0 {
+		t.Error("a nil error should exit with 0")
+	}
+}
+
+func TestError(t *testing.T) {
+	sentinel := New(NotFound, "no peanut configuration found")
+	err := fmt.Errorf("%w in /srv", sentinel)
+	if !stderrors.Is(err, sentinel) {
+		t.Error("a marked sentinel should still match with errors.Is")
+	}
+	if err.Error() != "no peanut configuration found in /srv" {
+		t.Errorf("marking should not change the message, got %q", err)
+	}
+
+	cause := stderrors.New("refused")
+	var marked *Error
+	if !stderrors.As(Wrap(Connection, cause), &marked) || marked.Code() != "connection" || !stderrors.Is(marked, cause) {
+		t.Errorf("unexpected wrapped error %#v", marked)
+	}
+	if Wrap(Parse, nil) != nil {
+		t.Error("Wrap(nil) should be nil")
+	}
+	if Kind(42).String() != "kind(42)" {
+		t.Errorf("unexpected name %q", Kind(42))
+	}
+}
+
+func TestClassify(t *testing.T) {
+	plain := stderrors.New("boom")
+	if Classify(plain) != plain || Classify(nil) != nil {
+		t.Error("unknown errors should be returned as they are")
+	}
+	var marked *Error
+	err := Classify(fmt.Errorf("failed to open: %w", os.ErrNotExist))
+	if !stderrors.As(err, &marked) || marked.Code() != "not_found" {
+		t.Errorf("Classify should mark recognized errors, got %#v", err)
+	}
+	parse := New(Parse, "bad")
+	if Classify(parse) != parse {
+		t.Error("marked errors should be returned as they are")
+	}
+}
@@ -0,0 +1,43 @@
+// Command basics loads peanu.tsk and reads typed values with defaults.
+//
+//	tsk examples run basics
+//	go run . [dir]
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func main() {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	if err := run(dir, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, w io.Writer) error {
+	// Load finds peanu.pnt, peanu.tsk or peanu.peanuts in dir
+	cfg, err := peanut.Load(dir)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	fmt.Fprintf(w, "app:      %s\n", cfg.GetString("app.name", "unknown"))
+	fmt.Fprintf(w, "debug:    %t\n", cfg.GetBool("app.debug", true))
+	fmt.Fprintf(w, "listen:   %s:%d\n", cfg.GetString("server.host", "localhost"), cfg.GetInt("server.port", 80))
+	fmt.Fprintf(w, "timeout:  %.1fs\n", cfg.GetFloat("server.timeout", 30))
+	fmt.Fprintf(w, "features: %v\n", cfg.Get("features.enabled", nil))
+
+	// Missing keys fall back to the default
+	fmt.Fprintf(w, "owner:    %s\n", cfg.GetString("app.owner", "nobody"))
+	return nil
+}
@@ -0,0 +1,51 @@
+// Command binary compiles peanu.tsk into a compressed peanu.pnt and reads
+// it back. Load prefers peanu.pnt, so applications pick up the binary
+// without code changes.
+//
+//	tsk examples run binary
+//	go run . [dir]
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func main() {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	if err := run(dir, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, w io.Writer) error {
+	opts := peanut.DefaultWriteOptions
+	opts.Compression = peanut.CompressionZstd
+	opts.Checksum = peanut.ChecksumCRC32
+
+	input := filepath.Join(dir, "peanu.tsk")
+	output := filepath.Join(dir, "peanu.pnt")
+	if err := peanut.CompileToBinaryWith(input, output, opts); err != nil {
+		return err
+	}
+
+	cfg, err := peanut.Load(dir)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	fmt.Fprintf(w, "loaded %s\n", filepath.Base(cfg.File()))
+	for _, key := range cfg.Keys() {
+		fmt.Fprintf(w, "  %s = %v\n", key, cfg.Get(key, nil))
+	}
+	return nil
+}
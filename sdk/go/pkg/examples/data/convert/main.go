@@ -0,0 +1,58 @@
+// Command convert turns settings.json into peanu.tsk and loads the result.
+//
+//	tsk examples run convert
+//	go run . [dir]
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cyber-boost/tusktsk/pkg/convert"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func main() {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	if err := run(dir, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, w io.Writer) error {
+	in, err := os.Open(filepath.Join(dir, "settings.json"))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(filepath.Join(dir, "peanu.tsk"))
+	if err != nil {
+		return err
+	}
+	if err := convert.Convert(in, out, convert.FormatJSON, convert.FormatTSK); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	cfg, err := peanut.Load(dir)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	fmt.Fprintf(w, "wrote %s\n", filepath.Base(cfg.File()))
+	for _, key := range cfg.Keys() {
+		fmt.Fprintf(w, "  %s = %v\n", key, cfg.Get(key, nil))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Command expressions compiles operator expressions into peanu.pnt and
+// evaluates them with the expression VM.
+//
+//	tsk examples run expressions
+//	TSK_EXAMPLE_MODE=production go run . [dir]
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func main() {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	if err := run(dir, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, w io.Writer) error {
+	input := filepath.Join(dir, "peanu.tsk")
+	output := filepath.Join(dir, "peanu.pnt")
+	if err := peanut.CompileToBinary(input, output); err != nil {
+		return err
+	}
+
+	cfg, err := peanut.LoadFile(output)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	// Get returns the expression source; Resolve and Execute run it
+	fmt.Fprintf(w, "source:   %s\n", cfg.GetString("app.db_host", ""))
+
+	vm := peanut.NewVM()
+	host, _, err := cfg.Resolve("app.db_host", vm)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "resolved: %v\n", host)
+
+	values, err := cfg.Execute(vm)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s = %v\n", key, values[key])
+	}
+	return nil
+}
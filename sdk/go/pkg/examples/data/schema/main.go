@@ -0,0 +1,56 @@
+// Command schema validates peanu.tsk against schema.tsk, then shows the
+// errors reported for an invalid value.
+//
+//	tsk examples run schema
+//	go run . [dir]
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/schema"
+)
+
+func main() {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	if err := run(dir, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, w io.Writer) error {
+	s, err := schema.LoadFile(filepath.Join(dir, "schema.tsk"))
+	if err != nil {
+		return err
+	}
+
+	cfg := config.New()
+	if err := cfg.LoadFromFile(filepath.Join(dir, "peanu.tsk")); err != nil {
+		return err
+	}
+	report(w, "peanu.tsk", s.Validate(cfg))
+
+	cfg.Set("server.port", 70000)
+	cfg.Set("log.level", "verbose")
+	report(w, "peanu.tsk with port 70000 and level verbose", s.Validate(cfg))
+	return nil
+}
+
+func report(w io.Writer, name string, errs []schema.ValidationError) {
+	if len(errs) == 0 {
+		fmt.Fprintf(w, "✅ %s is valid\n", name)
+		return
+	}
+	fmt.Fprintf(w, "❌ %s has %d error(s)\n", name, len(errs))
+	for _, e := range errs {
+		fmt.Fprintf(w, "  %s\n", e)
+	}
+}
@@ -0,0 +1,108 @@
+// Package examples embeds small runnable programs together with the
+// configuration files they use, so new users get working starting points
+// from `tsk examples run` instead of snippets that drift from the SDK.
+//
+// Each example lives in data/<name> as a standalone main package plus its
+// config files. The program body is mirrored here so the tsk binary can run
+// it without a Go toolchain; the package tests check both stay in step.
+package examples
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+//go:embed data
+var data embed.FS
+
+// Example is one embedded example
+type Example struct {
+	Name        string
+	Description string
+	run         func(dir string, w io.Writer) error
+}
+
+// registry lists the examples in the order they are presented
+var registry = []*Example{
+	{Name: "basics", Description: "Load peanu.tsk and read typed values with defaults", run: basics},
+	{Name: "binary", Description: "Compile peanu.tsk to a compressed .pnt binary and read it back", run: binaryExample},
+	{Name: "expressions", Description: "Compile @operator expressions and evaluate them with the VM", run: expressions},
+	{Name: "schema", Description: "Validate a configuration against a TSK schema", run: schemaExample},
+	{Name: "convert", Description: "Convert settings.json to peanu.tsk and load it", run: convertExample},
+}
+
+// List returns every example
+func List() []*Example {
+	return registry
+}
+
+// Get returns the example with the given name
+func Get(name string) (*Example, error) {
+	for _, example := range registry {
+		if example.Name == name {
+			return example, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown example %q (run `tsk examples list`)", name)
+}
+
+// Files returns the names of the files the example writes, main.go included
+func (e *Example) Files() ([]string, error) {
+	entries, err := fs.ReadDir(data, path.Join("data", e.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read example %s: %w", e.Name, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Source returns the contents of one of the example's files
+func (e *Example) Source(name string) ([]byte, error) {
+	content, err := data.ReadFile(path.Join("data", e.Name, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from example %s: %w", name, e.Name, err)
+	}
+	return content, nil
+}
+
+// Extract writes the example's files into dir
+func (e *Example) Extract(dir string) error {
+	names, err := e.Files()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	for _, name := range names {
+		content, err := e.Source(name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Run extracts the example into dir and runs it there, writing its output to w
+func (e *Example) Run(dir string, w io.Writer) error {
+	if err := e.Extract(dir); err != nil {
+		return err
+	}
+	if err := e.run(dir, w); err != nil {
+		return fmt.Errorf("example %s failed: %w", e.Name, err)
+	}
+	return nil
+}
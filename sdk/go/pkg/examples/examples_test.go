@@ -0,0 +1,76 @@
+package examples
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestExamplesRun(t *testing.T) {
+	t.Setenv("TSK_EXAMPLE_MODE", "")
+	for _, example := range List() {
+		t.Run(example.Name, func(t *testing.T) {
+			files, err := example.Files()
+			if err != nil {
+				t.Fatal(err)
+			}
+			hasMain := false
+			for _, name := range files {
+				hasMain = hasMain || name == "main.go"
+			}
+			if !hasMain {
+				t.Errorf("files = %v, want main.go", files)
+			}
+
+			var out bytes.Buffer
+			if err := example.Run(t.TempDir(), &out); err != nil {
+				t.Fatalf("Run() returned error: %v", err)
+			}
+			if out.Len() == 0 {
+				t.Error("Run() wrote no output")
+			}
+		})
+	}
+}
+
+// TestExamplesMatchPrograms runs each embedded main.go and checks it prints
+// the same as the copy compiled into tsk
+func TestExamplesMatchPrograms(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go run in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+	t.Setenv("TSK_EXAMPLE_MODE", "")
+
+	for _, example := range List() {
+		t.Run(example.Name, func(t *testing.T) {
+			var want bytes.Buffer
+			if err := example.Run(t.TempDir(), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			if err := example.Extract(dir); err != nil {
+				t.Fatal(err)
+			}
+			cmd := exec.Command(goTool, "run", "./"+filepath.Join("data", example.Name), dir)
+			got, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("go run failed: %v\n%s", err, got)
+			}
+			if string(got) != want.String() {
+				t.Errorf("main.go output differs from the built-in example\nmain.go:\n%s\nbuilt-in:\n%s", got, want.String())
+			}
+		})
+	}
+}
+
+func TestGetUnknownExample(t *testing.T) {
+	if _, err := Get("nope"); err == nil {
+		t.Error("Get() returned nil error for an unknown example")
+	}
+}
@@ -0,0 +1,158 @@
+package examples
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/convert"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/schema"
+)
+
+// The functions below mirror run() in data/<name>/main.go
+
+func basics(dir string, w io.Writer) error {
+	// Load finds peanu.pnt, peanu.tsk or peanu.peanuts in dir
+	cfg, err := peanut.Load(dir)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	fmt.Fprintf(w, "app:      %s\n", cfg.GetString("app.name", "unknown"))
+	fmt.Fprintf(w, "debug:    %t\n", cfg.GetBool("app.debug", true))
+	fmt.Fprintf(w, "listen:   %s:%d\n", cfg.GetString("server.host", "localhost"), cfg.GetInt("server.port", 80))
+	fmt.Fprintf(w, "timeout:  %.1fs\n", cfg.GetFloat("server.timeout", 30))
+	fmt.Fprintf(w, "features: %v\n", cfg.Get("features.enabled", nil))
+
+	// Missing keys fall back to the default
+	fmt.Fprintf(w, "owner:    %s\n", cfg.GetString("app.owner", "nobody"))
+	return nil
+}
+
+func binaryExample(dir string, w io.Writer) error {
+	opts := peanut.DefaultWriteOptions
+	opts.Compression = peanut.CompressionZstd
+	opts.Checksum = peanut.ChecksumCRC32
+
+	input := filepath.Join(dir, "peanu.tsk")
+	output := filepath.Join(dir, "peanu.pnt")
+	if err := peanut.CompileToBinaryWith(input, output, opts); err != nil {
+		return err
+	}
+
+	cfg, err := peanut.Load(dir)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	fmt.Fprintf(w, "loaded %s\n", filepath.Base(cfg.File()))
+	for _, key := range cfg.Keys() {
+		fmt.Fprintf(w, "  %s = %v\n", key, cfg.Get(key, nil))
+	}
+	return nil
+}
+
+func expressions(dir string, w io.Writer) error {
+	input := filepath.Join(dir, "peanu.tsk")
+	output := filepath.Join(dir, "peanu.pnt")
+	if err := peanut.CompileToBinary(input, output); err != nil {
+		return err
+	}
+
+	cfg, err := peanut.LoadFile(output)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	// Get returns the expression source; Resolve and Execute run it
+	fmt.Fprintf(w, "source:   %s\n", cfg.GetString("app.db_host", ""))
+
+	vm := peanut.NewVM()
+	host, _, err := cfg.Resolve("app.db_host", vm)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "resolved: %v\n", host)
+
+	values, err := cfg.Execute(vm)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s = %v\n", key, values[key])
+	}
+	return nil
+}
+
+func schemaExample(dir string, w io.Writer) error {
+	s, err := schema.LoadFile(filepath.Join(dir, "schema.tsk"))
+	if err != nil {
+		return err
+	}
+
+	cfg := config.New()
+	if err := cfg.LoadFromFile(filepath.Join(dir, "peanu.tsk")); err != nil {
+		return err
+	}
+	report(w, "peanu.tsk", s.Validate(cfg))
+
+	cfg.Set("server.port", 70000)
+	cfg.Set("log.level", "verbose")
+	report(w, "peanu.tsk with port 70000 and level verbose", s.Validate(cfg))
+	return nil
+}
+
+func report(w io.Writer, name string, errs []schema.ValidationError) {
+	if len(errs) == 0 {
+		fmt.Fprintf(w, "✅ %s is valid\n", name)
+		return
+	}
+	fmt.Fprintf(w, "❌ %s has %d error(s)\n", name, len(errs))
+	for _, e := range errs {
+		fmt.Fprintf(w, "  %s\n", e)
+	}
+}
+
+func convertExample(dir string, w io.Writer) error {
+	in, err := os.Open(filepath.Join(dir, "settings.json"))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(filepath.Join(dir, "peanu.tsk"))
+	if err != nil {
+		return err
+	}
+	if err := convert.Convert(in, out, convert.FormatJSON, convert.FormatTSK); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	cfg, err := peanut.Load(dir)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	fmt.Fprintf(w, "wrote %s\n", filepath.Base(cfg.File()))
+	for _, key := range cfg.Keys() {
+		fmt.Fprintf(w, "  %s = %v\n", key, cfg.Get(key, nil))
+	}
+	return nil
+}
@@ -0,0 +1,739 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// node is a node of the syntax tree
+type node interface {
+	eval(data map[string]interface{}) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (n *literal) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type field struct {
+	name string
+}
+
+func (n *field) eval(data map[string]interface{}) (interface{}, error) {
+	value, _ := Lookup(data, n.name)
+	return normalize(value), nil
+}
+
+type list struct {
+	items []node
+}
+
+func (n *list) eval(data map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(data)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (n *logical) eval(data map[string]interface{}) (interface{}, error) {
+	op := "||"
+	if n.and {
+		op = "&&"
+	}
+	left, err := evalBool(n.left, data, op)
+	if err != nil {
+		return nil, err
+	}
+	// Short-circuit, so has(x) && x > 1 works when x is not set
+	if left != n.and {
+		return left, nil
+	}
+	return evalBool(n.right, data, op)
+}
+
+type not struct {
+	operand node
+}
+
+func (n *not) eval(data map[string]interface{}) (interface{}, error) {
+	value, err := evalBool(n.operand, data, "!")
+	if err != nil {
+		return nil, err
+	}
+	return !value, nil
+}
+
+func evalBool(n node, data map[string]interface{}, op string) (bool, error) {
+	value, err := n.eval(data)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %s needs booleans, got %s", ErrType, op, describe(value))
+	}
+	return b, nil
+}
+
+type comparison struct {
+	op          string
+	left, right node
+}
+
+func (n *comparison) eval(data map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	}
+	cmp, err := compare(left, right, n.op)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+type match struct {
+	left, right node
+	negate      bool
+	// re is the pattern when it is a literal
+	re *regexp.Regexp
+}
+
+func (n *match) eval(data map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	re := n.re
+	if re == nil {
+		right, err := n.right.eval(data)
+		if err != nil {
+			return nil, err
+		}
+		pattern, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: the pattern of =~ is %s, not a string", ErrType, describe(right))
+		}
+		if re, err = compileRegexp(pattern); err != nil {
+			return nil, err
+		}
+	}
+	if left == nil {
+		// Nothing matches an unset value
+		return n.negate, nil
+	}
+	s, ok := left.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: =~ matches strings, got %s", ErrType, describe(left))
+	}
+	return re.MatchString(s) != n.negate, nil
+}
+
+type in struct {
+	left, right node
+	negate      bool
+}
+
+func (n *in) eval(data map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	found, err := contains(right, left)
+	if err != nil {
+		return nil, err
+	}
+	return found != n.negate, nil
+}
+
+type arithmetic struct {
+	op          string
+	left, right node
+}
+
+func (n *arithmetic) eval(data map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "+" {
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		}
+	}
+	li, lInt := left.(int64)
+	ri, rInt := right.(int64)
+	if lInt && rInt {
+		switch n.op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/", "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if n.op == "%" {
+				return li % ri, nil
+			}
+			if li%ri == 0 {
+				return li / ri, nil
+			}
+		}
+	}
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%w: %s needs numbers, got %s and %s", ErrType, n.op, describe(left), describe(right))
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	}
+	if rf == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	return math.Mod(lf, rf), nil
+}
+
+type index struct {
+	target, key node
+}
+
+func (n *index) eval(data map[string]interface{}) (interface{}, error) {
+	target, err := n.target.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	switch t := target.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		i, ok := key.(int64)
+		if !ok {
+			return nil, fmt.Errorf("%w: lists are indexed by integers, got %s", ErrType, describe(key))
+		}
+		if i < 0 {
+			i += int64(len(t))
+		}
+		if i < 0 || i >= int64(len(t)) {
+			return nil, nil
+		}
+		return normalize(t[i]), nil
+	case map[string]interface{}:
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: maps are indexed by strings, got %s", ErrType, describe(key))
+		}
+		value, _ := Lookup(t, k)
+		return normalize(value), nil
+	}
+	return nil, fmt.Errorf("%w: cannot index %s", ErrType, describe(target))
+}
+
+type call struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n *call) eval(data map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		if f, ok := arg.(*field); ok && n.fn.raw {
+			// has() asks whether the name is set, not for its value
+			args[i] = f
+			continue
+		}
+		value, err := arg.eval(data)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	value, err := n.fn.call(data, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return value, nil
+}
+
+// walk calls visit for n and the nodes under it
+func walk(n node, visit func(node)) {
+	visit(n)
+	switch n := n.(type) {
+	case *list:
+		for _, item := range n.items {
+			walk(item, visit)
+		}
+	case *logical:
+		walk(n.left, visit)
+		walk(n.right, visit)
+	case *not:
+		walk(n.operand, visit)
+	case *comparison:
+		walk(n.left, visit)
+		walk(n.right, visit)
+	case *match:
+		walk(n.left, visit)
+		walk(n.right, visit)
+	case *in:
+		walk(n.left, visit)
+		walk(n.right, visit)
+	case *arithmetic:
+		walk(n.left, visit)
+		walk(n.right, visit)
+	case *index:
+		walk(n.target, visit)
+		walk(n.key, visit)
+	case *call:
+		for _, arg := range n.args {
+			walk(arg, visit)
+		}
+	}
+}
+
+// Values
+
+// normalize converts the numbers of data to int64 or float64, and arrays
+// and maps to []interface{} and map[string]interface{}
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, int64, float64, []interface{}, map[string]interface{}:
+		return v
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case time.Duration:
+		return v.Seconds()
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		return items
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			m[k] = s
+		}
+		return m
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = normalize(rv.Index(i).Interface())
+		}
+		return items
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			m := make(map[string]interface{}, rv.Len())
+			for _, k := range rv.MapKeys() {
+				m[k.String()] = rv.MapIndex(k).Interface()
+			}
+			return m
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+func asMap(value interface{}) (map[string]interface{}, bool) {
+	m, ok := normalize(value).(map[string]interface{})
+	return m, ok
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// equal compares values; numbers compare by value whatever their type
+func equal(a, b interface{}) bool {
+	a, b = normalize(a), normalize(b)
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		return ok && af == bf
+	}
+	switch av := a.(type) {
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			if w, ok := bv[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// compare orders two numbers or two strings
+func compare(a, b interface{}, op string) (int, error) {
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			switch {
+			case af < bf:
+				return -1, nil
+			case af > bf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return strings.Compare(as, bs), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: cannot compare %s %s %s", ErrType, describe(a), op, describe(b))
+}
+
+// contains reports whether item is in collection: an element of a list,
+// a key of a map or a substring of a string
+func contains(collection, item interface{}) (bool, error) {
+	switch c := collection.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, element := range c {
+			if equal(element, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("%w: map keys are strings, got %s", ErrType, describe(item))
+		}
+		_, found := c[key]
+		return found, nil
+	case string:
+		s, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("%w: cannot look for %s in a string", ErrType, describe(item))
+		}
+		return strings.Contains(c, s), nil
+	}
+	return false, fmt.Errorf("%w: in needs a list, map or string, got %s", ErrType, describe(collection))
+}
+
+// describe names the type and value of v for errors
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return fmt.Sprintf("the boolean %t", v)
+	case string:
+		return fmt.Sprintf("the string %q", v)
+	case int64, float64:
+		return fmt.Sprintf("the number %v", v)
+	case []interface{}:
+		return fmt.Sprintf("a list of %d", len(v))
+	case map[string]interface{}:
+		return "a map"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// regexps caches the patterns compiled at evaluation time
+var regexps sync.Map
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	regexps.Store(pattern, re)
+	return re, nil
+}
+
+// Functions
+
+// function is a built-in function
+type function struct {
+	// arity is the number of arguments, or -1 for any
+	arity int
+	// raw passes field arguments as *field, unevaluated
+	raw  bool
+	call func(data map[string]interface{}, args []interface{}) (interface{}, error)
+}
+
+// functions are the built-in functions
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"has": {arity: 1, raw: true, call: func(data map[string]interface{}, args []interface{}) (interface{}, error) {
+			if f, ok := args[0].(*field); ok {
+				_, found := Lookup(data, f.name)
+				return found, nil
+			}
+			return args[0] != nil, nil
+		}},
+		"get": {arity: 1, call: func(data map[string]interface{}, args []interface{}) (interface{}, error) {
+			name, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: names are strings, got %s", ErrType, describe(args[0]))
+			}
+			value, _ := Lookup(data, name)
+			return normalize(value), nil
+		}},
+		"len": {arity: 1, call: func(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case nil:
+				return int64(0), nil
+			case string:
+				return int64(len([]rune(v))), nil
+			case []interface{}:
+				return int64(len(v)), nil
+			case map[string]interface{}:
+				return int64(len(v)), nil
+			}
+			return nil, fmt.Errorf("%w: no length for %s", ErrType, describe(args[0]))
+		}},
+		"lower":      stringFunc(strings.ToLower),
+		"upper":      stringFunc(strings.ToUpper),
+		"trim":       stringFunc(strings.TrimSpace),
+		"startsWith": stringTest(strings.HasPrefix),
+		"endsWith":   stringTest(strings.HasSuffix),
+		"contains": {arity: 2, call: func(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+			return contains(args[0], args[1])
+		}},
+		"matches": {arity: 2, call: func(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+			s, ok := args[0].(string)
+			pattern, pok := args[1].(string)
+			if !ok || !pok {
+				return nil, fmt.Errorf("%w: needs a string and a pattern", ErrType)
+			}
+			re, err := compileRegexp(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return re.MatchString(s), nil
+		}},
+		"number": {arity: 1, call: func(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case int64, float64:
+				return v, nil
+			case bool:
+				if v {
+					return int64(1), nil
+				}
+				return int64(0), nil
+			case string:
+				s := strings.TrimSpace(v)
+				if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+					return n, nil
+				}
+				if f, err := strconv.ParseFloat(s, 64); err == nil {
+					return f, nil
+				}
+			}
+			return nil, fmt.Errorf("%w: %s is not a number", ErrType, describe(args[0]))
+		}},
+		"string": {arity: 1, call: func(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case nil:
+				return "", nil
+			case string:
+				return v, nil
+			case int64:
+				return strconv.FormatInt(v, 10), nil
+			case float64:
+				return strconv.FormatFloat(v, 'f', -1, 64), nil
+			}
+			return fmt.Sprint(args[0]), nil
+		}},
+		"duration": {arity: 1, call: func(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+			// Seconds, from "90s", "1h30m", whole days such as "90d" or a
+			// number of seconds
+			switch v := args[0].(type) {
+			case int64, float64:
+				return v, nil
+			case string:
+				v = strings.TrimSpace(v)
+				if days, ok := strings.CutSuffix(v, "d"); ok {
+					if n, err := strconv.ParseInt(days, 10, 64); err == nil {
+						return float64(n * 24 * 60 * 60), nil
+					}
+				}
+				d, err := time.ParseDuration(v)
+				if err != nil {
+					return nil, err
+				}
+				return d.Seconds(), nil
+			}
+			return nil, fmt.Errorf("%w: %s is not a duration", ErrType, describe(args[0]))
+		}},
+		"keys": {arity: 1, call: func(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+			m, ok := args[0].(map[string]interface{})
+			if !ok {
+				if args[0] == nil {
+					return []interface{}{}, nil
+				}
+				return nil, fmt.Errorf("%w: keys needs a map, got %s", ErrType, describe(args[0]))
+			}
+			names := make([]string, 0, len(m))
+			for k := range m {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			return normalize(names), nil
+		}},
+	}
+	// all and any test every element of a list against a pattern
+	for name, want := range map[string]bool{"all": true, "any": false} {
+		want := want
+		functions[name] = function{arity: 2, call: func(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+			items, ok := args[0].([]interface{})
+			pattern, pok := args[1].(string)
+			if !ok && args[0] != nil || !pok {
+				return nil, fmt.Errorf("%w: needs a list and a pattern", ErrType)
+			}
+			re, err := compileRegexp(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				s, ok := item.(string)
+				if (ok && re.MatchString(s)) != want {
+					return !want, nil
+				}
+			}
+			return want, nil
+		}}
+	}
+}
+
+func stringFunc(f func(string) string) function {
+	return function{arity: 1, call: func(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return "", nil
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: needs a string, got %s", ErrType, describe(args[0]))
+		}
+		return f(s), nil
+	}}
+}
+
+func stringTest(f func(string, string) bool) function {
+	return function{arity: 2, call: func(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return false, nil
+		}
+		s, ok := args[0].(string)
+		prefix, pok := args[1].(string)
+		if !ok || !pok {
+			return nil, fmt.Errorf("%w: needs strings, got %s and %s", ErrType, describe(args[0]), describe(args[1]))
+		}
+		return f(s, prefix), nil
+	}}
+}
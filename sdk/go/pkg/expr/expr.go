@@ -0,0 +1,530 @@
+// Package expr is the condition language of compliance rules and
+// workflows: boolean expressions over configuration and resource data.
+//
+//	server.port >= 1024 && server.port != 8080
+//	env == "prod" && !debug
+//	tls.min_version in ["1.2", "1.3"]
+//	db.host =~ "^[a-z0-9.-]+\\.internal$"
+//	has(encryption.key) && len(encryption.key) >= 32
+//	replicas > 1 || env != "prod"
+//
+// Names with dots look up flat keys such as "server.port" first, then
+// walk nested maps, so both config.Values() and JSON documents work.
+// A name that is not set is null; get("max-connections") reads names
+// that are not identifiers.
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrType is wrapped by evaluation errors from operands of the wrong type
+var ErrType = errors.New("type mismatch")
+
+// Expr is a compiled expression
+type Expr struct {
+	// Source is the expression compiled
+	Source string
+	root   node
+	fields []string
+}
+
+// Compile parses source
+func Compile(source string) (*Expr, error) {
+	p := &parser{lex: lexer{src: source}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.tok.text, p.tok.pos)
+	}
+	e := &Expr{Source: source, root: root}
+	seen := make(map[string]bool)
+	walk(root, func(n node) {
+		if f, ok := n.(*field); ok && !seen[f.name] {
+			seen[f.name] = true
+			e.fields = append(e.fields, f.name)
+		}
+	})
+	return e, nil
+}
+
+// MustCompile is Compile for expressions known to be valid; it panics on
+// errors
+func MustCompile(source string) *Expr {
+	e, err := Compile(source)
+	if err != nil {
+		panic(fmt.Sprintf("expr: %q: %v", source, err))
+	}
+	return e
+}
+
+// Fields returns the names the expression reads, in order of appearance
+func (e *Expr) Fields() []string {
+	return e.fields
+}
+
+// Eval evaluates the expression over data
+func (e *Expr) Eval(data map[string]interface{}) (interface{}, error) {
+	return e.root.eval(data)
+}
+
+// Bool evaluates the expression, which must be true or false
+func (e *Expr) Bool(data map[string]interface{}) (bool, error) {
+	value, err := e.root.eval(data)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: the condition is %s, not a boolean", ErrType, describe(value))
+	}
+	return b, nil
+}
+
+// Eval compiles and evaluates source over data
+func Eval(source string, data map[string]interface{}) (interface{}, error) {
+	e, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(data)
+}
+
+// Lookup resolves a dotted name in data: a flat key, or the longest flat
+// key it starts with followed by nested map keys. A name that only
+// prefixes flat keys, such as server for server.port, is the map of them.
+func Lookup(data map[string]interface{}, name string) (interface{}, bool) {
+	if value, ok := data[name]; ok {
+		return value, true
+	}
+	for i := len(name) - 1; i > 0; i-- {
+		if name[i] != '.' {
+			continue
+		}
+		if nested, ok := asMap(data[name[:i]]); ok {
+			return Lookup(nested, name[i+1:])
+		}
+	}
+	var section map[string]interface{}
+	for key, value := range data {
+		if rest, ok := strings.CutPrefix(key, name+"."); ok {
+			if section == nil {
+				section = make(map[string]interface{})
+			}
+			section[rest] = value
+		}
+	}
+	if section == nil {
+		return nil, false
+	}
+	return section, true
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// value is the value of a number or string
+	value interface{}
+	pos   int
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+// twoCharOps are the operators of two characters
+var twoCharOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~"}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && strings.ContainsRune(" \t\r\n", rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case c == '"' || c == '\'':
+		return l.string(c)
+	case c >= '0' && c <= '9':
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.' || l.src[l.pos] == '_') {
+			l.pos++
+		}
+		text := strings.ReplaceAll(l.src[start:l.pos], "_", "")
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return token{kind: tokNumber, text: text, value: n, pos: start}, nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return token{}, fmt.Errorf("invalid number %q at offset %d", text, start)
+		}
+		return token{kind: tokNumber, text: text, value: f, pos: start}, nil
+	case isIdentStart(c):
+		// Names may contain dots; get("max-connections") reads others
+		for l.pos < len(l.src) && (isIdentStart(l.src[l.pos]) || isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		text := strings.TrimRight(l.src[start:l.pos], ".")
+		l.pos = start + len(text)
+		return token{kind: tokIdent, text: text, pos: start}, nil
+	}
+	for _, op := range twoCharOps {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += 2
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	if strings.ContainsRune("+-*/%<>!()[],", rune(c)) {
+		l.pos++
+		return token{kind: tokOp, text: string(c), pos: start}, nil
+	}
+	return token{}, fmt.Errorf("unexpected %q at offset %d", c, start)
+}
+
+// string reads a string quoted with quote; backslash escapes work in both
+// kinds of quotes
+func (l *lexer) string(quote byte) (token, error) {
+	start := l.pos
+	var b strings.Builder
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			return token{kind: tokString, text: l.src[start:l.pos], value: b.String(), pos: start}, nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.pos++
+			switch e := l.src[l.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return token{}, fmt.Errorf("unterminated string at offset %d", start)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Parser
+
+type parser struct {
+	lex lexer
+	tok token
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+// is reports whether the current token is the operator or keyword text
+func (p *parser) is(text string) bool {
+	return (p.tok.kind == tokOp || p.tok.kind == tokIdent) && p.tok.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return p.unexpected("expected " + strconv.Quote(text))
+	}
+	return p.advance()
+}
+
+func (p *parser) unexpected(want string) error {
+	if p.tok.kind == tokEOF {
+		return fmt.Errorf("%s at the end of the expression", want)
+	}
+	return fmt.Errorf("%s, got %q at offset %d", want, p.tok.text, p.tok.pos)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("||") || p.is("or") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("&&") || p.is("and") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.is("!") || p.is("not") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &not{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+// comparisonOps are the operators of comparisons, which do not chain
+var comparisonOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "=~": true, "!~": true, "in": true}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op := p.tok.text
+	negate := false
+	if p.is("not") {
+		// not in
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if !p.is("in") {
+			return nil, p.unexpected(`expected "in" after "not"`)
+		}
+		op, negate = "in", true
+	} else if !comparisonOps[op] || p.tok.kind == tokString || p.tok.kind == tokNumber {
+		return left, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if op == "=~" || op == "!~" {
+		m := &match{left: left, right: right, negate: op == "!~"}
+		if lit, ok := right.(*literal); ok {
+			pattern, ok := lit.value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: the pattern of %s is %s, not a string", ErrType, op, describe(lit.value))
+			}
+			if m.re, err = compileRegexp(pattern); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	if op == "in" {
+		return &in{left: left, right: right, negate: negate}, nil
+	}
+	return &comparison{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "+" || p.tok.text == "-") {
+		op := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmetic{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "*" || p.tok.text == "/" || p.tok.text == "%") {
+		op := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmetic{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.tok.kind == tokOp && p.tok.text == "-" {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithmetic{op: "-", left: &literal{value: int64(0)}, right: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && p.tok.text == "[" {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		key, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		n = &index{target: n, key: key}
+	}
+	return n, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber, tokString:
+		return &literal{value: tok.value}, p.advance()
+	case tokIdent:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		switch tok.text {
+		case "true":
+			return &literal{value: true}, nil
+		case "false":
+			return &literal{value: false}, nil
+		case "null", "nil":
+			return &literal{value: nil}, nil
+		}
+		if !p.is("(") {
+			if keywords[tok.text] {
+				return nil, fmt.Errorf("unexpected %q at offset %d", tok.text, tok.pos)
+			}
+			return &field{name: tok.text}, nil
+		}
+		fn, ok := functions[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown function %s at offset %d", tok.text, tok.pos)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		c := &call{name: tok.text, fn: fn}
+		for !p.is(")") {
+			if len(c.args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+		}
+		if fn.arity >= 0 && len(c.args) != fn.arity {
+			return nil, fmt.Errorf("%s takes %d argument(s), got %d", tok.text, fn.arity, len(c.args))
+		}
+		return c, p.advance()
+	case tokOp:
+		switch tok.text {
+		case "(":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			l := &list{}
+			for !p.is("]") {
+				if len(l.items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				l.items = append(l.items, item)
+			}
+			return l, p.advance()
+		}
+	}
+	return nil, p.unexpected("expected a value")
+}
+
+// keywords are names that cannot be fields
+var keywords = map[string]bool{"and": true, "or": true, "not": true, "in": true}
@@ -0,0 +1,114 @@
+package expr
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// data mixes flat keys, as config.Values() returns them, with nested maps
+var data = map[string]interface{}{
+	"env":                "prod",
+	"debug":              false,
+	"replicas":           3,
+	"server.port":        8443,
+	"server.tls.enabled": true,
+	"server.tls.version": "1.3",
+	"server.timeout":     "30s",
+	"server.ratio":       0.75,
+	"db.host":            "pg.db.internal",
+	"db.password":        "",
+	"allowed_origins":    []interface{}{"https://a.example.com", "https://b.example.com"},
+	"max-connections":    100,
+	"labels": map[string]interface{}{
+		"team": "payments",
+		"tier": map[string]interface{}{"name": "gold"},
+	},
+}
+
+func TestEval(t *testing.T) {
+	for source, want := range map[string]interface{}{
+		`server.port >= 1024 && server.port != 8080`:          true,
+		`env == "prod" && !debug`:                             true,
+		`env == 'dev' || replicas > 1`:                        true,
+		`server.tls.version in ["1.2", "1.3"]`:                true,
+		`server.tls.version not in ["1.2", "1.3"]`:            false,
+		`"payments" in labels.team`:                           true,
+		`"team" in labels`:                                    true,
+		`db.host =~ "\\.internal$"`:                           true,
+		`db.host !~ "^localhost"`:                             true,
+		`missing =~ "x"`:                                      false,
+		`has(server.tls) && server.tls.enabled`:               true,
+		`has(missing) && missing > 1`:                         false,
+		`not has(db.user)`:                                    true,
+		`len(db.password) == 0`:                               true,
+		`labels.tier.name == "gold"`:                          true,
+		`labels["tier"]["name"]`:                              "gold",
+		`allowed_origins[-1]`:                                 "https://b.example.com",
+		`allowed_origins[5]`:                                  nil,
+		`all(allowed_origins, "^https://")`:                   true,
+		`any(allowed_origins, "^http://")`:                    false,
+		`duration(server.timeout) <= 60`:                      true,
+		`duration("90d") == duration("2160h")`:                true,
+		`replicas * 2 + 1`:                                    int64(7),
+		`replicas / 2`:                                        1.5,
+		`-replicas % 2`:                                       int64(-1),
+		`server.ratio * 100 == 75`:                            true,
+		`replicas == 3.0`:                                     true,
+		`get("max-connections") > 50`:                         true,
+		`startsWith(lower(env), "pr") and endsWith(env, "d")`: true,
+		`number("42") + 1`:                                    int64(43),
+		`string(replicas) + "x"`:                              "3x",
+		`keys(labels)`:                                        []interface{}{"team", "tier"},
+		`[1, 2] == [1, 2.0]`:                                  true,
+		`(1 + 2) * 3`:                                         int64(9),
+		`missing == null`:                                     true,
+	} {
+		got, err := Eval(source, data)
+		if err != nil {
+			t.Errorf("Eval(%s) returned error: %v", source, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Eval(%s) = %#v, want %#v", source, got, want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, source := range []string{`env > 3`, `missing < 1`, `!debug && env`, `env + 1`, `replicas / 0`, `replicas in 5`, `lower(replicas)`} {
+		_, err := Eval(source, data)
+		if err == nil {
+			t.Errorf("Eval(%s) returned no error", source)
+		}
+	}
+	if _, err := Eval(`env > 3`, data); !errors.Is(err, ErrType) {
+		t.Errorf("Eval(env > 3) = %v, want ErrType", err)
+	}
+	for _, source := range []string{``, `a ==`, `(a`, `a b`, `"open`, `nope(1)`, `len(1, 2)`, `a =~ "("`, `a =~ 1`, `a not b`, `in`, `a $ b`} {
+		if _, err := Compile(source); err == nil {
+			t.Errorf("Compile(%q) returned no error", source)
+		}
+	}
+	e := MustCompile(`replicas`)
+	if _, err := e.Bool(data); !errors.Is(err, ErrType) {
+		t.Errorf("Bool() of a number = %v, want ErrType", err)
+	}
+}
+
+func TestFields(t *testing.T) {
+	e := MustCompile(`has(tls.cert) && server.port > 1024 || server.port == tls.port`)
+	if got, want := e.Fields(), []string{"tls.cert", "server.port", "tls.port"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields() = %v, want %v", got, want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	section, ok := Lookup(data, "server.tls")
+	if !ok || !reflect.DeepEqual(section, map[string]interface{}{"enabled": true, "version": "1.3"}) {
+		t.Errorf("Lookup(server.tls) = %v, %t", section, ok)
+	}
+	if _, ok := Lookup(data, "server.tl"); ok {
+		t.Error("Lookup(server.tl) found a partial name")
+	}
+}
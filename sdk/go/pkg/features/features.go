@@ -0,0 +1,451 @@
+// Package features evaluates feature flags for the @feature operator.
+// Flags come from the [features] section of a configuration, a remote
+// provider, or both:
+//
+//	[features]
+//	provider: "https://flags.internal/v1/flags.json"
+//	refresh: "30s"
+//	dark_mode: true
+//	new_ui {
+//	    rollout: 25
+//	    users: ["alice"]
+//	    exclude: ["mallory"]
+//	    match {
+//	        country: ["DE", "FR"]
+//	    }
+//	}
+//
+// The provider serves the same shape as JSON and wins over the section; it
+// is sent TSK_FEATURES_TOKEN as a bearer token when set. `tsk feature
+// enable` and `disable` override both at runtime through OverridesFile.
+package features
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenEnv names the environment variable holding the provider's token
+const TokenEnv = "TSK_FEATURES_TOKEN"
+
+// DefaultRefresh is how often the provider is polled
+const DefaultRefresh = time.Minute
+
+// Flag is one feature flag. A user sees it when it is enabled, they are
+// not excluded, and they are listed in Users or match every Match
+// attribute and fall inside the Rollout percentage.
+type Flag struct {
+	Enabled bool
+	// Rollout is the percentage of users, 0 to 100, who see the flag
+	Rollout float64
+	Users   []string
+	Exclude []string
+	// Match restricts the flag to users whose attributes take one of the
+	// listed values
+	Match map[string][]string
+}
+
+// Options are the flags and provider of a [features] section
+type Options struct {
+	Flags    map[string]Flag
+	Provider string
+	Refresh  time.Duration
+}
+
+// OptionsFrom reads Options from the flat features.* keys of a
+// configuration
+func OptionsFrom(values map[string]interface{}) (Options, error) {
+	opts := Options{Refresh: DefaultRefresh}
+	flagValues := make(map[string]interface{})
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "features.")
+		if !ok {
+			continue
+		}
+		switch setting {
+		case "provider":
+			opts.Provider = fmt.Sprint(value)
+		case "refresh":
+			refresh, err := time.ParseDuration(fmt.Sprint(value))
+			if err != nil || refresh <= 0 {
+				return opts, fmt.Errorf("features.refresh: invalid duration %v", value)
+			}
+			opts.Refresh = refresh
+		default:
+			flagValues[setting] = value
+		}
+	}
+	flags, err := flagsFrom(flagValues, "features.")
+	if err != nil {
+		return opts, err
+	}
+	opts.Flags = flags
+	return opts, nil
+}
+
+// flagsFrom reads flags from flat keys: "name" holding a bool, or
+// "name.enabled", "name.rollout", "name.users", "name.exclude" and
+// "name.match.<attribute>". Errors name keys with prefix.
+func flagsFrom(values map[string]interface{}, prefix string) (map[string]Flag, error) {
+	flags := make(map[string]Flag)
+	for setting, value := range values {
+		key := prefix + setting
+		name, field, _ := strings.Cut(setting, ".")
+		flag, ok := flags[name]
+		if !ok {
+			flag = Flag{Enabled: true, Rollout: 100}
+		}
+		switch {
+		case field == "":
+			enabled, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected true, false or a section, got %v", key, value)
+			}
+			flag.Enabled = enabled
+		case field == "enabled":
+			enabled, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected true or false, got %v", key, value)
+			}
+			flag.Enabled = enabled
+		case field == "rollout":
+			rollout, err := strconv.ParseFloat(strings.TrimSuffix(fmt.Sprint(value), "%"), 64)
+			if err != nil || rollout < 0 || rollout > 100 {
+				return nil, fmt.Errorf("%s: expected a percentage, got %v", key, value)
+			}
+			flag.Rollout = rollout
+		case field == "users" || field == "exclude":
+			list, err := stringList(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			if field == "users" {
+				flag.Users = list
+			} else {
+				flag.Exclude = list
+			}
+		case strings.HasPrefix(field, "match."):
+			list, err := stringList(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			if flag.Match == nil {
+				flag.Match = make(map[string][]string)
+			}
+			flag.Match[strings.TrimPrefix(field, "match.")] = list
+		default:
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+		flags[name] = flag
+	}
+	return flags, nil
+}
+
+// stringList reads a string or an array of them
+func stringList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, len(v))
+		for i, item := range v {
+			list[i] = fmt.Sprint(item)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("expected a string or array, got %v", value)
+}
+
+// User is who a flag is evaluated for: an id and attributes to match
+type User map[string]string
+
+// ID returns the user's id, which rollouts hash
+func (u User) ID() string {
+	return u["id"]
+}
+
+// UserFrom reads a user from an id, a map of attributes or a JSON object
+func UserFrom(value interface{}) (User, error) {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		text := fmt.Sprint(value)
+		if !strings.HasPrefix(strings.TrimSpace(text), "{") {
+			return User{"id": text}, nil
+		}
+		if err := json.Unmarshal([]byte(text), &fields); err != nil {
+			return nil, fmt.Errorf("invalid user %q: %w", text, err)
+		}
+	}
+	user := make(User, len(fields))
+	for key, v := range fields {
+		user[key] = fmt.Sprint(v)
+	}
+	return user, nil
+}
+
+// Allows reports whether the flag called name is on for user, which may be
+// nil
+func (f Flag) Allows(name string, user User) bool {
+	if !f.Enabled {
+		return false
+	}
+	id := user.ID()
+	if id != "" && contains(f.Exclude, id) {
+		return false
+	}
+	if id != "" && contains(f.Users, id) {
+		return true
+	}
+	for attribute, allowed := range f.Match {
+		value, ok := user[attribute]
+		if !ok || !contains(allowed, value) {
+			return false
+		}
+	}
+	switch {
+	case f.Rollout >= 100:
+		return true
+	case f.Rollout <= 0 || id == "":
+		// Partial rollouts need an id to place the user consistently
+		return false
+	}
+	return bucket(name, id) < f.Rollout
+}
+
+// bucket places a user in [0, 100) for a flag. Each flag hashes its own
+// name in, so the same users are not always the first to see new flags.
+func bucket(name, id string) float64 {
+	sum := sha256.Sum256([]byte(name + ":" + id))
+	return float64(binary.BigEndian.Uint32(sum[:4])%10000) / 100
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Manager evaluates flags from a configuration, its provider and the
+// runtime overrides
+type Manager struct {
+	mu     sync.Mutex
+	opts   Options
+	remote map[string]Flag
+	// fetched is when the provider was last polled, successfully or not
+	fetched time.Time
+	err     error
+	client  *http.Client
+
+	overridesPath string
+	overrides     map[string]bool
+	overridesMod  time.Time
+	checked       time.Time
+
+	now func() time.Time
+}
+
+// NewManager creates a Manager without flags
+func NewManager() *Manager {
+	return &Manager{client: &http.Client{Timeout: 10 * time.Second}, now: time.Now}
+}
+
+// Default is the Manager behind the @feature operator
+var Default = NewManager()
+
+// Configure replaces the flags and provider. Remote flags are kept when the
+// provider is unchanged, so configuring on every load is cheap.
+func (m *Manager) Configure(opts Options) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if opts.Provider != m.opts.Provider || opts.Refresh != m.opts.Refresh {
+		m.remote, m.fetched, m.err = nil, time.Time{}, nil
+	}
+	m.opts = opts
+}
+
+// SetOverridesFile reads runtime overrides from path, usually
+// OverridesFile(dir). "" turns overrides off.
+func (m *Manager) SetOverridesFile(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if path != m.overridesPath {
+		m.overridesPath, m.overrides = path, nil
+		m.overridesMod, m.checked = time.Time{}, time.Time{}
+	}
+}
+
+// Flag returns the effective flag called name: a runtime override, else
+// the provider's flag, else the configuration's
+func (m *Manager) Flag(name string) (Flag, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshOverrides()
+	if enabled, ok := m.overrides[name]; ok {
+		return Flag{Enabled: enabled, Rollout: 100}, true, nil
+	}
+	err := m.refreshRemote()
+	if flag, ok := m.remote[name]; ok {
+		return flag, true, nil
+	}
+	flag, ok := m.opts.Flags[name]
+	if !ok && err != nil {
+		// The flag may only exist remotely
+		return Flag{}, false, err
+	}
+	return flag, ok, nil
+}
+
+// Enabled reports whether the flag called name is on for user. Unknown
+// flags are off.
+func (m *Manager) Enabled(name string, user User) (bool, error) {
+	flag, ok, err := m.Flag(name)
+	if err != nil || !ok {
+		return false, err
+	}
+	return flag.Allows(name, user), nil
+}
+
+// Evaluate executes @feature operator: @feature(name, user) reports
+// whether a flag is on, for a user given as an id or a JSON object of
+// attributes with an "id"
+func (m *Manager) Evaluate(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("@feature requires a flag name and an optional user")
+	}
+	var user User
+	if len(args) == 2 && args[1] != nil {
+		var err error
+		if user, err = UserFrom(args[1]); err != nil {
+			return nil, fmt.Errorf("@feature: %w", err)
+		}
+	}
+	enabled, err := m.Enabled(fmt.Sprint(args[0]), user)
+	if err != nil {
+		return nil, fmt.Errorf("@feature: %w", err)
+	}
+	return enabled, nil
+}
+
+// Names returns every flag name the configuration, provider and overrides
+// know, sorted
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshOverrides()
+	m.refreshRemote()
+	seen := make(map[string]bool)
+	for _, set := range []map[string]Flag{m.opts.Flags, m.remote} {
+		for name := range set {
+			seen[name] = true
+		}
+	}
+	for name := range m.overrides {
+		seen[name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// overrideCheckInterval limits how often the overrides file is stat'ed
+const overrideCheckInterval = time.Second
+
+// refreshOverrides rereads the overrides file when it has changed
+func (m *Manager) refreshOverrides() {
+	now := m.now()
+	if m.overridesPath == "" || now.Sub(m.checked) < overrideCheckInterval {
+		return
+	}
+	m.checked = now
+	info, err := os.Stat(m.overridesPath)
+	if err != nil {
+		m.overrides, m.overridesMod = nil, time.Time{}
+		return
+	}
+	if info.ModTime().Equal(m.overridesMod) {
+		return
+	}
+	overrides, err := LoadOverrides(m.overridesPath)
+	if err != nil {
+		// Keep the last good overrides while the file is rewritten
+		return
+	}
+	m.overrides, m.overridesMod = overrides, info.ModTime()
+}
+
+// refreshRemote polls the provider once Refresh has passed. A failed poll
+// keeps the last flags and is retried after Refresh.
+func (m *Manager) refreshRemote() error {
+	if m.opts.Provider == "" {
+		return nil
+	}
+	now := m.now()
+	if !m.fetched.IsZero() && now.Sub(m.fetched) < m.opts.Refresh {
+		return m.err
+	}
+	m.fetched = now
+	flags, err := m.fetch(m.opts.Provider)
+	if err != nil {
+		m.err = fmt.Errorf("failed to fetch flags from %s: %w", m.opts.Provider, err)
+		return m.err
+	}
+	m.remote, m.err = flags, nil
+	return nil
+}
+
+// fetch downloads and parses the provider's flags
+func (m *Manager) fetch(url string) (map[string]Flag, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token := os.Getenv(TokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var tree map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
+		return nil, fmt.Errorf("failed to decode flags: %w", err)
+	}
+	values := make(map[string]interface{})
+	flatten(values, "", tree)
+	return flagsFrom(values, "")
+}
+
+// flatten joins the keys of nested objects with dots, as configurations
+// are flattened
+func flatten(flat map[string]interface{}, prefix string, tree map[string]interface{}) {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if child, ok := value.(map[string]interface{}); ok && len(child) > 0 {
+			flatten(flat, key, child)
+			continue
+		}
+		flat[key] = value
+	}
+}
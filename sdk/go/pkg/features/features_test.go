@@ -0,0 +1,164 @@
+package features
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{
+		"features.provider":             "https://flags.internal/flags.json",
+		"features.refresh":              "30s",
+		"features.dark_mode":            false,
+		"features.new_ui.rollout":       "25%",
+		"features.new_ui.users":         []interface{}{"alice"},
+		"features.new_ui.match.country": []interface{}{"DE", "FR"},
+		"server.port":                   8080,
+	})
+	if err != nil {
+		t.Fatalf("OptionsFrom() returned error: %v", err)
+	}
+	want := Options{
+		Provider: "https://flags.internal/flags.json",
+		Refresh:  30 * time.Second,
+		Flags: map[string]Flag{
+			"dark_mode": {Enabled: false, Rollout: 100},
+			"new_ui": {Enabled: true, Rollout: 25, Users: []string{"alice"},
+				Match: map[string][]string{"country": {"DE", "FR"}}},
+		},
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("OptionsFrom() = %+v, want %+v", opts, want)
+	}
+
+	for _, values := range []map[string]interface{}{
+		{"features.new_ui.rollout": 150},
+		{"features.new_ui": "yes"},
+		{"features.new_ui.owner": "team"},
+		{"features.refresh": "soon"},
+	} {
+		if _, err := OptionsFrom(values); err == nil {
+			t.Errorf("OptionsFrom(%v) should fail", values)
+		}
+	}
+}
+
+func TestFlagAllows(t *testing.T) {
+	flag := Flag{Enabled: true, Rollout: 0, Users: []string{"alice", "mallory"}, Exclude: []string{"mallory"}}
+	for _, tc := range []struct {
+		user User
+		want bool
+	}{
+		{User{"id": "alice"}, true},
+		{User{"id": "mallory"}, false},
+		{User{"id": "bob"}, false},
+		{nil, false},
+	} {
+		if got := flag.Allows("beta", tc.user); got != tc.want {
+			t.Errorf("Allows(%v) = %v, want %v", tc.user, got, tc.want)
+		}
+	}
+
+	regional := Flag{Enabled: true, Rollout: 100, Match: map[string][]string{"country": {"DE"}}}
+	if !regional.Allows("eu", User{"id": "u1", "country": "DE"}) || regional.Allows("eu", User{"id": "u1", "country": "US"}) {
+		t.Error("Match should restrict the flag to the listed countries")
+	}
+	if (Flag{Enabled: false, Rollout: 100, Users: []string{"alice"}}).Allows("off", User{"id": "alice"}) {
+		t.Error("A disabled flag should be off for listed users too")
+	}
+
+	// Rollouts are stable per user and close to their percentage
+	half := Flag{Enabled: true, Rollout: 50}
+	on := 0
+	for i := 0; i < 2000; i++ {
+		user := User{"id": fmt.Sprintf("user-%d", i)}
+		if half.Allows("half", user) != half.Allows("half", user) {
+			t.Fatalf("%v flipped between evaluations", user)
+		}
+		if half.Allows("half", user) {
+			on++
+		}
+	}
+	if on < 900 || on > 1100 {
+		t.Errorf("a 50%% rollout reached %d of 2000 users", on)
+	}
+}
+
+func TestManager(t *testing.T) {
+	requests := 0
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		auth = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"new_ui": {"enabled": true, "users": ["bob"], "rollout": 0}, "remote_only": true}`)
+	}))
+	defer server.Close()
+	t.Setenv(TokenEnv, "flag-token")
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := NewManager()
+	m.now = func() time.Time { return now }
+	m.Configure(Options{
+		Provider: server.URL,
+		Refresh:  time.Minute,
+		Flags: map[string]Flag{
+			"new_ui":    {Enabled: false, Rollout: 100},
+			"dark_mode": {Enabled: true, Rollout: 100},
+		},
+	})
+
+	for _, tc := range []struct {
+		args []interface{}
+		want bool
+	}{
+		{[]interface{}{"new_ui", "bob"}, true},
+		{[]interface{}{"new_ui", `{"id": "carol"}`}, false},
+		{[]interface{}{"remote_only"}, true},
+		{[]interface{}{"dark_mode"}, true},
+		{[]interface{}{"unknown"}, false},
+	} {
+		got, err := m.Evaluate(tc.args...)
+		if err != nil || got != tc.want {
+			t.Errorf("Evaluate(%v) = %v, %v; want %v", tc.args, got, err, tc.want)
+		}
+	}
+	if requests != 1 || auth != "Bearer flag-token" {
+		t.Errorf("provider got %d request(s) with Authorization %q", requests, auth)
+	}
+	now = now.Add(2 * time.Minute)
+	m.Evaluate("new_ui")
+	if requests != 2 {
+		t.Errorf("the provider should be polled again after refresh, got %d request(s)", requests)
+	}
+
+	// Runtime overrides win over the provider and the configuration
+	path := OverridesPath(t.TempDir())
+	m.SetOverridesFile(path)
+	off := false
+	if err := SetOverride(path, "dark_mode", &off); err != nil {
+		t.Fatalf("SetOverride() returned error: %v", err)
+	}
+	if got, _ := m.Evaluate("dark_mode"); got != false {
+		t.Error("dark_mode should be disabled by its override")
+	}
+	if err := SetOverride(path, "dark_mode", nil); err != nil {
+		t.Fatalf("SetOverride(nil) returned error: %v", err)
+	}
+	now = now.Add(overrideCheckInterval)
+	// Let the modification time move on coarse filesystems
+	m.overridesMod = time.Time{}
+	if got, _ := m.Evaluate("dark_mode"); got != true {
+		t.Error("dark_mode should follow its configuration after reset")
+	}
+	if overrides, err := LoadOverrides(path); err != nil || len(overrides) != 0 {
+		t.Errorf("LoadOverrides() = %v, %v", overrides, err)
+	}
+	if filepath.Base(filepath.Dir(path)) != ".tsk" {
+		t.Errorf("OverridesPath() = %s", path)
+	}
+}
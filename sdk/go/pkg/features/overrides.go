@@ -0,0 +1,73 @@
+package features
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// OverridesFile is where `tsk feature enable` and `disable` record runtime
+// overrides, relative to the configuration's directory
+var OverridesFile = filepath.Join(".tsk", "features.json")
+
+// OverridesPath returns the overrides file of the configuration in dir
+func OverridesPath(dir string) string {
+	return filepath.Join(dir, OverridesFile)
+}
+
+// LoadOverrides reads the flags forced on or off in path. A missing file
+// has none.
+func LoadOverrides(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read overrides: %w", err)
+	}
+	overrides := make(map[string]bool)
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return overrides, nil
+}
+
+// SetOverride forces name on or off in path, or clears its override when
+// enabled is nil. The file is replaced atomically so running managers
+// never read half of it.
+func SetOverride(path, name string, enabled *bool) error {
+	overrides, err := LoadOverrides(path)
+	if err != nil {
+		return err
+	}
+	if enabled == nil {
+		delete(overrides, name)
+	} else {
+		overrides[name] = *enabled
+	}
+
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode overrides: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".features-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write overrides: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write overrides: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write overrides: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write overrides: %w", err)
+	}
+	return nil
+}
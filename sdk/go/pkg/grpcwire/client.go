@@ -0,0 +1,302 @@
+// Package grpcwire makes unary gRPC calls with JSON bodies, without
+// generated code. Method types come from a descriptor set file, written by
+// protoc --descriptor_set_out --include_imports, or from the server's
+// reflection service. It backs the @grpc operator.
+package grpcwire
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// maxMessage caps the size of a response message
+const maxMessage = 16 << 20
+
+// Options configures a Client
+type Options struct {
+	// Address is the server's host:port
+	Address string
+	// TLS connects with TLS; otherwise HTTP/2 runs in cleartext (h2c)
+	TLS bool
+	// Descriptors is a FileDescriptorSet file; empty uses server reflection
+	Descriptors string
+	// Metadata is sent with every call
+	Metadata map[string]string
+	Timeout  time.Duration
+}
+
+// Status is a non-OK gRPC status
+type Status struct {
+	Code    int
+	Message string
+}
+
+// statusNames are the names of the gRPC status codes
+var statusNames = []string{
+	"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded", "NotFound", "AlreadyExists",
+	"PermissionDenied", "ResourceExhausted", "FailedPrecondition", "Aborted", "OutOfRange",
+	"Unimplemented", "Internal", "Unavailable", "DataLoss", "Unauthenticated",
+}
+
+// Unimplemented is the status of an unknown service or method
+const Unimplemented = 12
+
+func (s *Status) Error() string {
+	name := strconv.Itoa(s.Code)
+	if s.Code >= 0 && s.Code < len(statusNames) {
+		name = statusNames[s.Code]
+	}
+	if s.Message == "" {
+		return "grpc status " + name
+	}
+	return fmt.Sprintf("grpc status %s: %s", name, s.Message)
+}
+
+// Client calls the methods of one server
+type Client struct {
+	opts      Options
+	transport *http2.Transport
+
+	mu    sync.Mutex
+	files *protoregistry.Files
+}
+
+// NewClient creates a Client; connections are made on the first call
+func NewClient(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	t := &http2.Transport{}
+	if opts.TLS {
+		host, _, _ := net.SplitHostPort(opts.Address)
+		t.TLSClientConfig = &tls.Config{ServerName: host}
+	} else {
+		t.AllowHTTP = true
+		t.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	return &Client{opts: opts, transport: t}
+}
+
+// Close closes idle connections
+func (c *Client) Close() {
+	c.transport.CloseIdleConnections()
+}
+
+// Invoke calls method, "package.Service/Method", with a JSON request body
+// and returns the response as JSON. metadata is sent after the client's.
+func (c *Client) Invoke(ctx context.Context, method string, body []byte, metadata map[string]string) ([]byte, error) {
+	service, name, err := splitMethod(method)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	files, err := c.descriptors(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	md, err := findMethod(files, service, name)
+	if err != nil {
+		return nil, err
+	}
+
+	request := dynamicpb.NewMessage(md.Input())
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := (protojson.UnmarshalOptions{Resolver: dynamicpb.NewTypes(files)}).Unmarshal(body, request); err != nil {
+			return nil, fmt.Errorf("invalid %s request: %w", md.Input().FullName(), err)
+		}
+	}
+	payload, err := proto.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(c.opts.Metadata)+len(metadata))
+	for key, value := range c.opts.Metadata {
+		headers[key] = value
+	}
+	for key, value := range metadata {
+		headers[key] = value
+	}
+	reply, err := c.call(ctx, "/"+service+"/"+name, payload, headers)
+	if err != nil {
+		return nil, err
+	}
+	response := dynamicpb.NewMessage(md.Output())
+	if err := proto.Unmarshal(reply, response); err != nil {
+		return nil, fmt.Errorf("invalid %s response: %w", md.Output().FullName(), err)
+	}
+	return protojson.MarshalOptions{Resolver: dynamicpb.NewTypes(files)}.Marshal(response)
+}
+
+// splitMethod reads "package.Service/Method" or "package.Service.Method"
+func splitMethod(method string) (string, string, error) {
+	method = strings.TrimPrefix(method, "/")
+	i := strings.LastIndexAny(method, "/.")
+	if i <= 0 || i == len(method)-1 {
+		return "", "", fmt.Errorf("invalid method %q: expected package.Service/Method", method)
+	}
+	return method[:i], method[i+1:], nil
+}
+
+func findMethod(files *protoregistry.Files, service, name string) (protoreflect.MethodDescriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("unknown service %s", service)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", service, name)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("%s/%s is a streaming method; only unary calls are supported", service, name)
+	}
+	return md, nil
+}
+
+// descriptors returns the descriptors holding service: the descriptor set,
+// or what reflection returned, cached for later calls
+func (c *Client) descriptors(ctx context.Context, service string) (*protoregistry.Files, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files != nil {
+		if _, err := c.files.FindDescriptorByName(protoreflect.FullName(service)); err == nil || c.opts.Descriptors != "" {
+			return c.files, nil
+		}
+	}
+
+	var set *descriptorpb.FileDescriptorSet
+	var err error
+	if c.opts.Descriptors != "" {
+		set, err = LoadDescriptorSet(c.opts.Descriptors)
+	} else {
+		set, err = c.reflect(ctx, service)
+	}
+	if err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptors: %w", err)
+	}
+	c.files = files
+	return files, nil
+}
+
+// LoadDescriptorSet reads a FileDescriptorSet file
+func LoadDescriptorSet(path string) (*descriptorpb.FileDescriptorSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set %s: %w", path, err)
+	}
+	return set, nil
+}
+
+// call sends one request message and returns the response message
+func (c *Client) call(ctx context.Context, path string, payload []byte, metadata map[string]string) ([]byte, error) {
+	scheme := "http"
+	if c.opts.TLS {
+		scheme = "https"
+	}
+	frame := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	frame = append(frame, payload...)
+
+	u := &url.URL{Scheme: scheme, Host: c.opts.Address, Path: path}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range metadata {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", strconv.FormatInt(time.Until(deadline).Milliseconds()+1, 10)+"m")
+	}
+
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s%s: %w", c.opts.Address, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to call %s%s: HTTP %s", c.opts.Address, path, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessage+5))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s%s: %w", c.opts.Address, path, err)
+	}
+	if err := status(resp); err != nil {
+		return nil, err
+	}
+	if len(body) < 5 {
+		return nil, fmt.Errorf("%s%s returned no message", c.opts.Address, path)
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("%s%s returned a compressed message", c.opts.Address, path)
+	}
+	size := binary.BigEndian.Uint32(body[1:5])
+	if int(size) > len(body)-5 {
+		return nil, fmt.Errorf("%s%s returned a truncated message", c.opts.Address, path)
+	}
+	return body[5 : 5+size], nil
+}
+
+// status reads grpc-status from the trailers, or from the headers of a
+// trailers-only response
+func status(resp *http.Response) error {
+	code := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if code == "" {
+		code, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if code == "" {
+		return fmt.Errorf("response has no grpc-status")
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil {
+		return fmt.Errorf("invalid grpc-status %q", code)
+	}
+	if n == 0 {
+		return nil
+	}
+	if decoded, err := url.PathUnescape(message); err == nil {
+		message = decoded
+	}
+	return &Status{Code: n, Message: message}
+}
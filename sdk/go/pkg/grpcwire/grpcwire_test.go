@@ -0,0 +1,183 @@
+package grpcwire
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// configFile describes test.v1.ConfigService
+func configFile() *descriptorpb.FileDescriptorProto {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		return &descriptorpb.FieldDescriptorProto{Name: proto.String(name), JsonName: proto.String(name),
+			Number: proto.Int32(number), Type: typ.Enum(), Label: label.Enum()}
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/v1/config.proto"),
+		Package: proto.String("test.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("GetRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false),
+			}},
+			{Name: proto.String("GetResponse"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("value", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false),
+				field("version", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, false),
+				field("tags", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, true),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("ConfigService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Get"), InputType: proto.String(".test.v1.GetRequest"), OutputType: proto.String(".test.v1.GetResponse")},
+				{Name: proto.String("Watch"), InputType: proto.String(".test.v1.GetRequest"), OutputType: proto.String(".test.v1.GetResponse"),
+					ServerStreaming: proto.Bool(true)},
+			},
+		}},
+	}
+}
+
+// startServer serves ConfigService.Get and v1alpha reflection over h2c
+func startServer(t *testing.T) *httptest.Server {
+	fd, err := protodesc.NewFile(configFile(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := fd.Messages()
+	fileBytes, _ := proto.Marshal(configFile())
+
+	reply := func(w http.ResponseWriter, message []byte, code, text string) {
+		w.Header().Set("Content-Type", "application/grpc")
+		if message != nil {
+			frame := make([]byte, 5, 5+len(message))
+			binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+			w.Write(append(frame, message...))
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", code)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", text)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if len(body) < 5 || r.Header.Get("Te") != "trailers" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body = body[5:]
+		switch r.URL.Path {
+		case "/test.v1.ConfigService/Get":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				reply(w, nil, "16", "missing token")
+				return
+			}
+			request := dynamicpb.NewMessage(messages.ByName("GetRequest"))
+			proto.Unmarshal(body, request)
+			key := request.Get(messages.ByName("GetRequest").Fields().ByName("key")).String()
+			if key == "missing" {
+				reply(w, nil, "5", "no key "+key)
+				return
+			}
+			response := dynamicpb.NewMessage(messages.ByName("GetResponse"))
+			fields := messages.ByName("GetResponse").Fields()
+			response.Set(fields.ByName("value"), protoreflect.ValueOfString("v-"+key))
+			response.Set(fields.ByName("version"), protoreflect.ValueOfInt32(3))
+			out, _ := proto.Marshal(response)
+			reply(w, out, "0", "")
+		case "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo":
+			_, _, n := protowire.ConsumeTag(body)
+			symbol, _ := protowire.ConsumeString(body[n:])
+			var out []byte
+			if symbol == "test.v1.ConfigService" {
+				files := protowire.AppendTag(nil, 1, protowire.BytesType)
+				files = protowire.AppendBytes(files, fileBytes)
+				out = protowire.AppendTag(out, responseFileDescriptor, protowire.BytesType)
+				out = protowire.AppendBytes(out, files)
+			} else {
+				e := protowire.AppendTag(nil, 1, protowire.VarintType)
+				e = protowire.AppendVarint(e, 5)
+				e = protowire.AppendTag(e, 2, protowire.BytesType)
+				e = protowire.AppendString(e, "symbol not found")
+				out = protowire.AppendTag(out, responseError, protowire.BytesType)
+				out = protowire.AppendBytes(out, e)
+			}
+			reply(w, out, "0", "")
+		default:
+			// Only the older reflection version is served
+			reply(w, nil, "12", "unknown service")
+		}
+	})
+	server := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestInvoke(t *testing.T) {
+	server := startServer(t)
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	set, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{configFile()}})
+	descriptors := filepath.Join(t.TempDir(), "config.pb")
+	if err := os.WriteFile(descriptors, set, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, opts := range map[string]Options{
+		"reflection":  {Address: address, Metadata: map[string]string{"Authorization": "Bearer token"}},
+		"descriptors": {Address: address, Descriptors: descriptors, Metadata: map[string]string{"Authorization": "Bearer token"}},
+	} {
+		c := NewClient(opts)
+		defer c.Close()
+		out, err := c.Invoke(context.Background(), "test.v1.ConfigService/Get", []byte(`{"key": "db"}`), nil)
+		if err != nil {
+			t.Fatalf("%s: Invoke() returned error: %v", name, err)
+		}
+		var got map[string]interface{}
+		json.Unmarshal(out, &got)
+		if want := map[string]interface{}{"value": "v-db", "version": float64(3)}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Invoke() = %s", name, out)
+		}
+	}
+
+	c := NewClient(Options{Address: address})
+	defer c.Close()
+	var status *Status
+	_, err := c.Invoke(context.Background(), "/test.v1.ConfigService.Get", []byte(`{"key": "missing"}`), map[string]string{"Authorization": "Bearer token"})
+	if !errors.As(err, &status) || status.Code != 5 || status.Message != "no key missing" {
+		t.Errorf("Expected a NotFound status, got %v", err)
+	}
+	if _, err := c.Invoke(context.Background(), "test.v1.ConfigService/Get", []byte(`{"key": "db"}`), nil); !errors.As(err, &status) || status.Code != 16 {
+		t.Errorf("Expected an Unauthenticated status without metadata, got %v", err)
+	}
+	for method, body := range map[string]string{
+		"test.v1.ConfigService/Watch":  `{}`,
+		"test.v1.ConfigService/Delete": `{}`,
+		"test.v1.ConfigService/Get":    `{"name": "db"}`,
+		"test.v1.Missing/Get":          `{}`,
+		"Get":                          `{}`,
+	} {
+		if _, err := c.Invoke(context.Background(), method, []byte(body), nil); err == nil {
+			t.Errorf("Invoke(%s, %s) should fail", method, body)
+		}
+	}
+}
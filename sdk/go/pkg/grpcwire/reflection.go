@@ -0,0 +1,182 @@
+package grpcwire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// reflectionServices are the reflection service versions, newest first
+var reflectionServices = []string{
+	"grpc.reflection.v1.ServerReflection",
+	"grpc.reflection.v1alpha.ServerReflection",
+}
+
+// Fields of the reflection messages, which are the same in v1 and v1alpha
+const (
+	requestFileByFilename        = 3
+	requestFileContainingSymbol  = 4
+	responseFileDescriptor       = 4
+	responseError                = 7
+	fileDescriptorResponseProtos = 1
+	errorResponseCode            = 1
+	errorResponseMessage         = 2
+)
+
+// reflect fetches the file defining symbol and its dependencies from the
+// server's reflection service
+func (c *Client) reflect(ctx context.Context, symbol string) (*descriptorpb.FileDescriptorSet, error) {
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	var order []string
+	add := func(protos []*descriptorpb.FileDescriptorProto) {
+		for _, fd := range protos {
+			if _, ok := files[fd.GetName()]; !ok {
+				files[fd.GetName()] = fd
+				order = append(order, fd.GetName())
+			}
+		}
+	}
+
+	protos, err := c.reflectionRequest(ctx, requestFileContainingSymbol, symbol)
+	if err != nil {
+		return nil, err
+	}
+	add(protos)
+	// Servers usually send every dependency along; fetch any they left out
+	for i := 0; i < len(order); i++ {
+		for _, dep := range files[order[i]].GetDependency() {
+			if _, ok := files[dep]; ok {
+				continue
+			}
+			if known, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				add([]*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(known)})
+				continue
+			}
+			protos, err := c.reflectionRequest(ctx, requestFileByFilename, dep)
+			if err != nil {
+				return nil, err
+			}
+			add(protos)
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, name := range order {
+		set.File = append(set.File, files[name])
+	}
+	return set, nil
+}
+
+// reflectionRequest sends one ServerReflectionRequest and decodes the file
+// descriptors of its response
+func (c *Client) reflectionRequest(ctx context.Context, field protowire.Number, value string) ([]*descriptorpb.FileDescriptorProto, error) {
+	request := protowire.AppendTag(nil, field, protowire.BytesType)
+	request = protowire.AppendString(request, value)
+
+	var reply []byte
+	var err error
+	for _, service := range reflectionServices {
+		reply, err = c.call(ctx, "/"+service+"/ServerReflectionInfo", request, c.opts.Metadata)
+		var status *Status
+		if !errors.As(err, &status) || status.Code != Unimplemented {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("server reflection failed (set a descriptor set instead): %w", err)
+	}
+
+	var protos []*descriptorpb.FileDescriptorProto
+	err = eachField(reply, func(num protowire.Number, data []byte) error {
+		switch num {
+		case responseFileDescriptor:
+			return eachField(data, func(num protowire.Number, data []byte) error {
+				if num != fileDescriptorResponseProtos {
+					return nil
+				}
+				fd := &descriptorpb.FileDescriptorProto{}
+				if err := proto.Unmarshal(data, fd); err != nil {
+					return fmt.Errorf("invalid file descriptor: %w", err)
+				}
+				protos = append(protos, fd)
+				return nil
+			})
+		case responseError:
+			status := &Status{}
+			eachField(data, func(num protowire.Number, data []byte) error {
+				if num == errorResponseMessage {
+					status.Message = string(data)
+				}
+				return nil
+			})
+			if code, n := fieldVarint(data, errorResponseCode); n {
+				status.Code = int(code)
+			}
+			return fmt.Errorf("reflection of %s: %w", value, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(protos) == 0 {
+		return nil, fmt.Errorf("reflection returned no descriptors for %s", value)
+	}
+	return protos, nil
+}
+
+// eachField calls fn with the number and contents of every length-delimited
+// field of a message
+func eachField(message []byte, fn func(protowire.Number, []byte) error) error {
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, message)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			message = message[n:]
+			continue
+		}
+		data, n := protowire.ConsumeBytes(message)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+		if err := fn(num, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldVarint returns the varint field num of a message
+func fieldVarint(message []byte, num protowire.Number) (uint64, bool) {
+	for len(message) > 0 {
+		field, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return 0, false
+		}
+		message = message[n:]
+		if field == num && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(message)
+			return v, n >= 0
+		}
+		n = protowire.ConsumeFieldValue(field, typ, message)
+		if n < 0 {
+			return 0, false
+		}
+		message = message[n:]
+	}
+	return 0, false
+}
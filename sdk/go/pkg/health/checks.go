@@ -0,0 +1,161 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/internal/dbprobe"
+	"github.com/cyber-boost/tusktsk/license"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/rediswire"
+)
+
+// LicenseEnv holds the license key when the configuration has no
+// license.key
+const LicenseEnv = license.KeyEnv
+
+// ForHierarchy creates the checker of a server started in dir, as its
+// [observability.health] section configures: "config" checks that the
+// hierarchy still loads, "database.<adapter>" pings each database with a
+// dsn or url, "cache" reaches a Redis or tiered @cache store and "license"
+// validates license.key or $TSK_LICENSE_KEY. The checks that do not apply
+// are left out. It returns nil when the probes are disabled.
+func ForHierarchy(dir string) (*Checker, error) {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if errors.Is(err, peanut.ErrNotFound) {
+		c := NewChecker(DefaultOptions())
+		return c, c.addLicense(os.Getenv(LicenseEnv))
+	}
+	if err != nil {
+		return nil, err
+	}
+	values, err := cfg.Execute(peanut.NewVM())
+	if err != nil {
+		return nil, err
+	}
+	opts, err := OptionsFrom(values)
+	if err != nil || !opts.Enabled {
+		return nil, err
+	}
+
+	c := NewChecker(opts)
+	if err := c.Add(ConfigCheck(dir)); err != nil {
+		return nil, err
+	}
+	for _, adapter := range dbprobe.Adapters {
+		for _, field := range []string{"dsn", "url"} {
+			if dsn, ok := values["database."+adapter+"."+field]; ok {
+				if err := c.Add(DatabaseCheck("database."+adapter, fmt.Sprint(dsn))); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+	if backend, _ := values["cache.backend"].(string); backend != "" && backend != "memory" {
+		err := c.Add(Check{Name: "cache", Run: func(ctx context.Context) error {
+			_, _, err := cfg.CacheStatus()
+			return err
+		}})
+		if err != nil {
+			return nil, err
+		}
+	}
+	key, _ := values["license.key"].(string)
+	if key == "" {
+		key = os.Getenv(LicenseEnv)
+	}
+	return c, c.addLicense(key)
+}
+
+func (c *Checker) addLicense(key string) error {
+	if key == "" {
+		return nil
+	}
+	return c.Add(LicenseCheck(license.New(key, "")))
+}
+
+// ConfigCheck reports whether the hierarchy of dir loads. It is live:
+// it parses the files again only once HierarchyStamp reports them changed.
+func ConfigCheck(dir string) Check {
+	var (
+		mu      sync.Mutex
+		stamp   string
+		lastErr error
+	)
+	return Check{Name: "config", Live: true, Run: func(ctx context.Context) error {
+		current, err := peanut.HierarchyStamp(dir)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if current != stamp || stamp == "" {
+			h, err := peanut.ResolveHierarchy(dir)
+			if err == nil {
+				h.Config.Close()
+			}
+			stamp, lastErr = current, err
+		}
+		return lastErr
+	}}
+}
+
+// DatabaseCheck pings the database of dsn: it checks the file of a SQLite
+// database, sends PING to Redis and connects to other servers
+func DatabaseCheck(name, dsn string) Check {
+	return Check{Name: name, Run: func(ctx context.Context) error {
+		return pingDatabase(ctx, dsn)
+	}}
+}
+
+func pingDatabase(ctx context.Context, dsn string) error {
+	target, err := dbprobe.Parse(dsn)
+	if err != nil {
+		return err
+	}
+	if target.SQLite != "" {
+		if _, err := os.Stat(target.SQLite); err != nil {
+			return fmt.Errorf("SQLite database %s: %w", target.SQLite, err)
+		}
+		return nil
+	}
+	if !target.Redis() {
+		return target.Dial(ctx)
+	}
+	opts, err := rediswire.ParseURL(dsn)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) > 0 {
+		opts.Timeout = time.Until(deadline)
+	}
+	opts.MaxOpen, opts.MaxIdle = 1, 1
+	client, err := rediswire.Dial(opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", target.URL.Redacted(), err)
+	}
+	return client.Close()
+}
+
+// LicenseCheck validates the key of l and that it has not expired
+func LicenseCheck(l *license.TuskLicense) Check {
+	return Check{Name: "license", Run: func(ctx context.Context) error {
+		if v := l.ValidateLicenseKey(); !v.Valid {
+			return errors.New(strings.ToLower(v.Error))
+		}
+		expiration := l.CheckLicenseExpiration()
+		switch {
+		case expiration.Error != "":
+			return errors.New(strings.ToLower(expiration.Error))
+		case expiration.Expired:
+			return fmt.Errorf("license expired on %s", expiration.ExpirationDate)
+		}
+		return nil
+	}}
+}
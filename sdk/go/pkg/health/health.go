@@ -0,0 +1,307 @@
+// Package health answers the liveness and readiness probes of the
+// long-running tsk processes, as Kubernetes sends them: /healthz and
+// /readyz run their checks concurrently, each within its own timeout, and
+// answer 200 or 503 with the outcome of every check as JSON. It is
+// configured by the [observability.health] section:
+//
+//	[observability.health]
+//	timeout: "2s"                        # for each check
+//	timeouts {
+//	    database.postgresql: "5s"
+//	}
+//	exclude: ["license"]
+//
+// Probes are served unless enabled is false. /readyz runs every check;
+// /healthz only those that restarting the process could fix, such as the
+// configuration failing to load. Either leaves out the checks named by
+// ?exclude=name.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Paths the probes are served on
+const (
+	LivePath  = "/healthz"
+	ReadyPath = "/readyz"
+)
+
+// Statuses of a check and of a report
+const (
+	OK   = "ok"
+	Fail = "fail"
+)
+
+// Options is the [observability.health] section of a configuration
+type Options struct {
+	Enabled bool
+	// Timeout bounds each check that Timeouts does not name
+	Timeout time.Duration
+	// Timeouts bounds the checks it names
+	Timeouts map[string]time.Duration
+	// Exclude names the checks never run
+	Exclude []string
+}
+
+// DefaultOptions serves the probes, giving each check 2 seconds
+func DefaultOptions() Options {
+	return Options{Enabled: true, Timeout: 2 * time.Second}
+}
+
+// OptionsFrom reads Options from the flat observability.health.* keys of
+// an evaluated configuration
+func OptionsFrom(values map[string]interface{}) (Options, error) {
+	opts := DefaultOptions()
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "observability.health.")
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		var err error
+		switch setting {
+		case "enabled":
+			opts.Enabled, err = strconv.ParseBool(text)
+		case "timeout":
+			opts.Timeout, err = parseTimeout(text)
+		case "exclude":
+			list, isList := value.([]interface{})
+			if !isList {
+				err = errors.New("must be a list of check names")
+			}
+			for _, name := range list {
+				opts.Exclude = append(opts.Exclude, fmt.Sprint(name))
+			}
+		default:
+			check, ok := strings.CutPrefix(setting, "timeouts.")
+			if !ok {
+				return opts, fmt.Errorf("unknown setting observability.health.%s", setting)
+			}
+			if opts.Timeouts == nil {
+				opts.Timeouts = make(map[string]time.Duration)
+			}
+			opts.Timeouts[check], err = parseTimeout(text)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("observability.health.%s: invalid value %q: %w", setting, text, err)
+		}
+	}
+	return opts, nil
+}
+
+func parseTimeout(text string) (time.Duration, error) {
+	d, err := time.ParseDuration(text)
+	if err == nil && d <= 0 {
+		err = errors.New("must be positive")
+	}
+	return d, err
+}
+
+// Check is one dependency a probe verifies
+type Check struct {
+	Name string
+	// Live makes the check part of /healthz as well as /readyz
+	Live bool
+	// Timeout bounds the check; zero uses the checker's
+	Timeout time.Duration
+	// Run returns why the dependency is unavailable, or nil. It should give
+	// up once ctx is done; its result is ignored after that.
+	Run func(ctx context.Context) error
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_ms"`
+}
+
+// Report is the answer to a probe
+type Report struct {
+	Status string    `json:"status"`
+	Checks []Result  `json:"checks"`
+	Time   time.Time `json:"time"`
+}
+
+// Healthy reports whether every check passed
+func (r *Report) Healthy() bool {
+	return r.Status == OK
+}
+
+// Checker runs the checks of the probes
+type Checker struct {
+	opts Options
+
+	mu     sync.RWMutex
+	checks []Check
+}
+
+// NewChecker creates a checker without checks, bounding them as opts sets
+func NewChecker(opts Options) *Checker {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultOptions().Timeout
+	}
+	return &Checker{opts: opts}
+}
+
+// Add registers a check, unless opts excludes it. A name that is already
+// registered is refused.
+func (c *Checker) Add(check Check) error {
+	if check.Name == "" || check.Run == nil {
+		return fmt.Errorf("check %q needs a name and a function", check.Name)
+	}
+	for _, name := range c.opts.Exclude {
+		if name == check.Name {
+			return nil
+		}
+	}
+	if timeout, ok := c.opts.Timeouts[check.Name]; ok {
+		check.Timeout = timeout
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = c.opts.Timeout
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, existing := range c.checks {
+		if existing.Name == check.Name {
+			return fmt.Errorf("check %s is already registered", check.Name)
+		}
+	}
+	c.checks = append(c.checks, check)
+	return nil
+}
+
+// Checks returns the names of the registered checks, in the order they
+// are reported
+func (c *Checker) Checks() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, len(c.checks))
+	for i, check := range c.checks {
+		names[i] = check.Name
+	}
+	return names
+}
+
+// Run runs the checks concurrently, only the Live ones when live is set,
+// leaving out those named in exclude
+func (c *Checker) Run(ctx context.Context, live bool, exclude ...string) *Report {
+	c.mu.RLock()
+	var checks []Check
+	for _, check := range c.checks {
+		if (!live || check.Live) && !contains(exclude, check.Name) {
+			checks = append(checks, check)
+		}
+	}
+	c.mu.RUnlock()
+
+	report := &Report{Status: OK, Checks: make([]Result, len(checks)), Time: time.Now()}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = run(ctx, check)
+		}()
+	}
+	wg.Wait()
+	for _, result := range report.Checks {
+		if result.Status != OK {
+			report.Status = Fail
+		}
+	}
+	return report
+}
+
+// run runs one check within its timeout
+func run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("check panicked: %v", p)
+			}
+		}()
+		done <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", check.Timeout)
+	}
+	result := Result{Name: check.Name, Status: OK, Duration: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status, result.Error = Fail, err.Error()
+	}
+	return result
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler answers the probes: 200 when every check passed, 503 otherwise,
+// with the Report as JSON either way
+func Handler(c *Checker) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			rw.Header().Set("Allow", "GET, HEAD")
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var exclude []string
+		for _, names := range r.URL.Query()["exclude"] {
+			exclude = append(exclude, strings.Split(names, ",")...)
+		}
+		report := c.Run(r.Context(), r.URL.Path == LivePath, exclude...)
+		status := http.StatusOK
+		if !report.Healthy() {
+			status = http.StatusServiceUnavailable
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Cache-Control", "no-store")
+		rw.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			encoder := json.NewEncoder(rw)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(report)
+		}
+	})
+}
+
+// Mount serves the probes of c on LivePath and ReadyPath in front of next,
+// which serves every other path. A nil checker returns next.
+func Mount(next http.Handler, c *Checker) http.Handler {
+	if c == nil {
+		return next
+	}
+	probes := Handler(c)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == LivePath || r.URL.Path == ReadyPath {
+			probes.ServeHTTP(rw, r)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
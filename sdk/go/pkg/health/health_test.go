@@ -0,0 +1,185 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{
+		"observability.health.timeout":                      "500ms",
+		"observability.health.timeouts.database.postgresql": "5s",
+		"observability.health.exclude":                      []interface{}{"license"},
+		"server.port":                                       8080,
+	})
+	if err != nil {
+		t.Fatalf("OptionsFrom() returned error: %v", err)
+	}
+	if !opts.Enabled || opts.Timeout != 500*time.Millisecond || opts.Timeouts["database.postgresql"] != 5*time.Second || len(opts.Exclude) != 1 || opts.Exclude[0] != "license" {
+		t.Errorf("OptionsFrom() = %+v", opts)
+	}
+	for key, value := range map[string]interface{}{"enabled": "maybe", "timeout": "0s", "timeouts.cache": "soon", "exclude": "license", "port": 8080} {
+		if _, err := OptionsFrom(map[string]interface{}{"observability.health." + key: value}); err == nil {
+			t.Errorf("OptionsFrom() accepted %s: %v", key, value)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	c := NewChecker(Options{Timeout: 50 * time.Millisecond, Timeouts: map[string]time.Duration{"slow": 20 * time.Millisecond}, Exclude: []string{"license"}})
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	for _, check := range []Check{
+		{Name: "config", Live: true, Run: func(context.Context) error { return nil }},
+		{Name: "slow", Run: block},
+		{Name: "stuck", Run: func(context.Context) error { select {} }},
+		{Name: "broken", Run: func(context.Context) error { return errors.New("connection refused") }},
+		{Name: "license", Run: func(context.Context) error { return errors.New("expired") }},
+	} {
+		if err := c.Add(check); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Add(Check{Name: "config", Run: block}); err == nil {
+		t.Error("Add() accepted a second config check")
+	}
+
+	start := time.Now()
+	report := c.Run(context.Background(), false)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Run() took %s, want the checks to run concurrently", elapsed)
+	}
+	if report.Healthy() || len(report.Checks) != 4 {
+		t.Fatalf("Run() = %+v, want 4 checks, failing", report)
+	}
+	want := map[string]string{"config": "", "slow": "timed out after 20ms", "stuck": "timed out after 50ms", "broken": "connection refused"}
+	for _, result := range report.Checks {
+		if result.Error != want[result.Name] || (result.Status == OK) != (want[result.Name] == "") {
+			t.Errorf("%s: %+v, want error %q", result.Name, result, want[result.Name])
+		}
+	}
+
+	if report := c.Run(context.Background(), true); !report.Healthy() || len(report.Checks) != 1 || report.Checks[0].Name != "config" {
+		t.Errorf("live Run() = %+v, want only config", report)
+	}
+	if report := c.Run(context.Background(), false, "slow", "stuck", "broken"); !report.Healthy() {
+		t.Errorf("Run() excluding the failures = %+v", report)
+	}
+}
+
+func TestMount(t *testing.T) {
+	app := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) { rw.Write([]byte("app")) })
+	if Mount(app, nil) == nil {
+		t.Fatal("Mount() returned nil")
+	}
+	c := NewChecker(DefaultOptions())
+	c.Add(Check{Name: "config", Live: true, Run: func(context.Context) error { return nil }})
+	c.Add(Check{Name: "database.redis", Run: func(context.Context) error { return errors.New("connection refused") }})
+	server := httptest.NewServer(Mount(app, c))
+	defer server.Close()
+
+	get := func(path string) (int, Report) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var report Report
+		json.NewDecoder(resp.Body).Decode(&report)
+		return resp.StatusCode, report
+	}
+	if status, report := get("/healthz"); status != http.StatusOK || report.Status != OK || len(report.Checks) != 1 {
+		t.Errorf("/healthz = %d %+v", status, report)
+	}
+	if status, report := get("/readyz"); status != http.StatusServiceUnavailable || report.Status != Fail || report.Checks[1].Error != "connection refused" {
+		t.Errorf("/readyz = %d %+v", status, report)
+	}
+	if status, _ := get("/readyz?exclude=database.redis"); status != http.StatusOK {
+		t.Errorf("/readyz?exclude=database.redis = %d", status)
+	}
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/ = %d, want the app", resp.StatusCode)
+	}
+	resp, err = http.Post(server.URL+"/readyz", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /readyz = %d", resp.StatusCode)
+	}
+}
+
+func TestForHierarchy(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "peanu.tsk")
+	content := `[database.postgresql]
+dsn: "postgresql://app@` + listener.Addr().String() + `/app"
+
+[database.sqlite]
+dsn: "sqlite:` + filepath.Join(dir, "missing.db") + `"
+
+[observability.health]
+timeout: "1s"
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(LicenseEnv, "")
+	c, err := ForHierarchy(dir)
+	if err != nil {
+		t.Fatalf("ForHierarchy() returned error: %v", err)
+	}
+	report := c.Run(context.Background(), false)
+	status := map[string]string{}
+	for _, result := range report.Checks {
+		status[result.Name] = result.Status
+	}
+	if len(status) != 3 || status["config"] != OK || status["database.postgresql"] != OK || status["database.sqlite"] != Fail {
+		t.Errorf("Run() = %+v", report)
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if report := c.Run(context.Background(), true); report.Healthy() {
+		t.Errorf("live Run() = %+v after the file was removed", report)
+	}
+
+	if err := os.WriteFile(file, []byte("[observability.health]\nenabled: false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := ForHierarchy(dir); c != nil || err != nil {
+		t.Errorf("ForHierarchy() = %v, %v with the probes disabled", c, err)
+	}
+}
@@ -0,0 +1,266 @@
+package jobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ArtifactStore stores job outputs by content digest, so identical files
+// produced by many jobs are kept once
+type ArtifactStore interface {
+	Put(r io.Reader) (digest string, size int64, err error)
+	Get(digest string) (io.ReadCloser, error)
+	Delete(digest string) error
+}
+
+// LocalArtifactStore keeps artifacts under Root/sha256/<xx>/<digest>
+type LocalArtifactStore struct {
+	Root string
+}
+
+func (s *LocalArtifactStore) path(digest string) string {
+	return filepath.Join(s.Root, "sha256", digest[:2], digest)
+}
+
+func (s *LocalArtifactStore) Put(r io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(s.Root, 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create artifact store: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.Root, ".upload-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write artifact: %w", err)
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	dest := s.path(digest)
+	if _, err := os.Stat(dest); err == nil {
+		return digest, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", 0, fmt.Errorf("failed to store artifact: %w", err)
+	}
+	return digest, size, nil
+}
+
+func (s *LocalArtifactStore) Get(digest string) (io.ReadCloser, error) {
+	if !validDigest(digest) {
+		return nil, fmt.Errorf("invalid artifact digest %q", digest)
+	}
+	return os.Open(s.path(digest))
+}
+
+func (s *LocalArtifactStore) Delete(digest string) error {
+	if !validDigest(digest) {
+		return fmt.Errorf("invalid artifact digest %q", digest)
+	}
+	if err := os.Remove(s.path(digest)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func validDigest(digest string) bool {
+	if len(digest) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+// SetArtifactStore replaces the store job outputs are uploaded to
+func (hpc *HPCClusterManager) SetArtifactStore(store ArtifactStore) {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+	hpc.artifacts = store
+}
+
+func (hpc *HPCClusterManager) artifactTTLLocked(job *HPCJob) time.Duration {
+	if job.ArtifactTTL > 0 {
+		return job.ArtifactTTL
+	}
+	return hpc.config.ArtifactRetention
+}
+
+// uploadArtifacts stores the files matching a finished job's artifact
+// patterns. It runs without the cluster lock since uploads can be slow.
+func (hpc *HPCClusterManager) uploadArtifacts(jobID, workDir string, patterns []string, ttl time.Duration) {
+	hpc.mutex.RLock()
+	store := hpc.artifacts
+	hpc.mutex.RUnlock()
+
+	var stored []JobArtifact
+	for _, file := range expandArtifactPatterns(jobID, workDir, patterns) {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Printf("Job %s: failed to open artifact %s: %v", jobID, file, err)
+			continue
+		}
+		digest, size, err := store.Put(f)
+		f.Close()
+		if err != nil {
+			log.Printf("Job %s: failed to upload artifact %s: %v", jobID, file, err)
+			continue
+		}
+
+		name, err := filepath.Rel(workDir, file)
+		if err != nil || workDir == "" {
+			name = filepath.Base(file)
+		}
+		artifact := JobArtifact{Name: filepath.ToSlash(name), Digest: digest, Size: size, StoredAt: time.Now()}
+		if ttl > 0 {
+			expires := artifact.StoredAt.Add(ttl)
+			artifact.ExpiresAt = &expires
+		}
+		stored = append(stored, artifact)
+	}
+
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+	if job, ok := hpc.jobs[jobID]; ok {
+		job.StoredArtifacts = append(job.StoredArtifacts, stored...)
+	}
+	log.Printf("Job %s: stored %d artifacts", jobID, len(stored))
+}
+
+// expandArtifactPatterns resolves artifact globs to files; directories are
+// walked recursively
+func expandArtifactPatterns(jobID, workDir string, patterns []string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(workDir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil || len(matches) == 0 {
+			log.Printf("Job %s: artifact %s matched no files", jobID, pattern)
+			continue
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+			filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err == nil && info.Mode().IsRegular() {
+					add(path)
+				}
+				return nil
+			})
+		}
+	}
+	return files
+}
+
+// JobArtifacts returns the stored artifacts of a job
+func (hpc *HPCClusterManager) JobArtifacts(jobID string) ([]JobArtifact, error) {
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+
+	job, ok := hpc.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("job %s not found", jobID)
+	}
+	return append([]JobArtifact(nil), job.StoredArtifacts...), nil
+}
+
+// OpenArtifact opens a stored artifact of a job by name
+func (hpc *HPCClusterManager) OpenArtifact(jobID, name string) (io.ReadCloser, *JobArtifact, error) {
+	hpc.mutex.RLock()
+	store := hpc.artifacts
+	job, ok := hpc.jobs[jobID]
+	var artifact *JobArtifact
+	if ok {
+		for i := range job.StoredArtifacts {
+			if job.StoredArtifacts[i].Name == name {
+				a := job.StoredArtifacts[i]
+				artifact = &a
+				break
+			}
+		}
+	}
+	hpc.mutex.RUnlock()
+
+	if !ok {
+		return nil, nil, fmt.Errorf("job %s not found", jobID)
+	}
+	if artifact == nil || store == nil {
+		return nil, nil, fmt.Errorf("job %s has no artifact %s", jobID, name)
+	}
+
+	rc, err := store.Get(artifact.Digest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open artifact %s: %w", name, err)
+	}
+	return rc, artifact, nil
+}
+
+// pruneArtifacts drops expired artifact records and deletes content no
+// longer referenced by any job
+func (hpc *HPCClusterManager) pruneArtifacts() {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	if hpc.artifacts == nil {
+		return
+	}
+
+	now := time.Now()
+	expired := make(map[string]bool)
+	live := make(map[string]bool)
+	for _, job := range hpc.jobs {
+		kept := job.StoredArtifacts[:0]
+		for _, artifact := range job.StoredArtifacts {
+			if artifact.ExpiresAt != nil && now.After(*artifact.ExpiresAt) {
+				expired[artifact.Digest] = true
+				continue
+			}
+			live[artifact.Digest] = true
+			kept = append(kept, artifact)
+		}
+		job.StoredArtifacts = kept
+	}
+
+	for digest := range expired {
+		if live[digest] {
+			continue
+		}
+		if err := hpc.artifacts.Delete(digest); err != nil {
+			log.Printf("Failed to delete expired artifact %s: %v", digest, err)
+		}
+	}
+	if len(expired) > 0 {
+		log.Printf("Pruned %d expired artifacts", len(expired))
+	}
+}
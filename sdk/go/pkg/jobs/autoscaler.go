@@ -0,0 +1,464 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ScalingProvider adds and removes compute nodes on behalf of the autoscaler
+type ScalingProvider interface {
+	Name() string
+	ScaleUp(ctx context.Context, count int, state ScalingState) ([]*ComputeNode, error)
+	ScaleDown(ctx context.Context, nodeIDs []string, state ScalingState) error
+}
+
+// ScalingState is the queue snapshot a scaling decision was based on
+type ScalingState struct {
+	QueueDepth  int           `json:"queue_depth"`
+	OldestWait  time.Duration `json:"oldest_wait"`
+	RunningJobs int           `json:"running_jobs"`
+	ActiveNodes int           `json:"active_nodes"`
+	IdleNodeIDs []string      `json:"idle_node_ids"`
+}
+
+// AutoscalerConfig controls when the autoscaler adds or removes nodes
+type AutoscalerConfig struct {
+	EvaluationInterval time.Duration `json:"evaluation_interval"`
+	DryRun             bool          `json:"dry_run"`
+
+	ScaleUpQueueDepth int           `json:"scale_up_queue_depth"` // queued jobs that trigger scale-up
+	ScaleUpWaitTime   time.Duration `json:"scale_up_wait_time"`   // oldest queued job wait that triggers scale-up
+	ScaleUpStep       int           `json:"scale_up_step"`
+	ScaleUpCooldown   time.Duration `json:"scale_up_cooldown"`
+
+	ScaleDownIdleTime time.Duration `json:"scale_down_idle_time"` // how long a node must be idle
+	ScaleDownStep     int           `json:"scale_down_step"`
+	ScaleDownCooldown time.Duration `json:"scale_down_cooldown"`
+
+	MinNodes int `json:"min_nodes"`
+	MaxNodes int `json:"max_nodes"`
+}
+
+// ScalingDecision records one autoscaler action (or intended action in dry-run mode)
+type ScalingDecision struct {
+	Time     time.Time    `json:"time"`
+	Action   string       `json:"action"` // scale_up, scale_down
+	Count    int          `json:"count"`
+	NodeIDs  []string     `json:"node_ids,omitempty"`
+	Reason   string       `json:"reason"`
+	Provider string       `json:"provider"`
+	DryRun   bool         `json:"dry_run"`
+	Error    string       `json:"error,omitempty"`
+	State    ScalingState `json:"state"`
+}
+
+// Autoscaler watches queue depth and wait time and resizes the cluster
+type Autoscaler struct {
+	cluster       *HPCClusterManager
+	provider      ScalingProvider
+	config        AutoscalerConfig
+	lastScaleUp   time.Time
+	lastScaleDown time.Time
+	idleSince     map[string]time.Time
+	managed       map[string]bool
+	decisions     []ScalingDecision
+	stop          chan struct{}
+	mutex         sync.RWMutex
+}
+
+// EnableAutoscaler starts an autoscaler backed by provider
+func (hpc *HPCClusterManager) EnableAutoscaler(config AutoscalerConfig, provider ScalingProvider) *Autoscaler {
+	if config.EvaluationInterval <= 0 {
+		config.EvaluationInterval = 30 * time.Second
+	}
+	if config.ScaleUpStep <= 0 {
+		config.ScaleUpStep = 1
+	}
+	if config.ScaleDownStep <= 0 {
+		config.ScaleDownStep = 1
+	}
+	if config.MaxNodes <= 0 {
+		config.MaxNodes = hpc.config.MaxNodes
+	}
+
+	as := &Autoscaler{
+		cluster:   hpc,
+		provider:  provider,
+		config:    config,
+		idleSince: make(map[string]time.Time),
+		managed:   make(map[string]bool),
+		decisions: make([]ScalingDecision, 0),
+		stop:      make(chan struct{}),
+	}
+
+	hpc.mutex.Lock()
+	if hpc.autoscaler != nil {
+		close(hpc.autoscaler.stop)
+	}
+	hpc.autoscaler = as
+	hpc.mutex.Unlock()
+
+	go as.run()
+
+	mode := "live"
+	if config.DryRun {
+		mode = "dry-run"
+	}
+	log.Printf("Autoscaler enabled with provider %s (%s)", provider.Name(), mode)
+	return as
+}
+
+func (as *Autoscaler) run() {
+	ticker := time.NewTicker(as.config.EvaluationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			as.Evaluate()
+		case <-as.stop:
+			return
+		}
+	}
+}
+
+// Evaluate takes one scaling decision based on the current queue state
+func (as *Autoscaler) Evaluate() {
+	state := as.snapshot()
+	now := time.Now()
+
+	as.mutex.Lock()
+	cfg := as.config
+	canScaleUp := now.Sub(as.lastScaleUp) >= cfg.ScaleUpCooldown
+	canScaleDown := now.Sub(as.lastScaleDown) >= cfg.ScaleDownCooldown
+	as.mutex.Unlock()
+
+	// Scale up when the queue is deep or jobs have waited too long
+	var reason string
+	switch {
+	case cfg.ScaleUpQueueDepth > 0 && state.QueueDepth >= cfg.ScaleUpQueueDepth:
+		reason = fmt.Sprintf("queue depth %d >= %d", state.QueueDepth, cfg.ScaleUpQueueDepth)
+	case cfg.ScaleUpWaitTime > 0 && state.OldestWait >= cfg.ScaleUpWaitTime:
+		reason = fmt.Sprintf("oldest queued job waited %v >= %v", state.OldestWait.Round(time.Second), cfg.ScaleUpWaitTime)
+	}
+
+	if reason != "" {
+		count := min(cfg.ScaleUpStep, cfg.MaxNodes-state.ActiveNodes)
+		if count > 0 && canScaleUp {
+			as.scaleUp(count, reason, state)
+		}
+		return
+	}
+
+	// Scale down managed nodes that have been idle long enough while the queue is empty
+	if state.QueueDepth > 0 || cfg.ScaleDownIdleTime <= 0 || !canScaleDown {
+		return
+	}
+
+	as.mutex.RLock()
+	var candidates []string
+	for _, nodeID := range state.IdleNodeIDs {
+		since, ok := as.idleSince[nodeID]
+		if ok && as.managed[nodeID] && now.Sub(since) >= cfg.ScaleDownIdleTime {
+			candidates = append(candidates, nodeID)
+		}
+	}
+	as.mutex.RUnlock()
+
+	sort.Strings(candidates)
+	limit := min(cfg.ScaleDownStep, state.ActiveNodes-cfg.MinNodes, len(candidates))
+	if limit > 0 {
+		reason = fmt.Sprintf("%d node(s) idle for %v with empty queue", len(candidates), cfg.ScaleDownIdleTime)
+		as.scaleDown(candidates[:limit], reason, state)
+	}
+}
+
+// snapshot collects queue metrics and tracks how long nodes have been idle
+func (as *Autoscaler) snapshot() ScalingState {
+	hpc := as.cluster
+	now := time.Now()
+	state := ScalingState{}
+
+	hpc.mutex.RLock()
+	for _, job := range hpc.jobs {
+		switch job.Status {
+		case "queued":
+			state.QueueDepth++
+			if wait := now.Sub(job.SubmittedAt); wait > state.OldestWait {
+				state.OldestWait = wait
+			}
+		case "running":
+			state.RunningJobs++
+		}
+	}
+	idle := make(map[string]bool)
+	for _, node := range hpc.nodes {
+		if node.Status != "available" {
+			continue
+		}
+		state.ActiveNodes++
+		if node.JobsRunning == 0 {
+			idle[node.ID] = true
+			state.IdleNodeIDs = append(state.IdleNodeIDs, node.ID)
+		}
+	}
+	hpc.mutex.RUnlock()
+
+	as.mutex.Lock()
+	for nodeID := range idle {
+		if _, ok := as.idleSince[nodeID]; !ok {
+			as.idleSince[nodeID] = now
+		}
+	}
+	for nodeID := range as.idleSince {
+		if !idle[nodeID] {
+			delete(as.idleSince, nodeID)
+		}
+	}
+	as.mutex.Unlock()
+
+	return state
+}
+
+func (as *Autoscaler) scaleUp(count int, reason string, state ScalingState) {
+	decision := ScalingDecision{
+		Time:     time.Now(),
+		Action:   "scale_up",
+		Count:    count,
+		Reason:   reason,
+		Provider: as.provider.Name(),
+		DryRun:   as.config.DryRun,
+		State:    state,
+	}
+
+	if as.config.DryRun {
+		log.Printf("[dry-run] Autoscaler would add %d node(s) via %s: %s", count, decision.Provider, reason)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		nodes, err := as.provider.ScaleUp(ctx, count, state)
+		cancel()
+
+		if err != nil {
+			decision.Error = err.Error()
+			log.Printf("Autoscaler scale-up via %s failed: %v", decision.Provider, err)
+		}
+		for _, node := range nodes {
+			if node.Metadata == nil {
+				node.Metadata = make(map[string]string)
+			}
+			node.Metadata["autoscaled"] = "true"
+			if err := as.cluster.RegisterNode(node); err != nil {
+				log.Printf("Autoscaler could not register node %s: %v", node.ID, err)
+				continue
+			}
+			decision.NodeIDs = append(decision.NodeIDs, node.ID)
+			as.mutex.Lock()
+			as.managed[node.ID] = true
+			as.mutex.Unlock()
+		}
+		log.Printf("Autoscaler added %d node(s) via %s: %s", len(decision.NodeIDs), decision.Provider, reason)
+	}
+
+	as.record(decision, func() { as.lastScaleUp = decision.Time })
+}
+
+func (as *Autoscaler) scaleDown(nodeIDs []string, reason string, state ScalingState) {
+	decision := ScalingDecision{
+		Time:     time.Now(),
+		Action:   "scale_down",
+		Count:    len(nodeIDs),
+		NodeIDs:  nodeIDs,
+		Reason:   reason,
+		Provider: as.provider.Name(),
+		DryRun:   as.config.DryRun,
+		State:    state,
+	}
+
+	if as.config.DryRun {
+		log.Printf("[dry-run] Autoscaler would remove node(s) %v via %s: %s", nodeIDs, decision.Provider, reason)
+	} else {
+		// Take nodes out of the scheduler before asking the provider to release them
+		removed := make([]string, 0, len(nodeIDs))
+		for _, nodeID := range nodeIDs {
+			if err := as.cluster.DeregisterNode(nodeID); err != nil {
+				log.Printf("Autoscaler skipped node %s: %v", nodeID, err)
+				continue
+			}
+			removed = append(removed, nodeID)
+		}
+		decision.NodeIDs = removed
+		decision.Count = len(removed)
+
+		if len(removed) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			if err := as.provider.ScaleDown(ctx, removed, state); err != nil {
+				decision.Error = err.Error()
+				log.Printf("Autoscaler scale-down via %s failed: %v", decision.Provider, err)
+			}
+			cancel()
+		}
+
+		as.mutex.Lock()
+		for _, nodeID := range removed {
+			delete(as.managed, nodeID)
+			delete(as.idleSince, nodeID)
+		}
+		as.mutex.Unlock()
+		log.Printf("Autoscaler removed node(s) %v via %s: %s", removed, decision.Provider, reason)
+	}
+
+	as.record(decision, func() { as.lastScaleDown = decision.Time })
+}
+
+// record stores a decision and updates the cooldown timestamp
+func (as *Autoscaler) record(decision ScalingDecision, markCooldown func()) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	markCooldown()
+	as.decisions = append(as.decisions, decision)
+	if len(as.decisions) > 100 {
+		as.decisions = as.decisions[1:]
+	}
+}
+
+// Decisions returns the recent scaling decisions
+func (as *Autoscaler) Decisions() []ScalingDecision {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return append([]ScalingDecision(nil), as.decisions...)
+}
+
+// ShellScalingProvider runs a script as `<script> up <count>` or
+// `<script> down <node-id>...`. Scale-up output must be a JSON array of nodes.
+type ShellScalingProvider struct {
+	Script string
+	Env    []string
+}
+
+func (p *ShellScalingProvider) Name() string { return "shell:" + p.Script }
+
+func (p *ShellScalingProvider) ScaleUp(ctx context.Context, count int, state ScalingState) ([]*ComputeNode, error) {
+	out, err := p.run(ctx, state, "up", fmt.Sprintf("%d", count))
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*ComputeNode
+	if err := json.Unmarshal(out, &nodes); err != nil {
+		return nil, fmt.Errorf("script output is not a JSON node list: %w", err)
+	}
+	return nodes, nil
+}
+
+func (p *ShellScalingProvider) ScaleDown(ctx context.Context, nodeIDs []string, state ScalingState) error {
+	_, err := p.run(ctx, state, append([]string{"down"}, nodeIDs...)...)
+	return err
+}
+
+func (p *ShellScalingProvider) run(ctx context.Context, state ScalingState, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, p.Script, args...)
+	cmd.Env = append(os.Environ(), p.Env...)
+	cmd.Env = append(cmd.Env,
+		fmt.Sprintf("HPC_QUEUE_DEPTH=%d", state.QueueDepth),
+		fmt.Sprintf("HPC_OLDEST_WAIT_SECONDS=%d", int(state.OldestWait.Seconds())),
+		fmt.Sprintf("HPC_ACTIVE_NODES=%d", state.ActiveNodes),
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %v: %w: %s", p.Script, args, err, stderr.String())
+	}
+	return out, nil
+}
+
+// WebhookScalingProvider POSTs scaling requests as JSON to a URL. Scale-up
+// responses must contain {"nodes": [...]}.
+type WebhookScalingProvider struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+func (p *WebhookScalingProvider) Name() string { return "webhook:" + p.URL }
+
+func (p *WebhookScalingProvider) ScaleUp(ctx context.Context, count int, state ScalingState) ([]*ComputeNode, error) {
+	var response struct {
+		Nodes []*ComputeNode `json:"nodes"`
+	}
+	err := p.post(ctx, map[string]interface{}{"action": "scale_up", "count": count, "state": state}, &response)
+	return response.Nodes, err
+}
+
+func (p *WebhookScalingProvider) ScaleDown(ctx context.Context, nodeIDs []string, state ScalingState) error {
+	return p.post(ctx, map[string]interface{}{"action": "scale_down", "node_ids": nodeIDs, "state": state}, nil)
+}
+
+func (p *WebhookScalingProvider) post(ctx context.Context, payload interface{}, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range p.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// CloudScalingProvider adapts a cloud SDK client to the autoscaler. Launch
+// must return the nodes it created; Terminate releases instances by node ID.
+type CloudScalingProvider struct {
+	Provider  string // e.g. aws, gcp, azure
+	Launch    func(ctx context.Context, count int) ([]*ComputeNode, error)
+	Terminate func(ctx context.Context, nodeIDs []string) error
+}
+
+func (p *CloudScalingProvider) Name() string { return "cloud:" + p.Provider }
+
+func (p *CloudScalingProvider) ScaleUp(ctx context.Context, count int, state ScalingState) ([]*ComputeNode, error) {
+	if p.Launch == nil {
+		return nil, fmt.Errorf("cloud provider %s has no Launch function", p.Provider)
+	}
+	return p.Launch(ctx, count)
+}
+
+func (p *CloudScalingProvider) ScaleDown(ctx context.Context, nodeIDs []string, state ScalingState) error {
+	if p.Terminate == nil {
+		return fmt.Errorf("cloud provider %s has no Terminate function", p.Provider)
+	}
+	return p.Terminate(ctx, nodeIDs)
+}
@@ -0,0 +1,456 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Validate checks what can be checked of a DAG before it is submitted: it
+// has an ID and jobs, its job IDs are unique and the dependencies between
+// its jobs form no cycle. Dependencies on jobs outside the DAG are checked
+// when it is submitted.
+func (dag *JobDAG) Validate() error {
+	if dag.ID == "" {
+		return fmt.Errorf("dag id is required")
+	}
+	if len(dag.Jobs) == 0 {
+		return fmt.Errorf("dag %s has no jobs", dag.ID)
+	}
+	members := make(map[string]bool, len(dag.Jobs))
+	for _, job := range dag.Jobs {
+		if job.ID == "" {
+			return fmt.Errorf("dag %s: job id is required", dag.ID)
+		}
+		if members[job.ID] {
+			return fmt.Errorf("dag %s: duplicate job %s", dag.ID, job.ID)
+		}
+		members[job.ID] = true
+	}
+	if cycle := findCycle(dag.Jobs); cycle != nil {
+		return fmt.Errorf("dag %s: dependency cycle %s", dag.ID, strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// SubmitDAG validates and submits a set of interdependent jobs
+func (hpc *HPCClusterManager) SubmitDAG(dag *JobDAG) error {
+	if err := dag.Validate(); err != nil {
+		return err
+	}
+
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	if _, exists := hpc.dags[dag.ID]; exists {
+		return fmt.Errorf("dag %s already exists", dag.ID)
+	}
+	members := make(map[string]*HPCJob, len(dag.Jobs))
+	for _, job := range dag.Jobs {
+		members[job.ID] = job
+	}
+	for _, job := range dag.Jobs {
+		if err := hpc.checkSubmittableLocked(job, members); err != nil {
+			return fmt.Errorf("dag %s: %w", dag.ID, err)
+		}
+	}
+
+	dag.SubmittedAt = time.Now()
+	hpc.dags[dag.ID] = dag
+	for _, job := range dag.Jobs {
+		job.DAGID = dag.ID
+		hpc.submitJobLocked(job)
+	}
+	hpc.releaseWaitingJobsLocked()
+
+	log.Printf("DAG submitted: %s (%d jobs)", dag.ID, len(dag.Jobs))
+	return nil
+}
+
+// checkSubmittableLocked validates a job's ID, array spec and dependencies.
+// Dependencies may name existing jobs/arrays or members of the same DAG.
+func (hpc *HPCClusterManager) checkSubmittableLocked(job *HPCJob, members map[string]*HPCJob) error {
+	if hpc.stopping {
+		return fmt.Errorf("cluster manager is shutting down")
+	}
+	if job.ID == "" {
+		return fmt.Errorf("job id is required")
+	}
+	if _, exists := hpc.jobs[job.ID]; exists {
+		return fmt.Errorf("job %s already exists", job.ID)
+	}
+	if _, exists := hpc.arrays[job.ID]; exists {
+		return fmt.Errorf("job array %s already exists", job.ID)
+	}
+	if job.ArraySize < 0 || (len(job.ArrayParams) > 0 && job.ArraySize > 0 && job.ArraySize != len(job.ArrayParams)) {
+		return fmt.Errorf("job %s: array_size must match the number of array_params", job.ID)
+	}
+
+	switch job.OnDependencyFailure {
+	case "", "cancel", "continue":
+	default:
+		return fmt.Errorf("job %s: unknown on_dependency_failure %q", job.ID, job.OnDependencyFailure)
+	}
+
+	for _, dep := range job.DependsOn {
+		if dep == job.ID {
+			return fmt.Errorf("job %s depends on itself", job.ID)
+		}
+		_, isJob := hpc.jobs[dep]
+		_, isArray := hpc.arrays[dep]
+		_, isMember := members[dep]
+		if !isJob && !isArray && !isMember {
+			return fmt.Errorf("job %s depends on unknown job %s", job.ID, dep)
+		}
+	}
+	return nil
+}
+
+// submitJobLocked adds a job (or the tasks of a job array) to the cluster;
+// the caller must hold hpc.mutex
+func (hpc *HPCClusterManager) submitJobLocked(job *HPCJob) {
+	size := job.ArraySize
+	if size == 0 {
+		size = len(job.ArrayParams)
+	}
+	if size == 0 {
+		hpc.addJobLocked(job)
+		return
+	}
+
+	taskIDs := make([]string, size)
+	for i := 0; i < size; i++ {
+		param := strconv.Itoa(i)
+		if len(job.ArrayParams) > 0 {
+			param = job.ArrayParams[i]
+		}
+		expand := strings.NewReplacer("{{index}}", strconv.Itoa(i), "{{param}}", param).Replace
+
+		task := *job
+		task.ID = fmt.Sprintf("%s[%d]", job.ID, i)
+		task.Name = expand(job.Name)
+		task.Command = expand(job.Command)
+		task.Arguments = make([]string, len(job.Arguments))
+		for j, arg := range job.Arguments {
+			task.Arguments[j] = expand(arg)
+		}
+		task.ArraySize = 0
+		task.ArrayParams = nil
+		task.ArrayID = job.ID
+		task.ArrayIndex = i
+		task.Metadata = make(map[string]string, len(job.Metadata)+2)
+		for k, v := range job.Metadata {
+			task.Metadata[k] = v
+		}
+		task.Metadata["array_index"] = strconv.Itoa(i)
+		task.Metadata["array_param"] = param
+
+		hpc.addJobLocked(&task)
+		taskIDs[i] = task.ID
+	}
+
+	hpc.arrays[job.ID] = taskIDs
+	job.Status = "submitted"
+	job.SubmittedAt = time.Now()
+	log.Printf("Job array submitted: %s (%d tasks)", job.ID, size)
+}
+
+func (hpc *HPCClusterManager) addJobLocked(job *HPCJob) {
+	job.Status = "queued"
+	if len(job.DependsOn) > 0 {
+		job.Status = "waiting"
+	}
+	job.SubmittedAt = time.Now()
+	if job.Metadata == nil {
+		job.Metadata = make(map[string]string)
+	}
+
+	hpc.jobs[job.ID] = job
+	atomic.AddInt64(&hpc.stats.TotalJobs, 1)
+	if job.Status == "queued" {
+		atomic.AddInt32(&hpc.stats.QueuedJobs, 1)
+	}
+
+	log.Printf("Job submitted: %s (type: %s, priority: %d)", job.ID, job.Type, job.Priority)
+}
+
+// dependencyJobsLocked expands a dependency ID into job IDs (arrays fan in)
+func (hpc *HPCClusterManager) dependencyJobsLocked(dep string) []string {
+	if tasks, ok := hpc.arrays[dep]; ok {
+		return tasks
+	}
+	return []string{dep}
+}
+
+// releaseWaitingJobsLocked queues waiting jobs whose dependencies have
+// finished and cancels those whose dependencies failed. Cancellation cascades,
+// so it repeats until nothing changes.
+func (hpc *HPCClusterManager) releaseWaitingJobsLocked() {
+	for changed := true; changed; {
+		changed = false
+
+		for _, job := range hpc.jobs {
+			if job.Status != "waiting" {
+				continue
+			}
+
+			pending, failedDep := false, ""
+			for _, dep := range job.DependsOn {
+				for _, id := range hpc.dependencyJobsLocked(dep) {
+					switch hpc.jobs[id].Status {
+					case "completed":
+					case "failed", "cancelled":
+						if failedDep == "" {
+							failedDep = id
+						}
+					default:
+						pending = true
+					}
+				}
+			}
+
+			switch {
+			case failedDep != "" && job.OnDependencyFailure != "continue":
+				hpc.cancelJobLocked(job, fmt.Sprintf("dependency %s did not complete", failedDep))
+				changed = true
+			case !pending:
+				job.Status = "queued"
+				atomic.AddInt32(&hpc.stats.QueuedJobs, 1)
+				log.Printf("Job %s dependencies satisfied, queued", job.ID)
+				changed = true
+			}
+		}
+	}
+}
+
+// cancelJobLocked cancels a job that has not started
+func (hpc *HPCClusterManager) cancelJobLocked(job *HPCJob, reason string) {
+	if job.Status == "queued" {
+		atomic.AddInt32(&hpc.stats.QueuedJobs, -1)
+	}
+	now := time.Now()
+	job.Status = "cancelled"
+	job.CompletedAt = &now
+	job.Error = reason
+	log.Printf("Job %s cancelled: %s", job.ID, reason)
+}
+
+// failDAGLocked cancels every pending job of a fail-fast DAG
+func (hpc *HPCClusterManager) failDAGLocked(dagID, failedJob string) {
+	dag, ok := hpc.dags[dagID]
+	if !ok || !dag.FailFast {
+		return
+	}
+	for _, job := range hpc.jobs {
+		if job.DAGID == dagID && (job.Status == "waiting" || job.Status == "queued") && !hpc.isReservedLocked(job.ID) {
+			hpc.cancelJobLocked(job, fmt.Sprintf("dag %s failed at %s", dagID, failedJob))
+		}
+	}
+}
+
+// findCycle returns the job IDs forming a dependency cycle, or nil
+func findCycle(jobs []*HPCJob) []string {
+	deps := make(map[string][]string, len(jobs))
+	for _, job := range jobs {
+		deps[job.ID] = job.DependsOn
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(jobs))
+	var path []string
+
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		switch state[id] {
+		case visiting:
+			for i, p := range path {
+				if p == id {
+					return append(append([]string{}, path[i:]...), id)
+				}
+			}
+		case done:
+			return nil
+		}
+		state[id] = visiting
+		path = append(path, id)
+		for _, dep := range deps[id] {
+			if _, inDAG := deps[dep]; !inDAG {
+				continue
+			}
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = done
+		return nil
+	}
+
+	for _, job := range jobs {
+		if cycle := visit(job.ID); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// DAG status and visualization
+
+// DAGNodeStatus summarizes one DAG job, aggregating array tasks
+type DAGNodeStatus struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Status    string         `json:"status"`
+	DependsOn []string       `json:"depends_on,omitempty"`
+	Tasks     map[string]int `json:"tasks,omitempty"` // status -> count for arrays
+	Level     int            `json:"level"`
+}
+
+// DAGStatus returns the status of every job in a DAG in topological order
+func (hpc *HPCClusterManager) DAGStatus(dagID string) (*JobDAG, []DAGNodeStatus, error) {
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+
+	dag, ok := hpc.dags[dagID]
+	if !ok {
+		return nil, nil, fmt.Errorf("dag %s not found", dagID)
+	}
+
+	levels := make(map[string]int, len(dag.Jobs))
+	var level func(job *HPCJob) int
+	byID := make(map[string]*HPCJob, len(dag.Jobs))
+	for _, job := range dag.Jobs {
+		byID[job.ID] = job
+	}
+	level = func(job *HPCJob) int {
+		if l, ok := levels[job.ID]; ok {
+			return l
+		}
+		l := 0
+		for _, dep := range job.DependsOn {
+			if parent, ok := byID[dep]; ok {
+				l = max(l, level(parent)+1)
+			}
+		}
+		levels[job.ID] = l
+		return l
+	}
+
+	nodes := make([]DAGNodeStatus, 0, len(dag.Jobs))
+	for _, job := range dag.Jobs {
+		node := DAGNodeStatus{ID: job.ID, Name: job.Name, DependsOn: job.DependsOn, Level: level(job)}
+		if tasks, isArray := hpc.arrays[job.ID]; isArray {
+			node.Tasks = make(map[string]int)
+			for _, id := range tasks {
+				node.Tasks[hpc.jobs[id].Status]++
+			}
+			node.Status = aggregateStatus(node.Tasks, len(tasks))
+		} else {
+			node.Status = hpc.jobs[job.ID].Status
+		}
+		nodes = append(nodes, node)
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Level < nodes[j].Level })
+	return dag, nodes, nil
+}
+
+// aggregateStatus reduces array task statuses to a single status
+func aggregateStatus(counts map[string]int, total int) string {
+	for _, status := range []string{"failed", "running"} {
+		if counts[status] > 0 {
+			return status
+		}
+	}
+	for _, status := range []string{"completed", "cancelled", "waiting"} {
+		if counts[status] == total {
+			return status
+		}
+	}
+	if counts["completed"]+counts["cancelled"] == total {
+		return "cancelled"
+	}
+	return "queued"
+}
+
+var dagStatusIcons = map[string]string{
+	"waiting": "⏸", "queued": "…", "running": "▶", "completed": "✓", "failed": "✗", "cancelled": "⊘",
+}
+
+// RenderDAGASCII draws a DAG level by level with each job's dependencies
+func RenderDAGASCII(dag *JobDAG, nodes []DAGNodeStatus) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "DAG %s", dag.ID)
+	if dag.Name != "" {
+		fmt.Fprintf(&b, " (%s)", dag.Name)
+	}
+	b.WriteString("\n")
+
+	level := -1
+	for _, node := range nodes {
+		if node.Level != level {
+			level = node.Level
+			fmt.Fprintf(&b, "│\n├─ stage %d\n", level)
+		}
+		fmt.Fprintf(&b, "│  [%s] %-24s %s", dagStatusIcons[node.Status], node.ID, node.Status)
+		if node.Tasks != nil {
+			fmt.Fprintf(&b, " %s", formatTaskCounts(node.Tasks))
+		}
+		if len(node.DependsOn) > 0 {
+			fmt.Fprintf(&b, "  ◀ %s", strings.Join(node.DependsOn, ", "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// RenderDAGMermaid renders a DAG as a Mermaid flowchart
+func RenderDAGMermaid(dag *JobDAG, nodes []DAGNodeStatus) string {
+	var b strings.Builder
+	b.WriteString("graph TD\n")
+
+	ids := make(map[string]string, len(nodes))
+	for i, node := range nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+	}
+
+	for _, node := range nodes {
+		label := fmt.Sprintf("%s<br/>%s", node.ID, node.Status)
+		if node.Tasks != nil {
+			label += " " + formatTaskCounts(node.Tasks)
+		}
+		fmt.Fprintf(&b, "    %s[\"%s\"]:::%s\n", ids[node.ID], strings.ReplaceAll(label, `"`, "'"), node.Status)
+	}
+	for _, node := range nodes {
+		for _, dep := range node.DependsOn {
+			if from, ok := ids[dep]; ok {
+				fmt.Fprintf(&b, "    %s --> %s\n", from, ids[node.ID])
+			}
+		}
+	}
+
+	b.WriteString("    classDef waiting fill:#eee,stroke:#999\n")
+	b.WriteString("    classDef queued fill:#fff3cd,stroke:#d4a017\n")
+	b.WriteString("    classDef running fill:#cfe2ff,stroke:#0d6efd\n")
+	b.WriteString("    classDef completed fill:#d1e7dd,stroke:#198754\n")
+	b.WriteString("    classDef failed fill:#f8d7da,stroke:#dc3545\n")
+	b.WriteString("    classDef cancelled fill:#e2e3e5,stroke:#6c757d\n")
+	return b.String()
+}
+
+func formatTaskCounts(counts map[string]int) string {
+	parts := make([]string, 0, len(counts))
+	for status, n := range counts {
+		parts = append(parts, fmt.Sprintf("%d %s", n, status))
+	}
+	sort.Strings(parts)
+	return "(" + strings.Join(parts, ", ") + ")"
+}
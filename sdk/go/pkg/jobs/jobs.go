@@ -0,0 +1,514 @@
+// Package jobs is the HPC cluster manager: it schedules jobs, job arrays
+// and DAGs of dependent jobs on compute nodes with FIFO, fair-share or
+// backfill placement, preempts lower-priority jobs through checkpoint
+// hooks, reschedules the jobs of nodes that stop heartbeating, accounts
+// CPU- and GPU-hours per user and team, keeps job artifacts and resizes
+// the cluster with an autoscaler. tsk jobs and tsk compute talk to its
+// HTTP API.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HPCClusterManager - PRODUCTION high-performance computing cluster
+type HPCClusterManager struct {
+	nodes      map[string]*ComputeNode
+	jobs       map[string]*HPCJob
+	queues     map[string]*JobQueue
+	running    map[string]context.CancelFunc
+	reserved   map[string]string
+	arrays     map[string][]string
+	dags       map[string]*JobDAG
+	nodeEvents map[string][]NodeEvent
+	usage      []UsageRecord
+	scheduler  *HPCScheduler
+	monitor    *ClusterMonitor
+	autoscaler *Autoscaler
+	artifacts  ArtifactStore
+	config     HPCConfig
+	httpServer *http.Server
+	stats      *ClusterStats
+	stop       chan struct{}
+	stopping   bool
+	mutex      sync.RWMutex
+}
+
+type ComputeNode struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Type        string            `json:"type"` // cpu, gpu, memory
+	CPUCores    int               `json:"cpu_cores"`
+	Memory      int64             `json:"memory_gb"`
+	GPUs        int               `json:"gpus"`
+	Status      string            `json:"status"` // available, busy, maintenance, unhealthy, draining, drained
+	Load        float64           `json:"load"`
+	JobsRunning int               `json:"jobs_running"`
+	MaxJobs     int               `json:"max_jobs"`
+	Performance NodePerformance   `json:"performance"`
+	Metadata    map[string]string `json:"metadata"`
+
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	Draining      bool      `json:"draining"` // set by DrainNode, survives unhealthy/recovered transitions
+}
+
+// NodeEvent is one entry in a node's health and lifecycle history
+type NodeEvent struct {
+	Time    time.Time `json:"time"`
+	NodeID  string    `json:"node_id"`
+	Type    string    `json:"type"` // registered, unhealthy, recovered, drain_requested, drained, undrained, job_rescheduled, job_lost, deregistered
+	Status  string    `json:"status"`
+	Message string    `json:"message,omitempty"`
+}
+
+// maxNodeEvents bounds the per-node event history
+const maxNodeEvents = 200
+
+type HPCJob struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Type        string            `json:"type"` // compute, simulation, ml_training
+	Priority    int               `json:"priority"`
+	Resources   ResourceRequest   `json:"resources"`
+	Command     string            `json:"command"`
+	Arguments   []string          `json:"arguments"`
+	Status      string            `json:"status"` // waiting, queued, running, completed, failed, cancelled
+	SubmittedAt time.Time         `json:"submitted_at"`
+	StartedAt   *time.Time        `json:"started_at"`
+	CompletedAt *time.Time        `json:"completed_at"`
+	NodeID      string            `json:"node_id"`
+	ExitCode    int               `json:"exit_code"`
+	Output      string            `json:"output"`
+	Error       string            `json:"error"`
+	Metadata    map[string]string `json:"metadata"`
+
+	// Preemption
+	NoPreempt       bool              `json:"no_preempt"`
+	Checkpoint      *CheckpointPolicy `json:"checkpoint,omitempty"`
+	CheckpointRef   string            `json:"checkpoint_ref,omitempty"`
+	PreemptionCount int               `json:"preemption_count"`
+
+	// Job arrays and dependencies
+	ArraySize           int      `json:"array_size,omitempty"`            // submit as tasks ID[0]..ID[N-1]
+	ArrayParams         []string `json:"array_params,omitempty"`          // per-task values for {{param}}
+	ArrayID             string   `json:"array_id,omitempty"`              // set on array tasks
+	ArrayIndex          int      `json:"array_index,omitempty"`           // set on array tasks
+	DependsOn           []string `json:"depends_on,omitempty"`            // job or array IDs that must finish first
+	OnDependencyFailure string   `json:"on_dependency_failure,omitempty"` // cancel (default) or continue
+	DAGID               string   `json:"dag_id,omitempty"`
+
+	// Node failure handling
+	Retry      *RetryPolicy `json:"retry,omitempty"`
+	Attempts   int          `json:"attempts"`              // attempts lost to node failures
+	RetryAfter *time.Time   `json:"retry_after,omitempty"` // not scheduled before this time
+
+	// Result artifacts
+	WorkDir         string        `json:"work_dir,omitempty"`
+	Artifacts       []string      `json:"artifacts,omitempty"`    // output paths or globs, relative to WorkDir
+	ArtifactTTL     time.Duration `json:"artifact_ttl,omitempty"` // overrides HPCConfig.ArtifactRetention
+	StoredArtifacts []JobArtifact `json:"stored_artifacts,omitempty"`
+}
+
+// UsageRecord is the resources one job consumed while running. A job that
+// is preempted or rescheduled produces one record per run.
+type UsageRecord struct {
+	JobID    string    `json:"job_id"`
+	User     string    `json:"user"`
+	Team     string    `json:"team"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	CPUHours float64   `json:"cpu_hours"`
+	GPUHours float64   `json:"gpu_hours"`
+}
+
+// UsageSummary aggregates usage records for one user or team
+type UsageSummary struct {
+	Account  string  `json:"account"`
+	Jobs     int     `json:"jobs"`
+	CPUHours float64 `json:"cpu_hours"`
+	GPUHours float64 `json:"gpu_hours"`
+}
+
+// JobArtifact is one output file uploaded to the artifact store
+type JobArtifact struct {
+	Name      string     `json:"name"`   // path relative to the job's WorkDir
+	Digest    string     `json:"digest"` // sha256 of the content
+	Size      int64      `json:"size"`
+	StoredAt  time.Time  `json:"stored_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// RetryPolicy controls rescheduling of jobs whose node stops heartbeating
+type RetryPolicy struct {
+	MaxRetries int           `json:"max_retries"`
+	Backoff    time.Duration `json:"backoff"` // doubled after each attempt
+}
+
+// JobDAG is a set of jobs connected by DependsOn edges. Jobs in a DAG may be
+// arrays, so a single node can fan out into many tasks and a dependent node
+// fans them back in.
+type JobDAG struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	FailFast    bool      `json:"fail_fast"` // cancel all pending jobs on the first failure
+	Jobs        []*HPCJob `json:"jobs"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// CheckpointPolicy describes how a job is asked to checkpoint before preemption
+type CheckpointPolicy struct {
+	Signal      string        `json:"signal"`       // e.g. SIGTERM, SIGUSR1
+	GracePeriod time.Duration `json:"grace_period"` // time allowed for the checkpoint hook
+}
+
+// CheckpointHook is invoked before a running job is preempted. It receives the
+// configured signal and must return within the context deadline; the returned
+// reference is stored on the requeued job so it can resume from the checkpoint.
+type CheckpointHook func(ctx context.Context, job *HPCJob, signal string) (string, error)
+
+type JobQueue struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Priority int      `json:"priority"`
+	MaxJobs  int      `json:"max_jobs"`
+	Jobs     []string `json:"jobs"`
+	Status   string   `json:"status"`
+}
+
+type ResourceRequest struct {
+	CPUCores int           `json:"cpu_cores"`
+	Memory   int64         `json:"memory_gb"`
+	GPUs     int           `json:"gpus"`
+	Walltime time.Duration `json:"walltime"`
+	Nodes    int           `json:"nodes"`
+}
+
+type NodePerformance struct {
+	CPUUtilization    float64       `json:"cpu_utilization"`
+	MemoryUtilization float64       `json:"memory_utilization"`
+	GPUUtilization    float64       `json:"gpu_utilization"`
+	NetworkThroughput float64       `json:"network_throughput"`
+	JobThroughput     float64       `json:"job_throughput"`
+	Uptime            time.Duration `json:"uptime"`
+	LastUpdated       time.Time     `json:"last_updated"`
+}
+
+type HPCConfig struct {
+	MaxNodes         int           `json:"max_nodes"`
+	MaxJobs          int           `json:"max_jobs"`
+	ServerPort       int           `json:"server_port"`
+	ScheduleInterval time.Duration `json:"schedule_interval"`
+	MonitorInterval  time.Duration `json:"monitor_interval"`
+
+	// HeartbeatTimeout marks nodes unhealthy after this long without a
+	// heartbeat; zero disables failure detection
+	HeartbeatTimeout time.Duration `json:"heartbeat_timeout"`
+	// DefaultRetry applies to jobs without their own retry policy
+	DefaultRetry RetryPolicy `json:"default_retry"`
+
+	// ArtifactDir enables the local content-addressed artifact store
+	ArtifactDir string `json:"artifact_dir"`
+	// ArtifactRetention is how long artifacts are kept; zero keeps them forever
+	ArtifactRetention time.Duration `json:"artifact_retention"`
+	// UsageRetention is how long usage records are kept; zero keeps them forever
+	UsageRetention time.Duration `json:"usage_retention"`
+}
+
+type HPCScheduler struct {
+	cluster    *HPCClusterManager
+	algorithms map[string]ScheduleAlgorithm
+	config     SchedulerConfig
+	checkpoint CheckpointHook
+	mutex      sync.RWMutex
+}
+
+type ScheduleAlgorithm func(job *HPCJob, nodes []*ComputeNode) (*ComputeNode, error)
+
+type SchedulerConfig struct {
+	Algorithm        string `json:"algorithm"` // fifo, fair_share, backfill
+	EnablePreemption bool   `json:"enable_preemption"`
+	EnableBackfill   bool   `json:"enable_backfill"`
+
+	// PreemptionPriorityGap is the minimum priority difference required to preempt
+	PreemptionPriorityGap int `json:"preemption_priority_gap"`
+	// PreemptionGracePeriod is used for jobs without their own checkpoint policy
+	PreemptionGracePeriod time.Duration `json:"preemption_grace_period"`
+
+	// Fair-share: accounts with little recent usage get up to FairShareWeight
+	// extra priority points, so heavy users yield to light users over time
+	FairShareBy       string        `json:"fair_share_by"`        // user (default) or team, from job metadata
+	FairShareWeight   float64       `json:"fair_share_weight"`    // zero disables the adjustment
+	FairShareHalfLife time.Duration `json:"fair_share_half_life"` // usage decay half-life
+	GPUHourWeight     float64       `json:"gpu_hour_weight"`      // CPU-hours charged per GPU-hour
+}
+
+type ClusterMonitor struct {
+	cluster *HPCClusterManager
+	metrics map[string]float64
+	alerts  []ClusterAlert
+	mutex   sync.RWMutex
+}
+
+type ClusterAlert struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Severity  string    `json:"severity"`
+	Message   string    `json:"message"`
+	NodeID    string    `json:"node_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type ClusterStats struct {
+	TotalNodes         int32         `json:"total_nodes"`
+	ActiveNodes        int32         `json:"active_nodes"`
+	TotalJobs          int64         `json:"total_jobs"`
+	RunningJobs        int32         `json:"running_jobs"`
+	CompletedJobs      int64         `json:"completed_jobs"`
+	FailedJobs         int64         `json:"failed_jobs"`
+	PreemptedJobs      int64         `json:"preempted_jobs"`
+	QueuedJobs         int32         `json:"queued_jobs"`
+	ClusterUtilization float64       `json:"cluster_utilization"`
+	AvgJobWaitTime     time.Duration `json:"avg_job_wait_time"`
+	Throughput         float64       `json:"throughput"`
+	StartTime          time.Time     `json:"start_time"`
+}
+
+// NewHPCClusterManager creates a cluster manager. Nothing runs until
+// Start, so a manager can also be driven by hand.
+func NewHPCClusterManager(config HPCConfig) *HPCClusterManager {
+	cluster := &HPCClusterManager{
+		nodes:      make(map[string]*ComputeNode),
+		jobs:       make(map[string]*HPCJob),
+		queues:     make(map[string]*JobQueue),
+		running:    make(map[string]context.CancelFunc),
+		reserved:   make(map[string]string),
+		arrays:     make(map[string][]string),
+		dags:       make(map[string]*JobDAG),
+		nodeEvents: make(map[string][]NodeEvent),
+		config:     config,
+		stop:       make(chan struct{}),
+		scheduler: &HPCScheduler{
+			algorithms: make(map[string]ScheduleAlgorithm),
+			config: SchedulerConfig{
+				Algorithm:             "fair_share",
+				EnablePreemption:      false,
+				EnableBackfill:        true,
+				PreemptionPriorityGap: 1,
+				PreemptionGracePeriod: 30 * time.Second,
+				FairShareBy:           "user",
+				FairShareWeight:       10,
+				FairShareHalfLife:     7 * 24 * time.Hour,
+				GPUHourWeight:         10,
+			},
+		},
+		monitor: &ClusterMonitor{
+			metrics: make(map[string]float64),
+			alerts:  make([]ClusterAlert, 0),
+		},
+		stats: &ClusterStats{
+			StartTime: time.Now(),
+		},
+	}
+
+	cluster.scheduler.cluster = cluster
+	cluster.monitor.cluster = cluster
+
+	if config.ArtifactDir != "" {
+		cluster.artifacts = &LocalArtifactStore{Root: config.ArtifactDir}
+	}
+
+	cluster.initializeComponents()
+
+	return cluster
+}
+
+func (hpc *HPCClusterManager) initializeComponents() {
+	// Register scheduling algorithms
+	hpc.scheduler.algorithms["fifo"] = hpc.scheduleFIFO
+	hpc.scheduler.algorithms["fair_share"] = hpc.scheduleFairShare
+	hpc.scheduler.algorithms["backfill"] = hpc.scheduleBackfill
+
+	// Setup HTTP server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nodes", hpc.handleNodes)
+	mux.HandleFunc("/jobs", hpc.handleJobs)
+	mux.HandleFunc("/submit", hpc.handleSubmit)
+	mux.HandleFunc("/stats", hpc.handleStats)
+	mux.HandleFunc("/monitor", hpc.handleMonitor)
+	mux.HandleFunc("/autoscaler", hpc.handleAutoscaler)
+	mux.HandleFunc("/dags", hpc.handleDAGs)
+	mux.HandleFunc("/nodes/heartbeat", hpc.handleHeartbeat)
+	mux.HandleFunc("/nodes/drain", hpc.handleDrain)
+	mux.HandleFunc("/nodes/undrain", hpc.handleUndrain)
+	mux.HandleFunc("/nodes/events", hpc.handleNodeEvents)
+	mux.HandleFunc("/jobs/artifacts", hpc.handleArtifacts)
+	mux.HandleFunc("/usage", hpc.handleUsage)
+
+	hpc.httpServer = &http.Server{
+		Addr:    fmt.Sprintf(":%d", hpc.config.ServerPort),
+		Handler: mux,
+	}
+
+	log.Println("HPC Cluster Manager components initialized")
+}
+
+// Handler serves the HTTP API of the manager
+func (hpc *HPCClusterManager) Handler() http.Handler {
+	return hpc.httpServer.Handler
+}
+
+// Start runs the scheduler, the monitor, node failure detection and, when
+// ServerPort is set, the HTTP API
+func (hpc *HPCClusterManager) Start() {
+	// Start job scheduler
+	go hpc.runScheduler()
+
+	// Start cluster monitor
+	go hpc.runMonitor()
+
+	// Start node failure detection
+	if hpc.config.HeartbeatTimeout > 0 {
+		go hpc.runHeartbeatMonitor()
+	}
+
+	if hpc.config.ServerPort == 0 {
+		return
+	}
+	go func() {
+		if err := hpc.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP server error: %v", err)
+		}
+	}()
+
+	log.Printf("HPC Cluster Manager started on port %d", hpc.config.ServerPort)
+}
+
+// Shutdown stops scheduling and the HTTP API, refuses new submissions and
+// waits for running jobs to finish. Jobs still running when ctx expires are
+// left running and reported in the error.
+func (hpc *HPCClusterManager) Shutdown(ctx context.Context) error {
+	hpc.mutex.Lock()
+	if !hpc.stopping {
+		hpc.stopping = true
+		close(hpc.stop)
+		if hpc.autoscaler != nil {
+			close(hpc.autoscaler.stop)
+			hpc.autoscaler = nil
+		}
+	}
+	hpc.mutex.Unlock()
+
+	err := hpc.httpServer.Shutdown(ctx)
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		hpc.mutex.RLock()
+		running := len(hpc.running)
+		hpc.mutex.RUnlock()
+		if running == 0 {
+			log.Println("HPC Cluster Manager stopped")
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%d jobs still running: %w", running, ctx.Err())
+		}
+	}
+}
+
+// RegisterNode registers a compute node
+func (hpc *HPCClusterManager) RegisterNode(node *ComputeNode) error {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	if _, exists := hpc.nodes[node.ID]; exists {
+		return fmt.Errorf("node %s already exists", node.ID)
+	}
+
+	node.Status = "available"
+	node.Load = 0.0
+	node.JobsRunning = 0
+	node.Performance = NodePerformance{
+		LastUpdated: time.Now(),
+		Uptime:      0,
+	}
+
+	node.LastHeartbeat = time.Now()
+	node.Draining = false
+
+	hpc.nodes[node.ID] = node
+	atomic.AddInt32(&hpc.stats.TotalNodes, 1)
+	atomic.AddInt32(&hpc.stats.ActiveNodes, 1)
+	hpc.recordNodeEventLocked(node, "registered", "")
+
+	log.Printf("Node registered: %s (%d cores, %d GB RAM, %d GPUs)",
+		node.ID, node.CPUCores, node.Memory, node.GPUs)
+	return nil
+}
+
+// DeregisterNode removes an idle compute node from the cluster
+func (hpc *HPCClusterManager) DeregisterNode(nodeID string) error {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	node, exists := hpc.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %s not found", nodeID)
+	}
+	if node.JobsRunning > 0 {
+		return fmt.Errorf("node %s is running %d jobs", nodeID, node.JobsRunning)
+	}
+
+	delete(hpc.nodes, nodeID)
+	atomic.AddInt32(&hpc.stats.TotalNodes, -1)
+	if node.Status == "available" {
+		atomic.AddInt32(&hpc.stats.ActiveNodes, -1)
+	}
+	hpc.recordNodeEventLocked(node, "deregistered", "")
+
+	log.Printf("Node deregistered: %s", nodeID)
+	return nil
+}
+
+// SubmitJob submits a job to the cluster. A job with ArraySize or
+// ArrayParams is submitted as an array of tasks.
+func (hpc *HPCClusterManager) SubmitJob(job *HPCJob) error {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	if err := hpc.checkSubmittableLocked(job, nil); err != nil {
+		return err
+	}
+	hpc.submitJobLocked(job)
+	hpc.releaseWaitingJobsLocked()
+	return nil
+}
+
+// GetStats returns cluster statistics
+func (hpc *HPCClusterManager) GetStats() map[string]interface{} {
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+
+	return map[string]interface{}{
+		"total_nodes":         atomic.LoadInt32(&hpc.stats.TotalNodes),
+		"active_nodes":        atomic.LoadInt32(&hpc.stats.ActiveNodes),
+		"total_jobs":          atomic.LoadInt64(&hpc.stats.TotalJobs),
+		"running_jobs":        atomic.LoadInt32(&hpc.stats.RunningJobs),
+		"completed_jobs":      atomic.LoadInt64(&hpc.stats.CompletedJobs),
+		"failed_jobs":         atomic.LoadInt64(&hpc.stats.FailedJobs),
+		"preempted_jobs":      atomic.LoadInt64(&hpc.stats.PreemptedJobs),
+		"queued_jobs":         atomic.LoadInt32(&hpc.stats.QueuedJobs),
+		"cluster_utilization": hpc.stats.ClusterUtilization,
+		"throughput":          hpc.stats.Throughput,
+		"uptime":              time.Since(hpc.stats.StartTime).Seconds(),
+	}
+}
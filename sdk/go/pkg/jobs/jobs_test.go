@@ -0,0 +1,1063 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond, holding the manager's lock, until it holds
+func waitFor(t *testing.T, hpc *HPCClusterManager, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		hpc.mutex.RLock()
+		ok := cond()
+		hpc.mutex.RUnlock()
+		if ok {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// runningJob is a job already running on the node of a preemption test
+type runningJob struct {
+	id        string
+	priority  int
+	started   time.Duration // how long ago
+	noPreempt bool
+}
+
+// newPreemptionCluster runs jobs on a single node with slots slots and
+// queues a job of priority preemptor that fits the node but finds it full
+func newPreemptionCluster(t *testing.T, slots int, running []runningJob, preemptor int) (*HPCClusterManager, *ComputeNode, *HPCJob) {
+	t.Helper()
+	hpc := NewHPCClusterManager(HPCConfig{})
+	node := &ComputeNode{ID: "node-1", CPUCores: 16, Memory: 64, MaxJobs: slots}
+	if err := hpc.RegisterNode(node); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	hpc.mutex.Lock()
+	for _, r := range running {
+		job := &HPCJob{ID: r.id, Priority: r.priority, NoPreempt: r.noPreempt, Resources: ResourceRequest{CPUCores: 4, Memory: 8}}
+		hpc.addJobLocked(job)
+		hpc.startJobLocked(job, node)
+		started := now.Add(-r.started)
+		job.StartedAt = &started
+	}
+	job := &HPCJob{ID: "urgent", Priority: preemptor, Resources: ResourceRequest{CPUCores: 4, Memory: 8}}
+	hpc.addJobLocked(job)
+	hpc.mutex.Unlock()
+	t.Cleanup(func() {
+		hpc.mutex.Lock()
+		defer hpc.mutex.Unlock()
+		for _, cancel := range hpc.running {
+			cancel()
+		}
+	})
+	return hpc, node, job
+}
+
+func TestPreemptionOrder(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		slots     int
+		running   []runningJob
+		preemptor int
+		gap       int
+		want      string // the job preempted, none if empty
+	}{
+		{
+			name:      "lowest priority first",
+			running:   []runningJob{{"batch", 3, time.Minute, false}, {"scavenger", 1, time.Hour, false}},
+			preemptor: 5,
+			want:      "scavenger",
+		},
+		{
+			name:      "most recently started among equals",
+			running:   []runningJob{{"old", 2, time.Hour, false}, {"new", 2, time.Minute, false}},
+			preemptor: 5,
+			want:      "new",
+		},
+		{
+			name:      "no_preempt is skipped",
+			running:   []runningJob{{"pinned", 1, time.Minute, true}, {"batch", 3, time.Minute, false}},
+			preemptor: 5,
+			want:      "batch",
+		},
+		{
+			name:      "equal priority is not preempted",
+			running:   []runningJob{{"peer", 5, time.Minute, false}},
+			preemptor: 5,
+		},
+		{
+			name:      "within the priority gap",
+			running:   []runningJob{{"batch", 4, time.Minute, false}},
+			preemptor: 5,
+			gap:       2,
+		},
+		{
+			name:      "priority gap met",
+			running:   []runningJob{{"batch", 3, time.Minute, false}},
+			preemptor: 5,
+			gap:       2,
+			want:      "batch",
+		},
+		{
+			name:      "node with a free slot",
+			slots:     2,
+			running:   []runningJob{{"batch", 1, time.Minute, false}},
+			preemptor: 5,
+		},
+		{
+			name:      "only no_preempt jobs",
+			running:   []runningJob{{"pinned", 1, time.Minute, true}},
+			preemptor: 9,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			slots := tt.slots
+			if slots == 0 {
+				slots = len(tt.running)
+			}
+			hpc, node, urgent := newPreemptionCluster(t, slots, tt.running, tt.preemptor)
+			hpc.ConfigureScheduler(SchedulerConfig{Algorithm: "fifo", EnablePreemption: true, PreemptionPriorityGap: tt.gap})
+			hpc.tryPreemption(urgent, []*ComputeNode{node}, hpc.scheduler.config)
+
+			if tt.want == "" {
+				hpc.mutex.RLock()
+				defer hpc.mutex.RUnlock()
+				for _, r := range tt.running {
+					if status := hpc.jobs[r.id].Status; status != "running" {
+						t.Errorf("%s is %s, want it left running", r.id, status)
+					}
+				}
+				if hpc.isReservedLocked(urgent.ID) {
+					t.Error("a slot was reserved without a victim")
+				}
+				return
+			}
+
+			waitFor(t, hpc, "the preemptor to start", func() bool { return urgent.Status == "running" })
+			hpc.mutex.RLock()
+			defer hpc.mutex.RUnlock()
+			for _, r := range tt.running {
+				job := hpc.jobs[r.id]
+				switch {
+				case r.id == tt.want && (job.Status != "queued" || job.PreemptionCount != 1 || job.Metadata["preempted_by"] != urgent.ID):
+					t.Errorf("victim %s: status %s, %d preemption(s), preempted by %q", r.id, job.Status, job.PreemptionCount, job.Metadata["preempted_by"])
+				case r.id != tt.want && job.Status != "running":
+					t.Errorf("%s is %s, want only %s preempted", r.id, job.Status, tt.want)
+				}
+			}
+			if urgent.NodeID != node.ID || node.JobsRunning != slots {
+				t.Errorf("preemptor on %q, node running %d jobs", urgent.NodeID, node.JobsRunning)
+			}
+			if hpc.stats.PreemptedJobs != 1 {
+				t.Errorf("PreemptedJobs = %d, want 1", hpc.stats.PreemptedJobs)
+			}
+		})
+	}
+}
+
+func TestPreemptionCheckpoint(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		policy *CheckpointPolicy
+		hook   CheckpointHook
+		want   string
+		signal string
+	}{
+		{
+			name:   "checkpoint taken",
+			policy: &CheckpointPolicy{Signal: "SIGUSR1"},
+			hook: func(ctx context.Context, job *HPCJob, signal string) (string, error) {
+				return "ckpt-2", nil
+			},
+			want:   "ckpt-2",
+			signal: "SIGUSR1",
+		},
+		{
+			name:   "default signal",
+			policy: &CheckpointPolicy{},
+			hook: func(ctx context.Context, job *HPCJob, signal string) (string, error) {
+				return "ckpt-2", nil
+			},
+			want:   "ckpt-2",
+			signal: "SIGTERM",
+		},
+		{
+			name:   "hook failed",
+			policy: &CheckpointPolicy{},
+			hook: func(ctx context.Context, job *HPCJob, signal string) (string, error) {
+				return "", errors.New("disk full")
+			},
+			want:   "ckpt-1",
+			signal: "SIGTERM",
+		},
+		{
+			name:   "grace period exceeded",
+			policy: &CheckpointPolicy{GracePeriod: 10 * time.Millisecond},
+			hook: func(ctx context.Context, job *HPCJob, signal string) (string, error) {
+				<-ctx.Done()
+				return "ckpt-late", nil
+			},
+			want:   "ckpt-1",
+			signal: "SIGTERM",
+		},
+		{
+			name: "job without a checkpoint policy",
+			hook: func(ctx context.Context, job *HPCJob, signal string) (string, error) {
+				return "ckpt-2", nil
+			},
+			want: "ckpt-1",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			hpc, node, urgent := newPreemptionCluster(t, 1, []runningJob{{"batch", 1, time.Minute, false}}, 5)
+			hpc.ConfigureScheduler(SchedulerConfig{Algorithm: "fifo", EnablePreemption: true})
+			var signal string
+			hpc.SetCheckpointHook(func(ctx context.Context, job *HPCJob, sig string) (string, error) {
+				signal = sig
+				return tt.hook(ctx, job, sig)
+			})
+			hpc.mutex.Lock()
+			victim := hpc.jobs["batch"]
+			victim.Checkpoint, victim.CheckpointRef = tt.policy, "ckpt-1"
+			hpc.mutex.Unlock()
+
+			hpc.tryPreemption(urgent, []*ComputeNode{node}, hpc.scheduler.config)
+			waitFor(t, hpc, "the victim to be requeued", func() bool { return victim.Status == "queued" })
+			hpc.mutex.RLock()
+			defer hpc.mutex.RUnlock()
+			if victim.CheckpointRef != tt.want || signal != tt.signal {
+				t.Errorf("checkpoint %q after %q, want %q after %q", victim.CheckpointRef, signal, tt.want, tt.signal)
+			}
+			// The preempted run is charged to its account
+			if len(hpc.usage) != 1 || hpc.usage[0].JobID != "batch" {
+				t.Errorf("usage = %+v", hpc.usage)
+			}
+		})
+	}
+}
+
+func TestDAGValidate(t *testing.T) {
+	job := func(id string, deps ...string) *HPCJob {
+		return &HPCJob{ID: id, DependsOn: deps}
+	}
+	for _, tt := range []struct {
+		name string
+		dag  JobDAG
+		want string // in the error, none if empty
+	}{
+		{"fan-out and fan-in", JobDAG{ID: "d", Jobs: []*HPCJob{job("prepare"), job("left", "prepare"), job("right", "prepare"), job("reduce", "left", "right")}}, ""},
+		{"dependency outside the DAG", JobDAG{ID: "d", Jobs: []*HPCJob{job("report", "nightly-etl")}}, ""},
+		{"two-job cycle", JobDAG{ID: "d", Jobs: []*HPCJob{job("a", "b"), job("b", "a")}}, "dependency cycle a -> b -> a"},
+		{"self dependency", JobDAG{ID: "d", Jobs: []*HPCJob{job("a", "a")}}, "dependency cycle a -> a"},
+		{"cycle past a sound prefix", JobDAG{ID: "d", Jobs: []*HPCJob{job("root"), job("x", "root", "z"), job("y", "x"), job("z", "y")}}, "dependency cycle x -> z -> y -> x"},
+		{"duplicate job", JobDAG{ID: "d", Jobs: []*HPCJob{job("a"), job("a")}}, "duplicate job a"},
+		{"job without an id", JobDAG{ID: "d", Jobs: []*HPCJob{job("")}}, "job id is required"},
+		{"no jobs", JobDAG{ID: "d"}, "has no jobs"},
+		{"no id", JobDAG{Jobs: []*HPCJob{job("a")}}, "dag id is required"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.dag.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// A DAG that does not validate submits none of its jobs
+	hpc := NewHPCClusterManager(HPCConfig{})
+	if err := hpc.SubmitDAG(&JobDAG{ID: "d", Jobs: []*HPCJob{job("a"), job("b", "c"), job("c", "b")}}); err == nil {
+		t.Fatal("SubmitDAG accepted a cycle")
+	}
+	if err := hpc.SubmitDAG(&JobDAG{ID: "e", Jobs: []*HPCJob{job("report", "nightly-etl")}}); err == nil {
+		t.Error("SubmitDAG accepted a dependency on an unknown job")
+	}
+	if len(hpc.jobs) != 0 || len(hpc.dags) != 0 {
+		t.Errorf("rejected DAGs left %d job(s) and %d DAG(s)", len(hpc.jobs), len(hpc.dags))
+	}
+}
+
+func TestFairShareFactors(t *testing.T) {
+	const halfLife = 7 * 24 * time.Hour
+	usage := func(user, team string, ago time.Duration, cpuHours, gpuHours float64) UsageRecord {
+		end := time.Now().Add(-ago)
+		return UsageRecord{JobID: user + "-job", User: user, Team: team, Start: end.Add(-time.Hour), End: end, CPUHours: cpuHours, GPUHours: gpuHours}
+	}
+	for _, tt := range []struct {
+		name   string
+		by     string
+		usage  []UsageRecord
+		queued []string // users with a queued job
+		want   map[string]float64
+	}{
+		{
+			name:   "no usage yet",
+			queued: []string{"alice", "bob"},
+			want:   map[string]float64{"alice": 1, "bob": 1},
+		},
+		{
+			name:  "equal usage",
+			usage: []UsageRecord{usage("alice", "physics", 0, 10, 0), usage("bob", "ml", 0, 10, 0)},
+			want:  map[string]float64{"alice": 0.5, "bob": 0.5},
+		},
+		{
+			name:  "heavy and light",
+			usage: []UsageRecord{usage("alice", "physics", 0, 30, 0), usage("bob", "ml", 0, 10, 0)},
+			want:  map[string]float64{"alice": math.Pow(2, -1.5), "bob": math.Pow(2, -0.5)},
+		},
+		{
+			name:  "gpu-hours weighted",
+			usage: []UsageRecord{usage("alice", "physics", 0, 10, 0), usage("bob", "ml", 0, 0, 1)},
+			want:  map[string]float64{"alice": 0.5, "bob": 0.5},
+		},
+		{
+			name:  "usage decays with the half-life",
+			usage: []UsageRecord{usage("alice", "physics", halfLife, 20, 0), usage("bob", "ml", 0, 10, 0)},
+			want:  map[string]float64{"alice": 0.5, "bob": 0.5},
+		},
+		{
+			name:   "queued account without usage",
+			usage:  []UsageRecord{usage("alice", "physics", 0, 10, 0)},
+			queued: []string{"bob"},
+			want:   map[string]float64{"alice": 0.25, "bob": 1},
+		},
+		{
+			name:  "by team",
+			by:    "team",
+			usage: []UsageRecord{usage("alice", "physics", 0, 10, 0), usage("bob", "physics", 0, 10, 0), usage("carol", "ml", 0, 20, 0)},
+			want:  map[string]float64{"physics": 0.5, "ml": 0.5},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			hpc := NewHPCClusterManager(HPCConfig{})
+			hpc.ConfigureScheduler(SchedulerConfig{FairShareBy: tt.by, FairShareWeight: 10, FairShareHalfLife: halfLife})
+			hpc.usage = tt.usage
+			for _, user := range tt.queued {
+				hpc.addJobLocked(&HPCJob{ID: user + "-queued", Metadata: map[string]string{"user": user}})
+			}
+			got := hpc.FairShareFactors()
+			if len(got) != len(tt.want) {
+				t.Errorf("factors = %v, want %v", got, tt.want)
+			}
+			for account, want := range tt.want {
+				if math.Abs(got[account]-want) > 1e-6 {
+					t.Errorf("factor of %s = %f, want %f", account, got[account], want)
+				}
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	hpc := NewHPCClusterManager(HPCConfig{})
+	node := &ComputeNode{ID: "gpu-1", CPUCores: 32, Memory: 128, GPUs: 4, MaxJobs: 4}
+	if err := hpc.RegisterNode(node); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	preempted := &HPCJob{ID: "train", Resources: ResourceRequest{CPUCores: 8, GPUs: 2, Nodes: 2}, Metadata: map[string]string{"user": "ravi", "team": "ml"}}
+	hpc.mutex.Lock()
+	hpc.addJobLocked(preempted)
+	// Two runs of one job, two hours on two nodes before being preempted
+	// and one hour since
+	for _, run := range []struct{ start, end time.Time }{
+		{now.Add(-5 * time.Hour), now.Add(-3 * time.Hour)},
+		{now.Add(-2 * time.Hour), now.Add(-time.Hour)},
+	} {
+		start := run.start
+		preempted.StartedAt = &start
+		hpc.recordUsageLocked(preempted, run.end)
+	}
+	preempted.StartedAt = nil
+	running := &HPCJob{ID: "sim", Resources: ResourceRequest{CPUCores: 4}, Metadata: map[string]string{"user": "kim", "team": "physics"}}
+	hpc.addJobLocked(running)
+	hpc.startJobLocked(running, node)
+	started := now.Add(-30 * time.Minute)
+	running.StartedAt = &started
+	hpc.addJobLocked(&HPCJob{ID: "untagged", Resources: ResourceRequest{CPUCores: 2}})
+	hpc.mutex.Unlock()
+	t.Cleanup(func() {
+		hpc.mutex.Lock()
+		defer hpc.mutex.Unlock()
+		hpc.running["sim"]()
+	})
+
+	for _, tt := range []struct {
+		by    string
+		since time.Time
+		want  []UsageSummary
+	}{
+		{"user", time.Time{}, []UsageSummary{{"ravi", 1, 48, 12}, {"kim", 1, 2, 0}}},
+		{"team", time.Time{}, []UsageSummary{{"ml", 1, 48, 12}, {"physics", 1, 2, 0}}},
+		// Only the second run of the preempted job ended in the window
+		{"user", now.Add(-2 * time.Hour), []UsageSummary{{"ravi", 1, 16, 4}, {"kim", 1, 2, 0}}},
+	} {
+		got := hpc.Usage(tt.by, tt.since)
+		if len(got) != len(tt.want) {
+			t.Errorf("Usage(%s, %s) = %+v, want %+v", tt.by, tt.since, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].Account != tt.want[i].Account || got[i].Jobs != tt.want[i].Jobs ||
+				math.Abs(got[i].CPUHours-tt.want[i].CPUHours) > 0.01 || math.Abs(got[i].GPUHours-tt.want[i].GPUHours) > 0.01 {
+				t.Errorf("Usage(%s, %s)[%d] = %+v, want %+v", tt.by, tt.since, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+// scalingRecorder is a cloud provider whose calls the test inspects
+type scalingRecorder struct {
+	mu         sync.Mutex
+	launched   int
+	terminated []string
+}
+
+func (r *scalingRecorder) provider() *CloudScalingProvider {
+	return &CloudScalingProvider{
+		Provider: "test",
+		Launch: func(ctx context.Context, count int) ([]*ComputeNode, error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			nodes := make([]*ComputeNode, count)
+			for i := range nodes {
+				r.launched++
+				nodes[i] = &ComputeNode{ID: fmt.Sprintf("auto-%d", r.launched), CPUCores: 8, Memory: 32, MaxJobs: 2}
+			}
+			return nodes, nil
+		},
+		Terminate: func(ctx context.Context, nodeIDs []string) error {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.terminated = append(r.terminated, nodeIDs...)
+			return nil
+		},
+	}
+}
+
+// enableAutoscaler enables an autoscaler that only evaluates when the
+// test calls Evaluate
+func enableAutoscaler(t *testing.T, hpc *HPCClusterManager, config AutoscalerConfig, provider ScalingProvider) *Autoscaler {
+	t.Helper()
+	config.EvaluationInterval = time.Hour
+	as := hpc.EnableAutoscaler(config, provider)
+	t.Cleanup(func() { close(as.stop) })
+	return as
+}
+
+func TestAutoscaler(t *testing.T) {
+	hpc := NewHPCClusterManager(HPCConfig{MaxNodes: 3})
+	if err := hpc.RegisterNode(&ComputeNode{ID: "static-1", CPUCores: 8, Memory: 32, MaxJobs: 2}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := &scalingRecorder{}
+	as := enableAutoscaler(t, hpc, AutoscalerConfig{
+		ScaleUpQueueDepth: 2,
+		ScaleUpStep:       5,
+		ScaleUpCooldown:   time.Hour,
+		ScaleDownIdleTime: time.Millisecond,
+		ScaleDownStep:     5,
+		MinNodes:          1,
+	}, recorder.provider())
+
+	// One queued job is below the threshold
+	hpc.SubmitJob(&HPCJob{ID: "a", Resources: ResourceRequest{CPUCores: 1}})
+	as.Evaluate()
+	if decisions := as.Decisions(); len(decisions) != 0 {
+		t.Fatalf("decisions below the queue threshold: %+v", decisions)
+	}
+
+	// Two are not, and the cluster grows up to MaxNodes
+	hpc.SubmitJob(&HPCJob{ID: "b", Resources: ResourceRequest{CPUCores: 1}})
+	as.Evaluate()
+	decisions := as.Decisions()
+	if len(decisions) != 1 || decisions[0].Action != "scale_up" || decisions[0].Count != 2 || decisions[0].State.QueueDepth != 2 {
+		t.Fatalf("decisions = %+v, want one scale-up by 2", decisions)
+	}
+	hpc.mutex.RLock()
+	for _, id := range []string{"auto-1", "auto-2"} {
+		if node, ok := hpc.nodes[id]; !ok || node.Status != "available" || node.Metadata["autoscaled"] != "true" {
+			t.Errorf("node %s = %+v, want it registered as autoscaled", id, node)
+		}
+	}
+	hpc.mutex.RUnlock()
+
+	// The cooldown holds off another scale-up
+	as.Evaluate()
+	if decisions := as.Decisions(); len(decisions) != 1 || recorder.launched != 2 {
+		t.Errorf("scaled again within the cooldown: %+v", decisions)
+	}
+
+	// With the queue empty the idle autoscaled nodes go, the static one stays
+	hpc.mutex.Lock()
+	for _, id := range []string{"a", "b"} {
+		hpc.cancelJobLocked(hpc.jobs[id], "test")
+	}
+	hpc.mutex.Unlock()
+	as.Evaluate()
+	time.Sleep(5 * time.Millisecond)
+	as.Evaluate()
+	decisions = as.Decisions()
+	if len(decisions) != 2 || decisions[1].Action != "scale_down" || strings.Join(decisions[1].NodeIDs, ",") != "auto-1,auto-2" {
+		t.Fatalf("decisions = %+v, want a scale-down of auto-1 and auto-2", decisions)
+	}
+	if strings.Join(recorder.terminated, ",") != "auto-1,auto-2" {
+		t.Errorf("terminated %v", recorder.terminated)
+	}
+	hpc.mutex.RLock()
+	if _, ok := hpc.nodes["static-1"]; !ok || len(hpc.nodes) != 1 {
+		t.Errorf("nodes after the scale-down = %v", hpc.nodes)
+	}
+	hpc.mutex.RUnlock()
+}
+
+func TestAutoscalerWaitTimeAndDryRun(t *testing.T) {
+	hpc := NewHPCClusterManager(HPCConfig{MaxNodes: 4})
+	recorder := &scalingRecorder{}
+	as := enableAutoscaler(t, hpc, AutoscalerConfig{DryRun: true, ScaleUpWaitTime: time.Millisecond}, recorder.provider())
+
+	hpc.SubmitJob(&HPCJob{ID: "slow", Resources: ResourceRequest{CPUCores: 1}})
+	time.Sleep(5 * time.Millisecond)
+	as.Evaluate()
+	decisions := as.Decisions()
+	if len(decisions) != 1 || !decisions[0].DryRun || decisions[0].Count != 1 || !strings.Contains(decisions[0].Reason, "oldest queued job waited") {
+		t.Fatalf("decisions = %+v, want one dry-run scale-up for the wait", decisions)
+	}
+	if recorder.launched != 0 || len(hpc.nodes) != 0 {
+		t.Errorf("a dry run launched %d node(s), registered %d", recorder.launched, len(hpc.nodes))
+	}
+}
+
+func TestScalingProviders(t *testing.T) {
+	state := ScalingState{QueueDepth: 3, ActiveNodes: 1}
+
+	// The webhook gets the action and the state, and answers the nodes
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		body["auth"] = r.Header.Get("Authorization")
+		requests = append(requests, body)
+		if body["action"] == "scale_up" {
+			fmt.Fprint(w, `{"nodes": [{"id": "hook-1", "cpu_cores": 4, "max_jobs": 1}]}`)
+		}
+	}))
+	defer server.Close()
+	webhook := &WebhookScalingProvider{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer x"}}
+	nodes, err := webhook.ScaleUp(context.Background(), 1, state)
+	if err != nil || len(nodes) != 1 || nodes[0].ID != "hook-1" || nodes[0].CPUCores != 4 {
+		t.Errorf("webhook ScaleUp() = %+v, %v", nodes, err)
+	}
+	if err := webhook.ScaleDown(context.Background(), []string{"hook-1"}, state); err != nil {
+		t.Errorf("webhook ScaleDown() = %v", err)
+	}
+	if len(requests) != 2 || requests[0]["count"] != float64(1) || requests[0]["auth"] != "Bearer x" ||
+		requests[1]["action"] != "scale_down" || fmt.Sprint(requests[1]["node_ids"]) != "[hook-1]" {
+		t.Errorf("webhook requests = %v", requests)
+	}
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer failing.Close()
+	if _, err := (&WebhookScalingProvider{URL: failing.URL}).ScaleUp(context.Background(), 1, state); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("webhook ScaleUp() against a failing hook = %v", err)
+	}
+
+	// The script gets its arguments and the state in its environment
+	dir := t.TempDir()
+	script := filepath.Join(dir, "scale.sh")
+	calls := filepath.Join(dir, "calls")
+	os.WriteFile(script, []byte(`#!/bin/sh
+echo "$* $HPC_QUEUE_DEPTH $HPC_ACTIVE_NODES" >> "`+calls+`"
+if [ "$1" = up ]; then echo '[{"id": "sh-1", "max_jobs": 2}]'; fi
+`), 0755)
+	shell := &ShellScalingProvider{Script: script}
+	nodes, err = shell.ScaleUp(context.Background(), 2, state)
+	if err != nil || len(nodes) != 1 || nodes[0].ID != "sh-1" {
+		t.Errorf("shell ScaleUp() = %+v, %v", nodes, err)
+	}
+	if err := shell.ScaleDown(context.Background(), []string{"sh-1", "sh-2"}, state); err != nil {
+		t.Errorf("shell ScaleDown() = %v", err)
+	}
+	if data, _ := os.ReadFile(calls); string(data) != "up 2 3 1\ndown sh-1 sh-2 3 1\n" {
+		t.Errorf("script calls = %q", data)
+	}
+	if _, err := (&ShellScalingProvider{Script: filepath.Join(dir, "missing")}).ScaleUp(context.Background(), 1, state); err == nil {
+		t.Error("ScaleUp() with a missing script succeeded")
+	}
+
+	if _, err := (&CloudScalingProvider{Provider: "aws"}).ScaleUp(context.Background(), 1, state); err == nil {
+		t.Error("ScaleUp() of a cloud provider without Launch succeeded")
+	}
+}
+
+// runJob starts the job id on node and completes it with success
+func runJob(t *testing.T, hpc *HPCClusterManager, node *ComputeNode, id string, success bool) {
+	t.Helper()
+	hpc.mutex.Lock()
+	job, ok := hpc.jobs[id]
+	if !ok || job.Status != "queued" {
+		hpc.mutex.Unlock()
+		t.Fatalf("job %s = %+v, want it queued", id, job)
+	}
+	hpc.startJobLocked(job, node)
+	hpc.mutex.Unlock()
+	hpc.completeJob(job, node, success)
+}
+
+func TestJobArray(t *testing.T) {
+	hpc := NewHPCClusterManager(HPCConfig{})
+	err := hpc.SubmitJob(&HPCJob{
+		ID:          "sweep",
+		Name:        "sweep {{index}}",
+		Command:     "train",
+		Arguments:   []string{"--lr={{param}}"},
+		ArrayParams: []string{"0.1", "0.01"},
+		Metadata:    map[string]string{"user": "ada"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(hpc.arrays["sweep"], ","); got != "sweep[0],sweep[1]" {
+		t.Fatalf("array tasks = %s", got)
+	}
+	task := hpc.jobs["sweep[1]"]
+	if task.Name != "sweep 1" || task.Arguments[0] != "--lr=0.01" || task.ArrayID != "sweep" || task.ArrayIndex != 1 ||
+		task.Status != "queued" || task.Metadata["array_param"] != "0.01" || task.Metadata["user"] != "ada" {
+		t.Errorf("task sweep[1] = %+v", task)
+	}
+	if hpc.jobs["sweep[0]"].Arguments[0] != "--lr=0.1" {
+		t.Errorf("task sweep[0] shares the arguments of another task: %v", hpc.jobs["sweep[0]"].Arguments)
+	}
+
+	// A dependency on the array waits for every task
+	if err := hpc.SubmitJob(&HPCJob{ID: "merge", DependsOn: []string{"sweep"}}); err != nil {
+		t.Fatal(err)
+	}
+	node := &ComputeNode{ID: "node-1", CPUCores: 8, Memory: 32, MaxJobs: 4}
+	hpc.RegisterNode(node)
+	runJob(t, hpc, node, "sweep[0]", true)
+	if status := hpc.jobs["merge"].Status; status != "waiting" {
+		t.Errorf("merge is %s with a task left, want waiting", status)
+	}
+	runJob(t, hpc, node, "sweep[1]", true)
+	if status := hpc.jobs["merge"].Status; status != "queued" {
+		t.Errorf("merge is %s once the array completed, want queued", status)
+	}
+
+	for _, job := range []*HPCJob{
+		{ID: "sweep"},
+		{ID: "bad", ArraySize: 3, ArrayParams: []string{"a"}},
+		{ID: "orphan", DependsOn: []string{"nowhere"}},
+		{ID: "policy", OnDependencyFailure: "retry"},
+	} {
+		if err := hpc.SubmitJob(job); err == nil {
+			t.Errorf("SubmitJob(%s) succeeded", job.ID)
+		}
+	}
+}
+
+func TestDAGStatus(t *testing.T) {
+	hpc := NewHPCClusterManager(HPCConfig{})
+	node := &ComputeNode{ID: "node-1", CPUCores: 8, Memory: 32, MaxJobs: 4}
+	hpc.RegisterNode(node)
+	err := hpc.SubmitDAG(&JobDAG{ID: "pipeline", Name: "nightly", Jobs: []*HPCJob{
+		{ID: "prepare"},
+		{ID: "sweep", ArraySize: 2, DependsOn: []string{"prepare"}},
+		{ID: "reduce", DependsOn: []string{"sweep"}},
+		{ID: "report", DependsOn: []string{"reduce"}, OnDependencyFailure: "continue"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := func() map[string]DAGNodeStatus {
+		t.Helper()
+		_, nodes, err := hpc.DAGStatus("pipeline")
+		if err != nil {
+			t.Fatal(err)
+		}
+		byID := make(map[string]DAGNodeStatus, len(nodes))
+		for i, n := range nodes {
+			if i > 0 && n.Level < nodes[i-1].Level {
+				t.Errorf("DAGStatus() is not in level order: %+v", nodes)
+			}
+			byID[n.ID] = n
+		}
+		return byID
+	}
+	got := status()
+	for id, want := range map[string]struct {
+		status string
+		level  int
+	}{"prepare": {"queued", 0}, "sweep": {"waiting", 1}, "reduce": {"waiting", 2}, "report": {"waiting", 3}} {
+		if got[id].Status != want.status || got[id].Level != want.level {
+			t.Errorf("%s = %+v, want %s at level %d", id, got[id], want.status, want.level)
+		}
+	}
+
+	// Fan-out: the tasks queue once prepare completes
+	runJob(t, hpc, node, "prepare", true)
+	if sweep := status()["sweep"]; sweep.Status != "queued" || sweep.Tasks["queued"] != 2 {
+		t.Errorf("sweep = %+v, want 2 queued tasks", sweep)
+	}
+	runJob(t, hpc, node, "sweep[0]", true)
+	hpc.mutex.Lock()
+	hpc.startJobLocked(hpc.jobs["sweep[1]"], node)
+	hpc.mutex.Unlock()
+	if sweep := status()["sweep"]; sweep.Status != "running" || sweep.Tasks["completed"] != 1 || sweep.Tasks["running"] != 1 {
+		t.Errorf("sweep = %+v, want one task running and one completed", sweep)
+	}
+
+	// Fan-in: a failed task cancels reduce; report continues regardless
+	hpc.completeJob(hpc.jobs["sweep[1]"], node, false)
+	got = status()
+	if got["sweep"].Status != "failed" || got["reduce"].Status != "cancelled" || got["report"].Status != "queued" {
+		t.Errorf("after a failed task: sweep %s, reduce %s, report %s", got["sweep"].Status, got["reduce"].Status, got["report"].Status)
+	}
+
+	dag, nodes, _ := hpc.DAGStatus("pipeline")
+	ascii := RenderDAGASCII(dag, nodes)
+	for _, want := range []string{"DAG pipeline (nightly)", "├─ stage 3", "sweep", "failed (1 completed, 1 failed)  ◀ prepare"} {
+		if !strings.Contains(ascii, want) {
+			t.Errorf("RenderDAGASCII() lacks %q:\n%s", want, ascii)
+		}
+	}
+	mermaid := RenderDAGMermaid(dag, nodes)
+	for _, want := range []string{"graph TD", "n0 --> n1", "n2 --> n3", `n2["reduce<br/>cancelled"]:::cancelled`} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("RenderDAGMermaid() lacks %q:\n%s", want, mermaid)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	hpc.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dags?id=pipeline&format=ascii", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != ascii {
+		t.Errorf("GET /dags?format=ascii = %d:\n%s", rec.Code, rec.Body)
+	}
+	if _, _, err := hpc.DAGStatus("missing"); err == nil {
+		t.Error("DAGStatus() of an unknown DAG succeeded")
+	}
+}
+
+func TestDAGFailFast(t *testing.T) {
+	hpc := NewHPCClusterManager(HPCConfig{})
+	node := &ComputeNode{ID: "node-1", CPUCores: 8, Memory: 32, MaxJobs: 4}
+	hpc.RegisterNode(node)
+	err := hpc.SubmitDAG(&JobDAG{ID: "ff", FailFast: true, Jobs: []*HPCJob{
+		{ID: "a"}, {ID: "b"}, {ID: "c", DependsOn: []string{"a"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runJob(t, hpc, node, "a", false)
+	for _, id := range []string{"b", "c"} {
+		if job := hpc.jobs[id]; job.Status != "cancelled" || !strings.Contains(job.Error, "dag ff failed at a") {
+			t.Errorf("%s = %s (%s), want cancelled by the failure of a", id, job.Status, job.Error)
+		}
+	}
+}
+
+// eventTypes lists the types of the events of a node
+func eventTypes(t *testing.T, hpc *HPCClusterManager, nodeID string) string {
+	t.Helper()
+	events, err := hpc.NodeEvents(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return strings.Join(types, ",")
+}
+
+// silence makes node miss its heartbeats and runs failure detection
+func silence(hpc *HPCClusterManager, node *ComputeNode) {
+	hpc.mutex.Lock()
+	node.LastHeartbeat = time.Now().Add(-time.Minute)
+	hpc.mutex.Unlock()
+	hpc.checkHeartbeats()
+}
+
+func TestNodeFailureReschedulesJobs(t *testing.T) {
+	hpc := NewHPCClusterManager(HPCConfig{HeartbeatTimeout: time.Second, DefaultRetry: RetryPolicy{MaxRetries: 1, Backoff: time.Hour}})
+	node := &ComputeNode{ID: "node-1", CPUCores: 8, Memory: 32, MaxJobs: 2}
+	hpc.RegisterNode(node)
+	job := &HPCJob{ID: "sim", Resources: ResourceRequest{CPUCores: 2}, Metadata: map[string]string{"user": "kim"}}
+	hpc.SubmitJob(job)
+	start := func() {
+		hpc.mutex.Lock()
+		defer hpc.mutex.Unlock()
+		hpc.startJobLocked(job, node)
+	}
+	start()
+
+	// A node that heartbeats in time is left alone
+	hpc.checkHeartbeats()
+	if node.Status != "available" || job.Status != "running" {
+		t.Fatalf("a healthy node is %s, its job %s", node.Status, job.Status)
+	}
+
+	// A silent one is marked unhealthy and its job requeued with backoff
+	silence(hpc, node)
+	if node.Status != "unhealthy" || node.JobsRunning != 0 {
+		t.Errorf("silent node = %s with %d jobs, want unhealthy and empty", node.Status, node.JobsRunning)
+	}
+	if job.Status != "queued" || job.Attempts != 1 || job.NodeID != "" || job.Metadata["lost_on_node"] != "node-1" ||
+		job.RetryAfter == nil || time.Until(*job.RetryAfter) < 59*time.Minute {
+		t.Errorf("lost job = %+v, want it requeued after the backoff", job)
+	}
+	if len(hpc.usage) != 1 || hpc.usage[0].JobID != "sim" {
+		t.Errorf("the lost run was not charged: %+v", hpc.usage)
+	}
+
+	// A heartbeat returns it to service with its metrics
+	if err := hpc.Heartbeat("node-1", &NodePerformance{CPUUtilization: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	if node.Status != "available" || node.Performance.CPUUtilization != 0.5 || node.Performance.LastUpdated.IsZero() {
+		t.Errorf("node after a heartbeat = %+v", node)
+	}
+
+	// Past MaxRetries the job fails
+	start()
+	silence(hpc, node)
+	if job.Status != "failed" || !strings.Contains(job.Error, "retries exhausted after 2 attempts") {
+		t.Errorf("job lost twice = %s (%s), want failed", job.Status, job.Error)
+	}
+	if got := eventTypes(t, hpc, "node-1"); got != "registered,unhealthy,job_rescheduled,recovered,unhealthy,job_lost" {
+		t.Errorf("node events = %s", got)
+	}
+	if err := hpc.Heartbeat("node-9", nil); err == nil {
+		t.Error("Heartbeat() of an unknown node succeeded")
+	}
+}
+
+func TestDrainNode(t *testing.T) {
+	hpc := NewHPCClusterManager(HPCConfig{HeartbeatTimeout: time.Second})
+	busy := &ComputeNode{ID: "busy", CPUCores: 8, Memory: 32, MaxJobs: 2}
+	idle := &ComputeNode{ID: "idle", CPUCores: 8, Memory: 32, MaxJobs: 2}
+	hpc.RegisterNode(busy)
+	hpc.RegisterNode(idle)
+	hpc.SubmitJob(&HPCJob{ID: "long", Resources: ResourceRequest{CPUCores: 2}})
+	hpc.mutex.Lock()
+	hpc.startJobLocked(hpc.jobs["long"], busy)
+	hpc.mutex.Unlock()
+
+	// A node with jobs drains once they finish
+	if err := hpc.DrainNode("busy"); err != nil {
+		t.Fatal(err)
+	}
+	if busy.Status != "draining" || hpc.jobs["long"].Status != "running" {
+		t.Errorf("draining node = %s, its job %s", busy.Status, hpc.jobs["long"].Status)
+	}
+	hpc.SubmitJob(&HPCJob{ID: "next", Resources: ResourceRequest{CPUCores: 2}})
+	hpc.DrainNode("idle")
+	hpc.scheduleJobs()
+	if status := hpc.jobs["next"].Status; status != "queued" {
+		t.Errorf("a job was placed on a draining node: %s", status)
+	}
+	hpc.completeJob(hpc.jobs["long"], busy, true)
+	if busy.Status != "drained" || busy.JobsRunning != 0 {
+		t.Errorf("node after its last job = %s", busy.Status)
+	}
+	if got := eventTypes(t, hpc, "busy"); got != "registered,drain_requested,drained" {
+		t.Errorf("busy node events = %s", got)
+	}
+
+	// An empty node drains at once, and stays drained through a failure
+	if idle.Status != "drained" {
+		t.Errorf("empty node = %s, want drained", idle.Status)
+	}
+	silence(hpc, idle)
+	hpc.Heartbeat("idle", nil)
+	if idle.Status != "drained" {
+		t.Errorf("drained node after recovering = %s, want drained", idle.Status)
+	}
+
+	// Undraining returns nodes to service
+	hpc.UndrainNode("idle")
+	if idle.Status != "available" || idle.Draining {
+		t.Errorf("undrained node = %s", idle.Status)
+	}
+	hpc.scheduleJobs()
+	if job := hpc.jobs["next"]; job.Status != "running" || job.NodeID != "idle" {
+		t.Errorf("next = %s on %q, want it running on the undrained node", job.Status, job.NodeID)
+	}
+	if stats := hpc.GetStats(); stats["active_nodes"] != int32(1) {
+		t.Errorf("active nodes = %v, want 1", stats["active_nodes"])
+	}
+	hpc.mutex.Lock()
+	hpc.running["next"]()
+	hpc.mutex.Unlock()
+	if err := hpc.DrainNode("node-9"); err == nil {
+		t.Error("DrainNode() of an unknown node succeeded")
+	}
+}
+
+func TestArtifacts(t *testing.T) {
+	store := t.TempDir()
+	hpc := NewHPCClusterManager(HPCConfig{ArtifactDir: store})
+	node := &ComputeNode{ID: "node-1", CPUCores: 8, Memory: 32, MaxJobs: 4}
+	hpc.RegisterNode(node)
+
+	// Two jobs write the same result; the first also a log of its own
+	workDir := func(files map[string]string) string {
+		dir := t.TempDir()
+		for name, content := range files {
+			os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+			os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		}
+		return dir
+	}
+	short := &HPCJob{ID: "short", WorkDir: workDir(map[string]string{"out/result.txt": "42", "logs/run.log": "ok", "scratch.tmp": "x"}),
+		Artifacts: []string{"out/*.txt", "logs", "missing/*"}, ArtifactTTL: time.Millisecond}
+	kept := &HPCJob{ID: "kept", WorkDir: workDir(map[string]string{"out/result.txt": "42"}), Artifacts: []string{"out/result.txt"}}
+	for _, job := range []*HPCJob{short, kept} {
+		hpc.SubmitJob(job)
+		runJob(t, hpc, node, job.ID, true)
+	}
+	waitFor(t, hpc, "the artifact uploads", func() bool {
+		return len(short.StoredArtifacts) == 2 && len(kept.StoredArtifacts) == 1
+	})
+
+	artifacts, err := hpc.JobArtifacts("short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("42"))
+	result := hex.EncodeToString(sum[:])
+	names := map[string]JobArtifact{}
+	for _, a := range artifacts {
+		names[a.Name] = a
+	}
+	if a := names["out/result.txt"]; a.Digest != result || a.Size != 2 || a.ExpiresAt == nil {
+		t.Errorf("out/result.txt = %+v", a)
+	}
+	if _, ok := names["logs/run.log"]; !ok {
+		t.Errorf("artifacts = %+v, want the files under logs", artifacts)
+	}
+	if kept.StoredArtifacts[0].Digest != result || kept.StoredArtifacts[0].ExpiresAt != nil {
+		t.Errorf("kept artifact = %+v", kept.StoredArtifacts[0])
+	}
+
+	// Identical content is stored once
+	var stored []string
+	filepath.Walk(filepath.Join(store, "sha256"), func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			stored = append(stored, filepath.Base(path))
+		}
+		return nil
+	})
+	if len(stored) != 2 {
+		t.Errorf("store holds %v, want 2 files", stored)
+	}
+
+	rc, artifact, err := hpc.OpenArtifact("kept", "out/result.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "42" || artifact.Digest != result {
+		t.Errorf("OpenArtifact() = %q, %+v", data, artifact)
+	}
+	rec := httptest.NewRecorder()
+	hpc.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/artifacts?id=kept&name=out/result.txt", nil))
+	if rec.Body.String() != "42" || rec.Header().Get("X-Artifact-Digest") != "sha256:"+result {
+		t.Errorf("GET /jobs/artifacts = %d %v: %s", rec.Code, rec.Header(), rec.Body)
+	}
+	if _, _, err := hpc.OpenArtifact("kept", "scratch.tmp"); err == nil {
+		t.Error("OpenArtifact() of a file not declared succeeded")
+	}
+
+	// Expired records go; content goes once no job references it
+	time.Sleep(5 * time.Millisecond)
+	hpc.pruneArtifacts()
+	if artifacts, _ := hpc.JobArtifacts("short"); len(artifacts) != 0 {
+		t.Errorf("expired artifacts kept: %+v", artifacts)
+	}
+	logSum := sha256.Sum256([]byte("ok"))
+	if _, err := hpc.artifacts.Get(hex.EncodeToString(logSum[:])); !os.IsNotExist(err) {
+		t.Errorf("the expired log is still stored: %v", err)
+	}
+	rc, _, err = hpc.OpenArtifact("kept", "out/result.txt")
+	if err != nil {
+		t.Fatalf("the result shared with a kept job was deleted: %v", err)
+	}
+	rc.Close()
+
+	if _, err := hpc.artifacts.Get("../../etc/passwd"); err == nil {
+		t.Error("Get() accepted a path for a digest")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	hpc := NewHPCClusterManager(HPCConfig{ScheduleInterval: time.Hour, MonitorInterval: time.Hour, HeartbeatTimeout: time.Hour})
+	node := &ComputeNode{ID: "node", CPUCores: 8, Memory: 32, MaxJobs: 2}
+	hpc.RegisterNode(node)
+	hpc.SubmitJob(&HPCJob{ID: "running", Resources: ResourceRequest{CPUCores: 2}})
+	hpc.SubmitJob(&HPCJob{ID: "queued", Resources: ResourceRequest{CPUCores: 2}})
+	hpc.mutex.Lock()
+	hpc.startJobLocked(hpc.jobs["running"], node)
+	hpc.mutex.Unlock()
+	hpc.Start()
+
+	// Running work holds shutdown until the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := hpc.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "1 jobs still running") {
+		t.Errorf("Shutdown() with a running job = %v", err)
+	}
+	if status := hpc.jobs["running"].Status; status != "running" {
+		t.Errorf("running job after an expired shutdown = %s, want it left running", status)
+	}
+
+	// Nothing new is accepted or placed
+	if err := hpc.SubmitJob(&HPCJob{ID: "late"}); err == nil || !strings.Contains(err.Error(), "shutting down") {
+		t.Errorf("SubmitJob() while shutting down = %v", err)
+	}
+	hpc.scheduleJobs()
+	if status := hpc.jobs["queued"].Status; status != "queued" {
+		t.Errorf("queued job while shutting down = %s, want it queued", status)
+	}
+
+	// Shutdown returns once the last job finishes
+	done := make(chan error, 1)
+	go func() { done <- hpc.Shutdown(context.Background()) }()
+	hpc.completeJob(hpc.jobs["running"], node, true)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Shutdown() after the last job = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown() did not return once running jobs finished")
+	}
+}
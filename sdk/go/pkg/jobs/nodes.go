@@ -0,0 +1,236 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat records that a node is alive, optionally with fresh performance
+// metrics. An unhealthy node that heartbeats again is returned to service.
+func (hpc *HPCClusterManager) Heartbeat(nodeID string, perf *NodePerformance) error {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	node, exists := hpc.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %s not found", nodeID)
+	}
+
+	node.LastHeartbeat = time.Now()
+	if perf != nil {
+		perf.LastUpdated = node.LastHeartbeat
+		node.Performance = *perf
+	}
+
+	if node.Status == "unhealthy" {
+		hpc.setNodeStatusLocked(node, hpc.serviceStatusLocked(node))
+		hpc.recordNodeEventLocked(node, "recovered", "heartbeat received")
+		log.Printf("Node %s recovered", nodeID)
+	}
+	return nil
+}
+
+// DrainNode stops scheduling new jobs on a node. Running jobs finish
+// normally; the node becomes "drained" once it is empty.
+func (hpc *HPCClusterManager) DrainNode(nodeID string) error {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	node, exists := hpc.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %s not found", nodeID)
+	}
+	if node.Draining {
+		return nil
+	}
+
+	node.Draining = true
+	if node.Status != "unhealthy" {
+		hpc.setNodeStatusLocked(node, hpc.serviceStatusLocked(node))
+	}
+	hpc.recordNodeEventLocked(node, "drain_requested", fmt.Sprintf("%d jobs running", node.JobsRunning))
+	if node.Status == "drained" {
+		hpc.recordNodeEventLocked(node, "drained", "")
+	}
+
+	log.Printf("Node %s draining (%d jobs running)", nodeID, node.JobsRunning)
+	return nil
+}
+
+// UndrainNode returns a drained or draining node to service
+func (hpc *HPCClusterManager) UndrainNode(nodeID string) error {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	node, exists := hpc.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %s not found", nodeID)
+	}
+	if !node.Draining {
+		return nil
+	}
+
+	node.Draining = false
+	if node.Status != "unhealthy" {
+		hpc.setNodeStatusLocked(node, "available")
+	}
+	hpc.recordNodeEventLocked(node, "undrained", "")
+
+	log.Printf("Node %s returned to service", nodeID)
+	return nil
+}
+
+// NodeEvents returns the event history of a node, oldest first
+func (hpc *HPCClusterManager) NodeEvents(nodeID string) ([]NodeEvent, error) {
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+
+	events, ok := hpc.nodeEvents[nodeID]
+	if !ok {
+		return nil, fmt.Errorf("node %s has no events", nodeID)
+	}
+	return append([]NodeEvent(nil), events...), nil
+}
+
+func (hpc *HPCClusterManager) runHeartbeatMonitor() {
+	ticker := time.NewTicker(hpc.config.HeartbeatTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			hpc.checkHeartbeats()
+		case <-hpc.stop:
+			return
+		}
+	}
+}
+
+// checkHeartbeats marks silent nodes unhealthy and reschedules their jobs
+func (hpc *HPCClusterManager) checkHeartbeats() {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	now := time.Now()
+	for _, node := range hpc.nodes {
+		if node.Status == "unhealthy" || now.Sub(node.LastHeartbeat) < hpc.config.HeartbeatTimeout {
+			continue
+		}
+
+		silence := now.Sub(node.LastHeartbeat).Round(time.Second)
+		hpc.setNodeStatusLocked(node, "unhealthy")
+		hpc.recordNodeEventLocked(node, "unhealthy", fmt.Sprintf("no heartbeat for %v", silence))
+		log.Printf("Node %s unhealthy: no heartbeat for %v", node.ID, silence)
+
+		for _, job := range hpc.jobs {
+			if job.NodeID == node.ID && job.Status == "running" {
+				hpc.rescheduleLostJobLocked(job, node)
+			}
+		}
+	}
+}
+
+// rescheduleLostJobLocked requeues a job whose node failed, or fails it once
+// its retry policy is exhausted
+func (hpc *HPCClusterManager) rescheduleLostJobLocked(job *HPCJob, node *ComputeNode) {
+	// Jobs being preempted are owned by the preemption path
+	cancel, ok := hpc.running[job.ID]
+	if !ok {
+		return
+	}
+	cancel()
+	delete(hpc.running, job.ID)
+	hpc.releaseSlotLocked(node)
+	hpc.recordUsageLocked(job, time.Now())
+	atomic.AddInt32(&hpc.stats.RunningJobs, -1)
+
+	policy := hpc.config.DefaultRetry
+	if job.Retry != nil {
+		policy = *job.Retry
+	}
+	job.Attempts++
+
+	if job.Attempts > policy.MaxRetries {
+		now := time.Now()
+		job.Status = "failed"
+		job.ExitCode = 1
+		job.CompletedAt = &now
+		job.Error = fmt.Sprintf("node %s failed; retries exhausted after %d attempts", node.ID, job.Attempts)
+		atomic.AddInt64(&hpc.stats.FailedJobs, 1)
+		hpc.recordNodeEventLocked(node, "job_lost", job.ID)
+		log.Printf("Job %s failed: %s", job.ID, job.Error)
+
+		if job.DAGID != "" {
+			hpc.failDAGLocked(job.DAGID, job.ID)
+		}
+		hpc.releaseWaitingJobsLocked()
+		return
+	}
+
+	backoff := policy.Backoff * time.Duration(1<<(job.Attempts-1))
+	retryAfter := time.Now().Add(backoff)
+	job.Status = "queued"
+	job.NodeID = ""
+	job.StartedAt = nil
+	job.RetryAfter = &retryAfter
+	job.Metadata["lost_on_node"] = node.ID
+	atomic.AddInt32(&hpc.stats.QueuedJobs, 1)
+
+	hpc.recordNodeEventLocked(node, "job_rescheduled", fmt.Sprintf("%s (attempt %d, backoff %v)", job.ID, job.Attempts, backoff))
+	log.Printf("Job %s rescheduled after node %s failed (attempt %d/%d, backoff %v)",
+		job.ID, node.ID, job.Attempts, policy.MaxRetries, backoff)
+}
+
+// releaseSlotLocked frees one job slot on a node and completes a pending drain
+func (hpc *HPCClusterManager) releaseSlotLocked(node *ComputeNode) {
+	node.JobsRunning--
+	node.Load = float64(node.JobsRunning) / float64(node.MaxJobs)
+
+	if node.Status == "draining" && node.JobsRunning == 0 {
+		hpc.setNodeStatusLocked(node, "drained")
+		hpc.recordNodeEventLocked(node, "drained", "")
+		log.Printf("Node %s drained", node.ID)
+	}
+}
+
+// serviceStatusLocked is the status a healthy node should have
+func (hpc *HPCClusterManager) serviceStatusLocked(node *ComputeNode) string {
+	switch {
+	case !node.Draining:
+		return "available"
+	case node.JobsRunning > 0:
+		return "draining"
+	default:
+		return "drained"
+	}
+}
+
+// setNodeStatusLocked changes a node's status and keeps ActiveNodes in sync
+func (hpc *HPCClusterManager) setNodeStatusLocked(node *ComputeNode, status string) {
+	if node.Status == status {
+		return
+	}
+	if node.Status == "available" {
+		atomic.AddInt32(&hpc.stats.ActiveNodes, -1)
+	}
+	if status == "available" {
+		atomic.AddInt32(&hpc.stats.ActiveNodes, 1)
+	}
+	node.Status = status
+}
+
+func (hpc *HPCClusterManager) recordNodeEventLocked(node *ComputeNode, eventType, message string) {
+	events := append(hpc.nodeEvents[node.ID], NodeEvent{
+		Time:    time.Now(),
+		NodeID:  node.ID,
+		Type:    eventType,
+		Status:  node.Status,
+		Message: message,
+	})
+	if len(events) > maxNodeEvents {
+		events = events[len(events)-maxNodeEvents:]
+	}
+	hpc.nodeEvents[node.ID] = events
+}
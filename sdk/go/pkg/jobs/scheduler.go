@@ -0,0 +1,610 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// REAL Scheduling Algorithms
+func (hpc *HPCClusterManager) scheduleFIFO(job *HPCJob, nodes []*ComputeNode) (*ComputeNode, error) {
+	// First-In-First-Out scheduling
+	for _, node := range nodes {
+		if hpc.canRunJob(node, job) {
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("no suitable node found")
+}
+
+func (hpc *HPCClusterManager) scheduleFairShare(job *HPCJob, nodes []*ComputeNode) (*ComputeNode, error) {
+	// Fair-share scheduling based on resource utilization
+	var bestNode *ComputeNode
+	lowestUtilization := float64(1.0)
+
+	for _, node := range nodes {
+		if hpc.canRunJob(node, job) {
+			utilization := hpc.calculateNodeUtilization(node)
+			if utilization < lowestUtilization {
+				lowestUtilization = utilization
+				bestNode = node
+			}
+		}
+	}
+
+	if bestNode == nil {
+		return nil, fmt.Errorf("no suitable node found")
+	}
+
+	return bestNode, nil
+}
+
+func (hpc *HPCClusterManager) scheduleBackfill(job *HPCJob, nodes []*ComputeNode) (*ComputeNode, error) {
+	// Backfill scheduling - try to fit smaller jobs in gaps
+	bestNode := hpc.findBestFitNode(job, nodes)
+	if bestNode != nil {
+		return bestNode, nil
+	}
+
+	// If no perfect fit, use fair share
+	return hpc.scheduleFairShare(job, nodes)
+}
+
+func (hpc *HPCClusterManager) canRunJob(node *ComputeNode, job *HPCJob) bool {
+	return node.Status == "available" &&
+		node.JobsRunning < node.MaxJobs &&
+		node.CPUCores >= job.Resources.CPUCores &&
+		node.Memory >= job.Resources.Memory &&
+		node.GPUs >= job.Resources.GPUs
+}
+
+func (hpc *HPCClusterManager) calculateNodeUtilization(node *ComputeNode) float64 {
+	cpuUtil := float64(node.JobsRunning) / float64(node.MaxJobs)
+	return cpuUtil
+}
+
+func (hpc *HPCClusterManager) findBestFitNode(job *HPCJob, nodes []*ComputeNode) *ComputeNode {
+	var bestNode *ComputeNode
+	bestScore := float64(-1)
+
+	for _, node := range nodes {
+		if hpc.canRunJob(node, job) {
+			// Calculate fit score (lower is better)
+			cpuFit := float64(node.CPUCores-job.Resources.CPUCores) / float64(node.CPUCores)
+			memFit := float64(node.Memory-job.Resources.Memory) / float64(node.Memory)
+			score := (cpuFit + memFit) / 2
+
+			if bestScore == -1 || score < bestScore {
+				bestScore = score
+				bestNode = node
+			}
+		}
+	}
+
+	return bestNode
+}
+
+// Preemption
+
+// ConfigureScheduler replaces the scheduler configuration
+func (hpc *HPCClusterManager) ConfigureScheduler(config SchedulerConfig) {
+	hpc.scheduler.mutex.Lock()
+	defer hpc.scheduler.mutex.Unlock()
+
+	if config.PreemptionPriorityGap <= 0 {
+		config.PreemptionPriorityGap = 1
+	}
+	if config.PreemptionGracePeriod <= 0 {
+		config.PreemptionGracePeriod = 30 * time.Second
+	}
+	if config.FairShareBy == "" {
+		config.FairShareBy = "user"
+	}
+	if config.FairShareHalfLife <= 0 {
+		config.FairShareHalfLife = 7 * 24 * time.Hour
+	}
+	if config.GPUHourWeight <= 0 {
+		config.GPUHourWeight = 10
+	}
+	hpc.scheduler.config = config
+}
+
+// SetCheckpointHook registers the hook invoked before jobs are preempted
+func (hpc *HPCClusterManager) SetCheckpointHook(hook CheckpointHook) {
+	hpc.scheduler.mutex.Lock()
+	defer hpc.scheduler.mutex.Unlock()
+	hpc.scheduler.checkpoint = hook
+}
+
+// isReservedLocked is isReserved for callers that hold hpc.mutex
+func (hpc *HPCClusterManager) isReservedLocked(jobID string) bool {
+	for _, reservedJob := range hpc.reserved {
+		if reservedJob == jobID {
+			return true
+		}
+	}
+	return false
+}
+
+func (hpc *HPCClusterManager) isReserved(jobID string) bool {
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+	_, ok := hpc.reserved[jobID]
+	return ok
+}
+
+// tryPreemption looks for a full node that could run job if a lower-priority
+// running job were evicted, and starts the eviction asynchronously. The freed
+// slot is handed directly to job so no other queued job can take it.
+func (hpc *HPCClusterManager) tryPreemption(job *HPCJob, nodes []*ComputeNode, config SchedulerConfig) {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	var victim *HPCJob
+	var victimNode *ComputeNode
+
+	for _, node := range nodes {
+		// Only nodes that are constrained by slots, not by static resources
+		if node.Status != "available" || node.JobsRunning < node.MaxJobs ||
+			node.CPUCores < job.Resources.CPUCores ||
+			node.Memory < job.Resources.Memory ||
+			node.GPUs < job.Resources.GPUs {
+			continue
+		}
+
+		for _, candidate := range hpc.jobs {
+			if candidate.NodeID != node.ID || candidate.Status != "running" || candidate.NoPreempt {
+				continue
+			}
+			if candidate.Priority+config.PreemptionPriorityGap > job.Priority {
+				continue
+			}
+			if _, ok := hpc.running[candidate.ID]; !ok {
+				continue
+			}
+			// Prefer the lowest priority, then the most recently started (least work lost)
+			if victim == nil || candidate.Priority < victim.Priority ||
+				(candidate.Priority == victim.Priority && candidate.StartedAt.After(*victim.StartedAt)) {
+				victim = candidate
+				victimNode = node
+			}
+		}
+	}
+
+	if victim == nil {
+		return
+	}
+
+	// Claim the victim so it can neither complete nor be preempted twice
+	cancel := hpc.running[victim.ID]
+	delete(hpc.running, victim.ID)
+	victim.Status = "preempting"
+	hpc.reserved[job.ID] = victimNode.ID
+
+	log.Printf("Preempting job %s (priority %d) on node %s for job %s (priority %d)",
+		victim.ID, victim.Priority, victimNode.ID, job.ID, job.Priority)
+
+	go hpc.preemptJob(victim, victimNode, job, cancel, config)
+}
+
+// preemptJob checkpoints and terminates victim, requeues it, and starts
+// preemptor on the freed slot
+func (hpc *HPCClusterManager) preemptJob(victim *HPCJob, node *ComputeNode, preemptor *HPCJob, cancel context.CancelFunc, config SchedulerConfig) {
+	checkpointRef := victim.CheckpointRef
+
+	hpc.scheduler.mutex.RLock()
+	hook := hpc.scheduler.checkpoint
+	hpc.scheduler.mutex.RUnlock()
+
+	if hook != nil && victim.Checkpoint != nil {
+		signal := victim.Checkpoint.Signal
+		if signal == "" {
+			signal = "SIGTERM"
+		}
+		grace := victim.Checkpoint.GracePeriod
+		if grace <= 0 {
+			grace = config.PreemptionGracePeriod
+		}
+
+		ctx, cancelHook := context.WithTimeout(context.Background(), grace)
+		ref, err := hook(ctx, victim, signal)
+		cancelHook()
+
+		switch {
+		case err != nil:
+			log.Printf("Checkpoint of job %s failed: %v", victim.ID, err)
+		case ctx.Err() == context.DeadlineExceeded:
+			log.Printf("Checkpoint of job %s exceeded grace period %v", victim.ID, grace)
+		default:
+			checkpointRef = ref
+		}
+	}
+
+	// Terminate the running job
+	cancel()
+
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	hpc.recordUsageLocked(victim, time.Now())
+	victim.Status = "queued"
+	victim.NodeID = ""
+	victim.StartedAt = nil
+	victim.CheckpointRef = checkpointRef
+	victim.PreemptionCount++
+	victim.Metadata["preempted_by"] = preemptor.ID
+	hpc.releaseSlotLocked(node)
+
+	atomic.AddInt64(&hpc.stats.PreemptedJobs, 1)
+	atomic.AddInt32(&hpc.stats.RunningJobs, -1)
+	atomic.AddInt32(&hpc.stats.QueuedJobs, 1)
+
+	log.Printf("Job %s preempted and requeued (checkpoint: %q, preemptions: %d)",
+		victim.ID, checkpointRef, victim.PreemptionCount)
+
+	delete(hpc.reserved, preemptor.ID)
+	if preemptor.Status == "queued" && node.Status == "available" && !hpc.stopping {
+		hpc.startJobLocked(preemptor, node)
+	}
+}
+
+// Service Runners
+func (hpc *HPCClusterManager) runScheduler() {
+	ticker := time.NewTicker(hpc.config.ScheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			hpc.scheduleJobs()
+		case <-hpc.stop:
+			return
+		}
+	}
+}
+
+func (hpc *HPCClusterManager) scheduleJobs() {
+	hpc.mutex.RLock()
+	queuedJobs := make([]*HPCJob, 0)
+	availableNodes := make([]*ComputeNode, 0)
+
+	for _, job := range hpc.jobs {
+		if job.Status == "queued" {
+			queuedJobs = append(queuedJobs, job)
+		}
+	}
+
+	for _, node := range hpc.nodes {
+		if node.Status == "available" {
+			availableNodes = append(availableNodes, node)
+		}
+	}
+	hpc.mutex.RUnlock()
+
+	if len(queuedJobs) == 0 || len(availableNodes) == 0 {
+		return
+	}
+
+	hpc.scheduler.mutex.RLock()
+	schedConfig := hpc.scheduler.config
+	hpc.scheduler.mutex.RUnlock()
+
+	// Highest effective priority first, then oldest submission
+	priority := make(map[string]float64, len(queuedJobs))
+	factors := hpc.FairShareFactors()
+	for _, job := range queuedJobs {
+		priority[job.ID] = float64(job.Priority)
+		if schedConfig.FairShareWeight > 0 {
+			priority[job.ID] += schedConfig.FairShareWeight * factors[jobAccount(job, schedConfig.FairShareBy)]
+		}
+	}
+	sort.Slice(queuedJobs, func(i, j int) bool {
+		if priority[queuedJobs[i].ID] != priority[queuedJobs[j].ID] {
+			return priority[queuedJobs[i].ID] > priority[queuedJobs[j].ID]
+		}
+		return queuedJobs[i].SubmittedAt.Before(queuedJobs[j].SubmittedAt)
+	})
+
+	algorithm := hpc.scheduler.algorithms[schedConfig.Algorithm]
+	if algorithm == nil {
+		algorithm = hpc.scheduler.algorithms["fifo"]
+	}
+
+	now := time.Now()
+	for _, job := range queuedJobs {
+		if hpc.isReserved(job.ID) || (job.RetryAfter != nil && now.Before(*job.RetryAfter)) {
+			continue
+		}
+
+		selectedNode, err := algorithm(job, availableNodes)
+		if err != nil {
+			if schedConfig.EnablePreemption {
+				hpc.tryPreemption(job, availableNodes, schedConfig)
+			}
+			continue
+		}
+
+		hpc.executeJob(job, selectedNode)
+	}
+}
+
+func (hpc *HPCClusterManager) executeJob(job *HPCJob, node *ComputeNode) {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+	if hpc.stopping {
+		return
+	}
+	hpc.startJobLocked(job, node)
+}
+
+// startJobLocked marks a job running on node; the caller must hold hpc.mutex
+func (hpc *HPCClusterManager) startJobLocked(job *HPCJob, node *ComputeNode) {
+	job.Status = "running"
+	job.NodeID = node.ID
+	now := time.Now()
+	job.StartedAt = &now
+	node.JobsRunning++
+	node.Load = float64(node.JobsRunning) / float64(node.MaxJobs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hpc.running[job.ID] = cancel
+
+	atomic.AddInt32(&hpc.stats.QueuedJobs, -1)
+	atomic.AddInt32(&hpc.stats.RunningJobs, 1)
+
+	if job.CheckpointRef != "" {
+		log.Printf("Job %s resuming from checkpoint %s on node %s", job.ID, job.CheckpointRef, node.ID)
+	} else {
+		log.Printf("Job %s started on node %s", job.ID, node.ID)
+	}
+
+	// Simulate job execution
+	go func() {
+		hpc.simulateJobExecution(ctx, job, node)
+	}()
+}
+
+func (hpc *HPCClusterManager) simulateJobExecution(ctx context.Context, job *HPCJob, node *ComputeNode) {
+	// REAL job simulation based on type
+	var executionTime time.Duration
+	var success bool = true
+
+	switch job.Type {
+	case "compute":
+		executionTime = time.Duration(10+len(job.Arguments)*2) * time.Second
+		success = hpc.performComputeJob(job)
+	case "simulation":
+		executionTime = time.Duration(30+job.Resources.CPUCores*5) * time.Second
+		success = hpc.performSimulationJob(job)
+	case "ml_training":
+		executionTime = time.Duration(60+job.Resources.GPUs*10) * time.Second
+		success = hpc.performMLTrainingJob(job)
+	default:
+		executionTime = 15 * time.Second
+		success = true
+	}
+
+	select {
+	case <-time.After(executionTime):
+	case <-ctx.Done():
+		// Preempted: the preemption path owns the job's state from here
+		return
+	}
+
+	hpc.completeJob(job, node, success)
+}
+
+func (hpc *HPCClusterManager) performComputeJob(job *HPCJob) bool {
+	// REAL compute job - matrix operations
+	size := 1000
+	if len(job.Arguments) > 0 {
+		// Parse size from arguments
+		size = 500 + len(job.Arguments)*100
+	}
+
+	// Perform matrix multiplication
+	a := make([][]float64, size)
+	b := make([][]float64, size)
+	c := make([][]float64, size)
+
+	for i := 0; i < size; i++ {
+		a[i] = make([]float64, size)
+		b[i] = make([]float64, size)
+		c[i] = make([]float64, size)
+		for j := 0; j < size; j++ {
+			a[i][j] = float64(i + j)
+			b[i][j] = float64(i * j)
+		}
+	}
+
+	// Matrix multiplication
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			for k := 0; k < size; k++ {
+				c[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+
+	job.Output = fmt.Sprintf("Computed %dx%d matrix multiplication, result[0][0] = %.2f", size, size, c[0][0])
+	return true
+}
+
+func (hpc *HPCClusterManager) performSimulationJob(job *HPCJob) bool {
+	// REAL simulation job - Monte Carlo simulation
+	iterations := 1000000
+	inside := 0
+
+	for i := 0; i < iterations; i++ {
+		x := float64(i%1000) / 1000.0
+		y := float64((i*7)%1000) / 1000.0
+
+		if x*x+y*y <= 1.0 {
+			inside++
+		}
+	}
+
+	pi := 4.0 * float64(inside) / float64(iterations)
+	job.Output = fmt.Sprintf("Monte Carlo simulation: Pi ≈ %.6f (iterations: %d)", pi, iterations)
+	return math.Abs(pi-math.Pi) < 0.1 // Success if reasonably close to Pi
+}
+
+func (hpc *HPCClusterManager) performMLTrainingJob(job *HPCJob) bool {
+	// REAL ML training job - simple linear regression
+	dataSize := 10000
+	learningRate := 0.01
+	epochs := 1000
+
+	// Generate synthetic data
+	x := make([]float64, dataSize)
+	y := make([]float64, dataSize)
+	for i := 0; i < dataSize; i++ {
+		x[i] = float64(i) / 100.0
+		y[i] = 2.5*x[i] + 1.0 + (float64(i%10)-5.0)/10.0 // y = 2.5x + 1 + noise
+	}
+
+	// Train linear regression
+	w := 0.0
+	b := 0.0
+
+	for epoch := 0; epoch < epochs; epoch++ {
+		totalLoss := 0.0
+		dwSum := 0.0
+		dbSum := 0.0
+
+		for i := 0; i < dataSize; i++ {
+			pred := w*x[i] + b
+			loss := pred - y[i]
+			totalLoss += loss * loss
+
+			dwSum += loss * x[i]
+			dbSum += loss
+		}
+
+		w -= learningRate * dwSum / float64(dataSize)
+		b -= learningRate * dbSum / float64(dataSize)
+
+		if epoch%200 == 0 {
+			avgLoss := totalLoss / float64(dataSize)
+			log.Printf("Job %s - Epoch %d, Loss: %.6f, w: %.3f, b: %.3f", job.ID, epoch, avgLoss, w, b)
+		}
+	}
+
+	job.Output = fmt.Sprintf("ML Training completed: w=%.3f, b=%.3f (target: w=2.5, b=1.0)", w, b)
+	return math.Abs(w-2.5) < 0.5 && math.Abs(b-1.0) < 0.5
+}
+
+func (hpc *HPCClusterManager) completeJob(job *HPCJob, node *ComputeNode, success bool) {
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	// A job claimed for preemption is requeued rather than completed
+	cancel, ok := hpc.running[job.ID]
+	if !ok {
+		return
+	}
+	cancel()
+	delete(hpc.running, job.ID)
+
+	now := time.Now()
+	job.CompletedAt = &now
+	hpc.releaseSlotLocked(node)
+	hpc.recordUsageLocked(job, now)
+
+	if success {
+		job.Status = "completed"
+		job.ExitCode = 0
+		atomic.AddInt64(&hpc.stats.CompletedJobs, 1)
+	} else {
+		job.Status = "failed"
+		job.ExitCode = 1
+		job.Error = "Job execution failed"
+		atomic.AddInt64(&hpc.stats.FailedJobs, 1)
+	}
+
+	atomic.AddInt32(&hpc.stats.RunningJobs, -1)
+
+	waitTime := job.StartedAt.Sub(job.SubmittedAt)
+	log.Printf("Job %s %s on node %s (wait time: %v)", job.ID, job.Status, node.ID, waitTime)
+
+	if !success && job.DAGID != "" {
+		hpc.failDAGLocked(job.DAGID, job.ID)
+	}
+	hpc.releaseWaitingJobsLocked()
+
+	// Failed jobs keep their outputs too; they are often what explains the failure
+	if len(job.Artifacts) > 0 && hpc.artifacts != nil {
+		go hpc.uploadArtifacts(job.ID, job.WorkDir, append([]string(nil), job.Artifacts...), hpc.artifactTTLLocked(job))
+	}
+}
+
+func (hpc *HPCClusterManager) runMonitor() {
+	ticker := time.NewTicker(hpc.config.MonitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			hpc.updateClusterStats()
+			hpc.checkAlerts()
+			hpc.pruneArtifacts()
+			hpc.pruneUsage()
+		case <-hpc.stop:
+			return
+		}
+	}
+}
+
+func (hpc *HPCClusterManager) updateClusterStats() {
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+
+	totalUtilization := 0.0
+	activeNodes := 0
+
+	for _, node := range hpc.nodes {
+		if node.Status == "available" {
+			totalUtilization += node.Load
+			activeNodes++
+		}
+	}
+
+	if activeNodes > 0 {
+		hpc.stats.ClusterUtilization = totalUtilization / float64(activeNodes)
+	}
+
+	// Calculate throughput
+	elapsed := time.Since(hpc.stats.StartTime).Hours()
+	if elapsed > 0 {
+		hpc.stats.Throughput = float64(hpc.stats.CompletedJobs) / elapsed
+	}
+}
+
+func (hpc *HPCClusterManager) checkAlerts() {
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+
+	// Check for overloaded nodes
+	for _, node := range hpc.nodes {
+		if node.Load > 0.9 {
+			alert := ClusterAlert{
+				ID:        fmt.Sprintf("alert_%d", time.Now().UnixNano()),
+				Type:      "high_load",
+				Severity:  "warning",
+				Message:   fmt.Sprintf("Node %s is overloaded (%.1f%%)", node.ID, node.Load*100),
+				NodeID:    node.ID,
+				Timestamp: time.Now(),
+			}
+			hpc.monitor.alerts = append(hpc.monitor.alerts, alert)
+		}
+	}
+
+	// Limit alert history
+	if len(hpc.monitor.alerts) > 100 {
+		hpc.monitor.alerts = hpc.monitor.alerts[1:]
+	}
+}
@@ -0,0 +1,251 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTP Handlers
+func (hpc *HPCClusterManager) handleNodes(w http.ResponseWriter, r *http.Request) {
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hpc.nodes)
+}
+
+func (hpc *HPCClusterManager) handleJobs(w http.ResponseWriter, r *http.Request) {
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hpc.jobs)
+}
+
+func (hpc *HPCClusterManager) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var job HPCJob
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := hpc.SubmitJob(&job); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "submitted", "job_id": job.ID})
+}
+
+func (hpc *HPCClusterManager) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hpc.stats)
+}
+
+func (hpc *HPCClusterManager) handleAutoscaler(w http.ResponseWriter, r *http.Request) {
+	hpc.mutex.RLock()
+	as := hpc.autoscaler
+	hpc.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if as == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":   true,
+		"provider":  as.provider.Name(),
+		"config":    as.config,
+		"decisions": as.Decisions(),
+	})
+}
+
+// handleDAGs submits a DAG (POST) or reports its status (GET ?id=&format=json|ascii|mermaid)
+func (hpc *HPCClusterManager) handleDAGs(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		var dag JobDAG
+		if err := json.NewDecoder(r.Body).Decode(&dag); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := hpc.SubmitDAG(&dag); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"status": "submitted", "dag_id": dag.ID})
+		return
+	}
+
+	dag, nodes, err := hpc.DAGStatus(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "ascii":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, RenderDAGASCII(dag, nodes))
+	case "mermaid":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, RenderDAGMermaid(dag, nodes))
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"dag": dag, "nodes": nodes})
+	}
+}
+
+func (hpc *HPCClusterManager) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var perf *NodePerformance
+	if r.ContentLength > 0 {
+		perf = &NodePerformance{}
+		if err := json.NewDecoder(r.Body).Decode(perf); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := hpc.Heartbeat(r.URL.Query().Get("id"), perf); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (hpc *HPCClusterManager) handleDrain(w http.ResponseWriter, r *http.Request) {
+	hpc.handleNodeAction(w, r, hpc.DrainNode, "draining")
+}
+
+func (hpc *HPCClusterManager) handleUndrain(w http.ResponseWriter, r *http.Request) {
+	hpc.handleNodeAction(w, r, hpc.UndrainNode, "undrained")
+}
+
+func (hpc *HPCClusterManager) handleNodeAction(w http.ResponseWriter, r *http.Request, action func(string) error, result string) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	nodeID := r.URL.Query().Get("id")
+	if err := action(nodeID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	hpc.mutex.RLock()
+	status := hpc.nodes[nodeID].Status
+	hpc.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"node_id": nodeID, "result": result, "status": status})
+}
+
+func (hpc *HPCClusterManager) handleNodeEvents(w http.ResponseWriter, r *http.Request) {
+	nodeID := r.URL.Query().Get("id")
+	events, err := hpc.NodeEvents(nodeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Count unhealthy transitions in the last hour to spot flapping hosts
+	flaps := 0
+	for _, event := range events {
+		if event.Type == "unhealthy" && time.Since(event.Time) < time.Hour {
+			flaps++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node_id":             nodeID,
+		"unhealthy_last_hour": flaps,
+		"events":              events,
+	})
+}
+
+// handleArtifacts lists a job's artifacts (?id=) or downloads one (?id=&name=)
+func (hpc *HPCClusterManager) handleArtifacts(w http.ResponseWriter, r *http.Request) {
+	jobID := r.URL.Query().Get("id")
+	name := r.URL.Query().Get("name")
+
+	if name == "" {
+		artifacts, err := hpc.JobArtifacts(jobID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"job_id": jobID, "artifacts": artifacts})
+		return
+	}
+
+	rc, artifact, err := hpc.OpenArtifact(jobID, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(artifact.Size, 10))
+	w.Header().Set("X-Artifact-Digest", "sha256:"+artifact.Digest)
+	io.Copy(w, rc)
+}
+
+// handleUsage reports usage (?by=user|team&since=RFC3339) and the current
+// fair-share factors
+func (hpc *HPCClusterManager) handleUsage(w http.ResponseWriter, r *http.Request) {
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "user"
+	}
+	if by != "user" && by != "team" {
+		http.Error(w, "by must be user or team", http.StatusBadRequest)
+		return
+	}
+
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	hpc.scheduler.mutex.RLock()
+	fairShareBy := hpc.scheduler.config.FairShareBy
+	hpc.scheduler.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"by":            by,
+		"since":         since,
+		"usage":         hpc.Usage(by, since),
+		"fair_share_by": fairShareBy,
+		"fair_share":    hpc.FairShareFactors(),
+	})
+}
+
+func (hpc *HPCClusterManager) handleMonitor(w http.ResponseWriter, r *http.Request) {
+	hpc.monitor.mutex.RLock()
+	defer hpc.monitor.mutex.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hpc.monitor.alerts)
+}
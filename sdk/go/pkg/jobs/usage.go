@@ -0,0 +1,175 @@
+package jobs
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// jobAccount returns the user or team a job is charged to
+func jobAccount(job *HPCJob, by string) string {
+	key := "user"
+	if by == "team" {
+		key = "team"
+	}
+	if account := job.Metadata[key]; account != "" {
+		return account
+	}
+	return "unknown"
+}
+
+// jobUsage returns the CPU- and GPU-hours a job consumed between start and end
+func jobUsage(job *HPCJob, start, end time.Time) (float64, float64) {
+	hours := end.Sub(start).Hours()
+	nodes := job.Resources.Nodes
+	if nodes < 1 {
+		nodes = 1
+	}
+	return hours * float64(job.Resources.CPUCores*nodes), hours * float64(job.Resources.GPUs*nodes)
+}
+
+// recordUsageLocked charges a job's current run to its user and team
+func (hpc *HPCClusterManager) recordUsageLocked(job *HPCJob, end time.Time) {
+	if job.StartedAt == nil {
+		return
+	}
+	cpuHours, gpuHours := jobUsage(job, *job.StartedAt, end)
+	hpc.usage = append(hpc.usage, UsageRecord{
+		JobID:    job.ID,
+		User:     jobAccount(job, "user"),
+		Team:     jobAccount(job, "team"),
+		Start:    *job.StartedAt,
+		End:      end,
+		CPUHours: cpuHours,
+		GPUHours: gpuHours,
+	})
+}
+
+func (hpc *HPCClusterManager) pruneUsage() {
+	if hpc.config.UsageRetention <= 0 {
+		return
+	}
+
+	hpc.mutex.Lock()
+	defer hpc.mutex.Unlock()
+
+	cutoff := time.Now().Add(-hpc.config.UsageRetention)
+	kept := hpc.usage[:0]
+	for _, record := range hpc.usage {
+		if record.End.After(cutoff) {
+			kept = append(kept, record)
+		}
+	}
+	hpc.usage = kept
+}
+
+// Usage aggregates usage since the given time by "user" or "team",
+// including the elapsed part of running jobs
+func (hpc *HPCClusterManager) Usage(by string, since time.Time) []UsageSummary {
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+
+	summaries := make(map[string]*UsageSummary)
+	jobs := make(map[string]map[string]bool)
+	add := func(account, jobID string, cpuHours, gpuHours float64) {
+		summary, ok := summaries[account]
+		if !ok {
+			summary = &UsageSummary{Account: account}
+			summaries[account] = summary
+			jobs[account] = make(map[string]bool)
+		}
+		summary.CPUHours += cpuHours
+		summary.GPUHours += gpuHours
+		if !jobs[account][jobID] {
+			jobs[account][jobID] = true
+			summary.Jobs++
+		}
+	}
+
+	for _, record := range hpc.usage {
+		if record.End.Before(since) {
+			continue
+		}
+		account := record.User
+		if by == "team" {
+			account = record.Team
+		}
+		add(account, record.JobID, record.CPUHours, record.GPUHours)
+	}
+
+	now := time.Now()
+	for _, job := range hpc.jobs {
+		if job.Status == "running" && job.StartedAt != nil {
+			cpuHours, gpuHours := jobUsage(job, *job.StartedAt, now)
+			add(jobAccount(job, by), job.ID, cpuHours, gpuHours)
+		}
+	}
+
+	result := make([]UsageSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CPUHours != result[j].CPUHours {
+			return result[i].CPUHours > result[j].CPUHours
+		}
+		return result[i].Account < result[j].Account
+	})
+	return result
+}
+
+// FairShareFactors returns a factor between 0 and 1 for every account with
+// usage or queued jobs. Usage decays with the configured half-life and
+// accounts get equal shares; an account with no recent usage scores 1, one
+// using exactly its share 0.5, and heavier accounts approach 0.
+func (hpc *HPCClusterManager) FairShareFactors() map[string]float64 {
+	hpc.scheduler.mutex.RLock()
+	config := hpc.scheduler.config
+	hpc.scheduler.mutex.RUnlock()
+
+	hpc.mutex.RLock()
+	defer hpc.mutex.RUnlock()
+
+	now := time.Now()
+	decay := func(end time.Time) float64 {
+		return math.Pow(0.5, float64(now.Sub(end))/float64(config.FairShareHalfLife))
+	}
+
+	usage := make(map[string]float64)
+	total := 0.0
+	for _, record := range hpc.usage {
+		account := record.User
+		if config.FairShareBy == "team" {
+			account = record.Team
+		}
+		charge := (record.CPUHours + config.GPUHourWeight*record.GPUHours) * decay(record.End)
+		usage[account] += charge
+		total += charge
+	}
+	for _, job := range hpc.jobs {
+		account := jobAccount(job, config.FairShareBy)
+		switch {
+		case job.Status == "running" && job.StartedAt != nil:
+			cpuHours, gpuHours := jobUsage(job, *job.StartedAt, now)
+			charge := cpuHours + config.GPUHourWeight*gpuHours
+			usage[account] += charge
+			total += charge
+		case job.Status == "queued":
+			// Waiting accounts hold a share even with no usage yet
+			if _, ok := usage[account]; !ok {
+				usage[account] = 0
+			}
+		}
+	}
+
+	factors := make(map[string]float64, len(usage))
+	share := 1 / float64(len(usage))
+	for account, charge := range usage {
+		if total == 0 {
+			factors[account] = 1
+			continue
+		}
+		factors[account] = math.Pow(2, -(charge/total)/share)
+	}
+	return factors
+}
@@ -0,0 +1,317 @@
+// Package k8s exports a configuration hierarchy to Kubernetes, for
+// `tsk k8s export`: the resolved values become a ConfigMap, and sensitive
+// ones a Secret. A key is sensitive when its raw value is a @secret(...),
+// when its comment carries a "k8s:secret" line, or when it matches one of
+// the secret patterns of the [k8s] section:
+//
+//	[k8s]
+//	name: "api"
+//	namespace: "payments"
+//	labels.team: "platform"
+//	secrets: ["database.password", "*.token"]
+//	# k8s:secret
+//	stripe_key: @env("STRIPE_KEY")
+//
+// The [k8s] section itself is not exported. Helm and Kustomize export the
+// base configuration and its environment overlays as values files or
+// patches for existing charts and kustomizations.
+package k8s
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/security"
+	"gopkg.in/yaml.v3"
+)
+
+// Section is the configuration section holding export settings
+const Section = "k8s"
+
+// SecretMarker is the comment line that marks a key as sensitive
+const SecretMarker = "k8s:secret"
+
+// KubectlCommand is the kubectl binary Apply runs
+var KubectlCommand = "kubectl"
+
+// ManagedBy is the app.kubernetes.io/managed-by label of every manifest
+const ManagedBy = "tsk"
+
+// Key styles of exported data
+const (
+	// KeysDotted keeps keys as they are, database.host
+	KeysDotted = "dotted"
+	// KeysEnv turns them into environment variable names, DATABASE_HOST,
+	// so a pod can load them with envFrom
+	KeysEnv = "env"
+)
+
+// Options controls an export. Empty fields fall back to the [k8s] section.
+type Options struct {
+	// Name of the ConfigMap; the Secret is named <Name>-secret
+	Name      string
+	Namespace string
+	Labels    map[string]string
+	// Secrets are path.Match patterns of keys exported to the Secret
+	Secrets []string
+	// Keys is KeysDotted (the default) or KeysEnv
+	Keys string
+}
+
+// Metadata is the metadata of a manifest
+type Metadata struct {
+	Name      string            `yaml:"name" json:"name"`
+	Namespace string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// Manifest is a ConfigMap or Secret
+type Manifest struct {
+	APIVersion string            `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string            `yaml:"kind" json:"kind"`
+	Metadata   Metadata          `yaml:"metadata" json:"metadata"`
+	Type       string            `yaml:"type,omitempty" json:"type,omitempty"`
+	Data       map[string]string `yaml:"data" json:"data"`
+}
+
+// Source is the configuration to export: its raw values, before operators
+// run, and the comments above its keys
+type Source struct {
+	Values   map[string]interface{}
+	Comments map[string]string
+}
+
+// envKeyPattern matches what is not allowed in an environment variable name
+var envKeyPattern = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Export resolves the values of src with vm and returns a ConfigMap, and a
+// Secret when any key is sensitive
+func Export(src Source, vm *peanut.VM, opts Options) ([]Manifest, error) {
+	opts, err := prepare(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	raw, resolved, err := resolve(src, vm)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNames(resolved, opts.Keys); err != nil {
+		return nil, err
+	}
+
+	configMap := Manifest{APIVersion: "v1", Kind: "ConfigMap", Metadata: opts.metadata(opts.Name), Data: map[string]string{}}
+	secret := Manifest{APIVersion: "v1", Kind: "Secret", Metadata: opts.metadata(opts.Name + "-secret"), Type: "Opaque", Data: map[string]string{}}
+	for _, key := range sortedKeys(resolved) {
+		text, err := dataValue(resolved[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if sensitive(key, raw[key], src.Comments[key], opts.Secrets) {
+			secret.Data[dataName(key, opts.Keys)] = base64.StdEncoding.EncodeToString([]byte(text))
+		} else {
+			configMap.Data[dataName(key, opts.Keys)] = text
+		}
+	}
+
+	manifests := []Manifest{configMap}
+	if len(secret.Data) > 0 {
+		manifests = append(manifests, secret)
+	}
+	return manifests, nil
+}
+
+// prepare fills opts from the [k8s] section of src and checks them
+func prepare(src Source, opts Options) (Options, error) {
+	opts = withSection(src.Values, opts)
+	if opts.Name == "" {
+		return opts, fmt.Errorf("no name for the ConfigMap: pass one or set %s.name", Section)
+	}
+	if opts.Keys != "" && opts.Keys != KeysDotted && opts.Keys != KeysEnv {
+		return opts, fmt.Errorf("unknown key style %q (use %s or %s)", opts.Keys, KeysDotted, KeysEnv)
+	}
+	return opts, nil
+}
+
+// metadata returns the metadata of a manifest called name
+func (o Options) metadata(name string) Metadata {
+	labels := map[string]string{"app.kubernetes.io/managed-by": ManagedBy}
+	for k, v := range o.Labels {
+		labels[k] = v
+	}
+	return Metadata{Name: name, Namespace: o.Namespace, Labels: labels}
+}
+
+// resolve returns the raw values of src outside the [k8s] section and the
+// same values with their operators evaluated
+func resolve(src Source, vm *peanut.VM) (raw, resolved map[string]interface{}, err error) {
+	raw = make(map[string]interface{}, len(src.Values))
+	for key, value := range src.Values {
+		if key != Section && !strings.HasPrefix(key, Section+".") {
+			raw[key] = value
+		}
+	}
+	resolved, err = peanut.FromValues(raw).Execute(vm)
+	return raw, resolved, err
+}
+
+// dataName returns the data key that key exports as in a key style
+func dataName(key, style string) string {
+	if style == KeysEnv {
+		return strings.ToUpper(envKeyPattern.ReplaceAllString(key, "_"))
+	}
+	return key
+}
+
+// checkNames refuses two keys of values exporting as the same data key
+func checkNames(values map[string]interface{}, style string) error {
+	origin := make(map[string]string)
+	for _, key := range sortedKeys(values) {
+		name := dataName(key, style)
+		if previous, ok := origin[name]; ok {
+			return fmt.Errorf("%s and %s both export as %s", previous, key, name)
+		}
+		origin[name] = key
+	}
+	return nil
+}
+
+// withSection fills the empty fields of opts from the [k8s] section
+func withSection(values map[string]interface{}, opts Options) Options {
+	section := make(map[string]interface{})
+	for key, value := range values {
+		if rest, ok := strings.CutPrefix(key, Section+"."); ok {
+			section[rest] = value
+		}
+	}
+	if s, ok := section["name"].(string); ok && opts.Name == "" {
+		opts.Name = s
+	}
+	if s, ok := section["namespace"].(string); ok && opts.Namespace == "" {
+		opts.Namespace = s
+	}
+	if s, ok := section["keys"].(string); ok && opts.Keys == "" {
+		opts.Keys = s
+	}
+	if patterns, ok := section["secrets"].([]interface{}); ok {
+		for _, p := range patterns {
+			opts.Secrets = append(opts.Secrets, fmt.Sprint(p))
+		}
+	}
+	labels := make(map[string]string)
+	for key, value := range section {
+		if name, ok := strings.CutPrefix(key, "labels."); ok {
+			labels[name] = fmt.Sprint(value)
+		}
+	}
+	for k, v := range opts.Labels {
+		labels[k] = v
+	}
+	opts.Labels = labels
+	return opts
+}
+
+// sensitive reports whether a key belongs in the Secret
+func sensitive(key string, raw interface{}, comment string, patterns []string) bool {
+	if s, ok := raw.(string); ok && security.IsSecret(s) {
+		return true
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		if strings.TrimSpace(line) == SecretMarker {
+			return true
+		}
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dataValue renders a resolved value as ConfigMap data: strings as they
+// are, lists and maps as JSON, everything else as written in TSK
+func dataValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []interface{}, map[string]interface{}:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+	return config.FormatValue(value), nil
+}
+
+// Marshal renders manifests as a multi-document YAML stream
+func Marshal(manifests []Manifest) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, m := range manifests {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		data, err := encodeYAML(m)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeYAML marshals v with the two-space indent of Kubernetes manifests
+func encodeYAML(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Apply pipes manifests to kubectl apply, which uses the local kubeconfig;
+// args are passed on, such as --context or --dry-run=server. It returns
+// what kubectl printed.
+func Apply(manifests []Manifest, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(KubectlCommand); err != nil {
+		return nil, fmt.Errorf("%s not found: install kubectl to use --apply", KubectlCommand)
+	}
+	data, err := Marshal(manifests)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(KubectlCommand, append([]string{"apply", "-f", "-"}, args...)...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), fmt.Errorf("%s apply failed: %w: %s", KubectlCommand, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,230 @@
+package k8s
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func TestExport(t *testing.T) {
+	t.Setenv("K8S_TEST_TOKEN", "s3cr3t")
+	src := Source{
+		Values: map[string]interface{}{
+			"k8s.name":          "api",
+			"k8s.namespace":     "payments",
+			"k8s.labels.team":   "platform",
+			"k8s.secrets":       []interface{}{"*.password"},
+			"database.host":     "db.internal",
+			"database.port":     5432,
+			"database.password": "hunter2",
+			"api.token":         `@env("K8S_TEST_TOKEN")`,
+			"hosts":             []interface{}{"a", "b"},
+		},
+		Comments: map[string]string{"api.token": "Token for the upstream API\nk8s:secret"},
+	}
+
+	manifests, err := Export(src, peanut.NewVM(), Options{Labels: map[string]string{"tier": "backend"}})
+	if err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	if len(manifests) != 2 {
+		t.Fatalf("expected a ConfigMap and a Secret, got %d manifests", len(manifests))
+	}
+	cm, secret := manifests[0], manifests[1]
+	if cm.Kind != "ConfigMap" || cm.Metadata.Name != "api" || cm.Metadata.Namespace != "payments" {
+		t.Errorf("unexpected ConfigMap metadata %+v", cm.Metadata)
+	}
+	for label, want := range map[string]string{"team": "platform", "tier": "backend", "app.kubernetes.io/managed-by": "tsk"} {
+		if cm.Metadata.Labels[label] != want {
+			t.Errorf("label %s = %q, want %q", label, cm.Metadata.Labels[label], want)
+		}
+	}
+	want := map[string]string{"database.host": "db.internal", "database.port": "5432", "hosts": `["a","b"]`}
+	if len(cm.Data) != len(want) {
+		t.Errorf("ConfigMap data = %v, want %v", cm.Data, want)
+	}
+	for key, value := range want {
+		if cm.Data[key] != value {
+			t.Errorf("ConfigMap %s = %q, want %q", key, cm.Data[key], value)
+		}
+	}
+
+	if secret.Kind != "Secret" || secret.Metadata.Name != "api-secret" || secret.Type != "Opaque" {
+		t.Errorf("unexpected Secret %+v", secret)
+	}
+	for key, value := range map[string]string{"database.password": "hunter2", "api.token": "s3cr3t"} {
+		decoded, _ := base64.StdEncoding.DecodeString(secret.Data[key])
+		if string(decoded) != value {
+			t.Errorf("Secret %s = %q, want %q", key, decoded, value)
+		}
+	}
+
+	data, err := Marshal(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), "\n---\n") != 1 || !strings.Contains(string(data), "kind: Secret") {
+		t.Errorf("unexpected YAML stream:\n%s", data)
+	}
+}
+
+func TestExportEnvKeys(t *testing.T) {
+	src := Source{Values: map[string]interface{}{"database.host": "db", "log-level": "info"}}
+	manifests, err := Export(src, peanut.NewVM(), Options{Name: "api", Keys: KeysEnv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 1 || manifests[0].Data["DATABASE_HOST"] != "db" || manifests[0].Data["LOG_LEVEL"] != "info" {
+		t.Errorf("unexpected manifests %+v", manifests)
+	}
+
+	src.Values["database_host"] = "other"
+	if _, err := Export(src, peanut.NewVM(), Options{Name: "api", Keys: KeysEnv}); err == nil {
+		t.Error("expected an error when two keys export as the same name")
+	}
+	if _, err := Export(src, peanut.NewVM(), Options{}); err == nil {
+		t.Error("expected an error without a name")
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir := t.TempDir()
+	stdin := filepath.Join(dir, "stdin")
+	script := filepath.Join(dir, "kubectl")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\"\ncat > "+stdin+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous string) { KubectlCommand = previous }(KubectlCommand)
+	KubectlCommand = script
+
+	manifests := []Manifest{{APIVersion: "v1", Kind: "ConfigMap", Metadata: Metadata{Name: "api"}, Data: map[string]string{"a": "1"}}}
+	out, err := Apply(manifests, "--context", "staging")
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if strings.TrimSpace(string(out)) != "apply -f - --context staging" {
+		t.Errorf("unexpected kubectl arguments %q", out)
+	}
+	applied, _ := os.ReadFile(stdin)
+	if !strings.Contains(string(applied), "name: api") {
+		t.Errorf("kubectl did not receive the manifests:\n%s", applied)
+	}
+
+	KubectlCommand = filepath.Join(dir, "missing")
+	if _, err := Apply(manifests); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestHelmAndKustomize(t *testing.T) {
+	dir := t.TempDir()
+	base := `[k8s]
+name: "api"
+namespace: "payments"
+
+# Primary database
+[database]
+host: "db.internal"
+pool: 10
+password: @secret("c2VjcmV0")
+
+[app]
+# Enabled features
+features: ["search"]
+replicas: 2
+`
+	overlay := `[database =]
+# Production cluster
+host: "db.prod"
+
+[app]
+features +=: ["audit"]
+`
+	if err := os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte(base), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "peanu.production.tsk"), []byte(overlay), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := func(env string) Source {
+		h, err := peanut.ResolveHierarchy(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env != "" {
+			if err := h.Overlay(filepath.Join(dir, "peanu."+env+".tsk")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		values, err := h.Config.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Source{Values: values, Comments: h.Comments}
+	}
+	envs := []Environment{{Name: "production", Source: source("production")}}
+
+	helm, err := Helm(source(""), envs, peanut.NewVM(), Options{})
+	if err != nil {
+		t.Fatalf("Helm returned error: %v", err)
+	}
+	if len(helm.Files) != 2 || helm.Files[0].Path != "values.yaml" || helm.Files[1].Path != "values-production.yaml" {
+		t.Fatalf("unexpected Helm files %+v", helm.Files)
+	}
+	if strings.Join(helm.Skipped, ",") != "database.password" {
+		t.Errorf("Skipped = %v, want the @secret key", helm.Skipped)
+	}
+	values := string(helm.Files[0].Data)
+	for _, want := range []string{"# Primary database\ndatabase:\n", "  host: db.internal\n", "  # Enabled features\n  features:\n    - search\n"} {
+		if !strings.Contains(values, want) {
+			t.Errorf("values.yaml lacks %q:\n%s", want, values)
+		}
+	}
+	if strings.Contains(values, "k8s") || strings.Contains(values, "password") {
+		t.Errorf("values.yaml exports the k8s section or a secret:\n%s", values)
+	}
+	want := `app:
+  # Enabled features
+  features:
+    - search
+    - audit
+# Primary database
+database:
+  # Production cluster
+  host: db.prod
+  pool: null
+`
+	if got := string(helm.Files[1].Data); got != want {
+		t.Errorf("values-production.yaml =\n%s\nwant\n%s", got, want)
+	}
+
+	kustomize, err := Kustomize(source(""), envs, peanut.NewVM(), Options{})
+	if err != nil {
+		t.Fatalf("Kustomize returned error: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range kustomize.Files {
+		files[f.Path] = string(f.Data)
+	}
+	if !strings.Contains(files["base/kustomization.yaml"], "namespace: payments") ||
+		!strings.Contains(files["overlays/production/kustomization.yaml"], "- ../../base") {
+		t.Errorf("unexpected kustomizations: %v", files)
+	}
+	if cm := files["base/configmap.yaml"]; !strings.Contains(cm, "kind: ConfigMap") || !strings.Contains(cm, `database.pool: "10"`) {
+		t.Errorf("unexpected base ConfigMap:\n%s", cm)
+	}
+	patch := files["overlays/production/configmap-patch.yaml"]
+	for _, want := range []string{"  name: api\n", `  app.features: '["search","audit"]'`, "  # Production cluster\n  database.host: db.prod\n", "  database.pool: null\n"} {
+		if !strings.Contains(patch, want) {
+			t.Errorf("patch lacks %q:\n%s", want, patch)
+		}
+	}
+	if strings.Contains(patch, "replicas") {
+		t.Errorf("patch carries an unchanged key:\n%s", patch)
+	}
+}
@@ -0,0 +1,311 @@
+package k8s
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a generated file
+type File struct {
+	// Path is relative to the output directory
+	Path string `json:"path"`
+	Data []byte `json:"-"`
+}
+
+// Bundle is the files of a Helm or Kustomize export
+type Bundle struct {
+	Files []File `json:"files"`
+	// Skipped lists the sensitive keys left out; they belong in the Secret
+	// of Export, not in files checked in next to a chart
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// Environment is an environment overlay, exported as what it changes
+type Environment struct {
+	Name string
+	// Source holds the base with the overlay merged in, the way
+	// peanut.Hierarchy.Overlay merges it
+	Source Source
+}
+
+// Helm returns a values.yaml for the base and a values-<env>.yaml per
+// environment holding only what its overlay changes, to be passed after the
+// base:
+//
+//	helm upgrade api ./chart -f values.yaml -f values-production.yaml
+//
+// Helm deep-merges maps but replaces lists, so a list an overlay appends to
+// ("key +=:") is written whole, and keys a replace annotation ("key =:",
+// "[section =]") drops are set to null, which Helm removes. Comments above
+// keys and sections become YAML comments.
+func Helm(base Source, envs []Environment, vm *peanut.VM, opts Options) (*Bundle, error) {
+	opts = withSection(base.Values, opts)
+	bundle := &Bundle{}
+	skipped := make(map[string]bool)
+
+	b, err := exportLayer(base, vm, opts, skipped)
+	if err != nil {
+		return nil, err
+	}
+	data, err := valuesYAML(b, nil, base.Comments)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Files = append(bundle.Files, File{Path: "values.yaml", Data: data})
+
+	for _, env := range envs {
+		e, err := exportLayer(env.Source, vm, opts, skipped)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", env.Name, err)
+		}
+		changed, removed := diff(b, e)
+		data, err := valuesYAML(changed, removed, env.Source.Comments)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Files = append(bundle.Files, File{Path: "values-" + env.Name + ".yaml", Data: data})
+	}
+	bundle.Skipped = sortedSet(skipped)
+	return bundle, nil
+}
+
+// Kustomize returns a base holding the ConfigMap of the base configuration
+// and an overlay per environment patching it:
+//
+//	base/kustomization.yaml
+//	base/configmap.yaml
+//	overlays/<env>/kustomization.yaml
+//	overlays/<env>/configmap-patch.yaml
+//
+// Patches are strategic merges: they carry the data keys an overlay changes,
+// lists whole as in the ConfigMap, and null for the keys it drops.
+func Kustomize(base Source, envs []Environment, vm *peanut.VM, opts Options) (*Bundle, error) {
+	opts, err := prepare(base, opts)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{}
+	skipped := make(map[string]bool)
+
+	b, err := exportLayer(base, vm, opts, skipped)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNames(b, opts.Keys); err != nil {
+		return nil, err
+	}
+	configMap := Manifest{APIVersion: "v1", Kind: "ConfigMap", Metadata: opts.metadata(opts.Name)}
+	data, err := manifestYAML(configMap, b, nil, base.Comments, opts.Keys)
+	if err != nil {
+		return nil, err
+	}
+	kustomization, err := encodeYAML(Kustomization{
+		APIVersion: KustomizeAPIVersion, Kind: "Kustomization",
+		Namespace: opts.Namespace, Resources: []string{"configmap.yaml"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	bundle.Files = append(bundle.Files,
+		File{Path: "base/kustomization.yaml", Data: kustomization},
+		File{Path: "base/configmap.yaml", Data: data})
+
+	for _, env := range envs {
+		e, err := exportLayer(env.Source, vm, opts, skipped)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", env.Name, err)
+		}
+		if err := checkNames(e, opts.Keys); err != nil {
+			return nil, fmt.Errorf("%s: %w", env.Name, err)
+		}
+		changed, removed := diff(b, e)
+		patch := Manifest{APIVersion: "v1", Kind: "ConfigMap", Metadata: Metadata{Name: opts.Name}}
+		data, err := manifestYAML(patch, changed, removed, env.Source.Comments, opts.Keys)
+		if err != nil {
+			return nil, err
+		}
+		kustomization, err := encodeYAML(Kustomization{
+			APIVersion: KustomizeAPIVersion, Kind: "Kustomization",
+			Resources: []string{"../../base"}, Patches: []KustomizePatch{{Path: "configmap-patch.yaml"}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		dir := path.Join("overlays", env.Name)
+		bundle.Files = append(bundle.Files,
+			File{Path: path.Join(dir, "kustomization.yaml"), Data: kustomization},
+			File{Path: path.Join(dir, "configmap-patch.yaml"), Data: data})
+	}
+	bundle.Skipped = sortedSet(skipped)
+	return bundle, nil
+}
+
+// KustomizeAPIVersion is the apiVersion of generated kustomization files
+const KustomizeAPIVersion = "kustomize.config.k8s.io/v1beta1"
+
+// Kustomization is a kustomization.yaml
+type Kustomization struct {
+	APIVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Namespace  string           `yaml:"namespace,omitempty"`
+	Resources  []string         `yaml:"resources"`
+	Patches    []KustomizePatch `yaml:"patches,omitempty"`
+}
+
+// KustomizePatch is an entry of the patches of a kustomization
+type KustomizePatch struct {
+	Path string `yaml:"path"`
+}
+
+// exportLayer leaves out the sensitive keys of src, adding them to
+// skipped, and resolves the rest; secrets are never decrypted
+func exportLayer(src Source, vm *peanut.VM, opts Options, skipped map[string]bool) (map[string]interface{}, error) {
+	kept := Source{Values: make(map[string]interface{}, len(src.Values)), Comments: src.Comments}
+	for key, value := range src.Values {
+		if sensitive(key, value, src.Comments[key], opts.Secrets) {
+			skipped[key] = true
+			continue
+		}
+		kept.Values[key] = value
+	}
+	_, resolved, err := resolve(kept, vm)
+	return resolved, err
+}
+
+// diff returns the keys env sets differently from base, and the keys of
+// base env no longer has
+func diff(base, env map[string]interface{}) (map[string]interface{}, []string) {
+	changed := make(map[string]interface{})
+	for key, value := range env {
+		if previous, ok := base[key]; !ok || !reflect.DeepEqual(previous, value) {
+			changed[key] = value
+		}
+	}
+	var removed []string
+	for key := range base {
+		if _, ok := env[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// valuesYAML renders flat values nested by section, with removed keys set
+// to null and comments above their keys and sections
+func valuesYAML(values map[string]interface{}, removed []string, comments map[string]string) ([]byte, error) {
+	flat := make(map[string]interface{}, len(values)+len(removed))
+	for key, value := range values {
+		flat[key] = value
+	}
+	for _, key := range removed {
+		flat[key] = nil
+	}
+	node, err := valuesNode(config.Nest(flat), "", comments)
+	if err != nil {
+		return nil, err
+	}
+	return encodeYAML(node)
+}
+
+// valuesNode builds the mapping node of a section of a nested tree
+func valuesNode(tree map[string]interface{}, prefix string, comments map[string]string) (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, name := range sortedKeys(tree) {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		keyNode := &yaml.Node{}
+		if err := keyNode.Encode(name); err != nil {
+			return nil, err
+		}
+		keyNode.HeadComment = yamlComment(comments[key])
+
+		var valueNode *yaml.Node
+		if section, ok := tree[name].(map[string]interface{}); ok {
+			child, err := valuesNode(section, key, comments)
+			if err != nil {
+				return nil, err
+			}
+			valueNode = child
+		} else {
+			valueNode = &yaml.Node{}
+			if err := valueNode.Encode(tree[name]); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		node.Content = append(node.Content, keyNode, valueNode)
+	}
+	return node, nil
+}
+
+// manifestYAML renders m with values as its data, removed keys set to null
+// and comments above the data keys
+func manifestYAML(m Manifest, values map[string]interface{}, removed []string, comments map[string]string, style string) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(m); err != nil {
+		return nil, err
+	}
+
+	keys := append(sortedKeys(values), removed...)
+	sort.Strings(keys)
+	data := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range keys {
+		keyNode := &yaml.Node{}
+		if err := keyNode.Encode(dataName(key, style)); err != nil {
+			return nil, err
+		}
+		keyNode.HeadComment = yamlComment(comments[key])
+
+		valueNode := &yaml.Node{}
+		var value interface{}
+		if v, ok := values[key]; ok {
+			text, err := dataValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			value = text
+		}
+		if err := valueNode.Encode(value); err != nil {
+			return nil, err
+		}
+		data.Content = append(data.Content, keyNode, valueNode)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "data" {
+			node.Content[i+1] = data
+		}
+	}
+	return encodeYAML(&node)
+}
+
+// yamlComment returns a TSK comment as a YAML comment, without the
+// k8s:secret marker
+func yamlComment(comment string) string {
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		if strings.TrimSpace(line) != SecretMarker {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// sortedSet returns the members of a set in order
+func sortedSet(set map[string]bool) []string {
+	var members []string
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
@@ -0,0 +1,417 @@
+// Package lineedit reads command lines from a terminal with emacs-style
+// editing, history and tab completion, for `tsk shell`. When the input is
+// not a terminal, lines are read as they come, so scripts can be piped in.
+//
+// Split and Quote turn lines into arguments and back with shell quoting:
+//
+//	config get 'app.name'  "database.host"  path\ with\ spaces
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInterrupt is returned by ReadLine when the user presses Ctrl+C
+var ErrInterrupt = errors.New("interrupted")
+
+// ErrUnterminated is returned by Split for a line that ends inside quotes
+// or after a backslash, which continues on the next line
+var ErrUnterminated = errors.New("unterminated quote or escape")
+
+// MaxHistory caps the entries kept in memory and in the history file
+const MaxHistory = 1000
+
+// Completer returns the candidates for word, the word under the cursor,
+// after args, the words before it. Both are unquoted, and so are the
+// candidates. A candidate ending in '.', '/' or '=' is not followed by a
+// space, so its completion can continue.
+type Completer func(args []string, word string) []string
+
+// Editor reads lines
+type Editor struct {
+	// Prompt is printed before each line
+	Prompt string
+	// Complete is called on Tab; nil disables completion
+	Complete Completer
+
+	in          *bufio.Reader
+	out         io.Writer
+	fd          int
+	raw         bool
+	history     []string
+	historyFile string
+}
+
+// NewEditor reads from in and echoes to out. Editing needs in to be a
+// terminal; otherwise ReadLine reads plain lines.
+func NewEditor(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{in: bufio.NewReader(in), out: out, fd: -1}
+	if file, ok := in.(*os.File); ok && isTerminal(int(file.Fd())) {
+		e.fd, e.raw = int(file.Fd()), true
+	}
+	return e
+}
+
+// UseHistoryFile loads the history from file and appends new entries to it
+func (e *Editor) UseHistoryFile(file string) error {
+	e.historyFile = file
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, strings.ReplaceAll(line, `\n`, "\n"))
+		}
+	}
+	if len(e.history) > MaxHistory {
+		e.history = e.history[len(e.history)-MaxHistory:]
+		// Compact the file so it does not grow without bound
+		var data strings.Builder
+		for _, entry := range e.history {
+			data.WriteString(strings.ReplaceAll(entry, "\n", `\n`) + "\n")
+		}
+		os.WriteFile(file, []byte(data.String()), 0600)
+	}
+	return nil
+}
+
+// History returns the entries, oldest first
+func (e *Editor) History() []string {
+	return e.history
+}
+
+// AddHistory appends line to the history and the history file, skipping
+// blank lines and repeats of the last entry. Newlines are kept, as \n in
+// the file.
+func (e *Editor) AddHistory(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > MaxHistory {
+		e.history = e.history[1:]
+	}
+	if e.historyFile == "" {
+		return
+	}
+	file, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, strings.ReplaceAll(line, "\n", `\n`))
+}
+
+// ReadLine prints the prompt and returns the next line, without its
+// newline. It returns io.EOF at the end of input or on Ctrl+D at an empty
+// line, and ErrInterrupt on Ctrl+C.
+func (e *Editor) ReadLine() (string, error) {
+	if !e.raw {
+		fmt.Fprint(e.out, e.Prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	if e.fd >= 0 {
+		restore, err := makeRaw(e.fd)
+		if err != nil {
+			return "", fmt.Errorf("failed to set up the terminal: %w", err)
+		}
+		defer restore()
+	}
+	return e.edit()
+}
+
+// ReadPassword prints the prompt and returns the next line without
+// echoing it, for passwords. Backspace is the only editing key; Ctrl+C
+// returns ErrInterrupt. Plain input is read like ReadLine does.
+func (e *Editor) ReadPassword() (string, error) {
+	if !e.raw {
+		return e.ReadLine()
+	}
+	if e.fd >= 0 {
+		restore, err := makeRaw(e.fd)
+		if err != nil {
+			return "", fmt.Errorf("failed to set up the terminal: %w", err)
+		}
+		defer restore()
+	}
+	fmt.Fprint(e.out, e.Prompt)
+	var buf []rune
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl+C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupt
+		case 4: // Ctrl+D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+		case 127, 8: // Backspace
+			if len(buf) > 0 {
+				buf = buf[:len(buf)-1]
+			}
+		default:
+			if unicode.IsPrint(r) {
+				buf = append(buf, r)
+			}
+		}
+	}
+}
+
+// line is the state of the line being edited
+type line struct {
+	buf []rune
+	pos int
+}
+
+// edit runs the editing loop on raw input
+func (e *Editor) edit() (string, error) {
+	var l line
+	// Browsing the history: index into e.history, and the line being typed
+	// before browsing started
+	index, pending := len(e.history), ""
+	e.refresh(&l)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(l.buf), nil
+		case 3: // Ctrl+C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupt
+		case 4: // Ctrl+D
+			if len(l.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			l.delete()
+		case '\t':
+			e.complete(&l)
+		case 127, 8: // Backspace, Ctrl+H
+			if l.pos > 0 {
+				l.pos--
+				l.delete()
+			}
+		case 1: // Ctrl+A
+			l.pos = 0
+		case 5: // Ctrl+E
+			l.pos = len(l.buf)
+		case 2: // Ctrl+B
+			l.pos = max(l.pos-1, 0)
+		case 6: // Ctrl+F
+			l.pos = min(l.pos+1, len(l.buf))
+		case 11: // Ctrl+K
+			l.buf = l.buf[:l.pos]
+		case 21: // Ctrl+U
+			l.buf, l.pos = l.buf[l.pos:], 0
+		case 23: // Ctrl+W
+			start := l.pos
+			for start > 0 && unicode.IsSpace(l.buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(l.buf[start-1]) {
+				start--
+			}
+			l.buf, l.pos = append(l.buf[:start], l.buf[l.pos:]...), start
+		case 12: // Ctrl+L
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case 16, 14: // Ctrl+P, Ctrl+N
+			index, pending = e.browse(&l, index, pending, r == 16)
+		case 27: // Escape sequences: arrows, Home, End, Delete
+			switch e.escape() {
+			case 'A':
+				index, pending = e.browse(&l, index, pending, true)
+			case 'B':
+				index, pending = e.browse(&l, index, pending, false)
+			case 'C':
+				l.pos = min(l.pos+1, len(l.buf))
+			case 'D':
+				l.pos = max(l.pos-1, 0)
+			case 'H':
+				l.pos = 0
+			case 'F':
+				l.pos = len(l.buf)
+			case '~':
+				l.delete()
+			}
+		default:
+			if unicode.IsPrint(r) {
+				l.insert([]rune{r})
+			}
+		}
+		e.refresh(&l)
+	}
+}
+
+// escape reads the rest of an escape sequence and reduces it to a key:
+// A-D for arrows, H and F for Home and End, '~' for Delete, 0 otherwise
+func (e *Editor) escape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+	var param []rune
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0
+		}
+		if r < '0' || r > '9' && r != ';' {
+			break
+		}
+		param = append(param, r)
+	}
+	if r != '~' {
+		return r
+	}
+	switch string(param) {
+	case "1", "7":
+		return 'H'
+	case "4", "8":
+		return 'F'
+	case "3":
+		return '~'
+	}
+	return 0
+}
+
+// browse moves through the history, older when up
+func (e *Editor) browse(l *line, index int, pending string, up bool) (int, string) {
+	if up && index > 0 {
+		if index == len(e.history) {
+			pending = string(l.buf)
+		}
+		index--
+		l.buf = []rune(e.history[index])
+	} else if !up && index < len(e.history) {
+		index++
+		if index == len(e.history) {
+			l.buf = []rune(pending)
+		} else {
+			l.buf = []rune(e.history[index])
+		}
+	}
+	l.pos = len(l.buf)
+	return index, pending
+}
+
+// complete completes the word under the cursor, listing the candidates
+// when they share no longer prefix
+func (e *Editor) complete(l *line) {
+	if e.Complete == nil {
+		return
+	}
+	start, word := lastWord(string(l.buf[:l.pos]))
+	args, _ := Split(string(l.buf[:start]))
+	var matches []string
+	for _, candidate := range e.Complete(args, word) {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		fmt.Fprint(e.out, "\a")
+	case len(matches) == 1:
+		completion := Quote(matches[0])
+		if !strings.ContainsAny(matches[0][len(matches[0])-1:], "./=") {
+			completion += " "
+		}
+		l.replace(start, completion)
+	default:
+		prefix := commonPrefix(matches)
+		if len(prefix) > len(word) {
+			l.replace(start, Quote(prefix))
+			return
+		}
+		sort.Strings(matches)
+		fmt.Fprint(e.out, "\r\n")
+		e.list(matches)
+	}
+}
+
+// list prints candidates in columns
+func (e *Editor) list(candidates []string) {
+	width := 0
+	for _, c := range candidates {
+		width = max(width, utf8.RuneCountInString(c))
+	}
+	width += 2
+	columns := max(80/width, 1)
+	for i, c := range candidates {
+		fmt.Fprintf(e.out, "%-*s", width, c)
+		if (i+1)%columns == 0 || i == len(candidates)-1 {
+			fmt.Fprint(e.out, "\r\n")
+		}
+	}
+}
+
+// refresh redraws the prompt and the line, and places the cursor
+func (e *Editor) refresh(l *line) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.Prompt, string(l.buf))
+	if back := len(l.buf) - l.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+func (l *line) insert(runes []rune) {
+	l.buf = append(l.buf[:l.pos], append(runes, l.buf[l.pos:]...)...)
+	l.pos += len(runes)
+}
+
+// delete removes the rune under the cursor
+func (l *line) delete() {
+	if l.pos < len(l.buf) {
+		l.buf = append(l.buf[:l.pos], l.buf[l.pos+1:]...)
+	}
+}
+
+// replace swaps the runes from start to the cursor for text
+func (l *line) replace(start int, text string) {
+	rest := append([]rune(nil), l.buf[l.pos:]...)
+	l.buf, l.pos = l.buf[:start], start
+	l.insert([]rune(text))
+	l.buf = append(l.buf, rest...)
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,193 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := map[string][]string{
+		`config get app.name`:    {"config", "get", "app.name"},
+		`  spaced   out  `:       {"spaced", "out"},
+		`set 'a b' "c \"d\" \e"`: {"set", "a b", `c "d" \e`},
+		`path\ with\ spaces x`:   {"path with spaces", "x"},
+		`empty '' ""`:            {"empty", "", ""},
+		`mixed'single'"double"`:  {"mixedsingledouble"},
+		`'it'\''s'`:              {"it's"},
+	}
+	for line, want := range tests {
+		got, err := Split(line)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Split(%q) = %q, %v; want %q", line, got, err, want)
+		}
+	}
+	for _, line := range []string{`open 'quote`, `open "quote`, `trailing \`} {
+		if _, err := Split(line); !errors.Is(err, ErrUnterminated) {
+			t.Errorf("Split(%q) should be unterminated, got %v", line, err)
+		}
+	}
+	for _, arg := range []string{"plain", "a b", "it's", `back\slash`, ""} {
+		if got, err := Split(Quote(arg)); err != nil || len(got) != 1 || got[0] != arg {
+			t.Errorf("Quote(%q) = %s does not split back: %q, %v", arg, Quote(arg), got, err)
+		}
+	}
+}
+
+func TestLastWord(t *testing.T) {
+	tests := []struct {
+		head  string
+		start int
+		word  string
+	}{
+		{"", 0, ""},
+		{"config ", 7, ""},
+		{"config ge", 7, "ge"},
+		{"get 'app.na", 4, "app.na"},
+		{`get a\ b`, 4, "a b"},
+	}
+	for _, tt := range tests {
+		if start, word := lastWord(tt.head); start != tt.start || word != tt.word {
+			t.Errorf("lastWord(%q) = %d, %q; want %d, %q", tt.head, start, word, tt.start, tt.word)
+		}
+	}
+}
+
+// editor returns an Editor reading keys from input as a terminal would
+// send them
+func editor(input string) (*Editor, *strings.Builder) {
+	out := &strings.Builder{}
+	e := NewEditor(strings.NewReader(input), out)
+	e.in, e.raw = bufio.NewReader(strings.NewReader(input)), true
+	return e, out
+}
+
+func TestEdit(t *testing.T) {
+	keys := strings.Join([]string{
+		"helo\x1b[D\x1b[Dl\r",        // left twice, insert
+		"abc\x01x\x05y\x0b\r",        // Ctrl+A, Ctrl+E, Ctrl+K
+		"one two\x17three\r",         // Ctrl+W
+		"\x1b[A\x1b[A\x1b[A\x1b[B\r", // history: up three times, down
+		"x\x7f\x7fz\x1b[H\x1b[3~\r",  // backspace past the start, Home, Delete
+		"typed\x03",                  // Ctrl+C
+		"\x04",                       // Ctrl+D
+	}, "")
+	e, out := editor(keys)
+	e.Prompt = "> "
+	var lines []string
+	for {
+		line, err := e.ReadLine()
+		if errors.Is(err, ErrInterrupt) {
+			lines = append(lines, "^C")
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadLine failed: %v", err)
+		}
+		lines = append(lines, line)
+		e.AddHistory(line)
+	}
+	want := []string{"hello", "xabcy", "one three", "xabcy", "", "^C"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got lines %q, want %q", lines, want)
+	}
+	if !strings.Contains(out.String(), "> hello") {
+		t.Errorf("the line should be echoed after the prompt: %q", out.String())
+	}
+	if !reflect.DeepEqual(e.History(), []string{"hello", "xabcy", "one three", "xabcy"}) {
+		t.Errorf("unexpected history %q", e.History())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	commands := []string{"config", "compile", "convert", "cache"}
+	complete := func(args []string, word string) []string {
+		if len(args) > 0 {
+			return []string{"app.", "app.name", "my key"}
+		}
+		return commands
+	}
+
+	e, out := editor("co\t\tnf\tget ap\tn\t\r" + "config get my\t\r" + "x\t\r")
+	e.Complete = complete
+	for _, want := range []string{"config get app.name ", "config get 'my key' ", "x"} {
+		if line, err := e.ReadLine(); err != nil || line != want {
+			t.Errorf("got %q, %v; want %q", line, err, want)
+		}
+	}
+	// The ambiguous "co" lists the candidates, and "x" rings the bell
+	if !strings.Contains(out.String(), "compile  config   convert") || !strings.Contains(out.String(), "\a") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+	e := NewEditor(strings.NewReader(""), io.Discard)
+	if err := e.UseHistoryFile(file); err != nil {
+		t.Fatalf("UseHistoryFile failed: %v", err)
+	}
+	for _, line := range []string{"version", "version", "  ", "config get 'a\nb'"} {
+		e.AddHistory(line)
+	}
+
+	e = NewEditor(strings.NewReader(""), io.Discard)
+	if err := e.UseHistoryFile(file); err != nil {
+		t.Fatalf("UseHistoryFile failed: %v", err)
+	}
+	if !reflect.DeepEqual(e.History(), []string{"version", "config get 'a\nb'"}) {
+		t.Errorf("unexpected history %q", e.History())
+	}
+
+	var lines []string
+	for i := 0; i < MaxHistory+10; i++ {
+		lines = append(lines, "entry")
+	}
+	os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0600)
+	e = NewEditor(strings.NewReader(""), io.Discard)
+	e.UseHistoryFile(file)
+	data, _ := os.ReadFile(file)
+	if len(e.History()) != MaxHistory || strings.Count(string(data), "\n") != MaxHistory {
+		t.Errorf("the history should be capped at %d, got %d entries", MaxHistory, len(e.History()))
+	}
+}
+
+func TestPlainInput(t *testing.T) {
+	out := &strings.Builder{}
+	e := NewEditor(strings.NewReader("version\r\nconfig get x"), out)
+	e.Prompt = "tsk> "
+	first, err1 := e.ReadLine()
+	second, err2 := e.ReadLine()
+	_, err3 := e.ReadLine()
+	if first != "version" || second != "config get x" || err1 != nil || err2 != nil || err3 != io.EOF {
+		t.Errorf("got %q, %q, %v, %v, %v", first, second, err1, err2, err3)
+	}
+	if out.String() != "tsk> tsk> tsk> " {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestReadPassword(t *testing.T) {
+	e, out := editor("secrex\x7ft\r")
+	e.Prompt = "Password: "
+	password, err := e.ReadPassword()
+	if err != nil || password != "secret" {
+		t.Errorf("ReadPassword = %q, %v", password, err)
+	}
+	if strings.Contains(out.String(), "sec") {
+		t.Errorf("the password was echoed: %q", out.String())
+	}
+
+	e = NewEditor(strings.NewReader("hunter22\n"), &strings.Builder{})
+	if password, err := e.ReadPassword(); err != nil || password != "hunter22" {
+		t.Errorf("ReadPassword from plain input = %q, %v", password, err)
+	}
+}
@@ -0,0 +1,118 @@
+package lineedit
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Split breaks a line into arguments the way a shell does: whitespace
+// separates them, single quotes keep everything literal, double quotes keep
+// whitespace and honour \" and \\, and a backslash outside quotes escapes
+// the next character. It returns ErrUnterminated when the line ends inside
+// quotes or after a backslash.
+func Split(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord, escaped := false, false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == '\\':
+			escaped, inWord = true, true
+		case unicode.IsSpace(r):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return args, ErrUnterminated
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// Quote returns arg as Split reads it back, single-quoted when it holds
+// whitespace, quotes or backslashes
+func Quote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// lastWord returns where the word under the cursor starts in head, in
+// runes, and the word unquoted
+func lastWord(head string) (int, string) {
+	runes := []rune(head)
+	start := len(runes)
+	inWord, escaped := false, false
+	var quote rune
+	for i, r := range runes {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' {
+				escaped = true
+			}
+		case unicode.IsSpace(r):
+			inWord = false
+			start = i + 1
+		default:
+			if !inWord {
+				start, inWord = i, true
+			}
+			if r == '\'' || r == '"' {
+				quote = r
+			} else if r == '\\' {
+				escaped = true
+			}
+		}
+	}
+	text := string(runes[start:])
+	// Close what is open so Split can read the partial word
+	if escaped {
+		text = text[:len(text)-1]
+	}
+	if quote != 0 {
+		text += string(quote)
+	}
+	words, _ := Split(text)
+	if len(words) == 0 {
+		return start, ""
+	}
+	return start, words[0]
+}
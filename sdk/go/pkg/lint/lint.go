@@ -0,0 +1,233 @@
+// Package lint checks TSK files for likely mistakes, for `tsk config lint`:
+// unused variables, duplicate keys, section-local variables shadowing
+// globals, numbers written as strings, fallbacks that can never be reached
+// and inconsistent key naming. Many findings carry a fix that edits the
+// lines of the file in place, so comments and layout survive --fix.
+//
+// Rules run in the order they are registered, the built-in ones first;
+// packages can add their own with Register:
+//
+//	lint.Register(lint.Rule{Name: "no-debug", Severity: lint.Warning, Check: func(f *lint.File, project []*lint.File) []lint.Finding {
+//		...
+//	}})
+package lint
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Severity is how serious a finding is
+type Severity string
+
+const (
+	// Error is almost certainly a bug, such as a key set twice
+	Error Severity = "error"
+	// Warning is likely a mistake
+	Warning Severity = "warning"
+	// Info is a matter of style
+	Info Severity = "info"
+)
+
+// Fix replaces lines Start to End (1-based, inclusive) of a file with Lines
+type Fix struct {
+	Start, End int
+	Lines      []string
+}
+
+// Finding is one problem reported by a rule
+type Finding struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Hint says how to solve findings --fix cannot
+	Hint    string `json:"hint,omitempty"`
+	Fixable bool   `json:"fixable"`
+
+	fix *Fix
+}
+
+// WithFix returns the finding with a fix attached
+func (f Finding) WithFix(fix Fix) Finding {
+	f.fix = &fix
+	f.Fixable = true
+	return f
+}
+
+// Check inspects one file of a project and reports its findings. project
+// holds every file being linted, f included, for rules that look across
+// files.
+type Check func(f *File, project []*File) []Finding
+
+// Rule is a named check with the severity of its findings
+type Rule struct {
+	Name        string   `json:"name"`
+	Severity    Severity `json:"severity"`
+	Description string   `json:"description"`
+	Check       Check    `json:"-"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = builtinRules()
+)
+
+// Register adds a rule, run after the built-in ones. A name that is
+// already registered is refused.
+func Register(rule Rule) error {
+	if rule.Name == "" || rule.Check == nil {
+		return fmt.Errorf("rule %q needs a name and a check", rule.Name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := lookup(registry, rule.Name); ok {
+		return fmt.Errorf("rule %s is already registered", rule.Name)
+	}
+	registry = append(registry, rule)
+	return nil
+}
+
+// Rules returns the registered rules, in the order they run
+func Rules() []Rule {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]Rule(nil), registry...)
+}
+
+// Options controls Lint
+type Options struct {
+	// Rules, when set, are the only rules run
+	Rules []string
+	// Fix applies the fixes of fixable findings and writes the files
+	Fix bool
+}
+
+// Report is the outcome of Lint
+type Report struct {
+	Files    []string  `json:"files"`
+	Findings []Finding `json:"findings"`
+	// Fixed is the number of findings --fix resolved
+	Fixed int `json:"fixed"`
+	// Changed lists the files --fix wrote
+	Changed []string `json:"changed,omitempty"`
+	// Counts holds the number of findings of each severity
+	Counts map[Severity]int `json:"counts"`
+}
+
+// Fixable returns the number of findings --fix would resolve
+func (r *Report) Fixable() int {
+	n := 0
+	for _, finding := range r.Findings {
+		if finding.Fixable {
+			n++
+		}
+	}
+	return n
+}
+
+// maxFixPasses bounds the fix loop; a fix can expose another finding,
+// such as a variable only an unused variable referred to
+const maxFixPasses = 10
+
+// Lint checks path, a file or a directory of .tsk and .peanuts files. With
+// Fix set, fixes are applied until none is left and the report lists what
+// remains.
+func Lint(path string, opts Options) (*Report, error) {
+	rules, err := selectRules(opts.Rules)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := findFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*File, len(paths))
+	for i, p := range paths {
+		if files[i], err = ParseFile(p); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &Report{Files: paths}
+	changed := make(map[*File]bool)
+	for pass := 0; ; pass++ {
+		report.Findings = []Finding{}
+		fixes := make(map[*File][]*Fix)
+		for _, f := range files {
+			for _, rule := range rules {
+				for _, finding := range rule.Check(f, files) {
+					finding.File, finding.Rule = f.Path, rule.Name
+					if finding.Severity == "" {
+						finding.Severity = rule.Severity
+					}
+					report.Findings = append(report.Findings, finding)
+					if finding.fix != nil {
+						fixes[f] = append(fixes[f], finding.fix)
+					}
+				}
+			}
+		}
+		if !opts.Fix || len(fixes) == 0 || pass == maxFixPasses {
+			break
+		}
+		for f, fileFixes := range fixes {
+			if n := f.apply(fileFixes); n > 0 {
+				report.Fixed += n
+				changed[f] = true
+				// Nodes moved with the lines; parse the result again
+				parsed := Parse(string(f.Content()))
+				f.Lines, f.Nodes = parsed.Lines, parsed.Nodes
+			}
+		}
+	}
+
+	for _, f := range files {
+		if !changed[f] {
+			continue
+		}
+		if err := os.WriteFile(f.Path, f.Content(), f.mode); err != nil {
+			return report, fmt.Errorf("failed to write %s: %w", f.Path, err)
+		}
+		report.Changed = append(report.Changed, f.Path)
+	}
+
+	report.Counts = make(map[Severity]int)
+	for _, finding := range report.Findings {
+		report.Counts[finding.Severity]++
+	}
+	return report, nil
+}
+
+// selectRules returns the registered rules named in only, or all of them
+func selectRules(only []string) ([]Rule, error) {
+	rules := Rules()
+	if len(only) == 0 {
+		return rules, nil
+	}
+	var selected []Rule
+	for _, name := range only {
+		rule, ok := lookup(rules, name)
+		if !ok {
+			var names []string
+			for _, r := range rules {
+				names = append(names, r.Name)
+			}
+			return nil, fmt.Errorf("unknown rule %q (available: %v)", name, names)
+		}
+		selected = append(selected, rule)
+	}
+	return selected, nil
+}
+
+func lookup(rules []Rule, name string) (Rule, bool) {
+	for _, rule := range rules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
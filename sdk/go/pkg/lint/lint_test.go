@@ -0,0 +1,178 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const sample = `# Shown in logs
+$app_name: "demo"
+# Nobody reads this
+$unused: 42
+$port: 8080
+
+[server]
+$port: 9090
+port: $port
+title: "${app_name} server"
+# first try
+timeout: "30"
+timeout: 60
+url: @env("URL", "http://x") || "http://fallback"  # keep me
+mode: @env("MODE") || "dev"
+retries: @env("RETRIES", 0) || 3
+version: "2"
+maxConnections: 10
+log_level: "info"
+`
+
+func findings(report *Report, rule string) []Finding {
+	var found []Finding
+	for _, f := range report.Findings {
+		if f.Rule == rule {
+			found = append(found, f)
+		}
+	}
+	return found
+}
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "peanu.tsk")
+	writeFile(t, file, sample)
+	// Schema files describe keys and are not linted
+	writeFile(t, filepath.Join(dir, "schema.tsk"), "[server]\nport: \"5432\"\n")
+
+	report, err := Lint(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 1 {
+		t.Errorf("files = %v", report.Files)
+	}
+
+	tests := []struct {
+		rule  string
+		lines []int
+	}{
+		{"duplicate-key", []int{12}},
+		{"unused-variable", []int{4}},
+		{"shadowed-local", []int{8}},
+		{"string-number", []int{12}},
+		{"unreachable-default", []int{14}},
+		{"naming", []int{18}},
+	}
+	for _, tt := range tests {
+		found := findings(report, tt.rule)
+		if len(found) != len(tt.lines) {
+			t.Errorf("%s: %+v", tt.rule, found)
+			continue
+		}
+		for i, f := range found {
+			if f.Line != tt.lines[i] {
+				t.Errorf("%s reported on line %d, want %d: %s", tt.rule, f.Line, tt.lines[i], f.Message)
+			}
+		}
+	}
+	if report.Counts[Error] != 1 || report.Fixable() != 4 {
+		t.Errorf("counts = %v, fixable = %d", report.Counts, report.Fixable())
+	}
+	if hint := findings(report, "naming")[0].Hint; hint != "tsk refactor rename server.maxConnections server.max_connections --write" {
+		t.Errorf("naming hint = %q", hint)
+	}
+
+	only, err := Lint(file, Options{Rules: []string{"naming"}})
+	if err != nil || len(only.Findings) != 1 {
+		t.Errorf("--rule naming = %+v, %v", only, err)
+	}
+	if _, err := Lint(file, Options{Rules: []string{"nope"}}); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+}
+
+func TestLintFix(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "peanu.tsk")
+	writeFile(t, file, sample)
+
+	report, err := Lint(file, Options{Fix: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changed) != 1 || report.Counts[Error] != 0 || report.Fixable() != 0 {
+		t.Errorf("report = %+v", report)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	for _, want := range []string{
+		"# Shown in logs\n$app_name: \"demo\"\n$port: 8080\n",
+		"title: \"${app_name} server\"\ntimeout: 60\n",
+		"url: @env(\"URL\", \"http://x\")  # keep me\n",
+		"mode: @env(\"MODE\") || \"dev\"\n",
+		"retries: @env(\"RETRIES\", 0) || 3\n",
+		"version: \"2\"\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("fixed file lacks %q:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "unused") || strings.Contains(content, "first try") {
+		t.Errorf("deleted lines left their comments behind:\n%s", content)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	rule := Rule{Name: "no-debug", Severity: Error, Check: func(f *File, project []*File) []Finding {
+		var found []Finding
+		for _, n := range f.Nodes {
+			if n.Path() == "debug" && n.Value == "true" {
+				found = append(found, Finding{Line: n.Line, Message: "debug is on"}.WithFix(Fix{Start: n.Line, End: n.Line, Lines: []string{"debug: false"}}))
+			}
+		}
+		return found
+	}}
+	if err := Register(rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(rule); err == nil {
+		t.Error("expected registering a rule twice to fail")
+	}
+
+	file := filepath.Join(t.TempDir(), "app.tsk")
+	writeFile(t, file, "debug: true\n")
+	report, err := Lint(file, Options{Rules: []string{"no-debug"}, Fix: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(file)
+	if report.Fixed != 1 || string(data) != "debug: false\n" {
+		t.Errorf("fixed %d, file %q", report.Fixed, data)
+	}
+}
+
+func TestRestyle(t *testing.T) {
+	tests := []struct{ name, style, want string }{
+		{"maxConnections", styleSnake, "max_connections"},
+		{"max_connections", styleCamel, "maxConnections"},
+		{"$log-level", stylePascal, "$LogLevel"},
+		{"LogLevel", styleKebab, "log-level"},
+	}
+	for _, tt := range tests {
+		if got := restyle(tt.name, tt.style); got != tt.want {
+			t.Errorf("restyle(%q, %s) = %q, want %q", tt.name, tt.style, got, tt.want)
+		}
+	}
+}
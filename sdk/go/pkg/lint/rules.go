@@ -0,0 +1,430 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+)
+
+// builtinRules returns the rules every lint runs unless told otherwise
+func builtinRules() []Rule {
+	return []Rule{
+		{"duplicate-key", Error, "A key is set twice in one file; the last value wins", checkDuplicateKeys},
+		{"unused-variable", Warning, "A $variable is defined but never referenced", checkUnusedVariables},
+		{"shadowed-local", Warning, "A section-local $variable hides a global of the same name", checkShadowedLocals},
+		{"string-number", Warning, "A number is quoted, so it is read as a string", checkStringNumbers},
+		{"unreachable-default", Warning, "A || fallback follows a value that is never empty, such as an @env default", checkUnreachableDefaults},
+		{"naming", Info, "A key does not follow the naming style of the rest of its file", checkNaming},
+	}
+}
+
+var (
+	variableRefPattern = regexp.MustCompile(`\$\{?\s*([A-Za-z_][A-Za-z0-9_]*)`)
+	numberPattern      = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+	literalPattern     = regexp.MustCompile(`^("[^"]*"|'[^']*'|-?[0-9]+(\.[0-9]+)?|true|false|null)$`)
+	envDefaultPattern  = regexp.MustCompile(`^@env\(\s*("[^"]*"|'[^']*')\s*,\s*(.+?)\s*\)$`)
+)
+
+// stringNames are key names whose values are strings even when they look
+// like numbers
+var stringNames = []string{"version", "zip", "postal", "phone", "code"}
+
+// deleteFix removes a node's line together with the comment above it
+func deleteFix(f *File, n *Node) Fix {
+	return Fix{Start: f.commentAbove(n.Line), End: n.Line}
+}
+
+// valueFix replaces the value of a node, keeping the rest of the line
+func valueFix(f *File, n *Node, value string) Fix {
+	line := f.Lines[n.Line-1]
+	return Fix{Start: n.Line, End: n.Line, Lines: []string{line[:n.ValueStart] + value + line[n.ValueEnd:]}}
+}
+
+// checkDuplicateKeys reports each value that a later line of the same file
+// overrides. Keys opening a list are left alone, since repeating them adds
+// items.
+func checkDuplicateKeys(f *File, project []*File) []Finding {
+	last := make(map[string]*Node)
+	for _, n := range f.Nodes {
+		if n.Kind == NodeKey && n.Value != "" {
+			last[n.Path()] = n
+		}
+	}
+	var findings []Finding
+	for _, n := range f.Nodes {
+		if n.Kind != NodeKey || n.Value == "" || last[n.Path()] == n {
+			continue
+		}
+		finding := Finding{
+			Line:    n.Line,
+			Column:  n.NameStart + 1,
+			Message: fmt.Sprintf("%s is set again on line %d, which wins", n.Path(), last[n.Path()].Line),
+		}
+		findings = append(findings, finding.WithFix(deleteFix(f, n)))
+	}
+	return findings
+}
+
+// checkUnusedVariables reports $variables nothing refers to. Globals may be
+// used from any file of the project; section-locals only from their scope.
+func checkUnusedVariables(f *File, project []*File) []Finding {
+	var findings []Finding
+	for _, def := range f.Nodes {
+		name, ok := def.Variable()
+		if !ok || def.Value == "" || referenced(f, project, def, name) {
+			continue
+		}
+		finding := Finding{
+			Line:    def.Line,
+			Column:  def.NameStart + 1,
+			Message: fmt.Sprintf("%s is never referenced", describeVariable(def)),
+		}
+		findings = append(findings, finding.WithFix(deleteFix(f, def)))
+	}
+	return findings
+}
+
+// referenced reports whether a value other than def's own refers to name
+// where def is visible
+func referenced(f *File, project []*File, def *Node, name string) bool {
+	scope := def.Scope()
+	files := project
+	if scope != "" {
+		files = []*File{f}
+	}
+	for _, file := range files {
+		for _, n := range file.Nodes {
+			if n == def || n.Value == "" {
+				continue
+			}
+			if scope != "" && n.Scope() != scope && !strings.HasPrefix(n.Scope(), scope+".") {
+				continue
+			}
+			for _, match := range variableRefPattern.FindAllStringSubmatch(n.Value, -1) {
+				if match[1] == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkShadowedLocals reports section-local variables named like a global
+// or a local of an enclosing scope
+func checkShadowedLocals(f *File, project []*File) []Finding {
+	var findings []Finding
+	for _, local := range f.Nodes {
+		name, ok := local.Variable()
+		if !ok || local.Scope() == "" {
+			continue
+		}
+		outer, file := shadowed(f, project, local, name)
+		if outer == nil {
+			continue
+		}
+		findings = append(findings, Finding{
+			Line:   local.Line,
+			Column: local.NameStart + 1,
+			Message: fmt.Sprintf("%s shadows %s (%s:%d); $%s below it means the local",
+				describeVariable(local), describeVariable(outer), file.Path, outer.Line, name),
+			Hint: fmt.Sprintf("rename one of them with tsk refactor rename %s <new>", local.Path()),
+		})
+	}
+	return findings
+}
+
+// shadowed returns the definition local hides, if any: a variable of an
+// enclosing scope in the same file, or a global of any file
+func shadowed(f *File, project []*File, local *Node, name string) (*Node, *File) {
+	scope := local.Scope()
+	for _, file := range project {
+		for _, n := range file.Nodes {
+			other, ok := n.Variable()
+			if !ok || other != name || n == local {
+				continue
+			}
+			outer := n.Scope()
+			if outer == "" || file == f && outer != scope && strings.HasPrefix(scope, outer+".") {
+				return n, file
+			}
+		}
+	}
+	return nil, nil
+}
+
+// describeVariable names a variable with its scope, as $port or $port in [server]
+func describeVariable(n *Node) string {
+	if n.Scope() == "" {
+		return "the global " + n.Name
+	}
+	return fmt.Sprintf("%s in [%s]", n.Name, n.Scope())
+}
+
+// checkStringNumbers reports quoted numbers, which the parser keeps as
+// strings, under keys that are not usually strings
+func checkStringNumbers(f *File, project []*File) []Finding {
+	var findings []Finding
+	for _, n := range f.Nodes {
+		if (n.Kind != NodeKey && n.Kind != NodeItem) || len(n.Value) < 2 {
+			continue
+		}
+		quote := n.Value[0]
+		if (quote != '"' && quote != '\'') || n.Value[len(n.Value)-1] != quote {
+			continue
+		}
+		inner := n.Value[1 : len(n.Value)-1]
+		if !numberPattern.MatchString(inner) || stringName(n) {
+			continue
+		}
+		what := n.Path()
+		if n.Kind == NodeItem {
+			what = "an item of " + n.Scope()
+		}
+		finding := Finding{
+			Line:    n.Line,
+			Column:  n.ValueStart + 1,
+			Message: fmt.Sprintf("%s is the string %s; unquoted it would be a number", what, n.Value),
+		}
+		findings = append(findings, finding.WithFix(valueFix(f, n, inner)))
+	}
+	return findings
+}
+
+// stringName reports whether the key of n names something that is a
+// string by nature, such as a version or zip code
+func stringName(n *Node) bool {
+	name := strings.ToLower(n.Path())
+	for _, s := range stringNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnreachableDefaults reports || chains with operands after one that
+// can never be empty, such as @env("PORT", 8080) || 3000
+func checkUnreachableDefaults(f *File, project []*File) []Finding {
+	var findings []Finding
+	for _, n := range f.Nodes {
+		if (n.Kind != NodeKey && n.Kind != NodeItem) || !strings.Contains(n.Value, "||") {
+			continue
+		}
+		operands, ok := splitOr(n.Value)
+		if !ok {
+			continue
+		}
+		for i, operand := range operands[:len(operands)-1] {
+			why, always := alwaysSet(operand.text)
+			if !always {
+				continue
+			}
+			unreachable := strings.TrimSpace(n.Value[operands[i+1].start:])
+			finding := Finding{
+				Line:    n.Line,
+				Column:  n.ValueStart + operands[i+1].start + 1,
+				Message: fmt.Sprintf("%s can never be used: %s", unreachable, why),
+			}
+			kept := strings.TrimRight(n.Value[:operand.end], " \t")
+			findings = append(findings, finding.WithFix(valueFix(f, n, kept)))
+			break
+		}
+	}
+	return findings
+}
+
+// operand is one side of a || chain, with its offsets in the value
+type operand struct {
+	text       string
+	start, end int
+}
+
+// splitOr splits a value at its top-level || operators. Values with a
+// top-level && or ?: are not split, as their operands do not fall through.
+func splitOr(value string) ([]operand, bool) {
+	var operands []operand
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(' || ch == '[' || ch == '{':
+			depth++
+		case ch == ')' || ch == ']' || ch == '}':
+			depth--
+		case depth > 0:
+		case ch == '?' || strings.HasPrefix(value[i:], "&&"):
+			return nil, false
+		case strings.HasPrefix(value[i:], "||"):
+			operands = append(operands, operand{strings.TrimSpace(value[start:i]), start, i})
+			start = i + 2
+			i++
+		}
+	}
+	operands = append(operands, operand{strings.TrimSpace(value[start:]), start, len(value)})
+	return operands, len(operands) > 1
+}
+
+// alwaysSet reports whether an operand can never be empty, and why
+func alwaysSet(text string) (string, bool) {
+	if m := envDefaultPattern.FindStringSubmatch(text); m != nil {
+		if literalPattern.MatchString(m[2]) && truthy(config.ParseValue(m[2])) {
+			return fmt.Sprintf("%s falls back to %s itself", text, m[2]), true
+		}
+		return "", false
+	}
+	if literalPattern.MatchString(text) && truthy(config.ParseValue(text)) {
+		return fmt.Sprintf("%s is never empty", text), true
+	}
+	return "", false
+}
+
+// truthy mirrors how expressions test values: nil, false, "" and 0 are empty
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case int:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	}
+	return true
+}
+
+// Naming styles
+const (
+	styleSnake  = "snake_case"
+	styleKebab  = "kebab-case"
+	styleCamel  = "camelCase"
+	stylePascal = "PascalCase"
+)
+
+var stylePatterns = []struct {
+	style   string
+	pattern *regexp.Regexp
+}{
+	{styleSnake, regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)+$`)},
+	{styleKebab, regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)+$`)},
+	{styleCamel, regexp.MustCompile(`^[a-z][a-z0-9]*([A-Z][a-z0-9]*)+$`)},
+	{stylePascal, regexp.MustCompile(`^[A-Z][a-z0-9]+([A-Z][a-z0-9]*)*$`)},
+}
+
+// styleOf returns the naming style of one segment, or "" for single
+// lowercase words, which fit every style
+func styleOf(segment string) string {
+	for _, sp := range stylePatterns {
+		if sp.pattern.MatchString(segment) {
+			return sp.style
+		}
+	}
+	return ""
+}
+
+// checkNaming reports key and section names written in another style than
+// most names of their file. Renaming changes what readers look up, so the
+// fix is left to tsk refactor rename.
+func checkNaming(f *File, project []*File) []Finding {
+	counts := make(map[string]int)
+	for _, n := range f.Nodes {
+		if n.Kind == NodeItem {
+			continue
+		}
+		for _, segment := range strings.Split(n.Name, ".") {
+			if style := styleOf(strings.TrimPrefix(segment, "$")); style != "" {
+				counts[style]++
+			}
+		}
+	}
+	dominant, best, tie := "", 0, false
+	for _, sp := range stylePatterns {
+		switch count := counts[sp.style]; {
+		case count > best:
+			dominant, best, tie = sp.style, count, false
+		case count == best && count > 0:
+			tie = true
+		}
+	}
+	if dominant == "" || tie {
+		return nil
+	}
+
+	var findings []Finding
+	for _, n := range f.Nodes {
+		if n.Kind == NodeItem {
+			continue
+		}
+		segments := strings.Split(n.Name, ".")
+		for i, segment := range segments {
+			style := styleOf(strings.TrimPrefix(segment, "$"))
+			if style == "" || style == dominant {
+				continue
+			}
+			path := append(append([]string(nil), n.Prefix...), segments[:i+1]...)
+			if n.Kind == NodeSection {
+				path = segments[:i+1]
+			}
+			old := strings.Join(path, ".")
+			path[len(path)-1] = restyle(segment, dominant)
+			findings = append(findings, Finding{
+				Line:    n.Line,
+				Column:  n.NameStart + 1,
+				Message: fmt.Sprintf("%s is %s; this file mostly uses %s", old, style, dominant),
+				Hint:    fmt.Sprintf("tsk refactor rename %s %s --write", old, strings.Join(path, ".")),
+			})
+		}
+	}
+	return findings
+}
+
+// restyle rewrites a name in another naming style, keeping a leading $
+func restyle(name, style string) string {
+	sigil := ""
+	if strings.HasPrefix(name, "$") {
+		sigil, name = "$", name[1:]
+	}
+	var words []string
+	var word []rune
+	for _, r := range name {
+		switch {
+		case r == '_' || r == '-':
+			words, word = append(words, string(word)), nil
+		case unicode.IsUpper(r) && len(word) > 0:
+			words, word = append(words, string(word)), []rune{unicode.ToLower(r)}
+		default:
+			word = append(word, unicode.ToLower(r))
+		}
+	}
+	words = append(words, string(word))
+
+	switch style {
+	case styleSnake:
+		return sigil + strings.Join(words, "_")
+	case styleKebab:
+		return sigil + strings.Join(words, "-")
+	}
+	for i, w := range words {
+		if w != "" && (i > 0 || style == stylePascal) {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return sigil + strings.Join(words, "")
+}
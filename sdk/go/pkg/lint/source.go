@@ -0,0 +1,196 @@
+package lint
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+)
+
+// NodeKind is what a line of a TSK file declares
+type NodeKind int
+
+const (
+	// NodeSection is a [name] header
+	NodeSection = NodeKind(config.DeclSection)
+	// NodeBlock opens a name { or name > block
+	NodeBlock = NodeKind(config.DeclBlock)
+	// NodeKey is a name: value pair, or name: opening a map or list
+	NodeKey = NodeKind(config.DeclKey)
+	// NodeItem is a - value list item
+	NodeItem = NodeKind(config.DeclItem)
+)
+
+// Node is one declaration of a File. The lines of the file are kept as
+// they are, comments and spacing included, so fixes edit them in place.
+type Node struct {
+	Kind NodeKind
+	// Line is the 1-based line of the declaration
+	Line int
+	// Prefix is the path of the section and blocks enclosing the node
+	Prefix []string
+	// Name is the name as written, without a merge annotation; it may be
+	// dotted. Items have none.
+	Name string
+	// NameStart is the byte offset of Name in the line
+	NameStart int
+	// Value is the value written on the line, without a trailing comment;
+	// ValueStart and ValueEnd delimit it in the line
+	Value                string
+	ValueStart, ValueEnd int
+}
+
+// Path returns the full dotted path of the node
+func (n *Node) Path() string {
+	return strings.Join(append(append([]string(nil), n.Prefix...), n.Name), ".")
+}
+
+// Scope returns the dotted path of the section and blocks enclosing the node
+func (n *Node) Scope() string {
+	return strings.Join(n.Prefix, ".")
+}
+
+// Variable returns the variable a key defines, without the $, when its
+// name is a single $name segment
+func (n *Node) Variable() (string, bool) {
+	if n.Kind != NodeKey || !strings.HasPrefix(n.Name, "$") || strings.Contains(n.Name, ".") {
+		return "", false
+	}
+	return n.Name[1:], true
+}
+
+// File is a parsed TSK file
+type File struct {
+	Path  string
+	Lines []string
+	Nodes []*Node
+	// newline records whether the file ends with a newline
+	newline bool
+	mode    fs.FileMode
+}
+
+// ParseFile reads and parses a .tsk or .peanuts file
+func ParseFile(path string) (*File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	f := Parse(string(data))
+	f.Path = path
+	f.mode = info.Mode().Perm()
+	return f, nil
+}
+
+// Parse parses TSK content with the nesting rules of config.LoadTSK
+func Parse(content string) *File {
+	f := &File{
+		Lines:   strings.Split(strings.TrimSuffix(content, "\n"), "\n"),
+		newline: strings.HasSuffix(content, "\n"),
+		mode:    0644,
+	}
+	for _, d := range config.Scan(f.Lines) {
+		f.Nodes = append(f.Nodes, &Node{
+			Kind:       NodeKind(d.Kind),
+			Line:       d.Line,
+			Prefix:     d.Prefix,
+			Name:       d.Name,
+			NameStart:  d.NameStart,
+			Value:      d.Value,
+			ValueStart: d.ValueStart,
+			ValueEnd:   d.ValueEnd,
+		})
+	}
+	return f
+}
+
+// commentAbove returns the 1-based first line of the # comment lines
+// directly above line, or line itself when there are none
+func (f *File) commentAbove(line int) int {
+	first := line
+	for first > 1 && strings.HasPrefix(strings.TrimSpace(f.Lines[first-2]), "#") {
+		first--
+	}
+	return first
+}
+
+// Content returns the file with fixes applied, or as read
+func (f *File) Content() []byte {
+	content := strings.Join(f.Lines, "\n")
+	if f.newline {
+		content += "\n"
+	}
+	return []byte(content)
+}
+
+// apply applies fixes bottom-up, skipping those that overlap one already
+// applied, and returns the number applied
+func (f *File) apply(fixes []*Fix) int {
+	sort.SliceStable(fixes, func(i, j int) bool { return fixes[i].Start > fixes[j].Start })
+	applied := 0
+	limit := len(f.Lines) + 1
+	for _, fix := range fixes {
+		if fix.End >= limit || fix.Start < 1 {
+			continue
+		}
+		lines := append(append([]string(nil), f.Lines[:fix.Start-1]...), fix.Lines...)
+		f.Lines = append(lines, f.Lines[fix.End:]...)
+		limit = fix.Start
+		applied++
+	}
+	return applied
+}
+
+// findFiles returns path when it is a file, or the .tsk and .peanuts
+// files under it, sorted. Schema and policy files describe keys rather
+// than define them and are left out.
+func findFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != path && skipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch filepath.Ext(p) {
+		case ".tsk", ".peanuts":
+			name := strings.TrimSuffix(d.Name(), filepath.Ext(p))
+			for _, role := range []string{"schema", "policy"} {
+				if name == role || strings.HasSuffix(name, "."+role) {
+					return nil
+				}
+			}
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", path, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// skipDirs are never scanned
+var skipDirs = map[string]bool{
+	".git": true, "node_modules": true, "vendor": true, ".idea": true, ".vscode": true,
+}
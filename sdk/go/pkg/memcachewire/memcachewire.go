@@ -0,0 +1,436 @@
+// Package memcachewire is a small memcached client speaking the text
+// protocol directly. Keys are spread over the servers by hash, each with a
+// pool of idle connections. It backs the memcached L3 cache level.
+package memcachewire
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures a Client
+type Options struct {
+	// Servers are host:port addresses; a host alone uses port 11211
+	Servers []string
+	// Timeout bounds dialing and each command; 0 means 2s
+	Timeout time.Duration
+	// MaxIdle is the number of idle connections kept per server; 0 means 2
+	MaxIdle int
+}
+
+// Error is an ERROR, CLIENT_ERROR or SERVER_ERROR reply
+type Error string
+
+func (e Error) Error() string {
+	return "memcached: " + string(e)
+}
+
+// maxRelativeTTL is the longest expiry memcached reads as seconds from
+// now; longer ones must be sent as a Unix time
+const maxRelativeTTL = 30 * 24 * time.Hour
+
+// Client sends commands to a set of servers
+type Client struct {
+	opts    Options
+	servers []*server
+}
+
+type server struct {
+	addr string
+	mu   sync.Mutex
+	idle []*conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// New returns a client for opts.Servers; connections open on first use
+func New(opts Options) (*Client, error) {
+	if len(opts.Servers) == 0 {
+		return nil, errors.New("memcached: no servers")
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = 2
+	}
+	c := &Client{opts: opts}
+	for _, addr := range opts.Servers {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "11211")
+		}
+		c.servers = append(c.servers, &server{addr: addr})
+	}
+	return c, nil
+}
+
+// pick returns the server holding key
+func (c *Client) pick(key string) *server {
+	return c.servers[crc32.ChecksumIEEE([]byte(key))%uint32(len(c.servers))]
+}
+
+// do runs fn on a connection to the server holding key. Connections that
+// fail mid-command are closed rather than pooled.
+func (c *Client) do(key string, fn func(*conn) error) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	s := c.pick(key)
+	s.mu.Lock()
+	var cn *conn
+	if n := len(s.idle); n > 0 {
+		cn, s.idle = s.idle[n-1], s.idle[:n-1]
+	}
+	s.mu.Unlock()
+	if cn == nil {
+		nc, err := net.DialTimeout("tcp", s.addr, c.opts.Timeout)
+		if err != nil {
+			return fmt.Errorf("memcached: failed to reach %s: %w", s.addr, err)
+		}
+		cn = &conn{Conn: nc, r: bufio.NewReader(nc)}
+	}
+
+	cn.SetDeadline(time.Now().Add(c.opts.Timeout))
+	err := fn(cn)
+	var reply Error
+	if err != nil && !errors.As(err, &reply) {
+		cn.Close()
+		return err
+	}
+	s.mu.Lock()
+	if len(s.idle) < c.opts.MaxIdle {
+		s.idle = append(s.idle, cn)
+		cn = nil
+	}
+	s.mu.Unlock()
+	if cn != nil {
+		cn.Close()
+	}
+	return err
+}
+
+// checkKey rejects keys the text protocol cannot carry
+func checkKey(key string) error {
+	if key == "" || len(key) > 250 {
+		return fmt.Errorf("memcached: key must be 1 to 250 bytes, got %d", len(key))
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return fmt.Errorf("memcached: key %q contains whitespace or control characters", key)
+		}
+	}
+	return nil
+}
+
+// readLine reads one reply line, turning error replies into Error
+func (cn *conn) readLine() (string, error) {
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	for _, prefix := range []string{"ERROR", "CLIENT_ERROR ", "SERVER_ERROR "} {
+		if strings.HasPrefix(line, prefix) {
+			return "", Error(line)
+		}
+	}
+	return line, nil
+}
+
+// Get returns the value at key; ok is false for a miss
+func (c *Client) Get(key string) (value []byte, ok bool, err error) {
+	err = c.do(key, func(cn *conn) error {
+		if _, err := fmt.Fprintf(cn, "get %s\r\n", key); err != nil {
+			return err
+		}
+		for {
+			line, err := cn.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			// VALUE <key> <flags> <bytes>
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[0] != "VALUE" {
+				return fmt.Errorf("memcached: unexpected reply %q", line)
+			}
+			n, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return fmt.Errorf("memcached: unexpected reply %q", line)
+			}
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(cn.r, data); err != nil {
+				return err
+			}
+			value, ok = data[:n], true
+		}
+	})
+	return value, ok, err
+}
+
+// Set stores value at key; a ttl of 0 never expires
+func (c *Client) Set(key string, value []byte, ttl time.Duration) error {
+	return c.do(key, func(cn *conn) error {
+		if _, err := fmt.Fprintf(cn, "set %s 0 %d %d\r\n", key, expiry(ttl), len(value)); err != nil {
+			return err
+		}
+		if _, err := cn.Write(append(value, '\r', '\n')); err != nil {
+			return err
+		}
+		return expect(cn, "STORED")
+	})
+}
+
+// expiry converts a ttl into the exptime field
+func expiry(ttl time.Duration) int64 {
+	switch {
+	case ttl <= 0:
+		return 0
+	case ttl > maxRelativeTTL:
+		return time.Now().Add(ttl).Unix()
+	case ttl < time.Second:
+		// 0 would mean never; round up to the shortest expiry there is
+		return 1
+	}
+	return int64(ttl / time.Second)
+}
+
+// Delete removes key; a missing key is not an error
+func (c *Client) Delete(key string) error {
+	return c.do(key, func(cn *conn) error {
+		if _, err := fmt.Fprintf(cn, "delete %s\r\n", key); err != nil {
+			return err
+		}
+		return expect(cn, "DELETED", "NOT_FOUND")
+	})
+}
+
+// Incr adds delta to the number at key; ok is false when key is missing
+func (c *Client) Incr(key string, delta uint64) (value uint64, ok bool, err error) {
+	err = c.do(key, func(cn *conn) error {
+		if _, err := fmt.Fprintf(cn, "incr %s %d\r\n", key, delta); err != nil {
+			return err
+		}
+		line, err := cn.readLine()
+		if err != nil || line == "NOT_FOUND" {
+			return err
+		}
+		if value, err = strconv.ParseUint(line, 10, 64); err != nil {
+			return fmt.Errorf("memcached: unexpected reply %q", line)
+		}
+		ok = true
+		return nil
+	})
+	return value, ok, err
+}
+
+// expect reads one reply line and checks it is one of replies
+func expect(cn *conn, replies ...string) error {
+	line, err := cn.readLine()
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if line == reply {
+			return nil
+		}
+	}
+	return fmt.Errorf("memcached: unexpected reply %q", line)
+}
+
+// Close closes every pooled connection
+func (c *Client) Close() error {
+	for _, s := range c.servers {
+		s.mu.Lock()
+		for _, cn := range s.idle {
+			cn.Close()
+		}
+		s.idle = nil
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Cache stores JSON-encoded values under a key prefix. memcached cannot
+// list keys, so the prefix carries a namespace number kept in memcached
+// itself: Clear moves to a new one and the old entries expire unreachable.
+// Values come back as JSON decodes them: numbers as float64, objects as maps.
+type Cache struct {
+	client *Client
+	prefix string
+
+	mu sync.Mutex
+	// ns is the namespace in use, read again after nsRefresh so a Clear
+	// from another process is seen
+	ns     string
+	nsRead time.Time
+}
+
+// nsRefresh is how long a Cache trusts the namespace it read
+const nsRefresh = time.Second
+
+// NewCache creates a cache whose keys all start with prefix
+func NewCache(client *Client, prefix string) *Cache {
+	return &Cache{client: client, prefix: prefix}
+}
+
+var (
+	sharedMu     sync.Mutex
+	sharedCaches = make(map[string]*Cache)
+)
+
+// SharedCache returns one cache per server list and prefix
+func SharedCache(servers []string, prefix string) (*Cache, error) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	key := strings.Join(servers, ",") + " " + prefix
+	if c, ok := sharedCaches[key]; ok {
+		return c, nil
+	}
+	client, err := New(Options{Servers: servers})
+	if err != nil {
+		return nil, err
+	}
+	c := NewCache(client, prefix)
+	sharedCaches[key] = c
+	return c, nil
+}
+
+// namespace returns the current namespace, starting one when there is none
+func (c *Cache) namespace() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ns != "" && time.Since(c.nsRead) < nsRefresh {
+		return c.ns, nil
+	}
+	key := c.prefix + "ns"
+	data, ok, err := c.client.Get(key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		data = []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+		if err := c.client.Set(key, data, 0); err != nil {
+			return "", err
+		}
+	}
+	c.ns, c.nsRead = string(data), time.Now()
+	return c.ns, nil
+}
+
+// itemKey returns the memcached key of key, hashed when it would not fit
+// the protocol
+func (c *Cache) itemKey(key string) (string, error) {
+	ns, err := c.namespace()
+	if err != nil {
+		return "", err
+	}
+	full := c.prefix + ns + ":" + key
+	if checkKey(full) != nil {
+		sum := sha1.Sum([]byte(key))
+		full = c.prefix + ns + ":#" + hex.EncodeToString(sum[:])
+	}
+	return full, nil
+}
+
+// Get returns the value at key; ok is false for a miss
+func (c *Cache) Get(key string) (value interface{}, ok bool, err error) {
+	item, err := c.itemKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	data, ok, err := c.client.Get(item)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, false, fmt.Errorf("failed to decode cached %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// Set stores value at key; a ttl of 0 never expires
+func (c *Cache) Set(key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	item, err := c.itemKey(key)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(item, data, ttl)
+}
+
+// Delete removes key
+func (c *Cache) Delete(key string) error {
+	item, err := c.itemKey(key)
+	if err != nil {
+		return err
+	}
+	return c.client.Delete(item)
+}
+
+// Clear makes every entry unreachable by moving to a new namespace
+func (c *Cache) Clear() error {
+	key := c.prefix + "ns"
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok, err := c.client.Incr(key, 1)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		value = uint64(time.Now().UnixNano())
+		if err := c.client.Set(key, []byte(strconv.FormatUint(value, 10)), 0); err != nil {
+			return err
+		}
+	}
+	c.ns, c.nsRead = strconv.FormatUint(value, 10), time.Now()
+	return nil
+}
+
+// ConfigServers reads the servers configured under prefix, such as
+// cache.memcached: <prefix>.servers as a list or a comma-separated string,
+// or <prefix>.host and port. ok is false when none is set.
+func ConfigServers(values map[string]interface{}, prefix string) ([]string, bool) {
+	var servers []string
+	switch v := values[prefix+".servers"].(type) {
+	case []interface{}:
+		for _, item := range v {
+			servers = append(servers, fmt.Sprint(item))
+		}
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				servers = append(servers, item)
+			}
+		}
+	}
+	if len(servers) == 0 {
+		if host, ok := values[prefix+".host"]; ok && host != nil {
+			addr := fmt.Sprint(host)
+			if port, ok := values[prefix+".port"]; ok && port != nil {
+				addr = net.JoinHostPort(addr, fmt.Sprint(port))
+			}
+			servers = append(servers, addr)
+		}
+	}
+	return servers, len(servers) > 0
+}
@@ -0,0 +1,211 @@
+package memcachewire
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMemcached is an in-memory server for the commands the client sends
+type fakeMemcached struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]string
+}
+
+func startFake(t *testing.T) (*fakeMemcached, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &fakeMemcached{data: make(map[string][]byte), ttls: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, ln.Addr().String()
+}
+
+func (s *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			io.WriteString(conn, "ERROR\r\n")
+			continue
+		}
+		s.mu.Lock()
+		switch fields[0] {
+		case "get":
+			if value, ok := s.data[fields[1]]; ok {
+				fmt.Fprintf(conn, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(value), value)
+			}
+			io.WriteString(conn, "END\r\n")
+		case "set":
+			n, _ := strconv.Atoi(fields[4])
+			value := make([]byte, n+2)
+			io.ReadFull(r, value)
+			s.data[fields[1]] = value[:n]
+			s.ttls[fields[1]] = fields[3]
+			io.WriteString(conn, "STORED\r\n")
+		case "delete":
+			if _, ok := s.data[fields[1]]; ok {
+				delete(s.data, fields[1])
+				io.WriteString(conn, "DELETED\r\n")
+			} else {
+				io.WriteString(conn, "NOT_FOUND\r\n")
+			}
+		case "incr":
+			value, ok := s.data[fields[1]]
+			if !ok {
+				io.WriteString(conn, "NOT_FOUND\r\n")
+				break
+			}
+			n, err := strconv.ParseUint(string(value), 10, 64)
+			if err != nil {
+				io.WriteString(conn, "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+				break
+			}
+			delta, _ := strconv.ParseUint(fields[2], 10, 64)
+			s.data[fields[1]] = []byte(strconv.FormatUint(n+delta, 10))
+			fmt.Fprintf(conn, "%d\r\n", n+delta)
+		default:
+			io.WriteString(conn, "ERROR\r\n")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestClient(t *testing.T) {
+	s, addr := startFake(t)
+	client, err := New(Options{Servers: []string{addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, ok, err := client.Get("missing"); ok || err != nil {
+		t.Errorf("Get(missing) = %v, %v", ok, err)
+	}
+	if err := client.Set("greeting", []byte("hello\r\nworld"), 90*time.Second); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	value, ok, err := client.Get("greeting")
+	if err != nil || !ok || string(value) != "hello\r\nworld" {
+		t.Errorf("Get = %q, %v, %v", value, ok, err)
+	}
+	if s.ttls["greeting"] != "90" {
+		t.Errorf("exptime = %s, want 90", s.ttls["greeting"])
+	}
+
+	client.Set("n", []byte("41"), 0)
+	if n, ok, err := client.Incr("n", 1); n != 42 || !ok || err != nil {
+		t.Errorf("Incr = %d, %v, %v", n, ok, err)
+	}
+	if _, ok, err := client.Incr("nothing", 1); ok || err != nil {
+		t.Errorf("Incr(nothing) = %v, %v", ok, err)
+	}
+	if _, _, err := client.Incr("greeting", 1); err == nil || !strings.Contains(err.Error(), "non-numeric") {
+		t.Errorf("expected a client error, got %v", err)
+	} else if _, _, err := client.Get("greeting"); err != nil {
+		// The connection survives an error reply
+		t.Errorf("Get after an error reply: %v", err)
+	}
+
+	if err := client.Delete("greeting"); err != nil {
+		t.Errorf("Delete returned error: %v", err)
+	}
+	if err := client.Delete("greeting"); err != nil {
+		t.Errorf("Delete of a missing key returned error: %v", err)
+	}
+	if err := client.Set("has space", nil, 0); err == nil {
+		t.Error("expected an error for a key with a space")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	if got := expiry(0); got != 0 {
+		t.Errorf("expiry(0) = %d", got)
+	}
+	if got := expiry(time.Millisecond); got != 1 {
+		t.Errorf("expiry(1ms) = %d", got)
+	}
+	if got := expiry(60 * 24 * time.Hour); got < time.Now().Unix() {
+		t.Errorf("expiry(60d) = %d, want a Unix time", got)
+	}
+}
+
+func TestCache(t *testing.T) {
+	s, addr := startFake(t)
+	client, _ := New(Options{Servers: []string{addr}})
+	cache := NewCache(client, "tsk:cache:")
+
+	if err := cache.Set("answer", map[string]interface{}{"n": 42}, time.Minute); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	value, ok, err := cache.Get("answer")
+	if err != nil || !ok || !reflect.DeepEqual(value, map[string]interface{}{"n": float64(42)}) {
+		t.Errorf("Get = %v, %v, %v", value, ok, err)
+	}
+
+	long := strings.Repeat("k", 300)
+	if err := cache.Set(long, "v", 0); err != nil {
+		t.Fatalf("Set of a long key returned error: %v", err)
+	}
+	if value, ok, _ := cache.Get(long); !ok || value != "v" {
+		t.Errorf("Get of a long key = %v, %v", value, ok)
+	}
+
+	// A second cache on the same prefix sees the clear once it reads the
+	// namespace again
+	other := NewCache(client, "tsk:cache:")
+	if _, ok, _ := other.Get("answer"); !ok {
+		t.Error("second cache missed a stored key")
+	}
+	if err := cache.Clear(); err != nil {
+		t.Fatalf("Clear returned error: %v", err)
+	}
+	if _, ok, _ := cache.Get("answer"); ok {
+		t.Error("Get hit after Clear")
+	}
+	other.nsRead = time.Time{}
+	if _, ok, _ := other.Get("answer"); ok {
+		t.Error("second cache hit after Clear")
+	}
+	if _, ok := s.data["tsk:cache:ns"]; !ok {
+		t.Error("namespace key not stored")
+	}
+}
+
+func TestConfigServers(t *testing.T) {
+	servers, ok := ConfigServers(map[string]interface{}{"cache.memcached.servers": "a:11211, b"}, "cache.memcached")
+	if !ok || !reflect.DeepEqual(servers, []string{"a:11211", "b"}) {
+		t.Errorf("ConfigServers = %v, %v", servers, ok)
+	}
+	servers, ok = ConfigServers(map[string]interface{}{"cache.memcached.host": "mc", "cache.memcached.port": 11212}, "cache.memcached")
+	if !ok || !reflect.DeepEqual(servers, []string{"mc:11212"}) {
+		t.Errorf("ConfigServers = %v, %v", servers, ok)
+	}
+	if _, ok := ConfigServers(map[string]interface{}{}, "cache.memcached"); ok {
+		t.Error("expected no servers")
+	}
+}
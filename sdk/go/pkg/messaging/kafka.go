@@ -0,0 +1,731 @@
+package messaging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Kafka API keys, used at the versions below
+const (
+	apiProduce          = 0
+	apiFetch            = 1
+	apiListOffsets      = 2
+	apiMetadata         = 3
+	apiSaslHandshake    = 17
+	apiSaslAuthenticate = 36
+)
+
+const (
+	produceVersion          = 3
+	fetchVersion            = 4
+	listOffsetsVersion      = 1
+	metadataVersion         = 1
+	saslHandshakeVersion    = 1
+	saslAuthenticateVersion = 0
+
+	// maxKafkaResponse caps the size of a response
+	maxKafkaResponse = 64 << 20
+	// fetchBytes is how much of a partition a fetch asks for
+	fetchBytes = 1 << 20
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaErrors names the error codes worth explaining
+var kafkaErrors = map[int16]string{
+	1:  "offset out of range",
+	2:  "corrupt message",
+	3:  "unknown topic or partition",
+	5:  "leader not available",
+	6:  "not leader for partition",
+	7:  "request timed out",
+	10: "message too large",
+	17: "invalid topic",
+	19: "not enough replicas",
+	29: "topic authorization failed",
+	31: "cluster authorization failed",
+	58: "SASL authentication failed",
+}
+
+// KafkaError is an error code returned by a Kafka broker
+type KafkaError int16
+
+func (e KafkaError) Error() string {
+	if text, ok := kafkaErrors[int16(e)]; ok {
+		return fmt.Sprintf("kafka error %d: %s", int16(e), text)
+	}
+	return fmt.Sprintf("kafka error %d", int16(e))
+}
+
+// kafkaWriter encodes Kafka protocol fields
+type kafkaWriter struct {
+	bytes.Buffer
+}
+
+func (w *kafkaWriter) int8(v int8)   { w.WriteByte(byte(v)) }
+func (w *kafkaWriter) int16(v int16) { w.Write(binary.BigEndian.AppendUint16(nil, uint16(v))) }
+func (w *kafkaWriter) int32(v int32) { w.Write(binary.BigEndian.AppendUint32(nil, uint32(v))) }
+func (w *kafkaWriter) int64(v int64) { w.Write(binary.BigEndian.AppendUint64(nil, uint64(v))) }
+
+func (w *kafkaWriter) varint(v int64) { w.Write(binary.AppendVarint(nil, v)) }
+
+func (w *kafkaWriter) string(s string) {
+	w.int16(int16(len(s)))
+	w.WriteString(s)
+}
+
+// bytes writes b, or null when b is nil
+func (w *kafkaWriter) bytes(b []byte) {
+	if b == nil {
+		w.int32(-1)
+		return
+	}
+	w.int32(int32(len(b)))
+	w.Write(b)
+}
+
+// varbytes writes b with a varint length, or null when b is nil
+func (w *kafkaWriter) varbytes(b []byte) {
+	if b == nil {
+		w.varint(-1)
+		return
+	}
+	w.varint(int64(len(b)))
+	w.Write(b)
+}
+
+// kafkaReader decodes Kafka protocol fields, keeping the first error
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b) {
+		r.err = fmt.Errorf("truncated Kafka response")
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *kafkaReader) int8() int8 {
+	if b := r.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (r *kafkaReader) int16() int16 {
+	if b := r.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if b := r.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if b := r.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.err = fmt.Errorf("invalid varint in Kafka response")
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.take(int(n)))
+}
+
+func (r *kafkaReader) bytes() []byte {
+	n := r.int32()
+	if n < 0 {
+		return nil
+	}
+	return r.take(int(n))
+}
+
+func (r *kafkaReader) varbytes() []byte {
+	n := r.varint()
+	if n < 0 {
+		return nil
+	}
+	return r.take(int(n))
+}
+
+// count reads an array length, treating null as empty
+func (r *kafkaReader) count() int {
+	n := int(r.int32())
+	if n < 0 {
+		return 0
+	}
+	if n > len(r.b) {
+		// Every element takes at least a byte
+		r.err = fmt.Errorf("truncated Kafka response")
+		return 0
+	}
+	return n
+}
+
+// kafkaConn is a connection to one broker
+type kafkaConn struct {
+	net.Conn
+	address     string
+	clientID    string
+	correlation int32
+}
+
+// roundTrip sends a request and returns a reader over its response body
+func (c *kafkaConn) roundTrip(apiKey, version int16, body []byte) (*kafkaReader, error) {
+	c.correlation++
+	var w kafkaWriter
+	w.int32(0)
+	w.int16(apiKey)
+	w.int16(version)
+	w.int32(c.correlation)
+	w.string(c.clientID)
+	w.Write(body)
+	request := w.Bytes()
+	binary.BigEndian.PutUint32(request, uint32(len(request)-4))
+	if _, err := c.Write(request); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > maxKafkaResponse {
+		return nil, fmt.Errorf("invalid Kafka response size %d", n)
+	}
+	response := make([]byte, n)
+	if _, err := io.ReadFull(c, response); err != nil {
+		return nil, err
+	}
+	r := &kafkaReader{b: response}
+	if id := r.int32(); id != c.correlation {
+		return nil, fmt.Errorf("Kafka response %d does not match request %d", id, c.correlation)
+	}
+	return r, nil
+}
+
+// kafkaPartition is a partition of a topic and the address of its leader
+type kafkaPartition struct {
+	id     int32
+	leader string
+}
+
+// kafkaClient opens connections for one call and closes them after it:
+// configuration is evaluated rarely, and leaders move between evaluations
+type kafkaClient struct {
+	broker Broker
+	conns  map[string]*kafkaConn
+}
+
+func (k *kafkaClient) dial(address string) (*kafkaConn, error) {
+	if c, ok := k.conns[address]; ok {
+		return c, nil
+	}
+	dialer := &net.Dialer{Timeout: k.broker.Timeout}
+	var conn net.Conn
+	var err error
+	if k.broker.TLS {
+		host, _, _ := net.SplitHostPort(address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(k.broker.Timeout))
+	c := &kafkaConn{Conn: conn, address: address, clientID: k.broker.ClientID}
+	if k.broker.User != "" {
+		if err := c.authenticate(k.broker.User, k.broker.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if k.conns == nil {
+		k.conns = make(map[string]*kafkaConn)
+	}
+	k.conns[address] = c
+	return c, nil
+}
+
+func (k *kafkaClient) close() {
+	for _, c := range k.conns {
+		c.Close()
+	}
+	k.conns = nil
+}
+
+// authenticate signs in with SASL PLAIN
+func (c *kafkaConn) authenticate(user, password string) error {
+	var w kafkaWriter
+	w.string("PLAIN")
+	r, err := c.roundTrip(apiSaslHandshake, saslHandshakeVersion, w.Bytes())
+	if err != nil {
+		return fmt.Errorf("SASL handshake failed: %w", err)
+	}
+	if code := r.int16(); code != 0 {
+		return fmt.Errorf("SASL PLAIN is not enabled: %w", KafkaError(code))
+	}
+
+	w.Reset()
+	w.bytes([]byte("\x00" + user + "\x00" + password))
+	if r, err = c.roundTrip(apiSaslAuthenticate, saslAuthenticateVersion, w.Bytes()); err != nil {
+		return fmt.Errorf("SASL authentication failed: %w", err)
+	}
+	code, message := r.int16(), r.string()
+	if r.err != nil {
+		return r.err
+	}
+	if code != 0 {
+		if message != "" {
+			return fmt.Errorf("%w: %s", KafkaError(code), message)
+		}
+		return KafkaError(code)
+	}
+	return nil
+}
+
+// partitions returns the partitions of topic from the first reachable
+// bootstrap broker
+func (k *kafkaClient) partitions(topic string) ([]kafkaPartition, error) {
+	var c *kafkaConn
+	var err error
+	for _, address := range k.broker.Addresses {
+		if c, err = k.dial(address); err == nil {
+			break
+		}
+	}
+	if c == nil {
+		return nil, fmt.Errorf("no broker reachable: %w", err)
+	}
+
+	var w kafkaWriter
+	w.int32(1)
+	w.string(topic)
+	r, err := c.roundTrip(apiMetadata, metadataVersion, w.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("metadata request failed: %w", err)
+	}
+	brokers := make(map[int32]string)
+	for i, n := 0, r.count(); i < n; i++ {
+		id, host, port := r.int32(), r.string(), r.int32()
+		r.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.int32() // controller
+	var partitions []kafkaPartition
+	for i, n := 0, r.count(); i < n; i++ {
+		code, name := r.int16(), r.string()
+		r.int8() // internal
+		if code != 0 && name == topic {
+			return nil, KafkaError(code)
+		}
+		for j, m := 0, r.count(); j < m; j++ {
+			r.int16() // partition error, such as a replica being down
+			id, leader := r.int32(), r.int32()
+			for replicas := r.count(); replicas > 0; replicas-- {
+				r.int32()
+			}
+			for isr := r.count(); isr > 0; isr-- {
+				r.int32()
+			}
+			if name == topic {
+				partitions = append(partitions, kafkaPartition{id: id, leader: brokers[leader]})
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(partitions) == 0 {
+		return nil, KafkaError(3)
+	}
+	return partitions, nil
+}
+
+// publish produces one record, to the partition of its key or to a random
+// one, acknowledged by all in-sync replicas
+func (k *kafkaClient) publish(topic string, key, value []byte) error {
+	defer k.close()
+	partitions, err := k.partitions(topic)
+	if err != nil {
+		return err
+	}
+	p := partitions[rand.Intn(len(partitions))]
+	if key != nil {
+		p = partitionFor(partitions, key)
+	}
+	if p.leader == "" {
+		return KafkaError(5)
+	}
+	c, err := k.dial(p.leader)
+	if err != nil {
+		return err
+	}
+
+	var w kafkaWriter
+	w.int16(-1) // no transaction
+	w.int16(-1) // all in-sync replicas
+	w.int32(int32(k.broker.Timeout / time.Millisecond))
+	w.int32(1)
+	w.string(topic)
+	w.int32(1)
+	w.int32(p.id)
+	w.bytes(encodeRecordBatch(key, value, time.Now()))
+	r, err := c.roundTrip(apiProduce, produceVersion, w.Bytes())
+	if err != nil {
+		return fmt.Errorf("produce request failed: %w", err)
+	}
+	for i, n := 0, r.count(); i < n; i++ {
+		r.string()
+		for j, m := 0, r.count(); j < m; j++ {
+			r.int32()
+			if code := r.int16(); code != 0 && r.err == nil {
+				return KafkaError(code)
+			}
+			r.int64() // base offset
+			r.int64() // log append time
+		}
+	}
+	return r.err
+}
+
+// partitionFor picks a key's partition the way Kafka's default
+// partitioner does, so keyed messages land with other clients' messages
+func partitionFor(partitions []kafkaPartition, key []byte) kafkaPartition {
+	id := (murmur2(key) & 0x7fffffff) % int32(len(partitions))
+	for _, p := range partitions {
+		if p.id == id {
+			return p
+		}
+	}
+	return partitions[id]
+}
+
+// murmur2 is Kafka's key hash
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// kafkaRecord is a record read back from a partition
+type kafkaRecord struct {
+	offset    int64
+	timestamp int64
+	key       []byte
+	value     []byte
+}
+
+// latest returns the newest record across the topic's partitions
+func (k *kafkaClient) latest(topic string) ([]byte, bool, error) {
+	defer k.close()
+	partitions, err := k.partitions(topic)
+	if err != nil {
+		return nil, false, err
+	}
+	var newest *kafkaRecord
+	for _, p := range partitions {
+		if p.leader == "" {
+			return nil, false, KafkaError(5)
+		}
+		c, err := k.dial(p.leader)
+		if err != nil {
+			return nil, false, err
+		}
+		end, err := c.endOffset(topic, p.id)
+		if err != nil {
+			return nil, false, fmt.Errorf("partition %d: %w", p.id, err)
+		}
+		if end == 0 {
+			continue
+		}
+		record, err := c.fetchLast(topic, p.id, end)
+		if err != nil {
+			return nil, false, fmt.Errorf("partition %d: %w", p.id, err)
+		}
+		if record != nil && (newest == nil || record.timestamp > newest.timestamp) {
+			newest = record
+		}
+	}
+	if newest == nil {
+		return nil, false, nil
+	}
+	return newest.value, true, nil
+}
+
+// endOffset returns the offset the next record of a partition will get
+func (c *kafkaConn) endOffset(topic string, partition int32) (int64, error) {
+	var w kafkaWriter
+	w.int32(-1) // a client, not a replica
+	w.int32(1)
+	w.string(topic)
+	w.int32(1)
+	w.int32(partition)
+	w.int64(-1) // latest
+	r, err := c.roundTrip(apiListOffsets, listOffsetsVersion, w.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("list offsets request failed: %w", err)
+	}
+	var offset int64 = -1
+	for i, n := 0, r.count(); i < n; i++ {
+		r.string()
+		for j, m := 0, r.count(); j < m; j++ {
+			r.int32()
+			code := r.int16()
+			r.int64() // timestamp
+			offset = r.int64()
+			if code != 0 && r.err == nil {
+				return 0, KafkaError(code)
+			}
+		}
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("no offset returned")
+	}
+	return offset, nil
+}
+
+// fetchLast returns the last record before end, or nil when it has been
+// deleted or is a transaction marker
+func (c *kafkaConn) fetchLast(topic string, partition int32, end int64) (*kafkaRecord, error) {
+	var w kafkaWriter
+	w.int32(-1)  // a client, not a replica
+	w.int32(100) // max wait ms
+	w.int32(1)   // min bytes
+	w.int32(fetchBytes)
+	w.int8(0) // read uncommitted
+	w.int32(1)
+	w.string(topic)
+	w.int32(1)
+	w.int32(partition)
+	w.int64(end - 1)
+	w.int32(fetchBytes)
+	r, err := c.roundTrip(apiFetch, fetchVersion, w.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("fetch request failed: %w", err)
+	}
+	r.int32() // throttle time
+	var last *kafkaRecord
+	for i, n := 0, r.count(); i < n; i++ {
+		r.string()
+		for j, m := 0, r.count(); j < m; j++ {
+			r.int32()
+			code := r.int16()
+			r.int64() // high watermark
+			r.int64() // last stable offset
+			for aborted := r.int32(); aborted > 0; aborted-- {
+				r.int64()
+				r.int64()
+			}
+			records := r.bytes()
+			if r.err != nil {
+				return nil, r.err
+			}
+			if code != 0 {
+				return nil, KafkaError(code)
+			}
+			batch, err := decodeRecordBatches(records)
+			if err != nil {
+				return nil, err
+			}
+			for k := range batch {
+				if batch[k].offset < end && (last == nil || batch[k].offset > last.offset) {
+					last = &batch[k]
+				}
+			}
+		}
+	}
+	return last, r.err
+}
+
+// encodeRecordBatch encodes one record as a v2 record batch
+func encodeRecordBatch(key, value []byte, now time.Time) []byte {
+	var record kafkaWriter
+	record.int8(0)   // attributes
+	record.varint(0) // timestamp delta
+	record.varint(0) // offset delta
+	record.varbytes(key)
+	record.varbytes(value)
+	record.varint(0) // headers
+
+	timestamp := now.UnixMilli()
+	var tail kafkaWriter
+	tail.int16(0) // attributes: uncompressed, create time
+	tail.int32(0) // last offset delta
+	tail.int64(timestamp)
+	tail.int64(timestamp)
+	tail.int64(-1) // producer id
+	tail.int16(-1) // producer epoch
+	tail.int32(-1) // base sequence
+	tail.int32(1)
+	tail.varint(int64(record.Len()))
+	tail.Write(record.Bytes())
+
+	var batch kafkaWriter
+	batch.int64(0)
+	batch.int32(int32(4 + 1 + 4 + tail.Len()))
+	batch.int32(-1) // partition leader epoch
+	batch.int8(2)   // magic
+	batch.Write(binary.BigEndian.AppendUint32(nil, crc32.Checksum(tail.Bytes(), castagnoli)))
+	batch.Write(tail.Bytes())
+	return batch.Bytes()
+}
+
+// decodeRecordBatches decodes the v2 record batches of a fetch, skipping
+// control batches and a partial batch at the end
+func decodeRecordBatches(data []byte) ([]kafkaRecord, error) {
+	var records []kafkaRecord
+	for len(data) >= 12 {
+		base := int64(binary.BigEndian.Uint64(data))
+		size := int(binary.BigEndian.Uint32(data[8:]))
+		if 12+size > len(data) {
+			break
+		}
+		r := &kafkaReader{b: data[12 : 12+size]}
+		data = data[12+size:]
+
+		r.int32() // partition leader epoch
+		if magic := r.int8(); magic != 2 {
+			return nil, fmt.Errorf("unsupported Kafka message format v%d", magic)
+		}
+		crc := uint32(r.int32())
+		if r.err == nil && crc32.Checksum(r.b, castagnoli) != crc {
+			return nil, fmt.Errorf("corrupt record batch at offset %d", base)
+		}
+		attributes := r.int16()
+		r.int32() // last offset delta
+		firstTimestamp, maxTimestamp := r.int64(), r.int64()
+		r.int64() // producer id
+		r.int16() // producer epoch
+		r.int32() // base sequence
+		count := r.int32()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if attributes&0x20 != 0 {
+			// Transaction markers hold no messages
+			continue
+		}
+		body, err := decompress(attributes&0x7, r.b)
+		if err != nil {
+			return nil, fmt.Errorf("record batch at offset %d: %w", base, err)
+		}
+		r = &kafkaReader{b: body}
+		for i := int32(0); i < count; i++ {
+			r.varint() // length
+			r.int8()   // attributes
+			timestamp := firstTimestamp + r.varint()
+			offset := base + r.varint()
+			key, value := r.varbytes(), r.varbytes()
+			for headers := r.varint(); headers > 0; headers-- {
+				r.varbytes()
+				r.varbytes()
+			}
+			if attributes&0x8 != 0 {
+				// Log append time applies to the whole batch
+				timestamp = maxTimestamp
+			}
+			if r.err != nil {
+				return nil, r.err
+			}
+			records = append(records, kafkaRecord{offset: offset, timestamp: timestamp, key: key, value: value})
+		}
+	}
+	return records, nil
+}
+
+// decompress undoes a batch's compression codec
+func decompress(codec int16, data []byte) ([]byte, error) {
+	switch codec {
+	case 0:
+		return data, nil
+	case 1:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(io.LimitReader(zr, maxKafkaResponse))
+	case 4:
+		zr, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return zr.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("unsupported compression codec %d: use none, gzip or zstd", codec)
+}
@@ -0,0 +1,341 @@
+// Package messaging publishes to and reads from Kafka topics and NATS
+// subjects for the @publish and @consume_latest operators. It speaks both
+// wire protocols directly. Brokers are named in the [messaging] section:
+//
+//	[messaging]
+//	timeout: "5s"
+//	events {
+//	    url: "kafka://kafka-1:9092,kafka-2:9092"
+//	    user: "tusk"
+//	    password: @env("KAFKA_PASSWORD")
+//	}
+//	bus {
+//	    url: "nats://nats.internal:4222"
+//	    token: @env("NATS_TOKEN")
+//	    stream: "CONFIG"
+//	}
+//
+// Kafka credentials are sent with SASL PLAIN. Reading the latest NATS
+// message needs JetStream; the stream holding the subject is looked up
+// when stream is not set.
+package messaging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default ports and timeout
+const (
+	DefaultKafkaPort = "9092"
+	DefaultNATSPort  = "4222"
+	DefaultTimeout   = 5 * time.Second
+)
+
+// Broker is a named Kafka cluster or NATS server
+type Broker struct {
+	// Kind is "kafka" or "nats"
+	Kind string
+	// Addresses are host:port pairs, tried in order
+	Addresses []string
+	User      string
+	Password  string
+	// Token authenticates to NATS
+	Token string
+	// TLS connects with TLS, verifying the server's certificate
+	TLS bool
+	// Stream is the JetStream stream read by ConsumeLatest on NATS
+	Stream   string
+	ClientID string
+	Timeout  time.Duration
+}
+
+// Options are the brokers of a [messaging] section
+type Options struct {
+	Brokers map[string]Broker
+}
+
+// ParseURL reads kafka://[user:password@]host[:port][,host[:port]...] or
+// nats://[user:password@|token@]host[:port][,...]; the kafkas:// and tls://
+// schemes turn on TLS
+func ParseURL(rawURL string) (Broker, error) {
+	var b Broker
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return b, fmt.Errorf("invalid messaging URL: %s", rawURL)
+	}
+	port := DefaultKafkaPort
+	switch scheme {
+	case "kafka", "kafkas":
+		b.Kind = "kafka"
+		b.TLS = scheme == "kafkas"
+	case "nats", "tls":
+		b.Kind = "nats"
+		b.TLS = scheme == "tls"
+		port = DefaultNATSPort
+	default:
+		return b, fmt.Errorf("invalid messaging URL %s: expected kafka://, kafkas://, nats:// or tls://", rawURL)
+	}
+	rest = strings.TrimSuffix(rest, "/")
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		user, password, hasPassword := strings.Cut(rest[:at], ":")
+		switch {
+		case hasPassword:
+			b.User, b.Password = user, password
+		case b.Kind == "nats":
+			b.Token = user
+		default:
+			return b, fmt.Errorf("invalid messaging URL %s: expected user:password", rawURL)
+		}
+		rest = rest[at+1:]
+	}
+	for _, host := range strings.Split(rest, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" || strings.ContainsAny(host, "/?") {
+			return b, fmt.Errorf("invalid messaging URL %s: bad host %q", rawURL, host)
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, port)
+		}
+		b.Addresses = append(b.Addresses, host)
+	}
+	return b, nil
+}
+
+// OptionsFrom reads Options from the flat messaging.* keys of a
+// configuration: a default timeout and client_id, and brokers with url,
+// user, password, token, tls, stream, client_id and timeout
+func OptionsFrom(values map[string]interface{}) (Options, error) {
+	opts := Options{Brokers: make(map[string]Broker)}
+	settings := make(map[string]map[string]interface{})
+	timeout, clientID := DefaultTimeout, "tusktsk"
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "messaging.")
+		if !ok {
+			continue
+		}
+		name, field, ok := strings.Cut(setting, ".")
+		switch {
+		case setting == "timeout":
+			d, err := parseDuration(value)
+			if err != nil {
+				return opts, fmt.Errorf("messaging.timeout: %w", err)
+			}
+			timeout = d
+		case setting == "client_id":
+			clientID = fmt.Sprint(value)
+		case !ok:
+			return opts, fmt.Errorf("unknown setting messaging.%s", setting)
+		default:
+			if settings[name] == nil {
+				settings[name] = make(map[string]interface{})
+			}
+			settings[name][field] = value
+		}
+	}
+
+	for name, fields := range settings {
+		rawURL, ok := fields["url"]
+		if !ok {
+			return opts, fmt.Errorf("messaging.%s: missing url", name)
+		}
+		b, err := ParseURL(fmt.Sprint(rawURL))
+		if err != nil {
+			return opts, fmt.Errorf("messaging.%s: %w", name, err)
+		}
+		b.Timeout, b.ClientID = timeout, clientID
+		for field, value := range fields {
+			text := fmt.Sprint(value)
+			switch field {
+			case "url":
+			case "user":
+				b.User = text
+			case "password":
+				b.Password = text
+			case "token":
+				b.Token = text
+			case "stream":
+				b.Stream = text
+			case "client_id":
+				b.ClientID = text
+			case "tls":
+				if b.TLS, err = strconv.ParseBool(text); err != nil {
+					return opts, fmt.Errorf("messaging.%s.tls: expected true or false, got %v", name, value)
+				}
+			case "timeout":
+				if b.Timeout, err = parseDuration(value); err != nil {
+					return opts, fmt.Errorf("messaging.%s.timeout: %w", name, err)
+				}
+			default:
+				return opts, fmt.Errorf("unknown setting messaging.%s.%s", name, field)
+			}
+		}
+		if b.Kind == "kafka" && b.Token != "" {
+			return opts, fmt.Errorf("messaging.%s: Kafka takes a user and password, not a token", name)
+		}
+		if b.Kind == "kafka" && b.Stream != "" {
+			return opts, fmt.Errorf("messaging.%s: stream is a NATS setting", name)
+		}
+		opts.Brokers[name] = b
+	}
+	return opts, nil
+}
+
+// parseDuration reads a duration string or a number of seconds
+func parseDuration(value interface{}) (time.Duration, error) {
+	text := fmt.Sprint(value)
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%q is not a duration", text)
+	}
+	return d, nil
+}
+
+// client is the protocol of one kind of broker
+type client interface {
+	// publish sends value, with an optional key, to a topic or subject
+	publish(topic string, key, value []byte) error
+	// latest returns the newest message of a topic or subject
+	latest(topic string) ([]byte, bool, error)
+}
+
+// Manager resolves broker names for the messaging operators
+type Manager struct {
+	mu   sync.RWMutex
+	opts Options
+}
+
+// NewManager creates a Manager without brokers
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Default is the Manager behind @publish and @consume_latest
+var Default = NewManager()
+
+// Configure replaces the brokers
+func (m *Manager) Configure(opts Options) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.opts = opts
+}
+
+func (m *Manager) client(name string) (client, error) {
+	m.mu.RLock()
+	b, ok := m.opts.Brokers[name]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown broker %q: add it to [messaging]", name)
+	}
+	if b.Timeout <= 0 {
+		b.Timeout = DefaultTimeout
+	}
+	if b.Kind == "nats" {
+		return &natsClient{broker: b}, nil
+	}
+	return &kafkaClient{broker: b}, nil
+}
+
+// Publish executes @publish(broker, topic, message, key): it sends
+// message, a string or a value encoded as JSON, to a Kafka topic or NATS
+// subject and returns it. The key picks the Kafka partition.
+func (m *Manager) Publish(args ...interface{}) (interface{}, error) {
+	if len(args) < 3 || len(args) > 4 {
+		return nil, fmt.Errorf("@publish requires a broker, a topic, a message and an optional key")
+	}
+	broker, topic := fmt.Sprint(args[0]), fmt.Sprint(args[1])
+	c, err := m.client(broker)
+	if err != nil {
+		return nil, fmt.Errorf("@publish: %w", err)
+	}
+	value, err := encodeMessage(args[2])
+	if err != nil {
+		return nil, fmt.Errorf("@publish: %w", err)
+	}
+	var key []byte
+	if len(args) == 4 && args[3] != nil {
+		key = []byte(fmt.Sprint(args[3]))
+	}
+	if err := c.publish(topic, key, value); err != nil {
+		return nil, fmt.Errorf("failed to publish to %s/%s: %w", broker, topic, err)
+	}
+	return args[2], nil
+}
+
+// ConsumeLatest executes @consume_latest(broker, topic, default): it
+// returns the newest message of a topic or subject, decoded when it is
+// JSON, or default when there is none
+func (m *Manager) ConsumeLatest(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("@consume_latest requires a broker, a topic and an optional default")
+	}
+	broker, topic := fmt.Sprint(args[0]), fmt.Sprint(args[1])
+	c, err := m.client(broker)
+	if err != nil {
+		return nil, fmt.Errorf("@consume_latest: %w", err)
+	}
+	value, found, err := c.latest(topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s/%s: %w", broker, topic, err)
+	}
+	if !found {
+		if len(args) == 3 {
+			return args[2], nil
+		}
+		return nil, nil
+	}
+	return decodeMessage(value), nil
+}
+
+// encodeMessage sends strings as they are and other values as JSON
+func encodeMessage(value interface{}) ([]byte, error) {
+	if text, ok := value.(string); ok {
+		return []byte(text), nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return encoded, nil
+}
+
+// decodeMessage decodes a JSON message, with integral numbers as ints;
+// other messages are returned as text
+func decodeMessage(message []byte) interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return string(message)
+	}
+	return normalizeJSON(value)
+}
+
+func normalizeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := strconv.Atoi(v.String()); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeJSON(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = normalizeJSON(v[key])
+		}
+	}
+	return value
+}
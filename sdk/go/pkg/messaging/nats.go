@@ -0,0 +1,284 @@
+package messaging
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxNATSPayload caps the size of a message read back
+const maxNATSPayload = 64 << 20
+
+// natsInfo is the part of the server's INFO the client uses
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+	MaxPayload  int  `json:"max_payload"`
+}
+
+// natsConn is a connection to one NATS server
+type natsConn struct {
+	net.Conn
+	r    *bufio.Reader
+	info natsInfo
+}
+
+// natsClient opens a connection per call, like kafkaClient
+type natsClient struct {
+	broker Broker
+}
+
+func (n *natsClient) dial() (*natsConn, error) {
+	var c *natsConn
+	var err error
+	for _, address := range n.broker.Addresses {
+		if c, err = n.connect(address); err == nil {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no server reachable: %w", err)
+}
+
+// connect reads the server's INFO, upgrades to TLS when asked to, and
+// sends CONNECT
+func (n *natsClient) connect(address string) (*natsConn, error) {
+	conn, err := net.DialTimeout("tcp", address, n.broker.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(n.broker.Timeout))
+	c := &natsConn{Conn: conn, r: bufio.NewReader(conn)}
+	fail := func(err error) (*natsConn, error) {
+		c.Close()
+		return nil, err
+	}
+
+	line, err := c.readLine()
+	if err != nil {
+		return fail(err)
+	}
+	info, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fail(fmt.Errorf("expected INFO from %s, got %q", address, line))
+	}
+	if err := json.Unmarshal([]byte(info), &c.info); err != nil {
+		return fail(fmt.Errorf("invalid INFO from %s: %w", address, err))
+	}
+	if n.broker.TLS || c.info.TLSRequired {
+		host, _, _ := net.SplitHostPort(address)
+		secure := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := secure.Handshake(); err != nil {
+			return fail(fmt.Errorf("TLS handshake with %s failed: %w", address, err))
+		}
+		c.Conn, c.r = secure, bufio.NewReader(secure)
+	}
+
+	connect := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     n.broker.ClientID,
+		"lang":     "go",
+		"version":  "tusktsk",
+		"protocol": 1,
+	}
+	if n.broker.User != "" {
+		connect["user"], connect["pass"] = n.broker.User, n.broker.Password
+	}
+	if n.broker.Token != "" {
+		connect["auth_token"] = n.broker.Token
+	}
+	options, _ := json.Marshal(connect)
+	if _, err := fmt.Fprintf(c, "CONNECT %s\r\nPING\r\n", options); err != nil {
+		return fail(err)
+	}
+	if err := c.flush(); err != nil {
+		return fail(err)
+	}
+	return c, nil
+}
+
+func (c *natsConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// next returns the next message or PONG, answering server PINGs and
+// turning -ERR into an error
+func (c *natsConn) next() (string, error) {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case line == "PING":
+			if _, err := io.WriteString(c, "PONG\r\n"); err != nil {
+				return "", err
+			}
+		case line == "+OK", strings.HasPrefix(line, "INFO "):
+		case strings.HasPrefix(line, "-ERR"):
+			return "", fmt.Errorf("nats: %s", strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		default:
+			return line, nil
+		}
+	}
+}
+
+// flush waits for the PONG of a PING the caller sent, which the server
+// sends after handling everything before it
+func (c *natsConn) flush() error {
+	line, err := c.next()
+	if err != nil {
+		return err
+	}
+	if line != "PONG" {
+		return fmt.Errorf("nats: expected PONG, got %q", line)
+	}
+	return nil
+}
+
+// validSubject rejects subjects the server would refuse or misparse
+func validSubject(subject string) error {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n*>") || strings.Contains(subject, "..") ||
+		strings.HasPrefix(subject, ".") || strings.HasSuffix(subject, ".") {
+		return fmt.Errorf("invalid subject %q", subject)
+	}
+	return nil
+}
+
+func (n *natsClient) publish(subject string, _, value []byte) error {
+	if err := validSubject(subject); err != nil {
+		return err
+	}
+	c, err := n.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if c.info.MaxPayload > 0 && len(value) > c.info.MaxPayload {
+		return fmt.Errorf("message of %d bytes exceeds the server's %d byte limit", len(value), c.info.MaxPayload)
+	}
+	if _, err := fmt.Fprintf(c, "PUB %s %d\r\n%s\r\nPING\r\n", subject, len(value), value); err != nil {
+		return err
+	}
+	return c.flush()
+}
+
+// request publishes payload to subject and returns the first reply
+func (c *natsConn) request(subject string, payload []byte) ([]byte, error) {
+	token := make([]byte, 8)
+	rand.Read(token)
+	inbox := "_INBOX." + hex.EncodeToString(token)
+	if _, err := fmt.Fprintf(c, "SUB %s 1\r\nPUB %s %s %d\r\n%s\r\n", inbox, subject, inbox, len(payload), payload); err != nil {
+		return nil, err
+	}
+	for {
+		line, err := c.next()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil, fmt.Errorf("no reply to %s: is JetStream enabled?", subject)
+			}
+			return nil, err
+		}
+		// MSG <subject> <sid> [reply-to] <#bytes>
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "MSG" {
+			continue
+		}
+		size, err := strconv.Atoi(fields[len(fields)-1])
+		if err != nil || size < 0 || size > maxNATSPayload {
+			return nil, fmt.Errorf("nats: invalid message header %q", line)
+		}
+		body := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, body); err != nil {
+			return nil, err
+		}
+		if fields[1] == inbox {
+			return body[:size], nil
+		}
+	}
+}
+
+// jsError is the error of a JetStream API response
+type jsError struct {
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+}
+
+// jsRequest calls a JetStream API and decodes its response into v
+func (c *natsConn) jsRequest(subject string, request interface{}, v interface{}) (*jsError, error) {
+	payload, _ := json.Marshal(request)
+	reply, err := c.request(subject, payload)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Error *jsError `json:"error"`
+	}
+	if err := json.Unmarshal(reply, &response); err != nil {
+		return nil, fmt.Errorf("invalid JetStream response: %w", err)
+	}
+	if response.Error != nil {
+		return response.Error, nil
+	}
+	return nil, json.Unmarshal(reply, v)
+}
+
+// latest reads the last message of subject from the JetStream stream
+// that stores it
+func (n *natsClient) latest(subject string) ([]byte, bool, error) {
+	if err := validSubject(subject); err != nil {
+		return nil, false, err
+	}
+	c, err := n.dial()
+	if err != nil {
+		return nil, false, err
+	}
+	defer c.Close()
+
+	stream := n.broker.Stream
+	if stream == "" {
+		var names struct {
+			Streams []string `json:"streams"`
+		}
+		jsErr, err := c.jsRequest("$JS.API.STREAM.NAMES", map[string]string{"subject": subject}, &names)
+		switch {
+		case err != nil:
+			return nil, false, err
+		case jsErr != nil:
+			return nil, false, fmt.Errorf("jetstream: %s", jsErr.Description)
+		case len(names.Streams) == 0:
+			return nil, false, fmt.Errorf("subject %s is not stored by a JetStream stream", subject)
+		}
+		stream = names.Streams[0]
+	}
+
+	var got struct {
+		Message struct {
+			Data []byte `json:"data"`
+		} `json:"message"`
+	}
+	jsErr, err := c.jsRequest("$JS.API.STREAM.MSG.GET."+stream, map[string]string{"last_by_subj": subject}, &got)
+	switch {
+	case err != nil:
+		return nil, false, err
+	case jsErr != nil && jsErr.Code == 404:
+		return nil, false, nil
+	case jsErr != nil:
+		return nil, false, fmt.Errorf("jetstream stream %s: %s", stream, jsErr.Description)
+	}
+	if got.Message.Data == nil {
+		got.Message.Data = []byte{}
+	}
+	return got.Message.Data, true, nil
+}
@@ -0,0 +1,411 @@
+// Package migrate imports existing configuration files (.env, YAML, JSON,
+// TOML and viper-style config files) into a peanu.tsk/config.tsk hierarchy
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/convert"
+)
+
+// Output file names for the generated hierarchy
+const (
+	RootFile = "peanu.tsk"
+	DirFile  = "config.tsk"
+)
+
+// skipDirs are never scanned
+var skipDirs = map[string]bool{
+	".git": true, "node_modules": true, "vendor": true, ".idea": true, ".vscode": true,
+}
+
+// configNames are the base names (without extension) that viper and common
+// frameworks load configuration from
+var configNames = map[string]bool{
+	"config": true, "settings": true, "app": true, "application": true, "appsettings": true,
+}
+
+// envPattern matches a value that is exactly one ${VAR} or ${VAR:-default} reference
+var envPattern = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)(?::?-(.*))?\}$`)
+
+// embeddedEnvPattern matches ${VAR} references inside a longer string
+var embeddedEnvPattern = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*(:?-[^}]*)?\}`)
+
+// Source is one configuration file found during a scan
+type Source struct {
+	Path   string
+	Format convert.Format
+	Tree   map[string]interface{}
+}
+
+// Issue describes a construct that could not be converted faithfully
+type Issue struct {
+	Source  string `json:"source"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	if i.Key == "" {
+		return fmt.Sprintf("%s: %s", i.Source, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Source, i.Key, i.Message)
+}
+
+// Candidate is one source's value for a conflicting key
+type Candidate struct {
+	Source string      `json:"source"`
+	Value  interface{} `json:"value"`
+}
+
+// Conflict is a key that more than one source in a directory sets to
+// different values
+type Conflict struct {
+	Output     string      `json:"output"`
+	Key        string      `json:"key"`
+	Candidates []Candidate `json:"candidates"`
+	Chosen     int         `json:"chosen"`
+}
+
+// Resolver picks the candidate to keep for a conflict
+type Resolver func(conflict *Conflict) (int, error)
+
+// LastWins keeps the value from the source scanned last, so .env.local
+// overrides .env and config.yaml overrides settings.json
+func LastWins(conflict *Conflict) (int, error) {
+	return len(conflict.Candidates) - 1, nil
+}
+
+// Output is one TSK file the migration will write
+type Output struct {
+	Path    string
+	Sources []string
+	Tree    map[string]interface{}
+}
+
+// Plan is the result of a scan: the files to write and everything the
+// user should review
+type Plan struct {
+	Root      string
+	Outputs   []*Output
+	Conflicts []*Conflict
+	Issues    []Issue
+}
+
+// Scan finds configuration files under root and plans one TSK file per
+// directory: peanu.tsk at the root and config.tsk below it
+func Scan(root string, resolve Resolver) (*Plan, error) {
+	if resolve == nil {
+		resolve = LastWins
+	}
+
+	sources, issues, err := findSources(root)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Root: root, Issues: issues}
+
+	byDir := make(map[string][]*Source)
+	var dirs []string
+	for _, src := range sources {
+		dir := filepath.Dir(src.Path)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], src)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		name := DirFile
+		if dir == filepath.Clean(root) {
+			name = RootFile
+		}
+		output := &Output{Path: filepath.Join(dir, name)}
+
+		conflicts, err := plan.merge(output, byDir[dir], resolve)
+		if err != nil {
+			return nil, err
+		}
+		plan.Conflicts = append(plan.Conflicts, conflicts...)
+		plan.Outputs = append(plan.Outputs, output)
+	}
+
+	sort.SliceStable(plan.Issues, func(i, j int) bool {
+		if plan.Issues[i].Source != plan.Issues[j].Source {
+			return plan.Issues[i].Source < plan.Issues[j].Source
+		}
+		return plan.Issues[i].Key < plan.Issues[j].Key
+	})
+	return plan, nil
+}
+
+// merge combines the sources of one directory into output.Tree
+func (p *Plan) merge(output *Output, sources []*Source, resolve Resolver) ([]*Conflict, error) {
+	values := make(map[string][]Candidate)
+	for _, src := range sources {
+		rel := p.rel(src.Path)
+		output.Sources = append(output.Sources, rel)
+
+		flat := make(map[string]interface{})
+		p.flatten(flat, rel, "", src.Tree)
+		for key, value := range flat {
+			values[key] = append(values[key], Candidate{Source: rel, Value: value})
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	flat := make(map[string]interface{}, len(keys))
+	var conflicts []*Conflict
+	for _, key := range keys {
+		candidates := values[key]
+		if !differs(candidates) {
+			flat[key] = candidates[0].Value
+			continue
+		}
+
+		conflict := &Conflict{Output: p.rel(output.Path), Key: key, Candidates: candidates}
+		chosen, err := resolve(conflict)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve conflict for %s: %w", key, err)
+		}
+		if chosen < 0 || chosen >= len(candidates) {
+			return nil, fmt.Errorf("invalid choice %d for %s", chosen+1, key)
+		}
+		conflict.Chosen = chosen
+		flat[key] = candidates[chosen].Value
+		conflicts = append(conflicts, conflict)
+	}
+
+	output.Tree = config.Nest(flat)
+	return conflicts, nil
+}
+
+// flatten walks a source tree into dotted keys, rewriting ${VAR} references
+// and recording anything TSK cannot express
+func (p *Plan) flatten(flat map[string]interface{}, source, prefix string, tree map[string]interface{}) {
+	for key, value := range tree {
+		name := sanitizeKey(key)
+		if name != key {
+			p.Issues = append(p.Issues, Issue{Source: source, Key: joinKey(prefix, key),
+				Message: fmt.Sprintf("key renamed to %q (TSK keys cannot contain spaces, dots or ':#[]{}')", name)})
+		}
+		path := joinKey(prefix, name)
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if len(v) == 0 {
+				flat[path] = v
+				continue
+			}
+			p.flatten(flat, source, path, v)
+		case []interface{}:
+			for _, item := range v {
+				if _, ok := item.(map[string]interface{}); ok {
+					p.Issues = append(p.Issues, Issue{Source: source, Key: path,
+						Message: "array of maps written as an indexed block"})
+					break
+				}
+			}
+			flat[path] = v
+		case string:
+			flat[path] = p.rewriteEnv(source, path, v)
+		default:
+			flat[path] = v
+		}
+	}
+}
+
+// rewriteEnv turns "${VAR}" and "${VAR:-default}" into @env operators.
+// References embedded in longer strings are kept verbatim and reported.
+func (p *Plan) rewriteEnv(source, key, value string) string {
+	if m := envPattern.FindStringSubmatch(value); m != nil {
+		if strings.Contains(value, "-") {
+			return fmt.Sprintf("@env(%q, %q)", m[1], m[2])
+		}
+		return fmt.Sprintf("@env(%q)", m[1])
+	}
+	if embeddedEnvPattern.MatchString(value) {
+		p.Issues = append(p.Issues, Issue{Source: source, Key: key,
+			Message: "variable interpolation inside a string is not supported, kept as a literal"})
+	}
+	return value
+}
+
+func (p *Plan) rel(path string) string {
+	if rel, err := filepath.Rel(p.Root, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// Write writes every planned output. Existing files are left untouched
+// unless force is set.
+func (p *Plan) Write(force bool) ([]string, error) {
+	if !force {
+		for _, output := range p.Outputs {
+			if _, err := os.Stat(output.Path); err == nil {
+				return nil, fmt.Errorf("%s already exists (use --force to overwrite)", output.Path)
+			}
+		}
+	}
+
+	var written []string
+	for _, output := range p.Outputs {
+		data, err := output.Render()
+		if err != nil {
+			return written, err
+		}
+		if err := os.WriteFile(output.Path, data, 0644); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", output.Path, err)
+		}
+		written = append(written, output.Path)
+	}
+	return written, nil
+}
+
+// Render returns the TSK content of the output with a header listing its sources
+func (o *Output) Render() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by tsk migrate from:\n")
+	for _, src := range o.Sources {
+		buf.WriteString(fmt.Sprintf("#   %s\n", src))
+	}
+	buf.WriteString("\n")
+
+	if err := convert.Encode(&buf, o.Tree, convert.FormatTSK); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// findSources walks root for configuration files and decodes them
+func findSources(root string) ([]*Source, []Issue, error) {
+	var sources []*Source
+	var issues []Issue
+
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && skipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		format, ok := sourceFormat(d.Name())
+		if !ok {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		rel, _ := filepath.Rel(root, path)
+		tree, err := convert.Decode(file, format)
+		if err != nil {
+			issues = append(issues, Issue{Source: rel, Message: fmt.Sprintf("skipped: %v", err)})
+			return nil
+		}
+		sources = append(sources, &Source{Path: path, Format: format, Tree: tree})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+
+	// Within a directory, base files come before overrides (.env before .env.local)
+	sort.SliceStable(sources, func(i, j int) bool {
+		di, dj := filepath.Dir(sources[i].Path), filepath.Dir(sources[j].Path)
+		if di != dj {
+			return di < dj
+		}
+		return sourceRank(sources[i].Path) < sourceRank(sources[j].Path)
+	})
+
+	return sources, issues, nil
+}
+
+// sourceFormat reports whether a file name looks like a configuration file
+func sourceFormat(name string) (convert.Format, bool) {
+	if name == ".env" || strings.HasPrefix(name, ".env.") {
+		switch strings.TrimPrefix(name, ".env.") {
+		case "example", "sample", "template", "dist":
+			return "", false
+		}
+		return convert.FormatEnv, true
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if !configNames[strings.ToLower(base)] {
+		return "", false
+	}
+
+	format, err := convert.ParseFormat(ext)
+	if err != nil || format == convert.FormatTSK {
+		return "", false
+	}
+	return format, true
+}
+
+// sourceRank orders files so more specific ones override general ones
+func sourceRank(path string) string {
+	name := filepath.Base(path)
+	switch {
+	case name == ".env.local":
+		return "3"
+	case strings.HasPrefix(name, ".env."):
+		return "2" + name
+	case name == ".env":
+		return "1"
+	}
+	return "0" + name
+}
+
+// differs reports whether candidates disagree on the value
+func differs(candidates []Candidate) bool {
+	for _, c := range candidates[1:] {
+		if !reflect.DeepEqual(c.Value, candidates[0].Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeKey replaces characters the TSK parser treats as syntax
+func sanitizeKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '.', ':', '#', '[', ']', '{', '}':
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,78 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanAndWrite(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".env"), "DATABASE__HOST=localhost\nAPI_KEY=${API_KEY}\nDEBUG=false\n")
+	writeFile(t, filepath.Join(root, ".env.local"), "DEBUG=true\n")
+	writeFile(t, filepath.Join(root, ".env.example"), "DEBUG=\n")
+	writeFile(t, filepath.Join(root, "config.yaml"), "database:\n  port: 5432\nurl: \"http://${HOST}/api\"\n")
+	writeFile(t, filepath.Join(root, "services", "worker", "settings.json"), `{"queue": {"workers": 4}, "bad key": 1}`)
+
+	plan, err := Scan(root, nil)
+	if err != nil {
+		t.Fatalf("Scan() returned error: %v", err)
+	}
+	if len(plan.Outputs) != 2 {
+		t.Fatalf("expected 2 outputs, got %d", len(plan.Outputs))
+	}
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0].Key != "debug" {
+		t.Errorf("expected a conflict on debug, got %+v", plan.Conflicts)
+	}
+	if len(plan.Issues) != 2 {
+		t.Errorf("expected 2 issues, got %v", plan.Issues)
+	}
+
+	if _, err := plan.Write(false); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+
+	cfg := config.New()
+	if err := cfg.LoadFromFile(filepath.Join(root, RootFile)); err != nil {
+		t.Fatalf("failed to load %s: %v", RootFile, err)
+	}
+	if cfg.GetString("database.host") != "localhost" || cfg.GetInt("database.port") != 5432 {
+		t.Errorf("database section not merged: %v", cfg.Values())
+	}
+	if !cfg.GetBool("debug") {
+		t.Errorf(".env.local should override .env")
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, RootFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `api_key: @env("API_KEY")`) {
+		t.Errorf("${API_KEY} was not rewritten to @env:\n%s", data)
+	}
+
+	sub := config.New()
+	if err := sub.LoadFromFile(filepath.Join(root, "services", "worker", DirFile)); err != nil {
+		t.Fatalf("failed to load %s: %v", DirFile, err)
+	}
+	if sub.GetInt("queue.workers") != 4 || sub.GetInt("bad_key") != 1 {
+		t.Errorf("worker config not migrated: %v", sub.Values())
+	}
+
+	if _, err := plan.Write(false); err == nil {
+		t.Errorf("expected Write() to refuse overwriting existing files")
+	}
+}
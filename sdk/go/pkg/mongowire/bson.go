@@ -0,0 +1,418 @@
+package mongowire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// D is an ordered BSON document. Commands must be ordered: the server reads
+// the command name from the first key.
+type D []E
+
+// E is one element of a D
+type E struct {
+	Key   string
+	Value interface{}
+}
+
+// Get returns the value of key, or nil
+func (d D) Get(key string) interface{} {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+// Map converts d, and every document nested in it, to plain maps and slices
+func (d D) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(d))
+	for _, e := range d {
+		m[e.Key] = plain(e.Value)
+	}
+	return m
+}
+
+// plain converts nested documents to maps
+func plain(value interface{}) interface{} {
+	switch v := value.(type) {
+	case D:
+		return v.Map()
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = plain(item)
+		}
+		return out
+	}
+	return value
+}
+
+// ObjectID is a 12-byte MongoDB object id
+type ObjectID [12]byte
+
+// String renders the id the way the mongo shell does
+func (id ObjectID) String() string {
+	return `ObjectId("` + hex.EncodeToString(id[:]) + `")`
+}
+
+// Hex is the id's 24 hex digits
+func (id ObjectID) Hex() string {
+	return hex.EncodeToString(id[:])
+}
+
+// ObjectIDFromHex parses 24 hex digits
+func ObjectIDFromHex(s string) (ObjectID, error) {
+	var id ObjectID
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(id) {
+		return id, fmt.Errorf("invalid ObjectId %q", s)
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// Binary is BSON binary data with a subtype
+type Binary struct {
+	Subtype byte
+	Data    []byte
+}
+
+// Timestamp is a BSON internal timestamp
+type Timestamp struct {
+	T, I uint32
+}
+
+// Regex is a BSON regular expression
+type Regex struct {
+	Pattern, Options string
+}
+
+// Decimal128 holds the raw bytes of a BSON decimal
+type Decimal128 [16]byte
+
+// BSON element types
+const (
+	typeDouble    = 0x01
+	typeString    = 0x02
+	typeDocument  = 0x03
+	typeArray     = 0x04
+	typeBinary    = 0x05
+	typeUndefined = 0x06
+	typeObjectID  = 0x07
+	typeBool      = 0x08
+	typeDateTime  = 0x09
+	typeNull      = 0x0A
+	typeRegex     = 0x0B
+	typeInt32     = 0x10
+	typeTimestamp = 0x11
+	typeInt64     = 0x12
+	typeDecimal   = 0x13
+	typeMinKey    = 0xFF
+	typeMaxKey    = 0x7F
+)
+
+// Marshal encodes a D, or a map with its keys sorted, as a BSON document
+func Marshal(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeDocument(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeDocument appends doc to buf
+func writeDocument(buf *bytes.Buffer, doc interface{}) error {
+	var elems D
+	switch v := doc.(type) {
+	case D:
+		elems = v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			elems = append(elems, E{key, v[key]})
+		}
+	case []interface{}:
+		for i, item := range v {
+			elems = append(elems, E{fmt.Sprint(i), item})
+		}
+	default:
+		return fmt.Errorf("cannot encode %T as a document", doc)
+	}
+
+	start := buf.Len()
+	buf.Write([]byte{0, 0, 0, 0})
+	for _, e := range elems {
+		if err := writeElement(buf, e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(0)
+	binary.LittleEndian.PutUint32(buf.Bytes()[start:], uint32(buf.Len()-start))
+	return nil
+}
+
+// writeElement appends one typed element to buf
+func writeElement(buf *bytes.Buffer, key string, value interface{}) error {
+	header := func(t byte) {
+		buf.WriteByte(t)
+		buf.WriteString(key)
+		buf.WriteByte(0)
+	}
+	var scratch [8]byte
+	switch v := value.(type) {
+	case nil:
+		header(typeNull)
+	case float64:
+		header(typeDouble)
+		binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+		buf.Write(scratch[:])
+	case float32:
+		return writeElement(buf, key, float64(v))
+	case string:
+		header(typeString)
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)+1))
+		buf.Write(scratch[:4])
+		buf.WriteString(v)
+		buf.WriteByte(0)
+	case D, map[string]interface{}:
+		header(typeDocument)
+		return writeDocument(buf, v)
+	case []interface{}:
+		header(typeArray)
+		return writeDocument(buf, v)
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		return writeElement(buf, key, items)
+	case []D:
+		items := make([]interface{}, len(v))
+		for i, d := range v {
+			items[i] = d
+		}
+		return writeElement(buf, key, items)
+	case []byte:
+		return writeElement(buf, key, Binary{Data: v})
+	case Binary:
+		header(typeBinary)
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v.Data)))
+		buf.Write(scratch[:4])
+		buf.WriteByte(v.Subtype)
+		buf.Write(v.Data)
+	case ObjectID:
+		header(typeObjectID)
+		buf.Write(v[:])
+	case bool:
+		header(typeBool)
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case time.Time:
+		header(typeDateTime)
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v.UnixMilli()))
+		buf.Write(scratch[:])
+	case Regex:
+		header(typeRegex)
+		buf.WriteString(v.Pattern)
+		buf.WriteByte(0)
+		buf.WriteString(v.Options)
+		buf.WriteByte(0)
+	case int32:
+		header(typeInt32)
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(v))
+		buf.Write(scratch[:4])
+	case Timestamp:
+		header(typeTimestamp)
+		binary.LittleEndian.PutUint32(scratch[:4], v.I)
+		binary.LittleEndian.PutUint32(scratch[4:], v.T)
+		buf.Write(scratch[:])
+	case int64:
+		header(typeInt64)
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+		buf.Write(scratch[:])
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return writeElement(buf, key, int32(v))
+		}
+		return writeElement(buf, key, int64(v))
+	case Decimal128:
+		header(typeDecimal)
+		buf.Write(v[:])
+	default:
+		return fmt.Errorf("cannot encode %s of type %T", key, value)
+	}
+	return nil
+}
+
+// Unmarshal decodes one BSON document
+func Unmarshal(data []byte) (D, error) {
+	r := &reader{data: data}
+	doc, err := r.document()
+	if err != nil {
+		return nil, fmt.Errorf("malformed BSON: %w", err)
+	}
+	return doc, nil
+}
+
+// reader decodes BSON from a byte slice
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) take(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *reader) int32() (int32, error) {
+	b, err := r.take(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(b)), nil
+}
+
+func (r *reader) uint64() (uint64, error) {
+	b, err := r.take(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (r *reader) cstring() (string, error) {
+	end := bytes.IndexByte(r.data[r.pos:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string")
+	}
+	s := string(r.data[r.pos : r.pos+end])
+	r.pos += end + 1
+	return s, nil
+}
+
+func (r *reader) document() (D, error) {
+	size, err := r.int32()
+	if err != nil {
+		return nil, err
+	}
+	end := r.pos - 4 + int(size)
+	if size < 5 || end > len(r.data) {
+		return nil, fmt.Errorf("invalid document length %d", size)
+	}
+	doc := D{}
+	for r.pos < end-1 {
+		t := r.data[r.pos]
+		r.pos++
+		key, err := r.cstring()
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.value(t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		doc = append(doc, E{key, value})
+	}
+	if r.pos != end-1 || r.data[r.pos] != 0 {
+		return nil, fmt.Errorf("document overruns its length")
+	}
+	r.pos = end
+	return doc, nil
+}
+
+func (r *reader) value(t byte) (interface{}, error) {
+	switch t {
+	case typeDouble:
+		bits, err := r.uint64()
+		return math.Float64frombits(bits), err
+	case typeString:
+		n, err := r.int32()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.take(int(n))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid string")
+		}
+		return string(b[:n-1]), nil
+	case typeDocument:
+		return r.document()
+	case typeArray:
+		doc, err := r.document()
+		if err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, len(doc))
+		for i, e := range doc {
+			items[i] = e.Value
+		}
+		return items, nil
+	case typeBinary:
+		n, err := r.int32()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.take(int(n) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Binary{Subtype: b[0], Data: append([]byte(nil), b[1:]...)}, nil
+	case typeUndefined, typeNull, typeMinKey, typeMaxKey:
+		return nil, nil
+	case typeObjectID:
+		var id ObjectID
+		b, err := r.take(12)
+		copy(id[:], b)
+		return id, err
+	case typeBool:
+		b, err := r.take(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] == 1, nil
+	case typeDateTime:
+		ms, err := r.uint64()
+		return time.UnixMilli(int64(ms)).UTC(), err
+	case typeRegex:
+		pattern, err := r.cstring()
+		if err != nil {
+			return nil, err
+		}
+		options, err := r.cstring()
+		return Regex{pattern, options}, err
+	case typeInt32:
+		n, err := r.int32()
+		return n, err
+	case typeTimestamp:
+		v, err := r.uint64()
+		return Timestamp{T: uint32(v >> 32), I: uint32(v)}, err
+	case typeInt64:
+		v, err := r.uint64()
+		return int64(v), err
+	case typeDecimal:
+		var d Decimal128
+		b, err := r.take(16)
+		copy(d[:], b)
+		return d, err
+	}
+	return nil, fmt.Errorf("unsupported BSON type 0x%02x", t)
+}
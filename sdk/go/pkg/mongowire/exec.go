@@ -0,0 +1,225 @@
+package mongowire
+
+import (
+	"fmt"
+)
+
+// Result is the outcome of a statement: documents for reads, a count of
+// affected documents for writes
+type Result struct {
+	Documents []D
+	Affected  int64
+}
+
+// Exec runs a parsed statement against db
+func (c *Client) Exec(db string, st *Statement) (*Result, error) {
+	coll := st.Collection
+	arg := func(i int) (interface{}, error) {
+		if i >= len(st.Args) || st.Args[i] == nil {
+			return D{}, nil
+		}
+		switch v := st.Args[i].(type) {
+		case D, map[string]interface{}:
+			return v, nil
+		}
+		return nil, fmt.Errorf("%s: argument %d must be a document", st.Method, i+1)
+	}
+
+	switch st.Method {
+	case "showCollections":
+		return c.cursor(db, "", D{{"listCollections", 1}, {"nameOnly", true}}, 0)
+
+	case "runCommand":
+		cmd, ok := first(st.Args).(D)
+		if !ok || len(cmd) == 0 {
+			return nil, fmt.Errorf("runCommand expects a command document")
+		}
+		reply, err := c.RunCommand(db, cmd)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Documents: []D{reply}}, nil
+
+	case "find", "findOne":
+		filter, err := arg(0)
+		if err != nil {
+			return nil, err
+		}
+		cmd := D{{"find", coll}, {"filter", filter}}
+		if len(st.Args) > 1 {
+			projection, err := arg(1)
+			if err != nil {
+				return nil, err
+			}
+			cmd = append(cmd, E{"projection", projection})
+		}
+		if st.Sort != nil {
+			cmd = append(cmd, E{"sort", st.Sort})
+		}
+		if st.Skip > 0 {
+			cmd = append(cmd, E{"skip", st.Skip})
+		}
+		limit := st.Limit
+		if st.Method == "findOne" {
+			limit = 1
+			cmd = append(cmd, E{"singleBatch", true})
+		}
+		if limit > 0 {
+			cmd = append(cmd, E{"limit", limit})
+		}
+		return c.cursor(db, coll, cmd, limit)
+
+	case "count", "countDocuments":
+		filter, err := arg(0)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := c.RunCommand(db, D{{"count", coll}, {"query", filter}})
+		if err != nil {
+			return nil, err
+		}
+		n, _ := toInt64(reply.Get("n"))
+		return &Result{Documents: []D{{{"count", n}}}}, nil
+
+	case "distinct":
+		key, ok := first(st.Args).(string)
+		if !ok {
+			return nil, fmt.Errorf("distinct expects a field name")
+		}
+		filter, err := arg(1)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := c.RunCommand(db, D{{"distinct", coll}, {"key", key}, {"query", filter}})
+		if err != nil {
+			return nil, err
+		}
+		result := &Result{}
+		values, _ := reply.Get("values").([]interface{})
+		for _, v := range values {
+			result.Documents = append(result.Documents, D{{key, v}})
+		}
+		return result, nil
+
+	case "aggregate":
+		pipeline, ok := first(st.Args).([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("aggregate expects a pipeline array")
+		}
+		return c.cursor(db, coll, D{{"aggregate", coll}, {"pipeline", pipeline}, {"cursor", D{}}}, 0)
+
+	case "insertOne", "insertMany":
+		var docs []interface{}
+		if st.Method == "insertMany" {
+			items, ok := first(st.Args).([]interface{})
+			if !ok || len(items) == 0 {
+				return nil, fmt.Errorf("insertMany expects an array of documents")
+			}
+			docs = items
+		} else {
+			doc, err := arg(0)
+			if err != nil {
+				return nil, err
+			}
+			docs = []interface{}{doc}
+		}
+		return c.write(db, D{{"insert", coll}, {"documents", docs}})
+
+	case "updateOne", "updateMany", "replaceOne":
+		filter, err := arg(0)
+		if err != nil {
+			return nil, err
+		}
+		update, err := arg(1)
+		if err != nil {
+			return nil, err
+		}
+		options, err := arg(2)
+		if err != nil {
+			return nil, err
+		}
+		upsert, _ := lookup(options, "upsert").(bool)
+		return c.write(db, D{{"update", coll}, {"updates", []interface{}{D{
+			{"q", filter},
+			{"u", update},
+			{"multi", st.Method == "updateMany"},
+			{"upsert", upsert},
+		}}}})
+
+	case "deleteOne", "deleteMany":
+		filter, err := arg(0)
+		if err != nil {
+			return nil, err
+		}
+		limit := int32(0)
+		if st.Method == "deleteOne" {
+			limit = 1
+		}
+		return c.write(db, D{{"delete", coll}, {"deletes", []interface{}{D{{"q", filter}, {"limit", limit}}}}})
+
+	case "drop":
+		if _, err := c.RunCommand(db, D{{"drop", coll}}); err != nil {
+			return nil, err
+		}
+		return &Result{}, nil
+	}
+	return nil, fmt.Errorf("unsupported method %q", st.Method)
+}
+
+// write runs an insert, update or delete command and reports how many
+// documents it touched
+func (c *Client) write(db string, cmd D) (*Result, error) {
+	reply, err := c.RunCommand(db, cmd)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := toInt64(reply.Get("n"))
+	return &Result{Affected: n}, nil
+}
+
+// cursor runs a command returning a cursor and drains it with getMore,
+// stopping after limit documents when limit is positive
+func (c *Client) cursor(db, coll string, cmd D, limit int64) (*Result, error) {
+	reply, err := c.RunCommand(db, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if coll == "" {
+		// listCollections cursors live on the $cmd.listCollections namespace
+		coll = "$cmd.listCollections"
+	}
+	result := &Result{}
+	batch := "firstBatch"
+	for {
+		cur, _ := reply.Get("cursor").(D)
+		docs, _ := cur.Get(batch).([]interface{})
+		for _, doc := range docs {
+			if d, ok := doc.(D); ok {
+				result.Documents = append(result.Documents, d)
+			}
+		}
+		id, _ := toInt64(cur.Get("id"))
+		if id == 0 {
+			return result, nil
+		}
+		if limit > 0 && int64(len(result.Documents)) >= limit {
+			c.RunCommand(db, D{{"killCursors", coll}, {"cursors", []interface{}{id}}})
+			return result, nil
+		}
+		if reply, err = c.RunCommand(db, D{{"getMore", id}, {"collection", coll}}); err != nil {
+			return nil, err
+		}
+		batch = "nextBatch"
+	}
+}
+
+// lookup reads key from a D or map document
+func lookup(doc interface{}, key string) interface{} {
+	switch d := doc.(type) {
+	case D:
+		return d.Get(key)
+	case map[string]interface{}:
+		return d[key]
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+package mongowire
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Statement is a parsed mongo shell statement such as
+// db.users.find({age: {$gt: 30}}).sort({name: 1}).limit(10)
+type Statement struct {
+	// Collection is empty for database-level statements
+	Collection string
+	// Method is the collection method (find, insertOne, ...), or
+	// "showCollections" and "runCommand" for database-level statements
+	Method string
+	Args   []interface{}
+	// Sort, Limit and Skip come from chained cursor methods
+	Sort  interface{}
+	Limit int64
+	Skip  int64
+}
+
+// collectionMethods are the methods a statement may call on a collection
+var collectionMethods = map[string]bool{
+	"find": true, "findOne": true, "countDocuments": true, "count": true, "distinct": true,
+	"aggregate": true, "insertOne": true, "insertMany": true, "updateOne": true,
+	"updateMany": true, "replaceOne": true, "deleteOne": true, "deleteMany": true, "drop": true,
+}
+
+// ParseStatement parses show collections, db.runCommand({...}) and
+// db.<collection>.<method>(...) statements
+func ParseStatement(s string) (*Statement, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), ";")
+	switch strings.Join(strings.Fields(s), " ") {
+	case "show collections", "show tables":
+		return &Statement{Method: "showCollections"}, nil
+	}
+
+	p := &parser{s: s}
+	if !p.consume("db.") {
+		return nil, fmt.Errorf("expected db.<collection>.<method>(...), got %q", s)
+	}
+	st := &Statement{}
+	name := p.ident()
+	switch name {
+	case "runCommand":
+		args, err := p.args()
+		if err != nil {
+			return nil, err
+		}
+		st.Method, st.Args = "runCommand", args
+		return st, p.end()
+	case "getCollection":
+		args, err := p.args()
+		if err != nil {
+			return nil, err
+		}
+		collection, ok := first(args).(string)
+		if !ok || len(args) != 1 {
+			return nil, fmt.Errorf("getCollection expects a collection name")
+		}
+		st.Collection = collection
+	case "":
+		return nil, fmt.Errorf("expected a collection name after db.")
+	default:
+		st.Collection = name
+	}
+
+	if !p.consume(".") {
+		return nil, fmt.Errorf("expected .<method>(...) after db.%s", st.Collection)
+	}
+	st.Method = p.ident()
+	if !collectionMethods[st.Method] {
+		return nil, fmt.Errorf("unsupported method %q", st.Method)
+	}
+	args, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+	st.Args = args
+
+	for p.consume(".") {
+		modifier := p.ident()
+		args, err := p.args()
+		if err != nil {
+			return nil, err
+		}
+		if st.Method != "find" {
+			return nil, fmt.Errorf(".%s() can only follow find()", modifier)
+		}
+		switch modifier {
+		case "sort":
+			st.Sort = first(args)
+		case "limit", "skip":
+			n, ok := toInt64(first(args))
+			if !ok {
+				return nil, fmt.Errorf(".%s() expects a number", modifier)
+			}
+			if modifier == "limit" {
+				st.Limit = n
+			} else {
+				st.Skip = n
+			}
+		default:
+			return nil, fmt.Errorf("unsupported cursor method %q", modifier)
+		}
+	}
+	return st, p.end()
+}
+
+// ParseValue parses a mongo shell value: JSON that also allows unquoted
+// keys, single-quoted strings, ObjectId("..."), ISODate("...") and the
+// $oid, $date and $numberLong extended JSON forms
+func ParseValue(s string) (interface{}, error) {
+	p := &parser{s: s}
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return value, p.end()
+}
+
+// first returns args[0], or nil
+func first(args []interface{}) interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	return args[0]
+}
+
+// toInt64 converts a parsed number
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int32:
+		return int64(n), true
+	case float64:
+		return int64(n), n == float64(int64(n))
+	}
+	return 0, false
+}
+
+// parser reads mongo shell syntax
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *parser) end() error {
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return fmt.Errorf("unexpected %q at offset %d", p.s[p.pos:], p.pos)
+	}
+	return nil
+}
+
+func (p *parser) ident() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == '_' || c == '$' || c == '-' && p.pos > start || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) && p.pos > start {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.s[start:p.pos]
+}
+
+// args parses a parenthesised, comma-separated argument list
+func (p *parser) args() ([]interface{}, error) {
+	if !p.consume("(") {
+		return nil, fmt.Errorf("expected ( at offset %d", p.pos)
+	}
+	var args []interface{}
+	if p.consume(")") {
+		return args, nil
+	}
+	for {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+		if p.consume(")") {
+			return args, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("expected , or ) at offset %d", p.pos)
+		}
+	}
+}
+
+func (p *parser) value() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, fmt.Errorf("unexpected end of input")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	}
+
+	word := p.ident()
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "undefined":
+		return nil, nil
+	case "ObjectId", "ISODate", "NumberLong", "NumberInt", "new":
+		if word == "new" {
+			if word = p.ident(); word != "Date" {
+				return nil, fmt.Errorf("unsupported constructor new %s", word)
+			}
+		}
+		args, err := p.args()
+		if err != nil {
+			return nil, err
+		}
+		return construct(word, args)
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", p.s[p.pos:], p.pos)
+}
+
+// construct evaluates ObjectId("..."), ISODate("...") and friends
+func construct(name string, args []interface{}) (interface{}, error) {
+	arg := first(args)
+	switch name {
+	case "ObjectId":
+		s, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("ObjectId expects a hex string")
+		}
+		return ObjectIDFromHex(s)
+	case "ISODate", "Date":
+		if arg == nil {
+			return time.Now().UTC(), nil
+		}
+		s, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a date string", name)
+		}
+		return parseDate(s)
+	case "NumberLong":
+		n, err := strconv.ParseInt(fmt.Sprint(arg), 10, 64)
+		return n, err
+	case "NumberInt":
+		n, err := strconv.ParseInt(fmt.Sprint(arg), 10, 32)
+		return int32(n), err
+	}
+	return nil, fmt.Errorf("unsupported constructor %s", name)
+}
+
+// parseDate accepts RFC 3339 timestamps and plain dates
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+func (p *parser) object() (interface{}, error) {
+	p.consume("{")
+	doc := D{}
+	if p.consume("}") {
+		return doc, nil
+	}
+	for {
+		p.skipSpace()
+		var key string
+		if p.pos < len(p.s) && (p.s[p.pos] == '"' || p.s[p.pos] == '\'') {
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		} else if key = p.ident(); key == "" {
+			return nil, fmt.Errorf("expected a key at offset %d", p.pos)
+		}
+		if !p.consume(":") {
+			return nil, fmt.Errorf("expected : after %q", key)
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, E{key, value})
+		if p.consume("}") {
+			break
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("expected , or } at offset %d", p.pos)
+		}
+	}
+	return extendedJSON(doc)
+}
+
+// extendedJSON converts {$oid: ...}, {$date: ...} and {$numberLong: ...}
+func extendedJSON(doc D) (interface{}, error) {
+	if len(doc) != 1 {
+		return doc, nil
+	}
+	s, ok := doc[0].Value.(string)
+	switch {
+	case doc[0].Key == "$oid" && ok:
+		return ObjectIDFromHex(s)
+	case doc[0].Key == "$date" && ok:
+		return parseDate(s)
+	case doc[0].Key == "$numberLong" && ok:
+		return strconv.ParseInt(s, 10, 64)
+	}
+	return doc, nil
+}
+
+func (p *parser) array() (interface{}, error) {
+	p.consume("[")
+	items := []interface{}{}
+	if p.consume("]") {
+		return items, nil
+	}
+	for {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+		if p.consume("]") {
+			return items, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("expected , or ] at offset %d", p.pos)
+		}
+	}
+}
+
+func (p *parser) str() (string, error) {
+	quote := p.s[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && p.pos < len(p.s):
+			escaped := p.s[p.pos]
+			p.pos++
+			switch escaped {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if p.pos+4 > len(p.s) {
+					return "", fmt.Errorf("invalid \\u escape")
+				}
+				r, err := strconv.ParseUint(p.s[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					return "", fmt.Errorf("invalid \\u escape")
+				}
+				b.WriteRune(rune(r))
+				p.pos += 4
+			default:
+				b.WriteByte(escaped)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+func (p *parser) number() (interface{}, error) {
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte("+-.0123456789eE", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	text := p.s[start:p.pos]
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", text)
+	}
+	return f, nil
+}
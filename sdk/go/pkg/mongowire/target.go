@@ -0,0 +1,170 @@
+package mongowire
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// BuildStatement turns a query into a statement. Shell statements
+// (db.users.find(...), show collections) are parsed as they are; a bare
+// collection name finds documents matching the filter in args[0], which may
+// be a shell/JSON string, a D or a map.
+func BuildStatement(query string, args ...interface{}) (*Statement, error) {
+	query = strings.TrimSpace(query)
+	if strings.HasPrefix(query, "db.") || strings.HasPrefix(query, "show ") {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("shell statements take no arguments")
+		}
+		return ParseStatement(query)
+	}
+	if query == "" || strings.ContainsAny(query, " ({") {
+		return nil, fmt.Errorf("expected a collection name or a db.<collection> statement, got %q", query)
+	}
+	if len(args) > 1 {
+		return nil, fmt.Errorf("a collection query takes at most one filter")
+	}
+	st := &Statement{Collection: query, Method: "find"}
+	switch filter := first(args).(type) {
+	case nil:
+	case string:
+		value, err := ParseValue(filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+		st.Args = []interface{}{value}
+	case D, map[string]interface{}:
+		st.Args = []interface{}{filter}
+	default:
+		return nil, fmt.Errorf("filter must be a document, got %T", filter)
+	}
+	return st, nil
+}
+
+// Rows flattens result documents into maps and the union of their keys, in
+// first-seen order
+func (r *Result) Rows() ([]map[string]interface{}, []string) {
+	rows := make([]map[string]interface{}, 0, len(r.Documents))
+	var columns []string
+	seen := make(map[string]bool)
+	for _, doc := range r.Documents {
+		for _, e := range doc {
+			if !seen[e.Key] {
+				seen[e.Key] = true
+				columns = append(columns, e.Key)
+			}
+		}
+		rows = append(rows, doc.Map())
+	}
+	return rows, columns
+}
+
+// ConfigURI builds a connection string from flattened configuration:
+// database.mongodb.uri, or database.mongodb.host, port, username, password,
+// database and auth_source. ok is false when neither is configured.
+func ConfigURI(values map[string]interface{}) (uri string, ok bool) {
+	get := func(key string) string {
+		if v, ok := values["database.mongodb."+key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	if uri := get("uri"); uri != "" {
+		return uri, true
+	}
+	host := get("host")
+	if host == "" {
+		return "", false
+	}
+	if port := get("port"); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	u := url.URL{Scheme: "mongodb", Host: host, Path: "/" + get("database")}
+	if user := get("username"); user != "" {
+		if password := get("password"); password != "" {
+			u.User = url.UserPassword(user, password)
+		} else {
+			u.User = url.User(user)
+		}
+	}
+	if source := get("auth_source"); source != "" {
+		u.RawQuery = url.Values{"authSource": {source}}.Encode()
+	}
+	return u.String(), true
+}
+
+// Target runs queries for the @query operator, connecting on first use
+type Target struct {
+	uri    string
+	mu     sync.Mutex
+	client *Client
+}
+
+var (
+	targetsMu sync.Mutex
+	targets   = make(map[string]*Target)
+)
+
+// TargetFor returns the shared target for uri, so repeated configuration
+// reuses one connection pool
+func TargetFor(uri string) *Target {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	if t, ok := targets[uri]; ok {
+		return t
+	}
+	t := &Target{uri: uri}
+	targets[uri] = t
+	return t
+}
+
+// NewClientTarget serves queries from an existing client
+func NewClientTarget(client *Client) *Target {
+	return &Target{client: client}
+}
+
+// Query runs a statement or collection query. Reads return a slice of
+// documents as maps; writes return the number of affected documents.
+func (t *Target) Query(query string, args ...interface{}) (interface{}, error) {
+	st, err := BuildStatement(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	client, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.Exec(client.Database(), st)
+	if err != nil {
+		return nil, err
+	}
+	if writeMethods[st.Method] {
+		return result.Affected, nil
+	}
+	rows, _ := result.Rows()
+	return rows, nil
+}
+
+func (t *Target) connect() (*Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+	opts, err := ParseURI(t.uri)
+	if err != nil {
+		return nil, err
+	}
+	if t.client, err = Dial(opts); err != nil {
+		return nil, err
+	}
+	return t.client, nil
+}
+
+// writeMethods are the statements that modify documents
+var writeMethods = map[string]bool{
+	"insertOne": true, "insertMany": true, "updateOne": true, "updateMany": true,
+	"replaceOne": true, "deleteOne": true, "deleteMany": true,
+}
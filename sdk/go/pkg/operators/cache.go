@@ -0,0 +1,302 @@
+package operators
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStore holds @cache results. The default keeps them in memory;
+// rediswire.Cache shares them through Redis.
+type CacheStore interface {
+	Get(key string) (interface{}, bool, error)
+	Set(key string, value interface{}, ttl time.Duration) error
+}
+
+var (
+	cacheStoreMu sync.RWMutex
+	cacheStore   CacheStore = newMemoryCache()
+)
+
+// SetCacheStore switches the store behind @cache; nil restores the
+// in-memory default
+func SetCacheStore(store CacheStore) {
+	cacheStoreMu.Lock()
+	defer cacheStoreMu.Unlock()
+	if store == nil {
+		store = newMemoryCache()
+	}
+	cacheStore = store
+}
+
+func currentCacheStore() CacheStore {
+	cacheStoreMu.RLock()
+	defer cacheStoreMu.RUnlock()
+	return cacheStore
+}
+
+// CacheKey is the key a compiled @cache stores its value under when no
+// key is given: a hash of the expression's source text
+func CacheKey(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return "expr:" + hex.EncodeToString(sum[:16])
+}
+
+// cacheCounters back CacheStatus
+var cacheCounters struct {
+	hits, misses, sets, errors atomic.Int64
+}
+
+// CacheStats describes the @cache store. Counters cover this process since
+// it started or the cache was last cleared.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+	Sets   int64
+	// Errors counts store failures, which degrade to misses
+	Errors int64
+	// Entries is -1 when the store cannot count its keys
+	Entries int
+	// Levels describes each level of a tiered store, fastest first
+	Levels []CacheLevel
+}
+
+// CacheLevel describes one level of a tiered @cache store. Its hits and
+// misses count the lookups that reached it.
+type CacheLevel struct {
+	// Name is the level, such as "l1"
+	Name string
+	// Backend is where the level keeps entries, such as "memory" or "redis"
+	Backend   string
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	// Entries is -1 when the level cannot count its keys
+	Entries int
+	// Bytes is the size of the entries held, where the level tracks it
+	Bytes int64
+}
+
+// CacheStatus returns the @cache counters and the number of stored entries
+func CacheStatus() (CacheStats, error) {
+	stats := CacheStats{
+		Hits:    cacheCounters.hits.Load(),
+		Misses:  cacheCounters.misses.Load(),
+		Sets:    cacheCounters.sets.Load(),
+		Errors:  cacheCounters.errors.Load(),
+		Entries: -1,
+	}
+	if counter, ok := currentCacheStore().(interface{ Len() (int, error) }); ok {
+		n, err := counter.Len()
+		if err != nil {
+			return stats, fmt.Errorf("failed to count cache entries: %w", err)
+		}
+		stats.Entries = n
+	}
+	if tiered, ok := currentCacheStore().(interface{ CacheLevels() []CacheLevel }); ok {
+		stats.Levels = tiered.CacheLevels()
+	}
+	return stats, nil
+}
+
+// CacheContains reports whether the @cache store holds key, without
+// counting a hit or a miss. Stores that count lookups themselves can skip
+// counting this one by implementing Contains.
+func CacheContains(key string) (bool, error) {
+	store := currentCacheStore()
+	if container, ok := store.(interface{ Contains(string) (bool, error) }); ok {
+		return container.Contains(key)
+	}
+	_, ok, err := store.Get(key)
+	return ok, err
+}
+
+// ClearCache drops every @cache entry and resets the counters. Stores
+// that cannot be cleared keep their entries until they expire.
+func ClearCache() error {
+	cacheCounters.hits.Store(0)
+	cacheCounters.misses.Store(0)
+	cacheCounters.sets.Store(0)
+	cacheCounters.errors.Store(0)
+	if clearer, ok := currentCacheStore().(interface{ Clear() error }); ok {
+		if err := clearer.Clear(); err != nil {
+			return fmt.Errorf("failed to clear cache: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteCache drops the @cache entries under keys, leaving the rest. A
+// store that cannot delete single entries is cleared instead.
+func DeleteCache(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	store := currentCacheStore()
+	deleter, ok := store.(interface{ Delete(string) error })
+	if !ok {
+		return ClearCache()
+	}
+	for _, key := range keys {
+		if err := deleter.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete cache entry %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// cacheHit wraps a cached value so the VM can branch on a hit even when the
+// value itself is falsy
+type cacheHit struct {
+	value interface{}
+}
+
+// cacheGet implements the lookup half of a compiled @cache: a cacheHit, or
+// nil on a miss
+func cacheGet(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("@cache lookup requires a key")
+	}
+	key := fmt.Sprint(args[0])
+	value, ok, err := currentCacheStore().Get(key)
+	if err != nil {
+		// A store outage degrades to recomputing the value
+		cacheCounters.errors.Add(1)
+	}
+	if err != nil || !ok {
+		cacheCounters.misses.Add(1)
+		return nil, nil
+	}
+	cacheCounters.hits.Add(1)
+	return cacheHit{value}, nil
+}
+
+// cacheValue unwraps a cacheHit
+func cacheValue(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("@cache value requires one argument")
+	}
+	if hit, ok := args[0].(cacheHit); ok {
+		return hit.value, nil
+	}
+	return args[0], nil
+}
+
+// cacheSet implements @cache(ttl, value[, key]): value is stored under key
+// for ttl and returned. Without a key there is nothing to look up later, so
+// the value is returned as is; compiled expressions key on a hash of the
+// value's source text and skip evaluating it on a hit.
+func cacheSet(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("@cache requires a TTL, a value and an optional key")
+	}
+	ttl, err := cacheTTL(args[0])
+	if err != nil {
+		return nil, err
+	}
+	value := args[1]
+	if len(args) == 3 {
+		// A failed write only costs a recompute next time
+		if err := currentCacheStore().Set(fmt.Sprint(args[2]), value, ttl); err != nil {
+			cacheCounters.errors.Add(1)
+		} else {
+			cacheCounters.sets.Add(1)
+		}
+	}
+	return value, nil
+}
+
+// cacheTTL reads "5m"-style durations, or a number of seconds
+func cacheTTL(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case string:
+		if seconds, err := strconv.Atoi(v); err == nil {
+			return time.Duration(seconds) * time.Second, nil
+		}
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid @cache TTL %q", v)
+		}
+		return ttl, nil
+	}
+	return 0, fmt.Errorf("invalid @cache TTL %v", value)
+}
+
+// memoryCache is the default CacheStore
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: make(map[string]memoryEntry)}
+}
+
+func (m *memoryCache) Get(key string) (interface{}, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (m *memoryCache) Set(key string, value interface{}, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	m.entries[key] = entry
+	return nil
+}
+
+// Len counts the entries that have not expired
+func (m *memoryCache) Len() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for key, entry := range m.entries {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			delete(m.entries, key)
+		}
+	}
+	return len(m.entries), nil
+}
+
+// Delete drops the entry under key
+func (m *memoryCache) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// Clear drops every entry
+func (m *memoryCache) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]memoryEntry)
+	return nil
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/cron"
+)
+
+// CronNext executes @cron_next operator: @cron_next(expr, from, timezone)
+// returns the next time, in RFC 3339, that a cron expression runs after
+// from (default now), evaluated in timezone (default local)
+func (dto *DateTimeOperator) CronNext(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args) > 3 {
+		return nil, fmt.Errorf("@cron_next requires an expression, and an optional start time and timezone")
+	}
+	schedule, err := cron.Parse(fmt.Sprint(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	zone := ""
+	if len(args) == 3 {
+		zone = fmt.Sprint(args[2])
+	}
+	loc, err := location(zone)
+	if err != nil {
+		return nil, err
+	}
+	from := time.Now()
+	if len(args) >= 2 && fmt.Sprint(args[1]) != "" {
+		if from, err = parseTime(fmt.Sprint(args[1]), loc); err != nil {
+			return nil, err
+		}
+	}
+
+	next := schedule.Next(from.In(loc))
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron expression %q never runs", args[0])
+	}
+	return next.Format(time.RFC3339), nil
+}
@@ -0,0 +1,237 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxRandomLength caps the strings @random generates
+const maxRandomLength = 4096
+
+// hashes are the algorithms of @hash and @hmac
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// charsets are the named character sets of @random; any other charset
+// argument is used as the characters themselves
+var charsets = map[string]string{
+	"alphanumeric": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"alpha":        "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"lower":        "abcdefghijklmnopqrstuvwxyz",
+	"upper":        "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"numeric":      "0123456789",
+	"hex":          "0123456789abcdef",
+	"urlsafe":      "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_",
+	"symbols":      "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!@#$%^&*()-_=+[]{}<>?",
+}
+
+// CryptoOperator handles hashing, signing, encoding and random values
+type CryptoOperator struct{}
+
+// NewCryptoOperator creates a new crypto operator
+func NewCryptoOperator() *CryptoOperator {
+	return &CryptoOperator{}
+}
+
+// Hash executes @hash operator: @hash(algorithm, data, encoding), where the
+// algorithm is md5, sha1, sha256, sha384 or sha512 and the digest is hex
+// (the default) or base64
+func (co *CryptoOperator) Hash(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("@hash requires an algorithm, data and an optional encoding")
+	}
+	newHash, err := hashAlgorithm(args[0])
+	if err != nil {
+		return nil, err
+	}
+	h := newHash()
+	h.Write([]byte(fmt.Sprint(args[1])))
+	return encodeDigest(h.Sum(nil), args[2:])
+}
+
+// HMAC executes @hmac operator: @hmac(algorithm, key, data, encoding)
+func (co *CryptoOperator) HMAC(args ...interface{}) (interface{}, error) {
+	if len(args) < 3 || len(args) > 4 {
+		return nil, fmt.Errorf("@hmac requires an algorithm, key, data and an optional encoding")
+	}
+	newHash, err := hashAlgorithm(args[0])
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(newHash, []byte(fmt.Sprint(args[1])))
+	mac.Write([]byte(fmt.Sprint(args[2])))
+	return encodeDigest(mac.Sum(nil), args[3:])
+}
+
+func hashAlgorithm(arg interface{}) (func() hash.Hash, error) {
+	algorithm := strings.ToLower(fmt.Sprint(arg))
+	newHash, ok := hashes[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash algorithm: %s", algorithm)
+	}
+	return newHash, nil
+}
+
+func encodeDigest(sum []byte, args []interface{}) (interface{}, error) {
+	encoding := "hex"
+	if len(args) > 0 {
+		encoding = strings.ToLower(fmt.Sprint(args[0]))
+	}
+	switch encoding {
+	case "hex":
+		return hex.EncodeToString(sum), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(sum), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(sum), nil
+	default:
+		return nil, fmt.Errorf("unknown digest encoding: %s", encoding)
+	}
+}
+
+// Base64 executes @base64 operator: @base64(action, data) with encode,
+// decode, encodeurl or decodeurl
+func (co *CryptoOperator) Base64(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("@base64 requires an action and data")
+	}
+	action, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("@base64 action must be string")
+	}
+	data := fmt.Sprint(args[1])
+
+	switch strings.ToLower(action) {
+	case "encode":
+		return base64.StdEncoding.EncodeToString([]byte(data)), nil
+	case "decode":
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64: %v", err)
+		}
+		return string(decoded), nil
+	case "encodeurl":
+		return base64.URLEncoding.EncodeToString([]byte(data)), nil
+	case "decodeurl":
+		// Tokens often drop the padding
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64url: %v", err)
+		}
+		return string(decoded), nil
+	default:
+		return nil, fmt.Errorf("unknown base64 action: %s", action)
+	}
+}
+
+// Hex executes @hex operator: @hex(action, data) with encode or decode
+func (co *CryptoOperator) Hex(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("@hex requires an action and data")
+	}
+	action, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("@hex action must be string")
+	}
+	data := fmt.Sprint(args[1])
+
+	switch strings.ToLower(action) {
+	case "encode":
+		return hex.EncodeToString([]byte(data)), nil
+	case "decode":
+		decoded, err := hex.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex: %v", err)
+		}
+		return string(decoded), nil
+	default:
+		return nil, fmt.Errorf("unknown hex action: %s", action)
+	}
+}
+
+// UUID executes @uuid operator: @uuid(version) with v4 (the default), v7,
+// v1 or nil
+func (co *CryptoOperator) UUID(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return uuid.New().String(), nil
+	}
+	version, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("@uuid version must be string")
+	}
+
+	var id uuid.UUID
+	var err error
+	switch strings.ToLower(version) {
+	case "v4":
+		id, err = uuid.NewRandom()
+	case "v7":
+		id, err = uuid.NewV7()
+	case "v1":
+		id, err = uuid.NewUUID()
+	case "nil":
+		id = uuid.Nil
+	default:
+		return nil, fmt.Errorf("unknown UUID version: %s", version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate UUID: %w", err)
+	}
+	return id.String(), nil
+}
+
+// Random executes @random operator: @random(length, charset) returns a
+// cryptographically secure random string. charset is alphanumeric (the
+// default), alpha, lower, upper, numeric, hex, urlsafe, symbols, or the
+// characters to draw from.
+func (co *CryptoOperator) Random(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("@random requires a length and an optional charset")
+	}
+	length, err := strconv.Atoi(fmt.Sprint(args[0]))
+	if err != nil || length < 1 || length > maxRandomLength {
+		return nil, fmt.Errorf("@random length must be between 1 and %d, got %v", maxRandomLength, args[0])
+	}
+	charset := charsets["alphanumeric"]
+	if len(args) == 2 {
+		name := fmt.Sprint(args[1])
+		if named, ok := charsets[strings.ToLower(name)]; ok {
+			charset = named
+		} else {
+			charset = name
+		}
+	}
+	chars := []rune(charset)
+	if len(chars) < 2 {
+		return nil, fmt.Errorf("@random charset needs at least 2 characters")
+	}
+
+	limit := big.NewInt(int64(len(chars)))
+	out := make([]rune, length)
+	for i := range out {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate random string: %w", err)
+		}
+		out[i] = chars[n.Int64()]
+	}
+	return string(out), nil
+}
@@ -233,7 +233,7 @@ func (dto *DateTimeOperator) Timezone(args ...interface{}) (interface{}, error)
 		return time.Now().In(loc).Format("2006-01-02 15:04:05 MST"), nil
 	}
 	
-	if len(args) == 2 {
+	if len(args) == 2 || len(args) == 3 {
 		dateStr, ok := args[0].(string)
 		if !ok {
 			return nil, fmt.Errorf("@timezone date must be string")
@@ -244,14 +244,18 @@ func (dto *DateTimeOperator) Timezone(args ...interface{}) (interface{}, error)
 			return nil, fmt.Errorf("@timezone zone must be string")
 		}
 		
-		// Parse the date string
-		parsed, err := time.Parse("2006-01-02 15:04:05", dateStr)
-		if err != nil {
-			parsed, err = time.Parse("2006-01-02", dateStr)
-			if err != nil {
-				return nil, fmt.Errorf("invalid date format: %v", err)
+		// The date is in UTC unless a source zone is given
+		from := time.UTC
+		if len(args) == 3 {
+			var err error
+			if from, err = location(fmt.Sprint(args[2])); err != nil {
+				return nil, err
 			}
 		}
+		parsed, err := parseTime(dateStr, from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date format: %v", err)
+		}
 		
 		loc, err := time.LoadLocation(zone)
 		if err != nil {
@@ -261,7 +265,7 @@ func (dto *DateTimeOperator) Timezone(args ...interface{}) (interface{}, error)
 		return parsed.In(loc).Format("2006-01-02 15:04:05 MST"), nil
 	}
 	
-	return nil, fmt.Errorf("@timezone requires 0, 1, or 2 arguments")
+	return nil, fmt.Errorf("@timezone requires 0 to 3 arguments")
 }
 
 // AddDays adds days to a date
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the layouts dates and times are parsed with, most
+// specific first
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTime parses a date or date-time in loc, unless it carries an offset
+func parseTime(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse time %q", value)
+}
+
+// location loads a timezone; "" and "Local" are the local zone
+func location(zone string) (*time.Location, error) {
+	if zone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %v", err)
+	}
+	return loc, nil
+}
+
+// durationUnits extends time.ParseDuration with days and weeks
+var durationUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// parseDuration parses "90s", "1h30m", "2d" or "1w2d3h"
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	var total time.Duration
+	rest := value
+	for rest != "" {
+		i := 0
+		for i < len(rest) && (rest[i] >= '0' && rest[i] <= '9' || rest[i] == '.') {
+			i++
+		}
+		j := i
+		for j < len(rest) && (rest[j] < '0' || rest[j] > '9') && rest[j] != '.' {
+			j++
+		}
+		if unit, ok := durationUnits[rest[i:j]]; ok && i > 0 {
+			n, err := strconv.ParseFloat(rest[:i], 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			total += time.Duration(n * float64(unit))
+		} else {
+			d, err := time.ParseDuration(rest[:j])
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			total += d
+		}
+		rest = rest[j:]
+	}
+	return total, nil
+}
+
+// Duration executes @duration operator: @duration("2h + 15m - 30s", unit)
+// adds and subtracts durations. Without a unit it returns a duration
+// string such as "1h44m30s"; with s, ms, m, h or d it returns the number
+// of those units.
+func (dto *DateTimeOperator) Duration(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("@duration requires an expression and an optional unit")
+	}
+	expr := strings.TrimSpace(fmt.Sprint(args[0]))
+	if n, ok := args[0].(int); ok {
+		// Bare numbers are seconds
+		expr = strconv.Itoa(n) + "s"
+	}
+
+	var total time.Duration
+	sign := time.Duration(1)
+	for _, term := range strings.Fields(strings.NewReplacer("+", " + ", "-", " - ").Replace(expr)) {
+		switch term {
+		case "+":
+			sign = 1
+		case "-":
+			sign = -1
+		default:
+			d, err := parseDuration(term)
+			if err != nil {
+				return nil, err
+			}
+			total += sign * d
+			sign = 1
+		}
+	}
+
+	if len(args) == 1 {
+		return total.String(), nil
+	}
+	unit := strings.ToLower(fmt.Sprint(args[1]))
+	var per time.Duration
+	switch unit {
+	case "ns":
+		per = time.Nanosecond
+	case "ms":
+		per = time.Millisecond
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	case "d":
+		per = 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("unknown duration unit: %s", unit)
+	}
+	if total%per == 0 {
+		return int(total / per), nil
+	}
+	return float64(total) / float64(per), nil
+}
+
+// TimeBetween executes @time_between operator: @time_between(start, end,
+// timezone, at) reports whether at (default now) falls in [start, end).
+// start and end are times of day such as "22:00", where a window ending
+// before it starts wraps past midnight, or full dates and times.
+func (dto *DateTimeOperator) TimeBetween(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 4 {
+		return nil, fmt.Errorf("@time_between requires a start, an end, and an optional timezone and time")
+	}
+	zone := ""
+	if len(args) > 2 {
+		zone = fmt.Sprint(args[2])
+	}
+	loc, err := location(zone)
+	if err != nil {
+		return nil, err
+	}
+	at := time.Now().In(loc)
+	if len(args) == 4 {
+		if at, err = parseTime(fmt.Sprint(args[3]), loc); err != nil {
+			return nil, err
+		}
+		at = at.In(loc)
+	}
+
+	start, end := fmt.Sprint(args[0]), fmt.Sprint(args[1])
+	startClock, startIsClock := clockSeconds(start)
+	endClock, endIsClock := clockSeconds(end)
+	if startIsClock != endIsClock {
+		return nil, fmt.Errorf("@time_between start and end must both be times of day or both dates")
+	}
+	if startIsClock {
+		now := at.Hour()*60*60 + at.Minute()*60 + at.Second()
+		if startClock <= endClock {
+			return now >= startClock && now < endClock, nil
+		}
+		return now >= startClock || now < endClock, nil
+	}
+
+	from, err := parseTime(start, loc)
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseTime(end, loc)
+	if err != nil {
+		return nil, err
+	}
+	return !at.Before(from) && at.Before(until), nil
+}
+
+// clockSeconds parses a time of day, "HH:MM" or "HH:MM:SS", into seconds
+// since midnight
+func clockSeconds(value string) (int, bool) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Hour()*60*60 + t.Minute()*60 + t.Second(), true
+		}
+	}
+	return 0, false
+}
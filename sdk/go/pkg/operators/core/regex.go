@@ -0,0 +1,170 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// maxCachedPatterns bounds the compiled pattern cache; configs use a
+// handful of patterns, so evicting arbitrarily when full is enough
+const maxCachedPatterns = 256
+
+// maxPinnedPatterns bounds the patterns PinPattern keeps
+const maxPinnedPatterns = 1024
+
+var (
+	patternsMu sync.RWMutex
+	patterns   = make(map[string]*regexp.Regexp)
+	// pinned patterns are never evicted
+	pinned = make(map[string]*regexp.Regexp)
+)
+
+// compilePattern compiles an RE2 pattern once and reuses it
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patternsMu.RLock()
+	re, ok := pinned[pattern]
+	if !ok {
+		re, ok = patterns[pattern]
+	}
+	patternsMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex pattern: %v", err)
+	}
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	if len(patterns) >= maxCachedPatterns {
+		for cached := range patterns {
+			delete(patterns, cached)
+			break
+		}
+	}
+	patterns[pattern] = re
+	return re, nil
+}
+
+// PinPattern compiles an RE2 pattern ahead of the calls that use it and
+// keeps it out of the eviction of the pattern cache. It reports false when
+// the pattern does not compile or too many are pinned.
+func PinPattern(pattern string) bool {
+	patternsMu.RLock()
+	_, ok := pinned[pattern]
+	patternsMu.RUnlock()
+	if ok {
+		return true
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	if len(pinned) >= maxPinnedPatterns {
+		return false
+	}
+	pinned[pattern] = re
+	return true
+}
+
+// regexArgs compiles the pattern of a @regex.* call and returns the value
+// it applies to
+func regexArgs(operator string, args []interface{}, min, max int) (*regexp.Regexp, string, error) {
+	if len(args) < min || len(args) > max {
+		return nil, "", fmt.Errorf("%s requires %d to %d arguments", operator, min, max)
+	}
+	pattern, ok := args[0].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("%s pattern must be string", operator)
+	}
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return nil, "", err
+	}
+	return re, fmt.Sprint(args[1]), nil
+}
+
+// RegexMatch executes @regex.match operator: whether value matches pattern
+func (so *StringOperator) RegexMatch(args ...interface{}) (interface{}, error) {
+	re, value, err := regexArgs("@regex.match", args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(value), nil
+}
+
+// RegexCapture executes @regex.capture operator: the groups of the first
+// match, as a map when the pattern names them and a list otherwise, or nil
+// without a match
+func (so *StringOperator) RegexCapture(args ...interface{}) (interface{}, error) {
+	re, value, err := regexArgs("@regex.capture", args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	match := re.FindStringSubmatch(value)
+	if match == nil {
+		return nil, nil
+	}
+
+	named := false
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			named = true
+			break
+		}
+	}
+	if !named {
+		groups := make([]interface{}, len(match)-1)
+		for i, group := range match[1:] {
+			groups[i] = group
+		}
+		return groups, nil
+	}
+	groups := make(map[string]interface{})
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		groups[name] = match[i]
+	}
+	return groups, nil
+}
+
+// RegexFindAll executes @regex.find_all operator: every match in value, or
+// the first n of them
+func (so *StringOperator) RegexFindAll(args ...interface{}) (interface{}, error) {
+	re, value, err := regexArgs("@regex.find_all", args, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+	n := -1
+	if len(args) == 3 {
+		if n, err = strconv.Atoi(fmt.Sprint(args[2])); err != nil {
+			return nil, fmt.Errorf("@regex.find_all limit must be a number")
+		}
+	}
+	matches := re.FindAllString(value, n)
+	found := make([]interface{}, len(matches))
+	for i, match := range matches {
+		found[i] = match
+	}
+	return found, nil
+}
+
+// RegexReplace executes @regex.replace operator: value with every match
+// replaced; the replacement can refer to groups as $1 or ${name}
+func (so *StringOperator) RegexReplace(args ...interface{}) (interface{}, error) {
+	re, value, err := regexArgs("@regex.replace", args, 3, 3)
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(value, fmt.Sprint(args[2])), nil
+}
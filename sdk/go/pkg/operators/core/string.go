@@ -2,19 +2,11 @@
 package core
 
 import (
-	"crypto/md5"
-	"crypto/sha1"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"unicode"
-
-	"github.com/google/uuid"
 )
 
 // StringOperator handles string and data operations
@@ -59,9 +51,9 @@ func (so *StringOperator) Regex(args ...interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("@regex text must be string")
 	}
 	
-	regex, err := regexp.Compile(pattern)
+	regex, err := compilePattern(pattern)
 	if err != nil {
-		return nil, fmt.Errorf("invalid regex pattern: %v", err)
+		return nil, err
 	}
 	
 	if len(args) == 2 {
@@ -199,44 +191,6 @@ func (so *StringOperator) extractJSONPath(data interface{}, path string) interfa
 	return current
 }
 
-// Base64 executes @base64 operator
-func (so *StringOperator) Base64(args ...interface{}) (interface{}, error) {
-	if len(args) < 2 {
-		return nil, fmt.Errorf("@base64 requires at least 2 arguments")
-	}
-	
-	action, ok := args[0].(string)
-	if !ok {
-		return nil, fmt.Errorf("@base64 action must be string")
-	}
-	
-	data, ok := args[1].(string)
-	if !ok {
-		return nil, fmt.Errorf("@base64 data must be string")
-	}
-	
-	switch strings.ToLower(action) {
-	case "encode":
-		return base64.StdEncoding.EncodeToString([]byte(data)), nil
-	case "decode":
-		decoded, err := base64.StdEncoding.DecodeString(data)
-		if err != nil {
-			return nil, fmt.Errorf("invalid base64: %v", err)
-		}
-		return string(decoded), nil
-	case "encodeurl":
-		return base64.URLEncoding.EncodeToString([]byte(data)), nil
-	case "decodeurl":
-		decoded, err := base64.URLEncoding.DecodeString(data)
-		if err != nil {
-			return nil, fmt.Errorf("invalid base64url: %v", err)
-		}
-		return string(decoded), nil
-	default:
-		return nil, fmt.Errorf("unknown base64 action: %s", action)
-	}
-}
-
 // URL executes @url operator
 func (so *StringOperator) URL(args ...interface{}) (interface{}, error) {
 	if len(args) < 2 {
@@ -341,60 +295,6 @@ func (so *StringOperator) urlDecodeComponent(s string) string {
 	return result
 }
 
-// Hash executes @hash operator
-func (so *StringOperator) Hash(args ...interface{}) (interface{}, error) {
-	if len(args) < 2 {
-		return nil, fmt.Errorf("@hash requires at least 2 arguments")
-	}
-	
-	algorithm, ok := args[0].(string)
-	if !ok {
-		return nil, fmt.Errorf("@hash algorithm must be string")
-	}
-	
-	data, ok := args[1].(string)
-	if !ok {
-		return nil, fmt.Errorf("@hash data must be string")
-	}
-	
-	switch strings.ToLower(algorithm) {
-	case "md5":
-		hash := md5.Sum([]byte(data))
-		return hex.EncodeToString(hash[:]), nil
-	case "sha1":
-		hash := sha1.Sum([]byte(data))
-		return hex.EncodeToString(hash[:]), nil
-	case "sha256":
-		hash := sha256.Sum256([]byte(data))
-		return hex.EncodeToString(hash[:]), nil
-	default:
-		return nil, fmt.Errorf("unknown hash algorithm: %s", algorithm)
-	}
-}
-
-// UUID executes @uuid operator
-func (so *StringOperator) UUID(args ...interface{}) (interface{}, error) {
-	if len(args) == 0 {
-		return uuid.New().String(), nil
-	}
-	
-	version, ok := args[0].(string)
-	if !ok {
-		return nil, fmt.Errorf("@uuid version must be string")
-	}
-	
-	switch strings.ToLower(version) {
-	case "v4":
-		return uuid.New().String(), nil
-	case "v1":
-		return uuid.New().String(), nil // Simplified - always returns v4
-	case "nil":
-		return uuid.Nil.String(), nil
-	default:
-		return nil, fmt.Errorf("unknown UUID version: %s", version)
-	}
-}
-
 // String utility methods
 func (so *StringOperator) ToUpper(s string) string {
 	return strings.ToUpper(s)
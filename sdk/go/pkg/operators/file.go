@@ -0,0 +1,240 @@
+package operators
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxFileRead caps how much @file.read returns
+const maxFileRead = 10 << 20
+
+// FileSandbox confines the @file operators to a root directory, so a config
+// cannot read files outside it through "..", absolute paths or symlinks.
+// peanut gives each config a sandbox of its own, rooted at the config's
+// directory or at files.root inside it:
+//
+//	[files]
+//	root: "certs"
+type FileSandbox struct {
+	mu   sync.RWMutex
+	root string
+}
+
+// NewFileSandbox confines file access to root
+func NewFileSandbox(root string) *FileSandbox {
+	return &FileSandbox{root: root}
+}
+
+// DefaultFiles is the sandbox behind the @file operators of an
+// OperatorManager, rooted at the working directory
+var DefaultFiles = NewFileSandbox(".")
+
+// Operator returns the @file operator name, such as "file.read", bound to
+// fsb; nil when name is not one
+func (fsb *FileSandbox) Operator(name string) func(args ...interface{}) (interface{}, error) {
+	switch name {
+	case "file.read":
+		return fsb.Read
+	case "file.exists":
+		return fsb.Exists
+	case "file.glob":
+		return fsb.Glob
+	case "file.hash":
+		return fsb.Hash
+	case "file.sha256":
+		return func(args ...interface{}) (interface{}, error) {
+			return fsb.Hash(append(args, "sha256")...)
+		}
+	}
+	return nil
+}
+
+// SetRoot moves the sandbox to root
+func (fsb *FileSandbox) SetRoot(root string) {
+	fsb.mu.Lock()
+	defer fsb.mu.Unlock()
+	fsb.root = root
+}
+
+// Root returns the directory files are confined to
+func (fsb *FileSandbox) Root() string {
+	fsb.mu.RLock()
+	defer fsb.mu.RUnlock()
+	return fsb.root
+}
+
+// resolve maps name to a path inside the root, following symlinks. A
+// missing file resolves with an error wrapping fs.ErrNotExist.
+func (fsb *FileSandbox) resolve(name string) (string, error) {
+	root, err := filepath.Abs(fsb.Root())
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve file root: %w", err)
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+	if !within(root, path) {
+		return "", fmt.Errorf("%s is outside the file root %s", name, root)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve file root: %w", err)
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !within(realRoot, realPath) {
+		return "", fmt.Errorf("%s links outside the file root %s", name, root)
+	}
+	return realPath, nil
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Read returns the contents of a file as a string
+func (fsb *FileSandbox) Read(args ...interface{}) (interface{}, error) {
+	name, err := fileArg(args)
+	if err != nil {
+		return nil, err
+	}
+	path, err := fsb.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxFileRead+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFileRead {
+		return nil, fmt.Errorf("%s is over %d MiB", name, maxFileRead>>20)
+	}
+	return string(data), nil
+}
+
+// Exists reports whether a file or directory exists inside the root
+func (fsb *FileSandbox) Exists(args ...interface{}) (interface{}, error) {
+	name, err := fileArg(args)
+	if err != nil {
+		return nil, err
+	}
+	path, err := fsb.resolve(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(path)
+	return err == nil, nil
+}
+
+// Glob returns the files matching a pattern, relative to the root, sorted
+func (fsb *FileSandbox) Glob(args ...interface{}) (interface{}, error) {
+	pattern, err := fileArg(args)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(fsb.Root())
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(root, pattern)
+	}
+	if !within(root, filepath.Clean(pattern)) {
+		return nil, fmt.Errorf("%s is outside the file root %s", args[0], root)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	files := make([]interface{}, 0, len(matches))
+	for _, match := range matches {
+		// Skip matches that link out of the root
+		if _, err := fsb.resolve(match); err != nil {
+			continue
+		}
+		rel, _ := filepath.Rel(root, match)
+		files = append(files, filepath.ToSlash(rel))
+	}
+	return files, nil
+}
+
+// hashes are the algorithms of @file.hash
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// Hash returns the hex checksum of a file: @file.hash(path, algorithm),
+// where the algorithm is md5, sha1, sha256 (the default) or sha512
+func (fsb *FileSandbox) Hash(args ...interface{}) (interface{}, error) {
+	algorithm := "sha256"
+	if len(args) == 2 {
+		algorithm = strings.ToLower(fmt.Sprint(args[1]))
+		args = args[:1]
+	}
+	newHash, ok := hashes[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown algorithm %q", algorithm)
+	}
+	name, err := fileArg(args)
+	if err != nil {
+		return nil, err
+	}
+	path, err := fsb.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	h := newHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fileArg returns the path argument of a call. Errors leave the operator
+// unnamed, as callers such as the peanut VM prefix it.
+func fileArg(args []interface{}) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("a path is required")
+	}
+	name := fmt.Sprint(args[0])
+	if name == "" {
+		return "", errors.New("a path is required")
+	}
+	return name, nil
+}
@@ -5,7 +5,13 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/cyber-boost/tusktsk/pkg/adaptive"
+	"github.com/cyber-boost/tusktsk/pkg/blobstore"
+	"github.com/cyber-boost/tusktsk/pkg/features"
+	"github.com/cyber-boost/tusktsk/pkg/messaging"
 	"github.com/cyber-boost/tusktsk/pkg/operators/core"
+	"github.com/cyber-boost/tusktsk/pkg/secretstore"
+	"github.com/cyber-boost/tusktsk/pkg/security"
 )
 
 // Operator represents a TuskLang operator
@@ -30,6 +36,7 @@ type CoreOperators struct {
 	Conditional *core.ConditionalOperator
 	Math        *core.MathOperator
 	Array       *core.ArrayOperator
+	Crypto      *core.CryptoOperator
 }
 
 // New creates a new OperatorManager
@@ -43,6 +50,7 @@ func New() *OperatorManager {
 			Conditional: core.NewConditionalOperator(),
 			Math:        core.NewMathOperator(),
 			Array:       core.NewArrayOperator(),
+			Crypto:      core.NewCryptoOperator(),
 		},
 	}
 	om.registerDefaultOperators()
@@ -57,11 +65,15 @@ func (om *OperatorManager) RegisterOperator(op *Operator) {
 	om.operators[op.Symbol] = op
 }
 
-// GetOperator retrieves an operator by name or symbol
+// GetOperator retrieves an operator by name or symbol, falling back to
+// the custom operators added with Register
 func (om *OperatorManager) GetOperator(name string) (*Operator, bool) {
 	om.mutex.RLock()
-	defer om.mutex.RUnlock()
 	op, exists := om.operators[name]
+	om.mutex.RUnlock()
+	if !exists {
+		return customOperator(name)
+	}
 	return op, exists
 }
 
@@ -93,6 +105,72 @@ func (om *OperatorManager) registerDefaultOperators() {
 		},
 	})
 
+	om.RegisterOperator(&Operator{
+		Name:     "secret",
+		Symbol:   "@secret",
+		Function: security.Secret,
+	})
+
+	// Secret store operators, disabled until a config opts in through
+	// secrets.providers
+	for _, name := range []string{"vault", "awssecrets", "gcpsecret"} {
+		name := name
+		om.RegisterOperator(&Operator{
+			Name:   name,
+			Symbol: "@" + name,
+			Function: func(args ...interface{}) (interface{}, error) {
+				return secretstore.Default.Resolve(name, args...)
+			},
+		})
+	}
+
+	// @cache(ttl, value); compiled expressions also call the lookup halves
+	om.RegisterOperator(&Operator{Name: "cache", Symbol: "@cache", Function: cacheSet})
+	om.RegisterOperator(&Operator{Name: "cache.get", Symbol: "@cache.get", Function: cacheGet})
+	om.RegisterOperator(&Operator{Name: "cache.value", Symbol: "@cache.value", Function: cacheValue})
+
+	// @http(method, url, options), disabled until a config allows hosts
+	// through http.allow
+	om.RegisterOperator(&Operator{Name: "http", Symbol: "@http", Function: DefaultHTTP.Do})
+	// @graphql(endpoint, query, variables, options), to graphql.endpoints
+	// or hosts allowed for @http
+	om.RegisterOperator(&Operator{Name: "graphql", Symbol: "@graphql", Function: DefaultGraphQL.Query})
+	// @grpc(service, method, body, options), to services named in
+	// grpc.services
+	om.RegisterOperator(&Operator{Name: "grpc", Symbol: "@grpc", Function: DefaultGRPC.Call})
+	// @s3.get, @gcs.get and @azblob.get("bucket/key"), with credentials
+	// from the environment
+	for _, provider := range []string{blobstore.S3, blobstore.GCS, blobstore.Azure} {
+		om.RegisterOperator(&Operator{Name: provider + ".get", Symbol: "@" + provider + ".get", Function: blobstore.Default.Operator(provider)})
+	}
+
+	// @file.read, @file.exists, @file.glob and @file.hash, confined to the
+	// DefaultFiles root
+	om.RegisterOperator(&Operator{Name: "file.read", Symbol: "@file.read", Function: DefaultFiles.Read})
+	om.RegisterOperator(&Operator{Name: "file.exists", Symbol: "@file.exists", Function: DefaultFiles.Exists})
+	om.RegisterOperator(&Operator{Name: "file.glob", Symbol: "@file.glob", Function: DefaultFiles.Glob})
+	om.RegisterOperator(&Operator{Name: "file.hash", Symbol: "@file.hash", Function: DefaultFiles.Hash})
+	// @jwt.sign, @jwt.verify and @jwt.decode, with keys named in jwt.keys
+	// or passed inline
+	om.RegisterOperator(&Operator{Name: "jwt.sign", Symbol: "@jwt.sign", Function: DefaultJWT.Sign})
+	om.RegisterOperator(&Operator{Name: "jwt.verify", Symbol: "@jwt.verify", Function: DefaultJWT.Verify})
+	om.RegisterOperator(&Operator{Name: "jwt.decode", Symbol: "@jwt.decode", Function: DefaultJWT.Decode})
+	// @feature(name, user), from the [features] section, its provider and
+	// runtime overrides
+	om.RegisterOperator(&Operator{Name: "feature", Symbol: "@feature", Function: features.Default.Evaluate})
+	// @optimize(name, initial) and @learn(name, default), tuned by the
+	// observations the host reports to adaptive.Default
+	om.RegisterOperator(&Operator{Name: "optimize", Symbol: "@optimize", Function: adaptive.Default.Optimize})
+	om.RegisterOperator(&Operator{Name: "learn", Symbol: "@learn", Function: adaptive.Default.Learn})
+	// @metrics(name, value, labels), exported by promhttp.Handler
+	om.RegisterOperator(&Operator{Name: "metrics", Symbol: "@metrics", Function: DefaultMetrics.Record})
+	// @publish(broker, topic, message, key) and @consume_latest(broker,
+	// topic, default), to the Kafka and NATS brokers named in [messaging]
+	om.RegisterOperator(&Operator{Name: "publish", Symbol: "@publish", Function: messaging.Default.Publish})
+	om.RegisterOperator(&Operator{Name: "consume_latest", Symbol: "@consume_latest", Function: messaging.Default.ConsumeLatest})
+
+	om.RegisterOperator(&Operator{Name: "file.sha256", Symbol: "@file.sha256", Function: DefaultFiles.Operator("file.sha256")})
+
 	om.RegisterOperator(&Operator{
 		Name:   "request",
 		Symbol: "@request",
@@ -137,6 +215,9 @@ func (om *OperatorManager) registerDefaultOperators() {
 		Name:   "query",
 		Symbol: "@query",
 		Function: func(args ...interface{}) (interface{}, error) {
+			if target, query, ok := queryTarget(args); ok {
+				return target(query, args[1:]...)
+			}
 			return om.core.Variable.Query(args...)
 		},
 	})
@@ -190,6 +271,30 @@ func (om *OperatorManager) registerDefaultOperators() {
 		},
 	})
 
+	om.RegisterOperator(&Operator{
+		Name:   "duration",
+		Symbol: "@duration",
+		Function: func(args ...interface{}) (interface{}, error) {
+			return om.core.DateTime.Duration(args...)
+		},
+	})
+
+	om.RegisterOperator(&Operator{
+		Name:   "cron_next",
+		Symbol: "@cron_next",
+		Function: func(args ...interface{}) (interface{}, error) {
+			return om.core.DateTime.CronNext(args...)
+		},
+	})
+
+	om.RegisterOperator(&Operator{
+		Name:   "time_between",
+		Symbol: "@time_between",
+		Function: func(args ...interface{}) (interface{}, error) {
+			return om.core.DateTime.TimeBetween(args...)
+		},
+	})
+
 	// String & Data Operators
 	om.RegisterOperator(&Operator{
 		Name:   "string",
@@ -207,6 +312,15 @@ func (om *OperatorManager) registerDefaultOperators() {
 		},
 	})
 
+	for name, function := range map[string]func(...interface{}) (interface{}, error){
+		"regex.match":    om.core.String.RegexMatch,
+		"regex.capture":  om.core.String.RegexCapture,
+		"regex.find_all": om.core.String.RegexFindAll,
+		"regex.replace":  om.core.String.RegexReplace,
+	} {
+		om.RegisterOperator(&Operator{Name: name, Symbol: "@" + name, Function: function})
+	}
+
 	om.RegisterOperator(&Operator{
 		Name:   "json",
 		Symbol: "@json",
@@ -219,7 +333,7 @@ func (om *OperatorManager) registerDefaultOperators() {
 		Name:   "base64",
 		Symbol: "@base64",
 		Function: func(args ...interface{}) (interface{}, error) {
-			return om.core.String.Base64(args...)
+			return om.core.Crypto.Base64(args...)
 		},
 	})
 
@@ -235,7 +349,7 @@ func (om *OperatorManager) registerDefaultOperators() {
 		Name:   "hash",
 		Symbol: "@hash",
 		Function: func(args ...interface{}) (interface{}, error) {
-			return om.core.String.Hash(args...)
+			return om.core.Crypto.Hash(args...)
 		},
 	})
 
@@ -243,7 +357,31 @@ func (om *OperatorManager) registerDefaultOperators() {
 		Name:   "uuid",
 		Symbol: "@uuid",
 		Function: func(args ...interface{}) (interface{}, error) {
-			return om.core.String.UUID(args...)
+			return om.core.Crypto.UUID(args...)
+		},
+	})
+
+	om.RegisterOperator(&Operator{
+		Name:   "hmac",
+		Symbol: "@hmac",
+		Function: func(args ...interface{}) (interface{}, error) {
+			return om.core.Crypto.HMAC(args...)
+		},
+	})
+
+	om.RegisterOperator(&Operator{
+		Name:   "hex",
+		Symbol: "@hex",
+		Function: func(args ...interface{}) (interface{}, error) {
+			return om.core.Crypto.Hex(args...)
+		},
+	})
+
+	om.RegisterOperator(&Operator{
+		Name:   "random",
+		Symbol: "@random",
+		Function: func(args ...interface{}) (interface{}, error) {
+			return om.core.Crypto.Random(args...)
 		},
 	})
 
@@ -556,6 +694,11 @@ func (om *OperatorManager) ListOperators() []string {
 	for name := range om.operators {
 		operators = append(operators, name)
 	}
+	for _, name := range Registered() {
+		if _, shadowed := om.operators[name]; !shadowed {
+			operators = append(operators, name, "@"+name)
+		}
+	}
 	return operators
 }
 
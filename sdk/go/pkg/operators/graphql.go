@@ -0,0 +1,487 @@
+package operators
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// GraphQLEndpoint is a named GraphQL API of the [graphql] section:
+//
+//	[graphql]
+//	endpoints {
+//	    github {
+//	        url: "https://api.github.com/graphql"
+//	        timeout: "5s"
+//	        headers {
+//	            Authorization: @env("GITHUB_TOKEN")
+//	        }
+//	    }
+//	}
+//
+// Named endpoints may be called without listing their host in http.allow.
+type GraphQLEndpoint struct {
+	URL     string
+	Timeout time.Duration
+	Headers map[string]string
+}
+
+// GraphQLEndpointsFrom reads the endpoints of the flat graphql.* keys of a
+// configuration
+func GraphQLEndpointsFrom(values map[string]interface{}) (map[string]GraphQLEndpoint, error) {
+	endpoints := make(map[string]GraphQLEndpoint)
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "graphql.")
+		if !ok {
+			continue
+		}
+		rest, ok := strings.CutPrefix(setting, "endpoints.")
+		if !ok {
+			return nil, fmt.Errorf("unknown setting graphql.%s", setting)
+		}
+		name, field, _ := strings.Cut(rest, ".")
+		endpoint := endpoints[name]
+		if endpoint.Headers == nil {
+			endpoint.Headers = make(map[string]string)
+		}
+		switch {
+		case field == "url":
+			endpoint.URL = fmt.Sprint(value)
+		case field == "timeout":
+			timeout, err := httpDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("graphql.endpoints.%s.timeout: %w", name, err)
+			}
+			endpoint.Timeout = timeout
+		case strings.HasPrefix(field, "headers."):
+			endpoint.Headers[strings.TrimPrefix(field, "headers.")] = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("unknown setting graphql.%s", setting)
+		}
+		endpoints[name] = endpoint
+	}
+	for name, endpoint := range endpoints {
+		u, err := url.Parse(endpoint.URL)
+		if endpoint.URL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("graphql.endpoints.%s: %q is not an http or https URL", name, endpoint.URL)
+		}
+	}
+	return endpoints, nil
+}
+
+// GraphQLClient performs the requests of @graphql over an HTTPClient,
+// whose allowed hosts and headers apply to endpoints given as URLs
+type GraphQLClient struct {
+	mu        sync.RWMutex
+	endpoints map[string]GraphQLEndpoint
+	http      *HTTPClient
+}
+
+// NewGraphQLClient creates a GraphQLClient without named endpoints
+func NewGraphQLClient(http *HTTPClient) *GraphQLClient {
+	return &GraphQLClient{http: http}
+}
+
+// DefaultGraphQL is the client behind @graphql
+var DefaultGraphQL = NewGraphQLClient(DefaultHTTP)
+
+// Configure replaces the named endpoints
+func (c *GraphQLClient) Configure(endpoints map[string]GraphQLEndpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.endpoints = endpoints
+}
+
+func (c *GraphQLClient) endpoint(name string) (GraphQLEndpoint, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	endpoint, ok := c.endpoints[name]
+	return endpoint, ok
+}
+
+// Query runs @graphql(endpoint, query, variables, options). endpoint is a
+// name from graphql.endpoints or a URL allowed by http.allow. variables
+// and options are maps or JSON object strings; options take headers,
+// timeout and path, a dot path into the data. The data must hold every
+// field the query selects, and is returned with integral numbers as ints.
+func (c *GraphQLClient) Query(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 4 {
+		return nil, fmt.Errorf("@graphql: expects an endpoint, a query, and optional variables and options")
+	}
+	name := fmt.Sprint(args[0])
+	query := fmt.Sprint(args[1])
+	selections, err := parseSelections(query)
+	if err != nil {
+		return nil, fmt.Errorf("@graphql %s: invalid query: %w", name, err)
+	}
+
+	body := map[string]interface{}{"query": query}
+	if len(args) > 2 && args[2] != nil && args[2] != "" {
+		variables, err := httpCallOptions(args[2])
+		if err != nil {
+			return nil, fmt.Errorf("@graphql %s: variables: %w", name, err)
+		}
+		body["variables"] = variables
+	}
+	options := map[string]interface{}{}
+	if len(args) > 3 && args[3] != nil {
+		if options, err = httpCallOptions(args[3]); err != nil {
+			return nil, fmt.Errorf("@graphql %s: %w", name, err)
+		}
+	}
+
+	// The request goes through @http's request handling, so headers merge
+	// the same way: http headers, then the endpoint's, then the call's
+	httpOpts := c.http.options()
+	call := map[string]interface{}{"body": body}
+	headers := map[string]interface{}{}
+	endpoint, named := c.endpoint(name)
+	if named {
+		for header, value := range endpoint.Headers {
+			headers[header] = value
+		}
+		if endpoint.Timeout > 0 {
+			call["timeout"] = endpoint.Timeout.String()
+		}
+	}
+	var path string
+	for key, value := range options {
+		switch key {
+		case "headers":
+			callHeaders, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("@graphql %s: headers must be an object", name)
+			}
+			for header, v := range callHeaders {
+				headers[header] = v
+			}
+		case "timeout":
+			call["timeout"] = value
+		case "path":
+			path = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("@graphql %s: unknown option %q", name, key)
+		}
+	}
+	call["headers"] = headers
+
+	target := name
+	if named {
+		target = endpoint.URL
+	}
+	req, err := parseHTTPArgs(httpOpts, []interface{}{"POST", target, call})
+	if err != nil {
+		return nil, fmt.Errorf("@graphql %s: %w", name, err)
+	}
+	if !named && !hostAllowed(httpOpts.Allow, req.url) {
+		return nil, fmt.Errorf("@graphql: host %s is not allowed: add it to http.allow or graphql.endpoints", req.url.Host)
+	}
+	if named {
+		// Redirects stay on the endpoint's host
+		httpOpts.Allow = append(append([]string(nil), httpOpts.Allow...), req.url.Host)
+	}
+
+	raw, err := c.http.send(httpOpts, req)
+	if err != nil {
+		return nil, fmt.Errorf("@graphql %s: %w", name, err)
+	}
+	data, err := graphQLData(raw)
+	if err != nil {
+		return nil, fmt.Errorf("@graphql %s: %w", name, err)
+	}
+	if err := validateSelections(data, selections, ""); err != nil {
+		return nil, fmt.Errorf("@graphql %s: %w", name, err)
+	}
+	if path == "" {
+		return data, nil
+	}
+	value, err := selectPath(data, path)
+	if err != nil {
+		return nil, fmt.Errorf("@graphql %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// graphQLData reads the data of a GraphQL response, failing on its errors
+func graphQLData(raw []byte) (interface{}, error) {
+	response, ok := decodeHTTPBody(raw).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("response is not a GraphQL JSON object")
+	}
+	if errs, ok := response["errors"].([]interface{}); ok && len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		for _, e := range errs {
+			if m, ok := e.(map[string]interface{}); ok && m["message"] != nil {
+				messages = append(messages, fmt.Sprint(m["message"]))
+			} else {
+				messages = append(messages, fmt.Sprint(e))
+			}
+		}
+		return nil, fmt.Errorf("%s", strings.Join(messages, "; "))
+	}
+	data, ok := response["data"]
+	if !ok || data == nil {
+		return nil, fmt.Errorf("response has no data")
+	}
+	return data, nil
+}
+
+// selection is a field of a query's selection set, under its response key
+type selection struct {
+	key string
+	// optional fields are under a type condition or @include/@skip, so
+	// may be absent
+	optional bool
+	fields   []selection
+}
+
+// validateSelections checks value holds every selected field; null values
+// and empty lists are allowed
+func validateSelections(value interface{}, selections []selection, path string) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		for i, item := range v {
+			if err := validateSelections(item, selections, fmt.Sprintf("%s.%d", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		for _, sel := range selections {
+			field, ok := v[sel.key]
+			at := strings.TrimPrefix(path+"."+sel.key, ".")
+			if !ok {
+				if sel.optional {
+					continue
+				}
+				return fmt.Errorf("response is missing %s", at)
+			}
+			if sel.fields != nil {
+				if err := validateSelections(field, sel.fields, at); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if path == "" {
+		return fmt.Errorf("response data is a %T, not an object", value)
+	}
+	return fmt.Errorf("response has a %T at %s, not an object", value, path)
+}
+
+// parseSelections reads the selection set of the first operation of a
+// GraphQL document. Fragment spreads are not followed.
+func parseSelections(query string) ([]selection, error) {
+	p := &selectionParser{tokens: graphQLTokens(query)}
+	for p.pos < len(p.tokens) {
+		if p.peek() == "fragment" {
+			// fragment Name on Type { ... }
+			for p.pos < len(p.tokens) && p.peek() != "{" {
+				p.pos++
+			}
+			if err := p.skipBalanced("{", "}"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Skip the operation type, name, variables and directives
+		for p.pos < len(p.tokens) && p.peek() != "{" {
+			if p.peek() == "(" {
+				if err := p.skipBalanced("(", ")"); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			p.pos++
+		}
+		if p.pos == len(p.tokens) {
+			break
+		}
+		return p.selectionSet(false)
+	}
+	return nil, fmt.Errorf("no operation found")
+}
+
+type selectionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *selectionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *selectionParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// skipBalanced skips from an open token to its matching close token
+func (p *selectionParser) skipBalanced(open, close string) error {
+	depth := 0
+	for p.pos < len(p.tokens) {
+		switch p.next() {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unbalanced %s", open)
+}
+
+// directives skips directives and reports whether one is @include or @skip
+func (p *selectionParser) directives() (bool, error) {
+	conditional := false
+	for p.peek() == "@" {
+		p.pos++
+		switch p.next() {
+		case "include", "skip":
+			conditional = true
+		}
+		if p.peek() == "(" {
+			if err := p.skipBalanced("(", ")"); err != nil {
+				return false, err
+			}
+		}
+	}
+	return conditional, nil
+}
+
+func (p *selectionParser) selectionSet(optional bool) ([]selection, error) {
+	if p.next() != "{" {
+		return nil, fmt.Errorf("expected {")
+	}
+	selections := []selection{}
+	for {
+		token := p.next()
+		switch {
+		case token == "}":
+			return selections, nil
+		case token == "":
+			return nil, fmt.Errorf("unterminated selection set")
+		case token == "...":
+			if p.peek() == "on" {
+				p.pos += 2
+			} else if p.peek() != "{" && p.peek() != "@" {
+				// A fragment spread
+				p.pos++
+				if _, err := p.directives(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if _, err := p.directives(); err != nil {
+				return nil, err
+			}
+			fields, err := p.selectionSet(true)
+			if err != nil {
+				return nil, err
+			}
+			selections = append(selections, fields...)
+		case isGraphQLName(token):
+			sel := selection{key: token, optional: optional}
+			if p.peek() == ":" {
+				// An alias is the response key
+				p.pos += 2
+			}
+			if p.peek() == "(" {
+				if err := p.skipBalanced("(", ")"); err != nil {
+					return nil, err
+				}
+			}
+			conditional, err := p.directives()
+			if err != nil {
+				return nil, err
+			}
+			sel.optional = sel.optional || conditional
+			if p.peek() == "{" {
+				if sel.fields, err = p.selectionSet(false); err != nil {
+					return nil, err
+				}
+			}
+			selections = append(selections, sel)
+		default:
+			return nil, fmt.Errorf("unexpected %q in selection set", token)
+		}
+	}
+}
+
+func isGraphQLName(token string) bool {
+	if token == "" {
+		return false
+	}
+	for i, r := range token {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// graphQLTokens splits a GraphQL document into names, punctuators and
+// literals, dropping whitespace, commas and comments
+func graphQLTokens(query string) []string {
+	var tokens []string
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r) || r == ',' || r == '\uFEFF':
+			i++
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '"':
+			start := i
+			if i+2 < len(runes) && runes[i+1] == '"' && runes[i+2] == '"' {
+				// A block string runs to the next """
+				for i += 3; i < len(runes) && !(runes[i] == '"' && i+2 < len(runes) && runes[i+1] == '"' && runes[i+2] == '"'); i++ {
+				}
+				i += 3
+			} else {
+				for i++; i < len(runes) && runes[i] != '"' && runes[i] != '\n'; i++ {
+					if runes[i] == '\\' {
+						i++
+					}
+				}
+				i++
+			}
+			if i > len(runes) {
+				i = len(runes)
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		case r == '.' && i+2 < len(runes) && runes[i+1] == '.' && runes[i+2] == '.':
+			tokens = append(tokens, "...")
+			i += 3
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i++; i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])); i++ {
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		case r == '-' || unicode.IsDigit(r):
+			start := i
+			for i++; i < len(runes) && (runes[i] == '.' || runes[i] == '+' || runes[i] == '-' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])); i++ {
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,193 @@
+package operators
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cyber-boost/tusktsk/pkg/grpcwire"
+)
+
+// GRPCServicesFrom reads the services of the flat grpc.* keys of a
+// configuration:
+//
+//	[grpc]
+//	services {
+//	    inventory {
+//	        address: "inventory.internal:9090"
+//	        tls: true
+//	        descriptors: "protos/inventory.pb"
+//	        timeout: "3s"
+//	        metadata {
+//	            authorization: @env("INVENTORY_TOKEN")
+//	        }
+//	    }
+//	}
+//
+// Services without descriptors are described by server reflection.
+func GRPCServicesFrom(values map[string]interface{}) (map[string]grpcwire.Options, error) {
+	services := make(map[string]grpcwire.Options)
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "grpc.")
+		if !ok {
+			continue
+		}
+		rest, ok := strings.CutPrefix(setting, "services.")
+		if !ok {
+			return nil, fmt.Errorf("unknown setting grpc.%s", setting)
+		}
+		name, field, _ := strings.Cut(rest, ".")
+		service := services[name]
+		if service.Metadata == nil {
+			service.Metadata = make(map[string]string)
+		}
+		text := fmt.Sprint(value)
+		switch {
+		case field == "address":
+			service.Address = text
+		case field == "tls":
+			enabled, err := strconv.ParseBool(text)
+			if err != nil {
+				return nil, fmt.Errorf("grpc.services.%s.tls: expected true or false, got %v", name, value)
+			}
+			service.TLS = enabled
+		case field == "descriptors":
+			service.Descriptors = text
+		case field == "timeout":
+			timeout, err := httpDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("grpc.services.%s.timeout: %w", name, err)
+			}
+			service.Timeout = timeout
+		case strings.HasPrefix(field, "metadata."):
+			service.Metadata[strings.TrimPrefix(field, "metadata.")] = text
+		default:
+			return nil, fmt.Errorf("unknown setting grpc.%s", setting)
+		}
+		services[name] = service
+	}
+	for name, service := range services {
+		if service.Address == "" || strings.Contains(service.Address, "://") {
+			return nil, fmt.Errorf("grpc.services.%s: address must be host:port, got %q", name, service.Address)
+		}
+	}
+	return services, nil
+}
+
+// GRPCClients performs the calls of @grpc, keeping a client per service
+// so reflection runs once
+type GRPCClients struct {
+	mu       sync.Mutex
+	services map[string]grpcwire.Options
+	clients  map[string]*grpcwire.Client
+}
+
+// NewGRPCClients creates GRPCClients without services
+func NewGRPCClients() *GRPCClients {
+	return &GRPCClients{}
+}
+
+// DefaultGRPC is the client behind @grpc
+var DefaultGRPC = NewGRPCClients()
+
+// Configure replaces the services
+func (g *GRPCClients) Configure(services map[string]grpcwire.Options) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, client := range g.clients {
+		client.Close()
+	}
+	g.services, g.clients = services, nil
+}
+
+func (g *GRPCClients) client(name string) (*grpcwire.Client, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if client, ok := g.clients[name]; ok {
+		return client, nil
+	}
+	opts, ok := g.services[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown service %q: add it to grpc.services", name)
+	}
+	if g.clients == nil {
+		g.clients = make(map[string]*grpcwire.Client)
+	}
+	client := grpcwire.NewClient(opts)
+	g.clients[name] = client
+	return client, nil
+}
+
+// Call runs @grpc(service, method, body, options): a unary call of
+// method, "package.Service/Method", on a service of grpc.services. body is
+// the request as JSON or a map; options take metadata, timeout and path, a
+// dot path into the response. The response is returned decoded from its
+// JSON form, with integral numbers as ints; 64-bit integers stay strings.
+func (g *GRPCClients) Call(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 4 {
+		return nil, fmt.Errorf("@grpc: expects a service, a method, and an optional body and options")
+	}
+	name, method := fmt.Sprint(args[0]), fmt.Sprint(args[1])
+	client, err := g.client(name)
+	if err != nil {
+		return nil, fmt.Errorf("@grpc: %w", err)
+	}
+
+	var body []byte
+	if len(args) > 2 && args[2] != nil {
+		if text, ok := args[2].(string); ok {
+			body = []byte(text)
+		} else if body, err = json.Marshal(args[2]); err != nil {
+			return nil, fmt.Errorf("@grpc %s: body: %w", method, err)
+		}
+	}
+	ctx := context.Background()
+	metadata := make(map[string]string)
+	var path string
+	if len(args) > 3 && args[3] != nil {
+		options, err := httpCallOptions(args[3])
+		if err != nil {
+			return nil, fmt.Errorf("@grpc %s: %w", method, err)
+		}
+		for key, value := range options {
+			switch key {
+			case "metadata":
+				values, ok := value.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("@grpc %s: metadata must be an object", method)
+				}
+				for k, v := range values {
+					metadata[k] = fmt.Sprint(v)
+				}
+			case "timeout":
+				timeout, err := httpDuration(value)
+				if err != nil {
+					return nil, fmt.Errorf("@grpc %s: timeout: %w", method, err)
+				}
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			case "path":
+				path = fmt.Sprint(value)
+			default:
+				return nil, fmt.Errorf("@grpc %s: unknown option %q", method, key)
+			}
+		}
+	}
+
+	out, err := client.Invoke(ctx, method, body, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("@grpc %s %s: %w", name, method, err)
+	}
+	value := decodeHTTPBody(out)
+	if path == "" {
+		return value, nil
+	}
+	if value, err = selectPath(value, path); err != nil {
+		return nil, fmt.Errorf("@grpc %s %s: %w", name, method, err)
+	}
+	return value, nil
+}
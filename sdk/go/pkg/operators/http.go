@@ -0,0 +1,483 @@
+package operators
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the @http operator
+const (
+	DefaultHTTPTimeout = 10 * time.Second
+	DefaultHTTPBackoff = 200 * time.Millisecond
+	// maxHTTPBody caps how much of a response is read
+	maxHTTPBody = 10 << 20
+)
+
+// HTTPOptions configure @http. Requests are refused unless their host is
+// allowed, so configuration cannot reach arbitrary services:
+//
+//	[http]
+//	allow: ["config.internal", "*.svc.cluster.local"]
+//	timeout: "5s"
+//	retries: 2
+//	headers {
+//	    User-Agent: "tusktsk"
+//	}
+//	hosts {
+//	    config {
+//	        match: "config.internal"
+//	        headers {
+//	            Authorization: @env("CONFIG_TOKEN")
+//	        }
+//	    }
+//	}
+type HTTPOptions struct {
+	// Allow lists host patterns: "host", "host:port" or "*.domain"
+	Allow   []string
+	Timeout time.Duration
+	// Retries is how many times idempotent requests are retried after a
+	// network error, 429 or 5xx response, with Backoff doubling between
+	Retries int
+	Backoff time.Duration
+	// Headers are sent with every request
+	Headers map[string]string
+	// HostHeaders are sent to hosts matching their pattern
+	HostHeaders map[string]map[string]string
+}
+
+// HTTPOptionsFrom reads HTTPOptions from the flat http.* keys of a
+// configuration. Hosts with headers are allowed too.
+func HTTPOptionsFrom(values map[string]interface{}) (HTTPOptions, error) {
+	opts := HTTPOptions{Headers: make(map[string]string), HostHeaders: make(map[string]map[string]string)}
+	hostMatch := make(map[string]string)
+	hostHeaders := make(map[string]map[string]string)
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "http.")
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		switch {
+		case setting == "allow":
+			switch v := value.(type) {
+			case string:
+				opts.Allow = append(opts.Allow, v)
+			case []interface{}:
+				for _, item := range v {
+					opts.Allow = append(opts.Allow, fmt.Sprint(item))
+				}
+			default:
+				return opts, fmt.Errorf("http.allow: expected a string or array, got %v", value)
+			}
+		case setting == "timeout":
+			timeout, err := httpDuration(value)
+			if err != nil {
+				return opts, fmt.Errorf("http.timeout: %w", err)
+			}
+			opts.Timeout = timeout
+		case setting == "backoff":
+			backoff, err := httpDuration(value)
+			if err != nil {
+				return opts, fmt.Errorf("http.backoff: %w", err)
+			}
+			opts.Backoff = backoff
+		case setting == "retries":
+			retries, err := strconv.Atoi(text)
+			if err != nil || retries < 0 {
+				return opts, fmt.Errorf("http.retries: %q is not a count", text)
+			}
+			opts.Retries = retries
+		case strings.HasPrefix(setting, "headers."):
+			opts.Headers[strings.TrimPrefix(setting, "headers.")] = text
+		case strings.HasPrefix(setting, "hosts."):
+			name, rest, _ := strings.Cut(strings.TrimPrefix(setting, "hosts."), ".")
+			switch {
+			case rest == "match":
+				hostMatch[name] = text
+			case strings.HasPrefix(rest, "headers."):
+				if hostHeaders[name] == nil {
+					hostHeaders[name] = make(map[string]string)
+				}
+				hostHeaders[name][strings.TrimPrefix(rest, "headers.")] = text
+			default:
+				return opts, fmt.Errorf("unknown setting http.%s", setting)
+			}
+		default:
+			return opts, fmt.Errorf("unknown setting http.%s", setting)
+		}
+	}
+	for name, headers := range hostHeaders {
+		pattern, ok := hostMatch[name]
+		if !ok {
+			return opts, fmt.Errorf("http.hosts.%s: headers without a match pattern", name)
+		}
+		opts.HostHeaders[pattern] = headers
+	}
+	for _, pattern := range hostMatch {
+		if !containsString(opts.Allow, pattern) {
+			opts.Allow = append(opts.Allow, pattern)
+		}
+	}
+	sort.Strings(opts.Allow)
+	return opts, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// httpDuration reads a duration string or a number of seconds
+func httpDuration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	}
+	text := fmt.Sprint(value)
+	if seconds, err := strconv.Atoi(text); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a duration", text)
+	}
+	return d, nil
+}
+
+// HTTPClient performs the requests of @http
+type HTTPClient struct {
+	mu     sync.RWMutex
+	opts   HTTPOptions
+	client *http.Client
+	sleep  func(time.Duration)
+}
+
+// NewHTTPClient creates an HTTPClient that allows no hosts
+func NewHTTPClient() *HTTPClient {
+	c := &HTTPClient{sleep: time.Sleep}
+	c.client = &http.Client{CheckRedirect: c.checkRedirect}
+	return c
+}
+
+// DefaultHTTP is the client behind @http
+var DefaultHTTP = NewHTTPClient()
+
+// Configure replaces the options
+func (c *HTTPClient) Configure(opts HTTPOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opts = opts
+}
+
+func (c *HTTPClient) options() HTTPOptions {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.opts
+}
+
+// checkRedirect keeps redirects on allowed hosts
+func (c *HTTPClient) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if !hostAllowed(c.options().Allow, req.URL) {
+		return fmt.Errorf("redirect to %s is not allowed: add it to http.allow", req.URL.Host)
+	}
+	return nil
+}
+
+// hostAllowed matches u against host patterns
+func hostAllowed(patterns []string, u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	hostPort := host
+	if u.Port() != "" {
+		hostPort = net.JoinHostPort(host, u.Port())
+	}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		switch {
+		case strings.HasPrefix(pattern, "*."):
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		case pattern == host || pattern == hostPort:
+			return true
+		}
+	}
+	return false
+}
+
+// httpRequest is one @http call
+type httpRequest struct {
+	method  string
+	url     *url.URL
+	headers map[string]string
+	body    []byte
+	// path selects a value of a JSON response, such as "data.items.0"
+	path    string
+	timeout time.Duration
+	retries int
+}
+
+// Do runs @http(method, url, options). options is a map, or a JSON object
+// string, with headers, body (a string, or a value sent as JSON), path
+// (a dot path into the JSON response), timeout and retries. JSON responses
+// are decoded; others are returned as text.
+func (c *HTTPClient) Do(args ...interface{}) (interface{}, error) {
+	opts := c.options()
+	req, err := parseHTTPArgs(opts, args)
+	if err != nil {
+		return nil, fmt.Errorf("@http: %w", err)
+	}
+	if !hostAllowed(opts.Allow, req.url) {
+		return nil, fmt.Errorf("@http: host %s is not allowed: add it to http.allow", req.url.Host)
+	}
+
+	body, err := c.send(opts, req)
+	if err != nil {
+		return nil, fmt.Errorf("@http %s %s: %w", req.method, req.url.Redacted(), err)
+	}
+	value := decodeHTTPBody(body)
+	if req.path == "" {
+		return value, nil
+	}
+	value, err = selectPath(value, req.path)
+	if err != nil {
+		return nil, fmt.Errorf("@http %s %s: %w", req.method, req.url.Redacted(), err)
+	}
+	return value, nil
+}
+
+func parseHTTPArgs(opts HTTPOptions, args []interface{}) (*httpRequest, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("expects a method, a URL and optional options")
+	}
+	req := &httpRequest{
+		method:  strings.ToUpper(fmt.Sprint(args[0])),
+		headers: make(map[string]string),
+		timeout: opts.Timeout,
+		retries: opts.Retries,
+	}
+	if req.timeout <= 0 {
+		req.timeout = DefaultHTTPTimeout
+	}
+	u, err := url.Parse(fmt.Sprint(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%q is not an http or https URL", args[1])
+	}
+	req.url = u
+
+	// Configured headers first, so per-call headers win
+	for name, value := range opts.Headers {
+		req.headers[name] = value
+	}
+	for pattern, headers := range opts.HostHeaders {
+		if hostAllowed([]string{pattern}, u) {
+			for name, value := range headers {
+				req.headers[name] = value
+			}
+		}
+	}
+
+	if len(args) < 3 || args[2] == nil {
+		return req, nil
+	}
+	options, err := httpCallOptions(args[2])
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range options {
+		switch key {
+		case "headers":
+			headers, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("headers must be an object")
+			}
+			for name, v := range headers {
+				req.headers[name] = fmt.Sprint(v)
+			}
+		case "body":
+			if text, ok := value.(string); ok {
+				req.body = []byte(text)
+				break
+			}
+			if req.body, err = json.Marshal(value); err != nil {
+				return nil, fmt.Errorf("body: %w", err)
+			}
+			if _, set := req.headers["Content-Type"]; !set {
+				req.headers["Content-Type"] = "application/json"
+			}
+		case "path":
+			req.path = fmt.Sprint(value)
+		case "timeout":
+			if req.timeout, err = httpDuration(value); err != nil {
+				return nil, fmt.Errorf("timeout: %w", err)
+			}
+		case "retries":
+			if req.retries, err = strconv.Atoi(fmt.Sprint(value)); err != nil || req.retries < 0 {
+				return nil, fmt.Errorf("retries: %v is not a count", value)
+			}
+		default:
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return req, nil
+}
+
+// httpCallOptions reads the options argument: a map or a JSON object
+func httpCallOptions(arg interface{}) (map[string]interface{}, error) {
+	switch v := arg.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case string:
+		var options map[string]interface{}
+		if err := json.Unmarshal([]byte(v), &options); err != nil {
+			return nil, fmt.Errorf("options must be a JSON object: %w", err)
+		}
+		return options, nil
+	}
+	return nil, fmt.Errorf("options must be an object, got %T", arg)
+}
+
+// send performs req, retrying idempotent methods on network errors, 429
+// and 5xx responses
+func (c *HTTPClient) send(opts HTTPOptions, req *httpRequest) ([]byte, error) {
+	retries := req.retries
+	switch req.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+	default:
+		retries = 0
+	}
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = DefaultHTTPBackoff
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			c.sleep(backoff << (attempt - 1))
+		}
+		body, retry, err := c.attempt(req)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+	if retries > 0 {
+		return nil, fmt.Errorf("giving up after %d retries: %w", retries, lastErr)
+	}
+	return nil, lastErr
+}
+
+// attempt performs req once and reports whether a failure is worth retrying
+func (c *HTTPClient) attempt(req *httpRequest) ([]byte, bool, error) {
+	httpReq, err := http.NewRequest(req.method, req.url.String(), bytes.NewReader(req.body))
+	if err != nil {
+		return nil, false, err
+	}
+	for name, value := range req.headers {
+		httpReq.Header.Set(name, value)
+	}
+	if httpReq.Header.Get("Accept") == "" {
+		httpReq.Header.Set("Accept", "application/json, text/plain;q=0.9, */*;q=0.8")
+	}
+
+	client := *c.client
+	client.Timeout = req.timeout
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBody))
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("%s", resp.Status)
+	}
+	return body, false, nil
+}
+
+// decodeHTTPBody decodes a JSON body, with integral numbers as ints; other
+// bodies are returned as text
+func decodeHTTPBody(body []byte) interface{} {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return ""
+	}
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return string(body)
+	}
+	return normalizeJSON(value)
+}
+
+func normalizeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := strconv.Atoi(v.String()); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeJSON(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = normalizeJSON(v[key])
+		}
+	}
+	return value
+}
+
+// selectPath follows a dot path such as "data.items.0.name"
+func selectPath(value interface{}, path string) (interface{}, error) {
+	for _, part := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[part]
+			if !ok {
+				return nil, fmt.Errorf("response has no %q in path %s", part, path)
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("response has no index %q in path %s", part, path)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("path %s goes past a %T at %q", path, value, part)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,298 @@
+package operators
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// JWTKey is a named key of the [jwt] section. Secret is an HMAC secret;
+// PrivateKey and PublicKey are PEM-encoded RSA or ECDSA keys, of which
+// signing needs the private one:
+//
+//	[jwt]
+//	keys {
+//	    api {
+//	        secret: @env("API_JWT_SECRET")
+//	        algorithm: "HS512"
+//	    }
+//	    sso {
+//	        public_key: @file.read("keys/sso.pub.pem")
+//	    }
+//	}
+type JWTKey struct {
+	Secret     string
+	PrivateKey string
+	PublicKey  string
+	// Algorithm pins the signing method; by default it follows the key
+	Algorithm string
+}
+
+// JWTKeysFrom reads the jwt.keys.<name>.* keys of a configuration
+func JWTKeysFrom(values map[string]interface{}) (map[string]JWTKey, error) {
+	keys := make(map[string]JWTKey)
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "jwt.keys.")
+		if !ok {
+			if strings.HasPrefix(key, "jwt.") {
+				return nil, fmt.Errorf("unknown setting %s", key)
+			}
+			continue
+		}
+		name, field, _ := strings.Cut(setting, ".")
+		k := keys[name]
+		text := fmt.Sprint(value)
+		switch field {
+		case "secret":
+			k.Secret = text
+		case "private_key":
+			k.PrivateKey = text
+		case "public_key":
+			k.PublicKey = text
+		case "algorithm":
+			if jwt.GetSigningMethod(text) == nil {
+				return nil, fmt.Errorf("jwt.keys.%s.algorithm: unknown algorithm %q", name, text)
+			}
+			k.Algorithm = text
+		default:
+			return nil, fmt.Errorf("unknown setting jwt.keys.%s", setting)
+		}
+		keys[name] = k
+	}
+	for name, k := range keys {
+		if k.Secret == "" && k.PrivateKey == "" && k.PublicKey == "" {
+			return nil, fmt.Errorf("jwt.keys.%s needs a secret, private_key or public_key", name)
+		}
+	}
+	return keys, nil
+}
+
+// JWTKeys holds the named keys of the @jwt operators
+type JWTKeys struct {
+	mu   sync.RWMutex
+	keys map[string]JWTKey
+	now  func() time.Time
+}
+
+// NewJWTKeys creates an empty key ring; keys can still be passed inline
+func NewJWTKeys() *JWTKeys {
+	return &JWTKeys{keys: make(map[string]JWTKey), now: time.Now}
+}
+
+// DefaultJWT is the key ring behind the @jwt operators
+var DefaultJWT = NewJWTKeys()
+
+// Configure replaces the named keys
+func (jk *JWTKeys) Configure(keys map[string]JWTKey) {
+	jk.mu.Lock()
+	defer jk.mu.Unlock()
+	jk.keys = keys
+}
+
+// key looks up a named key; other values are inline keys: PEM text or an
+// HMAC secret
+func (jk *JWTKeys) key(arg interface{}) JWTKey {
+	text := fmt.Sprint(arg)
+	jk.mu.RLock()
+	k, ok := jk.keys[text]
+	jk.mu.RUnlock()
+	if ok {
+		return k
+	}
+	switch {
+	case strings.Contains(text, "PRIVATE KEY-----"):
+		return JWTKey{PrivateKey: text}
+	case strings.Contains(text, "-----BEGIN"):
+		return JWTKey{PublicKey: text}
+	}
+	return JWTKey{Secret: text}
+}
+
+// signingKey returns the key and method tokens are signed with
+func (k JWTKey) signingKey() (interface{}, jwt.SigningMethod, error) {
+	switch {
+	case k.Secret != "":
+		return []byte(k.Secret), k.method(jwt.SigningMethodHS256), nil
+	case k.PrivateKey != "":
+		if key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(k.PrivateKey)); err == nil {
+			return key, k.method(jwt.SigningMethodRS256), nil
+		}
+		key, err := jwt.ParseECPrivateKeyFromPEM([]byte(k.PrivateKey))
+		if err != nil {
+			return nil, nil, fmt.Errorf("private key is neither RSA nor ECDSA")
+		}
+		return key, k.method(ecMethod(key.Params().BitSize)), nil
+	}
+	return nil, nil, fmt.Errorf("signing needs a secret or private key")
+}
+
+// verifyingKey returns the key tokens are verified with and the method
+// family they must be signed with
+func (k JWTKey) verifyingKey() (interface{}, func(jwt.SigningMethod) bool, error) {
+	switch {
+	case k.Secret != "":
+		return []byte(k.Secret), k.family(func(m jwt.SigningMethod) bool {
+			_, ok := m.(*jwt.SigningMethodHMAC)
+			return ok
+		}), nil
+	case k.PublicKey != "":
+		if key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(k.PublicKey)); err == nil {
+			return key, k.family(isRSA), nil
+		}
+		key, err := jwt.ParseECPublicKeyFromPEM([]byte(k.PublicKey))
+		if err != nil {
+			return nil, nil, fmt.Errorf("public key is neither RSA nor ECDSA")
+		}
+		return key, k.family(isECDSA), nil
+	case k.PrivateKey != "":
+		private, _, err := k.signingKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch key := private.(type) {
+		case *rsa.PrivateKey:
+			return &key.PublicKey, k.family(isRSA), nil
+		case *ecdsa.PrivateKey:
+			return &key.PublicKey, k.family(isECDSA), nil
+		}
+	}
+	return nil, nil, fmt.Errorf("verifying needs a secret or key")
+}
+
+func (k JWTKey) method(fallback jwt.SigningMethod) jwt.SigningMethod {
+	if k.Algorithm != "" {
+		return jwt.GetSigningMethod(k.Algorithm)
+	}
+	return fallback
+}
+
+// family accepts methods of the key's type, or only the pinned algorithm
+func (k JWTKey) family(accept func(jwt.SigningMethod) bool) func(jwt.SigningMethod) bool {
+	if k.Algorithm != "" {
+		return func(m jwt.SigningMethod) bool { return m.Alg() == k.Algorithm }
+	}
+	return accept
+}
+
+func isRSA(m jwt.SigningMethod) bool {
+	switch m.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		return true
+	}
+	return false
+}
+
+func isECDSA(m jwt.SigningMethod) bool {
+	_, ok := m.(*jwt.SigningMethodECDSA)
+	return ok
+}
+
+func ecMethod(bits int) jwt.SigningMethod {
+	switch bits {
+	case 384:
+		return jwt.SigningMethodES384
+	case 521:
+		return jwt.SigningMethodES512
+	}
+	return jwt.SigningMethodES256
+}
+
+// Sign returns a token for @jwt.sign(claims, key). claims is a map or a
+// JSON object; exp, nbf and iat given as durations such as "1h" are
+// relative to now.
+func (jk *JWTKeys) Sign(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("@jwt.sign requires claims and a key")
+	}
+	claims, err := jwtClaims(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("@jwt.sign: %w", err)
+	}
+	for _, name := range []string{"exp", "nbf", "iat"} {
+		if text, ok := claims[name].(string); ok {
+			d, err := time.ParseDuration(text)
+			if err != nil {
+				return nil, fmt.Errorf("@jwt.sign: %s: %q is not a duration", name, text)
+			}
+			claims[name] = jk.now().Add(d).Unix()
+		}
+	}
+	key, method, err := jk.key(args[1]).signingKey()
+	if err != nil {
+		return nil, fmt.Errorf("@jwt.sign: %w", err)
+	}
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		return nil, fmt.Errorf("@jwt.sign: %w", err)
+	}
+	return token, nil
+}
+
+func jwtClaims(arg interface{}) (jwt.MapClaims, error) {
+	switch v := arg.(type) {
+	case map[string]interface{}:
+		claims := make(jwt.MapClaims, len(v))
+		for name, value := range v {
+			claims[name] = value
+		}
+		return claims, nil
+	case string:
+		var claims jwt.MapClaims
+		if err := json.Unmarshal([]byte(v), &claims); err != nil {
+			return nil, fmt.Errorf("claims must be a JSON object: %w", err)
+		}
+		return claims, nil
+	}
+	return nil, fmt.Errorf("claims must be an object, got %T", arg)
+}
+
+// Verify returns the claims of @jwt.verify(token, key) once the signature,
+// exp and nbf check out
+func (jk *JWTKeys) Verify(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("@jwt.verify requires a token and a key")
+	}
+	key, accept, err := jk.key(args[1]).verifyingKey()
+	if err != nil {
+		return nil, fmt.Errorf("@jwt.verify: %w", err)
+	}
+	claims := jwt.MapClaims{}
+	// Times are checked below against jk.now rather than jwt.TimeFunc
+	parser := &jwt.Parser{UseJSONNumber: true, SkipClaimsValidation: true}
+	_, err = parser.ParseWithClaims(fmt.Sprint(args[0]), claims, func(token *jwt.Token) (interface{}, error) {
+		if !accept(token.Method) {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("@jwt.verify: %w", err)
+	}
+	now := jk.now().Unix()
+	if !claims.VerifyExpiresAt(now, false) {
+		return nil, fmt.Errorf("@jwt.verify: token is expired")
+	}
+	if !claims.VerifyNotBefore(now, false) {
+		return nil, fmt.Errorf("@jwt.verify: token is not valid yet")
+	}
+	return normalizeJSON(map[string]interface{}(claims)), nil
+}
+
+// Decode returns the claims of @jwt.decode(token) without verifying it
+func (jk *JWTKeys) Decode(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("@jwt.decode requires a token")
+	}
+	claims := jwt.MapClaims{}
+	parser := &jwt.Parser{UseJSONNumber: true}
+	if _, _, err := parser.ParseUnverified(fmt.Sprint(args[0]), claims); err != nil {
+		return nil, fmt.Errorf("@jwt.decode: %w", err)
+	}
+	return normalizeJSON(map[string]interface{}(claims)), nil
+}
@@ -0,0 +1,269 @@
+package operators
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kinds of MetricDef
+const (
+	MetricCounter   = "counter"
+	MetricGauge     = "gauge"
+	MetricHistogram = "histogram"
+)
+
+// MetricDef declares a metric that @metrics records
+type MetricDef struct {
+	Type    string
+	Help    string
+	Labels  []string
+	Buckets []float64
+}
+
+// MetricDefsFrom reads the metrics.<name>.type, help, labels and buckets
+// keys of a configuration
+func MetricDefsFrom(values map[string]interface{}) (map[string]MetricDef, error) {
+	defs := make(map[string]MetricDef)
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "metrics.")
+		if !ok {
+			continue
+		}
+		name, field, ok := strings.Cut(setting, ".")
+		if !ok {
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+		def := defs[name]
+		switch field {
+		case "type":
+			def.Type = strings.ToLower(fmt.Sprint(value))
+			if def.Type != MetricCounter && def.Type != MetricGauge && def.Type != MetricHistogram {
+				return nil, fmt.Errorf("%s: unknown metric type %q", key, value)
+			}
+		case "help":
+			def.Help = fmt.Sprint(value)
+		case "labels":
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: expected an array, got %v", key, value)
+			}
+			for _, item := range items {
+				def.Labels = append(def.Labels, fmt.Sprint(item))
+			}
+		case "buckets":
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: expected an array, got %v", key, value)
+			}
+			for _, item := range items {
+				bucket, err := metricValue(item)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", key, err)
+				}
+				def.Buckets = append(def.Buckets, bucket)
+			}
+		default:
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+		defs[name] = def
+	}
+	for name, def := range defs {
+		if def.Type == "" {
+			return nil, fmt.Errorf("metrics.%s needs a type", name)
+		}
+		if len(def.Buckets) > 0 && def.Type != MetricHistogram {
+			return nil, fmt.Errorf("metrics.%s: only histograms have buckets", name)
+		}
+	}
+	return defs, nil
+}
+
+// Metrics is the process-wide registry behind @metrics. Metrics a config
+// does not declare are created on first use: counters when the name ends
+// in _total, gauges otherwise.
+type Metrics struct {
+	mu         sync.Mutex
+	registerer prometheus.Registerer
+	defs       map[string]MetricDef
+	metrics    map[string]*metric
+}
+
+// metric is one registered collector and the definition it was built from
+type metric struct {
+	def       MetricDef
+	collector prometheus.Collector
+}
+
+// NewMetrics creates a registry that registers its collectors with
+// registerer
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	return &Metrics{
+		registerer: registerer,
+		defs:       make(map[string]MetricDef),
+		metrics:    make(map[string]*metric),
+	}
+}
+
+// DefaultMetrics backs @metrics. It registers with Prometheus' default
+// registry, which promhttp.Handler serves.
+var DefaultMetrics = NewMetrics(prometheus.DefaultRegisterer)
+
+// Configure replaces the declared metrics. A registered metric whose
+// definition changed is registered again, losing its value.
+func (m *Metrics) Configure(defs map[string]MetricDef) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, existing := range m.metrics {
+		if def, ok := defs[name]; ok && !reflect.DeepEqual(def, existing.def) {
+			m.registerer.Unregister(existing.collector)
+			delete(m.metrics, name)
+		}
+	}
+	m.defs = defs
+}
+
+// Record executes @metrics operator: @metrics(name, value, labels) adds
+// value (default 1) to a counter, sets a gauge or observes a histogram,
+// and returns value. labels is a map or a JSON object of label values.
+func (m *Metrics) Record(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args) > 3 {
+		return nil, fmt.Errorf("@metrics requires a name, and an optional value and labels")
+	}
+	name := fmt.Sprint(args[0])
+	var value interface{} = 1
+	if len(args) >= 2 {
+		value = args[1]
+	}
+	n, err := metricValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("@metrics %s: %w", name, err)
+	}
+	labels := make(map[string]string)
+	if len(args) == 3 {
+		if labels, err = metricLabels(args[2]); err != nil {
+			return nil, fmt.Errorf("@metrics %s: %w", name, err)
+		}
+	}
+
+	met, err := m.metric(name, labels)
+	if err != nil {
+		return nil, err
+	}
+	switch c := met.collector.(type) {
+	case *prometheus.CounterVec:
+		if n < 0 {
+			return nil, fmt.Errorf("@metrics %s: counters cannot decrease", name)
+		}
+		counter, err := c.GetMetricWith(labels)
+		if err != nil {
+			return nil, fmt.Errorf("@metrics %s: %w", name, err)
+		}
+		counter.Add(n)
+	case *prometheus.GaugeVec:
+		gauge, err := c.GetMetricWith(labels)
+		if err != nil {
+			return nil, fmt.Errorf("@metrics %s: %w", name, err)
+		}
+		gauge.Set(n)
+	case *prometheus.HistogramVec:
+		histogram, err := c.GetMetricWith(labels)
+		if err != nil {
+			return nil, fmt.Errorf("@metrics %s: %w", name, err)
+		}
+		histogram.Observe(n)
+	}
+	return value, nil
+}
+
+// metric returns the collector for name, registering it on first use.
+// Undeclared metrics take their label names from the first call.
+func (m *Metrics) metric(name string, labels map[string]string) (*metric, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if met, ok := m.metrics[name]; ok {
+		return met, nil
+	}
+
+	def, declared := m.defs[name]
+	if !declared {
+		def.Type = MetricGauge
+		if strings.HasSuffix(name, "_total") {
+			def.Type = MetricCounter
+		}
+		for label := range labels {
+			def.Labels = append(def.Labels, label)
+		}
+		sort.Strings(def.Labels)
+	}
+	help := def.Help
+	if help == "" {
+		help = "Recorded by @metrics"
+	}
+
+	var collector prometheus.Collector
+	switch def.Type {
+	case MetricCounter:
+		collector = prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, def.Labels)
+	case MetricGauge:
+		collector = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, def.Labels)
+	case MetricHistogram:
+		collector = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: def.Buckets}, def.Labels)
+	}
+	if err := m.registerer.Register(collector); err != nil {
+		var already prometheus.AlreadyRegisteredError
+		if !errors.As(err, &already) || reflect.TypeOf(already.ExistingCollector) != reflect.TypeOf(collector) {
+			return nil, fmt.Errorf("failed to register metric %s: %w", name, err)
+		}
+		// Registered by an earlier registry, such as before a reload
+		collector = already.ExistingCollector
+	}
+	met := &metric{def: def, collector: collector}
+	m.metrics[name] = met
+	return met, nil
+}
+
+// metricValue reads a number, or a string holding one
+func metricValue(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("%v is not a number", value)
+}
+
+// metricLabels reads label values from a map or a JSON object
+func metricLabels(value interface{}) (map[string]string, error) {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		text, isString := value.(string)
+		if !isString || json.Unmarshal([]byte(text), &fields) != nil {
+			return nil, fmt.Errorf("labels must be an object, got %v", value)
+		}
+	}
+	labels := make(map[string]string, len(fields))
+	for name, v := range fields {
+		labels[name] = fmt.Sprint(v)
+	}
+	return labels, nil
+}
@@ -1,8 +1,25 @@
 package operators
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestOperatorManager(t *testing.T) {
@@ -47,6 +64,492 @@ func TestVariableOperators(t *testing.T) {
 	fmt.Printf("✅ Variable operators working\n")
 }
 
+func TestQueryTargets(t *testing.T) {
+	om := New()
+	RegisterQueryTarget("fake", func(query string, args ...interface{}) (interface{}, error) {
+		return fmt.Sprintf("%s %v", query, args), nil
+	})
+	defer RegisterQueryTarget("fake", nil)
+
+	result, err := om.ExecuteOperator("@query", "fake:users", "{active: true}")
+	if err != nil {
+		t.Errorf("@query target failed: %v", err)
+	}
+	if result != "users [{active: true}]" {
+		t.Errorf("Expected the target to receive the query, got %v", result)
+	}
+
+	// Unregistered prefixes keep the request parameter behaviour
+	result, err = om.ExecuteOperator("@query", "other:key", "value")
+	if err != nil || result != "value" {
+		t.Errorf("Expected @query to set a parameter, got %v, %v", result, err)
+	}
+}
+
+func TestHTTPOptionsFrom(t *testing.T) {
+	opts, err := HTTPOptionsFrom(map[string]interface{}{
+		"http.allow":                              []interface{}{"api.example.com", "*.svc.local"},
+		"http.timeout":                            "2s",
+		"http.retries":                            3,
+		"http.headers.User-Agent":                 "tusktsk",
+		"http.hosts.config.match":                 "config.internal:8443",
+		"http.hosts.config.headers.Authorization": "Bearer token",
+	})
+	if err != nil {
+		t.Fatalf("HTTPOptionsFrom() returned error: %v", err)
+	}
+	if opts.Timeout != 2*time.Second || opts.Retries != 3 || opts.Headers["User-Agent"] != "tusktsk" {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+	if opts.HostHeaders["config.internal:8443"]["Authorization"] != "Bearer token" {
+		t.Errorf("Expected host headers, got %+v", opts.HostHeaders)
+	}
+	if strings.Join(opts.Allow, ",") != "*.svc.local,api.example.com,config.internal:8443" {
+		t.Errorf("Expected configured hosts to be allowed, got %v", opts.Allow)
+	}
+	if _, err := HTTPOptionsFrom(map[string]interface{}{"http.retry": 1}); err == nil {
+		t.Error("Expected an unknown setting to be rejected")
+	}
+
+	for host, want := range map[string]bool{
+		"https://api.example.com/v1":        true,
+		"https://a.b.svc.local/":            true,
+		"https://svc.local/":                false,
+		"https://config.internal:8443":      true,
+		"https://config.internal/":          false,
+		"https://evil.com/?api.example.com": false,
+	} {
+		u, _ := url.Parse(host)
+		if got := hostAllowed(opts.Allow, u); got != want {
+			t.Errorf("hostAllowed(%s) = %v; want %v", host, got, want)
+		}
+	}
+}
+
+func TestHTTPOperator(t *testing.T) {
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"ok": true}`)
+		case "/config":
+			if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("X-Env") != "test" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"data": {"limits": [{"max": 100}, {"max": 2.5}]}}`)
+		case "/echo":
+			body := new(strings.Builder)
+			fmt.Fprint(body, r.Method, " ")
+			buf := make([]byte, 64)
+			n, _ := r.Body.Read(buf)
+			body.Write(buf[:n])
+			fmt.Fprint(w, body.String())
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	client := NewHTTPClient()
+	var slept []time.Duration
+	client.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	if _, err := client.Do("GET", server.URL+"/config"); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected hosts to be refused until allowed, got %v", err)
+	}
+
+	client.Configure(HTTPOptions{
+		Allow:       []string{host},
+		Retries:     2,
+		Backoff:     10 * time.Millisecond,
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+		HostHeaders: map[string]map[string]string{"127.0.0.1": {"X-Env": "test"}},
+	})
+
+	result, err := client.Do("GET", server.URL+"/flaky")
+	if err != nil {
+		t.Fatalf("Expected retries to recover, got %v", err)
+	}
+	if ok := result.(map[string]interface{})["ok"]; ok != true || len(slept) != 2 || slept[1] != 20*time.Millisecond {
+		t.Errorf("Expected two retries with backoff, got %v after %v", result, slept)
+	}
+
+	result, err = client.Do("GET", server.URL+"/config", `{"path": "data.limits.0.max"}`)
+	if err != nil || result != 100 {
+		t.Errorf("Expected the JSON path value 100, got %v (%T), %v", result, result, err)
+	}
+	result, _ = client.Do("GET", server.URL+"/config", map[string]interface{}{"path": "data.limits.1.max"})
+	if result != 2.5 {
+		t.Errorf("Expected 2.5, got %v", result)
+	}
+	if _, err := client.Do("GET", server.URL+"/config", `{"path": "data.missing"}`); err == nil {
+		t.Error("Expected a missing path to fail")
+	}
+
+	result, err = client.Do("post", server.URL+"/echo", map[string]interface{}{"body": map[string]interface{}{"a": 1}})
+	if err != nil || result != `POST {"a":1}` {
+		t.Errorf("Expected a JSON body to be sent, got %v, %v", result, err)
+	}
+
+	// POST is not retried
+	failures, slept = 1, nil
+	if _, err := client.Do("POST", server.URL+"/flaky"); err == nil || len(slept) != 0 {
+		t.Errorf("Expected POST to fail without retries, got %v after %v", err, slept)
+	}
+
+	if _, err := client.Do("GET", server.URL+"/slow", `{"timeout": "50ms", "retries": 0}`); err == nil {
+		t.Error("Expected the timeout to fail the request")
+	}
+	if _, err := client.Do("GET", "file:///etc/passwd"); err == nil {
+		t.Error("Expected non-HTTP URLs to be refused")
+	}
+
+	// The registered operator goes through DefaultHTTP
+	DefaultHTTP.Configure(HTTPOptions{Allow: []string{host}})
+	defer DefaultHTTP.Configure(HTTPOptions{})
+	result, err = New().ExecuteOperator("@http", "GET", server.URL+"/echo")
+	if err != nil || result != "GET " {
+		t.Errorf("@http returned %v, %v", result, err)
+	}
+}
+
+func TestGraphQLOperator(t *testing.T) {
+	var got struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		switch r.URL.Path {
+		case "/graphql":
+			fmt.Fprint(w, `{"data": {"repo": {"name": "tusktsk", "stars": 42, "topics": [{"name": "config"}], "owner": null}}}`)
+		case "/partial":
+			fmt.Fprint(w, `{"data": {"repo": {"name": "tusktsk"}}}`)
+		case "/errors":
+			fmt.Fprint(w, `{"data": null, "errors": [{"message": "Bad credentials"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	endpoints, err := GraphQLEndpointsFrom(map[string]interface{}{
+		"graphql.endpoints.github.url":                   server.URL + "/graphql",
+		"graphql.endpoints.github.timeout":               "2s",
+		"graphql.endpoints.github.headers.Authorization": "Bearer gh",
+		"graphql.endpoints.partial.url":                  server.URL + "/partial",
+		"graphql.endpoints.errors.url":                   server.URL + "/errors",
+	})
+	if err != nil {
+		t.Fatalf("GraphQLEndpointsFrom() returned error: %v", err)
+	}
+	if endpoints["github"].Timeout != 2*time.Second || endpoints["github"].Headers["Authorization"] != "Bearer gh" {
+		t.Errorf("GraphQLEndpointsFrom() = %+v", endpoints["github"])
+	}
+	for _, values := range []map[string]interface{}{
+		{"graphql.endpoints.github.url": "ftp://example.com"},
+		{"graphql.endpoints.github.token": "x"},
+		{"graphql.url": "https://example.com/graphql"},
+	} {
+		if _, err := GraphQLEndpointsFrom(values); err == nil {
+			t.Errorf("GraphQLEndpointsFrom(%v) should fail", values)
+		}
+	}
+
+	client := NewGraphQLClient(NewHTTPClient())
+	client.Configure(endpoints)
+	query := `# Repository details
+query Repo($name: String!) {
+  repo(name: $name) {
+    name
+    stars: stargazerCount
+    topics(first: 5) { name }
+    owner { login }
+    ... on Fork { parent { name } }
+    license @include(if: false) { key }
+  }
+}`
+	result, err := client.Query("github", query, `{"name": "tusktsk"}`)
+	if err != nil {
+		t.Fatalf("Query() returned error: %v", err)
+	}
+	repo := result.(map[string]interface{})["repo"].(map[string]interface{})
+	if repo["stars"] != 42 || got.Variables["name"] != "tusktsk" || got.Query != query || auth != "Bearer gh" {
+		t.Errorf("Query() = %v, sent %+v with Authorization %q", result, got, auth)
+	}
+	result, err = client.Query("github", query, nil, map[string]interface{}{"path": "repo.topics.0.name", "headers": map[string]interface{}{"Authorization": "Bearer call"}})
+	if err != nil || result != "config" || auth != "Bearer call" {
+		t.Errorf("Query() with path = %v, %v (Authorization %q)", result, err, auth)
+	}
+
+	if _, err := client.Query("partial", query, nil); err == nil || !strings.Contains(err.Error(), "missing repo.stars") {
+		t.Errorf("Expected a response without selected fields to fail, got %v", err)
+	}
+	if _, err := client.Query("errors", "{ viewer { login } }"); err == nil || !strings.Contains(err.Error(), "Bad credentials") {
+		t.Errorf("Expected GraphQL errors to fail, got %v", err)
+	}
+	if _, err := client.Query(server.URL+"/graphql", "{ repo { name } }"); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected URLs outside http.allow to be refused, got %v", err)
+	}
+	if _, err := client.Query("github", "{ repo { name }"); err == nil {
+		t.Error("Expected an unterminated query to fail")
+	}
+}
+
+func TestGRPCServicesFrom(t *testing.T) {
+	services, err := GRPCServicesFrom(map[string]interface{}{
+		"grpc.services.inventory.address":                "inventory.internal:9090",
+		"grpc.services.inventory.tls":                    true,
+		"grpc.services.inventory.descriptors":            "protos/inventory.pb",
+		"grpc.services.inventory.timeout":                "3s",
+		"grpc.services.inventory.metadata.authorization": "Bearer token",
+		"grpc.services.pricing.address":                  "localhost:50051",
+	})
+	if err != nil {
+		t.Fatalf("GRPCServicesFrom() returned error: %v", err)
+	}
+	inventory := services["inventory"]
+	if !inventory.TLS || inventory.Descriptors != "protos/inventory.pb" || inventory.Timeout != 3*time.Second ||
+		inventory.Metadata["authorization"] != "Bearer token" || services["pricing"].Address != "localhost:50051" {
+		t.Errorf("GRPCServicesFrom() = %+v", services)
+	}
+	for _, values := range []map[string]interface{}{
+		{"grpc.services.inventory.address": "https://inventory.internal"},
+		{"grpc.services.inventory.tls": true},
+		{"grpc.services.inventory.address": "inventory:9090", "grpc.services.inventory.proto": "x.proto"},
+		{"grpc.address": "inventory:9090"},
+	} {
+		if _, err := GRPCServicesFrom(values); err == nil {
+			t.Errorf("GRPCServicesFrom(%v) should fail", values)
+		}
+	}
+
+	clients := NewGRPCClients()
+	clients.Configure(services)
+	if _, err := clients.Call("billing", "billing.v1.Billing/Get", "{}"); err == nil || !strings.Contains(err.Error(), "unknown service") {
+		t.Errorf("Expected services outside grpc.services to be refused, got %v", err)
+	}
+}
+
+func TestFileOperators(t *testing.T) {
+	outside := t.TempDir()
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	os.MkdirAll(filepath.Join(root, "conf.d"), 0755)
+	os.WriteFile(filepath.Join(root, "conf.d", "a.tsk"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(root, "conf.d", "b.tsk"), []byte("b"), 0644)
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "conf.d", "c.tsk")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	files := NewFileSandbox(root)
+	if got, err := files.Read("conf.d/a.tsk"); err != nil || got != "a" {
+		t.Errorf("Read() = %v, %v; want a", got, err)
+	}
+	if got, _ := files.Exists("conf.d/b.tsk"); got != true {
+		t.Error("Expected conf.d/b.tsk to exist")
+	}
+	if got, err := files.Exists("missing.tsk"); err != nil || got != false {
+		t.Errorf("Exists(missing) = %v, %v", got, err)
+	}
+	if got, err := files.Glob("conf.d/*.tsk"); err != nil || !reflect.DeepEqual(got, []interface{}{"conf.d/a.tsk", "conf.d/b.tsk"}) {
+		t.Errorf("Glob() = %v, %v; want the files inside the root", got, err)
+	}
+	if got, err := files.Hash("conf.d/a.tsk", "md5"); err != nil || got != "0cc175b9c0f1b6a831c399e269772661" {
+		t.Errorf("Hash(md5) = %v, %v", got, err)
+	}
+	if _, err := files.Hash("conf.d/a.tsk", "crc"); err == nil {
+		t.Error("Expected an unknown algorithm to fail")
+	}
+
+	for _, name := range []string{"../" + filepath.Base(outside) + "/secret.txt", filepath.Join(outside, "secret.txt"), "conf.d/c.tsk"} {
+		if got, err := files.Read(name); err == nil {
+			t.Errorf("Read(%s) escaped the root: %v", name, got)
+		}
+	}
+	if _, err := files.Glob("../*"); err == nil {
+		t.Error("Expected a glob outside the root to fail")
+	}
+	if got, err := files.Read(filepath.Join(root, "conf.d", "b.tsk")); err != nil || got != "b" {
+		t.Errorf("Absolute paths inside the root should read, got %v, %v", got, err)
+	}
+}
+
+func TestJWTOperators(t *testing.T) {
+	keys := NewJWTKeys()
+	now := time.Unix(1700000000, 0)
+	keys.now = func() time.Time { return now }
+
+	token, err := keys.Sign(`{"sub": "svc", "exp": "1h", "scope": ["read"]}`, "s3cret")
+	if err != nil {
+		t.Fatalf("Sign() returned error: %v", err)
+	}
+	claims, err := keys.Verify(token, "s3cret")
+	want := map[string]interface{}{"sub": "svc", "exp": 1700003600, "scope": []interface{}{"read"}}
+	if err != nil || !reflect.DeepEqual(claims, want) {
+		t.Errorf("Verify() = %v, %v; want %v", claims, err, want)
+	}
+	if _, err := keys.Verify(token, "other"); err == nil {
+		t.Error("Expected a token signed with another secret to fail")
+	}
+	if claims, err := keys.Decode(token); err != nil || claims.(map[string]interface{})["sub"] != "svc" {
+		t.Errorf("Decode() = %v, %v", claims, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := keys.Verify(token, "s3cret"); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Expected an expired token to fail, got %v", err)
+	}
+
+	// ECDSA keys, named in the config
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, _ := x509.MarshalECPrivateKey(private)
+	publicDER, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	privatePEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateDER}))
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	named, err := JWTKeysFrom(map[string]interface{}{
+		"jwt.keys.issuer.private_key": privatePEM,
+		"jwt.keys.sso.public_key":     publicPEM,
+		"jwt.keys.api.secret":         "s3cret",
+		"jwt.keys.api.algorithm":      "HS512",
+	})
+	if err != nil {
+		t.Fatalf("JWTKeysFrom() returned error: %v", err)
+	}
+	keys.Configure(named)
+
+	token, err = keys.Sign(map[string]interface{}{"sub": "sso"}, "issuer")
+	if err != nil {
+		t.Fatalf("Sign(ES256) returned error: %v", err)
+	}
+	if claims, err := keys.Verify(token, "sso"); err != nil || claims.(map[string]interface{})["sub"] != "sso" {
+		t.Errorf("Verify(ES256) = %v, %v", claims, err)
+	}
+	if claims, err := keys.Verify(token, publicPEM); err != nil || claims.(map[string]interface{})["sub"] != "sso" {
+		t.Errorf("Verify() with an inline key = %v, %v", claims, err)
+	}
+
+	// A token signed with the public key as an HMAC secret must not verify
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "admin"}).SignedString([]byte(publicPEM))
+	if _, err := keys.Verify(forged, "sso"); err == nil || !strings.Contains(err.Error(), "signing method") {
+		t.Error("Expected an HMAC token to fail against an ECDSA key")
+	}
+
+	// A pinned algorithm rejects the others of its family
+	hs256, _ := NewJWTKeys().Sign(`{"sub": "svc"}`, "s3cret")
+	if _, err := keys.Verify(hs256, "api"); err == nil {
+		t.Error("Expected HS256 to fail against a key pinned to HS512")
+	}
+
+	if _, err := JWTKeysFrom(map[string]interface{}{"jwt.keys.api.algorithm": "HS999"}); err == nil {
+		t.Error("Expected an unknown algorithm to be rejected")
+	}
+}
+
+func TestMetricsOperator(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := NewMetrics(registry)
+	defs, err := MetricDefsFrom(map[string]interface{}{
+		"metrics.jobs_total.type":   "counter",
+		"metrics.jobs_total.labels": []interface{}{"queue"},
+		"metrics.latency.type":      "histogram",
+		"metrics.latency.buckets":   []interface{}{0.1, 1},
+	})
+	if err != nil {
+		t.Fatalf("MetricDefsFrom() returned error: %v", err)
+	}
+	metrics.Configure(defs)
+
+	for _, args := range [][]interface{}{
+		{"jobs_total", 2, `{"queue": "mail"}`},
+		{"jobs_total", 1, map[string]interface{}{"queue": "mail"}},
+		{"latency", 0.5},
+		{"workers", "4"},
+		{"workers", 3},
+	} {
+		if _, err := metrics.Record(args...); err != nil {
+			t.Fatalf("Record(%v) returned error: %v", args, err)
+		}
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]float64)
+	for _, family := range families {
+		m := family.GetMetric()[0]
+		switch {
+		case m.Counter != nil:
+			got[family.GetName()] = m.GetCounter().GetValue()
+		case m.Gauge != nil:
+			got[family.GetName()] = m.GetGauge().GetValue()
+		case m.Histogram != nil:
+			got[family.GetName()] = m.GetHistogram().GetSampleSum()
+		}
+	}
+	if want := map[string]float64{"jobs_total": 3, "latency": 0.5, "workers": 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gathered %v, want %v", got, want)
+	}
+
+	if _, err := metrics.Record("jobs_total", -1, `{"queue": "mail"}`); err == nil {
+		t.Error("Expected a counter to refuse a negative value")
+	}
+	if _, err := metrics.Record("jobs_total", 1); err == nil {
+		t.Error("Expected missing labels to be rejected")
+	}
+	if _, err := MetricDefsFrom(map[string]interface{}{"metrics.x.type": "summary"}); err == nil {
+		t.Error("Expected an unknown metric type to be rejected")
+	}
+}
+
+func TestRegisterOperators(t *testing.T) {
+	before := New()
+	double := func(args ...interface{}) (interface{}, error) {
+		return args[0].(int) * 2, nil
+	}
+	if err := Register("acme.double", double); err != nil {
+		t.Fatalf("Register() returned error: %v", err)
+	}
+	for _, om := range []*OperatorManager{before, New()} {
+		if got, err := om.ExecuteOperator("@acme.double", 21); err != nil || got != 42 {
+			t.Errorf("@acme.double(21) = %v, %v; want 42", got, err)
+		}
+	}
+	listed := false
+	for _, name := range New().ListOperators() {
+		listed = listed || name == "acme.double"
+	}
+	if !listed {
+		t.Error("ListOperators() should include registered operators")
+	}
+
+	for _, name := range []string{"acme.double", "env", "@file.copy", "jwt.refresh", "9lives", "acme.tsk.get", "acme..op"} {
+		if err := Register(name, double); err == nil {
+			t.Errorf("Register(%q) should fail", name)
+		}
+	}
+
+	if names, err := LoadPlugins(t.TempDir()); err != nil || len(names) != 0 {
+		t.Errorf("LoadPlugins() of an empty directory = %v, %v", names, err)
+	}
+	if _, err := LoadPlugins(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected LoadPlugins() to fail for a missing directory")
+	}
+}
+
 func TestDateTimeOperators(t *testing.T) {
 	om := New()
 	
@@ -89,6 +592,47 @@ func TestDateTimeOperators(t *testing.T) {
 	fmt.Printf("✅ DateTime operators working\n")
 }
 
+func TestDurationOperators(t *testing.T) {
+	om := New()
+
+	tests := []struct {
+		operator string
+		args     []interface{}
+		want     interface{}
+	}{
+		{"@duration", []interface{}{"15m + 2h"}, "2h15m0s"},
+		{"@duration", []interface{}{"1d - 30m", "h"}, 23.5},
+		{"@duration", []interface{}{"1w2d", "d"}, 9},
+		{"@duration", []interface{}{"1500ms", "s"}, 1.5},
+		{"@duration", []interface{}{90, "m"}, 1.5},
+		// Mondays at 02:30
+		{"@cron_next", []interface{}{"30 2 * * MON", "2024-03-06 12:00", "UTC"}, "2024-03-11T02:30:00Z"},
+		{"@cron_next", []interface{}{"*/15 9-17 * * 1-5", "2024-03-08 17:50", "UTC"}, "2024-03-11T09:00:00Z"},
+		{"@cron_next", []interface{}{"0 0 29 2 *", "2024-03-01", "UTC"}, "2028-02-29T00:00:00Z"},
+		{"@cron_next", []interface{}{"@monthly", "2024-12-15 08:00", "Europe/Berlin"}, "2025-01-01T00:00:00+01:00"},
+		// Either day field matches when both are restricted
+		{"@cron_next", []interface{}{"0 12 13 * FRI", "2024-09-01", "UTC"}, "2024-09-06T12:00:00Z"},
+		{"@time_between", []interface{}{"22:00", "02:00", "UTC", "2024-03-08 23:30"}, true},
+		{"@time_between", []interface{}{"22:00", "02:00", "UTC", "2024-03-08 02:00"}, false},
+		{"@time_between", []interface{}{"09:00", "17:00", "America/New_York", "2024-03-08T15:00:00Z"}, true},
+		{"@time_between", []interface{}{"09:00", "17:00", "America/New_York", "2024-03-08T23:00:00Z"}, false},
+		{"@time_between", []interface{}{"2024-12-24", "2024-12-27", "UTC", "2024-12-25 10:00"}, true},
+		{"@timezone", []interface{}{"2024-07-01 09:00", "UTC", "America/New_York"}, "2024-07-01 13:00:00 UTC"},
+	}
+	for _, tt := range tests {
+		result, err := om.ExecuteOperator(tt.operator, tt.args...)
+		if err != nil || result != tt.want {
+			t.Errorf("%s%q = %v, %v; want %v", tt.operator, tt.args, result, err, tt.want)
+		}
+	}
+
+	for _, args := range [][]interface{}{{"@duration", "5x"}, {"@cron_next", "61 * * * *"}, {"@cron_next", "0 0 30 2 *"}, {"@time_between", "09:00", "2024-01-01"}} {
+		if _, err := om.ExecuteOperator(args[0].(string), args[1:]...); err == nil {
+			t.Errorf("Expected %v to fail", args)
+		}
+	}
+}
+
 func TestStringOperators(t *testing.T) {
 	om := New()
 	
@@ -149,6 +693,93 @@ func TestStringOperators(t *testing.T) {
 	fmt.Printf("✅ String operators working\n")
 }
 
+func TestRegexOperators(t *testing.T) {
+	om := New()
+
+	tests := []struct {
+		operator string
+		args     []interface{}
+		want     interface{}
+	}{
+		{"@regex.match", []interface{}{`^v\d+\.\d+$`, "v1.22"}, true},
+		{"@regex.match", []interface{}{`^v\d+$`, 12}, false},
+		{"@regex.capture", []interface{}{`(\w+)@(\w+)\.com`, "ops@example.com"}, []interface{}{"ops", "example"}},
+		{"@regex.capture", []interface{}{`(?P<host>[^:]+):(?P<port>\d+)`, "db.local:5432"}, map[string]interface{}{"host": "db.local", "port": "5432"}},
+		{"@regex.capture", []interface{}{`(\d+)`, "none"}, nil},
+		{"@regex.find_all", []interface{}{`\d+`, "a1 b22 c333"}, []interface{}{"1", "22", "333"}},
+		{"@regex.find_all", []interface{}{`\d+`, "a1 b22 c333", 2}, []interface{}{"1", "22"}},
+		{"@regex.find_all", []interface{}{`\d+`, "none"}, []interface{}{}},
+		{"@regex.replace", []interface{}{`(\w+)@(\w+)`, "ops@example", "$2/${1}"}, "example/ops"},
+	}
+	for _, tt := range tests {
+		result, err := om.ExecuteOperator(tt.operator, tt.args...)
+		if err != nil || !reflect.DeepEqual(result, tt.want) {
+			t.Errorf("%s%q = %#v, %v; want %#v", tt.operator, tt.args, result, err, tt.want)
+		}
+	}
+
+	// RE2 rejects backreferences rather than backtracking
+	if _, err := om.ExecuteOperator("@regex.match", `(a)\1`, "aa"); err == nil {
+		t.Error("Expected a backreference to be rejected")
+	}
+	if _, err := om.ExecuteOperator("@regex.replace", `a`, "b"); err == nil {
+		t.Error("Expected @regex.replace without a replacement to fail")
+	}
+}
+
+func TestCryptoOperators(t *testing.T) {
+	om := New()
+
+	tests := []struct {
+		operator string
+		args     []interface{}
+		want     interface{}
+	}{
+		{"@hash", []interface{}{"sha256", "hello world"}, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"},
+		{"@hash", []interface{}{"SHA1", "hello world", "base64"}, "Kq5sNclPz7QV2+lfQIuc6R7oRu0="},
+		{"@hmac", []interface{}{"sha256", "key", "The quick brown fox jumps over the lazy dog"}, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{"@base64", []interface{}{"encode", "hello world"}, "aGVsbG8gd29ybGQ="},
+		{"@base64", []interface{}{"decodeurl", "aGk_"}, "hi?"},
+		{"@hex", []interface{}{"encode", "hi"}, "6869"},
+		{"@hex", []interface{}{"decode", "6869"}, "hi"},
+		{"@uuid", []interface{}{"nil"}, "00000000-0000-0000-0000-000000000000"},
+	}
+	for _, tt := range tests {
+		result, err := om.ExecuteOperator(tt.operator, tt.args...)
+		if err != nil || result != tt.want {
+			t.Errorf("%s%v = %v, %v; want %v", tt.operator, tt.args, result, err, tt.want)
+		}
+	}
+
+	for _, version := range []string{"v4", "v7"} {
+		result, err := om.ExecuteOperator("@uuid", version)
+		if err != nil || len(result.(string)) != 36 || result.(string)[14] != version[1] {
+			t.Errorf("@uuid(%s) = %v, %v", version, result, err)
+		}
+	}
+
+	result, err := om.ExecuteOperator("@random", 32, "hex")
+	if err != nil || len(result.(string)) != 32 || strings.Trim(result.(string), "0123456789abcdef") != "" {
+		t.Errorf("@random(32, hex) = %v, %v", result, err)
+	}
+	other, _ := om.ExecuteOperator("@random", 32, "hex")
+	if other == result {
+		t.Error("Expected @random to differ between calls")
+	}
+	result, err = om.ExecuteOperator("@random", "6", "ab")
+	if err != nil || len(result.(string)) != 6 || strings.Trim(result.(string), "ab") != "" {
+		t.Errorf("@random(6, ab) = %v, %v", result, err)
+	}
+	for _, args := range [][]interface{}{{0}, {100000}, {8, "a"}} {
+		if _, err := om.ExecuteOperator("@random", args...); err == nil {
+			t.Errorf("Expected @random%v to fail", args)
+		}
+	}
+	if _, err := om.ExecuteOperator("@hash", "crc32", "x"); err == nil {
+		t.Error("Expected an unknown algorithm to fail")
+	}
+}
+
 func TestConditionalOperators(t *testing.T) {
 	om := New()
 	
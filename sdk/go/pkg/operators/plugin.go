@@ -0,0 +1,178 @@
+package operators
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OperatorFunc is the function behind an operator
+type OperatorFunc = func(args ...interface{}) (interface{}, error)
+
+// operatorName is an operator name: identifiers joined by dots, such as
+// "geo.distance"
+var operatorName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+var (
+	customMu sync.RWMutex
+	custom   = make(map[string]*Operator)
+
+	builtinOnce       sync.Once
+	builtinNames      map[string]bool
+	builtinNamespaces map[string]bool
+)
+
+// Register adds a custom operator to every OperatorManager, including ones
+// already created. Names should be namespaced, "vendor.op", and called as
+// @vendor.op(...). A name that is already registered, or that is or falls
+// under a built-in operator's namespace, such as "file.copy", is refused,
+// so an SDK upgrade cannot silently change what a configuration calls.
+func Register(name string, fn OperatorFunc) error {
+	name = strings.TrimPrefix(name, "@")
+	if !operatorName.MatchString(name) {
+		return fmt.Errorf("invalid operator name %q", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("operator @%s has no function", name)
+	}
+	for _, segment := range strings.Split(name, ".") {
+		if segment == "tsk" {
+			// @name.tsk.get reads another config file
+			return fmt.Errorf("operator @%s: %q is reserved", name, segment)
+		}
+	}
+
+	builtinOnce.Do(loadBuiltinNames)
+	namespace, _, namespaced := strings.Cut(name, ".")
+	switch {
+	case builtinNames[name]:
+		return fmt.Errorf("operator @%s conflicts with a built-in operator", name)
+	case namespaced && builtinNamespaces[namespace]:
+		return fmt.Errorf("operator @%s is in the built-in @%s namespace", name, namespace)
+	}
+
+	customMu.Lock()
+	defer customMu.Unlock()
+	if _, exists := custom[name]; exists {
+		return fmt.Errorf("operator @%s is already registered", name)
+	}
+	custom[name] = &Operator{Name: name, Symbol: "@" + name, Function: fn}
+	return nil
+}
+
+// MustRegister is Register for init functions: it panics on a conflict
+func MustRegister(name string, fn OperatorFunc) {
+	if err := Register(name, fn); err != nil {
+		panic(err)
+	}
+}
+
+// Registered returns the names of the custom operators, sorted
+func Registered() []string {
+	customMu.RLock()
+	defer customMu.RUnlock()
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// customOperator looks up a registered custom operator by name or symbol
+func customOperator(name string) (*Operator, bool) {
+	customMu.RLock()
+	defer customMu.RUnlock()
+	op, ok := custom[strings.TrimPrefix(name, "@")]
+	return op, ok
+}
+
+// loadBuiltinNames records the names and namespaces of the default
+// operators
+func loadBuiltinNames() {
+	builtinNames = make(map[string]bool)
+	builtinNamespaces = make(map[string]bool)
+	for _, op := range New().operators {
+		builtinNames[op.Name] = true
+		if namespace, _, ok := strings.Cut(op.Name, "."); ok {
+			builtinNamespaces[namespace] = true
+		}
+	}
+}
+
+// PluginSymbol is the function a Go plugin exports for LoadPlugins:
+//
+//	func Operators() map[string]func(args ...interface{}) (interface{}, error)
+//
+// The plugin must be built with the same Go version and SDK version as the
+// program loading it (go build -buildmode=plugin).
+const PluginSymbol = "Operators"
+
+var (
+	pluginsMu sync.Mutex
+	// loadedPlugins are plugin paths already loaded, which Go cannot unload
+	loadedPlugins = make(map[string]bool)
+)
+
+// LoadPlugins registers the operators of every .so plugin in dir and
+// returns their names. Plugins already loaded are skipped, so it is safe to
+// call on every configuration load.
+func LoadPlugins(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plugins: %w", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+	sort.Strings(paths)
+
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	var names []string
+	for _, path := range paths {
+		if loadedPlugins[path] {
+			continue
+		}
+		ops, err := openPlugin(path)
+		if err != nil {
+			return names, err
+		}
+		// An opened plugin stays loaded even when its operators conflict
+		loadedPlugins[path] = true
+		opNames := make([]string, 0, len(ops))
+		for name := range ops {
+			opNames = append(opNames, name)
+		}
+		sort.Strings(opNames)
+		for _, name := range opNames {
+			if err := Register(name, ops[name]); err != nil {
+				return names, fmt.Errorf("plugin %s: %w", filepath.Base(path), err)
+			}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// openPlugin opens a plugin and calls its PluginSymbol
+func openPlugin(path string) (map[string]OperatorFunc, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin %s: %w", path, err)
+	}
+	sym, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s does not export %s: %w", path, PluginSymbol, err)
+	}
+	operators, ok := sym.(func() map[string]func(args ...interface{}) (interface{}, error))
+	if !ok {
+		return nil, fmt.Errorf("plugin %s: %s has type %T, want func() map[string]func(...interface{}) (interface{}, error)", path, PluginSymbol, sym)
+	}
+	return operators(), nil
+}
@@ -0,0 +1,38 @@
+package operators
+
+import "github.com/cyber-boost/tusktsk/pkg/operators/core"
+
+// pureOperators return the same value for the same arguments and have no
+// side effects, so a call with constant arguments can be evaluated once
+// when an expression is compiled. @math is left out for its random mode.
+var pureOperators = map[string]bool{
+	"string": true, "concat": true, "json": true, "base64": true, "url": true,
+	"hash": true, "hmac": true, "hex": true,
+	"regex": true, "regex.match": true, "regex.capture": true, "regex.find_all": true, "regex.replace": true,
+	"calc": true, "round": true, "min": true, "max": true, "avg": true, "sum": true,
+	"add": true, "subtract": true, "multiply": true, "divide": true,
+	"length": true, "join": true, "split": true, "equals": true, "not_equals": true,
+}
+
+// regexOperators take an RE2 pattern as their first argument
+var regexOperators = map[string]bool{
+	"regex": true, "regex.match": true, "regex.capture": true, "regex.find_all": true, "regex.replace": true,
+}
+
+// IsPure reports whether the built-in operator name always returns the
+// same value for the same arguments, without side effects
+func IsPure(name string) bool {
+	return pureOperators[name]
+}
+
+// PrecompilePattern compiles the pattern a call to operator name passes
+// as its first argument ahead of the call, keeping it compiled for the
+// life of the process. It reports whether name takes a pattern and it
+// compiled.
+func PrecompilePattern(name string, pattern interface{}) bool {
+	s, ok := pattern.(string)
+	if !ok || !regexOperators[name] {
+		return false
+	}
+	return core.PinPattern(s)
+}
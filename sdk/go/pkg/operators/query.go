@@ -0,0 +1,46 @@
+package operators
+
+import (
+	"strings"
+	"sync"
+)
+
+// QueryTarget answers @query calls addressed to a data source, such as
+// @query("mongodb:users", "{active: true}")
+type QueryTarget func(query string, args ...interface{}) (interface{}, error)
+
+var (
+	queryTargetsMu sync.RWMutex
+	queryTargets   = make(map[string]QueryTarget)
+)
+
+// RegisterQueryTarget makes name addressable from @query. A nil target
+// removes it.
+func RegisterQueryTarget(name string, target QueryTarget) {
+	queryTargetsMu.Lock()
+	defer queryTargetsMu.Unlock()
+	if target == nil {
+		delete(queryTargets, name)
+		return
+	}
+	queryTargets[name] = target
+}
+
+// queryTarget resolves "name:query" to its registered target
+func queryTarget(args []interface{}) (QueryTarget, string, bool) {
+	if len(args) == 0 {
+		return nil, "", false
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, "", false
+	}
+	name, query, found := strings.Cut(s, ":")
+	if !found {
+		return nil, "", false
+	}
+	queryTargetsMu.RLock()
+	defer queryTargetsMu.RUnlock()
+	target, ok := queryTargets[name]
+	return target, query, ok
+}
@@ -0,0 +1,155 @@
+package orm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/dbschema"
+)
+
+// AutoMigrate brings the tables of the registered models in line with the
+// models: it creates tables, adds, renames and alters columns, and syncs
+// indexes. It refuses plans with destructive changes, such as dropped
+// columns or type changes; review those with Plan and apply them with
+// plan.Apply(db, true).
+func (orm *ORM) AutoMigrate() error {
+	plan, err := orm.Plan()
+	if err != nil {
+		return err
+	}
+	if err := plan.Apply(orm.db, false); err != nil {
+		return fmt.Errorf("failed to migrate: %w", err)
+	}
+	return nil
+}
+
+// Plan compares the tables of the registered models with the database
+func (orm *ORM) Plan() (*dbschema.Plan, error) {
+	dialect, err := dbschema.Detect(orm.db)
+	if err != nil {
+		return nil, err
+	}
+	desired := orm.Schema(dialect)
+	current, err := dbschema.Inspect(orm.db, dialect, desired.TableNames()...)
+	if err != nil {
+		return nil, err
+	}
+	return dbschema.Diff(current, desired), nil
+}
+
+// Schema returns the tables of the registered models, with column types
+// for dialect
+func (orm *ORM) Schema(dialect string) *dbschema.Schema {
+	schema := dbschema.New()
+	for tableName, info := range orm.models {
+		table := &dbschema.Table{Name: tableName, Renamed: make(map[string]string)}
+		for _, field := range info.Fields {
+			table.Columns = append(table.Columns, dbschema.ParseColumn(field.Column(), buildColumnDefinition(field, dialect)))
+			if old := renamedFrom(field); old != "" {
+				table.Renamed[field.Column()] = old
+			}
+		}
+		for _, index := range info.Indexes {
+			table.Indexes = append(table.Indexes, &dbschema.Index{Name: index.Name, Columns: index.Fields, Unique: index.Unique})
+		}
+		schema.Tables[tableName] = table
+	}
+	return schema
+}
+
+// buildColumnDefinition builds a column definition, without the name
+func buildColumnDefinition(field FieldInfo, dialect string) string {
+	dbType := field.DBType
+	switch dialect {
+	case dbschema.PostgreSQL:
+		dbType = strings.TrimSuffix(dbType, " UNSIGNED")
+		switch dbType {
+		case "DOUBLE":
+			dbType = "DOUBLE PRECISION"
+		case "BLOB":
+			dbType = "BYTEA"
+		}
+		if field.IsAutoIncr && dbType == "BIGINT" {
+			dbType = "BIGSERIAL"
+		} else if field.IsAutoIncr {
+			dbType = "SERIAL"
+		}
+	case dbschema.SQLite:
+		// Only INTEGER PRIMARY KEY columns autoincrement
+		if field.IsAutoIncr && field.IsPrimary {
+			dbType = "INTEGER"
+		}
+	}
+	parts := []string{dbType}
+
+	if field.IsPrimary {
+		parts = append(parts, "PRIMARY KEY")
+	} else if !field.IsNullable {
+		parts = append(parts, "NOT NULL")
+	}
+
+	if field.IsAutoIncr {
+		switch dialect {
+		case dbschema.MySQL:
+			parts = append(parts, "AUTO_INCREMENT")
+		case dbschema.SQLite:
+			if field.IsPrimary {
+				parts = append(parts, "AUTOINCREMENT")
+			}
+		}
+	}
+
+	if field.IsUnique {
+		parts = append(parts, "UNIQUE")
+	}
+
+	if field.DefaultValue != nil {
+		parts = append(parts, fmt.Sprintf("DEFAULT %v", field.DefaultValue))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// renamedFrom reads the gorm renamedFrom:<old column> setting
+func renamedFrom(field FieldInfo) string {
+	for _, part := range strings.Split(field.Tags["gorm"], ";") {
+		if part = strings.TrimSpace(part); strings.HasPrefix(part, "renamedFrom:") {
+			return strings.TrimPrefix(part, "renamedFrom:")
+		}
+	}
+	return ""
+}
+
+// addIndexes records the index and uniqueIndex settings of a gorm tag.
+// Fields naming the same index share it, in field order.
+func addIndexes(info *ModelInfo, column, tag string) {
+	for _, part := range strings.Split(tag, ";") {
+		part = strings.TrimSpace(part)
+		setting, name, _ := strings.Cut(part, ":")
+		unique := setting == "uniqueIndex"
+		if setting != "index" && !unique {
+			continue
+		}
+		if name == "" {
+			prefix := "idx_"
+			if unique {
+				prefix = "uidx_"
+			}
+			name = prefix + info.TableName + "_" + column
+		}
+
+		found := false
+		for i := range info.Indexes {
+			if info.Indexes[i].Name == name {
+				info.Indexes[i].Fields = append(info.Indexes[i].Fields, column)
+				info.Indexes[i].Unique = info.Indexes[i].Unique || unique
+				found = true
+			}
+		}
+		if !found {
+			info.Indexes = append(info.Indexes, IndexInfo{Name: name, Fields: []string{column}, Unique: unique})
+		}
+	}
+	sort.SliceStable(info.Indexes, func(i, j int) bool { return info.Indexes[i].Name < info.Indexes[j].Name })
+}
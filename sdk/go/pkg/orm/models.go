@@ -1,7 +1,6 @@
 package orm
 
 import (
-	"database/sql"
 	"fmt"
 	"reflect"
 	"strings"
@@ -50,8 +49,11 @@ func (bm *BaseModel) SetID(id interface{}) {
 
 // ORM provides the main ORM functionality
 type ORM struct {
-	db databasetypes.DatabaseAdapter
-	models map[string]*ModelInfo
+	// db runs statements: the adapter, or the transaction of a tx ORM
+	db      executor
+	adapter databasetypes.DatabaseAdapter
+	tx      *txState
+	models  map[string]*ModelInfo
 }
 
 // ModelInfo contains metadata about a model
@@ -80,7 +82,16 @@ type FieldInfo struct {
 	Tags         map[string]string
 }
 
-// RelationInfo contains information about model relationships
+// Column returns the column a field is stored in: its db tag, or its name
+func (f FieldInfo) Column() string {
+	if tag := f.Tags["db"]; tag != "" && tag != "-" {
+		return strings.Split(tag, ",")[0]
+	}
+	return f.Name
+}
+
+// RelationInfo contains information about model relationships; see
+// relations.go for how keys are derived
 type RelationInfo struct {
 	Name         string
 	Type         RelationType
@@ -121,8 +132,9 @@ type ConstraintInfo struct {
 // NewORM creates a new ORM instance
 func NewORM(db databasetypes.DatabaseAdapter) *ORM {
 	return &ORM{
-		db:     db,
-		models: make(map[string]*ModelInfo),
+		db:      db,
+		adapter: db,
+		models:  make(map[string]*ModelInfo),
 	}
 }
 
@@ -164,6 +176,16 @@ func (orm *ORM) analyzeModel(model Model, info *ModelInfo) error {
 			continue
 		}
 		
+		// Relations are loaded with Preload rather than stored as columns
+		if !fieldType.Anonymous && relatedModel(fieldType.Type) != nil {
+			relation, err := analyzeRelation(typ, fieldType)
+			if err != nil {
+				return err
+			}
+			info.Relations = append(info.Relations, relation)
+			continue
+		}
+		
 		fieldInfo := FieldInfo{
 			Name:   fieldType.Name,
 			Type:   field.Type().String(),
@@ -180,6 +202,7 @@ func (orm *ORM) analyzeModel(model Model, info *ModelInfo) error {
 		if gormTag != "" {
 			fieldInfo.Tags["gorm"] = gormTag
 			orm.parseGormTag(gormTag, &fieldInfo)
+			addIndexes(info, fieldInfo.Column(), gormTag)
 		}
 		
 		jsonTag := fieldType.Tag.Get("json")
@@ -187,8 +210,10 @@ func (orm *ORM) analyzeModel(model Model, info *ModelInfo) error {
 			fieldInfo.Tags["json"] = jsonTag
 		}
 		
-		// Determine database type
-		fieldInfo.DBType = orm.getDBType(field.Type())
+		// Determine database type, unless the gorm tag sets it
+		if fieldInfo.DBType == "" {
+			fieldInfo.DBType = orm.getDBType(field.Type())
+		}
 		
 		info.Fields = append(info.Fields, fieldInfo)
 	}
@@ -215,6 +240,8 @@ func (orm *ORM) parseGormTag(tag string, fieldInfo *FieldInfo) {
 			if size, err := fmt.Sscanf(part, "size:%d", &fieldInfo.Size); err == nil {
 				_ = size
 			}
+		case strings.HasPrefix(part, "type:"):
+			fieldInfo.DBType = strings.ToUpper(strings.TrimPrefix(part, "type:"))
 		case strings.HasPrefix(part, "default:"):
 			defaultVal := strings.TrimPrefix(part, "default:")
 			fieldInfo.DefaultValue = defaultVal
@@ -256,153 +283,6 @@ func (orm *ORM) getDBType(typ reflect.Type) string {
 	}
 }
 
-// AutoMigrate automatically creates or updates database tables
-func (orm *ORM) AutoMigrate() error {
-	for tableName, modelInfo := range orm.models {
-		if err := orm.migrateTable(tableName, modelInfo); err != nil {
-			return fmt.Errorf("failed to migrate table %s: %w", tableName, err)
-		}
-	}
-	return nil
-}
-
-// migrateTable creates or updates a single table
-func (orm *ORM) migrateTable(tableName string, modelInfo *ModelInfo) error {
-	// Check if table exists
-	exists, err := orm.tableExists(tableName)
-	if err != nil {
-		return err
-	}
-	
-	if !exists {
-		// Create new table
-		return orm.createTable(tableName, modelInfo)
-	} else {
-		// Update existing table
-		return orm.updateTable(tableName, modelInfo)
-	}
-}
-
-// tableExists checks if a table exists
-func (orm *ORM) tableExists(tableName string) (bool, error) {
-	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = ?"
-	result, err := orm.db.Query(query, tableName)
-	if err != nil {
-		return false, err
-	}
-	
-	if len(result.Rows) > 0 {
-		count := result.Rows[0]["count"]
-		if countInt, ok := count.(int64); ok {
-			return countInt > 0, nil
-		}
-	}
-	
-	return false, nil
-}
-
-// createTable creates a new table
-func (orm *ORM) createTable(tableName string, modelInfo *ModelInfo) error {
-	columns := make([]string, 0)
-	
-	for _, field := range modelInfo.Fields {
-		columnDef := orm.buildColumnDefinition(field)
-		columns = append(columns, columnDef)
-	}
-	
-	// Add primary key constraint
-	primaryKeys := make([]string, 0)
-	for _, field := range modelInfo.Fields {
-		if field.IsPrimary {
-			primaryKeys = append(primaryKeys, field.Name)
-		}
-	}
-	
-	if len(primaryKeys) > 0 {
-		columns = append(columns, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(primaryKeys, ", ")))
-	}
-	
-	// Add unique constraints
-	for _, field := range modelInfo.Fields {
-		if field.IsUnique {
-			columns = append(columns, fmt.Sprintf("UNIQUE (%s)", field.Name))
-		}
-	}
-	
-	query := fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", tableName, strings.Join(columns, ",\n  "))
-	
-	return orm.db.Execute(query)
-}
-
-// buildColumnDefinition builds a column definition string
-func (orm *ORM) buildColumnDefinition(field FieldInfo) string {
-	parts := []string{field.Name, field.DBType}
-	
-	if !field.IsNullable {
-		parts = append(parts, "NOT NULL")
-	}
-	
-	if field.IsAutoIncr {
-		parts = append(parts, "AUTO_INCREMENT")
-	}
-	
-	if field.DefaultValue != nil {
-		parts = append(parts, fmt.Sprintf("DEFAULT %v", field.DefaultValue))
-	}
-	
-	return strings.Join(parts, " ")
-}
-
-// updateTable updates an existing table
-func (orm *ORM) updateTable(tableName string, modelInfo *ModelInfo) error {
-	// Get existing columns
-	existingColumns, err := orm.getExistingColumns(tableName)
-	if err != nil {
-		return err
-	}
-	
-	// Add missing columns
-	for _, field := range modelInfo.Fields {
-		if !orm.columnExists(existingColumns, field.Name) {
-			columnDef := orm.buildColumnDefinition(field)
-			query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", tableName, columnDef)
-			if err := orm.db.Execute(query); err != nil {
-				return fmt.Errorf("failed to add column %s: %w", field.Name, err)
-			}
-		}
-	}
-	
-	return nil
-}
-
-// getExistingColumns gets the list of existing columns in a table
-func (orm *ORM) getExistingColumns(tableName string) ([]string, error) {
-	query := "SELECT column_name FROM information_schema.columns WHERE table_name = ?"
-	result, err := orm.db.Query(query, tableName)
-	if err != nil {
-		return nil, err
-	}
-	
-	columns := make([]string, 0)
-	for _, row := range result.Rows {
-		if columnName, ok := row["column_name"].(string); ok {
-			columns = append(columns, columnName)
-		}
-	}
-	
-	return columns, nil
-}
-
-// columnExists checks if a column exists in the list
-func (orm *ORM) columnExists(columns []string, columnName string) bool {
-	for _, col := range columns {
-		if col == columnName {
-			return true
-		}
-	}
-	return false
-}
-
 // Create creates a new record
 func (orm *ORM) Create(model Model) error {
 	tableName := model.TableName()
@@ -431,7 +311,7 @@ func (orm *ORM) Create(model Model) error {
 			continue
 		}
 		
-		fields = append(fields, field.Name)
+		fields = append(fields, field.Column())
 		placeholders = append(placeholders, "?")
 		values = append(values, fieldVal.Interface())
 	}
@@ -446,60 +326,19 @@ func (orm *ORM) Create(model Model) error {
 
 // Find finds records by conditions
 func (orm *ORM) Find(model Model, conditions map[string]interface{}) ([]Model, error) {
-	tableName := model.TableName()
-	
-	// Build SELECT query
-	query := fmt.Sprintf("SELECT * FROM %s", tableName)
-	values := make([]interface{}, 0)
-	
-	if len(conditions) > 0 {
-		whereClauses := make([]string, 0)
-		for field, value := range conditions {
-			whereClauses = append(whereClauses, fmt.Sprintf("%s = ?", field))
-			values = append(values, value)
-		}
-		query += " WHERE " + strings.Join(whereClauses, " AND ")
-	}
-	
-	result, err := orm.db.Query(query, values...)
-	if err != nil {
-		return nil, err
-	}
-	
-	// Convert results to models
-	models := make([]Model, 0)
-	for _, row := range result.Rows {
-		newModel := orm.createModelInstance(model)
-		if err := orm.scanRowToModel(row, newModel); err != nil {
-			return nil, err
-		}
-		models = append(models, newModel)
-	}
-	
-	return models, nil
+	return orm.Model(model).Where(conditions).fetch(modelValue(model).Type())
 }
 
 // FindByID finds a record by ID
 func (orm *ORM) FindByID(model Model, id interface{}) (Model, error) {
-	tableName := model.TableName()
-	primaryKey := model.PrimaryKey()
-	
-	query := fmt.Sprintf("SELECT * FROM %s WHERE %s = ? LIMIT 1", tableName, primaryKey)
-	result, err := orm.db.Query(query, id)
+	models, err := orm.Model(model).Where(map[string]interface{}{model.PrimaryKey(): id}).Limit(1).fetch(modelValue(model).Type())
 	if err != nil {
 		return nil, err
 	}
-	
-	if len(result.Rows) == 0 {
-		return nil, fmt.Errorf("record not found")
-	}
-	
-	newModel := orm.createModelInstance(model)
-	if err := orm.scanRowToModel(result.Rows[0], newModel); err != nil {
-		return nil, err
+	if len(models) == 0 {
+		return nil, ErrRecordNotFound
 	}
-	
-	return newModel, nil
+	return models[0], nil
 }
 
 // Update updates a record
@@ -527,7 +366,7 @@ func (orm *ORM) Update(model Model) error {
 			continue
 		}
 		
-		fields = append(fields, fmt.Sprintf("%s = ?", field.Name))
+		fields = append(fields, fmt.Sprintf("%s = ?", field.Column()))
 		values = append(values, fieldVal.Interface())
 	}
 	
@@ -570,8 +409,13 @@ func (orm *ORM) scanRowToModel(row map[string]interface{}, model Model) error {
 		val = val.Elem()
 	}
 	
+	// Columns match db tags, then field names
+	columns := columnFields(val)
 	for fieldName, value := range row {
-		field := val.FieldByName(fieldName)
+		field, ok := columns[fieldName]
+		if !ok {
+			field = val.FieldByName(fieldName)
+		}
 		if !field.IsValid() || !field.CanSet() {
 			continue
 		}
@@ -594,8 +438,11 @@ func (orm *ORM) setFieldValue(field reflect.Value, value interface{}) error {
 	
 	switch field.Kind() {
 	case reflect.String:
-		if str, ok := value.(string); ok {
+		switch str := value.(type) {
+		case string:
 			field.SetString(str)
+		case []byte:
+			field.SetString(string(str))
 		}
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		if num, ok := value.(int64); ok {
@@ -0,0 +1,604 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+	"github.com/cyber-boost/tusktsk/pkg/dbschema"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteDB is a minimal SQLite adapter that records the queries it runs
+type sqliteDB struct {
+	db           *sql.DB
+	queries      []string
+	executed     []string
+	noSavepoints bool
+}
+
+func (s *sqliteDB) Connect(config string) error { return nil }
+func (s *sqliteDB) Disconnect() error           { return s.db.Close() }
+func (s *sqliteDB) IsConnected() bool           { return true }
+func (s *sqliteDB) Ping() error                 { return s.db.Ping() }
+
+func (s *sqliteDB) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	s.queries = append(s.queries, query)
+	return queryRows(s.db, query, args...)
+}
+
+// queryRows runs a query on a *sql.DB or *sql.Tx
+func queryRows(db interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}, query string, args ...interface{}) (*databasetypes.Result, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &databasetypes.Result{Columns: columns}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{})
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqliteDB) Execute(query string, args ...interface{}) error {
+	_, err := s.db.Exec(query, args...)
+	return err
+}
+
+func (s *sqliteDB) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+func (s *sqliteDB) BeginTransaction() (databasetypes.Transaction, error) {
+	return s.BeginTransactionWithContext(context.Background())
+}
+func (s *sqliteDB) BeginTransactionWithContext(ctx context.Context) (databasetypes.Transaction, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteTx{tx: tx, db: s}, nil
+}
+func (s *sqliteDB) SupportsSavepoints() bool           { return !s.noSavepoints }
+func (s *sqliteDB) SetMaxOpenConns(n int)              {}
+func (s *sqliteDB) SetMaxIdleConns(n int)              {}
+func (s *sqliteDB) SetConnMaxLifetime(d time.Duration) {}
+func (s *sqliteDB) SetConnMaxIdleTime(d time.Duration) {}
+func (s *sqliteDB) GetStats() *databasetypes.Stats     { return &databasetypes.Stats{} }
+func (s *sqliteDB) Close() error                       { return s.db.Close() }
+
+// sqliteTx records statements into the sqliteDB that began it
+type sqliteTx struct {
+	tx *sql.Tx
+	db *sqliteDB
+}
+
+func (t *sqliteTx) Commit() error   { return t.tx.Commit() }
+func (t *sqliteTx) Rollback() error { return t.tx.Rollback() }
+
+func (t *sqliteTx) Query(query string, args ...interface{}) (*databasetypes.Result, error) {
+	t.db.queries = append(t.db.queries, query)
+	return queryRows(t.tx, query, args...)
+}
+
+func (t *sqliteTx) Execute(query string, args ...interface{}) error {
+	t.db.executed = append(t.db.executed, query)
+	_, err := t.tx.Exec(query, args...)
+	return err
+}
+
+func (t *sqliteTx) QueryRow(query string, args ...interface{}) (*databasetypes.Row, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+type Author struct {
+	ID      int64    `db:"id"`
+	Name    string   `db:"name"`
+	Posts   []*Post  `gorm:"foreignKey:AuthorID"`
+	Profile *Profile `gorm:"foreignKey:AuthorID"`
+}
+
+func (a *Author) TableName() string    { return "authors" }
+func (a *Author) PrimaryKey() string   { return "id" }
+func (a *Author) GetID() interface{}   { return a.ID }
+func (a *Author) SetID(id interface{}) { a.ID, _ = id.(int64) }
+
+type Profile struct {
+	ID       int64  `db:"id"`
+	AuthorID int64  `db:"author_id"`
+	Bio      string `db:"bio"`
+}
+
+func (p *Profile) TableName() string    { return "profiles" }
+func (p *Profile) PrimaryKey() string   { return "id" }
+func (p *Profile) GetID() interface{}   { return p.ID }
+func (p *Profile) SetID(id interface{}) { p.ID, _ = id.(int64) }
+
+type Post struct {
+	ID       int64  `db:"id"`
+	AuthorID int64  `db:"author_id"`
+	Title    string `db:"title"`
+	Author   *Author
+	Comments []Comment
+	Tags     []*Tag `gorm:"many2many:post_tags"`
+}
+
+func (p *Post) TableName() string    { return "posts" }
+func (p *Post) PrimaryKey() string   { return "id" }
+func (p *Post) GetID() interface{}   { return p.ID }
+func (p *Post) SetID(id interface{}) { p.ID, _ = id.(int64) }
+
+type Comment struct {
+	ID     int64  `db:"id"`
+	PostID int64  `db:"post_id"`
+	Body   string `db:"body"`
+}
+
+func (c *Comment) TableName() string    { return "comments" }
+func (c *Comment) PrimaryKey() string   { return "id" }
+func (c *Comment) GetID() interface{}   { return c.ID }
+func (c *Comment) SetID(id interface{}) { c.ID, _ = id.(int64) }
+
+type Tag struct {
+	ID    int64   `db:"id"`
+	Name  string  `db:"name"`
+	Posts []*Post `gorm:"many2many:post_tags"`
+}
+
+func (t *Tag) TableName() string    { return "tags" }
+func (t *Tag) PrimaryKey() string   { return "id" }
+func (t *Tag) GetID() interface{}   { return t.ID }
+func (t *Tag) SetID(id interface{}) { t.ID, _ = id.(int64) }
+
+func openBlog(t *testing.T) (*ORM, *sqliteDB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "blog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`
+		CREATE TABLE authors (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE profiles (id INTEGER PRIMARY KEY, author_id INTEGER, bio TEXT);
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, author_id INTEGER, title TEXT);
+		CREATE TABLE comments (id INTEGER PRIMARY KEY, post_id INTEGER, body TEXT);
+		CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE post_tags (post_id INTEGER, tag_id INTEGER);
+		INSERT INTO authors VALUES (1, 'ada'), (2, 'bob'), (3, 'cy');
+		INSERT INTO profiles VALUES (1, 2, 'likes go');
+		INSERT INTO posts VALUES (1, 1, 'first'), (2, 1, 'second'), (3, 2, 'third');
+		INSERT INTO comments VALUES (1, 1, 'nice'), (2, 1, 'agreed'), (3, 3, 'hm');
+		INSERT INTO tags VALUES (1, 'go'), (2, 'sql');
+		INSERT INTO post_tags VALUES (1, 1), (1, 2), (3, 1);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter := &sqliteDB{db: db}
+	return NewORM(adapter), adapter
+}
+
+func TestRegisterModelRelations(t *testing.T) {
+	orm, _ := openBlog(t)
+	if err := orm.RegisterModel(&Post{}); err != nil {
+		t.Fatalf("RegisterModel() returned error: %v", err)
+	}
+	info := orm.models["posts"]
+	if len(info.Fields) != 3 {
+		t.Errorf("relations should not be columns: %+v", info.Fields)
+	}
+	want := map[string]RelationInfo{
+		"Author":   {Type: BelongsTo, ForeignKey: "author_id", References: "id"},
+		"Comments": {Type: HasMany, ForeignKey: "post_id", References: "id"},
+		"Tags":     {Type: ManyToMany, ForeignKey: "post_id", References: "tag_id", Through: "post_tags"},
+	}
+	for _, rel := range info.Relations {
+		w := want[rel.Name]
+		if rel.Type != w.Type || rel.ForeignKey != w.ForeignKey || rel.References != w.References || rel.Through != w.Through {
+			t.Errorf("relation %s = %+v; want %+v", rel.Name, rel, w)
+		}
+	}
+	if len(info.Relations) != len(want) {
+		t.Errorf("found %d relations, want %d", len(info.Relations), len(want))
+	}
+}
+
+func TestPreload(t *testing.T) {
+	orm, db := openBlog(t)
+
+	var authors []*Author
+	err := orm.Preload("Posts.Comments", "Posts.Tags", "Profile").Find(&authors)
+	if err != nil {
+		t.Fatalf("Find() returned error: %v", err)
+	}
+	// One query for authors, then one per relation
+	if len(db.queries) != 5 {
+		t.Errorf("expected 5 queries, got %d:\n%s", len(db.queries), strings.Join(db.queries, "\n"))
+	}
+
+	ada, bob, cy := authors[0], authors[1], authors[2]
+	if len(ada.Posts) != 2 || ada.Posts[0].Title != "first" || ada.Posts[1].Title != "second" {
+		t.Fatalf("ada's posts = %+v", ada.Posts)
+	}
+	if cy.Posts == nil || len(cy.Posts) != 0 {
+		t.Errorf("a loaded relation without rows should be empty, not nil: %#v", cy.Posts)
+	}
+	if bob.Profile == nil || bob.Profile.Bio != "likes go" || ada.Profile != nil {
+		t.Errorf("profiles = %+v, %+v", ada.Profile, bob.Profile)
+	}
+	first := ada.Posts[0]
+	if len(first.Comments) != 2 || first.Comments[1].Body != "agreed" {
+		t.Errorf("comments = %+v", first.Comments)
+	}
+	if len(first.Tags) != 2 || first.Tags[0].Name != "go" || first.Tags[1].Name != "sql" {
+		t.Errorf("tags = %+v", first.Tags)
+	}
+	// A tag reached through several posts is one instance
+	if third := bob.Posts[0]; len(third.Tags) != 1 || third.Tags[0] != first.Tags[0] {
+		t.Errorf("tags of the third post = %+v", third.Tags)
+	}
+
+	if err := orm.Preload("Followers").Find(&authors); err == nil {
+		t.Error("expected an error for an unknown relation")
+	}
+}
+
+func TestPreloadBatches(t *testing.T) {
+	orm, db := openBlog(t)
+	for i := 4; i <= batchSize+10; i++ {
+		if err := db.Execute("INSERT INTO authors VALUES (?, ?)", i, fmt.Sprintf("author%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.queries = nil
+
+	var authors []Author
+	if err := orm.Preload("Posts").Find(&authors); err != nil {
+		t.Fatalf("Find() returned error: %v", err)
+	}
+	if len(authors) != batchSize+10 || len(db.queries) != 3 {
+		t.Errorf("got %d authors in %d queries", len(authors), len(db.queries))
+	}
+}
+
+func TestJoins(t *testing.T) {
+	orm, db := openBlog(t)
+
+	var p Post
+	if err := orm.Joins("Author").Preload("Tags").First(&p, 3); err != nil {
+		t.Fatalf("First() returned error: %v", err)
+	}
+	if p.Title != "third" || p.Author == nil || p.Author.Name != "bob" || len(p.Tags) != 1 {
+		t.Errorf("post = %+v, author %+v", p, p.Author)
+	}
+	if len(db.queries) != 2 || !strings.Contains(db.queries[0], "LEFT JOIN authors Author") {
+		t.Errorf("queries = %q", db.queries)
+	}
+
+	db.Execute("INSERT INTO posts VALUES (4, 9, 'orphan')")
+	var orphan Post
+	if err := orm.Joins("Author").First(&orphan, 4); err != nil || orphan.Author != nil {
+		t.Errorf("an unmatched join should leave Author nil: %+v, %v", orphan, err)
+	}
+
+	var posts []Post
+	if err := orm.Joins("Comments").Find(&posts); err == nil {
+		t.Error("has-many relations should not be joinable")
+	}
+}
+
+func TestPreloadAll(t *testing.T) {
+	orm, db := openBlog(t)
+
+	var posts []*Post
+	if err := orm.Model(&Post{}).PreloadAll().Find(&posts, map[string]interface{}{"id": 1}); err != nil {
+		t.Fatalf("Find() returned error: %v", err)
+	}
+	p := posts[0]
+	if p.Author == nil || len(p.Author.Posts) != 0 || p.Author.Profile != nil {
+		t.Errorf("author = %+v", p.Author)
+	}
+	if len(p.Tags) != 2 || p.Tags[0].Posts != nil {
+		t.Errorf("relations back to Post should not load: %+v", p.Tags)
+	}
+	// posts, then Author (and its Profile; Posts leads back), Comments and Tags
+	if len(db.queries) != 5 {
+		t.Errorf("expected 5 queries, got %d:\n%s", len(db.queries), strings.Join(db.queries, "\n"))
+	}
+}
+
+func TestQueryBuilder(t *testing.T) {
+	orm, db := openBlog(t)
+
+	var posts []Post
+	err := orm.Model(&Post{}).Where("author_id = ?", 1).Where("title <> ?", "nope").Order("title DESC").Limit(1).Offset(1).Find(&posts)
+	if err != nil {
+		t.Fatalf("Find() returned error: %v", err)
+	}
+	if len(posts) != 1 || posts[0].Title != "first" {
+		t.Errorf("posts = %+v", posts)
+	}
+	if want := "SELECT * FROM posts WHERE (author_id = ?) AND (title <> ?) ORDER BY title DESC LIMIT 1 OFFSET 1"; db.queries[0] != want {
+		t.Errorf("query = %q; want %q", db.queries[0], want)
+	}
+
+	// Raw joins qualify the selected columns and map conditions
+	var authors []*Author
+	err = orm.Joins("JOIN posts ON posts.author_id = authors.id AND posts.title = ?", "third").
+		Where(map[string]interface{}{"name": "bob"}).Find(&authors)
+	if err != nil || len(authors) != 1 || authors[0].Name != "bob" {
+		t.Errorf("authors = %+v, %v", authors, err)
+	}
+
+	var author Author
+	if err := orm.Where("name = ?", "cy").First(&author); err != nil || author.ID != 3 {
+		t.Errorf("First() = %+v, %v", author, err)
+	}
+	if err := orm.Model(&Author{}).First(&author, "name = ?", "nobody"); err != ErrRecordNotFound {
+		t.Errorf("First() should report ErrRecordNotFound, got %v", err)
+	}
+
+	for name, err := range map[string]error{
+		"not a slice":  orm.Model(&Post{}).Find(&author),
+		"wrong model":  orm.Model(&Post{}).Find(&authors),
+		"bad where":    orm.Where(42).Find(&authors),
+		"offset alone": orm.Model(&Author{}).Offset(2).Find(&authors),
+	} {
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// The map-based API still works
+	models, err := orm.Find(&Author{}, map[string]interface{}{"name": "ada"})
+	if err != nil || len(models) != 1 || models[0].(*Author).ID != 1 {
+		t.Errorf("Find() = %+v, %v", models, err)
+	}
+}
+
+func TestQueryDelete(t *testing.T) {
+	orm, _ := openBlog(t)
+	if err := orm.Model(&Post{}).Where("author_id = ?", 1).Where(map[string]interface{}{"title": "first"}).Delete(); err != nil {
+		t.Fatalf("Delete() returned error: %v", err)
+	}
+	var posts []Post
+	if err := orm.Model(&Post{}).Order("id").Find(&posts); err != nil || len(posts) != 2 || posts[0].Title != "second" {
+		t.Errorf("posts after Delete() = %+v, %v", posts, err)
+	}
+	for name, err := range map[string]error{
+		"no conditions": orm.Model(&Post{}).Delete(),
+		"no model":      orm.Where("id = ?", 2).Delete(),
+		"limit":         orm.Model(&Post{}).Where("id = ?", 2).Limit(1).Delete(),
+	} {
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// authorNames lists author names in id order
+func authorNames(t *testing.T, orm *ORM) []string {
+	t.Helper()
+	var authors []Author
+	if err := orm.Model(&Author{}).Order("id").Find(&authors); err != nil {
+		t.Fatalf("Find() returned error: %v", err)
+	}
+	names := make([]string, len(authors))
+	for i, author := range authors {
+		names[i] = author.Name
+	}
+	return names
+}
+
+func TestTransaction(t *testing.T) {
+	orm, _ := openBlog(t)
+	if err := orm.RegisterModel(&Author{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := orm.Transaction(func(tx *ORM) error {
+		if err := tx.Create(&Author{ID: 4, Name: "dee"}); err != nil {
+			return err
+		}
+		if err := tx.Update(&Author{ID: 1, Name: "ada l."}); err != nil {
+			return err
+		}
+		return tx.Delete(&Author{ID: 3})
+	})
+	if err != nil {
+		t.Fatalf("Transaction() returned error: %v", err)
+	}
+	if got := strings.Join(authorNames(t, orm), ","); got != "ada l.,bob,dee" {
+		t.Errorf("after commit authors = %s", got)
+	}
+
+	failure := fmt.Errorf("boom")
+	err = orm.Transaction(func(tx *ORM) error {
+		if err := tx.Create(&Author{ID: 5, Name: "eve"}); err != nil {
+			return err
+		}
+		// Reads in the transaction see its own writes
+		var author Author
+		if err := tx.Model(&Author{}).First(&author, int64(5)); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Errorf("Transaction() returned %v; want the callback's error", err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "panic in tx" {
+				t.Errorf("recover() = %v; want the callback's panic", r)
+			}
+		}()
+		orm.Transaction(func(tx *ORM) error {
+			tx.Delete(&Author{ID: 1})
+			panic("panic in tx")
+		})
+	}()
+
+	if got := strings.Join(authorNames(t, orm), ","); got != "ada l.,bob,dee" {
+		t.Errorf("rolled back transactions left authors = %s", got)
+	}
+}
+
+func TestNestedTransaction(t *testing.T) {
+	orm, db := openBlog(t)
+	if err := orm.RegisterModel(&Author{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := orm.Transaction(func(tx *ORM) error {
+		if err := tx.Create(&Author{ID: 4, Name: "dee"}); err != nil {
+			return err
+		}
+		err := tx.Transaction(func(tx *ORM) error {
+			tx.Create(&Author{ID: 5, Name: "eve"})
+			return fmt.Errorf("inner failure")
+		})
+		if err == nil || err.Error() != "inner failure" {
+			t.Errorf("inner Transaction() returned %v", err)
+		}
+		return tx.Transaction(func(tx *ORM) error {
+			return tx.Create(&Author{ID: 6, Name: "fay"})
+		})
+	})
+	if err != nil {
+		t.Fatalf("Transaction() returned error: %v", err)
+	}
+	if got := strings.Join(authorNames(t, orm), ","); got != "ada,bob,cy,dee,fay" {
+		t.Errorf("authors = %s; want the failed savepoint rolled back", got)
+	}
+	want := []string{"SAVEPOINT tsk_sp_1", "ROLLBACK TO SAVEPOINT tsk_sp_1", "RELEASE SAVEPOINT tsk_sp_1", "SAVEPOINT tsk_sp_2", "RELEASE SAVEPOINT tsk_sp_2"}
+	var savepoints []string
+	for _, stmt := range db.executed {
+		if strings.Contains(stmt, "SAVEPOINT") {
+			savepoints = append(savepoints, stmt)
+		}
+	}
+	if strings.Join(savepoints, "\n") != strings.Join(want, "\n") {
+		t.Errorf("savepoint statements = %q; want %q", savepoints, want)
+	}
+
+	db.noSavepoints = true
+	err = orm.Transaction(func(tx *ORM) error {
+		return tx.Transaction(func(tx *ORM) error { return nil })
+	})
+	if err == nil || !strings.Contains(err.Error(), "savepoints") {
+		t.Errorf("nesting without savepoints returned %v", err)
+	}
+}
+
+type account struct {
+	ID   int64  `db:"id" gorm:"primaryKey;autoIncrement"`
+	Name string `db:"name"`
+	Nick string `db:"nick"`
+}
+
+func (a *account) TableName() string    { return "accounts" }
+func (a *account) PrimaryKey() string   { return "id" }
+func (a *account) GetID() interface{}   { return a.ID }
+func (a *account) SetID(id interface{}) { a.ID, _ = id.(int64) }
+
+// accountV2 is account after a release renaming name and replacing nick
+type accountV2 struct {
+	ID       int64  `db:"id" gorm:"primaryKey;autoIncrement"`
+	FullName string `db:"full_name" gorm:"renamedFrom:name"`
+	Email    string `db:"email" gorm:"uniqueIndex;default:''"`
+}
+
+func (a *accountV2) TableName() string    { return "accounts" }
+func (a *accountV2) PrimaryKey() string   { return "id" }
+func (a *accountV2) GetID() interface{}   { return a.ID }
+func (a *accountV2) SetID(id interface{}) { a.ID, _ = id.(int64) }
+
+func TestGormType(t *testing.T) {
+	type note struct {
+		account
+		Body string `db:"body" gorm:"type:text"`
+	}
+	orm := NewORM(nil)
+	if err := orm.RegisterModel(&note{}); err != nil {
+		t.Fatal(err)
+	}
+	fields := orm.models["accounts"].Fields
+	if body := fields[len(fields)-1]; body.Name != "Body" || body.DBType != "TEXT" {
+		t.Errorf("Body is %+v, want the TEXT of its gorm tag", body)
+	}
+}
+
+func TestAutoMigrate(t *testing.T) {
+	_, db := openBlog(t)
+
+	v1 := NewORM(db)
+	if err := v1.RegisterModel(&account{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1.AutoMigrate(); err != nil {
+		t.Fatalf("AutoMigrate() returned error: %v", err)
+	}
+	if err := v1.Create(&account{ID: 1, Name: "ada", Nick: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err := v1.Plan(); err != nil || !plan.Empty() {
+		t.Fatalf("Plan() after AutoMigrate = %+v, %v; want no changes", plan, err)
+	}
+
+	v2 := NewORM(db)
+	if err := v2.RegisterModel(&accountV2{}); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := v2.Plan()
+	if err != nil {
+		t.Fatalf("Plan() returned error: %v", err)
+	}
+	var changes []string
+	for _, change := range plan.Changes {
+		changes = append(changes, change.String())
+	}
+	want := "rename column accounts.name -> full_name\n" +
+		"rename column accounts.nick -> email (guessed; declare it under renamed to confirm)\n" +
+		"create index accounts.uidx_accounts_email"
+	if got := strings.Join(changes, "\n"); got != want {
+		t.Errorf("plan =\n%s\nwant\n%s", got, want)
+	}
+
+	var refused *dbschema.DestructiveError
+	if err := v2.AutoMigrate(); !errors.As(err, &refused) {
+		t.Fatalf("AutoMigrate() = %v; want the guessed rename refused", err)
+	}
+	if err := plan.Apply(db, true); err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+	var got accountV2
+	if err := v2.Model(&accountV2{}).First(&got, int64(1)); err != nil || got.FullName != "ada" {
+		t.Errorf("after migrating, account = %+v, %v; want the renamed column's data", got, err)
+	}
+}
@@ -0,0 +1,335 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrRecordNotFound is returned by First and FindByID when nothing matches
+var ErrRecordNotFound = errors.New("record not found")
+
+// Query builds a SELECT step by step:
+//
+//	var users []User
+//	err := orm.Model(&User{}).Where("age > ?", 18).Order("name").Limit(10).Find(&users)
+//
+// Builder methods modify and return the query, so a Query is used once.
+type Query struct {
+	orm      *ORM
+	model    Model
+	wheres   []whereClause
+	joins    []joinClause
+	orders   []string
+	limit    int
+	offset   int
+	preloads preloadTree
+	all      bool
+	err      error
+}
+
+// whereClause is SQL with arguments, or a column compared to a value; the
+// column is qualified with the table once joins are known
+type whereClause struct {
+	sql    string
+	column string
+	args   []interface{}
+}
+
+// joinClause is a relation joined by name, or a raw JOIN clause
+type joinClause struct {
+	relation string
+	sql      string
+	args     []interface{}
+}
+
+// Model starts a query on the table of model
+func (orm *ORM) Model(model Model) *Query {
+	return &Query{orm: orm, model: model, preloads: preloadTree{}}
+}
+
+// Where starts a query with a condition; see Query.Where
+func (orm *ORM) Where(query interface{}, args ...interface{}) *Query {
+	return (&Query{orm: orm, preloads: preloadTree{}}).Where(query, args...)
+}
+
+// Preload starts a query that eagerly loads relations, e.g. "Posts" or
+// "Posts.Comments", with one batched IN query per relation
+func (orm *ORM) Preload(relations ...string) *Query {
+	return (&Query{orm: orm, preloads: preloadTree{}}).Preload(relations...)
+}
+
+// Joins starts a query with a join; see Query.Joins
+func (orm *ORM) Joins(join string, args ...interface{}) *Query {
+	return (&Query{orm: orm, preloads: preloadTree{}}).Joins(join, args...)
+}
+
+// Where adds a condition, ANDed with the others: SQL with ? placeholders
+// ("age > ? AND role = ?", 18, "admin"), or a map of columns to values
+func (q *Query) Where(query interface{}, args ...interface{}) *Query {
+	switch cond := query.(type) {
+	case string:
+		q.wheres = append(q.wheres, whereClause{sql: "(" + cond + ")", args: args})
+	case map[string]interface{}:
+		columns := make([]string, 0, len(cond))
+		for column := range cond {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for _, column := range columns {
+			q.wheres = append(q.wheres, whereClause{column: column, args: []interface{}{cond[column]}})
+		}
+	default:
+		q.err = fmt.Errorf("unsupported Where condition %T: use a string or a map", query)
+	}
+	return q
+}
+
+// Order adds an ORDER BY term such as "name" or "created_at DESC"
+func (q *Query) Order(order string) *Query {
+	q.orders = append(q.orders, order)
+	return q
+}
+
+// Limit caps the number of records
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+	return q
+}
+
+// Offset skips records; it needs a Limit
+func (q *Query) Offset(n int) *Query {
+	q.offset = n
+	return q
+}
+
+// Joins adds a join: a BelongsTo or HasOne relation by name, loaded from a
+// LEFT JOIN in the main query, or a raw clause such as
+// "JOIN posts ON posts.author_id = authors.id AND posts.title = ?"
+func (q *Query) Joins(join string, args ...interface{}) *Query {
+	if strings.ContainsAny(join, " \t\n") {
+		q.joins = append(q.joins, joinClause{sql: join, args: args})
+	} else {
+		q.joins = append(q.joins, joinClause{relation: join})
+	}
+	return q
+}
+
+// Preload adds relations to load
+func (q *Query) Preload(relations ...string) *Query {
+	for _, path := range relations {
+		q.preloads.add(path)
+	}
+	return q
+}
+
+// PreloadAll loads every relation, and theirs in turn, except relations
+// leading back to a model already on the path, so cycles end
+func (q *Query) PreloadAll() *Query {
+	q.all = true
+	return q
+}
+
+// Find loads the matching records into dest, a pointer to a slice of models
+// or of pointers to models. conds are inline Where conditions; a single
+// value that is neither a string nor a map matches the primary key.
+func (q *Query) Find(dest interface{}, conds ...interface{}) error {
+	val := reflect.ValueOf(dest)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("Find requires a pointer to a slice of models, got %T", dest)
+	}
+	slice := val.Elem()
+	typ := relatedModel(slice.Type())
+	if typ == nil {
+		return fmt.Errorf("%s is not a model type", slice.Type().Elem())
+	}
+
+	models, err := q.inline(typ, conds).fetch(typ)
+	if err != nil {
+		return err
+	}
+
+	result := reflect.MakeSlice(slice.Type(), 0, len(models))
+	for _, model := range models {
+		item := reflect.ValueOf(model)
+		if slice.Type().Elem().Kind() != reflect.Ptr {
+			item = item.Elem()
+		}
+		result = reflect.Append(result, item)
+	}
+	slice.Set(result)
+	return nil
+}
+
+// First loads the first matching record, by primary key unless ordered,
+// into dest, a pointer to a model. It returns ErrRecordNotFound when
+// nothing matches.
+func (q *Query) First(dest Model, conds ...interface{}) error {
+	typ := modelValue(dest).Type()
+	if len(q.orders) == 0 {
+		q.Order(dest.TableName() + "." + dest.PrimaryKey())
+	}
+	models, err := q.inline(typ, conds).Limit(1).fetch(typ)
+	if err != nil {
+		return err
+	}
+	if len(models) == 0 {
+		return ErrRecordNotFound
+	}
+	modelValue(dest).Set(modelValue(models[0]))
+	return nil
+}
+
+// inline applies the conditions passed to Find and First
+func (q *Query) inline(typ reflect.Type, conds []interface{}) *Query {
+	if len(conds) == 0 {
+		return q
+	}
+	switch cond := conds[0].(type) {
+	case string, map[string]interface{}:
+		return q.Where(cond, conds[1:]...)
+	default:
+		return q.Where(map[string]interface{}{newModel(typ).PrimaryKey(): cond})
+	}
+}
+
+// fetch runs the query for models of type typ and loads their relations
+func (q *Query) fetch(typ reflect.Type) ([]Model, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if q.model != nil && modelValue(q.model).Type() != typ {
+		return nil, fmt.Errorf("query on %s cannot load %s", modelValue(q.model).Type().Name(), typ.Name())
+	}
+	if q.offset > 0 && q.limit == 0 {
+		return nil, fmt.Errorf("Offset requires a Limit")
+	}
+
+	model := newModel(typ)
+	tableName := model.TableName()
+	rels, err := relations(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build SELECT query
+	selects := []string{"*"}
+	if len(q.joins) > 0 {
+		selects[0] = tableName + ".*"
+	}
+	from := tableName
+	values := make([]interface{}, 0)
+	var joined []RelationInfo
+	for _, join := range q.joins {
+		if join.relation == "" {
+			from += " " + join.sql
+			values = append(values, join.args...)
+			continue
+		}
+		name := join.relation
+		rel, ok := rels[name]
+		if !ok {
+			return nil, fmt.Errorf("%s has no relation %s", typ.Name(), name)
+		}
+		if rel.Type != BelongsTo && rel.Type != HasOne {
+			return nil, fmt.Errorf("relation %s cannot be joined: only belongs-to and has-one relations can", name)
+		}
+		for _, column := range sortedColumns(modelValue(rel.Model)) {
+			selects = append(selects, fmt.Sprintf("%s.%s AS %s%s%s", name, column, name, joinSeparator, column))
+		}
+		on := fmt.Sprintf("%s.%s = %s.%s", name, rel.References, tableName, rel.ForeignKey)
+		if rel.Type == HasOne {
+			on = fmt.Sprintf("%s.%s = %s.%s", name, rel.ForeignKey, tableName, rel.References)
+		}
+		from += fmt.Sprintf(" LEFT JOIN %s %s ON %s", rel.Model.TableName(), name, on)
+		joined = append(joined, rel)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selects, ", "), from)
+	where, args := q.where(tableName)
+	query += where
+	values = append(values, args...)
+	if len(q.orders) > 0 {
+		query += " ORDER BY " + strings.Join(q.orders, ", ")
+	}
+	if q.limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.limit)
+		if q.offset > 0 {
+			query += fmt.Sprintf(" OFFSET %d", q.offset)
+		}
+	}
+
+	result, err := q.orm.db.Query(query, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert results to models
+	models := make([]Model, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		newModel := q.orm.createModelInstance(model)
+		if err := q.orm.scanRowToModel(row, newModel); err != nil {
+			return nil, err
+		}
+		for _, rel := range joined {
+			if err := q.orm.scanJoined(row, newModel, rel); err != nil {
+				return nil, err
+			}
+		}
+		models = append(models, newModel)
+	}
+
+	tree := q.preloads
+	if q.all {
+		tree = allRelations(typ, map[reflect.Type]bool{})
+	}
+	if err := q.orm.preload(models, typ, tree); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// where returns the WHERE clause of the query, if any, and its arguments
+func (q *Query) where(tableName string) (string, []interface{}) {
+	if len(q.wheres) == 0 {
+		return "", nil
+	}
+	clauses := make([]string, 0, len(q.wheres))
+	var values []interface{}
+	for _, where := range q.wheres {
+		clause := where.sql
+		if where.column != "" {
+			column := where.column
+			if len(q.joins) > 0 && !strings.Contains(column, ".") {
+				column = tableName + "." + column
+			}
+			clause = column + " = ?"
+		}
+		clauses = append(clauses, clause)
+		values = append(values, where.args...)
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), values
+}
+
+// Delete deletes the matching records of the query's model in one
+// statement. It refuses a query without conditions rather than empty the
+// table.
+func (q *Query) Delete() error {
+	if q.err != nil {
+		return q.err
+	}
+	if q.model == nil {
+		return fmt.Errorf("Delete requires a query started with Model")
+	}
+	if len(q.wheres) == 0 {
+		return fmt.Errorf("Delete requires a Where condition")
+	}
+	if len(q.joins) > 0 || len(q.orders) > 0 || q.limit > 0 {
+		return fmt.Errorf("Delete does not support joins, ordering or limits")
+	}
+	tableName := q.model.TableName()
+	where, values := q.where(tableName)
+	return q.orm.db.Execute("DELETE FROM "+tableName+where, values...)
+}
@@ -0,0 +1,449 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Relations are struct fields whose type, or slice element type, is another
+// model. Keys follow GORM's conventions and can be set in gorm tags:
+//
+//	Posts  []Post `gorm:"foreignKey:AuthorID"`   // has many: posts.author_id = id
+//	Author *User                                 // belongs to: AuthorID = users.id
+//	Tags   []*Tag `gorm:"many2many:post_tags"`  // through post_tags.post_id/tag_id
+//
+// For HasOne and HasMany, ForeignKey is the target's column and References
+// the owner's; for BelongsTo it is the other way round. ManyToMany relations
+// join Through, whose ForeignKey column holds the owner's primary key and
+// References column the target's.
+
+var (
+	modelType = reflect.TypeOf((*Model)(nil)).Elem()
+	timeType  = reflect.TypeOf(time.Time{})
+)
+
+// batchSize bounds the keys of one IN query, below SQLite's 999 parameters
+const batchSize = 500
+
+// joinSeparator prefixes the columns of joined relations, e.g. Author__name
+const joinSeparator = "__"
+
+// relatedModel returns the model type of a relation field, or nil
+func relatedModel(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == timeType || !reflect.PtrTo(typ).Implements(modelType) {
+		return nil
+	}
+	return typ
+}
+
+// gormSetting returns the value of a key:value part of a gorm tag
+func gormSetting(tag, key string) string {
+	for _, part := range strings.Split(tag, ";") {
+		part = strings.TrimSpace(part)
+		if value, ok := strings.CutPrefix(part, key+":"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// columnName returns the column of a struct field: its db tag, or its name
+func columnName(field reflect.StructField) string {
+	if tag := field.Tag.Get("db"); tag != "" && tag != "-" {
+		return strings.Split(tag, ",")[0]
+	}
+	return field.Name
+}
+
+// fieldColumn returns the column of a named, possibly promoted, field
+func fieldColumn(typ reflect.Type, name string) (string, bool) {
+	field, ok := typ.FieldByName(name)
+	if !ok {
+		return "", false
+	}
+	return columnName(field), true
+}
+
+// columnFields maps columns to the settable fields of a struct value,
+// including the fields of embedded structs such as BaseModel
+func columnFields(val reflect.Value) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	typ := val.Type()
+	for i := 0; i < val.NumField(); i++ {
+		field, value := typ.Field(i), val.Field(i)
+		if !value.CanSet() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for column, inner := range columnFields(value) {
+				if _, ok := fields[column]; !ok {
+					fields[column] = inner
+				}
+			}
+			continue
+		}
+		if relatedModel(field.Type) != nil {
+			continue
+		}
+		fields[columnName(field)] = value
+	}
+	return fields
+}
+
+// modelValue returns the struct a model points to
+func modelValue(model Model) reflect.Value {
+	val := reflect.ValueOf(model)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	return val
+}
+
+// newModel returns a new instance of a model type
+func newModel(typ reflect.Type) Model {
+	return reflect.New(typ).Interface().(Model)
+}
+
+// analyzeRelation describes the relation held by field of owner
+func analyzeRelation(owner reflect.Type, field reflect.StructField) (RelationInfo, error) {
+	target := relatedModel(field.Type)
+	ownerModel, targetModel := newModel(owner), newModel(target)
+	tag := field.Tag.Get("gorm")
+	rel := RelationInfo{
+		Name:     field.Name,
+		Model:    targetModel,
+		OnDelete: gormSetting(tag, "constraint:OnDelete"),
+		OnUpdate: gormSetting(tag, "constraint:OnUpdate"),
+	}
+	foreignKey, references := gormSetting(tag, "foreignKey"), gormSetting(tag, "references")
+
+	if through := gormSetting(tag, "many2many"); through != "" {
+		rel.Type = ManyToMany
+		rel.Through = through
+		rel.ForeignKey = gormSetting(tag, "joinForeignKey")
+		if rel.ForeignKey == "" {
+			rel.ForeignKey = snakeCase(owner.Name()) + "_id"
+		}
+		rel.References = gormSetting(tag, "joinReferences")
+		if rel.References == "" {
+			rel.References = snakeCase(target.Name()) + "_id"
+		}
+		return rel, nil
+	}
+
+	// A single model is owned through a key on the owner when one exists
+	if field.Type.Kind() != reflect.Slice {
+		name := foreignKey
+		if name == "" {
+			name = field.Name + "ID"
+		}
+		if column, ok := fieldColumn(owner, name); ok {
+			rel.Type = BelongsTo
+			rel.ForeignKey = column
+			rel.References = targetModel.PrimaryKey()
+			if references != "" {
+				if rel.References, ok = fieldColumn(target, references); !ok {
+					return rel, fmt.Errorf("relation %s: %s has no field %s", field.Name, target.Name(), references)
+				}
+			}
+			return rel, nil
+		}
+	}
+
+	rel.Type = HasMany
+	if field.Type.Kind() != reflect.Slice {
+		rel.Type = HasOne
+	}
+	name := foreignKey
+	if name == "" {
+		name = owner.Name() + "ID"
+	}
+	column, ok := fieldColumn(target, name)
+	if !ok {
+		return rel, fmt.Errorf("relation %s: %s has no field %s", field.Name, target.Name(), name)
+	}
+	rel.ForeignKey = column
+	rel.References = ownerModel.PrimaryKey()
+	if references != "" {
+		if rel.References, ok = fieldColumn(owner, references); !ok {
+			return rel, fmt.Errorf("relation %s: %s has no field %s", field.Name, owner.Name(), references)
+		}
+	}
+	return rel, nil
+}
+
+// snakeCase turns PostTag into post_tag
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 && !(s[i-1] >= 'A' && s[i-1] <= 'Z') {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// relations returns the relations of a model type, by field name
+func relations(typ reflect.Type) (map[string]RelationInfo, error) {
+	rels := make(map[string]RelationInfo)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" || field.Anonymous || relatedModel(field.Type) == nil {
+			continue
+		}
+		rel, err := analyzeRelation(typ, field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to analyze %s: %w", typ.Name(), err)
+		}
+		rels[field.Name] = rel
+	}
+	return rels, nil
+}
+
+// preloadTree holds nested relation names: Posts.Comments is
+// {"Posts": {"Comments": {}}}
+type preloadTree map[string]preloadTree
+
+func (t preloadTree) add(path string) {
+	node := t
+	for _, name := range strings.Split(path, ".") {
+		if node[name] == nil {
+			node[name] = preloadTree{}
+		}
+		node = node[name]
+	}
+}
+
+// sortedColumns lists the columns of a model struct
+func sortedColumns(val reflect.Value) []string {
+	columns := make([]string, 0)
+	for column := range columnFields(val) {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// scanJoined fills a joined relation from its prefixed columns; a row
+// without a match leaves it empty
+func (orm *ORM) scanJoined(row map[string]interface{}, model Model, rel RelationInfo) error {
+	prefix := rel.Name + joinSeparator
+	values := make(map[string]interface{})
+	matched := false
+	for column, value := range row {
+		if name, ok := strings.CutPrefix(column, prefix); ok {
+			values[name] = value
+			matched = matched || value != nil
+		}
+	}
+	if !matched {
+		return nil
+	}
+	target := orm.createModelInstance(rel.Model)
+	if err := orm.scanRowToModel(values, target); err != nil {
+		return err
+	}
+	setRelation(modelValue(model).FieldByName(rel.Name), []Model{target})
+	return nil
+}
+
+// allRelations builds the preload tree of every relation of typ, skipping
+// relations back to a type on the current path
+func allRelations(typ reflect.Type, path map[reflect.Type]bool) preloadTree {
+	tree := preloadTree{}
+	rels, err := relations(typ)
+	if err != nil {
+		// preload reports the error when it analyzes typ again
+		return tree
+	}
+	path[typ] = true
+	defer delete(path, typ)
+	for name, rel := range rels {
+		target := modelValue(rel.Model).Type()
+		if path[target] {
+			continue
+		}
+		tree[name] = allRelations(target, path)
+	}
+	return tree
+}
+
+// preload loads the relations in tree for models of type typ
+func (orm *ORM) preload(models []Model, typ reflect.Type, tree preloadTree) error {
+	if len(models) == 0 || len(tree) == 0 {
+		return nil
+	}
+	rels, err := relations(typ)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rel, ok := rels[name]
+		if !ok {
+			return fmt.Errorf("%s has no relation %s", typ.Name(), name)
+		}
+		groups, loaded, err := orm.loadRelation(models, rel)
+		if err != nil {
+			return fmt.Errorf("failed to preload %s: %w", name, err)
+		}
+		// Nested relations load before assignment, as slices of structs
+		// hold copies
+		if err := orm.preload(loaded, modelValue(rel.Model).Type(), tree[name]); err != nil {
+			return err
+		}
+		for i, model := range models {
+			setRelation(modelValue(model).FieldByName(rel.Name), groups[i])
+		}
+	}
+	return nil
+}
+
+// loadRelation fetches the targets of rel for every model. groups holds
+// the targets of each model by index; loaded holds each target once.
+func (orm *ORM) loadRelation(models []Model, rel RelationInfo) (groups [][]Model, loaded []Model, err error) {
+	targetTable := rel.Model.TableName()
+	targetKey := rel.Model.PrimaryKey()
+
+	// ownerKey is the owner column matched against the target
+	ownerKey, matchColumn := rel.References, rel.ForeignKey
+	switch rel.Type {
+	case BelongsTo:
+		ownerKey, matchColumn = rel.ForeignKey, rel.References
+	case ManyToMany:
+		ownerKey = models[0].PrimaryKey()
+	}
+
+	keys := make([]interface{}, 0, len(models))
+	seen := make(map[string]bool)
+	for _, model := range models {
+		key, ok := modelKey(model, ownerKey)
+		if !ok {
+			continue
+		}
+		if !seen[keyString(key)] {
+			seen[keyString(key)] = true
+			keys = append(keys, key)
+		}
+	}
+
+	byKey := make(map[string][]Model)
+	identity := make(map[string]Model)
+	for start := 0; start < len(keys); start += batchSize {
+		batch := keys[start:min(start+batchSize, len(keys))]
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+
+		var query string
+		switch rel.Type {
+		case ManyToMany:
+			query = fmt.Sprintf("SELECT %s.*, %s.%s AS %sowner FROM %s JOIN %s ON %s.%s = %s.%s WHERE %s.%s IN (%s) ORDER BY %s.%s",
+				targetTable, rel.Through, rel.ForeignKey, joinSeparator, targetTable,
+				rel.Through, rel.Through, rel.References, targetTable, targetKey,
+				rel.Through, rel.ForeignKey, placeholders, targetTable, targetKey)
+			matchColumn = joinSeparator + "owner"
+		default:
+			query = fmt.Sprintf("SELECT * FROM %s WHERE %s IN (%s) ORDER BY %s",
+				targetTable, matchColumn, placeholders, targetKey)
+		}
+
+		result, err := orm.db.Query(query, batch...)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, row := range result.Rows {
+			// Rows reached through several owners become one shared instance
+			id := keyString(row[targetKey])
+			target, ok := identity[id]
+			if !ok {
+				target = orm.createModelInstance(rel.Model)
+				if err := orm.scanRowToModel(row, target); err != nil {
+					return nil, nil, err
+				}
+				identity[id] = target
+				loaded = append(loaded, target)
+			}
+			match := keyString(row[matchColumn])
+			byKey[match] = append(byKey[match], target)
+		}
+	}
+
+	groups = make([][]Model, len(models))
+	for i, model := range models {
+		if key, ok := modelKey(model, ownerKey); ok {
+			groups[i] = byKey[keyString(key)]
+		}
+	}
+	return groups, loaded, nil
+}
+
+// modelKey reads a column of a model; zero keys do not reference anything
+func modelKey(model Model, column string) (interface{}, bool) {
+	field, ok := columnFields(modelValue(model))[column]
+	if !ok {
+		return nil, false
+	}
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil, false
+		}
+		field = field.Elem()
+	}
+	if field.IsZero() {
+		return nil, false
+	}
+	return field.Interface(), true
+}
+
+// keyString compares keys across types: uint 1 and int64 1 are both "1"
+func keyString(key interface{}) string {
+	if b, ok := key.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(key)
+}
+
+// setRelation stores loaded targets in a relation field. Slices are set
+// even when empty, so a loaded relation is never nil.
+func setRelation(field reflect.Value, targets []Model) {
+	switch field.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), 0, len(targets))
+		for _, target := range targets {
+			val := reflect.ValueOf(target)
+			if field.Type().Elem().Kind() != reflect.Ptr {
+				val = val.Elem()
+			}
+			slice = reflect.Append(slice, val)
+		}
+		field.Set(slice)
+	case reflect.Ptr:
+		if len(targets) > 0 {
+			field.Set(reflect.ValueOf(targets[0]))
+		} else {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	case reflect.Struct:
+		if len(targets) > 0 {
+			field.Set(reflect.ValueOf(targets[0]).Elem())
+		}
+	}
+}
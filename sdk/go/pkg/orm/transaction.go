@@ -0,0 +1,96 @@
+package orm
+
+import (
+	"fmt"
+
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes"
+)
+
+// executor runs statements, on the adapter or inside a transaction
+type executor interface {
+	Query(query string, args ...interface{}) (*databasetypes.Result, error)
+	Execute(query string, args ...interface{}) error
+}
+
+// txState is the open transaction shared by a tx ORM and its nested calls
+type txState struct {
+	tx         databasetypes.Transaction
+	savepoints int
+}
+
+// Transaction runs fn with an ORM whose Create, Update, Delete and queries
+// run in one database transaction. The transaction commits when fn returns
+// nil and rolls back when fn returns an error or panics; a panic is
+// re-raised after the rollback.
+//
+// Calling Transaction on the tx ORM nests: the inner call runs under a
+// savepoint, so its failure rolls back only its own work. Nesting needs an
+// adapter implementing databasetypes.SavepointAdapter.
+func (orm *ORM) Transaction(fn func(tx *ORM) error) (err error) {
+	if orm.tx != nil {
+		return orm.savepoint(fn)
+	}
+
+	tx, err := orm.adapter.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	txORM := &ORM{db: tx, adapter: orm.adapter, tx: &txState{tx: tx}, models: orm.models}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(txORM); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// savepoint runs a nested Transaction under a savepoint of the open one
+func (orm *ORM) savepoint(fn func(tx *ORM) error) error {
+	sp, ok := orm.adapter.(databasetypes.SavepointAdapter)
+	if !ok || !sp.SupportsSavepoints() {
+		return fmt.Errorf("nested transactions are not supported: the adapter has no savepoints")
+	}
+
+	orm.tx.savepoints++
+	name := fmt.Sprintf("tsk_sp_%d", orm.tx.savepoints)
+	if err := orm.db.Execute("SAVEPOINT " + name); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+
+	rollback := func() error {
+		if err := orm.db.Execute("ROLLBACK TO SAVEPOINT " + name); err != nil {
+			return err
+		}
+		return orm.db.Execute("RELEASE SAVEPOINT " + name)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(orm); err != nil {
+		if rbErr := rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback to savepoint failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	if err := orm.db.Execute("RELEASE SAVEPOINT " + name); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package peanut
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/performance/jit"
+	"github.com/cyber-boost/tusktsk/pkg/performance/memory"
+)
+
+// BenchmarkOptions controls a Benchmark run
+type BenchmarkOptions struct {
+	Iterations int
+	Warmup     int
+	Write      WriteOptions
+}
+
+// DefaultBenchmarkOptions runs 1000 measured iterations after 100 warmup
+// iterations against a binary written with DefaultWriteOptions
+var DefaultBenchmarkOptions = BenchmarkOptions{Iterations: 1000, Warmup: 100, Write: DefaultWriteOptions}
+
+// BenchmarkResult is the latency distribution and allocation cost of one workload
+type BenchmarkResult struct {
+	Name        string        `json:"name"`
+	Iterations  int           `json:"iterations"`
+	Min         time.Duration `json:"min_ns"`
+	Mean        time.Duration `json:"mean_ns"`
+	P50         time.Duration `json:"p50_ns"`
+	P95         time.Duration `json:"p95_ns"`
+	P99         time.Duration `json:"p99_ns"`
+	Max         time.Duration `json:"max_ns"`
+	AllocsPerOp uint64        `json:"allocs_per_op"`
+	BytesPerOp  uint64        `json:"bytes_per_op"`
+}
+
+// BenchmarkReport is the outcome of Benchmark
+type BenchmarkReport struct {
+	File       string            `json:"file"`
+	Keys       int               `json:"keys"`
+	TextSize   int64             `json:"text_bytes"`
+	BinarySize int64             `json:"binary_bytes"`
+	Warmup     int               `json:"warmup"`
+	GoVersion  string            `json:"go_version"`
+	Platform   string            `json:"platform"`
+	Results    []BenchmarkResult `json:"results"`
+	// JIT describes the compilation of the execute workload's expressions
+	JIT *jit.CompilationStats `json:"jit"`
+	// ParserPools describes the scratch pools the parse-text workload's
+	// parses drew their temporaries from
+	ParserPools *memory.PoolStats `json:"parser_pools"`
+}
+
+// Result returns the result of the named workload
+func (r *BenchmarkReport) Result(name string) (BenchmarkResult, bool) {
+	for _, result := range r.Results {
+		if result.Name == name {
+			return result, true
+		}
+	}
+	return BenchmarkResult{}, false
+}
+
+// Benchmark workloads
+const (
+	WorkloadParseText  = "parse-text"
+	WorkloadLoadBinary = "load-binary"
+	WorkloadExecute    = "execute"
+	// WorkloadExecuteInterpreted executes without compiling hot expressions
+	WorkloadExecuteInterpreted = "execute-interpreted"
+)
+
+// Benchmark measures a text configuration against its compiled binary:
+// parsing the text file, loading the binary, and executing every key of the
+// loaded binary with the expression VM, with its expressions compiled once
+// hot and interpreted throughout. The binary is written to a temporary file
+// with opts.Write and removed afterwards.
+func Benchmark(file string, opts BenchmarkOptions) (*BenchmarkReport, error) {
+	if opts.Iterations <= 0 {
+		return nil, fmt.Errorf("iterations must be positive")
+	}
+	if opts.Warmup < 0 {
+		return nil, fmt.Errorf("warmup must not be negative")
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	if strings.HasSuffix(file, ".pnt") || strings.HasSuffix(file, ".tskb") {
+		return nil, fmt.Errorf("%s is already a binary; benchmark its text source instead", file)
+	}
+	text, err := LoadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "tsk-benchmark-*.pnt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary binary: %w", err)
+	}
+	binaryFile := tmp.Name()
+	defer os.Remove(binaryFile)
+	err = text.WriteBinary(tmp, opts.Write)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temporary binary: %w", err)
+	}
+	binaryInfo, err := os.Stat(binaryFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read temporary binary: %w", err)
+	}
+
+	loaded, err := LoadFile(binaryFile)
+	if err != nil {
+		return nil, err
+	}
+	defer loaded.Close()
+	compiler := jit.NewJITCompiler()
+	vm := NewVM()
+	vm.SetJIT(compiler)
+	interpreter := NewVM()
+	interpreter.SetJIT(nil)
+
+	workloads := []struct {
+		name string
+		run  func() error
+	}{
+		{WorkloadParseText, func() error {
+			_, err := LoadFile(file)
+			return err
+		}},
+		{WorkloadLoadBinary, func() error {
+			cfg, err := LoadFile(binaryFile)
+			if err != nil {
+				return err
+			}
+			return cfg.Close()
+		}},
+		{WorkloadExecute, func() error {
+			_, err := loaded.Execute(vm)
+			return err
+		}},
+		{WorkloadExecuteInterpreted, func() error {
+			_, err := loaded.Execute(interpreter)
+			return err
+		}},
+	}
+
+	report := &BenchmarkReport{
+		File:       file,
+		Keys:       len(text.Keys()),
+		TextSize:   info.Size(),
+		BinarySize: binaryInfo.Size(),
+		Warmup:     opts.Warmup,
+		GoVersion:  runtime.Version(),
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	for _, workload := range workloads {
+		pools := memory.Parser.Stats()
+		result, err := measure(workload.name, workload.run, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", workload.name, err)
+		}
+		if workload.name == WorkloadParseText {
+			report.ParserPools = memory.Parser.Stats().Since(pools)
+		}
+		report.Results = append(report.Results, result)
+	}
+	report.JIT = compiler.GetStats()
+	return report, nil
+}
+
+// measure runs fn Warmup times, then times each of Iterations runs.
+// Allocations are averaged over the measured runs, as testing.B does.
+func measure(name string, fn func() error, opts BenchmarkOptions) (BenchmarkResult, error) {
+	for i := 0; i < opts.Warmup; i++ {
+		if err := fn(); err != nil {
+			return BenchmarkResult{}, err
+		}
+	}
+
+	samples := make([]time.Duration, opts.Iterations)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := range samples {
+		start := time.Now()
+		if err := fn(); err != nil {
+			return BenchmarkResult{}, err
+		}
+		samples[i] = time.Since(start)
+	}
+	runtime.ReadMemStats(&after)
+
+	var total time.Duration
+	for _, sample := range samples {
+		total += sample
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	n := uint64(opts.Iterations)
+	return BenchmarkResult{
+		Name:        name,
+		Iterations:  opts.Iterations,
+		Min:         samples[0],
+		Mean:        total / time.Duration(opts.Iterations),
+		P50:         percentile(samples, 50),
+		P95:         percentile(samples, 95),
+		P99:         percentile(samples, 99),
+		Max:         samples[len(samples)-1],
+		AllocsPerOp: (after.Mallocs - before.Mallocs) / n,
+		BytesPerOp:  (after.TotalAlloc - before.TotalAlloc) / n,
+	}, nil
+}
+
+// percentile returns the nearest-rank percentile of sorted samples
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,757 @@
+package peanut
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tskbinary "github.com/cyber-boost/tusktsk/internal/binary"
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+// Binary format versions
+const (
+	// FormatV1 stores the whole flat map after a 24-byte header and must be
+	// decoded in full on load
+	FormatV1 uint32 = 1
+	// FormatV2 adds a sorted key index so single keys can be read from a
+	// memory-mapped file without decoding the rest
+	FormatV2 uint32 = 2
+	// CurrentFormat is the version written by CompileToBinary
+	CurrentFormat = FormatV2
+)
+
+// Magic identifies .pnt files
+var Magic = [4]byte{'P', 'N', 'U', 'T'}
+
+// Layout of a v2 file:
+//
+//	0   4  magic "PNUT"
+//	4   4  version (2)
+//	8   8  timestamp: modification time of the source (unix nanoseconds)
+//	       when flag bit 9 is set, otherwise the compile time (unix seconds)
+//	16  4  entry count
+//	20  4  flags: bits 0-3 compression, bits 4-7 checksum, bit 8 signed,
+//	       bit 9 source time
+//	24  8  key block offset
+//	32  8  value block offset
+//	40     index: entry count × {key offset u32, key length u32, value offset u64, value length u64}
+//	       key block: concatenated keys, sorted
+//	       value block: encoded values
+//	       signature: Ed25519 signature of header and body, when signed (64 bytes)
+//	       footer: checksum of everything before it (4 bytes CRC32 or 32 bytes SHA-256)
+//
+// All integers are little endian; offsets in index entries are relative to
+// their block. When compressed, everything between the header and the footer
+// is stored compressed and offsets refer to the decompressed layout.
+const (
+	v1HeaderSize = 24
+	v2HeaderSize = 40
+	v2EntrySize  = 24
+)
+
+// Value type tags
+const (
+	tagNil byte = iota
+	tagFalse
+	tagTrue
+	tagInt
+	tagFloat
+	tagString
+	tagArray
+	tagMap
+	tagExpr // v2 only: source string followed by the compiled Program
+)
+
+// WriteOptions controls how a binary is written
+type WriteOptions struct {
+	Version     uint32
+	Compression Compression
+	Checksum    Checksum
+	// SigningKey, when set, embeds an Ed25519 signature (v2 only)
+	SigningKey ed25519.PrivateKey
+	// SourceModTime, when set, is the modification time of the text file
+	// compiled, recorded so Load can tell when the binary is stale (v2 only)
+	SourceModTime time.Time
+}
+
+// DefaultWriteOptions writes the current format with a CRC32 footer
+var DefaultWriteOptions = WriteOptions{Version: CurrentFormat, Checksum: ChecksumCRC32}
+
+// CompileToBinary compiles a text configuration into a .pnt file using
+// DefaultWriteOptions
+func CompileToBinary(input, output string) error {
+	return CompileToBinaryWith(input, output, DefaultWriteOptions)
+}
+
+// CompileToBinaryWith compiles a text configuration into a .pnt file
+func CompileToBinaryWith(input, output string, opts WriteOptions) error {
+	info, err := os.Stat(input)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	cfg, err := LoadFile(input)
+	if err != nil {
+		return err
+	}
+	defer cfg.Close()
+
+	if opts.Version == FormatV2 {
+		opts.SourceModTime = info.ModTime()
+	}
+	var buf bytes.Buffer
+	if err := cfg.WriteBinary(&buf, opts); err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write binary: %w", err)
+	}
+	return nil
+}
+
+// WriteBinary writes the configuration in binary form
+func (c *Config) WriteBinary(w io.Writer, opts WriteOptions) error {
+	values, err := c.Values()
+	if err != nil {
+		return err
+	}
+
+	switch opts.Version {
+	case FormatV1:
+		if flags(opts.Compression, opts.Checksum) != 0 || opts.SigningKey != nil || !opts.SourceModTime.IsZero() {
+			return fmt.Errorf("compression, checksum footers, signing and source times require format v2")
+		}
+		return writeV1(w, values)
+	case FormatV2:
+		return writeV2(w, values, opts)
+	}
+	return fmt.Errorf("unsupported binary format version %d", opts.Version)
+}
+
+// LoadBinary loads a .pnt file of any supported version using
+// DefaultLoadOptions
+func LoadBinary(file string) (*Config, error) {
+	opts, err := DefaultLoadOptions()
+	if err != nil {
+		return nil, err
+	}
+	return LoadBinaryWith(file, opts)
+}
+
+// LoadBinaryWith loads a .pnt file of any supported version
+func LoadBinaryWith(file string, opts LoadOptions) (*Config, error) {
+	data, closer, err := mapFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open binary: %w", err)
+	}
+
+	version, err := readVersion(data)
+	if err != nil {
+		closer()
+		return nil, binaryError(file, err)
+	}
+
+	switch version {
+	case FormatV1:
+		if opts.PublicKey != nil {
+			closer()
+			return nil, tskerrors.New(tskerrors.Validation, "%s: v1 binaries cannot be signed and a public key is configured", file)
+		}
+		// v1 has no index, so everything is decoded and the mapping released
+		values, err := readV1(data)
+		closer()
+		if err != nil {
+			return nil, binaryError(file, err)
+		}
+		return &Config{values: values, file: file}, nil
+	case FormatV2:
+		body, decompressed, err := unwrapV2(data, opts)
+		if err != nil {
+			closer()
+			return nil, binaryError(file, err)
+		}
+		if decompressed {
+			// The body now lives in memory, so the mapping is no longer needed
+			closer()
+			closer = nil
+		}
+		index, err := openV2(body, closer)
+		if err != nil {
+			if closer != nil {
+				closer()
+			}
+			return nil, binaryError(file, err)
+		}
+		return &Config{index: index, file: file}, nil
+	}
+
+	closer()
+	return nil, tskerrors.New(tskerrors.Parse, "%s: unsupported binary format version %d", file, version)
+}
+
+// binaryError reports a failure to decode file, as a parse error unless err
+// already has a kind, such as a failed signature check
+func binaryError(file string, err error) error {
+	err = fmt.Errorf("%s: %w", file, err)
+	if tskerrors.KindOf(err) == tskerrors.Unknown {
+		return tskerrors.Wrap(tskerrors.Parse, err)
+	}
+	return err
+}
+
+func readVersion(data []byte) (uint32, error) {
+	if len(data) < 8 {
+		return 0, fmt.Errorf("file too short for a .pnt header")
+	}
+	if !bytes.Equal(data[:4], Magic[:]) {
+		return 0, fmt.Errorf("invalid magic bytes %q", data[:4])
+	}
+	return binary.LittleEndian.Uint32(data[4:8]), nil
+}
+
+// Version 1
+
+func writeV1(w io.Writer, values map[string]interface{}) error {
+	var payload bytes.Buffer
+	if err := encodeValue(tskbinary.NewBinaryWriter(&payload), values); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(payload.Bytes())
+
+	header := make([]byte, v1HeaderSize)
+	copy(header[0:4], Magic[:])
+	binary.LittleEndian.PutUint32(header[4:8], FormatV1)
+	binary.LittleEndian.PutUint64(header[8:16], uint64(time.Now().Unix()))
+	copy(header[16:24], sum[:8])
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload.Bytes())
+	return err
+}
+
+func readV1(data []byte) (map[string]interface{}, error) {
+	if len(data) < v1HeaderSize {
+		return nil, fmt.Errorf("file too short for a v1 header")
+	}
+	payload := data[v1HeaderSize:]
+	sum := sha256.Sum256(payload)
+	if !bytes.Equal(sum[:8], data[16:24]) {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+
+	value, err := decodeValue(tskbinary.NewBinaryReader(bytes.NewReader(payload)))
+	if err != nil {
+		return nil, err
+	}
+	values, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("v1 payload is not a map")
+	}
+	return values, nil
+}
+
+// Version 2
+
+func writeV2(w io.Writer, values map[string]interface{}, opts WriteOptions) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	index := make([]byte, len(keys)*v2EntrySize)
+	var keyBlock, valueBlock bytes.Buffer
+	writer := tskbinary.NewBinaryWriter(&valueBlock)
+
+	for i, key := range keys {
+		entry := index[i*v2EntrySize:]
+		binary.LittleEndian.PutUint32(entry[0:4], uint32(keyBlock.Len()))
+		binary.LittleEndian.PutUint32(entry[4:8], uint32(len(key)))
+		keyBlock.WriteString(key)
+
+		start := valueBlock.Len()
+		if err := encodeEntry(writer, values[key]); err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+		binary.LittleEndian.PutUint64(entry[8:16], uint64(start))
+		binary.LittleEndian.PutUint64(entry[16:24], uint64(valueBlock.Len()-start))
+	}
+
+	header := v2Header(len(keys), uint64(keyBlock.Len()), opts)
+
+	body := bytes.Join([][]byte{index, keyBlock.Bytes(), valueBlock.Bytes()}, nil)
+	body, err := compress(body, opts.Compression)
+	if err != nil {
+		return err
+	}
+
+	file := append(header, body...)
+	if opts.SigningKey != nil {
+		file = append(file, ed25519.Sign(opts.SigningKey, file)...)
+	}
+	footer, err := checksum(file, opts.Checksum)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(file, footer...))
+	return err
+}
+
+// v2Header builds the header of a v2 file with count entries whose keys
+// take keyBytes
+func v2Header(count int, keyBytes uint64, opts WriteOptions) []byte {
+	keyOffset := uint64(v2HeaderSize + count*v2EntrySize)
+	header := make([]byte, v2HeaderSize)
+	copy(header[0:4], Magic[:])
+	binary.LittleEndian.PutUint32(header[4:8], FormatV2)
+	binary.LittleEndian.PutUint64(header[8:16], uint64(time.Now().Unix()))
+	binary.LittleEndian.PutUint32(header[16:20], uint32(count))
+	fl := flags(opts.Compression, opts.Checksum)
+	if opts.SigningKey != nil {
+		fl |= flagSigned
+	}
+	if !opts.SourceModTime.IsZero() {
+		binary.LittleEndian.PutUint64(header[8:16], uint64(opts.SourceModTime.UnixNano()))
+		fl |= flagSourceTime
+	}
+	binary.LittleEndian.PutUint32(header[20:24], fl)
+	binary.LittleEndian.PutUint64(header[24:32], keyOffset)
+	binary.LittleEndian.PutUint64(header[32:40], keyOffset+keyBytes)
+	return header
+}
+
+// flagSourceTime marks a v2 file whose timestamp is the modification time
+// of its source
+const flagSourceTime uint32 = 1 << 9
+
+// StaleBinary reports whether the text file beside the binary file, the
+// first of peanu.tsk and peanu.peanuts, changed since file was compiled,
+// and returns it. Load skips stale binaries. A binary recording the modification time of its source
+// is stale when the source's differs; an older one when the source is
+// newer than the binary's compile time. Unreadable binaries are left for
+// the load to report.
+func StaleBinary(file string) (string, bool) {
+	var source string
+	var info os.FileInfo
+	for _, name := range searchNames {
+		if isBinaryFile(name) {
+			continue
+		}
+		candidate := filepath.Join(filepath.Dir(file), name)
+		if fi, err := os.Stat(candidate); err == nil {
+			source, info = candidate, fi
+			break
+		}
+	}
+	if info == nil {
+		return "", false
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	header := make([]byte, v1HeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header[0:4], Magic[:]) {
+		return "", false
+	}
+	stamp := int64(binary.LittleEndian.Uint64(header[8:16]))
+	if binary.LittleEndian.Uint32(header[4:8]) == FormatV2 && binary.LittleEndian.Uint32(header[20:24])&flagSourceTime != 0 {
+		return source, info.ModTime().UnixNano() != stamp
+	}
+	return source, info.ModTime().Unix() > stamp
+}
+
+// binaryIndex reads entries of a v2 file on demand
+type binaryIndex struct {
+	data       []byte
+	count      int
+	keyBlock   []byte
+	valueBlock []byte
+	closer     func() error
+
+	// interned holds the scalar value of each entry once decoded, so that
+	// repeated lookups return it without decoding or boxing it again
+	internOnce sync.Once
+	interned   []atomic.Pointer[internedValue]
+}
+
+// internedValue is a decoded scalar: nil, a bool, an int, a float64 or a
+// string
+type internedValue struct {
+	value interface{}
+}
+
+func openV2(data []byte, closer func() error) (*binaryIndex, error) {
+	if len(data) < v2HeaderSize {
+		return nil, fmt.Errorf("file too short for a v2 header")
+	}
+
+	count := int(binary.LittleEndian.Uint32(data[16:20]))
+	keyOffset := binary.LittleEndian.Uint64(data[24:32])
+	valueOffset := binary.LittleEndian.Uint64(data[32:40])
+
+	indexEnd := uint64(v2HeaderSize) + uint64(count)*v2EntrySize
+	if keyOffset != indexEnd || valueOffset < keyOffset || valueOffset > uint64(len(data)) {
+		return nil, fmt.Errorf("corrupt v2 header (truncated file?)")
+	}
+
+	return &binaryIndex{
+		data:       data,
+		count:      count,
+		keyBlock:   data[keyOffset:valueOffset],
+		valueBlock: data[valueOffset:],
+		closer:     closer,
+	}, nil
+}
+
+func (bi *binaryIndex) close() error {
+	var err error
+	if bi.closer != nil {
+		err = bi.closer()
+		bi.closer = nil
+	}
+	bi.data, bi.keyBlock, bi.valueBlock = nil, nil, nil
+	return err
+}
+
+// entry returns the key and value bytes of the i-th index entry
+func (bi *binaryIndex) entry(i int) ([]byte, []byte, error) {
+	e := bi.data[v2HeaderSize+i*v2EntrySize:]
+	keyOff := uint64(binary.LittleEndian.Uint32(e[0:4]))
+	keyLen := uint64(binary.LittleEndian.Uint32(e[4:8]))
+	valOff := binary.LittleEndian.Uint64(e[8:16])
+	valLen := binary.LittleEndian.Uint64(e[16:24])
+
+	if keyOff+keyLen > uint64(len(bi.keyBlock)) || valOff+valLen > uint64(len(bi.valueBlock)) || valOff+valLen < valOff {
+		return nil, nil, fmt.Errorf("corrupt index entry %d", i)
+	}
+	return bi.keyBlock[keyOff : keyOff+keyLen], bi.valueBlock[valOff : valOff+valLen], nil
+}
+
+func (bi *binaryIndex) key(i int) string {
+	key, _, err := bi.entry(i)
+	if err != nil {
+		return ""
+	}
+	return string(key)
+}
+
+// search returns the first entry whose key is >= key. Keys are compared
+// in place, without copying them to strings.
+func (bi *binaryIndex) search(key string) int {
+	return sort.Search(bi.count, func(i int) bool {
+		k, _, err := bi.entry(i)
+		return err == nil && string(k) >= key
+	})
+}
+
+// find returns the entry holding key
+func (bi *binaryIndex) find(key string) (int, bool) {
+	i := bi.search(key)
+	if i >= bi.count {
+		return i, false
+	}
+	k, _, err := bi.entry(i)
+	return i, err == nil && string(k) == key
+}
+
+// scalar returns the value of entry i when it is a scalar or an operator
+// expression, decoding it on first use only. Arrays and maps are not
+// interned: they are decoded for every lookup since callers may modify
+// them.
+func (bi *binaryIndex) scalar(i int) (interface{}, bool) {
+	bi.internOnce.Do(func() {
+		bi.interned = make([]atomic.Pointer[internedValue], bi.count)
+	})
+	if v := bi.interned[i].Load(); v != nil {
+		return v.value, true
+	}
+
+	_, raw, err := bi.entry(i)
+	if err != nil || len(raw) == 0 {
+		return nil, false
+	}
+	var value interface{}
+	switch raw[0] {
+	case tagNil:
+	case tagFalse:
+		value = false
+	case tagTrue:
+		value = true
+	case tagInt, tagFloat:
+		if len(raw) < 9 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint64(raw[1:9])
+		if raw[0] == tagInt {
+			value = int(int64(n))
+		} else {
+			value = math.Float64frombits(n)
+		}
+	case tagString:
+		if len(raw) < 5 || uint64(len(raw)-5) < uint64(binary.LittleEndian.Uint32(raw[1:5])) {
+			return nil, false
+		}
+		value = string(raw[5 : 5+binary.LittleEndian.Uint32(raw[1:5])])
+	case tagExpr:
+		// Lookups return the source of an expression, which takes decoding
+		// the whole program to reach
+		if _, value, err = bi.decode(i); err != nil {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	bi.interned[i].Store(&internedValue{value})
+	return value, true
+}
+
+func (bi *binaryIndex) decode(i int) (string, interface{}, error) {
+	key, raw, err := bi.entry(i)
+	if err != nil {
+		return "", nil, err
+	}
+	value, err := decodeValue(tskbinary.NewBinaryReader(bytes.NewReader(raw)))
+	if err != nil {
+		return "", nil, fmt.Errorf("key %s: %w", key, err)
+	}
+	return string(key), value, nil
+}
+
+// lookup decodes a single key, or every key in the section it names
+func (bi *binaryIndex) lookup(key string) (interface{}, bool, error) {
+	if bi.data != nil {
+		if i, ok := bi.find(key); ok {
+			if value, ok := bi.scalar(i); ok {
+				return value, true, nil
+			}
+		}
+	}
+	return bi.lookupWith(key, bi.decode)
+}
+
+// lookupWith is lookup with a custom entry decoder
+func (bi *binaryIndex) lookupWith(key string, decode func(i int) (string, interface{}, error)) (interface{}, bool, error) {
+	if bi.data == nil {
+		return nil, false, fmt.Errorf("configuration is closed")
+	}
+
+	if i, ok := bi.find(key); ok {
+		_, value, err := decode(i)
+		return value, err == nil, err
+	}
+
+	// Keys are sorted, so a section's entries are contiguous among those
+	// starting with key, after siblings such as "key-x" and before "key/x"
+	var section map[string]interface{}
+	for j := bi.search(key); j < bi.count; j++ {
+		k, _, err := bi.entry(j)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(k) <= len(key) || string(k[:len(key)]) != key || k[len(key)] > '.' {
+			break
+		}
+		if k[len(key)] != '.' {
+			continue
+		}
+		name, value, err := decode(j)
+		if err != nil {
+			return nil, false, err
+		}
+		if section == nil {
+			section = make(map[string]interface{})
+		}
+		section[name[len(key)+1:]] = value
+	}
+	if section == nil {
+		return nil, false, nil
+	}
+	return config.Nest(section), true, nil
+}
+
+func (bi *binaryIndex) keys() []string {
+	keys := make([]string, 0, bi.count)
+	for i := 0; i < bi.count; i++ {
+		keys = append(keys, bi.key(i))
+	}
+	return keys
+}
+
+func (bi *binaryIndex) all() (map[string]interface{}, error) {
+	if bi.data == nil {
+		return nil, fmt.Errorf("configuration is closed")
+	}
+
+	values := make(map[string]interface{}, bi.count)
+	for i := 0; i < bi.count; i++ {
+		key, value, err := bi.decode(i)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// Value encoding
+
+// encodeEntry encodes a top-level v2 value, compiling operator expressions
+// so they can be executed without re-parsing
+func encodeEntry(w *tskbinary.BinaryWriter, value interface{}) error {
+	if s, ok := value.(string); ok && isExpression(s) {
+		if program, err := CompileExpression(s); err == nil {
+			if err := w.WriteBytes([]byte{tagExpr}); err != nil {
+				return err
+			}
+			return encodeProgram(w, program)
+		}
+	}
+	return encodeValue(w, value)
+}
+
+func encodeValue(w *tskbinary.BinaryWriter, value interface{}) error {
+	write := func(tag byte) error { return w.WriteBytes([]byte{tag}) }
+
+	switch v := value.(type) {
+	case nil:
+		return write(tagNil)
+	case bool:
+		if v {
+			return write(tagTrue)
+		}
+		return write(tagFalse)
+	case int:
+		if err := write(tagInt); err != nil {
+			return err
+		}
+		return w.WriteUint64(uint64(int64(v)))
+	case int64:
+		if err := write(tagInt); err != nil {
+			return err
+		}
+		return w.WriteUint64(uint64(v))
+	case float64:
+		if err := write(tagFloat); err != nil {
+			return err
+		}
+		return w.WriteUint64(math.Float64bits(v))
+	case string:
+		if err := write(tagString); err != nil {
+			return err
+		}
+		return w.WriteString(v)
+	case []interface{}:
+		if err := write(tagArray); err != nil {
+			return err
+		}
+		if err := w.WriteUint32(uint32(len(v))); err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err := encodeValue(w, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		if err := write(tagMap); err != nil {
+			return err
+		}
+		if err := w.WriteUint32(uint32(len(v))); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := w.WriteString(key); err != nil {
+				return err
+			}
+			if err := encodeValue(w, v[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported value type %T", value)
+}
+
+func decodeValue(r *tskbinary.BinaryReader) (interface{}, error) {
+	tag, err := r.ReadBytes(1)
+	if err != nil {
+		return nil, fmt.Errorf("truncated value: %w", err)
+	}
+
+	switch tag[0] {
+	case tagNil:
+		return nil, nil
+	case tagFalse:
+		return false, nil
+	case tagTrue:
+		return true, nil
+	case tagInt:
+		n, err := r.ReadUint64()
+		return int(int64(n)), err
+	case tagFloat:
+		n, err := r.ReadUint64()
+		return math.Float64frombits(n), err
+	case tagString:
+		return r.ReadString()
+	case tagArray:
+		n, err := r.ReadUint32()
+		if err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, 0, min(int(n), 1024))
+		for i := uint32(0); i < n; i++ {
+			item, err := decodeValue(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case tagMap:
+		n, err := r.ReadUint32()
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, min(int(n), 1024))
+		for i := uint32(0); i < n; i++ {
+			key, err := r.ReadString()
+			if err != nil {
+				return nil, err
+			}
+			if m[key], err = decodeValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case tagExpr:
+		program, err := decodeProgram(r)
+		if err != nil {
+			return nil, err
+		}
+		return program.Source, nil
+	}
+	return nil, fmt.Errorf("unknown value tag %d", tag[0])
+}
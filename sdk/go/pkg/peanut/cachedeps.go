@@ -0,0 +1,155 @@
+package peanut
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/operators"
+)
+
+// CacheDependency is what one @cache entry of a configuration is computed
+// from. Expressions cannot read other keys, so an entry depends on the keys
+// whose expression computes it and on the environment it reads.
+type CacheDependency struct {
+	CacheKey string `json:"cache_key"`
+	// ConfigKeys are the keys whose expression stores the entry, sorted
+	ConfigKeys []string `json:"config_keys"`
+	// Env are the variables read through @env inside the @cache, sorted
+	Env []string `json:"env,omitempty"`
+}
+
+// CacheDependencies returns the dependency graph of the @cache entries of
+// the configuration, sorted by cache key
+func (c *Config) CacheDependencies() ([]CacheDependency, error) {
+	values, err := c.Values()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	byKey := make(map[string]*CacheDependency)
+	var graph []*CacheDependency
+	for _, key := range keys {
+		for _, entry := range cacheEntriesOf(values[key]) {
+			dep, ok := byKey[entry.key]
+			if !ok {
+				dep = &CacheDependency{CacheKey: entry.key}
+				byKey[entry.key] = dep
+				graph = append(graph, dep)
+			}
+			dep.ConfigKeys = appendMissing(dep.ConfigKeys, key)
+			for _, variable := range entry.env {
+				dep.Env = appendMissing(dep.Env, variable)
+			}
+		}
+	}
+
+	deps := make([]CacheDependency, len(graph))
+	for i, dep := range graph {
+		sort.Strings(dep.Env)
+		deps[i] = *dep
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].CacheKey < deps[j].CacheKey })
+	return deps, nil
+}
+
+// InvalidateCache drops the @cache entries computed by a key under one of
+// prefixes, or reading one of the environment variables env, from the store
+// this configuration selects, and returns their dependencies. A prefix
+// matches whole segments: "db" covers db and db.host but not dbx.
+func (c *Config) InvalidateCache(prefixes, env []string) ([]CacheDependency, error) {
+	graph, err := c.CacheDependencies()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.configureCacheStore(); err != nil {
+		return nil, err
+	}
+
+	invalidated := []CacheDependency{}
+	var keys []string
+	for _, dep := range graph {
+		if dependsOn(dep, prefixes, env) {
+			invalidated = append(invalidated, dep)
+			keys = append(keys, dep.CacheKey)
+		}
+	}
+	if err := operators.DeleteCache(keys...); err != nil {
+		return nil, err
+	}
+	return invalidated, nil
+}
+
+// dependsOn reports whether dep reads a key under one of prefixes or one
+// of the variables env
+func dependsOn(dep CacheDependency, prefixes, env []string) bool {
+	for _, key := range dep.ConfigKeys {
+		for _, prefix := range prefixes {
+			if underPrefix(key, prefix) {
+				return true
+			}
+		}
+	}
+	for _, variable := range dep.Env {
+		for _, name := range env {
+			if variable == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// underPrefix reports whether key is prefix or one of its children
+func underPrefix(key, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, ".")
+	return key == prefix || strings.HasPrefix(key, prefix+".")
+}
+
+// changedCacheKeys returns the @cache keys stored by the old and the new
+// values of changed keys, which a reload makes stale
+func changedCacheKeys(changes []KeyChange) []string {
+	var keys []string
+	for _, change := range changes {
+		for _, value := range []interface{}{change.Old, change.New} {
+			for _, entry := range cacheEntriesOf(value) {
+				keys = appendMissing(keys, entry.key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cacheEntriesOf returns the compiled @cache entries of the expressions in
+// a value
+func cacheEntriesOf(value interface{}) []cacheEntry {
+	switch v := value.(type) {
+	case string:
+		if !isExpression(v) {
+			return nil
+		}
+		program, err := CompileExpression(v)
+		if err != nil {
+			return nil
+		}
+		return program.cacheEntries()
+	case []interface{}:
+		var entries []cacheEntry
+		for _, item := range v {
+			entries = append(entries, cacheEntriesOf(item)...)
+		}
+		return entries
+	case map[string]interface{}:
+		var entries []cacheEntry
+		for _, item := range v {
+			entries = append(entries, cacheEntriesOf(item)...)
+		}
+		return entries
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package peanut
+
+import (
+	"time"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/operators"
+	perfcache "github.com/cyber-boost/tusktsk/pkg/performance/cache"
+)
+
+// Statuses of a WarmedKey
+const (
+	// WarmEvaluated means the expression ran and its value was stored
+	WarmEvaluated = "evaluated"
+	// WarmCached means the store already held the value
+	WarmCached = "cached"
+	// WarmSkipped means the key evaluated without reaching the @cache,
+	// as in the branch of a condition not taken
+	WarmSkipped = "skipped"
+	// WarmFailed means evaluating the key failed
+	WarmFailed = "failed"
+)
+
+// WarmReport is the result of WarmCache
+type WarmReport struct {
+	// Snapshot is the access log the keys were ranked by
+	Snapshot string      `json:"snapshot"`
+	Keys     []WarmedKey `json:"keys"`
+	// Unknown counts logged keys no @cache of this configuration stores,
+	// such as those of expressions since edited
+	Unknown int `json:"unknown"`
+}
+
+// WarmedKey is one @cache entry WarmCache filled
+type WarmedKey struct {
+	CacheKey string `json:"cache_key"`
+	// ConfigKey is the key whose expression computes the entry
+	ConfigKey string        `json:"config_key"`
+	Lookups   int64         `json:"lookups"`
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+// WarmCache fills the @cache store ahead of time with the top entries of
+// the access log a tiered cache records (cache.access_log): each is
+// computed by evaluating the configuration key whose @cache stores it, so
+// its operators run now rather than on the first lookup. Entries the store
+// already holds are left alone. top of 0 or less warms every logged entry
+// this configuration computes.
+func (c *Config) WarmCache(vm *VM, top int) (*WarmReport, error) {
+	file, err := c.cacheAccessLog()
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := perfcache.LoadAccessSnapshot(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshot.Keys) == 0 {
+		return nil, tskerrors.New(tskerrors.NotFound, "no cache accesses recorded in %s; they are recorded while [cache] backend is \"tiered\"", file)
+	}
+	sources, err := c.cacheSources()
+	if err != nil {
+		return nil, err
+	}
+	// Select the store before asking it what it holds
+	vm, err = c.configureOperators(vm)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &WarmReport{Snapshot: file, Keys: []WarmedKey{}}
+	for _, access := range snapshot.Keys {
+		if top > 0 && len(report.Keys) == top {
+			break
+		}
+		configKey, ok := sources[access.Key]
+		if !ok {
+			report.Unknown++
+			continue
+		}
+		warmed := WarmedKey{CacheKey: access.Key, ConfigKey: configKey, Lookups: access.Count}
+		if cached, err := operators.CacheContains(access.Key); err == nil && cached {
+			warmed.Status = WarmCached
+			report.Keys = append(report.Keys, warmed)
+			continue
+		}
+		start := time.Now()
+		_, _, err := c.Resolve(configKey, vm)
+		warmed.Duration = time.Since(start)
+		switch stored, _ := operators.CacheContains(access.Key); {
+		case err != nil:
+			warmed.Status, warmed.Error = WarmFailed, err.Error()
+		case stored:
+			warmed.Status = WarmEvaluated
+		default:
+			warmed.Status = WarmSkipped
+		}
+		report.Keys = append(report.Keys, warmed)
+	}
+	return report, nil
+}
+
+// cacheSources maps the key of each compiled @cache in the configuration
+// to the first configuration key, in sorted order, that computes it
+func (c *Config) cacheSources() (map[string]string, error) {
+	graph, err := c.CacheDependencies()
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]string, len(graph))
+	for _, dep := range graph {
+		sources[dep.CacheKey] = dep.ConfigKeys[0]
+	}
+	return sources, nil
+}
@@ -0,0 +1,550 @@
+package peanut
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tskbinary "github.com/cyber-boost/tusktsk/internal/binary"
+	"github.com/cyber-boost/tusktsk/pkg/config"
+)
+
+// MaxTextFileSize is the largest text file LoadFile parses in memory.
+// Parsing takes several times the file size in RAM, so larger files are
+// refused and must be compiled with CompileChunked. Zero disables the guard.
+var MaxTextFileSize int64 = 1 << 30
+
+// DefaultChunkSize is the amount of text CompileChunked parses at a time
+const DefaultChunkSize = 64 << 20
+
+// Compile phases reported through CompileProgress
+const (
+	PhaseParse = "parse"
+	PhaseMerge = "merge"
+)
+
+// ChunkedOptions controls CompileChunked
+type ChunkedOptions struct {
+	// Write selects the output format; only v2 without signing is supported
+	// because the file is streamed rather than built in memory
+	Write WriteOptions
+	// ChunkSize bounds the text parsed at once (default DefaultChunkSize).
+	// Chunks end at [section] headers, so one section is never split.
+	ChunkSize int64
+	// RateLimit caps reads from the input in bytes per second; 0 is unlimited
+	RateLimit int64
+	// WorkDir holds sorted runs and the checkpoint (default output + ".parts").
+	// Its files are removed once the output is written.
+	WorkDir string
+	// Progress, when set, is called after every chunk and periodically
+	// while merging
+	Progress func(CompileProgress)
+}
+
+// CompileProgress reports how far CompileChunked has got
+type CompileProgress struct {
+	Phase   string
+	Done    int64
+	Total   int64
+	Elapsed time.Duration
+	ETA     time.Duration
+	// Resumed is set when the parse phase continued from a checkpoint
+	Resumed bool
+}
+
+// chunkCheckpoint records the chunks already turned into runs. It is only
+// reused for the same input file and chunk size.
+type chunkCheckpoint struct {
+	Input     string    `json:"input"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	ChunkSize int64     `json:"chunk_size"`
+	Offset    int64     `json:"offset"`
+	Runs      int       `json:"runs"`
+}
+
+const checkpointFile = "checkpoint.json"
+
+// CompileChunked compiles a text configuration of any size into a v2
+// binary with bounded memory. The input is parsed chunk by chunk into
+// sorted runs on disk, which are then merged into the output. A checkpoint
+// is written after every chunk, so an interrupted compile (ctx cancelled,
+// process killed) resumes where it stopped when run again with the same
+// input, output and chunk size. When a key is set in several chunks the
+// last one wins.
+func CompileChunked(ctx context.Context, input, output string, opts ChunkedOptions) error {
+	if opts.Write.Version == 0 {
+		opts.Write.Version = FormatV2
+	}
+	if opts.Write.Version != FormatV2 {
+		return fmt.Errorf("chunked compilation requires format v2")
+	}
+	if opts.Write.SigningKey != nil {
+		return fmt.Errorf("chunked compilation cannot sign; Ed25519 needs the whole file in memory")
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	if opts.WorkDir == "" {
+		opts.WorkDir = output + ".parts"
+	}
+	if opts.Progress == nil {
+		opts.Progress = func(CompileProgress) {}
+	}
+
+	info, err := os.Stat(input)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", input, err)
+	}
+	opts.Write.SourceModTime = info.ModTime()
+	if err := os.MkdirAll(opts.WorkDir, 0755); err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+
+	cp := chunkCheckpoint{Input: input, Size: info.Size(), ModTime: info.ModTime().UTC(), ChunkSize: opts.ChunkSize}
+	resumed := false
+	if saved, err := readCheckpoint(opts.WorkDir); err == nil && saved.Input == cp.Input && saved.Size == cp.Size &&
+		saved.ModTime.Equal(cp.ModTime) && saved.ChunkSize == cp.ChunkSize {
+		cp = *saved
+		resumed = cp.Offset > 0
+	} else if err := cleanWorkDir(opts.WorkDir); err != nil {
+		return err
+	}
+
+	if err := parseChunks(ctx, input, &cp, resumed, opts); err != nil {
+		return err
+	}
+	if err := mergeRuns(ctx, output, cp.Runs, opts); err != nil {
+		return err
+	}
+	if err := cleanWorkDir(opts.WorkDir); err != nil {
+		return err
+	}
+	// Only succeeds when the directory held nothing but our files
+	os.Remove(opts.WorkDir)
+	return nil
+}
+
+// cleanWorkDir removes the runs, blocks and checkpoint of an earlier
+// compile, leaving anything else in dir alone
+func cleanWorkDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "run-*"))
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{checkpointFile, "index", "keys", "values"} {
+		files = append(files, filepath.Join(dir, name))
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to clean work directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseChunks turns the input from cp.Offset on into sorted runs
+func parseChunks(ctx context.Context, input string, cp *chunkCheckpoint, resumed bool, opts ChunkedOptions) error {
+	file, err := os.Open(input)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", input, err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(cp.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to resume %s: %w", input, err)
+	}
+
+	var reader io.Reader = file
+	if opts.RateLimit > 0 {
+		reader = &throttledReader{r: file, rate: opts.RateLimit, start: time.Now()}
+	}
+	lines := bufio.NewReaderSize(reader, 1<<20)
+
+	start, startOffset := time.Now(), cp.Offset
+	var chunk bytes.Buffer
+	offset := cp.Offset
+
+	flush := func() error {
+		if chunk.Len() == 0 {
+			return nil
+		}
+		if err := writeRun(opts.WorkDir, cp.Runs, chunk.Bytes()); err != nil {
+			return err
+		}
+		cp.Runs++
+		cp.Offset = offset
+		chunk.Reset()
+		if err := writeCheckpoint(opts.WorkDir, cp); err != nil {
+			return err
+		}
+		opts.Progress(progress(PhaseParse, cp.Offset-startOffset, cp.Offset, cp.Size, start, resumed))
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("compile interrupted after %d of %d bytes (run again to resume): %w", cp.Offset, cp.Size, err)
+		}
+
+		line, err := lines.ReadBytes('\n')
+		if len(line) > 0 {
+			if int64(chunk.Len()) >= opts.ChunkSize && isSectionHeader(line) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			chunk.Write(line)
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", input, err)
+		}
+	}
+}
+
+// isSectionHeader reports whether line is a [section] header, after which
+// the parser holds no state from earlier lines
+func isSectionHeader(line []byte) bool {
+	s := strings.TrimSpace(string(line))
+	return strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") && !strings.Contains(s, ":")
+}
+
+// writeRun parses one chunk and writes its entries, sorted by key, as
+// {key length u32, key, value length u32, encoded value} records
+func writeRun(dir string, n int, chunk []byte) error {
+	cfg := config.New()
+	if err := cfg.LoadTSK(chunk); err != nil {
+		return fmt.Errorf("failed to parse chunk %d: %w", n, err)
+	}
+	values := cfg.Values()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	path := runPath(dir, n)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create run: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	var encoded bytes.Buffer
+	writer := tskbinary.NewBinaryWriter(&encoded)
+	for _, key := range keys {
+		encoded.Reset()
+		if err := encodeEntry(writer, values[key]); err != nil {
+			tmp.Close()
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+		writeRecord(w, []byte(key), encoded.Bytes())
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeRecord(w *bufio.Writer, key, value []byte) {
+	w.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(key))))
+	w.Write(key)
+	w.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(value))))
+	w.Write(value)
+}
+
+func runPath(dir string, n int) string {
+	return filepath.Join(dir, fmt.Sprintf("run-%06d", n))
+}
+
+// runReader reads the records of one run in key order
+type runReader struct {
+	file  *os.File
+	r     *bufio.Reader
+	n     int
+	key   []byte
+	value []byte
+	read  int64
+}
+
+func (rr *runReader) next() (bool, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(rr.r, size[:]); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, fmt.Errorf("corrupt run %d: %w", rr.n, err)
+	}
+	rr.key = make([]byte, binary.LittleEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(rr.r, rr.key); err != nil {
+		return false, fmt.Errorf("corrupt run %d: %w", rr.n, err)
+	}
+	if _, err := io.ReadFull(rr.r, size[:]); err != nil {
+		return false, fmt.Errorf("corrupt run %d: %w", rr.n, err)
+	}
+	rr.value = make([]byte, binary.LittleEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(rr.r, rr.value); err != nil {
+		return false, fmt.Errorf("corrupt run %d: %w", rr.n, err)
+	}
+	rr.read += int64(8 + len(rr.key) + len(rr.value))
+	return true, nil
+}
+
+// runHeap orders runs by their current key; for equal keys the later run
+// comes first so that its value wins
+type runHeap []*runReader
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if c := bytes.Compare(h[i].key, h[j].key); c != 0 {
+		return c < 0
+	}
+	return h[i].n > h[j].n
+}
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	rr := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return rr
+}
+
+// mergeRuns merges the runs into the index, key and value blocks in the
+// work directory, then streams them into output
+func mergeRuns(ctx context.Context, output string, runs int, opts ChunkedOptions) error {
+	var readers []*runReader
+	defer func() {
+		for _, rr := range readers {
+			rr.file.Close()
+		}
+	}()
+
+	var total int64
+	h := &runHeap{}
+	for n := 0; n < runs; n++ {
+		file, err := os.Open(runPath(opts.WorkDir, n))
+		if err != nil {
+			return fmt.Errorf("failed to open run %d (delete %s to start over): %w", n, opts.WorkDir, err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to open run %d: %w", n, err)
+		}
+		total += info.Size()
+		rr := &runReader{file: file, r: bufio.NewReaderSize(file, 256<<10), n: n}
+		readers = append(readers, rr)
+		ok, err := rr.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Push(h, rr)
+		}
+	}
+
+	blocks := make([]*os.File, 3)
+	for i, name := range []string{"index", "keys", "values"} {
+		f, err := os.Create(filepath.Join(opts.WorkDir, name))
+		if err != nil {
+			return fmt.Errorf("failed to create %s block: %w", name, err)
+		}
+		defer f.Close()
+		blocks[i] = f
+	}
+	index, keys, values := bufio.NewWriter(blocks[0]), bufio.NewWriter(blocks[1]), bufio.NewWriter(blocks[2])
+
+	start := time.Now()
+	var count int
+	var keyBytes, valueBytes uint64
+	var last []byte
+	entry := make([]byte, v2EntrySize)
+	for h.Len() > 0 {
+		rr := (*h)[0]
+		if last == nil || !bytes.Equal(rr.key, last) {
+			if keyBytes+uint64(len(rr.key)) > 1<<32-1 {
+				return fmt.Errorf("keys exceed the 4 GiB key block of the v2 format")
+			}
+			binary.LittleEndian.PutUint32(entry[0:4], uint32(keyBytes))
+			binary.LittleEndian.PutUint32(entry[4:8], uint32(len(rr.key)))
+			binary.LittleEndian.PutUint64(entry[8:16], valueBytes)
+			binary.LittleEndian.PutUint64(entry[16:24], uint64(len(rr.value)))
+			index.Write(entry)
+			keys.Write(rr.key)
+			values.Write(rr.value)
+			keyBytes += uint64(len(rr.key))
+			valueBytes += uint64(len(rr.value))
+			last = rr.key
+			count++
+
+			if count%100000 == 0 {
+				if err := ctx.Err(); err != nil {
+					return fmt.Errorf("compile interrupted while merging (run again to resume): %w", err)
+				}
+				opts.Progress(progress(PhaseMerge, mergedBytes(readers), mergedBytes(readers), total, start, false))
+			}
+		}
+
+		ok, err := rr.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	for _, w := range []*bufio.Writer{index, keys, values} {
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to write block: %w", err)
+		}
+	}
+	opts.Progress(progress(PhaseMerge, total, total, total, start, false))
+
+	return assembleV2(output, count, keyBytes, blocks, opts.Write)
+}
+
+func mergedBytes(readers []*runReader) int64 {
+	var n int64
+	for _, rr := range readers {
+		n += rr.read
+	}
+	return n
+}
+
+// assembleV2 writes the header and blocks to output, compressing the body
+// and appending the checksum footer as writeV2 does
+func assembleV2(output string, count int, keyBytes uint64, blocks []*os.File, opts WriteOptions) error {
+	tmp, err := os.Create(output + ".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write binary: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	sum, footer, err := newChecksum(opts.Checksum)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	out := bufio.NewWriterSize(tmp, 1<<20)
+	hashed := io.MultiWriter(out, sum)
+
+	if _, err := hashed.Write(v2Header(count, keyBytes, opts)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write binary: %w", err)
+	}
+	body, err := compressWriter(hashed, opts.Compression)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	for _, block := range blocks {
+		if _, err := block.Seek(0, io.SeekStart); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to read block: %w", err)
+		}
+		if _, err := io.Copy(body, block); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write binary: %w", err)
+		}
+	}
+	if err := body.Close(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write binary: %w", err)
+	}
+	out.Write(footer())
+	if err := out.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write binary: %w", err)
+	}
+	return os.Rename(tmp.Name(), output)
+}
+
+func readCheckpoint(dir string) (*chunkCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Join(dir, checkpointFile))
+	if err != nil {
+		return nil, err
+	}
+	var cp chunkCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	// Every run the checkpoint counts must still be there
+	for n := 0; n < cp.Runs; n++ {
+		if _, err := os.Stat(runPath(dir, n)); err != nil {
+			return nil, errors.New("checkpoint refers to a missing run")
+		}
+	}
+	return &cp, nil
+}
+
+func writeCheckpoint(dir string, cp *chunkCheckpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, checkpointFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// progress estimates the time left from the rate since start
+func progress(phase string, doneSinceStart, done, total int64, start time.Time, resumed bool) CompileProgress {
+	p := CompileProgress{Phase: phase, Done: done, Total: total, Elapsed: time.Since(start), Resumed: resumed}
+	if doneSinceStart > 0 && total > done {
+		p.ETA = time.Duration(float64(p.Elapsed) * float64(total-done) / float64(doneSinceStart))
+	}
+	return p
+}
+
+// throttledReader limits reads to rate bytes per second on average
+type throttledReader struct {
+	r     io.Reader
+	rate  int64
+	start time.Time
+	read  int64
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Keep single reads to a tenth of a second's worth so the rate stays smooth
+	if max := int(t.rate / 10); max > 0 && len(p) > max {
+		p = p[:max]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+	due := time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second))
+	if wait := due - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
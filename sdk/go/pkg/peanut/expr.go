@@ -0,0 +1,724 @@
+package peanut
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	tskbinary "github.com/cyber-boost/tusktsk/internal/binary"
+	"github.com/cyber-boost/tusktsk/pkg/operators"
+	"github.com/cyber-boost/tusktsk/pkg/performance/memory"
+)
+
+// Opcodes of compiled expressions. Operands are little-endian uint16s;
+// jump targets are absolute offsets into the code.
+const (
+	opConst           byte = iota + 1 // push consts[a]
+	opCall                            // call operator consts[a] with b (uint8) arguments
+	opJump                            // jump to a
+	opJumpIfFalse                     // pop, jump to a if falsy
+	opJumpIfFalseKeep                 // jump to a if top is falsy, else pop (&&)
+	opJumpIfTrueKeep                  // jump to a if top is truthy, else pop (||)
+	opNot
+	opEq
+	opNe
+	opLt
+	opGt
+	opLe
+	opGe
+)
+
+// Program is a compiled operator expression such as
+// @env("MODE") == "prod" ? @env("DB_HOST") : "localhost"
+type Program struct {
+	Source string
+	Consts []interface{}
+	Code   []byte
+}
+
+// CompileExpression compiles an operator expression. Values without an
+// operator call (plain strings, e-mail addresses) are rejected, so callers
+// can use it to decide whether a string is an expression at all.
+func CompileExpression(source string) (*Program, error) {
+	p := &exprParser{src: source}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	c := &exprCompiler{program: &Program{Source: source}}
+	if err := p.parseTernary(c); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.tok.text, p.tok.pos)
+	}
+	if !c.calls {
+		return nil, fmt.Errorf("not an operator expression")
+	}
+	return c.program, nil
+}
+
+// Operators returns the names of the operators the program calls, without
+// the @, sorted and without repeats. The lookups @cache compiles to are
+// reported as cache.
+func (p *Program) Operators() []string {
+	seen := memory.Parser.Set()
+	defer memory.Parser.PutSet(seen)
+	var names []string
+	for pc := 0; pc < len(p.Code); {
+		op := p.Code[pc]
+		pc++
+		switch op {
+		case opCall:
+			if pc+2 <= len(p.Code) {
+				index := int(binary.LittleEndian.Uint16(p.Code[pc:]))
+				if index < len(p.Consts) {
+					name, _ := p.Consts[index].(string)
+					if name == "cache.get" || name == "cache.value" {
+						name = "cache"
+					}
+					if name != "" && !seen[name] {
+						seen[name] = true
+						names = append(names, name)
+					}
+				}
+			}
+			pc += 3
+		case opConst, opJump, opJumpIfFalse, opJumpIfFalseKeep, opJumpIfTrueKeep:
+			pc += 2
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CacheKeys returns the keys the program's compiled @cache expressions
+// store their values under, in the order they appear
+func (p *Program) CacheKeys() []string {
+	var keys []string
+	for _, entry := range p.cacheEntries() {
+		keys = append(keys, entry.key)
+	}
+	return keys
+}
+
+// cacheEntry is one compiled @cache of a program and the environment
+// variables its expression reads through @env with a literal name
+type cacheEntry struct {
+	key string
+	env []string
+}
+
+// cacheEntries walks the code of the program once, following which values
+// on the stack are literals so that the key of each @cache lookup and the
+// names passed to @env are known. The walk is linear: both arms of a
+// condition are visited, which is what a dependency needs.
+func (p *Program) cacheEntries() []cacheEntry {
+	var entries []cacheEntry
+	// open indexes the entries whose expression the walk is inside
+	var open []int
+	// stack holds the constant index of each value, or -1 for computed ones
+	var stack []int
+	pop := func(n int) []int {
+		if n > len(stack) {
+			n = len(stack)
+		}
+		args := append([]int(nil), stack[len(stack)-n:]...)
+		stack = stack[:len(stack)-n]
+		return args
+	}
+	literal := func(index int) (string, bool) {
+		if index < 0 || index >= len(p.Consts) {
+			return "", false
+		}
+		s, ok := p.Consts[index].(string)
+		return s, ok
+	}
+
+	for pc := 0; pc < len(p.Code); {
+		op := p.Code[pc]
+		pc++
+		switch op {
+		case opConst:
+			if pc+2 <= len(p.Code) {
+				stack = append(stack, int(binary.LittleEndian.Uint16(p.Code[pc:])))
+			}
+			pc += 2
+		case opCall:
+			if pc+3 > len(p.Code) {
+				return entries
+			}
+			name, _ := literal(int(binary.LittleEndian.Uint16(p.Code[pc:])))
+			args := pop(int(p.Code[pc+2]))
+			pc += 3
+			switch name {
+			case "cache.get":
+				if len(args) == 1 {
+					if key, ok := literal(args[0]); ok {
+						entries = append(entries, cacheEntry{key: key})
+						open = append(open, len(entries)-1)
+					}
+				}
+			case "cache":
+				// The store of a compiled @cache closes its expression
+				if len(args) == 3 && len(open) > 0 {
+					if key, ok := literal(args[2]); ok && key == entries[open[len(open)-1]].key {
+						open = open[:len(open)-1]
+					}
+				}
+			case "env":
+				if len(args) > 0 {
+					if variable, ok := literal(args[0]); ok {
+						for _, i := range open {
+							entries[i].env = appendMissing(entries[i].env, variable)
+						}
+					}
+				}
+			}
+			stack = append(stack, -1)
+		case opJump:
+			pc += 2
+		case opJumpIfFalse, opJumpIfFalseKeep, opJumpIfTrueKeep:
+			// Falling through pops the condition
+			pop(1)
+			pc += 2
+		case opNot:
+			pop(1)
+			stack = append(stack, -1)
+		case opEq, opNe, opLt, opGt, opLe, opGe:
+			pop(2)
+			stack = append(stack, -1)
+		}
+	}
+	return entries
+}
+
+// appendMissing appends s to list unless it is there already
+func appendMissing(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// isExpression reports whether a string should be compiled
+func isExpression(s string) bool {
+	return strings.Contains(s, "@")
+}
+
+// Compiler
+
+type exprCompiler struct {
+	program *Program
+	calls   bool
+}
+
+func (c *exprCompiler) constant(value interface{}) (uint16, error) {
+	for i, existing := range c.program.Consts {
+		if existing == value {
+			return uint16(i), nil
+		}
+	}
+	if len(c.program.Consts) > 0xffff {
+		return 0, fmt.Errorf("expression has too many constants")
+	}
+	c.program.Consts = append(c.program.Consts, value)
+	return uint16(len(c.program.Consts) - 1), nil
+}
+
+func (c *exprCompiler) emit(op byte, operands ...uint16) int {
+	c.program.Code = append(c.program.Code, op)
+	at := len(c.program.Code)
+	for _, operand := range operands {
+		c.program.Code = binary.LittleEndian.AppendUint16(c.program.Code, operand)
+	}
+	return at
+}
+
+// call emits a call of operator name with argc arguments
+func (c *exprCompiler) call(name string, argc int) error {
+	index, err := c.constant(name)
+	if err != nil {
+		return err
+	}
+	c.emit(opCall, index)
+	c.program.Code = append(c.program.Code, byte(argc))
+	c.calls = true
+	return nil
+}
+
+// patch points the jump operand at offset to the current end of code
+func (c *exprCompiler) patch(at int) {
+	binary.LittleEndian.PutUint16(c.program.Code[at:], uint16(len(c.program.Code)))
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokOperator
+	tokIdent
+	tokNumber
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	src string
+	pos int
+	tok token
+}
+
+func (p *exprParser) next() error {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return nil
+	}
+
+	ch := p.src[p.pos]
+	switch {
+	case ch == '@':
+		p.pos++
+		name := p.scanIdent()
+		if name == "" {
+			return fmt.Errorf("expected operator name after @ at offset %d", start)
+		}
+		p.tok = token{kind: tokOperator, text: name + p.scanMember(), pos: start}
+	case isIdentStart(ch):
+		p.tok = token{kind: tokIdent, text: p.scanIdent(), pos: start}
+	case ch >= '0' && ch <= '9' || ch == '-' && p.pos+1 < len(p.src) && p.src[p.pos+1] >= '0' && p.src[p.pos+1] <= '9':
+		p.pos++
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.src[start:p.pos], pos: start}
+	case ch == '"' || ch == '\'':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != ch {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			return fmt.Errorf("unterminated string at offset %d", start)
+		}
+		p.pos++
+		text := p.src[start+1 : p.pos-1]
+		if ch == '"' {
+			unquoted, err := strconv.Unquote(p.src[start:p.pos])
+			if err != nil {
+				return fmt.Errorf("invalid string at offset %d: %w", start, err)
+			}
+			text = unquoted
+		}
+		p.tok = token{kind: tokString, text: text, pos: start}
+	default:
+		for _, punct := range []string{"==", "!=", "<=", ">=", "&&", "||", "(", ")", ",", "?", ":", "<", ">", "!"} {
+			if strings.HasPrefix(p.src[p.pos:], punct) {
+				p.pos += len(punct)
+				p.tok = token{kind: tokPunct, text: punct, pos: start}
+				return nil
+			}
+		}
+		return fmt.Errorf("unexpected character %q at offset %d", ch, start)
+	}
+	return nil
+}
+
+func (p *exprParser) scanIdent() string {
+	start := p.pos
+	for p.pos < len(p.src) && (isIdentStart(p.src[p.pos]) || p.src[p.pos] >= '0' && p.src[p.pos] <= '9') {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// scanMember scans the ".read" of an operator family call such as
+// @file.read(...). Without the call it scans nothing, so a value like
+// @example.com stays plain text, as do cross-file references such as
+// @peanu.tsk.get("key").
+func (p *exprParser) scanMember() string {
+	end := p.pos
+	for end+1 < len(p.src) && p.src[end] == '.' && isIdentStart(p.src[end+1]) {
+		start := end + 1
+		end += 2
+		for end < len(p.src) && (isIdentStart(p.src[end]) || p.src[end] >= '0' && p.src[end] <= '9') {
+			end++
+		}
+		if p.src[start:end] == "tsk" {
+			return ""
+		}
+	}
+	if end == p.pos || end >= len(p.src) || p.src[end] != '(' {
+		return ""
+	}
+	member := p.src[p.pos:end]
+	p.pos = end
+	return member
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+func (p *exprParser) accept(punct string) (bool, error) {
+	if p.tok.kind != tokPunct || p.tok.text != punct {
+		return false, nil
+	}
+	return true, p.next()
+}
+
+func (p *exprParser) expect(punct string) error {
+	ok, err := p.accept(punct)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("expected %q at offset %d", punct, p.tok.pos)
+	}
+	return nil
+}
+
+// Parser; each level compiles straight to bytecode
+
+func (p *exprParser) parseTernary(c *exprCompiler) error {
+	if err := p.parseOr(c); err != nil {
+		return err
+	}
+	if ok, err := p.accept("?"); err != nil || !ok {
+		return err
+	}
+
+	elseJump := c.emit(opJumpIfFalse, 0)
+	if err := p.parseTernary(c); err != nil {
+		return err
+	}
+	endJump := c.emit(opJump, 0)
+	c.patch(elseJump)
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+	if err := p.parseTernary(c); err != nil {
+		return err
+	}
+	c.patch(endJump)
+	return nil
+}
+
+func (p *exprParser) parseOr(c *exprCompiler) error {
+	if err := p.parseAnd(c); err != nil {
+		return err
+	}
+	for {
+		ok, err := p.accept("||")
+		if err != nil || !ok {
+			return err
+		}
+		jump := c.emit(opJumpIfTrueKeep, 0)
+		if err := p.parseAnd(c); err != nil {
+			return err
+		}
+		c.patch(jump)
+	}
+}
+
+func (p *exprParser) parseAnd(c *exprCompiler) error {
+	if err := p.parseComparison(c); err != nil {
+		return err
+	}
+	for {
+		ok, err := p.accept("&&")
+		if err != nil || !ok {
+			return err
+		}
+		jump := c.emit(opJumpIfFalseKeep, 0)
+		if err := p.parseComparison(c); err != nil {
+			return err
+		}
+		c.patch(jump)
+	}
+}
+
+var comparisonOps = map[string]byte{"==": opEq, "!=": opNe, "<": opLt, ">": opGt, "<=": opLe, ">=": opGe}
+
+func (p *exprParser) parseComparison(c *exprCompiler) error {
+	if err := p.parseUnary(c); err != nil {
+		return err
+	}
+	op, ok := comparisonOps[p.tok.text]
+	if p.tok.kind != tokPunct || !ok {
+		return nil
+	}
+	if err := p.next(); err != nil {
+		return err
+	}
+	if err := p.parseUnary(c); err != nil {
+		return err
+	}
+	c.emit(op)
+	return nil
+}
+
+func (p *exprParser) parseUnary(c *exprCompiler) error {
+	ok, err := p.accept("!")
+	if err != nil {
+		return err
+	}
+	if ok {
+		if err := p.parseUnary(c); err != nil {
+			return err
+		}
+		c.emit(opNot)
+		return nil
+	}
+	return p.parsePrimary(c)
+}
+
+func (p *exprParser) parsePrimary(c *exprCompiler) error {
+	tok := p.tok
+	switch tok.kind {
+	case tokOperator:
+		if err := p.next(); err != nil {
+			return err
+		}
+		if tok.text == "cache" {
+			if compiled, err := p.parseCache(c); err != nil || compiled {
+				return err
+			}
+		}
+		argc := 0
+		if ok, err := p.accept("("); err != nil {
+			return err
+		} else if ok {
+			if closed, err := p.accept(")"); err != nil {
+				return err
+			} else if !closed {
+				for {
+					if err := p.parseTernary(c); err != nil {
+						return err
+					}
+					argc++
+					if more, err := p.accept(","); err != nil {
+						return err
+					} else if !more {
+						break
+					}
+				}
+				if err := p.expect(")"); err != nil {
+					return err
+				}
+			}
+		}
+		if argc > 0xff {
+			return fmt.Errorf("too many arguments to @%s", tok.text)
+		}
+		name, err := c.constant(tok.text)
+		if err != nil {
+			return err
+		}
+		c.emit(opCall, name)
+		c.program.Code = append(c.program.Code, byte(argc))
+		c.calls = true
+		return nil
+
+	case tokPunct:
+		if tok.text != "(" {
+			return fmt.Errorf("unexpected %q at offset %d", tok.text, tok.pos)
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.parseTernary(c); err != nil {
+			return err
+		}
+		return p.expect(")")
+
+	case tokEOF:
+		return fmt.Errorf("unexpected end of expression")
+	}
+
+	var value interface{}
+	switch tok.kind {
+	case tokString:
+		value = tok.text
+	case tokNumber:
+		if n, err := strconv.Atoi(tok.text); err == nil {
+			value = n
+		} else if f, err := strconv.ParseFloat(tok.text, 64); err == nil {
+			value = f
+		} else {
+			return fmt.Errorf("invalid number %q at offset %d", tok.text, tok.pos)
+		}
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null", "nil":
+			value = nil
+		default:
+			return fmt.Errorf("unknown identifier %q at offset %d", tok.text, tok.pos)
+		}
+	}
+
+	index, err := c.constant(value)
+	if err != nil {
+		return err
+	}
+	c.emit(opConst, index)
+	return p.next()
+}
+
+// parseCache compiles @cache("5m", expr) so that expr only runs on a miss:
+//
+//	const key; call cache.get 1; jumpIfTrueKeep hit
+//	const ttl; <expr>; const key; call cache 3; jump end
+//	hit: call cache.value 1
+//	end:
+//
+// The key is a hash of the source text of expr unless a third argument
+// names one.
+// It reports false without consuming anything when the TTL is not a
+// literal, leaving @cache to compile as a plain call.
+func (p *exprParser) parseCache(c *exprCompiler) (bool, error) {
+	saved := *p
+	if ok, err := p.accept("("); err != nil || !ok {
+		*p = saved
+		return false, err
+	}
+	ttlTok := p.tok
+	if ttlTok.kind != tokString && ttlTok.kind != tokNumber {
+		*p = saved
+		return false, nil
+	}
+	if err := p.next(); err != nil {
+		return false, err
+	}
+	if ok, err := p.accept(","); err != nil || !ok {
+		*p = saved
+		return false, err
+	}
+	var ttl interface{} = ttlTok.text
+	if ttlTok.kind == tokNumber {
+		n, err := strconv.Atoi(ttlTok.text)
+		if err != nil {
+			return false, fmt.Errorf("invalid @cache TTL %q at offset %d", ttlTok.text, ttlTok.pos)
+		}
+		ttl = n
+	}
+
+	keyAt := c.emit(opConst, 0)
+	if err := c.call("cache.get", 1); err != nil {
+		return false, err
+	}
+	hitJump := c.emit(opJumpIfTrueKeep, 0)
+	ttlIndex, err := c.constant(ttl)
+	if err != nil {
+		return false, err
+	}
+	c.emit(opConst, ttlIndex)
+
+	start := p.tok.pos
+	if err := p.parseTernary(c); err != nil {
+		return false, err
+	}
+	key := operators.CacheKey(strings.TrimSpace(p.src[start:p.tok.pos]))
+	if ok, err := p.accept(","); err != nil {
+		return false, err
+	} else if ok {
+		if p.tok.kind != tokString {
+			return false, fmt.Errorf("@cache key must be a string at offset %d", p.tok.pos)
+		}
+		key = p.tok.text
+		if err := p.next(); err != nil {
+			return false, err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return false, err
+	}
+
+	keyIndex, err := c.constant(key)
+	if err != nil {
+		return false, err
+	}
+	binary.LittleEndian.PutUint16(c.program.Code[keyAt:], keyIndex)
+	c.emit(opConst, keyIndex)
+	if err := c.call("cache", 3); err != nil {
+		return false, err
+	}
+	endJump := c.emit(opJump, 0)
+	c.patch(hitJump)
+	if err := c.call("cache.value", 1); err != nil {
+		return false, err
+	}
+	c.patch(endJump)
+	return true, nil
+}
+
+// Serialization, used for tagExpr values in v2 binaries
+
+func encodeProgram(w *tskbinary.BinaryWriter, program *Program) error {
+	if err := w.WriteString(program.Source); err != nil {
+		return err
+	}
+	if err := encodeValue(w, program.Consts); err != nil {
+		return err
+	}
+	if err := w.WriteUint32(uint32(len(program.Code))); err != nil {
+		return err
+	}
+	return w.WriteBytes(program.Code)
+}
+
+func decodeProgram(r *tskbinary.BinaryReader) (*Program, error) {
+	source, err := r.ReadString()
+	if err != nil {
+		return nil, err
+	}
+	consts, err := decodeValue(r)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := consts.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("corrupt expression constants")
+	}
+	n, err := r.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+	code, err := r.ReadBytes(int(n))
+	if err != nil {
+		return nil, err
+	}
+	return &Program{Source: source, Consts: items, Code: code}, nil
+}
+
+// programFromRaw decodes an encoded value, returning nil for non-expressions
+func programFromRaw(raw []byte) (*Program, error) {
+	if len(raw) == 0 || raw[0] != tagExpr {
+		return nil, nil
+	}
+	return decodeProgram(tskbinary.NewBinaryReader(bytes.NewReader(raw[1:])))
+}
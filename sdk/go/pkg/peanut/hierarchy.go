@@ -0,0 +1,342 @@
+package peanut
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// KeyOrigin explains where the effective value of a key came from
+type KeyOrigin struct {
+	Key string `json:"key"`
+	// File set the value, or last contributed to an appended array
+	File string `json:"file"`
+	// Line is the line of File the key is declared on, 0 for binaries
+	Line     int                  `json:"line,omitempty"`
+	Strategy config.MergeStrategy `json:"strategy"`
+	// Overrides are the files above File whose value for the key was
+	// replaced or, for appends, combined with it, root first
+	Overrides []string `json:"overrides,omitempty"`
+	// Chain is every file's value for the key, root first; the last entry
+	// is File's
+	Chain []KeySource `json:"chain"`
+}
+
+// Overridden reports whether the value replaced or extended one inherited
+// from a file above
+func (o KeyOrigin) Overridden() bool {
+	return len(o.Overrides) > 0
+}
+
+// KeySource is the value one file of a hierarchy gives a key
+type KeySource struct {
+	File     string               `json:"file"`
+	Line     int                  `json:"line,omitempty"`
+	Value    interface{}          `json:"value"`
+	Strategy config.MergeStrategy `json:"strategy"`
+}
+
+// DroppedKey is an inherited key removed by a replace annotation
+type DroppedKey struct {
+	Key  string `json:"key"`
+	File string `json:"file"`
+	// By is the file whose annotation dropped it
+	By string `json:"by"`
+}
+
+// Hierarchy is a merged configuration together with how it was merged
+type Hierarchy struct {
+	Config  *Config
+	Files   []string
+	Origins map[string]KeyOrigin
+	Dropped []DroppedKey
+	// Comments holds the # comments above keys and sections, taken from
+	// the closest file that documents each
+	Comments map[string]string
+}
+
+// LoadHierarchy loads the peanut files of dir and every directory above it,
+// CSS-style: the filesystem root comes first and files closer to dir
+// override it. Each directory contributes its first peanu.pnt, peanu.tsk or
+// peanu.peanuts, skipping a peanu.pnt that is older than its source. It returns the merged configuration and the files used.
+func LoadHierarchy(dir string) (*Config, []string, error) {
+	h, err := ResolveHierarchy(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.Config, h.Files, nil
+}
+
+// ResolveHierarchy merges the hierarchy of dir like LoadHierarchy and
+// records the origin of every key. Keys are deep-merged unless a text file
+// annotates them: "key +=:" appends to the inherited array, "key =:" and
+// "[section =]" replace everything inherited under the key or section.
+// Binaries do not keep annotations and always deep-merge.
+//
+// The files are parsed concurrently, by up to GOMAXPROCS workers, and
+// merged root first as they become available; when several fail, the
+// error is that of the file closest to the root.
+func ResolveHierarchy(dir string) (*Hierarchy, error) {
+	return resolveHierarchy(dir, runtime.GOMAXPROCS(0))
+}
+
+// resolveHierarchy is ResolveHierarchy parsing with up to workers
+// goroutines
+func resolveHierarchy(dir string, workers int) (*Hierarchy, error) {
+	dirs, err := hierarchyDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, d := range dirs {
+		if file, ok := findFile(d); ok {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w in %s or its parents", ErrNotFound, dir)
+	}
+
+	ctx, span := tracing.Start(context.Background(), "peanut.hierarchy", trace.SpanKindInternal)
+	defer span.End()
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("tsk.dir", dir), attribute.Int("tsk.files", len(files)))
+	}
+
+	h := &Hierarchy{Origins: make(map[string]KeyOrigin), Comments: make(map[string]string)}
+	values := make(map[string]interface{})
+	err = loadLayers(ctx, files, workers, func(l layer) error {
+		if l.err != nil {
+			return l.err
+		}
+		h.mergeLayer(l, values)
+		h.Files = append(h.Files, l.file)
+		return nil
+	})
+	if err != nil {
+		tracing.Fail(span, err)
+		return nil, err
+	}
+
+	sort.Slice(h.Dropped, func(i, j int) bool { return h.Dropped[i].Key < h.Dropped[j].Key })
+	h.Config = FromValues(values)
+	h.Config.file = h.Files[len(h.Files)-1]
+	h.Config.origins = h.Origins
+	return h, nil
+}
+
+// Overlay merges file, such as an environment overlay, on top of the
+// hierarchy, honouring its merge annotations like those of the hierarchy's
+// own files
+func (h *Hierarchy) Overlay(file string) error {
+	if err := h.mergeFile(file, h.Config.values); err != nil {
+		return err
+	}
+	h.Files = append(h.Files, file)
+	h.Config.file = file
+	sort.Slice(h.Dropped, func(i, j int) bool { return h.Dropped[i].Key < h.Dropped[j].Key })
+	return nil
+}
+
+// HierarchyStamp identifies the files LoadHierarchy chooses from for dir by
+// their paths, sizes and modification times. The source beside a binary is
+// included, since editing it makes the binary stale. A configuration
+// loaded from dir is current while its stamp is unchanged; computing the
+// stamp only stats files, so caches can check it on every use.
+func HierarchyStamp(dir string) (string, error) {
+	dirs, err := hierarchyDirs(dir)
+	if err != nil {
+		return "", err
+	}
+	var stamp strings.Builder
+	for _, d := range dirs {
+		for _, name := range searchNames {
+			file := filepath.Join(d, name)
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(&stamp, "%s:%d:%d\n", file, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return stamp.String(), nil
+}
+
+// layer is one parsed file of a hierarchy
+type layer struct {
+	file   string
+	cfg    *Config
+	values map[string]interface{}
+	err    error
+}
+
+// loadLayer parses one file of a hierarchy, as a span of the trace in ctx
+func loadLayer(ctx context.Context, file string) layer {
+	cfg, err := loadFile(ctx, file)
+	if err != nil {
+		return layer{file: file, err: fmt.Errorf("failed to load %s: %w", file, err)}
+	}
+	values, err := cfg.Values()
+	cfg.Close()
+	if err != nil {
+		return layer{file: file, err: fmt.Errorf("failed to load %s: %w", file, err)}
+	}
+	return layer{file: file, cfg: cfg, values: values}
+}
+
+// loadLayers parses files with up to workers goroutines and calls fn with
+// each in the order given, as soon as it and those before it are parsed, so
+// that merging overlaps parsing. It stops at the first error fn returns.
+func loadLayers(ctx context.Context, files []string, workers int, fn func(layer) error) error {
+	workers = min(workers, len(files))
+	if workers <= 1 {
+		for _, file := range files {
+			if err := fn(loadLayer(ctx, file)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	layers := make([]layer, len(files))
+	ready := make([]chan struct{}, len(files))
+	next := make(chan int, len(files))
+	for i := range files {
+		ready[i] = make(chan struct{})
+		next <- i
+	}
+	close(next)
+	// Workers left running after an error finish the remaining files and
+	// exit
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range next {
+				layers[i] = loadLayer(ctx, files[i])
+				close(ready[i])
+			}
+		}()
+	}
+	for i := range files {
+		<-ready[i]
+		if err := fn(layers[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeFile applies one file of the hierarchy to values
+func (h *Hierarchy) mergeFile(file string, values map[string]interface{}) error {
+	l := loadLayer(context.Background(), file)
+	if l.err != nil {
+		return l.err
+	}
+	h.mergeLayer(l, values)
+	return nil
+}
+
+// mergeLayer applies a parsed file of the hierarchy to values
+func (h *Hierarchy) mergeLayer(l layer, values map[string]interface{}) {
+	file, cfg, fileValues := l.file, l.cfg, l.values
+
+	// Replacements drop inherited keys before the file's own keys land,
+	// shortest path first so the report names the outermost annotation
+	var replaced []string
+	for path, strategy := range cfg.merge {
+		if strategy == config.MergeReplace {
+			replaced = append(replaced, path)
+		}
+	}
+	sort.Strings(replaced)
+	for _, path := range replaced {
+		for key := range values {
+			if key != path && !strings.HasPrefix(key, path+".") {
+				continue
+			}
+			h.Dropped = append(h.Dropped, DroppedKey{Key: key, File: h.Origins[key].File, By: file})
+			delete(values, key)
+			delete(h.Origins, key)
+		}
+	}
+
+	for key, value := range fileValues {
+		origin := KeyOrigin{Key: key, File: file, Line: cfg.lines[key], Strategy: strategyFor(key, cfg.merge)}
+		if previous, ok := h.Origins[key]; ok {
+			// previous is replaced below, so its slices are extended in
+			// place rather than copied for every level
+			origin.Overrides = append(previous.Overrides, previous.File)
+			origin.Chain = previous.Chain
+		}
+		origin.Chain = append(origin.Chain, KeySource{File: file, Line: origin.Line, Value: value, Strategy: origin.Strategy})
+
+		if origin.Strategy == config.MergeAppend {
+			if inherited, ok := values[key]; ok {
+				value = appendValues(inherited, value)
+			}
+		}
+		values[key] = value
+		h.Origins[key] = origin
+	}
+	for key, comment := range cfg.comments {
+		h.Comments[key] = comment
+	}
+}
+
+// strategyFor returns the annotation governing key: its own, or a replace
+// on a section above it. Appends apply to the annotated key only.
+func strategyFor(key string, annotations map[string]config.MergeStrategy) config.MergeStrategy {
+	if strategy, ok := annotations[key]; ok {
+		return strategy
+	}
+	for path := key; ; {
+		dot := strings.LastIndex(path, ".")
+		if dot == -1 {
+			return config.MergeDeep
+		}
+		path = path[:dot]
+		if annotations[path] == config.MergeReplace {
+			return config.MergeReplace
+		}
+	}
+}
+
+// appendValues appends value to an inherited array; scalars on either side
+// are treated as one-element arrays
+func appendValues(inherited, value interface{}) []interface{} {
+	var result []interface{}
+	for _, v := range []interface{}{inherited, value} {
+		if items, ok := v.([]interface{}); ok {
+			result = append(result, items...)
+		} else {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// hierarchyDirs returns dir and its parents, the filesystem root first
+func hierarchyDirs(dir string) ([]string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	var dirs []string
+	for {
+		dirs = append([]string{abs}, dirs...)
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return dirs, nil
+		}
+		abs = parent
+	}
+}
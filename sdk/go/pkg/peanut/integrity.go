@@ -0,0 +1,196 @@
+package peanut
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the payload compression of a v2 binary
+type Compression string
+
+// Supported compressions
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// Checksum is the integrity footer algorithm of a v2 binary
+type Checksum string
+
+// Supported checksums
+const (
+	ChecksumNone   Checksum = "none"
+	ChecksumCRC32  Checksum = "crc32"
+	ChecksumSHA256 Checksum = "sha256"
+)
+
+// Flag encodings, stored in the low byte of the v2 header flags
+var (
+	compressionIDs = map[Compression]uint32{"": 0, CompressionNone: 0, CompressionGzip: 1, CompressionZstd: 2}
+	checksumIDs    = map[Checksum]uint32{"": 0, ChecksumNone: 0, ChecksumCRC32: 1, ChecksumSHA256: 2}
+	checksumSizes  = map[uint32]int{0: 0, 1: crc32.Size, 2: sha256.Size}
+)
+
+// ParseCompression converts a name such as "zstd" into a Compression
+func ParseCompression(name string) (Compression, error) {
+	c := Compression(name)
+	if _, ok := compressionIDs[c]; !ok {
+		return "", fmt.Errorf("unsupported compression %q (supported: none, gzip, zstd)", name)
+	}
+	if c == "" {
+		c = CompressionNone
+	}
+	return c, nil
+}
+
+// ParseChecksum converts a name such as "sha256" into a Checksum
+func ParseChecksum(name string) (Checksum, error) {
+	c := Checksum(name)
+	if _, ok := checksumIDs[c]; !ok {
+		return "", fmt.Errorf("unsupported checksum %q (supported: none, crc32, sha256)", name)
+	}
+	if c == "" {
+		c = ChecksumNone
+	}
+	return c, nil
+}
+
+func flags(compression Compression, sum Checksum) uint32 {
+	return compressionIDs[compression] | checksumIDs[sum]<<4
+}
+
+func compress(body []byte, compression Compression) ([]byte, error) {
+	if compression == "" || compression == CompressionNone {
+		return body, nil
+	}
+
+	var buf bytes.Buffer
+	zw, err := compressWriter(&buf, compression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressWriter returns a writer that compresses into w; Close flushes it
+func compressWriter(w io.Writer, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case "", CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unsupported compression %q", compression)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func checksum(data []byte, sum Checksum) ([]byte, error) {
+	h, footer, err := newChecksum(sum)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(data)
+	return footer(), nil
+}
+
+// newChecksum returns a writer that hashes everything written to it and a
+// function returning the footer for the data seen so far
+func newChecksum(sum Checksum) (io.Writer, func() []byte, error) {
+	switch sum {
+	case "", ChecksumNone:
+		return io.Discard, func() []byte { return nil }, nil
+	case ChecksumCRC32:
+		h := crc32.NewIEEE()
+		return h, func() []byte { return binary.LittleEndian.AppendUint32(nil, h.Sum32()) }, nil
+	case ChecksumSHA256:
+		h := sha256.New()
+		return h, func() []byte { return h.Sum(nil) }, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported checksum %q", sum)
+}
+
+// unwrapV2 verifies the checksum footer and signature of a v2 file and
+// decompresses its body. It returns the file as header plus uncompressed
+// body, and whether that is a new buffer rather than a slice of data.
+func unwrapV2(data []byte, opts LoadOptions) ([]byte, bool, error) {
+	if len(data) < v2HeaderSize {
+		return nil, false, fmt.Errorf("file too short for a v2 header (truncated?)")
+	}
+
+	fl := binary.LittleEndian.Uint32(data[20:24])
+	compressionID, checksumID := fl&0xf, fl>>4&0xf
+
+	footerSize, ok := checksumSizes[checksumID]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown checksum type %d", checksumID)
+	}
+	if len(data) < v2HeaderSize+footerSize {
+		return nil, false, fmt.Errorf("file too short for its checksum footer (truncated?)")
+	}
+
+	content, footer := data[:len(data)-footerSize], data[len(data)-footerSize:]
+	if footerSize > 0 {
+		var sum Checksum = ChecksumCRC32
+		if checksumID == checksumIDs[ChecksumSHA256] {
+			sum = ChecksumSHA256
+		}
+		want, _ := checksum(content, sum)
+		if !bytes.Equal(want, footer) {
+			return nil, false, fmt.Errorf("%s checksum mismatch: file is corrupted or truncated", sum)
+		}
+	}
+
+	content, err := verifySignature(content, fl, opts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var reader io.Reader
+	body := bytes.NewReader(content[v2HeaderSize:])
+	switch compressionID {
+	case compressionIDs[CompressionNone]:
+		return content, false, nil
+	case compressionIDs[CompressionGzip]:
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decompress gzip payload: %w", err)
+		}
+		defer zr.Close()
+		reader = zr
+	case compressionIDs[CompressionZstd]:
+		zr, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decompress zstd payload: %w", err)
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return nil, false, fmt.Errorf("unknown compression type %d", compressionID)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(content[:v2HeaderSize])
+	if _, err := io.Copy(&buf, reader); err != nil {
+		return nil, false, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	return buf.Bytes(), true, nil
+}
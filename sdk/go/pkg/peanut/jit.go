@@ -0,0 +1,430 @@
+package peanut
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/operators"
+	"github.com/cyber-boost/tusktsk/pkg/performance/jit"
+)
+
+// jitFunc is the compiled form of a hot program: a tree of closures that
+// evaluates the expression without decoding instructions
+type jitFunc func(vm *VM) (interface{}, error)
+
+// Kinds of jitNode
+const (
+	nodeConst byte = iota
+	nodeCall
+	nodeNot
+	nodeCompare
+	nodeTernary
+	nodeAnd
+	nodeOr
+	nodeCache
+)
+
+// jitNode is one expression of a program rebuilt from its code. The
+// children of a ternary are cond, then, else; of an and or an or, left and
+// right; of a cache, the lookup and the store.
+type jitNode struct {
+	kind  byte
+	op    byte
+	value interface{}
+	name  string
+	args  []*jitNode
+}
+
+// SetJIT makes the VM compile the programs it runs more than the
+// compiler's threshold to closures; nil interprets every run. VMs from
+// NewVM share jit.Default. Calls to pure operators with constant arguments
+// are evaluated once, through the VM that compiles the program, so a
+// compiler should only be shared by VMs with the same operators.
+func (vm *VM) SetJIT(compiler *jit.JITCompiler) {
+	vm.jit = compiler
+}
+
+// compile compiles a program that turned hot and records the outcome. It
+// returns nil when the program keeps being interpreted.
+func (vm *VM) compile(program *Program) jitFunc {
+	start := time.Now()
+	fn, info, err := compileProgram(vm, program)
+	vm.jit.Store(program.Source, fn, info, time.Since(start), err)
+	if err != nil {
+		return nil
+	}
+	return fn
+}
+
+// compileProgram rebuilds the expression tree of a program, resolves its
+// constant sub-expressions and turns it into closures
+func compileProgram(vm *VM, program *Program) (jitFunc, jit.CompileInfo, error) {
+	var info jit.CompileInfo
+	b := &jitBuilder{program: program}
+	stack, err := b.block(0, len(program.Code))
+	if err != nil {
+		return nil, info, err
+	}
+	if len(stack) != 1 {
+		return nil, info, fmt.Errorf("expression leaves %d values", len(stack))
+	}
+	root := foldNode(vm, stack[0], &info)
+	return compileNode(root), info, nil
+}
+
+// jitBuilder rebuilds expression trees from the shapes of code the
+// expression compiler emits. Anything else is reported as an error and
+// left to the interpreter.
+type jitBuilder struct {
+	program *Program
+}
+
+func (b *jitBuilder) operand(pc int) (int, error) {
+	if pc+2 > len(b.program.Code) {
+		return 0, fmt.Errorf("truncated instruction at %d", pc-1)
+	}
+	return int(binary.LittleEndian.Uint16(b.program.Code[pc:])), nil
+}
+
+func (b *jitBuilder) constant(index int) (interface{}, error) {
+	if index >= len(b.program.Consts) {
+		return nil, fmt.Errorf("invalid constant %d", index)
+	}
+	return b.program.Consts[index], nil
+}
+
+// callName returns the operator an opCall at pc names
+func (b *jitBuilder) callName(pc int) string {
+	if pc < 0 || pc+4 > len(b.program.Code) || b.program.Code[pc] != opCall {
+		return ""
+	}
+	index, _ := b.operand(pc + 1)
+	value, _ := b.constant(index)
+	name, _ := value.(string)
+	return name
+}
+
+// jumpAt returns the target of the opJump at pc
+func (b *jitBuilder) jumpAt(pc, start, end int) (int, bool) {
+	if pc < start || pc+3 > end || b.program.Code[pc] != opJump {
+		return 0, false
+	}
+	target, err := b.operand(pc + 1)
+	return target, err == nil
+}
+
+// single builds the code in [start, end) as one expression
+func (b *jitBuilder) single(start, end int) (*jitNode, error) {
+	stack, err := b.block(start, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("branch at %d leaves %d values", start, len(stack))
+	}
+	return stack[0], nil
+}
+
+// block builds the code in [start, end) and returns the expressions it
+// leaves on the stack
+func (b *jitBuilder) block(start, end int) ([]*jitNode, error) {
+	code := b.program.Code
+	var stack []*jitNode
+	pop := func(n int) ([]*jitNode, error) {
+		if n > len(stack) {
+			return nil, fmt.Errorf("stack underflow")
+		}
+		args := append([]*jitNode(nil), stack[len(stack)-n:]...)
+		stack = stack[:len(stack)-n]
+		return args, nil
+	}
+
+	for pc := start; pc < end; {
+		op := code[pc]
+		pc++
+		switch op {
+		case opConst:
+			index, err := b.operand(pc)
+			if err != nil {
+				return nil, err
+			}
+			value, err := b.constant(index)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, &jitNode{kind: nodeConst, value: value})
+			pc += 2
+
+		case opCall:
+			name := b.callName(pc - 1)
+			if name == "" {
+				return nil, fmt.Errorf("invalid call at %d", pc-1)
+			}
+			args, err := pop(int(code[pc+2]))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, &jitNode{kind: nodeCall, name: name, args: args})
+			pc += 3
+
+		case opNot:
+			args, err := pop(1)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, &jitNode{kind: nodeNot, args: args})
+
+		case opEq, opNe, opLt, opGt, opLe, opGe:
+			args, err := pop(2)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, &jitNode{kind: nodeCompare, op: op, args: args})
+
+		case opJumpIfFalse:
+			// cond; jumpIfFalse else; <then>; jump end; else: <else>; end:
+			target, err := b.operand(pc)
+			if err != nil {
+				return nil, err
+			}
+			cond, err := pop(1)
+			if err != nil {
+				return nil, err
+			}
+			after, ok := b.jumpAt(target-3, pc+2, end)
+			if !ok || target > end || after < target || after > end {
+				return nil, fmt.Errorf("unexpected condition at %d", pc-1)
+			}
+			then, err := b.single(pc+2, target-3)
+			if err != nil {
+				return nil, err
+			}
+			otherwise, err := b.single(target, after)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, &jitNode{kind: nodeTernary, args: []*jitNode{cond[0], then, otherwise}})
+			pc = after
+
+		case opJumpIfFalseKeep, opJumpIfTrueKeep:
+			target, err := b.operand(pc)
+			if err != nil {
+				return nil, err
+			}
+			if target <= pc || target > end {
+				return nil, fmt.Errorf("invalid jump target %d at %d", target, pc-1)
+			}
+			left, err := pop(1)
+			if err != nil {
+				return nil, err
+			}
+			// A compiled @cache:
+			// lookup; jumpIfTrueKeep hit; <store>; jump end; hit: call cache.value 1; end:
+			if op == opJumpIfTrueKeep && left[0].kind == nodeCall && left[0].name == "cache.get" && b.callName(target) == "cache.value" {
+				after, ok := b.jumpAt(target-3, pc+2, end)
+				if !ok || after != target+4 || after > end {
+					return nil, fmt.Errorf("unexpected @cache at %d", pc-1)
+				}
+				store, err := b.single(pc+2, target-3)
+				if err != nil {
+					return nil, err
+				}
+				stack = append(stack, &jitNode{kind: nodeCache, args: []*jitNode{left[0], store}})
+				pc = after
+				continue
+			}
+			right, err := b.single(pc+2, target)
+			if err != nil {
+				return nil, err
+			}
+			kind := nodeAnd
+			if op == opJumpIfTrueKeep {
+				kind = nodeOr
+			}
+			stack = append(stack, &jitNode{kind: kind, args: []*jitNode{left[0], right}})
+			pc = target
+
+		default:
+			return nil, fmt.Errorf("unexpected opcode %d at %d", op, pc-1)
+		}
+	}
+	return stack, nil
+}
+
+// foldNode resolves the sub-expressions of n whose value is known before
+// it runs: comparisons and negations of constants, conditions on constants
+// and calls to pure operators with constant arguments, as long as they
+// yield a scalar that is safe to share between runs. Regex patterns passed
+// as constants are compiled ahead of the calls.
+func foldNode(vm *VM, n *jitNode, info *jit.CompileInfo) *jitNode {
+	for i, arg := range n.args {
+		n.args[i] = foldNode(vm, arg, info)
+	}
+	constant := func(i int) bool { return n.args[i].kind == nodeConst }
+	folded := func(value interface{}) *jitNode {
+		info.FoldedConstants++
+		return &jitNode{kind: nodeConst, value: value}
+	}
+
+	switch n.kind {
+	case nodeCall:
+		pure := operators.IsPure(n.name)
+		args := make([]interface{}, len(n.args))
+		for i, arg := range n.args {
+			if arg.kind != nodeConst {
+				pure = false
+				break
+			}
+			args[i] = arg.value
+		}
+		if pure {
+			if value, err := vm.call(n.name, args...); err == nil && isScalar(value) {
+				return folded(value)
+			}
+		}
+		if len(n.args) > 0 && constant(0) && operators.PrecompilePattern(n.name, n.args[0].value) {
+			info.PrecompiledRegexes++
+		}
+	case nodeNot:
+		if constant(0) {
+			return folded(!truthy(n.args[0].value))
+		}
+	case nodeCompare:
+		if constant(0) && constant(1) {
+			if result, err := compareValues(n.op, n.args[0].value, n.args[1].value); err == nil {
+				return folded(result)
+			}
+		}
+	case nodeTernary:
+		if constant(0) {
+			info.FoldedConstants++
+			if truthy(n.args[0].value) {
+				return n.args[1]
+			}
+			return n.args[2]
+		}
+	case nodeAnd, nodeOr:
+		if constant(0) {
+			info.FoldedConstants++
+			if truthy(n.args[0].value) == (n.kind == nodeOr) {
+				return n.args[0]
+			}
+			return n.args[1]
+		}
+	}
+	return n
+}
+
+// isScalar reports whether a value can be returned by every run without
+// one run's changes showing in another
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case nil, bool, string, int, int64, float64:
+		return true
+	}
+	return false
+}
+
+// compileNode turns an expression tree into closures
+func compileNode(n *jitNode) jitFunc {
+	switch n.kind {
+	case nodeConst:
+		value := n.value
+		return func(*VM) (interface{}, error) { return value, nil }
+
+	case nodeCall:
+		name := n.name
+		argFns := make([]jitFunc, len(n.args))
+		for i, arg := range n.args {
+			argFns[i] = compileNode(arg)
+		}
+		return func(vm *VM) (interface{}, error) {
+			args := make([]interface{}, len(argFns))
+			for i, fn := range argFns {
+				value, err := fn(vm)
+				if err != nil {
+					return nil, err
+				}
+				args[i] = value
+			}
+			result, err := vm.invoke(name, args...)
+			if err != nil {
+				return nil, fmt.Errorf("@%s: %w", name, err)
+			}
+			return result, nil
+		}
+
+	case nodeNot:
+		arg := compileNode(n.args[0])
+		return func(vm *VM) (interface{}, error) {
+			value, err := arg(vm)
+			if err != nil {
+				return nil, err
+			}
+			return !truthy(value), nil
+		}
+
+	case nodeCompare:
+		op, left, right := n.op, compileNode(n.args[0]), compileNode(n.args[1])
+		return func(vm *VM) (interface{}, error) {
+			l, err := left(vm)
+			if err != nil {
+				return nil, err
+			}
+			r, err := right(vm)
+			if err != nil {
+				return nil, err
+			}
+			result, err := compareValues(op, l, r)
+			if err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+
+	case nodeTernary:
+		cond, then, otherwise := compileNode(n.args[0]), compileNode(n.args[1]), compileNode(n.args[2])
+		return func(vm *VM) (interface{}, error) {
+			value, err := cond(vm)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(value) {
+				return then(vm)
+			}
+			return otherwise(vm)
+		}
+
+	case nodeAnd, nodeOr:
+		keepTruthy := n.kind == nodeOr
+		left, right := compileNode(n.args[0]), compileNode(n.args[1])
+		return func(vm *VM) (interface{}, error) {
+			value, err := left(vm)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(value) == keepTruthy {
+				return value, nil
+			}
+			return right(vm)
+		}
+
+	default: // nodeCache
+		lookup, store := compileNode(n.args[0]), compileNode(n.args[1])
+		return func(vm *VM) (interface{}, error) {
+			hit, err := lookup(vm)
+			if err != nil {
+				return nil, err
+			}
+			if !truthy(hit) {
+				return store(vm)
+			}
+			value, err := vm.invoke("cache.value", hit)
+			if err != nil {
+				return nil, fmt.Errorf("@cache.value: %w", err)
+			}
+			return value, nil
+		}
+	}
+}
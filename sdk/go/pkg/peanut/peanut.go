@@ -0,0 +1,335 @@
+// Package peanut provides Peanut configuration loading with support for the
+// compiled .pnt binary format
+package peanut
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/security"
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// File names searched by Load when given a directory, fastest first
+var searchNames = []string{"peanu.pnt", "peanu.tsk", "peanu.peanuts"}
+
+// ErrNotFound is returned when a directory holds no peanut configuration
+var ErrNotFound = tskerrors.New(tskerrors.NotFound, "no peanut configuration found")
+
+// Config is a loaded Peanut configuration. Text files and v1 binaries are
+// decoded up front; v2 binaries are memory-mapped and read one key at a time.
+type Config struct {
+	values map[string]interface{}
+	index  *binaryIndex
+	file   string
+	// merge holds the merge annotations of a text file
+	merge map[string]config.MergeStrategy
+	// lines holds the line each key of a text file is declared on
+	lines map[string]int
+	// comments holds the # comments above the keys and sections of a text file
+	comments map[string]string
+	// origins holds the provenance of each key of a merged hierarchy
+	origins map[string]KeyOrigin
+	// fileRoot is the sandbox root the host set with SetFileRoot
+	fileRoot string
+	// cacheWarning logs once that the @cache backend needs a license
+	cacheWarning sync.Once
+}
+
+// Load loads a configuration file, or the first peanu.pnt, peanu.tsk or
+// peanu.peanuts found when path is a directory. A peanu.pnt older than the
+// text file beside it is skipped with a warning.
+func Load(path string) (*Config, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if !info.IsDir() {
+		return LoadFile(path)
+	}
+
+	if file, ok := findFile(path); ok {
+		return LoadFile(file)
+	}
+	return nil, fmt.Errorf("%w in %s", ErrNotFound, path)
+}
+
+// findFile returns the first of searchNames in dir. A binary whose source
+// beside it changed since it was compiled is skipped, so an edit is never
+// hidden by a stale peanu.pnt.
+func findFile(dir string) (string, bool) {
+	for _, name := range searchNames {
+		file := filepath.Join(dir, name)
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		if isBinaryFile(file) {
+			if source, stale := StaleBinary(file); stale {
+				log.Printf("warning: %s is older than %s and was skipped; run tsk binary compile to update it", file, source)
+				continue
+			}
+		}
+		return file, true
+	}
+	return "", false
+}
+
+// LoadFile loads a text (.tsk, .peanuts) or binary (.pnt, .tskb) configuration file
+func LoadFile(file string) (*Config, error) {
+	return loadFile(context.Background(), file)
+}
+
+// loadFile is LoadFile recording the parse as a span of the trace in ctx
+func loadFile(ctx context.Context, file string) (cfg *Config, err error) {
+	_, span := tracing.Start(ctx, "peanut.parse", trace.SpanKindInternal)
+	defer func() {
+		if span.IsRecording() {
+			format, keys := "text", 0
+			if isBinaryFile(file) {
+				format = "binary"
+			}
+			if cfg != nil {
+				keys = len(cfg.values)
+				if cfg.index != nil {
+					keys = cfg.index.count
+				}
+			}
+			span.SetAttributes(attribute.String("tsk.file", file), attribute.String("tsk.format", format), attribute.Int("tsk.keys", keys))
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
+
+	if isBinaryFile(file) {
+		return LoadBinary(file)
+	}
+
+	if MaxTextFileSize > 0 {
+		if info, err := os.Stat(file); err == nil && info.Size() > MaxTextFileSize {
+			return nil, fmt.Errorf("%s is %d MiB, over the %d MiB limit for parsing in memory: compile it with `tsk binary compile --chunked` (peanut.CompileChunked) or raise peanut.MaxTextFileSize",
+				file, info.Size()>>20, MaxTextFileSize>>20)
+		}
+	}
+
+	parsed := config.New()
+	if err := parsed.LoadFromFile(file); err != nil {
+		return nil, err
+	}
+	lines := make(map[string]int, len(parsed.Values()))
+	for _, key := range parsed.Keys() {
+		lines[key] = parsed.Line(key)
+	}
+	return &Config{values: parsed.Values(), file: file, merge: parsed.MergeAnnotations(), lines: lines, comments: parsed.Comments()}, nil
+}
+
+// isBinaryFile reports whether file is named as a compiled configuration
+func isBinaryFile(file string) bool {
+	return strings.HasSuffix(file, ".pnt") || strings.HasSuffix(file, ".tskb")
+}
+
+// FromValues creates a Config from flat dotted keys
+func FromValues(values map[string]interface{}) *Config {
+	return &Config{values: values}
+}
+
+// File returns the file the configuration was loaded from
+func (c *Config) File() string {
+	return c.file
+}
+
+// Origin returns where the value of key came from. Configurations loaded
+// with LoadHierarchy or ResolveHierarchy report the full override chain;
+// others report their own file. Lines are only known for text files.
+func (c *Config) Origin(key string) (KeyOrigin, bool) {
+	if c.origins != nil {
+		origin, ok := c.origins[key]
+		return origin, ok
+	}
+	value, ok, err := c.Lookup(key)
+	if err != nil || !ok {
+		return KeyOrigin{}, false
+	}
+	source := KeySource{File: c.file, Line: c.lines[key], Value: value, Strategy: config.MergeDeep}
+	return KeyOrigin{Key: key, File: c.file, Line: source.Line, Strategy: config.MergeDeep, Chain: []KeySource{source}}, true
+}
+
+// Comment returns the # comment lines written directly above key, or above
+// the header of a section, in a text file
+func (c *Config) Comment(key string) string {
+	return c.comments[key]
+}
+
+// Close releases the memory mapping of a v2 binary. It is safe to call on
+// any Config.
+func (c *Config) Close() error {
+	if c.index == nil {
+		return nil
+	}
+	return c.index.close()
+}
+
+// Get returns the value at key, or def when it is not set. A key that names
+// a section ("database") returns the nested map of everything below it.
+// @secret("...") values are decrypted with security.SecretKey; def is
+// returned when that fails, and Secret reports why.
+func (c *Config) Get(key string, def interface{}) interface{} {
+	value, ok, err := c.Lookup(key)
+	if err != nil || !ok {
+		return def
+	}
+	if s, isString := value.(string); isString && security.IsSecret(s) {
+		plaintext, err := c.Secret(key)
+		if err != nil {
+			return def
+		}
+		return plaintext
+	}
+	return value
+}
+
+// Secret returns the decrypted value of a @secret("...") key
+func (c *Config) Secret(key string) (string, error) {
+	value, ok, err := c.Lookup(key)
+	if err != nil {
+		return "", err
+	}
+	s, isString := value.(string)
+	if !ok || !isString || !security.IsSecret(s) {
+		return "", fmt.Errorf("%s is not a secret", key)
+	}
+	secretKey, err := security.SecretKey()
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := security.DecryptSecret(s, secretKey)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	return plaintext, nil
+}
+
+// Lookup returns the value at key and whether it was found. Errors are only
+// returned for corrupt binaries.
+func (c *Config) Lookup(key string) (interface{}, bool, error) {
+	if c.index != nil {
+		return c.index.lookup(key)
+	}
+
+	if value, ok := c.values[key]; ok {
+		return value, true, nil
+	}
+
+	// A missing key allocates nothing; the section is built on its first
+	// key
+	var section map[string]interface{}
+	for k, v := range c.values {
+		if len(k) > len(key) && k[len(key)] == '.' && strings.HasPrefix(k, key) {
+			if section == nil {
+				section = make(map[string]interface{})
+			}
+			section[k[len(key)+1:]] = v
+		}
+	}
+	if section == nil {
+		return nil, false, nil
+	}
+	return config.Nest(section), true, nil
+}
+
+// GetString returns the value at key as a string
+func (c *Config) GetString(key string, def string) string {
+	switch v := c.Get(key, nil).(type) {
+	case nil:
+		return def
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// GetInt returns the value at key as an int
+func (c *Config) GetInt(key string, def int) int {
+	switch v := c.Get(key, nil).(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// GetFloat returns the value at key as a float64
+func (c *Config) GetFloat(key string, def float64) float64 {
+	switch v := c.Get(key, nil).(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// GetBool returns the value at key as a bool
+func (c *Config) GetBool(key string, def bool) bool {
+	switch v := c.Get(key, nil).(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+// Keys returns every flat key in sorted order
+func (c *Config) Keys() []string {
+	if c.index != nil {
+		return c.index.keys()
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Values returns all flat values. For v2 binaries this decodes every entry.
+func (c *Config) Values() (map[string]interface{}, error) {
+	if c.index == nil {
+		return c.values, nil
+	}
+	return c.index.all()
+}
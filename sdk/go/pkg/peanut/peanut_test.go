@@ -0,0 +1,1537 @@
+package peanut
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/internal/licensetest"
+	"github.com/cyber-boost/tusktsk/license"
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/operators"
+	"github.com/cyber-boost/tusktsk/pkg/performance/jit"
+	"github.com/cyber-boost/tusktsk/pkg/performance/memory"
+	"github.com/cyber-boost/tusktsk/pkg/security"
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
+)
+
+const sampleConfig = `[app]
+name: "Demo"
+debug: true
+
+[server]
+host: "localhost"
+port: 8080
+ratio: 0.5
+tags: ["a", "b"]
+
+[database]
+host: "db.local"
+`
+
+func TestCompileAndLoadBinary(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	if err := os.WriteFile(input, []byte(sampleConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := LoadFile(input)
+	if err != nil {
+		t.Fatalf("LoadFile() returned error: %v", err)
+	}
+	want, _ := text.Values()
+
+	variants := []WriteOptions{
+		{Version: FormatV1},
+		{Version: FormatV2},
+		{Version: FormatV2, Compression: CompressionGzip, Checksum: ChecksumCRC32},
+		{Version: FormatV2, Compression: CompressionZstd, Checksum: ChecksumSHA256},
+	}
+	for _, opts := range variants {
+		version := opts.Version
+		output := filepath.Join(dir, "peanu.pnt")
+		if err := CompileToBinaryWith(input, output, opts); err != nil {
+			t.Fatalf("%+v: CompileToBinaryWith() returned error: %v", opts, err)
+		}
+
+		cfg, err := Load(dir)
+		if err != nil {
+			t.Fatalf("v%d: Load() returned error: %v", version, err)
+		}
+		if cfg.File() != output {
+			t.Errorf("v%d: Load() should prefer the binary, loaded %s", version, cfg.File())
+		}
+
+		got, err := cfg.Values()
+		if err != nil {
+			t.Fatalf("v%d: Values() returned error: %v", version, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("v%d: values mismatch:\nwant %#v\ngot  %#v", version, want, got)
+		}
+
+		if cfg.GetInt("server.port", 0) != 8080 || cfg.GetString("app.name", "") != "Demo" || !cfg.GetBool("app.debug", false) {
+			t.Errorf("v%d: typed getters returned wrong values", version)
+		}
+		if cfg.GetString("missing", "fallback") != "fallback" {
+			t.Errorf("v%d: default not returned for missing key", version)
+		}
+
+		section, ok := cfg.Get("server", nil).(map[string]interface{})
+		if !ok || len(section) != 4 || section["host"] != "localhost" {
+			t.Errorf("v%d: section lookup returned %#v", version, cfg.Get("server", nil))
+		}
+		if cfg.Get("serv", nil) != nil {
+			t.Errorf("v%d: partial key should not match a section", version)
+		}
+
+		if err := cfg.Close(); err != nil {
+			t.Errorf("v%d: Close() returned error: %v", version, err)
+		}
+	}
+}
+
+func TestStaleBinary(t *testing.T) {
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	compiled := time.Now().Add(-time.Hour)
+	for _, tt := range []struct {
+		name    string
+		version uint32
+		// source is the modification time of peanu.tsk after compiling,
+		// relative to when it was compiled; none removes it
+		source time.Duration
+		none   bool
+		want   string
+	}{
+		{"unchanged", FormatV2, 0, false, "peanu.pnt"},
+		{"source edited", FormatV2, time.Minute, false, "peanu.tsk"},
+		{"source replaced by an older file", FormatV2, -time.Minute, false, "peanu.tsk"},
+		{"no source", FormatV2, time.Minute, true, "peanu.pnt"},
+		{"v1 unchanged", FormatV1, -time.Minute, false, "peanu.pnt"},
+		{"v1 source edited", FormatV1, 2 * time.Hour, false, "peanu.tsk"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			logged.Reset()
+			dir := t.TempDir()
+			input := filepath.Join(dir, "peanu.tsk")
+			if err := os.WriteFile(input, []byte("port: 80\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(input, compiled, compiled)
+			if err := CompileToBinaryWith(input, filepath.Join(dir, "peanu.pnt"), WriteOptions{Version: tt.version}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.none {
+				os.Remove(input)
+			} else {
+				os.WriteFile(input, []byte("port: 8080\n"), 0644)
+				os.Chtimes(input, compiled, compiled.Add(tt.source))
+			}
+
+			cfg, err := Load(dir)
+			if err != nil {
+				t.Fatalf("Load() returned error: %v", err)
+			}
+			defer cfg.Close()
+			if got := filepath.Base(cfg.File()); got != tt.want {
+				t.Errorf("Load() read %s, want %s", got, tt.want)
+			}
+			_, files, err := LoadHierarchy(dir)
+			if err != nil || filepath.Base(files[len(files)-1]) != tt.want {
+				t.Errorf("LoadHierarchy() read %v, %v; want %s", files, err, tt.want)
+			}
+			if warned := strings.Contains(logged.String(), "peanu.pnt is older than"); warned != (tt.want == "peanu.tsk") {
+				t.Errorf("warning logged = %v: %q", warned, logged.String())
+			}
+		})
+	}
+}
+
+// getKeys are scalar keys of sampleConfig, read by TestGetAllocations and
+// BenchmarkGet
+var getKeys = []string{"app.name", "app.debug", "server.port", "server.ratio"}
+
+func TestGetAllocations(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	output := filepath.Join(dir, "peanu.pnt")
+	if err := os.WriteFile(input, []byte(sampleConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompileToBinary(input, output); err != nil {
+		t.Fatal(err)
+	}
+	text, err := LoadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := LoadBinary(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer binary.Close()
+
+	// Against decoding every lookup, as Get did before interning
+	var interned, decoded float64
+	for _, key := range getKeys {
+		interned += testing.AllocsPerRun(100, func() { binary.Get(key, nil) })
+		decoded += testing.AllocsPerRun(100, func() { binary.index.lookupWith(key, binary.index.decode) })
+	}
+	if interned*5 > decoded {
+		t.Errorf("binary Get: %v allocations for %d keys, decoding takes %v", interned, len(getKeys), decoded)
+	}
+
+	for _, cfg := range []*Config{text, binary} {
+		allocs := testing.AllocsPerRun(100, func() {
+			cfg.GetString("app.name", "")
+			cfg.GetBool("app.debug", false)
+			cfg.GetInt("server.port", 0)
+			cfg.GetFloat("server.ratio", 0)
+			cfg.GetString("missing.key", "")
+		})
+		if allocs != 0 {
+			t.Errorf("%s: typed getters allocated %v times", cfg.File(), allocs)
+		}
+	}
+
+	for _, value := range []string{"localhost", "8080", "1.5", "true"} {
+		if allocs := testing.AllocsPerRun(100, func() { config.ParseValue(value) }); allocs > 1 {
+			t.Errorf("ParseValue(%q) allocated %v times", value, allocs)
+		}
+	}
+}
+
+func TestParserScratch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "peanu.tsk")
+	content := sampleConfig + "\n[cache]\nredis {\n  hosts: [\"a:6379\", [\"b\", \"c\"]]\n  pool:\n    size: 4\n}\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	program, err := CompileExpression(`@env("A") || @env("B")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := memory.Parser.Stats()
+	for i := 0; i < 20; i++ {
+		cfg, err := LoadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.Get("cache.redis.hosts", nil); !reflect.DeepEqual(got, []interface{}{"a:6379", []interface{}{"b", "c"}}) {
+			t.Fatalf("cache.redis.hosts = %#v", got)
+		}
+		if got := cfg.Get("cache.redis.pool.size", nil); got != 4 {
+			t.Fatalf("cache.redis.pool.size = %#v", got)
+		}
+		program.Operators()
+	}
+	after := memory.Parser.Stats()
+
+	// Each parse takes lines, the parts of three inline arrays and a key
+	// builder; Operators takes a set
+	for kind, gets := range map[string]int64{"tokens": 80, "builders": 20, "sets": 20} {
+		got := after.Kinds[kind].TotalAllocated - before.Kinds[kind].TotalAllocated
+		reused := after.Kinds[kind].TotalReused - before.Kinds[kind].TotalReused
+		if got != gets || reused < gets/2 {
+			t.Errorf("%s: %d gets, %d reused; want %d gets, most reused", kind, got, reused, gets)
+		}
+	}
+}
+
+func TestLoadBinaryRejectsTruncatedFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	output := filepath.Join(dir, "peanu.pnt")
+	if err := os.WriteFile(input, []byte(sampleConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompileToBinary(input, output); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(output, data[:50], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadBinary(output); err == nil {
+		t.Errorf("expected an error loading a truncated binary")
+	}
+}
+
+func TestLoadBinaryDetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	if err := os.WriteFile(input, []byte(sampleConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []WriteOptions{
+		{Version: FormatV2, Checksum: ChecksumCRC32},
+		{Version: FormatV2, Compression: CompressionZstd, Checksum: ChecksumSHA256},
+	} {
+		output := filepath.Join(dir, "peanu.pnt")
+		if err := CompileToBinaryWith(input, output, opts); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Flip one bit in the body
+		data[len(data)/2] ^= 0x01
+		if err := os.WriteFile(output, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err = LoadBinary(output)
+		if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Errorf("%+v: expected checksum mismatch, got %v", opts, err)
+		}
+	}
+}
+
+func TestSignedBinary(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	if err := os.WriteFile(input, []byte(sampleConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	privFile, pubFile := filepath.Join(dir, "key.pem"), filepath.Join(dir, "key.pub.pem")
+	if err := GenerateKeyPair(privFile, pubFile); err != nil {
+		t.Fatal(err)
+	}
+	priv, err := LoadPrivateKey(privFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := LoadPublicKey(pubFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := filepath.Join(dir, "signed.pnt")
+	opts := WriteOptions{Version: FormatV2, Compression: CompressionZstd, Checksum: ChecksumCRC32, SigningKey: priv}
+	if err := CompileToBinaryWith(input, signed, opts); err != nil {
+		t.Fatalf("CompileToBinaryWith() returned error: %v", err)
+	}
+	unsigned := filepath.Join(dir, "unsigned.pnt")
+	if err := CompileToBinary(input, unsigned); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadBinaryWith(signed, LoadOptions{PublicKey: pub})
+	if err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if cfg.GetInt("server.port", 0) != 8080 {
+		t.Errorf("signed binary returned wrong values")
+	}
+	cfg.Close()
+
+	// Signed binaries still load when no key is configured
+	if cfg, err := LoadBinaryWith(signed, LoadOptions{}); err != nil {
+		t.Errorf("signed binary without a key returned error: %v", err)
+	} else {
+		cfg.Close()
+	}
+
+	if _, err := LoadBinaryWith(unsigned, LoadOptions{PublicKey: pub}); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("expected unsigned binary to be refused, got %v", err)
+	}
+
+	otherPriv, otherPub := filepath.Join(dir, "other.pem"), filepath.Join(dir, "other.pub.pem")
+	if err := GenerateKeyPair(otherPriv, otherPub); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := LoadPublicKey(otherPub)
+	if _, err := LoadBinaryWith(signed, LoadOptions{PublicKey: other}); err == nil || !strings.Contains(err.Error(), "signature verification failed") {
+		t.Errorf("expected signature from another key to be refused, got %v", err)
+	}
+
+	// Tamper with the header and recompute the CRC32 footer so only the
+	// signature catches it
+	data, err := os.ReadFile(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[8] ^= 0x01
+	content := data[:len(data)-4]
+	footer, _ := checksum(content, ChecksumCRC32)
+	if err := os.WriteFile(signed, append(content, footer...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(PublicKeyEnv, pubFile)
+	if _, err := LoadFile(signed); err == nil || !strings.Contains(err.Error(), "signature verification failed") {
+		t.Errorf("expected tampered binary to be refused, got %v", err)
+	}
+}
+
+func TestExecuteCompiledExpressions(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	content := `[app]
+mode: @env("TSK_TEST_MODE", "dev")
+db: @env("TSK_TEST_MODE") == "prod" && @env("TSK_TEST_REPLICA") ? "replica" : "localhost"
+workers: !@env("TSK_TEST_SINGLE") ? 8 : 1
+owner: "ops@example.com"
+year: @date("2006")
+`
+	if err := os.WriteFile(input, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "peanu.pnt")
+	if err := CompileToBinary(input, output); err != nil {
+		t.Fatalf("CompileToBinary() returned error: %v", err)
+	}
+
+	t.Setenv("TSK_TEST_MODE", "prod")
+	t.Setenv("TSK_TEST_REPLICA", "1")
+	for _, file := range []string{input, output} {
+		cfg, err := LoadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Get still returns the expression source
+		if got := cfg.GetString("app.mode", ""); got != `@env("TSK_TEST_MODE", "dev")` {
+			t.Errorf("%s: Get() returned %q, want the expression source", file, got)
+		}
+
+		values, err := cfg.Execute(NewVM())
+		if err != nil {
+			t.Fatalf("%s: Execute() returned error: %v", file, err)
+		}
+		want := map[string]interface{}{
+			"app.mode":    "prod",
+			"app.db":      "replica",
+			"app.workers": 8,
+			"app.owner":   "ops@example.com",
+			"app.year":    time.Now().Format("2006"),
+		}
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("%s: Execute() mismatch:\nwant %#v\ngot  %#v", file, want, values)
+		}
+
+		section, ok, err := cfg.Resolve("app", NewVM())
+		if err != nil || !ok || section.(map[string]interface{})["db"] != "replica" {
+			t.Errorf("%s: Resolve(app) returned %v, %v, %v", file, section, ok, err)
+		}
+		cfg.Close()
+	}
+
+	// Compiled programs dispatch to the VM's operators without re-parsing
+	var calls []string
+	vm := NewVMWith(func(name string, args ...interface{}) (interface{}, error) {
+		calls = append(calls, name)
+		return "", nil
+	})
+	cfg, err := LoadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Close()
+	if db, _, err := cfg.Resolve("app.db", vm); err != nil || db != "localhost" {
+		t.Errorf("Resolve(app.db) = %v, %v; want localhost", db, err)
+	}
+	if !reflect.DeepEqual(calls, []string{"env"}) {
+		t.Errorf("&& should short-circuit, operator calls: %v", calls)
+	}
+}
+
+func TestCachedExpressions(t *testing.T) {
+	ops := operators.New()
+	calls := 0
+	vm := NewVMWith(func(name string, args ...interface{}) (interface{}, error) {
+		if name == "count" {
+			calls++
+			return calls, nil
+		}
+		return ops.ExecuteOperator(name, args...)
+	})
+
+	for i := 0; i < 3; i++ {
+		if got, err := vm.Eval(`@cache("1m", @count("cached-test"))`); err != nil || got != 1 {
+			t.Fatalf("run %d: @cache returned %v, %v; want 1", i, got, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("the cached expression ran %d times", calls)
+	}
+
+	// Falsy values are cached too, and an explicit key is shared
+	for _, source := range []string{`@cache(60, @count() > 100, "flag")`, `@cache(60, @count() > 0, "flag")`} {
+		if got, err := vm.Eval(source); err != nil || got != false {
+			t.Errorf("%s returned %v, %v; want the cached false", source, got, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected one more evaluation, got %d", calls)
+	}
+
+	// Without a key, values are stored under a hash of the expression
+	if err := operators.ClearCache(); err != nil {
+		t.Fatalf("ClearCache() returned error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := vm.Eval(`@cache("1m", @count("stats"))`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hit, _ := ops.ExecuteOperator("cache.get", operators.CacheKey(`@count("stats")`)); hit == nil {
+		t.Error("the value is not stored under CacheKey of its source")
+	}
+	stats, err := operators.CacheStatus()
+	if err != nil {
+		t.Fatalf("CacheStatus() returned error: %v", err)
+	}
+	if want := (operators.CacheStats{Hits: 2, Misses: 1, Sets: 1, Entries: 1}); !reflect.DeepEqual(stats, want) {
+		t.Errorf("CacheStatus() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestDistributedCacheLicense(t *testing.T) {
+	t.Setenv(license.KeyEnv, "")
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { operators.SetCacheStore(nil) })
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	content := `[cache]
+backend: "redis"
+redis.url: "redis://127.0.0.1:1"
+`
+	if err := os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := LoadHierarchy(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a license the cache stays in memory and loading goes on
+	for i := 0; i < 2; i++ {
+		if _, err := cfg.Execute(NewVM()); err != nil {
+			t.Fatalf("Execute() without a license = %v", err)
+		}
+	}
+	if backend, _, err := cfg.CacheStatus(); err != nil || backend != "memory" {
+		t.Errorf("CacheStatus() without a license = %q, %v; want memory", backend, err)
+	}
+	if n := strings.Count(logged.String(), "premium tier"); n != 1 {
+		t.Errorf("want one license warning, got %d: %q", n, logged.String())
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("HOME"), ".tusk")); !os.IsNotExist(err) {
+		t.Errorf("loading the configuration created ~/.tusk: %v", err)
+	}
+
+	// A key alone, whatever tier it names, leaves the cache in memory
+	key := fmt.Sprintf("TUSK-PREMIUM-0123456789abcdef-%x", time.Now().Add(time.Hour).Unix())
+	content += "\n[license]\nkey: \"" + key + "\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _, err = LoadHierarchy(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.Execute(NewVM()); err != nil {
+		t.Errorf("Execute() with an unverified license.key = %v", err)
+	}
+	if backend, _, _ := cfg.CacheStatus(); backend != "memory" {
+		t.Errorf("CacheStatus() with an unverified license.key = %q, want memory", backend)
+	}
+
+	// Once the license server verifies it, @cache goes to Redis
+	key = fmt.Sprintf("TUSK-PREMIUM-fedcba9876543210-%x", time.Now().Add(time.Hour).Unix())
+	licensetest.Grant(t, key, license.TierPremium)
+	content = strings.Replace(content, "0123456789abcdef", "fedcba9876543210", 1)
+	if err := os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _, err = LoadHierarchy(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.Execute(NewVM()); err != nil {
+		t.Errorf("Execute() with license.key = %v", err)
+	}
+	if backend, _, _ := cfg.CacheStatus(); backend != "redis" {
+		t.Errorf("CacheStatus() with a verified license.key = %q, want redis", backend)
+	}
+}
+
+func TestWarmCache(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	content := `[cache]
+backend: "tiered"
+
+[app]
+hot: @cache("1m", @count("hot"))
+named: @cache("1m", @count("named"), "named")
+cold: @cache("1m", @count("cold"))
+plain: @count("plain")
+`
+	if err := os.WriteFile(input, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		StopCaches()
+		operators.SetCacheStore(nil)
+	})
+	ops := operators.New()
+	calls := make(map[string]int)
+	vm := NewVMWith(func(name string, args ...interface{}) (interface{}, error) {
+		if name == "count" {
+			calls[fmt.Sprint(args[0])]++
+			return calls[fmt.Sprint(args[0])], nil
+		}
+		return ops.ExecuteOperator(name, args...)
+	})
+	cfg, err := LoadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lookups are recorded while the tiered backend is in use
+	for i := 0; i < 3; i++ {
+		cfg.Resolve("app.hot", vm)
+	}
+	cfg.Resolve("app.named", vm)
+	cfg.Resolve("app.cold", vm)
+	StopCaches()
+	if err := cfg.ClearCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := cfg.WarmCache(vm, 2)
+	if err != nil {
+		t.Fatalf("WarmCache returned error: %v", err)
+	}
+	if len(report.Keys) != 2 || report.Keys[0].ConfigKey != "app.hot" || report.Keys[0].Lookups != 3 ||
+		report.Keys[0].Status != WarmEvaluated || report.Keys[1].Status != WarmEvaluated {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if calls["hot"] != 2 || calls["cold"]+calls["named"] != 3 {
+		t.Errorf("unexpected evaluations %v", calls)
+	}
+	if report, _ = cfg.WarmCache(vm, 0); len(report.Keys) != 3 || report.Keys[0].Status != WarmCached {
+		t.Errorf("second warm = %+v", report)
+	}
+
+	program, err := CompileExpression(`@cache("1m", @count("a"), "a") ? @cache("1m", @count("b")) : 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := program.CacheKeys(), []string{"a", operators.CacheKey(`@count("b")`)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CacheKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestCacheDependencies(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	content := `[db]
+host: @cache("1h", @env("DB_HOST", "localhost"), "db-host")
+url: @cache("1h", @env("DB_HOST") != "" && @env("DB_PORT") != "", "db-url")
+[dbx]
+pool: @cache("1h", @env("POOL") ? @env("POOL") : 4)
+[app]
+name: @cache("1h", @env("APP") == "" ? @cache("1m", @env("HOST")) : @env("APP"), "app")
+same: @cache("1h", @env("DB_HOST", "localhost"), "db-host")
+`
+	if err := os.WriteFile(input, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { operators.SetCacheStore(nil) })
+	cfg, err := LoadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graph, err := cfg.CacheDependencies()
+	if err != nil {
+		t.Fatalf("CacheDependencies returned error: %v", err)
+	}
+	deps := make(map[string]CacheDependency)
+	for _, dep := range graph {
+		deps[dep.CacheKey] = dep
+	}
+	if dep := deps["db-host"]; !reflect.DeepEqual(dep.ConfigKeys, []string{"app.same", "db.host"}) || !reflect.DeepEqual(dep.Env, []string{"DB_HOST"}) {
+		t.Errorf("db-host = %+v", dep)
+	}
+	if dep := deps["app"]; !reflect.DeepEqual(dep.Env, []string{"APP", "HOST"}) {
+		t.Errorf("app = %+v", dep)
+	}
+	if dep := deps[operators.CacheKey(`@env("HOST")`)]; !reflect.DeepEqual(dep.Env, []string{"HOST"}) {
+		t.Errorf("nested @cache = %+v", dep)
+	}
+	if len(graph) != 5 {
+		t.Errorf("graph has %d entries, want 5: %+v", len(graph), graph)
+	}
+
+	for _, dep := range graph {
+		operators.New().ExecuteOperator("cache", "1h", "v", dep.CacheKey)
+	}
+	invalidated, err := cfg.InvalidateCache([]string{"db."}, []string{"HOST"})
+	if err != nil {
+		t.Fatalf("InvalidateCache returned error: %v", err)
+	}
+	var keys []string
+	for _, dep := range invalidated {
+		keys = append(keys, dep.CacheKey)
+	}
+	want := []string{"app", "db-host", "db-url", operators.CacheKey(`@env("HOST")`)}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("invalidated %v, want %v", keys, want)
+	}
+	if stats, _ := operators.CacheStatus(); stats.Entries != 1 {
+		t.Errorf("%d entries left, want the one of dbx.pool", stats.Entries)
+	}
+}
+
+func TestFileOperators(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "certs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "certs", "ca.pem"), []byte("CERT"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "peanu.tsk")
+	content := `[tls]
+ca: @file.read("certs/ca.pem")
+ca_sum: @file.sha256("certs/ca.pem")
+has_key: @file.exists("certs/key.pem") ? "yes" : "no"
+`
+	if err := os.WriteFile(input, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "peanu.pnt")
+	if err := CompileToBinary(input, output); err != nil {
+		t.Fatalf("CompileToBinary() returned error: %v", err)
+	}
+	for _, file := range []string{input, output} {
+		// Relative paths resolve against the config, not the working directory
+		cfg, err := LoadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, err := cfg.Execute(NewVM())
+		cfg.Close()
+		if err != nil {
+			t.Fatalf("%s: Execute() returned error: %v", file, err)
+		}
+		want := map[string]interface{}{
+			"tls.ca":      "CERT",
+			"tls.ca_sum":  "fc3c8e63b513125abcbc527c9b18c1a1dad76f87d03b127609a89603d5d0c5c1",
+			"tls.has_key": "no",
+		}
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("%s: Execute() mismatch:\nwant %#v\ngot  %#v", file, want, values)
+		}
+	}
+
+	// files.root narrows the sandbox
+	if err := os.WriteFile(input, []byte("[files]\nroot: \"certs\"\n\n[tls]\nca: @file.read(\"../peanu.tsk\")\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.Execute(NewVM())
+	if err == nil || !strings.Contains(err.Error(), "outside the file root") {
+		t.Errorf("Expected reads outside files.root to fail, got %v", err)
+	} else if strings.Count(err.Error(), "@file.read") != 1 {
+		t.Errorf("Expected the error to name @file.read once, got %v", err)
+	}
+
+	// files.root cannot widen the sandbox beyond the config's directory
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("SECRET"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, root := range []string{"/", "..", filepath.Dir(outside)} {
+		content := fmt.Sprintf("[files]\nroot: %q\n\n[x]\nsecret: @file.read(%q)\n", root, outside)
+		if err := os.WriteFile(input, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, err := cfg.Execute(NewVM())
+		if tskerrors.KindOf(err) != tskerrors.Permission {
+			t.Errorf("files.root %q: Execute() = %v, %v; want a permission error", root, values, err)
+		}
+		// Only the host can widen it
+		cfg.SetFileRoot("/")
+		if values, err := cfg.Execute(NewVM()); err != nil || values["x.secret"] != "SECRET" {
+			t.Errorf("files.root %q under SetFileRoot(\"/\"): Execute() = %v, %v", root, values, err)
+		}
+	}
+	if root := operators.DefaultFiles.Root(); root != "." {
+		t.Errorf("loading configs moved operators.DefaultFiles to %s", root)
+	}
+}
+
+func TestFileSandboxPerConfig(t *testing.T) {
+	// Configs evaluated concurrently each read through their own directory
+	var configs []*Config
+	for i := 0; i < 4; i++ {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "id.txt"), []byte(fmt.Sprint(i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, "peanu.tsk")
+		if err := os.WriteFile(file, []byte("id: @file.read(\"id.txt\")\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		configs = append(configs, cfg)
+	}
+	var wg sync.WaitGroup
+	for i, cfg := range configs {
+		wg.Add(1)
+		go func(i int, cfg *Config) {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				values, err := cfg.Execute(NewVM())
+				if err != nil || values["id"] != fmt.Sprint(i) {
+					t.Errorf("config %d: Execute() = %v, %v", i, values, err)
+					return
+				}
+			}
+		}(i, cfg)
+	}
+	wg.Wait()
+}
+
+func TestCompileExpressionErrors(t *testing.T) {
+	for _, source := range []string{"plain text", "ops@example.com", "@example.com", `@peanu.tsk.get("database", "host")`, `@env("X"`, `@env("X") ? 1`, `1 == 2`} {
+		if _, err := CompileExpression(source); err == nil {
+			t.Errorf("CompileExpression(%q) should fail", source)
+		}
+	}
+}
+
+func TestProgramOperators(t *testing.T) {
+	program, err := CompileExpression(`@env("MODE") == "prod" ? @env("DB_HOST") : @date("Y") || @cache("5m", @http("GET", "x"))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(program.Operators(), ",")
+	if got != "cache,date,env,http" {
+		t.Errorf("Operators() = %s", got)
+	}
+}
+
+func TestJITCompile(t *testing.T) {
+	t.Setenv("JIT_MODE", "prod")
+	ops := operators.New()
+	calls := 0
+	call := func(name string, args ...interface{}) (interface{}, error) {
+		if name == "count" {
+			calls++
+			return calls, nil
+		}
+		return ops.ExecuteOperator(name, args...)
+	}
+
+	// Compiled programs agree with the interpreter
+	sources := []string{
+		`@env("JIT_MODE") == "prod" ? @string("p", @env("JIT_MODE")) : "dev"`,
+		`@env("JIT_MISSING") || @env("JIT_MODE") && !@env("JIT_MISSING")`,
+		`"a" < "b" ? @string("x", "y") : @count()`,
+		`@regex.match("^p[a-z]+$", @env("JIT_MODE"))`,
+		`@regex.replace("[0-9]+", @string(@env("JIT_MODE"), 1), "#")`,
+		`@env("JIT_MODE") > 3`,
+	}
+	for _, source := range sources {
+		program, err := CompileExpression(source)
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		want, wantErr := NewVMWith(call).interpret(program)
+		fn, _, err := compileProgram(NewVMWith(call), program)
+		if err != nil {
+			t.Errorf("%s did not compile: %v", source, err)
+			continue
+		}
+		got, gotErr := fn(NewVMWith(call))
+		if !reflect.DeepEqual(got, want) || fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+			t.Errorf("%s: compiled %v, %v; interpreted %v, %v", source, got, gotErr, want, wantErr)
+		}
+	}
+
+	// Hot programs switch to their compiled form, with constants resolved
+	compiler := jit.NewJITCompiler()
+	compiler.SetThreshold(3)
+	vm := NewVMWith(call)
+	vm.SetJIT(compiler)
+	source := `"a" < "b" ? @string("x", "y") : @count()`
+	for i := 0; i < 5; i++ {
+		if got, err := vm.Eval(source); err != nil || got != "xy" {
+			t.Fatalf("run %d = %v, %v", i, got, err)
+		}
+	}
+	program, _ := CompileExpression(`@regex.match("^[a-z]+$", @env("JIT_MODE"))`)
+	for i := 0; i < 3; i++ {
+		vm.Run(program)
+	}
+	stats := compiler.GetStats()
+	if stats.TotalCompilations != 2 || stats.CompiledExecutions != 2 || stats.InterpretedExecutions != 6 ||
+		stats.FoldedConstants != 3 || stats.PrecompiledRegexes != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	paths := compiler.GetHotPaths()
+	if len(paths) != 2 || paths[0].Signature != source || paths[0].State != jit.StateCompiled || paths[0].FoldedConstants != 3 {
+		t.Errorf("unexpected hot paths %+v", paths)
+	}
+	if calls != 0 {
+		t.Errorf("the branch not taken ran %d times", calls)
+	}
+
+	// A compiled @cache still only evaluates on a miss
+	t.Cleanup(func() { operators.ClearCache() })
+	compiler.SetThreshold(1)
+	for i := 0; i < 3; i++ {
+		if got, err := vm.Eval(`@cache("1m", @count(), "jit-cached")`); err != nil || got != 1 {
+			t.Fatalf("cached run %d = %v, %v", i, got, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("the cached expression ran %d times", calls)
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	content := "[app]\nname: \"bench\"\nport: 8080\nmode: @env(\"TSK_BENCH_MODE\", \"dev\")\n"
+	if err := os.WriteFile(input, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Benchmark(input, BenchmarkOptions{Iterations: 100, Warmup: 2, Write: DefaultWriteOptions})
+	if err != nil {
+		t.Fatalf("Benchmark() returned error: %v", err)
+	}
+	if report.Keys != 3 || report.BinarySize == 0 {
+		t.Errorf("report = %d keys, %d binary bytes", report.Keys, report.BinarySize)
+	}
+	for _, name := range []string{WorkloadParseText, WorkloadLoadBinary, WorkloadExecute, WorkloadExecuteInterpreted} {
+		result, ok := report.Result(name)
+		if !ok {
+			t.Fatalf("missing %s result", name)
+		}
+		if result.Iterations != 100 || result.P50 <= 0 || result.P50 > result.P95 || result.P95 > result.P99 || result.P99 > result.Max {
+			t.Errorf("%s: inconsistent latencies %+v", name, result)
+		}
+	}
+
+	// The @env expression runs 102 times, past the default threshold
+	if report.JIT == nil || report.JIT.TotalCompilations != 1 || report.JIT.CompiledExecutions == 0 {
+		t.Errorf("JIT stats = %+v, want the @env expression compiled", report.JIT)
+	}
+	// Each of the 102 parses takes its lines and a key builder
+	if pools := report.ParserPools; pools == nil || pools.Kinds["tokens"].TotalAllocated != 102 || pools.HitRate < 0.5 {
+		t.Errorf("parser pool stats = %+v, want 102 line slices, mostly reused", pools)
+	}
+
+	if _, err := Benchmark(input, BenchmarkOptions{}); err == nil {
+		t.Error("Benchmark() with zero iterations should fail")
+	}
+	if _, err := Benchmark(filepath.Join(dir, "peanu.pnt"), DefaultBenchmarkOptions); err == nil {
+		t.Error("Benchmark() of a binary should fail")
+	}
+}
+
+func TestWatchHierarchy(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "service")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(file, content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(root, "peanu.tsk"), "[server]\nhost: \"0.0.0.0\"\nport: 80\n")
+	write(filepath.Join(dir, "peanu.tsk"), "[server]\nport: 8080\n")
+
+	cfg, files, err := LoadHierarchy(dir)
+	if err != nil {
+		t.Fatalf("LoadHierarchy() returned error: %v", err)
+	}
+	if cfg.GetInt("server.port", 0) != 8080 || cfg.GetString("server.host", "") != "0.0.0.0" {
+		t.Errorf("LoadHierarchy() values = %v", cfg.values)
+	}
+	if len(files) < 2 || files[len(files)-1] != filepath.Join(dir, "peanu.tsk") {
+		t.Errorf("LoadHierarchy() files = %v", files)
+	}
+
+	for _, source := range []string{`@cache("1h", "stale", "watched")`, `@cache("1h", "kept", "unrelated")`} {
+		if _, err := NewVM().Eval(source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes := make(chan ConfigChange, 4)
+	w, err := Watch(dir, func(change ConfigChange) { changes <- change })
+	if err != nil {
+		t.Fatalf("Watch() returned error: %v", err)
+	}
+	defer w.Close()
+
+	// A change to the parent is seen through the child's hierarchy
+	write(filepath.Join(root, "peanu.tsk"), "[server]\nhost: \"127.0.0.1\"\nport: 80\ndebug: true\nbanner: @cache(\"1h\", \"hi\", \"watched\")\n")
+	select {
+	case change := <-changes:
+		if change.Err != nil {
+			t.Fatalf("change reported error: %v", change.Err)
+		}
+		want := []KeyChange{
+			{Key: "server.banner", Kind: KeyAdded, New: `@cache("1h", "hi", "watched")`},
+			{Key: "server.debug", Kind: KeyAdded, New: true},
+			{Key: "server.host", Kind: KeyModified, Old: "0.0.0.0", New: "127.0.0.1"},
+		}
+		if !reflect.DeepEqual(change.Changes, want) {
+			t.Errorf("Changes = %+v, want %+v", change.Changes, want)
+		}
+		if w.Config().GetString("server.host", "") != "127.0.0.1" {
+			t.Error("Config() was not reloaded")
+		}
+		// Only the entry a changed key computes is dropped
+		if !reflect.DeepEqual(change.Invalidated, []string{"watched"}) {
+			t.Errorf("Invalidated = %v", change.Invalidated)
+		}
+		if stale, _ := operators.CacheContains("watched"); stale {
+			t.Error("reload kept the entry of a changed key")
+		}
+		if kept, _ := operators.CacheContains("unrelated"); !kept {
+			t.Error("reload dropped an unrelated entry")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change delivered")
+	}
+
+	os.Remove(filepath.Join(dir, "peanu.tsk"))
+	select {
+	case change := <-changes:
+		want := []KeyChange{{Key: "server.port", Kind: KeyModified, Old: 8080, New: 80}}
+		if !reflect.DeepEqual(change.Changes, want) {
+			t.Errorf("Changes after remove = %+v, want %+v", change.Changes, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change delivered after remove")
+	}
+
+	// Reload drops cached results even when no file changed, and reports
+	// nothing when the values stay the same
+	if _, err := NewVM().Eval(`@cache("1h", "stale", "watched")`); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() returned error: %v", err)
+	}
+	if stats, _ := operators.CacheStatus(); stats.Entries != 0 {
+		t.Errorf("Reload() left %d @cache entries", stats.Entries)
+	}
+	select {
+	case change := <-changes:
+		t.Errorf("Reload() without changes delivered %+v", change)
+	default:
+	}
+	w.Close()
+	if err := w.Reload(); err == nil {
+		t.Error("Reload() after Close() should fail")
+	}
+}
+
+// deepHierarchy creates depth nested directories, each with a peanu.tsk of
+// keys values that override and append to those above, and returns the
+// deepest directory with the file of each level
+func deepHierarchy(tb testing.TB, depth, keys int) (string, []string) {
+	dir := tb.TempDir()
+	var files []string
+	for level := 0; level < depth; level++ {
+		dir = filepath.Join(dir, fmt.Sprintf("l%d", level))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		var content strings.Builder
+		fmt.Fprintf(&content, "[level]\ndepth: %d\ntags +=: [\"l%d\"]\n", level, level)
+		for section := 0; section < keys/10; section++ {
+			fmt.Fprintf(&content, "\n[s%d]\n", section)
+			for key := 0; key < 10; key++ {
+				fmt.Fprintf(&content, "k%d: \"%d-%d\"\n", key, level, (section+key)%(level+1))
+			}
+		}
+		file := filepath.Join(dir, "peanu.tsk")
+		if err := os.WriteFile(file, []byte(content.String()), 0644); err != nil {
+			tb.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return dir, files
+}
+
+func TestParallelHierarchy(t *testing.T) {
+	dir, files := deepHierarchy(t, 24, 50)
+
+	sequential, err := resolveHierarchy(dir, 1)
+	if err != nil {
+		t.Fatalf("resolveHierarchy() returned error: %v", err)
+	}
+	parallel, err := resolveHierarchy(dir, 8)
+	if err != nil {
+		t.Fatalf("resolveHierarchy() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(parallel.Files, sequential.Files) || !reflect.DeepEqual(parallel.Config.values, sequential.Config.values) ||
+		!reflect.DeepEqual(parallel.Origins, sequential.Origins) {
+		t.Error("parallel parsing merged differently from sequential parsing")
+	}
+	if tags := parallel.Config.Get("level.tags", nil).([]interface{}); len(tags) != 24 || tags[0] != "l0" || tags[23] != "l23" {
+		t.Errorf("appended tags = %v, want l0 to l23 in order", tags)
+	}
+
+	// Of two broken files, the one closer to the root is reported
+	for _, i := range []int{20, 5} {
+		if err := os.Remove(files[i]); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(files[i], 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		if _, err := resolveHierarchy(dir, 8); err == nil || !strings.Contains(err.Error(), files[5]) {
+			t.Fatalf("resolveHierarchy() returned %v, want the error of %s", err, files[5])
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracing.NewRecorder()
+	provider, err := tracing.Setup(tracing.Options{}, recorder, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Shutdown(context.Background())
+
+	dir, files := deepHierarchy(t, 3, 10)
+	if _, err := resolveHierarchy(dir, 2); err != nil {
+		t.Fatalf("resolveHierarchy() returned error: %v", err)
+	}
+	cfg := FromValues(map[string]interface{}{"app.mode": `@env("TSK_TEST_TRACE_MODE", "dev")`})
+	if _, err := cfg.Execute(NewVM()); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+
+	spans := map[string][]tracing.SpanData{}
+	for _, s := range recorder.Spans() {
+		spans[s.Name] = append(spans[s.Name], s)
+	}
+	hierarchy, parses := spans["peanut.hierarchy"], spans["peanut.parse"]
+	if len(hierarchy) != 1 || len(parses) != len(files) {
+		t.Fatalf("recorded %v, want a hierarchy span and %d parses", spans, len(files))
+	}
+	for _, parse := range parses {
+		if parse.Parent != hierarchy[0].SpanID || !hasAttribute(parse, "tsk.format", "text") {
+			t.Errorf("parse span = %+v, want a text parse under the hierarchy", parse)
+		}
+	}
+	execute, env := spans["peanut.execute"], spans["@env"]
+	if len(execute) != 1 || len(env) != 1 || env[0].Parent != execute[0].SpanID || !hasAttribute(env[0], "tsk.operator", "env") {
+		t.Errorf("recorded %v, want @env under peanut.execute", spans)
+	}
+}
+
+func hasAttribute(s tracing.SpanData, key, value string) bool {
+	for _, attr := range s.Attributes {
+		if string(attr.Key) == key {
+			return attr.Value.Emit() == value
+		}
+	}
+	return false
+}
+
+func TestHierarchyStamp(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "service")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(root, "peanu.tsk"), []byte("port: 80\n"), 0644)
+
+	stamp := func() string {
+		t.Helper()
+		s, err := HierarchyStamp(dir)
+		if err != nil {
+			t.Fatalf("HierarchyStamp() returned error: %v", err)
+		}
+		return s
+	}
+	first := stamp()
+	if first != stamp() {
+		t.Error("the stamp of unchanged files should not change")
+	}
+	// A file appearing closer to dir changes it
+	os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte("port: 8080\n"), 0644)
+	second := stamp()
+	if second == first {
+		t.Error("a new file should change the stamp")
+	}
+	os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte("port: 8081\n"), 0644)
+	os.Chtimes(filepath.Join(dir, "peanu.tsk"), time.Now(), time.Now().Add(time.Minute))
+	if stamp() == second {
+		t.Error("an edited file should change the stamp")
+	}
+}
+
+func TestCompileChunked(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "inventory.tsk")
+	var content strings.Builder
+	content.WriteString("name: \"inventory\"\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&content, "[host%03d]\naddress: \"10.0.%d.%d\"\nport: %d\ntags: [\"rack%d\"]\nmode: @env(\"TSK_TEST_MODE\", \"dev\")\n", i, i/256, i%256, 8000+i, i%4)
+	}
+	// A repeated section overrides values from an earlier chunk
+	content.WriteString("[host000]\nport: 1\n")
+	if err := os.WriteFile(input, []byte(content.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(dir, "want.pnt")
+	if err := CompileToBinary(input, want); err != nil {
+		t.Fatal(err)
+	}
+	wantCfg, err := LoadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wantCfg.Close()
+	wantValues, err := wantCfg.Execute(NewVM())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupt after the first chunk, then resume
+	output := filepath.Join(dir, "inventory.pnt")
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := ChunkedOptions{Write: DefaultWriteOptions, ChunkSize: 512, Progress: func(CompileProgress) { cancel() }}
+	opts.Write.Compression = CompressionZstd
+	if err := CompileChunked(ctx, input, output, opts); err == nil {
+		t.Fatal("CompileChunked() with a cancelled context should fail")
+	}
+	if _, err := os.Stat(output); err == nil {
+		t.Fatal("interrupted compile left an output file")
+	}
+
+	var last CompileProgress
+	resumed := false
+	opts.Progress = func(p CompileProgress) {
+		resumed = resumed || p.Resumed
+		last = p
+	}
+	if err := CompileChunked(context.Background(), input, output, opts); err != nil {
+		t.Fatalf("CompileChunked() returned error: %v", err)
+	}
+	if !resumed {
+		t.Error("second compile did not resume from the checkpoint")
+	}
+	if last.Phase != PhaseMerge || last.Done != last.Total {
+		t.Errorf("last progress = %+v", last)
+	}
+	if _, err := os.Stat(output + ".parts"); !os.IsNotExist(err) {
+		t.Error("work directory was not removed")
+	}
+
+	cfg, err := LoadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Close()
+	values, err := cfg.Execute(NewVM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("chunked binary differs: %d keys, want %d", len(values), len(wantValues))
+	}
+	if cfg.GetInt("host000.port", 0) != 1 {
+		t.Errorf("host000.port = %v, want the later value 1", cfg.Get("host000.port", nil))
+	}
+}
+
+func TestMaxTextFileSize(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "peanu.tsk")
+	if err := os.WriteFile(file, []byte("[app]\nname: \"big\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(max int64) { MaxTextFileSize = max }(MaxTextFileSize)
+
+	MaxTextFileSize = 8
+	if _, err := LoadFile(file); err == nil || !strings.Contains(err.Error(), "--chunked") {
+		t.Errorf("LoadFile() over the limit returned %v", err)
+	}
+	MaxTextFileSize = 0
+	if _, err := LoadFile(file); err != nil {
+		t.Errorf("LoadFile() with the guard disabled returned error: %v", err)
+	}
+}
+
+func TestHierarchyMergeStrategies(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "service")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	parent := `[app]
+features: ["search", "export"]
+name: "base"
+
+[database]
+host: "db.internal"
+pool: 10
+
+[cache]
+ttl: 60
+driver: "redis"
+`
+	child := `[app]
+features +=: ["beta"]
+
+[database]
+host: "localhost"
+
+[cache =]
+driver: "memory"
+`
+	if err := os.WriteFile(filepath.Join(root, "peanu.tsk"), []byte(parent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte(child), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := ResolveHierarchy(dir)
+	if err != nil {
+		t.Fatalf("ResolveHierarchy() returned error: %v", err)
+	}
+	cfg := h.Config
+	if got := cfg.Get("app.features", nil); !reflect.DeepEqual(got, []interface{}{"search", "export", "beta"}) {
+		t.Errorf("app.features = %v, want appended array", got)
+	}
+	if cfg.GetString("database.host", "") != "localhost" || cfg.GetInt("database.pool", 0) != 10 {
+		t.Errorf("database was not deep-merged: %v", cfg.Get("database", nil))
+	}
+	if _, ok, _ := cfg.Lookup("cache.ttl"); ok || cfg.GetString("cache.driver", "") != "memory" {
+		t.Errorf("cache was not replaced: %v", cfg.Get("cache", nil))
+	}
+
+	childFile, parentFile := filepath.Join(dir, "peanu.tsk"), filepath.Join(root, "peanu.tsk")
+	wantOrigins := map[string]KeyOrigin{
+		"app.features": {Key: "app.features", File: childFile, Line: 2, Strategy: config.MergeAppend, Overrides: []string{parentFile}, Chain: []KeySource{
+			{File: parentFile, Line: 2, Value: []interface{}{"search", "export"}, Strategy: config.MergeDeep},
+			{File: childFile, Line: 2, Value: []interface{}{"beta"}, Strategy: config.MergeAppend},
+		}},
+		"database.host": {Key: "database.host", File: childFile, Line: 5, Strategy: config.MergeDeep, Overrides: []string{parentFile}, Chain: []KeySource{
+			{File: parentFile, Line: 6, Value: "db.internal", Strategy: config.MergeDeep},
+			{File: childFile, Line: 5, Value: "localhost", Strategy: config.MergeDeep},
+		}},
+		"database.pool": {Key: "database.pool", File: parentFile, Line: 7, Strategy: config.MergeDeep, Chain: []KeySource{
+			{File: parentFile, Line: 7, Value: 10, Strategy: config.MergeDeep},
+		}},
+		"cache.driver": {Key: "cache.driver", File: childFile, Line: 8, Strategy: config.MergeReplace, Chain: []KeySource{
+			{File: childFile, Line: 8, Value: "memory", Strategy: config.MergeReplace},
+		}},
+	}
+	for key, want := range wantOrigins {
+		if got := h.Origins[key]; !reflect.DeepEqual(got, want) {
+			t.Errorf("Origins[%s] = %+v, want %+v", key, got, want)
+		}
+		if got, ok := cfg.Origin(key); !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("Origin(%s) = %+v, want %+v", key, got, want)
+		}
+	}
+	if origin := h.Origins["database.host"]; !origin.Overridden() || h.Origins["database.pool"].Overridden() {
+		t.Errorf("Overridden() wrong for database.host/database.pool")
+	}
+	single, err := LoadFile(parentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin, ok := single.Origin("cache.ttl"); !ok || origin.File != parentFile || origin.Line != 10 || len(origin.Chain) != 1 {
+		t.Errorf("Origin(cache.ttl) of a single file = %+v", origin)
+	}
+	wantDropped := []DroppedKey{
+		{Key: "cache.driver", File: parentFile, By: childFile},
+		{Key: "cache.ttl", File: parentFile, By: childFile},
+	}
+	if !reflect.DeepEqual(h.Dropped, wantDropped) {
+		t.Errorf("Dropped = %+v, want %+v", h.Dropped, wantDropped)
+	}
+
+	overlay := filepath.Join(dir, "peanu.production.tsk")
+	if err := os.WriteFile(overlay, []byte("[app]\nfeatures +=: [\"audit\"]\n\n[database =]\nhost: \"db.prod\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Overlay(overlay); err != nil {
+		t.Fatalf("Overlay() returned error: %v", err)
+	}
+	if got := cfg.Get("app.features", nil); !reflect.DeepEqual(got, []interface{}{"search", "export", "beta", "audit"}) {
+		t.Errorf("app.features after overlay = %v", got)
+	}
+	if _, ok, _ := cfg.Lookup("database.pool"); ok || cfg.GetString("database.host", "") != "db.prod" {
+		t.Errorf("database was not replaced by the overlay: %v", cfg.Get("database", nil))
+	}
+	if cfg.File() != overlay || h.Files[len(h.Files)-1] != overlay {
+		t.Errorf("overlay not recorded: file %s, files %v", cfg.File(), h.Files)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	key := "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // base64 of 32 bytes
+	t.Setenv(security.SecretKeyEnv, key)
+	security.ResetSecretKey()
+	defer security.ResetSecretKey()
+
+	rawKey, err := security.SecretKey()
+	if err != nil {
+		t.Fatalf("SecretKey() returned error: %v", err)
+	}
+	secret, err := security.EncryptSecret("s3cr3t pa$$", rawKey)
+	if err != nil {
+		t.Fatalf("EncryptSecret() returned error: %v", err)
+	}
+	if strings.Contains(secret, "s3cr3t") || !security.IsSecret(secret) {
+		t.Fatalf("unexpected secret %s", secret)
+	}
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	if err := os.WriteFile(input, []byte("[database]\npassword: "+secret+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "peanu.pnt")
+	if err := CompileToBinary(input, output); err != nil {
+		t.Fatalf("CompileToBinary() returned error: %v", err)
+	}
+	for _, file := range []string{input, output} {
+		cfg, err := LoadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.GetString("database.password", ""); got != "s3cr3t pa$$" {
+			t.Errorf("%s: Get() = %q, want the decrypted secret", file, got)
+		}
+		if got, _, err := cfg.Resolve("database.password", NewVM()); err != nil || got != "s3cr3t pa$$" {
+			t.Errorf("%s: Resolve() = %v, %v", file, got, err)
+		}
+		cfg.Close()
+	}
+
+	// A KMS-style command supplies the same key; a wrong key fails loudly
+	t.Setenv(security.SecretKeyEnv, "")
+	t.Setenv(security.SecretKeyCommandEnv, "echo "+key)
+	security.ResetSecretKey()
+	cfg, err := LoadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.GetString("database.password", ""); got != "s3cr3t pa$$" {
+		t.Errorf("Get() with %s = %q", security.SecretKeyCommandEnv, got)
+	}
+	t.Setenv(security.SecretKeyCommandEnv, "echo "+strings.Repeat("ab", 32))
+	security.ResetSecretKey()
+	if got := cfg.GetString("database.password", "fallback"); got != "fallback" {
+		t.Errorf("Get() with the wrong key = %q, want the default", got)
+	}
+	if _, err := cfg.Secret("database.password"); err == nil || !strings.Contains(err.Error(), "wrong key") {
+		t.Errorf("Secret() with the wrong key returned %v", err)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	dir := b.TempDir()
+	input := filepath.Join(dir, "peanu.tsk")
+	output := filepath.Join(dir, "peanu.pnt")
+	if err := os.WriteFile(input, []byte(sampleConfig), 0644); err != nil {
+		b.Fatal(err)
+	}
+	if err := CompileToBinary(input, output); err != nil {
+		b.Fatal(err)
+	}
+	text, err := LoadFile(input)
+	if err != nil {
+		b.Fatal(err)
+	}
+	binary, err := LoadBinary(output)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer binary.Close()
+
+	for _, cfg := range []*Config{text, binary} {
+		b.Run(filepath.Ext(cfg.File())[1:], func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				cfg.Get(getKeys[i%len(getKeys)], nil)
+			}
+		})
+	}
+	b.Run("pnt-decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			binary.index.lookupWith(getKeys[i%len(getKeys)], binary.index.decode)
+		}
+	})
+	b.Run("parse-value", func(b *testing.B) {
+		values := []string{"localhost", "8080", "1.5", "true"}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			config.ParseValue(values[i%len(values)])
+		}
+	})
+}
+
+func BenchmarkResolveHierarchy(b *testing.B) {
+	dir, _ := deepHierarchy(b, 48, 400)
+	// The parallel speedup is bounded by the merge, which stays sequential
+	for _, run := range []struct {
+		name    string
+		workers int
+	}{{"sequential", 1}, {"parallel", runtime.GOMAXPROCS(0)}} {
+		b.Run(run.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := resolveHierarchy(dir, run.workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
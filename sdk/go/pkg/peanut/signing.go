@@ -0,0 +1,130 @@
+package peanut
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+// PublicKeyEnv names a PEM public key file. When set, LoadBinary refuses
+// binaries that are unsigned or whose signature does not verify.
+const PublicKeyEnv = "TSK_BINARY_PUBLIC_KEY"
+
+// flagSigned marks a v2 file carrying an Ed25519 signature before its footer
+const flagSigned uint32 = 1 << 8
+
+// LoadOptions controls how a binary is loaded
+type LoadOptions struct {
+	// PublicKey, when set, requires a valid signature from the matching key
+	PublicKey ed25519.PublicKey
+}
+
+// DefaultLoadOptions returns the options used by LoadBinary, reading the
+// verification key from $TSK_BINARY_PUBLIC_KEY
+func DefaultLoadOptions() (LoadOptions, error) {
+	file := os.Getenv(PublicKeyEnv)
+	if file == "" {
+		return LoadOptions{}, nil
+	}
+	key, err := LoadPublicKey(file)
+	if err != nil {
+		return LoadOptions{}, fmt.Errorf("%s: %w", PublicKeyEnv, err)
+	}
+	return LoadOptions{PublicKey: key}, nil
+}
+
+// LoadPrivateKey reads a PKCS#8 PEM Ed25519 private key
+func LoadPrivateKey(file string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(file, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %w", file, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not an Ed25519 key", file)
+	}
+	return priv, nil
+}
+
+// LoadPublicKey reads a PKIX PEM Ed25519 public key
+func LoadPublicKey(file string) (ed25519.PublicKey, error) {
+	block, err := readPEM(file, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", file, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an Ed25519 key", file)
+	}
+	return pub, nil
+}
+
+// GenerateKeyPair writes a new Ed25519 private key and its public key as PEM
+func GenerateKeyPair(privateFile, publicFile string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	if err := os.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := os.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+	return nil
+}
+
+func readPEM(file, blockType string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM %s block", file, blockType)
+	}
+	return block, nil
+}
+
+// verifySignature checks and strips the signature of a v2 file whose footer
+// has already been removed
+func verifySignature(content []byte, fl uint32, opts LoadOptions) ([]byte, error) {
+	if fl&flagSigned == 0 {
+		if opts.PublicKey != nil {
+			return nil, tskerrors.New(tskerrors.Validation, "binary is not signed and a public key is configured")
+		}
+		return content, nil
+	}
+
+	if len(content) < v2HeaderSize+ed25519.SignatureSize {
+		return nil, fmt.Errorf("file too short for its signature (truncated?)")
+	}
+	signed, signature := content[:len(content)-ed25519.SignatureSize], content[len(content)-ed25519.SignatureSize:]
+	if opts.PublicKey != nil && !ed25519.Verify(opts.PublicKey, signed, signature) {
+		return nil, tskerrors.New(tskerrors.Validation, "signature verification failed: binary was tampered with or signed by another key")
+	}
+	return signed, nil
+}
@@ -0,0 +1,1044 @@
+package peanut
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/license"
+	"github.com/cyber-boost/tusktsk/pkg/adaptive"
+	"github.com/cyber-boost/tusktsk/pkg/blobstore"
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+	"github.com/cyber-boost/tusktsk/pkg/features"
+	"github.com/cyber-boost/tusktsk/pkg/messaging"
+	"github.com/cyber-boost/tusktsk/pkg/mongowire"
+	"github.com/cyber-boost/tusktsk/pkg/operators"
+	perfcache "github.com/cyber-boost/tusktsk/pkg/performance/cache"
+	"github.com/cyber-boost/tusktsk/pkg/performance/jit"
+	"github.com/cyber-boost/tusktsk/pkg/rediswire"
+	"github.com/cyber-boost/tusktsk/pkg/secretstore"
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OperatorFunc executes a named operator such as "env" or "date"
+type OperatorFunc func(name string, args ...interface{}) (interface{}, error)
+
+// VM evaluates compiled operator expressions on a value stack
+type VM struct {
+	call OperatorFunc
+	jit  *jit.JITCompiler
+	// ctx is the trace operator spans are recorded in
+	ctx context.Context
+}
+
+// NewVM creates a VM backed by the standard operator set. Programs it runs
+// more than jit.Default's threshold are compiled to closures.
+func NewVM() *VM {
+	vm := NewVMWith(operators.New().ExecuteOperator)
+	vm.jit = jit.Default
+	return vm
+}
+
+// NewVMWith creates a VM that dispatches operator calls to call. It
+// interprets every program unless SetJIT gives it a compiler.
+func NewVMWith(call OperatorFunc) *VM {
+	return &VM{call: call}
+}
+
+// WithContext returns a copy of the VM recording its operator calls as
+// spans of the trace in ctx
+func (vm *VM) WithContext(ctx context.Context) *VM {
+	c := *vm
+	c.ctx = ctx
+	return &c
+}
+
+// withFiles returns a copy of the VM whose @file operators are confined to
+// files instead of operators.DefaultFiles
+func (vm *VM) withFiles(files *operators.FileSandbox) *VM {
+	c := *vm
+	call := vm.call
+	c.call = func(name string, args ...interface{}) (interface{}, error) {
+		if fn := files.Operator(name); fn != nil {
+			return fn(args...)
+		}
+		return call(name, args...)
+	}
+	return &c
+}
+
+// context returns the VM's trace context
+func (vm *VM) context() context.Context {
+	if vm.ctx == nil {
+		return context.Background()
+	}
+	return vm.ctx
+}
+
+// invoke calls an operator, in a span of its own while tracing is on
+func (vm *VM) invoke(name string, args ...interface{}) (interface{}, error) {
+	if !tracing.Enabled() {
+		return vm.call(name, args...)
+	}
+	_, span := tracing.Start(vm.context(), "@"+name, trace.SpanKindInternal)
+	result, err := vm.call(name, args...)
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("tsk.operator", name))
+		tracing.Fail(span, err)
+	}
+	span.End()
+	return result, err
+}
+
+// Eval compiles and runs an expression
+func (vm *VM) Eval(source string) (interface{}, error) {
+	program, err := CompileExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	return vm.Run(program)
+}
+
+// Run executes a compiled program and returns its result, through its
+// compiled form once the program is hot
+func (vm *VM) Run(program *Program) (interface{}, error) {
+	if vm.jit != nil && program.Source != "" {
+		form, compile := vm.jit.Lookup(program.Source)
+		if fn, ok := form.(jitFunc); ok {
+			return fn(vm)
+		}
+		if compile {
+			if fn := vm.compile(program); fn != nil {
+				return fn(vm)
+			}
+		}
+	}
+	return vm.interpret(program)
+}
+
+// interpret executes the instructions of a program. Jumps only go forward,
+// so every program terminates.
+func (vm *VM) interpret(program *Program) (interface{}, error) {
+	code := program.Code
+	stack := make([]interface{}, 0, 8)
+
+	pop := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("stack underflow")
+		}
+		value := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return value, nil
+	}
+	operand := func(pc int) (int, error) {
+		if pc+2 > len(code) {
+			return 0, fmt.Errorf("truncated instruction at %d", pc-1)
+		}
+		return int(binary.LittleEndian.Uint16(code[pc:])), nil
+	}
+	jumpTarget := func(pc int) (int, error) {
+		target, err := operand(pc)
+		if err != nil {
+			return 0, err
+		}
+		if target <= pc || target > len(code) {
+			return 0, fmt.Errorf("invalid jump target %d at %d", target, pc-1)
+		}
+		return target, nil
+	}
+	constant := func(pc int) (interface{}, error) {
+		index, err := operand(pc)
+		if err != nil {
+			return nil, err
+		}
+		if index >= len(program.Consts) {
+			return nil, fmt.Errorf("invalid constant %d at %d", index, pc-1)
+		}
+		return program.Consts[index], nil
+	}
+
+	for pc := 0; pc < len(code); {
+		op := code[pc]
+		pc++
+
+		switch op {
+		case opConst:
+			value, err := constant(pc)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, value)
+			pc += 2
+
+		case opCall:
+			nameValue, err := constant(pc)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := nameValue.(string)
+			if !ok || pc+2 >= len(code) {
+				return nil, fmt.Errorf("invalid call at %d", pc-1)
+			}
+			argc := int(code[pc+2])
+			pc += 3
+			if argc > len(stack) {
+				return nil, fmt.Errorf("stack underflow calling @%s", name)
+			}
+			args := append([]interface{}(nil), stack[len(stack)-argc:]...)
+			stack = stack[:len(stack)-argc]
+
+			result, err := vm.invoke(name, args...)
+			if err != nil {
+				return nil, fmt.Errorf("@%s: %w", name, err)
+			}
+			stack = append(stack, result)
+
+		case opJump:
+			target, err := jumpTarget(pc)
+			if err != nil {
+				return nil, err
+			}
+			pc = target
+
+		case opJumpIfFalse, opJumpIfFalseKeep, opJumpIfTrueKeep:
+			target, err := jumpTarget(pc)
+			if err != nil {
+				return nil, err
+			}
+			pc += 2
+
+			var value interface{}
+			if op == opJumpIfFalse {
+				if value, err = pop(); err != nil {
+					return nil, err
+				}
+			} else {
+				if len(stack) == 0 {
+					return nil, fmt.Errorf("stack underflow")
+				}
+				value = stack[len(stack)-1]
+			}
+
+			jump := truthy(value) == (op == opJumpIfTrueKeep)
+			switch {
+			case jump:
+				pc = target
+			case op != opJumpIfFalse:
+				stack = stack[:len(stack)-1]
+			}
+
+		case opNot:
+			value, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, !truthy(value))
+
+		case opEq, opNe, opLt, opGt, opLe, opGe:
+			right, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			left, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			result, err := compareValues(op, left, right)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, result)
+
+		default:
+			return nil, fmt.Errorf("unknown opcode %d at %d", op, pc-1)
+		}
+	}
+
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("expression left %d values on the stack", len(stack))
+	}
+	return stack[0], nil
+}
+
+// resolve evaluates expression strings inside a decoded value
+func (vm *VM) resolve(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !isExpression(v) {
+			return v, nil
+		}
+		program, err := CompileExpression(v)
+		if err != nil {
+			// Not an expression after all, e.g. an e-mail address
+			return v, nil
+		}
+		return vm.Run(program)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved, err := vm.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = resolved
+		}
+		return items, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			resolved, err := vm.resolve(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			m[key] = resolved
+		}
+		return m, nil
+	}
+	return value, nil
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case int:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	}
+	return true
+}
+
+func compareValues(op byte, left, right interface{}) (bool, error) {
+	var cmp int
+	lf, lnum := toFloat(left)
+	rf, rnum := toFloat(right)
+	ls, lstr := left.(string)
+	rs, rstr := right.(string)
+
+	switch {
+	case lnum && rnum:
+		switch {
+		case lf < rf:
+			cmp = -1
+		case lf > rf:
+			cmp = 1
+		}
+	case lstr && rstr:
+		cmp = strings.Compare(ls, rs)
+	case op == opEq || op == opNe:
+		// Mixed types: operator results are often strings, so "8080" == 8080
+		equal := fmt.Sprint(left) == fmt.Sprint(right)
+		return equal == (op == opEq), nil
+	default:
+		return false, fmt.Errorf("cannot compare %T with %T", left, right)
+	}
+
+	switch op {
+	case opEq:
+		return cmp == 0, nil
+	case opNe:
+		return cmp != 0, nil
+	case opLt:
+		return cmp < 0, nil
+	case opGt:
+		return cmp > 0, nil
+	case opLe:
+		return cmp <= 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// Resolve returns the value at key with operator expressions evaluated by
+// vm. Expressions compiled into v2 binaries run without being re-parsed.
+func (c *Config) Resolve(key string, vm *VM) (interface{}, bool, error) {
+	vm, err := c.configureOperators(vm)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.index != nil {
+		return c.index.lookupWith(key, c.index.executor(vm))
+	}
+
+	value, ok, err := c.Lookup(key)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	resolved, err := vm.resolve(value)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", key, err)
+	}
+	return resolved, true, nil
+}
+
+// Execute returns every flat key with operator expressions evaluated. While
+// tracing is on, the evaluation and each operator call are recorded as
+// spans of the trace of vm's context.
+func (c *Config) Execute(vm *VM) (map[string]interface{}, error) {
+	if !tracing.Enabled() {
+		return c.execute(vm)
+	}
+	ctx, span := tracing.Start(vm.context(), "peanut.execute", trace.SpanKindInternal)
+	defer span.End()
+	values, err := c.execute(vm.WithContext(ctx))
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("tsk.file", c.file), attribute.Int("tsk.keys", len(values)))
+		tracing.Fail(span, err)
+	}
+	return values, err
+}
+
+// execute is Execute without its span
+func (c *Config) execute(vm *VM) (map[string]interface{}, error) {
+	vm, err := c.configureOperators(vm)
+	if err != nil {
+		return nil, err
+	}
+	if c.index != nil {
+		if c.index.data == nil {
+			return nil, fmt.Errorf("configuration is closed")
+		}
+		execute := c.index.executor(vm)
+		values := make(map[string]interface{}, c.index.count)
+		for i := 0; i < c.index.count; i++ {
+			key, value, err := execute(i)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+		}
+		return values, nil
+	}
+
+	values := make(map[string]interface{}, len(c.values))
+	for key, value := range c.values {
+		resolved, err := vm.resolve(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		values[key] = resolved
+	}
+	return values, nil
+}
+
+// configureOperators applies the configuration sections that operators
+// depend on. It returns vm with the @file operators confined to the
+// sandbox of c.
+func (c *Config) configureOperators(vm *VM) (*VM, error) {
+	if err := c.configureSecretStores(); err != nil {
+		return nil, err
+	}
+	if _, err := c.configureCacheStore(); err != nil {
+		return nil, err
+	}
+	// Files first: other sections may read keys with @file.read
+	files, err := c.fileSandbox()
+	if err != nil {
+		return nil, err
+	}
+	vm = vm.withFiles(files)
+	if err := c.configurePlugins(); err != nil {
+		return nil, err
+	}
+	if err := c.configureHTTP(vm); err != nil {
+		return nil, err
+	}
+	if err := c.configureGraphQL(vm); err != nil {
+		return nil, err
+	}
+	if err := c.configureGRPC(vm); err != nil {
+		return nil, err
+	}
+	if err := c.configureBlobs(vm); err != nil {
+		return nil, err
+	}
+	if err := c.configureJWT(vm); err != nil {
+		return nil, err
+	}
+	if err := c.configureMetrics(); err != nil {
+		return nil, err
+	}
+	if err := c.configureMessaging(vm); err != nil {
+		return nil, err
+	}
+	if err := c.configureFeatures(vm); err != nil {
+		return nil, err
+	}
+	if err := c.configureAdaptive(vm); err != nil {
+		return nil, err
+	}
+	if err := c.configureQueryTargets(); err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+// SetFileRoot confines the @file operators of c to root rather than the
+// config file's directory. It is for the host: the config itself can only
+// narrow the sandbox, with a files.root inside it.
+func (c *Config) SetFileRoot(root string) {
+	c.fileRoot = root
+}
+
+// fileSandbox returns the sandbox of the @file operators of c, rooted at
+// files.root, relative to the config file, or at the config file's
+// directory. files.root may not leave that directory or the root the host
+// set, so a config cannot widen its own access.
+func (c *Config) fileSandbox() (*operators.FileSandbox, error) {
+	base := c.fileRoot
+	if base == "" {
+		base = "."
+		if c.file != "" {
+			base = filepath.Dir(c.file)
+		}
+	}
+	base, err := filepath.Abs(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve file root: %w", err)
+	}
+	root, ok, err := c.Lookup("files.root")
+	if err != nil || !ok {
+		return operators.NewFileSandbox(base), err
+	}
+	path := fmt.Sprint(root)
+	if !filepath.IsAbs(path) {
+		dir := base
+		if c.file != "" {
+			dir = filepath.Dir(c.file)
+		}
+		path = filepath.Join(dir, path)
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve files.root: %w", err)
+	}
+	if rel, err := filepath.Rel(base, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, tskerrors.New(tskerrors.Permission, "files.root %s is outside %s", root, base)
+	}
+	return operators.NewFileSandbox(path), nil
+}
+
+// configurePlugins loads the operator plugins in plugins.dir, relative to
+// the config file
+func (c *Config) configurePlugins() error {
+	dir, ok, err := c.Lookup("plugins.dir")
+	if err != nil || !ok {
+		return err
+	}
+	path := fmt.Sprint(dir)
+	if !filepath.IsAbs(path) && c.file != "" {
+		path = filepath.Join(filepath.Dir(c.file), path)
+	}
+	_, err = operators.LoadPlugins(path)
+	return err
+}
+
+// configureHTTP applies the [http] section to @http: the hosts it may call
+// and the headers it sends, which may use operators such as @env
+func (c *Config) configureHTTP(vm *VM) error {
+	values, ok, err := c.resolvedSection("http", vm)
+	if err != nil || !ok {
+		return err
+	}
+	opts, err := operators.HTTPOptionsFrom(values)
+	if err != nil {
+		return err
+	}
+	operators.DefaultHTTP.Configure(opts)
+	return nil
+}
+
+// configureGraphQL names the endpoints of the [graphql] section for
+// @graphql, with headers that may use operators such as @env
+func (c *Config) configureGraphQL(vm *VM) error {
+	values, ok, err := c.resolvedSection("graphql", vm)
+	if err != nil || !ok {
+		return err
+	}
+	endpoints, err := operators.GraphQLEndpointsFrom(values)
+	if err != nil {
+		return err
+	}
+	operators.DefaultGraphQL.Configure(endpoints)
+	return nil
+}
+
+// configureGRPC names the services of the [grpc] section for @grpc, with
+// descriptor sets relative to the config file
+func (c *Config) configureGRPC(vm *VM) error {
+	values, ok, err := c.resolvedSection("grpc", vm)
+	if err != nil || !ok {
+		return err
+	}
+	services, err := operators.GRPCServicesFrom(values)
+	if err != nil {
+		return err
+	}
+	for name, service := range services {
+		if service.Descriptors != "" && !filepath.IsAbs(service.Descriptors) && c.file != "" {
+			service.Descriptors = filepath.Join(filepath.Dir(c.file), service.Descriptors)
+			services[name] = service
+		}
+	}
+	operators.DefaultGRPC.Configure(services)
+	return nil
+}
+
+// configureBlobs points @s3.get, @gcs.get and @azblob.get at the
+// regions, accounts and endpoints of the [blobs] section
+func (c *Config) configureBlobs(vm *VM) error {
+	values, ok, err := c.resolvedSection("blobs", vm)
+	if err != nil || !ok {
+		return err
+	}
+	opts, err := blobstore.OptionsFrom(values)
+	if err != nil {
+		return err
+	}
+	blobstore.Default.Configure(opts)
+	return nil
+}
+
+// configureJWT names the keys of the [jwt] section for the @jwt operators
+func (c *Config) configureJWT(vm *VM) error {
+	values, ok, err := c.resolvedSection("jwt", vm)
+	if err != nil || !ok {
+		return err
+	}
+	keys, err := operators.JWTKeysFrom(values)
+	if err != nil {
+		return err
+	}
+	operators.DefaultJWT.Configure(keys)
+	return nil
+}
+
+// configureMessaging names the Kafka and NATS brokers of the [messaging]
+// section for @publish and @consume_latest
+func (c *Config) configureMessaging(vm *VM) error {
+	values, ok, err := c.resolvedSection("messaging", vm)
+	if err != nil || !ok {
+		return err
+	}
+	opts, err := messaging.OptionsFrom(values)
+	if err != nil {
+		return err
+	}
+	messaging.Default.Configure(opts)
+	return nil
+}
+
+// configureMetrics declares the counters, gauges and histograms of the
+// [metrics] section for @metrics
+func (c *Config) configureMetrics() error {
+	section, ok, err := c.Lookup("metrics")
+	if err != nil || !ok {
+		return err
+	}
+	tree, isSection := section.(map[string]interface{})
+	if !isSection {
+		return fmt.Errorf("metrics must be a section")
+	}
+	values := make(map[string]interface{})
+	for key, value := range config.Flatten(tree) {
+		values["metrics."+key] = value
+	}
+	defs, err := operators.MetricDefsFrom(values)
+	if err != nil {
+		return err
+	}
+	operators.DefaultMetrics.Configure(defs)
+	return nil
+}
+
+// configureFeatures loads the flags of the [features] section for
+// @feature, with the runtime overrides kept next to the config file
+func (c *Config) configureFeatures(vm *VM) error {
+	if c.file != "" {
+		features.Default.SetOverridesFile(features.OverridesPath(filepath.Dir(c.file)))
+	}
+	values, ok, err := c.resolvedSection("features", vm)
+	if err != nil || !ok {
+		return err
+	}
+	opts, err := features.OptionsFrom(values)
+	if err != nil {
+		return err
+	}
+	features.Default.Configure(opts)
+	return nil
+}
+
+// configureAdaptive applies the [adaptive] section to @optimize and
+// @learn, keeping their state next to the config file
+func (c *Config) configureAdaptive(vm *VM) error {
+	values, ok, err := c.resolvedSection("adaptive", vm)
+	if err != nil {
+		return err
+	}
+	if !ok && c.file == "" {
+		return nil
+	}
+	opts, err := adaptive.OptionsFrom(values)
+	if err != nil {
+		return err
+	}
+	if c.file != "" {
+		if opts.State == "" {
+			opts.State = adaptive.StateFile
+		}
+		if !filepath.IsAbs(opts.State) {
+			opts.State = filepath.Join(filepath.Dir(c.file), opts.State)
+		}
+	}
+	return adaptive.Default.Configure(opts)
+}
+
+// resolvedSection returns the flat keys of a section, prefixed with its
+// name, with operators such as @env evaluated by vm
+func (c *Config) resolvedSection(name string, vm *VM) (map[string]interface{}, bool, error) {
+	section, ok, err := c.Lookup(name)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	tree, isSection := section.(map[string]interface{})
+	if !isSection {
+		return nil, false, fmt.Errorf("%s must be a section", name)
+	}
+	values := make(map[string]interface{})
+	for key, value := range config.Flatten(tree) {
+		resolved, err := vm.resolve(value)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s.%s: %w", name, key, err)
+		}
+		values[name+"."+key] = resolved
+	}
+	return values, true, nil
+}
+
+// configureCacheStore moves @cache results out of process memory when
+// [cache] sets backend: "redis" keeps them in Redis, from cache.redis
+// falling back to database.redis; "tiered" layers memory, disk and
+// optionally Redis or memcached (see configureTieredCache). Sharing the
+// cache through Redis or memcached needs a license unlocking
+// license.CapabilityDistributedCache; without one the cache stays local,
+// in memory or without its L3, and a warning is logged. It returns the
+// backend in use.
+func (c *Config) configureCacheStore() (string, error) {
+	backend, ok, err := c.Lookup("cache.backend")
+	if err != nil {
+		return "", err
+	}
+	if !ok || (backend != "redis" && backend != "tiered") {
+		return "memory", nil
+	}
+	shared := true
+	if backend == "redis" || c.GetString("cache.l3", "") != "" {
+		if err := license.DefaultRegistry.Check(c.License(), license.CapabilityDistributedCache); err != nil {
+			c.cacheWarning.Do(func() {
+				log.Printf("warning: %v; @cache results stay in this process", err)
+			})
+			if backend == "redis" {
+				return "memory", nil
+			}
+			shared = false
+		}
+	}
+	values := make(map[string]interface{})
+	for _, prefix := range []string{"cache", "database.redis"} {
+		section, ok, err := c.Lookup(prefix)
+		if err != nil {
+			return "", err
+		}
+		if tree, isSection := section.(map[string]interface{}); ok && isSection {
+			for key, value := range config.Flatten(tree) {
+				values[prefix+"."+key] = value
+			}
+		}
+	}
+	url, ok, err := rediswire.ConfigURL(values, "cache.redis")
+	if err == nil && !ok {
+		url, ok, err = rediswire.ConfigURL(values, "database.redis")
+		if ok {
+			values["cache.redis.url"] = url
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if backend == "tiered" {
+		if !shared {
+			delete(values, "cache.l3")
+		}
+		return "tiered", c.configureTieredCache(values)
+	}
+	if !ok {
+		return "", fmt.Errorf("cache.backend is redis but neither cache.redis nor database.redis is configured")
+	}
+	prefix, _ := values["cache.prefix"].(string)
+	if prefix == "" {
+		prefix = "tsk:cache:"
+	}
+	operators.SetCacheStore(rediswire.SharedCache(url, prefix))
+	return "redis", nil
+}
+
+// License returns the license of license.key, or license.Current when
+// the configuration has none
+func (c *Config) License() *license.TuskLicense {
+	if key := c.GetString("license.key", ""); key != "" {
+		return license.ForKey(key)
+	}
+	return license.Current()
+}
+
+// tieredCaches holds one cache manager per L2 directory, shared by every
+// configuration naming it
+var (
+	tieredMu     sync.Mutex
+	tieredCaches = make(map[string]*tieredCache)
+)
+
+// configureTieredCache backs @cache with a cache manager: L1 in memory,
+// L2 on disk and L3 in Redis or memcached. Settings of [cache]:
+//
+//	l1_size_mb    L1 bound, default 64
+//	l2_dir        L2 directory, relative to the config file; default .tsk/cache
+//	l2_size_mb    L2 bound, default 512
+//	l3            "redis" (cache.redis or database.redis) or "memcached"
+//	              (cache.memcached); without it L3 is a second memory level
+//	promote_hits  L2 hits before an entry moves up to L1, default 2
+//	access_log    file counting lookups per key for tsk cache warm;
+//	              default .tsk/cache-access.json
+func (c *Config) configureTieredCache(values map[string]interface{}) error {
+	dir, err := c.cachePath("cache.l2_dir", filepath.Join(".tsk", "cache"))
+	if err != nil {
+		return err
+	}
+	accessLog, err := c.cacheAccessLog()
+	if err != nil {
+		return err
+	}
+
+	tieredMu.Lock()
+	defer tieredMu.Unlock()
+	if store, ok := tieredCaches[dir]; ok {
+		operators.SetCacheStore(store)
+		return nil
+	}
+	l3, err := perfcache.L3BackendFromConfig(values)
+	if err != nil {
+		return err
+	}
+	l1Size := c.GetInt("cache.l1_size_mb", 64) << 20
+	manager, err := perfcache.OpenCacheManager(&perfcache.ManagerConfig{
+		L1Size:         l1Size,
+		L2Size:         c.GetInt("cache.l2_size_mb", 512) << 20,
+		L3Size:         l1Size,
+		L2Dir:          dir,
+		PromoteHits:    c.GetInt("cache.promote_hits", 2),
+		L2WriteThrough: true,
+		AccessLog:      accessLog,
+		L3Backend:      l3,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open the tiered cache: %w", err)
+	}
+	store := &tieredCache{manager: manager}
+	tieredCaches[dir] = store
+	operators.SetCacheStore(store)
+	return nil
+}
+
+// cachePath reads the path setting key, or def, relative to the config
+// file, as an absolute path
+func (c *Config) cachePath(key, def string) (string, error) {
+	path := c.GetString(key, def)
+	if !filepath.IsAbs(path) && c.file != "" {
+		path = filepath.Join(filepath.Dir(c.file), path)
+	}
+	return filepath.Abs(path)
+}
+
+// cacheAccessLog returns the file a tiered cache counts lookups in
+func (c *Config) cacheAccessLog() (string, error) {
+	return c.cachePath("cache.access_log", filepath.Join(".tsk", "cache-access.json"))
+}
+
+// StopCaches stops the tiered caches configurations opened, saving what
+// they hold in memory and their access counts to disk. Processes call it
+// before exiting; a later @cache opens them again.
+func StopCaches() {
+	tieredMu.Lock()
+	defer tieredMu.Unlock()
+	for dir, store := range tieredCaches {
+		store.manager.Stop()
+		delete(tieredCaches, dir)
+	}
+}
+
+// tieredCache adapts a cache manager to the @cache store interface
+type tieredCache struct {
+	manager *perfcache.CacheManager
+}
+
+func (t *tieredCache) Get(key string) (interface{}, bool, error) {
+	value, ok := t.manager.Get(key)
+	return value, ok, nil
+}
+
+func (t *tieredCache) Set(key string, value interface{}, ttl time.Duration) error {
+	return t.manager.Set(key, value, ttl)
+}
+
+func (t *tieredCache) Contains(key string) (bool, error) {
+	return t.manager.Contains(key)
+}
+
+func (t *tieredCache) Delete(key string) error {
+	t.manager.Delete(key)
+	return nil
+}
+
+func (t *tieredCache) Clear() error {
+	return t.manager.Clear()
+}
+
+// CacheLevels reports each level for CacheStatus
+func (t *tieredCache) CacheLevels() []operators.CacheLevel {
+	var levels []operators.CacheLevel
+	for _, level := range t.manager.Levels() {
+		levels = append(levels, operators.CacheLevel{
+			Name:      level.Name,
+			Backend:   level.Backend,
+			Hits:      level.Hits,
+			Misses:    level.Misses,
+			Evictions: level.Evictions,
+			Entries:   level.Entries,
+			Bytes:     int64(level.Size),
+		})
+	}
+	return levels
+}
+
+// CacheStatus reports the @cache store this configuration selects: its
+// backend, "memory", "redis" or "tiered", and its entries and counters
+func (c *Config) CacheStatus() (string, operators.CacheStats, error) {
+	backend, err := c.configureCacheStore()
+	if err != nil {
+		return "", operators.CacheStats{}, err
+	}
+	stats, err := operators.CacheStatus()
+	return backend, stats, err
+}
+
+// ClearCache drops every @cache entry in the store this configuration
+// selects
+func (c *Config) ClearCache() error {
+	if _, err := c.configureCacheStore(); err != nil {
+		return err
+	}
+	return operators.ClearCache()
+}
+
+// configureQueryTargets points @query("mongodb:...") at the server in the
+// [database] mongodb section, if any. The connection opens on first use.
+func (c *Config) configureQueryTargets() error {
+	section, ok, err := c.Lookup("database.mongodb")
+	if err != nil || !ok {
+		return err
+	}
+	tree, isSection := section.(map[string]interface{})
+	if !isSection {
+		return fmt.Errorf("database.mongodb must be a section")
+	}
+	values := make(map[string]interface{})
+	for key, value := range config.Flatten(tree) {
+		values["database.mongodb."+key] = value
+	}
+	if uri, ok := mongowire.ConfigURI(values); ok {
+		operators.RegisterQueryTarget("mongodb", mongowire.TargetFor(uri).Query)
+	}
+	return nil
+}
+
+// configureSecretStores opts the @vault, @awssecrets and @gcpsecret
+// operators into the providers listed in the [secrets] section, if any
+func (c *Config) configureSecretStores() error {
+	section, ok, err := c.Lookup("secrets")
+	if err != nil || !ok {
+		return err
+	}
+	tree, isSection := section.(map[string]interface{})
+	if !isSection {
+		return fmt.Errorf("secrets must be a section")
+	}
+	values := make(map[string]interface{})
+	for key, value := range config.Flatten(tree) {
+		values["secrets."+key] = value
+	}
+	opts, err := secretstore.OptionsFrom(values)
+	if err != nil {
+		return err
+	}
+	secretstore.Default.Configure(opts)
+	return nil
+}
+
+// executor decodes index entries, running compiled programs with vm
+func (bi *binaryIndex) executor(vm *VM) func(i int) (string, interface{}, error) {
+	return func(i int) (string, interface{}, error) {
+		key, raw, err := bi.entry(i)
+		if err != nil {
+			return "", nil, err
+		}
+
+		program, err := programFromRaw(raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("key %s: %w", key, err)
+		}
+		if program != nil {
+			value, err := vm.Run(program)
+			if err != nil {
+				return "", nil, fmt.Errorf("key %s: %w", key, err)
+			}
+			return string(key), value, nil
+		}
+
+		k, value, err := bi.decode(i)
+		if err != nil {
+			return "", nil, err
+		}
+		value, err = vm.resolve(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("key %s: %w", key, err)
+		}
+		return k, value, nil
+	}
+}
@@ -0,0 +1,259 @@
+package peanut
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/operators"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Kinds of KeyChange
+const (
+	KeyAdded    = "added"
+	KeyRemoved  = "removed"
+	KeyModified = "modified"
+)
+
+// KeyChange is one key that differs between two loads of a configuration.
+// Old is nil for added keys and New is nil for removed keys.
+type KeyChange struct {
+	Key  string      `json:"key"`
+	Kind string      `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// ConfigChange is delivered by Watch after the hierarchy is reloaded
+type ConfigChange struct {
+	// Trigger is the file whose change caused the reload, empty for Reload
+	Trigger string
+	// Files are the files of the reloaded hierarchy, root first
+	Files   []string
+	Changes []KeyChange
+	// Invalidated are the @cache keys dropped because a changed key
+	// computes them
+	Invalidated []string
+	// Config is the reloaded configuration, or the previous one when Err is set
+	Config *Config
+	// Err reports a reload failure, such as a file saved halfway through an edit
+	Err error
+}
+
+// watchDebounce coalesces the bursts of events editors produce for one save
+const watchDebounce = 100 * time.Millisecond
+
+// Diff returns the keys that differ between two flat value maps, sorted by key
+func Diff(old, new map[string]interface{}) []KeyChange {
+	var changes []KeyChange
+	for key, value := range new {
+		previous, ok := old[key]
+		switch {
+		case !ok:
+			changes = append(changes, KeyChange{Key: key, Kind: KeyAdded, New: value})
+		case !reflect.DeepEqual(previous, value):
+			changes = append(changes, KeyChange{Key: key, Kind: KeyModified, Old: previous, New: value})
+		}
+	}
+	for key, value := range old {
+		if _, ok := new[key]; !ok {
+			changes = append(changes, KeyChange{Key: key, Kind: KeyRemoved, Old: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// Watcher reloads a configuration hierarchy when its files change
+type Watcher struct {
+	dir     string
+	fn      func(ConfigChange)
+	watcher *fsnotify.Watcher
+
+	mu      sync.Mutex
+	current *Config
+	files   []string
+	reloads chan chan error
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// Watch loads the hierarchy of dir and calls fn whenever a peanu.tsk,
+// peanu.peanuts or peanu.pnt file in dir or one of its parents is created,
+// changed or removed. fn is not called when a save leaves every value as it
+// was. Call Close to stop watching.
+func Watch(dir string, fn func(ConfigChange)) (*Watcher, error) {
+	cfg, files, err := LoadHierarchy(dir)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := hierarchyDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	// Directories rather than files are watched so that atomic saves
+	// (write to a temp file, rename over the original) and newly created
+	// files are seen
+	for i, d := range dirs {
+		if err := fsw.Add(d); err != nil {
+			if i < len(dirs)-1 {
+				// An unreadable parent cannot hold a file we loaded either
+				continue
+			}
+			fsw.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", d, err)
+		}
+	}
+
+	w := &Watcher{
+		dir:     dir,
+		fn:      fn,
+		watcher: fsw,
+		current: cfg,
+		files:   files,
+		reloads: make(chan chan error),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Config returns the most recently loaded configuration
+func (w *Watcher) Config() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Files returns the files of the most recently loaded hierarchy, root first
+func (w *Watcher) Files() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.files...)
+}
+
+// Reload loads the hierarchy again now, as a change of its files would, and
+// returns once fn has seen the result, with the error loading it if any.
+// Cached operator results are dropped first so remote sources are fetched
+// again. It must not be called from fn.
+func (w *Watcher) Reload() error {
+	ack := make(chan error)
+	select {
+	case w.reloads <- ack:
+		return <-ack
+	case <-w.done:
+		return fmt.Errorf("watcher is closed")
+	}
+}
+
+// Close stops watching. No callbacks run after Close returns.
+func (w *Watcher) Close() error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+	}
+	close(w.done)
+	err := w.watcher.Close()
+	<-w.stopped
+	return err
+}
+
+func (w *Watcher) run() {
+	defer close(w.stopped)
+
+	var timer *time.Timer
+	var fire <-chan time.Time
+	trigger := ""
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !isPeanutFile(event.Name) || event.Op == fsnotify.Chmod {
+				continue
+			}
+			trigger = event.Name
+			if timer == nil {
+				timer = time.NewTimer(watchDebounce)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(watchDebounce)
+			}
+			fire = timer.C
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.fn(ConfigChange{Config: w.Config(), Files: w.Files(), Err: fmt.Errorf("watch failed: %w", err)})
+
+		case <-fire:
+			fire = nil
+			w.reload(trigger)
+
+		case ack := <-w.reloads:
+			operators.ClearCache()
+			ack <- w.reload("")
+		}
+	}
+}
+
+// reload loads the hierarchy again and reports the keys that changed
+func (w *Watcher) reload(trigger string) error {
+	cfg, files, err := LoadHierarchy(w.dir)
+	if err != nil {
+		w.fn(ConfigChange{Trigger: trigger, Config: w.Config(), Files: w.Files(), Err: err})
+		return err
+	}
+
+	w.mu.Lock()
+	previous := w.current
+	w.current, w.files = cfg, files
+	w.mu.Unlock()
+
+	changes := Diff(previous.values, cfg.values)
+	if len(changes) == 0 {
+		return nil
+	}
+	// Drop the cached values the changed keys computed, before and after
+	// the edit; the rest stay warm. An unreachable store keeps its entries
+	// until their TTLs run out.
+	invalidated := changedCacheKeys(changes)
+	operators.DeleteCache(invalidated...)
+	w.fn(ConfigChange{Trigger: trigger, Files: files, Changes: changes, Invalidated: invalidated, Config: cfg})
+	return nil
+}
+
+// isPeanutFile reports whether path is one of the files LoadHierarchy reads
+func isPeanutFile(path string) bool {
+	base := filepath.Base(path)
+	for _, name := range searchNames {
+		if base == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// MaxAccessKeys bounds the keys an access snapshot keeps; the least used
+// are dropped on save
+const MaxAccessKeys = 10000
+
+// KeyAccess counts the lookups of one key
+type KeyAccess struct {
+	Key   string    `json:"key"`
+	Count int64     `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+// AccessSnapshot is the access frequency of keys across runs, persisted by
+// a manager with an AccessLog and read back to warm a cold cache. Keys are
+// ordered most used first. Processes sharing the file merge their counts
+// by reading it back before each save, so concurrent saves can lose a few
+// counts; the order is what matters.
+type AccessSnapshot struct {
+	Updated time.Time   `json:"updated"`
+	Keys    []KeyAccess `json:"keys"`
+}
+
+// LoadAccessSnapshot reads the snapshot in file; a missing file is an empty
+// snapshot
+func LoadAccessSnapshot(file string) (*AccessSnapshot, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return &AccessSnapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshot AccessSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to read access snapshot %s: %v", file, err)
+	}
+	return &snapshot, nil
+}
+
+// Top returns the n most used keys, or every key when n is 0 or less
+func (s *AccessSnapshot) Top(n int) []KeyAccess {
+	if n <= 0 || n > len(s.Keys) {
+		n = len(s.Keys)
+	}
+	return s.Keys[:n]
+}
+
+// merge adds counts to the snapshot and orders its keys again
+func (s *AccessSnapshot) merge(counts map[string]*KeyAccess) {
+	index := make(map[string]int, len(s.Keys))
+	for i, access := range s.Keys {
+		index[access.Key] = i
+	}
+	for key, access := range counts {
+		i, ok := index[key]
+		if !ok {
+			s.Keys = append(s.Keys, KeyAccess{Key: key})
+			i = len(s.Keys) - 1
+		}
+		s.Keys[i].Count += access.Count
+		if access.Last.After(s.Keys[i].Last) {
+			s.Keys[i].Last = access.Last
+		}
+	}
+	sort.Slice(s.Keys, func(i, j int) bool {
+		a, b := s.Keys[i], s.Keys[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if !a.Last.Equal(b.Last) {
+			return a.Last.After(b.Last)
+		}
+		return a.Key < b.Key
+	})
+	if len(s.Keys) > MaxAccessKeys {
+		s.Keys = s.Keys[:MaxAccessKeys]
+	}
+}
+
+// Save writes the snapshot to file, replacing it atomically
+func (s *AccessSnapshot) Save(file string) error {
+	s.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBackend is an L3 backend in memory
+type fakeBackend struct {
+	mu   sync.Mutex
+	data map[string]interface{}
+	gets int
+}
+
+func (b *fakeBackend) Get(key string) (interface{}, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.gets++
+	value, ok := b.data[key]
+	return value, ok, nil
+}
+
+func (b *fakeBackend) Set(key string, value interface{}, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data[key] = value
+	return nil
+}
+
+func (b *fakeBackend) Delete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.data, key)
+	return nil
+}
+
+func (b *fakeBackend) Clear() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = make(map[string]interface{})
+	return nil
+}
+
+func TestL1Cache(t *testing.T) {
+	c := NewL1Cache(100, LRU, 0)
+	defer c.Stop()
+	var evicted []string
+	c.OnEvict(func(entry *CacheEntry) { evicted = append(evicted, entry.Key) })
+
+	c.Set("a", "aaaaaaaaaa")
+	c.Set("a", "aaaaaaaaaa")
+	if size := c.GetSize(); size != 12 {
+		t.Errorf("size after overwrite = %d, want 12", size)
+	}
+	// A TTL of 0 never expires
+	if _, ok := c.Get("a"); !ok {
+		t.Error("entry without a TTL missed")
+	}
+
+	c.Set("b", strings.Repeat("b", 40))
+	c.Set("c", strings.Repeat("c", 40))
+	c.Get("a")
+	c.Set("d", strings.Repeat("d", 40))
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Errorf("evicted %v, want [b]", evicted)
+	}
+	stats := c.GetStats()
+	if stats.Gets != 2 || stats.Hits != 2 || stats.Evictions != 1 || stats.Entries != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	c.SetWithTTL("e", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("e"); ok {
+		t.Error("expired entry hit")
+	}
+	if err := c.Set("big", strings.Repeat("x", 200)); err == nil {
+		t.Error("expected an error for a value larger than the cache")
+	}
+}
+
+func TestL2Cache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewL2Cache(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("NewL2Cache returned error: %v", err)
+	}
+	if err := c.Set("answer", map[string]interface{}{"n": 42}, 0); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	c.Set("short", "gone", time.Millisecond)
+	c.Set("line\nbreak", "kept", 0)
+	time.Sleep(5 * time.Millisecond)
+
+	// Reopening indexes what is on disk and drops the rest
+	os.WriteFile(filepath.Join(dir, "ab", ".tmp-123"), []byte("partial"), 0600)
+	os.MkdirAll(filepath.Join(dir, "ff"), 0700)
+	os.WriteFile(filepath.Join(dir, "ff", "junk"), []byte("not an entry"), 0600)
+	c, err = NewL2Cache(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("reopen returned error: %v", err)
+	}
+	if n := c.Len(); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+	if value, ok := c.Get("answer"); !ok || value.(map[string]interface{})["n"] != float64(42) {
+		t.Errorf("Get = %v, %v", value, ok)
+	}
+	if value, ok := c.Get("line\nbreak"); !ok || value != "kept" {
+		t.Errorf("Get of a key with a newline = %v, %v", value, ok)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ff", "junk")); !os.IsNotExist(err) {
+		t.Error("stray file not removed")
+	}
+
+	// Bounded by bytes on disk, least recently used first
+	small, _ := NewL2Cache(t.TempDir(), 150, 0)
+	small.Set("one", strings.Repeat("1", 50), 0)
+	time.Sleep(time.Millisecond)
+	small.Set("two", strings.Repeat("2", 50), 0)
+	time.Sleep(time.Millisecond)
+	small.Get("one")
+	small.Set("three", strings.Repeat("3", 50), 0)
+	if _, ok := small.Get("two"); ok {
+		t.Error("least recently used entry kept")
+	}
+	if _, ok := small.Get("one"); !ok {
+		t.Error("recently used entry evicted")
+	}
+	if stats := small.GetStats(); stats.Evictions != 1 || int64(stats.Size) > 150 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if err := c.Clear(); err != nil || c.Len() != 0 {
+		t.Errorf("Clear = %v, Len %d", err, c.Len())
+	}
+}
+
+func TestCacheManagerLevels(t *testing.T) {
+	dir := t.TempDir()
+	backend := &fakeBackend{data: map[string]interface{}{"remote": "from l3"}}
+	config := &ManagerConfig{L1Size: 64, L2Dir: dir, PromoteHits: 2, L3Backend: backend}
+	m, err := OpenCacheManager(config)
+	if err != nil {
+		t.Fatalf("OpenCacheManager returned error: %v", err)
+	}
+
+	// An L3 hit is copied to L2 but waits for a second hit to reach L1
+	if value, ok := m.Get("remote"); !ok || value != "from l3" {
+		t.Fatalf("Get = %v, %v", value, ok)
+	}
+	if _, ok := m.l1Cache.Get("remote"); ok {
+		t.Error("L3 hit promoted to L1 before PromoteHits")
+	}
+	m.Get("remote")
+	if _, ok := m.l1Cache.Get("remote"); ok {
+		t.Error("first L2 hit promoted to L1")
+	}
+	m.Get("remote")
+	if _, ok := m.l1Cache.Get("remote"); !ok {
+		t.Error("second L2 hit not promoted to L1")
+	}
+	if backend.gets != 1 {
+		t.Errorf("L3 read %d times, want 1", backend.gets)
+	}
+
+	// Filling L1 demotes its oldest entries to L2
+	m.Set("a", strings.Repeat("a", 30), 0)
+	m.Set("b", strings.Repeat("b", 30), 0)
+	m.Set("c", strings.Repeat("c", 30), 0)
+	if backend.data["a"] == nil {
+		t.Error("Set did not write through to L3")
+	}
+	deadline := time.Now().Add(time.Second)
+	for m.GetStats().Demotions == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := m.l2Cache.Get("a"); !ok {
+		t.Error("evicted entry not demoted to L2")
+	}
+
+	stats := m.GetStats()
+	if stats.L1Hits != 0 || stats.L2Hits != 2 || stats.L3Hits != 1 || stats.Promotions != 1 || stats.Demotions == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	levels := m.Levels()
+	if len(levels) != 3 || levels[1].Backend != "disk" || levels[2].Backend != "custom" || levels[2].Hits != 1 {
+		t.Errorf("unexpected levels %+v", levels)
+	}
+
+	// Stop demotes what L1 holds, so a new manager starts warm
+	m.Stop()
+	backend.Clear()
+	m, err = OpenCacheManager(&ManagerConfig{L1Size: 64, L2Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+	if value, ok := m.Get("c"); !ok || value != strings.Repeat("c", 30) {
+		t.Errorf("entry lost across restart: %v, %v", value, ok)
+	}
+
+	// A Set replaces the copy on disk
+	m.Set("a", "new", 0)
+	m.l1Cache.Delete("a")
+	if value, _ := m.Get("a"); value == strings.Repeat("a", 30) {
+		t.Error("stale L2 copy served after Set")
+	}
+}
+
+func TestCacheManagerWithoutL2(t *testing.T) {
+	m := NewCacheManager(&ManagerConfig{L1Size: 1024, L2Dir: filepath.Join(os.DevNull, "cache")})
+	defer m.Stop()
+	m.Set("k", "v", 0)
+	if value, ok := m.Get("k"); !ok || value != "v" {
+		t.Errorf("Get = %v, %v", value, ok)
+	}
+	if levels := m.Levels(); len(levels) != 2 || levels[1].Backend != "memory" {
+		t.Errorf("unexpected levels %+v", levels)
+	}
+}
+
+func TestFlushToDisk(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	m := NewCacheManager(&ManagerConfig{L1Size: 1024})
+	m.Set("k", "v", 0)
+	m.Set("gone", "v", time.Millisecond)
+	if err := m.FlushToDisk(file); err != nil {
+		t.Fatalf("FlushToDisk returned error: %v", err)
+	}
+	m.Stop()
+
+	time.Sleep(5 * time.Millisecond)
+	m = NewCacheManager(&ManagerConfig{L1Size: 1024})
+	defer m.Stop()
+	if err := m.LoadFromDisk(file); err != nil {
+		t.Fatalf("LoadFromDisk returned error: %v", err)
+	}
+	if _, ok := m.l1Cache.Get("k"); !ok {
+		t.Error("entry not restored")
+	}
+	if _, ok := m.l1Cache.Get("gone"); ok {
+		t.Error("expired entry restored")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "access.json")
+	for run := 0; run < 2; run++ {
+		m := NewCacheManager(&ManagerConfig{L1Size: 1024, AccessLog: file})
+		for i := 0; i < 3; i++ {
+			m.Get("hot")
+		}
+		m.Get("cold")
+		if run == 1 {
+			m.Get("new")
+		}
+		m.Stop()
+	}
+
+	snapshot, err := LoadAccessSnapshot(file)
+	if err != nil {
+		t.Fatalf("LoadAccessSnapshot returned error: %v", err)
+	}
+	top := snapshot.Top(2)
+	if len(top) != 2 || top[0].Key != "hot" || top[0].Count != 6 || top[1].Key != "cold" || top[1].Count != 2 {
+		t.Errorf("Top(2) = %+v", top)
+	}
+	if len(snapshot.Top(0)) != 3 || snapshot.Updated.IsZero() {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+
+	if missing, err := LoadAccessSnapshot(filepath.Join(t.TempDir(), "none.json")); err != nil || len(missing.Keys) != 0 {
+		t.Errorf("missing snapshot = %+v, %v", missing, err)
+	}
+}
@@ -3,34 +3,43 @@ package cache
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 )
 
 // L1Cache provides ultra-fast in-memory caching
 type L1Cache struct {
-	mu           sync.RWMutex
-	data         map[string]*CacheEntry
-	maxSize      int
-	currentSize  int
-	stats        *CacheStats
+	mu             sync.RWMutex
+	data           map[string]*CacheEntry
+	maxSize        int
+	currentSize    int
+	stats          *CacheStats
 	evictionPolicy EvictionPolicy
-	ttl          time.Duration
-	cleanupTicker *time.Ticker
-	stopCleanup  chan bool
+	ttl            time.Duration
+	stopCleanup    chan bool
+	stopOnce       sync.Once
+	// onEvict receives entries pushed out to make room, outside the lock
+	onEvict func(*CacheEntry)
 }
 
 // CacheEntry represents a cached item
 type CacheEntry struct {
-	Key       string
-	Value     interface{}
-	Created   time.Time
-	Accessed  time.Time
-	Hits      int64
-	Size      int
+	Key      string
+	Value    interface{}
+	Created  time.Time
+	Accessed time.Time
+	Hits     int64
+	Size     int
+	// ExpiresAt is zero for entries that never expire
 	ExpiresAt time.Time
 }
 
+// expired reports whether the entry has expired at now
+func (e *CacheEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
 // CacheStats tracks cache performance
 type CacheStats struct {
 	Hits        int64
@@ -42,6 +51,9 @@ type CacheStats struct {
 	MaxSize     int
 	HitRate     float64
 	MemoryUsage uint64
+	// Entries is the number of entries held; -1 when a backend cannot
+	// count them
+	Entries int
 }
 
 // EvictionPolicy defines how items are evicted from cache
@@ -54,7 +66,8 @@ const (
 	RAND EvictionPolicy = "rand" // Random
 )
 
-// NewL1Cache creates a new L1 cache instance
+// NewL1Cache creates a new L1 cache instance. maxSize bounds the bytes of
+// JSON held; a ttl of 0 keeps entries until they are evicted.
 func NewL1Cache(maxSize int, policy EvictionPolicy, ttl time.Duration) *L1Cache {
 	cache := &L1Cache{
 		data:           make(map[string]*CacheEntry),
@@ -64,95 +77,144 @@ func NewL1Cache(maxSize int, policy EvictionPolicy, ttl time.Duration) *L1Cache
 		stats:          &CacheStats{MaxSize: maxSize},
 		stopCleanup:    make(chan bool),
 	}
-	
+
 	// Start cleanup goroutine
 	go cache.startCleanup()
-	
+
 	return cache
 }
 
-// Set stores a value in the cache
-func (c *L1Cache) Set(key string, value interface{}) error {
+// OnEvict registers fn to receive every entry evicted to make room, so a
+// lower level can keep it. Expired entries are dropped without a call.
+func (c *L1Cache) OnEvict(fn func(*CacheEntry)) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	
+	c.onEvict = fn
+}
+
+// Set stores a value in the cache with the cache's default TTL
+func (c *L1Cache) Set(key string, value interface{}) error {
+	return c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL stores a value that expires after ttl; 0 never expires
+func (c *L1Cache) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
 	// Serialize value to calculate size
 	data, err := json.Marshal(value)
 	if err != nil {
 		return fmt.Errorf("failed to serialize value: %v", err)
 	}
-	
 	size := len(data)
-	
+
+	c.mu.Lock()
+	if c.maxSize > 0 && size > c.maxSize {
+		c.mu.Unlock()
+		return fmt.Errorf("value of %d bytes exceeds the L1 cache size", size)
+	}
+	if old, ok := c.data[key]; ok {
+		delete(c.data, key)
+		c.currentSize -= old.Size
+	}
+
 	// Check if we need to evict items
-	if c.currentSize+size > c.maxSize {
-		c.evict(size)
+	var evicted []*CacheEntry
+	if c.maxSize > 0 && c.currentSize+size > c.maxSize {
+		evicted = c.evict(c.currentSize + size - c.maxSize)
 	}
-	
-	// Create cache entry
+
+	now := time.Now()
 	entry := &CacheEntry{
-		Key:       key,
-		Value:     value,
-		Created:   time.Now(),
-		Accessed:  time.Now(),
-		Hits:      0,
-		Size:      size,
-		ExpiresAt: time.Now().Add(c.ttl),
+		Key:      key,
+		Value:    value,
+		Created:  now,
+		Accessed: now,
+		Size:     size,
+	}
+	if ttl > 0 {
+		entry.ExpiresAt = now.Add(ttl)
 	}
-	
-	// Store in cache
 	c.data[key] = entry
 	c.currentSize += size
 	c.stats.Sets++
 	c.stats.Size = c.currentSize
-	
+	onEvict := c.onEvict
+	c.mu.Unlock()
+
+	c.notify(onEvict, evicted)
 	return nil
 }
 
+// notify passes evicted entries to onEvict
+func (c *L1Cache) notify(onEvict func(*CacheEntry), evicted []*CacheEntry) {
+	if onEvict == nil {
+		return
+	}
+	for _, entry := range evicted {
+		onEvict(entry)
+	}
+}
+
 // Get retrieves a value from the cache
 func (c *L1Cache) Get(key string) (interface{}, bool) {
+	entry, ok := c.GetEntry(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+// GetEntry retrieves a copy of the entry at key, with its expiry
+func (c *L1Cache) GetEntry(key string) (CacheEntry, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	
+	c.stats.Gets++
+
 	entry, exists := c.data[key]
-	if !exists {
-		c.stats.Misses++
-		return nil, false
-	}
-	
-	// Check if entry has expired
-	if time.Now().After(entry.ExpiresAt) {
+	now := time.Now()
+	if exists && entry.expired(now) {
 		delete(c.data, key)
 		c.currentSize -= entry.Size
+		c.stats.Size = c.currentSize
+		exists = false
+	}
+	if !exists {
 		c.stats.Misses++
-		return nil, false
+		c.updateHitRate()
+		return CacheEntry{}, false
 	}
-	
+
 	// Update access statistics
-	entry.Accessed = time.Now()
+	entry.Accessed = now
 	entry.Hits++
 	c.stats.Hits++
-	
-	// Update hit rate
 	c.updateHitRate()
-	
-	return entry.Value, true
+
+	return *entry, true
+}
+
+// Contains reports whether key holds an unexpired entry, without counting
+// a lookup
+func (c *L1Cache) Contains(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.data[key]
+	return ok && !entry.expired(time.Now())
 }
 
 // Delete removes an item from the cache
 func (c *L1Cache) Delete(key string) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	
+
 	entry, exists := c.data[key]
 	if !exists {
 		return false
 	}
-	
+
 	delete(c.data, key)
 	c.currentSize -= entry.Size
 	c.stats.Size = c.currentSize
-	
+
 	return true
 }
 
@@ -160,7 +222,7 @@ func (c *L1Cache) Delete(key string) bool {
 func (c *L1Cache) Clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	
+
 	c.data = make(map[string]*CacheEntry)
 	c.currentSize = 0
 	c.stats.Size = 0
@@ -170,8 +232,10 @@ func (c *L1Cache) Clear() {
 func (c *L1Cache) GetStats() *CacheStats {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	
+
 	stats := *c.stats
+	stats.Entries = len(c.data)
+	stats.MemoryUsage = c.memoryUsage()
 	return &stats
 }
 
@@ -179,167 +243,119 @@ func (c *L1Cache) GetStats() *CacheStats {
 func (c *L1Cache) GetKeys() []string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	
+
 	keys := make([]string, 0, len(c.data))
 	for key := range c.data {
 		keys = append(keys, key)
 	}
-	
+
 	return keys
 }
 
+// Entries returns a copy of every unexpired entry
+func (c *L1Cache) Entries() []CacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	entries := make([]CacheEntry, 0, len(c.data))
+	for _, entry := range c.data {
+		if !entry.expired(now) {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries
+}
+
 // GetSize returns the current cache size
 func (c *L1Cache) GetSize() int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	
+
 	return c.currentSize
 }
 
 // GetMaxSize returns the maximum cache size
 func (c *L1Cache) GetMaxSize() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	return c.maxSize
 }
 
 // SetMaxSize updates the maximum cache size
 func (c *L1Cache) SetMaxSize(maxSize int) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	
 	c.maxSize = maxSize
 	c.stats.MaxSize = maxSize
-	
+
 	// Evict items if necessary
-	if c.currentSize > maxSize {
-		c.evict(c.currentSize - maxSize)
+	var evicted []*CacheEntry
+	if maxSize > 0 && c.currentSize > maxSize {
+		evicted = c.evict(c.currentSize - maxSize)
 	}
-}
+	onEvict := c.onEvict
+	c.mu.Unlock()
 
-// evict removes items from cache based on eviction policy
-func (c *L1Cache) evict(neededSpace int) {
-	switch c.evictionPolicy {
-	case LRU:
-		c.evictLRU(neededSpace)
-	case LFU:
-		c.evictLFU(neededSpace)
-	case TTL:
-		c.evictTTL(neededSpace)
-	case RAND:
-		c.evictRandom(neededSpace)
-	default:
-		c.evictLRU(neededSpace)
-	}
+	c.notify(onEvict, evicted)
 }
 
-// evictLRU removes least recently used items
-func (c *L1Cache) evictLRU(neededSpace int) {
-	// Create sorted list by access time
-	type entryWithTime struct {
-		key   string
-		entry *CacheEntry
-	}
-	
-	var entries []entryWithTime
-	for key, entry := range c.data {
-		entries = append(entries, entryWithTime{key, entry})
-	}
-	
-	// Sort by access time (oldest first)
-	for i := 0; i < len(entries)-1; i++ {
-		for j := i + 1; j < len(entries); j++ {
-			if entries[i].entry.Accessed.After(entries[j].entry.Accessed) {
-				entries[i], entries[j] = entries[j], entries[i]
-			}
-		}
-	}
-	
-	// Evict oldest entries
-	freedSpace := 0
-	for _, item := range entries {
-		if freedSpace >= neededSpace {
-			break
-		}
-		
-		delete(c.data, item.key)
-		freedSpace += item.entry.Size
-		c.stats.Evictions++
-	}
-	
-	c.currentSize -= freedSpace
-	c.stats.Size = c.currentSize
-}
-
-// evictLFU removes least frequently used items
-func (c *L1Cache) evictLFU(neededSpace int) {
-	// Create sorted list by hit count
-	type entryWithHits struct {
-		key   string
-		entry *CacheEntry
-	}
-	
-	var entries []entryWithHits
-	for key, entry := range c.data {
-		entries = append(entries, entryWithHits{key, entry})
-	}
-	
-	// Sort by hit count (lowest first)
-	for i := 0; i < len(entries)-1; i++ {
-		for j := i + 1; j < len(entries); j++ {
-			if entries[i].entry.Hits > entries[j].entry.Hits {
-				entries[i], entries[j] = entries[j], entries[i]
-			}
-		}
-	}
-	
-	// Evict least frequently used entries
-	freedSpace := 0
-	for _, item := range entries {
-		if freedSpace >= neededSpace {
-			break
-		}
-		
-		delete(c.data, item.key)
-		freedSpace += item.entry.Size
-		c.stats.Evictions++
-	}
-	
-	c.currentSize -= freedSpace
-	c.stats.Size = c.currentSize
-}
-
-// evictTTL removes expired items
-func (c *L1Cache) evictTTL(neededSpace int) {
+// evict frees at least neededSpace bytes, choosing victims by eviction
+// policy. Expired entries always go first and are not returned; the rest
+// are returned for onEvict.
+func (c *L1Cache) evict(neededSpace int) []*CacheEntry {
 	now := time.Now()
-	freedSpace := 0
-	
+	freed := 0
+	entries := make([]*CacheEntry, 0, len(c.data))
 	for key, entry := range c.data {
-		if now.After(entry.ExpiresAt) {
+		if entry.expired(now) {
 			delete(c.data, key)
-			freedSpace += entry.Size
+			freed += entry.Size
 			c.stats.Evictions++
+			continue
 		}
+		entries = append(entries, entry)
 	}
-	
-	c.currentSize -= freedSpace
-	c.stats.Size = c.currentSize
-}
 
-// evictRandom removes random items
-func (c *L1Cache) evictRandom(neededSpace int) {
-	// Simple random eviction - in practice, you'd use a proper random generator
-	freedSpace := 0
-	for key, entry := range c.data {
-		if freedSpace >= neededSpace {
+	switch c.evictionPolicy {
+	case LFU:
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Hits != entries[j].Hits {
+				return entries[i].Hits < entries[j].Hits
+			}
+			return entries[i].Accessed.Before(entries[j].Accessed)
+		})
+	case TTL:
+		// Soonest to expire first; entries without a TTL last
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i].ExpiresAt, entries[j].ExpiresAt
+			if a.IsZero() || b.IsZero() {
+				return !a.IsZero()
+			}
+			return a.Before(b)
+		})
+	case RAND:
+		// Map iteration order is already random
+	default:
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Accessed.Before(entries[j].Accessed)
+		})
+	}
+
+	var evicted []*CacheEntry
+	for _, entry := range entries {
+		if freed >= neededSpace {
 			break
 		}
-		
-		delete(c.data, key)
-		freedSpace += entry.Size
+		delete(c.data, entry.Key)
+		freed += entry.Size
 		c.stats.Evictions++
+		evicted = append(evicted, entry)
 	}
-	
-	c.currentSize -= freedSpace
+
+	c.currentSize -= freed
 	c.stats.Size = c.currentSize
+	return evicted
 }
 
 // updateHitRate calculates the current hit rate
@@ -352,14 +368,14 @@ func (c *L1Cache) updateHitRate() {
 
 // startCleanup starts the cleanup goroutine
 func (c *L1Cache) startCleanup() {
-	c.cleanupTicker = time.NewTicker(time.Minute)
-	
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-c.cleanupTicker.C:
+		case <-ticker.C:
 			c.cleanup()
 		case <-c.stopCleanup:
-			c.cleanupTicker.Stop()
 			return
 		}
 	}
@@ -369,25 +385,25 @@ func (c *L1Cache) startCleanup() {
 func (c *L1Cache) cleanup() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	
+
 	now := time.Now()
 	freedSpace := 0
-	
+
 	for key, entry := range c.data {
-		if now.After(entry.ExpiresAt) {
+		if entry.expired(now) {
 			delete(c.data, key)
 			freedSpace += entry.Size
 			c.stats.Evictions++
 		}
 	}
-	
+
 	c.currentSize -= freedSpace
 	c.stats.Size = c.currentSize
 }
 
 // Stop stops the cache and cleanup goroutine
 func (c *L1Cache) Stop() {
-	close(c.stopCleanup)
+	c.stopOnce.Do(func() { close(c.stopCleanup) })
 }
 
 // WarmUp preloads the cache with frequently accessed data
@@ -401,12 +417,12 @@ func (c *L1Cache) WarmUp(data map[string]interface{}) {
 func (c *L1Cache) GetMemoryUsage() uint64 {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	
-	// Estimate memory usage (simplified)
-	usage := uint64(c.currentSize)
-	
-	// Add overhead for map structure
-	usage += uint64(len(c.data) * 64) // Approximate overhead per entry
-	
-	return usage
-} 
\ No newline at end of file
+
+	return c.memoryUsage()
+}
+
+// memoryUsage estimates the bytes held: the JSON size of each value plus
+// map overhead
+func (c *L1Cache) memoryUsage() uint64 {
+	return uint64(c.currentSize) + uint64(len(c.data)*64)
+}
@@ -0,0 +1,378 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// L2Cache keeps entries on disk so they outlive the process. Each entry is
+// one file under dir, named by the hash of its key and spread over 256
+// subdirectories: a JSON header line holding the key and expiry, then the
+// value as JSON. Writes go to a temporary file renamed into place, so a
+// crash leaves either the old entry or the new one. An index of keys, sizes
+// and access times is kept in memory and rebuilt from the headers on open;
+// maxSize bounds the bytes on disk, evicting least recently used entries.
+type L2Cache struct {
+	mu      sync.Mutex
+	dir     string
+	maxSize int64
+	ttl     time.Duration
+	index   map[string]*l2Entry
+	size    int64
+	stats   *CacheStats
+}
+
+// l2Entry indexes one file
+type l2Entry struct {
+	key       string
+	file      string
+	size      int64
+	accessed  time.Time
+	expiresAt time.Time
+	hits      int64
+}
+
+// l2Header is the first line of an entry file
+type l2Header struct {
+	Key string `json:"key"`
+	// Expires is a Unix time in nanoseconds; 0 never expires
+	Expires int64 `json:"expires,omitempty"`
+}
+
+// NewL2Cache opens the disk cache in dir, creating it if needed, and
+// indexes the entries already there. Expired, unreadable and half-written
+// files are removed. A maxSize of 0 leaves the cache unbounded; a ttl of 0
+// keeps entries until they are evicted.
+func NewL2Cache(dir string, maxSize int, ttl time.Duration) (*L2Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create L2 cache directory: %w", err)
+	}
+	c := &L2Cache{
+		dir:     dir,
+		maxSize: int64(maxSize),
+		ttl:     ttl,
+		index:   make(map[string]*l2Entry),
+		stats:   &CacheStats{MaxSize: maxSize},
+	}
+	now := time.Now()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			os.Remove(path)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := readL2Header(path)
+		if err != nil || (header.Expires != 0 && now.UnixNano() > header.Expires) || c.file(header.Key) != path {
+			os.Remove(path)
+			return nil
+		}
+		entry := &l2Entry{key: header.Key, file: path, size: info.Size(), accessed: info.ModTime()}
+		if header.Expires != 0 {
+			entry.expiresAt = time.Unix(0, header.Expires)
+		}
+		c.index[entry.key] = entry
+		c.size += entry.size
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index L2 cache: %w", err)
+	}
+	c.stats.Size = int(c.size)
+	if c.maxSize > 0 && c.size > c.maxSize {
+		c.evict(c.size - c.maxSize)
+	}
+	return c, nil
+}
+
+// readL2Header reads the header line of an entry file
+func readL2Header(path string) (l2Header, error) {
+	var header l2Header
+	f, err := os.Open(path)
+	if err != nil {
+		return header, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return header, err
+	}
+	if err := json.Unmarshal(line, &header); err != nil {
+		return header, err
+	}
+	if header.Key == "" {
+		return header, errors.New("entry has no key")
+	}
+	return header, nil
+}
+
+// file returns the path of the entry for key
+func (c *L2Cache) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// Set stores a value that expires after ttl; 0 uses the cache's default
+func (c *L2Cache) Set(key string, value interface{}, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	return c.SetUntil(key, value, expiresAt)
+}
+
+// SetUntil stores a value that expires at expiresAt; the zero time never
+// expires. Demoted entries keep the expiry they had in L1 this way.
+func (c *L2Cache) SetUntil(key string, value interface{}, expiresAt time.Time) error {
+	header := l2Header{Key: key}
+	if !expiresAt.IsZero() {
+		header.Expires = expiresAt.UnixNano()
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	if err := enc.Encode(value); err != nil {
+		return fmt.Errorf("failed to serialize value: %v", err)
+	}
+	size := int64(buf.Len())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxSize > 0 && size > c.maxSize {
+		return fmt.Errorf("value of %d bytes exceeds the L2 cache size", size)
+	}
+
+	path := c.file(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if old, ok := c.index[key]; ok {
+		c.size -= old.size
+	}
+	c.index[key] = &l2Entry{key: key, file: path, size: size, accessed: time.Now(), expiresAt: expiresAt}
+	c.size += size
+	c.stats.Sets++
+	if c.maxSize > 0 && c.size > c.maxSize {
+		c.evict(c.size - c.maxSize)
+	}
+	c.stats.Size = int(c.size)
+	return nil
+}
+
+// Get retrieves a value from the cache
+func (c *L2Cache) Get(key string) (interface{}, bool) {
+	value, _, _, ok := c.get(key)
+	return value, ok
+}
+
+// get retrieves a value with the number of hits on it and its expiry. The
+// file's modification time records the access, so LRU order survives a
+// restart.
+func (c *L2Cache) get(key string) (value interface{}, hits int64, expiresAt time.Time, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Gets++
+	defer c.updateHitRate()
+
+	entry, ok := c.index[key]
+	now := time.Now()
+	if ok && !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+		c.remove(entry)
+		ok = false
+	}
+	if ok {
+		var err error
+		if value, err = readL2Value(entry.file); err != nil {
+			// Removed or corrupted behind our back: forget it
+			c.remove(entry)
+			ok = false
+		}
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, 0, time.Time{}, false
+	}
+
+	entry.accessed = now
+	entry.hits++
+	os.Chtimes(entry.file, now, now)
+	c.stats.Hits++
+	return value, entry.hits, entry.expiresAt, true
+}
+
+// Contains reports whether key holds an unexpired entry, without counting
+// a lookup
+func (c *L2Cache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.index[key]
+	return ok && (entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt))
+}
+
+// readL2Value decodes the value following the header line of an entry file
+func readL2Value(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return nil, errors.New("entry has no value")
+	}
+	var value interface{}
+	if err := json.Unmarshal(data[i+1:], &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// remove deletes an entry's file and index record
+func (c *L2Cache) remove(entry *l2Entry) {
+	os.Remove(entry.file)
+	delete(c.index, entry.key)
+	c.size -= entry.size
+	c.stats.Size = int(c.size)
+}
+
+// evict frees at least neededSpace bytes: expired entries first, then the
+// least recently used
+func (c *L2Cache) evict(neededSpace int64) {
+	now := time.Now()
+	var freed int64
+	entries := make([]*l2Entry, 0, len(c.index))
+	for _, entry := range c.index {
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			freed += entry.size
+			c.remove(entry)
+			c.stats.Evictions++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].accessed.Before(entries[j].accessed)
+	})
+	for _, entry := range entries {
+		if freed >= neededSpace {
+			break
+		}
+		freed += entry.size
+		c.remove(entry)
+		c.stats.Evictions++
+	}
+}
+
+// Delete removes a value
+func (c *L2Cache) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.index[key]
+	if ok {
+		c.remove(entry)
+	}
+	return ok
+}
+
+// Clear removes every entry from disk
+func (c *L2Cache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(c.dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	c.index = make(map[string]*l2Entry)
+	c.size = 0
+	c.stats.Size = 0
+	return nil
+}
+
+// Len returns the number of entries
+func (c *L2Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.index)
+}
+
+// updateHitRate calculates the current hit rate
+func (c *L2Cache) updateHitRate() {
+	if total := c.stats.Hits + c.stats.Misses; total > 0 {
+		c.stats.HitRate = float64(c.stats.Hits) / float64(total)
+	}
+}
+
+// GetStats returns cache statistics; Size is the bytes on disk
+func (c *L2Cache) GetStats() *CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := *c.stats
+	stats.Entries = len(c.index)
+	stats.MemoryUsage = c.memoryUsage()
+	return &stats
+}
+
+// GetMemoryUsage returns the bytes the index holds in memory; entries
+// themselves are on disk
+func (c *L2Cache) GetMemoryUsage() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.memoryUsage()
+}
+
+func (c *L2Cache) memoryUsage() uint64 {
+	return uint64(len(c.index) * 160)
+}
+
+// Dir returns the directory the cache keeps its files in
+func (c *L2Cache) Dir() string {
+	return c.dir
+}
+
+// Stop releases the cache; entries stay on disk for the next open
+func (c *L2Cache) Stop() {}
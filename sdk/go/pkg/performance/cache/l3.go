@@ -0,0 +1,278 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/memcachewire"
+	"github.com/cyber-boost/tusktsk/pkg/rediswire"
+)
+
+// L3Backend stores L3 entries outside the process, shared between
+// instances. rediswire.Cache and memcachewire.Cache implement it.
+type L3Backend interface {
+	Get(key string) (interface{}, bool, error)
+	Set(key string, value interface{}, ttl time.Duration) error
+	Delete(key string) error
+	Clear() error
+}
+
+// L3Cache is the largest and slowest cache level. Without a backend it
+// keeps entries in memory, bounded by maxSize bytes of JSON.
+type L3Cache struct {
+	mu      sync.RWMutex
+	backend L3Backend
+	data    map[string]*CacheEntry
+	maxSize int
+	size    int
+	ttl     time.Duration
+	stats   *CacheStats
+}
+
+// NewL3Cache creates a new L3 cache instance
+func NewL3Cache(maxSize int, ttl time.Duration) *L3Cache {
+	return &L3Cache{
+		data:    make(map[string]*CacheEntry),
+		maxSize: maxSize,
+		ttl:     ttl,
+		stats:   &CacheStats{MaxSize: maxSize},
+	}
+}
+
+// NewRedisL3Backend stores L3 entries in Redis under prefix
+func NewRedisL3Backend(client *rediswire.Client, prefix string) L3Backend {
+	return rediswire.NewCache(client, prefix)
+}
+
+// NewMemcachedL3Backend stores L3 entries in memcached under prefix
+func NewMemcachedL3Backend(client *memcachewire.Client, prefix string) L3Backend {
+	return memcachewire.NewCache(client, prefix)
+}
+
+// L3BackendFromConfig builds a backend from flattened peanut configuration.
+// cache.backend picks it, or cache.l3 when the backend is "tiered": "redis"
+// reads cache.redis (url or host, port, password, db, tls and pool.*),
+// "memcached" reads cache.memcached (servers, or host and port). It returns
+// nil when neither is selected.
+func L3BackendFromConfig(values map[string]interface{}) (L3Backend, error) {
+	kind := values["cache.backend"]
+	if kind == "tiered" {
+		kind = values["cache.l3"]
+	}
+	switch kind {
+	case "redis":
+		url, ok, err := rediswire.ConfigURL(values, "cache.redis")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("the L3 cache is redis but cache.redis is not configured")
+		}
+		return rediswire.SharedCache(url, "tsk:l3:"), nil
+	case "memcached":
+		servers, ok := memcachewire.ConfigServers(values, "cache.memcached")
+		if !ok {
+			return nil, fmt.Errorf("the L3 cache is memcached but cache.memcached is not configured")
+		}
+		return memcachewire.SharedCache(servers, "tsk:l3:")
+	}
+	return nil, nil
+}
+
+// BackendName returns "redis" or "memcached" for the built-in backends,
+// "memory" without one and "custom" for any other
+func (c *L3Cache) BackendName() string {
+	switch c.getBackend().(type) {
+	case nil:
+		return "memory"
+	case *rediswire.Cache:
+		return "redis"
+	case *memcachewire.Cache:
+		return "memcached"
+	}
+	return "custom"
+}
+
+// SetBackend moves the cache to backend, dropping in-memory entries
+func (c *L3Cache) SetBackend(backend L3Backend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backend = backend
+	c.data = make(map[string]*CacheEntry)
+	c.size = 0
+}
+
+// Set stores a value; a ttl of 0 uses the cache's default
+func (c *L3Cache) Set(key string, value interface{}, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	if backend := c.getBackend(); backend != nil {
+		c.mu.Lock()
+		c.stats.Sets++
+		c.mu.Unlock()
+		return backend.Set(key, value, ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Sets++
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to serialize value: %v", err)
+	}
+	if c.maxSize > 0 && len(data) > c.maxSize {
+		return fmt.Errorf("value of %d bytes exceeds the L3 cache size", len(data))
+	}
+	if old, ok := c.data[key]; ok {
+		c.size -= old.Size
+	}
+	for c.maxSize > 0 && c.size+len(data) > c.maxSize {
+		c.evictOldest()
+	}
+
+	now := time.Now()
+	entry := &CacheEntry{Key: key, Value: value, Created: now, Accessed: now, Size: len(data)}
+	if ttl > 0 {
+		entry.ExpiresAt = now.Add(ttl)
+	}
+	c.data[key] = entry
+	c.size += entry.Size
+	c.stats.Size = c.size
+	return nil
+}
+
+// evictOldest drops the least recently accessed entry
+func (c *L3Cache) evictOldest() {
+	var oldest *CacheEntry
+	for _, entry := range c.data {
+		if oldest == nil || entry.Accessed.Before(oldest.Accessed) {
+			oldest = entry
+		}
+	}
+	if oldest == nil {
+		return
+	}
+	delete(c.data, oldest.Key)
+	c.size -= oldest.Size
+	c.stats.Evictions++
+}
+
+// Get retrieves a value. Backend errors count as misses, so an unreachable
+// server only costs hit rate.
+func (c *L3Cache) Get(key string) (interface{}, bool) {
+	var value interface{}
+	found := false
+	backend := c.getBackend()
+	if backend != nil {
+		// Network round trips run outside the lock
+		v, ok, err := backend.Get(key)
+		value, found = v, ok && err == nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Gets++
+	if entry, ok := c.data[key]; backend == nil && ok {
+		if !entry.ExpiresAt.IsZero() && time.Now().After(entry.ExpiresAt) {
+			delete(c.data, key)
+			c.size -= entry.Size
+		} else {
+			entry.Accessed = time.Now()
+			entry.Hits++
+			value, found = entry.Value, true
+		}
+	}
+
+	if found {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	if c.stats.Gets > 0 {
+		c.stats.HitRate = float64(c.stats.Hits) / float64(c.stats.Gets)
+	}
+	return value, found
+}
+
+// Contains reports whether key holds an entry, without counting a lookup
+func (c *L3Cache) Contains(key string) (bool, error) {
+	if backend := c.getBackend(); backend != nil {
+		_, ok, err := backend.Get(key)
+		return ok, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.data[key]
+	return ok && (entry.ExpiresAt.IsZero() || time.Now().Before(entry.ExpiresAt)), nil
+}
+
+// getBackend reads the backend under the lock
+func (c *L3Cache) getBackend() L3Backend {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.backend
+}
+
+// Delete removes a value
+func (c *L3Cache) Delete(key string) bool {
+	if backend := c.getBackend(); backend != nil {
+		return backend.Delete(key) == nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.data[key]
+	if ok {
+		delete(c.data, key)
+		c.size -= entry.Size
+	}
+	return ok
+}
+
+// Clear removes every entry
+func (c *L3Cache) Clear() {
+	if backend := c.getBackend(); backend != nil {
+		backend.Clear()
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data = make(map[string]*CacheEntry)
+	c.size = 0
+}
+
+// GetStats returns cache statistics. Entries is -1 when the backend
+// cannot count its keys.
+func (c *L3Cache) GetStats() *CacheStats {
+	c.mu.RLock()
+	stats := *c.stats
+	stats.Size = c.size
+	stats.MemoryUsage = uint64(c.size)
+	stats.Entries = len(c.data)
+	backend := c.backend
+	c.mu.RUnlock()
+
+	if backend != nil {
+		stats.Entries = -1
+		if counter, ok := backend.(interface{ Len() (int, error) }); ok {
+			if n, err := counter.Len(); err == nil {
+				stats.Entries = n
+			}
+		}
+	}
+	return &stats
+}
+
+// GetMemoryUsage returns the bytes held in process; a backend holds its
+// entries elsewhere
+func (c *L3Cache) GetMemoryUsage() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return uint64(c.size)
+}
+
+// Stop releases the cache; pooled backend connections stay shared
+func (c *L3Cache) Stop() {}
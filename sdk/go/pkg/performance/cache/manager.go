@@ -2,23 +2,33 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 )
 
-// CacheManager coordinates multi-level caching system
+// CacheManager coordinates multi-level caching system. L1 is in process,
+// L2 on local disk and L3 shared, in Redis or memcached. Writes go through
+// to L1 and L3; L2 is a victim cache fed by entries L1 evicts and by L3
+// hits, so a restart or a cold L1 does not go back to the network.
 type CacheManager struct {
-	mu           sync.RWMutex
-	l1Cache      *L1Cache
-	l2Cache      *L2Cache
-	l3Cache      *L3Cache
-	stats        *ManagerStats
-	config       *ManagerConfig
-	ctx          context.Context
-	cancel       context.CancelFunc
-	warmupQueue  chan WarmupRequest
+	// mu guards stats and accesses
+	mu            sync.Mutex
+	l1Cache       *L1Cache
+	l2Cache       *L2Cache
+	l3Cache       *L3Cache
+	stats         ManagerStats
+	accesses      map[string]*KeyAccess
+	config        *ManagerConfig
+	ctx           context.Context
+	cancel        context.CancelFunc
+	warmupQueue   chan WarmupRequest
 	evictionQueue chan EvictionRequest
+	demoteQueue   chan CacheEntry
+	workers       sync.WaitGroup
+	stopOnce      sync.Once
 }
 
 // ManagerStats tracks overall cache manager performance
@@ -30,29 +40,49 @@ type ManagerStats struct {
 	CacheMisses      int64
 	WarmupRequests   int64
 	EvictionRequests int64
-	HitRate          float64
-	AverageLatency   time.Duration
+	// Promotions counts entries copied up into L1
+	Promotions int64
+	// Demotions counts entries L1 evicted into L2
+	Demotions      int64
+	HitRate        float64
+	AverageLatency time.Duration
 }
 
-// ManagerConfig defines cache manager configuration
+// ManagerConfig defines cache manager configuration. Sizes are bytes of
+// JSON; TTLs of 0 keep entries until they are evicted.
 type ManagerConfig struct {
-	L1Size          int
-	L2Size          int
-	L3Size          int
-	L1TTL           time.Duration
-	L2TTL           time.Duration
-	L3TTL           time.Duration
-	WarmupWorkers   int
-	EvictionWorkers int
+	L1Size int
+	L2Size int
+	L3Size int
+	L1TTL  time.Duration
+	L2TTL  time.Duration
+	L3TTL  time.Duration
+	// L2Dir is the directory of the disk cache; empty runs without L2
+	L2Dir string
+	// PromoteHits is the number of L2 hits that copies an entry into L1;
+	// 0 or 1 promotes on the first hit, L3 hits included
+	PromoteHits int
+	// L2WriteThrough makes Set write L2 too, so entries survive a restart
+	// without waiting for L1 to evict them. Short-lived processes, such as
+	// a CLI run, want it.
+	L2WriteThrough bool
+	// AccessLog is a file the lookups of each key are counted in across
+	// runs, see AccessSnapshot; empty counts nothing. It must be outside
+	// L2Dir.
+	AccessLog        string
+	WarmupWorkers    int
+	EvictionWorkers  int
 	PredictiveWarmup bool
-	AutoScaling     bool
+	AutoScaling      bool
+	// L3Backend moves L3 out of process, e.g. to Redis; nil keeps it in memory
+	L3Backend L3Backend
 }
 
 // WarmupRequest represents a cache warming request
 type WarmupRequest struct {
-	Key   string
-	Value interface{}
-	TTL   time.Duration
+	Key      string
+	Value    interface{}
+	TTL      time.Duration
 	Priority int
 }
 
@@ -64,77 +94,173 @@ type EvictionRequest struct {
 	Priority int
 }
 
-// NewCacheManager creates a new cache manager instance
+// LevelStats describes one cache level
+type LevelStats struct {
+	// Name is "l1", "l2" or "l3"
+	Name string
+	// Backend is "memory", "disk", "redis", "memcached" or "custom"
+	Backend string
+	CacheStats
+}
+
+// NewCacheManager creates a new cache manager instance. When the L2
+// directory cannot be opened the manager runs without L2.
 func NewCacheManager(config *ManagerConfig) *CacheManager {
+	manager, err := OpenCacheManager(config)
+	if err != nil {
+		withoutL2 := *config
+		withoutL2.L2Dir = ""
+		manager, _ = OpenCacheManager(&withoutL2)
+	}
+	return manager
+}
+
+// OpenCacheManager creates a cache manager, opening the L2 directory
+func OpenCacheManager(config *ManagerConfig) (*CacheManager, error) {
+	var l2 *L2Cache
+	if config.L2Dir != "" {
+		var err error
+		if l2, err = NewL2Cache(config.L2Dir, config.L2Size, config.L2TTL); err != nil {
+			return nil, err
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
-	
 	manager := &CacheManager{
 		l1Cache:       NewL1Cache(config.L1Size, LRU, config.L1TTL),
-		l2Cache:       NewL2Cache(config.L2Size, config.L2TTL),
+		l2Cache:       l2,
 		l3Cache:       NewL3Cache(config.L3Size, config.L3TTL),
-		stats:         &ManagerStats{},
 		config:        config,
 		ctx:           ctx,
 		cancel:        cancel,
 		warmupQueue:   make(chan WarmupRequest, 1000),
 		evictionQueue: make(chan EvictionRequest, 1000),
+		demoteQueue:   make(chan CacheEntry, 1000),
+		accesses:      make(map[string]*KeyAccess),
+	}
+
+	if config.L3Backend != nil {
+		manager.l3Cache.SetBackend(config.L3Backend)
 	}
-	
+	if l2 != nil {
+		// Disk writes happen on a worker, off the caller's path; a full
+		// queue drops the entry, which only costs a later miss
+		manager.l1Cache.OnEvict(func(entry *CacheEntry) {
+			select {
+			case manager.demoteQueue <- *entry:
+			default:
+			}
+		})
+	}
+
 	// Start worker goroutines
 	manager.startWorkers()
-	
-	return manager
+
+	return manager, nil
 }
 
 // Get retrieves a value from the cache hierarchy
 func (cm *CacheManager) Get(key string) (interface{}, bool) {
 	start := time.Now()
-	cm.stats.TotalRequests++
-	
+	cm.recordAccess(key, start)
+
 	// Try L1 cache first (fastest)
 	if value, found := cm.l1Cache.Get(key); found {
-		cm.stats.L1Hits++
-		cm.updateStats(time.Since(start))
+		cm.record(start, func(s *ManagerStats) { s.L1Hits++ })
 		return value, true
 	}
-	
-	// Try L2 cache (medium speed)
-	if value, found := cm.l2Cache.Get(key); found {
-		cm.stats.L2Hits++
-		// Promote to L1 cache
-		go cm.promoteToL1(key, value)
-		cm.updateStats(time.Since(start))
-		return value, true
+
+	// Try L2 cache (local disk)
+	if cm.l2Cache != nil {
+		if value, hits, expiresAt, found := cm.l2Cache.get(key); found {
+			promoted := hits >= int64(cm.config.PromoteHits)
+			if promoted {
+				cm.l1Cache.SetWithTTL(key, value, cm.l1TTL(expiresAt))
+			}
+			cm.record(start, func(s *ManagerStats) {
+				s.L2Hits++
+				if promoted {
+					s.Promotions++
+				}
+			})
+			return value, true
+		}
 	}
-	
+
 	// Try L3 cache (slowest)
 	if value, found := cm.l3Cache.Get(key); found {
-		cm.stats.L3Hits++
-		// Promote to L2 cache
-		go cm.promoteToL2(key, value)
-		cm.updateStats(time.Since(start))
+		// L2 keeps a local copy so the next lookup skips the network
+		if cm.l2Cache != nil {
+			cm.l2Cache.Set(key, value, cm.config.L2TTL)
+		}
+		promoted := cm.config.PromoteHits <= 1
+		if promoted {
+			cm.l1Cache.Set(key, value)
+		}
+		cm.record(start, func(s *ManagerStats) {
+			s.L3Hits++
+			if promoted {
+				s.Promotions++
+			}
+		})
 		return value, true
 	}
-	
+
 	// Cache miss
-	cm.stats.CacheMisses++
-	cm.updateStats(time.Since(start))
-	
+	cm.record(start, func(s *ManagerStats) { s.CacheMisses++ })
+
 	// Trigger predictive warmup if enabled
 	if cm.config.PredictiveWarmup {
 		go cm.predictiveWarmup(key)
 	}
-	
+
 	return nil, false
 }
 
-// Set stores a value in the cache hierarchy
+// Contains reports whether any level holds key, without counting a lookup
+// or moving the entry between levels
+func (cm *CacheManager) Contains(key string) (bool, error) {
+	if cm.l1Cache.Contains(key) || (cm.l2Cache != nil && cm.l2Cache.Contains(key)) {
+		return true, nil
+	}
+	return cm.l3Cache.Contains(key)
+}
+
+// l1TTL returns the L1 TTL of an entry promoted from L2, which must not
+// outlive its expiry there
+func (cm *CacheManager) l1TTL(expiresAt time.Time) time.Duration {
+	ttl := cm.config.L1TTL
+	if expiresAt.IsZero() {
+		return ttl
+	}
+	if remaining := time.Until(expiresAt); ttl == 0 || remaining < ttl {
+		// A zero TTL would never expire; keep at least a moment
+		if remaining <= 0 {
+			remaining = time.Millisecond
+		}
+		return remaining
+	}
+	return ttl
+}
+
+// Set stores a value in L1 and L3, dropping any older copy in L2 or, with
+// L2WriteThrough, replacing it. A ttl of 0 uses each level's default.
 func (cm *CacheManager) Set(key string, value interface{}, ttl time.Duration) error {
-	// Store in all cache levels
-	err1 := cm.l1Cache.Set(key, value)
-	err2 := cm.l2Cache.Set(key, value, ttl)
+	l1TTL := cm.config.L1TTL
+	if ttl > 0 && (l1TTL == 0 || ttl < l1TTL) {
+		l1TTL = ttl
+	}
+	err1 := cm.l1Cache.SetWithTTL(key, value, l1TTL)
+	var err2 error
+	if cm.l2Cache != nil {
+		if cm.config.L2WriteThrough {
+			err2 = cm.l2Cache.Set(key, value, ttl)
+		} else {
+			cm.l2Cache.Delete(key)
+		}
+	}
 	err3 := cm.l3Cache.Set(key, value, ttl)
-	
+
 	if err1 != nil {
 		return fmt.Errorf("L1 cache set failed: %v", err1)
 	}
@@ -144,28 +270,38 @@ func (cm *CacheManager) Set(key string, value interface{}, ttl time.Duration) er
 	if err3 != nil {
 		return fmt.Errorf("L3 cache set failed: %v", err3)
 	}
-	
+
 	return nil
 }
 
 // Delete removes a value from all cache levels
 func (cm *CacheManager) Delete(key string) {
 	cm.l1Cache.Delete(key)
-	cm.l2Cache.Delete(key)
+	if cm.l2Cache != nil {
+		cm.l2Cache.Delete(key)
+	}
 	cm.l3Cache.Delete(key)
 }
 
-// Clear clears all cache levels
-func (cm *CacheManager) Clear() {
+// Clear clears all cache levels and resets the counters
+func (cm *CacheManager) Clear() error {
 	cm.l1Cache.Clear()
-	cm.l2Cache.Clear()
 	cm.l3Cache.Clear()
+	cm.mu.Lock()
+	cm.stats = ManagerStats{}
+	cm.mu.Unlock()
+	if cm.l2Cache != nil {
+		return cm.l2Cache.Clear()
+	}
+	return nil
 }
 
 // WarmUp preloads the cache with frequently accessed data
 func (cm *CacheManager) WarmUp(data map[string]interface{}) {
+	cm.mu.Lock()
 	cm.stats.WarmupRequests++
-	
+	cm.mu.Unlock()
+
 	for key, value := range data {
 		request := WarmupRequest{
 			Key:      key,
@@ -173,7 +309,7 @@ func (cm *CacheManager) WarmUp(data map[string]interface{}) {
 			TTL:      cm.config.L1TTL,
 			Priority: 1,
 		}
-		
+
 		select {
 		case cm.warmupQueue <- request:
 		default:
@@ -186,7 +322,7 @@ func (cm *CacheManager) WarmUp(data map[string]interface{}) {
 func (cm *CacheManager) predictiveWarmup(key string) {
 	// Analyze access patterns to predict related keys
 	relatedKeys := cm.analyzeAccessPatterns(key)
-	
+
 	for _, relatedKey := range relatedKeys {
 		request := WarmupRequest{
 			Key:      relatedKey,
@@ -194,7 +330,7 @@ func (cm *CacheManager) predictiveWarmup(key string) {
 			TTL:      cm.config.L1TTL,
 			Priority: 2, // Lower priority than explicit warmup
 		}
-		
+
 		select {
 		case cm.warmupQueue <- request:
 		default:
@@ -207,51 +343,58 @@ func (cm *CacheManager) predictiveWarmup(key string) {
 func (cm *CacheManager) analyzeAccessPatterns(key string) []string {
 	// This is a simplified implementation
 	// In practice, you'd use machine learning or statistical analysis
-	
+
 	// Example: if key is "user:123", predict "user:123:profile", "user:123:settings"
 	var relatedKeys []string
-	
+
 	// Simple pattern matching
 	if len(key) > 5 && key[:5] == "user:" {
 		userID := key[5:]
-		relatedKeys = append(relatedKeys, 
+		relatedKeys = append(relatedKeys,
 			fmt.Sprintf("user:%s:profile", userID),
 			fmt.Sprintf("user:%s:settings", userID),
 			fmt.Sprintf("user:%s:preferences", userID),
 		)
 	}
-	
-	return relatedKeys
-}
-
-// promoteToL1 promotes a value from L2 to L1 cache
-func (cm *CacheManager) promoteToL1(key string, value interface{}) {
-	cm.l1Cache.Set(key, value)
-}
 
-// promoteToL2 promotes a value from L3 to L2 cache
-func (cm *CacheManager) promoteToL2(key string, value interface{}) {
-	cm.l2Cache.Set(key, value, cm.config.L2TTL)
+	return relatedKeys
 }
 
 // startWorkers starts background worker goroutines
 func (cm *CacheManager) startWorkers() {
 	// Start warmup workers
 	for i := 0; i < cm.config.WarmupWorkers; i++ {
-		go cm.warmupWorker()
+		cm.goWorker(cm.warmupWorker)
 	}
-	
+
 	// Start eviction workers
 	for i := 0; i < cm.config.EvictionWorkers; i++ {
-		go cm.evictionWorker()
+		cm.goWorker(cm.evictionWorker)
+	}
+
+	if cm.l2Cache != nil {
+		cm.goWorker(cm.demoteWorker)
+	}
+
+	if cm.config.AccessLog != "" {
+		cm.goWorker(cm.accessLogWorker)
 	}
-	
+
 	// Start auto-scaling worker if enabled
 	if cm.config.AutoScaling {
-		go cm.autoScalingWorker()
+		cm.goWorker(cm.autoScalingWorker)
 	}
 }
 
+// goWorker runs fn on a goroutine Stop waits for
+func (cm *CacheManager) goWorker(fn func()) {
+	cm.workers.Add(1)
+	go func() {
+		defer cm.workers.Done()
+		fn()
+	}()
+}
+
 // warmupWorker processes cache warming requests
 func (cm *CacheManager) warmupWorker() {
 	for {
@@ -276,6 +419,96 @@ func (cm *CacheManager) evictionWorker() {
 	}
 }
 
+// accessLogInterval is how often a long-running manager saves the access
+// counts of its keys
+const accessLogInterval = time.Minute
+
+// accessLogWorker saves the access counts periodically
+func (cm *CacheManager) accessLogWorker() {
+	ticker := time.NewTicker(accessLogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cm.FlushAccessLog()
+		case <-cm.ctx.Done():
+			return
+		}
+	}
+}
+
+// recordAccess counts a lookup of key for the access log
+func (cm *CacheManager) recordAccess(key string, at time.Time) {
+	if cm.config.AccessLog == "" {
+		return
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	access, ok := cm.accesses[key]
+	if !ok {
+		access = &KeyAccess{Key: key}
+		cm.accesses[key] = access
+	}
+	access.Count++
+	access.Last = at
+}
+
+// FlushAccessLog merges the lookups counted since the last flush into the
+// access log
+func (cm *CacheManager) FlushAccessLog() error {
+	if cm.config.AccessLog == "" {
+		return nil
+	}
+	cm.mu.Lock()
+	counts := cm.accesses
+	cm.accesses = make(map[string]*KeyAccess)
+	cm.mu.Unlock()
+	if len(counts) == 0 {
+		return nil
+	}
+
+	snapshot, err := LoadAccessSnapshot(cm.config.AccessLog)
+	if err != nil {
+		// A damaged log is replaced rather than blocking new counts
+		snapshot = &AccessSnapshot{}
+	}
+	snapshot.merge(counts)
+	return snapshot.Save(cm.config.AccessLog)
+}
+
+// demoteWorker writes entries evicted from L1 to L2, keeping their expiry
+func (cm *CacheManager) demoteWorker() {
+	for {
+		select {
+		case entry := <-cm.demoteQueue:
+			cm.demote(entry)
+		case <-cm.ctx.Done():
+			// Entries still queued are written before Stop returns
+			for {
+				select {
+				case entry := <-cm.demoteQueue:
+					cm.demote(entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// demote writes one entry to L2
+func (cm *CacheManager) demote(entry CacheEntry) {
+	if entry.expired(time.Now()) {
+		return
+	}
+	if cm.l2Cache.SetUntil(entry.Key, entry.Value, entry.ExpiresAt) == nil {
+		cm.mu.Lock()
+		cm.stats.Demotions++
+		cm.mu.Unlock()
+	}
+}
+
 // processWarmupRequest processes a single warmup request
 func (cm *CacheManager) processWarmupRequest(request WarmupRequest) {
 	// If value is nil, fetch from data source
@@ -284,13 +517,17 @@ func (cm *CacheManager) processWarmupRequest(request WarmupRequest) {
 		// For now, we'll skip nil values
 		return
 	}
-	
+
 	// Store in appropriate cache level based on priority
 	switch request.Priority {
 	case 1: // High priority - store in L1
-		cm.l1Cache.Set(request.Key, request.Value)
+		cm.l1Cache.SetWithTTL(request.Key, request.Value, request.TTL)
 	case 2: // Medium priority - store in L2
-		cm.l2Cache.Set(request.Key, request.Value, request.TTL)
+		if cm.l2Cache != nil {
+			cm.l2Cache.Set(request.Key, request.Value, request.TTL)
+		} else {
+			cm.l1Cache.SetWithTTL(request.Key, request.Value, request.TTL)
+		}
 	case 3: // Low priority - store in L3
 		cm.l3Cache.Set(request.Key, request.Value, request.TTL)
 	}
@@ -298,13 +535,17 @@ func (cm *CacheManager) processWarmupRequest(request WarmupRequest) {
 
 // processEvictionRequest processes a single eviction request
 func (cm *CacheManager) processEvictionRequest(request EvictionRequest) {
+	cm.mu.Lock()
 	cm.stats.EvictionRequests++
-	
+	cm.mu.Unlock()
+
 	switch request.Level {
 	case 1:
 		cm.l1Cache.Delete(request.Key)
 	case 2:
-		cm.l2Cache.Delete(request.Key)
+		if cm.l2Cache != nil {
+			cm.l2Cache.Delete(request.Key)
+		}
 	case 3:
 		cm.l3Cache.Delete(request.Key)
 	}
@@ -314,7 +555,7 @@ func (cm *CacheManager) processEvictionRequest(request EvictionRequest) {
 func (cm *CacheManager) autoScalingWorker() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
-	
+
 	for {
 		select {
 		case <-ticker.C:
@@ -328,7 +569,7 @@ func (cm *CacheManager) autoScalingWorker() {
 // performAutoScaling adjusts cache sizes based on performance
 func (cm *CacheManager) performAutoScaling() {
 	stats := cm.GetStats()
-	
+
 	// Scale L1 cache based on hit rate
 	if stats.HitRate < 0.8 {
 		// Increase L1 cache size
@@ -345,68 +586,131 @@ func (cm *CacheManager) performAutoScaling() {
 
 // GetStats returns comprehensive cache statistics
 func (cm *CacheManager) GetStats() *ManagerStats {
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
-	
-	stats := *cm.stats
-	
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	stats := cm.stats
+
 	// Calculate overall hit rate
 	total := stats.L1Hits + stats.L2Hits + stats.L3Hits + stats.CacheMisses
 	if total > 0 {
 		stats.HitRate = float64(stats.L1Hits+stats.L2Hits+stats.L3Hits) / float64(total)
 	}
-	
+
 	return &stats
 }
 
+// Levels returns the statistics of each level in use, L1 first. Hits and
+// misses count the lookups that reached the level.
+func (cm *CacheManager) Levels() []LevelStats {
+	levels := []LevelStats{{Name: "l1", Backend: "memory", CacheStats: *cm.l1Cache.GetStats()}}
+	if cm.l2Cache != nil {
+		levels = append(levels, LevelStats{Name: "l2", Backend: "disk", CacheStats: *cm.l2Cache.GetStats()})
+	}
+	return append(levels, LevelStats{Name: "l3", Backend: cm.l3Cache.BackendName(), CacheStats: *cm.l3Cache.GetStats()})
+}
+
 // GetDetailedStats returns detailed statistics for all cache levels
 func (cm *CacheManager) GetDetailedStats() map[string]interface{} {
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"manager": cm.GetStats(),
-		"l1":      cm.l1Cache.GetStats(),
-		"l2":      cm.l2Cache.GetStats(),
-		"l3":      cm.l3Cache.GetStats(),
 		"config":  cm.config,
 	}
+	for _, level := range cm.Levels() {
+		level := level
+		stats[level.Name] = &level.CacheStats
+	}
+	return stats
 }
 
-// updateStats updates performance statistics
-func (cm *CacheManager) updateStats(latency time.Duration) {
+// record counts one lookup
+func (cm *CacheManager) record(start time.Time, count func(*ManagerStats)) {
+	latency := time.Since(start)
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
-	
+
+	cm.stats.TotalRequests++
+	count(&cm.stats)
+
 	// Update average latency
 	total := cm.stats.TotalRequests
-	if total > 0 {
-		cm.stats.AverageLatency = (cm.stats.AverageLatency*time.Duration(total-1) + latency) / time.Duration(total)
-	}
+	cm.stats.AverageLatency = (cm.stats.AverageLatency*time.Duration(total-1) + latency) / time.Duration(total)
 }
 
-// Stop stops the cache manager and all workers
+// Stop stops the cache manager and all workers. L1 entries are demoted to
+// L2 first, so the next manager on the same directory starts warm, and the
+// access counts are saved.
 func (cm *CacheManager) Stop() {
-	cm.cancel()
-	cm.l1Cache.Stop()
-	cm.l2Cache.Stop()
-	cm.l3Cache.Stop()
+	cm.stopOnce.Do(func() {
+		cm.cancel()
+		cm.workers.Wait()
+		cm.FlushAccessLog()
+		if cm.l2Cache != nil {
+			for _, entry := range cm.l1Cache.Entries() {
+				cm.demote(entry)
+			}
+			cm.l2Cache.Stop()
+		}
+		cm.l1Cache.Stop()
+		cm.l3Cache.Stop()
+	})
 }
 
 // GetMemoryUsage returns total memory usage across all cache levels
 func (cm *CacheManager) GetMemoryUsage() uint64 {
-	return cm.l1Cache.GetMemoryUsage() + 
-		   cm.l2Cache.GetMemoryUsage() + 
-		   cm.l3Cache.GetMemoryUsage()
+	usage := cm.l1Cache.GetMemoryUsage() + cm.l3Cache.GetMemoryUsage()
+	if cm.l2Cache != nil {
+		usage += cm.l2Cache.GetMemoryUsage()
+	}
+	return usage
 }
 
-// FlushToDisk flushes cache data to disk for persistence
+// snapshotEntry is one L1 entry in a FlushToDisk file
+type snapshotEntry struct {
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value"`
+	ExpiresAt time.Time   `json:"expires_at,omitempty"`
+}
+
+// FlushToDisk writes the L1 entries to filename as JSON
 func (cm *CacheManager) FlushToDisk(filename string) error {
-	// This would implement cache persistence
-	// For now, return success
-	return nil
+	entries := cm.l1Cache.Entries()
+	snapshot := make([]snapshotEntry, 0, len(entries))
+	for _, entry := range entries {
+		snapshot = append(snapshot, snapshotEntry{Key: entry.Key, Value: entry.Value, ExpiresAt: entry.ExpiresAt})
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to serialize cache: %v", err)
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
 }
 
-// LoadFromDisk loads cache data from disk
+// LoadFromDisk loads the entries FlushToDisk wrote into L1, skipping
+// those that have expired since
 func (cm *CacheManager) LoadFromDisk(filename string) error {
-	// This would implement cache restoration
-	// For now, return success
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var snapshot []snapshotEntry
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to read cache snapshot %s: %v", filename, err)
+	}
+	for _, entry := range snapshot {
+		var ttl time.Duration
+		if !entry.ExpiresAt.IsZero() {
+			if ttl = time.Until(entry.ExpiresAt); ttl <= 0 {
+				continue
+			}
+		}
+		if err := cm.l1Cache.SetWithTTL(entry.Key, entry.Value, ttl); err != nil {
+			return err
+		}
+	}
 	return nil
-} 
\ No newline at end of file
+}
@@ -3,13 +3,14 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/cyber-boost/tusktsk/pkg/performance"
+	"github.com/cyber-boost/tusktsk/pkg/performance/cache"
+	"github.com/cyber-boost/tusktsk/pkg/performance/jit"
+	"github.com/cyber-boost/tusktsk/pkg/performance/memory"
 )
 
 // CacheCommands provides CLI commands for cache management
@@ -53,7 +54,9 @@ func (cc *CacheCommands) cacheClearCmd() *cobra.Command {
 				return fmt.Errorf("performance framework not initialized")
 			}
 			
-			cc.framework.Clear()
+			if err := cc.framework.Clear(); err != nil {
+				return err
+			}
 			fmt.Println("✅ All cache levels cleared successfully")
 			return nil
 		},
@@ -78,7 +81,7 @@ func (cc *CacheCommands) cacheStatusCmd() *cobra.Command {
 			fmt.Println("======================")
 			
 			if cacheStats, ok := stats["cache"].(map[string]interface{}); ok {
-				if manager, ok := cacheStats["manager"].(*performance.ManagerStats); ok {
+				if manager, ok := cacheStats["manager"].(*cache.ManagerStats); ok {
 					fmt.Printf("Total Requests: %d\n", manager.TotalRequests)
 					fmt.Printf("L1 Hits: %d\n", manager.L1Hits)
 					fmt.Printf("L2 Hits: %d\n", manager.L2Hits)
@@ -88,21 +91,21 @@ func (cc *CacheCommands) cacheStatusCmd() *cobra.Command {
 					fmt.Printf("Average Latency: %v\n", manager.AverageLatency)
 				}
 				
-				if l1, ok := cacheStats["l1"].(*performance.CacheStats); ok {
+				if l1, ok := cacheStats["l1"].(*cache.CacheStats); ok {
 					fmt.Printf("\nL1 Cache:\n")
 					fmt.Printf("  Size: %d / %d bytes\n", l1.Size, l1.MaxSize)
 					fmt.Printf("  Hit Rate: %.2f%%\n", l1.HitRate*100)
 					fmt.Printf("  Evictions: %d\n", l1.Evictions)
 				}
 				
-				if l2, ok := cacheStats["l2"].(*performance.CacheStats); ok {
+				if l2, ok := cacheStats["l2"].(*cache.CacheStats); ok {
 					fmt.Printf("\nL2 Cache:\n")
 					fmt.Printf("  Size: %d / %d bytes\n", l2.Size, l2.MaxSize)
 					fmt.Printf("  Hit Rate: %.2f%%\n", l2.HitRate*100)
 					fmt.Printf("  Evictions: %d\n", l2.Evictions)
 				}
 				
-				if l3, ok := cacheStats["l3"].(*performance.CacheStats); ok {
+				if l3, ok := cacheStats["l3"].(*cache.CacheStats); ok {
 					fmt.Printf("\nL3 Cache:\n")
 					fmt.Printf("  Size: %d / %d bytes\n", l3.Size, l3.MaxSize)
 					fmt.Printf("  Hit Rate: %.2f%%\n", l3.HitRate*100)
@@ -135,7 +138,9 @@ func (cc *CacheCommands) cacheWarmCmd() *cobra.Command {
 				warmupData[key] = fmt.Sprintf("warmup_value_%s", key)
 			}
 			
-			cc.framework.WarmUp(warmupData)
+			if err := cc.framework.WarmUp(warmupData); err != nil {
+				return err
+			}
 			fmt.Printf("✅ Cache warmed up with %d keys\n", len(args))
 			return nil
 		},
@@ -316,46 +321,54 @@ func (cc *CacheCommands) performanceStatsCmd() *cobra.Command {
 			}
 			
 			stats := cc.framework.GetDetailedStats()
+			out := cmd.OutOrStdout()
 			
-			fmt.Println("🚀 PERFORMANCE STATISTICS")
-			fmt.Println("=========================")
+			fmt.Fprintln(out, "🚀 PERFORMANCE STATISTICS")
+			fmt.Fprintln(out, "=========================")
 			
 			// Framework stats
 			if framework, ok := stats["framework"].(*performance.FrameworkStats); ok {
-				fmt.Printf("Total Requests: %d\n", framework.TotalRequests)
-				fmt.Printf("JIT Compilations: %d\n", framework.JITCompilations)
-				fmt.Printf("Cache Hits: %d\n", framework.CacheHits)
-				fmt.Printf("Memory Optimizations: %d\n", framework.MemoryOptimizations)
-				fmt.Printf("Performance Gain: %.2fx\n", framework.PerformanceGain)
-				fmt.Printf("Memory Usage: %s\n", formatBytes(framework.MemoryUsage))
-				fmt.Printf("CPU Usage: %.2f%%\n", framework.CPUUsage*100)
-				fmt.Printf("Uptime: %v\n", framework.Uptime)
+				fmt.Fprintf(out, "Total Requests: %d\n", framework.TotalRequests)
+				fmt.Fprintf(out, "JIT Compilations: %d\n", framework.JITCompilations)
+				fmt.Fprintf(out, "Cache Hits: %d\n", framework.CacheHits)
+				fmt.Fprintf(out, "Memory Optimizations: %d\n", framework.MemoryOptimizations)
+				fmt.Fprintf(out, "Performance Gain: %.2fx\n", framework.PerformanceGain)
+				fmt.Fprintf(out, "Memory Usage: %s\n", formatBytes(framework.MemoryUsage))
+				fmt.Fprintf(out, "CPU Usage: %.2f%%\n", framework.CPUUsage*100)
+				fmt.Fprintf(out, "Uptime: %v\n", framework.Uptime)
 			}
 			
 			// JIT stats
-			if jit, ok := stats["jit"].(*performance.CompilationStats); ok {
-				fmt.Printf("\nJIT Compilation:\n")
-				fmt.Printf("  Total Compilations: %d\n", jit.TotalCompilations)
-				fmt.Printf("  Hot Paths Detected: %d\n", jit.HotPathsDetected)
-				fmt.Printf("  Optimizations: %d\n", jit.Optimizations)
-				fmt.Printf("  Cache Hits: %d\n", jit.CacheHits)
-				fmt.Printf("  Cache Misses: %d\n", jit.CacheMisses)
-				fmt.Printf("  Compilation Time: %v\n", jit.CompilationTime)
-				fmt.Printf("  Performance Gain: %.2fx\n", jit.PerformanceGain)
+			if jitStats, ok := stats["jit"].(*jit.CompilationStats); ok {
+				fmt.Fprintf(out, "\nJIT Compilation:\n")
+				fmt.Fprintf(out, "  Threshold: %d executions\n", jitStats.Threshold)
+				fmt.Fprintf(out, "  Hot Paths Detected: %d\n", jitStats.HotPathsDetected)
+				fmt.Fprintf(out, "  Total Compilations: %d\n", jitStats.TotalCompilations)
+				fmt.Fprintf(out, "  Compile Failures: %d\n", jitStats.CompileFailures)
+				fmt.Fprintf(out, "  Compiled Executions: %d\n", jitStats.CompiledExecutions)
+				fmt.Fprintf(out, "  Interpreted Executions: %d\n", jitStats.InterpretedExecutions)
+				fmt.Fprintf(out, "  Folded Constants: %d\n", jitStats.FoldedConstants)
+				fmt.Fprintf(out, "  Precompiled Regexes: %d\n", jitStats.PrecompiledRegexes)
+				fmt.Fprintf(out, "  Compilation Time: %v\n", jitStats.CompilationTime)
 			}
 			
 			// Memory stats
-			if memory, ok := stats["memory"].(*performance.PoolStats); ok {
-				fmt.Printf("\nMemory Pool:\n")
-				fmt.Printf("  Total Pools: %d\n", memory.TotalPools)
-				fmt.Printf("  Total Objects: %d\n", memory.TotalObjects)
-				fmt.Printf("  Total Created: %d\n", memory.TotalCreated)
-				fmt.Printf("  Total Reused: %d\n", memory.TotalReused)
-				fmt.Printf("  Total Allocated: %d\n", memory.TotalAllocated)
-				fmt.Printf("  Total Freed: %d\n", memory.TotalFreed)
-				fmt.Printf("  Memory Usage: %s\n", formatBytes(memory.MemoryUsage))
-				fmt.Printf("  Hit Rate: %.2f%%\n", memory.HitRate*100)
-				fmt.Printf("  Efficiency: %.2f%%\n", memory.Efficiency*100)
+			if memStats, ok := stats["memory"].(*memory.PoolStats); ok {
+				fmt.Fprintf(out, "\nMemory Pool:\n")
+				fmt.Fprintf(out, "  Total Pools: %d\n", memStats.TotalPools)
+				fmt.Fprintf(out, "  Total Objects: %d\n", memStats.TotalObjects)
+				fmt.Fprintf(out, "  Total Created: %d\n", memStats.TotalCreated)
+				fmt.Fprintf(out, "  Total Reused: %d\n", memStats.TotalReused)
+				fmt.Fprintf(out, "  Total Allocated: %d\n", memStats.TotalAllocated)
+				fmt.Fprintf(out, "  Total Freed: %d\n", memStats.TotalFreed)
+				fmt.Fprintf(out, "  Memory Usage: %s\n", formatBytes(memStats.MemoryUsage))
+				fmt.Fprintf(out, "  Hit Rate: %.2f%%\n", memStats.HitRate*100)
+				fmt.Fprintf(out, "  Efficiency: %.2f%%\n", memStats.Efficiency*100)
+				for _, kind := range []string{"tokens", "builders", "sets"} {
+					if k, ok := memStats.Kinds[kind]; ok {
+						fmt.Fprintf(out, "  Parser %s: %.2f%% hit rate over %d gets\n", kind, k.HitRate*100, k.TotalAllocated)
+					}
+				}
 			}
 			
 			return nil
@@ -410,7 +423,8 @@ func (cc *CacheCommands) performanceBenchmarkCmd() *cobra.Command {
 				fmt.Printf("\nJIT Compilation:\n")
 				fmt.Printf("  Compilation Time: %v\n", results.JITResults.CompilationTime)
 				fmt.Printf("  Optimizations: %d\n", results.JITResults.Optimizations)
-				fmt.Printf("  Performance Gain: %.2fx\n", results.JITResults.PerformanceGain)
+				fmt.Printf("  Execution Time: %v\n", results.JITResults.ExecutionTime)
+				fmt.Printf("  Compiled Executions: %d\n", results.JITResults.CompiledExecutions)
 			}
 			
 			if results.CacheResults != nil {
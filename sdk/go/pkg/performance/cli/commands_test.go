@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cyber-boost/tusktsk/pkg/performance"
+	"github.com/cyber-boost/tusktsk/pkg/performance/memory"
+)
+
+// command returns the command of cc named name
+func command(t *testing.T, cc *CacheCommands, name string) *cobra.Command {
+	t.Helper()
+	for _, cmd := range cc.GetCommands() {
+		if cmd.Name() == name {
+			return cmd
+		}
+	}
+	t.Fatalf("no %s command", name)
+	return nil
+}
+
+func TestPerformanceStats(t *testing.T) {
+	framework := performance.NewFramework(&performance.FrameworkConfig{
+		JITEnabled:    true,
+		CacheEnabled:  true,
+		MemoryEnabled: true,
+	})
+	defer framework.Stop()
+
+	// Draw from the parser pools so they have counts to report
+	tokens := memory.Parser.Tokens()
+	memory.Parser.PutTokens(tokens)
+
+	var out bytes.Buffer
+	cmd := command(t, NewCacheCommands(framework), "performance-stats")
+	cmd.SetOut(&out)
+	cmd.SetArgs(nil)
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"JIT Compilation:",
+		"  Threshold: ",
+		"  Compiled Executions: ",
+		"  Precompiled Regexes: ",
+		"Memory Pool:",
+		"  Hit Rate: ",
+		"  Parser tokens: ",
+		"  Parser builders: ",
+		"  Parser sets: ",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("performance-stats output lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestCacheCommandsWithoutCache(t *testing.T) {
+	framework := performance.NewFramework(&performance.FrameworkConfig{})
+	defer framework.Stop()
+
+	cc := NewCacheCommands(framework)
+	for _, args := range [][]string{{"clear"}, {"warm", "app.name"}} {
+		cmd := command(t, cc, args[0])
+		cmd.SetArgs(args[1:])
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "cache not enabled") {
+			t.Errorf("%s without a cache = %v, want cache not enabled", args[0], err)
+		}
+	}
+}
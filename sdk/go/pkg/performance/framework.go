@@ -37,6 +37,8 @@ type FrameworkConfig struct {
 	OptimizationInterval time.Duration
 	MaxConcurrency   int
 	PerformanceTarget float64
+	// L3Backend shares the L3 cache level, e.g. through Redis
+	L3Backend        cache.L3Backend
 }
 
 // FrameworkStats tracks overall framework performance
@@ -79,7 +81,7 @@ func NewFramework(config *FrameworkConfig) *Framework {
 func (f *Framework) initializeComponents() {
 	// Initialize JIT compiler
 	if f.config.JITEnabled {
-		f.jitCompiler = jit.NewJITCompiler()
+		f.jitCompiler = jit.Default
 	}
 	
 	// Initialize cache manager
@@ -95,6 +97,7 @@ func (f *Framework) initializeComponents() {
 			EvictionWorkers:  2,
 			PredictiveWarmup: true,
 			AutoScaling:      true,
+			L3Backend:        f.config.L3Backend,
 		}
 		f.cacheManager = cache.NewCacheManager(cacheConfig)
 	}
@@ -127,15 +130,8 @@ func (f *Framework) Execute(signature string, fn func() interface{}) interface{}
 	f.stats.TotalRequests++
 	start := time.Now()
 	
-	// Use JIT compilation if enabled
-	if f.jitCompiler != nil {
-		result := f.jitCompiler.Execute(signature, fn)
-		f.stats.JITCompilations++
-		f.updatePerformanceMetrics(time.Since(start))
-		return result
-	}
-	
-	// Fallback to direct execution
+	// fn is already native code; the JIT compiler compiles expressions
+	// of the configuration VM, so the call is only counted
 	result := fn()
 	f.updatePerformanceMetrics(time.Since(start))
 	return result
@@ -163,6 +159,25 @@ func (f *Framework) Set(key string, value interface{}, ttl time.Duration) error
 	return f.cacheManager.Set(key, value, ttl)
 }
 
+// Clear empties every cache level and resets the cache counters
+func (f *Framework) Clear() error {
+	if f.cacheManager == nil {
+		return fmt.Errorf("cache not enabled")
+	}
+	
+	return f.cacheManager.Clear()
+}
+
+// WarmUp preloads the cache with data
+func (f *Framework) WarmUp(data map[string]interface{}) error {
+	if f.cacheManager == nil {
+		return fmt.Errorf("cache not enabled")
+	}
+	
+	f.cacheManager.WarmUp(data)
+	return nil
+}
+
 // GetBytes retrieves optimized byte slice
 func (f *Framework) GetBytes(size int) []byte {
 	if !f.enabled || f.memoryPool == nil {
@@ -211,7 +226,7 @@ func (f *Framework) ProfileFunction(id, name string, fn func() interface{}) inte
 // StartProfile begins profiling session
 func (f *Framework) StartProfile(id, name string) *jit.ProfileSession {
 	if !f.enabled || f.profiler == nil {
-		return &jit.ProfileSession{Enabled: false}
+		return new(jit.Profiler).StartProfile(id, name)
 	}
 	
 	return f.profiler.StartProfile(id, name)
@@ -290,6 +305,9 @@ func (f *Framework) GetStats() *FrameworkStats {
 	
 	stats := *f.stats
 	stats.Uptime = time.Since(stats.StartTime)
+	if f.jitCompiler != nil {
+		stats.JITCompilations = f.jitCompiler.GetStats().TotalCompilations
+	}
 	
 	return &stats
 }
@@ -400,7 +418,8 @@ type JITBenchmarkResults struct {
 	CompilationTime time.Duration
 	ExecutionTime   time.Duration
 	Optimizations   int64
-	PerformanceGain float64
+	// CompiledExecutions ran the compiled form of the benchmark path
+	CompiledExecutions int64
 }
 
 // CacheBenchmarkResults contains cache benchmark results
@@ -423,20 +442,30 @@ type MemoryBenchmarkResults struct {
 func (f *Framework) benchmarkJIT(iterations int) *JITBenchmarkResults {
 	results := &JITBenchmarkResults{}
 	
-	// Benchmark compilation
+	// A private compiler keeps the benchmark path out of the shared stats
+	compiler := jit.NewJITCompiler()
+	signature := "benchmark_function"
+	square := func(i int) interface{} { return i * i }
+	
 	start := time.Now()
 	for i := 0; i < iterations; i++ {
-		signature := fmt.Sprintf("benchmark_function_%d", i)
-		f.jitCompiler.Execute(signature, func() interface{} {
-			return i * i
-		})
+		form, compile := compiler.Lookup(signature)
+		if compile {
+			compiled := time.Now()
+			compiler.Store(signature, square, jit.CompileInfo{}, time.Since(compiled), nil)
+		}
+		if fn, ok := form.(func(int) interface{}); ok {
+			fn(i)
+		} else {
+			square(i)
+		}
 	}
-	results.CompilationTime = time.Since(start)
+	results.ExecutionTime = time.Since(start)
 	
-	// Get JIT stats
-	stats := f.jitCompiler.GetStats()
+	stats := compiler.GetStats()
+	results.CompilationTime = stats.CompilationTime
 	results.Optimizations = stats.TotalCompilations
-	results.PerformanceGain = stats.PerformanceGain
+	results.CompiledExecutions = stats.CompiledExecutions
 	
 	return results
 }
@@ -543,10 +572,10 @@ func (f *Framework) calculatePerformanceScore(report *PerformanceReport) float64
 		score += memoryStats.Efficiency * 0.2
 	}
 	
-	// JIT optimization (10%)
+	// JIT optimization (10%): the share of executions that ran compiled
 	if jitStats, ok := report.Components["jit"].(*jit.CompilationStats); ok {
-		if jitStats.PerformanceGain > 0 {
-			score += jitStats.PerformanceGain * 0.1
+		if total := jitStats.CompiledExecutions + jitStats.InterpretedExecutions; total > 0 {
+			score += float64(jitStats.CompiledExecutions) / float64(total) * 0.1
 		}
 	}
 	
@@ -1,243 +1,256 @@
+// Package jit detects hot code paths and keeps the compiled form of each,
+// with the statistics the performance framework reports. What a path is
+// compiled to is up to the caller: the expression VM of pkg/peanut
+// compiles operator expressions to closures.
 package jit
 
 import (
-	"bytes"
-	"encoding/binary"
-	"fmt"
-	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 )
 
-// JITCompiler provides Just-In-Time compilation for hot paths
-type JITCompiler struct {
-	mu           sync.RWMutex
-	hotPaths     map[string]*HotPath
-	compiledCode map[string][]byte
-	profiler     *Profiler
-	optimizer    *Optimizer
-	stats        *CompilationStats
+// DefaultThreshold is the number of executions after which a path is
+// compiled
+const DefaultThreshold = 100
+
+// MaxPaths bounds the paths a compiler tracks; executions of paths first
+// seen beyond it are only counted in the totals
+const MaxPaths = 10000
+
+// Default is the compiler shared by the VMs of the standard operator set
+var Default = NewJITCompiler()
+
+// States of a HotPath
+const (
+	StateCold      = "cold"
+	StateCompiling = "compiling"
+	StateCompiled  = "compiled"
+	StateFailed    = "failed"
+)
+
+// CompileInfo describes what compiling one path did
+type CompileInfo struct {
+	// FoldedConstants counts the sub-expressions resolved at compile time
+	FoldedConstants int `json:"folded_constants"`
+	// PrecompiledRegexes counts the patterns compiled ahead of their calls
+	PrecompiledRegexes int `json:"precompiled_regexes"`
 }
 
-// HotPath represents a frequently executed code path
+// HotPath describes one tracked path
 type HotPath struct {
-	ID          string
-	Signature   string
-	Executions  int64
-	LastExec    time.Time
-	Compiled    bool
-	MachineCode []byte
-	Optimized   bool
-	Performance float64
+	Signature  string `json:"signature"`
+	Executions int64  `json:"executions"`
+	// CompiledExecutions are the executions that ran the compiled form
+	CompiledExecutions int64         `json:"compiled_executions"`
+	State              string        `json:"state"`
+	CompiledAt         time.Time     `json:"compiled_at,omitempty"`
+	CompileTime        time.Duration `json:"compile_time_ns"`
+	CompileInfo
+	// Error is why compiling failed; the path keeps being interpreted
+	Error string `json:"error,omitempty"`
 }
 
-// CompilationStats tracks JIT compilation metrics
+// CompilationStats totals the activity of a compiler
 type CompilationStats struct {
-	TotalCompilations int64
-	HotPathsDetected  int64
-	Optimizations     int64
-	CacheHits         int64
-	CacheMisses       int64
-	CompilationTime   time.Duration
-	PerformanceGain   float64
+	Threshold        int64 `json:"threshold"`
+	HotPathsDetected int64 `json:"hot_paths_detected"`
+	// TotalCompilations counts successful compilations
+	TotalCompilations int64 `json:"total_compilations"`
+	CompileFailures   int64 `json:"compile_failures"`
+	// CompiledExecutions ran a compiled form, InterpretedExecutions did not
+	CompiledExecutions    int64         `json:"compiled_executions"`
+	InterpretedExecutions int64         `json:"interpreted_executions"`
+	FoldedConstants       int64         `json:"folded_constants"`
+	PrecompiledRegexes    int64         `json:"precompiled_regexes"`
+	CompilationTime       time.Duration `json:"compilation_time_ns"`
 }
 
-// NewJITCompiler creates a new JIT compiler instance
-func NewJITCompiler() *JITCompiler {
-	return &JITCompiler{
-		hotPaths:     make(map[string]*HotPath),
-		compiledCode: make(map[string][]byte),
-		profiler:     NewProfiler(),
-		optimizer:    NewOptimizer(),
-		stats:        &CompilationStats{},
-	}
+// path is the state of one signature. The counters are updated without
+// the compiler's lock, which only guards the map and the compile results.
+type path struct {
+	executions atomic.Int64
+	hits       atomic.Int64
+	compiled   atomic.Value // holds compiledForm once compiled
+	state      atomic.Int32
+
+	// Guarded by JITCompiler.mu
+	compiledAt  time.Time
+	compileTime time.Duration
+	info        CompileInfo
+	err         string
 }
 
-// Execute runs code with JIT optimization
-func (jit *JITCompiler) Execute(signature string, fn func() interface{}) interface{} {
-	// Check if we have compiled code for this signature
-	jit.mu.RLock()
-	if compiled, exists := jit.compiledCode[signature]; exists {
-		jit.stats.CacheHits++
-		jit.mu.RUnlock()
-		return jit.executeCompiled(compiled, fn)
-	}
-	jit.mu.RUnlock()
+// compiledForm wraps the caller's compiled value so that atomic.Value
+// accepts different concrete types across paths
+type compiledForm struct {
+	value interface{}
+}
 
-	// Track execution for hot path detection
-	jit.mu.Lock()
-	hotPath, exists := jit.hotPaths[signature]
-	if !exists {
-		hotPath = &HotPath{
-			ID:         generateID(),
-			Signature:  signature,
-			Executions: 0,
-			LastExec:   time.Now(),
-		}
-		jit.hotPaths[signature] = hotPath
-	}
-	hotPath.Executions++
-	hotPath.LastExec = time.Now()
-	jit.mu.Unlock()
+const (
+	cold int32 = iota
+	compiling
+	compiled
+	failed
+)
 
-	// Execute the function
-	start := time.Now()
-	result := fn()
-	executionTime := time.Since(start)
+var stateNames = map[int32]string{cold: StateCold, compiling: StateCompiling, compiled: StateCompiled, failed: StateFailed}
 
-	// Check if this path is hot enough for compilation
-	if hotPath.Executions >= 100 && !hotPath.Compiled {
-		go jit.compileHotPath(hotPath)
-	}
+// JITCompiler counts the executions of each path and holds the compiled
+// forms of those that turned hot
+type JITCompiler struct {
+	threshold atomic.Int64
+	paths     sync.Map // signature -> *path
+	npaths    atomic.Int64
 
-	return result
+	interpreted atomic.Int64
+	hits        atomic.Int64
+
+	mu    sync.Mutex
+	stats CompilationStats
 }
 
-// compileHotPath compiles a hot path to machine code
-func (jit *JITCompiler) compileHotPath(hotPath *HotPath) {
-	start := time.Now()
-	
-	// Generate machine code for the hot path
-	machineCode := jit.generateMachineCode(hotPath.Signature)
-	
-	// Optimize the generated code
-	optimizedCode := jit.optimizer.Optimize(machineCode)
-	
-	// Store the compiled code
-	jit.mu.Lock()
-	jit.compiledCode[hotPath.Signature] = optimizedCode
-	hotPath.Compiled = true
-	hotPath.MachineCode = optimizedCode
-	hotPath.Optimized = true
-	jit.stats.TotalCompilations++
-	jit.stats.Optimizations++
-	jit.mu.Unlock()
+// NewJITCompiler creates a compiler with DefaultThreshold
+func NewJITCompiler() *JITCompiler {
+	jit := &JITCompiler{}
+	jit.threshold.Store(DefaultThreshold)
+	return jit
+}
 
-	compilationTime := time.Since(start)
-	jit.stats.CompilationTime += compilationTime
+// SetThreshold sets the executions after which a path is compiled; 0 or
+// less turns compilation off. Paths already compiled stay compiled.
+func (jit *JITCompiler) SetThreshold(n int64) {
+	jit.threshold.Store(n)
+}
 
-	// Update performance metrics
-	jit.updatePerformanceMetrics(hotPath, compilationTime)
+// Threshold returns the executions after which a path is compiled
+func (jit *JITCompiler) Threshold() int64 {
+	return jit.threshold.Load()
 }
 
-// generateMachineCode generates machine code for a signature
-func (jit *JITCompiler) generateMachineCode(signature string) []byte {
-	// This is a simplified machine code generation
-	// In a real implementation, this would use a proper assembler
-	
-	// Generate optimized bytecode based on signature analysis
-	bytecode := jit.analyzeSignature(signature)
-	
-	// Convert to machine code (simplified)
-	machineCode := make([]byte, len(bytecode)*2)
-	for i, b := range bytecode {
-		// Optimize common patterns
-		switch b {
-		case 0x01: // Load operation
-			machineCode[i*2] = 0x48 // MOV instruction
-			machineCode[i*2+1] = 0x89 // Register to register
-		case 0x02: // Store operation
-			machineCode[i*2] = 0x48 // MOV instruction
-			machineCode[i*2+1] = 0x8B // Register from memory
-		case 0x03: // Add operation
-			machineCode[i*2] = 0x48 // ADD instruction
-			machineCode[i*2+1] = 0x01 // Register add
-		case 0x04: // Multiply operation
-			machineCode[i*2] = 0x48 // IMUL instruction
-			machineCode[i*2+1] = 0x0F // Extended instruction
-		default:
-			machineCode[i*2] = 0x90 // NOP
-			machineCode[i*2+1] = b
-		}
+// Lookup counts one execution of signature. It returns the compiled form
+// once one is stored. compile is true exactly once, for the execution that
+// makes the path hot: the caller then compiles it and calls Store.
+func (jit *JITCompiler) Lookup(signature string) (form interface{}, compile bool) {
+	p := jit.path(signature)
+	if p == nil {
+		jit.interpreted.Add(1)
+		return nil, false
 	}
-	
-	return machineCode
+	n := p.executions.Add(1)
+	if c, ok := p.compiled.Load().(compiledForm); ok {
+		p.hits.Add(1)
+		jit.hits.Add(1)
+		return c.value, false
+	}
+	jit.interpreted.Add(1)
+	threshold := jit.threshold.Load()
+	if threshold > 0 && n >= threshold && p.state.CompareAndSwap(cold, compiling) {
+		jit.mu.Lock()
+		jit.stats.HotPathsDetected++
+		jit.mu.Unlock()
+		return nil, true
+	}
+	return nil, false
 }
 
-// analyzeSignature analyzes a function signature for optimization opportunities
-func (jit *JITCompiler) analyzeSignature(signature string) []byte {
-	// Analyze the signature to determine optimal bytecode
-	bytecode := make([]byte, 0, 64)
-	
-	// Pattern matching for common operations
-	if contains(signature, "string") {
-		bytecode = append(bytecode, 0x01) // String load
-	}
-	if contains(signature, "int") {
-		bytecode = append(bytecode, 0x02) // Integer load
+// path returns the state of signature, or nil when MaxPaths are tracked
+func (jit *JITCompiler) path(signature string) *path {
+	if p, ok := jit.paths.Load(signature); ok {
+		return p.(*path)
 	}
-	if contains(signature, "add") || contains(signature, "sum") {
-		bytecode = append(bytecode, 0x03) // Add operation
+	if jit.npaths.Load() >= MaxPaths {
+		return nil
 	}
-	if contains(signature, "multiply") || contains(signature, "product") {
-		bytecode = append(bytecode, 0x04) // Multiply operation
+	p, loaded := jit.paths.LoadOrStore(signature, &path{})
+	if !loaded {
+		jit.npaths.Add(1)
 	}
-	
-	return bytecode
+	return p.(*path)
 }
 
-// executeCompiled executes pre-compiled machine code
-func (jit *JITCompiler) executeCompiled(machineCode []byte, fallback func() interface{}) interface{} {
-	// In a real implementation, this would execute the machine code directly
-	// For now, we'll use the fallback but track that we used compiled code
-	jit.stats.CacheHits++
-	return fallback()
-}
+// Store records the outcome of compiling signature after Lookup asked for
+// it: the compiled form, or err when the path cannot be compiled and
+// keeps being interpreted
+func (jit *JITCompiler) Store(signature string, form interface{}, info CompileInfo, elapsed time.Duration, err error) {
+	v, ok := jit.paths.Load(signature)
+	if !ok {
+		return
+	}
+	p := v.(*path)
 
-// updatePerformanceMetrics updates performance tracking
-func (jit *JITCompiler) updatePerformanceMetrics(hotPath *HotPath, compilationTime time.Duration) {
-	// Calculate performance improvement
-	baselineTime := 100 * time.Microsecond // Estimated baseline
-	improvement := float64(baselineTime) / float64(compilationTime)
-	
 	jit.mu.Lock()
-	jit.stats.PerformanceGain = (jit.stats.PerformanceGain + improvement) / 2
-	hotPath.Performance = improvement
-	jit.mu.Unlock()
+	defer jit.mu.Unlock()
+	p.compileTime = elapsed
+	jit.stats.CompilationTime += elapsed
+	if err != nil {
+		p.err = err.Error()
+		p.state.Store(failed)
+		jit.stats.CompileFailures++
+		return
+	}
+	p.compiledAt = time.Now()
+	p.info = info
+	p.compiled.Store(compiledForm{form})
+	p.state.Store(compiled)
+	jit.stats.TotalCompilations++
+	jit.stats.FoldedConstants += int64(info.FoldedConstants)
+	jit.stats.PrecompiledRegexes += int64(info.PrecompiledRegexes)
 }
 
 // GetStats returns compilation statistics
 func (jit *JITCompiler) GetStats() *CompilationStats {
-	jit.mu.RLock()
-	defer jit.mu.RUnlock()
-	
-	stats := *jit.stats
+	jit.mu.Lock()
+	stats := jit.stats
+	jit.mu.Unlock()
+	stats.Threshold = jit.threshold.Load()
+	stats.CompiledExecutions = jit.hits.Load()
+	stats.InterpretedExecutions = jit.interpreted.Load()
 	return &stats
 }
 
-// GetHotPaths returns information about detected hot paths
-func (jit *JITCompiler) GetHotPaths() map[string]*HotPath {
-	jit.mu.RLock()
-	defer jit.mu.RUnlock()
-	
-	hotPaths := make(map[string]*HotPath)
-	for k, v := range jit.hotPaths {
-		hotPaths[k] = v
-	}
-	return hotPaths
+// GetHotPaths returns the paths that reached the threshold, most executed
+// first
+func (jit *JITCompiler) GetHotPaths() []HotPath {
+	var paths []HotPath
+	jit.mu.Lock()
+	defer jit.mu.Unlock()
+	jit.paths.Range(func(key, value interface{}) bool {
+		p := value.(*path)
+		state := p.state.Load()
+		if state == cold {
+			return true
+		}
+		paths = append(paths, HotPath{
+			Signature:          key.(string),
+			Executions:         p.executions.Load(),
+			CompiledExecutions: p.hits.Load(),
+			State:              stateNames[state],
+			CompiledAt:         p.compiledAt,
+			CompileTime:        p.compileTime,
+			CompileInfo:        p.info,
+			Error:              p.err,
+		})
+		return true
+	})
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].Executions != paths[j].Executions {
+			return paths[i].Executions > paths[j].Executions
+		}
+		return paths[i].Signature < paths[j].Signature
+	})
+	return paths
 }
 
-// ClearCache clears the compiled code cache
+// ClearCache drops every compiled form and execution count, so paths are
+// interpreted until they turn hot again. The totals are kept.
 func (jit *JITCompiler) ClearCache() {
 	jit.mu.Lock()
 	defer jit.mu.Unlock()
-	
-	jit.compiledCode = make(map[string][]byte)
-	for _, hotPath := range jit.hotPaths {
-		hotPath.Compiled = false
-		hotPath.MachineCode = nil
-	}
+	jit.paths.Range(func(key, _ interface{}) bool {
+		jit.paths.Delete(key)
+		return true
+	})
+	jit.npaths.Store(0)
 }
-
-// Utility functions
-func generateID() string {
-	return fmt.Sprintf("jit_%d", time.Now().UnixNano())
-}
-
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || 
-		(len(s) > len(substr) && (s[:len(substr)] == substr || 
-		s[len(s)-len(substr):] == substr || 
-		bytes.Contains([]byte(s), []byte(substr)))))
-} 
\ No newline at end of file
@@ -0,0 +1,80 @@
+package jit
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLookupCompilesOnce(t *testing.T) {
+	jit := NewJITCompiler()
+	jit.SetThreshold(3)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	compiles := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, compile := jit.Lookup("hot"); compile {
+				mu.Lock()
+				compiles++
+				mu.Unlock()
+				jit.Store("hot", "compiled", CompileInfo{FoldedConstants: 2}, time.Millisecond, nil)
+			}
+		}()
+	}
+	wg.Wait()
+	if compiles != 1 {
+		t.Fatalf("asked to compile %d times, want 1", compiles)
+	}
+	if form, compile := jit.Lookup("hot"); form != "compiled" || compile {
+		t.Errorf("Lookup = %v, %v after Store", form, compile)
+	}
+
+	stats := jit.GetStats()
+	if stats.TotalCompilations != 1 || stats.HotPathsDetected != 1 || stats.FoldedConstants != 2 ||
+		stats.CompiledExecutions+stats.InterpretedExecutions != 51 || stats.CompilationTime != time.Millisecond {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCompileFailure(t *testing.T) {
+	jit := NewJITCompiler()
+	jit.SetThreshold(1)
+	jit.Lookup("cold")
+	jit.SetThreshold(2)
+	if _, compile := jit.Lookup("broken"); compile {
+		t.Error("compile requested before the threshold")
+	}
+	if _, compile := jit.Lookup("broken"); !compile {
+		t.Fatal("compile not requested at the threshold")
+	}
+	jit.Store("broken", nil, CompileInfo{}, 0, errors.New("unsupported"))
+	if form, compile := jit.Lookup("broken"); form != nil || compile {
+		t.Errorf("failed path = %v, %v; want it interpreted", form, compile)
+	}
+
+	paths := jit.GetHotPaths()
+	if len(paths) != 2 || paths[0].Signature != "broken" || paths[0].State != StateFailed || paths[0].Error != "unsupported" ||
+		paths[1].State != StateCompiling {
+		t.Errorf("unexpected hot paths %+v", paths)
+	}
+	if stats := jit.GetStats(); stats.CompileFailures != 1 || stats.TotalCompilations != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// A threshold of 0 turns compilation off; clearing forgets the paths
+	jit.ClearCache()
+	jit.SetThreshold(0)
+	for i := 0; i < 5; i++ {
+		if _, compile := jit.Lookup("broken"); compile {
+			t.Fatal("compile requested with compilation off")
+		}
+	}
+	if paths := jit.GetHotPaths(); len(paths) != 0 {
+		t.Errorf("hot paths after ClearCache: %+v", paths)
+	}
+}
@@ -1,413 +0,0 @@
-package jit
-
-import (
-	"bytes"
-	"encoding/binary"
-	"fmt"
-	"sync"
-	"time"
-)
-
-// Optimizer applies advanced optimization strategies to machine code
-type Optimizer struct {
-	mu           sync.RWMutex
-	strategies   map[string]OptimizationStrategy
-	optimizations map[string][]byte
-	stats        *OptimizationStats
-}
-
-// OptimizationStrategy defines an optimization technique
-type OptimizationStrategy struct {
-	Name        string
-	Description string
-	Apply       func([]byte) []byte
-	Priority    int
-	Enabled     bool
-}
-
-// OptimizationStats tracks optimization performance
-type OptimizationStats struct {
-	TotalOptimizations int64
-	StrategiesApplied  int64
-	PerformanceGain    float64
-	OptimizationTime   time.Duration
-	CacheHits          int64
-	CacheMisses        int64
-}
-
-// NewOptimizer creates a new optimizer instance
-func NewOptimizer() *Optimizer {
-	optimizer := &Optimizer{
-		strategies:    make(map[string]OptimizationStrategy),
-		optimizations: make(map[string][]byte),
-		stats:         &OptimizationStats{},
-	}
-	
-	// Register optimization strategies
-	optimizer.registerStrategies()
-	
-	return optimizer
-}
-
-// registerStrategies registers all available optimization strategies
-func (opt *Optimizer) registerStrategies() {
-	strategies := []OptimizationStrategy{
-		{
-			Name:        "loop_optimization",
-			Description: "Optimize loop structures for better performance",
-			Apply:       opt.loopOptimization,
-			Priority:    1,
-			Enabled:     true,
-		},
-		{
-			Name:        "function_inlining",
-			Description: "Inline small functions to reduce call overhead",
-			Apply:       opt.functionInlining,
-			Priority:    2,
-			Enabled:     true,
-		},
-		{
-			Name:        "dead_code_elimination",
-			Description: "Remove unreachable or unused code",
-			Apply:       opt.deadCodeElimination,
-			Priority:    3,
-			Enabled:     true,
-		},
-		{
-			Name:        "constant_folding",
-			Description: "Evaluate constant expressions at compile time",
-			Apply:       opt.constantFolding,
-			Priority:    4,
-			Enabled:     true,
-		},
-		{
-			Name:        "strength_reduction",
-			Description: "Replace expensive operations with cheaper equivalents",
-			Apply:       opt.strengthReduction,
-			Priority:    5,
-			Enabled:     true,
-		},
-		{
-			Name:        "vectorization",
-			Description: "Apply SIMD optimizations where possible",
-			Apply:       opt.vectorization,
-			Priority:    6,
-			Enabled:     true,
-		},
-		{
-			Name:        "memory_access_optimization",
-			Description: "Optimize memory access patterns",
-			Apply:       opt.memoryAccessOptimization,
-			Priority:    7,
-			Enabled:     true,
-		},
-		{
-			Name:        "branch_prediction",
-			Description: "Optimize branch prediction for better CPU utilization",
-			Apply:       opt.branchPrediction,
-			Priority:    8,
-			Enabled:     true,
-		},
-	}
-	
-	for _, strategy := range strategies {
-		opt.strategies[strategy.Name] = strategy
-	}
-}
-
-// Optimize applies all enabled optimization strategies to the given code
-func (opt *Optimizer) Optimize(code []byte) []byte {
-	start := time.Now()
-	
-	// Check if we have a cached optimization
-	opt.mu.RLock()
-	if cached, exists := opt.optimizations[string(code)]; exists {
-		opt.stats.CacheHits++
-		opt.mu.RUnlock()
-		return cached
-	}
-	opt.mu.RUnlock()
-	
-	opt.stats.CacheMisses++
-	
-	// Apply optimizations in priority order
-	optimizedCode := make([]byte, len(code))
-	copy(optimizedCode, code)
-	
-	// Sort strategies by priority
-	sortedStrategies := opt.getSortedStrategies()
-	
-	for _, strategy := range sortedStrategies {
-		if strategy.Enabled {
-			optimizedCode = strategy.Apply(optimizedCode)
-			opt.stats.StrategiesApplied++
-		}
-	}
-	
-	// Cache the optimization result
-	opt.mu.Lock()
-	opt.optimizations[string(code)] = optimizedCode
-	opt.stats.TotalOptimizations++
-	opt.mu.Unlock()
-	
-	optimizationTime := time.Since(start)
-	opt.stats.OptimizationTime += optimizationTime
-	
-	// Calculate performance gain
-	performanceGain := opt.calculatePerformanceGain(code, optimizedCode)
-	opt.stats.PerformanceGain = (opt.stats.PerformanceGain + performanceGain) / 2
-	
-	return optimizedCode
-}
-
-// getSortedStrategies returns strategies sorted by priority
-func (opt *Optimizer) getSortedStrategies() []OptimizationStrategy {
-	var strategies []OptimizationStrategy
-	for _, strategy := range opt.strategies {
-		strategies = append(strategies, strategy)
-	}
-	
-	// Sort by priority (lower number = higher priority)
-	for i := 0; i < len(strategies)-1; i++ {
-		for j := i + 1; j < len(strategies); j++ {
-			if strategies[i].Priority > strategies[j].Priority {
-				strategies[i], strategies[j] = strategies[j], strategies[i]
-			}
-		}
-	}
-	
-	return strategies
-}
-
-// loopOptimization optimizes loop structures
-func (opt *Optimizer) loopOptimization(code []byte) []byte {
-	// Detect loop patterns and optimize them
-	optimized := make([]byte, 0, len(code))
-	
-	for i := 0; i < len(code); i++ {
-		// Look for loop patterns (simplified)
-		if i+3 < len(code) && code[i] == 0x48 && code[i+1] == 0x89 {
-			// Potential loop start - optimize
-			optimized = append(optimized, 0x48, 0x89, 0x90) // Optimized loop instruction
-			i += 2 // Skip the next two bytes
-		} else {
-			optimized = append(optimized, code[i])
-		}
-	}
-	
-	return optimized
-}
-
-// functionInlining inlines small functions
-func (opt *Optimizer) functionInlining(code []byte) []byte {
-	// Detect function call patterns and inline small functions
-	optimized := make([]byte, 0, len(code))
-	
-	for i := 0; i < len(code); i++ {
-		// Look for function call patterns (simplified)
-		if i+2 < len(code) && code[i] == 0xE8 {
-			// Function call - check if it's small enough to inline
-			if i+10 < len(code) {
-				// Assume small function - inline it
-				optimized = append(optimized, 0x90, 0x90, 0x90) // Inlined function body
-				i += 2 // Skip the call instruction
-			} else {
-				optimized = append(optimized, code[i])
-			}
-		} else {
-			optimized = append(optimized, code[i])
-		}
-	}
-	
-	return optimized
-}
-
-// deadCodeElimination removes unreachable code
-func (opt *Optimizer) deadCodeElimination(code []byte) []byte {
-	// Remove unreachable code blocks
-	optimized := make([]byte, 0, len(code))
-	
-	for i := 0; i < len(code); i++ {
-		// Look for unreachable code patterns (simplified)
-		if i+1 < len(code) && code[i] == 0x90 && code[i+1] == 0x90 {
-			// Potential unreachable code - skip it
-			i++ // Skip the next byte
-		} else {
-			optimized = append(optimized, code[i])
-		}
-	}
-	
-	return optimized
-}
-
-// constantFolding evaluates constant expressions
-func (opt *Optimizer) constantFolding(code []byte) []byte {
-	// Evaluate constant expressions at compile time
-	optimized := make([]byte, 0, len(code))
-	
-	for i := 0; i < len(code); i++ {
-		// Look for constant expression patterns (simplified)
-		if i+3 < len(code) && code[i] == 0x48 && code[i+1] == 0x01 {
-			// Potential constant expression - fold it
-			optimized = append(optimized, 0x48, 0xB8) // Load immediate
-			optimized = append(optimized, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00) // Constant value
-			i += 2 // Skip the original instruction
-		} else {
-			optimized = append(optimized, code[i])
-		}
-	}
-	
-	return optimized
-}
-
-// strengthReduction replaces expensive operations
-func (opt *Optimizer) strengthReduction(code []byte) []byte {
-	// Replace expensive operations with cheaper equivalents
-	optimized := make([]byte, 0, len(code))
-	
-	for i := 0; i < len(code); i++ {
-		// Look for expensive operations (simplified)
-		if i+2 < len(code) && code[i] == 0x48 && code[i+1] == 0x0F {
-			// Expensive multiplication - replace with shift
-			optimized = append(optimized, 0x48, 0xD1) // Shift left
-			i++ // Skip the next byte
-		} else {
-			optimized = append(optimized, code[i])
-		}
-	}
-	
-	return optimized
-}
-
-// vectorization applies SIMD optimizations
-func (opt *Optimizer) vectorization(code []byte) []byte {
-	// Apply SIMD optimizations where possible
-	optimized := make([]byte, 0, len(code))
-	
-	for i := 0; i < len(code); i++ {
-		// Look for vectorizable patterns (simplified)
-		if i+7 < len(code) && code[i] == 0x48 && code[i+1] == 0x01 {
-			// Potential vector operation - apply SIMD
-			optimized = append(optimized, 0xC5, 0xF9, 0x58) // VPADD instruction
-			i += 2 // Skip the original instruction
-		} else {
-			optimized = append(optimized, code[i])
-		}
-	}
-	
-	return optimized
-}
-
-// memoryAccessOptimization optimizes memory access patterns
-func (opt *Optimizer) memoryAccessOptimization(code []byte) []byte {
-	// Optimize memory access for better cache utilization
-	optimized := make([]byte, 0, len(code))
-	
-	for i := 0; i < len(code); i++ {
-		// Look for memory access patterns (simplified)
-		if i+2 < len(code) && code[i] == 0x48 && code[i+1] == 0x8B {
-			// Memory load - optimize access pattern
-			optimized = append(optimized, 0x48, 0x8B, 0x90) // Optimized load
-			i++ // Skip the next byte
-		} else {
-			optimized = append(optimized, code[i])
-		}
-	}
-	
-	return optimized
-}
-
-// branchPrediction optimizes branch prediction
-func (opt *Optimizer) branchPrediction(code []byte) []byte {
-	// Optimize branch prediction for better CPU utilization
-	optimized := make([]byte, 0, len(code))
-	
-	for i := 0; i < len(code); i++ {
-		// Look for branch patterns (simplified)
-		if i+1 < len(code) && code[i] == 0x75 {
-			// Conditional branch - optimize prediction
-			optimized = append(optimized, 0x0F, 0x84) // Optimized branch
-			i++ // Skip the next byte
-		} else {
-			optimized = append(optimized, code[i])
-		}
-	}
-	
-	return optimized
-}
-
-// calculatePerformanceGain calculates the performance improvement
-func (opt *Optimizer) calculatePerformanceGain(original, optimized []byte) float64 {
-	// Calculate improvement based on code size and complexity
-	originalSize := len(original)
-	optimizedSize := len(optimized)
-	
-	if originalSize == 0 {
-		return 1.0
-	}
-	
-	// Size reduction contributes to performance
-	sizeImprovement := float64(originalSize) / float64(optimizedSize)
-	
-	// Instruction count reduction
-	instructionReduction := opt.countInstructions(original) / opt.countInstructions(optimized)
-	
-	// Combined performance gain
-	return (sizeImprovement + instructionReduction) / 2.0
-}
-
-// countInstructions counts the number of instructions in the code
-func (opt *Optimizer) countInstructions(code []byte) float64 {
-	count := 0
-	for i := 0; i < len(code); i++ {
-		if code[i] == 0x48 || code[i] == 0x0F || code[i] == 0xC5 {
-			count++
-		}
-	}
-	return float64(count)
-}
-
-// GetStats returns optimization statistics
-func (opt *Optimizer) GetStats() *OptimizationStats {
-	opt.mu.RLock()
-	defer opt.mu.RUnlock()
-	
-	stats := *opt.stats
-	return &stats
-}
-
-// EnableStrategy enables a specific optimization strategy
-func (opt *Optimizer) EnableStrategy(name string) error {
-	opt.mu.Lock()
-	defer opt.mu.Unlock()
-	
-	if strategy, exists := opt.strategies[name]; exists {
-		strategy.Enabled = true
-		opt.strategies[name] = strategy
-		return nil
-	}
-	
-	return fmt.Errorf("strategy %s not found", name)
-}
-
-// DisableStrategy disables a specific optimization strategy
-func (opt *Optimizer) DisableStrategy(name string) error {
-	opt.mu.Lock()
-	defer opt.mu.Unlock()
-	
-	if strategy, exists := opt.strategies[name]; exists {
-		strategy.Enabled = false
-		opt.strategies[name] = strategy
-		return nil
-	}
-	
-	return fmt.Errorf("strategy %s not found", name)
-}
-
-// ClearCache clears the optimization cache
-func (opt *Optimizer) ClearCache() {
-	opt.mu.Lock()
-	defer opt.mu.Unlock()
-	
-	opt.optimizations = make(map[string][]byte)
-} 
\ No newline at end of file
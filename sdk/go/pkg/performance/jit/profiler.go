@@ -2,6 +2,7 @@ package jit
 
 import (
 	"fmt"
+	"os"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
@@ -20,27 +21,28 @@ type Profiler struct {
 
 // ProfileData contains profiling information for a specific function or path
 type ProfileData struct {
-	ID              string
-	Name            string
-	CallCount       int64
-	TotalTime       time.Duration
-	AverageTime     time.Duration
-	MinTime         time.Duration
-	MaxTime         time.Duration
-	MemoryUsage     uint64
-	CPUUsage        float64
-	GoroutineCount  int
-	HotPath         bool
+	ID                string
+	Name              string
+	CallCount         int64
+	TotalTime         time.Duration
+	AverageTime       time.Duration
+	MinTime           time.Duration
+	MaxTime           time.Duration
+	MemoryUsage       uint64
+	CPUUsage          float64
+	GoroutineCount    int
+	HotPath           bool
 	OptimizationScore float64
-	LastProfile     time.Time
+	LastProfile       time.Time
 }
 
 // traceData tracks active trace sessions
 type traceData struct {
-	ID       string
-	Start    time.Time
-	File     string
-	Enabled  bool
+	ID      string
+	Start   time.Time
+	File    string
+	Enabled bool
+	out     *os.File
 }
 
 // ProfilerStats tracks overall profiler performance
@@ -73,9 +75,9 @@ func (p *Profiler) StartProfile(id, name string) *ProfileSession {
 	profile, exists := p.profiles[id]
 	if !exists {
 		profile = &ProfileData{
-			ID:         id,
-			Name:       name,
-			MinTime:    time.Hour, // Initialize to a large value
+			ID:          id,
+			Name:        name,
+			MinTime:     time.Hour, // Initialize to a large value
 			LastProfile: time.Now(),
 		}
 		p.profiles[id] = profile
@@ -106,41 +108,41 @@ func (ps *ProfileSession) End() {
 	}
 
 	duration := time.Since(ps.start)
-	
+
 	ps.profiler.mu.Lock()
 	defer ps.profiler.mu.Unlock()
-	
+
 	profile, exists := ps.profiler.profiles[ps.id]
 	if !exists {
 		return
 	}
-	
+
 	// Update profile statistics
 	profile.CallCount++
 	profile.TotalTime += duration
 	profile.AverageTime = profile.TotalTime / time.Duration(profile.CallCount)
-	
+
 	if duration < profile.MinTime {
 		profile.MinTime = duration
 	}
 	if duration > profile.MaxTime {
 		profile.MaxTime = duration
 	}
-	
+
 	// Update memory usage
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 	profile.MemoryUsage = m.Alloc
-	
+
 	// Update goroutine count
 	profile.GoroutineCount = runtime.NumGoroutine()
-	
+
 	// Check if this is a hot path
 	if profile.CallCount >= 100 && !profile.HotPath {
 		profile.HotPath = true
 		ps.profiler.stats.HotPathsDetected++
 	}
-	
+
 	// Calculate optimization score
 	profile.OptimizationScore = ps.calculateOptimizationScore(profile)
 	profile.LastProfile = time.Now()
@@ -149,9 +151,9 @@ func (ps *ProfileSession) End() {
 // calculateOptimizationScore calculates how much optimization potential exists
 func (ps *ProfileSession) calculateOptimizationScore(profile *ProfileData) float64 {
 	// Base score on call frequency and execution time
-	frequencyScore := float64(profile.CallCount) / 1000.0 // Normalize to 0-1
+	frequencyScore := float64(profile.CallCount) / 1000.0                 // Normalize to 0-1
 	timeScore := float64(profile.AverageTime) / float64(time.Millisecond) // Normalize to ms
-	
+
 	// Higher scores for frequently called, slow functions
 	return frequencyScore * timeScore
 }
@@ -164,26 +166,32 @@ func (p *Profiler) StartTrace(id string) error {
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	
+
 	if _, exists := p.activeTraces[id]; exists {
 		return fmt.Errorf("trace %s already active", id)
 	}
-	
-	traceFile := fmt.Sprintf("/tmp/tusk_jit_trace_%s.trace", id)
-	
+
+	traceFile := fmt.Sprintf("%s/tusk_jit_trace_%s.trace", os.TempDir(), id)
+	out, err := os.Create(traceFile)
+	if err != nil {
+		return fmt.Errorf("failed to start trace: %v", err)
+	}
+
 	// Start trace
-	if err := trace.Start(traceFile); err != nil {
+	if err := trace.Start(out); err != nil {
+		out.Close()
 		return fmt.Errorf("failed to start trace: %v", err)
 	}
-	
+
 	p.activeTraces[id] = &traceData{
 		ID:      id,
 		Start:   time.Now(),
 		File:    traceFile,
 		Enabled: true,
+		out:     out,
 	}
 	p.stats.ActiveTraces++
-	
+
 	return nil
 }
 
@@ -195,22 +203,23 @@ func (p *Profiler) StopTrace(id string) error {
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	
+
 	traceData, exists := p.activeTraces[id]
 	if !exists {
 		return fmt.Errorf("trace %s not found", id)
 	}
-	
+
 	// Stop trace
 	trace.Stop()
-	
+	traceData.out.Close()
+
 	// Update statistics
 	p.stats.ActiveTraces--
 	p.stats.ProfilingTime += time.Since(traceData.Start)
-	
+
 	// Remove from active traces
 	delete(p.activeTraces, id)
-	
+
 	return nil
 }
 
@@ -219,12 +228,16 @@ func (p *Profiler) StartCPUProfile(filename string) error {
 	if !p.enabled {
 		return nil
 	}
-	
-	file, err := pprof.StartCPUProfile(filename)
+
+	file, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("failed to start CPU profile: %v", err)
 	}
-	
+	if err := pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to start CPU profile: %v", err)
+	}
+
 	// Store file reference for cleanup
 	p.mu.Lock()
 	p.activeTraces["cpu_profile"] = &traceData{
@@ -232,9 +245,10 @@ func (p *Profiler) StartCPUProfile(filename string) error {
 		Start:   time.Now(),
 		File:    filename,
 		Enabled: true,
+		out:     file,
 	}
 	p.mu.Unlock()
-	
+
 	return nil
 }
 
@@ -243,10 +257,13 @@ func (p *Profiler) StopCPUProfile() {
 	if !p.enabled {
 		return
 	}
-	
+
 	pprof.StopCPUProfile()
-	
+
 	p.mu.Lock()
+	if profile, ok := p.activeTraces["cpu_profile"]; ok {
+		profile.out.Close()
+	}
 	delete(p.activeTraces, "cpu_profile")
 	p.mu.Unlock()
 }
@@ -256,21 +273,15 @@ func (p *Profiler) StartMemoryProfile(filename string) error {
 	if !p.enabled {
 		return nil
 	}
-	
-	file, err := pprof.WriteHeapProfile(filename)
+
+	file, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("failed to write memory profile: %v", err)
 	}
-	
-	p.mu.Lock()
-	p.activeTraces["memory_profile"] = &traceData{
-		ID:      "memory_profile",
-		Start:   time.Now(),
-		File:    filename,
-		Enabled: true,
+	defer file.Close()
+	if err := pprof.WriteHeapProfile(file); err != nil {
+		return fmt.Errorf("failed to write memory profile: %v", err)
 	}
-	p.mu.Unlock()
-	
 	return nil
 }
 
@@ -278,14 +289,14 @@ func (p *Profiler) StartMemoryProfile(filename string) error {
 func (p *Profiler) GetHotPaths() []*ProfileData {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	
+
 	var hotPaths []*ProfileData
 	for _, profile := range p.profiles {
 		if profile.HotPath {
 			hotPaths = append(hotPaths, profile)
 		}
 	}
-	
+
 	return hotPaths
 }
 
@@ -293,14 +304,14 @@ func (p *Profiler) GetHotPaths() []*ProfileData {
 func (p *Profiler) GetOptimizationCandidates(threshold float64) []*ProfileData {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	
+
 	var candidates []*ProfileData
 	for _, profile := range p.profiles {
 		if profile.OptimizationScore >= threshold {
 			candidates = append(candidates, profile)
 		}
 	}
-	
+
 	return candidates
 }
 
@@ -308,7 +319,7 @@ func (p *Profiler) GetOptimizationCandidates(threshold float64) []*ProfileData {
 func (p *Profiler) GetProfile(id string) (*ProfileData, bool) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	
+
 	profile, exists := p.profiles[id]
 	return profile, exists
 }
@@ -317,12 +328,12 @@ func (p *Profiler) GetProfile(id string) (*ProfileData, bool) {
 func (p *Profiler) GetAllProfiles() map[string]*ProfileData {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	
+
 	profiles := make(map[string]*ProfileData)
 	for k, v := range p.profiles {
 		profiles[k] = v
 	}
-	
+
 	return profiles
 }
 
@@ -330,7 +341,7 @@ func (p *Profiler) GetAllProfiles() map[string]*ProfileData {
 func (p *Profiler) GetStats() *ProfilerStats {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	
+
 	stats := *p.stats
 	return &stats
 }
@@ -353,7 +364,7 @@ func (p *Profiler) Disable() {
 func (p *Profiler) Clear() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	
+
 	p.profiles = make(map[string]*ProfileData)
 	p.stats = &ProfilerStats{}
 }
@@ -368,9 +379,9 @@ func (p *Profiler) GetMemoryStats() runtime.MemStats {
 // GetGoroutineStats returns goroutine statistics
 func (p *Profiler) GetGoroutineStats() map[string]interface{} {
 	return map[string]interface{}{
-		"count": runtime.NumGoroutine(),
+		"count":     runtime.NumGoroutine(),
 		"cpu_count": runtime.NumCPU(),
-		"version": runtime.Version(),
+		"version":   runtime.Version(),
 	}
 }
 
@@ -378,7 +389,7 @@ func (p *Profiler) GetGoroutineStats() map[string]interface{} {
 func (p *Profiler) ProfileFunction(id, name string, fn func() interface{}) interface{} {
 	session := p.StartProfile(id, name)
 	defer session.End()
-	
+
 	return fn()
 }
 
@@ -386,6 +397,6 @@ func (p *Profiler) ProfileFunction(id, name string, fn func() interface{}) inter
 func (p *Profiler) ProfileFunctionWithArgs(id, name string, fn func(args ...interface{}) interface{}, args ...interface{}) interface{} {
 	session := p.StartProfile(id, name)
 	defer session.End()
-	
+
 	return fn(args...)
-} 
\ No newline at end of file
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScratchReuse(t *testing.T) {
+	s := NewScratch()
+	for i := 0; i < 100; i++ {
+		tokens := s.Tokens()
+		if len(*tokens) != 0 {
+			t.Fatalf("Tokens() returned %d tokens, want none", len(*tokens))
+		}
+		*tokens = append(*tokens, "a", "b")
+		s.PutTokens(tokens)
+
+		buffer := s.Builder()
+		if buffer.Length() != 0 {
+			t.Fatalf("Builder() returned %q, want it empty", buffer.String())
+		}
+		buffer.WriteString("database.host")
+		s.PutBuilder(buffer)
+
+		set := s.Set()
+		if len(set) != 0 {
+			t.Fatalf("Set() returned %v, want it empty", set)
+		}
+		set["env"] = true
+		s.PutSet(set)
+	}
+
+	stats := s.Stats()
+	if stats.TotalPools != 3 || stats.TotalAllocated != 300 || stats.TotalFreed != 300 {
+		t.Errorf("Stats() = %+v, want 300 gets and puts over 3 pools", stats)
+	}
+	// sync.Pool may drop objects at a collection, so a few misses are fine
+	for kind, k := range stats.Kinds {
+		if k.TotalAllocated != 100 || k.HitRate < 0.5 || k.TotalReused+k.TotalCreated != k.TotalAllocated {
+			t.Errorf("%s: %+v, want most of 100 gets to hit", kind, k)
+		}
+	}
+}
+
+func TestScratchDropsOversized(t *testing.T) {
+	s := NewScratch()
+	tokens := s.Tokens()
+	*tokens = make([]string, maxPooledTokens+1)
+	s.PutTokens(tokens)
+	set := s.Set()
+	for i := 0; i <= maxPooledSet; i++ {
+		set[string(rune('a'+i%26))+string(rune(i))] = true
+	}
+	s.PutSet(set)
+	if stats := s.Stats(); stats.TotalFreed != 0 {
+		t.Errorf("oversized objects were pooled: %+v", stats)
+	}
+}
+
+func TestPoolStatsIncludeParser(t *testing.T) {
+	pool := NewPool(&PoolConfig{MaxPoolSize: 10, CleanupInterval: time.Minute})
+	defer pool.Stop()
+	pool.PutBytes(pool.GetBytes(64))
+	pool.GetBytes(64)
+
+	tokens := Parser.Tokens()
+	Parser.PutTokens(tokens)
+	parser := Parser.Stats()
+
+	stats := pool.GetStats()
+	if stats.TotalAllocated != 2+parser.TotalAllocated || stats.TotalReused != 1+parser.TotalReused {
+		t.Errorf("GetStats() = %+v, want the byte pool's 2 gets plus the parser's %+v", stats, parser)
+	}
+	if stats.Kinds["tokens"] == nil || stats.HitRate != float64(stats.TotalReused)/float64(stats.TotalAllocated) {
+		t.Errorf("GetStats() = %+v, want the parser kinds and a hit rate over both", stats)
+	}
+}
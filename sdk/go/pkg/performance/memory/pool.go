@@ -1,12 +1,9 @@
 package memory
 
 import (
-	"encoding/binary"
-	"fmt"
 	"runtime"
 	"sync"
 	"time"
-	"unsafe"
 )
 
 // Pool provides object pooling for memory optimization
@@ -43,6 +40,29 @@ type PoolStats struct {
 	MemoryUsage    uint64
 	HitRate        float64
 	Efficiency     float64
+	// Kinds breaks the parser scratch pools down by kind of object
+	Kinds          map[string]*PoolStats
+}
+
+// add adds the counters of other to s
+func (s *PoolStats) add(other *PoolStats) {
+	s.TotalPools += other.TotalPools
+	s.TotalObjects += other.TotalObjects
+	s.TotalCreated += other.TotalCreated
+	s.TotalReused += other.TotalReused
+	s.TotalAllocated += other.TotalAllocated
+	s.TotalFreed += other.TotalFreed
+	s.MemoryUsage += other.MemoryUsage
+}
+
+// rates derives HitRate and Efficiency from the counters
+func (s *PoolStats) rates() {
+	if s.TotalAllocated > 0 {
+		s.HitRate = float64(s.TotalReused) / float64(s.TotalAllocated)
+	}
+	if total := s.TotalCreated + s.TotalReused; total > 0 {
+		s.Efficiency = float64(s.TotalReused) / float64(total)
+	}
 }
 
 // PoolConfig defines pool configuration
@@ -240,7 +260,8 @@ func (op *ObjectPool) Put(obj interface{}) {
 	}
 }
 
-// GetStats returns pool statistics
+// GetStats returns pool statistics, including those of the Parser scratch
+// pools the parsers draw from
 func (p *Pool) GetStats() *PoolStats {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -258,21 +279,16 @@ func (p *Pool) GetStats() *PoolStats {
 		pool.mu.Unlock()
 	}
 	
-	// Calculate hit rate
-	total := stats.TotalAllocated
-	if total > 0 {
-		stats.HitRate = float64(stats.TotalReused) / float64(total)
-	}
-	
-	// Calculate efficiency
-	totalObjects := stats.TotalCreated + stats.TotalReused
-	if totalObjects > 0 {
-		stats.Efficiency = float64(stats.TotalReused) / float64(totalObjects)
-	}
-	
 	// Calculate memory usage
 	stats.MemoryUsage = p.calculateMemoryUsage()
 	
+	parser := Parser.Stats()
+	stats.add(parser)
+	stats.Kinds = parser.Kinds
+	
+	// Calculate hit rate and efficiency
+	stats.rates()
+	
 	return &stats
 }
 
@@ -313,7 +329,7 @@ func (p *Pool) cleanup() {
 	
 	now := time.Now()
 	
-	for size, pool := range p.pools {
+	for _, pool := range p.pools {
 		pool.mu.Lock()
 		
 		// Remove objects that haven't been accessed recently
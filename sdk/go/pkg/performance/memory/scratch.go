@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Objects grown past these sizes are left to the garbage collector rather
+// than pooled, so one large file does not pin its temporaries
+const (
+	maxPooledTokens  = 1 << 16
+	maxPooledBuilder = 64 << 10
+	maxPooledSet     = 1 << 10
+)
+
+// Scratch pools the temporaries of the parsers: token slices, string
+// builders and scratch sets. Each kind is a sync.Pool, so idle objects are
+// released by the garbage collector, and counts its gets and misses for
+// PoolStats.
+type Scratch struct {
+	tokens   scratchPool
+	builders scratchPool
+	sets     scratchPool
+}
+
+// Parser is the scratch space the TSK and operator expression parsers draw
+// from; Pool.GetStats includes its statistics
+var Parser = NewScratch()
+
+// NewScratch creates an empty set of scratch pools
+func NewScratch() *Scratch {
+	return &Scratch{}
+}
+
+// scratchPool is a sync.Pool that counts how often it had an object
+type scratchPool struct {
+	pool   sync.Pool
+	gets   atomic.Int64
+	misses atomic.Int64
+	puts   atomic.Int64
+}
+
+func (p *scratchPool) get() interface{} {
+	p.gets.Add(1)
+	obj := p.pool.Get()
+	if obj == nil {
+		p.misses.Add(1)
+	}
+	return obj
+}
+
+func (p *scratchPool) put(obj interface{}) {
+	p.puts.Add(1)
+	p.pool.Put(obj)
+}
+
+// stats reports the pool's counters. sync.Pool does not tell how many idle
+// objects it holds, so TotalObjects and MemoryUsage stay zero.
+func (p *scratchPool) stats() *PoolStats {
+	gets, misses := p.gets.Load(), p.misses.Load()
+	stats := &PoolStats{
+		TotalPools:     1,
+		TotalCreated:   misses,
+		TotalReused:    gets - misses,
+		TotalAllocated: gets,
+		TotalFreed:     p.puts.Load(),
+	}
+	stats.rates()
+	return stats
+}
+
+// Tokens returns an empty token slice; PutTokens returns it once the parse
+// is done with it
+func (s *Scratch) Tokens() *[]string {
+	if tokens, ok := s.tokens.get().(*[]string); ok {
+		return tokens
+	}
+	tokens := make([]string, 0, 64)
+	return &tokens
+}
+
+// PutTokens returns a token slice to the pool. The strings it held are
+// cleared so the pool does not keep the parsed content alive.
+func (s *Scratch) PutTokens(tokens *[]string) {
+	if cap(*tokens) > maxPooledTokens {
+		return
+	}
+	clear((*tokens)[:cap(*tokens)])
+	*tokens = (*tokens)[:0]
+	s.tokens.put(tokens)
+}
+
+// Builder returns an empty string buffer; its String copies, so the result
+// outlives PutBuilder
+func (s *Scratch) Builder() *StringBuffer {
+	if buffer, ok := s.builders.get().(*StringBuffer); ok {
+		return buffer
+	}
+	return NewStringBuffer(128)
+}
+
+// PutBuilder returns a string buffer to the pool
+func (s *Scratch) PutBuilder(buffer *StringBuffer) {
+	if buffer.Capacity() > maxPooledBuilder {
+		return
+	}
+	buffer.Reset()
+	s.builders.put(buffer)
+}
+
+// Set returns an empty set, such as the names a parser has seen
+func (s *Scratch) Set() map[string]bool {
+	if set, ok := s.sets.get().(map[string]bool); ok {
+		return set
+	}
+	return make(map[string]bool)
+}
+
+// PutSet returns a set to the pool
+func (s *Scratch) PutSet(set map[string]bool) {
+	if len(set) > maxPooledSet {
+		return
+	}
+	clear(set)
+	s.sets.put(set)
+}
+
+// Stats returns the totals of the scratch pools, with each kind of object
+// under Kinds
+func (s *Scratch) Stats() *PoolStats {
+	stats := &PoolStats{Kinds: map[string]*PoolStats{
+		"tokens":   s.tokens.stats(),
+		"builders": s.builders.stats(),
+		"sets":     s.sets.stats(),
+	}}
+	for _, kind := range stats.Kinds {
+		stats.add(kind)
+	}
+	stats.rates()
+	return stats
+}
+
+// Since returns the counters of s accumulated after earlier, both taken
+// from Stats, with the rates over that period
+func (s *PoolStats) Since(earlier *PoolStats) *PoolStats {
+	stats := &PoolStats{
+		TotalPools:     s.TotalPools,
+		TotalCreated:   s.TotalCreated - earlier.TotalCreated,
+		TotalReused:    s.TotalReused - earlier.TotalReused,
+		TotalAllocated: s.TotalAllocated - earlier.TotalAllocated,
+		TotalFreed:     s.TotalFreed - earlier.TotalFreed,
+	}
+	if s.Kinds != nil {
+		stats.Kinds = make(map[string]*PoolStats, len(s.Kinds))
+		for kind, k := range s.Kinds {
+			if before, ok := earlier.Kinds[kind]; ok {
+				k = k.Since(before)
+			}
+			stats.Kinds[kind] = k
+		}
+	}
+	stats.rates()
+	return stats
+}
@@ -0,0 +1,161 @@
+package profiling
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds are the profiles Capture takes. cpu and trace sample for the
+// duration asked for; the others are snapshots.
+var Kinds = []string{"cpu", "heap", "allocs", "goroutine", "block", "mutex", "threadcreate", "trace"}
+
+// FileName is the default file for a profile of kind
+func FileName(kind string) string {
+	if kind == "trace" {
+		return "trace.out"
+	}
+	return kind + ".pb.gz"
+}
+
+// Capture fetches a profile of kind from the endpoints at base, a URL
+// ending in Prefix, and copies it to w. The request lasts duration for cpu
+// and trace, so ctx should allow for it.
+func Capture(ctx context.Context, client *http.Client, base, kind string, duration time.Duration, token string, w io.Writer) error {
+	seconds := wholeSeconds(duration)
+	var path string
+	switch kind {
+	case "cpu":
+		path = "profile?seconds=" + seconds
+	case "trace":
+		path = "trace?seconds=" + seconds
+	case "heap":
+		// Collect garbage first so the profile shows live memory
+		path = "heap?gc=1"
+	default:
+		known := false
+		for _, k := range Kinds {
+			known = known || k == kind
+		}
+		if !known {
+			return fmt.Errorf("unknown profile %q (supported: %s)", kind, strings.Join(Kinds, ", "))
+		}
+		path = kind
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+"/"+path, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to capture %s profile: %w", kind, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to capture %s profile: %s: %s", kind, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to capture %s profile: %w", kind, err)
+	}
+	return nil
+}
+
+// wholeSeconds rounds d up to whole seconds, at least one, as the
+// endpoints take them
+func wholeSeconds(d time.Duration) string {
+	return fmt.Sprint(max(1, int(math.Ceil(d.Seconds()))))
+}
+
+// Continuous writes a CPU profile sampled for opts.CPUDuration and a heap
+// profile to opts.Dir every opts.Interval until ctx is done, keeping the
+// newest opts.Keep of each. report receives failures, such as a CPU profile
+// already being taken through the endpoints; nil ignores them.
+func Continuous(ctx context.Context, opts Options, report func(error)) {
+	if report == nil {
+		report = func(error) {}
+	}
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := snapshot(ctx, opts, now); err != nil {
+				report(err)
+			}
+		}
+	}
+}
+
+// snapshot writes one CPU and one heap profile named after now
+func snapshot(ctx context.Context, opts Options, now time.Time) error {
+	if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", opts.Dir, err)
+	}
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	heap := filepath.Join(opts.Dir, "heap-"+stamp+".pb.gz")
+	if err := writeProfile(heap, func(w io.Writer) error { return pprof.Lookup("heap").WriteTo(w, 0) }); err != nil {
+		return err
+	}
+	cpu := filepath.Join(opts.Dir, "cpu-"+stamp+".pb.gz")
+	err := writeProfile(cpu, func(w io.Writer) error {
+		if err := pprof.StartCPUProfile(w); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(opts.CPUDuration):
+		}
+		pprof.StopCPUProfile()
+		return nil
+	})
+	for _, kind := range []string{"heap", "cpu"} {
+		prune(opts.Dir, kind, opts.Keep)
+	}
+	return err
+}
+
+// writeProfile writes file with write, removing it when that fails
+func writeProfile(file string, write func(io.Writer) error) error {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file)
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(file), err)
+	}
+	return nil
+}
+
+// prune removes all but the newest keep profiles of kind in dir
+func prune(dir, kind string, keep int) {
+	files, err := filepath.Glob(filepath.Join(dir, kind+"-*.pb.gz"))
+	if err != nil || len(files) <= keep {
+		return
+	}
+	// Timestamps in the names sort chronologically
+	sort.Strings(files)
+	for _, file := range files[:len(files)-keep] {
+		os.Remove(file)
+	}
+}
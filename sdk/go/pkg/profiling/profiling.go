@@ -0,0 +1,200 @@
+// Package profiling exposes the net/http/pprof endpoints, runtime/trace
+// included, of the long-running tsk processes and captures profiles from
+// them. It is configured by the [observability.profiling] section:
+//
+//	[observability.profiling]
+//	enabled: true
+//	addr: "localhost:6060"   # own listener; empty mounts on the server's
+//	token: @env("PROFILING_TOKEN")
+//	dir: "/var/lib/app/profiles"   # continuous profiles, with interval
+//	interval: "10m"
+//	keep: 24
+//
+// Profiling is off unless enabled is true.
+package profiling
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix is where the endpoints are served, as net/http/pprof does
+const Prefix = "/debug/pprof/"
+
+// Options is the [observability.profiling] section of a configuration
+type Options struct {
+	Enabled bool
+	// Addr serves the endpoints on a listener of their own, such as
+	// localhost:6060; empty mounts them under Prefix on the server's
+	Addr string
+	// Token, when set, is required as "Authorization: Bearer <token>"
+	Token string
+	// Dir, when set, receives a CPU and a heap profile every Interval
+	Dir      string
+	Interval time.Duration
+	// CPUDuration is how long each continuous CPU profile samples
+	CPUDuration time.Duration
+	// Keep is how many continuous profiles of each kind Dir holds
+	Keep int
+}
+
+// DefaultOptions leaves profiling off; once enabled, continuous profiles
+// are taken every 10 minutes and the newest 24 of each kind kept
+func DefaultOptions() Options {
+	return Options{Interval: 10 * time.Minute, CPUDuration: 10 * time.Second, Keep: 24}
+}
+
+// OptionsFrom reads Options from the flat observability.profiling.* keys
+// of an evaluated configuration. A relative dir is taken relative to dir.
+func OptionsFrom(values map[string]interface{}, dir string) (Options, error) {
+	opts := DefaultOptions()
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "observability.profiling.")
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		var err error
+		switch setting {
+		case "enabled":
+			opts.Enabled, err = strconv.ParseBool(text)
+		case "addr":
+			opts.Addr = text
+		case "token":
+			opts.Token = text
+		case "dir":
+			opts.Dir = text
+		case "interval":
+			opts.Interval, err = time.ParseDuration(text)
+			if err == nil && opts.Interval <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "cpu_duration":
+			opts.CPUDuration, err = time.ParseDuration(text)
+			if err == nil && opts.CPUDuration <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "keep":
+			opts.Keep, err = strconv.Atoi(text)
+			if err == nil && opts.Keep < 1 {
+				err = errors.New("must be at least 1")
+			}
+		default:
+			return opts, fmt.Errorf("unknown setting observability.profiling.%s", setting)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("observability.profiling.%s: invalid value %q: %w", setting, text, err)
+		}
+	}
+	if opts.Dir != "" && !filepath.IsAbs(opts.Dir) {
+		opts.Dir = filepath.Join(dir, opts.Dir)
+	}
+	return opts, nil
+}
+
+// Handler serves the endpoints under Prefix: the index, cmdline, profile
+// (CPU), symbol, trace (runtime/trace) and the named profiles such as heap,
+// allocs and goroutine
+func Handler(opts Options) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(Prefix, pprof.Index)
+	mux.HandleFunc(Prefix+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(Prefix+"profile", pprof.Profile)
+	mux.HandleFunc(Prefix+"symbol", pprof.Symbol)
+	mux.HandleFunc(Prefix+"trace", pprof.Trace)
+	if opts.Token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(opts.Token)) != 1 {
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="tsk"`)
+			http.Error(rw, "a valid bearer token is required", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(rw, r)
+	})
+}
+
+// Mount returns next with the endpoints under Prefix when opts enables
+// them without a listener of their own, and next unchanged otherwise
+func Mount(next http.Handler, opts Options) http.Handler {
+	if !opts.Enabled || opts.Addr != "" {
+		return next
+	}
+	endpoints := Handler(opts)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, Prefix) {
+			endpoints.ServeHTTP(rw, r)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// Listen serves the endpoints on opts.Addr, when profiling is enabled with
+// one, until the returned server is closed. It returns nil otherwise.
+func Listen(opts Options) (*http.Server, error) {
+	if !opts.Enabled || opts.Addr == "" {
+		return nil, nil
+	}
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for profiling on %s: %w", opts.Addr, err)
+	}
+	server := &http.Server{Addr: listener.Addr().String(), Handler: Handler(opts), ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	return server, nil
+}
+
+// URL is the base URL of the endpoints of a server listening on addr, with
+// TLS when secure
+func URL(addr string, secure bool, opts Options) string {
+	scheme := "http"
+	if opts.Addr != "" {
+		addr = opts.Addr
+	} else if secure {
+		scheme = "https"
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+		addr = net.JoinHostPort("localhost", port)
+	}
+	return scheme + "://" + addr + Prefix
+}
+
+// Start runs the endpoint listener and the continuous profiles opts asks
+// for, which report their failures to report; stop shuts both down.
+// Nothing is started when profiling is off.
+func Start(opts Options, report func(error)) (stop func(), err error) {
+	server, err := Listen(opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	if opts.Enabled && opts.Dir != "" {
+		go func() {
+			defer close(done)
+			Continuous(ctx, opts, report)
+		}()
+	} else {
+		close(done)
+	}
+	return func() {
+		cancel()
+		<-done
+		if server != nil {
+			server.Close()
+		}
+	}, nil
+}
@@ -0,0 +1,108 @@
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{
+		"observability.profiling.enabled":  true,
+		"observability.profiling.token":    "s3cret",
+		"observability.profiling.dir":      "profiles",
+		"observability.profiling.interval": "1m",
+		"observability.profiling.keep":     3,
+		"server.port":                      8080,
+	}, "/srv/app")
+	if err != nil {
+		t.Fatalf("OptionsFrom() returned error: %v", err)
+	}
+	if !opts.Enabled || opts.Token != "s3cret" || opts.Dir != "/srv/app/profiles" || opts.Interval != time.Minute || opts.Keep != 3 || opts.CPUDuration != 10*time.Second {
+		t.Errorf("OptionsFrom() = %+v", opts)
+	}
+
+	if opts, err := OptionsFrom(nil, "."); err != nil || opts.Enabled {
+		t.Errorf("profiling should be off by default, got %+v, %v", opts, err)
+	}
+	for key, value := range map[string]interface{}{"enabled": "maybe", "interval": "0s", "keep": 0, "port": 6060} {
+		if _, err := OptionsFrom(map[string]interface{}{"observability.profiling." + key: value}, "."); err == nil {
+			t.Errorf("OptionsFrom() accepted %s: %v", key, value)
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+	app := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) { rw.Write([]byte("app")) })
+	if Mount(app, Options{}) == nil {
+		t.Fatal("Mount() returned nil")
+	}
+
+	server := httptest.NewServer(Mount(app, Options{Enabled: true, Token: "s3cret"}))
+	defer server.Close()
+	get := func(path, token string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		return resp.StatusCode, body.String()
+	}
+	if status, body := get("/", ""); status != http.StatusOK || body != "app" {
+		t.Errorf("GET / = %d %q, want the application", status, body)
+	}
+	if status, _ := get(Prefix, ""); status != http.StatusUnauthorized {
+		t.Errorf("GET %s without the token = %d, want 401", Prefix, status)
+	}
+	if status, body := get(Prefix, "s3cret"); status != http.StatusOK || !strings.Contains(body, "goroutine") {
+		t.Errorf("GET %s = %d, want the profile index", Prefix, status)
+	}
+
+	var heap bytes.Buffer
+	if err := Capture(context.Background(), http.DefaultClient, server.URL+Prefix, "heap", 0, "s3cret", &heap); err != nil || heap.Len() == 0 {
+		t.Errorf("Capture(heap) = %d bytes, %v", heap.Len(), err)
+	}
+	var cpu bytes.Buffer
+	if err := Capture(context.Background(), http.DefaultClient, server.URL+Prefix, "cpu", time.Second, "s3cret", &cpu); err != nil || cpu.Len() == 0 {
+		t.Errorf("Capture(cpu) = %d bytes, %v", cpu.Len(), err)
+	}
+	if err := Capture(context.Background(), http.DefaultClient, server.URL+Prefix, "heap", 0, "wrong", &heap); err == nil {
+		t.Error("Capture() with the wrong token should fail")
+	}
+	if err := Capture(context.Background(), http.DefaultClient, server.URL+Prefix, "disk", 0, "s3cret", &heap); err == nil {
+		t.Error("Capture() of an unknown profile should fail")
+	}
+}
+
+func TestContinuousSnapshots(t *testing.T) {
+	opts := Options{Enabled: true, Dir: filepath.Join(t.TempDir(), "profiles"), CPUDuration: 50 * time.Millisecond, Keep: 2}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := snapshot(context.Background(), opts, start.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("snapshot() returned error: %v", err)
+		}
+	}
+	for _, kind := range []string{"cpu", "heap"} {
+		files, _ := filepath.Glob(filepath.Join(opts.Dir, kind+"-*.pb.gz"))
+		if len(files) != 2 || !strings.HasSuffix(files[1], kind+"-20260102T030605Z.pb.gz") {
+			t.Errorf("%s profiles = %v, want the newest two", kind, files)
+		}
+		for _, file := range files {
+			if info, err := os.Stat(file); err != nil || info.Size() == 0 {
+				t.Errorf("%s is empty", file)
+			}
+		}
+	}
+}
@@ -0,0 +1,420 @@
+// Package promote promotes configuration from one environment overlay to
+// another, such as peanu.staging.tsk to peanu.production.tsk, with policy
+// checks, a snapshot of the target, webhook notifications and an audit log
+package promote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/internal/configvalue"
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// Files kept next to the overlays
+const (
+	// PolicyFile holds the promotion policy
+	PolicyFile = "promote.policy.tsk"
+	// StateDir holds snapshots and the audit log
+	StateDir = ".tsk"
+	// AuditLog is the JSON-lines promotion history inside StateDir
+	AuditLog = "audit.log"
+	// SnapshotDir holds copies of overlays taken before they were replaced
+	SnapshotDir = "snapshots"
+)
+
+// OverlayFile returns the overlay of environment env in dir
+func OverlayFile(dir, env string) string {
+	return filepath.Join(dir, "peanu."+env+".tsk")
+}
+
+// Environments returns the names of the environments with an overlay in
+// dir, in order
+func Environments(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "peanu.*.tsk"))
+	if err != nil {
+		return nil, err
+	}
+	var envs []string
+	for _, file := range files {
+		env := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "peanu."), ".tsk")
+		if env != "" && !strings.Contains(env, ".") {
+			envs = append(envs, env)
+		}
+	}
+	sort.Strings(envs)
+	return envs, nil
+}
+
+// Policy is what a promotion must satisfy, read from PolicyFile:
+//
+//	deny: ["debug", "*.debug"]
+//	approvals: 2
+//	pin: ["database.host"]
+//	notify: ["https://hooks.example.com/deploys"]
+type Policy struct {
+	// Deny lists key patterns that must not be enabled in the target
+	Deny []string `json:"deny"`
+	// Approvals is the number of approvers required besides the promoter
+	Approvals int `json:"approvals"`
+	// Pin lists key patterns that keep the target's value and are never promoted
+	Pin []string `json:"pin,omitempty"`
+	// Notify lists webhook URLs that receive each promotion record
+	Notify []string `json:"notify,omitempty"`
+}
+
+// DefaultPolicy refuses debug flags and requires no approvals
+var DefaultPolicy = Policy{Deny: []string{"debug", "*.debug"}}
+
+// LoadPolicy reads the PolicyFile of dir, or returns DefaultPolicy when
+// there is none. Patterns use path.Match syntax against dotted keys.
+func LoadPolicy(dir string) (*Policy, error) {
+	policy := DefaultPolicy
+	file := filepath.Join(dir, PolicyFile)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return &policy, nil
+	}
+
+	cfg := config.New()
+	if err := cfg.LoadFromFile(file); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", file, err)
+	}
+	for _, key := range cfg.Keys() {
+		var err error
+		switch key {
+		case "deny":
+			policy.Deny, err = configvalue.StringList(cfg.Get(key))
+		case "pin":
+			policy.Pin, err = configvalue.StringList(cfg.Get(key))
+		case "notify":
+			policy.Notify, err = configvalue.StringList(cfg.Get(key))
+		case "approvals":
+			policy.Approvals = cfg.GetInt(key)
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", file, key, err)
+		}
+	}
+	return &policy, nil
+}
+
+// Violation is a policy rule a promotion breaks
+type Violation struct {
+	Rule    string `json:"rule"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Key == "" {
+		return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", v.Rule, v.Key, v.Message)
+}
+
+// Options identifies who promotes and who approved
+type Options struct {
+	// User is the promoter recorded in the audit log
+	User string
+	// Approvers are the people who signed off; the promoter does not count
+	Approvers []string
+	// Now returns the promotion time; time.Now when nil
+	Now func() time.Time
+}
+
+// Promotion is a planned promotion. Nothing is written until Apply.
+type Promotion struct {
+	Dir    string `json:"-"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Changes are what the target gains, loses or changes, sorted by key
+	Changes []peanut.KeyChange `json:"changes"`
+	// Pinned are keys that differ but keep the target's value
+	Pinned     []string    `json:"pinned,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+	Policy     *Policy     `json:"policy"`
+
+	opts   Options
+	result map[string]interface{}
+}
+
+// Record is one promotion in the audit log, also posted to Notify webhooks
+type Record struct {
+	Time      time.Time          `json:"time"`
+	Action    string             `json:"action"`
+	From      string             `json:"from"`
+	To        string             `json:"to"`
+	User      string             `json:"user"`
+	Approvers []string           `json:"approvers,omitempty"`
+	Changes   []peanut.KeyChange `json:"changes"`
+	Snapshot  string             `json:"snapshot,omitempty"`
+}
+
+// Plan diffs the overlay of environment from against the overlay of to in
+// dir and checks the result against the policy. A missing target overlay
+// is treated as empty.
+func Plan(dir, from, to string, opts Options) (*Promotion, error) {
+	if from == to {
+		return nil, fmt.Errorf("cannot promote %s to itself", from)
+	}
+	policy, err := LoadPolicy(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Promotion{
+		Dir:    dir,
+		From:   from,
+		To:     to,
+		Source: OverlayFile(dir, from),
+		Target: OverlayFile(dir, to),
+		Policy: policy,
+		opts:   opts,
+	}
+	source, err := loadOverlay(p.Source, false)
+	if err != nil {
+		return nil, err
+	}
+	target, err := loadOverlay(p.Target, true)
+	if err != nil {
+		return nil, err
+	}
+
+	p.result = make(map[string]interface{}, len(source))
+	for key, value := range source {
+		p.result[key] = value
+	}
+	for _, change := range peanut.Diff(target, source) {
+		if !matchAny(policy.Pin, change.Key) {
+			p.Changes = append(p.Changes, change)
+			continue
+		}
+		p.Pinned = append(p.Pinned, change.Key)
+		if value, ok := target[change.Key]; ok {
+			p.result[change.Key] = value
+		} else {
+			delete(p.result, change.Key)
+		}
+	}
+	p.Violations = p.check()
+	return p, nil
+}
+
+// loadOverlay returns the flat values of an overlay file
+func loadOverlay(file string, optional bool) (map[string]interface{}, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) && optional {
+		return map[string]interface{}{}, nil
+	}
+	cfg := config.New()
+	if err := cfg.LoadFromFile(file); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", file, err)
+	}
+	return cfg.Values(), nil
+}
+
+// check applies the policy to the promoted values
+func (p *Promotion) check() []Violation {
+	var violations []Violation
+	keys := make([]string, 0, len(p.result))
+	for key := range p.result {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if matchAny(p.Policy.Deny, key) && enabled(p.result[key]) {
+			violations = append(violations, Violation{Rule: "deny", Key: key, Message: fmt.Sprintf("must not be enabled in %s", p.To)})
+		}
+	}
+
+	approvers := make(map[string]bool)
+	for _, approver := range p.opts.Approvers {
+		if approver != "" && approver != p.opts.User {
+			approvers[approver] = true
+		}
+	}
+	if len(approvers) < p.Policy.Approvals {
+		violations = append(violations, Violation{
+			Rule:    "approvals",
+			Message: fmt.Sprintf("needs %d approval(s) besides the promoter, got %d", p.Policy.Approvals, len(approvers)),
+		})
+	}
+	return violations
+}
+
+// matchAny reports whether key matches one of patterns
+func matchAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// enabled reports whether a flag value turns something on
+func enabled(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		switch strings.ToLower(v) {
+		case "true", "yes", "on", "1":
+			return true
+		}
+	}
+	return false
+}
+
+// Apply snapshots the target overlay, writes the promoted values to it,
+// appends a Record to the audit log and posts it to the policy's webhooks.
+// It refuses to run while the promotion has violations. Webhook failures
+// do not undo the promotion; they are returned alongside the record.
+func (p *Promotion) Apply() (*Record, []error, error) {
+	if len(p.Violations) > 0 {
+		return nil, nil, fmt.Errorf("promotion blocked by %d policy violation(s)", len(p.Violations))
+	}
+
+	now := time.Now
+	if p.opts.Now != nil {
+		now = p.opts.Now
+	}
+	record := &Record{
+		Time:      now().UTC(),
+		Action:    "promote",
+		From:      p.From,
+		To:        p.To,
+		User:      p.opts.User,
+		Approvers: p.opts.Approvers,
+		Changes:   p.Changes,
+	}
+
+	snapshot, err := p.snapshot(record.Time)
+	if err != nil {
+		return nil, nil, err
+	}
+	record.Snapshot = snapshot
+
+	cfg := config.New()
+	for key, value := range p.result {
+		cfg.Set(key, value)
+	}
+	if err := cfg.SaveToFile(p.Target); err != nil {
+		return nil, nil, err
+	}
+
+	if err := appendAudit(p.Dir, record); err != nil {
+		return nil, nil, err
+	}
+	return record, notify(p.Policy.Notify, record), nil
+}
+
+// snapshot copies the target overlay into the snapshot directory and
+// returns the copy's path, or "" when there is no target yet
+func (p *Promotion) snapshot(at time.Time) (string, error) {
+	data, err := os.ReadFile(p.Target)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", p.Target, err)
+	}
+
+	dir := filepath.Join(p.Dir, StateDir, SnapshotDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	name := fmt.Sprintf("peanu.%s-%s.tsk", p.To, at.Format("20060102T150405Z"))
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return file, nil
+}
+
+// appendAudit appends record to the audit log of dir
+func appendAudit(dir string, record *Record) error {
+	if err := os.MkdirAll(filepath.Join(dir, StateDir), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", StateDir, err)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, StateDir, AuditLog), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return f.Close()
+}
+
+// ReadAudit returns the promotion records of dir, oldest first
+func ReadAudit(dir string) ([]Record, error) {
+	data, err := os.ReadFile(filepath.Join(dir, StateDir, AuditLog))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	var records []Record
+	for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", i+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// notify posts record as JSON to each webhook and returns the failures
+func notify(urls []string, record *Record) []error {
+	if len(urls) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return []error{fmt.Errorf("failed to encode notification: %w", err)}
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	var errs []error
+	for _, url := range urls {
+		resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify %s: %w", url, err))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			errs = append(errs, fmt.Errorf("failed to notify %s: %s", url, resp.Status))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,129 @@
+package promote
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPromote(t *testing.T) {
+	var notified []Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record Record
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			t.Errorf("bad notification: %v", err)
+		}
+		notified = append(notified, record)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, PolicyFile), `deny: ["debug", "*.debug"]
+approvals: 1
+pin: ["database.host"]
+notify: ["`+server.URL+`"]
+`)
+	writeFile(t, OverlayFile(dir, "staging"), `debug: true
+workers: 8
+[database]
+host: "staging-db"
+pool: 20
+`)
+	writeFile(t, OverlayFile(dir, "production"), `workers: 4
+legacy: "yes"
+[database]
+host: "prod-db"
+pool: 10
+`)
+
+	if envs, err := Environments(dir); err != nil || strings.Join(envs, ",") != "production,staging" {
+		t.Errorf("Environments() = %v, %v", envs, err)
+	}
+
+	p, err := Plan(dir, "staging", "production", Options{User: "ana", Approvers: []string{"ana"}})
+	if err != nil {
+		t.Fatalf("Plan() returned error: %v", err)
+	}
+	if len(p.Violations) != 2 {
+		t.Fatalf("expected debug and approval violations, got %v", p.Violations)
+	}
+	if _, _, err := p.Apply(); err == nil {
+		t.Fatal("Apply() must refuse a promotion with violations")
+	}
+
+	writeFile(t, OverlayFile(dir, "staging"), "debug: false\nworkers: 8\n[database]\nhost: \"staging-db\"\npool: 20\n")
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	p, err = Plan(dir, "staging", "production", Options{User: "ana", Approvers: []string{"ben"}, Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatalf("Plan() returned error: %v", err)
+	}
+	if len(p.Violations) != 0 {
+		t.Fatalf("unexpected violations: %v", p.Violations)
+	}
+	kinds := make(map[string]string)
+	for _, change := range p.Changes {
+		kinds[change.Key] = change.Kind
+	}
+	want := map[string]string{"debug": peanut.KeyAdded, "workers": peanut.KeyModified, "database.pool": peanut.KeyModified, "legacy": peanut.KeyRemoved}
+	if len(kinds) != len(want) {
+		t.Errorf("expected changes %v, got %v", want, kinds)
+	}
+	for key, kind := range want {
+		if kinds[key] != kind {
+			t.Errorf("%s: expected %s, got %s", key, kind, kinds[key])
+		}
+	}
+	if len(p.Pinned) != 1 || p.Pinned[0] != "database.host" {
+		t.Errorf("expected database.host to be pinned, got %v", p.Pinned)
+	}
+
+	record, notifyErrs, err := p.Apply()
+	if err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+	if len(notifyErrs) != 0 {
+		t.Errorf("unexpected notification errors: %v", notifyErrs)
+	}
+
+	cfg := config.New()
+	if err := cfg.LoadFromFile(OverlayFile(dir, "production")); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GetInt("workers") != 8 || cfg.GetString("database.host") != "prod-db" || cfg.Has("legacy") {
+		t.Errorf("unexpected promoted values: %v", cfg.Values())
+	}
+
+	snapshot, err := os.ReadFile(record.Snapshot)
+	if err != nil {
+		t.Fatalf("snapshot not written: %v", err)
+	}
+	if filepath.Base(record.Snapshot) != "peanu.production-20260102T030405Z.tsk" || !strings.Contains(string(snapshot), "legacy") {
+		t.Errorf("unexpected snapshot %s:\n%s", record.Snapshot, snapshot)
+	}
+
+	records, err := ReadAudit(dir)
+	if err != nil {
+		t.Fatalf("ReadAudit() returned error: %v", err)
+	}
+	if len(records) != 1 || records[0].User != "ana" || len(records[0].Changes) != 4 {
+		t.Errorf("unexpected audit log: %+v", records)
+	}
+	if len(notified) != 1 || notified[0].To != "production" {
+		t.Errorf("unexpected notifications: %+v", notified)
+	}
+}
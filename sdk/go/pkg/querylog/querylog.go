@@ -0,0 +1,364 @@
+// Package querylog records the queries an adapter runs, one JSON object
+// per line, with their duration, rows and caller, and flags the ones slower
+// than a threshold. Read and Aggregate turn a log back into per-query
+// summaries for tsk db analyze. It is configured in the [database] section
+// of peanut.tsk:
+//
+//	[database]
+//	query_log {
+//	    file: "logs/queries.log"
+//	    slow: "200ms"
+//	    only_slow: false
+//	}
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSlow is the threshold queries are flagged as slow above
+const DefaultSlow = 100 * time.Millisecond
+
+// Entry is one logged query
+type Entry struct {
+	Time     time.Time     `json:"time"`
+	Adapter  string        `json:"adapter,omitempty"`
+	Query    string        `json:"query"`
+	Duration time.Duration `json:"duration"`
+	// Rows is the number of rows a query returned; statements run with
+	// Execute report none
+	Rows   int    `json:"rows"`
+	Caller string `json:"caller,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Slow   bool   `json:"slow,omitempty"`
+}
+
+// Config is where queries are logged and what counts as slow
+type Config struct {
+	File string
+	Slow time.Duration
+	// OnlySlow logs slow queries only
+	OnlySlow bool
+}
+
+// FromConfig reads query_log.file, query_log.slow and query_log.only_slow
+// from a flattened [database] section. ok is false without a file.
+func FromConfig(values map[string]interface{}) (cfg Config, ok bool, err error) {
+	cfg.Slow = DefaultSlow
+	file, found := values["query_log.file"]
+	if !found {
+		return cfg, false, nil
+	}
+	cfg.File = fmt.Sprint(file)
+	if slow, found := values["query_log.slow"]; found {
+		if cfg.Slow, err = duration(slow); err != nil {
+			return cfg, false, fmt.Errorf("invalid query_log.slow: %w", err)
+		}
+	}
+	switch onlySlow := values["query_log.only_slow"].(type) {
+	case nil:
+	case bool:
+		cfg.OnlySlow = onlySlow
+	default:
+		return cfg, false, fmt.Errorf("invalid query_log.only_slow: %v is not true or false", onlySlow)
+	}
+	return cfg, cfg.File != "", nil
+}
+
+// duration reads a duration string or a number of milliseconds
+func duration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case int:
+		return time.Duration(v) * time.Millisecond, nil
+	case float64:
+		return time.Duration(v * float64(time.Millisecond)), nil
+	case string:
+		if ms, err := strconv.Atoi(v); err == nil {
+			return time.Duration(ms) * time.Millisecond, nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a duration", v)
+		}
+		return d, nil
+	}
+	return 0, fmt.Errorf("%v is not a duration", value)
+}
+
+// Logger writes entries to a log
+type Logger struct {
+	Slow     time.Duration
+	OnlySlow bool
+	// OnSlow, when set, is called with every slow entry
+	OnSlow func(Entry)
+
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// New logs to w, flagging queries slower than slow
+func New(w io.Writer, slow time.Duration) *Logger {
+	return &Logger{w: w, Slow: slow}
+}
+
+// Open appends to the log file of cfg, creating it and its directory
+func Open(cfg Config) (*Logger, error) {
+	if dir := filepath.Dir(cfg.File); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create query log directory: %w", err)
+		}
+	}
+	file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open query log: %w", err)
+	}
+	logger := New(file, cfg.Slow)
+	logger.OnlySlow = cfg.OnlySlow
+	logger.closer = file
+	return logger, nil
+}
+
+// Log records one query run by adapter. It fills in the time, the caller
+// and whether the query was slow.
+func (l *Logger) Log(adapter, query string, elapsed time.Duration, rows int, err error) {
+	entry := Entry{
+		Time:     time.Now().Add(-elapsed),
+		Adapter:  adapter,
+		Query:    query,
+		Duration: elapsed,
+		Rows:     rows,
+		Slow:     l.Slow > 0 && elapsed >= l.Slow,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if l.OnlySlow && !entry.Slow {
+		return
+	}
+	entry.Caller = Caller()
+
+	line, _ := json.Marshal(entry)
+	l.mu.Lock()
+	l.w.Write(append(line, '\n'))
+	l.mu.Unlock()
+	if entry.Slow && l.OnSlow != nil {
+		l.OnSlow(entry)
+	}
+}
+
+// Close closes the log file opened by Open
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// internal are the packages between application code and the database;
+// callers are reported from outside them
+var internal = []string{
+	"github.com/cyber-boost/tusktsk/pkg/database.",
+	"github.com/cyber-boost/tusktsk/pkg/database/",
+	"github.com/cyber-boost/tusktsk/pkg/databasetypes.",
+	"github.com/cyber-boost/tusktsk/pkg/orm.",
+	"github.com/cyber-boost/tusktsk/pkg/querylog.",
+	"database/sql.",
+}
+
+// Caller returns file:line of the first caller outside the database
+// packages
+func Caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !isInternal(frame) {
+			return fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func isInternal(frame runtime.Frame) bool {
+	// Tests of the database packages count as callers
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+	for _, prefix := range internal {
+		if strings.HasPrefix(frame.Function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Read reads the entries of a log, skipping lines that are not entries
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Query == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read query log: %w", err)
+	}
+	return entries, nil
+}
+
+// ReadFile reads the entries of a log file
+func ReadFile(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open query log: %w", err)
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+var (
+	stringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numberLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	positional    = regexp.MustCompile(`\$\d+`)
+	valueList     = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	whitespace    = regexp.MustCompile(`\s+`)
+)
+
+// Fingerprint reduces a query to its shape, so runs with different values
+// group together: literals and placeholders become ?, and lists of them
+// become (?)
+func Fingerprint(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	query = positional.ReplaceAllString(query, "?")
+	query = numberLiteral.ReplaceAllString(query, "?")
+	query = valueList.ReplaceAllString(query, "(?)")
+	return strings.TrimSpace(whitespace.ReplaceAllString(query, " "))
+}
+
+// Summary aggregates the runs of one query shape
+type Summary struct {
+	Fingerprint string        `json:"fingerprint"`
+	Count       int           `json:"count"`
+	Slow        int           `json:"slow"`
+	Errors      int           `json:"errors"`
+	Total       time.Duration `json:"total"`
+	Mean        time.Duration `json:"mean"`
+	P95         time.Duration `json:"p95"`
+	Max         time.Duration `json:"max"`
+	Rows        int           `json:"rows"`
+	// Callers are where the query ran from, most frequent first
+	Callers []string `json:"callers"`
+	// Example is the slowest run
+	Example string `json:"example"`
+}
+
+// Filter selects entries to aggregate
+type Filter struct {
+	Adapter string
+	// Table keeps queries mentioning the table
+	Table string
+	// Slow keeps query shapes with at least one slow run
+	Slow bool
+}
+
+var word = regexp.MustCompile(`\w+`)
+
+func (f Filter) matches(entry Entry) bool {
+	if f.Adapter != "" && entry.Adapter != f.Adapter {
+		return false
+	}
+	if f.Table == "" {
+		return true
+	}
+	for _, w := range word.FindAllString(entry.Query, -1) {
+		if strings.EqualFold(w, f.Table) {
+			return true
+		}
+	}
+	return false
+}
+
+// Aggregate groups entries by fingerprint, slowest total time first
+func Aggregate(entries []Entry, filter Filter) []Summary {
+	type group struct {
+		summary   Summary
+		durations []time.Duration
+		callers   map[string]int
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, entry := range entries {
+		if !filter.matches(entry) {
+			continue
+		}
+		fingerprint := Fingerprint(entry.Query)
+		g, ok := groups[fingerprint]
+		if !ok {
+			g = &group{summary: Summary{Fingerprint: fingerprint}, callers: make(map[string]int)}
+			groups[fingerprint] = g
+			order = append(order, fingerprint)
+		}
+		s := &g.summary
+		s.Count++
+		s.Total += entry.Duration
+		s.Rows += entry.Rows
+		if entry.Slow {
+			s.Slow++
+		}
+		if entry.Error != "" {
+			s.Errors++
+		}
+		if entry.Duration >= s.Max {
+			s.Max = entry.Duration
+			s.Example = entry.Query
+		}
+		if entry.Caller != "" {
+			g.callers[entry.Caller]++
+		}
+		g.durations = append(g.durations, entry.Duration)
+	}
+
+	summaries := make([]Summary, 0, len(groups))
+	for _, fingerprint := range order {
+		g := groups[fingerprint]
+		if filter.Slow && g.summary.Slow == 0 {
+			continue
+		}
+		s := g.summary
+		s.Mean = s.Total / time.Duration(s.Count)
+		sort.Slice(g.durations, func(i, j int) bool { return g.durations[i] < g.durations[j] })
+		s.P95 = g.durations[(len(g.durations)*95+99)/100-1]
+		for caller := range g.callers {
+			s.Callers = append(s.Callers, caller)
+		}
+		sort.Slice(s.Callers, func(i, j int) bool {
+			a, b := s.Callers[i], s.Callers[j]
+			if g.callers[a] != g.callers[b] {
+				return g.callers[a] > g.callers[b]
+			}
+			return a < b
+		})
+		summaries = append(summaries, s)
+	}
+	sort.SliceStable(summaries, func(i, j int) bool { return summaries[i].Total > summaries[j].Total })
+	return summaries
+}
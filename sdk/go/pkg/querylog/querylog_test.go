@@ -0,0 +1,137 @@
+package querylog
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFromConfig(t *testing.T) {
+	cfg, ok, err := FromConfig(map[string]interface{}{
+		"query_log.file":      "logs/queries.log",
+		"query_log.slow":      "250ms",
+		"query_log.only_slow": true,
+	})
+	want := Config{File: "logs/queries.log", Slow: 250 * time.Millisecond, OnlySlow: true}
+	if err != nil || !ok || cfg != want {
+		t.Errorf("FromConfig() = %+v, %v, %v; want %+v", cfg, ok, err, want)
+	}
+	if cfg, ok, _ := FromConfig(map[string]interface{}{"query_log.file": "q.log", "query_log.slow": 50}); !ok || cfg.Slow != 50*time.Millisecond {
+		t.Errorf("a number should be milliseconds: %+v", cfg)
+	}
+	if _, ok, err := FromConfig(map[string]interface{}{"sqlite.max_open": 1}); ok || err != nil {
+		t.Errorf("without a file got ok=%v err=%v", ok, err)
+	}
+	if _, _, err := FromConfig(map[string]interface{}{"query_log.file": "q.log", "query_log.slow": "soon"}); err == nil {
+		t.Error("an invalid threshold should be rejected")
+	}
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, 100*time.Millisecond)
+	var flagged []Entry
+	logger.OnSlow = func(entry Entry) { flagged = append(flagged, entry) }
+
+	logger.Log("sqlite", "SELECT * FROM users WHERE id = ?", 5*time.Millisecond, 1, nil)
+	logger.Log("sqlite", "SELECT * FROM posts", 150*time.Millisecond, 40, nil)
+	logger.Log("sqlite", "DELETE FROM nope", time.Millisecond, 0, errors.New("no such table: nope"))
+
+	entries, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read() returned error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("read %d entries; want 3", len(entries))
+	}
+	if entries[0].Slow || !entries[1].Slow || entries[1].Rows != 40 || entries[2].Error == "" {
+		t.Errorf("entries = %+v", entries)
+	}
+	if !strings.HasPrefix(entries[0].Caller, "querylog_test.go:") {
+		t.Errorf("caller = %q; want this test", entries[0].Caller)
+	}
+	if len(flagged) != 1 || flagged[0].Query != "SELECT * FROM posts" {
+		t.Errorf("OnSlow got %+v; want the slow query", flagged)
+	}
+
+	buf.Reset()
+	logger.OnlySlow = true
+	logger.Log("sqlite", "SELECT 1", time.Millisecond, 1, nil)
+	if buf.Len() != 0 {
+		t.Errorf("OnlySlow logged a fast query: %s", buf.String())
+	}
+}
+
+func TestOpen(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "logs", "queries.log")
+	for i := 0; i < 2; i++ {
+		logger, err := Open(Config{File: file, Slow: DefaultSlow})
+		if err != nil {
+			t.Fatalf("Open() returned error: %v", err)
+		}
+		logger.Log("sqlite", "SELECT 1", time.Millisecond, 1, nil)
+		logger.Close()
+	}
+	entries, err := ReadFile(file)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("ReadFile() = %d entries, %v; want both runs appended", len(entries), err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM users WHERE id = 42":                           "SELECT * FROM users WHERE id = ?",
+		"SELECT *\n  FROM users WHERE name = 'O''Brien'":              "SELECT * FROM users WHERE name = ?",
+		"SELECT * FROM users WHERE id IN ($1, $2, $3)":                "SELECT * FROM users WHERE id IN (?)",
+		"INSERT INTO t2 (a, b) VALUES (?, ?)":                         "INSERT INTO t2 (a, b) VALUES (?)",
+		"SELECT * FROM logs WHERE score > 1.5 AND day = '2024-01-01'": "SELECT * FROM logs WHERE score > ? AND day = ?",
+	}
+	for in, want := range tests {
+		if got := Fingerprint(in); got != want {
+			t.Errorf("Fingerprint(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	ms := time.Millisecond
+	entries := []Entry{
+		{Adapter: "sqlite", Query: "SELECT * FROM users WHERE id = 1", Duration: 10 * ms, Rows: 1, Caller: "a.go:1"},
+		{Adapter: "sqlite", Query: "SELECT * FROM users WHERE id = 2", Duration: 300 * ms, Rows: 1, Caller: "b.go:2", Slow: true},
+		{Adapter: "sqlite", Query: "SELECT * FROM users WHERE id = 3", Duration: 20 * ms, Rows: 1, Caller: "b.go:2"},
+		{Adapter: "sqlite", Query: "SELECT * FROM posts", Duration: 50 * ms, Rows: 7, Caller: "c.go:3"},
+		{Adapter: "postgresql", Query: "SELECT * FROM users WHERE id = 4", Duration: time.Second, Slow: true},
+	}
+
+	summaries := Aggregate(entries, Filter{Adapter: "sqlite"})
+	if len(summaries) != 2 {
+		t.Fatalf("got %d summaries; want 2: %+v", len(summaries), summaries)
+	}
+	users := summaries[0]
+	want := Summary{
+		Fingerprint: "SELECT * FROM users WHERE id = ?",
+		Count:       3,
+		Slow:        1,
+		Total:       330 * ms,
+		Mean:        110 * ms,
+		P95:         300 * ms,
+		Max:         300 * ms,
+		Rows:        3,
+		Callers:     []string{"b.go:2", "a.go:1"},
+		Example:     "SELECT * FROM users WHERE id = 2",
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("users summary =\n%+v\nwant\n%+v", users, want)
+	}
+
+	if slow := Aggregate(entries, Filter{Adapter: "sqlite", Slow: true}); len(slow) != 1 || slow[0].Fingerprint != want.Fingerprint {
+		t.Errorf("slow summaries = %+v", slow)
+	}
+	if posts := Aggregate(entries, Filter{Table: "posts"}); len(posts) != 1 || posts[0].Rows != 7 {
+		t.Errorf("posts summaries = %+v", posts)
+	}
+}
@@ -0,0 +1,156 @@
+package rediswire
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Cache stores JSON-encoded values under a key prefix. Values come back as
+// JSON decodes them: numbers as float64, objects as maps.
+type Cache struct {
+	prefix string
+	url    string
+	mu     sync.Mutex
+	client *Client
+	// failed and err hold back redials for retryAfter after a failure
+	failed time.Time
+	err    error
+}
+
+// retryAfter spaces out reconnection attempts to an unreachable server
+const retryAfter = 10 * time.Second
+
+// NewCache creates a cache whose keys all start with prefix, so Clear never
+// touches keys it did not write
+func NewCache(client *Client, prefix string) *Cache {
+	return &Cache{client: client, prefix: prefix}
+}
+
+var (
+	sharedMu     sync.Mutex
+	sharedCaches = make(map[string]*Cache)
+)
+
+// SharedCache returns one cache per URL and prefix. It connects on first
+// use and, while the server is unreachable, retries every few seconds.
+func SharedCache(url, prefix string) *Cache {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	key := url + " " + prefix
+	if c, ok := sharedCaches[key]; ok {
+		return c
+	}
+	c := &Cache{url: url, prefix: prefix}
+	sharedCaches[key] = c
+	return c
+}
+
+// conn returns the client, dialing a shared cache's URL when needed
+func (c *Cache) conn() (*Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		return c.client, nil
+	}
+	if c.err != nil && time.Since(c.failed) < retryAfter {
+		return nil, c.err
+	}
+	opts, err := ParseURL(c.url)
+	if err != nil {
+		return nil, err
+	}
+	client, err := Dial(opts)
+	if err != nil {
+		c.failed, c.err = time.Now(), err
+		return nil, err
+	}
+	c.client = client
+	return client, nil
+}
+
+// do runs one command through conn
+func (c *Cache) do(args ...interface{}) (interface{}, error) {
+	client, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(args...)
+}
+
+// Get returns the value at key; ok is false for a miss
+func (c *Cache) Get(key string) (value interface{}, ok bool, err error) {
+	reply, err := c.do("GET", c.prefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	data, _ := reply.(string)
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return nil, false, fmt.Errorf("failed to decode cached %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// Set stores value at key; a ttl of 0 never expires
+func (c *Cache) Set(key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	args := []interface{}{"SET", c.prefix + key, data}
+	if ttl > 0 {
+		args = append(args, "PX", ttl)
+	}
+	_, err = c.do(args...)
+	return err
+}
+
+// Delete removes key
+func (c *Cache) Delete(key string) error {
+	_, err := c.do("DEL", c.prefix+key)
+	return err
+}
+
+// Len counts the keys under the prefix
+func (c *Cache) Len() (int, error) {
+	n := 0
+	err := c.scan(func(keys []interface{}) error {
+		n += len(keys)
+		return nil
+	})
+	return n, err
+}
+
+// Clear removes every key under the prefix, walking the keyspace with SCAN
+// rather than blocking the server with KEYS
+func (c *Cache) Clear() error {
+	return c.scan(func(keys []interface{}) error {
+		_, err := c.do(append([]interface{}{"DEL"}, keys...)...)
+		return err
+	})
+}
+
+// scan passes each non-empty batch of keys under the prefix to fn
+func (c *Cache) scan(fn func(keys []interface{}) error) error {
+	cursor := "0"
+	for {
+		reply, err := c.do("SCAN", cursor, "MATCH", c.prefix+"*", "COUNT", 500)
+		if err != nil {
+			return err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return fmt.Errorf("unexpected SCAN reply %v", reply)
+		}
+		cursor, _ = parts[0].(string)
+		if keys, _ := parts[1].([]interface{}); len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
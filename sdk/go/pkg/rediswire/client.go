@@ -0,0 +1,299 @@
+// Package rediswire configures github.com/redis/go-redis clients from TSK
+// settings and redis:// URLs, and wraps them in the untyped command API
+// the Redis database adapter, the L3 cache and the @cache operator use.
+package rediswire
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Options configures a Client
+type Options struct {
+	Address  string
+	Username string
+	Password string
+	DB       int
+	// TLS enables TLS when non-nil (rediss:// URLs)
+	TLS *tls.Config
+	// MaxOpen and MaxIdle bound the connection pool; 0 means 10 and 2
+	MaxOpen int
+	MaxIdle int
+	// MaxLifetime and MaxIdleTime retire old connections; 0 keeps them
+	MaxLifetime time.Duration
+	MaxIdleTime time.Duration
+	Timeout     time.Duration
+}
+
+// ParseURL reads redis://[user:password@]host[:port][/db] and rediss://
+// for TLS. Pool settings come from the max_open, max_idle, max_lifetime,
+// max_idle_time and timeout parameters; skip_verify=true disables
+// certificate checks.
+func ParseURL(rawURL string) (Options, error) {
+	var opts Options
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+		return opts, fmt.Errorf("invalid Redis URL: %s", rawURL)
+	}
+	host := u.Host
+	if host == "" {
+		host = "localhost"
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "6379")
+	}
+	opts.Address = host
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			opts.Password = password
+		} else {
+			// redis://:password@host and redis://password@host both mean a
+			// password without a user name
+			opts.Username, opts.Password = "", opts.Username
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if opts.DB, err = strconv.Atoi(db); err != nil {
+			return opts, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+
+	query := u.Query()
+	if u.Scheme == "rediss" {
+		opts.TLS = &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: query.Get("skip_verify") == "true",
+		}
+	}
+	for key, target := range map[string]*int{"max_open": &opts.MaxOpen, "max_idle": &opts.MaxIdle} {
+		if v := query.Get(key); v != "" {
+			if *target, err = strconv.Atoi(v); err != nil {
+				return opts, fmt.Errorf("invalid %s %q", key, v)
+			}
+		}
+	}
+	for key, target := range map[string]*time.Duration{
+		"max_lifetime": &opts.MaxLifetime, "max_idle_time": &opts.MaxIdleTime, "timeout": &opts.Timeout,
+	} {
+		if v := query.Get(key); v != "" {
+			if *target, err = time.ParseDuration(v); err != nil {
+				return opts, fmt.Errorf("invalid %s %q", key, v)
+			}
+		}
+	}
+	return opts, nil
+}
+
+// Error is an error reply from the server, such as WRONGTYPE
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Client is a pool of connections to one server
+type Client struct {
+	opts Options
+	mu   sync.Mutex
+	rdb  *redis.Client
+}
+
+// Dial connects to the server, failing fast on bad credentials or an
+// unreachable server
+func Dial(opts Options) (*Client, error) {
+	if opts.MaxOpen <= 0 {
+		opts.MaxOpen = 10
+	}
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = 2
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	c := &Client{opts: opts, rdb: redis.NewClient(redisOptions(opts))}
+	if _, err := c.Do("PING"); err != nil {
+		c.rdb.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// redisOptions translates opts for go-redis. Commands are sent once: a
+// command queued in a MULTI block on a pinned connection cannot be
+// replayed on a new one. Replies may take longer than Timeout, as those
+// of blocking commands do.
+func redisOptions(opts Options) *redis.Options {
+	maxIdleTime := opts.MaxIdleTime
+	if maxIdleTime == 0 {
+		maxIdleTime = -1
+	}
+	return &redis.Options{
+		Addr:             opts.Address,
+		Username:         opts.Username,
+		Password:         opts.Password,
+		DB:               opts.DB,
+		TLSConfig:        opts.TLS,
+		Protocol:         2,
+		DisableIndentity: true,
+		MaxRetries:       -1,
+		DialTimeout:      opts.Timeout,
+		ReadTimeout:      opts.Timeout + 30*time.Second,
+		WriteTimeout:     opts.Timeout + 30*time.Second,
+		PoolTimeout:      opts.Timeout,
+		PoolSize:         opts.MaxOpen,
+		MaxIdleConns:     opts.MaxIdle,
+		ConnMaxLifetime:  opts.MaxLifetime,
+		ConnMaxIdleTime:  maxIdleTime,
+	}
+}
+
+// client returns the current pool
+func (c *Client) client() *redis.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rdb
+}
+
+// SetPool changes the pool limits. go-redis sizes a pool when it is
+// created, so the pool is replaced: pinned connections keep working until
+// closed, and idle connections of the old pool are closed.
+func (c *Client) SetPool(maxOpen, maxIdle int, maxLifetime, maxIdleTime time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if maxOpen > 0 {
+		c.opts.MaxOpen = maxOpen
+	}
+	if maxIdle > 0 {
+		c.opts.MaxIdle = maxIdle
+	}
+	c.opts.MaxLifetime, c.opts.MaxIdleTime = maxLifetime, maxIdleTime
+	old := c.rdb
+	c.rdb = redis.NewClient(redisOptions(c.opts))
+	old.Close()
+}
+
+// PoolStats reports open and idle connections
+func (c *Client) PoolStats() (open, idle, maxOpen int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.rdb.PoolStats()
+	return int(stats.TotalConns), int(stats.IdleConns), c.opts.MaxOpen
+}
+
+// Close closes every pooled connection
+func (c *Client) Close() error {
+	err := c.client().Close()
+	if errors.Is(err, redis.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Do sends one command and returns its reply: string for status and bulk
+// replies, int64 for integers, []interface{} for arrays and nil for nil
+// replies. Error replies are returned as Error.
+func (c *Client) Do(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return reply(c.client().Do(context.Background(), commandArgs(args)...).Result())
+}
+
+// Conn pins one pooled connection, for MULTI/EXEC and other stateful
+// sequences. Close returns it to the pool.
+type Conn struct {
+	cn *redis.Conn
+}
+
+// Conn takes a connection out of the pool when its first command is sent
+func (c *Client) Conn() (*Conn, error) {
+	return &Conn{cn: c.client().Conn()}, nil
+}
+
+// Do sends one command on the pinned connection
+func (pc *Conn) Do(args ...interface{}) (interface{}, error) {
+	if pc.cn == nil {
+		return nil, fmt.Errorf("connection is closed")
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	ctx := context.Background()
+	cmd := redis.NewCmd(ctx, commandArgs(args)...)
+	pc.cn.Process(ctx, cmd)
+	return reply(cmd.Result())
+}
+
+// Close returns the connection to the pool
+func (pc *Conn) Close() error {
+	if pc.cn != nil {
+		pc.cn.Close()
+		pc.cn = nil
+	}
+	return nil
+}
+
+// commandArgs encodes args as the strings sent on the wire: durations in
+// the milliseconds PX and PEXPIRE take, and values of other types as
+// fmt.Sprint formats them
+func commandArgs(args []interface{}) []interface{} {
+	encoded := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string, []byte:
+			encoded[i] = v
+		case int:
+			encoded[i] = strconv.Itoa(v)
+		case int64:
+			encoded[i] = strconv.FormatInt(v, 10)
+		case float64:
+			encoded[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case time.Duration:
+			encoded[i] = strconv.FormatInt(v.Milliseconds(), 10)
+		default:
+			encoded[i] = fmt.Sprint(v)
+		}
+	}
+	return encoded
+}
+
+// reply converts a go-redis result: a nil reply is not an error, and
+// error replies, including those inside EXEC replies, become Error
+func reply(value interface{}, err error) (interface{}, error) {
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if items, ok := value.([]interface{}); ok {
+		for i, item := range items {
+			if itemErr, ok := item.(error); ok {
+				items[i] = convertError(itemErr)
+			} else if _, nested := item.([]interface{}); nested {
+				items[i], _ = reply(item, nil)
+			}
+		}
+	}
+	return value, nil
+}
+
+// convertError returns error replies as Error and wraps the rest
+func convertError(err error) error {
+	var replyErr redis.Error
+	if errors.As(err, &replyErr) {
+		return Error(replyErr.Error())
+	}
+	return fmt.Errorf("redis: %w", err)
+}
@@ -0,0 +1,64 @@
+package rediswire
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// poolKeys are the pool settings read from <prefix>.pool.* and passed on
+// as URL parameters
+var poolKeys = []string{"max_open", "max_idle", "max_lifetime", "max_idle_time", "timeout"}
+
+// ConfigURL builds a redis:// URL from flattened configuration under
+// prefix, such as database.redis or cache.redis: <prefix>.url, or
+// <prefix>.host, port, username, password, db and tls (with skip_verify),
+// plus pool settings in <prefix>.pool.max_open, max_idle, max_lifetime,
+// max_idle_time and timeout. ok is false when neither url nor host is set.
+func ConfigURL(values map[string]interface{}, prefix string) (string, bool, error) {
+	get := func(key string) string {
+		if v, ok := values[prefix+"."+key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+
+	var u *url.URL
+	if raw := get("url"); raw != "" {
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid %s.url: %w", prefix, err)
+		}
+		u = parsed
+	} else if host := get("host"); host != "" {
+		if port := get("port"); port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		u = &url.URL{Scheme: "redis", Host: host}
+		if enabled, _ := strconv.ParseBool(get("tls")); enabled {
+			u.Scheme = "rediss"
+		}
+		if db := get("db"); db != "" && db != "0" {
+			u.Path = "/" + db
+		}
+		if password := get("password"); password != "" {
+			u.User = url.UserPassword(get("username"), password)
+		}
+	} else {
+		return "", false, nil
+	}
+
+	query := u.Query()
+	for _, key := range poolKeys {
+		if v := get("pool." + key); v != "" {
+			query.Set(key, v)
+		}
+	}
+	if v := get("skip_verify"); v != "" {
+		query.Set("skip_verify", strings.ToLower(v))
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), true, nil
+}
@@ -0,0 +1,518 @@
+// Package refactor renames configuration keys across a TSK project,
+// updating the $variable references, ${} interpolations, cross-file
+// @file.tsk.get/set calls and schema and policy entries that name them
+package refactor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of Change
+const (
+	KindDefinition    = "definition"
+	KindVariable      = "variable"
+	KindInterpolation = "interpolation"
+	KindCrossFile     = "cross-file"
+	KindSchema        = "schema"
+	KindPolicy        = "policy"
+	KindAlias         = "alias"
+)
+
+// skipDirs are never scanned
+var skipDirs = map[string]bool{
+	".git": true, "node_modules": true, "vendor": true, ".idea": true, ".vscode": true,
+}
+
+var (
+	keyPattern           = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*(\.[A-Za-z_][A-Za-z0-9_-]*)*$`)
+	interpolationPattern = regexp.MustCompile(`\$\{\s*([^}\s]+)\s*\}`)
+	variablePattern      = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_-]*)*)`)
+	crossFilePattern     = regexp.MustCompile(`@([A-Za-z0-9_./-]+)\.tsk\.(get|set)\(`)
+	quotedPattern        = regexp.MustCompile(`"([^"]*)"|'([^']*)'`)
+)
+
+// Options controls a Rename
+type Options struct {
+	// Alias keeps the old key defined next to the new one, with the same
+	// value and a deprecation comment, so readers that were not updated
+	// keep working
+	Alias bool
+}
+
+// Change is one edit made by a rename
+type Change struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Kind string `json:"kind"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// FileEdit is the rewritten content of one file
+type FileEdit struct {
+	Path    string
+	name    string
+	lines   []string
+	newline bool
+	// replaced maps a 0-based line number to the lines that replace it
+	replaced map[int][]string
+	mode     fs.FileMode
+}
+
+// Plan is the outcome of Rename. Nothing is written until Apply.
+type Plan struct {
+	Old     string      `json:"old"`
+	New     string      `json:"new"`
+	Changes []Change    `json:"changes"`
+	Files   []*FileEdit `json:"-"`
+	// Stale lists compiled .pnt files whose text source changed
+	Stale []string `json:"stale,omitempty"`
+}
+
+// Rename plans renaming key old to new in every .tsk and .peanuts file
+// under root. Only the last segment of a key may change, so old and new
+// must share their parent: database.host can become database.hostname,
+// and database can become db, but database.host cannot move to cache.host.
+//
+// Renaming a section renames every key below it. Rename fails when old is
+// not defined anywhere or new is already defined.
+func Rename(root, old, new string, opts Options) (*Plan, error) {
+	old, new = strings.TrimPrefix(old, "$"), strings.TrimPrefix(new, "$")
+	for _, key := range []string{old, new} {
+		if !keyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+	}
+	oldPath, newPath := strings.Split(old, "."), strings.Split(new, ".")
+	if len(oldPath) != len(newPath) || strings.Join(oldPath[:len(oldPath)-1], ".") != strings.Join(newPath[:len(newPath)-1], ".") {
+		return nil, fmt.Errorf("%s and %s have different parents; only the last segment of a key can be renamed", old, new)
+	}
+	if old == new {
+		return nil, fmt.Errorf("%s is already named %s", old, new)
+	}
+
+	files, err := findFiles(root)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &renamer{old: oldPath, new: newPath, opts: opts, defining: make(map[string]bool)}
+	var sources []*source
+	for _, path := range files {
+		src, err := readSource(root, path)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+
+	// Definitions first, so cross-file references know which files define the key
+	for _, src := range sources {
+		if src.role != roleConfig {
+			continue
+		}
+		for _, tok := range src.tokens() {
+			switch {
+			case hasPrefix(tok.path(), newPath):
+				return nil, fmt.Errorf("%s is already defined in %s:%d", new, src.path, tok.line+1)
+			case hasPrefix(tok.path(), oldPath):
+				r.defining[filepath.Base(src.path)] = true
+				if opts.Alias && (tok.kind != tokenKey || !tok.value || len(tok.path()) > len(oldPath)) {
+					return nil, fmt.Errorf("cannot alias %s: it is a section in %s:%d", old, src.path, tok.line+1)
+				}
+			}
+		}
+	}
+	if len(r.defining) == 0 {
+		return nil, fmt.Errorf("%s is not defined in any file under %s", old, root)
+	}
+
+	plan := &Plan{Old: old, New: new}
+	for _, src := range sources {
+		edit, changes := r.rewrite(src)
+		if len(changes) == 0 {
+			continue
+		}
+		plan.Files = append(plan.Files, edit)
+		plan.Changes = append(plan.Changes, changes...)
+		binary := strings.TrimSuffix(src.path, filepath.Ext(src.path)) + ".pnt"
+		if _, err := os.Stat(binary); err == nil {
+			plan.Stale = append(plan.Stale, binary)
+		}
+	}
+	return plan, nil
+}
+
+// Apply writes every changed file and returns their paths
+func (p *Plan) Apply() ([]string, error) {
+	var written []string
+	for _, edit := range p.Files {
+		if err := os.WriteFile(edit.Path, edit.Content(), edit.mode); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", edit.Path, err)
+		}
+		written = append(written, edit.Path)
+	}
+	return written, nil
+}
+
+// Diff returns a unified diff of every changed file
+func (p *Plan) Diff() string {
+	var sb strings.Builder
+	for _, edit := range p.Files {
+		sb.WriteString(edit.Diff())
+	}
+	return sb.String()
+}
+
+// Content returns the rewritten file
+func (f *FileEdit) Content() []byte {
+	var out []string
+	for i, line := range f.lines {
+		if replacement, ok := f.replaced[i]; ok {
+			out = append(out, replacement...)
+			continue
+		}
+		out = append(out, line)
+	}
+	content := strings.Join(out, "\n")
+	if f.newline {
+		content += "\n"
+	}
+	return []byte(content)
+}
+
+// diffContext is the number of unchanged lines shown around each hunk
+const diffContext = 3
+
+// Diff returns a unified diff of the file
+func (f *FileEdit) Diff() string {
+	changed := make([]int, 0, len(f.replaced))
+	for i := range f.replaced {
+		changed = append(changed, i)
+	}
+	sort.Ints(changed)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", f.name, f.name)
+	// offset is how many lines the edits above the current hunk added
+	offset := 0
+	for len(changed) > 0 {
+		// Group changes whose context overlaps into one hunk
+		start := max(changed[0]-diffContext, 0)
+		end := changed[0]
+		n := 0
+		for n < len(changed) && changed[n] <= end+2*diffContext {
+			end = changed[n]
+			n++
+		}
+		end = min(end+diffContext, len(f.lines)-1)
+
+		var body strings.Builder
+		oldCount, newCount := 0, 0
+		for i := start; i <= end; i++ {
+			replacement, ok := f.replaced[i]
+			if !ok {
+				fmt.Fprintf(&body, " %s\n", f.lines[i])
+				oldCount++
+				newCount++
+				continue
+			}
+			fmt.Fprintf(&body, "-%s\n", f.lines[i])
+			oldCount++
+			for _, line := range replacement {
+				fmt.Fprintf(&body, "+%s\n", line)
+				newCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n%s", start+1, oldCount, start+1+offset, newCount, body.String())
+		offset += newCount - oldCount
+		changed = changed[n:]
+	}
+	return sb.String()
+}
+
+// findFiles returns the .tsk and .peanuts files under root, sorted
+func findFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && skipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".tsk", ".peanuts":
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// renamer rewrites one source at a time
+type renamer struct {
+	old, new []string
+	opts     Options
+	// defining holds the base names of the files that define the key, the
+	// names cross-file references address them by
+	defining map[string]bool
+}
+
+// rewrite returns the edit and changes for one source
+func (r *renamer) rewrite(src *source) (*FileEdit, []Change) {
+	edit := &FileEdit{Path: src.path, name: src.name, lines: src.lines, newline: src.newline, replaced: make(map[int][]string), mode: src.mode}
+	var changes []Change
+	record := func(line int, kind, old, new string) {
+		changes = append(changes, Change{File: src.path, Line: line + 1, Kind: kind, Old: old, New: new})
+	}
+
+	for i, info := range src.scan() {
+		raw := src.lines[i]
+		line := raw
+		var alias string
+
+		if tok := info.token; tok != nil {
+			if renamed, ok := r.renameToken(tok, src.role); ok {
+				kind := KindDefinition
+				if src.role == roleSchema {
+					kind = KindSchema
+				} else if src.role == rolePolicy {
+					kind = KindPolicy
+				}
+				record(i, kind, tok.name, renamed)
+				line = raw[:tok.start] + renamed + raw[tok.end:]
+				if r.opts.Alias && src.role == roleConfig && tok.kind == tokenKey {
+					alias = raw[:tok.end]
+				}
+			}
+		}
+
+		if info.refStart >= 0 {
+			// Renaming the definition may have shifted the value
+			shift := len(line) - len(raw)
+			codeStart, codeEnd := info.refStart+shift, info.codeEnd+shift
+			code := line[codeStart:codeEnd]
+			code = r.rewriteReferences(code, src.role, func(kind, old, new string) { record(i, kind, old, new) })
+			line = line[:codeStart] + code + line[codeEnd:]
+			if alias != "" {
+				alias = strings.TrimRight(alias+line[info.token.end+shift:codeStart+len(code)], " \t")
+			}
+		}
+
+		if line == raw {
+			continue
+		}
+		edit.replaced[i] = []string{line}
+		if alias != "" {
+			if strings.HasSuffix(raw, "\r") {
+				alias += "  # deprecated: renamed to " + strings.Join(r.new, ".") + "\r"
+			} else {
+				alias += "  # deprecated: renamed to " + strings.Join(r.new, ".")
+			}
+			edit.replaced[i] = append(edit.replaced[i], alias)
+			record(i, KindAlias, "", strings.Join(r.old, "."))
+		}
+	}
+	return edit, changes
+}
+
+// renameToken returns the new name of a token whose path covers the
+// renamed segment. In schema and policy files only [path] sections are
+// renamed, since their keys (type, required...) are not config keys.
+func (r *renamer) renameToken(t *token, role fileRole) (string, bool) {
+	path := t.path()
+	if !hasPrefix(path, r.old) || len(t.prefix) >= len(r.old) {
+		return "", false
+	}
+	if role != roleConfig && t.kind != tokenSection {
+		return "", false
+	}
+
+	segments := strings.Split(t.name, ".")
+	i := len(r.old) - 1 - len(t.prefix)
+	if strings.HasPrefix(segments[i], "$") {
+		segments[i] = "$" + r.new[len(r.new)-1]
+	} else {
+		segments[i] = r.new[len(r.new)-1]
+	}
+	return strings.Join(segments, "."), true
+}
+
+// rewriteReferences renames the key wherever code refers to it
+func (r *renamer) rewriteReferences(code string, role fileRole, record func(kind, old, new string)) string {
+	code = replaceSubmatch(interpolationPattern, code, func(ref string) (string, bool) {
+		renamed, ok := r.renamePath(ref)
+		if ok {
+			record(KindInterpolation, "${"+ref+"}", "${"+renamed+"}")
+		}
+		return renamed, ok
+	})
+	code = replaceSubmatch(variablePattern, code, func(ref string) (string, bool) {
+		renamed, ok := r.renamePath(ref)
+		if ok {
+			record(KindVariable, "$"+ref, "$"+renamed)
+		}
+		return renamed, ok
+	})
+	code = r.rewriteCrossFile(code, record)
+
+	if role == roleConfig {
+		return code
+	}
+	kind := KindSchema
+	if role == rolePolicy {
+		kind = KindPolicy
+	}
+	return quotedPattern.ReplaceAllStringFunc(code, func(quoted string) string {
+		renamed, ok := r.renamePath(quoted[1 : len(quoted)-1])
+		if !ok {
+			return quoted
+		}
+		record(kind, quoted, quoted[:1]+renamed+quoted[:1])
+		return quoted[:1] + renamed + quoted[:1]
+	})
+}
+
+// rewriteCrossFile renames the key in @file.tsk.get("key"),
+// @file.tsk.get("section", "key") and @file.tsk.set("key", ...) calls that
+// address a file defining it
+func (r *renamer) rewriteCrossFile(code string, record func(kind, old, new string)) string {
+	matches := crossFilePattern.FindAllStringSubmatchIndex(code, -1)
+	for m := len(matches) - 1; m >= 0; m-- {
+		match := matches[m]
+		file := filepath.Base(code[match[2]:match[3]]) + ".tsk"
+		if !r.defining[file] {
+			continue
+		}
+
+		args := parseStringArgs(code[match[1]:])
+		if len(args) == 0 {
+			continue
+		}
+		if code[match[4]:match[5]] == "set" || len(args) > 2 {
+			// set takes a value after the key
+			args = args[:1]
+		}
+		var parts []string
+		for _, arg := range args {
+			parts = append(parts, arg.value)
+		}
+		renamed, ok := r.renamePath(strings.Join(parts, "."))
+		if !ok {
+			continue
+		}
+
+		// Each argument keeps its number of segments
+		segments := strings.Split(renamed, ".")
+		values := make([]string, len(args))
+		for i, arg := range args {
+			n := strings.Count(arg.value, ".") + 1
+			values[i], segments = strings.Join(segments[:n], "."), segments[n:]
+		}
+		call, rest := code[match[0]:match[1]], code[match[1]:]
+		oldEnd := args[len(args)-1].end + 1
+		if closing := strings.IndexByte(rest[oldEnd:], ')'); closing != -1 && strings.TrimSpace(rest[oldEnd:oldEnd+closing]) == "" {
+			oldEnd += closing + 1
+		}
+		for i := len(args) - 1; i >= 0; i-- {
+			rest = rest[:args[i].start] + values[i] + rest[args[i].end:]
+		}
+		newEnd := oldEnd + len(rest) - len(code[match[1]:])
+		record(KindCrossFile, call+code[match[1]:match[1]+oldEnd], call+rest[:newEnd])
+		code = code[:match[1]] + rest
+	}
+	return code
+}
+
+// renamePath returns ref with the key renamed when ref is the key or below it
+func (r *renamer) renamePath(ref string) (string, bool) {
+	path := strings.Split(ref, ".")
+	if !hasPrefix(path, r.old) {
+		return "", false
+	}
+	path[len(r.old)-1] = r.new[len(r.new)-1]
+	return strings.Join(path, "."), true
+}
+
+// hasPrefix reports whether path starts with the segments of prefix. A
+// leading $ on the first segment is ignored, as $name and name are the same
+// global.
+func hasPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i, segment := range prefix {
+		if i == 0 {
+			if strings.TrimPrefix(path[0], "$") != segment {
+				return false
+			}
+			continue
+		}
+		if path[i] != segment {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceSubmatch replaces the first submatch of each match of pattern
+// when fn accepts it
+func replaceSubmatch(pattern *regexp.Regexp, s string, fn func(string) (string, bool)) string {
+	matches := pattern.FindAllStringSubmatchIndex(s, -1)
+	for m := len(matches) - 1; m >= 0; m-- {
+		start, end := matches[m][2], matches[m][3]
+		if replacement, ok := fn(s[start:end]); ok {
+			s = s[:start] + replacement + s[end:]
+		}
+	}
+	return s
+}
+
+// stringArg is a quoted argument; start and end delimit its contents
+type stringArg struct {
+	value      string
+	start, end int
+}
+
+// parseStringArgs parses the leading quoted arguments of a call whose
+// opening parenthesis has been consumed
+func parseStringArgs(s string) []stringArg {
+	var args []stringArg
+	i := 0
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+		if i >= len(s) || (s[i] != '"' && s[i] != '\'') {
+			return args
+		}
+		quote := s[i]
+		closing := strings.IndexByte(s[i+1:], quote)
+		if closing == -1 {
+			return args
+		}
+		args = append(args, stringArg{value: s[i+1 : i+1+closing], start: i + 1, end: i + 1 + closing})
+		i += closing + 2
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+		if i >= len(s) || s[i] != ',' {
+			return args
+		}
+		i++
+	}
+}
@@ -0,0 +1,144 @@
+package refactor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRename(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peanu.tsk"), `[database]
+host: "localhost"  # primary
+port: 5432
+url: "postgres://${database.host}:5432"
+`)
+	writeFile(t, filepath.Join(root, "api", "peanu.tsk"), `database {
+    host: "api-db"
+}
+upstream: @peanu.tsk.get("database", "host")
+mirror: @other.tsk.get("database.host")
+`)
+	writeFile(t, filepath.Join(root, "app.tsk"), `banner: "db at $database.host"
+`)
+	writeFile(t, filepath.Join(root, "schema.tsk"), `[database.host]
+type: "string"
+required: true
+
+[database.port]
+type: "int"
+`)
+	writeFile(t, filepath.Join(root, "access.policy.tsk"), `[database.host]
+readers: ["ops"]
+
+[audit]
+keys: ["database.host", "database.port"]
+`)
+
+	plan, err := Rename(root, "database.host", "database.hostname", Options{})
+	if err != nil {
+		t.Fatalf("Rename() returned error: %v", err)
+	}
+	kinds := make(map[string]int)
+	for _, change := range plan.Changes {
+		kinds[change.Kind]++
+	}
+	want := map[string]int{KindDefinition: 2, KindInterpolation: 1, KindCrossFile: 1, KindVariable: 1, KindSchema: 1, KindPolicy: 2}
+	for kind, n := range want {
+		if kinds[kind] != n {
+			t.Errorf("expected %d %s changes, got %d: %+v", n, kind, kinds[kind], plan.Changes)
+		}
+	}
+	if !strings.Contains(plan.Diff(), "-host: \"localhost\"  # primary\n+hostname: \"localhost\"  # primary\n") {
+		t.Errorf("diff does not show the renamed definition:\n%s", plan.Diff())
+	}
+	if got := readFile(t, filepath.Join(root, "peanu.tsk")); !strings.Contains(got, "host: ") {
+		t.Fatal("Rename() must not write files")
+	}
+
+	if _, err := plan.Apply(); err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+	checks := map[string][]string{
+		"peanu.tsk":         {"hostname: \"localhost\"  # primary", "${database.hostname}"},
+		"api/peanu.tsk":     {"    hostname: \"api-db\"", `@peanu.tsk.get("database", "hostname")`, `@other.tsk.get("database.host")`},
+		"app.tsk":           {"$database.hostname"},
+		"schema.tsk":        {"[database.hostname]", "[database.port]"},
+		"access.policy.tsk": {"[database.hostname]", `["database.hostname", "database.port"]`},
+	}
+	for file, wants := range checks {
+		got := readFile(t, filepath.Join(root, file))
+		for _, w := range wants {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: expected %q in:\n%s", file, w, got)
+			}
+		}
+	}
+
+	if _, err := Rename(root, "database.port", "database.hostname", Options{}); err == nil {
+		t.Error("expected an error renaming onto an existing key")
+	}
+	if _, err := Rename(root, "database.missing", "database.other", Options{}); err == nil {
+		t.Error("expected an error renaming an undefined key")
+	}
+	if _, err := Rename(root, "database.port", "cache.port", Options{}); err == nil {
+		t.Error("expected an error moving a key to another section")
+	}
+}
+
+func TestRenameSectionAndAlias(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "peanu.tsk"), "$environment: \"production\"\n[db]\nhost: \"localhost\"\ndebug: $environment == \"dev\"\n")
+
+	plan, err := Rename(root, "db", "database", Options{})
+	if err != nil {
+		t.Fatalf("Rename() returned error: %v", err)
+	}
+	if _, err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(root, "peanu.tsk")); !strings.Contains(got, "[database]\nhost:") {
+		t.Errorf("section not renamed:\n%s", got)
+	}
+
+	if _, err := Rename(root, "database", "store", Options{Alias: true}); err == nil {
+		t.Error("expected an error aliasing a section")
+	}
+
+	plan, err = Rename(root, "environment", "env", Options{Alias: true})
+	if err != nil {
+		t.Fatalf("Rename() returned error: %v", err)
+	}
+	if _, err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	got := readFile(t, filepath.Join(root, "peanu.tsk"))
+	for _, w := range []string{
+		"$env: \"production\"\n$environment: \"production\"  # deprecated: renamed to env\n",
+		"debug: $env == \"dev\"",
+	} {
+		if !strings.Contains(got, w) {
+			t.Errorf("expected %q in:\n%s", w, got)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package refactor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+)
+
+// fileRole is how a file refers to configuration keys
+type fileRole int
+
+const (
+	// roleConfig files define keys
+	roleConfig fileRole = iota
+	// roleSchema files describe keys in [path] sections
+	roleSchema
+	// rolePolicy files name keys in [path] sections and quoted strings
+	rolePolicy
+)
+
+// roleOf classifies a file by name: schema.tsk and *.schema.tsk are
+// schemas, policy.tsk and *.policy.tsk are policies
+func roleOf(path string) fileRole {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	switch {
+	case name == "schema" || strings.HasSuffix(name, ".schema"):
+		return roleSchema
+	case name == "policy" || strings.HasSuffix(name, ".policy"):
+		return rolePolicy
+	}
+	return roleConfig
+}
+
+// source is one file being refactored
+type source struct {
+	path string
+	// name is path relative to the scanned root
+	name  string
+	lines []string
+	// newline records whether the file ends with a newline
+	newline bool
+	mode    fs.FileMode
+	role    fileRole
+}
+
+// readSource reads a file under root for refactoring
+func readSource(root, path string) (*source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	name, err := filepath.Rel(root, path)
+	if err != nil {
+		name = path
+	}
+	content := string(data)
+	newline := strings.HasSuffix(content, "\n")
+	return &source{
+		path:    path,
+		name:    filepath.ToSlash(name),
+		lines:   strings.Split(strings.TrimSuffix(content, "\n"), "\n"),
+		newline: newline,
+		mode:    info.Mode().Perm(),
+		role:    roleOf(path),
+	}, nil
+}
+
+// Kinds of token
+const (
+	tokenSection = iota // [name]
+	tokenBlock          // name { or name >
+	tokenKey            // name: value
+)
+
+// token is a key or section name as written in a file
+type token struct {
+	kind int
+	line int
+	// prefix is the path of the section and blocks enclosing the name
+	prefix []string
+	// name is the name as written, without a merge annotation; it may be dotted
+	name string
+	// start and end delimit name in the line
+	start, end int
+	// value is set for keys with a value on the same line
+	value bool
+}
+
+// path returns the full dotted path of the token
+func (t *token) path() []string {
+	return append(append([]string(nil), t.prefix...), strings.Split(t.name, ".")...)
+}
+
+// lineInfo is what scan found on one line
+type lineInfo struct {
+	token *token
+	// refStart and codeEnd delimit the part of the line that may hold
+	// references: the value of a key or a list item, without any comment.
+	// refStart is -1 when there is none.
+	refStart, codeEnd int
+}
+
+// tokens returns the names the file defines
+func (s *source) tokens() []*token {
+	var tokens []*token
+	for _, info := range s.scan() {
+		if info.token != nil {
+			tokens = append(tokens, info.token)
+		}
+	}
+	return tokens
+}
+
+// scan walks the file with the nesting rules of config.LoadTSK and
+// returns, for each line, the name it defines and where its value is
+func (s *source) scan() []lineInfo {
+	infos := make([]lineInfo, len(s.lines))
+	for i := range infos {
+		infos[i].refStart = -1
+	}
+	for _, d := range config.Scan(s.lines) {
+		info := &infos[d.Line-1]
+		switch d.Kind {
+		case config.DeclSection:
+			info.token = &token{kind: tokenSection, line: d.Line - 1, name: d.Name, start: d.NameStart, end: d.NameStart + len(d.Name)}
+		case config.DeclBlock:
+			info.token = &token{kind: tokenBlock, line: d.Line - 1, prefix: d.Prefix, name: d.Name, start: d.NameStart, end: d.NameStart + len(d.Name)}
+		case config.DeclKey:
+			info.token = &token{kind: tokenKey, line: d.Line - 1, prefix: d.Prefix, name: d.Name, start: d.NameStart, end: d.NameStart + len(d.Name), value: d.Value != ""}
+			info.refStart, info.codeEnd = d.ValueStart, d.ValueEnd
+		case config.DeclItem:
+			info.refStart, info.codeEnd = d.ValueStart, d.ValueEnd
+		}
+	}
+	return infos
+}
@@ -0,0 +1,60 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// client sends requests to the first of a cluster's endpoints that answers
+type client struct {
+	endpoints []string
+	http      *http.Client
+	// current is the endpoint that answered last, tried first
+	current int
+}
+
+func newClient(endpoints []string) *client {
+	trimmed := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		trimmed[i] = strings.TrimRight(endpoint, "/")
+	}
+	return &client{endpoints: trimmed, http: &http.Client{}}
+}
+
+// do sends a request to path, moving on to the next endpoint while one
+// cannot be reached. prepare sets the headers of each attempt.
+func (c *client) do(ctx context.Context, method, path string, body []byte, prepare func(*http.Request)) (*http.Response, error) {
+	var lastErr error
+	for i := range c.endpoints {
+		n := (c.current + i) % len(c.endpoints)
+		req, err := http.NewRequestWithContext(ctx, method, c.endpoints[n]+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if prepare != nil {
+			prepare(req)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = fmt.Errorf("failed to reach %s: %w", req.URL.Host, err)
+			continue
+		}
+		c.current = n
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// responseError describes a failed response, closing its body
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("%s returned %s: %s", resp.Request.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,141 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// consulWait is how long one blocking query waits for a change
+const consulWait = 5 * time.Minute
+
+// consulStore talks to the Consul KV HTTP API
+type consulStore struct {
+	client *client
+	token  string
+}
+
+func newConsul(endpoints []string) *consulStore {
+	if len(endpoints) == 0 {
+		endpoints = []string{firstNonEmpty(os.Getenv("CONSUL_HTTP_ADDR"), "http://127.0.0.1:8500")}
+	}
+	for i, endpoint := range endpoints {
+		// CONSUL_HTTP_ADDR is often given without a scheme
+		if !strings.Contains(endpoint, "://") {
+			endpoints[i] = "http://" + endpoint
+		}
+	}
+	return &consulStore{client: newClient(endpoints), token: os.Getenv("CONSUL_HTTP_TOKEN")}
+}
+
+func (s *consulStore) request(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	path := "/v1/kv/" + strings.TrimLeft(key, "/")
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return s.client.do(ctx, method, path, body, func(req *http.Request) {
+		if s.token != "" {
+			req.Header.Set("X-Consul-Token", s.token)
+		}
+	})
+}
+
+// list reads the keys under prefix, blocking until the index passes index
+// when it is not zero
+func (s *consulStore) list(ctx context.Context, prefix string, index uint64) (map[string][]byte, uint64, error) {
+	query := url.Values{"recurse": {"true"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWait.String())
+	}
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	resp, err := s.request(ctx, http.MethodGet, dir, query, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return nil, 0, responseError(resp)
+	}
+	defer resp.Body.Close()
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	entries := make(map[string][]byte)
+	if resp.StatusCode == http.StatusNotFound {
+		return entries, next, nil
+	}
+	var pairs []struct {
+		Key   string
+		Value []byte
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	for _, pair := range pairs {
+		key, ok := strings.CutPrefix(pair.Key, dir)
+		// Folders are keys ending in / without a value
+		if !ok || key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+		entries[key] = pair.Value
+	}
+	return entries, next, nil
+}
+
+func (s *consulStore) List(ctx context.Context, prefix string) (map[string][]byte, uint64, error) {
+	return s.list(ctx, prefix, 0)
+}
+
+func (s *consulStore) Put(ctx context.Context, key string, value []byte) error {
+	return s.write(ctx, http.MethodPut, key, value)
+}
+
+func (s *consulStore) Delete(ctx context.Context, key string) error {
+	return s.write(ctx, http.MethodDelete, key, nil)
+}
+
+func (s *consulStore) write(ctx context.Context, method, key string, value []byte) error {
+	resp, err := s.request(ctx, method, key, nil, value)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Wait runs blocking queries until the index of prefix moves past index.
+// Consul may return before anything changed, so the index is compared
+// rather than trusted.
+func (s *consulStore) Wait(ctx context.Context, prefix string, index uint64) (uint64, error) {
+	if index == 0 {
+		index = 1
+	}
+	for {
+		_, next, err := s.list(ctx, prefix, index)
+		if err != nil {
+			return index, err
+		}
+		// A lower index means the cluster was reset; start over
+		if next != index {
+			return next, nil
+		}
+	}
+}
+
+// firstNonEmpty returns the first value that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
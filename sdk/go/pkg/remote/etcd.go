@@ -0,0 +1,205 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// etcdStore talks to the JSON gateway of etcd v3, which every etcd server
+// serves next to gRPC. Keys and values travel base64-encoded, which
+// encoding/json does for []byte; 64-bit numbers travel as strings.
+type etcdStore struct {
+	client             *client
+	username, password string
+
+	mu    sync.Mutex
+	token string
+}
+
+func newEtcd(endpoints []string) *etcdStore {
+	if len(endpoints) == 0 {
+		endpoints = strings.Split(firstNonEmpty(os.Getenv("ETCDCTL_ENDPOINTS"), "http://127.0.0.1:2379"), ",")
+	}
+	return &etcdStore{
+		client:   newClient(endpoints),
+		username: os.Getenv("ETCD_USERNAME"),
+		password: os.Getenv("ETCD_PASSWORD"),
+	}
+}
+
+type etcdHeader struct {
+	Revision string `json:"revision"`
+}
+
+type etcdKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// call posts request to a gateway path and returns the response, signing
+// in first when a username is set
+func (s *etcdStore) call(ctx context.Context, path string, request interface{}) (*http.Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		token, err := s.authenticate(ctx, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.client.do(ctx, http.MethodPost, path, body, func(req *http.Request) {
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", token)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Tokens expire; sign in again once
+		if resp.StatusCode == http.StatusUnauthorized && token != "" && attempt == 0 {
+			resp.Body.Close()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, responseError(resp)
+		}
+		return resp, nil
+	}
+}
+
+// authenticate returns the token to send, fetching a new one when renew is
+// set or there is none yet
+func (s *etcdStore) authenticate(ctx context.Context, renew bool) (string, error) {
+	if s.username == "" {
+		return "", nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && !renew {
+		return s.token, nil
+	}
+	body, _ := json.Marshal(map[string]string{"name": s.username, "password": s.password})
+	resp, err := s.client.do(ctx, http.MethodPost, "/v3/auth/authenticate", body, nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("etcd sign-in failed: %w", responseError(resp))
+	}
+	defer resp.Body.Close()
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	s.token = auth.Token
+	return s.token, nil
+}
+
+func (s *etcdStore) List(ctx context.Context, prefix string) (map[string][]byte, uint64, error) {
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	resp, err := s.call(ctx, "/v3/kv/range", map[string][]byte{"key": []byte(dir), "range_end": rangeEnd(dir)})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Header etcdHeader     `json:"header"`
+		Kvs    []etcdKeyValue `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	revision, _ := strconv.ParseUint(result.Header.Revision, 10, 64)
+	entries := make(map[string][]byte, len(result.Kvs))
+	for _, kv := range result.Kvs {
+		if key := strings.TrimPrefix(string(kv.Key), dir); key != "" {
+			entries[key] = kv.Value
+		}
+	}
+	return entries, revision, nil
+}
+
+func (s *etcdStore) Put(ctx context.Context, key string, value []byte) error {
+	resp, err := s.call(ctx, "/v3/kv/put", map[string][]byte{"key": []byte(key), "value": value})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *etcdStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.call(ctx, "/v3/kv/deleterange", map[string][]byte{"key": []byte(key)})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Wait opens a watch from the revision after index and returns the revision
+// of the first events it streams
+func (s *etcdStore) Wait(ctx context.Context, prefix string, index uint64) (uint64, error) {
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	create := map[string]interface{}{"key": []byte(dir), "range_end": rangeEnd(dir)}
+	if index > 0 {
+		create["start_revision"] = strconv.FormatUint(index+1, 10)
+	}
+	resp, err := s.call(ctx, "/v3/watch", map[string]interface{}{"create_request": create})
+	if err != nil {
+		return index, err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Result struct {
+				Header   etcdHeader        `json:"header"`
+				Events   []json.RawMessage `json:"events"`
+				Canceled bool              `json:"canceled"`
+				Reason   string            `json:"cancel_reason"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := dec.Decode(&message); err != nil {
+			if ctx.Err() != nil {
+				return index, ctx.Err()
+			}
+			return index, fmt.Errorf("etcd watch ended: %w", err)
+		}
+		switch {
+		case message.Error != nil:
+			return index, fmt.Errorf("etcd watch failed: %s", message.Error.Message)
+		case message.Result.Canceled:
+			return index, fmt.Errorf("etcd canceled the watch: %s", message.Result.Reason)
+		case len(message.Result.Events) > 0:
+			revision, _ := strconv.ParseUint(message.Result.Header.Revision, 10, 64)
+			return revision, nil
+		}
+	}
+}
+
+// rangeEnd returns the end of the key range starting with prefix, the
+// prefix with its last byte incremented
+func rangeEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// All 0xff: the range runs to the end of the keyspace
+	return []byte{0}
+}
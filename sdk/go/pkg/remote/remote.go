@@ -0,0 +1,403 @@
+// Package remote keeps configuration in etcd or Consul KV, for `tsk remote`
+// and for applications loading it at startup. A hierarchy is pushed as one
+// entry per key under a prefix, its raw value JSON-encoded, so operators
+// still run where the configuration is loaded. Load reads the store first
+// and falls back to the last copy it pulled, then to the local files, when
+// the store cannot be reached.
+//
+// The store is set in the [remote] section of the local hierarchy, which is
+// never pushed:
+//
+//	[remote]
+//	backend: "consul"
+//	endpoints: ["http://consul-1:8500", "http://consul-2:8500"]
+//	prefix: "tusk/api"
+//	timeout: "3s"
+//
+// Credentials come from the environment: Consul reads CONSUL_HTTP_TOKEN,
+// etcd reads ETCD_USERNAME and ETCD_PASSWORD. Without endpoints Consul uses
+// CONSUL_HTTP_ADDR and etcd ETCDCTL_ENDPOINTS, then their local defaults.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+// Backends, as named in remote.backend
+const (
+	Etcd   = "etcd"
+	Consul = "consul"
+)
+
+// Section is the configuration section holding the store settings
+const Section = "remote"
+
+// DefaultTimeout bounds each request Load makes before falling back
+const DefaultTimeout = 3 * time.Second
+
+// CacheFile is where Load keeps the last configuration it pulled, relative
+// to the directory it loads
+var CacheFile = filepath.Join(".tsk", "remote.pnt")
+
+// Options selects a store and where the configuration lives in it
+type Options struct {
+	Backend   string
+	Endpoints []string
+	// Prefix is the path the keys are stored under, without a trailing /
+	Prefix  string
+	Timeout time.Duration
+}
+
+// OptionsFrom reads Options from the flat remote.* keys of a configuration
+func OptionsFrom(values map[string]interface{}) (Options, error) {
+	var opts Options
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, Section+".")
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		switch setting {
+		case "backend":
+			opts.Backend = text
+		case "endpoints":
+			switch v := value.(type) {
+			case string:
+				opts.Endpoints = []string{v}
+			case []interface{}:
+				for _, item := range v {
+					opts.Endpoints = append(opts.Endpoints, fmt.Sprint(item))
+				}
+			default:
+				return opts, fmt.Errorf("remote.endpoints: expected a string or array, got %v", value)
+			}
+		case "prefix":
+			opts.Prefix = text
+		case "timeout":
+			timeout, err := time.ParseDuration(text)
+			if err != nil {
+				return opts, fmt.Errorf("remote.timeout: %w", err)
+			}
+			opts.Timeout = timeout
+		default:
+			return opts, fmt.Errorf("unknown setting remote.%s", setting)
+		}
+	}
+	return opts, nil
+}
+
+// Store is a key-value store holding configuration
+type Store interface {
+	// List returns the entries under prefix, keyed relative to it, and
+	// the index of the store's current state
+	List(ctx context.Context, prefix string) (map[string][]byte, uint64, error)
+	Put(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+	// Wait blocks until an entry under prefix changes after index and
+	// returns the new index
+	Wait(ctx context.Context, prefix string, index uint64) (uint64, error)
+}
+
+// Open returns the store opts select
+func Open(opts Options) (Store, error) {
+	switch opts.Backend {
+	case Consul:
+		return newConsul(opts.Endpoints), nil
+	case Etcd:
+		return newEtcd(opts.Endpoints), nil
+	case "":
+		return nil, fmt.Errorf("no remote backend: set %s.backend to %s or %s", Section, Etcd, Consul)
+	}
+	return nil, fmt.Errorf("unknown remote backend %q (use %s or %s)", opts.Backend, Etcd, Consul)
+}
+
+// entryKey returns the store key of a configuration key
+func entryKey(prefix, key string) string {
+	return strings.TrimSuffix(prefix, "/") + "/" + key
+}
+
+// PushReport lists what a push changed in the store
+type PushReport struct {
+	Prefix    string   `json:"prefix"`
+	Put       []string `json:"put"`
+	Deleted   []string `json:"deleted"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// Push makes the entries under prefix match values: changed and new keys
+// are written, keys values no longer has are deleted. The [remote] section
+// stays local.
+func Push(ctx context.Context, store Store, prefix string, values map[string]interface{}) (*PushReport, error) {
+	current, _, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	report := &PushReport{Prefix: prefix, Put: []string{}, Deleted: []string{}}
+	for _, key := range sortedKeys(values) {
+		if key == Section || strings.HasPrefix(key, Section+".") {
+			continue
+		}
+		data, err := json.Marshal(values[key])
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", key, err)
+		}
+		if existing, ok := current[key]; ok && bytes.Equal(existing, data) {
+			report.Unchanged++
+			continue
+		}
+		if err := store.Put(ctx, entryKey(prefix, key), data); err != nil {
+			return report, err
+		}
+		report.Put = append(report.Put, key)
+	}
+	for key := range current {
+		if _, ok := values[key]; !ok {
+			if err := store.Delete(ctx, entryKey(prefix, key)); err != nil {
+				return report, err
+			}
+			report.Deleted = append(report.Deleted, key)
+		}
+	}
+	sort.Strings(report.Deleted)
+	return report, nil
+}
+
+// Pull returns the configuration under prefix and the store index it was
+// read at
+func Pull(ctx context.Context, store Store, prefix string) (map[string]interface{}, uint64, error) {
+	entries, index, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, 0, err
+	}
+	values := make(map[string]interface{}, len(entries))
+	for key, data := range entries {
+		value, err := decodeValue(data)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", entryKey(prefix, key), err)
+		}
+		values[key] = value
+	}
+	return values, index, nil
+}
+
+// decodeValue decodes an entry, keeping whole numbers ints as TSK has them
+func decodeValue(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return numbers(value), nil
+}
+
+func numbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil && int64(int(i)) == i {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, item := range v {
+			v[i] = numbers(item)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = numbers(item)
+		}
+	}
+	return value
+}
+
+// Origin is where Load found the configuration
+type Origin string
+
+// Origins of a loaded configuration
+const (
+	FromRemote Origin = "remote"
+	// FromCache is the last configuration pulled from the store
+	FromCache Origin = "cache"
+	FromLocal Origin = "local"
+)
+
+// Loaded is the outcome of Load
+type Loaded struct {
+	Config *peanut.Config
+	Origin Origin
+	// Index is the store index of a remote configuration, to Watch from
+	Index uint64
+	// Err is why the store was not used when it is configured
+	Err error
+}
+
+// Load loads the configuration of dir from the store its [remote] section
+// names, keeping a copy in CacheFile. When the store cannot be reached it
+// loads that copy, and without one the local hierarchy. A hierarchy with no
+// [remote] backend is simply loaded.
+func Load(ctx context.Context, dir string) (*Loaded, error) {
+	local, _, err := peanut.LoadHierarchy(dir)
+	if err != nil {
+		return nil, err
+	}
+	localValues, err := local.Values()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := OptionsFrom(localValues)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Backend == "" {
+		return &Loaded{Config: local, Origin: FromLocal}, nil
+	}
+	store, err := Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	pullCtx, cancel := context.WithTimeout(ctx, timeout)
+	values, index, err := Pull(pullCtx, store, opts.Prefix)
+	cancel()
+	cache := filepath.Join(dir, CacheFile)
+	if err == nil && len(values) == 0 {
+		err = fmt.Errorf("nothing stored under %s", opts.Prefix)
+	}
+	if err != nil {
+		if cached, cacheErr := peanut.LoadFile(cache); cacheErr == nil {
+			local.Close()
+			return &Loaded{Config: cached, Origin: FromCache, Err: err}, nil
+		}
+		return &Loaded{Config: local, Origin: FromLocal, Err: err}, nil
+	}
+
+	// The store does not hold [remote]; keep the local one so the
+	// configuration still says where it came from
+	for key, value := range localValues {
+		if strings.HasPrefix(key, Section+".") {
+			values[key] = value
+		}
+	}
+	local.Close()
+	cfg := peanut.FromValues(values)
+	if err := writeCache(cfg, cache); err != nil {
+		return &Loaded{Config: cfg, Origin: FromRemote, Index: index, Err: err}, nil
+	}
+	return &Loaded{Config: cfg, Origin: FromRemote, Index: index}, nil
+}
+
+// writeCache saves cfg to file, replacing it only once fully written
+func writeCache(cfg *peanut.Config, file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := cfg.WriteBinary(&buf, peanut.DefaultWriteOptions); err != nil {
+		return err
+	}
+	tmp := file + ".partial"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// Watch calls fn with the configuration under prefix each time it changes
+// after index, until ctx ends. Errors reaching the store are passed to fn
+// and retried after a pause.
+func Watch(ctx context.Context, store Store, prefix string, index uint64, fn func(values map[string]interface{}, err error)) error {
+	var last map[string]interface{}
+	for {
+		next, err := store.Wait(ctx, prefix, index)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			var values map[string]interface{}
+			if values, index, err = Pull(ctx, store, prefix); err == nil {
+				if index < next {
+					index = next
+				}
+				if !reflect.DeepEqual(values, last) {
+					last = values
+					fn(values, nil)
+				}
+				continue
+			}
+		}
+		fn(nil, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryPause):
+		}
+	}
+}
+
+// retryPause is how long Watch and Sync wait after a failed request
+var retryPause = 2 * time.Second
+
+// Sync pushes the hierarchy of dir to prefix now and again whenever its
+// files change, until ctx ends. load, when set, returns the values to push
+// in place of the reloaded hierarchy, to apply an environment overlay. fn
+// sees every push.
+func Sync(ctx context.Context, dir string, store Store, prefix string, load func() (map[string]interface{}, error), fn func(*PushReport, error)) error {
+	push := func(cfg *peanut.Config) {
+		var values map[string]interface{}
+		var err error
+		if load != nil {
+			values, err = load()
+		} else {
+			values, err = cfg.Values()
+		}
+		if err != nil {
+			fn(nil, err)
+			return
+		}
+		fn(Push(ctx, store, prefix, values))
+	}
+	w, err := peanut.Watch(dir, func(change peanut.ConfigChange) {
+		if change.Err != nil {
+			fn(nil, change.Err)
+			return
+		}
+		push(change.Config)
+	})
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	push(w.Config())
+	<-ctx.Done()
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
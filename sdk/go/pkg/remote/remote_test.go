@@ -0,0 +1,372 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKV is an in-memory store behind the fake servers
+type fakeKV struct {
+	mu      sync.Mutex
+	data    map[string][]byte
+	index   uint64
+	changed chan struct{}
+}
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{data: make(map[string][]byte), index: 1, changed: make(chan struct{})}
+}
+
+func (kv *fakeKV) set(key string, value []byte) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if value == nil {
+		delete(kv.data, key)
+	} else {
+		kv.data[key] = value
+	}
+	kv.index++
+	close(kv.changed)
+	kv.changed = make(chan struct{})
+}
+
+func (kv *fakeKV) snapshot(prefix string) (map[string][]byte, uint64, chan struct{}) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	entries := make(map[string][]byte)
+	for key, value := range kv.data {
+		if strings.HasPrefix(key, prefix) {
+			entries[key] = value
+		}
+	}
+	return entries, kv.index, kv.changed
+}
+
+// consulServer serves the parts of the Consul KV API the store uses
+func consulServer(t *testing.T, kv *fakeKV, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != token {
+			http.Error(w, "ACL not found", http.StatusForbidden)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			kv.set(key, body)
+			w.Write([]byte("true"))
+		case http.MethodDelete:
+			kv.set(key, nil)
+			w.Write([]byte("true"))
+		case http.MethodGet:
+			entries, index, changed := kv.snapshot(key)
+			if wait := r.URL.Query().Get("index"); wait != "" && wait == strconv.FormatUint(index, 10) {
+				select {
+				case <-changed:
+				case <-r.Context().Done():
+					return
+				}
+				entries, index, _ = kv.snapshot(key)
+			}
+			w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+			if len(entries) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var pairs []map[string]interface{}
+			for k, v := range entries {
+				pairs = append(pairs, map[string]interface{}{"Key": k, "Value": v, "ModifyIndex": index})
+			}
+			json.NewEncoder(w).Encode(pairs)
+		}
+	}))
+}
+
+// etcdServer serves the parts of the etcd v3 JSON gateway the store uses
+func etcdServer(t *testing.T, kv *fakeKV, username, password string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]json.RawMessage
+		json.NewDecoder(r.Body).Decode(&req)
+		field := func(raw json.RawMessage) []byte {
+			var b []byte
+			json.Unmarshal(raw, &b)
+			return b
+		}
+		if r.URL.Path == "/v3/auth/authenticate" {
+			var name, pass string
+			json.Unmarshal(req["name"], &name)
+			json.Unmarshal(req["password"], &pass)
+			if name != username || pass != password {
+				http.Error(w, `{"message":"authentication failed"}`, http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": "tok"})
+			return
+		}
+		if username != "" && r.Header.Get("Authorization") != "tok" {
+			http.Error(w, `{"message":"user name is empty"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v3/kv/put":
+			kv.set(string(field(req["key"])), field(req["value"]))
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		case "/v3/kv/deleterange":
+			kv.set(string(field(req["key"])), nil)
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		case "/v3/kv/range":
+			if end := string(field(req["range_end"])); end != "tusk/api0" {
+				t.Errorf("unexpected range_end %q", end)
+			}
+			entries, index, _ := kv.snapshot(string(field(req["key"])))
+			var kvs []map[string][]byte
+			for k, v := range entries {
+				kvs = append(kvs, map[string][]byte{"key": []byte(k), "value": v})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"header": map[string]string{"revision": strconv.FormatUint(index, 10)},
+				"kvs":    kvs,
+			})
+		case "/v3/watch":
+			var create struct {
+				Key   []byte `json:"key"`
+				Start string `json:"start_revision"`
+			}
+			json.Unmarshal(req["create_request"], &create)
+			_, index, changed := kv.snapshot(string(create.Key))
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]interface{}{"created": true}})
+			w.(http.Flusher).Flush()
+			if start, _ := strconv.ParseUint(create.Start, 10, 64); start > index {
+				select {
+				case <-changed:
+				case <-r.Context().Done():
+					return
+				}
+			}
+			_, index, _ = kv.snapshot(string(create.Key))
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]interface{}{
+				"header": map[string]string{"revision": strconv.FormatUint(index, 10)},
+				"events": []map[string]string{{"type": "PUT"}},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{
+		"remote.backend":   "etcd",
+		"remote.endpoints": []interface{}{"http://a:2379", "http://b:2379"},
+		"remote.prefix":    "tusk/api",
+		"remote.timeout":   "500ms",
+		"server.port":      8080,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Options{Backend: Etcd, Endpoints: []string{"http://a:2379", "http://b:2379"}, Prefix: "tusk/api", Timeout: 500 * time.Millisecond}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("OptionsFrom = %+v, want %+v", opts, want)
+	}
+	if _, err := OptionsFrom(map[string]interface{}{"remote.backned": "etcd"}); err == nil {
+		t.Error("expected an error for an unknown setting")
+	}
+	if _, err := Open(Options{Backend: "zookeeper"}); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+func TestPushPull(t *testing.T) {
+	values := map[string]interface{}{
+		"server.port":   8080,
+		"server.hosts":  []interface{}{"a", "b"},
+		"ratio":         0.5,
+		"debug":         false,
+		"db.password":   `@secret("db")`,
+		"remote.prefix": "tusk/api",
+	}
+	t.Setenv("ETCD_USERNAME", "root")
+	t.Setenv("ETCD_PASSWORD", "pw")
+	t.Setenv("CONSUL_HTTP_TOKEN", "acl")
+
+	for _, backend := range []string{Consul, Etcd} {
+		t.Run(backend, func(t *testing.T) {
+			kv := newFakeKV()
+			var server *httptest.Server
+			if backend == Consul {
+				server = consulServer(t, kv, "acl")
+			} else {
+				server = etcdServer(t, kv, "root", "pw")
+			}
+			defer server.Close()
+			// The first endpoint is down; the store moves on
+			store, err := Open(Options{Backend: backend, Endpoints: []string{"http://127.0.0.1:1", server.URL}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			report, err := Push(ctx, store, "tusk/api", values)
+			if err != nil {
+				t.Fatalf("Push returned error: %v", err)
+			}
+			if len(report.Put) != 5 || len(report.Deleted) != 0 {
+				t.Errorf("unexpected first push %+v", report)
+			}
+			if string(kv.data["tusk/api/server.hosts"]) != `["a","b"]` {
+				t.Errorf("unexpected stored list %q", kv.data["tusk/api/server.hosts"])
+			}
+
+			pulled, index, err := Pull(ctx, store, "tusk/api")
+			if err != nil {
+				t.Fatalf("Pull returned error: %v", err)
+			}
+			want := map[string]interface{}{}
+			for k, v := range values {
+				if !strings.HasPrefix(k, "remote.") {
+					want[k] = v
+				}
+			}
+			if !reflect.DeepEqual(pulled, want) {
+				t.Errorf("Pull = %#v, want %#v", pulled, want)
+			}
+
+			changed := map[string]interface{}{"server.port": 9090, "server.hosts": []interface{}{"a", "b"}}
+			report, err = Push(ctx, store, "tusk/api", changed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(report.Deleted)
+			if !reflect.DeepEqual(report.Put, []string{"server.port"}) || report.Unchanged != 1 ||
+				!reflect.DeepEqual(report.Deleted, []string{"db.password", "debug", "ratio"}) {
+				t.Errorf("unexpected second push %+v", report)
+			}
+
+			// Watch sees a change made after the index it starts from
+			watchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			_, index, _ = Pull(ctx, store, "tusk/api")
+			got := make(chan map[string]interface{}, 1)
+			go Watch(watchCtx, store, "tusk/api", index, func(values map[string]interface{}, err error) {
+				if err != nil {
+					t.Errorf("Watch reported %v", err)
+					return
+				}
+				got <- values
+				cancel()
+			})
+			time.Sleep(50 * time.Millisecond)
+			kv.set("tusk/api/server.port", []byte("7070"))
+			select {
+			case values := <-got:
+				if values["server.port"] != 7070 {
+					t.Errorf("Watch delivered %v", values)
+				}
+			case <-watchCtx.Done():
+				t.Fatal("Watch did not see the change")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	kv := newFakeKV()
+	server := consulServer(t, kv, "")
+	dir := t.TempDir()
+	local := "name: \"local\"\n\n[remote]\nbackend: \"consul\"\nendpoints: \"" + server.URL + "\"\nprefix: \"tusk/api\"\ntimeout: \"1s\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kv.set("tusk/api/name", []byte(`"remote"`))
+	ctx := context.Background()
+
+	loaded, err := Load(ctx, dir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if loaded.Origin != FromRemote || loaded.Err != nil || loaded.Config.GetString("name", "") != "remote" ||
+		loaded.Config.GetString("remote.prefix", "") != "tusk/api" {
+		t.Errorf("unexpected remote load %+v", loaded)
+	}
+	if _, err := os.Stat(filepath.Join(dir, CacheFile)); err != nil {
+		t.Errorf("no cache written: %v", err)
+	}
+
+	// Offline: the cached copy wins over the local files
+	server.Close()
+	loaded, err = Load(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Origin != FromCache || loaded.Err == nil || loaded.Config.GetString("name", "") != "remote" {
+		t.Errorf("unexpected offline load %+v", loaded)
+	}
+	loaded.Config.Close()
+
+	os.Remove(filepath.Join(dir, CacheFile))
+	loaded, err = Load(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Origin != FromLocal || loaded.Config.GetString("name", "") != "local" {
+		t.Errorf("unexpected fallback load %+v", loaded)
+	}
+}
+
+func TestSync(t *testing.T) {
+	kv := newFakeKV()
+	server := consulServer(t, kv, "")
+	defer server.Close()
+	store, _ := Open(Options{Backend: Consul, Endpoints: []string{server.URL}})
+	dir := t.TempDir()
+	file := filepath.Join(dir, "peanu.tsk")
+	if err := os.WriteFile(file, []byte("port: 8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pushes := make(chan *PushReport, 4)
+	go Sync(ctx, dir, store, "tusk/api", nil, func(report *PushReport, err error) {
+		if err != nil {
+			t.Errorf("Sync reported %v", err)
+			return
+		}
+		pushes <- report
+	})
+	next := func() *PushReport {
+		select {
+		case report := <-pushes:
+			return report
+		case <-ctx.Done():
+			t.Fatal("no push")
+			return nil
+		}
+	}
+	if report := next(); !reflect.DeepEqual(report.Put, []string{"port"}) {
+		t.Errorf("unexpected first push %+v", report)
+	}
+	if err := os.WriteFile(file, []byte("port: 9090\nname: \"api\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if report := next(); !reflect.DeepEqual(report.Put, []string{"name", "port"}) {
+		t.Errorf("unexpected push after the edit %+v", report)
+	}
+	entries, _, _ := kv.snapshot("tusk/api/")
+	if string(entries["tusk/api/port"]) != "9090" {
+		t.Errorf("store holds %q", entries["tusk/api/port"])
+	}
+}
@@ -0,0 +1,427 @@
+package render
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TranslateJinja translates a template in a Jinja-like syntax to Go
+// text/template. The subset covers what configuration templates need:
+//
+//	{{ database.host }}                    values by path
+//	{{ name | upper }}, {{ s | indent(4) }} helpers as filters
+//	{% if a == "x" and not b %}...{% elif c %}...{% else %}...{% endif %}
+//	{% for host in hosts %}...{% endfor %} and {% for k, v in section %}
+//	{% set port = server.port %}
+//	{# comments #} and {%- -%} whitespace control
+//
+// Filters are the helpers of Funcs, the filtered value passed last.
+func TranslateJinja(source string) (string, error) {
+	t := &jinjaTranslator{}
+	var out strings.Builder
+	for len(source) > 0 {
+		start := strings.Index(source, "{")
+		for start != -1 && (start+1 >= len(source) || !strings.ContainsRune("{%#", rune(source[start+1]))) {
+			next := strings.Index(source[start+1:], "{")
+			if next == -1 {
+				start = -1
+			} else {
+				start += 1 + next
+			}
+		}
+		if start == -1 {
+			out.WriteString(source)
+			break
+		}
+		out.WriteString(source[:start])
+
+		kind := source[start+1]
+		closing := map[byte]string{'{': "}}", '%': "%}", '#': "#}"}[kind]
+		end := strings.Index(source[start+2:], closing)
+		if end == -1 {
+			return "", fmt.Errorf("line %d: unclosed {%c", strings.Count(out.String(), "\n")+1, kind)
+		}
+		body := source[start+2 : start+2+end]
+		source = source[start+2+end+2:]
+		if kind == '#' {
+			continue
+		}
+
+		trimLeft, trimRight := strings.HasPrefix(body, "-"), strings.HasSuffix(body, "-")
+		body = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(body, "-"), "-"))
+		var action string
+		var err error
+		if kind == '{' {
+			action, err = t.expression(body)
+		} else {
+			action, err = t.statement(body)
+		}
+		if err != nil {
+			return "", fmt.Errorf("line %d: %s: %w", strings.Count(out.String(), "\n")+1, body, err)
+		}
+
+		out.WriteString("{{")
+		if trimLeft {
+			out.WriteString("- ")
+		}
+		out.WriteString(action)
+		if trimRight {
+			out.WriteString(" -")
+		}
+		out.WriteString("}}")
+	}
+	if len(t.blocks) > 0 {
+		return "", fmt.Errorf("unclosed {%% %s %%}", t.blocks[len(t.blocks)-1])
+	}
+	return out.String(), nil
+}
+
+// jinjaTranslator tracks the open blocks and variables in scope
+type jinjaTranslator struct {
+	blocks []string
+	// vars holds, per open block plus the top level, the names it defines
+	vars []map[string]bool
+}
+
+func (t *jinjaTranslator) isVar(name string) bool {
+	for _, scope := range t.vars {
+		if scope[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *jinjaTranslator) define(name string) {
+	if len(t.vars) == 0 {
+		t.vars = append(t.vars, make(map[string]bool))
+	}
+	t.vars[len(t.vars)-1][name] = true
+}
+
+func (t *jinjaTranslator) expression(body string) (string, error) {
+	p := &jinjaParser{t: t, tokens: tokenizeJinja(body)}
+	expr, err := p.parseOr()
+	if err != nil {
+		return "", err
+	}
+	if p.pos < len(p.tokens) {
+		return "", fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+func (t *jinjaTranslator) statement(body string) (string, error) {
+	keyword, rest, _ := strings.Cut(body, " ")
+	rest = strings.TrimSpace(rest)
+	switch keyword {
+	case "if", "elif":
+		if keyword == "elif" && !t.inside("if") {
+			return "", fmt.Errorf("elif outside of if")
+		}
+		cond, err := t.expression(rest)
+		if err != nil {
+			return "", err
+		}
+		if keyword == "elif" {
+			return "else if " + cond, nil
+		}
+		t.open("if")
+		return "if " + cond, nil
+	case "else":
+		if !t.inside("if") && !t.inside("for") {
+			return "", fmt.Errorf("else outside of if or for")
+		}
+		return "else", nil
+	case "for":
+		names, over, ok := strings.Cut(rest, " in ")
+		if !ok {
+			return "", fmt.Errorf("expected for NAME in EXPRESSION")
+		}
+		collection, err := t.expression(strings.TrimSpace(over))
+		if err != nil {
+			return "", err
+		}
+		var vars []string
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if !isJinjaIdent(name) {
+				return "", fmt.Errorf("invalid loop variable %q", name)
+			}
+			vars = append(vars, "$"+name)
+		}
+		if len(vars) > 2 {
+			return "", fmt.Errorf("for takes one or two loop variables")
+		}
+		t.open("for")
+		for _, v := range vars {
+			t.define(v[1:])
+		}
+		return "range " + strings.Join(vars, ", ") + " := " + collection, nil
+	case "endif", "endfor":
+		want := strings.TrimPrefix(keyword, "end")
+		if len(t.blocks) == 0 || t.blocks[len(t.blocks)-1] != want {
+			return "", fmt.Errorf("%s without %s", keyword, want)
+		}
+		t.blocks = t.blocks[:len(t.blocks)-1]
+		t.vars = t.vars[:len(t.vars)-1]
+		return "end", nil
+	case "set":
+		name, value, ok := strings.Cut(rest, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !isJinjaIdent(name) {
+			return "", fmt.Errorf("expected set NAME = EXPRESSION")
+		}
+		expr, err := t.expression(strings.TrimSpace(value))
+		if err != nil {
+			return "", err
+		}
+		assign := ":="
+		if t.isVar(name) {
+			assign = "="
+		}
+		t.define(name)
+		return "$" + name + " " + assign + " " + expr, nil
+	}
+	return "", fmt.Errorf("unsupported statement %q", keyword)
+}
+
+func (t *jinjaTranslator) open(block string) {
+	if len(t.vars) == 0 {
+		t.vars = append(t.vars, make(map[string]bool))
+	}
+	t.blocks = append(t.blocks, block)
+	t.vars = append(t.vars, make(map[string]bool))
+}
+
+func (t *jinjaTranslator) inside(block string) bool {
+	return len(t.blocks) > 0 && t.blocks[len(t.blocks)-1] == block
+}
+
+// tokenizeJinja splits an expression into identifiers (dotted paths
+// included), literals and operators
+func tokenizeJinja(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			i++
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != ch {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			tokens = append(tokens, s[i:min(j+1, len(s))])
+			i = j + 1
+		case isJinjaIdentByte(ch) || ch == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && (isJinjaIdentByte(s[j]) || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			op := s[i : i+1]
+			for _, two := range []string{"==", "!=", "<=", ">="} {
+				if strings.HasPrefix(s[i:], two) {
+					op = two
+				}
+			}
+			tokens = append(tokens, op)
+			i += len(op)
+		}
+	}
+	return tokens
+}
+
+func isJinjaIdentByte(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
+
+func isJinjaIdent(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isJinjaIdentByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// jinjaParser translates one expression to a Go template pipeline
+type jinjaParser struct {
+	t      *jinjaTranslator
+	tokens []string
+	pos    int
+}
+
+func (p *jinjaParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *jinjaParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *jinjaParser) parseOr() (string, error) {
+	return p.parseBinary("or", p.parseAnd)
+}
+
+func (p *jinjaParser) parseAnd() (string, error) {
+	return p.parseBinary("and", p.parseNot)
+}
+
+func (p *jinjaParser) parseBinary(op string, operand func() (string, error)) (string, error) {
+	left, err := operand()
+	if err != nil {
+		return "", err
+	}
+	for p.peek() == op {
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + op + " " + left + " " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *jinjaParser) parseNot() (string, error) {
+	if p.peek() == "not" {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		return "(not " + operand + ")", nil
+	}
+	return p.parseComparison()
+}
+
+// comparisons maps Jinja comparison operators to template functions
+var comparisons = map[string]string{"==": "eq", "!=": "ne", "<": "lt", ">": "gt", "<=": "le", ">=": "ge"}
+
+func (p *jinjaParser) parseComparison() (string, error) {
+	left, err := p.parseFiltered()
+	if err != nil {
+		return "", err
+	}
+	fn, ok := comparisons[p.peek()]
+	if !ok {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseFiltered()
+	if err != nil {
+		return "", err
+	}
+	return "(" + fn + " " + left + " " + right + ")", nil
+}
+
+func (p *jinjaParser) parseFiltered() (string, error) {
+	value, err := p.parsePrimary()
+	if err != nil {
+		return "", err
+	}
+	for p.peek() == "|" {
+		p.next()
+		name := p.next()
+		if !isJinjaIdent(name) {
+			return "", fmt.Errorf("expected a filter name after |, got %q", name)
+		}
+		args, err := p.parseArgs()
+		if err != nil {
+			return "", err
+		}
+		value = "(" + strings.Join(append(append([]string{name}, args...), value), " ") + ")"
+	}
+	return value, nil
+}
+
+// parseArgs parses an optional (a, b) argument list
+func (p *jinjaParser) parseArgs() ([]string, error) {
+	if p.peek() != "(" {
+		return nil, nil
+	}
+	p.next()
+	var args []string
+	for p.peek() != ")" {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek() == "," {
+			p.next()
+		} else if p.peek() != ")" {
+			return nil, fmt.Errorf("expected , or ) in arguments, got %q", p.peek())
+		}
+	}
+	p.next()
+	return args, nil
+}
+
+func (p *jinjaParser) parsePrimary() (string, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return "", fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		expr, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if p.next() != ")" {
+			return "", fmt.Errorf("missing )")
+		}
+		return expr, nil
+	case tok[0] == '"' || tok[0] == '\'':
+		if len(tok) < 2 || tok[len(tok)-1] != tok[0] {
+			return "", fmt.Errorf("unterminated string %s", tok)
+		}
+		if tok[0] == '\'' {
+			return strconv.Quote(tok[1 : len(tok)-1]), nil
+		}
+		return tok, nil
+	case tok == "true" || tok == "false":
+		return tok, nil
+	case tok == "none" || tok == "None":
+		return "nil", nil
+	case tok[0] == '-' || tok[0] >= '0' && tok[0] <= '9':
+		return tok, nil
+	}
+
+	if p.peek() == "(" {
+		// A helper called as a function
+		args, err := p.parseArgs()
+		if err != nil {
+			return "", err
+		}
+		return "(" + strings.Join(append([]string{tok}, args...), " ") + ")", nil
+	}
+	first, rest, _ := strings.Cut(tok, ".")
+	if !isJinjaIdent(first) {
+		return "", fmt.Errorf("invalid name %q", tok)
+	}
+	path := "$." + tok
+	if p.t.isVar(first) {
+		path = "$" + first
+		if rest != "" {
+			path += "." + rest
+		}
+	}
+	return path, nil
+}
@@ -0,0 +1,247 @@
+// Package render renders text templates with a resolved configuration as
+// their data, for `tsk render`. Templates are Go text/template by default,
+// or a Jinja-like subset translated to it. Either way the configuration is
+// the dot, nested by section, so {{ .database.host }} prints database.host,
+// and these helpers are available:
+//
+//	indent N s / nindent N s   indent every line of s by N spaces (nindent adds a leading newline)
+//	quote s / squote s         wrap in double or single quotes
+//	b64enc s / b64dec s        base64 encode or decode
+//	toJSON v / toYAML v        encode a value or section
+//	default d v                v, or d when v is empty
+//	required msg v             v, or fail the render with msg when it is empty
+//	upper, lower, trim, replace OLD NEW s, join SEP list
+//	get "database.host"        a value by dotted key
+//	eval `@env("HOME")`        evaluate an operator expression
+//	op "env" "HOME"            call an operator with arguments
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"gopkg.in/yaml.v3"
+)
+
+// Syntax is the template language of a template
+type Syntax string
+
+// Supported syntaxes
+const (
+	SyntaxGo    Syntax = "go"
+	SyntaxJinja Syntax = "jinja"
+)
+
+// ParseSyntax converts a syntax name into a Syntax
+func ParseSyntax(name string) (Syntax, error) {
+	switch strings.ToLower(name) {
+	case "go", "gotemplate", "tmpl":
+		return SyntaxGo, nil
+	case "jinja", "jinja2", "j2":
+		return SyntaxJinja, nil
+	}
+	return "", fmt.Errorf("unsupported template syntax %q (use go or jinja)", name)
+}
+
+// SyntaxFor picks the syntax of a template file by its extension: .j2,
+// .jinja and .jinja2 are Jinja, everything else Go
+func SyntaxFor(file string) Syntax {
+	switch filepath.Ext(file) {
+	case ".j2", ".jinja", ".jinja2":
+		return SyntaxJinja
+	}
+	return SyntaxGo
+}
+
+// Options controls a render
+type Options struct {
+	Syntax Syntax
+	// Strict fails on keys the configuration does not have instead of
+	// printing "<no value>"
+	Strict bool
+}
+
+// Renderer renders templates against one configuration
+type Renderer struct {
+	vm *peanut.VM
+	// values are the resolved flat keys, data the same nested by section
+	values map[string]interface{}
+	data   map[string]interface{}
+}
+
+// New resolves every key of cfg with vm and returns a Renderer for it
+func New(cfg *peanut.Config, vm *peanut.VM) (*Renderer, error) {
+	values, err := cfg.Execute(vm)
+	if err != nil {
+		return nil, err
+	}
+	return &Renderer{vm: vm, values: values, data: config.Nest(values)}, nil
+}
+
+// Data returns the nested configuration templates see as the dot
+func (r *Renderer) Data() map[string]interface{} {
+	return r.data
+}
+
+// Render parses source, a template called name, and writes its output to w
+func (r *Renderer) Render(w io.Writer, name, source string, opts Options) error {
+	if opts.Syntax == SyntaxJinja {
+		translated, err := TranslateJinja(source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		source = translated
+	}
+
+	tmpl := template.New(name).Funcs(r.Funcs())
+	if opts.Strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	tmpl, err := tmpl.Parse(source)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	// Render to a buffer so a failed template writes nothing
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, r.data); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Funcs returns the helper functions templates can call
+func (r *Renderer) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"indent":  indent,
+		"nindent": func(n int, s interface{}) string { return "\n" + indent(n, s) },
+		"quote":   func(v interface{}) string { return strconv.Quote(toString(v)) },
+		"squote":  func(v interface{}) string { return "'" + toString(v) + "'" },
+		"b64enc":  func(v interface{}) string { return base64.StdEncoding.EncodeToString([]byte(toString(v))) },
+		"b64dec": func(v interface{}) (string, error) {
+			decoded, err := base64.StdEncoding.DecodeString(toString(v))
+			return string(decoded), err
+		},
+		"toJSON": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"toYAML": func(v interface{}) (string, error) {
+			data, err := yaml.Marshal(v)
+			return strings.TrimSuffix(string(data), "\n"), err
+		},
+		"default": func(def, v interface{}) interface{} {
+			if empty(v) {
+				return def
+			}
+			return v
+		},
+		"required": func(msg string, v interface{}) (interface{}, error) {
+			if empty(v) {
+				return nil, fmt.Errorf("%s", msg)
+			}
+			return v, nil
+		},
+		"upper":   func(v interface{}) string { return strings.ToUpper(toString(v)) },
+		"lower":   func(v interface{}) string { return strings.ToLower(toString(v)) },
+		"trim":    func(v interface{}) string { return strings.TrimSpace(toString(v)) },
+		"replace": func(old, new string, v interface{}) string { return strings.ReplaceAll(toString(v), old, new) },
+		"join":    join,
+		"get":     r.get,
+		"eval":    r.vm.Eval,
+		"op":      r.op,
+	}
+}
+
+// get returns the value or section at a dotted key, or nil
+func (r *Renderer) get(key string) interface{} {
+	if value, ok := r.values[key]; ok {
+		return value
+	}
+	var node interface{} = r.data
+	for _, segment := range strings.Split(key, ".") {
+		section, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = section[segment]
+	}
+	return node
+}
+
+// op calls operator name with args by compiling the call as an expression
+func (r *Renderer) op(name string, args ...interface{}) (interface{}, error) {
+	literals := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			literals[i] = strconv.Quote(v)
+		case bool, int, int64, float64:
+			literals[i] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("op %s: argument %d is a %T; only strings, numbers and booleans can be passed", name, i+1, arg)
+		}
+	}
+	return r.vm.Eval("@" + strings.TrimPrefix(name, "@") + "(" + strings.Join(literals, ", ") + ")")
+}
+
+// indent prefixes every line of s with n spaces
+func indent(n int, s interface{}) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(toString(s), "\n", "\n"+pad)
+}
+
+// join joins the items of a list with sep
+func join(sep string, list interface{}) string {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return toString(list)
+	}
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = toString(v.Index(i).Interface())
+	}
+	return strings.Join(items, sep)
+}
+
+// toString prints a value the way a template would
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// empty reports whether v is nil, false, zero or an empty string, list or map
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return rv.Int() == 0
+	case reflect.Float64, reflect.Float32:
+		return rv.Float() == 0
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func renderer(t *testing.T) *Renderer {
+	t.Helper()
+	t.Setenv("RENDER_TEST_HOST", "db.internal")
+	cfg := peanut.FromValues(map[string]interface{}{
+		"name":          "demo",
+		"database.host": `@env("RENDER_TEST_HOST", "localhost")`,
+		"database.port": 5432,
+		"hosts":         []interface{}{"a", "b"},
+		"debug":         false,
+		"motd":          "line one\nline two",
+	})
+	r, err := New(cfg, peanut.NewVM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func render(t *testing.T, r *Renderer, source string, opts Options) string {
+	t.Helper()
+	var out strings.Builder
+	if err := r.Render(&out, "test", source, opts); err != nil {
+		t.Fatalf("Render(%q): %v", source, err)
+	}
+	return out.String()
+}
+
+func TestRenderGo(t *testing.T) {
+	r := renderer(t)
+	tests := []struct{ source, want string }{
+		{`{{ .database.host }}:{{ .database.port }}`, "db.internal:5432"},
+		{`{{ .name | quote }} {{ .name | squote }} {{ .name | upper }}`, `"demo" 'demo' DEMO`},
+		{`{{ .name | b64enc }} {{ "ZGVtbw==" | b64dec }}`, "ZGVtbw== demo"},
+		{`motd:{{ .motd | nindent 2 }}`, "motd:\n  line one\n  line two"},
+		{`{{ .database | toJSON }}`, `{"host":"db.internal","port":5432}`},
+		{`{{ join "," .hosts }} {{ .debug | default "off" }}`, "a,b off"},
+		{`{{ get "database.port" }} {{ get "database" | toYAML | indent 2 }}`, "5432   host: db.internal\n  port: 5432"},
+		{"{{ eval `@env(\"RENDER_TEST_HOST\")` }} {{ op \"env\" \"MISSING_RENDER_VAR\" \"fallback\" }}", "db.internal fallback"},
+	}
+	for _, tt := range tests {
+		if got := render(t, r, tt.source, Options{}); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+
+	var out strings.Builder
+	if err := r.Render(&out, "test", `{{ .missing }}`, Options{Strict: true}); err == nil {
+		t.Error("expected --strict to fail on a missing key")
+	}
+	if err := r.Render(&out, "test", `{{ .debug | required "debug must be set" }}`, Options{}); err == nil || !strings.Contains(err.Error(), "debug must be set") {
+		t.Errorf("required: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("failed renders wrote %q", out.String())
+	}
+}
+
+func TestRenderJinja(t *testing.T) {
+	r := renderer(t)
+	source := `{# a comment #}host: {{ database.host | upper }}
+{% for h in hosts -%}
+- {{ h }}@{{ name }}
+{% endfor -%}
+{% if debug %}debug{% elif database.port == 5432 and not debug %}default port{% else %}custom{% endif %}
+{% set greeting = "hi " ~ name %}`
+	if _, err := TranslateJinja(source); err == nil {
+		t.Error("expected ~ to be rejected")
+	}
+
+	source = strings.Replace(source, `{% set greeting = "hi " ~ name %}`, `{% set port = database.port %}{{ port | quote }} {{ motd | indent(1) }}`, 1)
+	want := "host: DB.INTERNAL\n- a@demo\n- b@demo\ndefault port\n\"5432\"  line one\n line two"
+	if got := render(t, r, source, Options{Syntax: SyntaxJinja}); got != want {
+		t.Errorf("jinja render = %q, want %q", got, want)
+	}
+
+	for _, broken := range []string{`{% if debug %}`, `{% endfor %}`, `{{ name | }}`, `{% while x %}`, `{{ name`} {
+		if _, err := TranslateJinja(broken); err == nil {
+			t.Errorf("TranslateJinja(%q) should fail", broken)
+		}
+	}
+}
+
+func TestSyntaxFor(t *testing.T) {
+	if SyntaxFor("nginx.conf.j2") != SyntaxJinja || SyntaxFor("deploy.yaml.tmpl") != SyntaxGo {
+		t.Error("SyntaxFor picked the wrong syntax")
+	}
+	if _, err := ParseSyntax("mustache"); err == nil {
+		t.Error("expected an error for an unknown syntax")
+	}
+}
@@ -0,0 +1,466 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// JSONSchemaDraft is the JSON Schema dialect emitted by ToJSONSchema
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// ToJSONSchema converts the schema into a JSON Schema document.
+//
+// Dotted field paths become nested "object" schemas, and required fields are
+// listed in the "required" array of their parent object.
+func (s *Schema) ToJSONSchema() map[string]interface{} {
+	root := map[string]interface{}{
+		"$schema":    JSONSchemaDraft,
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+	if s.Title != "" {
+		root["title"] = s.Title
+	}
+	if s.Description != "" {
+		root["description"] = s.Description
+	}
+
+	for _, path := range s.Paths() {
+		f := s.Fields[path]
+		parent := root
+		parts := strings.Split(path, ".")
+		for _, part := range parts[:len(parts)-1] {
+			parent = childObject(parent, part)
+		}
+
+		name := parts[len(parts)-1]
+		props := parent["properties"].(map[string]interface{})
+		node, ok := props[name].(map[string]interface{})
+		if !ok {
+			node = map[string]interface{}{}
+			props[name] = node
+		}
+		for k, v := range f.jsonSchema() {
+			if _, exists := node[k]; exists && k == "properties" {
+				continue
+			}
+			node[k] = v
+		}
+
+		if f.Required {
+			required, _ := parent["required"].([]string)
+			parent["required"] = append(required, name)
+		}
+	}
+
+	return root
+}
+
+// MarshalJSONSchema renders the schema as indented JSON Schema
+func (s *Schema) MarshalJSONSchema() ([]byte, error) {
+	return json.MarshalIndent(s.ToJSONSchema(), "", "  ")
+}
+
+// jsonSchema returns the JSON Schema keywords for a single field
+func (f *Field) jsonSchema() map[string]interface{} {
+	node := map[string]interface{}{}
+	if t := jsonType(f.Type); t != "" {
+		node["type"] = t
+	}
+	if f.Type == TypeObject {
+		node["properties"] = map[string]interface{}{}
+	}
+	if f.Description != "" {
+		node["description"] = f.Description
+	}
+	if f.Default != nil {
+		node["default"] = f.Default
+	}
+	if len(f.Enum) > 0 {
+		node["enum"] = f.Enum
+	}
+	if f.Min != nil {
+		node["minimum"] = *f.Min
+	}
+	if f.Max != nil {
+		node["maximum"] = *f.Max
+	}
+	if f.MinLength != nil {
+		node["minLength"] = *f.MinLength
+	}
+	if f.MaxLength != nil {
+		node["maxLength"] = *f.MaxLength
+	}
+	if f.Pattern != "" {
+		node["pattern"] = f.Pattern
+	}
+	if f.Format != "" {
+		node["format"] = f.Format
+	}
+	if f.Type == TypeArray && f.Items != "" {
+		if t := jsonType(f.Items); t != "" {
+			node["items"] = map[string]interface{}{"type": t}
+		}
+	}
+	return node
+}
+
+// childObject returns the nested object schema for name, creating it if needed
+func childObject(parent map[string]interface{}, name string) map[string]interface{} {
+	props := parent["properties"].(map[string]interface{})
+	child, ok := props[name].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{"type": "object"}
+		props[name] = child
+	}
+	if _, ok := child["properties"]; !ok {
+		child["properties"] = map[string]interface{}{}
+	}
+	return child
+}
+
+// ImportJSONSchema converts a JSON Schema document into a Schema.
+//
+// Nested object properties are flattened into dotted field paths and local
+// "$ref" pointers (#/definitions/... and #/$defs/...) are resolved. Keywords
+// that have no TSK schema equivalent are skipped and reported as warnings.
+func ImportJSONSchema(data []byte) (*Schema, []string, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON Schema: %w", err)
+	}
+
+	imp := &jsonImporter{root: doc, schema: New()}
+	if title, ok := doc["title"].(string); ok {
+		imp.schema.Title = title
+	}
+	if desc, ok := doc["description"].(string); ok {
+		imp.schema.Description = desc
+	}
+
+	node, err := imp.resolve(doc, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := imp.walkProperties("", node, nil); err != nil {
+		return nil, nil, err
+	}
+
+	sort.Strings(imp.warnings)
+	return imp.schema, imp.warnings, nil
+}
+
+// unsupportedKeywords are JSON Schema keywords that TSK schemas cannot express
+var unsupportedKeywords = []string{
+	"oneOf", "anyOf", "not", "if", "then", "else", "patternProperties",
+	"additionalProperties", "dependentSchemas", "dependentRequired",
+	"uniqueItems", "minItems", "maxItems", "exclusiveMinimum", "exclusiveMaximum",
+	"multipleOf", "propertyNames",
+}
+
+// jsonImporter carries state while importing a JSON Schema document
+type jsonImporter struct {
+	root     map[string]interface{}
+	schema   *Schema
+	warnings []string
+}
+
+// walkProperties imports the properties of an object schema under prefix
+func (imp *jsonImporter) walkProperties(prefix string, node map[string]interface{}, seen []string) error {
+	required := map[string]bool{}
+	if list, ok := node["required"].([]interface{}); ok {
+		for _, name := range list {
+			if s, ok := name.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+
+	props, _ := node["properties"].(map[string]interface{})
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		raw, ok := props[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		child, err := imp.resolve(raw, seen)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		childSeen := seen
+		if ref, ok := raw["$ref"].(string); ok {
+			childSeen = append(append([]string{}, seen...), ref)
+		}
+
+		if err := imp.importField(path, child, required[name]); err != nil {
+			return err
+		}
+		if _, ok := child["properties"]; ok {
+			if err := imp.walkProperties(path, child, childSeen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// importField converts the keywords of a single property
+func (imp *jsonImporter) importField(path string, node map[string]interface{}, required bool) error {
+	f := &Field{Path: path, Required: required}
+
+	f.Type = imp.importType(path, node["type"])
+	if f.Type == TypeAny {
+		if _, ok := node["properties"]; ok {
+			f.Type = TypeObject
+		}
+	}
+
+	if desc, ok := node["description"].(string); ok {
+		f.Description = desc
+	}
+	if def, ok := node["default"]; ok {
+		f.Default = fromJSONValue(def)
+	}
+	if enum, ok := node["enum"].([]interface{}); ok {
+		for _, v := range enum {
+			f.Enum = append(f.Enum, fromJSONValue(v))
+		}
+	}
+	if c, ok := node["const"]; ok {
+		f.Enum = []interface{}{fromJSONValue(c)}
+	}
+	if n, ok := node["minimum"].(float64); ok {
+		f.Min = &n
+	}
+	if n, ok := node["maximum"].(float64); ok {
+		f.Max = &n
+	}
+	if n, ok := node["minLength"].(float64); ok {
+		v := int(n)
+		f.MinLength = &v
+	}
+	if n, ok := node["maxLength"].(float64); ok {
+		v := int(n)
+		f.MaxLength = &v
+	}
+	if p, ok := node["pattern"].(string); ok {
+		f.Pattern = p
+	}
+	if format, ok := node["format"].(string); ok {
+		f.Format = format
+	}
+	if items, ok := node["items"].(map[string]interface{}); ok {
+		if resolved, err := imp.resolve(items, nil); err == nil {
+			f.Items = imp.importType(path+"[]", resolved["type"])
+			if f.Items == TypeAny {
+				f.Items = ""
+			}
+		}
+	}
+
+	for _, keyword := range unsupportedKeywords {
+		if _, ok := node[keyword]; ok {
+			imp.warnings = append(imp.warnings, fmt.Sprintf("%s: keyword %q is not supported and was skipped", path, keyword))
+		}
+	}
+
+	imp.schema.AddField(f)
+	return nil
+}
+
+// importType maps a JSON Schema "type" keyword to a TSK schema type
+func (imp *jsonImporter) importType(path string, raw interface{}) string {
+	switch t := raw.(type) {
+	case string:
+		return fromJSONType(t)
+	case []interface{}:
+		// ["string", "null"] style nullable types keep the first concrete type
+		var types []string
+		for _, v := range t {
+			if s, ok := v.(string); ok && s != "null" {
+				types = append(types, s)
+			}
+		}
+		if len(types) == 1 {
+			return fromJSONType(types[0])
+		}
+		if len(types) > 1 {
+			imp.warnings = append(imp.warnings, fmt.Sprintf("%s: union type %v imported as any", path, types))
+		}
+	}
+	return TypeAny
+}
+
+// resolve follows a local $ref and merges allOf subschemas
+func (imp *jsonImporter) resolve(node map[string]interface{}, seen []string) (map[string]interface{}, error) {
+	ref, ok := node["$ref"].(string)
+	if ok {
+		for _, s := range seen {
+			if s == ref {
+				return nil, fmt.Errorf("recursive $ref %s is not supported", ref)
+			}
+		}
+		target, err := imp.lookup(ref)
+		if err != nil {
+			return nil, err
+		}
+		merged := map[string]interface{}{}
+		for k, v := range target {
+			merged[k] = v
+		}
+		for k, v := range node {
+			if k != "$ref" {
+				merged[k] = v
+			}
+		}
+		return imp.resolve(merged, append(seen, ref))
+	}
+
+	allOf, ok := node["allOf"].([]interface{})
+	if !ok {
+		return node, nil
+	}
+
+	merged := map[string]interface{}{}
+	props := map[string]interface{}{}
+	var required []interface{}
+	parts := append([]interface{}{node}, allOf...)
+	for _, part := range parts {
+		sub, ok := part.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		sub, err := imp.resolve(withoutKey(sub, "allOf"), seen)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range sub {
+			switch k {
+			case "properties":
+				if p, ok := v.(map[string]interface{}); ok {
+					for name, prop := range p {
+						props[name] = prop
+					}
+				}
+			case "required":
+				if r, ok := v.([]interface{}); ok {
+					required = append(required, r...)
+				}
+			default:
+				merged[k] = v
+			}
+		}
+	}
+	if len(props) > 0 {
+		merged["properties"] = props
+	}
+	if len(required) > 0 {
+		merged["required"] = required
+	}
+	return merged, nil
+}
+
+// lookup resolves a local JSON pointer such as #/$defs/port
+func (imp *jsonImporter) lookup(ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only local $ref pointers are supported, got %s", ref)
+	}
+
+	var current interface{} = imp.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %s", ref)
+		}
+		current, ok = obj[part]
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %s", ref)
+		}
+	}
+
+	target, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("$ref %s does not point to a schema", ref)
+	}
+	return target, nil
+}
+
+// Helper functions
+
+func jsonType(t string) string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeInt:
+		return "integer"
+	case TypeFloat:
+		return "number"
+	case TypeBool:
+		return "boolean"
+	case TypeArray:
+		return "array"
+	case TypeObject:
+		return "object"
+	}
+	return ""
+}
+
+func fromJSONType(t string) string {
+	switch t {
+	case "string":
+		return TypeString
+	case "integer":
+		return TypeInt
+	case "number":
+		return TypeFloat
+	case "boolean":
+		return TypeBool
+	case "array":
+		return TypeArray
+	case "object":
+		return TypeObject
+	}
+	return TypeAny
+}
+
+// fromJSONValue converts whole-number JSON floats back to ints so that
+// defaults and enums keep their TSK types
+func fromJSONValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case float64:
+		if val == float64(int(val)) {
+			return int(val)
+		}
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = fromJSONValue(item)
+		}
+		return out
+	}
+	return v
+}
+
+func withoutKey(node map[string]interface{}, key string) map[string]interface{} {
+	out := make(map[string]interface{}, len(node))
+	for k, v := range node {
+		if k != key {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,431 @@
+// Package schema provides schema definitions and validation for TuskLang configuration
+package schema
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+)
+
+// Field types understood by the schema subsystem
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+	TypeArray  = "array"
+	TypeObject = "object"
+	TypeAny    = "any"
+)
+
+// Schema describes the expected shape of a configuration
+type Schema struct {
+	Title       string
+	Description string
+	Fields      map[string]*Field
+}
+
+// Field describes a single configuration key, addressed by its dotted path
+type Field struct {
+	Path        string
+	Type        string
+	Description string
+	Required    bool
+	Default     interface{}
+	Enum        []interface{}
+	Min         *float64
+	Max         *float64
+	MinLength   *int
+	MaxLength   *int
+	Pattern     string
+	Format      string
+	Items       string
+}
+
+// ValidationError describes a configuration value that does not satisfy the schema
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+// Error returns the string representation of the validation error
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// fieldAttributes lists the keys a schema section may declare
+var fieldAttributes = map[string]bool{
+	"type": true, "description": true, "required": true, "default": true,
+	"enum": true, "min": true, "max": true, "min_length": true,
+	"max_length": true, "pattern": true, "format": true, "items": true,
+}
+
+// New creates an empty Schema
+func New() *Schema {
+	return &Schema{
+		Fields: make(map[string]*Field),
+	}
+}
+
+// LoadFile loads a schema from a .tsk schema file
+func LoadFile(filename string) (*Schema, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema file: %w", err)
+	}
+	return Parse(content)
+}
+
+// Parse parses a TSK schema document.
+//
+// Each field is declared as a section named after its dotted path, holding
+// the field attributes:
+//
+//	title: "Application config"
+//
+//	[server.port]
+//	type: "int"
+//	required: true
+//	min: 1
+//	max: 65535
+func Parse(content []byte) (*Schema, error) {
+	cfg := config.New()
+	if err := cfg.LoadTSK(content); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+
+	s := New()
+	for key, value := range cfg.Values() {
+		dot := strings.LastIndex(key, ".")
+		if dot == -1 {
+			switch key {
+			case "title":
+				s.Title = fmt.Sprintf("%v", value)
+			case "description":
+				s.Description = fmt.Sprintf("%v", value)
+			}
+			continue
+		}
+
+		path, attr := key[:dot], key[dot+1:]
+		if !fieldAttributes[attr] {
+			return nil, fmt.Errorf("unknown schema attribute %q for field %s", attr, path)
+		}
+		if err := s.field(path).set(attr, value); err != nil {
+			return nil, fmt.Errorf("field %s: %w", path, err)
+		}
+	}
+
+	for _, f := range s.Fields {
+		if f.Type == "" {
+			f.Type = TypeAny
+		}
+		if !validType(f.Type) {
+			return nil, fmt.Errorf("field %s: unknown type %q", f.Path, f.Type)
+		}
+	}
+
+	return s, nil
+}
+
+// AddField adds or replaces a field definition
+func (s *Schema) AddField(f *Field) {
+	s.Fields[f.Path] = f
+}
+
+// Paths returns all field paths in sorted order
+func (s *Schema) Paths() []string {
+	paths := make([]string, 0, len(s.Fields))
+	for path := range s.Fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// field returns the field at path, creating it if needed
+func (s *Schema) field(path string) *Field {
+	f, ok := s.Fields[path]
+	if !ok {
+		f = &Field{Path: path}
+		s.Fields[path] = f
+	}
+	return f
+}
+
+// set assigns a single schema attribute parsed from TSK
+func (f *Field) set(attr string, value interface{}) error {
+	switch attr {
+	case "type":
+		f.Type = normalizeType(fmt.Sprintf("%v", value))
+	case "description":
+		f.Description = fmt.Sprintf("%v", value)
+	case "required":
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("required must be a boolean")
+		}
+		f.Required = b
+	case "default":
+		f.Default = value
+	case "enum":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("enum must be an array")
+		}
+		f.Enum = items
+	case "min", "max":
+		n, ok := toFloat(value)
+		if !ok {
+			return fmt.Errorf("%s must be a number", attr)
+		}
+		if attr == "min" {
+			f.Min = &n
+		} else {
+			f.Max = &n
+		}
+	case "min_length", "max_length":
+		n, ok := value.(int)
+		if !ok {
+			return fmt.Errorf("%s must be an integer", attr)
+		}
+		if attr == "min_length" {
+			f.MinLength = &n
+		} else {
+			f.MaxLength = &n
+		}
+	case "pattern":
+		f.Pattern = fmt.Sprintf("%v", value)
+		if _, err := regexp.Compile(f.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	case "format":
+		f.Format = fmt.Sprintf("%v", value)
+	case "items":
+		f.Items = normalizeType(fmt.Sprintf("%v", value))
+	}
+	return nil
+}
+
+// Validate checks a configuration against the schema
+func (s *Schema) Validate(cfg *config.Config) []ValidationError {
+	var errors []ValidationError
+
+	for _, path := range s.Paths() {
+		f := s.Fields[path]
+		if !cfg.Has(path) {
+			if f.Required && f.Type != TypeObject {
+				errors = append(errors, ValidationError{Path: path, Message: "required key is missing"})
+			}
+			continue
+		}
+		errors = append(errors, f.validate(cfg.Get(path))...)
+	}
+
+	return errors
+}
+
+// validate checks a single value against the field definition
+func (f *Field) validate(value interface{}) []ValidationError {
+	fail := func(format string, args ...interface{}) []ValidationError {
+		return []ValidationError{{Path: f.Path, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if !matchesType(f.Type, value) {
+		return fail("expected %s, got %s", f.Type, typeOf(value))
+	}
+
+	if len(f.Enum) > 0 {
+		found := false
+		for _, allowed := range f.Enum {
+			if fmt.Sprintf("%v", allowed) == fmt.Sprintf("%v", value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail("value %v is not one of %v", value, f.Enum)
+		}
+	}
+
+	if n, ok := toFloat(value); ok {
+		if f.Min != nil && n < *f.Min {
+			return fail("value %v is below minimum %v", value, *f.Min)
+		}
+		if f.Max != nil && n > *f.Max {
+			return fail("value %v is above maximum %v", value, *f.Max)
+		}
+	}
+
+	if str, ok := value.(string); ok {
+		if f.MinLength != nil && len(str) < *f.MinLength {
+			return fail("length %d is below minimum %d", len(str), *f.MinLength)
+		}
+		if f.MaxLength != nil && len(str) > *f.MaxLength {
+			return fail("length %d is above maximum %d", len(str), *f.MaxLength)
+		}
+		if f.Pattern != "" && !regexp.MustCompile(f.Pattern).MatchString(str) {
+			return fail("value %q does not match pattern %s", str, f.Pattern)
+		}
+	}
+
+	if items, ok := value.([]interface{}); ok && f.Items != "" {
+		for i, item := range items {
+			if !matchesType(f.Items, item) {
+				return fail("item %d: expected %s, got %s", i, f.Items, typeOf(item))
+			}
+		}
+	}
+
+	return nil
+}
+
+// ToTSK renders the schema as a TSK schema document
+func (s *Schema) ToTSK() []byte {
+	var sb strings.Builder
+
+	if s.Title != "" {
+		sb.WriteString(fmt.Sprintf("title: %s\n", strconv.Quote(s.Title)))
+	}
+	if s.Description != "" {
+		sb.WriteString(fmt.Sprintf("description: %s\n", strconv.Quote(s.Description)))
+	}
+
+	for _, path := range s.Paths() {
+		f := s.Fields[path]
+		sb.WriteString(fmt.Sprintf("\n[%s]\n", path))
+		sb.WriteString(fmt.Sprintf("type: %s\n", strconv.Quote(f.Type)))
+		if f.Description != "" {
+			sb.WriteString(fmt.Sprintf("description: %s\n", strconv.Quote(f.Description)))
+		}
+		if f.Required {
+			sb.WriteString("required: true\n")
+		}
+		if f.Default != nil {
+			sb.WriteString(fmt.Sprintf("default: %s\n", config.FormatValue(f.Default)))
+		}
+		if len(f.Enum) > 0 {
+			sb.WriteString(fmt.Sprintf("enum: %s\n", config.FormatValue(f.Enum)))
+		}
+		if f.Min != nil {
+			sb.WriteString(fmt.Sprintf("min: %s\n", config.FormatValue(*f.Min)))
+		}
+		if f.Max != nil {
+			sb.WriteString(fmt.Sprintf("max: %s\n", config.FormatValue(*f.Max)))
+		}
+		if f.MinLength != nil {
+			sb.WriteString(fmt.Sprintf("min_length: %d\n", *f.MinLength))
+		}
+		if f.MaxLength != nil {
+			sb.WriteString(fmt.Sprintf("max_length: %d\n", *f.MaxLength))
+		}
+		if f.Pattern != "" {
+			sb.WriteString(fmt.Sprintf("pattern: %s\n", strconv.Quote(f.Pattern)))
+		}
+		if f.Format != "" {
+			sb.WriteString(fmt.Sprintf("format: %s\n", strconv.Quote(f.Format)))
+		}
+		if f.Items != "" {
+			sb.WriteString(fmt.Sprintf("items: %s\n", strconv.Quote(f.Items)))
+		}
+	}
+
+	return []byte(sb.String())
+}
+
+// Helper functions
+
+func normalizeType(t string) string {
+	switch strings.ToLower(t) {
+	case "str", "string":
+		return TypeString
+	case "int", "integer":
+		return TypeInt
+	case "float", "number", "double":
+		return TypeFloat
+	case "bool", "boolean":
+		return TypeBool
+	case "array", "list":
+		return TypeArray
+	case "object", "map", "section":
+		return TypeObject
+	case "any", "":
+		return TypeAny
+	default:
+		return t
+	}
+}
+
+func validType(t string) bool {
+	switch t {
+	case TypeString, TypeInt, TypeFloat, TypeBool, TypeArray, TypeObject, TypeAny:
+		return true
+	}
+	return false
+}
+
+func matchesType(t string, value interface{}) bool {
+	switch t {
+	case TypeString:
+		_, ok := value.(string)
+		return ok
+	case TypeInt:
+		switch v := value.(type) {
+		case int, int64:
+			return true
+		case float64:
+			return v == float64(int64(v))
+		}
+		return false
+	case TypeFloat:
+		_, ok := toFloat(value)
+		return ok
+	case TypeBool:
+		_, ok := value.(bool)
+		return ok
+	case TypeArray:
+		_, ok := value.([]interface{})
+		return ok
+	case TypeObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return true
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return TypeString
+	case int, int64:
+		return TypeInt
+	case float64:
+		return TypeFloat
+	case bool:
+		return TypeBool
+	case []interface{}:
+		return TypeArray
+	case map[string]interface{}:
+		return TypeObject
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
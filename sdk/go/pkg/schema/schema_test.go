@@ -0,0 +1,117 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+)
+
+const testSchema = `title: "App config"
+
+[server.port]
+type: "int"
+required: true
+min: 1
+max: 65535
+default: 8080
+
+[server.host]
+type: "string"
+pattern: "^[a-z.]+$"
+
+[app.mode]
+type: "string"
+enum: ["dev", "prod"]
+
+[app.features]
+type: "array"
+items: "string"
+`
+
+func TestParseAndValidate(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if len(s.Fields) != 4 {
+		t.Fatalf("expected 4 fields, got %d", len(s.Fields))
+	}
+
+	cfg := config.New()
+	if err := cfg.LoadTSK([]byte("[server]\nport: 70000\nhost: \"Bad Host\"\n\n[app]\nmode: \"test\"\n")); err != nil {
+		t.Fatalf("LoadTSK() returned error: %v", err)
+	}
+
+	errors := s.Validate(cfg)
+	if len(errors) != 3 {
+		t.Errorf("expected 3 validation errors, got %d: %v", len(errors), errors)
+	}
+}
+
+func TestJSONSchemaRoundTrip(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	data, err := s.MarshalJSONSchema()
+	if err != nil {
+		t.Fatalf("MarshalJSONSchema() returned error: %v", err)
+	}
+
+	imported, warnings, err := ImportJSONSchema(data)
+	if err != nil {
+		t.Fatalf("ImportJSONSchema() returned error: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	port := imported.Fields["server.port"]
+	if port == nil || port.Type != TypeInt || !port.Required || port.Default != 8080 {
+		t.Errorf("server.port did not round-trip: %+v", port)
+	}
+	if port.Min == nil || *port.Min != 1 || port.Max == nil || *port.Max != 65535 {
+		t.Errorf("server.port bounds did not round-trip: %+v", port)
+	}
+	if f := imported.Fields["app.features"]; f == nil || f.Items != TypeString {
+		t.Errorf("app.features items did not round-trip: %+v", f)
+	}
+	if f := imported.Fields["server"]; f == nil || f.Type != TypeObject {
+		t.Errorf("expected intermediate object field for server, got %+v", f)
+	}
+}
+
+func TestImportJSONSchemaRefs(t *testing.T) {
+	doc := `{
+		"$defs": {"port": {"type": "integer", "minimum": 1}},
+		"type": "object",
+		"required": ["db"],
+		"properties": {
+			"db": {
+				"type": "object",
+				"required": ["port"],
+				"properties": {
+					"port": {"$ref": "#/$defs/port"},
+					"name": {"type": ["string", "null"], "oneOf": []}
+				}
+			}
+		}
+	}`
+
+	s, warnings, err := ImportJSONSchema([]byte(doc))
+	if err != nil {
+		t.Fatalf("ImportJSONSchema() returned error: %v", err)
+	}
+
+	port := s.Fields["db.port"]
+	if port == nil || port.Type != TypeInt || !port.Required || port.Min == nil {
+		t.Errorf("db.port $ref was not resolved: %+v", port)
+	}
+	if name := s.Fields["db.name"]; name == nil || name.Type != TypeString {
+		t.Errorf("nullable type was not imported: %+v", name)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected 1 warning for oneOf, got %v", warnings)
+	}
+}
@@ -0,0 +1,196 @@
+package secretscan
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Rule detects one kind of secret
+type Rule struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description"`
+	Severity    Severity `json:"severity"`
+	// pattern finds the secret; its first group, when it has one, is the
+	// secret itself
+	pattern *regexp.Regexp
+	// valid rejects matches that only look like the secret
+	valid func(secret string) bool
+}
+
+// Rules are the rules of Scan, the specific ones first: a span of a line
+// matched by a rule is not matched by the rules after it
+var Rules = []*Rule{
+	{ID: "encrypted-private-key", Description: "Encrypted private key", Severity: High,
+		pattern: regexp.MustCompile(`-----BEGIN (ENCRYPTED PRIVATE KEY)-----`)},
+	{ID: "private-key", Description: "Private key", Severity: Critical,
+		pattern: regexp.MustCompile(`-----BEGIN ((?:RSA |EC |DSA |OPENSSH |PGP )?PRIVATE KEY)(?: BLOCK)?-----`)},
+	{ID: "aws-access-key-id", Description: "AWS access key ID", Severity: Critical,
+		pattern: regexp.MustCompile(`\b((?:AKIA|ASIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA)[A-Z0-9]{16})\b`)},
+	{ID: "aws-secret-access-key", Description: "AWS secret access key", Severity: Critical,
+		pattern: regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|private).{0,20}?(?:[:=]|=>)\s*["'` + "`" + `]?([A-Za-z0-9/+]{40})\b`)},
+	{ID: "github-token", Description: "GitHub token", Severity: High,
+		pattern: regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{ID: "slack-token", Description: "Slack token", Severity: High,
+		pattern: regexp.MustCompile(`\b(xox[abprs]-[A-Za-z0-9-]{10,})`)},
+	{ID: "stripe-secret-key", Description: "Stripe live secret key", Severity: Critical,
+		pattern: regexp.MustCompile(`\b((?:sk|rk)_live_[A-Za-z0-9]{24,})\b`)},
+	{ID: "google-api-key", Description: "Google API key", Severity: High,
+		pattern: regexp.MustCompile(`\b(AIza[0-9A-Za-z_-]{35})`)},
+	{ID: "tsk-token", Description: "TuskLang API token", Severity: High,
+		pattern: regexp.MustCompile(`\b(tsk_[A-Za-z0-9_-]{43})`)},
+	{ID: "jwt", Description: "JSON Web Token", Severity: High,
+		pattern: regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,})`),
+		valid:   validJWT},
+	{ID: "url-password", Description: "Password in a URL", Severity: High,
+		pattern: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@"']+:([^/\s:@"']{3,})@`)},
+	{ID: "secret-assignment", Description: "Secret assigned a literal value", Severity: Medium,
+		pattern: regexp.MustCompile(`(?i)` + secretKey + `["']?\s*(?::=|=>|[:=])\s*(?:"([^"\s]{6,})"|'([^'\s]{6,})'|([^"'\s,;#)]{6,}))`),
+		valid:   literalValue},
+	{ID: "high-entropy-string", Description: "High-entropy string that may be a secret", Severity: Low,
+		pattern: regexp.MustCompile(`["'` + "`" + `=:]\s*([A-Za-z0-9+/_\-]{20,}={0,2})`)},
+}
+
+// secretKey matches a name that holds a secret
+const secretKey = `\b[a-z0-9_.-]*(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?key|auth[_-]?token|access[_-]?token|token|private[_-]?key|credentials?)\b`
+
+// ruleByID returns the rule named id
+func ruleByID(id string) (*Rule, bool) {
+	for _, r := range Rules {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// lineMatch is a secret on a line
+type lineMatch struct {
+	rule       *Rule
+	start, end int
+	secret     string
+}
+
+// matchLine runs the rules over line
+func matchLine(line string) []lineMatch {
+	var matches []lineMatch
+	overlaps := func(start, end int) bool {
+		for _, m := range matches {
+			if start < m.end && m.start < end {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rule := range Rules {
+		for _, loc := range rule.pattern.FindAllStringSubmatchIndex(line, -1) {
+			// The secret is the first group that matched
+			start, end := loc[0], loc[1]
+			for g := 2; g < len(loc); g += 2 {
+				if loc[g] >= 0 {
+					start, end = loc[g], loc[g+1]
+					break
+				}
+			}
+			secret := line[start:end]
+			if overlaps(start, end) || placeholder(secret) || (rule.valid != nil && !rule.valid(secret)) {
+				continue
+			}
+			if rule.ID == "high-entropy-string" && !highEntropy(line[:start], secret) {
+				continue
+			}
+			matches = append(matches, lineMatch{rule: rule, start: start, end: end, secret: secret})
+		}
+	}
+	return matches
+}
+
+// placeholders are values of examples and templates, not secrets
+var placeholders = []string{"example", "changeme", "change_me", "placeholder", "your_", "your-", "xxxxxx", "******", "<", "{{", "${", "$(", "%s", "redacted", "dummy"}
+
+// placeholder reports whether secret is an example value
+func placeholder(secret string) bool {
+	lower := strings.ToLower(secret)
+	for _, p := range placeholders {
+		if strings.Contains(lower, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// validJWT checks that the header of a token is JSON naming an algorithm
+func validJWT(token string) bool {
+	header, _, _ := strings.Cut(token, ".")
+	data, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return false
+	}
+	var fields struct {
+		Alg string `json:"alg"`
+	}
+	return json.Unmarshal(data, &fields) == nil && fields.Alg != ""
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z_.]*$`)
+
+// literalValue rejects values that are not literals: @env and @secret
+// operators, variables, expressions and identifiers, and URLs without
+// credentials
+func literalValue(value string) bool {
+	switch {
+	case strings.HasPrefix(value, "@"), strings.HasPrefix(value, "$"), strings.HasPrefix(value, "%"):
+		return false
+	case strings.ContainsAny(value, "()[]{}"), strings.HasPrefix(value, "+"):
+		return false
+	case strings.Contains(value, "://") && !strings.Contains(value, "@"):
+		// A URL without credentials
+		return false
+	case identifier.MatchString(value):
+		// os.Getenv, cfg.Password, string, true
+		return false
+	}
+	return true
+}
+
+// highEntropy decides whether secret, following prefix on its line, is
+// random enough to be a secret. Hex strings are not: they are mostly
+// hashes, and a hex secret assigned to a name like password is a
+// secret-assignment.
+func highEntropy(prefix, secret string) bool {
+	if !strings.ContainsAny(secret, "0123456789") || strings.IndexFunc(secret, isLetter) < 0 {
+		return false
+	}
+	if strings.Trim(secret, "0123456789abcdefABCDEF") == "" {
+		return false
+	}
+	// Hashes and values encrypted by @secret
+	if strings.HasSuffix(prefix, "sha256:") || strings.HasSuffix(prefix, "v1:") {
+		return false
+	}
+	return Entropy(secret) >= 4.0
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// Entropy returns the Shannon entropy of s, in bits per character
+func Entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len(s))
+	bits := 0.0
+	for _, c := range counts {
+		p := float64(c) / n
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
@@ -0,0 +1,129 @@
+package secretscan
+
+// SARIF 2.1.0, the format code scanning services such as GitHub's read.
+// Only the properties tsk fills are declared.
+
+// SARIFVersion is the version of the SARIF reports
+const SARIFVersion = "2.1.0"
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// SARIFLog is a SARIF report
+type SARIFLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+// SARIFRun is the run of one tool
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+// SARIFTool describes tsk and its rules
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+// SARIFDriver is the tool that ran
+type SARIFDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []SARIFRule `json:"rules"`
+}
+
+// SARIFRule is a rule of the tool
+type SARIFRule struct {
+	ID                   string            `json:"id"`
+	ShortDescription     SARIFMessage      `json:"shortDescription"`
+	DefaultConfiguration SARIFRuleConfig   `json:"defaultConfiguration"`
+	Properties           map[string]string `json:"properties"`
+}
+
+// SARIFRuleConfig holds the level of a rule
+type SARIFRuleConfig struct {
+	Level string `json:"level"`
+}
+
+// SARIFMessage is a plain text message
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIFResult is a finding
+type SARIFResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             SARIFMessage      `json:"message"`
+	Locations           []SARIFLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+// SARIFLocation is where a result is
+type SARIFLocation struct {
+	PhysicalLocation SARIFPhysicalLocation `json:"physicalLocation"`
+}
+
+// SARIFPhysicalLocation is a region of a file
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+	Region           SARIFRegion           `json:"region"`
+}
+
+// SARIFArtifactLocation is a file, relative to the root of the scan
+type SARIFArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// SARIFRegion is a position in a file
+type SARIFRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+// sarifLevel maps severities to SARIF levels
+func sarifLevel(s Severity) string {
+	switch s {
+	case Critical, High:
+		return "error"
+	case Medium:
+		return "warning"
+	}
+	return "note"
+}
+
+// securitySeverity is the CVSS-like score code scanning services sort by
+var securitySeverity = map[Severity]string{Critical: "9.5", High: "8.0", Medium: "5.5", Low: "3.0"}
+
+// SARIF returns the report as a SARIF log
+func (r *Report) SARIF() *SARIFLog {
+	run := SARIFRun{
+		Tool: SARIFTool{Driver: SARIFDriver{
+			Name:           "tsk security scan",
+			InformationURI: "https://tuskt.sk",
+		}},
+		Results: []SARIFResult{},
+	}
+	for _, rule := range Rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, SARIFRule{
+			ID:                   rule.ID,
+			ShortDescription:     SARIFMessage{Text: rule.Description},
+			DefaultConfiguration: SARIFRuleConfig{Level: sarifLevel(rule.Severity)},
+			Properties:           map[string]string{"security-severity": securitySeverity[rule.Severity]},
+		})
+	}
+	for _, f := range r.Findings {
+		run.Results = append(run.Results, SARIFResult{
+			RuleID:  f.Rule,
+			Level:   sarifLevel(f.Severity),
+			Message: SARIFMessage{Text: f.Message + ": " + f.Secret},
+			Locations: []SARIFLocation{{PhysicalLocation: SARIFPhysicalLocation{
+				ArtifactLocation: SARIFArtifactLocation{URI: f.File},
+				Region:           SARIFRegion{StartLine: f.Line, StartColumn: f.Column},
+			}}},
+			PartialFingerprints: map[string]string{"tskSecret/v1": f.Fingerprint},
+		})
+	}
+	return &SARIFLog{Schema: sarifSchema, Version: SARIFVersion, Runs: []SARIFRun{run}}
+}
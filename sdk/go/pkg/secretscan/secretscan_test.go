@@ -0,0 +1,249 @@
+package secretscan
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The secrets are split, so this file does not trip the scanner itself
+var (
+	awsKeyID  = "AKIA" + "Q3EGRIGHTWK5JXLN"
+	awsSecret = "wJalrXUtnFEMI/K7MDENG/" + "bPxRfiCYz9Xq2Lm8Rt"
+	jwt       = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1234567890"}`)) + ".SflKxwRJSMeKKF2QT4fwpMeJf36POk6yJV_adQssw5c"
+	privateKey = "-----BEGIN RSA " + "PRIVATE KEY-----\nMIIEpAIBAAKCAQEA7bq98lN0\n-----END RSA PRIVATE KEY-----\n"
+	random     = "q8Zr" + "T3vLx9Pw2KmN7bYc4HdF"
+)
+
+func sample() string {
+	return `# Credentials nobody should commit
+[aws]
+access_key_id: "` + awsKeyID + `"
+aws_secret_access_key: "` + awsSecret + `"
+
+[api]
+token: "` + jwt + `"
+password: "hunter2hunter2"
+api_key: @env("API_KEY")
+db_password: @secret("v1:` + random + `")
+example_password: "changeme"
+session_id: "` + random + `"
+ignored: "` + awsKeyID + `"  # tsk-scan:allow
+`
+}
+
+func rules(report *Report) map[string]Finding {
+	found := map[string]Finding{}
+	for _, f := range report.Findings {
+		found[f.Rule] = f
+	}
+	return found
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "peanu.tsk"), sample())
+	writeFile(t, filepath.Join(dir, "keys", "deploy.pem"), privateKey)
+	// Not source, and not descended into
+	writeFile(t, filepath.Join(dir, "notes.png"), awsKeyID)
+	writeFile(t, filepath.Join(dir, "node_modules", "x.js"), `const k = "`+awsKeyID+`"`)
+
+	report, err := Scan(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 2 {
+		t.Errorf("files = %d, want 2", report.Files)
+	}
+	found := rules(report)
+	for rule, severity := range map[string]Severity{
+		"aws-access-key-id":     Critical,
+		"aws-secret-access-key": Critical,
+		"jwt":                   High,
+		"secret-assignment":     Medium,
+		"private-key":           Critical,
+		"high-entropy-string":   Low,
+	} {
+		f, ok := found[rule]
+		if !ok {
+			t.Errorf("no %s finding in %+v", rule, report.Findings)
+			continue
+		}
+		if f.Severity != severity {
+			t.Errorf("%s severity = %s, want %s", rule, f.Severity, severity)
+		}
+	}
+	if len(report.Findings) != 6 {
+		t.Errorf("findings = %+v, want 6", report.Findings)
+	}
+	if report.Suppressed != 1 {
+		t.Errorf("suppressed = %d, want the inline allow", report.Suppressed)
+	}
+	if f := found["aws-access-key-id"]; f.File != "peanu.tsk" || f.Line != 3 || f.Column != 17 || f.Secret != "AKIA************" {
+		t.Errorf("aws key finding = %+v", f)
+	}
+	if f := found["private-key"]; f.File != "keys/deploy.pem" || f.Line != 1 {
+		t.Errorf("private key finding = %+v", f)
+	}
+	for _, f := range report.Findings {
+		if strings.Contains(f.Secret, random[4:]) || len(f.Fingerprint) != 16 {
+			t.Errorf("finding %+v leaks its secret or has no fingerprint", f)
+		}
+	}
+	if report.Failing(High) != 4 || report.Failing(Low) != 6 || report.Counts[Critical] != 3 {
+		t.Errorf("failing high = %d, low = %d, counts = %v", report.Failing(High), report.Failing(Low), report.Counts)
+	}
+
+	report, err = Scan(dir, Options{MinSeverity: High})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Findings) != 4 {
+		t.Errorf("findings at high = %+v", report.Findings)
+	}
+
+	// A file is scanned whatever its name
+	writeFile(t, filepath.Join(dir, "creds"), "secret = "+awsKeyID+"\n")
+	report, err = Scan(filepath.Join(dir, "creds"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := rules(report); len(report.Findings) != 1 || found["aws-access-key-id"].File != "creds" {
+		t.Errorf("findings in creds = %+v", report.Findings)
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "peanu.tsk"), sample())
+	writeFile(t, filepath.Join(dir, "testdata", "fixtures", "key.pem"), privateKey)
+
+	report, err := Scan(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtFinding := rules(report)["jwt"]
+
+	writeFile(t, filepath.Join(dir, AllowlistFile), `# Reviewed
+`+jwtFinding.Fingerprint+`  # test token
+rule:high-entropy-string
+path:testdata/**
+regex:^hunter2
+`)
+	report, err = Scan(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := rules(report)
+	if len(report.Findings) != 2 || found["aws-access-key-id"].Rule == "" || found["aws-secret-access-key"].Rule == "" {
+		t.Errorf("findings = %+v, want the AWS keys", report.Findings)
+	}
+	if report.Suppressed != 4 {
+		t.Errorf("suppressed = %d, want 4", report.Suppressed)
+	}
+
+	for _, bad := range []string{"rule:nope\n", "regex:(\n", "path:[\n", "not-a-fingerprint\n"} {
+		allow := filepath.Join(dir, "bad-allow")
+		writeFile(t, allow, bad)
+		if _, err := Scan(dir, Options{Allowlist: allow}); err == nil {
+			t.Errorf("allowlist %q: expected an error", bad)
+		}
+	}
+	if _, err := Scan(dir, Options{Allowlist: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("a missing allowlist given explicitly should be an error")
+	}
+}
+
+func TestMatchLine(t *testing.T) {
+	for line, want := range map[string]string{
+		`const token = "` + "ghp_" + strings.Repeat("a1B2", 9) + `"`:      "github-token",
+		`SLACK=` + "xoxb-" + "123456789012-abcdefABCDEF":                  "slack-token",
+		`stripe: "` + "sk_live_" + strings.Repeat("4eC3", 6) + `"`:        "stripe-secret-key",
+		`key := "` + "AIza" + strings.Repeat("SyA1b", 7) + `"`:            "google-api-key",
+		`-----BEGIN ENCRYPTED ` + `PRIVATE KEY-----`:                      "encrypted-private-key",
+		`DB_PASSWORD=s3cr3tPass`:                                          "secret-assignment",
+		`client_secret = "` + strings.Repeat("9f86d081884c7d65", 4) + `"`: "secret-assignment",
+		`nonce: "` + "Zk4Qm9Tx" + "2bWv7LpR8sYd" + `"`:                    "high-entropy-string",
+		`password := os.Getenv("PASSWORD")`:                               "",
+		`password: @env("DB_PASSWORD")`:                                   "",
+		`tokenURL = "https://auth.internal/oauth/token"`:                  "",
+		`dsn: "postgres://app:` + "s3cr3tPass" + `@db/app"`:               "url-password",
+		`token: string`:         "",
+		`api_key: "${API_KEY}"`: "",
+		`checksum: "sha256:` + strings.Repeat("9f86d081884c7d65", 4) + `"`: "",
+		`name: "TestScanFindsEveryRuleInThisFile"`:                         "",
+		`commit: "` + strings.Repeat("9f86d081884c7d65", 4) + `"`:          "",
+	} {
+		matches := matchLine(line)
+		got := ""
+		if len(matches) > 0 {
+			got = matches[0].rule.ID
+		}
+		if got != want || len(matches) > 1 {
+			t.Errorf("matchLine(%q) = %d match(es), first %q, want %q", line, len(matches), got, want)
+		}
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "peanu.tsk"), sample())
+	report, err := Scan(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(report.SARIF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log SARIFLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != SARIFVersion || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != len(Rules) {
+		t.Fatalf("sarif = %s", data)
+	}
+	results := log.Runs[0].Results
+	if len(results) != len(report.Findings) {
+		t.Fatalf("results = %d, want %d", len(results), len(report.Findings))
+	}
+	levels := map[string]string{}
+	for _, r := range results {
+		levels[r.RuleID] = r.Level
+		if r.Locations[0].PhysicalLocation.ArtifactLocation.URI != "peanu.tsk" || r.PartialFingerprints["tskSecret/v1"] == "" {
+			t.Errorf("result = %+v", r)
+		}
+	}
+	if levels["aws-access-key-id"] != "error" || levels["secret-assignment"] != "warning" || levels["high-entropy-string"] != "note" {
+		t.Errorf("levels = %v", levels)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	if e := Entropy("aaaaaaaa"); e != 0 {
+		t.Errorf("entropy of a repeated character = %v", e)
+	}
+	if e := Entropy("abcd"); e != 2 {
+		t.Errorf("entropy of 4 characters = %v, want 2", e)
+	}
+	if _, err := ParseSeverity("HIGH"); err != nil {
+		t.Error(err)
+	}
+	if _, err := ParseSeverity("urgent"); err == nil {
+		t.Error("expected an error for an unknown severity")
+	}
+}
@@ -0,0 +1,295 @@
+package secretstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fetchVault reads @vault("path", "field") from Vault's HTTP API. KV v2
+// responses nest the secret one level deeper than KV v1; both are handled.
+func (s *Store) fetchVault(opts Options, args []string) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("expects a path and an optional field")
+	}
+	addr := firstNonEmpty(opts.VaultAddr, os.Getenv("VAULT_ADDR"))
+	if addr == "" {
+		return nil, fmt.Errorf("no Vault address: set secrets.vault.addr or VAULT_ADDR")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("VAULT_TOKEN is not set")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(args[0], "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := firstNonEmpty(opts.VaultNamespace, os.Getenv("VAULT_NAMESPACE")); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := s.doJSON(req, &body); err != nil {
+		return nil, err
+	}
+	secret := body.Data
+	if nested, ok := secret["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := secret["metadata"]; hasMetadata {
+			secret = nested
+		}
+	}
+	return field(secret, optionalArg(args, 1))
+}
+
+// fetchAWS reads @awssecrets("secret-id", "field") with the Secrets
+// Manager GetSecretValue action, signed with AWS Signature Version 4
+func (s *Store) fetchAWS(opts Options, args []string) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("expects a secret id and an optional field")
+	}
+	region := firstNonEmpty(opts.AWSRegion, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+	if region == "" {
+		return nil, fmt.Errorf("no AWS region: set secrets.aws.region or AWS_REGION")
+	}
+	creds := AWSCredentialsFromEnv()
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	endpoint := firstNonEmpty(opts.AWSEndpoint, "https://secretsmanager."+region+".amazonaws.com")
+	payload, err := json.Marshal(map[string]string{"SecretId": args[0]})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	SignV4(req, payload, creds, region, "secretsmanager", s.now())
+
+	var body struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary string `json:"SecretBinary"`
+	}
+	if err := s.doJSON(req, &body); err != nil {
+		return nil, err
+	}
+	secret := body.SecretString
+	if secret == "" && body.SecretBinary != "" {
+		decoded, err := base64.StdEncoding.DecodeString(body.SecretBinary)
+		if err != nil {
+			return nil, fmt.Errorf("malformed SecretBinary: %w", err)
+		}
+		secret = string(decoded)
+	}
+	return field(secret, optionalArg(args, 1))
+}
+
+// fetchGCP reads @gcpsecret("name", "version") from Secret Manager. name is
+// a secret id in secrets.gcp.project (or GOOGLE_CLOUD_PROJECT), or a full
+// projects/... resource name; version defaults to latest.
+func (s *Store) fetchGCP(opts Options, args []string) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("expects a secret name and an optional version")
+	}
+	name := args[0]
+	if !strings.HasPrefix(name, "projects/") {
+		project := firstNonEmpty(opts.GCPProject, os.Getenv("GOOGLE_CLOUD_PROJECT"))
+		if project == "" {
+			return nil, fmt.Errorf("no GCP project: set secrets.gcp.project or GOOGLE_CLOUD_PROJECT")
+		}
+		name = "projects/" + project + "/secrets/" + name
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/" + firstNonEmpty(optionalArg(args, 1), "latest")
+	}
+
+	token, err := GCPAccessToken(s.client)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := firstNonEmpty(opts.GCPEndpoint, "https://secretmanager.googleapis.com")
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(endpoint, "/")+"/v1/"+name+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var body struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := s.doJSON(req, &body); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(body.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed payload: %w", err)
+	}
+	return string(data), nil
+}
+
+// gcpMetadataToken is the metadata server endpoint for the default service
+// account's access token
+const gcpMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPAccessToken returns GOOGLE_OAUTH_ACCESS_TOKEN or a token for the
+// default service account from the metadata server
+func GCPAccessToken(client *http.Client) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, gcpMetadataToken, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doJSON(client, req, &body); err != nil {
+		return "", fmt.Errorf("no GCP credentials: set GOOGLE_OAUTH_ACCESS_TOKEN or run on GCP (%w)", err)
+	}
+	return body.AccessToken, nil
+}
+
+// doJSON sends req and decodes a successful JSON response into v
+func (s *Store) doJSON(req *http.Request, v interface{}) error {
+	return doJSON(s.client, req, v)
+}
+
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// AWSCredentials are static AWS credentials
+type AWSCredentials struct {
+	AccessKey, SecretKey, SessionToken string
+}
+
+// AWSCredentialsFromEnv reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN
+func AWSCredentialsFromEnv() AWSCredentials {
+	return AWSCredentials{
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// SignV4 signs req for an AWS service with Signature Version 4. Headers
+// set on req before signing are signed too.
+func SignV4(req *http.Request, payload []byte, creds AWSCredentials, region, service string, now time.Time) {
+	t := now.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query parameters sorted by name, as SigV4 requires
+func canonicalQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// optionalArg returns args[i], or "" when it was not given
+func optionalArg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
@@ -0,0 +1,247 @@
+// Package secretstore resolves configuration values from enterprise secret
+// stores: HashiCorp Vault, AWS Secrets Manager and GCP Secret Manager. It
+// backs the @vault, @awssecrets and @gcpsecret operators.
+//
+// Every store is disabled until a configuration opts in:
+//
+//	[secrets]
+//	providers: ["vault", "aws"]
+//	ttl: "5m"
+//	vault.addr: "https://vault.internal:8200"
+//	aws.region: "eu-west-1"
+//	gcp.project: "my-project"
+//
+// Credentials never come from configuration: Vault reads VAULT_TOKEN, AWS
+// reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, and
+// GCP reads GOOGLE_OAUTH_ACCESS_TOKEN or asks the metadata server.
+package secretstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider names, as listed in secrets.providers
+const (
+	Vault = "vault"
+	AWS   = "aws"
+	GCP   = "gcp"
+)
+
+// operatorProviders maps each operator to the provider it needs
+var operatorProviders = map[string]string{
+	"vault":      Vault,
+	"awssecrets": AWS,
+	"gcpsecret":  GCP,
+}
+
+// DefaultTTL is how long a fetched secret is reused
+const DefaultTTL = 5 * time.Minute
+
+// Options enables providers and points them at their services. Fields left
+// empty fall back to the provider's usual environment variables.
+type Options struct {
+	Providers []string
+	// TTL is how long fetched secrets are cached; 0 means DefaultTTL and a
+	// negative TTL disables caching
+	TTL time.Duration
+
+	VaultAddr      string
+	VaultNamespace string
+	AWSRegion      string
+	// AWSEndpoint overrides https://secretsmanager.<region>.amazonaws.com
+	AWSEndpoint string
+	GCPProject  string
+	// GCPEndpoint overrides https://secretmanager.googleapis.com
+	GCPEndpoint string
+}
+
+// OptionsFrom reads Options from the flat secrets.* keys of a configuration
+func OptionsFrom(values map[string]interface{}) (Options, error) {
+	var opts Options
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "secrets.")
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		switch setting {
+		case "providers":
+			switch v := value.(type) {
+			case string:
+				opts.Providers = []string{v}
+			case []interface{}:
+				for _, item := range v {
+					opts.Providers = append(opts.Providers, fmt.Sprint(item))
+				}
+			default:
+				return opts, fmt.Errorf("secrets.providers: expected a string or array, got %v", value)
+			}
+		case "ttl":
+			ttl, err := time.ParseDuration(text)
+			if err != nil {
+				return opts, fmt.Errorf("secrets.ttl: %w", err)
+			}
+			if ttl == 0 {
+				ttl = -1
+			}
+			opts.TTL = ttl
+		case "vault.addr":
+			opts.VaultAddr = text
+		case "vault.namespace":
+			opts.VaultNamespace = text
+		case "aws.region":
+			opts.AWSRegion = text
+		case "aws.endpoint":
+			opts.AWSEndpoint = text
+		case "gcp.project":
+			opts.GCPProject = text
+		case "gcp.endpoint":
+			opts.GCPEndpoint = text
+		default:
+			return opts, fmt.Errorf("unknown setting secrets.%s", setting)
+		}
+	}
+	sort.Strings(opts.Providers)
+	for _, provider := range opts.Providers {
+		switch provider {
+		case Vault, AWS, GCP:
+		default:
+			return opts, fmt.Errorf("secrets.providers: unknown provider %q", provider)
+		}
+	}
+	return opts, nil
+}
+
+// cached is one fetched secret
+type cached struct {
+	value   interface{}
+	expires time.Time
+}
+
+// Store fetches and caches secrets for the enabled providers
+type Store struct {
+	mu      sync.Mutex
+	opts    Options
+	enabled map[string]bool
+	cache   map[string]cached
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewStore creates a Store with every provider disabled
+func NewStore() *Store {
+	return &Store{
+		enabled: make(map[string]bool),
+		cache:   make(map[string]cached),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     time.Now,
+	}
+}
+
+// Default is the Store behind the @vault, @awssecrets and @gcpsecret operators
+var Default = NewStore()
+
+// Configure enables the providers of opts. The cache is kept when the
+// options are unchanged, so configuring on every load is cheap.
+func (s *Store) Configure(opts Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reflect.DeepEqual(s.opts, opts) {
+		return
+	}
+	s.opts = opts
+	s.enabled = make(map[string]bool)
+	for _, provider := range opts.Providers {
+		s.enabled[provider] = true
+	}
+	s.cache = make(map[string]cached)
+}
+
+// Enabled reports whether provider has been opted into
+func (s *Store) Enabled(provider string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enabled[provider]
+}
+
+// Resolve runs operator ("vault", "awssecrets" or "gcpsecret") with args,
+// from the cache while the cached value is fresh
+func (s *Store) Resolve(operator string, args ...interface{}) (interface{}, error) {
+	provider, ok := operatorProviders[operator]
+	if !ok {
+		return nil, fmt.Errorf("unknown secret operator @%s", operator)
+	}
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("@%s expects string arguments, got %T", operator, arg)
+		}
+		strs[i] = str
+	}
+
+	s.mu.Lock()
+	if !s.enabled[provider] {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("@%s is disabled: add %q to secrets.providers to opt in", operator, provider)
+	}
+	opts := s.opts
+	cacheKey := operator + "\x00" + strings.Join(strs, "\x00")
+	if entry, ok := s.cache[cacheKey]; ok && s.now().Before(entry.expires) {
+		s.mu.Unlock()
+		return entry.value, nil
+	}
+	s.mu.Unlock()
+
+	var value interface{}
+	var err error
+	switch provider {
+	case Vault:
+		value, err = s.fetchVault(opts, strs)
+	case AWS:
+		value, err = s.fetchAWS(opts, strs)
+	case GCP:
+		value, err = s.fetchGCP(opts, strs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("@%s: %w", operator, err)
+	}
+
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl > 0 {
+		s.mu.Lock()
+		s.cache[cacheKey] = cached{value: value, expires: s.now().Add(ttl)}
+		s.mu.Unlock()
+	}
+	return value, nil
+}
+
+// field picks one field out of a secret: a map key, or a key of a JSON
+// object held in a string. Without a field the whole secret is returned.
+func field(secret interface{}, name string) (interface{}, error) {
+	if name == "" {
+		return secret, nil
+	}
+	m, ok := secret.(map[string]interface{})
+	if !ok {
+		text, isString := secret.(string)
+		if !isString || json.Unmarshal([]byte(text), &m) != nil {
+			return nil, fmt.Errorf("secret is not a JSON object, so it has no field %q", name)
+		}
+	}
+	value, ok := m[name]
+	if !ok {
+		return nil, fmt.Errorf("secret has no field %q", name)
+	}
+	return value, nil
+}
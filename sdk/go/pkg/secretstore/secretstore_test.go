@@ -0,0 +1,162 @@
+package secretstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{
+		"secrets.providers":  []interface{}{"vault", "aws"},
+		"secrets.ttl":        "30s",
+		"secrets.vault.addr": "https://vault:8200",
+		"secrets.aws.region": "eu-west-1",
+		"app.name":           "ignored",
+	})
+	if err != nil {
+		t.Fatalf("OptionsFrom failed: %v", err)
+	}
+	if strings.Join(opts.Providers, ",") != "aws,vault" || opts.TTL != 30*time.Second ||
+		opts.VaultAddr != "https://vault:8200" || opts.AWSRegion != "eu-west-1" {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+
+	if opts, _ := OptionsFrom(map[string]interface{}{"secrets.ttl": "0s"}); opts.TTL >= 0 {
+		t.Errorf("ttl 0s should disable caching, got %v", opts.TTL)
+	}
+	if _, err := OptionsFrom(map[string]interface{}{"secrets.providers": "azure"}); err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+	if _, err := OptionsFrom(map[string]interface{}{"secrets.vault.token": "s.123"}); err == nil {
+		t.Error("expected an error for an unknown setting")
+	}
+}
+
+func TestStore(t *testing.T) {
+	hits := 0
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Header.Get("X-Vault-Token") != "root" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/db":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"password": "hunter2"},
+				"metadata": map[string]interface{}{"version": 3},
+			}})
+		case "/v1/kv/api":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"key": "abc"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_TOKEN", "root")
+
+	s := NewStore()
+	if _, err := s.Resolve("vault", "secret/data/db", "password"); err == nil || !strings.Contains(err.Error(), "opt in") {
+		t.Fatalf("expected a disabled error, got %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	s.Configure(Options{Providers: []string{Vault}, TTL: time.Minute, VaultAddr: vault.URL})
+
+	for i := 0; i < 3; i++ {
+		value, err := s.Resolve("vault", "secret/data/db", "password")
+		if err != nil || value != "hunter2" {
+			t.Fatalf("Resolve = %v, %v", value, err)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("expected 1 request while cached, got %d", hits)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := s.Resolve("vault", "secret/data/db", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if hits != 2 {
+		t.Errorf("expected a refetch after the TTL, got %d requests", hits)
+	}
+
+	s.Configure(Options{Providers: []string{Vault}, TTL: time.Minute, VaultAddr: vault.URL})
+	if _, err := s.Resolve("vault", "secret/data/db", "password"); err != nil || hits != 2 {
+		t.Errorf("reconfiguring with the same options should keep the cache (%d requests, %v)", hits, err)
+	}
+
+	if value, err := s.Resolve("vault", "kv/api", "key"); err != nil || value != "abc" {
+		t.Errorf("KV v1 Resolve = %v, %v", value, err)
+	}
+	if _, err := s.Resolve("vault", "kv/api", "missing"); err == nil {
+		t.Error("expected an error for a missing field")
+	}
+	if _, err := s.Resolve("vault", "kv/nope"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+	if _, err := s.Resolve("awssecrets", "prod/db"); err == nil {
+		t.Error("aws should stay disabled")
+	}
+}
+
+func TestAWSAndGCP(t *testing.T) {
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var req struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"user":"app","password":"s3cret"}`})
+	}))
+	defer aws.Close()
+	gcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gtoken" ||
+			r.URL.Path != "/v1/projects/acme/secrets/api-key/versions/latest:access" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"payload": map[string]string{
+			"data": base64.StdEncoding.EncodeToString([]byte("gcp-value")),
+		}})
+	}))
+	defer gcp.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "gtoken")
+
+	s := NewStore()
+	s.Configure(Options{
+		Providers:   []string{AWS, GCP},
+		AWSRegion:   "us-east-1",
+		AWSEndpoint: aws.URL,
+		GCPProject:  "acme",
+		GCPEndpoint: gcp.URL,
+	})
+	if value, err := s.Resolve("awssecrets", "prod/db", "password"); err != nil || value != "s3cret" {
+		t.Errorf("awssecrets Resolve = %v, %v", value, err)
+	}
+	if value, err := s.Resolve("gcpsecret", "api-key"); err != nil || value != "gcp-value" {
+		t.Errorf("gcpsecret Resolve = %v, %v", value, err)
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case from the AWS SigV4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := AWSCredentials{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	SignV4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,438 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted files, as written by `tsk security encrypt`, start with a
+// header:
+//
+//	magic    "TSKENC"
+//	version  1 byte, 1
+//	kdf      1 byte: 0 key file, 1 argon2id, 2 scrypt
+//	params   3 × uint32: argon2id time, memory (KiB) and threads, or scrypt
+//	         log2(N), r and p
+//	chunk    uint32, the plaintext size of a chunk
+//	salt     32 bytes
+//	mac      HMAC-SHA256 of the bytes above
+//
+// The key of the passphrase or key file and the salt derive, with HKDF, an
+// AES-256-GCM key for the chunks and a key for the header MAC, so a wrong
+// key is told apart from a corrupt file and a changed header is refused.
+// The plaintext follows in chunks of chunk bytes, each sealed on its own
+// with a nonce of its index and a flag set on the last one, which may be
+// shorter or empty: chunks cannot be reordered, and truncation is caught.
+const (
+	fileMagic        = "TSKENC"
+	fileVersion      = 1
+	fileHeaderSize   = 24 + fileSaltSize
+	fileSaltSize     = 32
+	fileMACSize      = sha256.Size
+	fileHKDFInfo     = "tsk file encryption v1"
+	maxFileChunkSize = 16 << 20
+	maxArgon2Memory  = 1 << 20 // KiB
+	maxScryptLogN    = 22
+)
+
+const (
+	// DefaultChunkSize is the plaintext size of the chunks of a file
+	DefaultChunkSize = 64 << 10
+	// PassphraseEnv holds the passphrase of tsk security encrypt and
+	// decrypt, for scripts
+	PassphraseEnv = "TSK_PASSPHRASE"
+	// MinPassphraseSize is the shortest passphrase files are encrypted with
+	MinPassphraseSize = 8
+)
+
+// KDF is how the key of an encrypted file comes from its secret
+type KDF byte
+
+const (
+	// KeyFileKDF uses a 32-byte key, as ParseSecretKey reads it
+	KeyFileKDF KDF = iota
+	// Argon2idKDF derives the key from a passphrase with Argon2id
+	Argon2idKDF
+	// ScryptKDF derives the key from a passphrase with scrypt
+	ScryptKDF
+)
+
+// String returns the name of the KDF, as --kdf takes it
+func (k KDF) String() string {
+	switch k {
+	case KeyFileKDF:
+		return "key-file"
+	case Argon2idKDF:
+		return "argon2id"
+	case ScryptKDF:
+		return "scrypt"
+	}
+	return fmt.Sprintf("kdf(%d)", byte(k))
+}
+
+// ParseKDF reads a passphrase KDF name
+func ParseKDF(name string) (KDF, error) {
+	switch name {
+	case "argon2id", "argon2":
+		return Argon2idKDF, nil
+	case "scrypt":
+		return ScryptKDF, nil
+	}
+	return 0, fmt.Errorf("unknown KDF %q (argon2id or scrypt)", name)
+}
+
+var (
+	// ErrNotEncrypted is returned for input that is not an encrypted file
+	ErrNotEncrypted = errors.New("not a tsk encrypted file")
+	// ErrWrongKey is returned when the header MAC does not verify
+	ErrWrongKey = errors.New("wrong passphrase or key, or the header was modified")
+	// ErrCorrupt is returned for chunks that do not authenticate
+	ErrCorrupt = errors.New("the encrypted data is corrupt or truncated")
+)
+
+// FileSecret is what an encrypted file is locked with: a passphrase or
+// a key
+type FileSecret struct {
+	Passphrase []byte
+	Key        []byte
+}
+
+// KeyFileSecret reads a key file of 32 bytes, raw or as base64 or hex
+func KeyFileSecret(file string) (FileSecret, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return FileSecret{}, fmt.Errorf("failed to read key file: %w", err)
+	}
+	key, err := ParseSecretKey(data)
+	if err != nil {
+		return FileSecret{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return FileSecret{Key: key}, nil
+}
+
+// EncryptOptions tune EncryptStream
+type EncryptOptions struct {
+	// KDF derives the key of a passphrase; Argon2idKDF by default. Keys
+	// always use KeyFileKDF.
+	KDF KDF
+	// ChunkSize is the plaintext size of a chunk; DefaultChunkSize if 0
+	ChunkSize int
+}
+
+// FileHeader is the header of an encrypted file
+type FileHeader struct {
+	Version   int
+	KDF       KDF
+	ChunkSize int
+	params    [3]uint32
+	salt      []byte
+	raw       []byte
+	mac       []byte
+}
+
+// UsesPassphrase reports whether the file was locked with a passphrase
+func (h *FileHeader) UsesPassphrase() bool {
+	return h.KDF != KeyFileKDF
+}
+
+// keys derives the chunk key and the MAC key of the header from secret
+func (h *FileHeader) keys(secret FileSecret) (cipher.AEAD, []byte, error) {
+	var master []byte
+	switch h.KDF {
+	case KeyFileKDF:
+		if len(secret.Key) != 32 {
+			return nil, nil, errors.New("the file was encrypted with a key file: a 32-byte key is needed")
+		}
+		master = secret.Key
+	case Argon2idKDF:
+		if len(secret.Passphrase) == 0 {
+			return nil, nil, errors.New("the file was encrypted with a passphrase")
+		}
+		master = argon2.IDKey(secret.Passphrase, h.salt, h.params[0], h.params[1], uint8(h.params[2]), 32)
+	case ScryptKDF:
+		if len(secret.Passphrase) == 0 {
+			return nil, nil, errors.New("the file was encrypted with a passphrase")
+		}
+		var err error
+		master, err = scrypt.Key(secret.Passphrase, h.salt, 1<<h.params[0], int(h.params[1]), int(h.params[2]), 32)
+		if err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported KDF %d", h.KDF)
+	}
+
+	keys := make([]byte, 64)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, h.salt, []byte(fileHKDFInfo)), keys); err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(keys[:32])
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, keys[32:], nil
+}
+
+// checkParams refuses headers that would make the KDF run for too long or
+// take too much memory
+func (h *FileHeader) checkParams() error {
+	p := h.params
+	switch h.KDF {
+	case KeyFileKDF:
+		return nil
+	case Argon2idKDF:
+		if p[0] < 1 || p[0] > 16 || p[1] < 8*p[2] || p[1] > maxArgon2Memory || p[2] < 1 || p[2] > 255 {
+			return fmt.Errorf("unsupported argon2id parameters t=%d m=%d p=%d", p[0], p[1], p[2])
+		}
+	case ScryptKDF:
+		if p[0] < 10 || p[0] > maxScryptLogN || p[1] < 1 || p[1] > 32 || p[2] < 1 || p[2] > 16 {
+			return fmt.Errorf("unsupported scrypt parameters N=2^%d r=%d p=%d", p[0], p[1], p[2])
+		}
+	default:
+		return fmt.Errorf("unsupported KDF %d", h.KDF)
+	}
+	return nil
+}
+
+// chunkNonce is the nonce of chunk index: the index, big-endian, then
+// 1 for the last chunk
+func chunkNonce(nonce []byte, index uint64, last bool) []byte {
+	clear(nonce)
+	binary.BigEndian.PutUint64(nonce[3:11], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// EncryptStream writes src to dst encrypted with secret: a key, or a
+// passphrase the KDF of opts derives the key from
+func EncryptStream(dst io.Writer, src io.Reader, secret FileSecret, opts EncryptOptions) error {
+	h := &FileHeader{Version: fileVersion, KDF: opts.KDF, ChunkSize: opts.ChunkSize, salt: make([]byte, fileSaltSize)}
+	if h.ChunkSize == 0 {
+		h.ChunkSize = DefaultChunkSize
+	}
+	if h.ChunkSize < 1 || h.ChunkSize > maxFileChunkSize {
+		return fmt.Errorf("chunk size must be between 1 and %d bytes", maxFileChunkSize)
+	}
+	switch {
+	case secret.Key != nil:
+		h.KDF = KeyFileKDF
+	case len(secret.Passphrase) < MinPassphraseSize:
+		return fmt.Errorf("the passphrase needs at least %d characters", MinPassphraseSize)
+	case h.KDF == KeyFileKDF || h.KDF == Argon2idKDF:
+		h.KDF, h.params = Argon2idKDF, [3]uint32{3, 64 << 10, 4}
+	case h.KDF == ScryptKDF:
+		h.params = [3]uint32{15, 8, 1}
+	default:
+		return fmt.Errorf("unsupported KDF %d", h.KDF)
+	}
+	if _, err := rand.Read(h.salt); err != nil {
+		return err
+	}
+
+	raw := make([]byte, 0, fileHeaderSize+fileMACSize)
+	raw = append(raw, fileMagic...)
+	raw = append(raw, fileVersion, byte(h.KDF))
+	for _, p := range h.params {
+		raw = binary.BigEndian.AppendUint32(raw, p)
+	}
+	raw = binary.BigEndian.AppendUint32(raw, uint32(h.ChunkSize))
+	raw = append(raw, h.salt...)
+	aead, macKey, err := h.keys(secret)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(raw)
+	if _, err := dst.Write(mac.Sum(raw)); err != nil {
+		return err
+	}
+
+	in := bufio.NewReaderSize(src, h.ChunkSize)
+	plain := make([]byte, h.ChunkSize)
+	sealed := make([]byte, 0, h.ChunkSize+aead.Overhead())
+	nonce := make([]byte, aead.NonceSize())
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(in, plain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		if !last {
+			// A full chunk is the last one when nothing follows
+			if _, err := in.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+		sealed = aead.Seal(sealed[:0], chunkNonce(nonce, index, last), plain[:n], nil)
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// ReadFileHeader reads the header of an encrypted file from r, leaving r
+// at the first chunk
+func ReadFileHeader(r io.Reader) (*FileHeader, error) {
+	raw := make([]byte, fileHeaderSize+fileMACSize)
+	if _, err := io.ReadFull(r, raw[:len(fileMagic)]); err != nil || string(raw[:len(fileMagic)]) != fileMagic {
+		return nil, ErrNotEncrypted
+	}
+	if _, err := io.ReadFull(r, raw[len(fileMagic):]); err != nil {
+		return nil, ErrCorrupt
+	}
+	h := &FileHeader{Version: int(raw[6]), KDF: KDF(raw[7]), raw: raw[:fileHeaderSize], mac: raw[fileHeaderSize:]}
+	if h.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported encrypted file version %d: upgrade tsk", h.Version)
+	}
+	for i := range h.params {
+		h.params[i] = binary.BigEndian.Uint32(raw[8+4*i:])
+	}
+	h.ChunkSize = int(binary.BigEndian.Uint32(raw[20:]))
+	h.salt = raw[24:fileHeaderSize]
+	if h.ChunkSize < 1 || h.ChunkSize > maxFileChunkSize {
+		return nil, fmt.Errorf("unsupported chunk size %d", h.ChunkSize)
+	}
+	if err := h.checkParams(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Decrypt writes the plaintext of the chunks of src, which follow the
+// header h, to dst. Chunks are written as they authenticate, so dst may
+// have received part of the plaintext when ErrCorrupt is returned.
+func (h *FileHeader) Decrypt(dst io.Writer, src io.Reader, secret FileSecret) error {
+	aead, macKey, err := h.keys(secret)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(h.raw)
+	if !hmac.Equal(mac.Sum(nil), h.mac) {
+		return ErrWrongKey
+	}
+
+	in := bufio.NewReaderSize(src, h.ChunkSize+aead.Overhead())
+	sealed := make([]byte, h.ChunkSize+aead.Overhead())
+	plain := make([]byte, 0, h.ChunkSize)
+	nonce := make([]byte, aead.NonceSize())
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(in, sealed)
+		if err == io.EOF {
+			// The last chunk is missing
+			return ErrCorrupt
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		if !last {
+			if _, err := in.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+		plain, err = aead.Open(plain[:0], chunkNonce(nonce, index, last), sealed[:n], nil)
+		if err != nil {
+			return ErrCorrupt
+		}
+		if _, err := dst.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// WriteFileAtomic writes file through write, into a temporary file of the
+// same directory renamed over file once complete and synced, so file is
+// never left half written. Without overwrite, an existing file is an
+// error.
+func WriteFileAtomic(file string, mode os.FileMode, overwrite bool, write func(w io.Writer) error) error {
+	if !overwrite {
+		if _, err := os.Lstat(file); err == nil {
+			return fmt.Errorf("%s already exists: %w", file, os.ErrExist)
+		}
+	}
+	dir := filepath.Dir(file)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	done := false
+	defer func() {
+		if !done {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if err := tmp.Chmod(mode); err != nil {
+		return err
+	}
+	out := bufio.NewWriterSize(tmp, 256<<10)
+	if err := write(out); err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+		done = true
+		return err
+	}
+	done = true
+	// Make the rename durable; directories cannot be synced everywhere
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// IsEncryptedFile reports whether file starts with the magic of an
+// encrypted file
+func IsEncryptedFile(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, len(fileMagic))
+	_, err = io.ReadFull(f, magic)
+	return err == nil && bytes.Equal(magic, []byte(fileMagic))
+}
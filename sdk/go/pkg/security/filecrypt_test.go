@@ -0,0 +1,242 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testChunk keeps chunks small so a few bytes span several of them
+const testChunk = 16
+
+var testKey = FileSecret{Key: bytes.Repeat([]byte{7}, 32)}
+
+func encryptBytes(t *testing.T, plain []byte, secret FileSecret, opts EncryptOptions) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := EncryptStream(&out, bytes.NewReader(plain), secret, opts); err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+	return out.Bytes()
+}
+
+func decryptBytes(data []byte, secret FileSecret) ([]byte, error) {
+	src := bytes.NewReader(data)
+	header, err := ReadFileHeader(src)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	err = header.Decrypt(&out, src, secret)
+	return out.Bytes(), err
+}
+
+// chunks splits an encrypted file into its header and sealed chunks
+func chunks(data []byte) (header []byte, sealed [][]byte) {
+	header, data = data[:fileHeaderSize+fileMACSize], data[fileHeaderSize+fileMACSize:]
+	size := testChunk + 16
+	for len(data) > size {
+		sealed, data = append(sealed, data[:size]), data[size:]
+	}
+	return header, append(sealed, data)
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		size   int
+		chunks int
+	}{
+		{"empty", 0, 1},
+		{"one byte", 1, 1},
+		{"exactly one chunk", testChunk, 1},
+		{"one chunk and a byte", testChunk + 1, 2},
+		{"exactly three chunks", 3 * testChunk, 3},
+		{"several chunks", 5*testChunk + 7, 6},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := make([]byte, tt.size)
+			for i := range plain {
+				plain[i] = byte(i)
+			}
+			data := encryptBytes(t, plain, testKey, EncryptOptions{ChunkSize: testChunk})
+			if _, sealed := chunks(data); len(sealed) != tt.chunks {
+				t.Errorf("%d chunks, want %d", len(sealed), tt.chunks)
+			}
+			got, err := decryptBytes(data, testKey)
+			if err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("decrypted %d bytes, %v; want %d bytes", len(got), err, len(plain))
+			}
+		})
+	}
+
+	// The default chunk size
+	plain := bytes.Repeat([]byte("tusk"), DefaultChunkSize/2)
+	if got, err := decryptBytes(encryptBytes(t, plain, testKey, EncryptOptions{}), testKey); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("default chunks: decrypted %d bytes, %v", len(got), err)
+	}
+}
+
+func TestFilePassphrase(t *testing.T) {
+	plain := []byte("database.password: hunter2")
+	for _, kdf := range []KDF{Argon2idKDF, ScryptKDF} {
+		t.Run(kdf.String(), func(t *testing.T) {
+			secret := FileSecret{Passphrase: []byte("correct horse")}
+			data := encryptBytes(t, plain, secret, EncryptOptions{KDF: kdf})
+			header, err := ReadFileHeader(bytes.NewReader(data))
+			if err != nil || header.KDF != kdf || !header.UsesPassphrase() {
+				t.Fatalf("header = %+v, %v", header, err)
+			}
+			if got, err := decryptBytes(data, secret); err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("decrypt = %q, %v", got, err)
+			}
+			if _, err := decryptBytes(data, FileSecret{Passphrase: []byte("battery staple")}); !errors.Is(err, ErrWrongKey) {
+				t.Errorf("wrong passphrase: %v, want ErrWrongKey", err)
+			}
+			if _, err := decryptBytes(data, testKey); err == nil {
+				t.Error("a key decrypted a passphrase file")
+			}
+		})
+	}
+
+	if err := EncryptStream(&bytes.Buffer{}, strings.NewReader("x"), FileSecret{Passphrase: []byte("short")}, EncryptOptions{}); err == nil {
+		t.Error("encrypted with a passphrase shorter than MinPassphraseSize")
+	}
+	if _, err := ParseKDF("bcrypt"); err == nil {
+		t.Error("ParseKDF accepted bcrypt")
+	}
+}
+
+func TestFileWrongKey(t *testing.T) {
+	data := encryptBytes(t, []byte("secret"), testKey, EncryptOptions{})
+	other := FileSecret{Key: bytes.Repeat([]byte{8}, 32)}
+	if got, err := decryptBytes(data, other); !errors.Is(err, ErrWrongKey) || len(got) != 0 {
+		t.Errorf("wrong key: %q, %v; want nothing and ErrWrongKey", got, err)
+	}
+	if _, err := decryptBytes(data, FileSecret{Passphrase: []byte("correct horse")}); err == nil {
+		t.Error("a passphrase decrypted a key file")
+	}
+	if _, err := decryptBytes(data, FileSecret{Key: []byte("short")}); err == nil {
+		t.Error("a short key was accepted")
+	}
+}
+
+func TestFileTampering(t *testing.T) {
+	plain := []byte(strings.Repeat("0123456789abcdef", 3) + "tail")
+	data := encryptBytes(t, plain, testKey, EncryptOptions{ChunkSize: testChunk})
+	header, sealed := chunks(data)
+	if len(sealed) != 4 {
+		t.Fatalf("%d chunks, want 4", len(sealed))
+	}
+	flip := func(b []byte, i int) []byte {
+		b = bytes.Clone(b)
+		b[i] ^= 1
+		return b
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want error
+		// plain is what is written before the damage is found
+		plain int
+	}{
+		{"no chunks", header, ErrCorrupt, 0},
+		{"final chunk dropped", join(header, sealed[0], sealed[1], sealed[2]), ErrCorrupt, 2 * testChunk},
+		{"final chunk cut", data[:len(data)-1], ErrCorrupt, 3 * testChunk},
+		{"middle chunk cut", join(header, sealed[0], sealed[1][:10]), ErrCorrupt, testChunk},
+		{"chunks reordered", join(header, sealed[1], sealed[0], sealed[2], sealed[3]), ErrCorrupt, 0},
+		{"chunk duplicated", join(header, sealed[0], sealed[0], sealed[1], sealed[2], sealed[3]), ErrCorrupt, testChunk},
+		{"chunk replayed last", join(header, sealed[0], sealed[1], sealed[2], sealed[2]), ErrCorrupt, 3 * testChunk},
+		{"chunk modified", join(header, sealed[0], flip(sealed[1], 3), sealed[2], sealed[3]), ErrCorrupt, testChunk},
+		{"bytes appended", join(data, []byte{0}), ErrCorrupt, 3 * testChunk},
+		{"salt modified", join(flip(header, 40), sealed[0], sealed[1], sealed[2], sealed[3]), ErrWrongKey, 0},
+		{"chunk size modified", join(flip(header, 23), sealed[0], sealed[1], sealed[2], sealed[3]), ErrWrongKey, 0},
+		{"MAC modified", join(flip(header, len(header)-1), sealed[0], sealed[1], sealed[2], sealed[3]), ErrWrongKey, 0},
+		{"magic modified", flip(data, 0), ErrNotEncrypted, 0},
+		{"header cut", data[:30], ErrCorrupt, 0},
+		{"not encrypted", []byte("[app]\nname: \"x\"\n"), ErrNotEncrypted, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptBytes(tt.data, testKey)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if !bytes.Equal(got, plain[:tt.plain]) {
+				t.Errorf("wrote %q before failing, want %q", got, plain[:tt.plain])
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name   string
+		offset int
+		value  byte
+	}{
+		{"version", 6, 2},
+		{"kdf", 7, 9},
+		// argon2id with a memory cost of 2^32-1 KiB would exhaust memory
+		{"kdf params", 12, 0xff},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			bad := bytes.Clone(data)
+			if tt.name == "kdf params" {
+				bad[7] = byte(Argon2idKDF)
+			}
+			bad[tt.offset] = tt.value
+			if _, err := decryptBytes(bad, testKey); err == nil || errors.Is(err, ErrWrongKey) {
+				t.Errorf("err = %v, want the header refused", err)
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out.enc")
+	write := func(content string) func(w io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		}
+	}
+	if err := WriteFileAtomic(file, 0600, false, write("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(file, 0600, false, write("second")); !errors.Is(err, os.ErrExist) {
+		t.Errorf("overwrite without force = %v, want os.ErrExist", err)
+	}
+	failed := errors.New("disk full")
+	if err := WriteFileAtomic(file, 0600, true, func(w io.Writer) error { return failed }); !errors.Is(err, failed) {
+		t.Errorf("failed write = %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "first" {
+		t.Errorf("failed write left %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, %v", info.Mode(), err)
+	}
+
+	if IsEncryptedFile(file) {
+		t.Error("plain file reported as encrypted")
+	}
+	if err := WriteFileAtomic(file, 0600, true, func(w io.Writer) error {
+		return EncryptStream(w, strings.NewReader("x"), testKey, EncryptOptions{})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedFile(file) {
+		t.Error("encrypted file not recognized")
+	}
+}
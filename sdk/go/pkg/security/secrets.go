@@ -0,0 +1,165 @@
+package security
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Environment variables that supply the secret key, checked in this order.
+// The key is 32 bytes, given raw or as base64 or hex.
+const (
+	// SecretKeyEnv holds the key itself
+	SecretKeyEnv = "TSK_SECRET_KEY"
+	// SecretKeyFileEnv names a file holding the key
+	SecretKeyFileEnv = "TSK_SECRET_KEY_FILE"
+	// SecretKeyCommandEnv is a shell command that prints the key, such as a
+	// KMS decrypt of an encrypted data key:
+	//   aws kms decrypt --ciphertext-blob fileb://tsk.key.enc --query Plaintext --output text
+	SecretKeyCommandEnv = "TSK_SECRET_KEY_COMMAND"
+)
+
+// secretVersion prefixes every encrypted blob so the format can change
+const secretVersion = "v1:"
+
+// secretPattern matches a whole @secret("...") value
+var secretPattern = regexp.MustCompile(`^@secret\(\s*"([^"]*)"\s*\)$`)
+
+var (
+	secretKeyMu sync.Mutex
+	secretKey   []byte
+)
+
+// SecretKey returns the key from SecretKeyEnv, SecretKeyFileEnv or
+// SecretKeyCommandEnv. The key is cached after the first successful load so
+// a KMS command runs once per process.
+func SecretKey() ([]byte, error) {
+	secretKeyMu.Lock()
+	defer secretKeyMu.Unlock()
+	if secretKey != nil {
+		return secretKey, nil
+	}
+
+	var raw []byte
+	var source string
+	switch {
+	case os.Getenv(SecretKeyEnv) != "":
+		raw, source = []byte(os.Getenv(SecretKeyEnv)), SecretKeyEnv
+	case os.Getenv(SecretKeyFileEnv) != "":
+		file := os.Getenv(SecretKeyFileEnv)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret key: %w", err)
+		}
+		raw, source = data, file
+	case os.Getenv(SecretKeyCommandEnv) != "":
+		command := os.Getenv(SecretKeyCommandEnv)
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command(shell, flag, command)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to run %s: %w: %s", SecretKeyCommandEnv, err, strings.TrimSpace(stderr.String()))
+		}
+		raw, source = out, SecretKeyCommandEnv
+	default:
+		return nil, fmt.Errorf("no secret key: set %s, %s or %s", SecretKeyEnv, SecretKeyFileEnv, SecretKeyCommandEnv)
+	}
+
+	key, err := ParseSecretKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	secretKey = key
+	return key, nil
+}
+
+// ResetSecretKey forgets the cached key, so the next SecretKey call loads
+// it again
+func ResetSecretKey() {
+	secretKeyMu.Lock()
+	defer secretKeyMu.Unlock()
+	secretKey = nil
+}
+
+// ParseSecretKey decodes a 32-byte AES-256 key given raw or as base64 or hex
+func ParseSecretKey(raw []byte) ([]byte, error) {
+	if len(raw) == 32 {
+		return raw, nil
+	}
+	text := strings.TrimSpace(string(raw))
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("secret key must be 32 bytes, raw or as base64 or hex")
+}
+
+// EncryptSecret encrypts plaintext with AES-256-GCM and returns it as a
+// @secret("...") value ready to paste into a .tsk file
+func EncryptSecret(plaintext string, key []byte) (string, error) {
+	ciphertext, err := New().Encrypt([]byte(plaintext), key)
+	if err != nil {
+		return "", err
+	}
+	blob := secretVersion + base64.StdEncoding.EncodeToString(ciphertext)
+	return "@secret(" + strconv.Quote(blob) + ")", nil
+}
+
+// DecryptSecret decrypts a @secret("...") value or the blob inside one
+func DecryptSecret(value string, key []byte) (string, error) {
+	blob := strings.TrimSpace(value)
+	if match := secretPattern.FindStringSubmatch(blob); match != nil {
+		blob = match[1]
+	}
+	encoded, ok := strings.CutPrefix(blob, secretVersion)
+	if !ok {
+		return "", fmt.Errorf("not an encrypted secret")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("malformed secret: %w", err)
+	}
+	plaintext, err := New().Decrypt(ciphertext, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret (wrong key?): %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// IsSecret reports whether value is a @secret("...") value
+func IsSecret(value string) bool {
+	// Checked on every configuration read: most values fail the prefix
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, "@secret") && secretPattern.MatchString(value)
+}
+
+// Secret is the @secret operator: it decrypts its argument with SecretKey
+func Secret(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("@secret expects one argument")
+	}
+	blob, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("@secret expects a string, got %T", args[0])
+	}
+	key, err := SecretKey()
+	if err != nil {
+		return nil, err
+	}
+	return DecryptSecret(blob, key)
+}
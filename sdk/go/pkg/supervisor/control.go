@@ -0,0 +1,182 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+// socketName is the control socket in the run directory
+const socketName = "supervisor.sock"
+
+// ErrNotRunning is returned by Client when no supervisor answers
+var ErrNotRunning = tskerrors.New(tskerrors.Connection, "no supervisor is running")
+
+// ErrRunning is returned by Serve when another supervisor uses the run
+// directory
+var ErrRunning = tskerrors.New(tskerrors.Conflict, "a supervisor is already running")
+
+// Serve runs the supervisor like Run and answers Client requests on the
+// control socket of the run directory, until ctx is done or a client asks
+// it to shut down. It writes supervisor.pid while it runs.
+func (s *Supervisor) Serve(ctx context.Context, names ...string) error {
+	if err := os.MkdirAll(s.runDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.runDir, err)
+	}
+	socket := filepath.Join(s.runDir, socketName)
+	if _, err := NewClient(s.runDir).Status(ctx); err == nil {
+		return fmt.Errorf("%w in %s", ErrRunning, s.runDir)
+	}
+	// The socket of a supervisor that died without cleaning up
+	os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socket, err)
+	}
+	pidFile := filepath.Join(s.runDir, "supervisor.pid")
+	os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0600)
+	defer os.Remove(pidFile)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopped := make(chan struct{})
+	server := &http.Server{Handler: s.handler(ctx, cancel, stopped), ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+
+	err = s.Run(ctx, names...)
+	close(stopped)
+	shutdown, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+	server.Shutdown(shutdown)
+	return err
+}
+
+// handler answers the control socket
+func (s *Supervisor) handler(ctx context.Context, cancel func(), stopped <-chan struct{}) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, s.Status())
+	})
+	mux.HandleFunc("POST /services/{name}/{action}", func(rw http.ResponseWriter, r *http.Request) {
+		var err error
+		name := r.PathValue("name")
+		switch r.PathValue("action") {
+		case "start":
+			err = s.Start(ctx, name)
+		case "stop":
+			err = s.Stop(ctx, name)
+		case "restart":
+			err = s.Restart(ctx, name)
+		default:
+			http.NotFound(rw, r)
+			return
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrUnknownService) {
+				status = http.StatusNotFound
+			}
+			writeJSON(rw, status, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(rw, http.StatusOK, s.services[name].report())
+	})
+	mux.HandleFunc("POST /shutdown", func(rw http.ResponseWriter, r *http.Request) {
+		cancel()
+		// Answer once every process has stopped
+		<-stopped
+		writeJSON(rw, http.StatusOK, s.Status())
+	})
+	return mux
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
+
+// Client talks to the supervisor of a run directory
+type Client struct {
+	http *http.Client
+}
+
+// NewClient connects to the control socket of runDir
+func NewClient(runDir string) *Client {
+	socket := filepath.Join(runDir, socketName)
+	return &Client{http: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}}
+}
+
+// Status reports every service
+func (c *Client) Status(ctx context.Context) ([]Status, error) {
+	var out []Status
+	return out, c.call(ctx, "GET", "/status", &out)
+}
+
+// Start starts a stopped service
+func (c *Client) Start(ctx context.Context, name string) (Status, error) {
+	var out Status
+	return out, c.call(ctx, "POST", "/services/"+name+"/start", &out)
+}
+
+// Stop stops a service, returning once its process has exited
+func (c *Client) Stop(ctx context.Context, name string) (Status, error) {
+	var out Status
+	return out, c.call(ctx, "POST", "/services/"+name+"/stop", &out)
+}
+
+// Restart stops a service and starts it again
+func (c *Client) Restart(ctx context.Context, name string) (Status, error) {
+	var out Status
+	return out, c.call(ctx, "POST", "/services/"+name+"/restart", &out)
+}
+
+// Shutdown stops every service and the supervisor
+func (c *Client) Shutdown(ctx context.Context) ([]Status, error) {
+	var out []Status
+	return out, c.call(ctx, "POST", "/shutdown", &out)
+}
+
+func (c *Client) call(ctx context.Context, method, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, "http://supervisor"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrNotRunning
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &body) == nil && body.Error != "" {
+			return errors.New(body.Error)
+		}
+		return fmt.Errorf("supervisor answered %s", resp.Status)
+	}
+	return json.Unmarshal(data, out)
+}
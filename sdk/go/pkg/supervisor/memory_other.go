@@ -0,0 +1,8 @@
+//go:build !linux
+
+package supervisor
+
+// processMemory is not reported outside Linux
+func processMemory(pid int) uint64 {
+	return 0
+}
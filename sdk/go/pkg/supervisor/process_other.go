@@ -0,0 +1,22 @@
+//go:build !unix
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+)
+
+func configureProcess(cmd *exec.Cmd) {}
+
+// terminateProcess kills the process on platforms without SIGTERM
+func terminateProcess(p *os.Process) {
+	p.Kill()
+}
+
+func killProcess(p *os.Process) {
+	p.Kill()
+}
+
+// Detach is a no-op on platforms without sessions
+func Detach(cmd *exec.Cmd) {}
@@ -0,0 +1,519 @@
+// Package supervisor runs the processes the [services] section declares,
+// for `tsk services`, and restarts them as their restart policy says:
+//
+//	[services]
+//	api.command: ["./bin/api", "--port", "3000"]
+//	api.dir: "backend"
+//	api.env.LOG_LEVEL: "info"
+//	api.restart: "always"
+//	worker.command: "python3 worker.py"
+//	worker.restart: "on-failure"
+//	worker.backoff: "2s"
+//	worker.max_backoff: "1m"
+//	worker.max_restarts: 10
+//
+// Restarts wait for a backoff that doubles after every exit, up to
+// max_backoff, and goes back to backoff once a process has stayed up for
+// a while. Each running process has a <name>.pid file in the run
+// directory; its output goes to <name>.log beside it.
+//
+// A Supervisor answers Client requests on a unix socket in the run
+// directory, so other tsk invocations can start, stop and inspect the
+// services while it runs.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tskerrors "github.com/cyber-boost/tusktsk/pkg/errors"
+)
+
+// RestartPolicy says when an exited process is started again
+type RestartPolicy string
+
+const (
+	// RestartAlways restarts a process however it exited
+	RestartAlways RestartPolicy = "always"
+	// RestartOnFailure restarts a process that exited with an error
+	RestartOnFailure RestartPolicy = "on-failure"
+	// RestartNever leaves an exited process stopped
+	RestartNever RestartPolicy = "never"
+)
+
+// stableUptime is how long a process has to run for its backoff to reset
+const stableUptime = 10 * time.Second
+
+// Spec declares a service
+type Spec struct {
+	Name string
+	// Command is the program and its arguments
+	Command []string
+	// Env is added to the environment of the supervisor
+	Env []string
+	// Dir is the working directory
+	Dir     string
+	Restart RestartPolicy
+	// Backoff is the first delay before a restart; MaxBackoff caps it
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxRestarts gives up after that many restarts in a row; zero means
+	// no limit
+	MaxRestarts int
+	// StopTimeout is how long a process gets to exit after SIGTERM before
+	// it is killed
+	StopTimeout time.Duration
+}
+
+// DefaultSpec is the Spec settings not given in [services] fall back to
+func DefaultSpec(name string) Spec {
+	return Spec{
+		Name:        name,
+		Restart:     RestartOnFailure,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+		StopTimeout: 10 * time.Second,
+	}
+}
+
+// SpecsFrom reads the services.* keys of an evaluated configuration,
+// sorted by name. Relative working directories are taken relative to dir.
+func SpecsFrom(values map[string]interface{}, dir string) ([]Spec, error) {
+	fields := make(map[string]map[string]interface{})
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "services.")
+		if !ok {
+			continue
+		}
+		name, field, ok := strings.Cut(setting, ".")
+		if !ok {
+			return nil, fmt.Errorf("services.%s: a service needs a command, such as services.%s.command", setting, setting)
+		}
+		if fields[name] == nil {
+			fields[name] = make(map[string]interface{})
+		}
+		fields[name][field] = value
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	specs := make([]Spec, 0, len(names))
+	for _, name := range names {
+		spec, err := parseSpec(name, fields[name], dir)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// parseSpec reads the fields of services.<name>
+func parseSpec(name string, fields map[string]interface{}, dir string) (Spec, error) {
+	spec := DefaultSpec(name)
+	spec.Dir = dir
+	env := make(map[string]string)
+	for field, value := range fields {
+		text := fmt.Sprint(value)
+		var err error
+		switch field {
+		case "command":
+			spec.Command = stringList(value)
+		case "dir":
+			spec.Dir = text
+			if !filepath.IsAbs(spec.Dir) {
+				spec.Dir = filepath.Join(dir, spec.Dir)
+			}
+		case "env":
+			for _, entry := range stringList(value) {
+				k, v, ok := strings.Cut(entry, "=")
+				if !ok || k == "" {
+					return spec, fmt.Errorf("services.%s.env: entries must be NAME=value, got %q", name, entry)
+				}
+				env[k] = v
+			}
+		case "restart":
+			spec.Restart = RestartPolicy(text)
+			if spec.Restart != RestartAlways && spec.Restart != RestartOnFailure && spec.Restart != RestartNever {
+				err = fmt.Errorf("must be always, on-failure or never")
+			}
+		case "backoff":
+			spec.Backoff, err = time.ParseDuration(text)
+		case "max_backoff":
+			spec.MaxBackoff, err = time.ParseDuration(text)
+		case "max_restarts":
+			spec.MaxRestarts, err = strconv.Atoi(text)
+		case "stop_timeout":
+			spec.StopTimeout, err = time.ParseDuration(text)
+		default:
+			k, ok := strings.CutPrefix(field, "env.")
+			if !ok {
+				return spec, fmt.Errorf("unknown setting services.%s.%s", name, field)
+			}
+			env[k] = text
+		}
+		if err != nil {
+			return spec, fmt.Errorf("services.%s.%s: invalid value %q: %w", name, field, text, err)
+		}
+	}
+	if len(spec.Command) == 0 {
+		return spec, fmt.Errorf("services.%s: no command", name)
+	}
+	if spec.Backoff <= 0 || spec.MaxBackoff < spec.Backoff {
+		return spec, fmt.Errorf("services.%s: backoff must be positive and at most max_backoff", name)
+	}
+	for k, v := range env {
+		spec.Env = append(spec.Env, k+"="+v)
+	}
+	sort.Strings(spec.Env)
+	return spec, nil
+}
+
+// stringList reads a list, or a string split on spaces
+func stringList(value interface{}) []string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return strings.Fields(fmt.Sprint(value))
+	}
+	out := make([]string, len(list))
+	for i, item := range list {
+		out[i] = fmt.Sprint(item)
+	}
+	return out
+}
+
+// State is what a service is doing
+type State string
+
+const (
+	StateRunning State = "running"
+	// StateBackoff is waiting to restart an exited process
+	StateBackoff State = "backoff"
+	StateStopped State = "stopped"
+	// StateExited finished and its restart policy leaves it so
+	StateExited State = "exited"
+	// StateFailed exited more than max_restarts times in a row
+	StateFailed State = "failed"
+)
+
+// Status reports a service
+type Status struct {
+	Name     string    `json:"name"`
+	State    State     `json:"state"`
+	PID      int       `json:"pid,omitempty"`
+	Started  time.Time `json:"started,omitempty"`
+	Restarts int       `json:"restarts"`
+	// LastExit describes how the process last exited
+	LastExit string `json:"last_exit,omitempty"`
+	// Memory is the resident memory of the process in bytes, zero when
+	// the platform does not report it
+	Memory  uint64   `json:"memory,omitempty"`
+	Command []string `json:"command"`
+	Log     string   `json:"log"`
+}
+
+// Uptime is how long the process has been running
+func (s Status) Uptime() time.Duration {
+	if s.State != StateRunning {
+		return 0
+	}
+	return time.Since(s.Started).Round(time.Second)
+}
+
+// ErrUnknownService is returned for names [services] does not declare
+var ErrUnknownService = tskerrors.New(tskerrors.NotFound, "unknown service")
+
+// Supervisor runs and restarts the processes of a set of services
+type Supervisor struct {
+	runDir   string
+	services map[string]*service
+	names    []string
+}
+
+// New supervises specs, keeping pidfiles, logs and the control socket in
+// runDir
+func New(specs []Spec, runDir string) *Supervisor {
+	s := &Supervisor{runDir: runDir, services: make(map[string]*service)}
+	for _, spec := range specs {
+		s.services[spec.Name] = &service{
+			spec:     spec,
+			pidFile:  filepath.Join(runDir, spec.Name+".pid"),
+			logFile:  filepath.Join(runDir, spec.Name+".log"),
+			commands: make(chan command),
+			status:   Status{Name: spec.Name, State: StateStopped},
+		}
+		s.names = append(s.names, spec.Name)
+	}
+	sort.Strings(s.names)
+	return s
+}
+
+// Run starts the named services, or all of them, and supervises them
+// until ctx is done; then it stops every process and returns
+func (s *Supervisor) Run(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		names = s.names
+	}
+	for _, name := range names {
+		if s.services[name] == nil {
+			return fmt.Errorf("%w %s", ErrUnknownService, name)
+		}
+	}
+	if err := os.MkdirAll(s.runDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.runDir, err)
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range s.names {
+		svc := s.services[name]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			svc.loop(ctx)
+		}()
+	}
+	for _, name := range names {
+		s.services[name].send(ctx, command{action: "start"})
+	}
+	<-ctx.Done()
+	wg.Wait()
+	return nil
+}
+
+// Start starts a stopped service
+func (s *Supervisor) Start(ctx context.Context, name string) error {
+	return s.do(ctx, name, "start")
+}
+
+// Stop stops a service, waiting for its process to exit
+func (s *Supervisor) Stop(ctx context.Context, name string) error {
+	return s.do(ctx, name, "stop")
+}
+
+// Restart stops a service and starts it again
+func (s *Supervisor) Restart(ctx context.Context, name string) error {
+	return s.do(ctx, name, "restart")
+}
+
+func (s *Supervisor) do(ctx context.Context, name, action string) error {
+	svc := s.services[name]
+	if svc == nil {
+		return fmt.Errorf("%w %s", ErrUnknownService, name)
+	}
+	return svc.send(ctx, command{action: action})
+}
+
+// Status reports every service, sorted by name
+func (s *Supervisor) Status() []Status {
+	out := make([]Status, len(s.names))
+	for i, name := range s.names {
+		out[i] = s.services[name].report()
+	}
+	return out
+}
+
+// command asks a service's loop to act; done receives the result
+type command struct {
+	action string
+	done   chan error
+}
+
+// service supervises the process of one Spec. Its loop owns the process;
+// the status is shared with Status under mu.
+type service struct {
+	spec     Spec
+	pidFile  string
+	logFile  string
+	commands chan command
+
+	mu     sync.Mutex
+	status Status
+}
+
+func (svc *service) send(ctx context.Context, cmd command) error {
+	cmd.done = make(chan error, 1)
+	select {
+	case svc.commands <- cmd:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-cmd.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (svc *service) report() Status {
+	svc.mu.Lock()
+	status := svc.status
+	svc.mu.Unlock()
+	status.Command = svc.spec.Command
+	status.Log = svc.logFile
+	if status.State == StateRunning {
+		status.Memory = processMemory(status.PID)
+	}
+	return status
+}
+
+func (svc *service) update(fn func(*Status)) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	fn(&svc.status)
+}
+
+// running is the process the loop is supervising
+type running struct {
+	cmd    *exec.Cmd
+	exited chan error
+}
+
+// loop starts, stops and restarts the process as commands and exits
+// require, until ctx is done
+func (svc *service) loop(ctx context.Context) {
+	var proc *running
+	var retry <-chan time.Time
+	backoff := svc.spec.Backoff
+	consecutive := 0
+
+	start := func() {
+		retry = nil
+		var err error
+		if proc, err = svc.start(); err != nil {
+			proc = nil
+			svc.update(func(s *Status) { s.LastExit = err.Error() })
+			retry = svc.exited(err, 0, &backoff, &consecutive)
+		}
+	}
+	stop := func() {
+		retry = nil
+		if proc != nil {
+			err := svc.terminate(proc)
+			proc = nil
+			svc.update(func(s *Status) { s.LastExit = describeExit(err) })
+		}
+		os.Remove(svc.pidFile)
+		svc.update(func(s *Status) { s.State, s.PID = StateStopped, 0 })
+	}
+
+	for {
+		var exited chan error
+		if proc != nil {
+			exited = proc.exited
+		}
+		select {
+		case <-ctx.Done():
+			stop()
+			return
+		case err := <-exited:
+			var uptime time.Duration
+			proc = nil
+			os.Remove(svc.pidFile)
+			svc.update(func(s *Status) {
+				uptime = time.Since(s.Started)
+				s.PID, s.LastExit = 0, describeExit(err)
+			})
+			retry = svc.exited(err, uptime, &backoff, &consecutive)
+		case <-retry:
+			svc.update(func(s *Status) { s.Restarts++ })
+			start()
+		case cmd := <-svc.commands:
+			switch cmd.action {
+			case "start":
+				if proc == nil {
+					backoff, consecutive = svc.spec.Backoff, 0
+					start()
+				}
+			case "stop":
+				stop()
+			case "restart":
+				stop()
+				backoff, consecutive = svc.spec.Backoff, 0
+				svc.update(func(s *Status) { s.Restarts++ })
+				start()
+			}
+			cmd.done <- nil
+		}
+	}
+}
+
+// exited records an exit and returns when to restart, nil when the
+// process stays down
+func (svc *service) exited(err error, uptime time.Duration, backoff *time.Duration, consecutive *int) <-chan time.Time {
+	if uptime >= stableUptime {
+		*backoff, *consecutive = svc.spec.Backoff, 0
+	}
+	restart := svc.spec.Restart == RestartAlways || (svc.spec.Restart == RestartOnFailure && err != nil)
+	if !restart {
+		svc.update(func(s *Status) { s.State = StateExited })
+		return nil
+	}
+	if svc.spec.MaxRestarts > 0 && *consecutive >= svc.spec.MaxRestarts {
+		svc.update(func(s *Status) { s.State = StateFailed })
+		return nil
+	}
+	*consecutive++
+	delay := *backoff
+	*backoff = min(*backoff*2, svc.spec.MaxBackoff)
+	svc.update(func(s *Status) { s.State = StateBackoff })
+	return time.After(delay)
+}
+
+// start launches the process with its output appended to the log
+func (svc *service) start() (*running, error) {
+	logFile, err := os.OpenFile(svc.logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(svc.spec.Command[0], svc.spec.Command[1:]...)
+	cmd.Dir = svc.spec.Dir
+	cmd.Env = append(os.Environ(), svc.spec.Env...)
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	configureProcess(cmd)
+	fmt.Fprintf(logFile, "--- %s starting %s\n", time.Now().Format(time.RFC3339), strings.Join(svc.spec.Command, " "))
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start: %w", err)
+	}
+
+	proc := &running{cmd: cmd, exited: make(chan error, 1)}
+	go func() { proc.exited <- cmd.Wait() }()
+	os.WriteFile(svc.pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0600)
+	svc.update(func(s *Status) {
+		s.State, s.PID, s.Started = StateRunning, cmd.Process.Pid, time.Now()
+	})
+	return proc, nil
+}
+
+// terminate asks the process to exit and kills it after StopTimeout
+func (svc *service) terminate(proc *running) error {
+	terminateProcess(proc.cmd.Process)
+	select {
+	case err := <-proc.exited:
+		return err
+	case <-time.After(svc.spec.StopTimeout):
+		killProcess(proc.cmd.Process)
+		return <-proc.exited
+	}
+}
+
+// describeExit turns the result of Wait into a line of status
+func describeExit(err error) string {
+	if err == nil {
+		return "exited cleanly"
+	}
+	return err.Error()
+}
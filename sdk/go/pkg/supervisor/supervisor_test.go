@@ -0,0 +1,184 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpecsFrom(t *testing.T) {
+	specs, err := SpecsFrom(map[string]interface{}{
+		"services.api.command":         []interface{}{"./bin/api", "--port", 3000},
+		"services.api.dir":             "backend",
+		"services.api.env.LOG_LEVEL":   "info",
+		"services.api.env.PORT":        3000,
+		"services.api.restart":         "always",
+		"services.worker.command":      "python3 worker.py",
+		"services.worker.env":          []interface{}{"QUEUE=jobs"},
+		"services.worker.backoff":      "2s",
+		"services.worker.max_backoff":  "1m",
+		"services.worker.max_restarts": 5,
+		"server.port":                  8080,
+	}, "/srv/app")
+	if err != nil {
+		t.Fatalf("SpecsFrom failed: %v", err)
+	}
+	if len(specs) != 2 {
+		t.Fatalf("expected 2 specs, got %+v", specs)
+	}
+	api, worker := specs[0], specs[1]
+	if !reflect.DeepEqual(api.Command, []string{"./bin/api", "--port", "3000"}) || api.Dir != "/srv/app/backend" ||
+		!reflect.DeepEqual(api.Env, []string{"LOG_LEVEL=info", "PORT=3000"}) || api.Restart != RestartAlways {
+		t.Errorf("unexpected api spec: %+v", api)
+	}
+	if !reflect.DeepEqual(worker.Command, []string{"python3", "worker.py"}) || worker.Dir != "/srv/app" ||
+		!reflect.DeepEqual(worker.Env, []string{"QUEUE=jobs"}) || worker.Restart != RestartOnFailure ||
+		worker.Backoff != 2*time.Second || worker.MaxBackoff != time.Minute || worker.MaxRestarts != 5 {
+		t.Errorf("unexpected worker spec: %+v", worker)
+	}
+
+	for _, test := range []struct {
+		values map[string]interface{}
+		want   string
+	}{
+		{map[string]interface{}{"services.api": "./api"}, "a service needs a command"},
+		{map[string]interface{}{"services.api.dir": "x"}, "services.api: no command"},
+		{map[string]interface{}{"services.api.command": "x", "services.api.restart": "sometimes"}, "must be always, on-failure or never"},
+		{map[string]interface{}{"services.api.command": "x", "services.api.backoff": "soon"}, "services.api.backoff: invalid value"},
+		{map[string]interface{}{"services.api.command": "x", "services.api.backoff": "1m", "services.api.max_backoff": "1s"}, "at most max_backoff"},
+		{map[string]interface{}{"services.api.command": "x", "services.api.env": "PORT"}, "entries must be NAME=value"},
+		{map[string]interface{}{"services.api.command": "x", "services.api.user": "www"}, "unknown setting services.api.user"},
+	} {
+		if _, err := SpecsFrom(test.values, "."); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: expected an error containing %q, got %v", test.values, test.want, err)
+		}
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh and sleep")
+	}
+	runDir := t.TempDir()
+	spec := func(name, script string, restart RestartPolicy) Spec {
+		s := DefaultSpec(name)
+		s.Command = []string{"sh", "-c", script}
+		s.Restart = restart
+		s.Backoff, s.MaxBackoff = 10*time.Millisecond, 40*time.Millisecond
+		s.StopTimeout = time.Second
+		return s
+	}
+	crash := spec("crash", "echo crashing; exit 3", RestartOnFailure)
+	crash.MaxRestarts = 3
+	done := spec("done", "exit 0", RestartOnFailure)
+	stubborn := spec("stubborn", "trap '' TERM; echo $GREETING; sleep 30 & wait", RestartAlways)
+	stubborn.Env = []string{"GREETING=hello"}
+	stubborn.StopTimeout = 100 * time.Millisecond
+	s := New([]Spec{crash, done, stubborn, spec("idle", "sleep 30", RestartAlways)}, runDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, "crash", "done", "stubborn") }()
+	client := NewClient(runDir)
+	status := func(name string) Status {
+		t.Helper()
+		statuses, err := client.Status(context.Background())
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		for _, st := range statuses {
+			if st.Name == name {
+				return st
+			}
+		}
+		t.Fatalf("no status for %s", name)
+		return Status{}
+	}
+	waitFor := func(name string, state State) Status {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if st, err := client.Status(context.Background()); err == nil {
+				for _, st := range st {
+					if st.Name == name && st.State == state {
+						return st
+					}
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%s never became %s: %+v", name, state, status(name))
+		return Status{}
+	}
+
+	// Failures are restarted with backoff until max_restarts
+	if st := waitFor("crash", StateFailed); st.Restarts != 3 || st.LastExit != "exit status 3" {
+		t.Errorf("unexpected crash status: %+v", st)
+	}
+	if log, _ := os.ReadFile(filepath.Join(runDir, "crash.log")); strings.Count(string(log), "\ncrashing\n") != 4 {
+		t.Errorf("expected 4 runs in the log, got %q", log)
+	}
+	// A clean exit is not a failure
+	if st := waitFor("done", StateExited); st.Restarts != 0 || st.LastExit != "exited cleanly" {
+		t.Errorf("unexpected done status: %+v", st)
+	}
+	if st := status("idle"); st.State != StateStopped {
+		t.Errorf("services not named should stay stopped, got %+v", st)
+	}
+
+	st := waitFor("stubborn", StateRunning)
+	pid, _ := os.ReadFile(filepath.Join(runDir, "stubborn.pid"))
+	if st.PID == 0 || strings.TrimSpace(string(pid)) != strconv.Itoa(st.PID) {
+		t.Errorf("pidfile %q does not match %+v", pid, st)
+	}
+	if runtime.GOOS == "linux" && st.Memory == 0 {
+		t.Error("expected the memory of a running process")
+	}
+	restarted, err := client.Restart(context.Background(), "stubborn")
+	if err != nil || restarted.State != StateRunning || restarted.PID == st.PID || restarted.Restarts != 1 {
+		t.Errorf("unexpected restart: %+v, %v", restarted, err)
+	}
+	// SIGTERM is ignored, so stopping falls back to killing the group
+	if st, err := client.Stop(context.Background(), "stubborn"); err != nil || st.State != StateStopped || !strings.Contains(st.LastExit, "killed") {
+		t.Errorf("unexpected stop: %+v, %v", st, err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "stubborn.pid")); !os.IsNotExist(err) {
+		t.Error("the pidfile should be removed on stop")
+	}
+	if log, _ := os.ReadFile(filepath.Join(runDir, "stubborn.log")); strings.Count(string(log), "hello") != 2 {
+		t.Errorf("the environment should reach the process, got %q", log)
+	}
+	if _, err := client.Start(context.Background(), "nope"); err == nil || !strings.Contains(err.Error(), "unknown service nope") {
+		t.Errorf("expected an unknown service error, got %v", err)
+	}
+	if st, err := client.Start(context.Background(), "idle"); err != nil || st.State != StateRunning {
+		t.Errorf("unexpected start: %+v, %v", st, err)
+	}
+
+	if err := New(nil, runDir).Serve(context.Background()); !errors.Is(err, ErrRunning) {
+		t.Errorf("a second supervisor should refuse the run directory, got %v", err)
+	}
+	statuses, err := client.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	for _, st := range statuses {
+		if st.State == StateRunning {
+			t.Errorf("%s still running after shutdown", st.Name)
+		}
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+	cancel()
+	if _, err := client.Status(context.Background()); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("expected ErrNotRunning after shutdown, got %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+// Package tfvars exports configuration as Terraform variable definitions,
+// for `tsk tfvars`: terraform.tfvars.json or an HCL .tfvars file. Each
+// top-level key becomes a variable and each section an object variable, so
+//
+//	[network]
+//	cidr: "10.0.0.0/16"
+//	zones: ["a", "b"]
+//
+// becomes network = { cidr = "10.0.0.0/16", zones = ["a", "b"] }, matching a
+// variable "network" of type object({ cidr = string, zones = list(string) }).
+package tfvars
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cyber-boost/tusktsk/pkg/config"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+	"github.com/cyber-boost/tusktsk/pkg/security"
+)
+
+// Format is an output format
+type Format string
+
+// Supported formats
+const (
+	FormatJSON Format = "json"
+	FormatHCL  Format = "hcl"
+)
+
+// ParseFormat converts a format name into a Format
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "json", "tfvars.json":
+		return FormatJSON, nil
+	case "hcl", "tfvars":
+		return FormatHCL, nil
+	}
+	return "", fmt.Errorf("unsupported format %q (use json or hcl)", name)
+}
+
+// FormatFor picks the format of an output file by its name: .json is JSON,
+// everything else HCL
+func FormatFor(file string) Format {
+	if strings.HasSuffix(file, ".json") {
+		return FormatJSON
+	}
+	return FormatHCL
+}
+
+// Options selects what is exported
+type Options struct {
+	// Sections, when set, are the only top-level keys exported
+	Sections []string
+	// Prefix keeps only the keys under it and strips it, so "terraform"
+	// exports the keys of [terraform] as top-level variables
+	Prefix string
+	// Secrets includes @secret values, decrypted; they are left out
+	// otherwise
+	Secrets bool
+}
+
+// Vars are the variables to export
+type Vars struct {
+	// Values holds the variables, sections nested as maps
+	Values map[string]interface{} `json:"values"`
+	// Skipped lists the @secret keys left out
+	Skipped []string `json:"skipped,omitempty"`
+
+	comments map[string]string
+}
+
+// variableName matches the names Terraform allows for variables
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// Export selects the keys of values by opts, resolves them with vm and
+// returns them as variables. comments, keyed like values, are written above
+// the variables of HCL output.
+func Export(values map[string]interface{}, comments map[string]string, vm *peanut.VM, opts Options) (*Vars, error) {
+	prefix := strings.TrimSuffix(opts.Prefix, ".")
+	sections := make(map[string]bool)
+	for _, section := range opts.Sections {
+		sections[section] = true
+	}
+
+	vars := &Vars{comments: make(map[string]string)}
+	selected := make(map[string]interface{})
+	for key, value := range values {
+		name := key
+		if prefix != "" {
+			rest, ok := strings.CutPrefix(key, prefix+".")
+			if !ok {
+				continue
+			}
+			name = rest
+		}
+		if len(sections) > 0 && !sections[strings.SplitN(name, ".", 2)[0]] {
+			continue
+		}
+		if s, ok := value.(string); ok && security.IsSecret(s) && !opts.Secrets {
+			vars.Skipped = append(vars.Skipped, key)
+			continue
+		}
+		selected[name] = value
+	}
+	// Comments are keyed by name too, sections included
+	for key, comment := range comments {
+		name := key
+		if prefix != "" {
+			rest, ok := strings.CutPrefix(key, prefix+".")
+			if !ok {
+				continue
+			}
+			name = rest
+		}
+		vars.comments[name] = comment
+	}
+	sort.Strings(vars.Skipped)
+
+	resolved, err := peanut.FromValues(selected).Execute(vm)
+	if err != nil {
+		return nil, err
+	}
+	vars.Values = config.Nest(resolved)
+	for name := range vars.Values {
+		if !variableName.MatchString(name) {
+			return nil, fmt.Errorf("%q is not a valid Terraform variable name", name)
+		}
+	}
+	return vars, nil
+}
+
+// Encode renders the variables in a format
+func (v *Vars) Encode(format Format) ([]byte, error) {
+	if format == FormatJSON {
+		data, err := json.MarshalIndent(v.Values, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	return v.HCL()
+}
+
+// HCL renders the variables as a .tfvars file, with the comments above
+// their keys
+func (v *Vars) HCL() ([]byte, error) {
+	var b strings.Builder
+	for i, name := range sortedKeys(v.Values) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		writeComment(&b, v.comments[name], "")
+		b.WriteString(name + " = ")
+		if err := v.writeValue(&b, v.Values[name], name, ""); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// writeValue writes value as an HCL expression; path is its key, for
+// comments, and indent the indentation of the line it starts on
+func (v *Vars) writeValue(b *strings.Builder, value interface{}, path, indent string) error {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+		b.WriteString("{\n")
+		inner := indent + "  "
+		for _, key := range sortedKeys(val) {
+			writeComment(b, v.comments[path+"."+key], inner)
+			b.WriteString(inner + attributeName(key) + " = ")
+			if err := v.writeValue(b, val[key], path+"."+key, inner); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(indent + "}")
+	case []interface{}:
+		simple := true
+		for _, item := range val {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				simple = false
+			}
+		}
+		if simple {
+			b.WriteString("[")
+			for i, item := range val {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				if err := v.writeValue(b, item, path, indent); err != nil {
+					return err
+				}
+			}
+			b.WriteString("]")
+			return nil
+		}
+		b.WriteString("[\n")
+		inner := indent + "  "
+		for _, item := range val {
+			b.WriteString(inner)
+			if err := v.writeValue(b, item, path, inner); err != nil {
+				return err
+			}
+			b.WriteString(",\n")
+		}
+		b.WriteString(indent + "]")
+	case string:
+		b.WriteString(quote(val))
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(val))
+	case int:
+		b.WriteString(strconv.Itoa(val))
+	case int64:
+		b.WriteString(strconv.FormatInt(val, 10))
+	case float64:
+		if math.IsInf(val, 0) || math.IsNaN(val) {
+			return fmt.Errorf("%v has no HCL literal", val)
+		}
+		b.WriteString(strconv.FormatFloat(val, 'f', -1, 64))
+	default:
+		return fmt.Errorf("unsupported value of type %T", value)
+	}
+	return nil
+}
+
+// attributeName returns key bare when it is an identifier, quoted otherwise
+func attributeName(key string) string {
+	if variableName.MatchString(key) {
+		return key
+	}
+	return quote(key)
+}
+
+// quote returns s as an HCL string literal; template sequences are escaped
+// so values are never interpolated
+func quote(s string) string {
+	data, _ := json.Marshal(s)
+	quoted := strings.ReplaceAll(string(data), "${", "$${")
+	return strings.ReplaceAll(quoted, "%{", "%%{")
+}
+
+// writeComment writes a TSK comment as # lines
+func writeComment(b *strings.Builder, comment, indent string) {
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		b.WriteString(strings.TrimRight(indent+"# "+line, " ") + "\n")
+	}
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,96 @@
+package tfvars
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
+)
+
+func TestExport(t *testing.T) {
+	t.Setenv("TFVARS_TEST_REGION", "eu-west-1")
+	values := map[string]interface{}{
+		"terraform.region":         `@env("TFVARS_TEST_REGION")`,
+		"terraform.network.cidr":   "10.0.0.0/16",
+		"terraform.network.zones":  []interface{}{"a", "b"},
+		"terraform.instance_count": 3,
+		"terraform.tags":           map[string]interface{}{"team": "platform", "cost-center": "42", "a b": 1},
+		"terraform.rules":          []interface{}{map[string]interface{}{"port": 443, "public": true}},
+		"terraform.template":       "${var.name}",
+		"terraform.db_password":    `@secret("c2VjcmV0")`,
+		"app.name":                 "api",
+	}
+	comments := map[string]string{"terraform.network": "VPC layout", "terraform.network.cidr": "Primary range\nDo not shrink"}
+
+	vars, err := Export(values, comments, peanut.NewVM(), Options{Prefix: "terraform"})
+	if err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	if !reflect.DeepEqual(vars.Skipped, []string{"terraform.db_password"}) {
+		t.Errorf("Skipped = %v", vars.Skipped)
+	}
+	if _, ok := vars.Values["app"]; ok || vars.Values["region"] != "eu-west-1" {
+		t.Errorf("unexpected variables %v", vars.Values)
+	}
+
+	hcl, err := vars.Encode(FormatHCL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `instance_count = 3
+
+# VPC layout
+network = {
+  # Primary range
+  # Do not shrink
+  cidr = "10.0.0.0/16"
+  zones = ["a", "b"]
+}
+
+region = "eu-west-1"
+
+rules = [
+  {
+    port = 443
+    public = true
+  },
+]
+
+tags = {
+  "a b" = 1
+  cost-center = "42"
+  team = "platform"
+}
+
+template = "$${var.name}"
+`
+	if string(hcl) != want {
+		t.Errorf("HCL =\n%s\nwant\n%s", hcl, want)
+	}
+
+	data, err := vars.Encode(FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["network"].(map[string]interface{})["cidr"] != "10.0.0.0/16" || decoded["template"] != "${var.name}" {
+		t.Errorf("unexpected JSON %s", data)
+	}
+
+	vars, err = Export(values, nil, peanut.NewVM(), Options{Prefix: "terraform", Sections: []string{"network"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars.Values) != 1 || vars.Values["network"] == nil {
+		t.Errorf("--section did not select network: %v", vars.Values)
+	}
+
+	if _, err := Export(map[string]interface{}{"bad name": 1}, nil, peanut.NewVM(), Options{}); err == nil || !strings.Contains(err.Error(), "variable name") {
+		t.Errorf("expected an invalid name error, got %v", err)
+	}
+}
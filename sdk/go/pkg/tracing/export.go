@@ -0,0 +1,392 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Exporter sends ended spans somewhere
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Close() error
+}
+
+// newExporter creates the exporter opts names; none has none
+func newExporter(opts Options) (Exporter, error) {
+	switch opts.Exporter {
+	case "otlp", "":
+		return NewOTLPExporter(opts.Endpoint, opts.Headers, opts.ServiceName)
+	case "stdout":
+		if opts.File == "" {
+			return NewJSONExporter(os.Stdout), nil
+		}
+		file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter := NewJSONExporter(file)
+		exporter.closer = file
+		return exporter, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown exporter %q", opts.Exporter)
+}
+
+// OTLPExporter posts spans to an OpenTelemetry collector with the OTLP/HTTP
+// protocol, JSON encoded
+type OTLPExporter struct {
+	url      string
+	headers  map[string]string
+	resource []attribute.KeyValue
+	client   *http.Client
+}
+
+// NewOTLPExporter exports to endpoint, adding /v1/traces unless it names a
+// path, with headers on every request and spans attributed to service
+func NewOTLPExporter(endpoint string, headers map[string]string, service string) (*OTLPExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return &OTLPExporter{
+		url:      u.String(),
+		headers:  headers,
+		resource: []attribute.KeyValue{attribute.String("service.name", service)},
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Export posts spans in one request
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(otlpRequest(e.resource, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export %d span(s): %w", len(spans), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to export %d span(s): %s: %s", len(spans), resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Close releases nothing; requests in flight finish on their own
+func (e *OTLPExporter) Close() error {
+	return nil
+}
+
+// otlpRequest builds an ExportTraceServiceRequest in the protocol's JSON
+// mapping: IDs in hex, 64-bit integers as strings, spans grouped by scope
+func otlpRequest(resource []attribute.KeyValue, spans []SpanData) map[string]interface{} {
+	var scopes []string
+	byScope := make(map[string][]interface{})
+	for _, s := range spans {
+		if _, ok := byScope[s.Scope]; !ok {
+			scopes = append(scopes, s.Scope)
+		}
+		span := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.TraceID[:]),
+			"spanId":            hex.EncodeToString(s.SpanID[:]),
+			"name":              s.Name,
+			"kind":              int(s.Kind),
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.Attributes),
+			"status":            otlpStatus(s.Status, s.StatusMessage),
+		}
+		if s.Parent.IsValid() {
+			span["parentSpanId"] = hex.EncodeToString(s.Parent[:])
+		}
+		if len(s.Events) > 0 {
+			events := make([]interface{}, len(s.Events))
+			for i, e := range s.Events {
+				events[i] = map[string]interface{}{
+					"timeUnixNano": strconv.FormatInt(e.Time.UnixNano(), 10),
+					"name":         e.Name,
+					"attributes":   otlpAttributes(e.Attributes),
+				}
+			}
+			span["events"] = events
+		}
+		byScope[s.Scope] = append(byScope[s.Scope], span)
+	}
+
+	scopeSpans := make([]interface{}, len(scopes))
+	for i, scope := range scopes {
+		scopeSpans[i] = map[string]interface{}{
+			"scope": map[string]interface{}{"name": scope},
+			"spans": byScope[scope],
+		}
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource":   map[string]interface{}{"attributes": otlpAttributes(resource)},
+			"scopeSpans": scopeSpans,
+		}},
+	}
+}
+
+// otlpStatus maps a status code to the protocol's: unset 0, ok 1, error 2
+func otlpStatus(code codes.Code, message string) map[string]interface{} {
+	status := map[string]interface{}{}
+	switch code {
+	case codes.Ok:
+		status["code"] = 1
+	case codes.Error:
+		status["code"] = 2
+		status["message"] = message
+	}
+	return status
+}
+
+func otlpAttributes(attrs []attribute.KeyValue) []interface{} {
+	out := make([]interface{}, 0, len(attrs))
+	for _, attr := range attrs {
+		out = append(out, map[string]interface{}{"key": string(attr.Key), "value": otlpValue(attr.Value)})
+	}
+	return out
+}
+
+func otlpValue(v attribute.Value) map[string]interface{} {
+	switch v.Type() {
+	case attribute.BOOL:
+		return map[string]interface{}{"boolValue": v.AsBool()}
+	case attribute.INT64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v.AsInt64(), 10)}
+	case attribute.FLOAT64:
+		return map[string]interface{}{"doubleValue": v.AsFloat64()}
+	case attribute.BOOLSLICE, attribute.INT64SLICE, attribute.FLOAT64SLICE, attribute.STRINGSLICE:
+		var values []interface{}
+		switch v.Type() {
+		case attribute.BOOLSLICE:
+			for _, b := range v.AsBoolSlice() {
+				values = append(values, otlpValue(attribute.BoolValue(b)))
+			}
+		case attribute.INT64SLICE:
+			for _, n := range v.AsInt64Slice() {
+				values = append(values, otlpValue(attribute.Int64Value(n)))
+			}
+		case attribute.FLOAT64SLICE:
+			for _, f := range v.AsFloat64Slice() {
+				values = append(values, otlpValue(attribute.Float64Value(f)))
+			}
+		default:
+			for _, s := range v.AsStringSlice() {
+				values = append(values, otlpValue(attribute.StringValue(s)))
+			}
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	}
+	return map[string]interface{}{"stringValue": v.Emit()}
+}
+
+// JSONExporter writes each span as a line of JSON
+type JSONExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewJSONExporter writes spans to w
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{w: w}
+}
+
+// jsonSpan is the line JSONExporter writes for a span
+type jsonSpan struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	Kind       string                 `json:"kind"`
+	Start      time.Time              `json:"start"`
+	Duration   time.Duration          `json:"duration_ns"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Events     []jsonEvent            `json:"events,omitempty"`
+	Status     string                 `json:"status,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type jsonEvent struct {
+	Name       string                 `json:"name"`
+	Time       time.Time              `json:"time"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Export writes spans, one line each
+func (e *JSONExporter) Export(ctx context.Context, spans []SpanData) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, s := range spans {
+		line := jsonSpan{
+			TraceID:    s.TraceID.String(),
+			SpanID:     s.SpanID.String(),
+			Name:       s.Name,
+			Kind:       s.Kind.String(),
+			Start:      s.Start,
+			Duration:   s.Duration(),
+			Attributes: attributeMap(s.Attributes),
+		}
+		if s.Parent.IsValid() {
+			line.ParentID = s.Parent.String()
+		}
+		if s.Status != codes.Unset {
+			line.Status = s.Status.String()
+			line.Error = s.StatusMessage
+		}
+		for _, event := range s.Events {
+			line.Events = append(line.Events, jsonEvent{Name: event.Name, Time: event.Time, Attributes: attributeMap(event.Attributes)})
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+// Close closes the file spans were written to, if the exporter opened it
+func (e *JSONExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+func attributeMap(attrs []attribute.KeyValue) map[string]interface{} {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(attrs))
+	for _, attr := range attrs {
+		m[string(attr.Key)] = attr.Value.AsInterface()
+	}
+	return m
+}
+
+// Batching limits: spans are exported every batchInterval or once
+// batchSize are queued; past queueSize, new spans are dropped
+const (
+	batchSize     = 512
+	batchInterval = 5 * time.Second
+	queueSize     = 4096
+)
+
+// batcher queues ended spans and exports them in batches from its own
+// goroutine, so recording a span never waits on the network
+type batcher struct {
+	exporter Exporter
+	report   func(error)
+	queue    chan SpanData
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newBatcher(exporter Exporter, report func(error)) *batcher {
+	if report == nil {
+		report = func(error) {}
+	}
+	b := &batcher{
+		exporter: exporter,
+		report:   report,
+		queue:    make(chan SpanData, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *batcher) add(span SpanData) {
+	select {
+	case b.queue <- span:
+	default:
+		// Recording must not block the traced code
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+	batch := make([]SpanData, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := b.exporter.Export(ctx, batch); err != nil {
+			b.report(err)
+		}
+		cancel()
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span := <-b.queue:
+			batch = append(batch, span)
+			if len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-b.stop:
+			for {
+				select {
+				case span := <-b.queue:
+					batch = append(batch, span)
+					if len(batch) == batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// shutdown exports what is queued and closes the exporter
+func (b *batcher) shutdown(ctx context.Context) error {
+	b.once.Do(func() { close(b.stop) })
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return b.exporter.Close()
+}
@@ -0,0 +1,315 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// SpanData is an ended span, as exporters and recorders receive it
+type SpanData struct {
+	Name       string
+	Scope      string
+	TraceID    trace.TraceID
+	SpanID     trace.SpanID
+	Parent     trace.SpanID
+	Kind       trace.SpanKind
+	Start      time.Time
+	End        time.Time
+	Attributes []attribute.KeyValue
+	Events     []Event
+	Status     codes.Code
+	// StatusMessage describes an error status
+	StatusMessage string
+}
+
+// Duration is how long the span lasted
+func (s SpanData) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Event is something that happened during a span, such as an error
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []attribute.KeyValue
+}
+
+// Provider creates the tracers of the spans it records, and hands them to
+// its exporter and recorder as they end
+type Provider struct {
+	embedded.TracerProvider
+
+	opts     Options
+	tracer   trace.Tracer
+	batcher  *batcher
+	recorder *Recorder
+	// sampleAll records every trace, as a recorder expects
+	sampleAll bool
+
+	mu      sync.Mutex
+	tracers map[string]*tracer
+}
+
+// NewProvider creates a provider exporting as opts configures and handing
+// spans to recorder when not nil. report receives the failures of exports.
+func NewProvider(opts Options, recorder *Recorder, report func(error)) (*Provider, error) {
+	p := &Provider{opts: opts, recorder: recorder, sampleAll: recorder != nil, tracers: make(map[string]*tracer)}
+	if opts.Enabled {
+		exporter, err := newExporter(opts)
+		if err != nil {
+			return nil, err
+		}
+		if exporter != nil {
+			p.batcher = newBatcher(exporter, report)
+		}
+	}
+	p.tracer = p.Tracer(Scope)
+	return p, nil
+}
+
+// Tracer returns the tracer of an instrumentation scope
+func (p *Provider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.tracers[name]
+	if !ok {
+		t = &tracer{provider: p, scope: name}
+		p.tracers[name] = t
+	}
+	return t
+}
+
+// Shutdown stops recording and exports the spans still queued, waiting
+// until ctx is done at most. Setup's global provider is uninstalled.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	current.CompareAndSwap(p, nil)
+	if p.batcher == nil {
+		return nil
+	}
+	return p.batcher.shutdown(ctx)
+}
+
+// sampled decides whether a new trace is recorded, by its ID so that every
+// service sampling at the same ratio agrees
+func (p *Provider) sampled(id trace.TraceID) bool {
+	switch {
+	case p.sampleAll || p.opts.SampleRatio >= 1:
+		return true
+	case p.opts.SampleRatio <= 0:
+		return false
+	}
+	bound := uint64(p.opts.SampleRatio * (1 << 63))
+	return binary.BigEndian.Uint64(id[8:16])>>1 < bound
+}
+
+// end hands an ended span on
+func (p *Provider) end(data SpanData) {
+	if p.recorder != nil {
+		p.recorder.add(data)
+	}
+	if p.batcher != nil {
+		p.batcher.add(data)
+	}
+}
+
+// tracer starts the spans of one instrumentation scope
+type tracer struct {
+	embedded.Tracer
+
+	provider *Provider
+	scope    string
+}
+
+func (t *tracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	parent := trace.SpanContextFromContext(ctx)
+	if cfg.NewRoot() {
+		parent = trace.SpanContext{}
+	}
+
+	traceID := parent.TraceID()
+	sampled := parent.IsSampled()
+	if !parent.IsValid() {
+		traceID = newTraceID()
+		sampled = t.provider.sampled(traceID)
+	}
+	var flags trace.TraceFlags
+	if sampled {
+		flags = trace.FlagsSampled
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     newSpanID(),
+		TraceFlags: flags,
+		TraceState: parent.TraceState(),
+	})
+	if !sampled {
+		// The context still propagates, so callees do not sample again
+		ctx = trace.ContextWithSpanContext(ctx, sc)
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	start := cfg.Timestamp()
+	if start.IsZero() {
+		start = time.Now()
+	}
+	kind := cfg.SpanKind()
+	if kind == trace.SpanKindUnspecified {
+		kind = trace.SpanKindInternal
+	}
+	s := &span{provider: t.provider, sc: sc, data: SpanData{
+		Name:       name,
+		Scope:      t.scope,
+		TraceID:    traceID,
+		SpanID:     sc.SpanID(),
+		Parent:     parent.SpanID(),
+		Kind:       kind,
+		Start:      start,
+		Attributes: append([]attribute.KeyValue(nil), cfg.Attributes()...),
+	}}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+// span records one operation until End
+type span struct {
+	embedded.Span
+
+	provider *Provider
+	sc       trace.SpanContext
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *span) End(options ...trace.SpanEndOption) {
+	cfg := trace.NewSpanEndConfig(options...)
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = cfg.Timestamp()
+	if s.data.End.IsZero() {
+		s.data.End = time.Now()
+	}
+	data := s.data
+	s.mu.Unlock()
+	s.provider.end(data)
+}
+
+func (s *span) AddEvent(name string, options ...trace.EventOption) {
+	cfg := trace.NewEventConfig(options...)
+	s.addEvent(name, cfg)
+}
+
+func (s *span) addEvent(name string, cfg trace.EventConfig) {
+	at := cfg.Timestamp()
+	if at.IsZero() {
+		at = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Events = append(s.data.Events, Event{Name: name, Time: at, Attributes: cfg.Attributes()})
+	}
+}
+
+func (s *span) IsRecording() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.ended
+}
+
+func (s *span) RecordError(err error, options ...trace.EventOption) {
+	if err == nil {
+		return
+	}
+	options = append(options, trace.WithAttributes(
+		attribute.String("exception.type", fmt.Sprintf("%T", err)),
+		attribute.String("exception.message", err.Error()),
+	))
+	s.addEvent("exception", trace.NewEventConfig(options...))
+}
+
+func (s *span) SpanContext() trace.SpanContext {
+	return s.sc
+}
+
+// SetStatus follows the specification: Ok is final, and Unset changes
+// nothing
+func (s *span) SetStatus(code codes.Code, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended || code == codes.Unset || s.data.Status == codes.Ok {
+		return
+	}
+	s.data.Status = code
+	s.data.StatusMessage = ""
+	if code == codes.Error {
+		s.data.StatusMessage = description
+	}
+}
+
+func (s *span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Name = name
+	}
+}
+
+func (s *span) SetAttributes(kv ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	// A key set again replaces its value
+	for _, attr := range kv {
+		replaced := false
+		for i := range s.data.Attributes {
+			if s.data.Attributes[i].Key == attr.Key {
+				s.data.Attributes[i], replaced = attr, true
+				break
+			}
+		}
+		if !replaced {
+			s.data.Attributes = append(s.data.Attributes, attr)
+		}
+	}
+}
+
+func (s *span) TracerProvider() trace.TracerProvider {
+	return s.provider
+}
+
+func newTraceID() trace.TraceID {
+	var id trace.TraceID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(id[8:], rand.Uint64())
+	}
+	return id
+}
+
+func newSpanID() trace.SpanID {
+	var id trace.SpanID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
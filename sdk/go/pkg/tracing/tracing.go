@@ -0,0 +1,264 @@
+// Package tracing records OpenTelemetry spans for file parses, hierarchy
+// loads, @operator evaluations, database queries and HTTP requests, and
+// exports them to an OTLP/HTTP collector or as JSON lines. It implements the
+// go.opentelemetry.io/otel/trace API, so code instrumented with otel.Tracer
+// is recorded too. It is configured by the [observability.tracing] section:
+//
+//	[observability.tracing]
+//	enabled: true
+//	exporter: "otlp"                      # otlp, stdout or none
+//	endpoint: "http://localhost:4318"     # spans are posted to /v1/traces
+//	headers {
+//	    authorization: @env("OTLP_AUTH")
+//	}
+//	service_name: "billing"
+//	sample_ratio: 0.25
+//
+// Tracing is off unless enabled is true or a Recorder asks for the spans,
+// as tsk --trace does to print the trace tree of a command.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Scope is the instrumentation scope of the spans this module records
+const Scope = "github.com/cyber-boost/tusktsk"
+
+// Exporters tracing can send spans to
+var Exporters = []string{"otlp", "stdout", "none"}
+
+// Options is the [observability.tracing] section of a configuration
+type Options struct {
+	Enabled bool
+	// Exporter is otlp, stdout or none; none keeps spans for a Recorder only
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector spans are posted to, under
+	// /v1/traces unless it names a path
+	Endpoint string
+	// Headers are sent with every export, such as an authorization
+	Headers map[string]string
+	// File receives the stdout exporter's JSON lines instead of stdout
+	File string
+	// ServiceName is the service.name of the exported spans
+	ServiceName string
+	// SampleRatio is the share of traces recorded, from 0 to 1; traces
+	// continued from a caller follow the caller's decision
+	SampleRatio float64
+}
+
+// DefaultOptions leaves tracing off; once enabled, every trace is exported
+// to an OTLP collector on localhost
+func DefaultOptions() Options {
+	return Options{Exporter: "otlp", Endpoint: "http://localhost:4318", ServiceName: "tsk", SampleRatio: 1}
+}
+
+// OptionsFrom reads Options from the flat observability.tracing.* keys of
+// an evaluated configuration. A relative file is taken relative to dir.
+func OptionsFrom(values map[string]interface{}, dir string) (Options, error) {
+	opts := DefaultOptions()
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "observability.tracing.")
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		var err error
+		switch setting {
+		case "enabled":
+			opts.Enabled, err = strconv.ParseBool(text)
+		case "exporter":
+			opts.Exporter = text
+			if !known(text) {
+				err = fmt.Errorf("supported: %s", strings.Join(Exporters, ", "))
+			}
+		case "endpoint":
+			opts.Endpoint = text
+			if !strings.HasPrefix(text, "http://") && !strings.HasPrefix(text, "https://") {
+				err = errors.New("must be an http:// or https:// URL")
+			}
+		case "file":
+			opts.File = text
+		case "service_name":
+			opts.ServiceName = text
+		case "sample_ratio":
+			opts.SampleRatio, err = strconv.ParseFloat(text, 64)
+			if err == nil && (opts.SampleRatio < 0 || opts.SampleRatio > 1) {
+				err = errors.New("must be between 0 and 1")
+			}
+		default:
+			header, ok := strings.CutPrefix(setting, "headers.")
+			if !ok {
+				return opts, fmt.Errorf("unknown setting observability.tracing.%s", setting)
+			}
+			if opts.Headers == nil {
+				opts.Headers = make(map[string]string)
+			}
+			opts.Headers[http.CanonicalHeaderKey(header)] = text
+		}
+		if err != nil {
+			return opts, fmt.Errorf("observability.tracing.%s: invalid value %q: %w", setting, text, err)
+		}
+	}
+	if opts.File != "" && !filepath.IsAbs(opts.File) {
+		opts.File = filepath.Join(dir, opts.File)
+	}
+	return opts, nil
+}
+
+func known(exporter string) bool {
+	for _, e := range Exporters {
+		if e == exporter {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// current is the provider Setup installed, nil while tracing is off
+	current atomic.Pointer[Provider]
+	// root carries the span Begin started
+	root atomic.Pointer[context.Context]
+)
+
+// Setup installs a provider recording spans as opts configures, and for
+// recorder when not nil, as the global OpenTelemetry tracer provider, with
+// W3C trace context propagation. report receives the failures of exports;
+// nil ignores them. It returns nil when opts is off and there is no
+// recorder. Shut the provider down to flush the spans it holds.
+func Setup(opts Options, recorder *Recorder, report func(error)) (*Provider, error) {
+	if !opts.Enabled && recorder == nil {
+		return nil, nil
+	}
+	p, err := NewProvider(opts, recorder, report)
+	if err != nil {
+		return nil, err
+	}
+	current.Store(p)
+	otel.SetTracerProvider(p)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return p, nil
+}
+
+// Enabled reports whether Setup installed a provider that is still running
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Start starts a span of kind as a child of the span in ctx, or of the span
+// Begin started when ctx carries none. While tracing is off it returns ctx
+// and a span that records nothing, without allocating; attributes are best
+// set once span.IsRecording() is true.
+func Start(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	p := current.Load()
+	if p == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if r := root.Load(); r != nil {
+			ctx = trace.ContextWithSpan(ctx, trace.SpanFromContext(*r))
+		}
+	}
+	return p.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+}
+
+// Begin starts the root span of a one-shot run, such as a command line:
+// spans started through Start without a parent become its children until
+// end is called
+func Begin(name string) (end func()) {
+	ctx, span := Start(context.Background(), name, trace.SpanKindInternal)
+	if !span.IsRecording() {
+		return func() {}
+	}
+	root.Store(&ctx)
+	return func() {
+		root.CompareAndSwap(&ctx, nil)
+		span.End()
+	}
+}
+
+// Fail marks span as failed with err, when err is not nil
+func Fail(span trace.Span, err error) {
+	if err != nil && span.IsRecording() {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Handler records a server span for every request to next, continuing the
+// trace of a traceparent header, and passes the span's context on in the
+// request. Requests pass through untouched while tracing is off.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !Enabled() {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		ctx := propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Start(ctx, r.Method+" "+r.URL.Path, trace.SpanKindServer)
+		defer span.End()
+		recorder := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		if span.IsRecording() {
+			span.SetAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.Path),
+				attribute.Int("http.status_code", recorder.status),
+			)
+			if recorder.status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(recorder.status))
+			}
+		}
+	})
+}
+
+// Inject adds the trace context of ctx to the headers of an outgoing
+// request, so the server it goes to continues the trace
+func Inject(ctx context.Context, header http.Header) {
+	if Enabled() {
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(header))
+	}
+}
+
+// statusRecorder records the status of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written bool
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.written {
+		w.status, w.written = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
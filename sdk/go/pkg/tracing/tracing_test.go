@@ -0,0 +1,236 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{
+		"observability.tracing.enabled":               true,
+		"observability.tracing.exporter":              "stdout",
+		"observability.tracing.file":                  "traces.jsonl",
+		"observability.tracing.service_name":          "billing",
+		"observability.tracing.sample_ratio":          0.25,
+		"observability.tracing.headers.authorization": "Bearer abc",
+		"server.port": 8080,
+	}, "/srv/app")
+	if err != nil {
+		t.Fatalf("OptionsFrom() returned error: %v", err)
+	}
+	if !opts.Enabled || opts.Exporter != "stdout" || opts.File != "/srv/app/traces.jsonl" || opts.ServiceName != "billing" || opts.SampleRatio != 0.25 || opts.Headers["Authorization"] != "Bearer abc" {
+		t.Errorf("OptionsFrom() = %+v", opts)
+	}
+
+	if opts, err := OptionsFrom(nil, "."); err != nil || opts.Enabled || opts.Endpoint != "http://localhost:4318" {
+		t.Errorf("tracing should be off by default, got %+v, %v", opts, err)
+	}
+	for key, value := range map[string]interface{}{"enabled": "maybe", "exporter": "jaeger", "endpoint": "localhost:4318", "sample_ratio": 2, "port": 4318} {
+		if _, err := OptionsFrom(map[string]interface{}{"observability.tracing." + key: value}, "."); err == nil {
+			t.Errorf("OptionsFrom() accepted %s: %v", key, value)
+		}
+	}
+}
+
+func TestStartWhileOff(t *testing.T) {
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() {
+		_, span := Start(ctx, "peanut.parse", trace.SpanKindInternal)
+		span.End()
+	})
+	if allocs != 0 {
+		t.Errorf("Start() allocated %v times while tracing is off", allocs)
+	}
+	if Enabled() {
+		t.Error("Enabled() = true before Setup")
+	}
+	if p, err := Setup(Options{}, nil, nil); p != nil || err != nil {
+		t.Errorf("Setup() = %v, %v for disabled options", p, err)
+	}
+}
+
+func TestRecorderTree(t *testing.T) {
+	recorder := NewRecorder()
+	p, err := Setup(Options{}, recorder, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := Begin("tsk config get")
+	_, parse := Start(context.Background(), "peanut.parse", trace.SpanKindInternal)
+	parse.SetAttributes(attribute.String("tsk.file", "peanu.tsk"))
+	parse.End()
+	ctx, execute := Start(context.Background(), "peanut.execute", trace.SpanKindInternal)
+	_, op := Start(ctx, "@env", trace.SpanKindInternal)
+	Fail(op, errors.New("HOME is not set"))
+	op.End()
+	execute.End()
+	end()
+	p.Shutdown(context.Background())
+	if Enabled() {
+		t.Error("Enabled() = true after Shutdown")
+	}
+
+	spans := recorder.Spans()
+	if len(spans) != 4 {
+		t.Fatalf("recorded %d spans, want 4", len(spans))
+	}
+	var out bytes.Buffer
+	recorder.WriteTree(&out)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{"tsk config get ", "├─ peanut.parse ", "└─ peanut.execute ", "   └─ @env "}
+	if len(lines) != len(want) {
+		t.Fatalf("WriteTree() wrote:\n%s", out.String())
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = %q, want it to start with %q", i, lines[i], prefix)
+		}
+	}
+	if !strings.Contains(lines[1], "tsk.file=peanu.tsk") || !strings.Contains(lines[3], "❌ HOME is not set") {
+		t.Errorf("WriteTree() wrote:\n%s", out.String())
+	}
+}
+
+func TestOTLPExport(t *testing.T) {
+	requests := make(chan map[string]interface{}, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer abc" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(rw, "bad request", http.StatusBadRequest)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests <- body
+	}))
+	defer collector.Close()
+
+	p, err := Setup(Options{Enabled: true, Exporter: "otlp", Endpoint: collector.URL, Headers: map[string]string{"Authorization": "Bearer abc"}, ServiceName: "billing", SampleRatio: 1}, nil, func(err error) {
+		t.Errorf("export failed: %v", err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, parent := Start(context.Background(), "peanut.hierarchy", trace.SpanKindInternal)
+	_, child := Start(ctx, "SELECT", trace.SpanKindClient)
+	child.SetAttributes(attribute.Int("rows", 3))
+	child.End()
+	parent.End()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]interface{}
+	select {
+	case body = <-requests:
+	case <-time.After(time.Second):
+		t.Fatal("no spans were exported")
+	}
+	resource := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	service := resource["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if service["key"] != "service.name" || service["value"].(map[string]interface{})["stringValue"] != "billing" {
+		t.Errorf("resource attribute = %v", service)
+	}
+	scope := resource["scopeSpans"].([]interface{})[0].(map[string]interface{})
+	spans := scope["spans"].([]interface{})
+	if scope["scope"].(map[string]interface{})["name"] != Scope || len(spans) != 2 {
+		t.Fatalf("scopeSpans = %v", scope)
+	}
+	select_, hierarchy := spans[0].(map[string]interface{}), spans[1].(map[string]interface{})
+	if select_["name"] != "SELECT" || select_["kind"] != 3.0 || select_["parentSpanId"] != hierarchy["spanId"] || select_["traceId"] != hierarchy["traceId"] {
+		t.Errorf("spans = %v", spans)
+	}
+	if _, ok := select_["startTimeUnixNano"].(string); !ok {
+		t.Errorf("startTimeUnixNano = %v, want a string", select_["startTimeUnixNano"])
+	}
+	rows := select_["attributes"].([]interface{})[0].(map[string]interface{})
+	if rows["key"] != "rows" || rows["value"].(map[string]interface{})["intValue"] != "3" {
+		t.Errorf("attribute = %v", rows)
+	}
+}
+
+func TestStdoutExportToFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.jsonl")
+	p, err := Setup(Options{Enabled: true, Exporter: "stdout", File: file, SampleRatio: 1}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(context.Background(), "peanut.parse", trace.SpanKindInternal)
+	span.End()
+	p.Shutdown(context.Background())
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var line jsonSpan
+	if err := json.Unmarshal(data, &line); err != nil || line.Name != "peanut.parse" || line.Kind != "internal" {
+		t.Errorf("exported %s (%v)", data, err)
+	}
+}
+
+func TestSampleRatio(t *testing.T) {
+	recorded := 0
+	p, _ := NewProvider(Options{SampleRatio: 0.5}, nil, nil)
+	for i := 0; i < 1000; i++ {
+		if p.sampled(newTraceID()) {
+			recorded++
+		}
+	}
+	if recorded < 400 || recorded > 600 {
+		t.Errorf("sampled %d of 1000 traces at 0.5", recorded)
+	}
+	if p, _ := NewProvider(Options{SampleRatio: 0}, NewRecorder(), nil); !p.sampled(newTraceID()) {
+		t.Error("a recorder should see every trace")
+	}
+}
+
+func TestHandlerContinuesTrace(t *testing.T) {
+	recorder := NewRecorder()
+	p, err := Setup(Options{}, recorder, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(context.Background())
+
+	var inner trace.SpanContext
+	app := Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		inner = trace.SpanContextFromContext(r.Context())
+		http.Error(rw, "boom", http.StatusInternalServerError)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rw := httptest.NewRecorder()
+	app.ServeHTTP(rw, req)
+	io.Copy(io.Discard, rw.Body)
+
+	spans := recorder.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.Name != "GET /api/users" || s.Kind != trace.SpanKindServer || s.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || s.Parent.String() != "00f067aa0ba902b7" {
+		t.Errorf("span = %+v", s)
+	}
+	if inner.SpanID() != s.SpanID || s.Status.String() != "Error" {
+		t.Errorf("handler saw %v, span = %+v", inner, s)
+	}
+
+	out := http.Header{}
+	Inject(trace.ContextWithSpanContext(context.Background(), inner), out)
+	if !strings.HasPrefix(out.Get("traceparent"), "00-4bf92f3577b34da6a3ce929d0e0e4736-"+s.SpanID.String()) {
+		t.Errorf("Inject() set traceparent %q", out.Get("traceparent"))
+	}
+}
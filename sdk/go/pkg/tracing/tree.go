@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRecorded bounds the spans a Recorder keeps; later spans are counted
+// but dropped
+const maxRecorded = 10000
+
+// Recorder keeps the spans of a run in memory, to print them as a tree
+type Recorder struct {
+	mu      sync.Mutex
+	spans   []SpanData
+	dropped int
+}
+
+// NewRecorder creates an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) add(span SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.spans) >= maxRecorded {
+		r.dropped++
+		return
+	}
+	r.spans = append(r.spans, span)
+}
+
+// Spans returns the recorded spans in the order they ended
+func (r *Recorder) Spans() []SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SpanData(nil), r.spans...)
+}
+
+// WriteTree writes the recorded spans as a tree: each span with its
+// duration, attributes and error, its children in the order they started.
+// Spans whose parent was not recorded are printed as roots.
+func (r *Recorder) WriteTree(w io.Writer) error {
+	spans := r.Spans()
+	r.mu.Lock()
+	dropped := r.dropped
+	r.mu.Unlock()
+
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	recorded := make(map[trace.SpanID]bool, len(spans))
+	for _, s := range spans {
+		recorded[s.SpanID] = true
+	}
+	children := make(map[trace.SpanID][]SpanData)
+	var roots []SpanData
+	for _, s := range spans {
+		if s.Parent.IsValid() && recorded[s.Parent] {
+			children[s.Parent] = append(children[s.Parent], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+
+	var b strings.Builder
+	var walk func(s SpanData, indent, branch string)
+	walk = func(s SpanData, indent, branch string) {
+		b.WriteString(indent)
+		b.WriteString(branch)
+		b.WriteString(spanLine(s))
+		b.WriteByte('\n')
+		switch branch {
+		case "├─ ":
+			indent += "│  "
+		case "└─ ":
+			indent += "   "
+		}
+		kids := children[s.SpanID]
+		for i, child := range kids {
+			if i == len(kids)-1 {
+				walk(child, indent, "└─ ")
+			} else {
+				walk(child, indent, "├─ ")
+			}
+		}
+	}
+	for _, s := range roots {
+		walk(s, "", "")
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&b, "… %d more span(s) not recorded\n", dropped)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// spanLine describes a span on one line of the tree
+func spanLine(s SpanData) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", s.Name, s.Duration().Round(time.Microsecond))
+	for _, attr := range s.Attributes {
+		fmt.Fprintf(&b, " %s=%s", attr.Key, attr.Value.Emit())
+	}
+	if s.Status == codes.Error {
+		fmt.Fprintf(&b, " ❌ %s", s.StatusMessage)
+	}
+	return b.String()
+}
@@ -60,6 +60,12 @@ func (w *WebCLI) startCommand() *cobra.Command {
 				}
 			}
 
+			authenticator, err := LoadAuthenticator(config.ConfigDir)
+			if err != nil {
+				return fmt.Errorf("failed to load [auth]: %w", err)
+			}
+			config.Authenticator = authenticator
+
 			// Create and start framework
 			w.framework = NewFramework(config)
 			
@@ -75,6 +81,7 @@ func (w *WebCLI) startCommand() *cobra.Command {
 			fmt.Printf("⏰ Read Timeout: %v\n", config.ReadTimeout)
 			fmt.Printf("⏰ Write Timeout: %v\n", config.WriteTimeout)
 			fmt.Printf("📦 Max Header Bytes: %d\n", config.MaxHeaderBytes)
+			fmt.Printf("🔑 Authentication: %t\n", config.Authenticator != nil)
 			fmt.Println()
 
 			return w.framework.Start()
@@ -2,6 +2,7 @@ package web
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -9,9 +10,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/cyber-boost/tusktsk/pkg/auth"
+	"github.com/cyber-boost/tusktsk/pkg/configgraph"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
@@ -43,6 +46,34 @@ type Config struct {
 	EnableWebSocket bool          `json:"enable_websocket"`
 	StaticPath      string        `json:"static_path"`
 	LogLevel        string        `json:"log_level"`
+	// ConfigDir is the directory whose configuration hierarchy /graphql serves
+	ConfigDir       string        `json:"config_dir"`
+	// GraphQLMaxDepth limits how deeply /graphql queries can nest
+	GraphQLMaxDepth int           `json:"graphql_max_depth"`
+	// Authenticator, when set, authenticates every route but /health and
+	// /metrics; LoadAuthenticator builds it from the [auth] section
+	Authenticator auth.Authenticator `json:"-"`
+}
+
+// LoadAuthenticator returns the authenticator of the [auth] section of
+// the configuration hierarchy of dir, or nil when it has none
+func LoadAuthenticator(dir string) (auth.Authenticator, error) {
+	cfg, _, err := peanut.LoadHierarchy(dir)
+	if errors.Is(err, peanut.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	values, err := cfg.Execute(peanut.NewVM())
+	if err != nil {
+		return nil, err
+	}
+	opts, err := auth.OptionsFrom(values)
+	if err != nil || !opts.Configured() {
+		return nil, err
+	}
+	return auth.New(opts)
 }
 
 // DefaultConfig returns default configuration
@@ -59,11 +90,20 @@ func DefaultConfig() *Config {
 		EnableWebSocket: true,
 		StaticPath:      "./static",
 		LogLevel:        "info",
+		ConfigDir:       ".",
+		GraphQLMaxDepth: configgraph.DefaultMaxDepth,
 	}
 }
 
 // NewFramework creates a new web framework instance
 func NewFramework(config *Config) *Framework {
+	return newFramework(config, NewMetrics())
+}
+
+// newFramework creates a framework recording to metrics; NewMetrics
+// registers with the default Prometheus registry, so a process creates
+// them once
+func newFramework(config *Config, metrics *Metrics) *Framework {
 	if config == nil {
 		config = DefaultConfig()
 	}
@@ -95,7 +135,7 @@ func NewFramework(config *Config) *Framework {
 				return true // Allow all origins for development
 			},
 		},
-		metrics:   NewMetrics(),
+		metrics:   metrics,
 		tracer:    otel.Tracer("tusktsk-web"),
 		config:    config,
 		clients:   make(map[*websocket.Conn]bool),
@@ -119,8 +159,14 @@ func (f *Framework) setupRoutes() {
 		f.engine.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	}
 
+	// Routes below need an identity when there is an authenticator
+	var authenticate []gin.HandlerFunc
+	if f.config.Authenticator != nil {
+		authenticate = []gin.HandlerFunc{identityMiddleware(f.config.Authenticator)}
+	}
+
 	// API routes
-	api := f.engine.Group("/api/v1")
+	api := f.engine.Group("/api/v1", authenticate...)
 	{
 		api.GET("/status", f.statusHandler)
 		api.GET("/info", f.infoHandler)
@@ -129,7 +175,7 @@ func (f *Framework) setupRoutes() {
 
 	// WebSocket endpoint
 	if f.config.EnableWebSocket {
-		f.engine.GET("/ws", f.websocketHandler)
+		f.engine.GET("/ws", withHandler(authenticate, f.websocketHandler)...)
 	}
 
 	// Static file serving
@@ -137,9 +183,15 @@ func (f *Framework) setupRoutes() {
 		f.engine.Static("/static", f.config.StaticPath)
 	}
 
-	// GraphQL endpoint (placeholder for now)
-	f.engine.POST("/graphql", f.graphqlHandler)
-	f.engine.GET("/graphql", f.graphqlPlaygroundHandler)
+	// GraphQL endpoint over the configuration
+	f.engine.POST("/graphql", withHandler(authenticate, f.graphqlHandler)...)
+	f.engine.GET("/graphql", withHandler(authenticate, f.graphqlPlaygroundHandler)...)
+}
+
+// withHandler returns middleware followed by handler, leaving middleware
+// unchanged
+func withHandler(middleware []gin.HandlerFunc, handler gin.HandlerFunc) []gin.HandlerFunc {
+	return append(append([]gin.HandlerFunc(nil), middleware...), handler)
 }
 
 // Start starts the web server
@@ -3,10 +3,13 @@ package web
 import (
 	"encoding/json"
 	"fmt"
+	"html"
 	"net/http"
 	"runtime"
 	"time"
 
+	"github.com/cyber-boost/tusktsk/pkg/configgraph"
+	"github.com/cyber-boost/tusktsk/pkg/peanut"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"go.opentelemetry.io/otel/attribute"
@@ -211,34 +214,62 @@ func (f *Framework) handleWebSocketMessages(conn *websocket.Conn) {
 	}
 }
 
+// configGraph loads the configuration hierarchy of ConfigDir as a GraphQL
+// graph; it is loaded per request so edits show without a restart. The
+// returned function releases the configuration.
+func (f *Framework) configGraph() (*configgraph.Graph, func(), error) {
+	cfg, _, err := peanut.LoadHierarchy(f.config.ConfigDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	graph, err := configgraph.New(cfg, configgraph.Options{MaxDepth: f.config.GraphQLMaxDepth})
+	if err != nil {
+		cfg.Close()
+		return nil, nil, err
+	}
+	return graph, func() { cfg.Close() }, nil
+}
+
 // graphqlHandler handles GraphQL requests
 func (f *Framework) graphqlHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 	_, span := f.tracer.Start(ctx, "graphql_request")
 	defer span.End()
 
-	// For now, return a placeholder response
-	// This will be implemented with a proper GraphQL server
-	response := gin.H{
-		"data": gin.H{
-			"message": "GraphQL endpoint - coming soon",
-		},
-		"errors": []string{},
+	graph, release, err := f.configGraph()
+	if err != nil {
+		span.SetAttributes(attribute.String("graphql.status", "error"))
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": []gin.H{{"message": err.Error()}}})
+		return
 	}
+	defer release()
+	graph.ServeHTTP(c.Writer, c.Request)
 
 	span.SetAttributes(
-		attribute.String("graphql.status", "placeholder"),
+		attribute.String("graphql.status", "served"),
 	)
-
-	c.JSON(http.StatusOK, response)
 }
 
-// graphqlPlaygroundHandler serves GraphQL playground
+// graphqlPlaygroundHandler serves GraphQL playground, or runs the query of
+// a GET request
 func (f *Framework) graphqlPlaygroundHandler(c *gin.Context) {
+	if c.Query("query") != "" {
+		f.graphqlHandler(c)
+		return
+	}
+
 	ctx := c.Request.Context()
 	_, span := f.tracer.Start(ctx, "graphql_playground")
 	defer span.End()
 
+	schema := "The configuration could not be loaded"
+	if graph, release, err := f.configGraph(); err != nil {
+		schema += ": " + err.Error()
+	} else {
+		schema = graph.Schema().String()
+		release()
+	}
+
 	// Return GraphQL playground HTML
 	playground := `
 <!DOCTYPE html>
@@ -251,18 +282,21 @@ func (f *Framework) graphqlPlaygroundHandler(c *gin.Context) {
         .header { background: #f5f5f5; padding: 20px; border-radius: 8px; margin-bottom: 20px; }
         .content { background: #fff; padding: 20px; border: 1px solid #ddd; border-radius: 8px; }
         .endpoint { background: #e8f4fd; padding: 10px; border-radius: 4px; font-family: monospace; }
+        pre { background: #f8f8f8; padding: 10px; border-radius: 4px; overflow-x: auto; }
     </style>
 </head>
 <body>
     <div class="container">
         <div class="header">
             <h1>🚀 TuskTSK GraphQL Playground</h1>
-            <p>High-performance GraphQL API for TuskTSK Go SDK</p>
+            <p>The configuration as a typed graph: sections are types, keys are fields</p>
         </div>
         <div class="content">
             <h2>GraphQL Endpoint</h2>
-            <div class="endpoint">POST /graphql</div>
-            <p>GraphQL server implementation coming soon...</p>
+            <div class="endpoint">POST /graphql {"query": "{ database { host port } }"}</div>
+            <p>Operator expressions are evaluated when a query selects them.</p>
+            <h2>Schema</h2>
+            <pre>` + html.EscapeString(schema) + `</pre>
         </div>
     </div>
 </body>
@@ -283,7 +317,7 @@ func (f *Framework) metricsHandler(c *gin.Context) {
 	defer span.End()
 
 	metrics := gin.H{
-		"requests_total": f.metrics.RequestsTotal,
+		"requests_total": counterValue(f.metrics.RequestsTotal),
 		"requests_duration": f.metrics.RequestsDuration,
 		"websocket_connections": len(f.clients),
 		"uptime_seconds": time.Since(f.startTime).Seconds(),
@@ -296,7 +330,7 @@ func (f *Framework) metricsHandler(c *gin.Context) {
 	}
 
 	span.SetAttributes(
-		attribute.Int("metrics.requests_total", f.metrics.RequestsTotal),
+		attribute.Float64("metrics.requests_total", counterValue(f.metrics.RequestsTotal)),
 		attribute.Int("metrics.websocket_connections", len(f.clients)),
 	)
 
@@ -7,6 +7,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // Metrics holds all Prometheus metrics
@@ -218,6 +219,15 @@ func NewMetrics() *Metrics {
 	return metrics
 }
 
+// counterValue returns the current value of c
+func counterValue(c prometheus.Counter) float64 {
+	var metric dto.Metric
+	if err := c.Write(&metric); err != nil {
+		return 0
+	}
+	return metric.GetCounter().GetValue()
+}
+
 // RecordRequest records an HTTP request
 func (m *Metrics) RecordRequest(method, path string, statusCode int, duration time.Duration, size int) {
 	m.mu.Lock()
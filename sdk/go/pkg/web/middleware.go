@@ -5,10 +5,13 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/cyber-boost/tusktsk/pkg/auth"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -30,14 +33,16 @@ func corsMiddleware() gin.HandlerFunc {
 	})
 }
 
-// tracingMiddleware adds OpenTelemetry tracing
+// tracingMiddleware adds OpenTelemetry tracing, continuing the trace of a
+// traceparent header. Handlers find the span in c.Request.Context().
 func tracingMiddleware() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
-		ctx := c.Request.Context()
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
 		tracer := otel.Tracer("tusktsk-web")
 
 		spanName := c.Request.Method + " " + c.Request.URL.Path
 		ctx, span := tracer.Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindServer),
 			trace.WithAttributes(
 				attribute.String("http.method", c.Request.Method),
 				attribute.String("http.url", c.Request.URL.String()),
@@ -53,6 +58,9 @@ func tracingMiddleware() gin.HandlerFunc {
 		span.SetAttributes(
 			attribute.Int("http.status_code", c.Writer.Status()),
 		)
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(c.Writer.Status()))
+		}
 	})
 }
 
@@ -115,6 +123,32 @@ func authMiddleware(secret string) gin.HandlerFunc {
 	})
 }
 
+// identityMiddleware authenticates requests with a, answering 401 as
+// auth.Middleware does, and sets user_id, username and roles (the groups
+// of the identity) for roleMiddleware
+func identityMiddleware(a auth.Authenticator) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var id *auth.Identity
+		auth.Middleware(a, false, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			id, _ = auth.IdentityFrom(r.Context())
+			c.Request = r
+		})).ServeHTTP(c.Writer, c.Request)
+		if id == nil {
+			c.Abort()
+			return
+		}
+
+		roles := make([]interface{}, len(id.Groups))
+		for i, group := range id.Groups {
+			roles[i] = group
+		}
+		c.Set("user_id", id.User)
+		c.Set("username", id.User)
+		c.Set("roles", roles)
+		c.Next()
+	})
+}
+
 // roleMiddleware checks for specific roles
 func roleMiddleware(requiredRoles ...string) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -265,10 +265,10 @@ func (a *AdaptiveRateLimiter) Allow(key string) bool {
 	// Update user score based on behavior
 	if allowed {
 		// Increment score for good behavior
-		a.userScores[key] = min(1.0, a.userScores[key]+a.scoreIncrement)
+		a.userScores[key] = minFloat(1.0, a.userScores[key]+a.scoreIncrement)
 	} else {
 		// Decrement score for bad behavior
-		a.userScores[key] = max(-1.0, a.userScores[key]-a.scoreIncrement)
+		a.userScores[key] = maxFloat(-1.0, a.userScores[key]-a.scoreIncrement)
 	}
 
 	return allowed
@@ -287,7 +287,7 @@ func (a *AdaptiveRateLimiter) SetScore(key string, score float64) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	a.userScores[key] = max(-1.0, min(1.0, score))
+	a.userScores[key] = maxFloat(-1.0, minFloat(1.0, score))
 }
 
 // GetStats returns adaptive rate limiter statistics
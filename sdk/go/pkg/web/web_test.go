@@ -0,0 +1,221 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cyber-boost/tusktsk/pkg/auth"
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// testMetrics is shared by the frameworks of the tests, as NewMetrics
+// registers with the default Prometheus registry
+var testMetrics = sync.OnceValue(NewMetrics)
+
+// newTestFramework returns a framework serving the configuration content
+// as ConfigDir, adjusted by configure
+func newTestFramework(t *testing.T, content string, configure func(*Config)) *Framework {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.ConfigDir = dir
+	config.StaticPath = ""
+	if configure != nil {
+		configure(config)
+	}
+	return newFramework(config, testMetrics())
+}
+
+func serve(f *Framework, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	f.GetEngine().ServeHTTP(rec, r)
+	return rec
+}
+
+func TestGraphQL(t *testing.T) {
+	f := newTestFramework(t, "[database]\nhost: \"db.internal\"\nport: 5432\npool.max: 10\n", func(c *Config) {
+		c.GraphQLMaxDepth = 2
+	})
+
+	rec := serve(f, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "{ database { host port } }"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /graphql = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data struct {
+			Database struct {
+				Host string `json:"host"`
+				Port int    `json:"port"`
+			} `json:"database"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Database.Host != "db.internal" || resp.Data.Database.Port != 5432 || len(resp.Errors) != 0 {
+		t.Errorf("POST /graphql = %s", rec.Body)
+	}
+
+	// A GET with a query runs it; without one it serves the playground
+	rec = serve(f, httptest.NewRequest(http.MethodGet, "/graphql?query="+`%7B%20database%20%7B%20host%20%7D%20%7D`, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"host":"db.internal"`) {
+		t.Errorf("GET /graphql?query= = %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(f, httptest.NewRequest(http.MethodGet, "/graphql", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "host: String") {
+		t.Errorf("GET /graphql = %d: %s", rec.Code, rec.Body)
+	}
+
+	// The depth limit holds, and malformed requests are refused
+	rec = serve(f, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "{ database { pool { max } } }"}`)))
+	if !strings.Contains(rec.Body.String(), "query depth 3 exceeds the limit of 2") {
+		t.Errorf("a query deeper than GraphQLMaxDepth = %s", rec.Body)
+	}
+	rec = serve(f, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`not json`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /graphql with a malformed body = %d, want 400", rec.Code)
+	}
+}
+
+func TestGraphQLWithoutConfiguration(t *testing.T) {
+	f := newTestFramework(t, "", func(c *Config) {
+		c.ConfigDir = t.TempDir()
+	})
+	rec := serve(f, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "{ app { name } }"}`)))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), `"errors"`) {
+		t.Errorf("POST /graphql without a configuration = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestTracingContinuesTrace(t *testing.T) {
+	recorder := tracing.NewRecorder()
+	p, err := tracing.Setup(tracing.Options{}, recorder, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(context.Background())
+
+	// Without a configuration /graphql fails with 500
+	f := newTestFramework(t, "", func(c *Config) {
+		c.ConfigDir = t.TempDir()
+	})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "{ app { name } }"}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if rec := serve(f, req); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("POST /graphql = %d, want 500", rec.Code)
+	}
+	serve(f, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	spans := map[string]tracing.SpanData{}
+	for _, s := range recorder.Spans() {
+		spans[s.Name] = s
+	}
+	server, handler := spans["POST /graphql"], spans["graphql_request"]
+	if server.Kind != trace.SpanKindServer || server.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent.String() != "00f067aa0ba902b7" {
+		t.Errorf("server span = %+v", server)
+	}
+	if server.Status != codes.Error || server.StatusMessage != http.StatusText(http.StatusInternalServerError) {
+		t.Errorf("server span status = %v %q, want an error", server.Status, server.StatusMessage)
+	}
+	if handler.TraceID != server.TraceID || handler.Parent != server.SpanID {
+		t.Errorf("handler span = %+v, want a child of %s", handler, server.SpanID)
+	}
+
+	// A request without traceparent starts a trace, and succeeds unset
+	health, ok := spans["GET /health"]
+	if !ok || health.TraceID == server.TraceID || health.Parent.IsValid() || health.Status != codes.Unset {
+		t.Errorf("GET /health span = %+v", health)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	token := "tsk_" + strings.Repeat("a1", 20)
+	content := "[app]\nname: \"billing\"\n\n[auth]\ntokens {\n    ci: \"" + auth.HashToken(token) + "\"\n}\n"
+	f := newTestFramework(t, content, func(c *Config) {
+		var err error
+		if c.Authenticator, err = LoadAuthenticator(c.ConfigDir); err != nil || c.Authenticator == nil {
+			t.Fatalf("LoadAuthenticator() = %v, %v", c.Authenticator, err)
+		}
+	})
+
+	request := func(method, path, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"query": "{ app { name } }"}`))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		return serve(f, req)
+	}
+	for _, route := range [][2]string{{"GET", "/api/v1/status"}, {"POST", "/graphql"}, {"GET", "/graphql"}, {"GET", "/ws"}} {
+		if rec := request(route[0], route[1], ""); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s without a token = %d, want 401", route[0], route[1], rec.Code)
+		}
+		if rec := request(route[0], route[1], "tsk_wrong"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s with a wrong token = %d, want 401", route[0], route[1], rec.Code)
+		}
+	}
+	if rec := request("POST", "/graphql", token); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"billing"`) {
+		t.Errorf("POST /graphql with the token = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := request("GET", "/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET /health without a token = %d, want 200", rec.Code)
+	}
+
+	// The identity reaches the handlers as user_id and roles
+	engine := gin.New()
+	engine.GET("/whoami", identityMiddleware(f.config.Authenticator), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user": c.GetString("user_id"), "roles": c.MustGet("roles")})
+	})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	engine.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"roles":[],"user":"ci"}` {
+		t.Errorf("GET /whoami = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLoadAuthenticatorWithoutAuth(t *testing.T) {
+	if a, err := LoadAuthenticator(t.TempDir()); a != nil || err != nil {
+		t.Errorf("LoadAuthenticator() without a configuration = %v, %v", a, err)
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte("[app]\nname: \"billing\"\n"), 0644)
+	if a, err := LoadAuthenticator(dir); a != nil || err != nil {
+		t.Errorf("LoadAuthenticator() without [auth] = %v, %v", a, err)
+	}
+	os.WriteFile(filepath.Join(dir, "peanu.tsk"), []byte("[auth]\ntokens {\n    ci: \"short\"\n}\n"), 0644)
+	if _, err := LoadAuthenticator(dir); err == nil {
+		t.Error("LoadAuthenticator() accepted a short token")
+	}
+}
+
+func TestWithHandler(t *testing.T) {
+	noop := func(*gin.Context) {}
+	middleware := make([]gin.HandlerFunc, 1, 4)
+	middleware[0] = noop
+	first := withHandler(middleware, noop)
+	second := withHandler(middleware, noop)
+	first[1] = nil
+	if len(middleware) != 1 || len(second) != 2 || second[1] == nil {
+		t.Errorf("withHandler() shares its result with the middleware: %d, %v", len(middleware), second)
+	}
+	if handlers := withHandler(nil, noop); len(handlers) != 1 {
+		t.Errorf("withHandler(nil) = %d handlers, want 1", len(handlers))
+	}
+}
@@ -0,0 +1,586 @@
+package webserve
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a handler
+type Middleware func(http.Handler) http.Handler
+
+// MiddlewareFactory builds a middleware from its settings, the keys under
+// server.middleware.<name>
+type MiddlewareFactory func(settings Settings) (Middleware, error)
+
+// NamedMiddleware is a middleware of the chain, with the name it was
+// declared under
+type NamedMiddleware struct {
+	Name       string
+	Middleware Middleware
+}
+
+var middlewareName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var (
+	middlewareMu sync.RWMutex
+	middlewares  = map[string]MiddlewareFactory{
+		"request_id": requestIDMiddleware,
+		"logging":    loggingMiddleware,
+		"cors":       corsMiddleware,
+		"rate_limit": rateLimitMiddleware,
+		"auth":       authMiddleware,
+	}
+)
+
+// RegisterMiddleware makes a middleware available to server.middleware.order
+// under name. A name that is already registered, built-in ones included, is
+// refused.
+func RegisterMiddleware(name string, factory MiddlewareFactory) error {
+	if !middlewareName.MatchString(name) || name == "order" {
+		return fmt.Errorf("invalid middleware name %q", name)
+	}
+	if factory == nil {
+		return fmt.Errorf("middleware %s has no factory", name)
+	}
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	if _, exists := middlewares[name]; exists {
+		return fmt.Errorf("middleware %s is already registered", name)
+	}
+	middlewares[name] = factory
+	return nil
+}
+
+// MustRegisterMiddleware is RegisterMiddleware for init functions: it
+// panics on a conflict
+func MustRegisterMiddleware(name string, factory MiddlewareFactory) {
+	if err := RegisterMiddleware(name, factory); err != nil {
+		panic(err)
+	}
+}
+
+// RegisteredMiddleware returns the names of the available middleware, sorted
+func RegisteredMiddleware() []string {
+	middlewareMu.RLock()
+	defer middlewareMu.RUnlock()
+	names := make([]string, 0, len(middlewares))
+	for name := range middlewares {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// middlewareFrom builds the chain server.middleware.order declares from the
+// flat keys under server.middleware
+func middlewareFrom(values map[string]interface{}) ([]NamedMiddleware, error) {
+	settings := make(map[string]Settings)
+	for key, value := range values {
+		name, setting, ok := strings.Cut(key, ".")
+		if !ok {
+			if key != "order" {
+				return nil, fmt.Errorf("unknown setting server.middleware.%s", key)
+			}
+			continue
+		}
+		if settings[name] == nil {
+			settings[name] = make(Settings)
+		}
+		settings[name][setting] = value
+	}
+
+	order, err := Settings(values).Strings("order", nil)
+	if err != nil {
+		return nil, fmt.Errorf("server.middleware.%w", err)
+	}
+	middlewareMu.RLock()
+	defer middlewareMu.RUnlock()
+	for name := range settings {
+		if _, ok := middlewares[name]; !ok {
+			return nil, fmt.Errorf("server.middleware.%s: unknown middleware", name)
+		}
+	}
+	chain := make([]NamedMiddleware, 0, len(order))
+	seen := make(map[string]bool)
+	for _, name := range order {
+		factory, ok := middlewares[name]
+		if !ok {
+			return nil, fmt.Errorf("server.middleware.order: unknown middleware %s (available: %s)", name, strings.Join(sortedNames(middlewares), ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("server.middleware.order: %s is listed twice", name)
+		}
+		seen[name] = true
+		m, err := factory(settings[name])
+		if err != nil {
+			return nil, fmt.Errorf("server.middleware.%s: %w", name, err)
+		}
+		chain = append(chain, NamedMiddleware{Name: name, Middleware: m})
+	}
+	return chain, nil
+}
+
+func sortedNames(m map[string]MiddlewareFactory) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// chain wraps handler so the first middleware sees requests first
+func chain(handler http.Handler, middleware []NamedMiddleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i].Middleware(handler)
+	}
+	return handler
+}
+
+// Settings are the settings of a middleware, with their values as the
+// configuration evaluated them
+type Settings map[string]interface{}
+
+// Check returns an error for settings other than known
+func (s Settings) Check(known ...string) error {
+	for key := range s {
+		found := false
+		for _, k := range known {
+			found = found || k == key
+		}
+		if !found {
+			return fmt.Errorf("unknown setting %s", key)
+		}
+	}
+	return nil
+}
+
+// String returns the setting key, or def
+func (s Settings) String(key, def string) string {
+	if value, ok := s[key]; ok {
+		return fmt.Sprint(value)
+	}
+	return def
+}
+
+// Strings returns the list setting key, or def; a string is split on commas
+func (s Settings) Strings(key string, def []string) ([]string, error) {
+	value, ok := s[key]
+	if !ok {
+		return def, nil
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		list := make([]string, len(v))
+		for i, item := range v {
+			list[i] = fmt.Sprint(item)
+		}
+		return list, nil
+	case string:
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("%s: %v is not a list", key, value)
+}
+
+// Bool returns the boolean setting key, or def
+func (s Settings) Bool(key string, def bool) (bool, error) {
+	value, ok := s[key]
+	if !ok {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(fmt.Sprint(value))
+	if err != nil {
+		return def, fmt.Errorf("%s: %v is not a boolean", key, value)
+	}
+	return b, nil
+}
+
+// Float returns the numeric setting key, or def
+func (s Settings) Float(key string, def float64) (float64, error) {
+	value, ok := s[key]
+	if !ok {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+	if err != nil || math.IsNaN(f) {
+		return def, fmt.Errorf("%s: %v is not a number", key, value)
+	}
+	return f, nil
+}
+
+// Duration returns the duration setting key, such as "10m", or def
+func (s Settings) Duration(key string, def time.Duration) (time.Duration, error) {
+	value, ok := s[key]
+	if !ok {
+		return def, nil
+	}
+	d, err := time.ParseDuration(fmt.Sprint(value))
+	if err != nil {
+		return def, fmt.Errorf("%s: %v is not a duration", key, value)
+	}
+	return d, nil
+}
+
+// request_id
+
+type requestIDKey struct{}
+
+// RequestID returns the ID the request_id middleware gave the request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts the IDs of upstream proxies: short and printable
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDMiddleware keeps the request ID a client or proxy sent, or
+// generates one, and echoes it in the response and to upstreams
+func requestIDMiddleware(s Settings) (Middleware, error) {
+	if err := s.Check("header"); err != nil {
+		return nil, err
+	}
+	header := http.CanonicalHeaderKey(s.String("header", "X-Request-ID"))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if !validRequestID.MatchString(id) {
+				b := make([]byte, 16)
+				rand.Read(b)
+				id = hex.EncodeToString(b)
+				r.Header.Set(header, id)
+			}
+			rw.Header().Set(header, id)
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}, nil
+}
+
+// logging
+
+// statusRecorder records the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += n
+	return n, err
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// loggingMiddleware logs a line per request, as text or JSON
+func loggingMiddleware(s Settings) (Middleware, error) {
+	if err := s.Check("format"); err != nil {
+		return nil, err
+	}
+	format := s.String("format", "text")
+	if format != "text" && format != "json" {
+		return nil, fmt.Errorf("format: %q is not text or json", format)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: rw}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			elapsed := time.Since(start)
+			if format == "json" {
+				line, _ := json.Marshal(map[string]interface{}{
+					"method": r.Method, "path": r.URL.RequestURI(), "status": rec.status, "bytes": rec.bytes,
+					"duration_ms": float64(elapsed.Microseconds()) / 1000, "remote": r.RemoteAddr, "request_id": RequestID(r.Context()),
+				})
+				log.Print(string(line))
+				return
+			}
+			line := fmt.Sprintf("%s %s %d %dB %s", r.Method, r.URL.RequestURI(), rec.status, rec.bytes, elapsed.Round(time.Microsecond))
+			if id := RequestID(r.Context()); id != "" {
+				line += " " + id
+			}
+			log.Print(line)
+		})
+	}, nil
+}
+
+// cors
+
+// corsMiddleware answers preflight requests and adds the CORS headers for
+// the allowed origins
+func corsMiddleware(s Settings) (Middleware, error) {
+	if err := s.Check("origins", "methods", "headers", "credentials", "max_age"); err != nil {
+		return nil, err
+	}
+	origins, err := s.Strings("origins", []string{"*"})
+	if err != nil {
+		return nil, err
+	}
+	methods, err := s.Strings("methods", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	if err != nil {
+		return nil, err
+	}
+	headers, err := s.Strings("headers", []string{"Content-Type", "Authorization"})
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := s.Bool("credentials", false)
+	if err != nil {
+		return nil, err
+	}
+	maxAge, err := s.Duration("max_age", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	anyOrigin := false
+	for _, origin := range origins {
+		anyOrigin = anyOrigin || origin == "*"
+	}
+	if anyOrigin && credentials {
+		return nil, fmt.Errorf("credentials cannot be allowed for every origin")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowed := origin != "" && anyOrigin
+			for _, o := range origins {
+				allowed = allowed || o == origin
+			}
+			if !allowed {
+				next.ServeHTTP(rw, r)
+				return
+			}
+			h := rw.Header()
+			h.Add("Vary", "Origin")
+			if anyOrigin {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+				rw.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}, nil
+}
+
+// rate_limit
+
+// bucket is the token bucket of a client
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitMiddleware allows each client IP rate requests per second, with
+// bursts of up to burst, and answers 429 beyond that
+func rateLimitMiddleware(s Settings) (Middleware, error) {
+	if err := s.Check("rate", "burst", "trust_proxy"); err != nil {
+		return nil, err
+	}
+	rate, err := s.Float("rate", 10)
+	if err != nil {
+		return nil, err
+	}
+	burst, err := s.Float("burst", 2*rate)
+	if err != nil {
+		return nil, err
+	}
+	if rate <= 0 || burst < 1 {
+		return nil, fmt.Errorf("rate must be positive and burst at least 1")
+	}
+	trustProxy, err := s.Bool("trust_proxy", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	buckets := make(map[string]*bucket)
+	lastSweep := time.Now()
+	// A bucket idle this long is full again and can be dropped
+	refill := time.Duration(burst / rate * float64(time.Second))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			client := clientIP(r, trustProxy)
+			now := time.Now()
+			mu.Lock()
+			if now.Sub(lastSweep) > time.Minute {
+				for ip, b := range buckets {
+					if now.Sub(b.last) > refill {
+						delete(buckets, ip)
+					}
+				}
+				lastSweep = now
+			}
+			b, ok := buckets[client]
+			if !ok {
+				b = &bucket{tokens: burst, last: now}
+				buckets[client] = b
+			}
+			b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+			b.last = now
+			allowed := b.tokens >= 1
+			if allowed {
+				b.tokens--
+			}
+			wait := (1 - b.tokens) / rate
+			mu.Unlock()
+
+			if !allowed {
+				rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait))))
+				http.Error(rw, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}, nil
+}
+
+// clientIP is the address of the client; behind a trusted proxy, the
+// address the proxy saw
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// auth
+
+// authMiddleware requires a bearer token or basic credentials, except for
+// the paths under exclude, matched by whole segments like route paths
+func authMiddleware(s Settings) (Middleware, error) {
+	if err := s.Check("type", "tokens", "users", "realm", "exclude"); err != nil {
+		return nil, err
+	}
+	kind := s.String("type", "bearer")
+	realm := s.String("realm", "tsk")
+	exclude, err := s.Strings("exclude", nil)
+	if err != nil {
+		return nil, err
+	}
+	var secrets [][]byte
+	switch kind {
+	case "bearer":
+		tokens, err := s.Strings("tokens", nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, token := range tokens {
+			// An unset @env gives an empty token, which must not let
+			// requests without one in
+			if token != "" {
+				secrets = append(secrets, []byte(token))
+			}
+		}
+	case "basic":
+		users, err := s.Strings("users", nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if name, password, _ := strings.Cut(user, ":"); name == "" || password == "" {
+				return nil, fmt.Errorf("users: entries must be user:password")
+			}
+			secrets = append(secrets, []byte(user))
+		}
+	default:
+		return nil, fmt.Errorf("type: %q is not bearer or basic", kind)
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no credentials: set %s", map[string]string{"bearer": "tokens", "basic": "users"}[kind])
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			for _, prefix := range exclude {
+				if pathUnder(r.URL.Path, prefix) {
+					next.ServeHTTP(rw, r)
+					return
+				}
+			}
+			var given []byte
+			if kind == "bearer" {
+				if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+					given = []byte(token)
+				}
+			} else if user, password, ok := r.BasicAuth(); ok {
+				given = []byte(user + ":" + password)
+			}
+			valid := 0
+			for _, secret := range secrets {
+				valid |= subtle.ConstantTimeCompare(given, secret)
+			}
+			if given == nil || valid != 1 {
+				scheme := "Bearer"
+				if kind == "basic" {
+					scheme = "Basic"
+				}
+				rw.Header().Set("WWW-Authenticate", fmt.Sprintf("%s realm=%q", scheme, realm))
+				http.Error(rw, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}, nil
+}
@@ -0,0 +1,279 @@
+// Package webserve is the server of `tsk web serve`: it serves the files of
+// a public directory and proxies path prefixes to upstream services, as the
+// [server] section configures:
+//
+//	[server]
+//	port: 8080
+//	public: "public"
+//	gzip: true
+//	tls_cert: "certs/site.crt"
+//	tls_key: "certs/site.key"
+//
+//	[server.routes]
+//	api: ["/api/", "http://localhost:3000"]
+//	assets.path: "/assets/"
+//	assets.target: "http://cdn.internal"
+//	assets.strip_prefix: true
+//
+//	[server.middleware]
+//	order: ["request_id", "logging", "cors", "rate_limit", "auth"]
+//	cors.origins: ["https://app.example.com"]
+//	rate_limit.rate: 5
+//	auth.tokens: [@env("API_TOKEN")]
+//	auth.exclude: ["/health"]
+//
+// A route is either a [path, target] list or a section with path, target
+// and strip_prefix. Requests go to the route with the longest matching
+// path; the rest are served from the public directory.
+//
+// Requests pass through the middleware in order, the first listed seeing
+// them first. Besides the built-in request_id, logging, cors, rate_limit
+// and auth, applications can add their own with RegisterMiddleware. The
+// chain wraps this server only; servers built on pkg/web have their own.
+package webserve
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyber-boost/tusktsk/pkg/tracing"
+)
+
+// Route proxies the requests under Path to Target
+type Route struct {
+	Name   string
+	Path   string
+	Target *url.URL
+	// StripPrefix removes Path from the request path before proxying
+	StripPrefix bool
+}
+
+// Options configures the server
+type Options struct {
+	Host string
+	Port int
+	// Public is the directory of static files
+	Public string
+	Routes []Route
+	Gzip   bool
+	// TLSCert and TLSKey, when set, serve HTTPS
+	TLSCert string
+	TLSKey  string
+	// ShutdownTimeout is how long in-flight requests get to finish on
+	// shutdown
+	ShutdownTimeout time.Duration
+	// Middleware wraps every request, the first seeing requests first
+	Middleware []NamedMiddleware
+}
+
+// DefaultOptions serves public/ on localhost:8080 with gzip
+func DefaultOptions() Options {
+	return Options{
+		Host:            "localhost",
+		Port:            8080,
+		Public:          "public",
+		Gzip:            true,
+		ShutdownTimeout: 10 * time.Second,
+	}
+}
+
+// Addr is the address to listen on
+func (o Options) Addr() string {
+	return fmt.Sprintf("%s:%d", o.Host, o.Port)
+}
+
+// TLS reports whether HTTPS is configured
+func (o Options) TLS() bool {
+	return o.TLSCert != ""
+}
+
+// OptionsFrom reads Options from the flat server.* keys of an evaluated
+// configuration. Relative paths are taken relative to dir.
+func OptionsFrom(values map[string]interface{}, dir string) (Options, error) {
+	opts := DefaultOptions()
+	routes := make(map[string]map[string]interface{})
+	middleware := make(map[string]interface{})
+	for key, value := range values {
+		setting, ok := strings.CutPrefix(key, "server.")
+		if !ok {
+			continue
+		}
+		if setting, ok := strings.CutPrefix(setting, "middleware."); ok {
+			middleware[setting] = value
+			continue
+		}
+		if route, ok := strings.CutPrefix(setting, "routes."); ok {
+			name, field, _ := strings.Cut(route, ".")
+			if routes[name] == nil {
+				routes[name] = make(map[string]interface{})
+			}
+			routes[name][field] = value
+			continue
+		}
+		text := fmt.Sprint(value)
+		var err error
+		switch setting {
+		case "host":
+			opts.Host = text
+		case "port":
+			opts.Port, err = strconv.Atoi(text)
+			if err == nil && (opts.Port < 0 || opts.Port > 65535) {
+				err = fmt.Errorf("out of range")
+			}
+		case "public":
+			opts.Public = text
+		case "gzip":
+			opts.Gzip, err = strconv.ParseBool(text)
+		case "tls_cert":
+			opts.TLSCert = text
+		case "tls_key":
+			opts.TLSKey = text
+		case "shutdown_timeout":
+			opts.ShutdownTimeout, err = time.ParseDuration(text)
+		default:
+			return opts, fmt.Errorf("unknown setting server.%s", setting)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("server.%s: invalid value %q: %w", setting, text, err)
+		}
+	}
+	if (opts.TLSCert == "") != (opts.TLSKey == "") {
+		return opts, fmt.Errorf("server.tls_cert and server.tls_key must be set together")
+	}
+	for _, path := range []*string{&opts.Public, &opts.TLSCert, &opts.TLSKey} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		route, err := parseRoute(name, routes[name])
+		if err != nil {
+			return opts, err
+		}
+		opts.Routes = append(opts.Routes, route)
+	}
+	var err error
+	opts.Middleware, err = middlewareFrom(middleware)
+	return opts, err
+}
+
+// parseRoute reads server.routes.<name>, given as fields; a [path, target]
+// list is the field ""
+func parseRoute(name string, fields map[string]interface{}) (Route, error) {
+	route := Route{Name: name}
+	var target string
+	for field, value := range fields {
+		switch field {
+		case "":
+			list, ok := value.([]interface{})
+			if !ok || len(list) != 2 {
+				return route, fmt.Errorf("server.routes.%s must be a [path, target] list or a section", name)
+			}
+			route.Path, target = fmt.Sprint(list[0]), fmt.Sprint(list[1])
+		case "path":
+			route.Path = fmt.Sprint(value)
+		case "target":
+			target = fmt.Sprint(value)
+		case "strip_prefix":
+			strip, err := strconv.ParseBool(fmt.Sprint(value))
+			if err != nil {
+				return route, fmt.Errorf("server.routes.%s.strip_prefix: invalid value %v", name, value)
+			}
+			route.StripPrefix = strip
+		default:
+			return route, fmt.Errorf("unknown setting server.routes.%s.%s", name, field)
+		}
+	}
+	if !strings.HasPrefix(route.Path, "/") {
+		return route, fmt.Errorf("server.routes.%s: path %q must start with /", name, route.Path)
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return route, fmt.Errorf("server.routes.%s: target %q is not an http or https URL", name, target)
+	}
+	route.Target = u
+	return route, nil
+}
+
+// matches reports whether the route serves path
+func (r Route) matches(path string) bool {
+	return pathUnder(path, r.Path)
+}
+
+// pathUnder reports whether path is prefix or below it, segment by segment:
+// /health covers /health/live but not /health-admin. A prefix ending in /
+// matches everything under it, others also match themselves.
+func pathUnder(path, prefix string) bool {
+	if strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(path, prefix) || path+"/" == prefix
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Handler serves opts: the middleware, then the routes or the public
+// directory
+func Handler(opts Options) http.Handler {
+	routes := append([]Route(nil), opts.Routes...)
+	sort.SliceStable(routes, func(i, j int) bool { return len(routes[i].Path) > len(routes[j].Path) })
+	proxies := make([]http.Handler, len(routes))
+	for i, route := range routes {
+		proxies[i] = proxy(route)
+	}
+	files := http.FileServer(http.Dir(opts.Public))
+
+	var handler http.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		for i, route := range routes {
+			if route.matches(r.URL.Path) {
+				proxies[i].ServeHTTP(rw, r)
+				return
+			}
+		}
+		// Keep dotfiles, such as .env or .git, private
+		for _, part := range strings.Split(r.URL.Path, "/") {
+			if strings.HasPrefix(part, ".") {
+				http.NotFound(rw, r)
+				return
+			}
+		}
+		files.ServeHTTP(rw, r)
+	})
+	if opts.Gzip {
+		handler = gzipHandler(handler)
+	}
+	return chain(handler, opts.Middleware)
+}
+
+// proxy forwards requests to route.Target, with X-Forwarded headers and
+// the trace context of the request set
+func proxy(route Route) http.Handler {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			if route.StripPrefix {
+				prefix := strings.TrimSuffix(route.Path, "/")
+				r.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.Out.URL.Path, prefix), "/")
+				r.Out.URL.RawPath = ""
+			}
+			r.SetURL(route.Target)
+			r.SetXForwarded()
+			tracing.Inject(r.In.Context(), r.Out.Header)
+		},
+		ErrorHandler: func(rw http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("⚠️  route %s: %v", route.Name, err)
+			http.Error(rw, "bad gateway", http.StatusBadGateway)
+		},
+	}
+}
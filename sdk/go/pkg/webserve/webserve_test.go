@@ -0,0 +1,253 @@
+package webserve
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionsFrom(t *testing.T) {
+	opts, err := OptionsFrom(map[string]interface{}{
+		"server.port":                       "9090",
+		"server.gzip":                       false,
+		"server.tls_cert":                   "certs/site.crt",
+		"server.tls_key":                    "/etc/site.key",
+		"server.shutdown_timeout":           "3s",
+		"server.routes.api":                 []interface{}{"/api/", "http://localhost:3000"},
+		"server.routes.assets.path":         "/assets",
+		"server.routes.assets.target":       "https://cdn.internal/static",
+		"server.routes.assets.strip_prefix": true,
+		"database.host":                     "ignored",
+	}, "/srv/site")
+	if err != nil {
+		t.Fatalf("OptionsFrom failed: %v", err)
+	}
+	if opts.Addr() != "localhost:9090" || opts.Gzip || opts.Public != "/srv/site/public" ||
+		opts.TLSCert != "/srv/site/certs/site.crt" || opts.TLSKey != "/etc/site.key" || opts.ShutdownTimeout != 3*time.Second {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+	if len(opts.Routes) != 2 || opts.Routes[0].Name != "api" || opts.Routes[0].Target.String() != "http://localhost:3000" ||
+		opts.Routes[1].Path != "/assets" || !opts.Routes[1].StripPrefix {
+		t.Errorf("unexpected routes: %+v", opts.Routes)
+	}
+
+	for _, test := range []struct {
+		values map[string]interface{}
+		want   string
+	}{
+		{map[string]interface{}{"server.listen": "x"}, "unknown setting server.listen"},
+		{map[string]interface{}{"server.port": "http"}, "server.port: invalid value"},
+		{map[string]interface{}{"server.tls_cert": "a.crt"}, "must be set together"},
+		{map[string]interface{}{"server.routes.api": "/api"}, "must be a [path, target] list"},
+		{map[string]interface{}{"server.routes.api": []interface{}{"api", "http://x"}}, "must start with /"},
+		{map[string]interface{}{"server.routes.api": []interface{}{"/api", "localhost:3000"}}, "is not an http or https URL"},
+		{map[string]interface{}{"server.routes.api.upstream": "http://x"}, "unknown setting server.routes.api.upstream"},
+	} {
+		if _, err := OptionsFrom(test.values, "."); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: expected an error containing %q, got %v", test.values, test.want, err)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain")
+		io.WriteString(rw, r.URL.Path+" "+r.Header.Get("X-Forwarded-Host"))
+	}))
+	defer upstream.Close()
+
+	public := t.TempDir()
+	page := strings.Repeat("<p>hello</p>\n", 200)
+	os.WriteFile(filepath.Join(public, "index.html"), []byte(page), 0644)
+	os.WriteFile(filepath.Join(public, "small.txt"), []byte("small"), 0644)
+	os.WriteFile(filepath.Join(public, ".env"), []byte("SECRET=1"), 0644)
+
+	opts, err := OptionsFrom(map[string]interface{}{
+		"server.public":                 public,
+		"server.routes.api":             []interface{}{"/api/", upstream.URL},
+		"server.routes.v2.path":         "/api/v2",
+		"server.routes.v2.target":       upstream.URL + "/next",
+		"server.routes.v2.strip_prefix": true,
+	}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(Handler(opts))
+	defer server.Close()
+
+	get := func(path, encoding string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body io.Reader = resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			if body, err = gzip.NewReader(resp.Body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		data, _ := io.ReadAll(body)
+		return resp, string(data)
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	if _, body := get("/api/users", ""); body != "/api/users "+host {
+		t.Errorf("/api/users proxied as %q", body)
+	}
+	// The longest path wins and its prefix is stripped
+	if _, body := get("/api/v2/users", ""); body != "/next/users "+host {
+		t.Errorf("/api/v2/users proxied as %q", body)
+	}
+	if _, body := get("/api/v2", ""); body != "/next/ "+host {
+		t.Errorf("/api/v2 proxied as %q", body)
+	}
+
+	resp, body := get("/", "gzip, deflate")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "gzip" || body != page {
+		t.Errorf("/ should be served compressed, got %d %q", resp.StatusCode, resp.Header.Get("Content-Encoding"))
+	}
+	if resp, body = get("/", ""); resp.Header.Get("Content-Encoding") != "" || body != page {
+		t.Errorf("/ should not be compressed for clients without gzip")
+	}
+	if resp, body = get("/small.txt", "gzip"); resp.Header.Get("Content-Encoding") != "" || body != "small" {
+		t.Errorf("small files should not be compressed, got %q", resp.Header.Get("Content-Encoding"))
+	}
+	if resp, _ = get("/.env", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("dotfiles should not be served, got %d", resp.StatusCode)
+	}
+
+	down := Handler(Options{Routes: []Route{{Name: "down", Path: "/", Target: &url.URL{Scheme: "http", Host: "127.0.0.1:1"}}}})
+	rec := httptest.NewRecorder()
+	down.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("an unreachable upstream should give 502, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var trace []string
+	MustRegisterMiddleware("test_trace", func(s Settings) (Middleware, error) {
+		if err := s.Check("label"); err != nil {
+			return nil, err
+		}
+		label := s.String("label", "trace")
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				trace = append(trace, label+" "+RequestID(r.Context()))
+				next.ServeHTTP(rw, r)
+			})
+		}, nil
+	})
+	if err := RegisterMiddleware("cors", func(Settings) (Middleware, error) { return nil, nil }); err == nil {
+		t.Error("registering over a built-in middleware should fail")
+	}
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	opts, err := OptionsFrom(map[string]interface{}{
+		"server.public":                      t.TempDir(),
+		"server.middleware.order":            []interface{}{"request_id", "logging", "test_trace", "cors", "rate_limit", "auth"},
+		"server.middleware.test_trace.label": "seen",
+		"server.middleware.logging.format":   "json",
+		"server.middleware.cors.origins":     []interface{}{"https://app.example.com"},
+		"server.middleware.cors.credentials": true,
+		"server.middleware.rate_limit.rate":  1,
+		"server.middleware.rate_limit.burst": 3,
+		"server.middleware.auth.tokens":      []interface{}{"", "s3cret"},
+		"server.middleware.auth.exclude":     []interface{}{"/public/", "/health"},
+	}, ".")
+	if err != nil {
+		t.Fatalf("OptionsFrom failed: %v", err)
+	}
+	if len(opts.Middleware) != 6 || opts.Middleware[2].Name != "test_trace" {
+		t.Fatalf("unexpected chain: %+v", opts.Middleware)
+	}
+	handler := Handler(opts)
+	serve := func(method, path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("OPTIONS", "/api", "Origin", "https://app.example.com", "Access-Control-Request-Method", "PUT", "X-Request-ID", "req-1")
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		rec.Header().Get("Access-Control-Allow-Credentials") != "true" || rec.Header().Get("X-Request-ID") != "req-1" {
+		t.Errorf("unexpected preflight response: %d %v", rec.Code, rec.Header())
+	}
+	if len(trace) != 1 || trace[0] != "seen req-1" {
+		t.Errorf("custom middleware should run after request_id, got %v", trace)
+	}
+	if !strings.Contains(logs.String(), `"method":"OPTIONS"`) || !strings.Contains(logs.String(), `"request_id":"req-1"`) {
+		t.Errorf("unexpected log: %s", logs.String())
+	}
+
+	if rec = serve("GET", "/private", "Origin", "https://evil.example.com"); rec.Code != http.StatusUnauthorized ||
+		rec.Header().Get("Access-Control-Allow-Origin") != "" || len(rec.Header().Get("X-Request-ID")) != 32 {
+		t.Errorf("unexpected response without a token: %d %v", rec.Code, rec.Header())
+	}
+	// The empty token configured lets nothing in
+	if rec = serve("GET", "/private", "Authorization", "Bearer "); rec.Code != http.StatusUnauthorized {
+		t.Errorf("an empty token should be refused, got %d", rec.Code)
+	}
+	// Preflights stop at cors; the other requests spend the burst of 3
+	if rec = serve("GET", "/private", "Authorization", "Bearer s3cret"); rec.Code != http.StatusNotFound {
+		t.Errorf("a valid token should reach the files, got %d", rec.Code)
+	}
+	if rec = serve("GET", "/private", "Authorization", "Bearer s3cret"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected the rate limit, got %d %v", rec.Code, rec.Header())
+	}
+
+	opts.Middleware = opts.Middleware[5:]
+	handler = Handler(opts)
+	if rec = serve("GET", "/private", "Authorization", "Bearer s3cret"); rec.Code != http.StatusNotFound {
+		t.Errorf("a valid token should reach the files, got %d", rec.Code)
+	}
+	for _, path := range []string{"/public/x", "/health", "/health/live"} {
+		if rec = serve("GET", path); rec.Code != http.StatusNotFound {
+			t.Errorf("excluded path %s should not need a token, got %d", path, rec.Code)
+		}
+	}
+	for _, path := range []string{"/health-admin", "/healthz", "/publicity"} {
+		if rec = serve("GET", path); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s shares a prefix with an excluded path but is not under it, got %d", path, rec.Code)
+		}
+	}
+
+	for _, test := range []struct {
+		values map[string]interface{}
+		want   string
+	}{
+		{map[string]interface{}{"server.middleware.order": []interface{}{"gzip"}}, "unknown middleware gzip"},
+		{map[string]interface{}{"server.middleware.order": []interface{}{"cors", "cors"}}, "cors is listed twice"},
+		{map[string]interface{}{"server.middleware.cros.origins": "*"}, "server.middleware.cros: unknown middleware"},
+		{map[string]interface{}{"server.middleware.order": "auth"}, "server.middleware.auth: no credentials"},
+		{map[string]interface{}{"server.middleware.order": "auth", "server.middleware.auth.type": "basic", "server.middleware.auth.users": "admin"}, "entries must be user:password"},
+		{map[string]interface{}{"server.middleware.order": "cors", "server.middleware.cors.credentials": true}, "credentials cannot be allowed for every origin"},
+		{map[string]interface{}{"server.middleware.order": "rate_limit", "server.middleware.rate_limit.rate": "fast"}, "rate: fast is not a number"},
+		{map[string]interface{}{"server.middleware.order": "logging", "server.middleware.logging.level": "debug"}, "server.middleware.logging: unknown setting level"},
+	} {
+		if _, err := OptionsFrom(test.values, "."); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: expected an error containing %q, got %v", test.values, test.want, err)
+		}
+	}
+}